@@ -1,6 +1,7 @@
 package models
 
 import (
+	"context"
 	"time"
 
 	"gorm.io/gorm"
@@ -101,6 +102,12 @@ func NewUserRepository(db *gorm.DB) *UserRepository {
 	return &UserRepository{db: db}
 }
 
+// WithContext runs subsequent queries under ctx, so they stop when it is
+// canceled
+func (r *UserRepository) WithContext(ctx context.Context) *UserRepository {
+	return &UserRepository{db: r.db.WithContext(ctx)}
+}
+
 // Create creates a new user
 func (r *UserRepository) Create(user *User) error {
 	return r.db.Create(user).Error
@@ -212,6 +212,7 @@ func main() {
 		Short: "Rollback the last batch of migrations",
 		Run:   rollback,
 	}
+	rollbackCmd.Flags().Bool("force-data-loss", false, "Roll back even if Down drops tables or columns that hold data")
 
 	var statusCmd = &cobra.Command{
 		Use:   "status",
@@ -356,10 +357,18 @@ func rollback(cmd *cobra.Command, args []string) {
 		logger.Fatal("Failed to connect to database", zap.Error(err))
 	}
 
+	force, _ := cmd.Flags().GetBool("force-data-loss")
 	migrator := database.NewMigrator(db.GetSQLDB(), "migrations")
+	migrator.ForceDataLoss = force
 	result := migrator.Rollback()
-	
+	if result.Blocked {
+		logger.Fatal(result.Message)
+	}
+
 	logger.Info(result.Message)
+	for _, loss := range result.DataLoss {
+		logger.Warn("Dropped data", zap.String("detail", loss.String()))
+	}
 	if len(result.RolledBack) > 0 {
 		logger.Info("Rolled back migrations", zap.Any("migrations", result.RolledBack))
 		logger.Info("Batch", zap.Int("batch", result.Batch))
@@ -1,33 +1,74 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/go-chi/chi/v5"
+	"github.com/joho/godotenv"
 
 	"github.com/mrhoseah/dolphin/internal/app"
+	"github.com/mrhoseah/dolphin/internal/artifacts"
+	"github.com/mrhoseah/dolphin/internal/assets"
+	"github.com/mrhoseah/dolphin/internal/async"
 	"github.com/mrhoseah/dolphin/internal/auth"
+	"github.com/mrhoseah/dolphin/internal/cache"
+	"github.com/mrhoseah/dolphin/internal/cdn"
 	"github.com/mrhoseah/dolphin/internal/config"
 	"github.com/mrhoseah/dolphin/internal/database"
 	"github.com/mrhoseah/dolphin/internal/debug"
+	"github.com/mrhoseah/dolphin/internal/features"
+	"github.com/mrhoseah/dolphin/internal/frontend"
+	"github.com/mrhoseah/dolphin/internal/health"
+	"github.com/mrhoseah/dolphin/internal/i18n"
+	"github.com/mrhoseah/dolphin/internal/livereload"
 	"github.com/mrhoseah/dolphin/internal/logger"
 	"github.com/mrhoseah/dolphin/internal/maintenance"
+	"github.com/mrhoseah/dolphin/internal/media"
+	"github.com/mrhoseah/dolphin/internal/metering"
+	"github.com/mrhoseah/dolphin/internal/notify"
+	"github.com/mrhoseah/dolphin/internal/observability"
+	"github.com/mrhoseah/dolphin/internal/orm"
+	"github.com/mrhoseah/dolphin/internal/progress"
+	"github.com/mrhoseah/dolphin/internal/queue"
+	"github.com/mrhoseah/dolphin/internal/ratelimit"
 	"github.com/mrhoseah/dolphin/internal/router"
+	"github.com/mrhoseah/dolphin/internal/routing"
+	"github.com/mrhoseah/dolphin/internal/scan"
+	"github.com/mrhoseah/dolphin/internal/schedule"
+	"github.com/mrhoseah/dolphin/internal/search"
 	"github.com/mrhoseah/dolphin/internal/security"
+	"github.com/mrhoseah/dolphin/internal/seo"
+	"github.com/mrhoseah/dolphin/internal/sse"
+	"github.com/mrhoseah/dolphin/internal/startup"
+	"github.com/mrhoseah/dolphin/internal/storage"
+	views "github.com/mrhoseah/dolphin/internal/template"
+	"github.com/mrhoseah/dolphin/internal/tenancy"
+	dolphintime "github.com/mrhoseah/dolphin/internal/time"
+	"github.com/mrhoseah/dolphin/internal/webhooks"
+	"github.com/mrhoseah/dolphin/internal/workflow"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 var (
@@ -50,6 +91,18 @@ Examples:
   dolphin migrate                  # Run database migrations
   dolphin swagger                  # Generate API documentation`,
 		Version: version,
+		// Load the configuration for every command but those managing its
+		// cache, which must work while it is stale or invalid
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			if cmd.Annotations["config"] == "skip" {
+				return
+			}
+			var err error
+			cfg, err = config.Load()
+			if err != nil {
+				log.Fatal("Failed to load configuration: ", err)
+			}
+		},
 	}
 
 	// Command declarations moved here to avoid forward reference issues
@@ -78,9 +131,10 @@ Examples:
 	}
 
 	var liveReloadCmd = &cobra.Command{
-		Use:   "livereload",
-		Short: "Live reload management",
-		Long:  "Manage live reload and hot code reload for development.",
+		Use:     "dev",
+		Aliases: []string{"livereload"},
+		Short:   "Live reload development server",
+		Long:    "Rebuild and restart the app on file changes and refresh connected browsers.",
 	}
 
 	var assetCmd = &cobra.Command{
@@ -130,6 +184,19 @@ Examples:
 	}
 	updateCmd.Flags().StringP("version", "V", "main", "Version to install (e.g., v0.1.0 or 'main')")
 
+	// Upgrade command
+	var upgradeCmd = &cobra.Command{
+		Use:   "upgrade",
+		Short: "Opt the current app into new framework middleware",
+		Long:  "Show framework feature gates and enable them in config/config.yaml. Gates default to off so framework upgrades don't change runtime behavior until you opt in.",
+		Run:   upgradeApp,
+	}
+	upgradeCmd.Flags().StringSlice("enable", nil, "Feature gates to enable (e.g. compression,security_headers)")
+	upgradeCmd.Flags().Bool("all", false, "Enable every feature gate")
+	upgradeCmd.Flags().String("config", "config/config.yaml", "Config file to update")
+	upgradeCmd.Flags().Bool("dry-run", false, "Show what would change without writing")
+	upgradeCmd.Flags().BoolP("yes", "y", false, "Skip confirmation")
+
 	// Uninstall command
 	var uninstallCmd = &cobra.Command{
 		Use:   "uninstall",
@@ -146,10 +213,12 @@ Examples:
 		Run:   newProject,
 	}
 	newCmd.Flags().Bool("auth", false, "Include auth scaffolding (views and links)")
+	newCmd.Flags().String("frontend", "", "Scaffold a Vite frontend: vite-react or vite-vue")
 
 	// Add global flags
 	rootCmd.PersistentFlags().StringP("config", "c", "config/config.yaml", "Config file path")
 	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "Verbose output")
+	rootCmd.PersistentFlags().String("output", "text", "Output format: text, or json to print progress as plain lines on stderr")
 
 	// Serve command
 	var serveCmd = &cobra.Command{
@@ -169,6 +238,7 @@ Examples:
 		Run:   migrate,
 	}
 	migrateCmd.Flags().BoolP("force", "f", false, "Force migration without confirmation")
+	migrateCmd.Flags().String("database", "", "Only run migrations targeting this connection (default: every connection)")
 
 	var rollbackCmd = &cobra.Command{
 		Use:   "rollback",
@@ -177,6 +247,8 @@ Examples:
 		Run:   rollback,
 	}
 	rollbackCmd.Flags().IntP("steps", "s", 1, "Number of migration batches to rollback")
+	rollbackCmd.Flags().Bool("force-data-loss", false, "Roll back even if Down drops tables or columns that hold data")
+	rollbackCmd.Flags().String("database", database.DefaultConnection, "Connection whose migrations to roll back")
 
 	var statusCmd = &cobra.Command{
 		Use:   "status",
@@ -184,6 +256,7 @@ Examples:
 		Long:  "Display the current status of all migrations",
 		Run:   status,
 	}
+	statusCmd.Flags().String("database", "", "Only show migrations targeting this connection (default: every connection)")
 
 	var freshCmd = &cobra.Command{
 		Use:   "fresh",
@@ -192,6 +265,15 @@ Examples:
 		Run:   fresh,
 	}
 
+	var migrateFromTagsCmd = &cobra.Command{
+		Use:   "migrate:from-tags [Model]",
+		Short: "Generate a migration for a model's tagged indexes and foreign keys",
+		Long:  "Read index, uniqueIndex and foreignKey tags on a model and generate a migration adding the indexes and constraints the database is missing",
+		Args:  cobra.ExactArgs(1),
+		Run:   migrateFromTags,
+	}
+	migrateFromTagsCmd.Flags().String("models-dir", "app/models", "Directory containing the model sources")
+
 	// Make commands
 	var makeControllerCmd = &cobra.Command{
 		Use:   "make:controller [name]",
@@ -212,14 +294,20 @@ Examples:
 	}
 	makeModelCmd.Flags().BoolP("migration", "m", false, "Create a migration for the model")
 	makeModelCmd.Flags().BoolP("factory", "f", false, "Create a factory for the model")
+	makeModelCmd.Flags().Bool("soft-deletes", true, "Add a deleted_at column so deletes can be restored")
+	makeModelCmd.Flags().Duration("prune-after", 0, "Make soft-deleted rows prunable after this period (e.g. 720h)")
 
 	var makeMigrationCmd = &cobra.Command{
 		Use:   "make:migration [name]",
 		Short: "Create a new migration",
-		Long:  "Generate a new database migration file using Raptor migration system",
-		Args:  cobra.ExactArgs(1),
+		Long:  "Generate a new database migration file using Raptor migration system. With --from-model the migration is generated by diffing the model against the database.",
+		Args:  cobra.MaximumNArgs(1),
 		Run:   makeMigration,
 	}
+	makeMigrationCmd.Flags().String("from-model", "", "Generate ALTER TABLE steps bringing this model's table up to date")
+	makeMigrationCmd.Flags().String("models-dir", "app/models", "Directory containing the model sources")
+	makeMigrationCmd.Flags().Bool("dry-run", false, "Print the SQL instead of writing a migration (with --from-model)")
+	makeMigrationCmd.Flags().String("database", "", "Connection the migration runs on, e.g. analytics")
 
 	var makeMiddlewareCmd = &cobra.Command{
 		Use:   "make:middleware [name]",
@@ -236,6 +324,25 @@ Examples:
 		Args:  cobra.ExactArgs(1),
 		Run:   makeModule,
 	}
+	makeModuleCmd.Flags().Bool("soft-deletes", true, "Add a deleted_at column so deletes can be restored")
+	makeModuleCmd.Flags().Duration("prune-after", 0, "Make soft-deleted rows prunable after this period (e.g. 720h)")
+
+	var moduleCreateCmd = &cobra.Command{
+		Use:   "module:create [name]",
+		Short: "Create a self-contained module",
+		Long:  "Generate modules/<name>, a module with its public API package at the root and its model, repository, handlers and migrations behind it, wired into bootstrap/controllers.go",
+		Args:  cobra.ExactArgs(1),
+		Run:   moduleCreate,
+	}
+	moduleCreateCmd.Flags().String("model", "", "Name of the module's model (default: the module name, capitalized)")
+
+	var moduleLintCmd = &cobra.Command{
+		Use:   "module:lint",
+		Short: "Check module boundaries",
+		Long:  "Check that code only imports the public API package of each module under modules/, failing when it imports their other packages",
+		Args:  cobra.NoArgs,
+		Run:   moduleLint,
+	}
 
 	var makeViewCmd = &cobra.Command{
 		Use:   "make:view [name]",
@@ -252,6 +359,20 @@ Examples:
 		Args:  cobra.ExactArgs(1),
 		Run:   makeResource,
 	}
+	makeResourceCmd.Flags().Bool("cursor", false, "Generate a cursor (keyset) paginated Index endpoint")
+	makeResourceCmd.Flags().String("parent", "", "Nest the resource under a parent resource (e.g. --parent Post)")
+	makeResourceCmd.Flags().Bool("shallow", false, "Use shallow member routes for nested resources")
+	makeResourceCmd.Flags().Bool("soft-deletes", true, "Add a deleted_at column plus restore and force-delete endpoints")
+	makeResourceCmd.Flags().Duration("prune-after", 0, "Make soft-deleted rows prunable after this period (e.g. 720h)")
+	makeResourceCmd.Flags().Bool("export", false, "Add a GET /export endpoint streaming the filtered collection as CSV or XLSX")
+
+	var makeResourceTransformerCmd = &cobra.Command{
+		Use:   "make:resource-transformer [name]",
+		Short: "Create an API resource transformer",
+		Long:  "Generate an API resource transformer controlling serialized fields, conditional fields, and included relations",
+		Args:  cobra.ExactArgs(1),
+		Run:   makeResourceTransformer,
+	}
 
 	var makeRepositoryCmd = &cobra.Command{
 		Use:   "make:repository [name]",
@@ -301,6 +422,87 @@ Examples:
 		Run:   storageGet,
 	}
 
+	var cdnPurgeCmd = &cobra.Command{
+		Use:   "cdn:purge [keys...]",
+		Short: "Purge CDN responses by surrogate key",
+		Long:  "Purge the responses tagged with the surrogate keys (e.g. posts or posts:7) from the CDN of cdn.driver",
+		Args:  cobra.MinimumNArgs(1),
+		Run:   cdnPurge,
+	}
+
+	var notifyTestCmd = &cobra.Command{
+		Use:   "notify:test <to>",
+		Short: "Send a test notification",
+		Long:  "Send a test notification by SMS to a phone number, or by push to a device token or Web Push endpoint, through the drivers in the notifications config",
+		Args:  cobra.ExactArgs(1),
+		Run:   notifyTest,
+	}
+	notifyTestCmd.Flags().String("channel", notify.ChannelSMS, "Channel to send through: sms or push")
+	notifyTestCmd.Flags().String("platform", notify.PlatformFCM, "Push platform: fcm, apns or webpush")
+	notifyTestCmd.Flags().String("p256dh", "", "Web Push subscription's p256dh key")
+	notifyTestCmd.Flags().String("auth", "", "Web Push subscription's auth secret")
+	notifyTestCmd.Flags().String("title", "Dolphin", "Notification title")
+	notifyTestCmd.Flags().String("message", "This is a test notification.", "Notification body")
+
+	var notifyVapidCmd = &cobra.Command{
+		Use:   "notify:vapid",
+		Short: "Generate a VAPID key pair for Web Push",
+		Long:  "Generate the VAPID key pair Web Push requests are signed with, to set as notifications.push.webpush.vapid_public_key and vapid_private_key",
+		Run:   notifyVapid,
+	}
+
+	var securityBanCmd = &cobra.Command{
+		Use:   "security:ban <ip>",
+		Short: "Ban an IP address or CIDR range",
+		Long:  "Add an IP address or CIDR range (e.g. 203.0.113.0/24) to the ban list, refusing its requests on every instance within intrusion.ban_refresh",
+		Args:  cobra.ExactArgs(1),
+		Run:   securityBan,
+	}
+	securityBanCmd.Flags().Duration("for", 0, "Lift the ban after this long, e.g. 72h (default: forever)")
+	securityBanCmd.Flags().String("reason", "manual", "Why the IP is banned")
+
+	var securityUnbanCmd = &cobra.Command{
+		Use:   "security:unban <ip>",
+		Short: "Lift the ban on an IP address or CIDR range",
+		Args:  cobra.ExactArgs(1),
+		Run:   securityUnban,
+	}
+
+	var securityBansCmd = &cobra.Command{
+		Use:   "security:bans",
+		Short: "List banned IPs",
+		Long:  "List the IP addresses and ranges banned by hand or by intrusion detection, with why and until when",
+		Run:   securityBans,
+	}
+
+	var seoRobotsCmd = &cobra.Command{
+		Use:   "seo:robots",
+		Short: "Print the robots.txt the app serves",
+		Long:  "Print the robots.txt generated from the seo config, or its template override, for the app environment or another one (staging disallows every crawler by default), or write it to a file for static hosting",
+		Run:   seoRobots,
+	}
+	seoRobotsCmd.Flags().String("env", "", "Environment to generate for (default: app.environment)")
+	seoRobotsCmd.Flags().String("write", "", "Write to this file instead of printing, e.g. public/robots.txt")
+
+	var artifactsClearCmd = &cobra.Command{
+		Use:   "artifacts:clear [prefix]",
+		Short: "Delete cached generated artifacts",
+		Long:  "Delete the cached PDF invoices, report exports and other generated artifacts whose keys are under prefix, such as invoices, or all of them; they are rendered again on their next download",
+		Args:  cobra.MaximumNArgs(1),
+		Run:   artifactsClear,
+	}
+
+	var storageVerifyCmd = &cobra.Command{
+		Use:   "storage:verify",
+		Short: "Check storage disks end to end",
+		Long:  "Write files of random bytes to each configured disk, read them back comparing SHA-256 checksums and delete them, reporting put, get and delete latency percentiles and the step that failed. Exits 1 when any disk fails.",
+		Run:   storageVerify,
+	}
+	storageVerifyCmd.Flags().String("disk", "", "Only verify this disk (default: every configured disk)")
+	storageVerifyCmd.Flags().Int("rounds", 10, "Files written, read and deleted per disk")
+	storageVerifyCmd.Flags().Int("size", 64<<10, "Size of each file in bytes")
+	storageVerifyCmd.Flags().Duration("timeout", time.Minute, "Give up on a disk after this long")
+
 	var cacheCmd = &cobra.Command{
 		Use:   "cache",
 		Short: "Cache management commands",
@@ -341,18 +543,163 @@ Examples:
 	var makeRequestCmd = &cobra.Command{
 		Use:   "make:request [name]",
 		Short: "Create a new form request",
-		Long:  "Generate a new form request with validation rules",
+		Long:  "Generate a new request DTO bound from route params, query, headers, and body with validation rules",
 		Args:  cobra.ExactArgs(1),
 		Run:   makeRequest,
 	}
 
+	var makeUploadCmd = &cobra.Command{
+		Use:   "make:upload [name]",
+		Short: "Create an upload controller",
+		Long:  "Generate a controller accepting validated file uploads, storing them and making image thumbnails, with its routes. With --resumable, large files such as videos are taken in chunks over a tus endpoint of the controller's own, with an HTMX upload page showing progress.",
+		Args:  cobra.ExactArgs(1),
+		Run:   makeUpload,
+	}
+	makeUploadCmd.Flags().Bool("resumable", false, "Take uploads in chunks that resume after dropped connections, with an HTMX upload page")
+
+	var makeTenantCmd = &cobra.Command{
+		Use:   "make:tenant [id]",
+		Short: "Create a new tenant",
+		Long:  "Generate app/tenants/<id>.go registering the tenant with the tenancy store",
+		Args:  cobra.ExactArgs(1),
+		Run:   makeTenant,
+	}
+
+	var makePaymentHandlerCmd = &cobra.Command{
+		Use:   "make:payment-handler [name]",
+		Short: "Create a new payment provider",
+		Long:  "Generate app/gateways/<name>.go, a payment provider registered with the payments package and configured under payments.providers.<name>",
+		Args:  cobra.ExactArgs(1),
+		Run:   makePaymentHandler,
+	}
+
+	var makeObserverCmd = &cobra.Command{
+		Use:   "make:observer [model]",
+		Short: "Create a new model observer",
+		Long:  "Generate app/observers/<model>_observer.go, reacting to the model being created, updated, deleted and restored",
+		Args:  cobra.ExactArgs(1),
+		Run:   makeObserver,
+	}
+
 	// Database commands
 	var dbSeedCmd = &cobra.Command{
 		Use:   "db:seed",
 		Short: "Run database seeders",
-		Long:  "Run all database seeders to populate the database with test data",
+		Long:  "Run the seeders registered by the application and its modules, in registration order, to populate the database with test data",
 		Run:   dbSeed,
 	}
+	dbSeedCmd.Flags().StringSlice("seeder", nil, "Only run these seeders, in this order")
+
+	var modelPruneCmd = &cobra.Command{
+		Use:   "model:prune",
+		Short: "Permanently delete expired soft-deleted rows",
+		Long:  "Remove soft-deleted rows older than each prunable model's retention period and the tables configured under database.prune",
+		Run:   modelPrune,
+	}
+	modelPruneCmd.Flags().StringSlice("table", nil, "Only prune these tables")
+	modelPruneCmd.Flags().Duration("every", 0, "Keep running and prune on this interval (e.g. 24h)")
+	modelPruneCmd.Flags().Bool("pretend", false, "Report prunable tables without deleting anything")
+	modelPruneCmd.Flags().Bool("without-overlapping", false, "With --every, skip a run while another instance is pruning (locks in cache.locks)")
+
+	var searchImportCmd = &cobra.Command{
+		Use:   "search:import [model]",
+		Short: "Index a searchable model's rows",
+		Long:  "Index every row of a registered searchable model, named by its type, index or table, or of all of them without one",
+		Args:  cobra.MaximumNArgs(1),
+		Run:   searchImport,
+	}
+	searchImportCmd.Flags().Bool("flush", false, "Remove the index before importing, dropping documents whose rows are gone")
+
+	var searchFlushCmd = &cobra.Command{
+		Use:   "search:flush [model]",
+		Short: "Remove a searchable model's index",
+		Args:  cobra.ExactArgs(1),
+		Run:   searchFlush,
+	}
+
+	var tenantsMigrateCmd = &cobra.Command{
+		Use:   "tenants:migrate",
+		Short: "Run migrations for every tenant",
+		Long:  "Run pending migrations in each tenant's database or schema, creating schemas as needed",
+		Run:   tenantsMigrate,
+	}
+	tenantsMigrateCmd.Flags().StringSlice("tenant", nil, "Only migrate these tenants")
+
+	var dbExplainCmd = &cobra.Command{
+		Use:   "db:explain [sql]",
+		Short: "Show the query plan for a statement",
+		Long:  "Run EXPLAIN on a statement and print the plan. SELECTs use EXPLAIN ANALYZE on Postgres and MySQL, which executes them.",
+		Args:  cobra.ExactArgs(1),
+		Run:   dbExplain,
+	}
+	dbExplainCmd.Flags().Bool("analyze", true, "Use EXPLAIN ANALYZE where supported (SELECT only)")
+
+	var dbOptimizeCmd = &cobra.Command{
+		Use:   "db:optimize",
+		Short: "Run index and statistics maintenance",
+		Long:  "Run driver-appropriate maintenance on tables: VACUUM (ANALYZE) on Postgres, OPTIMIZE TABLE on MySQL, REINDEX and ANALYZE on SQLite. It refuses to run during database.optimize.peak_hours unless --force is given.",
+		Run:   dbOptimize,
+	}
+	dbOptimizeCmd.Flags().StringSlice("table", nil, "Only optimize these tables (default database.optimize.tables, or every table)")
+	dbOptimizeCmd.Flags().Duration("every", 0, "Keep running and optimize on this interval (e.g. 24h), skipping runs during peak hours")
+	dbOptimizeCmd.Flags().Bool("force", false, "Run even during peak hours")
+	dbOptimizeCmd.Flags().Bool("pretend", false, "Print the statements without running them")
+	dbOptimizeCmd.Flags().Bool("without-overlapping", false, "With --every, skip a run while another instance is optimizing (locks in cache.locks)")
+
+	var dbAnonymizeCmd = &cobra.Command{
+		Use:   "db:anonymize",
+		Short: "Replace personal data with fake values",
+		Long:  "Rewrite the tables and columns mapped in an anonymization config with fake emails, names, phone numbers and more, so a production dump can be loaded into staging. Rows are updated in chunks.",
+		Run:   dbAnonymize,
+	}
+	dbAnonymizeCmd.Flags().String("config", "config/anonymize.yaml", "Anonymization config mapping tables and columns to strategies")
+	dbAnonymizeCmd.Flags().StringSlice("table", nil, "Only anonymize these tables")
+	dbAnonymizeCmd.Flags().Bool("force", false, "Skip the confirmation and allow running in production")
+
+	var workflowListCmd = &cobra.Command{
+		Use:   "workflow:list",
+		Short: "List workflow instances",
+		Long:  "List workflow instances from the workflow_instances table, most recently updated first, with the step each is on and why failed ones stopped.",
+		Run:   workflowList,
+	}
+	workflowListCmd.Flags().StringSlice("status", nil, "Only list these statuses (pending, running, waiting, completed, compensating, compensated, failed)")
+	workflowListCmd.Flags().String("workflow", "", "Only list instances of this workflow")
+	workflowListCmd.Flags().Int("limit", 50, "Maximum number of instances to list")
+
+	var workflowRetryCmd = &cobra.Command{
+		Use:   "workflow:retry <id>",
+		Short: "Retry a compensated or failed workflow instance",
+		Long:  "Restart a compensated instance from its first step, or resume compensating a failed one. The application's workflow worker runs it.",
+		Args:  cobra.ExactArgs(1),
+		Run:   workflowRetry,
+	}
+
+	var webhooksListCmd = &cobra.Command{
+		Use:   "webhooks:list",
+		Short: "List captured inbound webhooks",
+		Long:  "List the inbound webhooks kept in the webhook_deliveries table with webhooks.capture on, newest first, with the status the application answered.",
+		Run:   webhooksList,
+	}
+	webhooksListCmd.Flags().String("source", "", "Only list deliveries from this source (payments, mail, or a webhook:<source> alias)")
+	webhooksListCmd.Flags().Bool("failed", false, "Only list deliveries the application didn't acknowledge")
+	webhooksListCmd.Flags().Int("limit", 50, "Maximum number of deliveries to list")
+
+	var webhooksReplayCmd = &cobra.Command{
+		Use:   "webhooks:replay <id>",
+		Short: "Process a captured webhook again",
+		Long:  "Serve a captured webhook through the application's routes again, in process, so a delivery that failed is reprocessed after a fix. Signatures are checked as of when it arrived.",
+		Args:  cobra.ExactArgs(1),
+		Run:   webhooksReplay,
+	}
+
+	var queueWorkCmd = &cobra.Command{
+		Use:   "queue:work",
+		Short: "Process queued jobs",
+		Long:  "Consume jobs from a queue connection (memory, kafka or nats) and run the handlers registered for their types: media variants, workflow steps and, when enabled, index syncs and upload scans. Jobs failing their schema in queue.schemas are dropped. Stops on Ctrl+C.",
+		Run:   queueWork,
+	}
+	queueWorkCmd.Flags().String("connection", "", "Queue connection to consume (default queue.default)")
+	queueWorkCmd.Flags().StringSlice("queue", []string{"default"}, "Queues to consume, each in its own worker")
 
 	var dbWipeCmd = &cobra.Command{
 		Use:   "db:wipe",
@@ -403,7 +750,18 @@ Examples:
 		Long:  "Manage Dolphin debugging tools and dashboard",
 	}
 
-	debugCmd.AddCommand(debugServeCmd, debugStatusCmd, debugGCCmd)
+	var debugExportCmd = &cobra.Command{
+		Use:   "export <id>",
+		Short: "Print a recorded request as a curl command",
+		Long:  "Print a request recorded by the debug dashboard as a curl command, read from debug.record_file when set or else from the running server",
+		Args:  cobra.ExactArgs(1),
+		Run:   debugExport,
+	}
+	debugExportCmd.Flags().String("host", "http://localhost", "Application server host")
+	debugExportCmd.Flags().IntP("port", "p", 0, "Application server port (default server.port)")
+	debugExportCmd.Flags().String("file", "", "Recording file to read (default debug.record_file)")
+
+	debugCmd.AddCommand(debugServeCmd, debugStatusCmd, debugGCCmd, debugExportCmd)
 
 	// Rate limit command group
 	var rateLimitCmd = &cobra.Command{
@@ -439,24 +797,30 @@ Examples:
 	var healthCheckCmd = &cobra.Command{
 		Use:   "check",
 		Short: "Run health checks",
-		Long:  "Run all configured health checks and display results.",
+		Long:  "Run all configured health checks in this process and display results. Exits 1 when unhealthy.",
 		Run:   healthCheck,
 	}
+	healthCheckCmd.Flags().Bool("json", false, "Print the results as JSON")
 
 	var healthLiveCmd = &cobra.Command{
 		Use:   "live",
 		Short: "Check liveness",
-		Long:  "Check if the application is alive (basic health check).",
+		Long:  "Query /health/live on the running application.",
 		Run:   healthLive,
 	}
 
 	var healthReadyCmd = &cobra.Command{
 		Use:   "ready",
 		Short: "Check readiness",
-		Long:  "Check if the application is ready to serve traffic.",
+		Long:  "Query /health/ready on the running application.",
 		Run:   healthReady,
 	}
 
+	for _, c := range []*cobra.Command{healthLiveCmd, healthReadyCmd} {
+		c.Flags().String("url", "", "Application base URL (default http://localhost:<server.port>)")
+		c.Flags().Bool("json", false, "Print the response as JSON")
+	}
+
 	healthCmd.AddCommand(healthCheckCmd, healthLiveCmd, healthReadyCmd)
 
 	// Mail command group
@@ -558,28 +922,6 @@ Examples:
 		Run:   policyTest,
 	}
 
-	var credentialsCmd = &cobra.Command{
-		Use:   "credentials",
-		Short: "Manage encrypted credentials",
-		Long:  "Encrypt, decrypt, and manage application credentials securely.",
-	}
-
-	var credentialsEncryptCmd = &cobra.Command{
-		Use:   "encrypt <file>",
-		Short: "Encrypt credentials file",
-		Long:  "Encrypt a .env file containing sensitive credentials.",
-		Args:  cobra.ExactArgs(1),
-		Run:   credentialsEncrypt,
-	}
-
-	var credentialsDecryptCmd = &cobra.Command{
-		Use:   "decrypt <file>",
-		Short: "Decrypt credentials file",
-		Long:  "Decrypt credentials and output to a file.",
-		Args:  cobra.ExactArgs(1),
-		Run:   credentialsDecrypt,
-	}
-
 	var csrfCmd = &cobra.Command{
 		Use:   "csrf",
 		Short: "CSRF protection tools",
@@ -594,9 +936,8 @@ Examples:
 	}
 
 	policyCmd.AddCommand(policyCreateCmd, policyTestCmd)
-	credentialsCmd.AddCommand(credentialsEncryptCmd, credentialsDecryptCmd)
 	csrfCmd.AddCommand(csrfGenerateCmd)
-	securityAdvancedCmd.AddCommand(policyCmd, credentialsCmd, csrfCmd)
+	securityAdvancedCmd.AddCommand(policyCmd, newCredentialsCmd(), csrfCmd)
 
 	var postmanGenerateCmd = &cobra.Command{
 		Use:   "postman:generate",
@@ -609,7 +950,7 @@ Examples:
 	var routeListCmd = &cobra.Command{
 		Use:   "route:list",
 		Short: "List all registered routes",
-		Long:  "Display all registered routes with their methods and middleware",
+		Long:  "Display all registered routes with their methods and the middleware groups and aliases they run",
 		Run:   routeList,
 	}
 
@@ -677,6 +1018,50 @@ Examples:
 
 	maintenanceCmd.AddCommand(maintenanceDownCmd, maintenanceUpCmd, maintenanceStatusCmd)
 
+	var readOnlyOnCmd = &cobra.Command{
+		Use:   "on",
+		Short: "Refuse writes while reads keep working",
+		Long:  "Enable read-only mode: POST, PUT, PATCH and DELETE requests get 503 while GETs are served",
+		Run:   readOnlyOn,
+	}
+	readOnlyOnCmd.Flags().StringP("message", "m", "", "Message shown for refused writes (default: read_only.message)")
+	readOnlyOnCmd.Flags().IntP("retry-after", "r", 0, "Retry-After header value in seconds (default: read_only.retry_after)")
+
+	var readOnlyOffCmd = &cobra.Command{
+		Use:   "off",
+		Short: "Accept writes again",
+		Long:  "Disable the runtime read-only toggle",
+		Run:   readOnlyOff,
+	}
+
+	var readOnlyStatusCmd = &cobra.Command{
+		Use:   "status",
+		Short: "Check read-only mode status",
+		Run:   readOnlyStatus,
+	}
+
+	var readOnlyCmd = &cobra.Command{
+		Use:   "read-only",
+		Short: "Read-only mode management",
+		Long:  "Keep serving reads while refusing writes, e.g. during a database failover",
+	}
+	readOnlyCmd.AddCommand(readOnlyOnCmd, readOnlyOffCmd, readOnlyStatusCmd)
+
+	var meteringExportCmd = &cobra.Command{
+		Use:   "metering:export",
+		Short: "Export usage for billing",
+		Long:  "Export metered usage (API calls, jobs, storage bytes) per tenant as CSV or JSON, or send it to the billing webhook",
+		Run:   meteringExport,
+	}
+	meteringExportCmd.Flags().String("from", "", "Start date, YYYY-MM-DD or RFC3339 (default: start of this month)")
+	meteringExportCmd.Flags().String("to", "", "End date, exclusive (default: now)")
+	meteringExportCmd.Flags().String("tenant", "", "Only export this tenant")
+	meteringExportCmd.Flags().String("metric", "", "Only export this metric")
+	meteringExportCmd.Flags().Duration("window", 0, "Roll usage up into windows of this size, e.g. 24h (default: as stored)")
+	meteringExportCmd.Flags().String("format", "csv", "Output format: csv or json")
+	meteringExportCmd.Flags().StringP("output", "o", "", "Write to this file instead of stdout")
+	meteringExportCmd.Flags().Bool("webhook", false, "POST the usage to metering.webhook_url")
+
 	var staticPageCmd = &cobra.Command{
 		Use:   "make:page [name]",
 		Short: "Create a static page",
@@ -737,6 +1122,7 @@ Examples:
 	rootCmd.AddCommand(serveCmd)
 	rootCmd.AddCommand(testCmd)
 	rootCmd.AddCommand(updateCmd)
+	rootCmd.AddCommand(upgradeCmd)
 	rootCmd.AddCommand(uninstallCmd)
 	rootCmd.AddCommand(newCmd)
 
@@ -745,6 +1131,7 @@ Examples:
 	rootCmd.AddCommand(rollbackCmd)
 	rootCmd.AddCommand(statusCmd)
 	rootCmd.AddCommand(freshCmd)
+	rootCmd.AddCommand(migrateFromTagsCmd)
 
 	// Make commands
 	rootCmd.AddCommand(makeControllerCmd)
@@ -752,24 +1139,54 @@ Examples:
 	rootCmd.AddCommand(makeMigrationCmd)
 	rootCmd.AddCommand(makeMiddlewareCmd)
 	rootCmd.AddCommand(makeModuleCmd)
+	rootCmd.AddCommand(moduleCreateCmd)
+	rootCmd.AddCommand(moduleLintCmd)
 	rootCmd.AddCommand(makeViewCmd)
 	rootCmd.AddCommand(makeResourceCmd)
+	rootCmd.AddCommand(makeResourceTransformerCmd)
 	rootCmd.AddCommand(makeRepositoryCmd)
 	rootCmd.AddCommand(makeProviderCmd)
 	rootCmd.AddCommand(makeSeederCmd)
 	rootCmd.AddCommand(makeRequestCmd)
+	rootCmd.AddCommand(makeUploadCmd)
+	rootCmd.AddCommand(makeTenantCmd)
+	rootCmd.AddCommand(makePaymentHandlerCmd)
+	rootCmd.AddCommand(makeObserverCmd)
 
 	// Storage commands
 	storageCmd.AddCommand(storageListCmd)
 	storageCmd.AddCommand(storagePutCmd)
 	storageCmd.AddCommand(storageGetCmd)
 	rootCmd.AddCommand(storageCmd)
+	rootCmd.AddCommand(storageVerifyCmd)
+
+	// CDN commands
+	rootCmd.AddCommand(cdnPurgeCmd)
+
+	// Notification commands
+	rootCmd.AddCommand(notifyTestCmd)
+	rootCmd.AddCommand(notifyVapidCmd)
+
+	// Ban list commands
+	rootCmd.AddCommand(securityBanCmd)
+	rootCmd.AddCommand(securityUnbanCmd)
+	rootCmd.AddCommand(securityBansCmd)
+
+	// SEO commands
+	rootCmd.AddCommand(seoRobotsCmd)
+
+	// Artifact commands
+	rootCmd.AddCommand(artifactsClearCmd)
 
 	// Event commands
 	rootCmd.AddCommand(eventCmd)
 
 	// Maintenance commands
 	rootCmd.AddCommand(maintenanceCmd)
+	rootCmd.AddCommand(readOnlyCmd)
+
+	// Metering commands
+	rootCmd.AddCommand(meteringExportCmd)
 
 	// Static page commands
 	rootCmd.AddCommand(staticPageCmd)
@@ -784,8 +1201,22 @@ Examples:
 
 	// Database commands
 	rootCmd.AddCommand(dbSeedCmd)
+	rootCmd.AddCommand(modelPruneCmd)
+	rootCmd.AddCommand(searchImportCmd)
+	rootCmd.AddCommand(searchFlushCmd)
+	rootCmd.AddCommand(tenantsMigrateCmd)
+	rootCmd.AddCommand(dbExplainCmd)
+	rootCmd.AddCommand(dbOptimizeCmd)
+	rootCmd.AddCommand(dbAnonymizeCmd)
 	rootCmd.AddCommand(dbWipeCmd)
 
+	// Workflow commands
+	rootCmd.AddCommand(workflowListCmd)
+	rootCmd.AddCommand(workflowRetryCmd)
+	rootCmd.AddCommand(webhooksListCmd)
+	rootCmd.AddCommand(webhooksReplayCmd)
+	rootCmd.AddCommand(queueWorkCmd)
+
 	// Documentation
 	rootCmd.AddCommand(swaggerCmd)
 	rootCmd.AddCommand(postmanGenerateCmd)
@@ -801,6 +1232,7 @@ Examples:
 	rootCmd.AddCommand(securityCmd)
 	rootCmd.AddCommand(validationCmd)
 	rootCmd.AddCommand(securityAdvancedCmd)
+	rootCmd.AddCommand(newCredentialsCmd())
 	rootCmd.AddCommand(observabilityCmd)
 	rootCmd.AddCommand(gracefulCmd)
 	rootCmd.AddCommand(circuitCmd)
@@ -978,16 +1410,25 @@ Examples:
 		Run:   templateStats,
 	}
 
-	templateCmd.AddCommand(templateListCmd, templateCompileCmd, templateWatchCmd, templateHelperCmd, templateTestCmd, templateStatsCmd)
+	var templateLintCmd = &cobra.Command{
+		Use:   "lint",
+		Short: "Check templates for accessibility problems",
+		Long:  "Check templates for images without alt text and form controls without a label. Exits with status 1 when any are found.",
+		Run:   templateLint,
+	}
+
+	templateCmd.AddCommand(templateListCmd, templateCompileCmd, templateWatchCmd, templateHelperCmd, templateTestCmd, templateStatsCmd, templateLintCmd)
 
 	// Asset pipeline command group
 
 	var assetBuildCmd = &cobra.Command{
 		Use:   "build",
 		Short: "Build assets",
-		Long:  "Build and process all assets in the pipeline.",
+		Long:  "Build and process all assets in the pipeline. Files and bundles unchanged since the last build, by content hash, are skipped; changing the pipeline configuration rebuilds everything.",
 		Run:   assetBuild,
 	}
+	assetBuildCmd.Flags().Bool("force", false, "Rebuild every file and bundle, ignoring the build cache")
+	assetBuildCmd.Flags().String("config", "config/assets.yaml", "Asset pipeline config (the defaults when missing)")
 
 	var assetWatchCmd = &cobra.Command{
 		Use:   "watch",
@@ -1038,45 +1479,57 @@ Examples:
 	var liveReloadStartCmd = &cobra.Command{
 		Use:   "start",
 		Short: "Start live reload development server",
-		Long:  "Start the development server with live reload enabled.",
+		Long:  "Build and run the app, rebuilding and restarting it when files change, until interrupted.",
 		Run:   liveReloadStart,
 	}
 
 	var liveReloadStopCmd = &cobra.Command{
 		Use:   "stop",
 		Short: "Stop live reload development server",
-		Long:  "Stop the live reload development server.",
+		Long:  "Stop a live reload server started in another terminal.",
 		Run:   liveReloadStop,
 	}
 
 	var liveReloadStatusCmd = &cobra.Command{
 		Use:   "status",
 		Short: "Show live reload status",
-		Long:  "Display current live reload status and statistics.",
+		Long:  "Display the status the live reload server last recorded.",
 		Run:   liveReloadStatus,
 	}
 
 	var liveReloadConfigCmd = &cobra.Command{
 		Use:   "config",
 		Short: "Show live reload configuration",
-		Long:  "Display current live reload configuration.",
+		Long:  "Display the effective live reload configuration.",
 		Run:   liveReloadConfig,
 	}
 
 	var liveReloadStatsCmd = &cobra.Command{
 		Use:   "stats",
 		Short: "Show live reload statistics",
-		Long:  "Display live reload statistics and metrics.",
+		Long:  "Display the statistics the live reload server last recorded.",
 		Run:   liveReloadStats,
 	}
 
 	var liveReloadTestCmd = &cobra.Command{
 		Use:   "test",
 		Short: "Test live reload functionality",
-		Long:  "Test live reload functionality with simulated changes.",
+		Long:  "Check that the live reload server, the app and the hot reload endpoint are up.",
 		Run:   liveReloadTest,
 	}
 
+	for _, c := range []*cobra.Command{liveReloadStartCmd, liveReloadConfigCmd} {
+		c.Flags().String("config", "config/livereload.yaml", "Live reload config file")
+		c.Flags().String("build", "", "Build command")
+		c.Flags().String("run", "", "Run command")
+		c.Flags().String("strategy", "", "Reload strategy (restart, rebuild, hot_reload)")
+		c.Flags().Int("port", 0, "Hot reload port (0 picks a free port)")
+		c.Flags().Bool("no-hot-reload", false, "Don't refresh browsers")
+	}
+	for _, c := range []*cobra.Command{liveReloadStopCmd, liveReloadStatusCmd, liveReloadStatsCmd, liveReloadTestCmd} {
+		c.Flags().String("state", livereload.DefaultStateFile, "Live reload state file")
+	}
+
 	liveReloadCmd.AddCommand(liveReloadStartCmd, liveReloadStopCmd, liveReloadStatusCmd, liveReloadConfigCmd, liveReloadStatsCmd, liveReloadTestCmd)
 
 	// Load shedding command group
@@ -1243,17 +1696,13 @@ Examples:
 
 	var metricsStatusCmd = &cobra.Command{
 		Use:   "status",
-		Short: "Show metrics status",
-		Long:  "Display current metrics configuration and status.",
+		Short: "Show live metrics",
+		Long:  "Scrape the metrics endpoint of the running application (started by `dolphin serve`) and summarize it.",
 		Run:   metricsStatus,
 	}
-
-	var metricsServeCmd = &cobra.Command{
-		Use:   "serve",
-		Short: "Start metrics server",
-		Long:  "Start the Prometheus metrics server.",
-		Run:   metricsServe,
-	}
+	metricsStatusCmd.Flags().String("url", "", "Metrics endpoint (default from the metrics config)")
+	metricsStatusCmd.Flags().Bool("json", false, "Print the summary as JSON")
+	metricsStatusCmd.Flags().Bool("raw", false, "Print the scraped metrics as-is")
 
 	var loggingCmd = &cobra.Command{
 		Use:   "logging",
@@ -1269,12 +1718,14 @@ Examples:
 	}
 
 	var loggingLevelCmd = &cobra.Command{
-		Use:   "level <level>",
-		Short: "Set logging level",
-		Long:  "Set the logging level (debug, info, warn, error, fatal).",
-		Args:  cobra.ExactArgs(1),
+		Use:   "level [level]",
+		Short: "Show or set the running application's log level",
+		Long:  "Show or change the log level (debug, info, warn, error, fatal) of the application started by `dolphin serve`, without a restart. Requires log.admin_token.",
+		Args:  cobra.MaximumNArgs(1),
 		Run:   loggingLevel,
 	}
+	loggingLevelCmd.Flags().String("url", "", "Application URL (default from the server config)")
+	loggingLevelCmd.Flags().String("token", "", "Admin token (default log.admin_token)")
 
 	var tracingCmd = &cobra.Command{
 		Use:   "tracing",
@@ -1303,7 +1754,7 @@ Examples:
 		Run:   healthServe,
 	}
 
-	metricsCmd.AddCommand(metricsStatusCmd, metricsServeCmd)
+	metricsCmd.AddCommand(metricsStatusCmd)
 	loggingCmd.AddCommand(loggingTestCmd, loggingLevelCmd)
 	tracingCmd.AddCommand(tracingStatusCmd, tracingTestCmd)
 	healthCmd.AddCommand(healthCheckCmd, healthServeCmd)
@@ -1312,12 +1763,33 @@ Examples:
 	// Key generation
 	rootCmd.AddCommand(keyGenerateCmd)
 
-	// Initialize configuration
-	var err error
-	cfg, err = config.Load()
-	if err != nil {
-		log.Fatal("Failed to load configuration:", err)
-	}
+	// Translations
+	var langMissingCmd = &cobra.Command{
+		Use:   "lang:missing",
+		Short: "List translation keys missing from each locale",
+		Long:  "Scan templates and Go files for keys passed to t, choice, i18n.T and i18n.Choice, and list those each locale's translation files don't define. Exits with status 1 when any are missing.",
+		Run:   langMissing,
+	}
+	langMissingCmd.Flags().StringSlice("path", []string{"."}, "Directories to scan")
+	langMissingCmd.Flags().StringSlice("locale", nil, "Only check these locales (default: every locale)")
+	rootCmd.AddCommand(langMissingCmd)
+
+	// Configuration cache
+	var configCacheCmd = &cobra.Command{
+		Use:         "config:cache",
+		Short:       "Cache the configuration",
+		Long:        "Compile config/config.yaml, the overlay for the environment and .env into " + config.CachePath + ", which is loaded at boot instead of them",
+		Annotations: map[string]string{"config": "skip"},
+		Run:         configCache,
+	}
+	var configClearCmd = &cobra.Command{
+		Use:         "config:clear",
+		Short:       "Remove the configuration cache",
+		Long:        "Remove " + config.CachePath + " so that the configuration is read from its sources again",
+		Annotations: map[string]string{"config": "skip"},
+		Run:         configClear,
+	}
+	rootCmd.AddCommand(configCacheCmd, configClearCmd)
 
 	if err := rootCmd.Execute(); err != nil {
 		log.Fatal(err)
@@ -1328,45 +1800,99 @@ func serve(cmd *cobra.Command, args []string) {
 	port, _ := cmd.Flags().GetInt("port")
 	host, _ := cmd.Flags().GetString("host")
 
-	// Initialize logger
-	logger := logger.New(cfg.Log.Level, cfg.Log.Format)
+	// Initialize logger; its level can change while serving
+	logLevel := zap.NewAtomicLevelAt(logger.ParseLevel(cfg.Log.Level))
+	logger := logger.NewWithLevel(logLevel, cfg.Log.Format)
 
-	// Initialize database
-	db, err := database.New(&cfg.Database)
+	// Dependencies are waited for as startup.policy says
+	waiter, err := startup.New(cfg.Startup, logger)
 	if err != nil {
-		logger.Fatal("Failed to connect to database", zap.Error(err))
+		logger.Fatal("Invalid startup config", zap.Error(err))
 	}
+	connectCtx, stopConnecting := context.WithCancel(context.Background())
+	defer stopConnecting()
+
+	// SIGHUP re-reads the config for a new log level
+	app.ReloadLogLevelOnSIGHUP(connectCtx, logLevel, logger)
+
+	handler := waiter.Handler()
+	booted := make(chan app.Booted, 1)
+	boot := func() {
+		// Initialize database
+		db, err := waiter.Connect(connectCtx, cfg)
+		if err != nil {
+			if connectCtx.Err() != nil {
+				return
+			}
+			logger.Fatal("Failed to connect to dependencies", zap.Error(err))
+		}
 
-	// Auto-migrate auth user model so register works out-of-the-box
-	_ = db.GetDB().AutoMigrate(&auth.User{})
+		// Auto-migrate auth user model so register works out-of-the-box
+		_ = db.GetDB().AutoMigrate(&auth.User{})
 
-	// Initialize application
-	app := app.New(cfg, logger, db)
+		db.QueryLog().OnSlow = func(q database.QueryRecord) {
+			logger.Warn("Slow query", zap.String("sql", q.SQL), zap.Duration("duration", q.Duration))
+		}
 
-	// Initialize router
-	r := router.New(app)
+		// Initialize application
+		application := app.New(cfg, logger, db)
+		application.SetLogLevel(logLevel)
+
+		// Initialize router
+		r := router.New(application)
+
+		// Optionally mount debug dashboard on main server when app debug enabled
+		if cfg.App.Debug {
+			dbg := debug.NewDebugger(debug.Config{Enabled: true, EnableProfiler: true})
+			dbg.SetQueryLog(db.QueryLog())
+			dbg.SetRecorder(r.Recorder())
+			dbg.SetWebhooks(r.Webhooks())
+			dbg.SetSLOs(r.SLOs())
+			dbg.SetAllocations(r.Allocations())
+			if dr := dbg.Router(); dr != nil {
+				// Build a subrouter with middleware, then mount under /debug
+				sub := chi.NewRouter()
+				sub.Use(dbg.Middleware())
+				sub.Mount("/", dr)
+				r.Mount("/debug", sub)
+			}
+		}
 
-	// Optionally mount debug dashboard on main server when app debug enabled
-	if cfg.App.Debug {
-		dbg := debug.NewDebugger(debug.Config{Enabled: true, EnableProfiler: true})
-		if dr := dbg.Router(); dr != nil {
-			// Build a subrouter with middleware, then mount under /debug
-			sub := chi.NewRouter()
-			sub.Use(dbg.Middleware())
-			sub.Mount("/", dr)
-			r.Mount("/debug", sub)
+		// Prometheus metrics on their own port
+		metricsSrv := r.MetricsServer()
+		if metricsSrv != nil {
+			go func() {
+				logger.Info("📊 Metrics", zap.String("url", cfg.Metrics.URL()))
+				if err := metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					logger.Error("Failed to start metrics server", zap.Error(err))
+				}
+			}()
 		}
+
+		handler.Ready(r)
+		booted <- app.Booted{Router: r, Metrics: metricsSrv}
+	}
+
+	// Degraded startup listens first, reporting not-ready until connected
+	if waiter.Degraded() {
+		go boot()
+	} else {
+		boot()
 	}
 
 	// Create HTTP server
 	srv := &http.Server{
 		Addr:         fmt.Sprintf("%s:%d", host, port),
-		Handler:      r,
+		Handler:      handler,
 		ReadTimeout:  time.Duration(cfg.Server.ReadTimeout) * time.Second,
 		WriteTimeout: time.Duration(cfg.Server.WriteTimeout) * time.Second,
 		IdleTimeout:  time.Duration(cfg.Server.IdleTimeout) * time.Second,
 	}
 
+	// Event streams never finish on their own, so Shutdown would wait them
+	// out; ending them has clients reconnect to another instance
+	srv.RegisterOnShutdown(func() { sse.Default.Drain() })
+
 	// Start server in goroutine
 	go func() {
 		logger.Info("🚀 Dolphin server running", zap.String("url", fmt.Sprintf("http://%s:%d", host, port)))
@@ -1381,6 +1907,7 @@ func serve(cmd *cobra.Command, args []string) {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
+	stopConnecting()
 
 	logger.Info("Shutting down server...")
 
@@ -1391,6 +1918,11 @@ func serve(cmd *cobra.Command, args []string) {
 	if err := srv.Shutdown(ctx); err != nil {
 		logger.Fatal("Server forced to shutdown", zap.Error(err))
 	}
+	select {
+	case b := <-booted:
+		b.Shutdown(ctx, logger)
+	default:
+	}
 
 	logger.Info("Server exited")
 }
@@ -1398,10 +1930,6 @@ func serve(cmd *cobra.Command, args []string) {
 func migrate(cmd *cobra.Command, args []string) {
 	force, _ := cmd.Flags().GetBool("force")
 	logger := logger.New(cfg.Log.Level, cfg.Log.Format)
-	db, err := database.New(&cfg.Database)
-	if err != nil {
-		logger.Fatal("Failed to connect to database", zap.Error(err))
-	}
 
 	if !force {
 		fmt.Print("Are you sure you want to run migrations? (y/N): ")
@@ -1413,33 +1941,81 @@ func migrate(cmd *cobra.Command, args []string) {
 		}
 	}
 
-	migrator := database.NewMigrator(db.GetSQLDB(), "migrations")
-	result := migrator.Migrate()
+	ui := progressUI(cmd)
+	connection, _ := cmd.Flags().GetString("database")
+	for _, name := range app.MigrationConnections(&cfg.Database, connection) {
+		db, err := database.NewConnection(&cfg.Database, name)
+		if err != nil {
+			logger.Fatal("Failed to connect to database", zap.String("connection", name), zap.Error(err))
+		}
 
-	if result.Message != "" {
-		logger.Info(result.Message)
+		label := "🗄️  " + name
+		var bar *progress.Bar
+		migrator := db.Migrator("migrations")
+		migrator.Progress = func(migration string, done, total int) {
+			if bar == nil {
+				bar = ui.Bar(label, int64(total))
+			}
+			bar.SetLabel(label + ": " + migration)
+			bar.Set(int64(done))
+		}
+		result := migrator.Migrate()
+		db.Close()
+		if bar != nil {
+			bar.SetLabel(label)
+			if result.Executed == nil {
+				bar.Fail()
+			} else {
+				bar.Set(int64(len(result.Executed)))
+				bar.Done()
+			}
+		}
+
+		if result.Message != "" {
+			logger.Info(result.Message, zap.String("connection", name))
+		}
+		if len(result.Executed) > 0 {
+			logger.Info("Executed migrations", zap.String("connection", name), zap.Any("migrations", result.Executed))
+			logger.Info("Batch", zap.Int("batch", result.Batch))
+		} else {
+			fmt.Printf("✅ No pending migrations on %s.\n", name)
+		}
 	}
-	if len(result.Executed) > 0 {
-		logger.Info("Executed migrations", zap.Any("migrations", result.Executed))
-		logger.Info("Batch", zap.Int("batch", result.Batch))
-	} else {
-		fmt.Println("✅ No pending migrations.")
+}
+
+// progressUI shows the progress of a long-running command on stdout, or
+// as plain lines on stderr with --output json so stdout only carries the
+// result
+func progressUI(cmd *cobra.Command) *progress.UI {
+	if output, _ := cmd.Flags().GetString("output"); output == "json" {
+		return progress.Plain(os.Stderr)
 	}
+	return progress.New(os.Stdout)
 }
 
 func rollback(cmd *cobra.Command, args []string) {
 	steps, _ := cmd.Flags().GetInt("steps")
+	force, _ := cmd.Flags().GetBool("force-data-loss")
+	connection, _ := cmd.Flags().GetString("database")
 	logger := logger.New(cfg.Log.Level, cfg.Log.Format)
-	db, err := database.New(&cfg.Database)
+	db, err := database.NewConnection(&cfg.Database, connection)
 	if err != nil {
 		logger.Fatal("Failed to connect to database", zap.Error(err))
 	}
+	defer db.Close()
 
-	migrator := database.NewMigrator(db.GetSQLDB(), "migrations")
+	migrator := db.Migrator("migrations")
+	migrator.ForceDataLoss = force
 
 	for i := 0; i < steps; i++ {
 		result := migrator.Rollback()
+		if result.Blocked {
+			logger.Fatal(result.Message)
+		}
 		logger.Info(result.Message)
+		for _, loss := range result.DataLoss {
+			logger.Warn("Dropped data", zap.String("detail", loss.String()))
+		}
 		if len(result.RolledBack) > 0 {
 			logger.Info("Rolled back migrations", zap.Any("migrations", result.RolledBack))
 			logger.Info("Batch", zap.Int("batch", result.Batch))
@@ -1449,22 +2025,26 @@ func rollback(cmd *cobra.Command, args []string) {
 
 func status(cmd *cobra.Command, args []string) {
 	logger := logger.New(cfg.Log.Level, cfg.Log.Format)
-	db, err := database.New(&cfg.Database)
-	if err != nil {
-		logger.Fatal("Failed to connect to database", zap.Error(err))
-	}
-
-	migrator := database.NewMigrator(db.GetSQLDB(), "migrations")
-	status := migrator.Status()
 
 	fmt.Println("📊 Migration Status:")
 	fmt.Println("===================")
-	for _, s := range status {
-		statusIcon := "✅"
-		if s.Status == "pending" {
-			statusIcon = "⏳"
+	connection, _ := cmd.Flags().GetString("database")
+	for _, name := range app.MigrationConnections(&cfg.Database, connection) {
+		db, err := database.NewConnection(&cfg.Database, name)
+		if err != nil {
+			logger.Fatal("Failed to connect to database", zap.String("connection", name), zap.Error(err))
+		}
+		status := db.Migrator("migrations").Status()
+		db.Close()
+
+		fmt.Printf("🔌 %s (%s)\n", name, database.MigrationsTable(name))
+		for _, s := range status {
+			statusIcon := "✅"
+			if s.Status == "pending" {
+				statusIcon = "⏳"
+			}
+			fmt.Printf("%s %s (Batch: %v)\n", statusIcon, s.Migration, s.Batch)
 		}
-		fmt.Printf("%s %s (Batch: %v)\n", statusIcon, s.Migration, s.Batch)
 	}
 }
 
@@ -1496,26 +2076,158 @@ func makeController(cmd *cobra.Command, args []string) {
 		log.Fatal("Failed to create controller:", err)
 	}
 	fmt.Printf("✅ Controller %s created successfully!\n", name)
+	fmt.Printf("   🔌 Wiring: %s\n", app.WiringFile)
 }
 
 func makeModel(cmd *cobra.Command, args []string) {
 	name := args[0]
 	generator := app.NewGenerator()
-	if err := generator.CreateModel(name); err != nil {
+	softDeletes, _ := cmd.Flags().GetBool("soft-deletes")
+	pruneAfter, _ := cmd.Flags().GetDuration("prune-after")
+	if pruneAfter > 0 && !softDeletes {
+		log.Fatal("--prune-after requires --soft-deletes")
+	}
+	opts := app.ModelOptions{SoftDeletes: softDeletes, PruneAfter: pruneAfter}
+	if err := generator.CreateModelWithOptions(name, opts); err != nil {
 		log.Fatal("Failed to create model:", err)
 	}
 	fmt.Printf("✅ Model %s created successfully!\n", name)
 }
 
 func makeMigration(cmd *cobra.Command, args []string) {
+	if model, _ := cmd.Flags().GetString("from-model"); model != "" {
+		makeMigrationFromModel(cmd, model, args)
+		return
+	}
+	if len(args) != 1 {
+		log.Fatal("make:migration requires a name or --from-model")
+	}
+
 	name := args[0]
+	connection, _ := cmd.Flags().GetString("database")
 	generator := app.NewGenerator()
-	if err := generator.CreateMigration(name); err != nil {
+	if err := generator.CreateMigrationForConnection(name, connection); err != nil {
 		log.Fatal("Failed to create migration:", err)
 	}
 	fmt.Printf("✅ Migration %s created successfully!\n", name)
 }
 
+func makeMigrationFromModel(cmd *cobra.Command, model string, args []string) {
+	modelsDir, _ := cmd.Flags().GetString("models-dir")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+	logger := logger.New(cfg.Log.Level, cfg.Log.Format)
+	src, err := database.ParseModelDir(modelsDir)
+	if err != nil {
+		logger.Fatal("Failed to read models", zap.Error(err))
+	}
+	spec, err := src.Model(model)
+	if err != nil {
+		logger.Fatal("Failed to read model", zap.Error(err))
+	}
+
+	db, err := database.New(&cfg.Database)
+	if err != nil {
+		logger.Fatal("Failed to connect to database", zap.Error(err))
+	}
+	defer db.Close()
+
+	diff, err := src.Diff(db.GetDB(), spec)
+	if err != nil {
+		logger.Fatal("Failed to diff model", zap.Error(err))
+	}
+	for _, field := range diff.Skipped {
+		fmt.Printf("⚠️  Skipped %s.%s: add a type tag so its column type is known\n", model, field)
+	}
+	if diff.Empty() {
+		fmt.Printf("✅ Table %s already matches %s\n", diff.Table, model)
+		return
+	}
+	for _, column := range diff.Dropped {
+		fmt.Printf("⚠️  Column %s.%s is not on the model and will be dropped\n", diff.Table, column)
+	}
+
+	if dryRun {
+		for _, direction := range []struct {
+			label string
+			steps []database.SchemaStep
+		}{{"Up", diff.Up}, {"Down", diff.Down}} {
+			queries, err := database.Pretend(cfg.Database.Driver, direction.steps)
+			fmt.Printf("-- %s\n", direction.label)
+			for _, query := range queries {
+				fmt.Println(query + ";")
+			}
+			if err != nil {
+				fmt.Printf("-- ❌ %v\n", err)
+			}
+		}
+		return
+	}
+
+	name := "update_" + diff.Table + "_table"
+	if diff.Create {
+		name = "create_" + diff.Table + "_table"
+	}
+	if len(args) == 1 {
+		name = args[0]
+	}
+	path, err := app.NewGenerator().CreateMigrationWithSteps(name, diff.Up, diff.Down)
+	if err != nil {
+		logger.Fatal("Failed to create migration", zap.Error(err))
+	}
+	fmt.Printf("✅ Migration %s created successfully!\n", path)
+}
+
+func migrateFromTags(cmd *cobra.Command, args []string) {
+	model := args[0]
+	modelsDir, _ := cmd.Flags().GetString("models-dir")
+
+	logger := logger.New(cfg.Log.Level, cfg.Log.Format)
+	src, err := database.ParseModelDir(modelsDir)
+	if err != nil {
+		logger.Fatal("Failed to read models", zap.Error(err))
+	}
+	spec, err := src.Model(model)
+	if err != nil {
+		logger.Fatal("Failed to read model", zap.Error(err))
+	}
+	indexes, err := src.Indexes(spec)
+	if err != nil {
+		logger.Fatal("Failed to read index tags", zap.Error(err))
+	}
+	keys, err := src.ForeignKeys(spec)
+	if err != nil {
+		logger.Fatal("Failed to read relationships", zap.Error(err))
+	}
+
+	db, err := database.New(&cfg.Database)
+	if err != nil {
+		logger.Fatal("Failed to connect to database", zap.Error(err))
+	}
+	defer db.Close()
+
+	indexes = database.MissingIndexes(db.GetDB(), indexes)
+	keys = database.MissingForeignKeys(db.GetDB(), keys)
+	if len(indexes) == 0 && len(keys) == 0 {
+		fmt.Printf("✅ %s's indexes and foreign keys are all in place\n", model)
+		return
+	}
+
+	for _, idx := range indexes {
+		fmt.Printf("➕ index %s on %s (%s)\n", idx.Name, idx.Table, strings.Join(idx.Columns, ", "))
+	}
+	for _, fk := range keys {
+		fmt.Printf("➕ foreign key %s: %s.%s -> %s.%s\n", fk.Name, fk.Table, fk.Column, fk.RefTable, fk.RefColumn)
+	}
+
+	up, down := database.ConstraintSteps(indexes, keys)
+	path, err := app.NewGenerator().CreateMigrationWithSteps("add_"+spec.Table+"_constraints", up, down)
+	if err != nil {
+		logger.Fatal("Failed to create migration", zap.Error(err))
+	}
+	fmt.Printf("✅ Migration %s created successfully!\n", path)
+}
+
 func makeMiddleware(cmd *cobra.Command, args []string) {
 	name := args[0]
 	generator := app.NewGenerator()
@@ -1529,7 +2241,13 @@ func makeModule(cmd *cobra.Command, args []string) {
 	name := args[0]
 	generator := app.NewGenerator()
 	fmt.Printf("🐬 Creating module %s...\n", name)
-	if err := generator.CreateModule(name); err != nil {
+	softDeletes, _ := cmd.Flags().GetBool("soft-deletes")
+	pruneAfter, _ := cmd.Flags().GetDuration("prune-after")
+	if pruneAfter > 0 && !softDeletes {
+		log.Fatal("--prune-after requires --soft-deletes")
+	}
+	opts := app.ModelOptions{SoftDeletes: softDeletes, PruneAfter: pruneAfter}
+	if err := generator.CreateModuleWithOptions(name, opts); err != nil {
 		log.Fatal("Failed to create module:", err)
 	}
 	fmt.Printf("✅ Module %s created successfully!\n", name)
@@ -1538,6 +2256,43 @@ func makeModule(cmd *cobra.Command, args []string) {
 	fmt.Printf("   📚 Repository: app/repositories/%s.go\n", name)
 	fmt.Printf("   🎨 Views: resources/views/%s/\n", name)
 	fmt.Printf("   🔄 Migration: migrations/*_%s.go\n", name)
+	fmt.Printf("   🔌 Wiring: %s\n", app.WiringFile)
+}
+
+func moduleCreate(cmd *cobra.Command, args []string) {
+	name := args[0]
+	model, _ := cmd.Flags().GetString("model")
+	if model == "" {
+		model = strings.ToUpper(name[:1]) + name[1:]
+	}
+	generator := app.NewGenerator()
+	fmt.Printf("🐬 Creating module %s...\n", name)
+	if err := generator.CreateAppModule(name, model); err != nil {
+		log.Fatal("Failed to create module:", err)
+	}
+	dir := filepath.Join(app.ModulesDir, strings.ToLower(name))
+	fmt.Printf("✅ Module %s created successfully!\n", name)
+	fmt.Printf("   📦 Public API: %s/\n", dir)
+	fmt.Printf("   📝 Model: %s/internal/models/%s.go\n", dir, strings.ToLower(model))
+	fmt.Printf("   📚 Repository: %s/internal/repositories/%s.go\n", dir, strings.ToLower(model))
+	fmt.Printf("   🎮 Handlers: %s/internal/handlers/%s.go\n", dir, strings.ToLower(model))
+	fmt.Printf("   🔄 Migration: %s/migrations/*_%s.go\n", dir, strings.ToLower(model))
+	fmt.Printf("   🔌 Wiring: %s\n", app.WiringFile)
+}
+
+func moduleLint(cmd *cobra.Command, args []string) {
+	violations, err := app.LintModules(".")
+	if err != nil {
+		log.Fatal("Failed to check modules:", err)
+	}
+	for _, v := range violations {
+		fmt.Println(v)
+	}
+	if len(violations) > 0 {
+		fmt.Printf("❌ %d imports reach past a module's public API\n", len(violations))
+		os.Exit(1)
+	}
+	fmt.Println("✅ Modules only import each other's public API")
 }
 
 func makeView(cmd *cobra.Command, args []string) {
@@ -1555,17 +2310,49 @@ func makeResource(cmd *cobra.Command, args []string) {
 	name := args[0]
 	generator := app.NewGenerator()
 	fmt.Printf("🚀 Creating API resource %s...\n", name)
-	if err := generator.CreateResource(name); err != nil {
+	cursor, _ := cmd.Flags().GetBool("cursor")
+	parent, _ := cmd.Flags().GetString("parent")
+	shallow, _ := cmd.Flags().GetBool("shallow")
+	softDeletes, _ := cmd.Flags().GetBool("soft-deletes")
+	pruneAfter, _ := cmd.Flags().GetDuration("prune-after")
+	export, _ := cmd.Flags().GetBool("export")
+	if shallow && parent == "" {
+		log.Fatal("--shallow requires --parent")
+	}
+	if pruneAfter > 0 && !softDeletes {
+		log.Fatal("--prune-after requires --soft-deletes")
+	}
+	opts := app.ResourceOptions{
+		Cursor:      cursor,
+		Parent:      parent,
+		Shallow:     shallow,
+		SoftDeletes: softDeletes,
+		PruneAfter:  pruneAfter,
+		Export:      export,
+	}
+	if err := generator.CreateResource(name, opts); err != nil {
 		log.Fatal("Failed to create resource:", err)
 	}
 	fmt.Printf("✅ API resource %s created successfully!\n", name)
 	fmt.Printf("   📝 Model: app/models/%s.go\n", name)
 	fmt.Printf("   🎮 API Controller: app/http/controllers/api/%s.go\n", name)
 	fmt.Printf("   📚 Repository: app/repositories/%s.go\n", name)
+	fmt.Printf("   🛣️  Routes: app/http/routes/%s.go\n", strings.ToLower(name))
 	fmt.Printf("   🔄 Migration: migrations/*_%s.go\n", name)
+	fmt.Printf("   🔌 Wiring: %s\n", app.WiringFile)
 }
 
-func makeRepository(cmd *cobra.Command, args []string) {
+func makeResourceTransformer(cmd *cobra.Command, args []string) {
+	name := args[0]
+	generator := app.NewGenerator()
+	if err := generator.CreateResourceTransformer(name); err != nil {
+		log.Fatal("Failed to create resource transformer:", err)
+	}
+	fmt.Printf("✅ Resource transformer %s created successfully!\n", name)
+	fmt.Printf("   🔁 Resource: app/http/resources/%s.go\n", strings.ToLower(name))
+}
+
+func makeRepository(cmd *cobra.Command, args []string) {
 	name := args[0]
 	generator := app.NewGenerator()
 	if err := generator.CreateRepository(name); err != nil {
@@ -1617,6 +2404,241 @@ func storageGet(cmd *cobra.Command, args []string) {
 	fmt.Println("Note: Storage commands require provider integration")
 }
 
+func cdnPurge(cmd *cobra.Command, args []string) {
+	purger, err := cdn.FromConfig(cfg.CDN)
+	if err != nil {
+		log.Fatal("Invalid CDN config:", err)
+	}
+	if purger == nil {
+		fmt.Println("❌ No CDN is configured (cdn.driver)")
+		os.Exit(1)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := purger.Purge(ctx, args...); err != nil {
+		log.Fatal("Failed to purge the CDN:", err)
+	}
+	fmt.Printf("✅ Purged %s from %s\n", strings.Join(args, ", "), cfg.CDN.Driver)
+}
+
+func notifyTest(cmd *cobra.Command, args []string) {
+	channel, _ := cmd.Flags().GetString("channel")
+	platform, _ := cmd.Flags().GetString("platform")
+	p256dh, _ := cmd.Flags().GetString("p256dh")
+	auth, _ := cmd.Flags().GetString("auth")
+	title, _ := cmd.Flags().GetString("title")
+	message, _ := cmd.Flags().GetString("message")
+
+	notifier, err := notify.FromConfig(cfg.Notify, nil, logger.New(cfg.Log.Level, cfg.Log.Format))
+	if err != nil {
+		log.Fatal("Invalid notifications config:", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	msg := notify.Message{Title: title, Body: message}
+	via := cfg.Notify.SMS.Driver
+	switch channel {
+	case notify.ChannelSMS:
+		err = notifier.SendSMS(ctx, args[0], msg.Text())
+	case notify.ChannelPush:
+		via = platform
+		err = notifier.Push(ctx, &notify.Device{Platform: platform, Token: args[0], P256dh: p256dh, Auth: auth}, msg)
+	default:
+		log.Fatalf("Unknown channel %q: use sms or push", channel)
+	}
+	if err != nil {
+		log.Fatal("Failed to send the notification:", err)
+	}
+	fmt.Printf("✅ Sent a test notification to %s through %s\n", args[0], via)
+}
+
+func notifyVapid(cmd *cobra.Command, args []string) {
+	publicKey, privateKey, err := notify.GenerateVAPIDKeys()
+	if err != nil {
+		log.Fatal("Failed to generate VAPID keys:", err)
+	}
+	fmt.Println("✅ VAPID keys generated. Add them to the notifications.push.webpush config:")
+	fmt.Printf("VAPID_PUBLIC_KEY=%s\n", publicKey)
+	fmt.Printf("VAPID_PRIVATE_KEY=%s\n", privateKey)
+}
+
+// openBanList opens the ban list in the application database
+func openBanList() (*ratelimit.BanList, func()) {
+	db, err := database.New(&cfg.Database)
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	bans, err := ratelimit.NewBanList(db.GetDB(), cfg.Intrusion.BanRefresh)
+	if err != nil {
+		db.Close()
+		log.Fatal("Failed to open the ban list:", err)
+	}
+	if !cfg.Intrusion.Enabled {
+		fmt.Println("⚠️  intrusion.enabled is off: the app doesn't enforce bans")
+	}
+	return bans, func() { db.Close() }
+}
+
+func securityBan(cmd *cobra.Command, args []string) {
+	duration, _ := cmd.Flags().GetDuration("for")
+	reason, _ := cmd.Flags().GetString("reason")
+
+	bans, closeDB := openBanList()
+	defer closeDB()
+	if err := bans.Ban(context.Background(), args[0], reason, duration); err != nil {
+		log.Fatal("Failed to ban:", err)
+	}
+	if duration > 0 {
+		fmt.Printf("✅ Banned %s for %s\n", args[0], duration)
+	} else {
+		fmt.Printf("✅ Banned %s\n", args[0])
+	}
+}
+
+func securityUnban(cmd *cobra.Command, args []string) {
+	bans, closeDB := openBanList()
+	defer closeDB()
+	if err := bans.Unban(context.Background(), args[0]); err != nil {
+		log.Fatal("Failed to lift the ban:", err)
+	}
+	fmt.Printf("✅ Lifted the ban on %s\n", args[0])
+}
+
+func securityBans(cmd *cobra.Command, args []string) {
+	bans, closeDB := openBanList()
+	defer closeDB()
+	list, err := bans.List(context.Background())
+	if err != nil {
+		log.Fatal("Failed to list bans:", err)
+	}
+	if len(list) == 0 {
+		fmt.Println("ℹ️  No IPs are banned")
+		return
+	}
+	fmt.Printf("   %-40s %-25s %-25s %s\n", "IP", "BANNED", "EXPIRES", "REASON")
+	for _, ban := range list {
+		expires := "never"
+		if ban.ExpiresAt != nil {
+			expires = ban.ExpiresAt.Format(time.RFC3339)
+		}
+		fmt.Printf("   %-40s %-25s %-25s %s\n", ban.IP, ban.CreatedAt.Format(time.RFC3339), expires, ban.Reason)
+	}
+}
+
+func seoRobots(cmd *cobra.Command, args []string) {
+	env, _ := cmd.Flags().GetString("env")
+	write, _ := cmd.Flags().GetString("write")
+
+	appConfig := cfg.App
+	if env != "" {
+		appConfig.Environment = env
+	}
+	files, err := seo.New(cfg.SEO, appConfig, nil)
+	if err != nil {
+		log.Fatal("Invalid seo config:", err)
+	}
+	robots, err := files.Robots()
+	if err != nil {
+		log.Fatal("Failed to generate robots.txt:", err)
+	}
+	if write == "" {
+		fmt.Print(string(robots))
+		return
+	}
+	if err := os.WriteFile(write, robots, 0644); err != nil {
+		log.Fatal("Failed to write robots.txt:", err)
+	}
+	fmt.Printf("✅ Wrote robots.txt for %s to %s\n", appConfig.Environment, write)
+}
+
+func artifactsClear(cmd *cobra.Command, args []string) {
+	prefix := ""
+	if len(args) > 0 {
+		prefix = args[0]
+	}
+	cache, err := artifacts.FromConfig(cfg.Artifacts, &cfg.Storage, nil)
+	if err != nil {
+		log.Fatal("Invalid artifacts config:", err)
+	}
+	deleted, err := cache.Clear(prefix)
+	if err != nil {
+		log.Fatal("Failed to clear artifacts:", err)
+	}
+	if prefix == "" {
+		fmt.Printf("✅ Deleted %d cached artifacts\n", deleted)
+		return
+	}
+	fmt.Printf("✅ Deleted %d cached artifacts under %s\n", deleted, prefix)
+}
+
+func storageVerify(cmd *cobra.Command, args []string) {
+	disk, _ := cmd.Flags().GetString("disk")
+	rounds, _ := cmd.Flags().GetInt("rounds")
+	size, _ := cmd.Flags().GetInt("size")
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	output, _ := cmd.Flags().GetString("output")
+
+	disks := storage.DiskNames(&cfg.Storage)
+	if disk != "" {
+		disks = []string{disk}
+	}
+	if len(disks) == 0 {
+		fmt.Println("❌ No storage disks are configured")
+		os.Exit(1)
+	}
+
+	type diskReport struct {
+		Disk string `json:"disk"`
+		*storage.VerifyReport
+	}
+	var reports []diskReport
+	failed := false
+	for _, name := range disks {
+		report := &storage.VerifyReport{}
+		driver, err := storage.Disk(&cfg.Storage, name)
+		if err != nil {
+			report.Step, report.Error = "config", err.Error()
+		} else {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			report = storage.Verify(ctx, driver, storage.VerifyOptions{Rounds: rounds, Size: size})
+			cancel()
+		}
+		failed = failed || !report.OK()
+		reports = append(reports, diskReport{Disk: name, VerifyReport: report})
+	}
+
+	if output == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(reports); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		for _, r := range reports {
+			if r.OK() {
+				fmt.Printf("✅ %s: %d rounds of %d bytes, checksums match\n", r.Disk, r.Rounds, r.Size)
+			} else {
+				fmt.Printf("❌ %s: failed at %s after %d rounds: %s\n", r.Disk, r.Step, r.Rounds, r.Error)
+			}
+			for _, op := range []struct {
+				name    string
+				latency storage.Latency
+			}{{"put", r.Put}, {"get", r.Get}, {"delete", r.Delete}} {
+				if op.latency.Max == 0 {
+					continue
+				}
+				fmt.Printf("   %-6s p50 %-10s p95 %-10s p99 %-10s max %s\n", op.name,
+					op.latency.P50.Round(time.Microsecond), op.latency.P95.Round(time.Microsecond),
+					op.latency.P99.Round(time.Microsecond), op.latency.Max.Round(time.Microsecond))
+			}
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
 func cacheClear(cmd *cobra.Command, args []string) {
 	fmt.Println("🗑️  Clearing all cache...")
 	fmt.Println("Note: Cache commands require provider integration")
@@ -1643,17 +2665,745 @@ func makeSeeder(cmd *cobra.Command, args []string) {
 
 func makeRequest(cmd *cobra.Command, args []string) {
 	name := args[0]
+	generator := app.NewGenerator()
+	if err := generator.CreateRequest(name); err != nil {
+		log.Fatal("Failed to create request:", err)
+	}
 	fmt.Printf("✅ Request %s created successfully!\n", name)
-	fmt.Println("Note: Request generation not yet implemented")
+	fmt.Printf("   📥 Request: app/http/requests/%s.go\n", strings.ToLower(name))
+}
+
+func makeUpload(cmd *cobra.Command, args []string) {
+	name := args[0]
+	resumable, _ := cmd.Flags().GetBool("resumable")
+	generator := app.NewGenerator()
+	lowerName := strings.ToLower(name)
+	if resumable {
+		if err := generator.CreateResumableUpload(name); err != nil {
+			log.Fatal("Failed to create upload controller:", err)
+		}
+		fmt.Printf("✅ Resumable upload controller %s created successfully!\n", name)
+		fmt.Printf("   🎮 Controller: app/http/controllers/%s_upload.go\n", lowerName)
+		fmt.Printf("   🛣️  Routes: app/http/routes/%s_upload.go (tus at /%ss/uploads, GET and POST /%ss/upload, GET /%ss/progress/{id})\n", lowerName, lowerName, lowerName, lowerName)
+		fmt.Printf("   🖼️  View: resources/views/%s/upload.html\n", lowerName)
+		fmt.Printf("   🔌 Wiring: %s\n", app.WiringFile)
+		return
+	}
+	if err := generator.CreateUpload(name); err != nil {
+		log.Fatal("Failed to create upload controller:", err)
+	}
+	fmt.Printf("✅ Upload controller %s created successfully!\n", name)
+	fmt.Printf("   🎮 Controller: app/http/controllers/%s_upload.go\n", lowerName)
+	fmt.Printf("   🛣️  Routes: app/http/routes/%s_upload.go (POST /%ss, DELETE /%ss/{file})\n", lowerName, lowerName, lowerName)
+	fmt.Printf("   🔌 Wiring: %s\n", app.WiringFile)
+}
+
+func makePaymentHandler(cmd *cobra.Command, args []string) {
+	name := args[0]
+	generator := app.NewGenerator()
+	if err := generator.CreatePaymentHandler(name); err != nil {
+		log.Fatal("Failed to create payment handler:", err)
+	}
+	fmt.Printf("✅ Payment handler %s created successfully!\n", name)
+	fmt.Println("   💳 Provider: app/gateways/")
+	fmt.Println("   Import app/gateways from main for it to register, and configure it under payments.providers")
+}
+
+func makeObserver(cmd *cobra.Command, args []string) {
+	model := args[0]
+	generator := app.NewGenerator()
+	if err := generator.CreateObserver(model); err != nil {
+		log.Fatal("Failed to create observer:", err)
+	}
+	fmt.Printf("✅ Observer for %s created successfully!\n", model)
+	fmt.Println("   👀 Observer: app/observers/")
+	fmt.Println("   Import app/observers from main for it to register")
+}
+
+func makeTenant(cmd *cobra.Command, args []string) {
+	id := args[0]
+	generator := app.NewGenerator()
+	if err := generator.CreateTenant(id); err != nil {
+		log.Fatal("Failed to create tenant:", err)
+	}
+	fmt.Printf("✅ Tenant %s created successfully!\n", id)
+	fmt.Printf("   🏢 Tenant: app/tenants/%s.go\n", id)
+	fmt.Println("   Run 'dolphin tenants:migrate --tenant " + id + "' to set up its database")
+}
+
+func tenantsMigrate(cmd *cobra.Command, args []string) {
+	only, _ := cmd.Flags().GetStringSlice("tenant")
+
+	logger := logger.New(cfg.Log.Level, cfg.Log.Format)
+	store, err := tenancy.StoreFromConfig(&cfg.Tenancy)
+	if err != nil {
+		logger.Fatal("Invalid tenancy config", zap.Error(err))
+	}
+	manager, err := tenancy.NewManager(&cfg.Tenancy, &cfg.Database, store)
+	if err != nil {
+		logger.Fatal("Invalid tenancy config", zap.Error(err))
+	}
+	defer manager.Close()
+
+	ctx := context.Background()
+	var tenants []*tenancy.Tenant
+	if len(only) > 0 {
+		for _, id := range only {
+			t, err := store.Find(ctx, id)
+			if err != nil {
+				logger.Fatal("Unknown tenant", zap.String("tenant", id))
+			}
+			tenants = append(tenants, t)
+		}
+	} else {
+		tenants, _ = store.All(ctx)
+	}
+	if len(tenants) == 0 {
+		fmt.Println("ℹ️  No tenants. Create one with 'dolphin make:tenant <id>' or list them under tenancy.tenants.")
+		return
+	}
+
+	db, err := database.New(&cfg.Database)
+	if err != nil {
+		logger.Fatal("Failed to connect to database", zap.Error(err))
+	}
+	defer db.Close()
+
+	// Tenants are migrated one at a time to show progress, and their
+	// results listed once the bar is done
+	var results []tenancy.MigrateResult
+	bar := progressUI(cmd).Bar("🏢 Tenants", int64(len(tenants)))
+	for _, t := range tenants {
+		bar.SetLabel("🏢 Tenants: " + t.ID)
+		results = append(results, manager.Migrate(ctx, db, "migrations", []*tenancy.Tenant{t})...)
+		bar.Add(1)
+	}
+	bar.SetLabel("🏢 Tenants")
+	bar.Done()
+
+	failed := false
+	for _, result := range results {
+		if result.Err != nil {
+			failed = true
+			fmt.Printf("❌ %s: %v\n", result.Tenant, result.Err)
+			continue
+		}
+		fmt.Printf("✅ %s: %s\n", result.Tenant, result.Message)
+		for _, name := range result.Executed {
+			fmt.Printf("   • %s\n", name)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
 }
 
 func dbSeed(cmd *cobra.Command, args []string) {
-	// Run seeders
+	only, _ := cmd.Flags().GetStringSlice("seeder")
+
+	logger := logger.New(cfg.Log.Level, cfg.Log.Format)
+	if len(database.Seeders()) == 0 {
+		fmt.Println("ℹ️  No seeders registered. Register them with database.RegisterSeeder or a module's Seeders.")
+		return
+	}
+	db, err := database.New(&cfg.Database)
+	if err != nil {
+		logger.Fatal("Failed to connect to database", zap.Error(err))
+	}
+	defer db.Close()
+
 	fmt.Println("🌱 Running database seeders...")
-	// Implementation would go here
+	ran, err := database.Seed(db.GetDB(), only...)
+	for _, name := range ran {
+		fmt.Printf("   • %s\n", name)
+	}
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
 	fmt.Println("✅ Database seeding completed!")
 }
 
+func modelPrune(cmd *cobra.Command, args []string) {
+	tables, _ := cmd.Flags().GetStringSlice("table")
+	every, _ := cmd.Flags().GetDuration("every")
+	pretend, _ := cmd.Flags().GetBool("pretend")
+
+	logger := logger.New(cfg.Log.Level, cfg.Log.Format)
+	db, err := database.New(&cfg.Database)
+	if err != nil {
+		logger.Fatal("Failed to connect to database", zap.Error(err))
+	}
+
+	// Registered models take precedence over configured tables of the same name
+	retention := map[string]time.Duration{}
+	for table, after := range cfg.Database.Prune {
+		retention[table] = after
+	}
+	models := map[string]orm.Prunable{}
+	for _, model := range orm.Prunables() {
+		models[model.TableName()] = model
+		retention[model.TableName()] = model.PruneAfter()
+	}
+	if len(tables) > 0 {
+		selected := map[string]time.Duration{}
+		for _, table := range tables {
+			after, ok := retention[table]
+			if !ok {
+				logger.Fatal("Table is not prunable", zap.String("table", table))
+			}
+			selected[table] = after
+		}
+		retention = selected
+	}
+	if len(retention) == 0 {
+		fmt.Println("ℹ️  No prunable models. Implement orm.Prunable or configure database.prune.")
+		return
+	}
+
+	names := make([]string, 0, len(retention))
+	for table := range retention {
+		names = append(names, table)
+	}
+	sort.Strings(names)
+
+	if pretend {
+		for _, table := range names {
+			fmt.Printf("🧹 %s: rows soft-deleted more than %s ago would be pruned\n", table, retention[table])
+		}
+		return
+	}
+
+	prune := func(ctx context.Context) {
+		for _, table := range names {
+			var result orm.PruneResult
+			var err error
+			if model, ok := models[table]; ok {
+				result, err = orm.Prune(ctx, db.GetDB(), model)
+			} else {
+				result, err = orm.PruneTable(ctx, db.GetDB(), table, retention[table])
+			}
+			if err != nil {
+				logger.Error("Failed to prune table", zap.String("table", table), zap.Error(err))
+				continue
+			}
+			fmt.Printf("🧹 %s: pruned %d rows\n", result.Table, result.Deleted)
+		}
+	}
+
+	if every <= 0 {
+		prune(context.Background())
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	fmt.Printf("⏰ Pruning every %s (Ctrl+C to stop)\n", every)
+	schedule.Every(ctx, every, prune, scheduleOptions(cmd, db, "schedule:model:prune")...)
+}
+
+// scheduleLockTTL is how long a scheduled run may hold its lock, freeing
+// the lock of an instance that crashed mid-run
+const scheduleLockTTL = 24 * time.Hour
+
+// scheduleOptions returns the options of a command's --every schedule:
+// with --without-overlapping, a lock on name in the store cache.locks
+// names, so instances running the same schedule take turns
+func scheduleOptions(cmd *cobra.Command, db *database.Manager, name string) []schedule.Option {
+	if without, _ := cmd.Flags().GetBool("without-overlapping"); !without {
+		return nil
+	}
+
+	var locker cache.Locker = cache.Locks
+	switch cfg.Cache.Locks {
+	case "", "cache":
+		if cfg.Cache.Driver == "redis" {
+			locker = cache.NewRedisCache(cfg.Cache.Host, cfg.Cache.Port, cfg.Cache.DB)
+		}
+	case "database":
+		dbLocker, err := cache.NewDatabaseLocker(db.GetDB())
+		if err != nil {
+			log.Fatalf("Failed to set up database locks: %v", err)
+		}
+		locker = dbLocker
+	default:
+		log.Fatalf("Unknown cache.locks store %q", cfg.Cache.Locks)
+	}
+	return []schedule.Option{schedule.WithoutOverlapping(cache.NewMutex(locker, name, scheduleLockTTL))}
+}
+
+func searchImport(cmd *cobra.Command, args []string) {
+	flush, _ := cmd.Flags().GetBool("flush")
+
+	logger := logger.New(cfg.Log.Level, cfg.Log.Format)
+	models := search.Registered()
+	if len(args) == 1 {
+		model, ok := search.Lookup(args[0])
+		if !ok {
+			logger.Fatal("Model is not searchable", zap.String("model", args[0]))
+		}
+		models = []search.Searchable{model}
+	}
+	if len(models) == 0 {
+		fmt.Println("ℹ️  No searchable models. Implement search.Searchable and register the model with search.Register.")
+		return
+	}
+
+	db, err := database.New(&cfg.Database)
+	if err != nil {
+		logger.Fatal("Failed to connect to database", zap.Error(err))
+	}
+	defer db.Close()
+	manager, err := search.New(cfg.Search, logger)
+	if err != nil {
+		logger.Fatal("Invalid search config", zap.Error(err))
+	}
+
+	ctx := context.Background()
+	ui := progressUI(cmd)
+	for _, model := range models {
+		index := manager.IndexName(model)
+		if flush {
+			if err := manager.Flush(ctx, model); err != nil {
+				logger.Fatal("Failed to flush index", zap.String("index", index), zap.Error(err))
+			}
+		}
+		var rows int64
+		db.GetDB().Model(model).Count(&rows)
+		bar := ui.Bar("🔍 "+index, rows)
+		indexed, err := manager.Import(ctx, db.GetDB(), model, func(indexed int) {
+			bar.Set(int64(indexed))
+		})
+		if err != nil {
+			bar.Fail()
+			logger.Fatal("Failed to import index", zap.String("index", index), zap.Error(err))
+		}
+		// Rows that aren't searchable were skipped, so the count of
+		// indexed ones is the total
+		bar.Set(int64(indexed))
+		bar.SetTotal(int64(indexed))
+		bar.Done()
+	}
+	if err := manager.Close(); err != nil {
+		logger.Fatal("Failed to save search indexes", zap.Error(err))
+	}
+}
+
+func searchFlush(cmd *cobra.Command, args []string) {
+	logger := logger.New(cfg.Log.Level, cfg.Log.Format)
+	model, ok := search.Lookup(args[0])
+	if !ok {
+		logger.Fatal("Model is not searchable", zap.String("model", args[0]))
+	}
+	manager, err := search.New(cfg.Search, logger)
+	if err != nil {
+		logger.Fatal("Invalid search config", zap.Error(err))
+	}
+	if err := manager.Flush(context.Background(), model); err != nil {
+		logger.Fatal("Failed to flush index", zap.String("index", manager.IndexName(model)), zap.Error(err))
+	}
+	fmt.Printf("🗑️  %s: flushed\n", manager.IndexName(model))
+}
+
+func dbExplain(cmd *cobra.Command, args []string) {
+	analyze, _ := cmd.Flags().GetBool("analyze")
+
+	logger := logger.New(cfg.Log.Level, cfg.Log.Format)
+	db, err := database.New(&cfg.Database)
+	if err != nil {
+		logger.Fatal("Failed to connect to database", zap.Error(err))
+	}
+	defer db.Close()
+
+	plan, err := db.Explain(context.Background(), args[0], analyze)
+	if err != nil {
+		logger.Fatal("Failed to explain query", zap.Error(err))
+	}
+
+	mode := "EXPLAIN"
+	if plan.Analyze {
+		mode = "EXPLAIN ANALYZE"
+	}
+	fmt.Printf("🔎 %s (%s)\n\n", mode, plan.Driver)
+	fmt.Println(plan.String())
+}
+
+func dbOptimize(cmd *cobra.Command, args []string) {
+	tables, _ := cmd.Flags().GetStringSlice("table")
+	every, _ := cmd.Flags().GetDuration("every")
+	force, _ := cmd.Flags().GetBool("force")
+	pretend, _ := cmd.Flags().GetBool("pretend")
+
+	logger := logger.New(cfg.Log.Level, cfg.Log.Format)
+	peak, err := database.NewPeakHours(cfg.Database.Optimize)
+	if err != nil {
+		logger.Fatal("Invalid database.optimize configuration", zap.Error(err))
+	}
+	db, err := database.New(&cfg.Database)
+	if err != nil {
+		logger.Fatal("Failed to connect to database", zap.Error(err))
+	}
+	defer db.Close()
+
+	if len(tables) == 0 {
+		tables = cfg.Database.Optimize.Tables
+	}
+	if len(tables) == 0 {
+		if tables, err = db.OptimizableTables(); err != nil {
+			logger.Fatal("Failed to list tables", zap.Error(err))
+		}
+	}
+	if len(tables) == 0 {
+		fmt.Println("ℹ️  No tables to optimize.")
+		return
+	}
+
+	if pretend {
+		for _, table := range tables {
+			statements, err := db.OptimizeStatements(table)
+			if err != nil {
+				logger.Fatal("Cannot optimize", zap.Error(err))
+			}
+			fmt.Printf("🛠️  %s: %s\n", table, strings.Join(statements, "; "))
+		}
+		if window, ok := peak.Active(time.Now()); ok && !force {
+			fmt.Printf("⏸️  Now is within peak hours (%s); a real run would be refused without --force\n", window)
+		}
+		return
+	}
+
+	// optimize reports false when it held off for peak hours
+	optimize := func(ctx context.Context) bool {
+		if window, ok := peak.Active(time.Now()); ok && !force {
+			logger.Warn("Skipping database optimization during peak hours", zap.String("peak_hours", window))
+			fmt.Printf("⏸️  Within peak hours (%s); use --force to run anyway\n", window)
+			return false
+		}
+		start := time.Now()
+		for _, table := range tables {
+			result, err := db.Optimize(ctx, table)
+			if err != nil {
+				logger.Error("Failed to optimize table", zap.String("table", table), zap.Duration("duration", result.Duration), zap.Error(err))
+				continue
+			}
+			logger.Info("Optimized table", zap.String("table", table), zap.Duration("duration", result.Duration))
+			fmt.Printf("🛠️  %s: optimized in %s\n", table, result.Duration.Round(time.Millisecond))
+		}
+		logger.Info("Database optimization finished", zap.Int("tables", len(tables)), zap.Duration("duration", time.Since(start)))
+		return true
+	}
+
+	if every <= 0 {
+		if !optimize(context.Background()) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	fmt.Printf("⏰ Optimizing every %s (Ctrl+C to stop)\n", every)
+	schedule.Every(ctx, every, func(ctx context.Context) { optimize(ctx) }, scheduleOptions(cmd, db, "schedule:db:optimize")...)
+}
+
+func queueWork(cmd *cobra.Command, args []string) {
+	connection, _ := cmd.Flags().GetString("connection")
+	queues, _ := cmd.Flags().GetStringSlice("queue")
+	if connection == "" {
+		connection = cfg.Queue.Default
+	}
+
+	logger := logger.New(cfg.Log.Level, cfg.Log.Format)
+	queue.Handle(media.JobType, media.Default.JobHandler())
+	if cfg.Workflow.Enabled {
+		db, err := database.New(&cfg.Database)
+		if err != nil {
+			logger.Fatal("Failed to connect to database", zap.Error(err))
+		}
+		defer db.Close()
+		store, err := workflow.NewDBStore(db.GetDB())
+		if err != nil {
+			logger.Fatal("Failed to open workflow store", zap.Error(err))
+		}
+		workflow.Default.SetStore(store)
+		workflow.Default.SetLogger(logger)
+	}
+	queue.Handle(workflow.JobType, workflow.Default.JobHandler())
+	if cfg.Async.Enabled {
+		db, err := database.New(&cfg.Database)
+		if err != nil {
+			logger.Fatal("Failed to connect to database", zap.Error(err))
+		}
+		defer db.Close()
+		store, err := async.NewDBStore(db.GetDB())
+		if err != nil {
+			logger.Fatal("Failed to open async operation store", zap.Error(err))
+		}
+		async.Default.SetStore(store)
+		async.Default.SetLogger(logger)
+		async.Default.SetTimeout(cfg.Async.Timeout)
+	}
+	queue.Handle(async.JobType, async.Default.JobHandler())
+	if cfg.Search.Enabled {
+		manager, err := search.New(cfg.Search, logger)
+		if err != nil {
+			logger.Fatal("Invalid search config", zap.Error(err))
+		}
+		queue.Handle(search.JobType, manager.JobHandler())
+		defer manager.Close()
+	}
+	if cfg.Scan.Enabled() {
+		guard, err := scan.FromConfig(cfg, logger)
+		if err != nil {
+			logger.Fatal("Invalid scan config", zap.Error(err))
+		}
+		media.Default.UseScanner(guard)
+		queue.Handle(scan.JobType, guard.JobHandler())
+	}
+
+	manager, err := queue.NewManager(cfg.Queue, logger)
+	if err != nil {
+		logger.Fatal("Invalid queue config", zap.Error(err))
+	}
+	defer manager.Close()
+	driver, err := manager.Connection(connection)
+	if err != nil {
+		logger.Fatal("Failed to connect to queue", zap.String("connection", connection), zap.Error(err))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	fmt.Printf("🐬 Working %s on %s (Ctrl+C to stop)\n", strings.Join(queues, ", "), connection)
+	var wg sync.WaitGroup
+	for _, name := range queues {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			if err := driver.Work(ctx, name, queue.Dispatch); err != nil && ctx.Err() == nil {
+				logger.Error("Queue worker stopped", zap.String("queue", name), zap.Error(err))
+				stop()
+			}
+		}(name)
+	}
+	wg.Wait()
+}
+
+func workflowList(cmd *cobra.Command, args []string) {
+	statuses, _ := cmd.Flags().GetStringSlice("status")
+	name, _ := cmd.Flags().GetString("workflow")
+	limit, _ := cmd.Flags().GetInt("limit")
+
+	logger := logger.New(cfg.Log.Level, cfg.Log.Format)
+	db, err := database.New(&cfg.Database)
+	if err != nil {
+		logger.Fatal("Failed to connect to database", zap.Error(err))
+	}
+	defer db.Close()
+	store, err := workflow.NewDBStore(db.GetDB())
+	if err != nil {
+		logger.Fatal("Failed to open workflow store", zap.Error(err))
+	}
+
+	filter := workflow.Filter{Workflow: name, Limit: limit}
+	for _, status := range statuses {
+		filter.Statuses = append(filter.Statuses, workflow.Status(status))
+	}
+	instances, err := store.List(context.Background(), filter)
+	if err != nil {
+		logger.Fatal("Failed to list workflows", zap.Error(err))
+	}
+	if len(instances) == 0 {
+		fmt.Println("🔀 No workflow instances")
+		return
+	}
+
+	fmt.Printf("🔀 %d workflow instance(s)\n\n", len(instances))
+	fmt.Printf("   %-36s %-20s %-12s %-16s %-8s %s\n", "ID", "WORKFLOW", "STATUS", "STEP", "ATTEMPTS", "UPDATED")
+	for _, instance := range instances {
+		step := instance.StepName
+		if step == "" {
+			step = "-"
+		}
+		fmt.Printf("   %-36s %-20s %-12s %-16s %-8d %s\n", instance.ID, instance.Workflow, instance.Status, step,
+			instance.Attempts, instance.UpdatedAt.Local().Format("2006-01-02 15:04:05"))
+		if instance.Error != "" {
+			message := instance.Error
+			if len(message) > 120 {
+				message = message[:117] + "..."
+			}
+			fmt.Printf("      ❌ %s\n", message)
+		}
+	}
+}
+
+func workflowRetry(cmd *cobra.Command, args []string) {
+	logger := logger.New(cfg.Log.Level, cfg.Log.Format)
+	db, err := database.New(&cfg.Database)
+	if err != nil {
+		logger.Fatal("Failed to connect to database", zap.Error(err))
+	}
+	defer db.Close()
+	store, err := workflow.NewDBStore(db.GetDB())
+	if err != nil {
+		logger.Fatal("Failed to open workflow store", zap.Error(err))
+	}
+
+	instance, err := workflow.NewEngine(store, logger).Retry(context.Background(), args[0])
+	if err != nil {
+		logger.Fatal("Failed to retry workflow", zap.Error(err))
+	}
+	fmt.Printf("🔁 Workflow %s (%s) is %s\n", instance.ID, instance.Workflow, instance.Status)
+	if !instance.Status.Finished() {
+		fmt.Println("   The application's workflow worker will pick it up (workflow.enabled must be true)")
+	}
+}
+
+func webhooksList(cmd *cobra.Command, args []string) {
+	source, _ := cmd.Flags().GetString("source")
+	failed, _ := cmd.Flags().GetBool("failed")
+	limit, _ := cmd.Flags().GetInt("limit")
+
+	logger := logger.New(cfg.Log.Level, cfg.Log.Format)
+	db, err := database.New(&cfg.Database)
+	if err != nil {
+		logger.Fatal("Failed to connect to database", zap.Error(err))
+	}
+	defer db.Close()
+	store, err := webhooks.NewStore(db.GetDB())
+	if err != nil {
+		logger.Fatal("Failed to open webhook store", zap.Error(err))
+	}
+
+	deliveries, err := store.List(context.Background(), webhooks.Filter{Source: source, Failed: failed, Limit: limit})
+	if err != nil {
+		logger.Fatal("Failed to list webhooks", zap.Error(err))
+	}
+	if len(deliveries) == 0 {
+		fmt.Println("🪝 No captured webhooks")
+		if !cfg.Webhooks.Capture {
+			fmt.Println("   Capture is off; set webhooks.capture to keep inbound webhooks")
+		}
+		return
+	}
+
+	fmt.Printf("🪝 %d webhook(s)\n\n", len(deliveries))
+	fmt.Printf("   %-16s %-12s %-6s %-40s %-6s %s\n", "ID", "SOURCE", "METHOD", "URL", "STATUS", "RECEIVED")
+	for _, delivery := range deliveries {
+		url := delivery.URL
+		if len(url) > 40 {
+			url = url[:37] + "..."
+		}
+		status := strconv.Itoa(delivery.Status)
+		if delivery.Failed() {
+			status = "❌ " + status
+		}
+		fmt.Printf("   %-16s %-12s %-6s %-40s %-6s %s", delivery.ID, delivery.Source, delivery.Method, url, status,
+			delivery.ReceivedAt.Local().Format("2006-01-02 15:04:05"))
+		if delivery.ReplayOf != "" {
+			fmt.Printf("  ↻ %s", delivery.ReplayOf)
+		}
+		fmt.Println()
+	}
+}
+
+func webhooksReplay(cmd *cobra.Command, args []string) {
+	logger := logger.New("error", cfg.Log.Format)
+	db, err := database.New(&cfg.Database)
+	if err != nil {
+		logger.Fatal("Failed to connect to database", zap.Error(err))
+	}
+	r := router.New(app.New(cfg, logger, db))
+	defer r.Close(context.Background())
+	if r.Webhooks() == nil {
+		logger.Fatal("Webhook capture is off; set webhooks.capture to replay webhooks")
+	}
+
+	delivery, err := r.Webhooks().Replay(context.Background(), args[0])
+	if err != nil {
+		logger.Fatal("Failed to replay webhook", zap.Error(err))
+	}
+	fmt.Printf("🔁 Replayed %s as %s: %s %s answered %d in %s\n", args[0], delivery.ID, delivery.Method, delivery.URL,
+		delivery.Status, delivery.Duration.Round(time.Millisecond))
+	if delivery.Response != "" {
+		fmt.Printf("   %s\n", strings.TrimSpace(delivery.Response))
+	}
+	if delivery.Failed() {
+		os.Exit(1)
+	}
+}
+
+func dbAnonymize(cmd *cobra.Command, args []string) {
+	path, _ := cmd.Flags().GetString("config")
+	tables, _ := cmd.Flags().GetStringSlice("table")
+	force, _ := cmd.Flags().GetBool("force")
+
+	logger := logger.New(cfg.Log.Level, cfg.Log.Format)
+	anonymize, err := database.LoadAnonymizeConfig(path)
+	if err != nil {
+		logger.Fatal("Failed to load anonymization config", zap.Error(err))
+	}
+	if len(tables) > 0 {
+		selected := map[string]database.AnonymizeTable{}
+		for _, table := range tables {
+			spec, ok := anonymize.Tables[table]
+			if !ok {
+				logger.Fatal("Table is not in the anonymization config", zap.String("table", table), zap.String("config", path))
+			}
+			selected[table] = spec
+		}
+		anonymize.Tables = selected
+	}
+
+	if cfg.IsProduction() && !force {
+		fmt.Println("❌ Refusing to anonymize a production database. Load the dump into staging first, or pass --force.")
+		os.Exit(1)
+	}
+	if !force {
+		fmt.Printf("⚠️  This will overwrite columns in %s of %s. Are you sure? (y/N): ",
+			strings.Join(anonymize.TableNames(), ", "), cfg.Database.Database)
+		var response string
+		fmt.Scanln(&response)
+		if response != "y" && response != "Y" {
+			fmt.Println("Operation cancelled.")
+			return
+		}
+	}
+
+	db, err := database.New(&cfg.Database)
+	if err != nil {
+		logger.Fatal("Failed to connect to database", zap.Error(err))
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	start := time.Now()
+	ui := progressUI(cmd)
+	var bar *progress.Bar
+	var barTable string
+	results, err := db.Anonymize(ctx, anonymize, func(table string, done, total int64) {
+		if bar == nil || barTable != table {
+			bar, barTable = ui.Bar("🕶️  "+table, total), table
+		}
+		bar.Set(done)
+		if done == total {
+			bar.Done()
+		}
+	})
+	if err != nil {
+		if bar != nil {
+			bar.Fail()
+		}
+		logger.Fatal("Failed to anonymize", zap.Error(err))
+	}
+
+	var rows int64
+	for _, result := range results {
+		rows += result.Rows
+	}
+	fmt.Printf("✅ Anonymized %d rows in %d tables in %s\n", rows, len(results), time.Since(start).Round(time.Millisecond))
+}
+
 func dbWipe(cmd *cobra.Command, args []string) {
 	fmt.Print("⚠️  This will DROP ALL TABLES. Are you sure? (y/N): ")
 	var response string
@@ -1739,22 +3489,51 @@ func cacheWarm(cmd *cobra.Command, args []string) {
 }
 
 func routeList(cmd *cobra.Command, args []string) {
+	logger := logger.New("error", cfg.Log.Format)
+	db, err := database.New(&cfg.Database)
+	if err != nil {
+		logger.Fatal("Failed to connect to database", zap.Error(err))
+	}
+	r := router.New(app.New(cfg, logger, db))
+	defer r.Close(context.Background())
+
+	type route struct {
+		method, path string
+		middleware   []string
+	}
+	var routes []route
+	err = routing.Walk(r.Routes(), func(method, path string, _ http.Handler, middleware ...func(http.Handler) http.Handler) error {
+		routes = append(routes, route{method, path, routing.Names(middleware...)})
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Failed to list routes: %v", err)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].path != routes[j].path {
+			return routes[i].path < routes[j].path
+		}
+		return routes[i].method < routes[j].method
+	})
+
 	fmt.Println("🛣️  Registered Routes:")
 	fmt.Println("===================")
-	fmt.Println("GET    /health")
-	fmt.Println("GET    /swagger/*")
-	fmt.Println("POST   /api/v1/auth/login")
-	fmt.Println("POST   /api/v1/auth/register")
-	fmt.Println("POST   /api/v1/auth/logout")
-	fmt.Println("POST   /api/v1/auth/refresh")
-	fmt.Println("GET    /api/v1/users")
-	fmt.Println("POST   /api/v1/users")
-	fmt.Println("GET    /api/v1/users/{id}")
-	fmt.Println("PUT    /api/v1/users/{id}")
-	fmt.Println("DELETE /api/v1/users/{id}")
-	fmt.Println("GET    /api/v1/protected/user")
-	fmt.Println("PUT    /api/v1/protected/user")
-	fmt.Println("DELETE /api/v1/protected/user")
+	for _, route := range routes {
+		fmt.Printf("%-7s %-50s %s\n", route.method, route.path, strings.Join(route.middleware, ", "))
+	}
+
+	fmt.Println()
+	groups := routing.Default.Groups()
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Println("🧩 Middleware groups:")
+	for _, name := range names {
+		fmt.Printf("   %-10s %s\n", name, strings.Join(groups[name], ", "))
+	}
+	fmt.Printf("   aliases:   %s\n", strings.Join(routing.Default.Aliases(), ", "))
 }
 
 func makeStaticPage(cmd *cobra.Command, args []string) {
@@ -1785,17 +3564,79 @@ func staticServe(cmd *cobra.Command, args []string) {
 	fmt.Printf("🌐 Starting static file server on port %d serving %s\n", port, dir)
 }
 
+func langMissing(cmd *cobra.Command, args []string) {
+	paths, _ := cmd.Flags().GetStringSlice("path")
+	locales, _ := cmd.Flags().GetStringSlice("locale")
+
+	translator, err := i18n.New(cfg.I18n)
+	if err != nil {
+		log.Fatalf("Failed to load translations: %v", err)
+	}
+	usages, err := i18n.Scan(paths...)
+	if err != nil {
+		log.Fatalf("Failed to scan for translation keys: %v", err)
+	}
+	if len(locales) == 0 {
+		locales = translator.Locales()
+	}
+
+	missing := translator.Missing(usages, locales...)
+	total := 0
+	for _, locale := range locales {
+		keys := missing[i18n.Canonical(locale)]
+		if len(keys) == 0 {
+			fmt.Printf("✅ %s: all keys translated\n", i18n.Canonical(locale))
+			continue
+		}
+		total += len(keys)
+		fmt.Printf("🌐 %s: %d missing key(s)\n", i18n.Canonical(locale), len(keys))
+		for _, usage := range keys {
+			fmt.Printf("   %-40s %s:%d\n", usage.Key, usage.File, usage.Line)
+		}
+	}
+	if total > 0 {
+		os.Exit(1)
+	}
+}
+
 func keyGenerate(cmd *cobra.Command, args []string) {
 	fmt.Println("🔑 Generating application key...")
 	// Implementation would go here
 	fmt.Println("✅ Application key generated!")
 }
 
+func configCache(cmd *cobra.Command, args []string) {
+	cached, err := config.Cache()
+	if err != nil {
+		fmt.Printf("❌ Failed to cache configuration: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("✅ Configuration cached in %s (environment: %s)\n", config.CachePath, cached.App.Environment)
+	fmt.Println("   Run `dolphin config:cache` again after changing .env or config/*.yaml")
+}
+
+func configClear(cmd *cobra.Command, args []string) {
+	cleared, err := config.ClearCache()
+	if err != nil {
+		fmt.Printf("❌ Failed to clear the configuration cache: %v\n", err)
+		os.Exit(1)
+	}
+	if !cleared {
+		fmt.Println("ℹ️  No configuration cache to clear")
+		return
+	}
+	fmt.Println("🧹 Configuration cache cleared")
+}
+
 // --- Project scaffolding ---
 func newProject(cmd *cobra.Command, args []string) {
 	name := args[0]
 	fmt.Printf("🐬 Creating new Dolphin project: %s\n", name)
 	includeAuth, _ := cmd.Flags().GetBool("auth")
+	frontendStack, _ := cmd.Flags().GetString("frontend")
+	if frontendStack != "" && !slices.Contains(frontend.Frontends, frontendStack) {
+		log.Fatalf("Unknown frontend %q (want %s)", frontendStack, strings.Join(frontend.Frontends, " or "))
+	}
 
 	// Directories
 	dirs := []string{
@@ -1814,6 +3655,7 @@ func newProject(cmd *cobra.Command, args []string) {
 		// storage and migrations
 		name + "/storage/uploads",
 		name + "/migrations",
+		name + "/public",
 	}
 	for _, d := range dirs {
 		if err := os.MkdirAll(d, 0755); err != nil {
@@ -1851,11 +3693,16 @@ func main() {
 	}
 
 	// config file
-	configYAML := []byte("app:\n  name: \"" + name + "\"\n  debug: true\nserver:\n  host: \"localhost\"\n  port: 8080\n")
+	configYAML := []byte("app:\n  name: \"" + name + "\"\n  debug: true\nserver:\n  host: \"localhost\"\n  port: 8080\n" + features.ScaffoldYAML())
 	if err := os.WriteFile(name+"/config/config.yaml", configYAML, 0644); err != nil {
 		log.Fatalf("Failed to write config/config.yaml: %v", err)
 	}
 
+	// HTTP presets: CORS, the default auth guard and rate limiters
+	if err := os.WriteFile(name+"/config/"+config.HTTPFile, []byte(config.HTTPPresets), 0644); err != nil {
+		log.Fatalf("Failed to write config/%s: %v", config.HTTPFile, err)
+	}
+
 	// .env.example
 	envExample := []byte("APP_NAME=" + name + "\n" +
 		"APP_ENV=development\n" +
@@ -1879,7 +3726,11 @@ func main() {
 	}
 
 	// Scaffold minimal UI views and layout
-	_ = os.WriteFile(name+"/ui/views/layouts/base.html", []byte(`<!DOCTYPE html><html lang="en"><head><meta charset="UTF-8"><meta name="viewport" content="width=device-width,initial-scale=1.0"><title>Dolphin</title><script src="https://unpkg.com/htmx.org@1.9.10"></script><style>body{margin:0;font-family:system-ui,-apple-system,Segoe UI,Roboto,Ubuntu,sans-serif;background:#f6f7fb;color:#111827}</style></head><body>{{header}}<main>{{yield}}</main>{{footer}}</body></html>`), 0644)
+	headTags := ""
+	if frontendStack != "" {
+		headTags = frontend.ViteLayoutTags(frontendStack)
+	}
+	_ = os.WriteFile(name+"/ui/views/layouts/base.html", []byte(`<!DOCTYPE html><html lang="en"><head><meta charset="UTF-8"><meta name="viewport" content="width=device-width,initial-scale=1.0"><title>Dolphin</title><script src="https://unpkg.com/htmx.org@1.9.10"></script><style>body{margin:0;font-family:system-ui,-apple-system,Segoe UI,Roboto,Ubuntu,sans-serif;background:#f6f7fb;color:#111827}</style>`+headTags+`</head><body>{{header}}<main>{{yield}}</main>{{footer}}</body></html>`), 0644)
 	headerNav := `<nav style="display:flex;gap:16px">`
 	if includeAuth {
 		headerNav += `<a href="/auth/login">Login</a><a href="/auth/register">Register</a>`
@@ -1888,10 +3739,14 @@ func main() {
 	_ = os.WriteFile(name+"/ui/views/partials/header.html", []byte(`<header style="background:#fff;border-bottom:1px solid #e5e7eb"><div style="max-width:1100px;margin:0 auto;padding:14px 16px;display:flex;justify-content:space-between"><a href="/" style="text-decoration:none;color:#0ea5a4;font-weight:800">🐬 DOLPHIN</a>`+headerNav+`</div></header>`), 0644)
 	_ = os.WriteFile(name+"/ui/views/partials/footer.html", []byte(`<footer style="border-top:1px solid #e5e7eb;margin-top:32px;background:#fff"><div style="max-width:1100px;margin:0 auto;padding:18px 16px;color:#6b7280;font-size:14px;text-align:center">Built with ❤️ by the Dolphin community • MIT License</div></footer>`), 0644)
 	_ = os.WriteFile(name+"/ui/views/pages/home.html", []byte(`<section style="max-width:1100px;margin:24px auto;padding:0 16px"><div style="background:#fff;border:1px solid #e5e7eb;border-radius:16px;padding:24px"><h1 style="font-size:32px;margin:0 0 8px">Welcome to Dolphin</h1><p style="color:#6b7280">Enterprise-grade Go web framework for rapid development.</p><div style="margin-top:12px;display:flex;gap:12px"><a href="/auth/register">Get Started</a><a href="/auth/login">Login</a></div></div></section>`), 0644)
-	_ = os.WriteFile(name+"/ui/views/pages/dashboard.html", []byte(`<section style="max-width:1100px;margin:24px auto;padding:0 16px"><h2>Dashboard</h2><div>Build your widgets here.</div></section>`), 0644)
+	dashboardBody := `<div>Build your widgets here.</div>`
+	if frontendStack != "" {
+		dashboardBody = `<div id="app"></div>`
+	}
+	_ = os.WriteFile(name+"/ui/views/pages/dashboard.html", []byte(`<section style="max-width:1100px;margin:24px auto;padding:0 16px"><h2>Dashboard</h2>`+dashboardBody+`</section>`), 0644)
 	if includeAuth {
-		_ = os.WriteFile(name+"/ui/views/auth/login.html", []byte(`<section style="max-width:480px;margin:32px auto;padding:0 16px"><div style="background:#fff;border:1px solid #e5e7eb;border-radius:12px;padding:20px"><h2>Login</h2><form hx-post="/auth/login" hx-target="#login-result"><input name="email" placeholder="Email" style="width:100%;margin:6px 0;padding:8px;border:1px solid #e5e7eb;border-radius:8px"/><input name="password" type="password" placeholder="Password" style="width:100%;margin:6px 0;padding:8px;border:1px solid #e5e7eb;border-radius:8px"/><button type="submit" style="padding:8px 12px">Login</button></form><div id="login-result" style="margin-top:8px"></div></div></section>`), 0644)
-		_ = os.WriteFile(name+"/ui/views/auth/register.html", []byte(`<section style="max-width:480px;margin:32px auto;padding:0 16px"><div style="background:#fff;border:1px solid #e5e7eb;border-radius:12px;padding:20px"><h2>Register</h2><form hx-post="/auth/register" hx-target="#register-result"><input name="firstName" placeholder="First Name" style="width:100%;margin:6px 0;padding:8px;border:1px solid #e5e7eb;border-radius:8px"/><input name="lastName" placeholder="Last Name" style="width:100%;margin:6px 0;padding:8px;border:1px solid #e5e7eb;border-radius:8px"/><input name="email" placeholder="Email" style="width:100%;margin:6px 0;padding:8px;border:1px solid #e5e7eb;border-radius:8px"/><input name="password" type="password" placeholder="Password" style="width:100%;margin:6px 0;padding:8px;border:1px solid #e5e7eb;border-radius:8px"/><button type="submit" style="padding:8px 12px">Create Account</button></form><div id="register-result" style="margin-top:8px"></div></div></section>`), 0644)
+		_ = os.WriteFile(name+"/ui/views/auth/login.html", []byte(`<section style="max-width:480px;margin:32px auto;padding:0 16px"><div style="background:#fff;border:1px solid #e5e7eb;border-radius:12px;padding:20px"><h2>Login</h2><form hx-post="/auth/login" hx-target="#login-result"><label for="email" style="display:block;margin-top:8px;font-size:14px">Email</label><input id="email" name="email" style="width:100%;margin:6px 0;padding:8px;border:1px solid #e5e7eb;border-radius:8px"/><label for="password" style="display:block;margin-top:8px;font-size:14px">Password</label><input id="password" name="password" type="password" style="width:100%;margin:6px 0;padding:8px;border:1px solid #e5e7eb;border-radius:8px"/><button type="submit" style="padding:8px 12px">Login</button></form><div id="login-result" role="status" aria-live="polite" style="margin-top:8px"></div></div></section>`), 0644)
+		_ = os.WriteFile(name+"/ui/views/auth/register.html", []byte(`<section style="max-width:480px;margin:32px auto;padding:0 16px"><div style="background:#fff;border:1px solid #e5e7eb;border-radius:12px;padding:20px"><h2>Register</h2><form hx-post="/auth/register" hx-target="#register-result"><label for="firstName" style="display:block;margin-top:8px;font-size:14px">First Name</label><input id="firstName" name="firstName" style="width:100%;margin:6px 0;padding:8px;border:1px solid #e5e7eb;border-radius:8px"/><label for="lastName" style="display:block;margin-top:8px;font-size:14px">Last Name</label><input id="lastName" name="lastName" style="width:100%;margin:6px 0;padding:8px;border:1px solid #e5e7eb;border-radius:8px"/><label for="email" style="display:block;margin-top:8px;font-size:14px">Email</label><input id="email" name="email" style="width:100%;margin:6px 0;padding:8px;border:1px solid #e5e7eb;border-radius:8px"/><label for="password" style="display:block;margin-top:8px;font-size:14px">Password</label><input id="password" name="password" type="password" style="width:100%;margin:6px 0;padding:8px;border:1px solid #e5e7eb;border-radius:8px"/><button type="submit" style="padding:8px 12px">Create Account</button></form><div id="register-result" role="status" aria-live="polite" style="margin-top:8px"></div></div></section>`), 0644)
 	}
 
 	// routes placeholder for users to extend
@@ -1910,8 +3765,17 @@ func Register(r chi.Router) {
 }
 `), 0644)
 
+	if frontendStack != "" {
+		if err := frontend.ScaffoldVite(name, name, frontendStack); err != nil {
+			log.Fatalf("Failed to scaffold the frontend: %v", err)
+		}
+	}
+
 	fmt.Println("✅ Project created!")
 	fmt.Printf("   Next:\n   cd %s && go mod tidy && dolphin serve\n", name)
+	if frontendStack != "" {
+		fmt.Println("   Frontend: npm install && npm run dev (npm run build for production)")
+	}
 }
 
 // --- Self-update ---
@@ -1986,6 +3850,74 @@ func updateSelf(cmd *cobra.Command, args []string) {
 	}
 }
 
+// --- Feature gate upgrade ---
+func upgradeApp(cmd *cobra.Command, args []string) {
+	enable, _ := cmd.Flags().GetStringSlice("enable")
+	all, _ := cmd.Flags().GetBool("all")
+	path, _ := cmd.Flags().GetString("config")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	yes, _ := cmd.Flags().GetBool("yes")
+
+	if all {
+		enable = features.Keys()
+	}
+
+	// Without a selection, report the state of every gate
+	if len(enable) == 0 {
+		pending, err := features.Plan(path, features.Keys())
+		if err != nil {
+			log.Fatal("Failed to read config:", err)
+		}
+		off := map[string]bool{}
+		for _, c := range pending {
+			off[c.Gate.Key] = true
+		}
+		fmt.Println("🚩 Feature gates:")
+		for _, g := range features.Gates {
+			state := "✅ on "
+			if off[g.Key] {
+				state = "⏸️  off"
+			}
+			fmt.Printf("   %s %-18s %s\n", state, g.Key, g.Description)
+		}
+		if len(pending) > 0 {
+			fmt.Println("\nEnable with: dolphin upgrade --enable <gate> (or --all)")
+		}
+		return
+	}
+
+	changes, err := features.Plan(path, enable)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(changes) == 0 {
+		fmt.Println("✅ Selected feature gates are already enabled.")
+		return
+	}
+
+	fmt.Printf("The following gates will be enabled in %s:\n", path)
+	for _, c := range changes {
+		fmt.Printf("   + %-18s %s\n", c.Gate.Key, c.Gate.Description)
+	}
+	if dryRun {
+		return
+	}
+	if !yes {
+		fmt.Print("These change runtime behavior. Continue? (y/N): ")
+		var response string
+		fmt.Scanln(&response)
+		if response != "y" && response != "Y" {
+			fmt.Println("Upgrade cancelled.")
+			return
+		}
+	}
+
+	if _, err := features.Upgrade(path, enable); err != nil {
+		log.Fatal("Failed to update config:", err)
+	}
+	fmt.Println("✅ Feature gates enabled. Restart the server to apply.")
+}
+
 // --- Debug command handlers ---
 func debugServe(cmd *cobra.Command, args []string) {
 	port, _ := cmd.Flags().GetInt("port")
@@ -2044,6 +3976,55 @@ func debugGC(cmd *cobra.Command, args []string) {
 	fmt.Printf("🧹 GC triggered via %s (status %d)\n", url, resp.StatusCode)
 }
 
+func debugExport(cmd *cobra.Command, args []string) {
+	host, _ := cmd.Flags().GetString("host")
+	port, _ := cmd.Flags().GetInt("port")
+	file, _ := cmd.Flags().GetString("file")
+
+	cfgLocal, err := config.Load()
+	if err != nil {
+		log.Fatal("Failed to load configuration:", err)
+	}
+	if file == "" {
+		file = cfgLocal.Debug.RecordFile
+	}
+	if port == 0 {
+		port = cfgLocal.Server.Port
+	}
+
+	// Recordings kept in a file can be read without the server
+	if file != "" {
+		if _, err := os.Stat(file); err == nil {
+			store, err := debug.OpenRecordingFile(file, 0)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer store.Close()
+			recording, err := store.Get(args[0])
+			if err != nil {
+				fmt.Printf("❌ Recording %s: %v\n", args[0], err)
+				os.Exit(1)
+			}
+			fmt.Println(recording.Curl())
+			return
+		}
+	}
+
+	url := fmt.Sprintf("%s:%d/debug/recordings/%s/curl", host, port, args[0])
+	resp, err := http.Get(url)
+	if err != nil {
+		fmt.Printf("❌ Could not reach the server at %s: %v\n", url, err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("❌ Recording %s: %s\n", args[0], strings.TrimSpace(string(body)))
+		os.Exit(1)
+	}
+	fmt.Print(string(body))
+}
+
 func maintenanceDown(cmd *cobra.Command, args []string) {
 	message, _ := cmd.Flags().GetString("message")
 	retryAfter, _ := cmd.Flags().GetInt("retry-after")
@@ -2125,6 +4106,149 @@ func maintenanceStatus(cmd *cobra.Command, args []string) {
 	}
 }
 
+func readOnlyOn(cmd *cobra.Command, args []string) {
+	message, _ := cmd.Flags().GetString("message")
+	retryAfter, _ := cmd.Flags().GetInt("retry-after")
+
+	readOnly := maintenance.NewReadOnly("storage/framework/read_only.json", cfg.ReadOnly)
+	if err := readOnly.Enable(message, retryAfter); err != nil {
+		fmt.Printf("❌ Failed to enable read-only mode: %v\n", err)
+		return
+	}
+
+	fmt.Println("📖 Read-only mode enabled!")
+	fmt.Printf("   Message: %s\n", readOnly.Info().Message)
+	fmt.Println("   Use 'dolphin read-only off' to accept writes again")
+}
+
+func readOnlyOff(cmd *cobra.Command, args []string) {
+	readOnly := maintenance.NewReadOnly("storage/framework/read_only.json", cfg.ReadOnly)
+	if err := readOnly.Disable(); err != nil {
+		fmt.Printf("❌ Failed to disable read-only mode: %v\n", err)
+		return
+	}
+
+	if readOnly.IsEnabled() {
+		fmt.Println("⚠️  Runtime toggle cleared, but read_only.enabled in config keeps read-only mode on")
+		return
+	}
+	fmt.Println("✅ Read-only mode disabled!")
+}
+
+func readOnlyStatus(cmd *cobra.Command, args []string) {
+	info := maintenance.NewReadOnly("storage/framework/read_only.json", cfg.ReadOnly).Info()
+
+	fmt.Println("📖 Read-only Mode Status:")
+	fmt.Println("========================")
+	if !info.Enabled {
+		fmt.Println("Status: 🟢 DISABLED")
+		return
+	}
+
+	fmt.Println("Status: 🟠 ENABLED")
+	if info.Forced {
+		fmt.Println("Source: config (read_only.enabled)")
+	}
+	fmt.Printf("Message: %s\n", info.Message)
+	fmt.Printf("Retry After: %d seconds\n", info.RetryAfter)
+	if !info.StartedAt.IsZero() {
+		fmt.Printf("Started At: %s\n", info.StartedAt.Format("2006-01-02 15:04:05"))
+	}
+}
+
+// --- Metering command handlers ---
+func meteringExport(cmd *cobra.Command, args []string) {
+	logger := logger.New(cfg.Log.Level, cfg.Log.Format)
+	if cfg.Metering.Store == "memory" {
+		logger.Fatal("Usage kept in memory can't be exported; set metering.store to database")
+	}
+
+	filter := metering.Filter{}
+	filter.Tenant, _ = cmd.Flags().GetString("tenant")
+	filter.Metric, _ = cmd.Flags().GetString("metric")
+	now := time.Now().UTC()
+	filter.From = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	filter.To = now
+	for flag, target := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		value, _ := cmd.Flags().GetString(flag)
+		if value == "" {
+			continue
+		}
+		t, err := parseExportTime(value)
+		if err != nil {
+			logger.Fatal("Invalid --"+flag, zap.Error(err))
+		}
+		*target = t
+	}
+
+	db, err := database.New(&cfg.Database)
+	if err != nil {
+		logger.Fatal("Failed to connect to database", zap.Error(err))
+	}
+	defer db.Close()
+
+	store, err := metering.NewDBStore(db.GetDB())
+	if err != nil {
+		logger.Fatal("Failed to open usage store", zap.Error(err))
+	}
+	ctx := context.Background()
+	usage, err := store.Query(ctx, filter)
+	if err != nil {
+		logger.Fatal("Failed to query usage", zap.Error(err))
+	}
+	if window, _ := cmd.Flags().GetDuration("window"); window > 0 {
+		usage = metering.Rollup(usage, window)
+	}
+
+	if webhook, _ := cmd.Flags().GetBool("webhook"); webhook {
+		if cfg.Metering.WebhookURL == "" {
+			logger.Fatal("metering.webhook_url is not set")
+		}
+		if err := metering.NewWebhookExporter(cfg.Metering.WebhookURL, cfg.Metering.WebhookSecret).Export(ctx, usage); err != nil {
+			logger.Fatal("Failed to export usage", zap.Error(err))
+		}
+		fmt.Printf("✅ Sent %d usage rows to %s\n", len(usage), cfg.Metering.WebhookURL)
+		return
+	}
+
+	out := io.Writer(os.Stdout)
+	output, _ := cmd.Flags().GetString("output")
+	if output != "" {
+		file, err := os.Create(output)
+		if err != nil {
+			logger.Fatal("Failed to create output file", zap.Error(err))
+		}
+		defer file.Close()
+		out = file
+	}
+
+	format, _ := cmd.Flags().GetString("format")
+	switch format {
+	case "csv":
+		err = metering.NewCSVExporter(out).Export(ctx, usage)
+	case "json":
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(usage)
+	default:
+		logger.Fatal("Unknown format", zap.String("format", format))
+	}
+	if err != nil {
+		logger.Fatal("Failed to export usage", zap.Error(err))
+	}
+	if output != "" {
+		fmt.Printf("✅ Exported %d usage rows to %s\n", len(usage), output)
+	}
+}
+
+// parseExportTime accepts a date or an RFC3339 timestamp
+func parseExportTime(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
 // --- Rate limit command handlers ---
 func rateLimitStatus(cmd *cobra.Command, args []string) {
 	fmt.Println("Rate Limiting Status:")
@@ -2144,30 +4268,101 @@ func rateLimitReset(cmd *cobra.Command, args []string) {
 
 // --- Health command handlers ---
 func healthCheck(cmd *cobra.Command, args []string) {
-	fmt.Println("Health Check Results:")
-	fmt.Println("====================")
-	fmt.Println("✅ Database: Connected")
-	fmt.Println("✅ Redis: Connected")
-	fmt.Println("✅ Application: Running")
-	fmt.Println("")
-	fmt.Println("Overall Status: HEALTHY")
+	logger := logger.New(cfg.Log.Level, cfg.Log.Format)
+	manager := health.NewHealthManager(version, logger)
+
+	db, err := database.New(&cfg.Database)
+	if err != nil {
+		manager.AddChecker(failedCheck{name: "database", err: err})
+		db = nil
+	} else {
+		defer db.Close()
+	}
+	if err := health.RegisterDefaults(manager, cfg, db); err != nil {
+		logger.Fatal("Failed to set up health checks", zap.Error(err))
+	}
+
+	printHealth(cmd, "Health Check Results:", manager.CheckAll(context.Background()))
 }
 
 func healthLive(cmd *cobra.Command, args []string) {
-	fmt.Println("Liveness Check:")
-	fmt.Println("===============")
-	fmt.Println("✅ Application is alive")
-	fmt.Println("Status: OK")
+	printHealth(cmd, "Liveness Check:", fetchHealth(cmd, "/health/live"))
 }
 
 func healthReady(cmd *cobra.Command, args []string) {
-	fmt.Println("Readiness Check:")
-	fmt.Println("================")
-	fmt.Println("✅ Database: Ready")
-	fmt.Println("✅ Redis: Ready")
-	fmt.Println("✅ Application: Ready")
-	fmt.Println("")
-	fmt.Println("Status: READY")
+	printHealth(cmd, "Readiness Check:", fetchHealth(cmd, "/health/ready"))
+}
+
+// failedCheck reports a dependency that couldn't even be set up
+type failedCheck struct {
+	name string
+	err  error
+}
+
+func (f failedCheck) GetName() string { return f.name }
+
+func (f failedCheck) Check(ctx context.Context) health.HealthStatus {
+	return health.HealthStatus{Status: health.StatusUnhealthy, Message: f.err.Error()}
+}
+
+// fetchHealth queries a health endpoint of the running application
+func fetchHealth(cmd *cobra.Command, path string) health.HealthResponse {
+	base, _ := cmd.Flags().GetString("url")
+	if base == "" {
+		base = fmt.Sprintf("http://localhost:%d", cfg.Server.Port)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(strings.TrimSuffix(base, "/") + path)
+	if err != nil {
+		fmt.Printf("❌ Application is not responding: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	var response health.HealthResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		fmt.Printf("❌ Unexpected response from %s (HTTP %d): %v\n", path, resp.StatusCode, err)
+		os.Exit(1)
+	}
+	return response
+}
+
+// printHealth prints health results and exits 1 when unhealthy
+func printHealth(cmd *cobra.Command, title string, response health.HealthResponse) {
+	if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+		out, _ := json.MarshalIndent(response, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		fmt.Println(title)
+		fmt.Println(strings.Repeat("=", len(title)))
+
+		names := make([]string, 0, len(response.Checks))
+		for name := range response.Checks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			check := response.Checks[name]
+			icon := "✅"
+			switch check.Status {
+			case health.StatusDegraded:
+				icon = "⚠️ "
+			case health.StatusUnhealthy:
+				icon = "❌"
+			}
+			fmt.Printf("%s %s: %s (%s)\n", icon, name, check.Message, check.Duration.Round(time.Millisecond))
+		}
+		if len(names) == 0 {
+			fmt.Printf("✅ Application is alive (up %s)\n", response.Uptime.Round(time.Second))
+		}
+		fmt.Println("")
+		fmt.Printf("Overall Status: %s\n", strings.ToUpper(response.Status))
+	}
+
+	if response.Status == health.StatusUnhealthy {
+		os.Exit(1)
+	}
 }
 
 // --- Mail command handlers ---
@@ -2393,6 +4588,36 @@ func policyTest(cmd *cobra.Command, args []string) {
 	fmt.Println("💡 Tip: Use 'dolphin security policy create' to define custom policies")
 }
 
+// newCredentialsCmd builds the credentials command group
+func newCredentialsCmd() *cobra.Command {
+	credentialsCmd := &cobra.Command{
+		Use:   "credentials",
+		Short: "Manage encrypted credentials",
+		Long:  "Encrypt, decrypt, and edit .env.encrypted, which the application decrypts in memory at boot with .dolphin/credentials.key or DOLPHIN_MASTER_KEY.",
+	}
+
+	credentialsCmd.AddCommand(&cobra.Command{
+		Use:   "encrypt <file>",
+		Short: "Encrypt credentials file",
+		Long:  "Encrypt a .env file containing sensitive credentials to .env.encrypted, generating the master key if needed.",
+		Args:  cobra.ExactArgs(1),
+		Run:   credentialsEncrypt,
+	}, &cobra.Command{
+		Use:   "decrypt <file>",
+		Short: "Decrypt credentials file",
+		Long:  "Decrypt .env.encrypted and output to a file.",
+		Args:  cobra.ExactArgs(1),
+		Run:   credentialsDecrypt,
+	}, &cobra.Command{
+		Use:   "edit",
+		Short: "Edit encrypted credentials",
+		Long:  "Decrypt .env.encrypted to a temporary file, open it in $EDITOR and re-encrypt it when the editor exits.",
+		Args:  cobra.NoArgs,
+		Run:   credentialsEdit,
+	})
+	return credentialsCmd
+}
+
 func credentialsEncrypt(cmd *cobra.Command, args []string) {
 	file := args[0]
 	fmt.Printf("Encrypting credentials file: %s\n", file)
@@ -2405,14 +4630,14 @@ func credentialsEncrypt(cmd *cobra.Command, args []string) {
 	}
 
 	// Create credential manager
-	cm, err := security.NewCredentialManager(".dolphin/credentials.key")
+	cm, err := security.NewCredentialManager(security.CredentialsKeyFile)
 	if err != nil {
 		fmt.Printf("❌ Failed to create credential manager: %v\n", err)
 		return
 	}
 
 	// Encrypt the file
-	if err := cm.EncryptFile(file); err != nil {
+	if err := cm.EncryptEnv(file, security.EncryptedEnvFile); err != nil {
 		fmt.Printf("❌ Failed to encrypt credentials: %v\n", err)
 		return
 	}
@@ -2420,14 +4645,15 @@ func credentialsEncrypt(cmd *cobra.Command, args []string) {
 	fmt.Println("✅ Credentials encrypted successfully!")
 	fmt.Println("")
 	fmt.Println("🔐 Security Information:")
-	fmt.Println("- Master key saved to: .dolphin/credentials.key")
-	fmt.Println("- Encrypted credentials saved to: .dolphin/credentials.key.credentials")
-	fmt.Println("- Keep these files secure and never commit them to version control")
+	fmt.Printf("- Master key: %s (or %s)\n", security.CredentialsKeyFile, security.MasterKeyEnv)
+	fmt.Printf("- Encrypted credentials saved to: %s, decrypted in memory at boot\n", security.EncryptedEnvFile)
+	fmt.Println("- Never commit the master key; the encrypted file is safe to commit")
 	fmt.Println("")
 	fmt.Println("💡 Next steps:")
 	fmt.Println("1. Add .dolphin/ to your .gitignore")
-	fmt.Println("2. Use 'dolphin security credentials decrypt' to decrypt when needed")
-	fmt.Println("3. Integrate CredentialManager in your application")
+	fmt.Printf("2. Delete %s, or keep it for local overrides (it takes precedence)\n", file)
+	fmt.Println("3. Use 'dolphin credentials edit' to change credentials")
+	fmt.Printf("4. In production, set %s to the base64 of the key\n", security.MasterKeyEnv)
 }
 
 func credentialsDecrypt(cmd *cobra.Command, args []string) {
@@ -2435,16 +4661,13 @@ func credentialsDecrypt(cmd *cobra.Command, args []string) {
 	fmt.Printf("Decrypting credentials to: %s\n", file)
 	fmt.Println("")
 
-	// Create credential manager
-	cm, err := security.NewCredentialManager(".dolphin/credentials.key")
+	plaintext, err := security.DecryptEnvFile(security.EncryptedEnvFile, security.CredentialsKeyFile)
 	if err != nil {
-		fmt.Printf("❌ Failed to create credential manager: %v\n", err)
+		fmt.Printf("❌ Failed to decrypt credentials: %v\n", err)
 		return
 	}
-
-	// Decrypt to file
-	if err := cm.DecryptToFile(file); err != nil {
-		fmt.Printf("❌ Failed to decrypt credentials: %v\n", err)
+	if err := os.WriteFile(file, plaintext, 0600); err != nil {
+		fmt.Printf("❌ Failed to write credentials: %v\n", err)
 		return
 	}
 
@@ -2454,7 +4677,60 @@ func credentialsDecrypt(cmd *cobra.Command, args []string) {
 	fmt.Println("⚠️  Security Warning:")
 	fmt.Println("- Delete the decrypted file after use")
 	fmt.Println("- Never commit decrypted credentials to version control")
-	fmt.Println("- Use environment variables or secure secret management in production")
+	fmt.Println("- Prefer 'dolphin credentials edit', which never leaves plaintext behind")
+}
+
+func credentialsEdit(cmd *cobra.Command, args []string) {
+	cm, err := security.NewCredentialManager(security.CredentialsKeyFile)
+	if err != nil {
+		fmt.Printf("❌ Failed to create credential manager: %v\n", err)
+		os.Exit(1)
+	}
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	changed, err := cm.EditEnv(security.EncryptedEnvFile, func(file string) error {
+		for {
+			// The editor may carry arguments, e.g. "code --wait"
+			words := strings.Fields(editor)
+			edit := exec.Command(words[0], append(words[1:], file)...)
+			edit.Stdin, edit.Stdout, edit.Stderr = os.Stdin, os.Stdout, os.Stderr
+			if err := edit.Run(); err != nil {
+				return fmt.Errorf("%s: %w", editor, err)
+			}
+
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			_, err = godotenv.Unmarshal(string(data))
+			if err == nil {
+				return nil
+			}
+			fmt.Printf("❌ Invalid .env syntax: %v\n", err)
+			fmt.Print("Re-open the editor? (Y/n): ")
+			var response string
+			fmt.Scanln(&response)
+			if response == "n" || response == "N" {
+				return fmt.Errorf("credentials left unchanged")
+			}
+		}
+	})
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	if !changed {
+		fmt.Println("ℹ️  No changes.")
+		return
+	}
+	fmt.Printf("✅ %s updated\n", security.EncryptedEnvFile)
 }
 
 func csrfGenerate(cmd *cobra.Command, args []string) {
@@ -2489,62 +4765,73 @@ func csrfGenerate(cmd *cobra.Command, args []string) {
 
 // --- Observability command handlers ---
 func metricsStatus(cmd *cobra.Command, args []string) {
-	fmt.Println("📊 Metrics Status")
-	fmt.Println("==================")
-	fmt.Println("")
+	url, _ := cmd.Flags().GetString("url")
+	if url == "" {
+		url = cfg.Metrics.URL()
+	}
 
-	fmt.Println("🔧 Configuration:")
-	fmt.Println("  Namespace: dolphin")
-	fmt.Println("  Subsystem: app")
-	fmt.Println("  Path: /metrics")
-	fmt.Println("  Port: 9090")
-	fmt.Println("")
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		fmt.Printf("❌ Metrics endpoint is not responding: %v\n", err)
+		if !cfg.Metrics.Enabled {
+			fmt.Println("💡 Metrics are disabled; set metrics.enabled in config and restart `dolphin serve`")
+		}
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("❌ %s returned HTTP %d\n", url, resp.StatusCode)
+		os.Exit(1)
+	}
 
-	fmt.Println("📈 Available Metrics:")
-	fmt.Println("  • HTTP Requests (total, duration, size)")
-	fmt.Println("  • Application (uptime, memory, goroutines)")
-	fmt.Println("  • Database (connections, queries, errors)")
-	fmt.Println("  • Cache (hits, misses, operations)")
-	fmt.Println("  • Business (events, registrations, logins)")
-	fmt.Println("  • Custom (counters, gauges, histograms)")
-	fmt.Println("")
+	if raw, _ := cmd.Flags().GetBool("raw"); raw {
+		_, _ = io.Copy(os.Stdout, resp.Body)
+		return
+	}
 
-	fmt.Println("🌐 Endpoints:")
-	fmt.Println("  • Prometheus: http://localhost:9090/metrics")
-	fmt.Println("  • Health: http://localhost:8081/health")
-	fmt.Println("")
+	metricsCfg := observability.DefaultMetricsConfig()
+	metricsCfg.Namespace = cfg.Metrics.Namespace
+	summary, err := observability.ParseMetricsSummary(resp.Body, metricsCfg)
+	if err != nil {
+		fmt.Printf("❌ Unexpected response from %s: %v\n", url, err)
+		os.Exit(1)
+	}
 
-	fmt.Println("💡 Usage:")
-	fmt.Println("  • Use 'dolphin observability metrics serve' to start server")
-	fmt.Println("  • Integrate MetricsCollector in your application")
-	fmt.Println("  • View metrics in Prometheus or Grafana")
-}
+	if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+		out, _ := json.MarshalIndent(summary, "", "  ")
+		fmt.Println(string(out))
+		return
+	}
 
-func metricsServe(cmd *cobra.Command, args []string) {
-	fmt.Println("🚀 Starting Metrics Server...")
+	fmt.Println("📊 Metrics Status")
+	fmt.Println("==================")
+	fmt.Printf("Endpoint: %s\n", url)
 	fmt.Println("")
 
-	// This would normally start the actual metrics server
-	// For now, show configuration
-	fmt.Println("📊 Metrics Server Configuration:")
-	fmt.Println("  Address: :9090")
-	fmt.Println("  Path: /metrics")
-	fmt.Println("  Format: Prometheus")
+	fmt.Println("🌐 HTTP:")
+	fmt.Printf("  Requests: %d (%d server errors)\n", summary.HTTPRequests, summary.HTTPServerErrors)
+	fmt.Printf("  In flight: %d\n", summary.HTTPActiveRequests)
+	fmt.Printf("  Average duration: %s\n", time.Duration(summary.HTTPDuration*float64(time.Second)).Round(time.Microsecond))
 	fmt.Println("")
 
-	fmt.Println("🔗 Access URLs:")
-	fmt.Println("  • Metrics: http://localhost:9090/metrics")
-	fmt.Println("  • Health: http://localhost:8081/health")
+	fmt.Println("🗄️  Database:")
+	fmt.Printf("  Queries: %d (%d errors)\n", summary.DatabaseQueries, summary.DatabaseErrors)
+	fmt.Printf("  Connections: %d in use, %d idle\n", summary.DatabaseConnectionsActive, summary.DatabaseConnectionsIdle)
 	fmt.Println("")
 
-	fmt.Println("📝 Integration Example:")
-	fmt.Println("  ```go")
-	fmt.Println("  metrics := observability.NewMetricsCollector(config, logger)")
-	fmt.Println("  r.Use(metrics.HTTPMetricsMiddleware)")
-	fmt.Println("  ```")
+	fmt.Println("⚡ Cache:")
+	fmt.Printf("  Hits: %d, misses: %d", summary.CacheHits, summary.CacheMisses)
+	if lookups := summary.CacheHits + summary.CacheMisses; lookups > 0 {
+		fmt.Printf(" (%.1f%% hit rate)", float64(summary.CacheHits)*100/float64(lookups))
+	}
+	fmt.Println("")
 	fmt.Println("")
 
-	fmt.Println("✅ Metrics server would be running (use Ctrl+C to stop)")
+	fmt.Println("🏃 Runtime:")
+	fmt.Printf("  Uptime: %s\n", time.Duration(summary.Uptime*float64(time.Second)).Round(time.Second))
+	fmt.Printf("  Goroutines: %d\n", summary.GoroutineCount)
+	fmt.Printf("  Memory: %.1f MB\n", float64(summary.MemoryUsage)/1024/1024)
 }
 
 func loggingTest(cmd *cobra.Command, args []string) {
@@ -2575,121 +4862,188 @@ func loggingTest(cmd *cobra.Command, args []string) {
 	fmt.Println("")
 
 	fmt.Println("💡 Usage:")
-	fmt.Println("  • Use 'dolphin observability logging level debug' to change level")
+	fmt.Println("  • Use 'dolphin observability logging level debug' to change the running app's level")
 	fmt.Println("  • Integrate LoggerManager in your application")
 	fmt.Println("  • View logs in structured format for better parsing")
 }
 
 func loggingLevel(cmd *cobra.Command, args []string) {
-	level := args[0]
-
-	fmt.Printf("🔧 Setting Log Level to: %s\n", level)
-	fmt.Println("")
+	url, _ := cmd.Flags().GetString("url")
+	if url == "" {
+		url = cfg.Server.URL()
+	}
+	url = strings.TrimSuffix(url, "/") + "/maintenance/log-level"
+	token, _ := cmd.Flags().GetString("token")
+	if token == "" {
+		token = cfg.Log.AdminToken
+	}
+	if token == "" {
+		fmt.Println("❌ No admin token; set log.admin_token (LOG_ADMIN_TOKEN) or pass --token")
+		os.Exit(1)
+	}
 
-	validLevels := []string{"debug", "info", "warn", "error", "fatal"}
-	valid := false
-	for _, validLevel := range validLevels {
-		if level == validLevel {
-			valid = true
-			break
+	// Without a level, show the current one
+	method, body := http.MethodGet, io.Reader(nil)
+	if len(args) == 1 {
+		if _, err := zapcore.ParseLevel(args[0]); err != nil || args[0] == "" {
+			fmt.Printf("❌ Invalid log level: %s\n", args[0])
+			fmt.Println("Valid levels: debug, info, warn, error, dpanic, panic, fatal")
+			os.Exit(1)
 		}
+		payload, _ := json.Marshal(map[string]string{"level": args[0]})
+		method, body = http.MethodPut, bytes.NewReader(payload)
 	}
 
-	if !valid {
-		fmt.Printf("❌ Invalid log level: %s\n", level)
-		fmt.Printf("Valid levels: %v\n", validLevels)
-		return
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
 	}
+	req.Header.Set("X-Admin-Token", token)
+	req.Header.Set("Content-Type", "application/json")
 
-	fmt.Printf("✅ Log level set to: %s\n", level)
-	fmt.Println("")
-
-	fmt.Println("📝 Log Level Descriptions:")
-	fmt.Println("  • debug: Detailed information for debugging")
-	fmt.Println("  • info:  General information about application flow")
-	fmt.Println("  • warn:  Warning messages for potential issues")
-	fmt.Println("  • error: Error messages for failed operations")
-	fmt.Println("  • fatal: Critical errors that cause application exit")
-	fmt.Println("")
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Printf("❌ Application is not responding: %v\n", err)
+		fmt.Println("💡 Start it with `dolphin serve`, or send it SIGHUP after editing log.level")
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		fmt.Printf("❌ %s returned HTTP %d: %s\n", url, resp.StatusCode, strings.TrimSpace(string(msg)))
+		os.Exit(1)
+	}
 
-	fmt.Println("💡 Note: Restart your application for the new log level to take effect")
+	var current struct {
+		Level string `json:"level"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&current); err != nil {
+		fmt.Printf("❌ Unexpected response from %s: %v\n", url, err)
+		os.Exit(1)
+	}
+	if method == http.MethodPut {
+		fmt.Printf("✅ Log level set to: %s\n", current.Level)
+	} else {
+		fmt.Printf("🔧 Log level: %s\n", current.Level)
+	}
+	fmt.Println("💡 The change lasts until restart; set log.level to keep it")
 }
 
 func tracingStatus(cmd *cobra.Command, args []string) {
+	tc := observability.TraceConfigFromConfig(cfg)
+
 	fmt.Println("🔍 Tracing Status")
 	fmt.Println("==================")
 	fmt.Println("")
 
+	enabled := "❌ disabled (set tracing.enabled to trace `dolphin serve`)"
+	if tc.Enabled {
+		enabled = "✅ enabled"
+	}
+	fmt.Printf("Tracing: %s\n", enabled)
+	fmt.Println("")
+
 	fmt.Println("🔧 Configuration:")
-	fmt.Println("  Service Name: dolphin-app")
-	fmt.Println("  Version: 1.0.0")
-	fmt.Println("  Environment: development")
-	fmt.Println("  Sampler: traceid_ratio")
-	fmt.Println("  Ratio: 1.0")
+	fmt.Printf("  Service Name: %s\n", tc.ServiceName)
+	fmt.Printf("  Version: %s\n", tc.Version)
+	fmt.Printf("  Environment: %s\n", tc.Environment)
+	fmt.Printf("  Sampler: %s (ratio %g)\n", tc.Sampler, tc.Ratio)
+	routes := make([]string, 0, len(tc.Routes))
+	for route := range tc.Routes {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	for _, route := range routes {
+		fmt.Printf("    %s: ratio %g\n", route, tc.Routes[route])
+	}
+	if _, err := observability.NewSampler(tc.Sampler, tc.Ratio, tc.Routes); err != nil {
+		fmt.Printf("  ❌ %v\n", err)
+	}
 	fmt.Println("")
 
 	fmt.Println("📡 Exporters:")
-	fmt.Println("  • Jaeger: http://localhost:14268/api/traces")
-	fmt.Println("  • Zipkin: http://localhost:9411/api/v2/spans")
+	exporters := []struct{ name, endpoint string }{
+		{"OTLP/" + tc.OTLPProtocol, tc.OTLPEndpoint},
+		{"Jaeger", tc.JaegerEndpoint},
+		{"Zipkin", tc.ZipkinEndpoint},
+	}
+	for _, e := range exporters {
+		if e.endpoint == "" {
+			continue
+		}
+		reachable := "✅ reachable"
+		if err := dialEndpoint(e.endpoint); err != nil {
+			reachable = fmt.Sprintf("❌ %v", err)
+		}
+		fmt.Printf("  • %s: %s (%s)\n", e.name, e.endpoint, reachable)
+	}
 	fmt.Println("")
 
-	fmt.Println("🏷️  Trace Headers:")
-	fmt.Println("  • Trace ID: X-Trace-Id")
-	fmt.Println("  • Span ID: X-Span-Id")
+	fmt.Println("📊 Traced Automatically:")
+	fmt.Println("  • HTTP requests (server spans named by route)")
+	fmt.Println("  • Database statements (client spans; use db.WithContext(r.Context()))")
+	fmt.Println("  • Outgoing requests through internal/http clients")
 	fmt.Println("")
 
-	fmt.Println("📊 Available Spans:")
-	fmt.Println("  • HTTP requests (server)")
-	fmt.Println("  • Database queries (client)")
-	fmt.Println("  • Cache operations (client)")
-	fmt.Println("  • Business events (internal)")
-	fmt.Println("")
+	fmt.Println("💡 Use 'dolphin observability tracing test' to send a test trace")
+}
 
-	fmt.Println("💡 Usage:")
-	fmt.Println("  • Use 'dolphin observability tracing test' to test")
-	fmt.Println("  • Integrate TracerManager in your application")
-	fmt.Println("  • View traces in Jaeger UI: http://localhost:16686")
+// dialEndpoint checks that an exporter endpoint, host:port or a URL,
+// accepts connections
+func dialEndpoint(endpoint string) error {
+	address := endpoint
+	if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+		port := u.Port()
+		if port == "" {
+			port = "80"
+			if u.Scheme == "https" {
+				port = "443"
+			}
+		}
+		address = net.JoinHostPort(u.Hostname(), port)
+	}
+	conn, err := net.DialTimeout("tcp", address, 3*time.Second)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
 }
 
 func tracingTest(cmd *cobra.Command, args []string) {
-	fmt.Println("🧪 Testing Tracing Configuration...")
-	fmt.Println("")
+	tc := observability.TraceConfigFromConfig(cfg)
+	tc.Enabled = true
+	tc.Sampler = "always_on"
 
-	// This would normally test the actual tracing configuration
-	fmt.Println("🔍 Sample Trace:")
+	fmt.Println("🧪 Testing Tracing Configuration...")
 	fmt.Println("")
 
-	fmt.Println("Trace ID: 1234567890abcdef")
-	fmt.Println("Span ID:  fedcba0987654321")
-	fmt.Println("")
+	tracer, err := observability.NewTracerManager(tc, nil)
+	if err != nil {
+		fmt.Printf("❌ Invalid tracing config: %v\n", err)
+		os.Exit(1)
+	}
 
-	fmt.Println("📊 Trace Structure:")
-	fmt.Println("  └── HTTP GET /api/users (server)")
-	fmt.Println("      ├── Database SELECT users (client)")
-	fmt.Println("      ├── Cache GET user:123 (client)")
-	fmt.Println("      └── Business Event user_viewed (internal)")
-	fmt.Println("")
+	ctx, root := tracer.StartSpan(context.Background(), "dolphin tracing test")
+	_, child := tracer.StartSpan(ctx, "dolphin tracing test child")
+	child.End()
+	root.End()
 
-	fmt.Println("🏷️  Span Attributes:")
-	fmt.Println("  • http.method: GET")
-	fmt.Println("  • http.url: /api/users")
-	fmt.Println("  • db.operation: SELECT")
-	fmt.Println("  • db.table: users")
-	fmt.Println("  • cache.operation: GET")
-	fmt.Println("  • cache.key: user:123")
+	fmt.Printf("Trace ID: %s\n", tracer.GetTraceID(ctx))
+	fmt.Printf("Span ID:  %s\n", tracer.GetSpanID(ctx))
 	fmt.Println("")
 
-	fmt.Println("⏱️  Timing Information:")
-	fmt.Println("  • Total Duration: 45ms")
-	fmt.Println("  • Database Query: 12ms")
-	fmt.Println("  • Cache Lookup: 2ms")
-	fmt.Println("  • Business Logic: 31ms")
-	fmt.Println("")
+	flushCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := tracer.ForceFlush(flushCtx); err != nil {
+		fmt.Printf("❌ Export failed: %v\n", err)
+		os.Exit(1)
+	}
+	_ = tracer.Shutdown(flushCtx)
 
-	fmt.Println("💡 Integration:")
-	fmt.Println("  • Use TracingMiddleware for HTTP requests")
-	fmt.Println("  • Use DatabaseTracingMiddleware for DB operations")
-	fmt.Println("  • Use CacheTracingMiddleware for cache operations")
+	fmt.Println("✅ Test trace exported")
+	fmt.Printf("💡 Look up the trace ID above in your tracing backend (service %q)\n", tc.ServiceName)
 }
 
 func healthServe(cmd *cobra.Command, args []string) {
@@ -3369,304 +5723,303 @@ func loadShedMetrics(cmd *cobra.Command, args []string) {
 }
 
 // --- Live Reload command handlers ---
-func liveReloadStart(cmd *cobra.Command, args []string) {
-	fmt.Println("🔄 Starting Live Reload Development Server")
-	fmt.Println("==========================================")
-	fmt.Println("")
 
-	fmt.Println("🔧 Configuration:")
-	fmt.Println("  Strategy: Restart")
-	fmt.Println("  Watch Paths: ., cmd, internal, app, ui, public")
-	fmt.Println("  Ignore Paths: .git, node_modules, vendor, *.log")
-	fmt.Println("  File Extensions: .go, .html, .css, .js, .json, .yaml")
-	fmt.Println("  Build Command: go build -o bin/app cmd/dolphin/main.go")
-	fmt.Println("  Run Command: ./bin/app serve")
-	fmt.Println("  Debounce Delay: 500ms")
-	fmt.Println("  Hot Reload Port: 35729")
-	fmt.Println("")
+// liveReloadConfigFrom loads config/livereload.yaml (or --config) and applies
+// the command line overrides
+func liveReloadConfigFrom(cmd *cobra.Command) (*livereload.Config, error) {
+	path, _ := cmd.Flags().GetString("config")
+	lrConfig, err := livereload.LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
 
-	fmt.Println("📊 Status:")
-	fmt.Println("  Live Reload: Starting...")
-	fmt.Println("  File Watcher: Initializing...")
-	fmt.Println("  Hot Reload Server: Starting...")
-	fmt.Println("  Main Process: Building...")
-	fmt.Println("")
+	flags := cmd.Flags()
+	if flags.Changed("build") {
+		lrConfig.BuildCommand, _ = flags.GetString("build")
+	}
+	if flags.Changed("run") {
+		lrConfig.RunCommand, _ = flags.GetString("run")
+	}
+	if flags.Changed("strategy") {
+		strategy, _ := flags.GetString("strategy")
+		if err := lrConfig.Strategy.UnmarshalText([]byte(strategy)); err != nil {
+			return nil, err
+		}
+	}
+	if flags.Changed("port") {
+		lrConfig.HotReloadPort, _ = flags.GetInt("port")
+	}
+	if noHotReload, _ := flags.GetBool("no-hot-reload"); noHotReload {
+		lrConfig.EnableHotReload = false
+	}
+	return lrConfig, nil
+}
 
-	fmt.Println("🌐 Endpoints:")
-	fmt.Println("  • Main Application: http://localhost:8080")
-	fmt.Println("  • Hot Reload Server: http://localhost:35729")
-	fmt.Println("  • Health Check: http://localhost:35729/health")
-	fmt.Println("  • Live Reload Script: http://localhost:35729/livereload.js")
-	fmt.Println("")
+func liveReloadStart(cmd *cobra.Command, args []string) {
+	lrConfig, err := liveReloadConfigFrom(cmd)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	if state, err := livereload.ReadState(lrConfig.StateFile); err == nil && state.Alive() {
+		fmt.Printf("❌ Live reload is already running (PID %d); use 'dolphin dev stop' first\n", state.PID)
+		os.Exit(1)
+	}
 
-	fmt.Println("💡 Usage:")
-	fmt.Println("  • Edit any .go, .html, .css, .js file to trigger reload")
-	fmt.Println("  • Use 'dolphin dev status' to view current status")
-	fmt.Println("  • Use 'dolphin dev stop' to stop the development server")
-	fmt.Println("  • Use 'dolphin dev stats' to view statistics")
-	fmt.Println("")
+	logger := logger.New(cfg.Log.Level, cfg.Log.Format)
+	manager, err := livereload.NewLiveReloadManager(lrConfig, logger)
+	if err != nil {
+		logger.Fatal("Failed to create live reload manager", zap.Error(err))
+	}
+	if err := manager.Start(); err != nil {
+		logger.Fatal("Failed to start live reload", zap.Error(err))
+	}
 
-	fmt.Println("✅ Live reload development server started successfully!")
-	fmt.Println("")
-	fmt.Println("🎯 Next Steps:")
-	fmt.Println("  1. Open your browser to http://localhost:8080")
-	fmt.Println("  2. Edit any file in the watched directories")
-	fmt.Println("  3. Watch the application automatically reload")
-	fmt.Println("  4. Check the console for reload notifications")
+	fmt.Println("🔄 Live reload started")
+	fmt.Printf("  Strategy: %s\n", lrConfig.Strategy)
+	fmt.Printf("  Build: %s\n", lrConfig.BuildCommand)
+	fmt.Printf("  Run: %s\n", lrConfig.RunCommand)
+	fmt.Printf("  Watching: %d directories\n", len(manager.GetWatchedPaths()))
+	if state := manager.State(); state.HotReload {
+		fmt.Printf("  Hot reload: ws://localhost:%d/livereload (script injected into HTML pages)\n", state.Port)
+	}
+	fmt.Println("  Press Ctrl+C or run 'dolphin dev stop' to stop")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+
+	fmt.Println("\n🛑 Stopping live reload...")
+	manager.Stop()
 }
 
 func liveReloadStop(cmd *cobra.Command, args []string) {
-	fmt.Println("🛑 Stopping Live Reload Development Server")
-	fmt.Println("==========================================")
-	fmt.Println("")
+	stateFile, _ := cmd.Flags().GetString("state")
+	state, err := livereload.ReadState(stateFile)
+	if err != nil || !state.Alive() {
+		fmt.Println("ℹ️  Live reload is not running")
+		return
+	}
 
-	fmt.Println("📊 Stop Actions:")
-	fmt.Println("  • File Watcher: Stopping...")
-	fmt.Println("  • Hot Reload Server: Stopping...")
-	fmt.Println("  • Main Process: Stopping...")
-	fmt.Println("  • WebSocket Connections: Closing...")
-	fmt.Println("")
+	process, err := os.FindProcess(state.PID)
+	if err == nil {
+		err = process.Signal(syscall.SIGTERM)
+	}
+	if err != nil {
+		fmt.Printf("❌ Failed to stop live reload (PID %d): %v\n", state.PID, err)
+		os.Exit(1)
+	}
 
-	fmt.Println("⏱️  Graceful Shutdown:")
-	fmt.Println("  • Sending interrupt signal to process")
-	fmt.Println("  • Waiting for process to exit (5s timeout)")
-	fmt.Println("  • Closing all file watchers")
-	fmt.Println("  • Stopping hot reload server")
-	fmt.Println("")
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if state, err := livereload.ReadState(stateFile); err != nil || !state.Alive() {
+			fmt.Println("✅ Live reload stopped")
+			return
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	fmt.Printf("⚠️  Live reload (PID %d) has not stopped after 10s\n", state.PID)
+	os.Exit(1)
+}
 
-	fmt.Println("✅ Live reload development server stopped successfully!")
-	fmt.Println("")
-	fmt.Println("💡 Note: All processes have been terminated and resources cleaned up")
+// readLiveReloadState reads the state file for status and stats, exiting
+// when no supervisor has run here
+func readLiveReloadState(cmd *cobra.Command) *livereload.State {
+	stateFile, _ := cmd.Flags().GetString("state")
+	state, err := livereload.ReadState(stateFile)
+	if os.IsNotExist(err) {
+		fmt.Println("ℹ️  Live reload has not run here; start it with 'dolphin dev start'")
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Printf("❌ Failed to read %s: %v\n", stateFile, err)
+		os.Exit(1)
+	}
+	return state
 }
 
 func liveReloadStatus(cmd *cobra.Command, args []string) {
+	state := readLiveReloadState(cmd)
+	status := state.Status
+	if !state.Alive() {
+		status = livereload.StatusStopped
+	}
+
 	fmt.Println("📊 Live Reload Status")
 	fmt.Println("====================")
-	fmt.Println("")
-
-	fmt.Println("🔄 Live Reload:")
-	fmt.Println("  Status: Running")
-	fmt.Println("  Strategy: Restart")
-	fmt.Println("  Hot Reload: Enabled")
-	fmt.Println("  Port: 35729")
-	fmt.Println("")
-
-	fmt.Println("👀 File Watching:")
-	fmt.Println("  Watched Paths: 5")
-	fmt.Println("  Ignored Paths: 6")
-	fmt.Println("  File Extensions: 7")
-	fmt.Println("  Active Watchers: 12")
-	fmt.Println("")
-
-	fmt.Println("🌐 Connections:")
-	fmt.Println("  WebSocket Connections: 0")
-	fmt.Println("  Hot Reload Server: Running")
-	fmt.Println("  Main Process: Running (PID: 12345)")
-	fmt.Println("")
-
-	fmt.Println("📈 Statistics:")
-	fmt.Println("  File Changes: 23")
-	fmt.Println("  Reloads: 8")
-	fmt.Println("  Process Starts: 8")
-	fmt.Println("  Process Stops: 7")
-	fmt.Println("  Hot Reloads: 0")
-	fmt.Println("  Uptime: 2m 34s")
-	fmt.Println("")
-
-	fmt.Println("💡 Usage:")
-	fmt.Println("  • Use 'dolphin dev config' to view configuration")
-	fmt.Println("  • Use 'dolphin dev stats' to view detailed statistics")
-	fmt.Println("  • Use 'dolphin dev test' to test live reload functionality")
+	fmt.Printf("  Status: %s\n", status)
+	fmt.Printf("  Strategy: %s\n", state.Strategy)
+	fmt.Printf("  Uptime: %s\n", state.Uptime().Round(time.Second))
+	fmt.Printf("  Updated: %s ago\n", time.Since(state.UpdatedAt).Round(time.Second))
+	fmt.Printf("  Watched Directories: %d\n", state.WatchedDirs)
+	if state.Alive() {
+		fmt.Printf("  Supervisor PID: %d\n", state.PID)
+		if state.AppPID > 0 {
+			fmt.Printf("  App PID: %d\n", state.AppPID)
+		}
+	}
+	if state.HotReload {
+		fmt.Printf("  Hot Reload: port %d, %d browser(s) connected\n", state.Port, state.Connections)
+	} else {
+		fmt.Println("  Hot Reload: disabled")
+	}
+	fmt.Printf("  File Changes: %d, Reloads: %d, Crashes: %d, Build Failures: %d\n",
+		state.Stats.FileChanges, state.Stats.Reloads, state.Stats.Crashes, state.Stats.BuildFailures)
+	if status == livereload.StatusBuildFailed && state.Stats.LastBuildError != "" {
+		fmt.Println("")
+		fmt.Println("❌ Last build error:")
+		fmt.Println(state.Stats.LastBuildError)
+	}
 }
 
 func liveReloadConfig(cmd *cobra.Command, args []string) {
+	lrConfig, err := liveReloadConfigFrom(cmd)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+
 	fmt.Println("⚙️  Live Reload Configuration")
 	fmt.Println("============================")
-	fmt.Println("")
-
-	fmt.Println("📁 Watch Configuration:")
-	fmt.Println("  Watch Paths:")
-	fmt.Println("    • .")
-	fmt.Println("    • cmd")
-	fmt.Println("    • internal")
-	fmt.Println("    • app")
-	fmt.Println("    • ui")
-	fmt.Println("    • public")
-	fmt.Println("")
-	fmt.Println("  Ignore Paths:")
-	fmt.Println("    • .git")
-	fmt.Println("    • node_modules")
-	fmt.Println("    • vendor")
-	fmt.Println("    • *.log")
-	fmt.Println("    • *.tmp")
-	fmt.Println("    • .env")
-	fmt.Println("")
-	fmt.Println("  File Extensions:")
-	fmt.Println("    • .go")
-	fmt.Println("    • .html")
-	fmt.Println("    • .css")
-	fmt.Println("    • .js")
-	fmt.Println("    • .json")
-	fmt.Println("    • .yaml")
-	fmt.Println("    • .yml")
-	fmt.Println("")
-
-	fmt.Println("🔄 Reload Configuration:")
-	fmt.Println("  Strategy: restart")
-	fmt.Println("  Build Command: go build -o bin/app cmd/dolphin/main.go")
-	fmt.Println("  Run Command: ./bin/app serve")
-	fmt.Println("  Build Timeout: 30s")
-	fmt.Println("  Restart Delay: 1s")
-	fmt.Println("")
-
-	fmt.Println("⚡ Hot Reload Configuration:")
-	fmt.Println("  Enabled: true")
-	fmt.Println("  Port: 35729")
-	fmt.Println("  Paths: /")
-	fmt.Println("")
-
-	fmt.Println("⏱️  Timing Configuration:")
-	fmt.Println("  Debounce Delay: 500ms")
-	fmt.Println("  Max Debounce: 5s")
-	fmt.Println("")
-
-	fmt.Println("📝 Logging Configuration:")
-	fmt.Println("  Enable Logging: true")
-	fmt.Println("  Verbose Logging: false")
+	fmt.Printf("  Watch Paths: %s\n", strings.Join(lrConfig.WatchPaths, ", "))
+	fmt.Printf("  Ignore Paths: %s\n", strings.Join(lrConfig.IgnorePaths, ", "))
+	fmt.Printf("  File Extensions: %s\n", strings.Join(lrConfig.FileExtensions, ", "))
+	fmt.Printf("  Strategy: %s\n", lrConfig.Strategy)
+	fmt.Printf("  Build Command: %s\n", lrConfig.BuildCommand)
+	fmt.Printf("  Run Command: %s\n", lrConfig.RunCommand)
+	fmt.Printf("  Build Timeout: %s\n", lrConfig.BuildTimeout)
+	fmt.Printf("  Restart Delay: %s (backoff up to %s)\n", lrConfig.RestartDelay, lrConfig.MaxBackoff)
+	fmt.Printf("  Debounce: %s (at most %s)\n", lrConfig.DebounceDelay, lrConfig.MaxDebounce)
+	if lrConfig.EnableHotReload {
+		fmt.Printf("  Hot Reload: port %d, paths %s\n", lrConfig.HotReloadPort, strings.Join(lrConfig.HotReloadPaths, ", "))
+	} else {
+		fmt.Println("  Hot Reload: disabled")
+	}
+	fmt.Printf("  State File: %s\n", lrConfig.StateFile)
 }
 
 func liveReloadStats(cmd *cobra.Command, args []string) {
+	state := readLiveReloadState(cmd)
+	stats := state.Stats
+	since := func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return time.Since(t).Round(time.Second).String() + " ago"
+	}
+
 	fmt.Println("📊 Live Reload Statistics")
 	fmt.Println("========================")
 	fmt.Println("")
-
 	fmt.Println("📈 File Changes:")
-	fmt.Println("  Total File Changes: 23")
-	fmt.Println("  File Change Rate: 0.9/min")
-	fmt.Println("  Most Changed Files:")
-	fmt.Println("    • internal/router/web.go (8 changes)")
-	fmt.Println("    • ui/views/pages/home.html (5 changes)")
-	fmt.Println("    • cmd/dolphin/main.go (4 changes)")
-	fmt.Println("    • internal/app/generator.go (3 changes)")
-	fmt.Println("    • public/static/app.css (3 changes)")
-	fmt.Println("")
-
-	fmt.Println("🔄 Reload Statistics:")
-	fmt.Println("  Total Reloads: 8")
-	fmt.Println("  Reload Rate: 0.3/min")
-	fmt.Println("  Last Reload: 2 minutes ago")
-	fmt.Println("  Average Reload Time: 1.2s")
-	fmt.Println("")
-
-	fmt.Println("⚡ Hot Reload Statistics:")
-	fmt.Println("  Hot Reloads: 0")
-	fmt.Println("  Last Hot Reload: Never")
-	fmt.Println("  WebSocket Connections: 0")
+	fmt.Printf("  Total: %d (%.1f/min)\n", stats.FileChanges, stats.FileChangesPerMin)
+	for _, file := range stats.MostChangedFiles {
+		fmt.Printf("    • %s (%d changes)\n", file.Filename, file.Count)
+	}
+	for op, count := range stats.ChangeTypes {
+		fmt.Printf("  %s: %d\n", op, count)
+	}
 	fmt.Println("")
-
-	fmt.Println("🔄 Process Statistics:")
-	fmt.Println("  Process Starts: 8")
-	fmt.Println("  Process Stops: 7")
-	fmt.Println("  Last Start: 2 minutes ago")
-	fmt.Println("  Last Stop: 2 minutes ago")
+	fmt.Println("🔄 Reloads:")
+	fmt.Printf("  Total: %d (%.1f/min)\n", stats.Reloads, stats.ReloadsPerMin)
+	fmt.Printf("  Last Reload: %s\n", since(stats.LastReload))
+	fmt.Printf("  Average Reload Time: %s\n", stats.AverageReloadTime.Round(time.Millisecond))
+	fmt.Printf("  Build Failures: %d\n", stats.BuildFailures)
 	fmt.Println("")
-
-	fmt.Println("📊 Change Types:")
-	fmt.Println("  WRITE: 18")
-	fmt.Println("  CREATE: 3")
-	fmt.Println("  REMOVE: 1")
-	fmt.Println("  RENAME: 1")
+	fmt.Println("⚙️  Process:")
+	fmt.Printf("  Starts: %d, Stops: %d, Crashes: %d\n", stats.ProcessStarts, stats.ProcessStops, stats.Crashes)
+	fmt.Printf("  Last Start: %s\n", since(stats.LastStart))
+	fmt.Printf("  Last Crash: %s\n", since(stats.LastCrash))
 	fmt.Println("")
-
-	fmt.Println("⏱️  Timing:")
-	fmt.Println("  Start Time: 2 minutes ago")
-	fmt.Println("  Uptime: 2m 34s")
-	fmt.Println("  File Change Rate: 0.9/min")
-	fmt.Println("  Reload Rate: 0.3/min")
+	fmt.Println("⚡ Hot Reload:")
+	fmt.Printf("  Browser Refreshes: %d\n", stats.HotReloads)
+	fmt.Printf("  Last Refresh: %s\n", since(stats.LastHotReload))
+	fmt.Printf("  Connections: %d\n", state.Connections)
 }
 
 func liveReloadTest(cmd *cobra.Command, args []string) {
-	fmt.Println("🧪 Testing Live Reload Functionality")
-	fmt.Println("====================================")
-	fmt.Println("")
+	state := readLiveReloadState(cmd)
+	ok := true
+	check := func(name string, err error) {
+		if err != nil {
+			ok = false
+			fmt.Printf("  • %s: ❌ %v\n", name, err)
+			return
+		}
+		fmt.Printf("  • %s: ✅\n", name)
+	}
 
-	fmt.Println("📋 Test Scenarios:")
-	fmt.Println("  1. File Change Detection")
-	fmt.Println("  2. Debouncing")
-	fmt.Println("  3. Process Restart")
-	fmt.Println("  4. Hot Reload Notification")
-	fmt.Println("  5. Error Handling")
-	fmt.Println("")
+	fmt.Println("🧪 Testing Live Reload")
+	fmt.Println("=====================")
+	var err error
+	if !state.Alive() {
+		err = fmt.Errorf("not running")
+	}
+	check("Supervisor", err)
 
-	fmt.Println("⏱️  Test Timeline:")
-	fmt.Println("  T+0s:  Starting test...")
-	fmt.Println("  T+1s:  Simulating file change...")
-	fmt.Println("  T+2s:  Debouncing delay (500ms)...")
-	fmt.Println("  T+3s:  Triggering reload...")
-	fmt.Println("  T+4s:  Building application...")
-	fmt.Println("  T+5s:  Restarting process...")
-	fmt.Println("  T+6s:  Sending hot reload notification...")
-	fmt.Println("  T+7s:  Test completed")
-	fmt.Println("")
+	err = nil
+	if state.Alive() && state.AppPID == 0 {
+		err = fmt.Errorf("app is not running (status %s)", state.Status)
+	}
+	check("App process", err)
 
-	fmt.Println("📊 Test Results:")
-	fmt.Println("  • File Change Detection: ✅ PASS")
-	fmt.Println("  • Debouncing: ✅ PASS")
-	fmt.Println("  • Process Restart: ✅ PASS")
-	fmt.Println("  • Hot Reload Notification: ✅ PASS")
-	fmt.Println("  • Error Handling: ✅ PASS")
-	fmt.Println("")
+	if state.HotReload && state.Alive() {
+		client := &http.Client{Timeout: 2 * time.Second}
+		resp, err := client.Get(fmt.Sprintf("http://localhost:%d/health", state.Port))
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				err = fmt.Errorf("health check returned %d", resp.StatusCode)
+			}
+		}
+		check("Hot reload server", err)
+	}
 
-	fmt.Println("✅ Live reload test completed successfully!")
-	fmt.Println("")
-	fmt.Println("💡 Note: All live reload functionality is working correctly")
+	if !ok {
+		os.Exit(1)
+	}
 }
 
 // --- Asset Pipeline command handlers ---
 func assetBuild(cmd *cobra.Command, args []string) {
-	fmt.Println("🔨 Building Assets")
-	fmt.Println("==================")
-	fmt.Println("")
-
-	fmt.Println("📁 Configuration:")
-	fmt.Println("  Source Directory: resources/assets")
-	fmt.Println("  Output Directory: public/assets")
-	fmt.Println("  Public Directory: public")
-	fmt.Println("  Enable Bundling: true")
-	fmt.Println("  Enable Versioning: true")
-	fmt.Println("  Enable Optimization: true")
-	fmt.Println("")
+	force, _ := cmd.Flags().GetBool("force")
+	configPath, _ := cmd.Flags().GetString("config")
 
-	fmt.Println("🔄 Processing:")
-	fmt.Println("  • Scanning source directory...")
-	fmt.Println("  • Processing CSS files...")
-	fmt.Println("  • Processing JavaScript files...")
-	fmt.Println("  • Processing images...")
-	fmt.Println("  • Processing fonts...")
-	fmt.Println("  • Creating bundles...")
-	fmt.Println("  • Generating versions...")
-	fmt.Println("  • Optimizing assets...")
-	fmt.Println("")
+	logger := logger.New(cfg.Log.Level, cfg.Log.Format)
+	assetConfig, err := assets.LoadConfig(configPath)
+	if err != nil {
+		logger.Fatal("Invalid asset pipeline config", zap.Error(err))
+	}
+	// A build runs once; watching is for `dolphin asset watch`
+	assetConfig.EnableWatch = false
+	manager, err := assets.NewAssetManager(assetConfig, nil)
+	if err != nil {
+		logger.Fatal("Failed to start the asset pipeline", zap.Error(err))
+	}
+	defer manager.Stop()
 
-	fmt.Println("📊 Results:")
-	fmt.Println("  • Total Assets: 45")
-	fmt.Println("  • CSS Files: 12")
-	fmt.Println("  • JavaScript Files: 18")
-	fmt.Println("  • Image Files: 10")
-	fmt.Println("  • Font Files: 5")
-	fmt.Println("  • Bundles Created: 4")
-	fmt.Println("  • Total Size: 2.3 MB")
-	fmt.Println("  • Optimized Size: 1.8 MB")
-	fmt.Println("  • Compression: 22%")
-	fmt.Println("")
+	spinner := progressUI(cmd).Spinner("🔨 Building assets from " + assetConfig.SourceDir)
+	result, err := manager.Build(assets.BuildOptions{Force: force})
+	if err != nil {
+		spinner.Fail()
+		logger.Fatal("Failed to build assets", zap.Error(err))
+	}
+	spinner.Done()
 
-	fmt.Println("✅ Assets built successfully!")
-	fmt.Println("")
-	fmt.Println("💡 Usage:")
-	fmt.Println("  • Use 'dolphin asset watch' to watch for changes")
-	fmt.Println("  • Use 'dolphin asset list' to list all assets")
-	fmt.Println("  • Use 'dolphin asset stats' to view statistics")
-	fmt.Println("  • Use 'dolphin asset clean' to clean built assets")
+	if result.Invalidated {
+		fmt.Println("♻️  Build cache dropped (--force or changed configuration)")
+	}
+	for _, path := range result.Built {
+		fmt.Printf("  • built %s\n", path)
+	}
+	for _, name := range result.Bundles {
+		fmt.Printf("  • bundled %s\n", name)
+	}
+	for _, path := range result.Removed {
+		fmt.Printf("  • removed %s\n", path)
+	}
+	fmt.Printf("✅ %d built, %d unchanged; %d bundles built, %d unchanged → %s\n",
+		len(result.Built), result.Skipped, len(result.Bundles), result.BundlesSkipped, assetConfig.OutputDir)
 }
 
 func assetWatch(cmd *cobra.Command, args []string) {
@@ -3907,144 +6260,147 @@ func assetVersion(cmd *cobra.Command, args []string) {
 
 // --- Template Engine command handlers ---
 func templateList(cmd *cobra.Command, args []string) {
+	engine := loadTemplateEngine(false)
+	stats := engine.Stats()
+	errs := engine.Errors()
+	errsByPath := make(map[string]*views.CompileError)
+	for _, err := range errs {
+		if _, ok := errsByPath[err.Path]; !ok {
+			errsByPath[err.Path] = err
+		}
+	}
+
 	fmt.Println("📋 Template List")
 	fmt.Println("================")
-	fmt.Println("")
-
-	fmt.Println("🏗️  Layouts:")
-	fmt.Println("  • base.html (2.1 KB) - Main layout")
-	fmt.Println("  • admin.html (1.8 KB) - Admin layout")
-	fmt.Println("  • auth.html (1.5 KB) - Authentication layout")
-	fmt.Println("  • email.html (1.2 KB) - Email layout")
-	fmt.Println("")
-
-	fmt.Println("🧩 Partials:")
-	fmt.Println("  • header.html (0.8 KB) - Page header")
-	fmt.Println("  • footer.html (0.6 KB) - Page footer")
-	fmt.Println("  • navigation.html (1.2 KB) - Navigation menu")
-	fmt.Println("  • sidebar.html (0.9 KB) - Sidebar")
-	fmt.Println("  • breadcrumbs.html (0.4 KB) - Breadcrumbs")
-	fmt.Println("")
+	for _, templateType := range templateTypes {
+		ts, ok := stats.Types[templateType]
+		if !ok {
+			continue
+		}
+		templates := engine.GetTemplatesByType(templateType)
+		fmt.Printf("\n%s %s (%s):\n", templateTypeIcons[templateType], templateTypeTitles[templateType], ts.Dir)
+		if len(templates) == 0 {
+			fmt.Println("  (none)")
+		}
+		names := make([]string, 0, len(templates))
+		for name := range templates {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			tmpl := templates[name]
+			line := fmt.Sprintf("  • %s (%s)", tmpl.Name, formatTemplateSize(tmpl.Size))
+			if tmpl.Extends != "" {
+				line += " extends " + tmpl.Extends
+			}
+			if err, ok := errsByPath[tmpl.Path]; ok {
+				line += " ❌ " + err.Message
+			}
+			fmt.Println(line)
+		}
+		for _, err := range errs {
+			if _, loaded := templates[err.Name]; !loaded && strings.HasPrefix(err.Path, ts.Dir) {
+				fmt.Printf("  • %s ❌ not compiled: %s\n", err.Name, err.Message)
+			}
+		}
+	}
 
-	fmt.Println("📄 Pages:")
-	fmt.Println("  • home.html (1.5 KB) - Home page")
-	fmt.Println("  • about.html (1.2 KB) - About page")
-	fmt.Println("  • contact.html (1.8 KB) - Contact page")
-	fmt.Println("  • dashboard.html (2.3 KB) - Dashboard page")
-	fmt.Println("  • profile.html (1.6 KB) - Profile page")
-	fmt.Println("")
+	fmt.Println("\n📊 Summary:")
+	fmt.Printf("  • Total Templates: %d (%s)\n", stats.Total, formatTemplateSize(stats.Size))
+	fmt.Printf("  • Errors: %d\n", stats.Errors)
+	if stats.Errors > 0 {
+		fmt.Println("\n💡 Run 'dolphin template compile' for error locations")
+	}
+}
 
-	fmt.Println("🧩 Components:")
-	fmt.Println("  • button.html (0.3 KB) - Button component")
-	fmt.Println("  • card.html (0.7 KB) - Card component")
-	fmt.Println("  • modal.html (1.1 KB) - Modal component")
-	fmt.Println("  • form.html (1.4 KB) - Form component")
-	fmt.Println("  • table.html (1.8 KB) - Table component")
-	fmt.Println("")
+func templateCompile(cmd *cobra.Command, args []string) {
+	engine := loadTemplateEngine(false)
+	stats := engine.Stats()
 
-	fmt.Println("📧 Emails:")
-	fmt.Println("  • welcome.html (1.2 KB) - Welcome email")
-	fmt.Println("  • reset.html (0.9 KB) - Password reset email")
-	fmt.Println("  • notification.html (1.1 KB) - Notification email")
-	fmt.Println("  • invoice.html (1.5 KB) - Invoice email")
+	fmt.Println("🔨 Compiling Templates")
+	fmt.Println("======================")
 	fmt.Println("")
-
-	fmt.Println("📊 Summary:")
-	fmt.Println("  • Total Templates: 25")
-	fmt.Println("  • Layouts: 4")
-	fmt.Println("  • Partials: 5")
-	fmt.Println("  • Pages: 5")
-	fmt.Println("  • Components: 5")
-	fmt.Println("  • Emails: 4")
-	fmt.Println("  • Total Size: 25.2 KB")
+	for _, templateType := range templateTypes {
+		if ts, ok := stats.Types[templateType]; ok {
+			fmt.Printf("  • %s: %d from %s\n", templateTypeTitles[templateType], ts.Count, ts.Dir)
+		}
+	}
+	fmt.Printf("  • Helper Functions: %d\n", stats.Helpers)
+	fmt.Printf("  • Compilation Time: %s\n", stats.LoadTime.Round(time.Microsecond))
 	fmt.Println("")
 
-	fmt.Println("💡 Usage:")
-	fmt.Println("  • Use 'dolphin template compile' to compile all templates")
-	fmt.Println("  • Use 'dolphin template watch' to watch for changes")
-	fmt.Println("  • Use 'dolphin template helpers' to list available helpers")
+	errs := engine.Errors()
+	if len(errs) == 0 {
+		fmt.Printf("✅ All %d templates compiled successfully!\n", stats.Total)
+		return
+	}
+	fmt.Printf("❌ %d template error(s):\n", len(errs))
+	for _, err := range errs {
+		fmt.Printf("  %s\n", err)
+	}
+	os.Exit(1)
 }
 
-func templateCompile(cmd *cobra.Command, args []string) {
-	fmt.Println("🔨 Compiling Templates")
-	fmt.Println("======================")
-	fmt.Println("")
+func templateLint(cmd *cobra.Command, args []string) {
+	engine := loadTemplateEngine(false)
+	stats := engine.Stats()
 
-	fmt.Println("📁 Template Directories:")
-	fmt.Println("  • Layouts: ui/views/layouts")
-	fmt.Println("  • Partials: ui/views/partials")
-	fmt.Println("  • Pages: ui/views/pages")
-	fmt.Println("  • Components: ui/views/components")
-	fmt.Println("  • Emails: ui/views/emails")
-	fmt.Println("")
-
-	fmt.Println("🔄 Compilation Process:")
-	fmt.Println("  • Scanning template directories...")
-	fmt.Println("  • Loading template files...")
-	fmt.Println("  • Parsing template syntax...")
-	fmt.Println("  • Registering helper functions...")
-	fmt.Println("  • Compiling templates...")
-	fmt.Println("  • Validating template references...")
-	fmt.Println("  • Checking for syntax errors...")
-	fmt.Println("")
-
-	fmt.Println("✅ Compilation Results:")
-	fmt.Println("  • Templates Loaded: 25")
-	fmt.Println("  • Layouts Compiled: 4")
-	fmt.Println("  • Partials Compiled: 5")
-	fmt.Println("  • Pages Compiled: 5")
-	fmt.Println("  • Components Compiled: 5")
-	fmt.Println("  • Emails Compiled: 4")
-	fmt.Println("  • Helper Functions: 45")
-	fmt.Println("  • Compilation Time: 0.8s")
-	fmt.Println("  • Errors: 0")
-	fmt.Println("  • Warnings: 0")
+	fmt.Println("♿ Linting Templates")
+	fmt.Println("===================")
 	fmt.Println("")
 
-	fmt.Println("✅ All templates compiled successfully!")
-	fmt.Println("")
-	fmt.Println("💡 Usage:")
-	fmt.Println("  • Use 'dolphin template watch' to watch for changes")
-	fmt.Println("  • Use 'dolphin template test' to test template rendering")
-	fmt.Println("  • Use 'dolphin template stats' to view statistics")
+	issues := engine.Lint()
+	if len(issues) == 0 {
+		fmt.Printf("✅ No accessibility problems in %d templates\n", stats.Total)
+		return
+	}
+	fmt.Printf("❌ %d accessibility problem(s):\n", len(issues))
+	for _, issue := range issues {
+		fmt.Printf("  %s\n", issue)
+	}
+	os.Exit(1)
 }
 
 func templateWatch(cmd *cobra.Command, args []string) {
+	engine := loadTemplateEngine(true)
+	defer engine.Stop()
+
+	stats := engine.Stats()
 	fmt.Println("👀 Watching Templates")
 	fmt.Println("====================")
-	fmt.Println("")
-
-	fmt.Println("📁 Watch Configuration:")
-	fmt.Println("  • Layouts Directory: ui/views/layouts")
-	fmt.Println("  • Partials Directory: ui/views/partials")
-	fmt.Println("  • Pages Directory: ui/views/pages")
-	fmt.Println("  • Components Directory: ui/views/components")
-	fmt.Println("  • Emails Directory: ui/views/emails")
-	fmt.Println("  • File Extension: .html")
-	fmt.Println("  • Auto-reload: Enabled")
-	fmt.Println("")
-
-	fmt.Println("🔄 Status:")
-	fmt.Println("  • File Watcher: Running")
-	fmt.Println("  • Templates Loaded: 25")
-	fmt.Println("  • Last Change: 2 minutes ago")
-	fmt.Println("  • Auto-reload: Enabled")
-	fmt.Println("  • Compilation: Automatic")
-	fmt.Println("")
+	for _, templateType := range templateTypes {
+		if ts, ok := stats.Types[templateType]; ok {
+			fmt.Printf("  • %s: %s (%d)\n", templateTypeTitles[templateType], ts.Dir, ts.Count)
+		}
+	}
+	fmt.Printf("\n🔨 Compiled %d templates in %s\n", stats.Total, stats.LoadTime.Round(time.Microsecond))
+	for _, err := range engine.Errors() {
+		fmt.Printf("❌ %s\n", err)
+	}
 
-	fmt.Println("📈 Statistics:")
-	fmt.Println("  • File Changes: 12")
-	fmt.Println("  • Recompilations: 8")
-	fmt.Println("  • Average Compile Time: 0.6s")
-	fmt.Println("  • Cache Hit Rate: 85%")
-	fmt.Println("")
+	engine.OnReload(func(reload views.Reload) {
+		stamp := time.Now().Format("15:04:05")
+		switch {
+		case reload.Err != nil:
+			fmt.Printf("[%s] ❌ %s\n", stamp, reload.Err)
+		case reload.Removed:
+			fmt.Printf("[%s] 🗑️  %s\n", stamp, reload)
+		default:
+			fmt.Printf("[%s] ✅ %s\n", stamp, reload)
+		}
+		// Layout changes can break or fix the pages extending them
+		for _, err := range engine.Errors() {
+			if err.Path != reload.Path {
+				fmt.Printf("           ⚠️  %s\n", err)
+			}
+		}
+	})
 
-	fmt.Println("✅ Template watcher started successfully!")
-	fmt.Println("")
-	fmt.Println("💡 Usage:")
-	fmt.Println("  • Edit any .html file in the template directories to trigger recompilation")
-	fmt.Println("  • Use 'dolphin template stats' to view statistics")
-	fmt.Println("  • Use Ctrl+C to stop watching")
+	fmt.Println("\n💡 Press Ctrl+C to stop watching")
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	fmt.Println("\n👋 Stopped watching templates")
 }
 
 func templateHelpers(cmd *cobra.Command, args []string) {
@@ -4225,74 +6581,114 @@ func templateTest(cmd *cobra.Command, args []string) {
 }
 
 func templateStats(cmd *cobra.Command, args []string) {
+	engine := loadTemplateEngine(false)
+	stats := engine.Stats()
+
 	fmt.Println("📊 Template Statistics")
 	fmt.Println("=====================")
 	fmt.Println("")
 
-	fmt.Println("📈 Template Statistics:")
-	fmt.Println("  • Total Templates: 25")
-	fmt.Println("  • Layouts: 4")
-	fmt.Println("  • Partials: 5")
-	fmt.Println("  • Pages: 5")
-	fmt.Println("  • Components: 5")
-	fmt.Println("  • Emails: 4")
-	fmt.Println("  • Total Size: 25.2 KB")
-	fmt.Println("  • Average Size: 1.0 KB")
-	fmt.Println("")
-
-	fmt.Println("🛠️  Helper Statistics:")
-	fmt.Println("  • Total Helpers: 45")
-	fmt.Println("  • String Helpers: 10")
-	fmt.Println("  • Number Helpers: 11")
-	fmt.Println("  • Date/Time Helpers: 9")
-	fmt.Println("  • Array Helpers: 10")
-	fmt.Println("  • Object Helpers: 6")
-	fmt.Println("  • HTML Helpers: 6")
-	fmt.Println("  • URL Helpers: 5")
-	fmt.Println("  • Security Helpers: 4")
-	fmt.Println("  • Conditional Helpers: 12")
-	fmt.Println("  • Loop Helpers: 3")
-	fmt.Println("  • Utility Helpers: 6")
+	fmt.Println("📁 Templates:")
+	for _, templateType := range templateTypes {
+		ts, ok := stats.Types[templateType]
+		if !ok {
+			continue
+		}
+		fmt.Printf("  • %s: %d in %s (%s)\n", templateTypeTitles[templateType], ts.Count, ts.Dir, formatTemplateSize(ts.Size))
+	}
+	fmt.Printf("  • Total: %d (%s", stats.Total, formatTemplateSize(stats.Size))
+	if stats.Total > 0 {
+		fmt.Printf(", %s on average", formatTemplateSize(stats.Size/int64(stats.Total)))
+	}
+	fmt.Println(")")
 	fmt.Println("")
 
-	fmt.Println("⚡ Performance Statistics:")
-	fmt.Println("  • Compilation Time: 0.8s")
-	fmt.Println("  • Average Render Time: 0.02s")
-	fmt.Println("  • Cache Hit Rate: 85%")
-	fmt.Println("  • Memory Usage: 2.1 MB")
-	fmt.Println("  • File Watcher: Active")
-	fmt.Println("")
+	templates := engine.GetAllTemplates()
+	largest := make([]*views.Template, 0, len(templates))
+	for _, tmpl := range templates {
+		largest = append(largest, tmpl)
+	}
+	sort.Slice(largest, func(i, j int) bool { return largest[i].Size > largest[j].Size })
+	if len(largest) > 5 {
+		largest = largest[:5]
+	}
+	if len(largest) > 0 {
+		fmt.Println("📏 Largest:")
+		for _, tmpl := range largest {
+			fmt.Printf("  • %s (%s) %s\n", tmpl.Name, formatTemplateSize(tmpl.Size), tmpl.Path)
+		}
+		fmt.Println("")
+	}
 
-	fmt.Println("📁 Directory Statistics:")
-	fmt.Println("  • Layouts Directory: ui/views/layouts (4 files)")
-	fmt.Println("  • Partials Directory: ui/views/partials (5 files)")
-	fmt.Println("  • Pages Directory: ui/views/pages (5 files)")
-	fmt.Println("  • Components Directory: ui/views/components (5 files)")
-	fmt.Println("  • Emails Directory: ui/views/emails (4 files)")
-	fmt.Println("")
+	fmt.Println("🔨 Compilation:")
+	fmt.Printf("  • Compilation Time: %s\n", stats.LoadTime.Round(time.Microsecond))
+	fmt.Printf("  • Helper Functions: %d\n", stats.Helpers)
+	fmt.Printf("  • Errors: %d\n", stats.Errors)
+	if stats.Errors > 0 {
+		fmt.Println("\n💡 Run 'dolphin template compile' for error locations")
+	}
+}
 
-	fmt.Println("🔄 Compilation Statistics:")
-	fmt.Println("  • Total Compilations: 12")
-	fmt.Println("  • Last Compilation: 2 minutes ago")
-	fmt.Println("  • Average Compile Time: 0.6s")
-	fmt.Println("  • Compilation Errors: 0")
-	fmt.Println("  • Compilation Warnings: 0")
-	fmt.Println("")
+// templateTypes orders template types for output
+var templateTypes = []views.TemplateType{
+	views.TypeLayout, views.TypePartial, views.TypePage, views.TypeComponent, views.TypeEmail, views.TypeError,
+}
 
-	fmt.Println("👀 File Watching Statistics:")
-	fmt.Println("  • File Changes: 12")
-	fmt.Println("  • Auto-recompilations: 8")
-	fmt.Println("  • Watch Duration: 2h 15m")
-	fmt.Println("  • Average Change Rate: 0.1/min")
-	fmt.Println("")
+var templateTypeTitles = map[views.TemplateType]string{
+	views.TypeLayout:    "Layouts",
+	views.TypePartial:   "Partials",
+	views.TypePage:      "Pages",
+	views.TypeComponent: "Components",
+	views.TypeEmail:     "Emails",
+	views.TypeError:     "Error Pages",
+}
 
-	fmt.Println("💡 Usage:")
-	fmt.Println("  • Use 'dolphin template compile' to compile templates")
-	fmt.Println("  • Use 'dolphin template watch' to watch for changes")
-	fmt.Println("  • Use 'dolphin template helpers' to list available helpers")
+var templateTypeIcons = map[views.TemplateType]string{
+	views.TypeLayout:    "🏗️ ",
+	views.TypePartial:   "🧩",
+	views.TypePage:      "📄",
+	views.TypeComponent: "🧱",
+	views.TypeEmail:     "📧",
+	views.TypeError:     "🚨",
+}
+
+// loadTemplateEngine loads the project's templates from the default
+// directories that exist, without creating the others
+func loadTemplateEngine(watch bool) *views.Engine {
+	config := views.DefaultConfig()
+	for _, dir := range []*string{&config.LayoutsDir, &config.PartialsDir, &config.PagesDir, &config.ComponentsDir, &config.EmailsDir, &config.ErrorsDir} {
+		if _, err := os.Stat(*dir); err != nil {
+			*dir = ""
+		}
+	}
+	config.AutoReload = watch
+	config.EnableLogging = false
+	// Compile with the helpers pages get when the router renders them
+	config.Funcs = dolphintime.TemplateHelpers()
+	for name, fn := range frontend.NewVite(cfg.Vite).TemplateHelpers() {
+		config.Funcs[name] = fn
+	}
+	translator, err := i18n.New(cfg.I18n)
+	if err != nil {
+		log.Fatalf("Failed to load translations: %v", err)
+	}
+	for name, fn := range translator.TemplateHelpers(translator.Locale()) {
+		config.Funcs[name] = fn
+	}
+	engine, err := views.NewEngine(config, nil)
+	if err != nil {
+		log.Fatalf("Failed to load templates: %v", err)
+	}
+	return engine
+}
+
+func formatTemplateSize(size int64) string {
+	if size < 1024 {
+		return fmt.Sprintf("%d B", size)
+	}
+	return fmt.Sprintf("%.1f KB", float64(size)/1024)
 }
 
-// --- HTTP Client command handlers ---
 func httpTest(cmd *cobra.Command, args []string) {
 	fmt.Println("🧪 Testing HTTP Client")
 	fmt.Println("=====================")
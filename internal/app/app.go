@@ -13,6 +13,9 @@ type App struct {
 	config *config.Config
 	logger *zap.Logger
 	db     *database.Manager
+
+	// logLevel is set when the logger's level can change at runtime
+	logLevel *zap.AtomicLevel
 }
 
 // New creates a new application instance
@@ -34,6 +37,17 @@ func (a *App) Logger() *zap.Logger {
 	return a.logger
 }
 
+// SetLogLevel hands the app the level its logger was built with, so the
+// level can be changed while it runs
+func (a *App) SetLogLevel(level zap.AtomicLevel) {
+	a.logLevel = &level
+}
+
+// LogLevel returns the logger's runtime level, or nil if it is fixed
+func (a *App) LogLevel() *zap.AtomicLevel {
+	return a.logLevel
+}
+
 // DB returns the database manager
 func (a *App) DB() *database.Manager {
 	return a.db
@@ -2,10 +2,14 @@ package app
 
 import (
 	"fmt"
+	"go/token"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
+
+	"github.com/mrhoseah/dolphin/internal/database"
+	"github.com/mrhoseah/dolphin/internal/tenancy"
 )
 
 // Generator handles code generation for scaffolding
@@ -18,18 +22,23 @@ func NewGenerator() *Generator {
 
 // CreateModule generates a complete module with model, controller, repository, and HTMX views
 func (g *Generator) CreateModule(name string) error {
+	return g.CreateModuleWithOptions(name, ModelOptions{SoftDeletes: true})
+}
+
+// CreateModuleWithOptions generates a module using the given model options
+func (g *Generator) CreateModuleWithOptions(name string, opts ModelOptions) error {
 	// Create model
-	if err := g.CreateModel(name); err != nil {
+	if err := g.CreateModelWithOptions(name, opts); err != nil {
 		return fmt.Errorf("failed to create model: %w", err)
 	}
 
 	// Create controller
-	if err := g.CreateController(name); err != nil {
+	if err := g.createController(name, true); err != nil {
 		return fmt.Errorf("failed to create controller: %w", err)
 	}
 
 	// Create repository
-	if err := g.CreateRepository(name); err != nil {
+	if err := g.createRepository(name, ResourceOptions{SoftDeletes: opts.SoftDeletes}); err != nil {
 		return fmt.Errorf("failed to create repository: %w", err)
 	}
 
@@ -39,38 +48,143 @@ func (g *Generator) CreateModule(name string) error {
 	}
 
 	// Create migration
-	if err := g.CreateMigration(name); err != nil {
+	if err := g.createModelMigration(name, opts); err != nil {
 		return fmt.Errorf("failed to create migration: %w", err)
 	}
 
+	// Wire the controller and its repository
+	if err := g.wireController(name, true); err != nil {
+		return fmt.Errorf("failed to wire controller: %w", err)
+	}
+
 	return nil
 }
 
+// ResourceOptions controls optional features of generated API resources
+type ResourceOptions struct {
+	// Cursor generates a keyset (cursor) paginated Index endpoint
+	Cursor bool
+
+	// Parent nests the resource under another one: /posts/{post}/comments
+	Parent string
+
+	// Shallow keeps only Index and Store nested; members use /comments/{id}
+	Shallow bool
+
+	// SoftDeletes adds restore and force-delete endpoints
+	SoftDeletes bool
+
+	// Export adds a GET .../export endpoint streaming the filtered
+	// collection as CSV or XLSX
+	Export bool
+
+	// PruneAfter makes the model prunable after this retention period
+	PruneAfter time.Duration
+}
+
+// ModelOptions controls optional fields of generated models
+type ModelOptions struct {
+	// Parent adds a <Parent>ID foreign key to the model
+	Parent string
+
+	// SoftDeletes adds a gorm.DeletedAt column so deletes only mark rows
+	SoftDeletes bool
+
+	// PruneAfter implements orm.Prunable so model:prune removes rows
+	// soft-deleted longer ago than this; zero keeps them forever
+	PruneAfter time.Duration
+}
+
 // CreateResource generates a complete API resource with CRUD operations
-func (g *Generator) CreateResource(name string) error {
+func (g *Generator) CreateResource(name string, opts ResourceOptions) error {
 	// Create model
-	if err := g.CreateModel(name); err != nil {
+	modelOpts := ModelOptions{Parent: opts.Parent, SoftDeletes: opts.SoftDeletes, PruneAfter: opts.PruneAfter}
+	if err := g.CreateModelWithOptions(name, modelOpts); err != nil {
 		return fmt.Errorf("failed to create model: %w", err)
 	}
 
 	// Create API controller
-	if err := g.CreateAPIController(name); err != nil {
+	if err := g.CreateAPIController(name, opts); err != nil {
 		return fmt.Errorf("failed to create API controller: %w", err)
 	}
 
 	// Create repository
-	if err := g.CreateRepository(name); err != nil {
+	if err := g.createRepository(name, opts); err != nil {
 		return fmt.Errorf("failed to create repository: %w", err)
 	}
 
+	// Create routes
+	if err := g.CreateResourceRoutes(name, opts); err != nil {
+		return fmt.Errorf("failed to create routes: %w", err)
+	}
+
 	// Create migration
-	if err := g.CreateMigration(name); err != nil {
+	if err := g.createModelMigration(name, modelOpts); err != nil {
 		return fmt.Errorf("failed to create migration: %w", err)
 	}
 
+	// Wire the controller, its repository and its routes
+	if err := g.wireAPIController(name); err != nil {
+		return fmt.Errorf("failed to wire controller: %w", err)
+	}
+
 	return nil
 }
 
+// CreateResourceRoutes generates the chi route registration for an API resource
+func (g *Generator) CreateResourceRoutes(name string, opts ResourceOptions) error {
+	routesDir := "app/http/routes"
+	if err := os.MkdirAll(routesDir, 0755); err != nil {
+		return err
+	}
+
+	filename := fmt.Sprintf("%s.go", strings.ToLower(name))
+	filepath := filepath.Join(routesDir, filename)
+	content := g.generateResourceRoutesContent(name, opts)
+
+	return os.WriteFile(filepath, []byte(content), 0644)
+}
+
+// CreateUpload generates an upload controller storing files with the
+// media package, its routes, and wires both into bootstrap/controllers.go
+func (g *Generator) CreateUpload(name string) error {
+	lowerName := strings.ToLower(name)
+	files := map[string]string{
+		filepath.Join("app/http/controllers", lowerName+"_upload.go"): g.generateUploadControllerContent(name),
+		filepath.Join("app/http/routes", lowerName+"_upload.go"):      g.generateUploadRoutesContent(name),
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+	return g.wireUpload(name)
+}
+
+// CreateResumableUpload generates an upload controller taking large files
+// in chunks over its own tus endpoint, its routes and an HTMX upload page,
+// and wires them into bootstrap/controllers.go
+func (g *Generator) CreateResumableUpload(name string) error {
+	lowerName := strings.ToLower(name)
+	files := map[string]string{
+		filepath.Join("app/http/controllers", lowerName+"_upload.go"): g.generateResumableUploadControllerContent(name),
+		filepath.Join("app/http/routes", lowerName+"_upload.go"):      g.generateResumableUploadRoutesContent(name),
+		filepath.Join("resources/views", lowerName, "upload.html"):    g.generateResumableUploadView(name),
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+	return g.wireResumableUpload(name)
+}
+
 // CreateHTMXViews generates HTMX-based views for a module
 func (g *Generator) CreateHTMXViews(name string) error {
 	viewsDir := fmt.Sprintf("resources/views/%s", strings.ToLower(name))
@@ -108,6 +222,12 @@ func (g *Generator) CreateHTMXViews(name string) error {
 
 // CreateRepository generates a repository for data access
 func (g *Generator) CreateRepository(name string) error {
+	return g.createRepository(name, ResourceOptions{})
+}
+
+// createRepository generates a repository embedding orm.Repository, with
+// parent scoping as requested
+func (g *Generator) createRepository(name string, opts ResourceOptions) error {
 	repositoriesDir := "app/repositories"
 	if err := os.MkdirAll(repositoriesDir, 0755); err != nil {
 		return err
@@ -115,13 +235,13 @@ func (g *Generator) CreateRepository(name string) error {
 
 	filename := fmt.Sprintf("%s.go", strings.ToLower(name))
 	filepath := filepath.Join(repositoriesDir, filename)
-	content := g.generateRepositoryContent(name)
+	content := g.generateRepositoryContent(name, opts)
 
 	return os.WriteFile(filepath, []byte(content), 0644)
 }
 
 // CreateAPIController generates an API-specific controller
-func (g *Generator) CreateAPIController(name string) error {
+func (g *Generator) CreateAPIController(name string, opts ResourceOptions) error {
 	controllersDir := "app/http/controllers/api"
 	if err := os.MkdirAll(controllersDir, 0755); err != nil {
 		return err
@@ -129,7 +249,100 @@ func (g *Generator) CreateAPIController(name string) error {
 
 	filename := fmt.Sprintf("%s.go", strings.ToLower(name))
 	filepath := filepath.Join(controllersDir, filename)
-	content := g.generateAPIControllerContent(name)
+	content := g.generateAPIControllerContent(name, opts)
+
+	return os.WriteFile(filepath, []byte(content), 0644)
+}
+
+// CreateResourceTransformer generates an API resource transformer for a model
+func (g *Generator) CreateResourceTransformer(name string) error {
+	resourcesDir := "app/http/resources"
+	if err := os.MkdirAll(resourcesDir, 0755); err != nil {
+		return err
+	}
+
+	filename := fmt.Sprintf("%s.go", strings.ToLower(name))
+	filepath := filepath.Join(resourcesDir, filename)
+	content := g.generateResourceTransformerContent(name)
+
+	return os.WriteFile(filepath, []byte(content), 0644)
+}
+
+// CreateRequest generates a request DTO bound from route params, query, headers, and body
+func (g *Generator) CreateRequest(name string) error {
+	requestsDir := "app/http/requests"
+	if err := os.MkdirAll(requestsDir, 0755); err != nil {
+		return err
+	}
+
+	filename := fmt.Sprintf("%s.go", strings.ToLower(name))
+	filepath := filepath.Join(requestsDir, filename)
+	content := g.generateRequestContent(name)
+
+	return os.WriteFile(filepath, []byte(content), 0644)
+}
+
+// CreateTenant generates a file registering a tenant with the tenancy store
+func (g *Generator) CreateTenant(id string) error {
+	if !tenancy.ValidID(id) {
+		return fmt.Errorf("invalid tenant id %q: use lowercase letters, digits, '-' and '_'", id)
+	}
+
+	tenantsDir := "app/tenants"
+	if err := os.MkdirAll(tenantsDir, 0755); err != nil {
+		return err
+	}
+
+	filepath := filepath.Join(tenantsDir, id+".go")
+	if _, err := os.Stat(filepath); err == nil {
+		return fmt.Errorf("%s already exists", filepath)
+	}
+	content := g.generateTenantContent(id)
+
+	return os.WriteFile(filepath, []byte(content), 0644)
+}
+
+// CreatePaymentHandler generates a payment provider in app/gateways,
+// registered with the payments package under its snake_case name, which
+// payments.providers.<name> configures
+func (g *Generator) CreatePaymentHandler(name string) error {
+	typeName := toCamelCase(name)
+	if typeName == "" || !token.IsIdentifier(typeName) {
+		return fmt.Errorf("invalid payment handler name %q", name)
+	}
+
+	gatewaysDir := "app/gateways"
+	if err := os.MkdirAll(gatewaysDir, 0755); err != nil {
+		return err
+	}
+
+	filepath := filepath.Join(gatewaysDir, toSnakeCase(typeName)+".go")
+	if _, err := os.Stat(filepath); err == nil {
+		return fmt.Errorf("%s already exists", filepath)
+	}
+	content := g.generatePaymentHandlerContent(typeName)
+
+	return os.WriteFile(filepath, []byte(content), 0644)
+}
+
+// CreateObserver generates an observer of a model in app/observers,
+// registered with the observers package
+func (g *Generator) CreateObserver(model string) error {
+	typeName := toCamelCase(model)
+	if typeName == "" || !token.IsIdentifier(typeName) {
+		return fmt.Errorf("invalid model name %q", model)
+	}
+
+	observersDir := "app/observers"
+	if err := os.MkdirAll(observersDir, 0755); err != nil {
+		return err
+	}
+
+	filepath := filepath.Join(observersDir, toSnakeCase(typeName)+"_observer.go")
+	if _, err := os.Stat(filepath); err == nil {
+		return fmt.Errorf("%s already exists", filepath)
+	}
+	content := g.generateObserverContent(typeName)
 
 	return os.WriteFile(filepath, []byte(content), 0644)
 }
@@ -171,8 +384,18 @@ func (g *Generator) createHTMXView(name, viewType, viewsDir string) error {
 	return os.WriteFile(filepath, []byte(content), 0644)
 }
 
-// CreateController generates a new controller
+// CreateController generates a new controller and wires it into
+// bootstrap/controllers.go
 func (g *Generator) CreateController(name string) error {
+	if err := g.createController(name, false); err != nil {
+		return err
+	}
+	return g.wireController(name, false)
+}
+
+// createController generates a controller, taking the model's repository
+// when withRepo is set
+func (g *Generator) createController(name string, withRepo bool) error {
 	// Ensure controllers directory exists
 	controllersDir := "app/http/controllers"
 	if err := os.MkdirAll(controllersDir, 0755); err != nil {
@@ -184,13 +407,18 @@ func (g *Generator) CreateController(name string) error {
 	filepath := filepath.Join(controllersDir, filename)
 
 	// Generate controller content
-	content := g.generateControllerContent(name)
+	content := g.generateControllerContent(name, withRepo)
 
 	return os.WriteFile(filepath, []byte(content), 0644)
 }
 
 // CreateModel generates a new model
 func (g *Generator) CreateModel(name string) error {
+	return g.CreateModelWithOptions(name, ModelOptions{SoftDeletes: true})
+}
+
+// CreateModelWithOptions generates a new model with optional fields
+func (g *Generator) CreateModelWithOptions(name string, opts ModelOptions) error {
 	// Ensure models directory exists
 	modelsDir := "app/models"
 	if err := os.MkdirAll(modelsDir, 0755); err != nil {
@@ -202,13 +430,19 @@ func (g *Generator) CreateModel(name string) error {
 	filepath := filepath.Join(modelsDir, filename)
 
 	// Generate model content
-	content := g.generateModelContent(name)
+	content := g.generateModelContent(name, opts)
 
 	return os.WriteFile(filepath, []byte(content), 0644)
 }
 
 // CreateMigration generates a new migration
 func (g *Generator) CreateMigration(name string) error {
+	return g.CreateMigrationForConnection(name, "")
+}
+
+// CreateMigrationForConnection generates a migration targeting a named
+// database connection; an empty connection targets the default one
+func (g *Generator) CreateMigrationForConnection(name, connection string) error {
 	// Ensure migrations directory exists
 	migrationsDir := "migrations"
 	if err := os.MkdirAll(migrationsDir, 0755); err != nil {
@@ -221,11 +455,44 @@ func (g *Generator) CreateMigration(name string) error {
 	filepath := filepath.Join(migrationsDir, filename)
 
 	// Generate migration content
-	content := g.generateMigrationContent(name)
+	content := g.generateMigrationContent(name, connection)
 
 	return os.WriteFile(filepath, []byte(content), 0644)
 }
 
+// createModelMigration generates the migration creating a model's table
+func (g *Generator) createModelMigration(name string, opts ModelOptions) error {
+	migrationsDir := "migrations"
+	if err := os.MkdirAll(migrationsDir, 0755); err != nil {
+		return err
+	}
+
+	timestamp := time.Now().Format("20060102150405")
+	filename := fmt.Sprintf("%s_%s.go", timestamp, strings.ToLower(name))
+	filepath := filepath.Join(migrationsDir, filename)
+
+	content := g.generateModelMigrationContent(name, opts)
+
+	return os.WriteFile(filepath, []byte(content), 0644)
+}
+
+// CreateMigrationWithSteps generates a migration whose Up and Down run the
+// given steps against a database.SchemaBuilder, returning its path
+func (g *Generator) CreateMigrationWithSteps(name string, up, down []database.SchemaStep) (string, error) {
+	migrationsDir := "migrations"
+	if err := os.MkdirAll(migrationsDir, 0755); err != nil {
+		return "", err
+	}
+
+	timestamp := time.Now().Format("20060102150405")
+	filename := fmt.Sprintf("%s_%s.go", timestamp, strings.ToLower(name))
+	filepath := filepath.Join(migrationsDir, filename)
+
+	content := g.generateStepMigrationContent(name, up, down)
+
+	return filepath, os.WriteFile(filepath, []byte(content), 0644)
+}
+
 // CreateMiddleware generates a new middleware
 func (g *Generator) CreateMiddleware(name string) error {
 	// Ensure middleware directory exists
@@ -244,82 +511,144 @@ func (g *Generator) CreateMiddleware(name string) error {
 	return os.WriteFile(filepath, []byte(content), 0644)
 }
 
-// generateControllerContent creates controller template
-func (g *Generator) generateControllerContent(name string) string {
+// generateControllerContent creates controller template. Module controllers
+// get the model's repository injected and read through it.
+func (g *Generator) generateControllerContent(name string, withRepo bool) string {
 	lowerName := strings.ToLower(name)
+	imports := `	"net/http"
+
+	"github.com/mrhoseah/dolphin/internal/dolphin"
+`
+	fields := "struct{}"
+	constructor := `// New` + name + ` creates a new ` + name + ` controller
+func New` + name + `() *` + name + ` {
+	return &` + name + `{}
+}`
+	index := `	return ctx.Respond(http.StatusOK, map[string]interface{}{
+		"message": "List of ` + lowerName + `",
+		"data":    []interface{}{},
+	})`
+	show := `	return ctx.Respond(http.StatusOK, map[string]interface{}{
+		"message": "Show ` + lowerName + `",
+		"id":      ctx.Param("id"),
+		"data":    map[string]interface{}{},
+	})`
+
+	if withRepo {
+		imports = `	"net/http"
+
+	"github.com/mrhoseah/dolphin/app/repositories"
+	"github.com/mrhoseah/dolphin/internal/dolphin"
+	"github.com/mrhoseah/dolphin/internal/problem"
+`
+		fields = `struct {
+	repo *repositories.` + name + `Repository
+}`
+		constructor = `// New` + name + ` creates a new ` + name + ` controller over repo
+func New` + name + `(repo *repositories.` + name + `Repository) *` + name + ` {
+	return &` + name + `{repo: repo}
+}`
+		index = `	items, err := c.repo.FindAll(ctx.Context())
+	if err != nil {
+		return err
+	}
+
+	return ctx.Respond(http.StatusOK, map[string]interface{}{
+		"message": "List of ` + lowerName + `",
+		"data":    items,
+	})`
+		show = `	id, err := ctx.ParamUint("id")
+	if err != nil {
+		return err
+	}
+
+	item, err := c.repo.Find(ctx.Context(), id)
+	if err != nil {
+		return problem.RecordNotFound(err, "` + lowerName + `", id)
+	}
+
+	return ctx.Respond(http.StatusOK, map[string]interface{}{
+		"message": "Show ` + lowerName + `",
+		"id":      id,
+		"data":    item,
+	})`
+	}
+
 	return `package controllers
 
 import (
-	"net/http"
+` + imports + `)
 
-	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/render"
-)
-
-// ` + name + ` handles ` + lowerName + ` related requests
-type ` + name + ` struct{}
+// ` + name + ` handles ` + lowerName + ` related requests. Register its
+// actions with dolphin.Handler, e.g. r.Get("/", dolphin.Handler(c.Index)).
+type ` + name + ` ` + fields + `
 
-// New` + name + ` creates a new ` + name + ` controller
-func New` + name + `() *` + name + ` {
-	return &` + name + `{}
-}
+` + constructor + `
 
 // Index handles GET /` + lowerName + `
-func (c *` + name + `) Index(w http.ResponseWriter, r *http.Request) {
-	render.JSON(w, r, map[string]interface{}{
-		"message": "List of ` + lowerName + `",
-		"data":    []interface{}{},
-	})
+func (c *` + name + `) Index(ctx *dolphin.Context) error {
+` + index + `
 }
 
 // Show handles GET /` + lowerName + `/{id}
-func (c *` + name + `) Show(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	
-	render.JSON(w, r, map[string]interface{}{
-		"message": "Show ` + lowerName + `",
-		"id":      id,
-		"data":    map[string]interface{}{},
-	})
+func (c *` + name + `) Show(ctx *dolphin.Context) error {
+` + show + `
 }
 
 // Store handles POST /` + lowerName + `
-func (c *` + name + `) Store(w http.ResponseWriter, r *http.Request) {
-	render.JSON(w, r, map[string]interface{}{
+func (c *` + name + `) Store(ctx *dolphin.Context) error {
+	return ctx.Respond(http.StatusCreated, map[string]interface{}{
 		"message": "` + lowerName + ` created successfully",
 		"data":    map[string]interface{}{},
 	})
 }
 
 // Update handles PUT /` + lowerName + `/{id}
-func (c *` + name + `) Update(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	
-	render.JSON(w, r, map[string]interface{}{
+func (c *` + name + `) Update(ctx *dolphin.Context) error {
+	return ctx.Respond(http.StatusOK, map[string]interface{}{
 		"message": "` + name + ` updated successfully",
-		"id":      id,
+		"id":      ctx.Param("id"),
 		"data":    map[string]interface{}{},
 	})
 }
 
 // Destroy handles DELETE /` + lowerName + `/{id}
-func (c *` + name + `) Destroy(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	
-	render.JSON(w, r, map[string]interface{}{
+func (c *` + name + `) Destroy(ctx *dolphin.Context) error {
+	return ctx.Respond(http.StatusOK, map[string]interface{}{
 		"message": "` + lowerName + ` deleted successfully",
-		"id":      id,
+		"id":      ctx.Param("id"),
 	})
 }`
 }
 
 // generateModelContent creates model template
-func (g *Generator) generateModelContent(name string) string {
-	return fmt.Sprintf(`package models
+func (g *Generator) generateModelContent(name string, opts ModelOptions) string {
+	fields := "\t// Add your fields here\n"
+	if opts.Parent != "" {
+		fields = fmt.Sprintf("\t// %[1]s this %[2]s belongs to\n\t%[1]sID uint `gorm:\"index;not null\"`\n\n", opts.Parent, strings.ToLower(name)) + fields
+	}
+	softDeletes, imports, prune := "", "", ""
+	if opts.SoftDeletes {
+		softDeletes = "\tDeletedAt gorm.DeletedAt `gorm:\"index\"`\n"
+		if opts.PruneAfter > 0 {
+			imports = "\t\"github.com/mrhoseah/dolphin/internal/orm\"\n"
+			prune = fmt.Sprintf(`
+func init() {
+	orm.RegisterPrunable(%[1]s{})
+}
+
+// PruneAfter is how long soft-deleted %[2]ss are kept before model:prune removes them
+func (%[1]s) PruneAfter() time.Duration {
+	return %[3]s
+}
+`, name, strings.ToLower(name), formatDurationLiteral(opts.PruneAfter))
+		}
+	}
+	content := fmt.Sprintf(`package models
 
 import (
 	"time"
-	"gorm.io/gorm"
+{{imports}}	"gorm.io/gorm"
 )
 
 // %s represents a %s model
@@ -327,10 +656,8 @@ type %s struct {
 	ID        uint           `+"`gorm:\"primarykey\"`"+`
 	CreatedAt time.Time
 	UpdatedAt time.Time
-	DeletedAt gorm.DeletedAt `+"`gorm:\"index\"`"+`
-	
-	// Add your fields here
-	// Name string `+"`gorm:\"not null\"`"+`
+{{softDeletes}}	
+{{fields}}	// Name string `+"`gorm:\"not null\"`"+`
 	// Email string `+"`gorm:\"uniqueIndex\"`"+`
 }
 
@@ -356,43 +683,158 @@ func (m *%s) BeforeDelete(tx *gorm.DB) error {
 	// Add any pre-delete logic here
 	return nil
 }
-`, name, strings.ToLower(name), name, strings.ToLower(name), name, strings.ToLower(name), name, name, name)
+{{prune}}`, name, strings.ToLower(name), name, strings.ToLower(name), name, strings.ToLower(name), name, name, name)
+	content = strings.Replace(content, "{{imports}}", imports, 1)
+	content = strings.Replace(content, "{{softDeletes}}", softDeletes, 1)
+	content = strings.Replace(content, "{{fields}}", fields, 1)
+	return strings.Replace(content, "{{prune}}", prune, 1)
+}
+
+// formatDurationLiteral renders a duration as Go source, e.g. 30 * 24 * time.Hour
+func formatDurationLiteral(d time.Duration) string {
+	switch {
+	case d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%d * 24 * time.Hour", d/(24*time.Hour))
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%d * time.Hour", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%d * time.Minute", d/time.Minute)
+	default:
+		return fmt.Sprintf("time.Duration(%d)", int64(d))
+	}
+}
+
+// generateMigrationContent creates migration template. Names following
+// the create_<table>_table and add_<x>_to_<table>_table conventions get a
+// schema builder body for that table.
+func (g *Generator) generateMigrationContent(name, connection string) string {
+	up := `	// Add your migration logic here
+	// Example: Create a table
+	// schema, err := database.NewBuilder(s)
+	// if err != nil {
+	// 	return err
+	// }
+	// return schema.Create("example", func(t *database.Table) {
+	// 	t.ID()
+	// 	t.String("name")
+	// 	t.Timestamps()
+	// })
+	return nil
+`
+	down := `	// Add your rollback logic here
+	// return schema.DropIfExists("example")
+	return nil
+`
+	if table, ok := matchMigrationName(name, "create_", "_table"); ok {
+		up = fmt.Sprintf(builderPreamble+`	return schema.Create(%q, func(t *database.Table) {
+		t.ID()
+		t.Timestamps()
+	})
+`, table)
+		down = fmt.Sprintf(builderPreamble+"\treturn schema.DropIfExists(%q)\n", table)
+	} else if table := alteredTable(name); table != "" {
+		up = fmt.Sprintf(builderPreamble+`	return schema.Table(%q, func(t *database.Table) {
+		// t.String("column").Nullable()
+	})
+`, table)
+		down = fmt.Sprintf(builderPreamble+`	return schema.Table(%q, func(t *database.Table) {
+		// t.DropColumn("column")
+	})
+`, table)
+	}
+	return g.renderMigration(name, connection, up, down)
 }
 
-// generateMigrationContent creates migration template
-func (g *Generator) generateMigrationContent(name string) string {
+// generateModelMigrationContent creates the migration for a generated
+// model's table
+func (g *Generator) generateModelMigrationContent(name string, opts ModelOptions) string {
+	table := strings.ToLower(name)
+	var columns strings.Builder
+	columns.WriteString("\t\tt.ID()\n")
+	if opts.Parent != "" {
+		fmt.Fprintf(&columns, "\t\tt.ForeignID(%q).Index().Constrained(%q).OnDelete(\"cascade\")\n", toSnakeCase(opts.Parent)+"_id", strings.ToLower(opts.Parent))
+	}
+	columns.WriteString("\t\tt.Timestamps()\n")
+	if opts.SoftDeletes {
+		columns.WriteString("\t\tt.SoftDeletes()\n")
+	}
+
+	up := fmt.Sprintf(builderPreamble+"\treturn schema.Create(%q, func(t *database.Table) {\n%s\t})\n", table, columns.String())
+	down := fmt.Sprintf(builderPreamble+"\treturn schema.DropIfExists(%q)\n", table)
+	return g.renderMigration(name, "", up, down)
+}
+
+// builderPreamble opens migration bodies that use the schema builder
+const builderPreamble = `	schema, err := database.NewBuilder(s)
+	if err != nil {
+		return err
+	}
+`
+
+func (g *Generator) renderMigration(name, connection, up, down string) string {
+	typeName := toCamelCase(name)
+	var connectionMethod string
+	if connection != "" {
+		connectionMethod = fmt.Sprintf(`
+// Connection returns the database connection the migration runs on
+func (m *%s) Connection() string {
+	return %q
+}
+`, typeName, connection)
+	}
+
 	return fmt.Sprintf(`package migrations
 
 import (
+	"github.com/mrhoseah/dolphin/internal/database"
 	raptor "github.com/mrhoseah/raptor/core"
 )
 
-// %s represents the %s migration
-type %s struct{}
+func init() {
+	database.RegisterMigration(&%[1]s{})
+}
+
+// %[1]s represents the %[2]s migration
+type %[1]s struct{}
 
 // Name returns the migration name
-func (m *%s) Name() string {
-	return "%s"
+func (m *%[1]s) Name() string {
+	return %[2]q
 }
-
+%[3]s
 // Up runs the migration
-func (m *%s) Up(s raptor.Schema) error {
-	// Add your migration logic here
-	// Example: Create a table
-	// return s.CreateTable("%s", []string{"id", "name", "email", "created_at"})
-	
-	return nil
-}
+func (m *%[1]s) Up(s raptor.Schema) error {
+%[4]s}
 
 // Down rolls back the migration
-func (m *%s) Down(s raptor.Schema) error {
-	// Add your rollback logic here
-	// Example: Drop a table
-	// return s.DropTable("%s")
-	
-	return nil
+func (m *%[1]s) Down(s raptor.Schema) error {
+%[5]s}
+`, typeName, strings.ToLower(name), connectionMethod, up, down)
 }
-`, name, strings.ToLower(name), name, name, strings.ToLower(name), name, strings.ToLower(name), name, strings.ToLower(name))
+
+// matchMigrationName returns what lies between prefix and suffix in a
+// migration name
+func matchMigrationName(name, prefix, suffix string) (string, bool) {
+	name = strings.ToLower(name)
+	if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) || len(name) <= len(prefix)+len(suffix) {
+		return "", false
+	}
+	return name[len(prefix) : len(name)-len(suffix)], true
+}
+
+// alteredTable returns the table of names like add_email_to_users_table or
+// remove_email_from_users_table
+func alteredTable(name string) string {
+	name = strings.ToLower(name)
+	if !strings.HasSuffix(name, "_table") {
+		return ""
+	}
+	for _, sep := range []string{"_to_", "_from_", "_in_", "_on_"} {
+		if i := strings.LastIndex(name, sep); i >= 0 {
+			return strings.TrimSuffix(name[i+len(sep):], "_table")
+		}
+	}
+	return ""
 }
 
 // generateMiddlewareContent creates middleware template
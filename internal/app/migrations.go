@@ -0,0 +1,23 @@
+package app
+
+import (
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/database"
+)
+
+// MigrationConnections returns the connection name, as given with
+// --database, or every configured connection that can be migrated when it
+// is empty
+func MigrationConnections(cfg *config.DatabaseConfig, name string) []string {
+	if name != "" {
+		return []string{name}
+	}
+	var names []string
+	for _, name := range database.ConnectionNames(cfg) {
+		if connCfg, err := database.ConnectionConfig(cfg, name); err == nil && database.ReadOnlyDriver(connCfg.Driver) {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
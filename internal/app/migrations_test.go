@@ -0,0 +1,21 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+func TestMigrationConnections(t *testing.T) {
+	cfg := &config.DatabaseConfig{
+		Driver: "postgres",
+		Connections: map[string]config.ConnectionConfig{
+			"reports":   {Driver: "mysql"},
+			"analytics": {Driver: "clickhouse"},
+		},
+	}
+	assert.Equal(t, []string{"default", "reports"}, MigrationConnections(cfg, ""), "read-only connections are skipped")
+	assert.Equal(t, []string{"analytics"}, MigrationConnections(cfg, "analytics"), "a named connection is taken as given")
+}
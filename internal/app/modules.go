@@ -0,0 +1,241 @@
+package app
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ModulesDir is where module:create puts modules, one directory each
+const ModulesDir = "modules"
+
+// moduleName is what module names must look like, being package names
+var moduleName = regexp.MustCompile(`^[a-z][a-z0-9]*$`)
+
+// CreateAppModule scaffolds a self-contained module under modules/<name>:
+// its public API package at the root, its model, repository and
+// controller under internal/, where Go stops other modules importing
+// them, and its views. The module registers itself and its migrations
+// when imported, and is wired into bootstrap/controllers.go. The name is
+// lowercased, as the other generators do, to be the package name.
+func (g *Generator) CreateAppModule(name, model string) error {
+	if !moduleName.MatchString(strings.ToLower(name)) {
+		return fmt.Errorf("module name %q must be letters and digits, as its package name", name)
+	}
+	name = strings.ToLower(name)
+	dir := filepath.Join(ModulesDir, name)
+	if _, err := os.Stat(dir); err == nil {
+		return fmt.Errorf("%s already exists", dir)
+	}
+
+	importPath := appModule + "/" + ModulesDir + "/" + name
+	files := map[string]string{
+		filepath.Join(dir, name+".go"):                                         g.generateModuleAPIContent(name, model),
+		filepath.Join(dir, "provider.go"):                                      g.generateModuleProviderContent(name, model),
+		filepath.Join(dir, "routes.go"):                                        g.generateModuleRoutesContent(name, model),
+		filepath.Join(dir, "views", "index.html"):                              g.generateModuleViewContent(name),
+		filepath.Join(dir, "internal", "models", strings.ToLower(model)+".go"): g.generateModelContent(model, ModelOptions{SoftDeletes: true}),
+		filepath.Join(dir, "internal", "repositories", strings.ToLower(model)+".go"): strings.Replace(
+			g.generateRepositoryContent(model, ResourceOptions{SoftDeletes: true}),
+			`"`+appModule+`/app/models"`, `"`+importPath+`/internal/models"`, 1),
+		filepath.Join(dir, "internal", "handlers", strings.ToLower(model)+".go"): strings.NewReplacer(
+			"package controllers", "package handlers",
+			`"`+appModule+`/app/repositories"`, `"`+importPath+`/internal/repositories"`,
+		).Replace(g.generateControllerContent(model, true)),
+		filepath.Join(dir, "migrations", time.Now().Format("20060102150405")+"_"+strings.ToLower(model)+".go"): g.generateModelMigrationContent(model, ModelOptions{SoftDeletes: true}),
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+
+	field := toCamelCase(name) + "Module"
+	return g.wire([]wiringEntry{
+		{"imports", `"` + importPath + `"`, `"` + importPath + `"`},
+		{"controllers", field + " ", fmt.Sprintf("%s *%s.Module", field, name)},
+		{"new-controllers", field + ":", fmt.Sprintf("%s: %s.New(a),", field, name)},
+		{"routes", fmt.Sprintf("c.%s.Routes(", field), fmt.Sprintf("c.%s.Routes(r)", field)},
+	})
+}
+
+// generateModuleAPIContent generates a module's public API: the package
+// other modules import, exposing the model and what may be done with it
+func (g *Generator) generateModuleAPIContent(name, model string) string {
+	return fmt.Sprintf(`// Package %[1]s is the public API of the %[1]s module, the only package of
+// it the application and other modules may import; dolphin module:lint
+// checks that they don't import the rest. Add what other modules need to
+// Module's methods, and keep the rest under internal/.
+package %[1]s
+
+import (
+	"context"
+
+	"%[3]s/internal/models"
+)
+
+// %[2]s is the module's model, as other modules see it
+type %[2]s = models.%[2]s
+
+// Find%[2]s returns a %[4]s by ID
+func (m *Module) Find%[2]s(ctx context.Context, id uint) (*%[2]s, error) {
+	return m.repo.Find(ctx, id)
+}
+`, name, model, appModule+"/"+ModulesDir+"/"+name, strings.ToLower(model))
+}
+
+// generateModuleProviderContent generates the module's registration and
+// the constructor building its repositories and handlers
+func (g *Generator) generateModuleProviderContent(name, model string) string {
+	return fmt.Sprintf(`package %[1]s
+
+import (
+	"github.com/mrhoseah/dolphin/internal/app"
+	"github.com/mrhoseah/dolphin/internal/modules"
+
+	"%[3]s/internal/handlers"
+	"%[3]s/internal/repositories"
+
+	// The module's migrations register themselves from init
+	_ "%[3]s/migrations"
+)
+
+// The module's views render as %[1]s::<name> and its assets are served
+// under /modules/%[1]s/. Its seeders and migrations may be added here too.
+func init() {
+	modules.Register(modules.Module{Name: "%[1]s", Dir: "%[4]s"})
+}
+
+// Module is the %[1]s module, built once at startup
+type Module struct {
+	repo     *repositories.%[2]sRepository
+	handlers *handlers.%[2]s
+}
+
+// New builds the %[1]s module from the application container
+func New(a *app.App) *Module {
+	repo := repositories.New%[2]sRepository(a.DB().GetDB())
+	return &Module{
+		repo:     repo,
+		handlers: handlers.New%[2]s(repo),
+	}
+}
+`, name, model, appModule+"/"+ModulesDir+"/"+name, ModulesDir+"/"+name)
+}
+
+// generateModuleViewContent generates a module's index page, to render as
+// <name>::index
+func (g *Generator) generateModuleViewContent(name string) string {
+	return fmt.Sprintf(`<h1>%s</h1>
+<p>This page is modules/%s/views/index.html, rendered as %s::index.</p>
+`, toCamelCase(name), name, name)
+}
+
+// generateModuleRoutesContent generates the registration of a module's
+// routes, under /<name> in the api middleware group
+func (g *Generator) generateModuleRoutesContent(name, model string) string {
+	return fmt.Sprintf(`package %[1]s
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/mrhoseah/dolphin/internal/dolphin"
+	"github.com/mrhoseah/dolphin/internal/routing"
+)
+
+// Routes registers the module's routes under /%[1]s, in the api middleware
+// group
+func (m *Module) Routes(r chi.Router) {
+	routing.Wrap(r).Group("api", func(r *routing.Router) {
+		r.Route("/%[1]s/%[2]ss", func(r *routing.Router) {
+			r.Get("/", dolphin.Handler(m.handlers.Index))
+			r.Post("/", dolphin.Handler(m.handlers.Store))
+			r.Get("/{id}", dolphin.Handler(m.handlers.Show))
+			r.Put("/{id}", dolphin.Handler(m.handlers.Update))
+			r.Delete("/{id}", dolphin.Handler(m.handlers.Destroy))
+		})
+	})
+}
+`, name, strings.ToLower(model))
+}
+
+// ModuleViolation is an import reaching past a module's public API
+type ModuleViolation struct {
+	// File and Line are where the import is
+	File string
+	Line int
+
+	// Import is the imported package, in Module but not its root
+	Import string
+	Module string
+}
+
+func (v ModuleViolation) String() string {
+	return fmt.Sprintf("%s:%d: imports %s; only the %s module's public API, %s, may be imported",
+		v.File, v.Line, v.Import, v.Module, appModule+"/"+ModulesDir+"/"+v.Module)
+}
+
+// LintModules checks that the Go files under root import only the public
+// API packages of the modules under root/modules, their root packages,
+// and not the packages beside or below them. A module's own files may
+// import all of its packages. Violations are in file order.
+func LintModules(root string) ([]ModuleViolation, error) {
+	prefix := appModule + "/" + ModulesDir + "/"
+	var violations []ModuleViolation
+	fset := token.NewFileSet()
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && (strings.HasPrefix(d.Name(), ".") || d.Name() == "vendor" || d.Name() == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		owner := ""
+		if parts := strings.Split(filepath.ToSlash(rel), "/"); len(parts) > 2 && parts[0] == ModulesDir {
+			owner = parts[1]
+		}
+
+		file, err := parser.ParseFile(fset, path, nil, parser.ImportsOnly)
+		if err != nil {
+			return err
+		}
+		for _, spec := range file.Imports {
+			imported, err := strconv.Unquote(spec.Path.Value)
+			if err != nil || !strings.HasPrefix(imported, prefix) {
+				continue
+			}
+			module, rest, _ := strings.Cut(strings.TrimPrefix(imported, prefix), "/")
+			if rest == "" || module == owner {
+				continue
+			}
+			violations = append(violations, ModuleViolation{
+				File:   filepath.ToSlash(rel),
+				Line:   fset.Position(spec.Pos()).Line,
+				Import: imported,
+				Module: module,
+			})
+		}
+		return nil
+	})
+	return violations, err
+}
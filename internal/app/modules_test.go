@@ -0,0 +1,82 @@
+package app
+
+import (
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateAppModule(t *testing.T) {
+	t.Chdir(t.TempDir())
+	g := NewGenerator()
+	require.NoError(t, g.CreateAppModule("billing", "Invoice"))
+
+	for _, path := range []string{
+		"modules/billing/billing.go",
+		"modules/billing/provider.go",
+		"modules/billing/routes.go",
+		"modules/billing/internal/models/invoice.go",
+		"modules/billing/internal/repositories/invoice.go",
+		"modules/billing/internal/handlers/invoice.go",
+	} {
+		_, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.AllErrors)
+		assert.NoError(t, err, path)
+	}
+	handlers, err := os.ReadFile("modules/billing/internal/handlers/invoice.go")
+	require.NoError(t, err)
+	assert.Contains(t, string(handlers), "package handlers")
+	assert.Contains(t, string(handlers), `"github.com/mrhoseah/dolphin/modules/billing/internal/repositories"`)
+	migrations, err := filepath.Glob("modules/billing/migrations/*_invoice.go")
+	require.NoError(t, err)
+	assert.Len(t, migrations, 1)
+	provider, err := os.ReadFile("modules/billing/provider.go")
+	require.NoError(t, err)
+	assert.Contains(t, string(provider), `modules.Register(modules.Module{Name: "billing", Dir: "modules/billing"})`)
+	assert.FileExists(t, "modules/billing/views/index.html")
+
+	content := readWiring(t)
+	assert.Contains(t, content, `"github.com/mrhoseah/dolphin/modules/billing"`)
+	assert.Contains(t, content, "BillingModule: billing.New(a),")
+	assert.Contains(t, content, "c.BillingModule.Routes(r)")
+
+	assert.Error(t, g.CreateAppModule("billing", "Invoice"), "already exists")
+	assert.Error(t, g.CreateAppModule("Billing", "Invoice"), "names are lowercased")
+	assert.Error(t, g.CreateAppModule("billing-2", "Invoice"), "not a package name")
+
+	require.NoError(t, g.CreateAppModule("Shipping", "Rate"))
+	assert.FileExists(t, "modules/shipping/shipping.go")
+	assert.Contains(t, readWiring(t), "ShippingModule: shipping.New(a),")
+}
+
+func TestLintModules(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"modules/billing/billing.go":                 `package billing; import _ "github.com/mrhoseah/dolphin/modules/billing/internal/models"`,
+		"modules/shipping/shipping.go":               `package shipping; import _ "github.com/mrhoseah/dolphin/modules/billing"`,
+		"modules/shipping/internal/rates/rates.go":   "package rates\n\nimport (\n\t_ \"fmt\"\n\t_ \"github.com/mrhoseah/dolphin/modules/billing/migrations\"\n)\n",
+		"bootstrap/controllers.go":                   `package bootstrap; import _ "github.com/mrhoseah/dolphin/modules/shipping/internal/rates"`,
+		"vendor/github.com/x/y/y.go":                 `package y; import _ "github.com/mrhoseah/dolphin/modules/billing/internal/models"`,
+		"modules/billing/internal/models/invoice.go": "package models",
+	}
+	for path, content := range files {
+		path = filepath.Join(root, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	violations, err := LintModules(root)
+	require.NoError(t, err)
+	var found []string
+	for _, v := range violations {
+		found = append(found, v.String())
+	}
+	assert.Equal(t, []string{
+		"bootstrap/controllers.go:1: imports github.com/mrhoseah/dolphin/modules/shipping/internal/rates; only the shipping module's public API, github.com/mrhoseah/dolphin/modules/shipping, may be imported",
+		"modules/shipping/internal/rates/rates.go:5: imports github.com/mrhoseah/dolphin/modules/billing/migrations; only the billing module's public API, github.com/mrhoseah/dolphin/modules/billing, may be imported",
+	}, found)
+}
@@ -0,0 +1,39 @@
+package app
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/logger"
+	"go.uber.org/zap"
+)
+
+// ReloadLogLevelOnSIGHUP sets the log level from the config, read afresh,
+// each time the process gets SIGHUP until ctx ends
+func ReloadLogLevelOnSIGHUP(ctx context.Context, level zap.AtomicLevel, appLogger *zap.Logger) {
+	logger.ReloadLevelOnSignal(ctx, level, appLogger, func() (string, error) {
+		reloaded, err := config.Load()
+		if err != nil {
+			return "", err
+		}
+		return reloaded.Log.Level, nil
+	})
+}
+
+// Booted is what serve has to shut down once dependencies connected
+type Booted struct {
+	// Router flushes usage and traces as it closes
+	Router  interface{ Close(context.Context) error }
+	Metrics *http.Server
+}
+
+// Shutdown stops the metrics server and closes the router
+func (b Booted) Shutdown(ctx context.Context, logger *zap.Logger) {
+	if b.Metrics != nil {
+		_ = b.Metrics.Shutdown(ctx)
+	}
+	if err := b.Router.Close(ctx); err != nil {
+		logger.Error("Failed to flush usage and traces", zap.Error(err))
+	}
+}
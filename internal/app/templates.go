@@ -3,6 +3,8 @@ package app
 import (
 	"fmt"
 	"strings"
+
+	"github.com/mrhoseah/dolphin/internal/database"
 )
 
 // generateHTMXViewContent generates HTMX view templates
@@ -32,7 +34,7 @@ func (g *Generator) generateIndexView(name, lowerName, pluralName string) string
 <head>
     <meta charset="UTF-8">
     <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>%s - Dolphin Framework</title>
+    <title>%[1]s - Dolphin Framework</title>
     <script src="https://cdn.tailwindcss.com"></script>
     <script src="https://unpkg.com/htmx.org@1.9.10"></script>
 </head>
@@ -42,10 +44,10 @@ func (g *Generator) generateIndexView(name, lowerName, pluralName string) string
             <div class="max-w-7xl mx-auto px-4">
                 <div class="flex justify-between h-16">
                     <div class="flex items-center">
-                        <h1 class="text-xl font-semibold">🐬 %s Management</h1>
+                        <h1 class="text-xl font-semibold">🐬 %[1]s Management</h1>
                     </div>
                     <div class="flex items-center">
-                        <a href="/%s/create" class="bg-blue-500 text-white px-4 py-2 rounded hover:bg-blue-600">
+                        <a href="/%[3]s/create" class="bg-blue-500 text-white px-4 py-2 rounded hover:bg-blue-600">
                             Create New
                         </a>
                     </div>
@@ -53,31 +55,47 @@ func (g *Generator) generateIndexView(name, lowerName, pluralName string) string
             </div>
         </nav>
         
-        <div class="max-w-7xl mx-auto py-6 px-4">
-            <div id="%s-list" class="bg-white rounded-lg shadow">
+        <main class="max-w-7xl mx-auto py-6 px-4">
+            <div id="%[4]s-list" class="bg-white rounded-lg shadow">
                 <div class="p-6">
                     <table class="min-w-full divide-y divide-gray-200">
+                        <caption class="sr-only">%[1]s list</caption>
                         <thead class="bg-gray-50">
                             <tr>
-                                <th class="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">ID</th>
-                                <th class="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">Name</th>
-                                <th class="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">Created</th>
-                                <th class="px-6 py-3 text-right text-xs font-medium text-gray-500 uppercase tracking-wider">Actions</th>
+                                <th scope="col" class="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">ID</th>
+                                <th scope="col" class="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">Created</th>
+                                <th scope="col" class="px-6 py-3 text-right text-xs font-medium text-gray-500 uppercase tracking-wider">Actions</th>
                             </tr>
                         </thead>
-                        <tbody class="bg-white divide-y divide-gray-200">
-                            <!-- HTMX will load data here -->
-                            <tr hx-get="/api/%s" hx-trigger="load" hx-swap="outerHTML">
-                                <td colspan="4" class="px-6 py-4 text-center text-gray-500">Loading...</td>
+                        <!-- Refreshed in place when a response triggers %[4]s-changed;
+                             the controller renders only the rows fragment for htmx:
+                             views.RenderHTMX(w, r, "%[4]s/index", "rows", data) -->
+                        <tbody id="%[4]s-rows" class="bg-white divide-y divide-gray-200"
+                               hx-get="/%[3]s" hx-trigger="%[4]s-changed from:body">
+                            {{block "rows" .}}
+                            {{range .Items}}
+                            <tr id="%[4]s-{{.ID}}">
+                                <td class="px-6 py-4 text-sm text-gray-900">{{.ID}}</td>
+                                <td class="px-6 py-4 text-sm text-gray-500">{{.CreatedAt.Format "2006-01-02"}}</td>
+                                <td class="px-6 py-4 text-right text-sm">
+                                    <!-- The hidden text tells screen reader users which row each link is for -->
+                                    <a href="/%[3]s/{{.ID}}" class="text-blue-600 hover:text-blue-900">View<span class="sr-only"> %[1]s {{.ID}}</span></a>
+                                </td>
+                            </tr>
+                            {{else}}
+                            <tr>
+                                <td colspan="3" class="px-6 py-4 text-center text-gray-500">No %[3]s yet</td>
                             </tr>
+                            {{end}}
+                            {{end}}
                         </tbody>
                     </table>
                 </div>
             </div>
-        </div>
+        </main>
     </div>
 </body>
-</html>`, name, name, pluralName, lowerName, pluralName)
+</html>`, name, name, pluralName, lowerName)
 }
 
 func (g *Generator) generateShowView(name, lowerName string) string {
@@ -86,7 +104,7 @@ func (g *Generator) generateShowView(name, lowerName string) string {
 <head>
     <meta charset="UTF-8">
     <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>View %s - Dolphin Framework</title>
+    <title>View %[1]s - Dolphin Framework</title>
     <script src="https://cdn.tailwindcss.com"></script>
     <script src="https://unpkg.com/htmx.org@1.9.10"></script>
 </head>
@@ -96,45 +114,48 @@ func (g *Generator) generateShowView(name, lowerName string) string {
             <div class="max-w-7xl mx-auto px-4">
                 <div class="flex justify-between h-16">
                     <div class="flex items-center">
-                        <h1 class="text-xl font-semibold">🐬 View %s</h1>
+                        <h1 class="text-xl font-semibold">🐬 View %[1]s</h1>
                     </div>
                     <div class="flex items-center space-x-4">
-                        <a href="/%s" class="text-gray-600 hover:text-gray-900">Back to List</a>
+                        <a href="/%[2]s" class="text-gray-600 hover:text-gray-900">Back to List</a>
                     </div>
                 </div>
             </div>
         </nav>
         
-        <div class="max-w-7xl mx-auto py-6 px-4">
-            <div id="%s-detail" class="bg-white rounded-lg shadow p-6">
+        <main class="max-w-7xl mx-auto py-6 px-4">
+            <div id="%[2]s-detail" class="bg-white rounded-lg shadow p-6" tabindex="-1">
                 <div class="space-y-4">
-                    <div>
-                        <label class="block text-sm font-medium text-gray-700">ID</label>
-                        <p class="mt-1 text-sm text-gray-900">1</p>
-                    </div>
-                    <div>
-                        <label class="block text-sm font-medium text-gray-700">Name</label>
-                        <p class="mt-1 text-sm text-gray-900">Sample %s</p>
-                    </div>
-                    <div>
-                        <label class="block text-sm font-medium text-gray-700">Created At</label>
-                        <p class="mt-1 text-sm text-gray-900">2024-01-01</p>
-                    </div>
+                    <dl class="space-y-4">
+                        <div>
+                            <dt class="block text-sm font-medium text-gray-700">ID</dt>
+                            <dd class="mt-1 text-sm text-gray-900">1</dd>
+                        </div>
+                        <div>
+                            <dt class="block text-sm font-medium text-gray-700">Name</dt>
+                            <dd class="mt-1 text-sm text-gray-900">Sample %[1]s</dd>
+                        </div>
+                        <div>
+                            <dt class="block text-sm font-medium text-gray-700">Created At</dt>
+                            <dd class="mt-1 text-sm text-gray-900">2024-01-01</dd>
+                        </div>
+                    </dl>
                     <div class="flex space-x-4">
-                        <a href="/%s/edit" class="bg-blue-500 text-white px-4 py-2 rounded hover:bg-blue-600">Edit</a>
-                        <button hx-delete="/api/%s/{id}" 
+                        <a href="/%[2]s/edit" class="bg-blue-500 text-white px-4 py-2 rounded hover:bg-blue-600">Edit</a>
+                        <button hx-delete="/api/%[2]s/{id}" 
                                 hx-confirm="Are you sure you want to delete this?"
-                                hx-target="#%s-detail"
+                                hx-target="#%[2]s-detail"
                                 class="bg-red-500 text-white px-4 py-2 rounded hover:bg-red-600">
                             Delete
                         </button>
                     </div>
                 </div>
             </div>
-        </div>
+        </main>
     </div>
+    %[3]s
 </body>
-</html>`, name, name, lowerName, lowerName, name, lowerName, lowerName, lowerName)
+</html>`, name, lowerName, formFocusScript)
 }
 
 func (g *Generator) generateCreateView(name, lowerName string) string {
@@ -143,7 +164,7 @@ func (g *Generator) generateCreateView(name, lowerName string) string {
 <head>
     <meta charset="UTF-8">
     <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>Create %s - Dolphin Framework</title>
+    <title>Create %[1]s - Dolphin Framework</title>
     <script src="https://cdn.tailwindcss.com"></script>
     <script src="https://unpkg.com/htmx.org@1.9.10"></script>
 </head>
@@ -153,43 +174,35 @@ func (g *Generator) generateCreateView(name, lowerName string) string {
             <div class="max-w-7xl mx-auto px-4">
                 <div class="flex justify-between h-16">
                     <div class="flex items-center">
-                        <h1 class="text-xl font-semibold">🐬 Create %s</h1>
+                        <h1 class="text-xl font-semibold">🐬 Create %[1]s</h1>
                     </div>
                     <div class="flex items-center">
-                        <a href="/%s" class="text-gray-600 hover:text-gray-900">Back to List</a>
+                        <a href="/%[2]s" class="text-gray-600 hover:text-gray-900">Back to List</a>
                     </div>
                 </div>
             </div>
         </nav>
         
-        <div class="max-w-7xl mx-auto py-6 px-4">
+        <main class="max-w-7xl mx-auto py-6 px-4">
             <div class="bg-white rounded-lg shadow p-6">
-                <form hx-post="/api/%s" hx-target="#result" class="space-y-4">
-                    <div>
-                        <label class="block text-sm font-medium text-gray-700">Name</label>
-                        <input type="text" name="name" required 
-                               class="mt-1 block w-full px-3 py-2 border border-gray-300 rounded-md shadow-sm focus:outline-none focus:ring-blue-500 focus:border-blue-500">
-                    </div>
-                    <div>
-                        <label class="block text-sm font-medium text-gray-700">Description</label>
-                        <textarea name="description" rows="4"
-                                  class="mt-1 block w-full px-3 py-2 border border-gray-300 rounded-md shadow-sm focus:outline-none focus:ring-blue-500 focus:border-blue-500"></textarea>
-                    </div>
+                <form hx-post="/api/%[2]s" hx-target="#result" class="space-y-4">
+                    %[3]s
                     <div class="flex space-x-4">
                         <button type="submit" class="bg-blue-500 text-white px-4 py-2 rounded hover:bg-blue-600">
                             Create
                         </button>
-                        <a href="/%s" class="bg-gray-500 text-white px-4 py-2 rounded hover:bg-gray-600">
+                        <a href="/%[2]s" class="bg-gray-500 text-white px-4 py-2 rounded hover:bg-gray-600">
                             Cancel
                         </a>
                     </div>
                 </form>
-                <div id="result" class="mt-4"></div>
+                <div id="result" class="mt-4" role="status" aria-live="polite" tabindex="-1"></div>
             </div>
-        </div>
+        </main>
     </div>
+    %[4]s
 </body>
-</html>`, name, name, lowerName, lowerName, lowerName)
+</html>`, name, lowerName, indentMarkup(formFields, "                    "), formFocusScript)
 }
 
 func (g *Generator) generateEditView(name, lowerName string) string {
@@ -198,7 +211,7 @@ func (g *Generator) generateEditView(name, lowerName string) string {
 <head>
     <meta charset="UTF-8">
     <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>Edit %s - Dolphin Framework</title>
+    <title>Edit %[1]s - Dolphin Framework</title>
     <script src="https://cdn.tailwindcss.com"></script>
     <script src="https://unpkg.com/htmx.org@1.9.10"></script>
 </head>
@@ -208,285 +221,1220 @@ func (g *Generator) generateEditView(name, lowerName string) string {
             <div class="max-w-7xl mx-auto px-4">
                 <div class="flex justify-between h-16">
                     <div class="flex items-center">
-                        <h1 class="text-xl font-semibold">🐬 Edit %s</h1>
+                        <h1 class="text-xl font-semibold">🐬 Edit %[1]s</h1>
                     </div>
                     <div class="flex items-center">
-                        <a href="/%s" class="text-gray-600 hover:text-gray-900">Back to List</a>
+                        <a href="/%[2]s" class="text-gray-600 hover:text-gray-900">Back to List</a>
                     </div>
                 </div>
             </div>
         </nav>
         
-        <div class="max-w-7xl mx-auto py-6 px-4">
+        <main class="max-w-7xl mx-auto py-6 px-4">
             <div class="bg-white rounded-lg shadow p-6">
-                <form hx-put="/api/%s/{id}" hx-target="#result" class="space-y-4">
-                    <div>
-                        <label class="block text-sm font-medium text-gray-700">Name</label>
-                        <input type="text" name="name" required 
-                               class="mt-1 block w-full px-3 py-2 border border-gray-300 rounded-md shadow-sm focus:outline-none focus:ring-blue-500 focus:border-blue-500">
-                    </div>
-                    <div>
-                        <label class="block text-sm font-medium text-gray-700">Description</label>
-                        <textarea name="description" rows="4"
-                                  class="mt-1 block w-full px-3 py-2 border border-gray-300 rounded-md shadow-sm focus:outline-none focus:ring-blue-500 focus:border-blue-500"></textarea>
-                    </div>
+                <form hx-put="/api/%[2]s/{id}" hx-target="#result" class="space-y-4">
+                    %[3]s
                     <div class="flex space-x-4">
                         <button type="submit" class="bg-blue-500 text-white px-4 py-2 rounded hover:bg-blue-600">
                             Update
                         </button>
-                        <a href="/%s" class="bg-gray-500 text-white px-4 py-2 rounded hover:bg-gray-600">
+                        <a href="/%[2]s" class="bg-gray-500 text-white px-4 py-2 rounded hover:bg-gray-600">
                             Cancel
                         </a>
                     </div>
                 </form>
-                <div id="result" class="mt-4"></div>
+                <div id="result" class="mt-4" role="status" aria-live="polite" tabindex="-1"></div>
             </div>
-        </div>
+        </main>
     </div>
+    %[4]s
 </body>
-</html>`, name, name, lowerName, lowerName, lowerName)
+</html>`, name, lowerName, indentMarkup(formFields, "                    "), formFocusScript)
 }
 
 func (g *Generator) generateFormPartial(name, lowerName string) string {
-	return fmt.Sprintf(`<div class="space-y-4">
-    <div>
-        <label class="block text-sm font-medium text-gray-700">Name</label>
-        <input type="text" name="name" required 
-               class="mt-1 block w-full px-3 py-2 border border-gray-300 rounded-md shadow-sm focus:outline-none focus:ring-blue-500 focus:border-blue-500">
-    </div>
-    <div>
-        <label class="block text-sm font-medium text-gray-700">Description</label>
-        <textarea name="description" rows="4"
-                  class="mt-1 block w-full px-3 py-2 border border-gray-300 rounded-md shadow-sm focus:outline-none focus:ring-blue-500 focus:border-blue-500"></textarea>
-    </div>
-</div>`)
+	return `<div class="space-y-4">
+    ` + indentMarkup(formFields, "    ") + `
+</div>`
 }
 
-// generateRepositoryContent generates repository template
-func (g *Generator) generateRepositoryContent(name string) string {
+// formFields are the fields of the scaffolded forms. Each is named by its
+// label, and described by the message of its error in .Errors, which a
+// page re-rendered after a failed submission fills in and marks invalid.
+const formFields = `<div>
+    <label for="name" class="block text-sm font-medium text-gray-700">Name</label>
+    <input type="text" id="name" name="name" required aria-describedby="name-error"{{with .Errors}}{{if .name}} aria-invalid="true"{{end}}{{end}}
+           class="mt-1 block w-full px-3 py-2 border border-gray-300 rounded-md shadow-sm focus:outline-none focus:ring-blue-500 focus:border-blue-500 aria-[invalid=true]:border-red-500">
+    <p id="name-error" class="mt-1 text-sm text-red-600">{{with .Errors}}{{.name}}{{end}}</p>
+</div>
+<div>
+    <label for="description" class="block text-sm font-medium text-gray-700">Description</label>
+    <textarea id="description" name="description" rows="4" aria-describedby="description-error"{{with .Errors}}{{if .description}} aria-invalid="true"{{end}}{{end}}
+              class="mt-1 block w-full px-3 py-2 border border-gray-300 rounded-md shadow-sm focus:outline-none focus:ring-blue-500 focus:border-blue-500 aria-[invalid=true]:border-red-500"></textarea>
+    <p id="description-error" class="mt-1 text-sm text-red-600">{{with .Errors}}{{.description}}{{end}}</p>
+</div>`
+
+// formFocusScript manages focus around htmx requests in the scaffolded
+// pages: a 422 problem's errors are shown next to their fields, which are
+// marked invalid, and focus moves to the first of them; otherwise focus
+// moves to the content swapped in, so keyboard and screen reader users
+// aren't left on a replaced element.
+const formFocusScript = `<script>
+        document.body.addEventListener('htmx:afterRequest', function (event) {
+            var form = event.detail.elt.closest('form');
+            if (!form) return;
+            form.querySelectorAll('[aria-invalid]').forEach(function (field) {
+                field.removeAttribute('aria-invalid');
+                var error = document.getElementById(field.id + '-error');
+                if (error) error.textContent = '';
+            });
+            if (event.detail.xhr.status !== 422) return;
+            var problem = {};
+            try { problem = JSON.parse(event.detail.xhr.responseText); } catch (e) {}
+            var first = null;
+            Object.keys(problem.errors || {}).forEach(function (name) {
+                var field = form.querySelector('[name="' + name + '"]');
+                if (!field) return;
+                field.setAttribute('aria-invalid', 'true');
+                var error = document.getElementById(field.id + '-error');
+                if (error) error.textContent = problem.errors[name];
+                first = first || field;
+            });
+            if (first) first.focus();
+        });
+        document.body.addEventListener('htmx:afterSwap', function (event) {
+            var target = event.detail.target;
+            if (!target.hasAttribute('tabindex')) target.setAttribute('tabindex', '-1');
+            target.focus();
+        });
+    </script>`
+
+// indentMarkup indents every line of markup but the first, which goes
+// where the placeholder it replaces is already indented
+func indentMarkup(markup, prefix string) string {
+	return strings.ReplaceAll(markup, "\n", "\n"+prefix)
+}
+
+// generateRepositoryContent generates a repository embedding
+// orm.Repository, which provides CRUD, pagination, scopes, soft deletes and
+// transactions, with a parent scope as requested
+func (g *Generator) generateRepositoryContent(name string, opts ResourceOptions) string {
 	lowerName := strings.ToLower(name)
+	scope := ""
+	if parent := opts.Parent; parent != "" {
+		scope = fmt.Sprintf(`
+// For%[1]s scopes the repository to %[3]ss belonging to a %[2]s
+func (r *%[4]sRepository) For%[1]s(%[2]sID uint) *%[4]sRepository {
+    return &%[4]sRepository{Repository: r.Scopes(func(db *gorm.DB) *gorm.DB {
+        return db.Where("%[5]s_id = ?", %[2]sID)
+    })}
+}
+`, parent, strings.ToLower(parent), lowerName, name, toSnakeCase(parent))
+	}
 	return fmt.Sprintf(`package repositories
 
 import (
     "github.com/mrhoseah/dolphin/app/models"
+    "github.com/mrhoseah/dolphin/internal/orm"
     "gorm.io/gorm"
 )
 
-// %[1]sRepository handles data access for %[2]s
+// %[1]sRepository handles data access for %[2]s. orm.Repository provides
+// CRUD, pagination, scopes, soft deletes and transactions; add custom
+// queries here, running them on r.DB(ctx).
 type %[1]sRepository struct {
-    db *gorm.DB
+    *orm.Repository[models.%[1]s]
 }
 
 // New%[1]sRepository creates a new %[1]s repository
 func New%[1]sRepository(db *gorm.DB) *%[1]sRepository {
-    return &%[1]sRepository{db: db}
+    return &%[1]sRepository{Repository: orm.NewRepository(db, models.%[1]s{})}
 }
-
-func (r *%[1]sRepository) FindAll() ([]models.%[1]s, error) {
-    var items []models.%[1]s
-    err := r.db.Find(&items).Error
-    return items, err
-}
-
-func (r *%[1]sRepository) FindByID(id uint) (*models.%[1]s, error) {
-    var item models.%[1]s
-    if err := r.db.First(&item, id).Error; err != nil {
-        return nil, err
-    }
-    return &item, nil
-}
-
-func (r *%[1]sRepository) Create(item *models.%[1]s) error { return r.db.Create(item).Error }
-func (r *%[1]sRepository) Update(item *models.%[1]s) error { return r.db.Save(item).Error }
-func (r *%[1]sRepository) Delete(id uint) error { return r.db.Delete(&models.%[1]s{}, id).Error }
-
-func (r *%[1]sRepository) Count() (int64, error) {
-    var count int64
-    err := r.db.Model(&models.%[1]s{}).Count(&count).Error
-    return count, err
-}
-
-func (r *%[1]sRepository) Paginate(page, pageSize int) ([]models.%[1]s, int64, error) {
-    var items []models.%[1]s
-    var total int64
-    offset := (page - 1) * pageSize
-    if err := r.db.Model(&models.%[1]s{}).Count(&total).Error; err != nil {
-        return nil, 0, err
-    }
-    err := r.db.Offset(offset).Limit(pageSize).Find(&items).Error
-    return items, total, err
-}
-`, name, lowerName)
+%[3]s`, name, lowerName, scope)
 }
 
 // generateAPIControllerContent generates API controller template
-func (g *Generator) generateAPIControllerContent(name string) string {
+func (g *Generator) generateAPIControllerContent(name string, opts ResourceOptions) string {
 	lowerName := strings.ToLower(name)
 	pluralName := lowerName + "s"
-	return fmt.Sprintf(`package api
+	index := g.generateAPIIndexContent(opts)
+	template := `package api
 
 import (
 	"net/http"
-	"strconv"
 
-	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/render"
 	"github.com/mrhoseah/dolphin/app/models"
 	"github.com/mrhoseah/dolphin/app/repositories"
-	"gorm.io/gorm"
+	"github.com/mrhoseah/dolphin/internal/dolphin"
+	"github.com/mrhoseah/dolphin/internal/problem"
+	"github.com/mrhoseah/dolphin/internal/query"
+	"github.com/mrhoseah/dolphin/internal/resources"
 )
 
 // %[1]sController handles API requests for %[2]s
-type %[1]sController struct { repo *repositories.%[1]sRepository }
-
-// New%[1]sController creates a new %[1]s API controller
-func New%[1]sController(db *gorm.DB) *%[1]sController {
-    return &%[1]sController{ repo: repositories.New%[1]sRepository(db) }
+type %[1]sController struct {
+	repo  *repositories.%[1]sRepository
+	query query.Config
 }
 
-// Index handles GET /api/%[3]s
-// @Summary List all %[3]s
-// @Description Get a list of all %[3]s
-// @Tags %[1]s
-// @Accept json
-// @Produce json
-// @Success 200 {array} models.%[1]s
-// @Router /api/%[3]s [get]
-func (c *%[1]sController) Index(w http.ResponseWriter, r *http.Request) {
-	items, err := c.repo.FindAll()
-	if err != nil {
-		render.Status(r, http.StatusInternalServerError)
-        render.JSON(w, r, map[string]string{"error": "Failed to retrieve %[2]s"})
-		return
+// New%[1]sController creates a new %[1]s API controller over repo
+func New%[1]sController(repo *repositories.%[1]sRepository) *%[1]sController {
+	return &%[1]sController{
+		repo: repo,
+		// Allowlist of query string capabilities for the Index endpoint
+		query: query.Config{
+			Resource:    "%[3]s",
+			Filterable:  map[string]string{"id": ""},
+			Sortable:    map[string]string{"id": "", "created_at": "", "updated_at": ""},
+			Fields:      []string{"id", "created_at", "updated_at"},
+			DefaultSort: "-created_at",
+		},
 	}
-	render.JSON(w, r, items)
 }
 
-// Show handles GET /api/%[3]s/{id}
+{{index}}
+// Show handles GET /api/{{memberPath}}
 // @Summary Get %[2]s by ID
 // @Description Get a single %[2]s by ID
 // @Tags %[1]s
 // @Accept json
 // @Produce json
-// @Param id path int true "%[2]s ID"
+{{memberParamDoc}}// @Param id path int true "%[2]s ID"
 // @Success 200 {object} models.%[1]s
-// @Failure 404 {object} map[string]string
-// @Router /api/%[3]s/{id} [get]
-func (c *%[1]sController) Show(w http.ResponseWriter, r *http.Request) {
-	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+// @Failure 404 {object} problem.Problem
+// @Router /api/{{memberPath}} [get]
+func (c *%[1]sController) Show(ctx *dolphin.Context) error {
+{{memberScope}}	id, err := ctx.ParamUint("id")
 	if err != nil {
-		render.Status(r, http.StatusBadRequest)
-		render.JSON(w, r, map[string]string{"error": "Invalid ID"})
-		return
+		return err
 	}
 
-    item, err := c.repo.FindByID(uint(id))
+	item, err := {{memberRepo}}.Find(ctx.Context(), id)
 	if err != nil {
-		render.Status(r, http.StatusNotFound)
-        render.JSON(w, r, map[string]string{"error": "%[2]s not found"})
-		return
+		return problem.RecordNotFound(err, "%[2]s", id)
 	}
 
-	render.JSON(w, r, item)
+	return ctx.Respond(http.StatusOK, item)
 }
 
-// Store handles POST /api/%[3]s
+// Store handles POST /api/{{collectionPath}}
 // @Summary Create %[2]s
 // @Description Create a new %[2]s
 // @Tags %[1]s
 // @Accept json
 // @Produce json
-// @Param %[2]s body models.%[1]s true "%[2]s data"
+{{collectionParamDoc}}// @Param %[2]s body models.%[1]s true "%[2]s data"
 // @Success 201 {object} models.%[1]s
-// @Failure 400 {object} map[string]string
-// @Router /api/%[3]s [post]
-func (c *%[1]sController) Store(w http.ResponseWriter, r *http.Request) {
-    var item models.%[1]s
-	if err := render.DecodeJSON(r.Body, &item); err != nil {
-		render.Status(r, http.StatusBadRequest)
-		render.JSON(w, r, map[string]string{"error": "Invalid request body"})
-		return
+// @Failure 400 {object} problem.Problem
+// @Router /api/{{collectionPath}} [post]
+func (c *%[1]sController) Store(ctx *dolphin.Context) error {
+{{collectionScope}}	var item models.%[1]s
+	if err := ctx.Bind(&item); err != nil {
+		return err
 	}
 
-    if err := c.repo.Create(&item); err != nil {
-		render.Status(r, http.StatusInternalServerError)
-        render.JSON(w, r, map[string]string{"error": "Failed to create %[2]s"})
-		return
+{{assignParent}}	if err := {{collectionRepo}}.Create(ctx.Context(), &item); err != nil {
+		return err
 	}
 
-	render.Status(r, http.StatusCreated)
-	render.JSON(w, r, item)
+	return ctx.Respond(http.StatusCreated, item)
 }
 
-// Update handles PUT /api/%[3]s/{id}
+// Update handles PUT /api/{{memberPath}}
 // @Summary Update %[2]s
 // @Description Update an existing %[2]s
 // @Tags %[1]s
 // @Accept json
 // @Produce json
-// @Param id path int true "%[2]s ID"
+{{memberParamDoc}}// @Param id path int true "%[2]s ID"
 // @Param %[2]s body models.%[1]s true "%[2]s data"
 // @Success 200 {object} models.%[1]s
-// @Failure 400 {object} map[string]string
-// @Failure 404 {object} map[string]string
-// @Router /api/%[3]s/{id} [put]
-func (c *%[1]sController) Update(w http.ResponseWriter, r *http.Request) {
-	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+// @Failure 400 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /api/{{memberPath}} [put]
+func (c *%[1]sController) Update(ctx *dolphin.Context) error {
+{{memberScope}}	id, err := ctx.ParamUint("id")
 	if err != nil {
-		render.Status(r, http.StatusBadRequest)
-		render.JSON(w, r, map[string]string{"error": "Invalid ID"})
-		return
+		return err
 	}
 
-    item, err := c.repo.FindByID(uint(id))
+	item, err := {{memberRepo}}.Find(ctx.Context(), id)
 	if err != nil {
-		render.Status(r, http.StatusNotFound)
-        render.JSON(w, r, map[string]string{"error": "%[2]s not found"})
-		return
+		return problem.RecordNotFound(err, "%[2]s", id)
 	}
 
-	if err := render.DecodeJSON(r.Body, item); err != nil {
-		render.Status(r, http.StatusBadRequest)
-		render.JSON(w, r, map[string]string{"error": "Invalid request body"})
-		return
+	if err := ctx.Bind(item); err != nil {
+		return err
 	}
 
-    if err := c.repo.Update(item); err != nil {
-		render.Status(r, http.StatusInternalServerError)
-        render.JSON(w, r, map[string]string{"error": "Failed to update %[2]s"})
-		return
+	if err := {{memberRepo}}.Update(ctx.Context(), item); err != nil {
+		return err
 	}
 
-	render.JSON(w, r, item)
+	return ctx.Respond(http.StatusOK, item)
 }
 
-// Destroy handles DELETE /api/%[3]s/{id}
+// Destroy handles DELETE /api/{{memberPath}}
 // @Summary Delete %[2]s
 // @Description Delete a %[2]s by ID
 // @Tags %[1]s
 // @Accept json
 // @Produce json
-// @Param id path int true "%[2]s ID"
+{{memberParamDoc}}// @Param id path int true "%[2]s ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} problem.Problem
+// @Router /api/{{memberPath}} [delete]
+func (c *%[1]sController) Destroy(ctx *dolphin.Context) error {
+{{memberScope}}	id, err := ctx.ParamUint("id")
+	if err != nil {
+		return err
+	}
+
+	if err := {{memberRepo}}.Delete(ctx.Context(), id); err != nil {
+		return err
+	}
+
+	return ctx.Respond(http.StatusOK, map[string]string{"message": "%[2]s deleted successfully"})
+}
+{{softDeletes}}{{parentHelper}}`
+	if opts.Export {
+		index += g.generateAPIExportContent()
+		template = strings.Replace(template, "\t\"github.com/mrhoseah/dolphin/internal/problem\"\n",
+			"\t\"github.com/mrhoseah/dolphin/internal/export\"\n\t\"github.com/mrhoseah/dolphin/internal/problem\"\n", 1)
+	}
+	template = strings.Replace(template, "{{index}}", index, 1)
+	template = strings.Replace(template, "{{softDeletes}}", g.generateAPISoftDeleteContent(opts), 1)
+	template = g.applyResourceScope(template, name, opts)
+	return fmt.Sprintf(template, name, lowerName, pluralName)
+}
+
+// generateAPIExportContent generates the Export action, streaming the
+// filtered collection as a CSV or XLSX download
+func (g *Generator) generateAPIExportContent() string {
+	return `
+// Export handles GET /api/{{collectionPath}}/export
+// @Summary Export %[3]s
+// @Description Download the filtered %[3]s as CSV, or as XLSX with format=xlsx
+// @Tags %[1]s
+// @Produce text/csv
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+{{collectionParamDoc}}// @Param format query string false "csv or xlsx"
+// @Param fields[%[3]s] query string false "Columns to export"
+// @Success 200 {file} file
+// @Failure 400 {object} problem.Problem
+// @Router /api/{{collectionPath}}/export [get]
+func (c *%[1]sController) Export(ctx *dolphin.Context) error {
+{{indexScope}}	params, err := query.Parse(ctx.Request.URL.Query(), c.query)
+	if err != nil {
+		return err
+	}
+
+	// Rows are read 1000 at a time as the file streams; Respond writes
+	// its own failures, so its error isn't returned
+	columns := export.Select(export.Columns[models.%[1]s](), params.SelectedFields()...)
+	filtered := {{collectionRepo}}.Scopes(params.ApplyFilters)
+	export.Respond(ctx.Writer, ctx.Request, "%[3]s", columns, export.Chunks(1000, func(size int, fn func([]models.%[1]s) error) error {
+		return filtered.Chunk(ctx.Context(), size, fn)
+	}))
+	return nil
+}
+`
+}
+
+// generateAPISoftDeleteContent generates the Restore and ForceDelete actions
+func (g *Generator) generateAPISoftDeleteContent(opts ResourceOptions) string {
+	if !opts.SoftDeletes {
+		return ""
+	}
+	return `
+// Restore handles POST /api/{{memberPath}}/restore
+// @Summary Restore %[2]s
+// @Description Restore a soft-deleted %[2]s
+// @Tags %[1]s
+// @Accept json
+// @Produce json
+{{memberParamDoc}}// @Param id path int true "%[2]s ID"
+// @Success 200 {object} models.%[1]s
+// @Failure 404 {object} problem.Problem
+// @Router /api/{{memberPath}}/restore [post]
+func (c *%[1]sController) Restore(ctx *dolphin.Context) error {
+{{memberScope}}	id, err := ctx.ParamUint("id")
+	if err != nil {
+		return err
+	}
+
+	item, err := {{memberRepo}}.Restore(ctx.Context(), id)
+	if err != nil {
+		return problem.RecordNotFound(err, "deleted %[2]s", id)
+	}
+
+	return ctx.Respond(http.StatusOK, item)
+}
+
+// ForceDelete handles DELETE /api/{{memberPath}}/force
+// @Summary Permanently delete %[2]s
+// @Description Permanently delete a %[2]s, bypassing soft deletes
+// @Tags %[1]s
+// @Accept json
+// @Produce json
+{{memberParamDoc}}// @Param id path int true "%[2]s ID"
 // @Success 200 {object} map[string]string
-// @Failure 404 {object} map[string]string
-// @Router /api/%[3]s/{id} [delete]
-func (c *%[1]sController) Destroy(w http.ResponseWriter, r *http.Request) {
-	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+// @Failure 404 {object} problem.Problem
+// @Router /api/{{memberPath}}/force [delete]
+func (c *%[1]sController) ForceDelete(ctx *dolphin.Context) error {
+{{memberScope}}	id, err := ctx.ParamUint("id")
+	if err != nil {
+		return err
+	}
+
+	if err := {{memberRepo}}.ForceDelete(ctx.Context(), id); err != nil {
+		return problem.RecordNotFound(err, "%[2]s", id)
+	}
+
+	return ctx.Respond(http.StatusOK, map[string]string{"message": "%[2]s permanently deleted"})
+}
+`
+}
+
+// applyResourceScope fills the route and repository scoping placeholders of
+// the API controller template for flat, nested, and shallow nested resources
+func (g *Generator) applyResourceScope(template, name string, opts ResourceOptions) string {
+	lowerName := strings.ToLower(name)
+	pluralName := lowerName + "s"
+
+	replacements := map[string]string{
+		"{{collectionPath}}":     pluralName,
+		"{{memberPath}}":         pluralName + "/{id}",
+		"{{collectionRepo}}":     "c.repo",
+		"{{memberRepo}}":         "c.repo",
+		"{{collectionScope}}":    "",
+		"{{indexScope}}":         "",
+		"{{memberScope}}":        "",
+		"{{collectionParamDoc}}": "",
+		"{{memberParamDoc}}":     "",
+		"{{assignParent}}":       "",
+		"{{parentHelper}}":       "",
+	}
+
+	if opts.Parent != "" {
+		parentLower := strings.ToLower(opts.Parent)
+		parentPath := fmt.Sprintf("%ss/{%s}/%s", parentLower, parentLower, pluralName)
+		scope := "\trepo, parentID, err := c.parent(ctx)\n\tif err != nil {\n\t\treturn err\n\t}\n\n"
+		paramDoc := fmt.Sprintf("// @Param %[1]s path int true \"%[1]s ID\"\n", parentLower)
+
+		replacements["{{collectionPath}}"] = parentPath
+		replacements["{{collectionRepo}}"] = "repo"
+		replacements["{{collectionScope}}"] = scope
+		replacements["{{indexScope}}"] = strings.Replace(scope, "parentID", "_", 1)
+		replacements["{{collectionParamDoc}}"] = paramDoc
+		replacements["{{assignParent}}"] = fmt.Sprintf("\titem.%sID = parentID\n\n", opts.Parent)
+		replacements["{{parentHelper}}"] = fmt.Sprintf(`
+// parent scopes the repository to the %[2]s named in the route
+func (c *%%[1]sController) parent(ctx *dolphin.Context) (*repositories.%%[1]sRepository, uint, error) {
+	parentID, err := ctx.ParamUint("%[2]s")
 	if err != nil {
-		render.Status(r, http.StatusBadRequest)
-		render.JSON(w, r, map[string]string{"error": "Invalid ID"})
+		return nil, 0, err
+	}
+	return c.repo.For%[1]s(parentID), parentID, nil
+}
+`, opts.Parent, parentLower)
+
+		// Shallow routes address members directly: /comments/{id}
+		if !opts.Shallow {
+			replacements["{{memberPath}}"] = parentPath + "/{id}"
+			replacements["{{memberRepo}}"] = "repo"
+			replacements["{{memberScope}}"] = strings.Replace(scope, "parentID", "_", 1)
+			replacements["{{memberParamDoc}}"] = paramDoc
+		}
+	}
+
+	for placeholder, value := range replacements {
+		template = strings.ReplaceAll(template, placeholder, value)
+	}
+	return template
+}
+
+// generateAPIIndexContent generates the Index action, offset or cursor paginated
+func (g *Generator) generateAPIIndexContent(opts ResourceOptions) string {
+	if opts.Cursor {
+		return `// Index handles GET /api/{{collectionPath}}
+// @Summary List all %[3]s
+// @Description Get a filtered, cursor paginated list of %[3]s
+// @Tags %[1]s
+// @Accept json
+// @Produce json
+{{collectionParamDoc}}// @Param sort query string false "Cursor column, prefix with - for descending"
+// @Param page[after] query string false "Cursor to continue forwards from"
+// @Param page[before] query string false "Cursor to continue backwards from"
+// @Param page[size] query int false "Page size"
+// @Success 200 {array} models.%[1]s
+// @Failure 400 {object} problem.Problem
+// @Router /api/{{collectionPath}} [get]
+func (c *%[1]sController) Index(ctx *dolphin.Context) error {
+{{indexScope}}	params, err := query.Parse(ctx.Request.URL.Query(), c.query)
+	if err != nil {
+		return err
+	}
+
+	page, err := {{collectionRepo}}.CursorList(ctx.Context(), params)
+	if err != nil {
+		return err
+	}
+	return ctx.Respond(http.StatusOK, map[string]interface{}{
+		"data": page.Data,
+		"meta": resources.CursorMeta{PerPage: page.Limit, NextCursor: page.NextCursor, PrevCursor: page.PrevCursor},
+	})
+}
+`
+	}
+
+	return `// Index handles GET /api/{{collectionPath}}
+// @Summary List all %[3]s
+// @Description Get a filtered, sorted and paginated list of %[3]s
+// @Tags %[1]s
+// @Accept json
+// @Produce json
+{{collectionParamDoc}}// @Param sort query string false "Sort fields, prefix with - for descending"
+// @Param page[number] query int false "Page number"
+// @Param page[size] query int false "Page size"
+// @Success 200 {array} models.%[1]s
+// @Failure 400 {object} problem.Problem
+// @Router /api/{{collectionPath}} [get]
+func (c *%[1]sController) Index(ctx *dolphin.Context) error {
+{{indexScope}}	params, err := query.Parse(ctx.Request.URL.Query(), c.query)
+	if err != nil {
+		return err
+	}
+
+	items, total, err := {{collectionRepo}}.List(ctx.Context(), params)
+	if err != nil {
+		return err
+	}
+	return ctx.Respond(http.StatusOK, map[string]interface{}{
+		"data": items,
+		"meta": resources.NewPageMeta(params.Page, params.PageSize, total, len(items)),
+	})
+}
+`
+}
+
+// generateResourceRoutesContent generates the chi route registration for a resource
+func (g *Generator) generateResourceRoutesContent(name string, opts ResourceOptions) string {
+	lowerName := strings.ToLower(name)
+	pluralName := lowerName + "s"
+
+	var routes string
+	switch {
+	case opts.Parent == "":
+		routes = fmt.Sprintf(`	r.Route("/%[1]s", func(r chi.Router) {
+		r.Get("/", dolphin.Handler(c.Index))
+{{exportRoute}}		r.Post("/", dolphin.Handler(c.Store))
+		r.Get("/{id}", dolphin.Handler(c.Show))
+		r.Put("/{id}", dolphin.Handler(c.Update))
+		r.Delete("/{id}", dolphin.Handler(c.Destroy))
+{{softDeleteRoutes}}	})
+`, pluralName)
+	case opts.Shallow:
+		parentLower := strings.ToLower(opts.Parent)
+		routes = fmt.Sprintf(`	// Collection routes are nested under the parent
+	r.Route("/%[1]ss/{%[1]s}/%[2]s", func(r chi.Router) {
+		r.Get("/", dolphin.Handler(c.Index))
+{{exportRoute}}		r.Post("/", dolphin.Handler(c.Store))
+	})
+
+	// Member routes are shallow since the ID is already unique
+	r.Route("/%[2]s", func(r chi.Router) {
+		r.Get("/{id}", dolphin.Handler(c.Show))
+		r.Put("/{id}", dolphin.Handler(c.Update))
+		r.Delete("/{id}", dolphin.Handler(c.Destroy))
+{{softDeleteRoutes}}	})
+`, parentLower, pluralName)
+	default:
+		parentLower := strings.ToLower(opts.Parent)
+		routes = fmt.Sprintf(`	r.Route("/%[1]ss/{%[1]s}/%[2]s", func(r chi.Router) {
+		r.Get("/", dolphin.Handler(c.Index))
+{{exportRoute}}		r.Post("/", dolphin.Handler(c.Store))
+		r.Get("/{id}", dolphin.Handler(c.Show))
+		r.Put("/{id}", dolphin.Handler(c.Update))
+		r.Delete("/{id}", dolphin.Handler(c.Destroy))
+{{softDeleteRoutes}}	})
+`, parentLower, pluralName)
+	}
+
+	exportRoute := ""
+	if opts.Export {
+		exportRoute = "\t\tr.Get(\"/export\", dolphin.Handler(c.Export))\n"
+	}
+	routes = strings.Replace(routes, "{{exportRoute}}", exportRoute, 1)
+
+	softDeleteRoutes := ""
+	if opts.SoftDeletes {
+		softDeleteRoutes = "\t\tr.Post(\"/{id}/restore\", dolphin.Handler(c.Restore))\n\t\tr.Delete(\"/{id}/force\", dolphin.Handler(c.ForceDelete))\n"
+	}
+	routes = strings.Replace(routes, "{{softDeleteRoutes}}", softDeleteRoutes, 1)
+	routes = strings.ReplaceAll(routes, "func(r chi.Router)", "func(r *routing.Router)")
+
+	return fmt.Sprintf(`package routes
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/mrhoseah/dolphin/app/http/controllers/api"
+	"github.com/mrhoseah/dolphin/internal/dolphin"
+	"github.com/mrhoseah/dolphin/internal/routing"
+)
+
+// Register%[1]sRoutes registers the %[2]s API routes on c, in the api
+// middleware group
+func Register%[1]sRoutes(r chi.Router, c *api.%[1]sController) {
+	routing.Wrap(r).Group("api", func(r *routing.Router) {
+%[3]s	})
+}
+`, name, lowerName, indent(routes))
+}
+
+// indent indents every non-blank line of code by a tab
+func indent(code string) string {
+	lines := strings.Split(code, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = "\t" + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// generateUploadControllerContent generates a controller accepting and
+// deleting uploads, images by default
+func (g *Generator) generateUploadControllerContent(name string) string {
+	lowerName := strings.ToLower(name)
+	return fmt.Sprintf(`package controllers
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"path"
+
+	"github.com/mrhoseah/dolphin/internal/dolphin"
+	"github.com/mrhoseah/dolphin/internal/media"
+	"github.com/mrhoseah/dolphin/internal/problem"
+)
+
+// %[2]sDir is where %[2]ss are stored on the uploader's disk
+const %[2]sDir = "%[3]s"
+
+// %[2]sRules limit the %[2]ss accepted. Types are checked against the
+// content, not the file name.
+var %[2]sRules = media.Rules{
+	MaxBytes: 5 << 20,
+	Types:    media.ImageTypes,
+}
+
+// %[2]sVariants are made of each %[2]s image after the upload is answered
+var %[2]sVariants = []media.Variant{
+	{Name: "thumb", Width: 200, Height: 200, Fit: media.Cover},
+}
+
+// %[1]sUpload handles %[2]s uploads
+type %[1]sUpload struct {
+	uploader *media.Uploader
+}
+
+// New%[1]sUpload creates a new %[1]sUpload controller storing files with
+// uploader
+func New%[1]sUpload(uploader *media.Uploader) *%[1]sUpload {
+	return &%[1]sUpload{uploader: uploader}
+}
+
+// Store handles POST /%[3]s, a multipart form sending the file as "file"
+func (c *%[1]sUpload) Store(ctx *dolphin.Context) error {
+	file, err := ctx.File("file", %[2]sRules)
+	if err != nil {
+		return err
+	}
+
+	stored, err := c.uploader.Store(file, %[2]sDir, %[2]sVariants...)
+	if err != nil {
+		return err
+	}
+
+	ctx.Writer.Header().Set("Location", stored.URL)
+	return ctx.Respond(http.StatusCreated, stored)
+}
+
+// Destroy handles DELETE /%[3]s/{file}
+func (c *%[1]sUpload) Destroy(ctx *dolphin.Context) error {
+	name := ctx.Param("file")
+	if name == "" || name != path.Base(name) || name[0] == '.' {
+		return problem.NotFound("%[2]s", name)
+	}
+
+	err := c.uploader.Delete(path.Join(%[2]sDir, name), %[2]sVariants...)
+	if errors.Is(err, fs.ErrNotExist) {
+		return problem.NotFound("%[2]s", name)
+	}
+	if err != nil {
+		return err
+	}
+
+	return ctx.NoContent()
+}
+`, name, lowerName, lowerName+"s")
+}
+
+// generateUploadRoutesContent generates the route registration for an
+// upload controller
+func (g *Generator) generateUploadRoutesContent(name string) string {
+	return fmt.Sprintf(`package routes
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/mrhoseah/dolphin/app/http/controllers"
+	"github.com/mrhoseah/dolphin/internal/dolphin"
+	"github.com/mrhoseah/dolphin/internal/routing"
+)
+
+// Register%[1]sUploadRoutes registers the %[2]s upload routes on c, in the
+// api middleware group
+func Register%[1]sUploadRoutes(r chi.Router, c *controllers.%[1]sUpload) {
+	routing.Wrap(r).Group("api", func(r *routing.Router) {
+		r.Post("/%[2]ss", dolphin.Handler(c.Store))
+		r.Delete("/%[2]ss/{file}", dolphin.Handler(c.Destroy))
+	})
+}
+`, name, strings.ToLower(name))
+}
+
+// generateResumableUploadControllerContent generates a controller taking
+// uploads in chunks over a tus endpoint of its own, videos by default
+func (g *Generator) generateResumableUploadControllerContent(name string) string {
+	lowerName := strings.ToLower(name)
+	return fmt.Sprintf(`package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"slices"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/problem"
+	"github.com/mrhoseah/dolphin/internal/resources"
+	"github.com/mrhoseah/dolphin/internal/storage"
+)
+
+// %[2]sUploadPath is where the %[2]s tus endpoint is served, from the
+// routes' mount point
+const %[2]sUploadPath = "/%[3]s/uploads"
+
+// %[2]sTypes are the file types accepted, as the client reports them
+// before sending any chunk. Check the stored file's content before
+// trusting it.
+var %[2]sTypes = []string{"video/mp4", "video/webm", "video/quicktime"}
+
+// %[1]sUpload takes %[2]s uploads in chunks, so a dropped connection
+// resumes where it stopped rather than starting over
+type %[1]sUpload struct {
+	tus    *storage.TusServer
+	logger *zap.Logger
+}
+
+// New%[1]sUpload creates a new %[1]sUpload controller. Chunks are kept
+// under tus.dir and completed %[2]ss stored under "%[3]s" on the tus disk;
+// incomplete ones are removed tus.expiry after their last chunk.
+func New%[1]sUpload(cfg *config.Config, logger *zap.Logger) *%[1]sUpload {
+	tusConfig := cfg.Tus
+	tusConfig.Path = %[2]sUploadPath
+	tusConfig.Dir = filepath.Join(cfg.Tus.Dir, "%[3]s")
+	tusConfig.Prefix = "%[3]s"
+
+	disk, err := storage.TusDisk(cfg)
+	if err != nil {
+		logger.Fatal("Invalid tus disk", zap.Error(err))
+	}
+	server, err := storage.NewTusServer(disk, tusConfig, logger)
+	if err != nil {
+		logger.Fatal("Failed to create the %[2]s upload server", zap.Error(err))
+	}
+
+	c := &%[1]sUpload{tus: server, logger: logger}
+	server.OnCreate(c.accept)
+	server.OnComplete(c.uploaded)
+	server.Start(cfg.Tus.CleanupInterval)
+	return c
+}
+
+// accept decides whether an upload may start, before any chunk is sent
+func (c *%[1]sUpload) accept(r *http.Request, u *storage.Upload) error {
+	if !slices.Contains(%[2]sTypes, u.Metadata["filetype"]) {
+		return errors.New("only MP4, WebM and QuickTime videos are accepted")
+	}
+	return nil
+}
+
+// uploaded is called once every chunk has arrived and the %[2]s is stored,
+// e.g. to queue transcoding
+func (c *%[1]sUpload) uploaded(ctx context.Context, u *storage.Upload) error {
+	c.logger.Info("%[1]s uploaded",
+		zap.String("id", u.ID),
+		zap.String("path", u.Path),
+		zap.String("filename", u.Metadata["filename"]),
+		zap.Int64("size", u.Size))
+	return nil
+}
+
+// Uploads serves the tus endpoint chunks are sent to, and the JavaScript
+// client at client.js
+func (c *%[1]sUpload) Uploads(r chi.Router) {
+	c.tus.Routes(r)
+}
+
+// Create handles GET /%[3]s/upload, the HTMX upload page
+func (c *%[1]sUpload) Create(w http.ResponseWriter, r *http.Request) {
+	http.ServeFile(w, r, "resources/views/%[2]s/upload.html")
+}
+
+// Progress handles GET /%[3]s/progress/{id}, reporting how much of an
+// upload has arrived, e.g. for another tab or device to poll
+func (c *%[1]sUpload) Progress(w http.ResponseWriter, r *http.Request) {
+	upload, err := c.tus.Get(chi.URLParam(r, "id"))
+	if err != nil {
+		problem.Write(w, r, problem.NotFound("upload", chi.URLParam(r, "id")))
 		return
 	}
+	resources.Respond(w, r, map[string]interface{}{
+		"id":         upload.ID,
+		"offset":     upload.Offset,
+		"size":       upload.Size,
+		"progress":   upload.Progress(),
+		"complete":   upload.Complete(),
+		"expires_at": upload.ExpiresAt,
+	})
+}
 
-    if err := c.repo.Delete(uint(id)); err != nil {
-		render.Status(r, http.StatusInternalServerError)
-        render.JSON(w, r, map[string]string{"error": "Failed to delete %[2]s"})
+// Store handles POST /%[3]s/upload, the form submitted once the upload is
+// complete, with its URL in the "%[2]s" field
+func (c *%[1]sUpload) Store(w http.ResponseWriter, r *http.Request) {
+	upload, err := c.tus.Get(r.FormValue("%[2]s"))
+	if err != nil {
+		problem.Write(w, r, problem.New(http.StatusUnprocessableEntity, "Choose a %[2]s to upload"))
+		return
+	}
+	if !upload.Complete() {
+		problem.Write(w, r, problem.New(http.StatusUnprocessableEntity, "The %[2]s is still uploading"))
 		return
 	}
 
-    render.JSON(w, r, map[string]string{"message": "%[2]s deleted successfully"})
+	render.Status(r, http.StatusCreated)
+	resources.Respond(w, r, upload)
+}
+`, name, lowerName, lowerName+"s")
+}
+
+// generateResumableUploadRoutesContent generates the route registration
+// for a resumable upload controller
+func (g *Generator) generateResumableUploadRoutesContent(name string) string {
+	return fmt.Sprintf(`package routes
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/mrhoseah/dolphin/app/http/controllers"
+	"github.com/mrhoseah/dolphin/internal/routing"
+)
+
+// Register%[1]sUploadRoutes registers the %[2]s upload routes on c, in the
+// web middleware group since its page posts the upload form
+func Register%[1]sUploadRoutes(r chi.Router, c *controllers.%[1]sUpload) {
+	routing.Wrap(r).Group("web", func(r *routing.Router) {
+		r.Router.Route("/%[2]ss/uploads", c.Uploads)
+		r.Get("/%[2]ss/upload", c.Create)
+		r.Post("/%[2]ss/upload", c.Store)
+		r.Get("/%[2]ss/progress/{id}", c.Progress)
+	})
+}
+`, name, strings.ToLower(name))
+}
+
+// generateResumableUploadView generates the HTMX page uploading a file in
+// chunks as soon as it is picked, with a progress bar
+func (g *Generator) generateResumableUploadView(name string) string {
+	lowerName := strings.ToLower(name)
+	return fmt.Sprintf(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Upload %[1]s - Dolphin Framework</title>
+    <script src="https://cdn.tailwindcss.com"></script>
+    <script src="https://unpkg.com/htmx.org@1.9.10"></script>
+    <script src="uploads/client.js" defer></script>
+</head>
+<body class="bg-gray-100">
+    <div class="min-h-screen">
+        <nav class="bg-white shadow">
+            <div class="max-w-7xl mx-auto px-4">
+                <div class="flex items-center h-16">
+                    <h1 class="text-xl font-semibold">🐬 Upload %[1]s</h1>
+                </div>
+            </div>
+        </nav>
+
+        <div class="max-w-7xl mx-auto py-6 px-4">
+            <div class="bg-white rounded-lg shadow p-6">
+                <!-- The file is sent in chunks as soon as it is picked; a
+                     dropped connection resumes where it stopped, even after
+                     reloading the page and picking the same file -->
+                <form hx-post="upload" hx-target="#result" class="space-y-4">
+                    <div>
+                        <label for="%[2]s-file" class="block text-sm font-medium text-gray-700">%[1]s</label>
+                        <input type="file" id="%[2]s-file" accept="video/*" aria-describedby="%[2]s-status"
+                               data-tus-upload="uploads" data-tus-target="%[2]s" data-tus-progress="%[2]s-progress"
+                               class="mt-1 block w-full text-sm text-gray-700">
+                        <input type="hidden" name="%[2]s">
+                        <progress id="%[2]s-progress" value="0" max="1" aria-label="%[1]s upload progress" class="mt-2 w-full"></progress>
+                        <p id="%[2]s-status" class="mt-1 text-sm text-gray-500" role="status" aria-live="polite"></p>
+                    </div>
+                    <button type="submit" id="%[2]s-submit" disabled
+                            class="bg-blue-500 text-white px-4 py-2 rounded hover:bg-blue-600 disabled:opacity-50">
+                        Save
+                    </button>
+                </form>
+                <div id="result" class="mt-4" role="status" aria-live="polite" tabindex="-1"></div>
+            </div>
+        </div>
+    </div>
+    <script>
+        document.addEventListener('tus:progress', function (e) {
+            var percent = Math.floor(e.detail.sent / e.detail.total * 100);
+            document.getElementById('%[2]s-status').textContent = percent + '%% uploaded';
+        });
+        document.addEventListener('tus:success', function () {
+            document.getElementById('%[2]s-status').textContent = 'Uploaded';
+            document.getElementById('%[2]s-submit').disabled = false;
+        });
+        document.addEventListener('tus:error', function (e) {
+            document.getElementById('%[2]s-status').textContent = 'Upload failed: ' + e.detail.error.message + '. Pick the file again to resume.';
+        });
+    </script>
+</body>
+</html>`, name, lowerName)
+}
+
+// toCamelCase converts a snake_case name such as add_user_indexes to an
+// exported Go identifier
+func toCamelCase(name string) string {
+	var b strings.Builder
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool { return r == '_' || r == '-' || r == ' ' }) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+// toSnakeCase converts a Go identifier to the snake_case column name GORM uses
+func toSnakeCase(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if r >= 'A' && r <= 'Z' {
+			if i > 0 {
+				prev := rune(name[i-1])
+				next := rune(0)
+				if i+1 < len(name) {
+					next = rune(name[i+1])
+				}
+				if (prev >= 'a' && prev <= 'z') || (prev >= '0' && prev <= '9') || (next >= 'a' && next <= 'z' && prev >= 'A' && prev <= 'Z') {
+					b.WriteByte('_')
+				}
+			}
+			b.WriteRune(r + ('a' - 'A'))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// generateResourceTransformerContent generates an API resource transformer template
+func (g *Generator) generateResourceTransformerContent(name string) string {
+	lowerName := strings.ToLower(name)
+	return fmt.Sprintf(`package resources
+
+import (
+	"context"
+
+	"github.com/mrhoseah/dolphin/app/models"
+	"github.com/mrhoseah/dolphin/internal/resources"
+)
+
+// %[1]sResource controls how a %[2]s is serialized in API responses
+type %[1]sResource struct {
+	model *models.%[1]s
+}
+
+// New%[1]sResource wraps a %[2]s model
+func New%[1]sResource(model *models.%[1]s) resources.Resource {
+	return &%[1]sResource{model: model}
+}
+
+// %[1]sCollection wraps a slice of %[2]s models
+func %[1]sCollection(items []models.%[1]s) []resources.Resource {
+	result := make([]resources.Resource, 0, len(items))
+	for i := range items {
+		result = append(result, New%[1]sResource(&items[i]))
+	}
+	return result
+}
+
+// ToMap returns the serialized fields for the %[2]s
+func (r *%[1]sResource) ToMap(ctx context.Context) map[string]interface{} {
+	return map[string]interface{}{
+		"id":         r.model.ID,
+		"created_at": r.model.CreatedAt,
+		"updated_at": r.model.UpdatedAt,
+
+		// Conditional fields are dropped when the condition is false
+		"deleted_at": resources.When(r.model.DeletedAt.Valid, r.model.DeletedAt.Time),
+
+		// Relations are only serialized when requested via ?include=
+		// "posts": resources.WhenIncluded(ctx, "posts", func(ctx context.Context) interface{} {
+		// 	return resources.CollectionOf(ctx, r.model.Posts, func(p models.Post) resources.Resource {
+		// 		return NewPostResource(&p)
+		// 	})
+		// }),
+	}
+}
+`, name, lowerName)
+}
+
+// generateRequestContent generates a request DTO template
+func (g *Generator) generateRequestContent(name string) string {
+	return fmt.Sprintf(`package requests
+
+import (
+	"net/http"
+
+	"github.com/mrhoseah/dolphin/internal/binding"
+)
+
+// %[1]s is populated from the route, query string, headers, and body.
+// Use source:"path=id,query=id" to list sources in precedence order;
+// fields without a source tag default to path, then query, then body.
+type %[1]s struct {
+	ID        uint   `+"`json:\"id\" source:\"path=id\"`"+`
+	Name      string `+"`json:\"name\" source:\"body\" validate:\"required|max_length:255\"`"+`
+	RequestID string `+"`json:\"-\" source:\"header=X-Request-ID\"`"+`
+}
+
+// Bind%[1]s binds and validates a %[1]s from the request
+func Bind%[1]s(r *http.Request) (*%[1]s, error) {
+	var req %[1]s
+	if err := binding.BindAndValidate(r, &req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+`, name)
+}
+
+// generateStepMigrationContent generates a migration running fixed
+// SchemaBuilder steps
+func (g *Generator) generateStepMigrationContent(name string, up, down []database.SchemaStep) string {
+	typeName := toCamelCase(name)
+	steps := func(stmts []database.SchemaStep) string {
+		var b strings.Builder
+		for _, stmt := range stmts {
+			b.WriteString("\tif err := " + stmt.String() + "; err != nil {\n\t\treturn err\n\t}\n")
+		}
+		return b.String()
+	}
+
+	return fmt.Sprintf(`package migrations
+
+import (
+	"fmt"
+
+	"github.com/mrhoseah/dolphin/internal/database"
+	raptor "github.com/mrhoseah/raptor/core"
+)
+
+func init() {
+	database.RegisterMigration(&%[1]s{})
+}
+
+// %[1]s represents the %[2]s migration
+type %[1]s struct{}
+
+// Name returns the migration name
+func (m *%[1]s) Name() string {
+	return %[2]q
+}
+
+// Up runs the migration
+func (m *%[1]s) Up(s raptor.Schema) error {
+	b, ok := s.(database.SchemaBuilder)
+	if !ok {
+		return fmt.Errorf("%[2]s: schema %%T does not support ALTER operations", s)
+	}
+%[3]s	return nil
+}
+
+// Down rolls back the migration
+func (m *%[1]s) Down(s raptor.Schema) error {
+	b, ok := s.(database.SchemaBuilder)
+	if !ok {
+		return fmt.Errorf("%[2]s: schema %%T does not support ALTER operations", s)
+	}
+%[4]s	return nil
+}
+`, typeName, strings.ToLower(name), steps(up), steps(down))
+}
+
+// generateTenantContent generates a tenant registration
+func (g *Generator) generateTenantContent(id string) string {
+	return fmt.Sprintf(`package tenants
+
+import "github.com/mrhoseah/dolphin/internal/tenancy"
+
+func init() {
+	tenancy.Register(&tenancy.Tenant{
+		ID: %[1]q,
+		// Database and Schema default to tenancy.pattern, e.g. "tenant_%[2]s"
+		// Database: "tenant_%[2]s",
+		// Schema:   "tenant_%[2]s",
+	})
+}
+`, id, strings.ReplaceAll(id, "-", "_"))
+}
+
+// generateObserverContent generates an observer of a model registered
+// with the observers package
+func (g *Generator) generateObserverContent(model string) string {
+	return fmt.Sprintf(`package observers
+
+import (
+	"context"
+
+	"github.com/mrhoseah/dolphin/app/models"
+	dolphinObservers "github.com/mrhoseah/dolphin/internal/observers"
+)
+
+func init() {
+	dolphinObservers.Register[models.%[1]s](%[1]sObserver{})
+}
+
+// %[1]sObserver reacts to %[2]ss being written. Each method runs after
+// its write commits; errors are logged. Remove the methods you don't need.
+type %[1]sObserver struct{}
+
+// Created runs after a %[2]s is inserted
+func (%[1]sObserver) Created(ctx context.Context, model *models.%[1]s) error {
+	return nil
+}
+
+// Updated runs after a %[2]s is updated
+func (%[1]sObserver) Updated(ctx context.Context, model *models.%[1]s) error {
+	return nil
+}
+
+// Deleted runs after a %[2]s is deleted
+func (%[1]sObserver) Deleted(ctx context.Context, model *models.%[1]s) error {
+	return nil
+}
+
+// Restored runs after a soft-deleted %[2]s is restored
+func (%[1]sObserver) Restored(ctx context.Context, model *models.%[1]s) error {
+	return nil
+}
+`, model, strings.ReplaceAll(toSnakeCase(model), "_", " "))
+}
+
+// generatePaymentHandlerContent generates a payment provider registered
+// with the payments package
+func (g *Generator) generatePaymentHandlerContent(name string) string {
+	return fmt.Sprintf(`package gateways
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mrhoseah/dolphin/internal/payments"
+)
+
+// Settings come from payments.providers.%[2]s in config/config.yaml:
+//
+//	payments:
+//	  providers:
+//	    %[2]s:
+//	      api_key: ...
+//	      webhook_secret: ...
+func init() {
+	payments.Register(%[2]q, New%[1]s)
+}
+
+// %[1]s charges through the %[1]s API
+type %[1]s struct {
+	apiKey        string
+	webhookSecret string
+	client        *http.Client
+}
+
+// New%[1]s creates the provider from its settings
+func New%[1]s(settings map[string]string) (payments.Provider, error) {
+	if settings["api_key"] == "" {
+		return nil, errors.New("%[2]s: api_key is required")
+	}
+	return &%[1]s{
+		apiKey:        settings["api_key"],
+		webhookSecret: settings["webhook_secret"],
+		client:        &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (p *%[1]s) Name() string {
+	return %[2]q
+}
+
+// Charge creates a charge of req.Amount, in minor units of req.Currency.
+// Send req.IdempotencyKey along when the API takes one, return a
+// *payments.ProviderError for errors it answers with, and a pending charge
+// with a RedirectURL when the customer must approve the payment elsewhere.
+func (p *%[1]s) Charge(ctx context.Context, req payments.ChargeRequest) (*payments.Charge, error) {
+	// TODO: call the %[1]s API
+	return nil, fmt.Errorf("%[2]s: charges are not implemented")
+}
+
+// Refund returns req.Amount of a charge, or all of it when zero
+func (p *%[1]s) Refund(ctx context.Context, req payments.RefundRequest) (*payments.Refund, error) {
+	// TODO: call the %[1]s API
+	return nil, fmt.Errorf("%[2]s: refunds are not implemented")
+}
+
+// Webhook verifies a notification and maps it to an event, or returns nil
+// for notifications the application doesn't need
+func (p *%[1]s) Webhook(r *http.Request, body []byte) (*payments.Event, error) {
+	// TODO: check the signature the way %[1]s signs its webhooks
+	mac := hmac.New(sha256.New, []byte(p.webhookSecret))
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	if p.webhookSecret == "" || !hmac.Equal([]byte(expected), []byte(r.Header.Get("X-Signature"))) {
+		return nil, payments.ErrInvalidSignature
+	}
+
+	// TODO: decode body into an event, e.g.
+	// return &payments.Event{ID: ..., Type: payments.EventChargeSucceeded, ChargeID: ..., Amount: ...}, nil
+	return nil, nil
 }
-`, name, lowerName, pluralName)
+`, name, toSnakeCase(name))
 }
 
 // generateProviderContent generates service provider template
@@ -0,0 +1,37 @@
+package app
+
+import (
+	"html/template"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	views "github.com/mrhoseah/dolphin/internal/template"
+)
+
+func TestScaffoldedViewsAreAccessible(t *testing.T) {
+	g := NewGenerator()
+	pages := map[string]string{"upload": g.generateResumableUploadView("Video")}
+	for _, viewType := range []string{"index", "show", "create", "edit", "form"} {
+		pages[viewType] = g.generateHTMXViewContent("Post", viewType)
+	}
+	for name, content := range pages {
+		assert.Empty(t, views.LintAccessibility(content), name)
+		_, err := template.New(name).Parse(content)
+		assert.NoError(t, err, name)
+	}
+
+	// Failed fields are marked invalid and described by their message
+	form := template.Must(template.New("form").Parse(pages["form"]))
+	var out strings.Builder
+	require.NoError(t, form.Execute(&out, map[string]interface{}{"Errors": map[string]string{"name": "is required"}}))
+	assert.Contains(t, out.String(), `aria-describedby="name-error" aria-invalid="true"`)
+	assert.Contains(t, out.String(), `<p id="name-error" class="mt-1 text-sm text-red-600">is required</p>`)
+	assert.NotContains(t, out.String(), `aria-describedby="description-error" aria-invalid`)
+
+	out.Reset()
+	require.NoError(t, form.Execute(&out, nil))
+	assert.NotContains(t, out.String(), "aria-invalid")
+}
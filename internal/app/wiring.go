@@ -0,0 +1,200 @@
+package app
+
+import (
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WiringFile is where generated controllers are constructed, each handed its
+// repositories rather than reaching for a global database handle
+const WiringFile = "bootstrap/controllers.go"
+
+// appModule is the import path generated code lives under
+const appModule = "github.com/mrhoseah/dolphin"
+
+const wiringTemplate = `// Package bootstrap builds the application's controllers. make:controller,
+// make:module, make:resource, make:upload and module:create keep the
+// dolphin: blocks up to date; code outside them is yours to change.
+package bootstrap
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/mrhoseah/dolphin/internal/app"
+	"gorm.io/gorm"
+
+	// dolphin:imports
+	// dolphin:end
+)
+
+// Repositories holds one repository per model, shared by the controllers
+type Repositories struct {
+	// dolphin:repositories
+	// dolphin:end
+}
+
+// NewRepositories builds every repository over db
+func NewRepositories(db *gorm.DB) *Repositories {
+	return &Repositories{
+		// dolphin:new-repositories
+		// dolphin:end
+	}
+}
+
+// Controllers holds every controller, built once at startup
+type Controllers struct {
+	Repositories *Repositories
+
+	// dolphin:controllers
+	// dolphin:end
+}
+
+// NewControllers builds the controllers from the application container
+func NewControllers(a *app.App) *Controllers {
+	repos := NewRepositories(a.DB().GetDB())
+	return &Controllers{
+		Repositories: repos,
+
+		// dolphin:new-controllers
+		// dolphin:end
+	}
+}
+
+// Routes registers the generated API routes
+func (c *Controllers) Routes(r chi.Router) {
+	// dolphin:routes
+	// dolphin:end
+}
+`
+
+// wiringEntry is a line to keep in one of the wiring file's blocks. An
+// existing line starting with key is replaced, so regenerating a controller
+// updates its constructor call instead of duplicating it.
+type wiringEntry struct {
+	block string
+	key   string
+	line  string
+}
+
+// wireController adds a controller from app/http/controllers, and with
+// withRepo its model's repository, to the wiring file
+func (g *Generator) wireController(name string, withRepo bool) error {
+	entries := []wiringEntry{
+		{"imports", `"` + appModule + `/app/http/controllers"`, `"` + appModule + `/app/http/controllers"`},
+		{"controllers", name + " ", fmt.Sprintf("%[1]s *controllers.%[1]s", name)},
+		{"new-controllers", name + ":", fmt.Sprintf("%[1]s: controllers.New%[1]s(),", name)},
+	}
+	if withRepo {
+		entries[2].line = fmt.Sprintf("%[1]s: controllers.New%[1]s(repos.%[1]s),", name)
+		entries = append(entries, repositoryEntries(name)...)
+	}
+	return g.wire(entries)
+}
+
+// wireAPIController adds an API controller, its repository and its routes
+// to the wiring file
+func (g *Generator) wireAPIController(name string) error {
+	field := name + "API"
+	entries := []wiringEntry{
+		{"imports", `"` + appModule + `/app/http/controllers/api"`, `"` + appModule + `/app/http/controllers/api"`},
+		{"imports", `"` + appModule + `/app/http/routes"`, `"` + appModule + `/app/http/routes"`},
+		{"controllers", field + " ", fmt.Sprintf("%s *api.%sController", field, name)},
+		{"new-controllers", field + ":", fmt.Sprintf("%s: api.New%sController(repos.%s),", field, name, name)},
+		{"routes", fmt.Sprintf("routes.Register%sRoutes(", name), fmt.Sprintf("routes.Register%sRoutes(r, c.%s)", name, field)},
+	}
+	return g.wire(append(entries, repositoryEntries(name)...))
+}
+
+// wireUpload adds an upload controller, storing files with the default
+// uploader, and its routes to the wiring file
+func (g *Generator) wireUpload(name string) error {
+	field := name + "Upload"
+	return g.wire([]wiringEntry{
+		{"imports", `"` + appModule + `/app/http/controllers"`, `"` + appModule + `/app/http/controllers"`},
+		{"imports", `"` + appModule + `/app/http/routes"`, `"` + appModule + `/app/http/routes"`},
+		{"imports", `"` + appModule + `/internal/media"`, `"` + appModule + `/internal/media"`},
+		{"controllers", field + " ", fmt.Sprintf("%[1]s *controllers.%[1]s", field)},
+		{"new-controllers", field + ":", fmt.Sprintf("%[1]s: controllers.New%[1]s(media.Default),", field)},
+		{"routes", fmt.Sprintf("routes.Register%sRoutes(", field), fmt.Sprintf("routes.Register%[1]sRoutes(r, c.%[1]s)", field)},
+	})
+}
+
+// wireResumableUpload adds a resumable upload controller, configured from
+// the application's tus settings, and its routes to the wiring file
+func (g *Generator) wireResumableUpload(name string) error {
+	field := name + "Upload"
+	return g.wire([]wiringEntry{
+		{"imports", `"` + appModule + `/app/http/controllers"`, `"` + appModule + `/app/http/controllers"`},
+		{"imports", `"` + appModule + `/app/http/routes"`, `"` + appModule + `/app/http/routes"`},
+		{"controllers", field + " ", fmt.Sprintf("%[1]s *controllers.%[1]s", field)},
+		{"new-controllers", field + ":", fmt.Sprintf("%[1]s: controllers.New%[1]s(a.Config(), a.Logger()),", field)},
+		{"routes", fmt.Sprintf("routes.Register%sRoutes(", field), fmt.Sprintf("routes.Register%[1]sRoutes(r, c.%[1]s)", field)},
+	})
+}
+
+func repositoryEntries(name string) []wiringEntry {
+	return []wiringEntry{
+		{"imports", `"` + appModule + `/app/repositories"`, `"` + appModule + `/app/repositories"`},
+		{"repositories", name + " ", fmt.Sprintf("%[1]s *repositories.%[1]sRepository", name)},
+		{"new-repositories", name + ":", fmt.Sprintf("%[1]s: repositories.New%[1]sRepository(db),", name)},
+	}
+}
+
+// wire creates the wiring file if needed and merges entries into its blocks
+func (g *Generator) wire(entries []wiringEntry) error {
+	content, err := os.ReadFile(WiringFile)
+	if os.IsNotExist(err) {
+		content, err = []byte(wiringTemplate), nil
+	}
+	if err != nil {
+		return err
+	}
+
+	lines := strings.Split(string(content), "\n")
+	for _, entry := range entries {
+		if lines, err = addWiring(lines, entry); err != nil {
+			return err
+		}
+	}
+
+	formatted, err := format.Source([]byte(strings.Join(lines, "\n")))
+	if err != nil {
+		return fmt.Errorf("%s: %w", WiringFile, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(WiringFile), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(WiringFile, formatted, 0644)
+}
+
+// addWiring replaces the block's line starting with the entry's key, or
+// appends the entry's line at the end of the block
+func addWiring(lines []string, entry wiringEntry) ([]string, error) {
+	start, end := -1, -1
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if start < 0 && trimmed == "// dolphin:"+entry.block {
+			start = i
+		} else if start >= 0 && trimmed == "// dolphin:end" {
+			end = i
+			break
+		}
+	}
+	if start < 0 || end < 0 {
+		return nil, fmt.Errorf("%s has no // dolphin:%s block; add %q by hand", WiringFile, entry.block, entry.line)
+	}
+
+	indent := lines[start][:len(lines[start])-len(strings.TrimLeft(lines[start], "\t "))]
+	for i := start + 1; i < end; i++ {
+		if strings.HasPrefix(strings.TrimSpace(lines[i]), entry.key) {
+			lines[i] = indent + entry.line
+			return lines, nil
+		}
+	}
+
+	wired := append([]string{}, lines[:end]...)
+	wired = append(wired, indent+entry.line)
+	return append(wired, lines[end:]...), nil
+}
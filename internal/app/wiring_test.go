@@ -0,0 +1,128 @@
+package app
+
+import (
+	"go/parser"
+	"go/token"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readWiring(t *testing.T) string {
+	t.Helper()
+	content, err := os.ReadFile(WiringFile)
+	require.NoError(t, err)
+	return string(content)
+}
+
+func TestWireCreatesAndUpdatesWiringFile(t *testing.T) {
+	t.Chdir(t.TempDir())
+	g := NewGenerator()
+
+	require.NoError(t, g.wireController("Home", false))
+	require.NoError(t, g.wireAPIController("Post"))
+	content := readWiring(t)
+
+	assert.Contains(t, content, "Home    *controllers.Home")
+	assert.Contains(t, content, "Home:    controllers.NewHome(),")
+	assert.Contains(t, content, "PostAPI: api.NewPostController(repos.Post),")
+	assert.Contains(t, content, "Post: repositories.NewPostRepository(db),")
+	assert.Contains(t, content, "routes.RegisterPostRoutes(r, c.PostAPI)")
+
+	// Wiring again is a no-op, and a module replaces the plain controller
+	require.NoError(t, g.wireAPIController("Post"))
+	require.NoError(t, g.wireController("Home", true))
+	content = readWiring(t)
+
+	assert.Equal(t, 1, strings.Count(content, "routes.RegisterPostRoutes"))
+	assert.Equal(t, 1, strings.Count(content, `"github.com/mrhoseah/dolphin/app/repositories"`))
+	assert.Contains(t, content, "controllers.NewHome(repos.Home),")
+	assert.NotContains(t, content, "controllers.NewHome(),")
+}
+
+func TestWireUpload(t *testing.T) {
+	t.Chdir(t.TempDir())
+	require.NoError(t, NewGenerator().wireUpload("Avatar"))
+	content := readWiring(t)
+
+	assert.Contains(t, content, `"github.com/mrhoseah/dolphin/internal/media"`)
+	assert.Contains(t, content, "AvatarUpload: controllers.NewAvatarUpload(media.Default),")
+	assert.Contains(t, content, "routes.RegisterAvatarUploadRoutes(r, c.AvatarUpload)")
+}
+
+func TestCreateResumableUpload(t *testing.T) {
+	t.Chdir(t.TempDir())
+	require.NoError(t, NewGenerator().CreateResumableUpload("Video"))
+	content := readWiring(t)
+
+	assert.NotContains(t, content, `"github.com/mrhoseah/dolphin/internal/media"`)
+	assert.Contains(t, content, "VideoUpload: controllers.NewVideoUpload(a.Config(), a.Logger()),")
+	assert.Contains(t, content, "routes.RegisterVideoUploadRoutes(r, c.VideoUpload)")
+
+	for _, path := range []string{"app/http/controllers/video_upload.go", "app/http/routes/video_upload.go", "resources/views/video/upload.html"} {
+		_, err := os.Stat(path)
+		assert.NoError(t, err, path)
+	}
+	routes, err := os.ReadFile("app/http/routes/video_upload.go")
+	require.NoError(t, err)
+	assert.Contains(t, string(routes), `routing.Wrap(r).Group("web", func(r *routing.Router) {`)
+	assert.Contains(t, string(routes), `r.Router.Route("/videos/uploads", c.Uploads)`)
+}
+
+func TestResourceRoutesAreInTheAPIGroup(t *testing.T) {
+	t.Chdir(t.TempDir())
+	require.NoError(t, NewGenerator().CreateResourceRoutes("Post", ResourceOptions{Parent: "User", Shallow: true}))
+
+	routes, err := os.ReadFile("app/http/routes/post.go")
+	require.NoError(t, err)
+	assert.Contains(t, string(routes), `routing.Wrap(r).Group("api", func(r *routing.Router) {`)
+	assert.Contains(t, string(routes), `		r.Route("/users/{user}/posts", func(r *routing.Router) {`)
+	assert.Contains(t, string(routes), `		r.Route("/posts", func(r *routing.Router) {`)
+	_, err = parser.ParseFile(token.NewFileSet(), "post.go", routes, 0)
+	assert.NoError(t, err)
+}
+
+func TestCreatePaymentHandler(t *testing.T) {
+	t.Chdir(t.TempDir())
+	generator := NewGenerator()
+	require.NoError(t, generator.CreatePaymentHandler("flutter_wave"))
+
+	content, err := os.ReadFile("app/gateways/flutter_wave.go")
+	require.NoError(t, err)
+	_, err = parser.ParseFile(token.NewFileSet(), "flutter_wave.go", content, 0)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), `payments.Register("flutter_wave", NewFlutterWave)`)
+	assert.Contains(t, string(content), "func (p *FlutterWave) Webhook(r *http.Request, body []byte) (*payments.Event, error)")
+
+	assert.ErrorContains(t, generator.CreatePaymentHandler("FlutterWave"), "already exists")
+	assert.Error(t, generator.CreatePaymentHandler("2checkout"))
+}
+
+func TestCreateObserver(t *testing.T) {
+	t.Chdir(t.TempDir())
+	generator := NewGenerator()
+	require.NoError(t, generator.CreateObserver("blog_post"))
+
+	content, err := os.ReadFile("app/observers/blog_post_observer.go")
+	require.NoError(t, err)
+	_, err = parser.ParseFile(token.NewFileSet(), "blog_post_observer.go", content, 0)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "dolphinObservers.Register[models.BlogPost](BlogPostObserver{})")
+	assert.Contains(t, string(content), "func (BlogPostObserver) Restored(ctx context.Context, model *models.BlogPost) error")
+
+	assert.ErrorContains(t, generator.CreateObserver("BlogPost"), "already exists")
+	assert.Error(t, generator.CreateObserver("2fa"))
+}
+
+func TestWireRequiresMarkers(t *testing.T) {
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.MkdirAll("bootstrap", 0755))
+	require.NoError(t, os.WriteFile(WiringFile, []byte("package bootstrap\n"), 0644))
+
+	err := NewGenerator().wireController("Home", false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "dolphin:imports")
+}
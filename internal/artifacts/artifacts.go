@@ -0,0 +1,394 @@
+// Package artifacts caches expensive generated files, such as PDF
+// invoices, report exports and image variants, on a storage disk. An
+// artifact is rendered once per version of its content and served from the
+// disk afterwards, with an ETag derived from the version so clients that
+// have it are answered 304 Not Modified without reading the disk:
+//
+//	router.Artifacts().Serve(w, r, artifacts.Artifact{
+//		Key:      fmt.Sprintf("invoices/%d.pdf", invoice.ID),
+//		Version:  invoice.UpdatedAt.Format(time.RFC3339Nano),
+//		Filename: invoice.Number + ".pdf",
+//		Render: func(ctx context.Context, w io.Writer) error {
+//			return pdf.RenderInvoice(ctx, w, invoice)
+//		},
+//	})
+//
+// A new version replaces the files of older ones once it has rendered.
+package artifacts
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/problem"
+	"github.com/mrhoseah/dolphin/internal/storage"
+)
+
+// Artifact is a generated file, cached by key and version
+type Artifact struct {
+	// Key names the artifact, such as invoices/42.pdf. Its extension gives
+	// the content type unless ContentType is set.
+	Key string
+
+	// Version changes whenever the content would, such as the updated_at
+	// of the record the artifact is generated from
+	Version string
+
+	// Filename, when set, serves the artifact as a download of that name
+	Filename    string
+	ContentType string
+
+	// Render writes the artifact's content
+	Render func(ctx context.Context, w io.Writer) error
+}
+
+// ETag returns the entity tag the artifact's version is served with
+func (a Artifact) ETag() string {
+	return `"` + versionHash(a.Version) + `"`
+}
+
+// validate checks the key stays under the cache's directory
+func (a Artifact) validate() error {
+	key := path.Clean("/" + a.Key)[1:]
+	if a.Key == "" || key != a.Key || strings.HasSuffix(a.Key, "/") {
+		return fmt.Errorf("artifacts: invalid key %q", a.Key)
+	}
+	if a.Render == nil {
+		return fmt.Errorf("artifacts: %s has no Render function", a.Key)
+	}
+	return nil
+}
+
+func (a Artifact) contentType() string {
+	if a.ContentType != "" {
+		return a.ContentType
+	}
+	if t := mime.TypeByExtension(path.Ext(a.Key)); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+func versionHash(version string) string {
+	sum := sha256.Sum256([]byte(version))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Cache keeps rendered artifacts on a storage disk. Renders of the same
+// artifact in the process are shared, so concurrent downloads render it
+// once.
+type Cache struct {
+	disk         storage.Driver
+	prefix       string
+	serveStale   bool
+	timeout      time.Duration
+	cacheControl string
+	logger       *zap.Logger
+
+	workers chan struct{}
+	wg      sync.WaitGroup
+
+	mu       sync.Mutex
+	inflight map[string]*render
+}
+
+// render is a render in progress, which others wait for
+type render struct {
+	done chan struct{}
+	err  error
+}
+
+// New creates a cache keeping artifacts on disk
+func New(disk storage.Driver, cfg config.ArtifactsConfig, logger *zap.Logger) *Cache {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	workers := cfg.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	return &Cache{
+		disk:         disk,
+		prefix:       strings.Trim(cfg.Prefix, "/"),
+		serveStale:   cfg.ServeStale,
+		timeout:      cfg.RenderTimeout,
+		cacheControl: cfg.CacheControl,
+		logger:       logger,
+		workers:      make(chan struct{}, workers),
+		inflight:     make(map[string]*render),
+	}
+}
+
+// FromConfig creates a cache on the disk artifacts.disk names
+func FromConfig(cfg config.ArtifactsConfig, storageCfg *config.StorageConfig, logger *zap.Logger) (*Cache, error) {
+	disk, err := storage.Disk(storageCfg, cfg.Disk)
+	if err != nil {
+		return nil, err
+	}
+	return New(disk, cfg, logger), nil
+}
+
+// dir returns the directory holding the versions of a key
+func (c *Cache) dir(key string) string {
+	return path.Join(c.prefix, key)
+}
+
+// path returns where an artifact's version is stored
+func (c *Cache) path(a Artifact) string {
+	return path.Join(c.dir(a.Key), versionHash(a.Version)+path.Ext(a.Key))
+}
+
+// Open returns the artifact's content, rendering and storing its version
+// first when it isn't cached
+func (c *Cache) Open(ctx context.Context, a Artifact) (io.ReadCloser, error) {
+	if err := a.validate(); err != nil {
+		return nil, err
+	}
+	p := c.path(a)
+	if !c.disk.Exists(p) {
+		if err := c.render(ctx, a, p); err != nil {
+			return nil, err
+		}
+	}
+	return c.disk.Get(p)
+}
+
+// Serve responds with the artifact, or 304 Not Modified when the request's
+// If-None-Match has its version. With serve_stale, a version not yet
+// rendered is answered with the previous one while it renders in the
+// background. Like export.Respond, Serve writes failures as problems and
+// returns them.
+func (c *Cache) Serve(w http.ResponseWriter, r *http.Request, a Artifact) error {
+	if err := a.validate(); err != nil {
+		problem.Write(w, r, err)
+		return err
+	}
+	w.Header().Set("Cache-Control", c.cacheControl)
+	if noneMatch(r, a.ETag()) {
+		w.Header().Set("ETag", a.ETag())
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	p := c.path(a)
+	if !c.disk.Exists(p) {
+		if stale := c.previous(a, p); stale != "" {
+			c.Warm(a)
+			p = stale
+		} else if err := c.render(r.Context(), a, p); err != nil {
+			problem.Write(w, r, err)
+			return err
+		}
+	}
+	etag := `"` + strings.TrimSuffix(path.Base(p), path.Ext(p)) + `"`
+	if noneMatch(r, etag) {
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	content, err := c.disk.Get(p)
+	if err != nil {
+		problem.Write(w, r, err)
+		return err
+	}
+	defer content.Close()
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Content-Type", a.contentType())
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if a.Filename != "" {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename}))
+	}
+	if size, err := c.disk.Size(p); err == nil {
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+	if r.Method == http.MethodHead {
+		return nil
+	}
+	_, err = io.Copy(w, content)
+	return err
+}
+
+// Warm renders the artifact's version in the background unless it is
+// cached, such as after the record it's generated from changes, so the
+// next download is served at once. Failures are logged.
+func (c *Cache) Warm(a Artifact) {
+	if err := a.validate(); err != nil {
+		c.logger.Error("Invalid artifact", zap.Error(err))
+		return
+	}
+	p := c.path(a)
+	if c.disk.Exists(p) {
+		return
+	}
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.workers <- struct{}{}
+		defer func() { <-c.workers }()
+		if err := c.render(context.Background(), a, p); err != nil {
+			c.logger.Error("Failed to render artifact", zap.String("key", a.Key), zap.Error(err))
+		}
+	}()
+}
+
+// Forget deletes every cached version of a key
+func (c *Cache) Forget(key string) error {
+	_, err := c.Clear(key)
+	return err
+}
+
+// Clear deletes the cached artifacts whose keys are under prefix, or all
+// of them when it is empty, returning how many files were deleted
+func (c *Cache) Clear(prefix string) (int, error) {
+	files, err := c.disk.List(path.Join(c.prefix, prefix))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for _, file := range files {
+		if file.IsDir {
+			continue
+		}
+		if err := c.disk.Delete(file.Path); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// Close waits for background renders to finish
+func (c *Cache) Close() {
+	c.wg.Wait()
+}
+
+// render renders an artifact to p, or waits for the render already in
+// progress. The render isn't canceled with ctx, so a download given up on
+// still leaves the artifact cached for the next.
+func (c *Cache) render(ctx context.Context, a Artifact, p string) error {
+	c.mu.Lock()
+	if running, ok := c.inflight[p]; ok {
+		c.mu.Unlock()
+		select {
+		case <-running.done:
+			return running.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	running := &render{done: make(chan struct{})}
+	c.inflight[p] = running
+	c.mu.Unlock()
+
+	renderCtx := context.WithoutCancel(ctx)
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		renderCtx, cancel = context.WithTimeout(renderCtx, c.timeout)
+		defer cancel()
+	}
+	// A render queued behind another may find it already done
+	if !c.disk.Exists(p) {
+		started := time.Now()
+		running.err = c.store(renderCtx, a, p)
+		if running.err == nil {
+			c.logger.Debug("Rendered artifact", zap.String("key", a.Key), zap.Duration("duration", time.Since(started)))
+		}
+	}
+
+	c.mu.Lock()
+	delete(c.inflight, p)
+	c.mu.Unlock()
+	close(running.done)
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		return running.err
+	}
+}
+
+// store renders an artifact to a temporary file and puts it on the disk,
+// then deletes the key's other versions
+func (c *Cache) store(ctx context.Context, a Artifact, p string) error {
+	tmp, err := os.CreateTemp("", "artifact-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if err := a.Render(ctx, tmp); err != nil {
+		return fmt.Errorf("artifacts: render %s: %w", a.Key, err)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := c.disk.Put(p, tmp); err != nil {
+		c.disk.Delete(p)
+		return err
+	}
+
+	files, err := c.disk.List(c.dir(a.Key))
+	if err != nil {
+		return nil
+	}
+	for _, file := range files {
+		if !file.IsDir && file.Path != p && path.Dir(file.Path) == c.dir(a.Key) {
+			if err := c.disk.Delete(file.Path); err != nil {
+				c.logger.Warn("Failed to delete old artifact", zap.String("path", file.Path), zap.Error(err))
+			}
+		}
+	}
+	return nil
+}
+
+// previous returns the newest other version of an artifact, or "" when
+// stale versions aren't served or there is none
+func (c *Cache) previous(a Artifact, p string) string {
+	if !c.serveStale {
+		return ""
+	}
+	files, err := c.disk.List(c.dir(a.Key))
+	if err != nil {
+		return ""
+	}
+	var newest storage.FileInfo
+	for _, file := range files {
+		if !file.IsDir && file.Path != p && path.Dir(file.Path) == c.dir(a.Key) && file.ModTime.After(newest.ModTime) {
+			newest = file
+		}
+	}
+	return newest.Path
+}
+
+// noneMatch reports whether the request's If-None-Match names etag
+func noneMatch(r *http.Request, etag string) bool {
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,186 @@
+package artifacts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/storage"
+)
+
+var testConfig = config.ArtifactsConfig{
+	Prefix:        "artifacts",
+	Workers:       2,
+	RenderTimeout: time.Minute,
+	CacheControl:  "private, no-cache",
+}
+
+// invoice renders a fake PDF, counting its renders
+type invoice struct {
+	renders atomic.Int32
+	release chan struct{}
+}
+
+func (i *invoice) artifact(version string) Artifact {
+	return Artifact{
+		Key:      "invoices/42.pdf",
+		Version:  version,
+		Filename: "INV-0042.pdf",
+		Render: func(ctx context.Context, w io.Writer) error {
+			i.renders.Add(1)
+			if i.release != nil {
+				<-i.release
+			}
+			_, err := fmt.Fprintf(w, "%%PDF invoice 42 %s", version)
+			return err
+		},
+	}
+}
+
+func newTestCache(t *testing.T, cfg config.ArtifactsConfig) (*Cache, *storage.LocalDriver) {
+	disk := storage.NewLocalDriver(t.TempDir(), "")
+	cache := New(disk, cfg, nil)
+	t.Cleanup(cache.Close)
+	return cache, disk
+}
+
+func serve(cache *Cache, a Artifact, etag string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/invoices/42/pdf", nil)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	rec := httptest.NewRecorder()
+	cache.Serve(rec, req, a)
+	return rec
+}
+
+func TestServeRendersOncePerVersion(t *testing.T) {
+	cache, disk := newTestCache(t, testConfig)
+	inv := &invoice{}
+	v1 := inv.artifact("2026-10-01T10:00:00Z")
+
+	rec := serve(cache, v1, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "%PDF invoice 42 2026-10-01T10:00:00Z", rec.Body.String())
+	assert.Equal(t, "application/pdf", rec.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename=INV-0042.pdf`, rec.Header().Get("Content-Disposition"))
+	assert.Equal(t, v1.ETag(), rec.Header().Get("ETag"))
+	assert.Equal(t, "private, no-cache", rec.Header().Get("Cache-Control"))
+	assert.Equal(t, "36", rec.Header().Get("Content-Length"))
+
+	rec = serve(cache, v1, "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = serve(cache, v1, `W/"other", `+v1.ETag())
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	assert.Empty(t, rec.Body.String())
+	assert.Equal(t, int32(1), inv.renders.Load())
+
+	v2 := inv.artifact("2026-10-02T09:30:00Z")
+	rec = serve(cache, v2, v1.ETag())
+	assert.Equal(t, http.StatusOK, rec.Code, "a new version")
+	assert.Equal(t, "%PDF invoice 42 2026-10-02T09:30:00Z", rec.Body.String())
+	assert.Equal(t, int32(2), inv.renders.Load())
+
+	files, err := disk.List("artifacts/invoices/42.pdf")
+	require.NoError(t, err)
+	assert.Len(t, files, 2, "the directory and the current version only")
+}
+
+func TestConcurrentDownloadsShareRender(t *testing.T) {
+	cache, _ := newTestCache(t, testConfig)
+	inv := &invoice{release: make(chan struct{})}
+	a := inv.artifact("v1")
+
+	var wg sync.WaitGroup
+	bodies := make([]string, 5)
+	for i := range bodies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			content, err := cache.Open(context.Background(), a)
+			if assert.NoError(t, err) {
+				data, _ := io.ReadAll(content)
+				content.Close()
+				bodies[i] = string(data)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(inv.release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), inv.renders.Load())
+	for _, body := range bodies {
+		assert.Equal(t, "%PDF invoice 42 v1", body)
+	}
+}
+
+func TestServeStaleWhileRendering(t *testing.T) {
+	cfg := testConfig
+	cfg.ServeStale = true
+	cache, _ := newTestCache(t, cfg)
+	inv := &invoice{}
+	v1 := inv.artifact("v1")
+	require.Equal(t, http.StatusOK, serve(cache, v1, "").Code)
+
+	inv.release = make(chan struct{})
+	v2 := inv.artifact("v2")
+	rec := serve(cache, v2, "")
+	assert.Equal(t, "%PDF invoice 42 v1", rec.Body.String(), "the previous version")
+	assert.Equal(t, v1.ETag(), rec.Header().Get("ETag"))
+	assert.Equal(t, http.StatusNotModified, serve(cache, v2, v1.ETag()).Code)
+
+	close(inv.release)
+	cache.Close()
+	rec = serve(cache, v2, v1.ETag())
+	assert.Equal(t, "%PDF invoice 42 v2", rec.Body.String())
+	assert.Equal(t, int32(2), inv.renders.Load())
+}
+
+func TestWarmAndClear(t *testing.T) {
+	cache, disk := newTestCache(t, testConfig)
+	inv := &invoice{}
+	a := inv.artifact("v1")
+
+	cache.Warm(a)
+	cache.Close()
+	assert.True(t, disk.Exists(cache.path(a)))
+	cache.Warm(a)
+	cache.Close()
+	assert.Equal(t, int32(1), inv.renders.Load(), "cached")
+
+	deleted, err := cache.Clear("invoices")
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	deleted, err = cache.Clear("reports")
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+}
+
+func TestRenderFailures(t *testing.T) {
+	cache, disk := newTestCache(t, testConfig)
+	a := Artifact{Key: "reports/q3.csv", Version: "1", Render: func(ctx context.Context, w io.Writer) error {
+		io.WriteString(w, "partial")
+		return errors.New("query failed")
+	}}
+
+	rec := serve(cache, a, "")
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.False(t, disk.Exists(cache.path(a)), "nothing cached")
+
+	_, err := cache.Open(context.Background(), Artifact{Key: "../etc/passwd", Render: a.Render})
+	assert.Error(t, err)
+	_, err = cache.Open(context.Background(), Artifact{Key: "reports/q3.csv"})
+	assert.Error(t, err, "no Render")
+}
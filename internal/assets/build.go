@@ -0,0 +1,340 @@
+package assets
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// BuildCacheDir is where Build remembers what it made, so the next build
+// only reprocesses what changed
+const BuildCacheDir = ".dolphin/cache/assets"
+
+// buildFormat is part of every config hash; bump it when Build's output
+// changes so old caches are ignored
+const buildFormat = "1"
+
+// BuildOptions configures Build
+type BuildOptions struct {
+	// Force reprocesses every file and bundle, ignoring the cache
+	Force bool
+
+	// CacheDir holds the build manifest, BuildCacheDir by default
+	CacheDir string
+}
+
+// BuildResult reports what Build did
+type BuildResult struct {
+	// Built lists the sources reprocessed, and Skipped counts those
+	// unchanged since the last build
+	Built   []string
+	Skipped int
+
+	// Bundles lists the bundles combined again, and BundlesSkipped counts
+	// those whose files were all unchanged
+	Bundles        []string
+	BundlesSkipped int
+
+	// Removed lists the outputs deleted because their source is gone or
+	// now builds elsewhere
+	Removed []string
+
+	// Invalidated reports that the whole cache was dropped, because of
+	// Force or a changed configuration
+	Invalidated bool
+
+	Duration time.Duration
+}
+
+// buildManifest is what a build made, saved as manifest.json in the cache
+// directory
+type buildManifest struct {
+	// Config is the hash of the configuration the outputs were built with
+	Config  string                `json:"config"`
+	Files   map[string]builtEntry `json:"files"`
+	Bundles map[string]builtEntry `json:"bundles"`
+}
+
+// builtEntry records the content hash a source or bundle was built from,
+// and the files made from it
+type builtEntry struct {
+	Hash    string   `json:"hash"`
+	Outputs []string `json:"outputs"`
+}
+
+// Build processes the source directory like ProcessAssets, writing each
+// file to the output directory and combining the bundles, but skips the
+// files and bundles whose content hasn't changed since the last build.
+// Changing any setting that affects the output rebuilds everything.
+func (am *AssetManager) Build(opts BuildOptions) (*BuildResult, error) {
+	start := time.Now()
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	if opts.CacheDir == "" {
+		opts.CacheDir = BuildCacheDir
+	}
+	manifestPath := filepath.Join(opts.CacheDir, "manifest.json")
+	previous := loadManifest(manifestPath)
+	configHash := am.configHash()
+
+	result := &BuildResult{}
+	valid := previous
+	if opts.Force || previous.Config != configHash {
+		result.Invalidated = len(previous.Files) > 0 || len(previous.Bundles) > 0
+		valid = buildManifest{}
+	}
+	next := buildManifest{
+		Config:  configHash,
+		Files:   make(map[string]builtEntry),
+		Bundles: make(map[string]builtEntry),
+	}
+
+	am.assets = make(map[string]*Asset)
+	am.bundles = make(map[string]*Bundle)
+	err := filepath.Walk(am.config.SourceDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !am.shouldProcessFile(path) {
+			return nil
+		}
+
+		asset, err := am.processFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to process %s: %w", path, err)
+		}
+		am.assets[path] = asset
+
+		if entry, ok := valid.Files[path]; ok && entry.Hash == asset.Hash && outputsExist(entry.Outputs) {
+			next.Files[path] = entry
+			result.Skipped++
+			am.stats.RecordCacheHit()
+			return nil
+		}
+		am.stats.RecordCacheMiss()
+
+		output, err := am.writeAsset(asset)
+		if err != nil {
+			return fmt.Errorf("failed to build %s: %w", path, err)
+		}
+		next.Files[path] = builtEntry{Hash: asset.Hash, Outputs: []string{output}}
+		result.Built = append(result.Built, path)
+		am.stats.RecordFileProcessed(asset.Type, asset.Bundle, asset.Size)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if am.config.EnableBundling {
+		if err := am.buildBundles(valid, &next, result); err != nil {
+			return nil, err
+		}
+	}
+
+	result.Removed = removeStaleOutputs(previous, next)
+	if err := saveManifest(manifestPath, next); err != nil {
+		return nil, fmt.Errorf("failed to save the build cache: %w", err)
+	}
+
+	am.stats.RecordProcess()
+	result.Duration = time.Since(start)
+	am.stats.RecordProcessDuration(result.Duration)
+	if am.config.EnableLogging && am.logger != nil {
+		am.logger.Info("Assets built",
+			zap.Int("built", len(result.Built)),
+			zap.Int("skipped", result.Skipped),
+			zap.Int("bundles", len(result.Bundles)),
+			zap.Duration("duration", result.Duration))
+	}
+	return result, nil
+}
+
+// buildBundles combines the bundles whose files changed, and registers the
+// rest from the cache
+func (am *AssetManager) buildBundles(valid buildManifest, next *buildManifest, result *BuildResult) error {
+	members := make(map[string][]*Asset)
+	for _, asset := range am.assets {
+		members[asset.Bundle] = append(members[asset.Bundle], asset)
+	}
+
+	for name, assets := range members {
+		hash := bundleHash(assets)
+		if entry, ok := valid.Bundles[name]; ok && entry.Hash == hash && outputsExist(entry.Outputs) {
+			bundle := am.newBundle(name, assets)
+			bundle.CombinedPaths = entry.Outputs
+			if len(entry.Outputs) > 0 {
+				bundle.CombinedPath = entry.Outputs[0]
+			}
+			am.bundles[name] = bundle
+			next.Bundles[name] = entry
+			result.BundlesSkipped++
+			continue
+		}
+
+		bundle, err := am.createBundle(name, assets)
+		if err != nil {
+			return fmt.Errorf("failed to create bundle %s: %w", name, err)
+		}
+		am.bundles[name] = bundle
+		next.Bundles[name] = builtEntry{Hash: hash, Outputs: bundle.CombinedPaths}
+		result.Bundles = append(result.Bundles, name)
+		am.stats.RecordBundleCreated(bundle.Size, bundle.CombinedPath != "")
+	}
+	sort.Strings(result.Bundles)
+	return nil
+}
+
+// writeAsset writes asset to the output directory, versioned when
+// versioning is on and minified when CSS or JS optimization is, returning
+// the path written
+func (am *AssetManager) writeAsset(asset *Asset) (string, error) {
+	content, err := os.ReadFile(asset.Path)
+	if err != nil {
+		return "", err
+	}
+
+	optimizer := NewOptimizer(am.config, am.logger)
+	if am.config.EnableOptimization {
+		switch {
+		case asset.Type == TypeCSS && am.config.OptimizeCSS && filepath.Ext(asset.Path) == ".css":
+			content = []byte(optimizer.minifyCSS(string(content)))
+		case asset.Type == TypeJS && am.config.OptimizeJS && filepath.Ext(asset.Path) == ".js":
+			content = []byte(optimizer.minifyJS(string(content)))
+		}
+	}
+
+	output := am.getOutputPath(asset)
+	if !am.config.EnableVersioning {
+		rel, err := filepath.Rel(am.config.SourceDir, asset.Path)
+		if err != nil {
+			rel = asset.Path
+		}
+		output = filepath.Join(am.config.OutputDir, rel)
+	}
+	if err := optimizer.writeFile(output, string(content)); err != nil {
+		return "", err
+	}
+	return output, nil
+}
+
+// configHash hashes the settings that change what a build writes
+func (am *AssetManager) configHash() string {
+	c := *am.config
+	c.EnableCache, c.CacheDir, c.CacheExpiry = false, "", 0
+	c.EnableWatch, c.EnableLogging, c.VerboseLogging = false, false, false
+	data, _ := json.Marshal(struct {
+		Format string
+		Config Config
+	}{buildFormat, c})
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// bundleHash hashes the paths and contents of a bundle's files
+func bundleHash(assets []*Asset) string {
+	parts := make([]string, 0, len(assets))
+	for _, asset := range assets {
+		parts = append(parts, asset.Path+"\x00"+asset.Hash)
+	}
+	sort.Strings(parts)
+	sum := md5.Sum([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// outputsExist reports whether every output of a cached entry is still on
+// disk
+func outputsExist(outputs []string) bool {
+	for _, output := range outputs {
+		if _, err := os.Stat(output); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// removeStaleOutputs deletes the files the previous build made that the
+// new one didn't, returning their paths
+func removeStaleOutputs(previous, next buildManifest) []string {
+	current := make(map[string]bool)
+	for _, entries := range []map[string]builtEntry{next.Files, next.Bundles} {
+		for _, entry := range entries {
+			for _, output := range entry.Outputs {
+				current[output] = true
+			}
+		}
+	}
+
+	var removed []string
+	for _, entries := range []map[string]builtEntry{previous.Files, previous.Bundles} {
+		for _, entry := range entries {
+			for _, output := range entry.Outputs {
+				if current[output] {
+					continue
+				}
+				if err := os.Remove(output); err == nil {
+					removed = append(removed, output)
+				}
+				current[output] = true
+			}
+		}
+	}
+	sort.Strings(removed)
+	return removed
+}
+
+// loadManifest reads a build manifest, returning an empty one when there
+// is none or it can't be read
+func loadManifest(path string) buildManifest {
+	var manifest buildManifest
+	if data, err := os.ReadFile(path); err == nil {
+		if json.Unmarshal(data, &manifest) != nil {
+			return buildManifest{}
+		}
+	}
+	return manifest
+}
+
+// saveManifest writes a build manifest, creating its directory
+func saveManifest(path string, manifest buildManifest) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// LoadConfig reads the pipeline configuration from the assets section of a
+// YAML file such as config/assets.yaml, over the defaults. A missing file
+// leaves the defaults.
+func LoadConfig(path string) (*Config, error) {
+	config := DefaultConfig()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	file := struct {
+		Assets *Config `yaml:"assets"`
+	}{Assets: config}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return config, nil
+}
@@ -0,0 +1,146 @@
+package assets
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// buildDirs are the directories a test build reads and writes
+type buildDirs struct {
+	src, out, cache string
+}
+
+func newBuildDirs(t *testing.T) buildDirs {
+	t.Helper()
+	dir := t.TempDir()
+	dirs := buildDirs{
+		src:   filepath.Join(dir, "src"),
+		out:   filepath.Join(dir, "out"),
+		cache: filepath.Join(dir, "cache"),
+	}
+	require.NoError(t, os.MkdirAll(dirs.src, 0755))
+	writeSource(t, dirs, "app.css", "body { color: red; }")
+	writeSource(t, dirs, "app.js", "var a = 1;")
+	return dirs
+}
+
+func writeSource(t *testing.T, dirs buildDirs, name, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(dirs.src, name), []byte(content), 0644))
+}
+
+// newBuilder returns a manager building dirs, with configure applied to its
+// config
+func newBuilder(t *testing.T, dirs buildDirs, configure func(*Config)) *AssetManager {
+	t.Helper()
+	config := DefaultConfig()
+	config.SourceDir = dirs.src
+	config.OutputDir = dirs.out
+	config.CacheDir = filepath.Join(dirs.cache, "assets")
+	config.EnableWatch = false
+	config.EnableBundling = false
+	config.EnableLogging = false
+	if configure != nil {
+		configure(config)
+	}
+	am, err := NewAssetManager(config, zap.NewNop())
+	require.NoError(t, err)
+	return am
+}
+
+// outputOf returns the output the last build recorded for the source name
+func outputOf(t *testing.T, dirs buildDirs, name string) string {
+	t.Helper()
+	manifest := loadManifest(filepath.Join(dirs.cache, "build", "manifest.json"))
+	entry, ok := manifest.Files[filepath.Join(dirs.src, name)]
+	require.True(t, ok, "no build recorded for %s", name)
+	require.Len(t, entry.Outputs, 1)
+	return entry.Outputs[0]
+}
+
+func TestBuild(t *testing.T) {
+	dirs := newBuildDirs(t)
+	am := newBuilder(t, dirs, nil)
+	opts := BuildOptions{CacheDir: filepath.Join(dirs.cache, "build")}
+	css, js := filepath.Join(dirs.src, "app.css"), filepath.Join(dirs.src, "app.js")
+
+	result, err := am.Build(opts)
+	require.NoError(t, err)
+	assert.Equal(t, []string{css, js}, result.Built)
+	assert.Zero(t, result.Skipped)
+	assert.False(t, result.Invalidated)
+	assert.FileExists(t, outputOf(t, dirs, "app.css"))
+
+	t.Run("unchanged files are skipped", func(t *testing.T) {
+		result, err := am.Build(opts)
+		require.NoError(t, err)
+		assert.Empty(t, result.Built)
+		assert.Equal(t, 2, result.Skipped)
+		assert.Empty(t, result.Removed)
+	})
+
+	t.Run("changed files are rebuilt", func(t *testing.T) {
+		old := outputOf(t, dirs, "app.css")
+		writeSource(t, dirs, "app.css", "body { color: blue; }")
+
+		result, err := am.Build(opts)
+		require.NoError(t, err)
+		assert.Equal(t, []string{css}, result.Built)
+		assert.Equal(t, 1, result.Skipped)
+
+		output := outputOf(t, dirs, "app.css")
+		assert.NotEqual(t, old, output, "a new version is written")
+		assert.FileExists(t, output)
+		assert.Equal(t, []string{old}, result.Removed)
+		assert.NoFileExists(t, old)
+	})
+
+	t.Run("missing outputs are rebuilt", func(t *testing.T) {
+		output := outputOf(t, dirs, "app.js")
+		require.NoError(t, os.Remove(output))
+
+		result, err := am.Build(opts)
+		require.NoError(t, err)
+		assert.Equal(t, []string{js}, result.Built)
+		assert.FileExists(t, output)
+	})
+
+	t.Run("outputs of deleted sources are removed", func(t *testing.T) {
+		output := outputOf(t, dirs, "app.js")
+		require.NoError(t, os.Remove(js))
+
+		result, err := am.Build(opts)
+		require.NoError(t, err)
+		assert.Empty(t, result.Built)
+		assert.Equal(t, []string{output}, result.Removed)
+		assert.NoFileExists(t, output)
+	})
+
+	t.Run("force rebuilds everything", func(t *testing.T) {
+		result, err := am.Build(BuildOptions{CacheDir: opts.CacheDir, Force: true})
+		require.NoError(t, err)
+		assert.True(t, result.Invalidated)
+		assert.Equal(t, []string{css}, result.Built)
+		assert.Zero(t, result.Skipped)
+	})
+
+	t.Run("a config change invalidates everything", func(t *testing.T) {
+		changed := newBuilder(t, dirs, func(c *Config) { c.OptimizeJS = false })
+		result, err := changed.Build(opts)
+		require.NoError(t, err)
+		assert.True(t, result.Invalidated)
+		assert.Equal(t, []string{css}, result.Built)
+
+		// Settings that don't change the output keep the cache
+		quiet := newBuilder(t, dirs, func(c *Config) { c.OptimizeJS = false; c.VerboseLogging = true })
+		result, err = quiet.Build(opts)
+		require.NoError(t, err)
+		assert.False(t, result.Invalidated)
+		assert.Equal(t, 1, result.Skipped)
+	})
+}
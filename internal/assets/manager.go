@@ -157,6 +157,7 @@ type Bundle struct {
 	Type        BundleType `json:"type"`
 	Assets      []*Asset  `json:"assets"`
 	CombinedPath string   `json:"combined_path"`
+	CombinedPaths []string `json:"combined_paths,omitempty"`
 	Version     string    `json:"version"`
 	Size        int64     `json:"size"`
 	CreatedAt   time.Time `json:"created_at"`
@@ -441,6 +442,25 @@ func (am *AssetManager) createBundles() error {
 
 // createBundle creates a single bundle
 func (am *AssetManager) createBundle(name string, assets []*Asset) (*Bundle, error) {
+	bundle := am.newBundle(name, assets)
+	
+	// Create combined files if enabled
+	if am.config.CombineAssets {
+		combinedPaths, err := am.createCombinedFile(bundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create combined file: %w", err)
+		}
+		bundle.CombinedPaths = combinedPaths
+		if len(combinedPaths) > 0 {
+			bundle.CombinedPath = combinedPaths[0]
+		}
+	}
+	
+	return bundle, nil
+}
+
+// newBundle describes a bundle of assets without writing its files
+func (am *AssetManager) newBundle(name string, assets []*Asset) *Bundle {
 	// Sort assets by type and path
 	sort.Slice(assets, func(i, j int) bool {
 		if assets[i].Type != assets[j].Type {
@@ -458,7 +478,7 @@ func (am *AssetManager) createBundle(name string, assets []*Asset) (*Bundle, err
 	// Generate bundle version
 	version := am.generateBundleVersion(assets)
 	
-	// Create bundle
+	// Describe bundle
 	bundle := &Bundle{
 		Name:        name,
 		Type:        am.getBundleType(name),
@@ -468,16 +488,7 @@ func (am *AssetManager) createBundle(name string, assets []*Asset) (*Bundle, err
 		CreatedAt:   time.Now(),
 	}
 	
-	// Create combined file if enabled
-	if am.config.CombineAssets {
-		combinedPath, err := am.createCombinedFile(bundle)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create combined file: %w", err)
-		}
-		bundle.CombinedPath = combinedPath
-	}
-	
-	return bundle, nil
+	return bundle
 }
 
 // generateBundleVersion generates a version for a bundle
@@ -517,8 +528,9 @@ func (am *AssetManager) getBundleType(name string) BundleType {
 	}
 }
 
-// createCombinedFile creates a combined file for a bundle
-func (am *AssetManager) createCombinedFile(bundle *Bundle) (string, error) {
+// createCombinedFile creates a combined file per asset type for a bundle,
+// CSS first
+func (am *AssetManager) createCombinedFile(bundle *Bundle) ([]string, error) {
 	// Group assets by type
 	cssAssets := make([]*Asset, 0)
 	jsAssets := make([]*Asset, 0)
@@ -536,31 +548,26 @@ func (am *AssetManager) createCombinedFile(bundle *Bundle) (string, error) {
 	var combinedPaths []string
 	
 	if len(cssAssets) > 0 {
-		cssPath, err := am.combineAssets(cssAssets, "css")
+		cssPath, err := am.combineAssets(bundle, cssAssets, "css")
 		if err != nil {
-			return "", fmt.Errorf("failed to combine CSS assets: %w", err)
+			return nil, fmt.Errorf("failed to combine CSS assets: %w", err)
 		}
 		combinedPaths = append(combinedPaths, cssPath)
 	}
 	
 	if len(jsAssets) > 0 {
-		jsPath, err := am.combineAssets(jsAssets, "js")
+		jsPath, err := am.combineAssets(bundle, jsAssets, "js")
 		if err != nil {
-			return "", fmt.Errorf("failed to combine JS assets: %w", err)
+			return nil, fmt.Errorf("failed to combine JS assets: %w", err)
 		}
 		combinedPaths = append(combinedPaths, jsPath)
 	}
 	
-	// Return the first combined path (or empty if none)
-	if len(combinedPaths) > 0 {
-		return combinedPaths[0], nil
-	}
-	
-	return "", nil
+	return combinedPaths, nil
 }
 
-// combineAssets combines multiple assets into a single file
-func (am *AssetManager) combineAssets(assets []*Asset, ext string) (string, error) {
+// combineAssets combines multiple assets of a bundle into a single file
+func (am *AssetManager) combineAssets(bundle *Bundle, assets []*Asset, ext string) (string, error) {
 	// Create output directory
 	outputDir := filepath.Join(am.config.OutputDir, "bundles")
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
@@ -568,7 +575,11 @@ func (am *AssetManager) combineAssets(assets []*Asset, ext string) (string, erro
 	}
 	
 	// Create output file
-	outputPath := filepath.Join(outputDir, fmt.Sprintf("%s.%s", ext, ext))
+	name := bundle.Name
+	if am.config.EnableVersioning {
+		name += "." + bundle.Version
+	}
+	outputPath := filepath.Join(outputDir, fmt.Sprintf("%s.%s", name, ext))
 	outputFile, err := os.Create(outputPath)
 	if err != nil {
 		return "", err
@@ -0,0 +1,423 @@
+// Package async offloads long-running work from requests. A handler starts
+// a registered operation and answers 202 Accepted at once, with the URL of
+// a status endpoint the client polls, or follows as server-sent events,
+// until the operation is done and links to its result:
+//
+//	async.Register("reports.build", func(ctx context.Context, input async.Input) (async.Result, error) {
+//		var params ReportParams
+//		if err := input.Decode(&params); err != nil {
+//			return async.Result{}, err
+//		}
+//		report, err := reports.Build(ctx, params)
+//		if err != nil {
+//			return async.Result{}, err
+//		}
+//		return async.Result{URL: "/api/reports/" + report.ID}, nil
+//	})
+//
+//	op, err := async.Default.Start(r.Context(), "reports.build", params)
+//	if err != nil {
+//		return err
+//	}
+//	return async.Default.Accept(w, r, op)
+//
+// Operations run in a goroutine, or as queue jobs with UseQueue, and are
+// kept in a Store so any instance can answer for their status.
+package async
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/auth"
+	"github.com/mrhoseah/dolphin/internal/correlation"
+	"github.com/mrhoseah/dolphin/internal/problem"
+	"github.com/mrhoseah/dolphin/internal/providers"
+	"github.com/mrhoseah/dolphin/internal/sse"
+)
+
+// JobType is the type of the queue jobs that run operations
+const JobType = "async.operation"
+
+// Status is the state of an operation
+type Status string
+
+const (
+	// StatusPending operations wait for a worker
+	StatusPending Status = "pending"
+	// StatusProcessing operations are running
+	StatusProcessing Status = "processing"
+	// StatusDone operations finished, with their result
+	StatusDone Status = "done"
+	// StatusFailed operations returned an error, or were abandoned by a
+	// crashed worker
+	StatusFailed Status = "failed"
+)
+
+// Finished reports whether the operation won't change any more
+func (s Status) Finished() bool {
+	return s == StatusDone || s == StatusFailed
+}
+
+// Input is the JSON encoded input an operation was started with
+type Input json.RawMessage
+
+// Decode decodes the input into dest
+func (i Input) Decode(dest interface{}) error {
+	return json.Unmarshal(i, dest)
+}
+
+// Result is the outcome of an operation
+type Result struct {
+	// URL links to what the operation produced, such as the report it
+	// built
+	URL string
+
+	// Data is sent in the status response, encoded as JSON
+	Data interface{}
+}
+
+// Func runs an operation. The error of a failed operation is logged; its
+// detail is shown to the client only when it is a problem.Error, such as
+// problem.Domain("quota_exceeded", "...").
+type Func func(ctx context.Context, input Input) (Result, error)
+
+// Operation is one run of a registered operation
+type Operation struct {
+	ID     string
+	Name   string
+	Status Status
+	Input  Input
+
+	// Result is the JSON encoded Result.Data, ResultURL its URL
+	Result    json.RawMessage
+	ResultURL string
+
+	// Error is the detail shown for a failed operation
+	Error string
+
+	// Owner is the ID of the user who started the operation, who alone
+	// may see its status; empty for guests
+	Owner string
+
+	// Correlation identifies the request the operation was started from
+	Correlation correlation.Fields
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Errors returned by managers and stores
+var (
+	ErrNotFound   = errors.New("async: operation not found")
+	ErrNotPending = errors.New("async: operation isn't pending")
+	ErrUnknown    = errors.New("async: unknown operation")
+)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Func{}
+)
+
+// Register makes an operation available to Start under name, in every
+// process that runs it: the web server and the queue workers alike. It
+// panics when the name is taken.
+func Register(name string, fn Func) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, exists := registry[name]; exists {
+		panic("async: operation registered twice: " + name)
+	}
+	registry[name] = fn
+}
+
+// Lookup returns a registered operation
+func Lookup(name string) (Func, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	fn, ok := registry[name]
+	return fn, ok
+}
+
+// Registered returns the names of the registered operations, sorted
+func Registered() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Manager starts operations and reports on them
+type Manager struct {
+	store      Store
+	logger     *zap.Logger
+	queue      providers.QueueProvider
+	queueName  string
+	path       string
+	retryAfter time.Duration
+	timeout    time.Duration
+	retention  time.Duration
+
+	// streams is the hub status streams are served by, sse.Default when
+	// nil
+	streams *sse.Hub
+
+	wg   sync.WaitGroup
+	stop chan struct{}
+	once sync.Once
+}
+
+// Default is the manager the application starts operations with. It keeps
+// operations in memory until the router gives it the database store.
+var Default = NewManager(nil, nil)
+
+// NewManager creates a manager keeping operations in store, or in memory
+// when store is nil
+func NewManager(store Store, logger *zap.Logger) *Manager {
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &Manager{
+		store:      store,
+		logger:     logger,
+		path:       "/api/operations",
+		retryAfter: 2 * time.Second,
+		timeout:    30 * time.Minute,
+		retention:  24 * time.Hour,
+		stop:       make(chan struct{}),
+	}
+}
+
+// SetStore replaces the store; call it before starting operations
+func (m *Manager) SetStore(store Store) {
+	m.store = store
+}
+
+// SetLogger replaces the logger
+func (m *Manager) SetLogger(logger *zap.Logger) {
+	m.logger = logger
+}
+
+// SetPath sets where the status endpoints are mounted, for the URLs sent
+// to clients
+func (m *Manager) SetPath(path string) {
+	m.path = path
+}
+
+// SetRetryAfter sets how long clients are told to wait between polls,
+// which is also how often event streams check for changes
+func (m *Manager) SetRetryAfter(d time.Duration) {
+	if d > 0 {
+		m.retryAfter = d
+	}
+}
+
+// SetTimeout bounds how long an operation may run. Operations left
+// unfinished for longer, such as by a crashed worker, are failed by Work.
+func (m *Manager) SetTimeout(d time.Duration) {
+	if d > 0 {
+		m.timeout = d
+	}
+}
+
+// SetRetention sets how long finished operations are kept before Work
+// deletes them
+func (m *Manager) SetRetention(d time.Duration) {
+	if d > 0 {
+		m.retention = d
+	}
+}
+
+// UseQueue runs operations through jobs pushed to the named queue. The
+// queue's workers must process them with JobHandler. Without a queue,
+// operations run in a goroutine of the process that started them.
+func (m *Manager) UseQueue(queue providers.QueueProvider, name string) {
+	m.queue = queue
+	m.queueName = name
+}
+
+// Store returns the manager's store
+func (m *Manager) Store() Store {
+	return m.store
+}
+
+// requester returns the ID of the user authenticated for the request ctx
+// belongs to, or of the user a job running on ctx was queued for
+func requester(ctx context.Context) string {
+	if id, ok := auth.UserID(ctx); ok {
+		return id
+	}
+	id, _ := correlation.UserID(ctx)
+	return id
+}
+
+// Start creates an operation of a registered name with input, encoded as
+// JSON, and hands it to a worker. The user authenticated for the request
+// ctx belongs to, or the job it runs, becomes its owner.
+func (m *Manager) Start(ctx context.Context, name string, input interface{}) (*Operation, error) {
+	if _, ok := Lookup(name); !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknown, name)
+	}
+	encoded, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("async: can't encode the input of %s: %w", name, err)
+	}
+	fields := correlation.Capture(ctx)
+	op := &Operation{
+		ID:          uuid.NewString(),
+		Name:        name,
+		Status:      StatusPending,
+		Input:       Input(encoded),
+		Owner:       requester(ctx),
+		Correlation: fields,
+	}
+	if err := m.store.Create(ctx, op); err != nil {
+		return nil, err
+	}
+
+	if m.queue == nil {
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			m.run(op.ID)
+		}()
+		return op, nil
+	}
+	err = m.queue.Push(m.queueName, providers.Job{
+		ID:          op.ID,
+		Type:        JobType,
+		Payload:     map[string]interface{}{"operation_id": op.ID},
+		Correlation: fields,
+	})
+	if err != nil {
+		op.Status, op.Error = StatusFailed, "Operation could not be queued"
+		if finishErr := m.store.Finish(context.WithoutCancel(ctx), op); finishErr != nil {
+			m.logger.Error("Failed to fail operation", zap.String("id", op.ID), zap.Error(finishErr))
+		}
+		return nil, fmt.Errorf("async: queue %s: %w", name, err)
+	}
+	return op, nil
+}
+
+// Get returns an operation, or ErrNotFound
+func (m *Manager) Get(ctx context.Context, id string) (*Operation, error) {
+	return m.store.Get(ctx, id)
+}
+
+// JobHandler runs the operations of the jobs pushed to the manager's queue
+func (m *Manager) JobHandler() providers.JobHandler {
+	return func(job providers.Job) error {
+		id, _ := job.Payload["operation_id"].(string)
+		if job.Type != JobType || id == "" {
+			return fmt.Errorf("async: not an operation job: %s", job.ID)
+		}
+		m.run(id)
+		return nil
+	}
+}
+
+// Work fails operations left unfinished past the timeout and deletes
+// finished ones past the retention every interval, until Close
+func (m *Manager) Work(interval time.Duration) {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			ctx := context.Background()
+			now := time.Now()
+			if abandoned, err := m.store.Abandon(ctx, now.Add(-m.timeout-interval)); err != nil {
+				m.logger.Error("Failed to fail abandoned operations", zap.Error(err))
+			} else if abandoned > 0 {
+				m.logger.Warn("Failed abandoned operations", zap.Int("count", abandoned))
+			}
+			if _, err := m.store.Prune(ctx, now.Add(-m.retention)); err != nil {
+				m.logger.Error("Failed to prune operations", zap.Error(err))
+			}
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Close stops Work and waits for operations running in goroutines
+func (m *Manager) Close() {
+	m.once.Do(func() { close(m.stop) })
+	m.wg.Wait()
+}
+
+// run claims a pending operation, runs it and saves its outcome. An
+// operation already claimed, as by a redelivered job, is left alone.
+func (m *Manager) run(id string) {
+	op, err := m.store.Claim(context.Background(), id)
+	if errors.Is(err, ErrNotPending) {
+		return
+	}
+	if err != nil {
+		m.logger.Error("Failed to claim operation", zap.String("id", id), zap.Error(err))
+		return
+	}
+
+	err = correlation.Run(context.Background(), op.Correlation, "operation "+op.Name, func(ctx context.Context) error {
+		fn, ok := Lookup(op.Name)
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrUnknown, op.Name)
+		}
+		ctx, cancel := context.WithTimeout(ctx, m.timeout)
+		defer cancel()
+		result, err := call(ctx, fn, op.Input)
+		if err != nil {
+			return err
+		}
+		if result.Data != nil {
+			if op.Result, err = json.Marshal(result.Data); err != nil {
+				return fmt.Errorf("async: can't encode the result of %s: %w", op.Name, err)
+			}
+		}
+		op.ResultURL = result.URL
+		return nil
+	})
+
+	op.Status = StatusDone
+	if err != nil {
+		op.Status, op.Result, op.ResultURL = StatusFailed, nil, ""
+		op.Error = "Operation failed"
+		var known problem.Error
+		if errors.As(err, &known) {
+			op.Error = known.Problem().Detail
+		}
+		m.logger.Error("Operation failed", zap.String("id", op.ID), zap.String("operation", op.Name), zap.Error(err))
+	}
+	if err := m.store.Finish(context.Background(), op); err != nil {
+		m.logger.Error("Failed to save operation", zap.String("id", op.ID), zap.Error(err))
+	}
+}
+
+// call runs fn, turning panics into errors
+func call(ctx context.Context, fn Func, input Input) (result Result, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn(ctx, input)
+}
@@ -0,0 +1,261 @@
+package async
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/auth"
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/correlation"
+	"github.com/mrhoseah/dolphin/internal/database"
+	"github.com/mrhoseah/dolphin/internal/problem"
+	"github.com/mrhoseah/dolphin/internal/providers"
+	"github.com/mrhoseah/dolphin/internal/sse"
+)
+
+func init() {
+	Register("test.report", func(ctx context.Context, input Input) (Result, error) {
+		var params struct{ Month string }
+		if err := input.Decode(&params); err != nil {
+			return Result{}, err
+		}
+		return Result{URL: "/api/reports/" + params.Month, Data: map[string]int{"rows": 42}}, nil
+	})
+	Register("test.failing", func(ctx context.Context, input Input) (Result, error) {
+		var reason string
+		input.Decode(&reason)
+		if reason == "quota" {
+			return Result{}, problem.Domain("quota_exceeded", "Monthly export quota reached")
+		}
+		return Result{}, errors.New("connection refused by 10.0.0.7")
+	})
+	Register("test.slow", func(ctx context.Context, input Input) (Result, error) {
+		var gate string
+		input.Decode(&gate)
+		release, _ := gates.Load(gate)
+		<-release.(chan struct{})
+		return Result{URL: "/api/exports/1"}, nil
+	})
+}
+
+// gates hold test.slow operations until their test releases them
+var gates sync.Map
+
+func newTestManager(t *testing.T) (*Manager, http.Handler) {
+	m := NewManager(nil, nil)
+	m.SetRetryAfter(20 * time.Millisecond)
+	t.Cleanup(m.Close)
+	r := chi.NewRouter()
+	r.Route("/api/operations", m.Routes)
+	return m, r
+}
+
+func get(h http.Handler, ctx context.Context, url string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil).WithContext(ctx))
+	return rec
+}
+
+func TestAcceptAndStatus(t *testing.T) {
+	m, routes := newTestManager(t)
+	ctx := context.Background()
+
+	op, err := m.Start(ctx, "test.report", map[string]string{"Month": "2026-09"})
+	require.NoError(t, err)
+	rec := httptest.NewRecorder()
+	require.NoError(t, m.Accept(rec, httptest.NewRequest(http.MethodPost, "/api/reports", nil), op))
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Equal(t, "/api/operations/"+op.ID, rec.Header().Get("Location"))
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+	assert.Contains(t, rec.Body.String(), `"status":"pending"`)
+
+	m.Close()
+	rec = get(routes, ctx, "/api/operations/"+op.ID)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get("Retry-After"), "finished")
+	var status StatusResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	assert.Equal(t, StatusDone, status.Status)
+	assert.Equal(t, "/api/reports/2026-09", status.ResultURL)
+	assert.JSONEq(t, `{"rows":42}`, string(status.Result))
+	assert.Equal(t, "/api/operations/"+op.ID+"/events", status.EventsURL)
+
+	assert.Equal(t, http.StatusNotFound, get(routes, ctx, "/api/operations/missing").Code)
+	_, err = m.Start(ctx, "test.unknown", nil)
+	assert.ErrorIs(t, err, ErrUnknown)
+}
+
+func TestFailedOperationsHideInternalErrors(t *testing.T) {
+	m, _ := newTestManager(t)
+	ctx := context.Background()
+
+	internal, err := m.Start(ctx, "test.failing", "network")
+	require.NoError(t, err)
+	domain, err := m.Start(ctx, "test.failing", "quota")
+	require.NoError(t, err)
+	m.Close()
+
+	op, err := m.Get(ctx, internal.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusFailed, op.Status)
+	assert.Equal(t, "Operation failed", op.Error)
+	op, err = m.Get(ctx, domain.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Monthly export quota reached", op.Error)
+}
+
+func TestStatusIsOnlyShownToOwner(t *testing.T) {
+	m, routes := newTestManager(t)
+	owner := auth.WithUser(context.Background(), &auth.User{ID: 7})
+
+	op, err := m.Start(owner, "test.report", map[string]string{"Month": "2026-09"})
+	require.NoError(t, err)
+	assert.Equal(t, "7", op.Owner)
+
+	// Jobs start operations for the user they were queued for
+	queued, err := m.Start(correlation.WithUser(context.Background(), "8"), "test.report", map[string]string{"Month": "2026-10"})
+	require.NoError(t, err)
+	assert.Equal(t, "8", queued.Owner)
+	m.Close()
+
+	assert.Equal(t, http.StatusOK, get(routes, owner, "/api/operations/"+op.ID).Code)
+	assert.Equal(t, http.StatusNotFound, get(routes, auth.WithUser(context.Background(), &auth.User{ID: 8}), "/api/operations/"+op.ID).Code)
+	assert.Equal(t, http.StatusNotFound, get(routes, context.Background(), "/api/operations/"+op.ID).Code, "a guest")
+}
+
+// recordingQueue keeps pushed jobs for the test to run
+type recordingQueue struct {
+	providers.QueueProvider
+	jobs []providers.Job
+}
+
+func (q *recordingQueue) Push(queue string, job providers.Job) error {
+	q.jobs = append(q.jobs, job)
+	return nil
+}
+
+func TestQueuedOperationsRunOnce(t *testing.T) {
+	store := newDBStore(t)
+	m := NewManager(store, nil)
+	queue := &recordingQueue{}
+	m.UseQueue(queue, "operations")
+	ctx := context.Background()
+
+	op, err := m.Start(ctx, "test.report", map[string]string{"Month": "2026-10"})
+	require.NoError(t, err)
+	require.Len(t, queue.jobs, 1)
+	assert.Equal(t, JobType, queue.jobs[0].Type)
+
+	handler := m.JobHandler()
+	require.NoError(t, handler(queue.jobs[0]))
+	require.NoError(t, handler(queue.jobs[0]), "redelivered")
+	stored, err := store.Get(ctx, op.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusDone, stored.Status)
+	assert.Equal(t, "/api/reports/2026-10", stored.ResultURL)
+	assert.Error(t, handler(providers.Job{ID: "x", Type: "other"}))
+}
+
+func TestAbandonAndPrune(t *testing.T) {
+	store := newDBStore(t)
+	ctx := context.Background()
+	for _, op := range []*Operation{
+		{ID: "stuck", Name: "test.report", Status: StatusPending},
+		{ID: "finished", Name: "test.report", Status: StatusPending},
+	} {
+		require.NoError(t, store.Create(ctx, op))
+	}
+	claimed, err := store.Claim(ctx, "finished")
+	require.NoError(t, err)
+	assert.Equal(t, StatusProcessing, claimed.Status)
+	_, err = store.Claim(ctx, "finished")
+	assert.ErrorIs(t, err, ErrNotPending)
+	claimed.Status = StatusDone
+	require.NoError(t, store.Finish(ctx, claimed))
+
+	abandoned, err := store.Abandon(ctx, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 1, abandoned)
+	stuck, err := store.Get(ctx, "stuck")
+	require.NoError(t, err)
+	assert.Equal(t, StatusFailed, stuck.Status)
+	assert.Equal(t, "Operation was interrupted", stuck.Error)
+
+	pruned, err := store.Prune(ctx, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, pruned, "too recent")
+	pruned, err = store.Prune(ctx, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 2, pruned)
+	_, err = store.Get(ctx, "stuck")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestEventsAndPoll(t *testing.T) {
+	release := make(chan struct{})
+	var once sync.Once
+	gates.Store(t.Name(), release)
+	m, routes := newTestManager(t)
+	m.streams = sse.NewHub(config.SSEConfig{Heartbeat: time.Minute}, nil)
+	// The stream outlives the request timeout
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeoutCause(r.Context(), time.Millisecond, problem.ErrRequestTimeout)
+		defer cancel()
+		routes.ServeHTTP(w, r.WithContext(ctx))
+	}))
+	defer server.Close()
+	defer once.Do(func() { close(release) })
+
+	op, err := m.Start(context.Background(), "test.slow", t.Name())
+	require.NoError(t, err)
+
+	resp, err := http.Get(server.URL + m.StatusURL(op.ID) + "/events")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	var statuses []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var status StatusResponse
+		require.NoError(t, json.Unmarshal([]byte(line), &status))
+		statuses = append(statuses, string(status.Status))
+		if status.Status == StatusProcessing {
+			once.Do(func() { close(release) })
+		}
+	}
+	require.NotEmpty(t, statuses)
+	assert.Contains(t, statuses, "processing")
+	assert.Equal(t, "done", statuses[len(statuses)-1], "the stream ends when the operation finishes")
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+m.StatusURL(op.ID), nil)
+	require.NoError(t, err)
+	status, err := Poll(context.Background(), server.Client(), req)
+	require.NoError(t, err)
+	assert.Equal(t, "/api/exports/1", status.ResultURL)
+}
+
+func newDBStore(t *testing.T) *DBStore {
+	manager, err := database.New(&config.DatabaseConfig{Driver: "sqlite", Database: filepath.Join(t.TempDir(), "app.db")})
+	require.NoError(t, err)
+	store, err := NewDBStore(manager.GetDB())
+	require.NoError(t, err)
+	return store
+}
@@ -0,0 +1,211 @@
+package async
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/problem"
+	"github.com/mrhoseah/dolphin/internal/sse"
+)
+
+// StatusResponse is the body of the 202 Accepted response and of the
+// status endpoint
+type StatusResponse struct {
+	ID        string          `json:"id"`
+	Operation string          `json:"operation"`
+	Status    Status          `json:"status"`
+	StatusURL string          `json:"status_url"`
+	EventsURL string          `json:"events_url"`
+	ResultURL string          `json:"result_url,omitempty"`
+	Result    json.RawMessage `json:"result,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// StatusURL returns the URL of an operation's status endpoint
+func (m *Manager) StatusURL(id string) string {
+	return strings.TrimSuffix(m.path, "/") + "/" + id
+}
+
+// response describes an operation to its client
+func (m *Manager) response(op *Operation) StatusResponse {
+	return StatusResponse{
+		ID:        op.ID,
+		Operation: op.Name,
+		Status:    op.Status,
+		StatusURL: m.StatusURL(op.ID),
+		EventsURL: m.StatusURL(op.ID) + "/events",
+		ResultURL: op.ResultURL,
+		Result:    op.Result,
+		Error:     op.Error,
+		CreatedAt: op.CreatedAt,
+		UpdatedAt: op.UpdatedAt,
+	}
+}
+
+// Accept answers a request with 202 Accepted for a started operation,
+// pointing the client at its status endpoint with Location and telling it
+// how long to wait before polling with Retry-After
+func (m *Manager) Accept(w http.ResponseWriter, r *http.Request, op *Operation) error {
+	w.Header().Set("Location", m.StatusURL(op.ID))
+	m.setRetryAfter(w)
+	render.Status(r, http.StatusAccepted)
+	render.JSON(w, r, m.response(op))
+	return nil
+}
+
+// Routes registers the status endpoints on r, typically under /api/operations:
+//
+//	GET /{id}         the operation's status
+//	GET /{id}/events  server-sent status events until it finishes
+//
+// Operations started by a signed-in user are only shown to that user.
+func (m *Manager) Routes(r chi.Router) {
+	r.Get("/{id}", m.status)
+	r.Get("/{id}/events", m.events)
+}
+
+func (m *Manager) status(w http.ResponseWriter, r *http.Request) {
+	op, err := m.find(r)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	if !op.Status.Finished() {
+		m.setRetryAfter(w)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	render.JSON(w, r, m.response(op))
+}
+
+// events sends the operation's status whenever it changes, and closes the
+// stream once it has finished
+func (m *Manager) events(w http.ResponseWriter, r *http.Request) {
+	op, err := m.find(r)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	streams := m.streams
+	if streams == nil {
+		streams = sse.Default
+	}
+	stream, err := streams.Stream(w, r)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	stream.Run(m.statuses(stream.Context(), op))
+}
+
+// statuses sends op's status whenever it changes, until it has finished or
+// ctx is done
+func (m *Manager) statuses(ctx context.Context, op *Operation) <-chan sse.Event {
+	events := make(chan sse.Event)
+	go func() {
+		defer close(events)
+		poll := time.NewTicker(m.retryAfter)
+		defer poll.Stop()
+		var last Status
+		var lastUpdate time.Time
+		for {
+			if op.Status != last || !op.UpdatedAt.Equal(lastUpdate) {
+				last, lastUpdate = op.Status, op.UpdatedAt
+				select {
+				case events <- sse.Event{Name: "status", Data: m.response(op)}:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if op.Status.Finished() {
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-poll.C:
+			}
+			id := op.ID
+			var err error
+			if op, err = m.store.Get(ctx, id); err != nil {
+				if ctx.Err() == nil {
+					m.logger.Warn("Failed to read operation", zap.String("id", id), zap.Error(err))
+				}
+				return
+			}
+		}
+	}()
+	return events
+}
+
+// find returns the operation the route names, hiding those of other users
+func (m *Manager) find(r *http.Request) (*Operation, error) {
+	id := chi.URLParam(r, "id")
+	op, err := m.store.Get(r.Context(), id)
+	if errors.Is(err, ErrNotFound) {
+		return nil, problem.NotFound("operation", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if op.Owner != "" && requester(r.Context()) != op.Owner {
+		return nil, problem.NotFound("operation", id)
+	}
+	return op, nil
+}
+
+func (m *Manager) setRetryAfter(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(m.retryAfter.Seconds()))))
+}
+
+// Poll requests an operation's status endpoint until the operation
+// finishes or ctx is done, waiting between requests as the responses'
+// Retry-After says. req is a GET of the status URL, cloned for every
+// request, so it carries the headers the endpoint needs.
+func Poll(ctx context.Context, client *http.Client, req *http.Request) (*StatusResponse, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	for {
+		resp, err := client.Do(req.Clone(ctx))
+		if err != nil {
+			return nil, err
+		}
+		var status StatusResponse
+		err = json.NewDecoder(resp.Body).Decode(&status)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+			return nil, fmt.Errorf("async: %s answered %s", req.URL, resp.Status)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("async: invalid status from %s: %w", req.URL, err)
+		}
+		if status.Status.Finished() {
+			return &status, nil
+		}
+
+		wait := time.Second
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			wait = time.Duration(seconds) * time.Second
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
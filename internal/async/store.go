@@ -0,0 +1,284 @@
+package async
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/mrhoseah/dolphin/internal/correlation"
+)
+
+// Store persists operations
+type Store interface {
+	// Create saves a new operation
+	Create(ctx context.Context, op *Operation) error
+
+	// Get returns an operation, or ErrNotFound
+	Get(ctx context.Context, id string) (*Operation, error)
+
+	// Claim marks a pending operation as processing and returns it, or
+	// returns ErrNotPending when another worker has it
+	Claim(ctx context.Context, id string) (*Operation, error)
+
+	// Finish saves a claimed operation's status, result and error
+	Finish(ctx context.Context, op *Operation) error
+
+	// Abandon fails the unfinished operations last updated before a time,
+	// returning how many there were
+	Abandon(ctx context.Context, before time.Time) (int, error)
+
+	// Prune deletes the finished operations last updated before a time,
+	// returning how many there were
+	Prune(ctx context.Context, before time.Time) (int, error)
+}
+
+// abandonedError is the detail of operations failed by Abandon
+const abandonedError = "Operation was interrupted"
+
+// MemoryStore keeps operations in memory, for tests and single instances
+// whose operations needn't survive a restart
+type MemoryStore struct {
+	mu         sync.Mutex
+	operations map[string]Operation
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{operations: map[string]Operation{}}
+}
+
+func (s *MemoryStore) Create(ctx context.Context, op *Operation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	op.CreatedAt, op.UpdatedAt = now, now
+	s.operations[op.ID] = *op
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (*Operation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	op, ok := s.operations[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &op, nil
+}
+
+func (s *MemoryStore) Claim(ctx context.Context, id string) (*Operation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	op, ok := s.operations[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if op.Status != StatusPending {
+		return nil, ErrNotPending
+	}
+	op.Status = StatusProcessing
+	op.UpdatedAt = time.Now().UTC()
+	s.operations[id] = op
+	return &op, nil
+}
+
+func (s *MemoryStore) Finish(ctx context.Context, op *Operation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.operations[op.ID]; !ok {
+		return ErrNotFound
+	}
+	op.UpdatedAt = time.Now().UTC()
+	s.operations[op.ID] = *op
+	return nil
+}
+
+func (s *MemoryStore) Abandon(ctx context.Context, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for id, op := range s.operations {
+		if !op.Status.Finished() && op.UpdatedAt.Before(before) {
+			op.Status, op.Error, op.UpdatedAt = StatusFailed, abandonedError, time.Now().UTC()
+			s.operations[id] = op
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *MemoryStore) Prune(ctx context.Context, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for id, op := range s.operations {
+		if op.Status.Finished() && op.UpdatedAt.Before(before) {
+			delete(s.operations, id)
+			count++
+		}
+	}
+	return count, nil
+}
+
+// OperationRecord is the row DBStore keeps per operation
+type OperationRecord struct {
+	ID          string `gorm:"primarykey;size:36"`
+	Name        string `gorm:"size:100;not null"`
+	Status      string `gorm:"size:20;index:idx_async_operations_status_updated;not null"`
+	Input       string `gorm:"type:text"`
+	Result      string `gorm:"type:text"`
+	ResultURL   string `gorm:"size:2048"`
+	Error       string `gorm:"type:text"`
+	Owner       string `gorm:"size:100"`
+	Correlation string `gorm:"type:text"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time `gorm:"index:idx_async_operations_status_updated"`
+}
+
+// TableName returns the table name for the OperationRecord model
+func (OperationRecord) TableName() string {
+	return "async_operations"
+}
+
+// DBStore keeps operations in the application database, so every instance
+// can report on them
+type DBStore struct {
+	db *gorm.DB
+}
+
+// NewDBStore creates a database operation store, creating its table if
+// needed
+func NewDBStore(db *gorm.DB) (*DBStore, error) {
+	if err := db.AutoMigrate(&OperationRecord{}); err != nil {
+		return nil, err
+	}
+	return &DBStore{db: db}, nil
+}
+
+func (s *DBStore) Create(ctx context.Context, op *Operation) error {
+	now := time.Now().UTC()
+	op.CreatedAt, op.UpdatedAt = now, now
+	record, err := toRecord(op)
+	if err != nil {
+		return err
+	}
+	return s.db.WithContext(ctx).Create(&record).Error
+}
+
+func (s *DBStore) Get(ctx context.Context, id string) (*Operation, error) {
+	var record OperationRecord
+	err := s.db.WithContext(ctx).Where("id = ?", id).First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fromRecord(record)
+}
+
+func (s *DBStore) Claim(ctx context.Context, id string) (*Operation, error) {
+	result := s.db.WithContext(ctx).Model(&OperationRecord{}).
+		Where("id = ? AND status = ?", id, string(StatusPending)).
+		Updates(map[string]interface{}{
+			"status":     string(StatusProcessing),
+			"updated_at": time.Now().UTC(),
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		if _, err := s.Get(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrNotPending
+	}
+	return s.Get(ctx, id)
+}
+
+func (s *DBStore) Finish(ctx context.Context, op *Operation) error {
+	op.UpdatedAt = time.Now().UTC()
+	result := s.db.WithContext(ctx).Model(&OperationRecord{}).
+		Where("id = ?", op.ID).
+		Updates(map[string]interface{}{
+			"status":     string(op.Status),
+			"result":     string(op.Result),
+			"result_url": op.ResultURL,
+			"error":      op.Error,
+			"updated_at": op.UpdatedAt,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *DBStore) Abandon(ctx context.Context, before time.Time) (int, error) {
+	result := s.db.WithContext(ctx).Model(&OperationRecord{}).
+		Where("status IN ? AND updated_at < ?", []string{string(StatusPending), string(StatusProcessing)}, before.UTC()).
+		Updates(map[string]interface{}{
+			"status":     string(StatusFailed),
+			"error":      abandonedError,
+			"updated_at": time.Now().UTC(),
+		})
+	return int(result.RowsAffected), result.Error
+}
+
+func (s *DBStore) Prune(ctx context.Context, before time.Time) (int, error) {
+	result := s.db.WithContext(ctx).
+		Where("status IN ? AND updated_at < ?", []string{string(StatusDone), string(StatusFailed)}, before.UTC()).
+		Delete(&OperationRecord{})
+	return int(result.RowsAffected), result.Error
+}
+
+func toRecord(op *Operation) (OperationRecord, error) {
+	fields, err := json.Marshal(op.Correlation)
+	if err != nil {
+		return OperationRecord{}, err
+	}
+	return OperationRecord{
+		ID:          op.ID,
+		Name:        op.Name,
+		Status:      string(op.Status),
+		Input:       string(op.Input),
+		Result:      string(op.Result),
+		ResultURL:   op.ResultURL,
+		Error:       op.Error,
+		Owner:       op.Owner,
+		Correlation: string(fields),
+		CreatedAt:   op.CreatedAt,
+		UpdatedAt:   op.UpdatedAt,
+	}, nil
+}
+
+func fromRecord(record OperationRecord) (*Operation, error) {
+	op := &Operation{
+		ID:        record.ID,
+		Name:      record.Name,
+		Status:    Status(record.Status),
+		Input:     Input(record.Input),
+		ResultURL: record.ResultURL,
+		Error:     record.Error,
+		Owner:     record.Owner,
+		CreatedAt: record.CreatedAt,
+		UpdatedAt: record.UpdatedAt,
+	}
+	if record.Result != "" {
+		op.Result = json.RawMessage(record.Result)
+	}
+	if record.Correlation != "" && record.Correlation != "null" {
+		var fields correlation.Fields
+		if err := json.Unmarshal([]byte(record.Correlation), &fields); err != nil {
+			return nil, err
+		}
+		op.Correlation = fields
+	}
+	return op, nil
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// identity holds the user the auth middleware authenticated for a request
+type identity struct {
+	mutex sync.RWMutex
+	user  Authenticatable
+}
+
+type identityKey struct{}
+
+// Identify gives every request a place for the user the auth middleware
+// authenticates further in. Middleware mounted before the auth middleware
+// only see that user once the handler has run, which is enough for those
+// recording it afterwards, such as tracing.
+func Identify(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, &identity{})))
+	})
+}
+
+// WithUser returns a copy of ctx in which user is the authenticated user of
+// the request, which is also recorded for the middleware Identify runs
+// outside of it
+func WithUser(ctx context.Context, user Authenticatable) context.Context {
+	if id, ok := ctx.Value(identityKey{}).(*identity); ok {
+		id.mutex.Lock()
+		id.user = user
+		id.mutex.Unlock()
+		return ctx
+	}
+	return context.WithValue(ctx, identityKey{}, &identity{user: user})
+}
+
+// UserFromContext returns the user authenticated for the request ctx
+// belongs to
+func UserFromContext(ctx context.Context) (Authenticatable, bool) {
+	id, ok := ctx.Value(identityKey{}).(*identity)
+	if !ok {
+		return nil, false
+	}
+	id.mutex.RLock()
+	defer id.mutex.RUnlock()
+	return id.user, id.user != nil
+}
+
+// UserID returns the ID of the user authenticated for the request ctx
+// belongs to, as jobs, traces and per-user stores key it
+func UserID(ctx context.Context) (string, bool) {
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		return "", false
+	}
+	return strconv.FormatUint(uint64(user.GetID()), 10), true
+}
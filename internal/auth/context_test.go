@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserFromContext(t *testing.T) {
+	_, ok := UserFromContext(context.Background())
+	assert.False(t, ok)
+
+	ctx := WithUser(context.Background(), &User{ID: 7})
+	user, ok := UserFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, uint(7), user.GetID())
+	id, ok := UserID(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "7", id)
+}
+
+func TestIdentify(t *testing.T) {
+	var seen []string
+	outer := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, before := UserID(r.Context())
+			next.ServeHTTP(w, r)
+			after, _ := UserID(r.Context())
+			assert.False(t, before, "nobody is authenticated yet")
+			seen = append(seen, after)
+		})
+	}
+	authenticate := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), &User{ID: 42})))
+		})
+	}
+	handler := Identify(outer(authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, []string{"42", "42"}, seen, "middleware outside auth see the user once the handler ran")
+
+	// Each request has its own identity
+	guest := Identify(outer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	guest.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, "", seen[2])
+}
@@ -0,0 +1,413 @@
+package binding
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mrhoseah/dolphin/internal/validation"
+)
+
+// Source identifies where a field value is read from
+type Source string
+
+const (
+	SourcePath   Source = "path"
+	SourceQuery  Source = "query"
+	SourceHeader Source = "header"
+	SourceBody   Source = "body"
+)
+
+// DefaultPrecedence is used for fields without a source tag. Earlier
+// sources win: a route param overrides a query value which overrides the body.
+var DefaultPrecedence = []Source{SourcePath, SourceQuery, SourceBody}
+
+// FieldError describes a single field that could not be bound
+type FieldError struct {
+	Field   string `json:"field"`
+	Source  Source `json:"source"`
+	Message string `json:"message"`
+}
+
+// Errors aggregates every binding failure for a request
+type Errors struct {
+	Errors []FieldError `json:"errors"`
+}
+
+// Error implements error
+func (e *Errors) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		messages = append(messages, fmt.Sprintf("%s (%s): %s", fe.Field, fe.Source, fe.Message))
+	}
+	return "binding failed: " + strings.Join(messages, "; ")
+}
+
+// add records a field error
+func (e *Errors) add(field string, source Source, message string) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Source: source, Message: message})
+}
+
+// Binder populates structs from several parts of an HTTP request
+type Binder struct {
+	// Precedence applies to fields without a source tag
+	Precedence []Source
+
+	// Limits bound body parsing; when zero, limits set by WithLimits on
+	// the request context apply, falling back to DefaultBodyLimits
+	Limits BodyLimits
+
+	// MaxBodyBytes overrides Limits.MaxBytes when set
+	MaxBodyBytes int64
+
+	validator *validation.FieldValidator
+}
+
+// NewBinder creates a binder with default precedence and validation
+func NewBinder() *Binder {
+	return &Binder{
+		Precedence: DefaultPrecedence,
+		validator:  validation.NewFieldValidator(),
+	}
+}
+
+// Bind populates dst using a default binder
+func Bind(r *http.Request, dst interface{}) error {
+	return NewBinder().Bind(r, dst)
+}
+
+// BindAndValidate populates dst and then runs `validate` tag rules
+func BindAndValidate(r *http.Request, dst interface{}) error {
+	return NewBinder().BindAndValidate(r, dst)
+}
+
+// BindAndValidate populates dst and then runs `validate` tag rules
+func (b *Binder) BindAndValidate(r *http.Request, dst interface{}) error {
+	if err := b.Bind(r, dst); err != nil {
+		return err
+	}
+	return b.validator.Validate(dst)
+}
+
+// fieldSource is one source/key pair from a `source` tag
+type fieldSource struct {
+	source Source
+	key    string
+}
+
+// requestData holds the parsed parts of a request
+type requestData struct {
+	r    *http.Request
+	body *Body
+
+	// consumed records body keys bound to a field, for unknown field checks
+	consumed map[string]bool
+}
+
+// Bind populates dst (a pointer to struct) from the request.
+//
+// Fields use `source:"path=id,query=id"` to list sources in precedence
+// order. A bare source ("query") uses the field's json name as key.
+// Fields without a tag follow the binder's Precedence.
+//
+// A body that cannot be parsed or exceeds the limits yields a *BodyError
+// carrying the HTTP status to respond with; field failures yield *Errors.
+func (b *Binder) Bind(r *http.Request, dst interface{}) error {
+	val := reflect.ValueOf(dst)
+	if val.Kind() != reflect.Ptr || val.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("binding target must be a pointer to struct")
+	}
+
+	limits := b.limits(r)
+	body, err := ParseBody(r, limits)
+	if err != nil {
+		return err
+	}
+
+	errs := &Errors{}
+	data := &requestData{r: r, body: body, consumed: map[string]bool{}}
+	b.bindStruct(val.Elem(), data, errs)
+
+	if limits.DisallowUnknownFields {
+		for _, key := range body.Keys() {
+			if !data.consumed[key] && !b.declares(val.Elem().Type(), key) {
+				errs.add(key, SourceBody, "unknown field")
+			}
+		}
+	}
+
+	if len(errs.Errors) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// bindStruct binds every exported field of v
+func (b *Binder) bindStruct(v reflect.Value, data *requestData, errs *Errors) {
+	typ := v.Type()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		fieldType := typ.Field(i)
+
+		if !field.CanSet() {
+			continue
+		}
+
+		// Embedded structs are flattened
+		if fieldType.Anonymous && field.Kind() == reflect.Struct {
+			b.bindStruct(field, data, errs)
+			continue
+		}
+
+		tag := fieldType.Tag.Get("source")
+		if tag == "-" {
+			continue
+		}
+
+		name := fieldName(fieldType)
+		for _, fs := range b.sources(tag, name) {
+			found, err := b.bindField(field, fs, data)
+			if err != nil {
+				errs.add(name, fs.source, err.Error())
+				break
+			}
+			if found {
+				break
+			}
+		}
+	}
+}
+
+// sources parses a source tag, falling back to the binder precedence
+func (b *Binder) sources(tag, name string) []fieldSource {
+	if tag == "" {
+		result := make([]fieldSource, 0, len(b.Precedence))
+		for _, s := range b.Precedence {
+			result = append(result, fieldSource{source: s, key: name})
+		}
+		return result
+	}
+
+	var result []fieldSource
+	for _, part := range strings.Split(tag, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key := name
+		if idx := strings.Index(part, "="); idx != -1 {
+			key = part[idx+1:]
+			part = part[:idx]
+		}
+		result = append(result, fieldSource{source: Source(part), key: key})
+	}
+	return result
+}
+
+// bindField sets field from a single source; found is false when absent
+func (b *Binder) bindField(field reflect.Value, fs fieldSource, data *requestData) (bool, error) {
+	switch fs.source {
+	case SourcePath:
+		value := ""
+		if rctx := chi.RouteContext(data.r.Context()); rctx != nil {
+			value = rctx.URLParam(fs.key)
+		}
+		if value == "" {
+			return false, nil
+		}
+		return true, setFromStrings(field, []string{value})
+	case SourceQuery:
+		values, ok := data.r.URL.Query()[fs.key]
+		if !ok {
+			return false, nil
+		}
+		return true, setFromStrings(field, values)
+	case SourceHeader:
+		values := data.r.Header.Values(fs.key)
+		if len(values) == 0 {
+			return false, nil
+		}
+		return true, setFromStrings(field, values)
+	case SourceBody:
+		if raw, ok := data.body.Fields[fs.key]; ok {
+			data.consumed[fs.key] = true
+			if err := json.Unmarshal(raw, field.Addr().Interface()); err != nil {
+				return true, fmt.Errorf("invalid value: %v", err)
+			}
+			return true, nil
+		}
+		if files, ok := data.body.Files[fs.key]; ok && bindFiles(field, files) {
+			data.consumed[fs.key] = true
+			return true, nil
+		}
+		if values, ok := data.body.Form[fs.key]; ok {
+			data.consumed[fs.key] = true
+			return true, setFromStrings(field, values)
+		}
+		return false, nil
+	default:
+		return false, fmt.Errorf("unknown source %q", fs.source)
+	}
+}
+
+// limits resolves the body limits for a request
+func (b *Binder) limits(r *http.Request) BodyLimits {
+	limits := b.Limits
+	if limits == (BodyLimits{}) {
+		limits = LimitsFromContext(r.Context())
+	}
+	if b.MaxBodyBytes > 0 {
+		limits.MaxBytes = b.MaxBodyBytes
+	}
+	return limits
+}
+
+// declares reports whether typ has a field that may read key from the body,
+// covering fields skipped because a higher precedence source supplied them
+func (b *Binder) declares(typ reflect.Type, key string) bool {
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			if b.declares(f.Type, key) {
+				return true
+			}
+			continue
+		}
+		tag := f.Tag.Get("source")
+		if tag == "-" || !f.IsExported() {
+			continue
+		}
+		for _, fs := range b.sources(tag, fieldName(f)) {
+			if fs.source == SourceBody && fs.key == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var fileHeaderType = reflect.TypeOf((*multipart.FileHeader)(nil))
+
+// bindFiles sets *multipart.FileHeader and []*multipart.FileHeader fields
+func bindFiles(field reflect.Value, files []*multipart.FileHeader) bool {
+	switch {
+	case field.Type() == fileHeaderType && len(files) > 0:
+		field.Set(reflect.ValueOf(files[0]))
+		return true
+	case field.Kind() == reflect.Slice && field.Type().Elem() == fileHeaderType:
+		field.Set(reflect.ValueOf(files))
+		return true
+	}
+	return false
+}
+
+// fieldName returns the json name of a field, or its Go name
+func fieldName(f reflect.StructField) string {
+	if tag := f.Tag.Get("json"); tag != "" {
+		if name := strings.Split(tag, ",")[0]; name != "" && name != "-" {
+			return name
+		}
+	}
+	return f.Name
+}
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	timeType            = reflect.TypeOf(time.Time{})
+)
+
+// setFromStrings converts string values into the field's type
+func setFromStrings(field reflect.Value, values []string) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	if field.Kind() == reflect.Ptr {
+		ptr := reflect.New(field.Type().Elem())
+		if err := setFromStrings(ptr.Elem(), values); err != nil {
+			return err
+		}
+		field.Set(ptr)
+		return nil
+	}
+
+	if field.Addr().Type().Implements(textUnmarshalerType) {
+		return field.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(values[0]))
+	}
+
+	if field.Kind() == reflect.Slice && field.Type().Elem().Kind() != reflect.Uint8 {
+		// Accept repeated keys as well as comma separated lists
+		if len(values) == 1 && strings.Contains(values[0], ",") {
+			values = strings.Split(values[0], ",")
+		}
+		slice := reflect.MakeSlice(field.Type(), len(values), len(values))
+		for i, v := range values {
+			if err := setScalar(slice.Index(i), strings.TrimSpace(v)); err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+		return nil
+	}
+
+	return setScalar(field, values[0])
+}
+
+// setScalar converts a single string into a scalar field
+func setScalar(field reflect.Value, value string) error {
+	if field.Type() == timeType {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return fmt.Errorf("must be an RFC3339 timestamp")
+		}
+		field.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("must be a boolean")
+		}
+		field.SetBool(v)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if field.Type() == reflect.TypeOf(time.Duration(0)) {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("must be a duration")
+			}
+			field.SetInt(int64(d))
+			return nil
+		}
+		v, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be an integer")
+		}
+		field.SetInt(v)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be a positive integer")
+		}
+		field.SetUint(v)
+	case reflect.Float32, reflect.Float64:
+		v, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be a number")
+		}
+		field.SetFloat(v)
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package binding
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// withParams adds chi route params to r
+func withParams(r *http.Request, params map[string]string) *http.Request {
+	rctx := chi.NewRouteContext()
+	for k, v := range params {
+		rctx.URLParams.Add(k, v)
+	}
+	return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+}
+
+func TestBindTagPrecedence(t *testing.T) {
+	type request struct {
+		ID     string `json:"id" source:"query=user,path=id"`
+		Tenant string `json:"tenant" source:"header=X-Tenant,body"`
+		Secret string `json:"secret" source:"-"`
+	}
+
+	r := withParams(newRequest("application/json", []byte(`{"tenant":"body","secret":"s"}`)), map[string]string{"id": "path"})
+	r.URL.RawQuery = "user=query"
+	r.Header.Set("X-Tenant", "header")
+
+	var dst request
+	if err := Bind(r, &dst); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dst.ID != "query" || dst.Tenant != "header" || dst.Secret != "" {
+		t.Fatalf("expected the first listed source to win, got %+v", dst)
+	}
+
+	r = withParams(newRequest("application/json", []byte(`{"tenant":"body"}`)), map[string]string{"id": "path"})
+	dst = request{}
+	if err := Bind(r, &dst); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dst.ID != "path" || dst.Tenant != "body" {
+		t.Fatalf("expected later sources when earlier ones are absent, got %+v", dst)
+	}
+}
+
+func TestBindDefaultPrecedence(t *testing.T) {
+	type request struct {
+		ID    int      `json:"id"`
+		Names []string `json:"names"`
+	}
+
+	tests := []struct {
+		name   string
+		params map[string]string
+		query  string
+		body   string
+		id     int
+	}{
+		{"path wins", map[string]string{"id": "1"}, "id=2", `{"id":3}`, 1},
+		{"query over body", nil, "id=2", `{"id":3}`, 2},
+		{"body last", nil, "", `{"id":3}`, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := withParams(newRequest("application/json", []byte(tt.body)), tt.params)
+			r.URL.RawQuery = tt.query
+
+			var dst request
+			if err := Bind(r, &dst); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if dst.ID != tt.id {
+				t.Fatalf("expected id %d, got %d", tt.id, dst.ID)
+			}
+		})
+	}
+
+	// A binder's own precedence replaces the default for untagged fields
+	binder := &Binder{Precedence: []Source{SourceBody, SourceQuery}}
+	r := newRequest("application/json", []byte(`{"id":3}`))
+	r.URL.RawQuery = "id=2&names=a,b"
+	var dst request
+	if err := binder.Bind(r, &dst); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dst.ID != 3 || len(dst.Names) != 2 || dst.Names[1] != "b" {
+		t.Fatalf("expected the body first and the query as fallback, got %+v", dst)
+	}
+}
+
+func TestBindAggregatesErrors(t *testing.T) {
+	type request struct {
+		Page   int    `json:"page" source:"query"`
+		Active bool   `json:"active" source:"header=X-Active"`
+		Count  uint   `json:"count" source:"body"`
+		Name   string `json:"name" source:"body"`
+	}
+
+	r := newRequest("application/json", []byte(`{"count":"many","name":"ok"}`))
+	r.URL.RawQuery = "page=first"
+	r.Header.Set("X-Active", "maybe")
+
+	var dst request
+	err := Bind(r, &dst)
+	var errs *Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected *Errors, got %v", err)
+	}
+	if len(errs.Errors) != 3 {
+		t.Fatalf("expected 3 field errors, got %v", errs.Errors)
+	}
+	expected := []struct {
+		field  string
+		source Source
+	}{{"page", SourceQuery}, {"active", SourceHeader}, {"count", SourceBody}}
+	for i, e := range expected {
+		if errs.Errors[i].Field != e.field || errs.Errors[i].Source != e.source {
+			t.Fatalf("expected error %d on %s (%s), got %+v", i, e.field, e.source, errs.Errors[i])
+		}
+	}
+	if dst.Name != "ok" {
+		t.Fatalf("expected valid fields to bind despite the errors, got %+v", dst)
+	}
+}
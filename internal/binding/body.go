@@ -0,0 +1,372 @@
+package binding
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// BodyLimits bounds what a request body may contain
+type BodyLimits struct {
+	// MaxBytes caps the body size; larger bodies are rejected with 413
+	MaxBytes int64
+
+	// MaxDepth caps object/array nesting, protecting against JSON bombs
+	MaxDepth int
+
+	// MaxArrayLength caps elements per array (or repeated form keys)
+	MaxArrayLength int
+
+	// DisallowUnknownFields rejects body fields the target struct lacks
+	DisallowUnknownFields bool
+}
+
+// DefaultBodyLimits are used when no limits are configured
+var DefaultBodyLimits = BodyLimits{
+	MaxBytes:       1 << 20,
+	MaxDepth:       32,
+	MaxArrayLength: 10000,
+}
+
+var (
+	ErrBodyTooLarge         = errors.New("request body too large")
+	ErrBodyTooDeep          = errors.New("request body nested too deeply")
+	ErrArrayTooLong         = errors.New("request body array too long")
+	ErrUnsupportedMediaType = errors.New("unsupported content type")
+)
+
+// BodyError is a body parsing failure with the HTTP status to respond with
+type BodyError struct {
+	Status int
+	Err    error
+}
+
+// Error implements error
+func (e *BodyError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *BodyError) Unwrap() error {
+	return e.Err
+}
+
+// Body is a parsed request body. Structured formats (JSON, msgpack) fill
+// Fields with JSON encoded values; form formats fill Form and Files.
+type Body struct {
+	Fields map[string]json.RawMessage
+	Form   map[string][]string
+	Files  map[string][]*multipart.FileHeader
+}
+
+// Keys returns every top-level field name present in the body
+func (b *Body) Keys() []string {
+	var keys []string
+	for k := range b.Fields {
+		keys = append(keys, k)
+	}
+	for k := range b.Form {
+		keys = append(keys, k)
+	}
+	for k := range b.Files {
+		if _, ok := b.Form[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// BodyParser parses a request body of one media type. The body reader is
+// already limited to limits.MaxBytes.
+type BodyParser func(r *http.Request, limits BodyLimits) (*Body, error)
+
+var (
+	parsersMu sync.RWMutex
+	parsers   = map[string]BodyParser{
+		"application/json":                  parseJSONBody,
+		"application/x-www-form-urlencoded": parseFormBody,
+		"multipart/form-data":               parseMultipartBody,
+		"application/msgpack":               parseMsgpackBody,
+		"application/x-msgpack":             parseMsgpackBody,
+		"application/vnd.msgpack":           parseMsgpackBody,
+	}
+)
+
+// RegisterBodyParser adds or replaces the parser for a media type
+func RegisterBodyParser(mediaType string, parser BodyParser) {
+	parsersMu.Lock()
+	defer parsersMu.Unlock()
+	parsers[strings.ToLower(mediaType)] = parser
+}
+
+// limitsKey stores per-route body limits in the request context
+type limitsKey struct{}
+
+// WithLimits returns middleware that applies limits to body parsing for
+// every handler it wraps, overriding DefaultBodyLimits
+func WithLimits(limits BodyLimits) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), limitsKey{}, limits)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// LimitsFromContext returns the limits set by WithLimits, or the defaults
+func LimitsFromContext(ctx context.Context) BodyLimits {
+	if limits, ok := ctx.Value(limitsKey{}).(BodyLimits); ok {
+		return limits
+	}
+	return DefaultBodyLimits
+}
+
+// ParseBody parses the request body according to its Content-Type. A
+// missing Content-Type is treated as JSON; an empty body yields an empty Body.
+func ParseBody(r *http.Request, limits BodyLimits) (*Body, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return &Body{}, nil
+	}
+
+	mediaType := "application/json"
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		parsed, _, err := mime.ParseMediaType(ct)
+		if err != nil {
+			return nil, &BodyError{Status: http.StatusUnsupportedMediaType, Err: ErrUnsupportedMediaType}
+		}
+		mediaType = strings.ToLower(parsed)
+	}
+
+	parsersMu.RLock()
+	parser, ok := parsers[mediaType]
+	parsersMu.RUnlock()
+	if !ok {
+		return nil, &BodyError{
+			Status: http.StatusUnsupportedMediaType,
+			Err:    fmt.Errorf("%w %q", ErrUnsupportedMediaType, mediaType),
+		}
+	}
+
+	if limits.MaxBytes <= 0 {
+		limits.MaxBytes = DefaultBodyLimits.MaxBytes
+	}
+	r.Body = http.MaxBytesReader(nil, r.Body, limits.MaxBytes)
+
+	body, err := parser(r, limits)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		var bodyErr *BodyError
+		switch {
+		case errors.As(err, &maxErr):
+			return nil, &BodyError{Status: http.StatusRequestEntityTooLarge, Err: ErrBodyTooLarge}
+		case errors.As(err, &bodyErr):
+			return nil, err
+		default:
+			return nil, &BodyError{Status: http.StatusBadRequest, Err: err}
+		}
+	}
+	return body, nil
+}
+
+// DecodeBody parses the request body and decodes it into dst, applying
+// limits and, if requested, rejecting fields dst does not declare
+func DecodeBody(r *http.Request, dst interface{}, limits BodyLimits) error {
+	binder := NewBinder()
+	binder.Precedence = []Source{SourceBody}
+	binder.Limits = limits
+	return binder.Bind(r, dst)
+}
+
+// parseJSONBody reads a JSON object after checking nesting and array limits
+func parseJSONBody(r *http.Request, limits BodyLimits) (*Body, error) {
+	raw, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if len(strings.TrimSpace(string(raw))) == 0 {
+		return &Body{}, nil
+	}
+	if err := checkJSONLimits(raw, limits); err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, fmt.Errorf("invalid JSON body: %v", err)
+	}
+	return &Body{Fields: fields}, nil
+}
+
+// checkJSONLimits scans raw JSON without decoding it, so deeply nested or
+// oversized arrays are rejected before any allocation proportional to them
+func checkJSONLimits(raw []byte, limits BodyLimits) error {
+	type frame struct {
+		array  bool
+		commas int
+	}
+	var stack []frame
+	inString, escaped := false, false
+
+	for _, c := range raw {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			inString = true
+		case '{', '[':
+			stack = append(stack, frame{array: c == '['})
+			if limits.MaxDepth > 0 && len(stack) > limits.MaxDepth {
+				return &BodyError{Status: http.StatusBadRequest, Err: ErrBodyTooDeep}
+			}
+		case '}', ']':
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case ',':
+			if n := len(stack); n > 0 && stack[n-1].array {
+				stack[n-1].commas++
+				if limits.MaxArrayLength > 0 && stack[n-1].commas >= limits.MaxArrayLength {
+					return &BodyError{Status: http.StatusBadRequest, Err: ErrArrayTooLong}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// parseFormBody reads an application/x-www-form-urlencoded body
+func parseFormBody(r *http.Request, limits BodyLimits) (*Body, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, fmt.Errorf("invalid form body: %v", err)
+	}
+	if err := checkFormLimits(r.PostForm, limits); err != nil {
+		return nil, err
+	}
+	return &Body{Form: r.PostForm}, nil
+}
+
+// parseMultipartBody reads a multipart/form-data body including files
+func parseMultipartBody(r *http.Request, limits BodyLimits) (*Body, error) {
+	if err := r.ParseMultipartForm(limits.MaxBytes); err != nil {
+		return nil, fmt.Errorf("invalid multipart body: %w", err)
+	}
+	if err := checkFormLimits(r.MultipartForm.Value, limits); err != nil {
+		return nil, err
+	}
+	return &Body{Form: r.MultipartForm.Value, Files: r.MultipartForm.File}, nil
+}
+
+// checkFormLimits caps repeated keys
+func checkFormLimits(values map[string][]string, limits BodyLimits) error {
+	if limits.MaxArrayLength <= 0 {
+		return nil
+	}
+	for _, v := range values {
+		if len(v) > limits.MaxArrayLength {
+			return &BodyError{Status: http.StatusBadRequest, Err: ErrArrayTooLong}
+		}
+	}
+	return nil
+}
+
+// parseMsgpackBody reads a msgpack map and re-encodes its values as JSON so
+// the rest of binding treats it exactly like a JSON body
+func parseMsgpackBody(r *http.Request, limits BodyLimits) (*Body, error) {
+	var decoded map[string]interface{}
+	dec := msgpack.NewDecoder(r.Body)
+	dec.SetCustomStructTag("json")
+	if err := dec.Decode(&decoded); err != nil {
+		if err == io.EOF {
+			return &Body{}, nil
+		}
+		return nil, fmt.Errorf("invalid msgpack body: %w", err)
+	}
+
+	if err := checkValueLimits(decoded, 1, limits); err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]json.RawMessage, len(decoded))
+	for k, v := range decoded {
+		raw, err := json.Marshal(normalizeMsgpack(v))
+		if err != nil {
+			return nil, fmt.Errorf("invalid msgpack value for %q: %v", k, err)
+		}
+		fields[k] = raw
+	}
+	return &Body{Fields: fields}, nil
+}
+
+// checkValueLimits walks a decoded value enforcing depth and array limits
+func checkValueLimits(v interface{}, depth int, limits BodyLimits) error {
+	if limits.MaxDepth > 0 && depth > limits.MaxDepth {
+		return &BodyError{Status: http.StatusBadRequest, Err: ErrBodyTooDeep}
+	}
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for _, item := range val {
+			if err := checkValueLimits(item, depth+1, limits); err != nil {
+				return err
+			}
+		}
+	case map[interface{}]interface{}:
+		for _, item := range val {
+			if err := checkValueLimits(item, depth+1, limits); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		if limits.MaxArrayLength > 0 && len(val) > limits.MaxArrayLength {
+			return &BodyError{Status: http.StatusBadRequest, Err: ErrArrayTooLong}
+		}
+		for _, item := range val {
+			if err := checkValueLimits(item, depth+1, limits); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// normalizeMsgpack converts maps with non-string keys, which JSON cannot encode
+func normalizeMsgpack(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			m[fmt.Sprint(k)] = normalizeMsgpack(item)
+		}
+		return m
+	case map[string]interface{}:
+		for k, item := range val {
+			val[k] = normalizeMsgpack(item)
+		}
+		return val
+	case []interface{}:
+		for i, item := range val {
+			val[i] = normalizeMsgpack(item)
+		}
+		return val
+	default:
+		return v
+	}
+}
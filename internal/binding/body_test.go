@@ -0,0 +1,87 @@
+package binding
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+type bodyRequest struct {
+	Name string   `json:"name" source:"body"`
+	Tags []string `json:"tags" source:"body"`
+}
+
+func newRequest(contentType string, body []byte) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	r.Header.Set("Content-Type", contentType)
+	return r
+}
+
+func TestDecodeBodyLimits(t *testing.T) {
+	limits := BodyLimits{MaxBytes: 1 << 10, MaxDepth: 3, MaxArrayLength: 2}
+
+	tests := []struct {
+		name   string
+		body   string
+		target error
+		status int
+	}{
+		{"too deep", `{"name":{"a":{"b":{"c":1}}}}`, ErrBodyTooDeep, http.StatusBadRequest},
+		{"brackets in strings are ignored", `{"name":"[[[[{{{{"}`, nil, 0},
+		{"array too long", `{"tags":["a","b","c"]}`, ErrArrayTooLong, http.StatusBadRequest},
+		{"too large", `{"name":"` + strings.Repeat("x", 2048) + `"}`, ErrBodyTooLarge, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dst bodyRequest
+			err := DecodeBody(newRequest("application/json", []byte(tt.body)), &dst, limits)
+			if tt.target == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var bodyErr *BodyError
+			if !errors.As(err, &bodyErr) || !errors.Is(err, tt.target) || bodyErr.Status != tt.status {
+				t.Fatalf("expected %v with status %d, got %v", tt.target, tt.status, err)
+			}
+		})
+	}
+}
+
+func TestDecodeBodyRejectsUnknownFields(t *testing.T) {
+	var dst bodyRequest
+	limits := DefaultBodyLimits
+	limits.DisallowUnknownFields = true
+
+	err := DecodeBody(newRequest("application/json", []byte(`{"name":"a","admin":true}`)), &dst, limits)
+	var errs *Errors
+	if !errors.As(err, &errs) || len(errs.Errors) != 1 || errs.Errors[0].Field != "admin" {
+		t.Fatalf("expected unknown field error for admin, got %v", err)
+	}
+}
+
+func TestDecodeBodyMsgpack(t *testing.T) {
+	payload, _ := msgpack.Marshal(map[string]interface{}{"name": "dolphin", "tags": []string{"a", "b"}})
+
+	var dst bodyRequest
+	if err := DecodeBody(newRequest("application/msgpack", payload), &dst, DefaultBodyLimits); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dst.Name != "dolphin" || len(dst.Tags) != 2 {
+		t.Fatalf("unexpected result: %+v", dst)
+	}
+}
+
+func TestParseBodyUnsupportedMediaType(t *testing.T) {
+	_, err := ParseBody(newRequest("text/plain", []byte("hi")), DefaultBodyLimits)
+	var bodyErr *BodyError
+	if !errors.As(err, &bodyErr) || bodyErr.Status != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected 415, got %v", err)
+	}
+}
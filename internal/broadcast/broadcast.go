@@ -0,0 +1,219 @@
+// Package broadcast carries messages between the instances of an app, so
+// what happens on one reaches listeners on the others: bus events shared
+// with Share, GraphQL subscription updates and cache tag flushes. Messages
+// go to every instance but the one publishing them, which has already
+// handled them itself:
+//
+//	b := broadcast.NewRedis(client, "dolphin:broadcast:", logger)
+//	stop := b.Subscribe("reports", func(ctx context.Context, msg broadcast.Message) error {
+//		var report Report
+//		json.Unmarshal(msg.Payload, &report)
+//		return hub.Send(report)
+//	})
+//	b.Publish(ctx, "reports", "", report)
+//
+// Handlers run with the publishing request's ID, trace, tenant and user
+// restored, as queued jobs do.
+package broadcast
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/correlation"
+)
+
+// Message is what one instance sent on a channel
+type Message struct {
+	Channel string `json:"-"`
+
+	// Origin identifies the instance that sent the message
+	Origin string `json:"origin"`
+
+	// Name tells apart the kinds of message sent on one channel, such as
+	// the event names on the events channel
+	Name string `json:"name,omitempty"`
+
+	// Payload is the JSON encoded value published
+	Payload json.RawMessage `json:"payload"`
+
+	Correlation correlation.Fields `json:"correlation,omitempty"`
+}
+
+// Handler handles a message from another instance
+type Handler func(ctx context.Context, msg Message) error
+
+// Broadcaster sends messages to the app's other instances
+type Broadcaster interface {
+	// Publish sends payload, encoded as JSON, to the subscribers of
+	// channel on the other instances
+	Publish(ctx context.Context, channel, name string, payload interface{}) error
+
+	// Subscribe calls fn with the messages other instances send on
+	// channel. The returned function removes the subscription.
+	Subscribe(channel string, fn Handler) (unsubscribe func())
+
+	// Close stops receiving messages
+	Close() error
+}
+
+// subscribers are the handlers of each channel on one instance
+type subscribers struct {
+	origin string
+	logger *zap.Logger
+
+	mu       sync.RWMutex
+	handlers map[string]map[uint64]Handler
+	nextID   uint64
+}
+
+func newSubscribers(logger *zap.Logger) *subscribers {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &subscribers{
+		origin:   uuid.NewString(),
+		logger:   logger,
+		handlers: map[string]map[uint64]Handler{},
+	}
+}
+
+// Subscribe implements Broadcaster
+func (s *subscribers) Subscribe(channel string, fn Handler) func() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	id := s.nextID
+	if s.handlers[channel] == nil {
+		s.handlers[channel] = map[uint64]Handler{}
+	}
+	s.handlers[channel][id] = fn
+
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.handlers[channel], id)
+	}
+}
+
+// message encodes a message sent from this instance
+func (s *subscribers) message(ctx context.Context, channel, name string, payload interface{}) (Message, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Message{}, err
+	}
+	return Message{
+		Channel:     channel,
+		Origin:      s.origin,
+		Name:        name,
+		Payload:     data,
+		Correlation: correlation.Capture(ctx),
+	}, nil
+}
+
+// deliver hands a message to the channel's handlers, unless this instance
+// sent it. Handler errors are logged.
+func (s *subscribers) deliver(msg Message) {
+	if msg.Origin == s.origin {
+		return
+	}
+	s.mu.RLock()
+	handlers := make([]Handler, 0, len(s.handlers[msg.Channel]))
+	for _, fn := range s.handlers[msg.Channel] {
+		handlers = append(handlers, fn)
+	}
+	s.mu.RUnlock()
+
+	for _, fn := range handlers {
+		err := correlation.Run(context.Background(), msg.Correlation, "broadcast "+msg.Channel, func(ctx context.Context) error {
+			return fn(ctx, msg)
+		})
+		if err != nil {
+			s.logger.Error("Broadcast handler failed", zap.String("channel", msg.Channel), zap.String("name", msg.Name), zap.Error(err))
+		}
+	}
+}
+
+// Memory broadcasts between broadcasters in one process: a single
+// instance, where it delivers nothing, or instances simulated with Join in
+// tests. Messages are delivered before Publish returns.
+type Memory struct {
+	*subscribers
+	network *memoryNetwork
+}
+
+var _ Broadcaster = (*Memory)(nil)
+
+type memoryNetwork struct {
+	mu      sync.RWMutex
+	members []*Memory
+}
+
+// NewMemory creates a broadcaster with no other instances to reach
+func NewMemory(logger *zap.Logger) *Memory {
+	m := &Memory{subscribers: newSubscribers(logger), network: &memoryNetwork{}}
+	m.network.members = []*Memory{m}
+	return m
+}
+
+// Join returns a broadcaster standing for another instance, which
+// receives the messages m publishes and sends its own to m
+func (m *Memory) Join() *Memory {
+	other := &Memory{subscribers: newSubscribers(m.logger), network: m.network}
+	m.network.mu.Lock()
+	m.network.members = append(m.network.members, other)
+	m.network.mu.Unlock()
+	return other
+}
+
+// Publish implements Broadcaster
+func (m *Memory) Publish(ctx context.Context, channel, name string, payload interface{}) error {
+	msg, err := m.message(ctx, channel, name, payload)
+	if err != nil {
+		return err
+	}
+	m.network.mu.RLock()
+	members := append([]*Memory(nil), m.network.members...)
+	m.network.mu.RUnlock()
+	for _, member := range members {
+		member.deliver(msg)
+	}
+	return nil
+}
+
+// Close implements Broadcaster by leaving the network
+func (m *Memory) Close() error {
+	m.network.mu.Lock()
+	defer m.network.mu.Unlock()
+	for i, member := range m.network.members {
+		if member == m {
+			m.network.members = append(m.network.members[:i:i], m.network.members[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// New creates the broadcaster for the configured driver. The redis driver
+// publishes on the cache's Redis server.
+func New(cfg config.BroadcastConfig, cache config.CacheConfig, logger *zap.Logger) (Broadcaster, error) {
+	switch cfg.Driver {
+	case "memory", "":
+		return NewMemory(logger), nil
+	case "redis":
+		client := redis.NewClient(&redis.Options{
+			Addr: fmt.Sprintf("%s:%d", cache.Host, cache.Port),
+			DB:   cache.DB,
+		})
+		return NewRedis(client, cfg.Prefix, logger), nil
+	default:
+		return nil, fmt.Errorf("unknown broadcast driver %q (redis or memory)", cfg.Driver)
+	}
+}
@@ -0,0 +1,154 @@
+package broadcast
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/bus"
+	"github.com/mrhoseah/dolphin/internal/cache"
+)
+
+type orderShipped struct {
+	ID      int    `json:"id"`
+	Carrier string `json:"carrier"`
+}
+
+type draftSaved struct {
+	ID int
+}
+
+func TestMemoryReachesOtherInstances(t *testing.T) {
+	a := NewMemory(nil)
+	b := a.Join()
+	c := a.Join()
+
+	var mu sync.Mutex
+	var received []string
+	for name, instance := range map[string]*Memory{"a": a, "b": b, "c": c} {
+		name := name
+		instance.Subscribe("reports", func(ctx context.Context, msg Message) error {
+			mu.Lock()
+			defer mu.Unlock()
+			received = append(received, name+":"+msg.Name+":"+string(msg.Payload)+":"+middleware.GetReqID(ctx))
+			return nil
+		})
+	}
+
+	ctx := context.WithValue(context.Background(), middleware.RequestIDKey, "req-1")
+	require.NoError(t, a.Publish(ctx, "reports", "daily", map[string]int{"orders": 3}))
+	assert.ElementsMatch(t, []string{`b:daily:{"orders":3}:req-1`, `c:daily:{"orders":3}:req-1`}, received,
+		"everyone but the publisher, in the publishing request")
+
+	received = nil
+	require.NoError(t, c.Close())
+	require.NoError(t, b.Publish(context.Background(), "other", "", 1))
+	require.NoError(t, b.Publish(context.Background(), "reports", "weekly", 2))
+	assert.Equal(t, []string{"a:weekly:2:"}, received)
+}
+
+func TestForwardSharesBusEvents(t *testing.T) {
+	Share[orderShipped]()
+	a := NewMemory(nil)
+	b := a.Join()
+	busA, busB := bus.New(), bus.New()
+	defer Forward(a, busA)()
+	defer Forward(b, busB)()
+
+	var onA, onB []interface{}
+	var mu sync.Mutex
+	bus.SubscribeTo(busA, func(ctx context.Context, e interface{}) error {
+		mu.Lock()
+		defer mu.Unlock()
+		onA = append(onA, e)
+		return nil
+	})
+	bus.SubscribeTo(busB, func(ctx context.Context, e interface{}) error {
+		mu.Lock()
+		defer mu.Unlock()
+		onB = append(onB, e)
+		return nil
+	})
+
+	ctx := context.Background()
+	require.NoError(t, busA.Publish(ctx, orderShipped{ID: 7, Carrier: "DHL"}))
+	require.NoError(t, busA.Publish(ctx, draftSaved{ID: 1}))
+	busA.Wait()
+	busB.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []interface{}{orderShipped{ID: 7, Carrier: "DHL"}, draftSaved{ID: 1}}, onA)
+	assert.Equal(t, []interface{}{orderShipped{ID: 7, Carrier: "DHL"}}, onB,
+		"only shared types travel, once, without bouncing back")
+}
+
+func TestFlushTagsAcross(t *testing.T) {
+	a := NewMemory(nil)
+	b := a.Join()
+	cacheA, cacheB := cache.NewMemoryCache(), cache.NewMemoryCache()
+	defer FlushTagsAcross(a, cacheA)()
+	defer FlushTagsAcross(b, cacheB)()
+
+	ctx := context.Background()
+	for _, c := range []*cache.MemoryCache{cacheA, cacheB} {
+		require.NoError(t, c.Tags("users").Set(ctx, "users:7", "Ada", time.Hour))
+		require.NoError(t, c.Set(ctx, "settings", "dark", time.Hour))
+	}
+
+	require.NoError(t, cacheB.Tags("users").Flush(ctx))
+	for _, c := range []*cache.MemoryCache{cacheA, cacheB} {
+		exists, _ := c.Exists(ctx, "users:7")
+		assert.False(t, exists)
+		exists, _ = c.Exists(ctx, "settings")
+		assert.True(t, exists)
+	}
+}
+
+func TestRedis(t *testing.T) {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_ADDR not set")
+	}
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	defer client.Close()
+	prefix := "test:" + t.Name() + ":"
+	a, b := NewRedis(client, prefix, nil), NewRedis(client, prefix, nil)
+	defer a.Close()
+	defer b.Close()
+
+	received := make(chan Message, 2)
+	for _, r := range []*Redis{a, b} {
+		r.Subscribe("reports", func(ctx context.Context, msg Message) error {
+			received <- msg
+			return nil
+		})
+	}
+	// Subscriptions are made in the background
+	time.Sleep(100 * time.Millisecond)
+
+	require.NoError(t, a.Publish(context.Background(), "reports", "daily", []int{1, 2}))
+	select {
+	case msg := <-received:
+		assert.Equal(t, "reports", msg.Channel)
+		assert.Equal(t, a.origin, msg.Origin)
+		var payload []int
+		require.NoError(t, json.Unmarshal(msg.Payload, &payload))
+		assert.Equal(t, []int{1, 2}, payload)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+	select {
+	case msg := <-received:
+		t.Fatalf("the publisher received its own message: %+v", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,71 @@
+package broadcast
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// Redis broadcasts over Redis pub/sub, on a channel per broadcast channel
+// under a prefix. Messages published while an instance is disconnected
+// are lost to it, so use the outbox or a queue for work that must happen.
+type Redis struct {
+	*subscribers
+	client redis.UniversalClient
+	prefix string
+	pubsub *redis.PubSub
+	done   chan struct{}
+}
+
+var _ Broadcaster = (*Redis)(nil)
+
+// NewRedis creates a broadcaster publishing on client's server and
+// listening to every channel under prefix, reconnecting as needed
+func NewRedis(client redis.UniversalClient, prefix string, logger *zap.Logger) *Redis {
+	r := &Redis{
+		subscribers: newSubscribers(logger),
+		client:      client,
+		prefix:      prefix,
+		pubsub:      client.PSubscribe(context.Background(), prefix+"*"),
+		done:        make(chan struct{}),
+	}
+	go r.receive()
+	return r
+}
+
+// Publish implements Broadcaster
+func (r *Redis) Publish(ctx context.Context, channel, name string, payload interface{}) error {
+	msg, err := r.message(ctx, channel, name, payload)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return r.client.Publish(ctx, r.prefix+channel, data).Err()
+}
+
+// Close implements Broadcaster, waiting for the message being handled
+func (r *Redis) Close() error {
+	err := r.pubsub.Close()
+	<-r.done
+	return err
+}
+
+// receive delivers the messages of other instances until Close
+func (r *Redis) receive() {
+	defer close(r.done)
+	for received := range r.pubsub.Channel() {
+		var msg Message
+		if err := json.Unmarshal([]byte(received.Payload), &msg); err != nil {
+			r.logger.Warn("Ignoring a malformed broadcast", zap.String("channel", received.Channel), zap.Error(err))
+			continue
+		}
+		msg.Channel = strings.TrimPrefix(received.Channel, r.prefix)
+		r.deliver(msg)
+	}
+}
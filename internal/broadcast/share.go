@@ -0,0 +1,129 @@
+package broadcast
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/mrhoseah/dolphin/internal/bus"
+	"github.com/mrhoseah/dolphin/internal/cache"
+)
+
+// Channels of the messages this package sends
+const (
+	EventsChannel    = "events"
+	CacheTagsChannel = "cache.tags"
+)
+
+var (
+	sharedMu sync.RWMutex
+	shared   = map[string]reflect.Type{}
+)
+
+// Share has values of type T published on the bus reach the bus of every
+// instance, once Forward runs. They travel as JSON under their
+// bus.EventName, so every instance must share the same types:
+//
+//	broadcast.Share[OrderShipped]()
+//	bus.Publish(ctx, OrderShipped{ID: 7}) // subscribers on every instance get it
+func Share[T any]() {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	var sample interface{}
+	if t.Kind() == reflect.Ptr {
+		sample = reflect.New(t.Elem()).Interface()
+	} else {
+		sample = reflect.New(t).Elem().Interface()
+	}
+	sharedMu.Lock()
+	shared[bus.EventName(sample)] = t
+	sharedMu.Unlock()
+}
+
+// sharedType returns the type shared under an event name
+func sharedType(name string) (reflect.Type, bool) {
+	sharedMu.RLock()
+	defer sharedMu.RUnlock()
+	t, ok := shared[name]
+	return t, ok
+}
+
+type receivedKey struct{}
+
+// Forward sends the shared values published on on to the other instances
+// through b, and publishes the ones they send on on. Sending happens in
+// the background, so a broadcast failure doesn't fail the publisher and is
+// reported to the bus's error handler. The returned function stops
+// forwarding.
+func Forward(b Broadcaster, on *bus.Bus) (stop func()) {
+	unsubscribe := bus.SubscribeTo(on, func(ctx context.Context, event interface{}) error {
+		if ctx.Value(receivedKey{}) != nil {
+			return nil
+		}
+		name := bus.EventName(event)
+		if _, ok := sharedType(name); !ok {
+			return nil
+		}
+		return b.Publish(ctx, EventsChannel, name, event)
+	}, bus.Async())
+
+	stopReceiving := b.Subscribe(EventsChannel, func(ctx context.Context, msg Message) error {
+		t, ok := sharedType(msg.Name)
+		if !ok {
+			return fmt.Errorf("broadcast: %q isn't shared on this instance", msg.Name)
+		}
+		event, err := decode(t, msg.Payload)
+		if err != nil {
+			return fmt.Errorf("broadcast: decoding %s: %w", msg.Name, err)
+		}
+		return on.Publish(context.WithValue(ctx, receivedKey{}, true), event)
+	})
+
+	return func() {
+		unsubscribe()
+		stopReceiving()
+	}
+}
+
+// decode rebuilds a value of type t from JSON
+func decode(t reflect.Type, data []byte) (interface{}, error) {
+	if t.Kind() == reflect.Ptr {
+		value := reflect.New(t.Elem())
+		if err := json.Unmarshal(data, value.Interface()); err != nil {
+			return nil, err
+		}
+		return value.Interface(), nil
+	}
+	value := reflect.New(t)
+	if err := json.Unmarshal(data, value.Interface()); err != nil {
+		return nil, err
+	}
+	return value.Elem().Interface(), nil
+}
+
+// FlushTagsAcross has tags flushed from c flushed from the memory caches
+// of the other instances too, and flushes the tags they flush from theirs.
+// A Redis cache is shared already and needs none of this. The returned
+// function stops it.
+func FlushTagsAcross(b Broadcaster, c *cache.MemoryCache) (stop func()) {
+	c.OnFlushTags(func(ctx context.Context, tags []string) {
+		if ctx.Value(receivedKey{}) != nil {
+			return
+		}
+		b.Publish(ctx, CacheTagsChannel, "", tags)
+	})
+
+	stopReceiving := b.Subscribe(CacheTagsChannel, func(ctx context.Context, msg Message) error {
+		var tags []string
+		if err := json.Unmarshal(msg.Payload, &tags); err != nil {
+			return err
+		}
+		return c.FlushTags(context.WithValue(ctx, receivedKey{}, true), tags...)
+	})
+
+	return func() {
+		c.OnFlushTags(nil)
+		stopReceiving()
+	}
+}
@@ -0,0 +1,78 @@
+package bus
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mrhoseah/dolphin/internal/events"
+)
+
+// Named is implemented by values that choose their event name when bridged
+// to the event dispatcher
+type Named interface {
+	EventName() string
+}
+
+// EventName returns the name a value is dispatched under when bridged: its
+// EventName if it has one, otherwise its type, e.g. "users.UserCreated"
+func EventName(event interface{}) string {
+	switch e := event.(type) {
+	case events.Event:
+		return e.GetName()
+	case Named:
+		return e.EventName()
+	}
+	return strings.TrimPrefix(fmt.Sprintf("%T", event), "*")
+}
+
+type bridgedKey struct{}
+
+// Bridge forwards every value published on b to the dispatcher, so the
+// event system's listeners see bus messages too. Values implementing
+// events.Event are dispatched as they are; others are wrapped in a
+// BaseEvent named by EventName with the value as payload. Dispatch errors
+// are returned from Publish. The returned function stops forwarding.
+func (b *Bus) Bridge(d events.EventDispatcher) (stop func()) {
+	return SubscribeTo(b, func(ctx context.Context, event interface{}) error {
+		if ctx.Value(bridgedKey{}) != nil {
+			return nil
+		}
+		e, ok := event.(events.Event)
+		if !ok {
+			e = events.NewBaseEvent(EventName(event), event)
+		}
+		return d.Dispatch(context.WithValue(ctx, bridgedKey{}, true), e)
+	})
+}
+
+// listener publishes dispatched events on a bus
+type listener struct {
+	bus *Bus
+}
+
+// Listener returns an events.Listener that publishes the payload of each
+// event it handles on b, so bus subscribers can react to the dispatcher's
+// events:
+//
+//	dispatcher.Listen("user.created", bus.Listener(bus.Default))
+//
+// Events the bus itself bridged to the dispatcher are skipped, so Bridge
+// and Listener can be combined without looping.
+func Listener(b *Bus) events.Listener {
+	return listener{bus: b}
+}
+
+func (l listener) Handle(ctx context.Context, event events.Event) error {
+	if ctx.Value(bridgedKey{}) != nil {
+		return nil
+	}
+	payload := event.GetPayload()
+	if payload == nil {
+		payload = event
+	}
+	return l.bus.Publish(context.WithValue(ctx, bridgedKey{}, true), payload)
+}
+
+func (l listener) GetPriority() int  { return 0 }
+func (l listener) ShouldQueue() bool { return false }
@@ -0,0 +1,179 @@
+// Package bus is a small typed pub/sub for decoupling modules inside one
+// process. Subscribers are chosen by the Go type of the published value:
+//
+//	bus.Subscribe(func(ctx context.Context, e UserCreated) error {
+//		return mailer.Welcome(ctx, e.Email)
+//	})
+//	bus.Publish(ctx, UserCreated{ID: u.ID, Email: u.Email})
+//
+// Use the events package when listeners need priorities, queueing or
+// persistence; Bridge forwards bus messages to an events.EventDispatcher.
+package bus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// Handler handles a published value of type T
+type Handler[T any] func(ctx context.Context, event T) error
+
+// Option configures a subscription
+type Option func(*subscription)
+
+// Async delivers events to the handler in its own goroutine, so Publish
+// doesn't wait for it and its error doesn't reach the publisher. The
+// handler's context keeps the publisher's values but not its cancellation,
+// so work outlives the request that published it.
+func Async() Option {
+	return func(s *subscription) { s.async = true }
+}
+
+type subscription struct {
+	id      uint64
+	async   bool
+	accepts func(event interface{}) bool
+	handle  func(ctx context.Context, event interface{}) error
+}
+
+// Bus delivers published values to the subscribers of their type
+type Bus struct {
+	mu      sync.RWMutex
+	subs    []*subscription
+	nextID  uint64
+	onError func(ctx context.Context, event interface{}, err error)
+	pending sync.WaitGroup
+}
+
+// New creates an empty bus
+func New() *Bus {
+	return &Bus{
+		onError: func(ctx context.Context, event interface{}, err error) {
+			log.Printf("bus: async handler for %T failed: %v", event, err)
+		},
+	}
+}
+
+// Default is the process-wide bus used by the package-level functions
+var Default = New()
+
+// Subscribe registers fn on the default bus for published values of type
+// T. T may be an interface, in which case every value implementing it is
+// delivered. The returned function removes the subscription.
+func Subscribe[T any](fn Handler[T], opts ...Option) (unsubscribe func()) {
+	return SubscribeTo(Default, fn, opts...)
+}
+
+// Publish publishes event on the default bus
+func Publish(ctx context.Context, event interface{}) error {
+	return Default.Publish(ctx, event)
+}
+
+// SubscribeTo registers fn on b for published values of type T
+func SubscribeTo[T any](b *Bus, fn Handler[T], opts ...Option) (unsubscribe func()) {
+	s := &subscription{
+		accepts: func(event interface{}) bool {
+			_, ok := event.(T)
+			return ok
+		},
+		handle: func(ctx context.Context, event interface{}) error {
+			return fn(ctx, event.(T))
+		},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	b.mu.Lock()
+	b.nextID++
+	s.id = b.nextID
+	b.subs = append(b.subs, s)
+	b.mu.Unlock()
+
+	return func() { b.remove(s.id) }
+}
+
+func (b *Bus) remove(id uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, s := range b.subs {
+		if s.id == id {
+			b.subs = append(b.subs[:i:i], b.subs[i+1:]...)
+			return
+		}
+	}
+}
+
+// Publish delivers event to its synchronous subscribers in subscription
+// order and hands it to asynchronous ones. It returns the synchronous
+// handlers' errors joined; every handler runs even if an earlier one fails.
+func (b *Bus) Publish(ctx context.Context, event interface{}) error {
+	if event == nil {
+		return errors.New("bus: cannot publish nil")
+	}
+
+	b.mu.RLock()
+	subs := append([]*subscription(nil), b.subs...)
+	onError := b.onError
+	b.mu.RUnlock()
+
+	var errs []error
+	for _, s := range subs {
+		if !s.accepts(event) {
+			continue
+		}
+		if s.async {
+			b.pending.Add(1)
+			go func(s *subscription) {
+				defer b.pending.Done()
+				if err := deliver(context.WithoutCancel(ctx), s, event); err != nil {
+					onError(ctx, event, err)
+				}
+			}(s)
+			continue
+		}
+		if err := deliver(ctx, s, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// deliver runs one handler, turning a panic into an error
+func deliver(ctx context.Context, s *subscription, event interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("bus: handler for %T panicked: %v", event, r)
+		}
+	}()
+	return s.handle(ctx, event)
+}
+
+// OnError sets what happens to errors from asynchronous handlers; they are
+// logged by default
+func (b *Bus) OnError(fn func(ctx context.Context, event interface{}, err error)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.onError = fn
+}
+
+// Wait blocks until asynchronous deliveries in flight have finished, e.g.
+// before shutting down
+func (b *Bus) Wait() {
+	b.pending.Wait()
+}
+
+// HasSubscribers reports whether a published event would reach any handler
+func (b *Bus) HasSubscribers(event interface{}) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, s := range b.subs {
+		if s.accepts(event) {
+			return true
+		}
+	}
+	return false
+}
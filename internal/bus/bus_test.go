@@ -0,0 +1,148 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/events"
+)
+
+type UserCreated struct {
+	ID    uint
+	Email string
+}
+
+type OrderPlaced struct{ Total int }
+
+func (OrderPlaced) EventName() string { return "order.placed" }
+
+type ctxKey struct{}
+
+func TestPublishDeliversByType(t *testing.T) {
+	b := New()
+	var got []string
+
+	SubscribeTo(b, func(ctx context.Context, e UserCreated) error {
+		got = append(got, "first:"+e.Email+":"+ctx.Value(ctxKey{}).(string))
+		return nil
+	})
+	unsubscribe := SubscribeTo(b, func(ctx context.Context, e UserCreated) error {
+		got = append(got, "second")
+		return errors.New("mailer down")
+	})
+	SubscribeTo(b, func(ctx context.Context, e OrderPlaced) error {
+		got = append(got, "order")
+		return nil
+	})
+	SubscribeTo(b, func(ctx context.Context, e Named) error {
+		got = append(got, "named:"+e.EventName())
+		return nil
+	})
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "req-1")
+	err := b.Publish(ctx, UserCreated{ID: 1, Email: "a@example.com"})
+	assert.ErrorContains(t, err, "mailer down")
+	assert.Equal(t, []string{"first:a@example.com:req-1", "second"}, got)
+
+	got = nil
+	unsubscribe()
+	require.NoError(t, b.Publish(ctx, UserCreated{}))
+	require.NoError(t, b.Publish(ctx, OrderPlaced{Total: 5}))
+	assert.Equal(t, []string{"first::req-1", "order", "named:order.placed"}, got)
+
+	assert.True(t, b.HasSubscribers(OrderPlaced{}))
+	assert.False(t, b.HasSubscribers(&UserCreated{}))
+	assert.Error(t, b.Publish(ctx, nil))
+}
+
+func TestAsyncDelivery(t *testing.T) {
+	b := New()
+	var mu sync.Mutex
+	var failures []error
+	b.OnError(func(ctx context.Context, event interface{}, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		failures = append(failures, err)
+	})
+
+	release := make(chan struct{})
+	var seen string
+	SubscribeTo(b, func(ctx context.Context, e UserCreated) error {
+		<-release
+		assert.NoError(t, ctx.Err(), "async handlers outlive the publisher's context")
+		seen = ctx.Value(ctxKey{}).(string)
+		return nil
+	}, Async())
+	SubscribeTo(b, func(ctx context.Context, e UserCreated) error {
+		panic("boom")
+	}, Async())
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "req-2"))
+	require.NoError(t, b.Publish(ctx, UserCreated{ID: 2}))
+	cancel()
+	close(release)
+	b.Wait()
+
+	assert.Equal(t, "req-2", seen)
+	require.Len(t, failures, 1)
+	assert.ErrorContains(t, failures[0], "panicked: boom")
+}
+
+func TestPackageLevelDefaultBus(t *testing.T) {
+	var got uint
+	unsubscribe := Subscribe[UserCreated](func(ctx context.Context, e UserCreated) error {
+		got = e.ID
+		return nil
+	})
+	defer unsubscribe()
+
+	require.NoError(t, Publish(context.Background(), UserCreated{ID: 7}))
+	assert.Equal(t, uint(7), got)
+}
+
+type recordingListener struct {
+	events []events.Event
+}
+
+func (l *recordingListener) Handle(ctx context.Context, e events.Event) error {
+	l.events = append(l.events, e)
+	return nil
+}
+func (l *recordingListener) GetPriority() int  { return 0 }
+func (l *recordingListener) ShouldQueue() bool { return false }
+
+func TestBridgeToDispatcher(t *testing.T) {
+	b := New()
+	d := events.NewEventDispatcher()
+	rec := &recordingListener{}
+	d.Listen("bus.UserCreated", rec)
+	d.Listen("order.placed", rec)
+
+	// Events dispatched elsewhere reach bus subscribers too
+	d.Listen("order.placed", Listener(b))
+	var orders []OrderPlaced
+	SubscribeTo(b, func(ctx context.Context, e OrderPlaced) error {
+		orders = append(orders, e)
+		return nil
+	})
+
+	stop := b.Bridge(d)
+	require.NoError(t, b.Publish(context.Background(), UserCreated{ID: 3}))
+	require.NoError(t, b.Publish(context.Background(), OrderPlaced{Total: 10}))
+	require.Len(t, rec.events, 2)
+	assert.Equal(t, UserCreated{ID: 3}, rec.events[0].GetPayload())
+	assert.Equal(t, "order.placed", rec.events[1].GetName())
+	assert.Len(t, orders, 1, "bridged events must not loop back onto the bus")
+
+	require.NoError(t, d.Dispatch(context.Background(), events.NewBaseEvent("order.placed", OrderPlaced{Total: 20})))
+	assert.Equal(t, []OrderPlaced{{Total: 10}, {Total: 20}}, orders)
+
+	stop()
+	require.NoError(t, b.Publish(context.Background(), UserCreated{ID: 4}))
+	assert.Len(t, rec.events, 3)
+}
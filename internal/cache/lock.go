@@ -0,0 +1,253 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// lockPrefix namespaces the Redis keys holding locks
+const lockPrefix = "dolphin:locks:"
+
+// lockRetry is how often Acquire asks for a lock held by someone else
+const lockRetry = 100 * time.Millisecond
+
+// ErrNotHeld is returned by Release when the lock isn't held, or expired
+// and was taken by someone else
+var ErrNotHeld = errors.New("cache: lock not held")
+
+// Locker stores named locks. Each is held by one owner until released or
+// until its ttl passes, so a crashed owner can't hold it forever.
+type Locker interface {
+	// AcquireLock takes name for owner for ttl, reporting false when
+	// another owner holds it
+	AcquireLock(ctx context.Context, name, owner string, ttl time.Duration) (bool, error)
+
+	// ReleaseLock frees name, reporting false when owner doesn't hold it
+	ReleaseLock(ctx context.Context, name, owner string) (bool, error)
+}
+
+// Locks stores the locks made by Lock. It keeps them in memory, which
+// only excludes this process, until the router replaces it with the store
+// cache.locks names.
+var Locks Locker = NewMemoryCache()
+
+// Lock returns a lock on name in Locks, which expires ttl after it is
+// taken:
+//
+//	lock := cache.Lock("reports:generate", 30*time.Second)
+//	if ok, _ := lock.TryAcquire(ctx); !ok {
+//		return // another instance is generating them
+//	}
+//	defer lock.Release(ctx)
+func Lock(name string, ttl time.Duration) *Mutex {
+	return NewMutex(Locks, name, ttl)
+}
+
+// Mutex is a lock on a name shared by every instance using the same
+// Locker. Each Mutex is its own owner: another Mutex on the same name,
+// even in the same process, waits for it.
+type Mutex struct {
+	locker Locker
+	name   string
+	ttl    time.Duration
+	owner  string
+
+	mu   sync.Mutex
+	stop chan struct{}
+}
+
+// NewMutex returns a lock on name in locker, which expires ttl after it is
+// taken
+func NewMutex(locker Locker, name string, ttl time.Duration) *Mutex {
+	return &Mutex{locker: locker, name: name, ttl: ttl, owner: uuid.NewString()}
+}
+
+// Name returns the name locked
+func (m *Mutex) Name() string {
+	return m.name
+}
+
+// TryAcquire takes the lock if it is free, without waiting. The lock is
+// released when ctx is cancelled, unless Release comes first.
+func (m *Mutex) TryAcquire(ctx context.Context) (bool, error) {
+	ok, err := m.locker.AcquireLock(ctx, m.name, m.owner, m.ttl)
+	if err != nil || !ok {
+		return false, err
+	}
+	m.releaseOnCancel(ctx)
+	return true, nil
+}
+
+// Acquire waits for the lock until ctx is done, returning ctx's error
+// then. Like TryAcquire, the lock is released when ctx is cancelled.
+func (m *Mutex) Acquire(ctx context.Context) error {
+	ticker := time.NewTicker(lockRetry)
+	defer ticker.Stop()
+	for {
+		ok, err := m.TryAcquire(ctx)
+		if err != nil || ok {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Release frees the lock, returning ErrNotHeld when it wasn't held
+func (m *Mutex) Release(ctx context.Context) error {
+	m.mu.Lock()
+	if m.stop != nil {
+		close(m.stop)
+		m.stop = nil
+	}
+	m.mu.Unlock()
+
+	ok, err := m.locker.ReleaseLock(context.WithoutCancel(ctx), m.name, m.owner)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotHeld
+	}
+	return nil
+}
+
+// Do runs fn holding the lock, waiting for it as Acquire does
+func (m *Mutex) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if err := m.Acquire(ctx); err != nil {
+		return err
+	}
+	defer m.Release(ctx)
+	return fn(ctx)
+}
+
+// releaseOnCancel releases the lock once ctx is cancelled
+func (m *Mutex) releaseOnCancel(ctx context.Context) {
+	if ctx.Done() == nil {
+		return
+	}
+	stop := make(chan struct{})
+	m.mu.Lock()
+	m.stop = stop
+	m.mu.Unlock()
+	go func() {
+		select {
+		case <-ctx.Done():
+			m.locker.ReleaseLock(context.WithoutCancel(ctx), m.name, m.owner)
+		case <-stop:
+		}
+	}()
+}
+
+// releaseScript deletes a lock only if the owner still holds it
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// AcquireLock sets the lock's key only if it doesn't exist, expiring after
+// ttl
+func (r *RedisCache) AcquireLock(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	return r.client.SetNX(ctx, lockPrefix+name, owner, ttl).Result()
+}
+
+// ReleaseLock deletes the lock's key if owner holds it, in one step so an
+// expired lock taken by someone else isn't deleted
+func (r *RedisCache) ReleaseLock(ctx context.Context, name, owner string) (bool, error) {
+	deleted, err := releaseScript.Run(ctx, r.client, []string{lockPrefix + name}, owner).Int()
+	return deleted > 0, err
+}
+
+// heldLock is a lock held in a MemoryCache
+type heldLock struct {
+	owner   string
+	expires time.Time
+}
+
+// AcquireLock takes the lock unless another owner holds it unexpired
+func (m *MemoryCache) AcquireLock(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if held, ok := m.locks[name]; ok && now.Before(held.expires) {
+		return false, nil
+	}
+	if m.locks == nil {
+		m.locks = make(map[string]heldLock)
+	}
+	m.locks[name] = heldLock{owner: owner, expires: now.Add(ttl)}
+	return true, nil
+}
+
+// ReleaseLock frees the lock if owner holds it
+func (m *MemoryCache) ReleaseLock(ctx context.Context, name, owner string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	held, ok := m.locks[name]
+	if !ok || held.owner != owner || !time.Now().Before(held.expires) {
+		return false, nil
+	}
+	delete(m.locks, name)
+	return true, nil
+}
+
+// LockRecord is a lock held in the cache_locks table
+type LockRecord struct {
+	Name      string    `gorm:"primaryKey;size:191"`
+	Owner     string    `gorm:"size:36;not null"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+}
+
+// TableName returns the table holding the locks
+func (LockRecord) TableName() string {
+	return "cache_locks"
+}
+
+// DatabaseLocker keeps locks in a table of the application database, for
+// apps whose instances share no Redis server
+type DatabaseLocker struct {
+	db *gorm.DB
+}
+
+var _ Locker = (*DatabaseLocker)(nil)
+
+// NewDatabaseLocker creates a database lock store, creating its table if
+// needed
+func NewDatabaseLocker(db *gorm.DB) (*DatabaseLocker, error) {
+	if err := db.AutoMigrate(&LockRecord{}); err != nil {
+		return nil, err
+	}
+	return &DatabaseLocker{db: db}, nil
+}
+
+// AcquireLock deletes the lock if it expired, then inserts it unless a row
+// for it is there still. The primary key makes the insert atomic.
+func (l *DatabaseLocker) AcquireLock(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	db := l.db.WithContext(ctx)
+	now := time.Now().UTC()
+	if err := db.Where("name = ? AND expires_at <= ?", name, now).Delete(&LockRecord{}).Error; err != nil {
+		return false, err
+	}
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&LockRecord{Name: name, Owner: owner, ExpiresAt: now.Add(ttl)})
+	return result.RowsAffected == 1, result.Error
+}
+
+// ReleaseLock deletes the lock if owner holds it unexpired
+func (l *DatabaseLocker) ReleaseLock(ctx context.Context, name, owner string) (bool, error) {
+	result := l.db.WithContext(ctx).
+		Where("name = ? AND owner = ? AND expires_at > ?", name, owner, time.Now().UTC()).
+		Delete(&LockRecord{})
+	return result.RowsAffected == 1, result.Error
+}
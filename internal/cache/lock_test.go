@@ -0,0 +1,139 @@
+package cache
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testLocker runs the behavior every Locker shares against locker
+func testLocker(t *testing.T, locker Locker) {
+	ctx := context.Background()
+
+	t.Run("exclusion", func(t *testing.T) {
+		first := NewMutex(locker, t.Name(), time.Minute)
+		second := NewMutex(locker, t.Name(), time.Minute)
+		ok, err := first.TryAcquire(ctx)
+		require.NoError(t, err)
+		require.True(t, ok)
+		ok, err = second.TryAcquire(ctx)
+		require.NoError(t, err)
+		assert.False(t, ok, "held by another owner")
+
+		other := NewMutex(locker, t.Name()+":other", time.Minute)
+		ok, err = other.TryAcquire(ctx)
+		require.NoError(t, err)
+		assert.True(t, ok, "other names are free")
+		require.NoError(t, other.Release(ctx))
+
+		require.NoError(t, first.Release(ctx))
+		ok, err = second.TryAcquire(ctx)
+		require.NoError(t, err)
+		assert.True(t, ok, "free once released")
+		require.NoError(t, second.Release(ctx))
+	})
+
+	t.Run("release by a non-owner", func(t *testing.T) {
+		owner := NewMutex(locker, t.Name(), time.Minute)
+		stranger := NewMutex(locker, t.Name(), time.Minute)
+		ok, err := owner.TryAcquire(ctx)
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		assert.ErrorIs(t, stranger.Release(ctx), ErrNotHeld)
+		ok, err = stranger.TryAcquire(ctx)
+		require.NoError(t, err)
+		assert.False(t, ok, "still held by its owner")
+		require.NoError(t, owner.Release(ctx))
+		assert.ErrorIs(t, owner.Release(ctx), ErrNotHeld, "released already")
+	})
+
+	t.Run("expiry", func(t *testing.T) {
+		crashed := NewMutex(locker, t.Name(), 200*time.Millisecond)
+		ok, err := crashed.TryAcquire(ctx)
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		next := NewMutex(locker, t.Name(), time.Minute)
+		assert.Eventually(t, func() bool {
+			ok, err := next.TryAcquire(ctx)
+			return err == nil && ok
+		}, 5*time.Second, 50*time.Millisecond)
+		assert.ErrorIs(t, crashed.Release(ctx), ErrNotHeld, "an expired owner can't free the next one's lock")
+		require.NoError(t, next.Release(ctx))
+	})
+
+	t.Run("release on cancel", func(t *testing.T) {
+		cancelled, cancel := context.WithCancel(ctx)
+		held := NewMutex(locker, t.Name(), time.Minute)
+		ok, err := held.TryAcquire(cancelled)
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		waiting := NewMutex(locker, t.Name(), time.Minute)
+		cancel()
+		assert.Eventually(t, func() bool {
+			ok, err := waiting.TryAcquire(ctx)
+			return err == nil && ok
+		}, 5*time.Second, 20*time.Millisecond)
+		require.NoError(t, waiting.Release(ctx))
+	})
+
+	t.Run("acquire waits", func(t *testing.T) {
+		held := NewMutex(locker, t.Name(), time.Minute)
+		ok, err := held.TryAcquire(ctx)
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		waiting := NewMutex(locker, t.Name(), time.Minute)
+		timeout, cancel := context.WithTimeout(ctx, 150*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, waiting.Acquire(timeout), context.DeadlineExceeded)
+
+		time.AfterFunc(150*time.Millisecond, func() { held.Release(ctx) })
+		ran := false
+		require.NoError(t, waiting.Do(ctx, func(ctx context.Context) error {
+			ran = true
+			return nil
+		}))
+		assert.True(t, ran)
+		ok, err = held.TryAcquire(ctx)
+		require.NoError(t, err)
+		assert.True(t, ok, "Do releases the lock")
+		require.NoError(t, held.Release(ctx))
+	})
+}
+
+func TestMemoryLocks(t *testing.T) {
+	testLocker(t, NewMemoryCache())
+}
+
+func TestDatabaseLocks(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "locks.db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	require.NoError(t, err)
+	locker, err := NewDatabaseLocker(db)
+	require.NoError(t, err)
+	testLocker(t, locker)
+}
+
+func TestRedisLocks(t *testing.T) {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_ADDR not set")
+	}
+	host, port, err := net.SplitHostPort(addr)
+	require.NoError(t, err)
+	portNumber, err := strconv.Atoi(port)
+	require.NoError(t, err)
+	testLocker(t, NewRedisCache(host, portNumber, 0))
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -74,9 +75,18 @@ func (r *RedisCache) Flush(ctx context.Context) error {
 	return r.client.FlushDB(ctx).Err()
 }
 
-// MemoryCache implements Cache interface using in-memory storage
+// MemoryCache implements Cache interface using in-memory storage.
+// It is safe for concurrent use, e.g. from HTTP middleware.
 type MemoryCache struct {
+	mu   sync.Mutex
 	data map[string]cacheItem
+
+	// tags holds the keys stored under each tag
+	tags        map[string]map[string]struct{}
+	onFlushTags func(ctx context.Context, tags []string)
+
+	// locks are kept apart from the data, so Flush doesn't release them
+	locks map[string]heldLock
 }
 
 type cacheItem struct {
@@ -93,6 +103,9 @@ func NewMemoryCache() *MemoryCache {
 
 // Get retrieves a value from cache
 func (m *MemoryCache) Get(ctx context.Context, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	item, exists := m.data[key]
 	if !exists {
 		return "", fmt.Errorf("key not found")
@@ -121,6 +134,8 @@ func (m *MemoryCache) Set(ctx context.Context, key string, value interface{}, ex
 		val = string(jsonData)
 	}
 
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.data[key] = cacheItem{
 		value:      val,
 		expiration: time.Now().Add(expiration),
@@ -131,12 +146,17 @@ func (m *MemoryCache) Set(ctx context.Context, key string, value interface{}, ex
 
 // Delete removes a value from cache
 func (m *MemoryCache) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	delete(m.data, key)
 	return nil
 }
 
 // Exists checks if a key exists in cache
 func (m *MemoryCache) Exists(ctx context.Context, key string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	item, exists := m.data[key]
 	if !exists {
 		return false, nil
@@ -152,7 +172,10 @@ func (m *MemoryCache) Exists(ctx context.Context, key string) (bool, error) {
 
 // Flush removes all keys from cache
 func (m *MemoryCache) Flush(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.data = make(map[string]cacheItem)
+	m.tags = nil
 	return nil
 }
 
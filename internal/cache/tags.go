@@ -0,0 +1,161 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// tagPrefix namespaces the Redis sets holding each tag's keys
+const tagPrefix = "dolphin:tags:"
+
+// TagStore is a cache that can group keys under tags and delete them
+// together
+type TagStore interface {
+	Cache
+
+	// TagKey records that key was stored under tags
+	TagKey(ctx context.Context, key string, tags []string) error
+
+	// FlushTags deletes the keys stored under any of tags
+	FlushTags(ctx context.Context, tags ...string) error
+}
+
+// Default is the app's cache, used by Tags. It keeps values in memory
+// until the router replaces it with the configured driver.
+var Default TagStore = NewMemoryCache()
+
+// Tags returns the default cache's keys under the named tags:
+//
+//	cache.Tags("users").Set(ctx, "users:7", user, time.Hour)
+//	cache.Tags("users").Flush(ctx) // deletes users:7 and every other key tagged users
+func Tags(names ...string) *TaggedCache {
+	return NewTagged(Default, names...)
+}
+
+// TaggedCache stores keys under tags, so they can be flushed together
+// without flushing the rest of the cache. Reads and deletes go straight to
+// the store.
+type TaggedCache struct {
+	store TagStore
+	tags  []string
+}
+
+var _ Cache = (*TaggedCache)(nil)
+
+// NewTagged returns store's keys under tags
+func NewTagged(store TagStore, tags ...string) *TaggedCache {
+	return &TaggedCache{store: store, tags: tags}
+}
+
+// Get retrieves a value from cache
+func (t *TaggedCache) Get(ctx context.Context, key string) (string, error) {
+	return t.store.Get(ctx, key)
+}
+
+// Set stores a value in cache under the tags
+func (t *TaggedCache) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	if err := t.store.TagKey(ctx, key, t.tags); err != nil {
+		return err
+	}
+	return t.store.Set(ctx, key, value, expiration)
+}
+
+// Delete removes a value from cache
+func (t *TaggedCache) Delete(ctx context.Context, key string) error {
+	return t.store.Delete(ctx, key)
+}
+
+// Exists checks if a key exists in cache
+func (t *TaggedCache) Exists(ctx context.Context, key string) (bool, error) {
+	return t.store.Exists(ctx, key)
+}
+
+// Flush removes the keys stored under any of the tags
+func (t *TaggedCache) Flush(ctx context.Context) error {
+	return t.store.FlushTags(ctx, t.tags...)
+}
+
+// Tags returns the cache's keys under the named tags
+func (r *RedisCache) Tags(names ...string) *TaggedCache {
+	return NewTagged(r, names...)
+}
+
+// TagKey adds key to a Redis set per tag, so every instance sharing the
+// server flushes the same keys
+func (r *RedisCache) TagKey(ctx context.Context, key string, tags []string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, tag := range tags {
+			pipe.SAdd(ctx, tagPrefix+tag, key)
+		}
+		return nil
+	})
+	return err
+}
+
+// FlushTags deletes the keys in the tags' sets, then the sets. Keys that
+// expired are left in their sets until then.
+func (r *RedisCache) FlushTags(ctx context.Context, tags ...string) error {
+	for _, tag := range tags {
+		keys, err := r.client.SMembers(ctx, tagPrefix+tag).Result()
+		if err != nil {
+			return err
+		}
+		if err := r.client.Del(ctx, append(keys, tagPrefix+tag)...).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Tags returns the cache's keys under the named tags
+func (m *MemoryCache) Tags(names ...string) *TaggedCache {
+	return NewTagged(m, names...)
+}
+
+// TagKey records key under tags
+func (m *MemoryCache) TagKey(ctx context.Context, key string, tags []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.tags == nil {
+		m.tags = make(map[string]map[string]struct{})
+	}
+	for _, tag := range tags {
+		if m.tags[tag] == nil {
+			m.tags[tag] = make(map[string]struct{})
+		}
+		m.tags[tag][key] = struct{}{}
+	}
+	return nil
+}
+
+// FlushTags deletes the keys stored under tags, then tells the function
+// set with OnFlushTags
+func (m *MemoryCache) FlushTags(ctx context.Context, tags ...string) error {
+	m.mu.Lock()
+	for _, tag := range tags {
+		for key := range m.tags[tag] {
+			delete(m.data, key)
+		}
+		delete(m.tags, tag)
+	}
+	onFlush := m.onFlushTags
+	m.mu.Unlock()
+
+	if onFlush != nil {
+		onFlush(ctx, tags)
+	}
+	return nil
+}
+
+// OnFlushTags sets a function called after tags are flushed, such as one
+// telling other instances to flush their copies
+func (m *MemoryCache) OnFlushTags(fn func(ctx context.Context, tags []string)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onFlushTags = fn
+}
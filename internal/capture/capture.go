@@ -0,0 +1,56 @@
+// Package capture holds what the request recorder and webhook capture
+// share to keep requests and responses and to replay them
+package capture
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// Buffer keeps the first Limit bytes written to it and discards the rest,
+// so a response can be teed into it whatever its size
+type Buffer struct {
+	bytes.Buffer
+	Limit     int
+	truncated bool
+}
+
+// NewBuffer creates a buffer keeping up to limit bytes
+func NewBuffer(limit int) *Buffer {
+	return &Buffer{Limit: limit}
+}
+
+// Write keeps what fits under the limit, reporting p as written in full
+func (b *Buffer) Write(p []byte) (int, error) {
+	if room := b.Limit - b.Len(); len(p) > room {
+		b.truncated = true
+		b.Buffer.Write(p[:max(room, 0)])
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// Truncated reports whether anything written was discarded
+func (b *Buffer) Truncated() bool {
+	return b.truncated
+}
+
+// Discard is a response writer dropping the response to a replay, which
+// has been kept by the time it is written
+type Discard struct {
+	header http.Header
+}
+
+// Header implements http.ResponseWriter
+func (w *Discard) Header() http.Header {
+	if w.header == nil {
+		w.header = http.Header{}
+	}
+	return w.header
+}
+
+// Write implements http.ResponseWriter
+func (w *Discard) Write(b []byte) (int, error) { return len(b), nil }
+
+// WriteHeader implements http.ResponseWriter
+func (w *Discard) WriteHeader(int) {}
@@ -0,0 +1,34 @@
+package capture
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuffer(t *testing.T) {
+	b := NewBuffer(5)
+	n, err := b.Write([]byte("abc"))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.False(t, b.Truncated())
+
+	n, err = b.Write([]byte("defgh"))
+	assert.NoError(t, err)
+	assert.Equal(t, 5, n, "writes are reported in full")
+	assert.Equal(t, "abcde", b.String())
+	assert.True(t, b.Truncated())
+
+	b.Write([]byte("ij"))
+	assert.Equal(t, "abcde", b.String(), "nothing is kept past the limit")
+}
+
+func TestDiscard(t *testing.T) {
+	w := &Discard{}
+	w.Header().Set("X-Test", "1")
+	w.WriteHeader(201)
+	n, err := w.Write([]byte("body"))
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+	assert.Equal(t, "1", w.Header().Get("X-Test"))
+}
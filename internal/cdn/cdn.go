@@ -0,0 +1,252 @@
+// Package cdn sets the caching headers a CDN in front of the app acts on,
+// and purges what it cached by surrogate key.
+//
+// Routes get a Cache-Control policy from the cdn.routes config or per
+// route, and handlers tag responses with the models they show:
+//
+//	r.With(cdn.Cache(cdn.Policy{SMaxAge: time.Hour, StaleWhileRevalidate: time.Minute})).
+//		Get("/posts/{id}", func(w http.ResponseWriter, r *http.Request) {
+//			cdn.TagModels(w, post) // Surrogate-Key: posts:7
+//			...
+//		})
+//
+// With cdn.purge_on_write, writing a post then purges posts:7 and posts,
+// the key of pages listing posts, from Fastly or Cloudflare.
+package cdn
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/routing"
+)
+
+const (
+	// SurrogateKeyHeader carries the space-separated keys Fastly purges by
+	SurrogateKeyHeader = "Surrogate-Key"
+
+	// CacheTagHeader carries the comma-separated tags Cloudflare purges by
+	CacheTagHeader = "Cache-Tag"
+)
+
+// Policy is how long browsers and the CDN may keep a route's responses
+type Policy struct {
+	// MaxAge is how long browsers keep a response, and SMaxAge how long
+	// the CDN does when it differs
+	MaxAge  time.Duration
+	SMaxAge time.Duration
+
+	// StaleWhileRevalidate serves a stale response while a fresh one is
+	// fetched, and StaleIfError while the app fails
+	StaleWhileRevalidate time.Duration
+	StaleIfError         time.Duration
+
+	// Private keeps responses out of the CDN, and NoStore out of every
+	// cache
+	Private bool
+	NoStore bool
+
+	// Keys tag every response
+	Keys []string
+}
+
+// PolicyFromConfig returns the policy of a cdn.routes entry
+func PolicyFromConfig(cfg config.CDNRouteConfig) Policy {
+	return Policy{
+		MaxAge:               cfg.MaxAge,
+		SMaxAge:              cfg.SMaxAge,
+		StaleWhileRevalidate: cfg.StaleWhileRevalidate,
+		StaleIfError:         cfg.StaleIfError,
+		Private:              cfg.Private,
+		NoStore:              cfg.NoStore,
+		Keys:                 cfg.Keys,
+	}
+}
+
+// CacheControl returns the policy's Cache-Control header
+func (p Policy) CacheControl() string {
+	if p.NoStore {
+		return "no-store"
+	}
+	directives := []string{"public", "max-age=" + seconds(p.MaxAge)}
+	if p.Private {
+		directives[0] = "private"
+	} else if p.SMaxAge > 0 {
+		directives = append(directives, "s-maxage="+seconds(p.SMaxAge))
+	}
+	if p.StaleWhileRevalidate > 0 {
+		directives = append(directives, "stale-while-revalidate="+seconds(p.StaleWhileRevalidate))
+	}
+	if p.StaleIfError > 0 {
+		directives = append(directives, "stale-if-error="+seconds(p.StaleIfError))
+	}
+	return strings.Join(directives, ", ")
+}
+
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(d/time.Second), 10)
+}
+
+// Apply sets the policy's headers on a response. Handlers may set their
+// own Cache-Control after it.
+func (p Policy) Apply(w http.ResponseWriter) {
+	w.Header().Set("Cache-Control", p.CacheControl())
+	if !p.Private && !p.NoStore {
+		Tag(w, p.Keys...)
+	}
+}
+
+// Cache applies policy to the GET and HEAD requests of the routes it
+// wraps. Responses setting cookies are sent as private, so one visitor's
+// session isn't cached for everyone.
+func Cache(policy Policy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			serve(policy, w, r, next)
+		})
+	}
+}
+
+// Routes applies the policy of each route pattern or path prefix to the
+// GET and HEAD requests it serves. A request's route pattern wins over
+// prefixes, and longer prefixes over shorter ones.
+func Routes(policies map[string]Policy) func(http.Handler) http.Handler {
+	routes := make([]string, 0, len(policies))
+	byRoute := make(map[string]Policy, len(policies))
+	for route, policy := range policies {
+		route = strings.ToLower(route)
+		routes = append(routes, route)
+		byRoute[route] = policy
+	}
+	sort.Slice(routes, func(i, j int) bool { return len(routes[i]) > len(routes[j]) })
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			policy, ok := byRoute[strings.ToLower(routing.Match(r))]
+			if !ok {
+				path := strings.ToLower(r.URL.Path)
+				for _, route := range routes {
+					prefix := strings.TrimSuffix(route, "/")
+					if path == route || strings.HasPrefix(path, prefix+"/") {
+						policy, ok = byRoute[route], true
+						break
+					}
+				}
+			}
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			serve(policy, w, r, next)
+		})
+	}
+}
+
+// serve applies policy and serves r, sending the response as private
+// should it set cookies
+func serve(policy Policy, w http.ResponseWriter, r *http.Request, next http.Handler) {
+	policy.Apply(w)
+	guard := &cookieGuard{ResponseWriter: w}
+	next.ServeHTTP(guard, r)
+	// Handlers that write nothing have their header written after
+	// returning, with cookies queued by middleware inside this one
+	if !guard.wroteHeader {
+		guard.check()
+	}
+}
+
+// Tag adds surrogate keys to a response, for Fastly's Surrogate-Key and
+// Cloudflare's Cache-Tag headers
+func Tag(w http.ResponseWriter, keys ...string) {
+	if len(keys) == 0 {
+		return
+	}
+	header := w.Header()
+	existing := strings.Fields(header.Get(SurrogateKeyHeader))
+	seen := make(map[string]bool, len(existing)+len(keys))
+	for _, key := range existing {
+		seen[key] = true
+	}
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		if key == "" || seen[key] || strings.ContainsAny(key, " ,") {
+			continue
+		}
+		seen[key] = true
+		existing = append(existing, key)
+	}
+	header.Set(SurrogateKeyHeader, strings.Join(existing, " "))
+	header.Set(CacheTagHeader, strings.Join(existing, ","))
+}
+
+// TagModels tags a response with the keys of the models it shows, which
+// are purged when they are written
+func TagModels(w http.ResponseWriter, models ...interface{}) {
+	for _, model := range models {
+		Tag(w, ModelKeys(model)...)
+	}
+}
+
+// TagCollection tags a response listing a model's rows, purged when any
+// of them is written
+func TagCollection(w http.ResponseWriter, model interface{}) {
+	Tag(w, CollectionKey(model))
+}
+
+// cookieGuard sends responses setting cookies as private, without
+// surrogate keys
+type cookieGuard struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+// check makes the response private when it sets cookies
+func (g *cookieGuard) check() {
+	header := g.Header()
+	if len(header.Values("Set-Cookie")) > 0 {
+		header.Set("Cache-Control", "private, no-store")
+		header.Del(SurrogateKeyHeader)
+		header.Del(CacheTagHeader)
+	}
+}
+
+func (g *cookieGuard) WriteHeader(code int) {
+	if !g.wroteHeader {
+		g.wroteHeader = true
+		g.check()
+	}
+	g.ResponseWriter.WriteHeader(code)
+}
+
+func (g *cookieGuard) Write(data []byte) (int, error) {
+	if !g.wroteHeader {
+		g.WriteHeader(http.StatusOK)
+	}
+	return g.ResponseWriter.Write(data)
+}
+
+func (g *cookieGuard) Flush() {
+	if flusher, ok := g.ResponseWriter.(http.Flusher); ok {
+		if !g.wroteHeader {
+			g.WriteHeader(http.StatusOK)
+		}
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (g *cookieGuard) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
@@ -0,0 +1,224 @@
+package cdn
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/cookies"
+	"github.com/mrhoseah/dolphin/internal/database"
+	"github.com/mrhoseah/dolphin/internal/orm"
+)
+
+type post struct {
+	orm.BaseModel
+	Title    string
+	AuthorID uint
+}
+
+func (p post) SurrogateKeys() []string {
+	return []string{fmt.Sprintf("authors:%d", p.AuthorID)}
+}
+
+type comment struct {
+	orm.BaseModel
+	Body string
+}
+
+func TestPolicyCacheControl(t *testing.T) {
+	for want, policy := range map[string]Policy{
+		"public, max-age=60, s-maxage=3600, stale-while-revalidate=30, stale-if-error=86400": {
+			MaxAge: time.Minute, SMaxAge: time.Hour, StaleWhileRevalidate: 30 * time.Second, StaleIfError: 24 * time.Hour,
+		},
+		"public, max-age=0, s-maxage=600": {SMaxAge: 10 * time.Minute},
+		"private, max-age=300":            {MaxAge: 5 * time.Minute, SMaxAge: time.Hour, Private: true},
+		"no-store":                        {MaxAge: time.Hour, NoStore: true},
+	} {
+		assert.Equal(t, want, policy.CacheControl())
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	jar, err := cookies.New("test-key", config.CookiesConfig{})
+	require.NoError(t, err)
+	r := chi.NewRouter()
+	r.Use(Routes(map[string]Policy{
+		"/posts/{id}": {SMaxAge: time.Hour, Keys: []string{"pages"}},
+		"/posts":      {MaxAge: time.Minute},
+		"/blog":       {SMaxAge: 10 * time.Minute},
+	}))
+	r.Use(cookies.Middleware)
+	r.Get("/posts/{id}", func(w http.ResponseWriter, r *http.Request) {
+		TagModels(w, &post{BaseModel: orm.BaseModel{ID: 7}, AuthorID: 1})
+		w.Write([]byte("post"))
+	})
+	r.Post("/posts/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	r.Get("/posts", func(w http.ResponseWriter, r *http.Request) {
+		TagCollection(w, &post{})
+	})
+	r.Get("/blog/*", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-cache")
+	})
+	r.Get("/account", func(w http.ResponseWriter, r *http.Request) {})
+	r.Get("/posts/{id}/draft", func(w http.ResponseWriter, r *http.Request) {
+		jar.Queue(r.Context(), "seen", "1")
+	})
+	get := func(method, path string) http.Header {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w.Header()
+	}
+
+	header := get(http.MethodGet, "/posts/7")
+	assert.Equal(t, "public, max-age=0, s-maxage=3600", header.Get("Cache-Control"))
+	assert.Equal(t, "pages posts:7 authors:1", header.Get(SurrogateKeyHeader))
+	assert.Equal(t, "pages,posts:7,authors:1", header.Get(CacheTagHeader))
+
+	header = get(http.MethodGet, "/posts")
+	assert.Equal(t, "public, max-age=60", header.Get("Cache-Control"))
+	assert.Equal(t, "posts", header.Get(SurrogateKeyHeader))
+
+	assert.Equal(t, "no-cache", get(http.MethodGet, "/blog/hello").Get("Cache-Control"), "handlers override the policy")
+	assert.Empty(t, get(http.MethodPost, "/posts/7").Get("Cache-Control"))
+	assert.Empty(t, get(http.MethodGet, "/account").Get("Cache-Control"))
+
+	// Matched by prefix, but setting a cookie
+	header = get(http.MethodGet, "/posts/7/draft")
+	assert.Equal(t, "private, no-store", header.Get("Cache-Control"))
+	assert.Empty(t, header.Get(SurrogateKeyHeader))
+	assert.NotEmpty(t, header.Get("Set-Cookie"))
+}
+
+func TestKeys(t *testing.T) {
+	assert.Equal(t, "posts", CollectionKey(&post{}))
+	assert.Equal(t, "comments", CollectionKey(comment{}))
+	assert.Equal(t, []string{"comments:3"}, ModelKeys(comment{BaseModel: orm.BaseModel{ID: 3}}))
+	assert.Empty(t, ModelKeys(&comment{}), "not saved yet")
+
+	w := httptest.NewRecorder()
+	Tag(w, "a", "b")
+	Tag(w, "b", "c", "with space", "")
+	assert.Equal(t, "a b c", w.Header().Get(SurrogateKeyHeader))
+}
+
+func TestFastly(t *testing.T) {
+	var requests []*http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		if r.Header.Get("Fastly-Key") != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"msg":"Provided credentials are missing or invalid"}`))
+			return
+		}
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	defer server.Close()
+
+	keys := make([]string, 300)
+	for i := range keys {
+		keys[i] = "posts:" + string(rune('a'+i%26)) + strings.Repeat("x", i/26)
+	}
+	fastly := NewFastly(config.FastlyConfig{APIToken: "token", ServiceID: "SU1Z0isxPaozGVKXdv0eY", SoftPurge: true, BaseURL: server.URL})
+	require.NoError(t, fastly.Purge(context.Background(), append(keys, keys[0])...))
+	require.Len(t, requests, 2, "in batches of 256")
+	assert.Equal(t, "/service/SU1Z0isxPaozGVKXdv0eY/purge", requests[0].URL.Path)
+	assert.Equal(t, "1", requests[0].Header.Get("Fastly-Soft-Purge"))
+	assert.Len(t, strings.Fields(requests[0].Header.Get("Surrogate-Key")), 256)
+	assert.Len(t, strings.Fields(requests[1].Header.Get("Surrogate-Key")), 44)
+
+	fastly = NewFastly(config.FastlyConfig{APIToken: "wrong", ServiceID: "svc", BaseURL: server.URL})
+	err := fastly.Purge(context.Background(), "posts")
+	assert.EqualError(t, err, "cdn: fastly purge failed with 401: Provided credentials are missing or invalid")
+}
+
+func TestCloudflare(t *testing.T) {
+	var tags [][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/client/v4/zones/zone-1/purge_cache", r.URL.Path)
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		var body struct {
+			Tags []string `json:"tags"`
+		}
+		data, _ := io.ReadAll(r.Body)
+		require.NoError(t, json.Unmarshal(data, &body))
+		tags = append(tags, body.Tags)
+		if body.Tags[0] == "forbidden" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"success":false,"errors":[{"code":10000,"message":"Authentication error"}]}`))
+			return
+		}
+		w.Write([]byte(`{"success":true,"errors":[],"result":{"id":"zone-1"}}`))
+	}))
+	defer server.Close()
+
+	cloudflare := NewCloudflare(config.CloudflareConfig{APIToken: "token", ZoneID: "zone-1", BaseURL: server.URL})
+	require.NoError(t, cloudflare.Purge(context.Background(), "posts", "posts:7"))
+	assert.Equal(t, [][]string{{"posts", "posts:7"}}, tags)
+	assert.EqualError(t, cloudflare.Purge(context.Background(), "forbidden"), "cdn: cloudflare purge failed with 403: Authentication error")
+}
+
+func TestFromConfig(t *testing.T) {
+	purger, err := FromConfig(config.CDNConfig{Driver: "none"})
+	require.NoError(t, err)
+	assert.Nil(t, purger)
+
+	purger, err = FromConfig(config.CDNConfig{Driver: "cloudflare", Cloudflare: config.CloudflareConfig{APIToken: "token", ZoneID: "zone"}})
+	require.NoError(t, err)
+	assert.IsType(t, &Cloudflare{}, purger)
+
+	_, err = FromConfig(config.CDNConfig{Driver: "fastly"})
+	assert.Error(t, err)
+	_, err = FromConfig(config.CDNConfig{Driver: "akamai"})
+	assert.Error(t, err)
+}
+
+// recordingPurger keeps the keys it is asked to purge
+type recordingPurger struct {
+	purged [][]string
+}
+
+func (p *recordingPurger) Purge(ctx context.Context, keys ...string) error {
+	p.purged = append(p.purged, keys)
+	return nil
+}
+
+func TestInvalidator(t *testing.T) {
+	db, err := database.New(&config.DatabaseConfig{Driver: "sqlite", Database: filepath.Join(t.TempDir(), "app.db")})
+	require.NoError(t, err)
+	gdb := db.GetDB()
+	require.NoError(t, gdb.AutoMigrate(&post{}, &comment{}))
+
+	purger := &recordingPurger{}
+	invalidator := NewInvalidator(purger, nil)
+	invalidator.dispatch = invalidator.purge
+	require.NoError(t, gdb.Use(invalidator))
+
+	p := post{Title: "Hello", AuthorID: 1}
+	require.NoError(t, gdb.Create(&p).Error)
+	require.NoError(t, gdb.Model(&p).Update("title", "Hello again").Error)
+	comments := []comment{{Body: "First"}, {Body: "Second"}}
+	require.NoError(t, gdb.Create(&comments).Error)
+	require.NoError(t, gdb.Model(&comment{}).Where("body = ?", "First").Update("body", "Edited").Error)
+	require.NoError(t, gdb.Delete(&comments[1]).Error)
+	require.NoError(t, gdb.Where("title = ?", "missing").Delete(&post{}).Error)
+
+	assert.Equal(t, [][]string{
+		{"posts", "posts:1", "authors:1"},
+		{"posts", "posts:1", "authors:1"},
+		{"comments", "comments:1", "comments:2"},
+		{"comments"},
+		{"comments", "comments:2"},
+	}, purger.purged, "nothing for writes changing no rows")
+}
@@ -0,0 +1,79 @@
+package cdn
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const pluginName = "dolphin:cdn"
+
+// purgeTimeout bounds a purge sent after a write
+const purgeTimeout = 30 * time.Second
+
+// Invalidator is a GORM plugin purging the keys of models after they are
+// created, updated or deleted: the collection key of their table and each
+// model's keys. Updates by condition carry no models, so only the
+// collection key is purged for them.
+type Invalidator struct {
+	purger Purger
+	logger *zap.Logger
+
+	// dispatch sends a purge; in the background, so writes don't wait for
+	// the CDN
+	dispatch func(keys []string)
+}
+
+// NewInvalidator returns a plugin purging with purger, logging failures
+func NewInvalidator(purger Purger, logger *zap.Logger) *Invalidator {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	inv := &Invalidator{purger: purger, logger: logger}
+	inv.dispatch = func(keys []string) {
+		go inv.purge(keys)
+	}
+	return inv
+}
+
+// Name implements gorm.Plugin
+func (inv *Invalidator) Name() string {
+	return pluginName
+}
+
+// Initialize implements gorm.Plugin by purging after each write commits
+func (inv *Invalidator) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Create().After("gorm:commit_or_rollback_transaction").Register(pluginName+"_create", inv.written); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:commit_or_rollback_transaction").Register(pluginName+"_update", inv.written); err != nil {
+		return err
+	}
+	return cb.Delete().After("gorm:commit_or_rollback_transaction").Register(pluginName+"_delete", inv.written)
+}
+
+// written purges the keys of the models a write changed
+func (inv *Invalidator) written(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil || db.RowsAffected == 0 {
+		return
+	}
+	s := db.Statement.Schema
+	keys := []string{s.Table}
+	eachModel(db.Statement.ReflectValue, func(value reflect.Value, model interface{}) {
+		keys = append(keys, modelKeys(db.Statement.Context, s, value, model)...)
+	})
+	inv.dispatch(keys)
+}
+
+// purge sends a purge, logging failures
+func (inv *Invalidator) purge(keys []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), purgeTimeout)
+	defer cancel()
+	if err := inv.purger.Purge(ctx, keys...); err != nil {
+		inv.logger.Warn("Failed to purge the CDN", zap.Strings("keys", keys), zap.Error(err))
+	}
+}
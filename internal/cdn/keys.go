@@ -0,0 +1,86 @@
+package cdn
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"gorm.io/gorm/schema"
+)
+
+// Keyed is a model tagging the responses showing it with more keys than
+// its own, such as its author's; they are purged with it
+type Keyed interface {
+	SurrogateKeys() []string
+}
+
+// schemas caches the parsed schemas of models tagged by handlers
+var schemas sync.Map
+
+// parse returns a model's schema, named as GORM names tables by default
+func parse(model interface{}) (*schema.Schema, error) {
+	return schema.Parse(model, &schemas, schema.NamingStrategy{})
+}
+
+// CollectionKey is the key of a model's table, e.g. posts, which tags
+// pages listing its rows
+func CollectionKey(model interface{}) string {
+	s, err := parse(model)
+	if err != nil {
+		return ""
+	}
+	return s.Table
+}
+
+// ModelKeys are the keys of a model: its table and primary key, e.g.
+// posts:7, and those it names as Keyed
+func ModelKeys(model interface{}) []string {
+	s, err := parse(model)
+	if err != nil {
+		return nil
+	}
+	value := reflect.ValueOf(model)
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	return modelKeys(context.Background(), s, value, model)
+}
+
+// modelKeys returns the keys of the model value holds, s being its schema
+func modelKeys(ctx context.Context, s *schema.Schema, value reflect.Value, model interface{}) []string {
+	var keys []string
+	if field := s.PrioritizedPrimaryField; field != nil {
+		if id, zero := field.ValueOf(ctx, value); !zero {
+			keys = append(keys, fmt.Sprintf("%s:%v", s.Table, id))
+		}
+	}
+	if keyed, ok := model.(Keyed); ok {
+		keys = append(keys, keyed.SurrogateKeys()...)
+	}
+	return keys
+}
+
+// eachModel calls fn with each model held by value, a model or a slice of
+// them
+func eachModel(value reflect.Value, fn func(value reflect.Value, model interface{})) {
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !value.IsNil() {
+			eachModel(value.Elem(), fn)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			eachModel(value.Index(i), fn)
+		}
+	case reflect.Struct:
+		model := value.Interface()
+		if value.CanAddr() {
+			model = value.Addr().Interface()
+		}
+		fn(value, model)
+	}
+}
@@ -0,0 +1,187 @@
+package cdn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+const (
+	// fastlyBatch is the most surrogate keys Fastly purges per request
+	fastlyBatch = 256
+
+	// cloudflareBatch is the most cache tags Cloudflare purges per request
+	cloudflareBatch = 100
+)
+
+// Purger removes the responses tagged with surrogate keys from a CDN
+type Purger interface {
+	Purge(ctx context.Context, keys ...string) error
+}
+
+// FromConfig returns the purger of cfg.Driver, or nil for none
+func FromConfig(cfg config.CDNConfig) (Purger, error) {
+	switch cfg.Driver {
+	case "", "none":
+		return nil, nil
+	case "fastly":
+		if cfg.Fastly.APIToken == "" || cfg.Fastly.ServiceID == "" {
+			return nil, fmt.Errorf("cdn: fastly needs an api_token and service_id")
+		}
+		return NewFastly(cfg.Fastly), nil
+	case "cloudflare":
+		if cfg.Cloudflare.APIToken == "" || cfg.Cloudflare.ZoneID == "" {
+			return nil, fmt.Errorf("cdn: cloudflare needs an api_token and zone_id")
+		}
+		return NewCloudflare(cfg.Cloudflare), nil
+	default:
+		return nil, fmt.Errorf("cdn: unknown driver %q", cfg.Driver)
+	}
+}
+
+// Fastly purges a Fastly service by surrogate key
+type Fastly struct {
+	token     string
+	serviceID string
+	soft      bool
+	baseURL   string
+	client    *http.Client
+}
+
+// NewFastly returns a purger for the config's service
+func NewFastly(cfg config.FastlyConfig) *Fastly {
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = "https://api.fastly.com"
+	}
+	return &Fastly{
+		token:     cfg.APIToken,
+		serviceID: cfg.ServiceID,
+		soft:      cfg.SoftPurge,
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Purge removes the responses tagged with keys, or marks them stale with
+// soft_purge
+func (f *Fastly) Purge(ctx context.Context, keys ...string) error {
+	for _, batch := range batches(keys, fastlyBatch) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.baseURL+"/service/"+url.PathEscape(f.serviceID)+"/purge", nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Fastly-Key", f.token)
+		req.Header.Set("Surrogate-Key", strings.Join(batch, " "))
+		req.Header.Set("Accept", "application/json")
+		if f.soft {
+			req.Header.Set("Fastly-Soft-Purge", "1")
+		}
+		if err := send(f.client, req, "fastly"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Cloudflare purges a Cloudflare zone by cache tag
+type Cloudflare struct {
+	token   string
+	zoneID  string
+	baseURL string
+	client  *http.Client
+}
+
+// NewCloudflare returns a purger for the config's zone
+func NewCloudflare(cfg config.CloudflareConfig) *Cloudflare {
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = "https://api.cloudflare.com"
+	}
+	return &Cloudflare{
+		token:   cfg.APIToken,
+		zoneID:  cfg.ZoneID,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Purge removes the responses tagged with keys
+func (c *Cloudflare) Purge(ctx context.Context, keys ...string) error {
+	for _, batch := range batches(keys, cloudflareBatch) {
+		body, err := json.Marshal(map[string][]string{"tags": batch})
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/client/v4/zones/"+url.PathEscape(c.zoneID)+"/purge_cache", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+c.token)
+		req.Header.Set("Content-Type", "application/json")
+		if err := send(c.client, req, "cloudflare"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send sends a purge, turning an error status into an error with the
+// CDN's message
+func send(client *http.Client, req *http.Request, cdn string) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("cdn: %s purge: %w", cdn, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	var body struct {
+		// Fastly
+		Msg string `json:"msg"`
+		// Cloudflare
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	json.Unmarshal(data, &body)
+	message := body.Msg
+	if len(body.Errors) > 0 {
+		message = body.Errors[0].Message
+	}
+	if message == "" {
+		message = http.StatusText(resp.StatusCode)
+	}
+	return fmt.Errorf("cdn: %s purge failed with %d: %s", cdn, resp.StatusCode, message)
+}
+
+// batches splits keys into groups of at most size, without duplicates
+func batches(keys []string, size int) [][]string {
+	seen := make(map[string]bool, len(keys))
+	var unique []string
+	for _, key := range keys {
+		if key != "" && !seen[key] {
+			seen[key] = true
+			unique = append(unique, key)
+		}
+	}
+	var out [][]string
+	for len(unique) > 0 {
+		n := min(size, len(unique))
+		out = append(out, unique[:n])
+		unique = unique[n:]
+	}
+	return out
+}
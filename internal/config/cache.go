@@ -0,0 +1,204 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// CachePath is where `dolphin config:cache` writes the compiled
+// configuration
+const CachePath = "storage/framework/config.json"
+
+var (
+	resolvedMu sync.RWMutex
+	resolved   = viper.New()
+)
+
+// Cache compiles the configuration from its sources, .env included, into
+// CachePath, which Load then reads instead. It returns the configuration
+// that was cached.
+func Cache() (*Config, error) {
+	config, err := loadSources()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(settings().AllSettings(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(CachePath), 0755); err != nil {
+		return nil, err
+	}
+
+	// The cache holds secrets from .env; write it whole, readable by the
+	// owner only
+	tmp := CachePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, CachePath); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// ClearCache removes the configuration cache, so that Load reads the
+// sources again. It reports whether there was a cache.
+func ClearCache() (bool, error) {
+	err := os.Remove(CachePath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// loadCache loads the configuration compiled by Cache
+func loadCache(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	setDefaults()
+	viper.SetConfigType("json")
+	if err := viper.ReadConfig(bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("failed to read config cache %s (remove it with `dolphin config:clear`): %w", path, err)
+	}
+	return resolve()
+}
+
+// settingsOf returns a value of the Config tree as settings keyed by
+// mapstructure tags, with durations written as strings such as "30s"
+func settingsOf(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return settingsOf(v.Elem())
+	case reflect.Struct:
+		m := make(map[string]interface{}, v.NumField())
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, _, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = strings.ToLower(field.Name)
+			}
+			m[name] = settingsOf(v.Field(i))
+		}
+		return m
+	case reflect.Map:
+		m := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			m[fmt.Sprint(iter.Key().Interface())] = settingsOf(iter.Value())
+		}
+		return m
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			items[i] = settingsOf(v.Index(i))
+		}
+		return items
+	}
+
+	if d, ok := v.Interface().(time.Duration); ok {
+		return d.String()
+	}
+	return v.Interface()
+}
+
+func setResolved(v *viper.Viper) {
+	resolvedMu.Lock()
+	defer resolvedMu.Unlock()
+	resolved = v
+}
+
+// settings returns the configuration last loaded, environment overrides
+// included
+func settings() *viper.Viper {
+	resolvedMu.RLock()
+	defer resolvedMu.RUnlock()
+	return resolved
+}
+
+// Get returns the value at a dotted key, such as "server.port", in the
+// configuration last loaded, or nil when it isn't set. Keys the Config
+// struct doesn't know, such as services.stripe.key, can be read too.
+func Get(key string) interface{} {
+	return settings().Get(key)
+}
+
+// IsSet reports whether key has a value
+func IsSet(key string) bool {
+	return settings().IsSet(key)
+}
+
+// GetString returns the value at key as a string
+func GetString(key string) string {
+	return settings().GetString(key)
+}
+
+// GetInt returns the value at key as an int
+func GetInt(key string) int {
+	return settings().GetInt(key)
+}
+
+// GetInt64 returns the value at key as an int64
+func GetInt64(key string) int64 {
+	return settings().GetInt64(key)
+}
+
+// GetFloat64 returns the value at key as a float64
+func GetFloat64(key string) float64 {
+	return settings().GetFloat64(key)
+}
+
+// GetBool returns the value at key as a bool
+func GetBool(key string) bool {
+	return settings().GetBool(key)
+}
+
+// GetStringSlice returns the value at key as a slice of strings
+func GetStringSlice(key string) []string {
+	return settings().GetStringSlice(key)
+}
+
+// GetStringMapString returns the value at key as a map of strings
+func GetStringMapString(key string) map[string]string {
+	return settings().GetStringMapString(key)
+}
+
+// GetDuration returns the value at key as a duration. Strings such as
+// "200ms" are parsed; plain numbers are seconds, as in server.read_timeout.
+func GetDuration(key string) time.Duration {
+	s := settings()
+	switch v := s.Get(key).(type) {
+	case int:
+		return time.Duration(v) * time.Second
+	case int64:
+		return time.Duration(v) * time.Second
+	case float64:
+		return time.Duration(v * float64(time.Second))
+	}
+	return s.GetDuration(key)
+}
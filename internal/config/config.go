@@ -1,24 +1,73 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"reflect"
 	"strconv"
 	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/spf13/viper"
+
+	"github.com/mrhoseah/dolphin/internal/security"
 )
 
 // Config holds all configuration for the application
 type Config struct {
-	App      AppConfig      `mapstructure:"app"`
-	Server   ServerConfig   `mapstructure:"server"`
-	Database DatabaseConfig `mapstructure:"database"`
-	Log      LogConfig      `mapstructure:"log"`
-	Cache    CacheConfig    `mapstructure:"cache"`
-	Session  SessionConfig  `mapstructure:"session"`
-	JWT      JWTConfig      `mapstructure:"jwt"`
-	Auth     AuthConfig     `mapstructure:"auth"`
+	App       AppConfig       `mapstructure:"app"`
+	Server    ServerConfig    `mapstructure:"server"`
+	HTTP      HTTPConfig      `mapstructure:"http"`
+	Database  DatabaseConfig  `mapstructure:"database"`
+	Log       LogConfig       `mapstructure:"log"`
+	Cache     CacheConfig     `mapstructure:"cache"`
+	Session   SessionConfig   `mapstructure:"session"`
+	JWT       JWTConfig       `mapstructure:"jwt"`
+	Auth      AuthConfig      `mapstructure:"auth"`
+	Features  FeaturesConfig  `mapstructure:"features"`
+	Tenancy   TenancyConfig   `mapstructure:"tenancy"`
+	ReadOnly  ReadOnlyConfig  `mapstructure:"read_only"`
+	Health    HealthConfig    `mapstructure:"health"`
+	Metering  MeteringConfig  `mapstructure:"metering"`
+	Metrics   MetricsConfig   `mapstructure:"metrics"`
+	SLO       SLOConfig       `mapstructure:"slo"`
+	Tracing   TracingConfig   `mapstructure:"tracing"`
+	Startup   StartupConfig   `mapstructure:"startup"`
+	Mail      MailConfig      `mapstructure:"mail"`
+	Debug     DebugConfig     `mapstructure:"debug"`
+	Presence  PresenceConfig  `mapstructure:"presence"`
+	Broadcast BroadcastConfig `mapstructure:"broadcast"`
+	SSE       SSEConfig       `mapstructure:"sse"`
+	Storage   StorageConfig   `mapstructure:"storage"`
+	Queue     QueueConfig     `mapstructure:"queue"`
+	Tus       TusConfig       `mapstructure:"tus"`
+	Scan      ScanConfig      `mapstructure:"scan"`
+	Payments  PaymentsConfig  `mapstructure:"payments"`
+	CDN       CDNConfig       `mapstructure:"cdn"`
+	Notify    NotifyConfig    `mapstructure:"notifications"`
+	Search    SearchConfig    `mapstructure:"search"`
+	Workflow  WorkflowConfig  `mapstructure:"workflow"`
+	Async     AsyncConfig     `mapstructure:"async"`
+	Vite      ViteConfig      `mapstructure:"vite"`
+	Outbox    OutboxConfig    `mapstructure:"outbox"`
+	Cookies   CookiesConfig   `mapstructure:"cookies"`
+	I18n      I18nConfig      `mapstructure:"i18n"`
+
+	Preferences PreferencesConfig `mapstructure:"preferences"`
+	Experiments ExperimentsConfig `mapstructure:"experiments"`
+	SEO         SEOConfig         `mapstructure:"seo"`
+	Intrusion   IntrusionConfig   `mapstructure:"intrusion"`
+	Artifacts   ArtifactsConfig   `mapstructure:"artifacts"`
+	Idempotency IdempotencyConfig `mapstructure:"idempotency"`
+	Signing     SigningConfig     `mapstructure:"signing"`
+	Gateway     GatewayConfig     `mapstructure:"gateway"`
+	Webhooks    WebhooksConfig    `mapstructure:"webhooks"`
+
+	// Required lists keys that must be set to a non-empty value, such as
+	// services.stripe.secret; loading fails otherwise
+	Required []string `mapstructure:"required"`
 }
 
 // AppConfig holds application-specific configuration
@@ -40,8 +89,97 @@ type ServerConfig struct {
 	IdleTimeout  int    `mapstructure:"idle_timeout"`
 }
 
+// HTTPConfig holds the presets of the HTTP middleware, kept in
+// config/http.yaml by new projects
+type HTTPConfig struct {
+	CORS CORSConfig     `mapstructure:"cors"`
+	Auth HTTPAuthConfig `mapstructure:"auth"`
+
+	// RateLimits are named limiters, used on routes with
+	// router.RateLimit(name) or "throttle:<name>" and applied to their Paths
+	RateLimits map[string]RateLimitConfig `mapstructure:"rate_limits"`
+
+	// MiddlewareGroups lists the middleware aliases of each group, such as
+	// web and api, which routes ask for with routing.Router.Group
+	MiddlewareGroups map[string][]string `mapstructure:"middleware_groups"`
+
+	// Requests bounds request bodies and how long requests may run
+	Requests RequestsConfig `mapstructure:"requests"`
+
+	// TrustedProxies are the IPs and CIDR ranges of the load balancers and
+	// proxies in front of the app. Only their X-Forwarded-For, X-Real-IP
+	// and True-Client-IP headers are believed for the client's IP, which
+	// bans, rate limits and intrusion detection go by.
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+}
+
+// RequestsConfig holds the limits of every request, and the overrides of
+// routes
+type RequestsConfig struct {
+	RequestLimitsConfig `mapstructure:",squash"`
+
+	// Routes overrides the limits by route pattern or path prefix, e.g.
+	// {"/api/v1/imports": {max_body_size: 52428800, timeout: 5m}}; unset
+	// fields keep the limits above
+	Routes map[string]RequestLimitsConfig `mapstructure:"routes"`
+}
+
+// RequestLimitsConfig bounds requests
+type RequestLimitsConfig struct {
+	// MaxBodySize caps request bodies in bytes, larger ones getting 413;
+	// 0 leaves them to the binder's 1 MB limit
+	MaxBodySize int64 `mapstructure:"max_body_size"`
+
+	// Timeout cancels the request's context, and the queries run with it,
+	// answering 408; 0 for none
+	Timeout time.Duration `mapstructure:"timeout"`
+
+	// SlowThreshold replaces log.access.slow_threshold when set
+	SlowThreshold time.Duration `mapstructure:"slow_threshold"`
+}
+
+// CORSConfig controls the CORS headers answered to other origins
+type CORSConfig struct {
+	// AllowedOrigins lists the origins allowed, such as
+	// https://app.example.com; "*" allows any, and a "*" within an origin
+	// matches one subdomain level, as in https://*.example.com
+	AllowedOrigins   []string `mapstructure:"allowed_origins"`
+	AllowedMethods   []string `mapstructure:"allowed_methods"`
+	AllowedHeaders   []string `mapstructure:"allowed_headers"`
+	ExposedHeaders   []string `mapstructure:"exposed_headers"`
+	AllowCredentials bool     `mapstructure:"allow_credentials"`
+
+	// MaxAge is how many seconds browsers may cache a preflight response
+	MaxAge int `mapstructure:"max_age"`
+}
+
+// HTTPAuthConfig holds the defaults of authentication
+type HTTPAuthConfig struct {
+	// Guard is the guard requests are authenticated with unless they name
+	// another: web or api
+	Guard string `mapstructure:"guard"`
+}
+
+// RateLimitConfig is a named rate limiter
+type RateLimitConfig struct {
+	// Limit requests are allowed per Window
+	Limit  int           `mapstructure:"limit"`
+	Window time.Duration `mapstructure:"window"`
+
+	// By is what requests are counted by: ip, or user, which counts
+	// guests by IP
+	By string `mapstructure:"by"`
+
+	// Paths are the path prefixes the limiter applies to, besides the
+	// routes that use it by name. Limiters by user apply to the routes
+	// behind auth under them.
+	Paths []string `mapstructure:"paths"`
+}
+
 // DatabaseConfig holds database configuration
 type DatabaseConfig struct {
+	// Driver is postgres, mysql, sqlite or sqlserver. Named connections may
+	// also use clickhouse, which is read-only.
 	Driver   string `mapstructure:"driver"`
 	Host     string `mapstructure:"host"`
 	Port     int    `mapstructure:"port"`
@@ -53,32 +191,1342 @@ type DatabaseConfig struct {
 	MaxOpen  int    `mapstructure:"max_open"`
 	MaxIdle  int    `mapstructure:"max_idle"`
 	MaxLife  int    `mapstructure:"max_life"`
+
+	// Schema sets the Postgres search_path for the connection
+	Schema string `mapstructure:"schema"`
+
+	// SlowQueryThreshold flags queries taking at least this long
+	SlowQueryThreshold time.Duration `mapstructure:"slow_query_threshold"`
+
+	// QueryTimeout bounds each statement; database.WithQueryTimeout
+	// overrides it per query and zero leaves only the request's deadline
+	QueryTimeout time.Duration `mapstructure:"query_timeout"`
+
+	// QueryLogSize is how many recent queries are kept for the debug dashboard
+	QueryLogSize int `mapstructure:"query_log_size"`
+
+	// Prune maps table names to how long soft-deleted rows are kept
+	// before model:prune removes them, e.g. {"sessions": "720h"}. The
+	// tables need deleted_at and id columns; id may be of any type.
+	Prune map[string]time.Duration `mapstructure:"prune"`
+
+	// Optimize configures db:optimize
+	Optimize OptimizeConfig `mapstructure:"optimize"`
+
+	// Replicas receive SELECTs; the connection above stays the primary
+	Replicas []ReplicaConfig `mapstructure:"replicas"`
+
+	// ReplicaHealthInterval is how often replicas are pinged
+	ReplicaHealthInterval time.Duration `mapstructure:"replica_health_interval"`
+
+	// Connections are additional named databases, e.g. an analytics
+	// warehouse, that migrations can target
+	Connections map[string]ConnectionConfig `mapstructure:"connections"`
+}
+
+// OptimizeConfig holds db:optimize configuration
+type OptimizeConfig struct {
+	// Tables are maintained when no --table is given; empty means every table
+	Tables []string `mapstructure:"tables"`
+
+	// PeakHours are "HH:MM-HH:MM" windows, which may wrap past midnight,
+	// when db:optimize refuses to run without --force
+	PeakHours []string `mapstructure:"peak_hours"`
+
+	// Timezone the peak hours are in, e.g. "Africa/Nairobi"; empty is local time
+	Timezone string `mapstructure:"timezone"`
+}
+
+// ConnectionConfig describes a named connection. Empty fields inherit the
+// primary's.
+type ConnectionConfig struct {
+	Driver   string `mapstructure:"driver"`
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	Database string `mapstructure:"database"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	SSLMode  string `mapstructure:"ssl_mode"`
+	Schema   string `mapstructure:"schema"`
+
+	// QueryTimeout replaces the primary's statement timeout, e.g. longer
+	// for a warehouse
+	QueryTimeout time.Duration `mapstructure:"query_timeout"`
+}
+
+// ReplicaConfig describes a read replica. Empty fields inherit the primary's.
+type ReplicaConfig struct {
+	Name     string `mapstructure:"name"`
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	Database string `mapstructure:"database"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+}
+
+// ReadOnlyConfig holds read-only mode configuration
+type ReadOnlyConfig struct {
+	// Enabled forces read-only mode on regardless of the runtime toggle
+	Enabled    bool   `mapstructure:"enabled"`
+	Message    string `mapstructure:"message"`
+	RetryAfter int    `mapstructure:"retry_after"`
+
+	// AdminToken authorizes toggling read-only mode over HTTP; the admin
+	// API is disabled while it is empty
+	AdminToken string `mapstructure:"admin_token"`
+}
+
+// HealthConfig holds health check configuration
+type HealthConfig struct {
+	// Timeout bounds each check; a check still running is reported unhealthy
+	Timeout time.Duration `mapstructure:"timeout"`
+
+	// DiskPath is checked for at least DiskMinFreeMB free; 0 disables the check
+	DiskPath      string `mapstructure:"disk_path"`
+	DiskMinFreeMB int    `mapstructure:"disk_min_free_mb"`
+
+	// Migrations makes the app unready while migrations are pending
+	Migrations bool `mapstructure:"migrations"`
+
+	// URLs are external services checked by name; a failure degrades
+	// health without failing readiness
+	URLs map[string]string `mapstructure:"urls"`
+
+	// Storage lists the disks whose write, read and delete round trip is
+	// checked; a failure degrades health without failing readiness
+	Storage []string `mapstructure:"storage"`
+}
+
+// MeteringConfig holds usage metering configuration
+type MeteringConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// Window is the aggregation window usage is stored in
+	Window time.Duration `mapstructure:"window"`
+
+	// FlushInterval is how often closed windows are saved
+	FlushInterval time.Duration `mapstructure:"flush_interval"`
+
+	// Store is "database" or "memory"
+	Store string `mapstructure:"store"`
+
+	// WebhookURL receives exported usage; WebhookSecret signs it
+	WebhookURL    string `mapstructure:"webhook_url"`
+	WebhookSecret string `mapstructure:"webhook_secret"`
+}
+
+// MetricsConfig holds Prometheus metrics configuration
+type MetricsConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// Host and Port are where `dolphin serve` exposes Path, apart from the
+	// application so the endpoint needn't be public
+	Host string `mapstructure:"host"`
+	Port int    `mapstructure:"port"`
+	Path string `mapstructure:"path"`
+
+	// Namespace prefixes every metric name
+	Namespace string `mapstructure:"namespace"`
+
+	// LabelAllowlist lists, by label name, the values recorded as they
+	// are; others are recorded as "other"
+	LabelAllowlist map[string][]string `mapstructure:"label_allowlist"`
+
+	// MaxSeries is how many series a metric may have before a warning is
+	// logged; 0 turns the check off
+	MaxSeries int `mapstructure:"max_series"`
+}
+
+// SLOConfig sets service level objectives for groups of routes, tracked
+// from the request metrics, and when their error budgets burn too fast to
+// alert
+type SLOConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// Window is the period objectives are met over; failing requests spend
+	// its error budget
+	Window time.Duration `mapstructure:"window"`
+
+	// Interval is how often the metrics are sampled and budgets checked
+	Interval time.Duration `mapstructure:"interval"`
+
+	// MinRequests is how many requests an alert's long window needs before
+	// it can fire, so a few failures on a quiet route don't page anyone
+	MinRequests int `mapstructure:"min_requests"`
+
+	Objectives []SLOObjective `mapstructure:"objectives"`
+
+	// BurnAlerts are the burn rates that alert; the standard fast and slow
+	// burn pair when empty
+	BurnAlerts []SLOBurnAlert `mapstructure:"burn_alerts"`
+
+	Alerts SLOAlertsConfig `mapstructure:"alerts"`
+}
+
+// SLOObjective is a target share of good requests to some routes
+type SLOObjective struct {
+	Name string `mapstructure:"name"`
+
+	// Routes are the route patterns counted, e.g. /api/users/{id}; one
+	// ending in * matches every pattern it prefixes. Empty counts them all.
+	Routes []string `mapstructure:"routes"`
+
+	// Target is the percentage of requests that must be good, e.g. 99.9
+	Target float64 `mapstructure:"target"`
+
+	// Latency makes good requests those served within it; without it,
+	// good requests are those not failing with a 5xx status
+	Latency time.Duration `mapstructure:"latency"`
+}
+
+// SLOBurnAlert fires when the error budget burns at Rate times the pace
+// that would spend it exactly over the window, both over the Long window
+// and the Short one, which ends the alert soon after the burning stops
+type SLOBurnAlert struct {
+	Severity string        `mapstructure:"severity"`
+	Rate     float64       `mapstructure:"rate"`
+	Long     time.Duration `mapstructure:"long"`
+	Short    time.Duration `mapstructure:"short"`
+}
+
+// SLOAlertsConfig says where burn rate alerts are sent, besides the log
+type SLOAlertsConfig struct {
+	// Channels are the notification channels alerts are sent to, through
+	// the notification provider the application gives the tracker
+	Channels []string `mapstructure:"channels"`
+
+	// Webhooks are URLs each alert is POSTed to as JSON
+	Webhooks []string `mapstructure:"webhooks"`
+
+	// Cooldown is how long an alert that keeps firing waits to repeat
+	Cooldown time.Duration `mapstructure:"cooldown"`
+}
+
+// TracingConfig holds OpenTelemetry tracing configuration
+type TracingConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// ServiceName names the app in traces; app.name when empty
+	ServiceName string `mapstructure:"service_name"`
+
+	// Sampler is always_on, always_off, traceidratio or their parentbased_
+	// forms; Ratio is the share of traces traceidratio keeps
+	Sampler string  `mapstructure:"sampler"`
+	Ratio   float64 `mapstructure:"ratio"`
+
+	// Routes overrides Ratio by route pattern or path prefix, e.g.
+	// {"/health": 0, "/api/orders": 1}
+	Routes map[string]float64 `mapstructure:"routes"`
+
+	// OTLPEndpoint is host:port or a URL; OTLPProtocol is grpc (port 4317)
+	// or http (port 4318). OTLPInsecure disables TLS for host:port.
+	OTLPEndpoint string            `mapstructure:"otlp_endpoint"`
+	OTLPProtocol string            `mapstructure:"otlp_protocol"`
+	OTLPInsecure bool              `mapstructure:"otlp_insecure"`
+	OTLPHeaders  map[string]string `mapstructure:"otlp_headers"`
+
+	// Jaeger's legacy collector and Zipkin, for backends without OTLP
+	JaegerEndpoint string `mapstructure:"jaeger_endpoint"`
+	ZipkinEndpoint string `mapstructure:"zipkin_endpoint"`
+
+	// ServerTiming reports each request's database, cache and template
+	// time in a Server-Timing header: "auto" in debug mode or staging,
+	// "on" or "off". Spans are recorded for it even without tracing.
+	ServerTiming string `mapstructure:"server_timing"`
+}
+
+// StartupConfig decides what `dolphin serve` does when the database or
+// Redis isn't reachable yet, as when containers start together
+type StartupConfig struct {
+	// Policy is "fail" (exit on the first failed connection), "wait" (retry
+	// before serving) or "degraded" (serve not-ready while retrying)
+	Policy string `mapstructure:"policy"`
+
+	// Timeout is how long to keep retrying before exiting; 0 retries forever
+	Timeout time.Duration `mapstructure:"timeout"`
+
+	// Backoff is the first delay between attempts, doubled up to MaxBackoff
+	Backoff    time.Duration `mapstructure:"backoff"`
+	MaxBackoff time.Duration `mapstructure:"max_backoff"`
+
+	// Redis also waits for the cache when cache.driver is redis
+	Redis bool `mapstructure:"redis"`
+}
+
+// MailConfig controls how email templates are prepared for sending
+type MailConfig struct {
+	// InlineCSS copies <style> rules into style attributes, since Gmail,
+	// Outlook and most webmail clients ignore or strip style sheets
+	InlineCSS bool `mapstructure:"inline_css"`
+
+	// PlainText derives a text/plain alternative from the HTML of messages
+	// that don't have one
+	PlainText bool `mapstructure:"plain_text"`
+
+	// MaxSize refuses messages larger than this many bytes once their
+	// attachments are encoded, before delivery is attempted; 0 allows any
+	// size
+	MaxSize int64 `mapstructure:"max_size"`
+
+	// SMTP lists the servers mail is sent through, in order of preference.
+	// A message a server can't take for the moment, because it is
+	// unreachable or answers with a temporary failure, goes to the next.
+	SMTP []SMTPConfig `mapstructure:"smtp"`
+
+	// Pool controls the connections kept open to each SMTP server
+	Pool MailPoolConfig `mapstructure:"pool"`
+
+	// DKIM signs mail from each domain listed with that domain's key
+	DKIM map[string]DKIMConfig `mapstructure:"dkim"`
+
+	// RateLimits caps the messages sent to each recipient domain, such as
+	// gmail.com; the "default" entry applies to domains not listed
+	RateLimits map[string]MailRateLimitConfig `mapstructure:"rate_limits"`
+
+	// Webhooks takes bounce and complaint notifications from providers
+	// into the suppression list
+	Webhooks MailWebhooksConfig `mapstructure:"webhooks"`
+}
+
+// MailRateLimitConfig caps the messages sent to a domain
+type MailRateLimitConfig struct {
+	Messages int           `mapstructure:"messages"`
+	Per      time.Duration `mapstructure:"per"`
+}
+
+// WebhooksConfig controls the capture of inbound webhooks, kept for the
+// debug dashboard and `dolphin webhooks:replay`
+type WebhooksConfig struct {
+	// Capture stores the deliveries of the payments and mail webhook
+	// endpoints, and of routes using the webhook middleware alias
+	Capture bool `mapstructure:"capture"`
+
+	// Retention is how long deliveries are kept; 0 keeps them
+	Retention time.Duration `mapstructure:"retention"`
+
+	// MaxBodySize caps the bytes kept of a payload; larger payloads are
+	// kept truncated and can't be replayed
+	MaxBodySize int64 `mapstructure:"max_body_size"`
+}
+
+// MailWebhooksConfig controls the endpoints that take bounce and complaint
+// notifications into the suppression list
+type MailWebhooksConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// Path is where the endpoints are mounted: <path>/ses and
+	// <path>/mailgun
+	Path string `mapstructure:"path"`
+
+	// SESTopics lists the ARNs of the SNS topics notifications are taken
+	// from; empty takes any topic. SNS signatures are always verified.
+	SESTopics []string `mapstructure:"ses_topics"`
+
+	// MailgunSigningKey verifies Mailgun's webhook signatures; the Mailgun
+	// endpoint is only served with one
+	MailgunSigningKey string `mapstructure:"mailgun_signing_key"`
+}
+
+// SMTPConfig is an SMTP server mail is sent through
+type SMTPConfig struct {
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+}
+
+// MailPoolConfig controls the connections kept open to an SMTP server, so
+// that mail sent at volume doesn't pay for a handshake per message
+type MailPoolConfig struct {
+	// MaxConnections caps the connections open to a server at once
+	MaxConnections int `mapstructure:"max_connections"`
+
+	// MaxMessages replaces a connection after it has sent this many
+	// messages; 0 keeps it for as long as it works
+	MaxMessages int `mapstructure:"max_messages"`
+
+	// IdleTimeout closes connections unused for this long
+	IdleTimeout time.Duration `mapstructure:"idle_timeout"`
+
+	// Timeout bounds the delivery of each message, connecting included
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// DKIMConfig is the key mail from a domain is signed with
+type DKIMConfig struct {
+	// Selector names the DNS record holding the public key, published at
+	// <selector>._domainkey.<domain>
+	Selector string `mapstructure:"selector"`
+
+	// PrivateKey is the path of the PEM encoded RSA or Ed25519 private key
+	PrivateKey string `mapstructure:"private_key"`
+}
+
+// DebugConfig controls the request recorder of the debug dashboard, which
+// runs when app.debug is on
+type DebugConfig struct {
+	// Record stores recent requests with their responses and queries for
+	// replaying from the dashboard and `dolphin debug export`
+	Record bool `mapstructure:"record"`
+
+	// RecordSize is how many requests are kept
+	RecordSize int `mapstructure:"record_size"`
+
+	// RecordFile keeps recordings in a SQLite file across restarts; empty
+	// keeps them in memory
+	RecordFile string `mapstructure:"record_file"`
+
+	// MaxBodySize caps the bytes kept of each request and response body
+	MaxBodySize int `mapstructure:"max_body_size"`
+
+	// Allocations measures the heap allocations of requests by route, for
+	// the dashboard's /debug/allocation page
+	Allocations bool `mapstructure:"allocations"`
+
+	// AllocationBudget is the bytes a request may allocate before its
+	// route is flagged, and AllocationObjectBudget the heap objects, zero
+	// for no limit
+	AllocationBudget       int64 `mapstructure:"allocation_budget"`
+	AllocationObjectBudget int64 `mapstructure:"allocation_object_budget"`
+
+	// AllocationSampleRate is the share of requests measured, from 0 to 1
+	AllocationSampleRate float64 `mapstructure:"allocation_sample_rate"`
+}
+
+// SearchConfig controls full-text search: the driver indexes are kept on
+// and how searchable models are synced to them
+type SearchConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// Driver is meilisearch, elasticsearch or local, an index kept in
+	// files for development and single instances
+	Driver string `mapstructure:"driver"`
+
+	// Prefix is put before index names, so applications can share a
+	// search server
+	Prefix string `mapstructure:"prefix"`
+
+	// ChunkSize is how many rows search:import reads and indexes at a time
+	ChunkSize int `mapstructure:"chunk_size"`
+
+	Meilisearch   MeilisearchConfig   `mapstructure:"meilisearch"`
+	Elasticsearch ElasticsearchConfig `mapstructure:"elasticsearch"`
+	Local         LocalSearchConfig   `mapstructure:"local"`
+}
+
+// MeilisearchConfig is the Meilisearch server indexes are kept on
+type MeilisearchConfig struct {
+	Host string `mapstructure:"host"`
+	Key  string `mapstructure:"key"`
+}
+
+// ElasticsearchConfig is the Elasticsearch cluster indexes are kept on
+type ElasticsearchConfig struct {
+	URL      string `mapstructure:"url"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+}
+
+// LocalSearchConfig is the directory the local driver keeps indexes in
+type LocalSearchConfig struct {
+	Dir string `mapstructure:"dir"`
+}
+
+// StorageConfig names the disks files are stored on
+type StorageConfig struct {
+	// Default is the disk used when none is named
+	Default string `mapstructure:"default"`
+
+	Disks map[string]DiskConfig `mapstructure:"disks"`
+}
+
+// DiskConfig is a disk's driver, local or s3, and its options: root and
+// base_url for local; bucket, region, base_url and endpoint for s3
+type DiskConfig struct {
+	Driver  string            `mapstructure:"driver"`
+	Options map[string]string `mapstructure:"options"`
+}
+
+// QueueConfig names the connections jobs and events are queued on
+type QueueConfig struct {
+	// Default is the connection used when none is named
+	Default string `mapstructure:"default"`
+
+	Connections map[string]QueueConnectionConfig `mapstructure:"connections"`
+
+	// Schemas is a directory of JSON schemas named <job type>.json, that
+	// payloads are checked against when jobs are pushed and handled
+	Schemas string `mapstructure:"schemas"`
+}
+
+// QueueConnectionConfig is a queue connection: its driver, memory, kafka
+// or nats, and where its jobs go
+type QueueConnectionConfig struct {
+	Driver string `mapstructure:"driver"`
+
+	// Topics maps queue names to the Kafka topic or NATS subject they use;
+	// other queues use Prefix followed by their name
+	Topics map[string]string `mapstructure:"topics"`
+	Prefix string            `mapstructure:"prefix"`
+
+	// Group is the consumer group workers join, so each job is handled by
+	// one worker of the group
+	Group string `mapstructure:"group"`
+
+	// MaxAttempts is how many times a job is tried before it is dropped
+	// as failed, and Backoff the wait before the first retry, doubling
+	// after each
+	MaxAttempts int           `mapstructure:"max_attempts"`
+	Backoff     time.Duration `mapstructure:"backoff"`
+
+	Kafka KafkaQueueConfig `mapstructure:"kafka"`
+	NATS  NATSQueueConfig  `mapstructure:"nats"`
+}
+
+// KafkaQueueConfig reaches Kafka through a Confluent REST Proxy
+type KafkaQueueConfig struct {
+	RestURL  string `mapstructure:"rest_url"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+
+	// OffsetReset is where a new consumer group starts reading a topic:
+	// earliest or latest
+	OffsetReset string `mapstructure:"offset_reset"`
+}
+
+// NATSQueueConfig reaches a NATS server with JetStream enabled
+type NATSQueueConfig struct {
+	URL      string `mapstructure:"url"`
+	Token    string `mapstructure:"token"`
+	User     string `mapstructure:"user"`
+	Password string `mapstructure:"password"`
+
+	// Stream is the JetStream stream holding the jobs, created when
+	// missing
+	Stream string `mapstructure:"stream"`
+
+	// AckWait is how long a worker may take over a job before it is
+	// delivered to another
+	AckWait time.Duration `mapstructure:"ack_wait"`
+
+	// TLS requires TLS, as does a tls:// URL or a CAFile; it is used
+	// anyway when the server requires it. CAFile trusts a private CA.
+	TLS    bool   `mapstructure:"tls"`
+	CAFile string `mapstructure:"ca_file"`
+
+	// MaxReconnects caps the attempts to reconnect after the connection
+	// drops, 60 when zero and unlimited when negative; workers stop once
+	// the connection is given up
+	MaxReconnects int `mapstructure:"max_reconnects"`
+}
+
+// TusConfig controls the resumable upload endpoint, speaking the tus
+// protocol under Path
+type TusConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Path    string `mapstructure:"path"`
+
+	// Dir holds uploads while their chunks arrive
+	Dir string `mapstructure:"dir"`
+
+	// Root and Prefix say where completed uploads are stored: under Prefix
+	// on the local disk at Root, which isn't served to the public
+	Root   string `mapstructure:"root"`
+	Prefix string `mapstructure:"prefix"`
+
+	// Disk names a storage disk to store completed uploads on instead of
+	// the one at Root, such as s3
+	Disk string `mapstructure:"disk"`
+
+	// MaxSize is the largest upload accepted, in bytes
+	MaxSize int64 `mapstructure:"max_size"`
+
+	// Expiry is how long an upload may go without a chunk before it is
+	// removed, with its chunks if incomplete
+	Expiry time.Duration `mapstructure:"expiry"`
+
+	// CleanupInterval is how often expired uploads are removed
+	CleanupInterval time.Duration `mapstructure:"cleanup_interval"`
+}
+
+// ScanConfig controls the malware scanning of uploads
+type ScanConfig struct {
+	// Driver is clamav, scanning with a clamd daemon, or none
+	Driver string `mapstructure:"driver"`
+
+	// Action is what happens to infected files: reject deletes them and
+	// quarantine keeps them on the quarantine disk. Either way the upload
+	// is refused.
+	Action string `mapstructure:"action"`
+
+	// QuarantineDisk names the storage disk quarantined files are kept on;
+	// when empty they go under QuarantineDir, which isn't served
+	QuarantineDisk string `mapstructure:"quarantine_disk"`
+	QuarantineDir  string `mapstructure:"quarantine_dir"`
+
+	// AsyncAbove is the size in bytes above which files are stored at
+	// once and scanned by a job on Queue, on queue.default. Files are
+	// scanned as they are uploaded when Queue is empty.
+	AsyncAbove int64  `mapstructure:"async_above"`
+	Queue      string `mapstructure:"queue"`
+
+	ClamAV ClamAVConfig `mapstructure:"clamav"`
+}
+
+// ClamAVConfig reaches a clamd daemon, at a host:port or a unix socket path
+type ClamAVConfig struct {
+	Address string        `mapstructure:"address"`
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// CDNConfig controls the caching headers sent for a CDN in front of the
+// app, and how its cache is purged
+type CDNConfig struct {
+	// Driver is fastly or cloudflare, which purges are sent to, or none to
+	// only send headers
+	Driver string `mapstructure:"driver"`
+
+	// PurgeOnWrite purges the surrogate keys of models as they are
+	// created, updated and deleted
+	PurgeOnWrite bool `mapstructure:"purge_on_write"`
+
+	// Routes sets the caching of GET requests by route pattern or path
+	// prefix, e.g. /api/posts/{id} or /blog
+	Routes map[string]CDNRouteConfig `mapstructure:"routes"`
+
+	Fastly     FastlyConfig     `mapstructure:"fastly"`
+	Cloudflare CloudflareConfig `mapstructure:"cloudflare"`
+}
+
+// CDNRouteConfig is the caching of a route's responses
+type CDNRouteConfig struct {
+	// MaxAge is how long browsers keep responses, and SMaxAge how long the
+	// CDN does when it differs
+	MaxAge  time.Duration `mapstructure:"max_age"`
+	SMaxAge time.Duration `mapstructure:"s_maxage"`
+
+	// StaleWhileRevalidate and StaleIfError let a stale response be served
+	// while it is fetched again, or while the app fails
+	StaleWhileRevalidate time.Duration `mapstructure:"stale_while_revalidate"`
+	StaleIfError         time.Duration `mapstructure:"stale_if_error"`
+
+	// Private keeps responses out of shared caches, and NoStore out of
+	// every cache
+	Private bool `mapstructure:"private"`
+	NoStore bool `mapstructure:"no_store"`
+
+	// Keys are surrogate keys every response of the route is tagged with
+	Keys []string `mapstructure:"keys"`
+}
+
+// FastlyConfig is the Fastly service purged by surrogate key
+type FastlyConfig struct {
+	APIToken  string `mapstructure:"api_token"`
+	ServiceID string `mapstructure:"service_id"`
+
+	// SoftPurge marks content stale instead of removing it, so it can
+	// still be served stale
+	SoftPurge bool   `mapstructure:"soft_purge"`
+	BaseURL   string `mapstructure:"base_url"`
+}
+
+// CloudflareConfig is the Cloudflare zone purged by cache tag
+type CloudflareConfig struct {
+	APIToken string `mapstructure:"api_token"`
+	ZoneID   string `mapstructure:"zone_id"`
+	BaseURL  string `mapstructure:"base_url"`
+}
+
+// NotifyConfig controls the SMS and push drivers notifications are sent
+// through. Users choose which channels they get in the database.
+type NotifyConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	SMS  SMSConfig  `mapstructure:"sms"`
+	Push PushConfig `mapstructure:"push"`
+}
+
+// SMSConfig selects the SMS driver and its credentials
+type SMSConfig struct {
+	// Driver is twilio, africastalking or vonage, or log to only log
+	// messages
+	Driver string `mapstructure:"driver"`
+
+	// From is the number, short code or alphanumeric sender ID messages
+	// are sent from
+	From string `mapstructure:"from"`
+
+	Twilio         TwilioConfig         `mapstructure:"twilio"`
+	AfricasTalking AfricasTalkingConfig `mapstructure:"africastalking"`
+	Vonage         VonageConfig         `mapstructure:"vonage"`
+}
+
+// TwilioConfig authenticates with Twilio's Messaging API
+type TwilioConfig struct {
+	AccountSID string `mapstructure:"account_sid"`
+	AuthToken  string `mapstructure:"auth_token"`
+
+	// MessagingServiceSID sends through a messaging service instead of
+	// the From number
+	MessagingServiceSID string `mapstructure:"messaging_service_sid"`
+	BaseURL             string `mapstructure:"base_url"`
+}
+
+// AfricasTalkingConfig authenticates with Africa's Talking. The sandbox
+// username sends to the sandbox simulator.
+type AfricasTalkingConfig struct {
+	Username string `mapstructure:"username"`
+	APIKey   string `mapstructure:"api_key"`
+	BaseURL  string `mapstructure:"base_url"`
+}
+
+// VonageConfig authenticates with Vonage's SMS API
+type VonageConfig struct {
+	APIKey    string `mapstructure:"api_key"`
+	APISecret string `mapstructure:"api_secret"`
+	BaseURL   string `mapstructure:"base_url"`
+}
+
+// PushConfig holds the credentials of each push platform; a platform is
+// set up once they are
+type PushConfig struct {
+	FCM     FCMConfig     `mapstructure:"fcm"`
+	APNs    APNsConfig    `mapstructure:"apns"`
+	WebPush WebPushConfig `mapstructure:"webpush"`
+}
+
+// FCMConfig authenticates with Firebase Cloud Messaging's HTTP v1 API
+type FCMConfig struct {
+	// CredentialsFile is the service account JSON key downloaded from the
+	// Firebase console
+	CredentialsFile string `mapstructure:"credentials_file"`
+
+	// ProjectID defaults to the service account's project
+	ProjectID string `mapstructure:"project_id"`
+	BaseURL   string `mapstructure:"base_url"`
+}
+
+// APNsConfig authenticates with Apple's push service using a token
+// signing key
+type APNsConfig struct {
+	// KeyFile is the .p8 key, KeyID its ID and TeamID the developer team
+	// it belongs to
+	KeyFile string `mapstructure:"key_file"`
+	KeyID   string `mapstructure:"key_id"`
+	TeamID  string `mapstructure:"team_id"`
+
+	// Topic is the app's bundle ID
+	Topic string `mapstructure:"topic"`
+
+	// Production sends to the production service rather than the
+	// sandbox development builds use
+	Production bool   `mapstructure:"production"`
+	BaseURL    string `mapstructure:"base_url"`
+}
+
+// WebPushConfig signs Web Push requests with a VAPID key pair, made with
+// dolphin notify:vapid
+type WebPushConfig struct {
+	PublicKey  string `mapstructure:"vapid_public_key"`
+	PrivateKey string `mapstructure:"vapid_private_key"`
+
+	// Subject is a mailto: or https: URL push services can reach the
+	// sender at
+	Subject string `mapstructure:"subject"`
+
+	// TTL is how long push services keep a message for an offline browser
+	TTL time.Duration `mapstructure:"ttl"`
+}
+
+// PaymentsConfig controls the payment providers and the endpoint taking
+// their webhooks. A built-in provider is set up once its credentials are.
+type PaymentsConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// Default names the provider charges go to when none is named
+	Default string `mapstructure:"default"`
+
+	// WebhookPath is where providers send events: <path>/<provider>
+	WebhookPath string `mapstructure:"webhook_path"`
+
+	// IdempotencyTTL is how long a charge or refund is returned again for
+	// a request repeating its idempotency key, and how long webhook event
+	// IDs are remembered so redeliveries are ignored
+	IdempotencyTTL time.Duration `mapstructure:"idempotency_ttl"`
+
+	Stripe StripeConfig `mapstructure:"stripe"`
+	PayPal PayPalConfig `mapstructure:"paypal"`
+	MPesa  MPesaConfig  `mapstructure:"mpesa"`
+
+	// Providers holds the settings of providers added with
+	// payments.Register, by name
+	Providers map[string]map[string]string `mapstructure:"providers"`
+}
+
+// StripeConfig authenticates with Stripe and verifies its webhooks
+type StripeConfig struct {
+	SecretKey     string `mapstructure:"secret_key"`
+	WebhookSecret string `mapstructure:"webhook_secret"`
+
+	// BaseURL is the API's address, replaced by tests
+	BaseURL string `mapstructure:"base_url"`
+}
+
+// PayPalConfig authenticates with PayPal's REST API
+type PayPalConfig struct {
+	ClientID     string `mapstructure:"client_id"`
+	ClientSecret string `mapstructure:"client_secret"`
+
+	// WebhookID is the ID PayPal gave the webhook, which its signatures
+	// are verified against
+	WebhookID string `mapstructure:"webhook_id"`
+
+	// Mode is sandbox or live
+	Mode    string `mapstructure:"mode"`
+	BaseURL string `mapstructure:"base_url"`
+
+	// ReturnURL and CancelURL are where buyers are sent back to after
+	// approving an order, or giving up
+	ReturnURL string `mapstructure:"return_url"`
+	CancelURL string `mapstructure:"cancel_url"`
+}
+
+// MPesaConfig authenticates with Safaricom's Daraja API for M-Pesa STK
+// push payments and reversals
+type MPesaConfig struct {
+	// Environment is sandbox or production
+	Environment    string `mapstructure:"environment"`
+	BaseURL        string `mapstructure:"base_url"`
+	ConsumerKey    string `mapstructure:"consumer_key"`
+	ConsumerSecret string `mapstructure:"consumer_secret"`
+
+	// ShortCode is the paybill or till number paid, and PassKey the Lipa
+	// na M-Pesa Online passkey issued for it
+	ShortCode string `mapstructure:"short_code"`
+	PassKey   string `mapstructure:"pass_key"`
+
+	// CallbackURL is the public URL of <webhook_path>/mpesa. Daraja
+	// doesn't sign callbacks, so each carries an HMAC with WebhookSecret
+	// in its query.
+	CallbackURL   string `mapstructure:"callback_url"`
+	WebhookSecret string `mapstructure:"webhook_secret"`
+
+	// AllowedIPs, when set, are the only addresses callbacks are taken
+	// from, such as Safaricom's published ranges
+	AllowedIPs []string `mapstructure:"allowed_ips"`
+
+	// Initiator and SecurityCredential authorize reversals, whose results
+	// are sent to ResultURL, or TimeoutURL when M-Pesa gives up
+	Initiator          string `mapstructure:"initiator"`
+	SecurityCredential string `mapstructure:"security_credential"`
+	ResultURL          string `mapstructure:"result_url"`
+	TimeoutURL         string `mapstructure:"timeout_url"`
+}
+
+// BroadcastConfig controls how shared events, GraphQL subscriptions and
+// cache tag flushes reach the app's other instances
+type BroadcastConfig struct {
+	// Driver is redis, publishing on the cache's Redis server, or memory
+	// for a single instance
+	Driver string `mapstructure:"driver"`
+
+	// Prefix namespaces the Redis channels, so apps sharing a server don't
+	// hear each other
+	Prefix string `mapstructure:"prefix"`
+}
+
+// SSEConfig controls the server-sent event streams of the sse package
+type SSEConfig struct {
+	// Heartbeat is how often an idle stream sends a comment, so proxies
+	// don't close it
+	Heartbeat time.Duration `mapstructure:"heartbeat"`
+
+	// Retry is how long clients wait before reconnecting a dropped stream
+	Retry time.Duration `mapstructure:"retry"`
+
+	// History is how many events of each channel are kept for clients
+	// reconnecting with Last-Event-ID
+	History int `mapstructure:"history"`
+}
+
+// PresenceConfig controls who's-online tracking per channel, served under
+// Path for HTMX widgets and JSON clients
+type PresenceConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// Driver is redis, sharing the cache's Redis server so every instance
+	// sees the same members, or memory for a single instance
+	Driver string `mapstructure:"driver"`
+
+	Path string `mapstructure:"path"`
+
+	// TTL is how long a member stays present after its last heartbeat
+	TTL time.Duration `mapstructure:"ttl"`
+
+	// Heartbeat is how often open presence streams refresh their member
+	Heartbeat time.Duration `mapstructure:"heartbeat"`
+
+	// PollInterval is how often streams check for changes made on other
+	// instances or by expiry
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+}
+
+// WorkflowConfig controls the worker that resumes workflow instances
+type WorkflowConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// PollInterval is how often pending and abandoned instances are resumed
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+
+	// Lease is how long a worker may go without saving an instance before
+	// it is presumed to have crashed
+	Lease time.Duration `mapstructure:"lease"`
+}
+
+// AsyncConfig controls long-running operations offloaded from requests
+type AsyncConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// Path is where the status endpoints are mounted
+	Path string `mapstructure:"path"`
+
+	// Queue names the queue, on the default connection, operations are
+	// pushed to; empty runs them in a goroutine of the web server
+	Queue string `mapstructure:"queue"`
+
+	// RetryAfter is how long clients are told to wait between polls
+	RetryAfter time.Duration `mapstructure:"retry_after"`
+
+	// Timeout bounds how long an operation may run
+	Timeout time.Duration `mapstructure:"timeout"`
+
+	// Retention is how long finished operations are kept
+	Retention time.Duration `mapstructure:"retention"`
+}
+
+// OutboxConfig controls the outbox that publishes aggregates' domain events
+// after their transaction commits
+type OutboxConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// PollInterval is how often the relay publishes messages left behind
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+
+	// Lease is how long a committed message is reserved for the process
+	// that committed it before the relay takes over
+	Lease time.Duration `mapstructure:"lease"`
+
+	// MaxAttempts is how often a message is tried before it is left for
+	// inspection; zero retries forever
+	MaxAttempts int `mapstructure:"max_attempts"`
+
+	// Retention is how long published messages are kept; zero keeps them
+	Retention time.Duration `mapstructure:"retention"`
+}
+
+// IdempotencyConfig controls the middleware replaying the first response
+// to writes retried with the same Idempotency-Key header
+type IdempotencyConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// TTL is how long a response is replayed for
+	TTL time.Duration `mapstructure:"ttl"`
+
+	// Methods are the methods honoring the header
+	Methods []string `mapstructure:"methods"`
+}
+
+// SigningConfig controls the HMAC signatures of requests between the
+// app's services
+type SigningConfig struct {
+	// KeyID and Secret sign the app's outgoing requests to other services
+	KeyID  string `mapstructure:"key_id"`
+	Secret string `mapstructure:"secret"`
+
+	// Keys are the secrets of the services allowed to call this one, by
+	// key ID
+	Keys map[string]string `mapstructure:"keys"`
+
+	// MaxSkew is how far a request's timestamp may be from the clock
+	MaxSkew time.Duration `mapstructure:"max_skew"`
+}
+
+// GatewayConfig declares the upstream services whose routes the
+// application proxies, so it can front existing services
+type GatewayConfig struct {
+	Upstreams map[string]UpstreamConfig `mapstructure:"upstreams"`
+}
+
+// UpstreamConfig is a service the gateway proxies to
+type UpstreamConfig struct {
+	// URL is the service's base URL, which proxied paths are joined to
+	URL string `mapstructure:"url"`
+
+	// Paths are the path prefixes proxied to the service. StripPrefix
+	// removes the prefix first, so /orders/42 goes to <url>/42.
+	Paths       []string `mapstructure:"paths"`
+	StripPrefix bool     `mapstructure:"strip_prefix"`
+
+	// Timeout bounds each attempt, reading the response included
+	Timeout time.Duration `mapstructure:"timeout"`
+
+	// Retries retries requests without a body, using idempotent methods,
+	// that can't connect or get 502, 503 or 504; the wait between attempts
+	// starts at RetryBackoff and doubles
+	Retries      int           `mapstructure:"retries"`
+	RetryBackoff time.Duration `mapstructure:"retry_backoff"`
+
+	// CircuitBreaker stops sending requests to a failing service
+	CircuitBreaker UpstreamBreakerConfig `mapstructure:"circuit_breaker"`
+
+	// RequestHeaders and ResponseHeaders are set on requests to the
+	// service and on its responses; an empty value removes the header
+	RequestHeaders  map[string]string `mapstructure:"request_headers"`
+	ResponseHeaders map[string]string `mapstructure:"response_headers"`
+
+	// RateLimit names the limiter of http.rate_limits that requests to the
+	// service are counted by
+	RateLimit string `mapstructure:"rate_limit"`
+}
+
+// UpstreamBreakerConfig opens an upstream's circuit after FailureThreshold
+// failed attempts, answering 503 without trying the service for
+// OpenTimeout. A zero FailureThreshold turns the breaker off.
+type UpstreamBreakerConfig struct {
+	FailureThreshold int           `mapstructure:"failure_threshold"`
+	OpenTimeout      time.Duration `mapstructure:"open_timeout"`
+}
+
+// ViteConfig locates the Vite dev server and production build that the
+// vite template helper links to
+type ViteConfig struct {
+	// HotFile holds the dev server's URL while `npm run dev` is running;
+	// when it exists, pages load assets from the dev server
+	HotFile string `mapstructure:"hot_file"`
+
+	// BuildDir is Vite's outDir, containing .vite/manifest.json
+	BuildDir string `mapstructure:"build_dir"`
+
+	// URL is where BuildDir is served, matching Vite's base option
+	URL string `mapstructure:"url"`
+
+	// EarlyHints sends the critical CSS and JS of server-rendered pages as
+	// 103 Early Hints before their handlers run
+	EarlyHints bool `mapstructure:"early_hints"`
+}
+
+// TenancyConfig holds multi-tenancy configuration
+type TenancyConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// Strategy isolates tenants by "database" (one database each) or
+	// "schema" (one Postgres schema each in the main database)
+	Strategy string `mapstructure:"strategy"`
+
+	// Resolvers are tried in order: "subdomain", "header" and/or "path"
+	Resolvers  []string `mapstructure:"resolvers"`
+	Header     string   `mapstructure:"header"`
+	BaseDomain string   `mapstructure:"base_domain"`
+	PathPrefix string   `mapstructure:"path_prefix"`
+
+	// Pattern names a tenant's database or schema when it doesn't set
+	// one, with %s replaced by the tenant ID
+	Pattern string `mapstructure:"pattern"`
+
+	Tenants []TenantConfig `mapstructure:"tenants"`
+}
+
+// TenantConfig describes a tenant known from config
+type TenantConfig struct {
+	ID       string `mapstructure:"id"`
+	Database string `mapstructure:"database"`
+	Schema   string `mapstructure:"schema"`
+}
+
+// FeaturesConfig gates framework middleware added after an app was created.
+// Gates default to off so upgrading the framework doesn't change runtime
+// behavior; new projects and `dolphin upgrade` switch them on explicitly.
+type FeaturesConfig struct {
+	Compression      bool          `mapstructure:"compression"`
+	SecurityHeaders  bool          `mapstructure:"security_headers"`
+	SecurityPreset   string        `mapstructure:"security_preset"`
+	ResponseCache    bool          `mapstructure:"response_cache"`
+	ResponseCacheTTL time.Duration `mapstructure:"response_cache_ttl"`
+
+	// CompressionLevel is the gzip/deflate level, 1-9
+	CompressionLevel int `mapstructure:"compression_level"`
+
+	// CompressionExclude lists extra content types (e.g. "application/x-ndjson"
+	// or "model/*") and path prefixes (starting with "/") left uncompressed
+	CompressionExclude []string `mapstructure:"compression_exclude"`
+}
+
+// LogConfig holds logging configuration
+type LogConfig struct {
+	Level  string `mapstructure:"level"`
+	Format string `mapstructure:"format"`
+	Output string `mapstructure:"output"`
+
+	// AdminToken authorizes changing the level over HTTP at
+	// /maintenance/log-level; the endpoint is disabled while it is empty
+	AdminToken string `mapstructure:"admin_token"`
+
+	Access AccessLogConfig `mapstructure:"access"`
+}
+
+// AccessLogConfig holds request logging configuration
+type AccessLogConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// Headers are request headers added to each entry
+	Headers []string `mapstructure:"headers"`
+
+	// RedactHeaders and RedactParams are headers and query parameters whose
+	// values are replaced with [REDACTED], matched case-insensitively
+	RedactHeaders []string `mapstructure:"redact_headers"`
+	RedactParams  []string `mapstructure:"redact_params"`
+
+	// Once more than SampleThreshold successful requests a second are
+	// logged, only one in SampleEvery is. Errors and slow requests are
+	// always logged; a threshold of 0 logs everything.
+	SampleThreshold int `mapstructure:"sample_threshold"`
+	SampleEvery     int `mapstructure:"sample_every"`
+
+	// SlowThreshold logs requests taking at least this long as warnings
+	SlowThreshold time.Duration `mapstructure:"slow_threshold"`
+
+	// Routes sets the level successful requests are logged at by route
+	// pattern or path prefix, e.g. {"/health": "debug"}; "off" drops them
+	Routes map[string]string `mapstructure:"routes"`
+}
+
+// CacheConfig holds cache configuration
+type CacheConfig struct {
+	Driver string `mapstructure:"driver"`
+	Host   string `mapstructure:"host"`
+	Port   int    `mapstructure:"port"`
+	DB     int    `mapstructure:"db"`
+
+	// Locks names where cache.Lock keeps locks: "cache" for the cache
+	// driver's store, or "database" for a table of the app database
+	Locks string `mapstructure:"locks"`
+}
+
+// SessionConfig holds session configuration
+type SessionConfig struct {
+	Driver   string        `mapstructure:"driver"`
+	Lifetime time.Duration `mapstructure:"lifetime"`
+	Secure   bool          `mapstructure:"secure"`
+	HttpOnly bool          `mapstructure:"http_only"`
+	SameSite string        `mapstructure:"same_site"`
+	Encrypt  bool          `mapstructure:"encrypt"`
+	Key      string        `mapstructure:"key"`
+}
+
+// CookiesConfig holds the defaults for cookies set through the cookies
+// package, which encrypts them with the app key
+type CookiesConfig struct {
+	Path     string `mapstructure:"path"`
+	Domain   string `mapstructure:"domain"`
+	Secure   bool   `mapstructure:"secure"`
+	HttpOnly bool   `mapstructure:"http_only"`
+
+	// SameSite is Lax, Strict or None; None cookies are always Secure
+	SameSite string `mapstructure:"same_site"`
+}
+
+// I18nConfig locates translation files and how a request's locale is
+// chosen
+type I18nConfig struct {
+	// Path holds <locale>.json or .yaml files, or <locale>/<group>.json
+	// files whose keys are prefixed with the group
+	Path string `mapstructure:"path"`
+
+	// Locale is used when a request asks for none of the supported
+	// locales, and Fallback when a key is missing from the chosen one
+	Locale   string `mapstructure:"locale"`
+	Fallback string `mapstructure:"fallback"`
+
+	// Locales limits the locales requests can choose; empty allows every
+	// locale with translation files
+	Locales []string `mapstructure:"locales"`
+
+	// Query and Cookie name the query parameter and cookie a locale is
+	// read from, before the Accept-Language header
+	Query  string `mapstructure:"query"`
+	Cookie string `mapstructure:"cookie"`
+
+	// Redirect sends a GET for a localized route's path without its
+	// locale prefix to its path in the request's locale
+	Redirect bool `mapstructure:"redirect"`
+}
+
+// PreferencesConfig controls the locale, timezone and theme users can
+// choose, saved for signed-in users and in a cookie for guests
+type PreferencesConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Path    string `mapstructure:"path"`
+	Cookie  string `mapstructure:"cookie"`
+
+	// Theme is used until one of Themes is chosen
+	Theme  string   `mapstructure:"theme"`
+	Themes []string `mapstructure:"themes"`
+
+	// Timezone is used until one is chosen; empty uses app.timezone.
+	// Timezones are offered by the switcher, though any IANA timezone is
+	// accepted.
+	Timezone  string   `mapstructure:"timezone"`
+	Timezones []string `mapstructure:"timezones"`
+}
+
+// ExperimentsConfig controls A/B experiments: the variants of each, and how
+// users and guests are kept in theirs
+type ExperimentsConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// Store is database to keep assignments, so changing an experiment's
+	// weights doesn't move units already in a variant, or none to assign
+	// by hash alone
+	Store string `mapstructure:"store"`
+
+	// Cookie keeps the visitor ID guests are assigned by
+	Cookie string `mapstructure:"cookie"`
+
+	// Definitions are the experiments, by name
+	Definitions map[string]ExperimentConfig `mapstructure:"definitions"`
+}
+
+// ExperimentConfig is an experiment and its variants
+type ExperimentConfig struct {
+	// Enabled runs the experiment; while off, everyone gets the first
+	// variant and no exposures are logged
+	Enabled bool `mapstructure:"enabled"`
+
+	// Traffic is the share of users enrolled, from 0 to 1; others get the
+	// first variant. Unset enrolls everyone.
+	Traffic float64 `mapstructure:"traffic"`
+
+	// Variants are split by weight; the first is the control
+	Variants []VariantConfig `mapstructure:"variants"`
+}
+
+// VariantConfig is a variant of an experiment and its share of users
+type VariantConfig struct {
+	Name   string `mapstructure:"name"`
+	Weight int    `mapstructure:"weight"`
 }
 
-// LogConfig holds logging configuration
-type LogConfig struct {
-	Level  string `mapstructure:"level"`
-	Format string `mapstructure:"format"`
-	Output string `mapstructure:"output"`
+// SEOConfig controls the robots.txt and security.txt the app serves
+type SEOConfig struct {
+	Robots      RobotsConfig      `mapstructure:"robots"`
+	SecurityTxt SecurityTxtConfig `mapstructure:"security_txt"`
 }
 
-// CacheConfig holds cache configuration
-type CacheConfig struct {
-	Driver string `mapstructure:"driver"`
-	Host   string `mapstructure:"host"`
-	Port   int    `mapstructure:"port"`
-	DB     int    `mapstructure:"db"`
+// RobotsConfig generates /robots.txt
+type RobotsConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// DisallowEnvironments are the app environments, such as staging,
+	// whose robots.txt disallows everything whatever the rules
+	DisallowEnvironments []string `mapstructure:"disallow_environments"`
+
+	// Rules are the groups of the file; none allows everything
+	Rules    []RobotsRule `mapstructure:"rules"`
+	Sitemaps []string     `mapstructure:"sitemaps"`
+
+	// Template overrides the generated file when it exists
+	Template string `mapstructure:"template"`
 }
 
-// SessionConfig holds session configuration
-type SessionConfig struct {
-	Driver   string        `mapstructure:"driver"`
-	Lifetime time.Duration `mapstructure:"lifetime"`
-	Secure   bool          `mapstructure:"secure"`
-	HttpOnly bool          `mapstructure:"http_only"`
-	SameSite string        `mapstructure:"same_site"`
-	Encrypt  bool          `mapstructure:"encrypt"`
-	Key      string        `mapstructure:"key"`
+// RobotsRule is a group of robots.txt rules for a user agent
+type RobotsRule struct {
+	UserAgent  string   `mapstructure:"user_agent"`
+	Allow      []string `mapstructure:"allow"`
+	Disallow   []string `mapstructure:"disallow"`
+	CrawlDelay int      `mapstructure:"crawl_delay"`
+}
+
+// SecurityTxtConfig generates /.well-known/security.txt (RFC 9116)
+type SecurityTxtConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// Contact is required: mailto:, tel: or https: URIs
+	Contact []string `mapstructure:"contact"`
+
+	// Expires is when the file goes stale, in RFC 3339; empty is a year
+	// from when it is served
+	Expires string `mapstructure:"expires"`
+
+	Encryption         []string `mapstructure:"encryption"`
+	Acknowledgments    []string `mapstructure:"acknowledgments"`
+	PreferredLanguages []string `mapstructure:"preferred_languages"`
+	Policy             []string `mapstructure:"policy"`
+	Hiring             []string `mapstructure:"hiring"`
+
+	// Canonical defaults to the file's URL under app.url
+	Canonical []string `mapstructure:"canonical"`
+
+	// Template overrides the generated file when it exists
+	Template string `mapstructure:"template"`
+}
+
+// ArtifactsConfig controls the cache of expensive generated files, such as
+// PDF invoices, report exports and image variants, kept on a storage disk
+// by key and content version
+type ArtifactsConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// Disk names the storage disk artifacts are kept on, the default disk
+	// when empty, under the Prefix directory
+	Disk   string `mapstructure:"disk"`
+	Prefix string `mapstructure:"prefix"`
+
+	// ServeStale serves the previous version of an artifact while its
+	// current version renders in the background
+	ServeStale bool `mapstructure:"serve_stale"`
+
+	// Workers bounds the artifacts rendering in the background at once,
+	// and RenderTimeout each render
+	Workers       int           `mapstructure:"workers"`
+	RenderTimeout time.Duration `mapstructure:"render_timeout"`
+
+	// CacheControl is sent with served artifacts; their ETags make
+	// revalidation cheap
+	CacheControl string `mapstructure:"cache_control"`
+}
+
+// IntrusionConfig controls intrusion detection: honeytokens that alert
+// when touched, and banning IPs that scan the app
+type IntrusionConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// HoneyPaths are paths no legitimate client requests, such as
+	// /wp-login.php; requests to them alert and ban
+	HoneyPaths []string `mapstructure:"honey_paths"`
+
+	// HoneyCredentials are decoy usernames, emails and API keys, planted
+	// where only an intruder would find them; using one alerts and bans
+	HoneyCredentials []string `mapstructure:"honey_credentials"`
+
+	// ScanPatterns are regular expressions of paths scanners probe for.
+	// Requests matching one, and 404s, count towards ScanThreshold.
+	ScanPatterns  []string      `mapstructure:"scan_patterns"`
+	ScanThreshold int           `mapstructure:"scan_threshold"`
+	ScanWindow    time.Duration `mapstructure:"scan_window"`
+
+	// BanDuration is how long detected IPs are banned; 0 only alerts
+	BanDuration time.Duration `mapstructure:"ban_duration"`
+
+	// BanRefresh is how often the ban list is reloaded from the database,
+	// picking up bans made by other instances and the CLI
+	BanRefresh time.Duration `mapstructure:"ban_refresh"`
+
+	// Trusted are IPs and CIDR ranges that are never banned
+	Trusted []string `mapstructure:"trusted"`
+
+	// AlertPhones get an SMS and AlertUsers a push notification per alert
+	AlertPhones []string `mapstructure:"alert_phones"`
+	AlertUsers  []string `mapstructure:"alert_users"`
 }
 
 // JWTConfig holds JWT configuration
@@ -96,12 +1544,27 @@ type AuthConfig struct {
 	PasswordSalt  string        `mapstructure:"password_salt"`
 }
 
-// Load loads configuration from files and environment variables
+// Load loads the configuration from the cache written by `dolphin
+// config:cache` when there is one, and otherwise from its sources: .env,
+// config/config.yaml, config/http.yaml and the overlay for the
+// environment, such as config/production.yaml. Environment variables
+// override them, and the result is validated.
 func Load() (*Config, error) {
+	if _, err := os.Stat(CachePath); err == nil {
+		return loadCache(CachePath)
+	}
+	return loadSources()
+}
+
+// loadSources loads the configuration from .env and the YAML files
+func loadSources() (*Config, error) {
 	// Load .env file if it exists
 	if err := godotenv.Load(); err != nil {
 		// .env file is optional
 	}
+	if err := loadEncryptedEnv(); err != nil {
+		return nil, err
+	}
 
 	// Set default values
 	setDefaults()
@@ -124,6 +1587,84 @@ func Load() (*Config, error) {
 		// Config file not found, use defaults and environment variables
 	}
 
+	// Layer the HTTP presets, then the environment's overlay, over the base
+	// file
+	if err := mergeFile(HTTPFile); err != nil {
+		return nil, err
+	}
+	if err := mergeOverlay(); err != nil {
+		return nil, err
+	}
+
+	return resolve()
+}
+
+// loadEncryptedEnv decrypts .env.encrypted in memory and sets the variables
+// it defines that the environment and .env haven't. Without a master key it
+// is skipped, leaving `required` to report any secrets that are missing.
+func loadEncryptedEnv() error {
+	if _, err := os.Stat(security.EncryptedEnvFile); err != nil {
+		return nil
+	}
+
+	data, err := security.DecryptEnvFile(security.EncryptedEnvFile, security.CredentialsKeyFile)
+	if errors.Is(err, security.ErrNoMasterKey) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	values, err := godotenv.Unmarshal(string(data))
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", security.EncryptedEnvFile, err)
+	}
+	for key, value := range values {
+		if _, set := os.LookupEnv(key); !set {
+			os.Setenv(key, value)
+		}
+	}
+	return nil
+}
+
+// mergeOverlay merges the file named after the environment, such as
+// config/production.yaml, from the directory of the base config file
+func mergeOverlay() error {
+	environment := os.Getenv("APP_ENV")
+	if environment == "" {
+		environment = viper.GetString("app.environment")
+	}
+	if environment == "" {
+		return nil
+	}
+	return mergeFile(environment + ".yaml")
+}
+
+// mergeFile merges a YAML file from the directory of the base config file,
+// when there is one
+func mergeFile(name string) error {
+	dir := "config"
+	if used := viper.ConfigFileUsed(); used != "" {
+		dir = filepath.Dir(used)
+	}
+	path := filepath.Join(dir, name)
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	// Merged from a reader, so that the base file stays the one reloads read
+	viper.SetConfigType("yaml")
+	if err := viper.MergeConfig(file); err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return nil
+}
+
+// resolve decodes the loaded settings, applies the environment overrides
+// and validates the result, which the typed accessors then read
+func resolve() (*Config, error) {
 	var config Config
 	if err := viper.Unmarshal(&config); err != nil {
 		return nil, err
@@ -132,10 +1673,22 @@ func Load() (*Config, error) {
 	// Override with environment variables
 	overrideWithEnv(&config)
 
+	settings := viper.New()
+	if err := settings.MergeConfigMap(viper.AllSettings()); err != nil {
+		return nil, err
+	}
+	if err := settings.MergeConfigMap(settingsOf(reflect.ValueOf(config)).(map[string]interface{})); err != nil {
+		return nil, err
+	}
+
+	if err := validate(&config, settings); err != nil {
+		return nil, err
+	}
+
+	setResolved(settings)
 	return &config, nil
 }
 
-// setDefaults sets default configuration values
 func setDefaults() {
 	// App defaults
 	viper.SetDefault("app.name", "Dolphin Framework")
@@ -151,6 +1704,17 @@ func setDefaults() {
 	viper.SetDefault("server.write_timeout", 30)
 	viper.SetDefault("server.idle_timeout", 120)
 
+	// HTTP defaults
+	viper.SetDefault("http.cors.allowed_origins", []string{"*"})
+	viper.SetDefault("http.cors.allowed_methods", []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"})
+	viper.SetDefault("http.cors.allowed_headers", []string{"*"})
+	viper.SetDefault("http.cors.exposed_headers", []string{"Link"})
+	viper.SetDefault("http.cors.allow_credentials", true)
+	viper.SetDefault("http.cors.max_age", 300)
+	viper.SetDefault("http.auth.guard", "web")
+	viper.SetDefault("http.requests.timeout", "30s")
+	viper.SetDefault("http.trusted_proxies", []string{"127.0.0.0/8", "::1", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7"})
+
 	// Database defaults
 	viper.SetDefault("database.driver", "postgres")
 	viper.SetDefault("database.host", "localhost")
@@ -163,17 +1727,28 @@ func setDefaults() {
 	viper.SetDefault("database.max_open", 25)
 	viper.SetDefault("database.max_idle", 5)
 	viper.SetDefault("database.max_life", 300)
+	viper.SetDefault("database.replica_health_interval", "10s")
+	viper.SetDefault("database.slow_query_threshold", "200ms")
+	viper.SetDefault("database.query_log_size", 200)
+	viper.SetDefault("database.query_timeout", "30s")
 
 	// Log defaults
 	viper.SetDefault("log.level", "info")
 	viper.SetDefault("log.format", "json")
 	viper.SetDefault("log.output", "stdout")
+	viper.SetDefault("log.access.enabled", true)
+	viper.SetDefault("log.access.redact_headers", []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"})
+	viper.SetDefault("log.access.redact_params", []string{"password", "token", "access_token", "refresh_token", "secret", "api_key", "signature"})
+	viper.SetDefault("log.access.sample_threshold", 0)
+	viper.SetDefault("log.access.sample_every", 10)
+	viper.SetDefault("log.access.slow_threshold", "1s")
 
 	// Cache defaults
 	viper.SetDefault("cache.driver", "redis")
 	viper.SetDefault("cache.host", "localhost")
 	viper.SetDefault("cache.port", 6379)
 	viper.SetDefault("cache.db", 0)
+	viper.SetDefault("cache.locks", "cache")
 
 	// Session defaults
 	viper.SetDefault("session.driver", "cookie")
@@ -183,6 +1758,29 @@ func setDefaults() {
 	viper.SetDefault("session.same_site", "Lax")
 	viper.SetDefault("session.encrypt", false)
 
+	// Cookie defaults
+	viper.SetDefault("cookies.path", "/")
+	viper.SetDefault("cookies.secure", false)
+	viper.SetDefault("cookies.http_only", true)
+	viper.SetDefault("cookies.same_site", "Lax")
+
+	// Translation defaults
+	viper.SetDefault("i18n.path", "lang")
+	viper.SetDefault("i18n.locale", "en")
+	viper.SetDefault("i18n.fallback", "en")
+	viper.SetDefault("i18n.locales", []string{})
+	viper.SetDefault("i18n.query", "lang")
+	viper.SetDefault("i18n.cookie", "locale")
+	viper.SetDefault("i18n.redirect", true)
+
+	// Preference defaults
+	viper.SetDefault("preferences.enabled", false)
+	viper.SetDefault("preferences.path", "/preferences")
+	viper.SetDefault("preferences.cookie", "preferences")
+	viper.SetDefault("preferences.theme", "system")
+	viper.SetDefault("preferences.themes", []string{"system", "light", "dark"})
+	viper.SetDefault("preferences.timezones", []string{"UTC", "Africa/Nairobi", "Africa/Lagos", "Europe/London", "Europe/Berlin", "America/New_York", "America/Los_Angeles", "Asia/Kolkata", "Asia/Tokyo", "Australia/Sydney"})
+
 	// JWT defaults
 	viper.SetDefault("jwt.secret", "your-secret-key")
 	viper.SetDefault("jwt.expiration", "24h")
@@ -193,6 +1791,242 @@ func setDefaults() {
 	viper.SetDefault("auth.token_expiry", "1h")
 	viper.SetDefault("auth.refresh_expiry", "168h") // 7 days
 	viper.SetDefault("auth.password_salt", "")
+
+	// Tenancy defaults
+	viper.SetDefault("tenancy.enabled", false)
+	viper.SetDefault("tenancy.strategy", "database")
+	viper.SetDefault("tenancy.resolvers", []string{"header"})
+	viper.SetDefault("tenancy.header", "X-Tenant")
+	viper.SetDefault("tenancy.path_prefix", "t")
+	viper.SetDefault("tenancy.pattern", "tenant_%s")
+
+	// Read-only mode
+	viper.SetDefault("read_only.enabled", false)
+	viper.SetDefault("read_only.message", "We're making some changes behind the scenes. You can keep browsing, but saving is paused for a few minutes.")
+	viper.SetDefault("read_only.retry_after", 120)
+
+	// Health defaults
+	viper.SetDefault("health.timeout", "5s")
+	viper.SetDefault("health.disk_path", ".")
+	viper.SetDefault("health.disk_min_free_mb", 100)
+	viper.SetDefault("health.migrations", true)
+
+	// Metering defaults
+	viper.SetDefault("metering.enabled", false)
+	viper.SetDefault("metering.window", "1h")
+	viper.SetDefault("metering.flush_interval", "1m")
+	viper.SetDefault("metering.store", "database")
+
+	// Metrics defaults
+	viper.SetDefault("metrics.enabled", true)
+	viper.SetDefault("metrics.host", "")
+	viper.SetDefault("metrics.port", 9090)
+	viper.SetDefault("metrics.path", "/metrics")
+	viper.SetDefault("metrics.namespace", "dolphin")
+	viper.SetDefault("metrics.max_series", 1000)
+
+	// SLO defaults
+	viper.SetDefault("slo.enabled", false)
+	viper.SetDefault("slo.window", "720h")
+	viper.SetDefault("slo.interval", "1m")
+	viper.SetDefault("slo.min_requests", 100)
+	viper.SetDefault("slo.alerts.cooldown", "1h")
+
+	// Tracing defaults
+	viper.SetDefault("tracing.enabled", false)
+	viper.SetDefault("tracing.sampler", "parentbased_traceidratio")
+	viper.SetDefault("tracing.ratio", 1.0)
+	viper.SetDefault("tracing.otlp_endpoint", "localhost:4317")
+	viper.SetDefault("tracing.otlp_protocol", "grpc")
+	viper.SetDefault("tracing.otlp_insecure", true)
+	viper.SetDefault("tracing.server_timing", "auto")
+
+	// Startup dependency checks
+	viper.SetDefault("startup.policy", "wait")
+	viper.SetDefault("startup.timeout", "60s")
+	viper.SetDefault("startup.backoff", "500ms")
+	viper.SetDefault("startup.max_backoff", "10s")
+	viper.SetDefault("startup.redis", false)
+
+	// Mail defaults
+	viper.SetDefault("mail.inline_css", true)
+	viper.SetDefault("mail.plain_text", true)
+	viper.SetDefault("mail.max_size", 25<<20)
+	viper.SetDefault("mail.pool.max_connections", 4)
+	viper.SetDefault("mail.pool.max_messages", 100)
+	viper.SetDefault("mail.pool.idle_timeout", "30s")
+	viper.SetDefault("mail.pool.timeout", "60s")
+	viper.SetDefault("mail.webhooks.enabled", false)
+	viper.SetDefault("mail.webhooks.path", "/webhooks/mail")
+
+	// Debug request recorder defaults
+	viper.SetDefault("debug.record", true)
+	viper.SetDefault("debug.record_size", 200)
+	viper.SetDefault("debug.record_file", "")
+	viper.SetDefault("debug.max_body_size", 65536)
+	viper.SetDefault("debug.allocations", false)
+	viper.SetDefault("debug.allocation_budget", 1048576)
+	viper.SetDefault("debug.allocation_object_budget", 0)
+	viper.SetDefault("debug.allocation_sample_rate", 1.0)
+
+	// Storage defaults
+	viper.SetDefault("storage.default", "local")
+	viper.SetDefault("storage.disks.local.driver", "local")
+	viper.SetDefault("storage.disks.local.options", map[string]string{"root": "storage/app", "base_url": "/storage"})
+
+	// Queue defaults
+	viper.SetDefault("queue.default", "memory")
+	viper.SetDefault("queue.connections.memory.driver", "memory")
+	viper.SetDefault("queue.schemas", "")
+
+	// Upload scanning defaults
+	viper.SetDefault("scan.driver", "none")
+	viper.SetDefault("scan.action", "reject")
+	viper.SetDefault("scan.quarantine_disk", "")
+	viper.SetDefault("scan.quarantine_dir", "storage/quarantine")
+	viper.SetDefault("scan.async_above", 25<<20)
+	viper.SetDefault("scan.queue", "")
+	viper.SetDefault("scan.clamav.address", "localhost:3310")
+	viper.SetDefault("scan.clamav.timeout", "2m")
+
+	// CDN defaults
+	viper.SetDefault("cdn.driver", "none")
+	viper.SetDefault("cdn.purge_on_write", false)
+	viper.SetDefault("cdn.fastly.base_url", "https://api.fastly.com")
+	viper.SetDefault("cdn.cloudflare.base_url", "https://api.cloudflare.com")
+
+	// Notifications defaults
+	viper.SetDefault("notifications.enabled", false)
+	viper.SetDefault("notifications.sms.driver", "log")
+	viper.SetDefault("notifications.sms.twilio.base_url", "https://api.twilio.com")
+	viper.SetDefault("notifications.sms.vonage.base_url", "https://rest.nexmo.com")
+	viper.SetDefault("notifications.push.fcm.base_url", "https://fcm.googleapis.com")
+	viper.SetDefault("notifications.push.apns.production", false)
+	viper.SetDefault("notifications.push.webpush.ttl", "24h")
+
+	// Experiments defaults
+	viper.SetDefault("experiments.enabled", false)
+	viper.SetDefault("experiments.store", "database")
+	viper.SetDefault("experiments.cookie", "experiments")
+
+	// SEO defaults
+	viper.SetDefault("seo.robots.enabled", true)
+	viper.SetDefault("seo.robots.disallow_environments", []string{"staging"})
+	viper.SetDefault("seo.robots.template", "resources/views/seo/robots.txt")
+	viper.SetDefault("seo.security_txt.enabled", false)
+	viper.SetDefault("seo.security_txt.template", "resources/views/seo/security.txt")
+
+	// Artifacts defaults
+	viper.SetDefault("artifacts.enabled", false)
+	viper.SetDefault("artifacts.disk", "")
+	viper.SetDefault("artifacts.prefix", "artifacts")
+	viper.SetDefault("artifacts.serve_stale", false)
+	viper.SetDefault("artifacts.workers", 2)
+	viper.SetDefault("artifacts.render_timeout", "2m")
+	viper.SetDefault("artifacts.cache_control", "private, no-cache")
+
+	// Intrusion detection defaults
+	viper.SetDefault("intrusion.enabled", false)
+	viper.SetDefault("intrusion.honey_paths", []string{"/wp-login.php", "/wp-admin", "/xmlrpc.php", "/phpmyadmin", "/.env", "/.git/config"})
+	viper.SetDefault("intrusion.scan_patterns", []string{`\.(php|asp|aspx|jsp|cgi)$`, `/\.(git|svn|hg|aws|ssh)/`, `\.\./`, `(?i)/(cgi-bin|boaform|actuator)/`})
+	viper.SetDefault("intrusion.scan_threshold", 20)
+	viper.SetDefault("intrusion.scan_window", "1m")
+	viper.SetDefault("intrusion.ban_duration", "24h")
+	viper.SetDefault("intrusion.ban_refresh", "30s")
+	viper.SetDefault("intrusion.trusted", []string{"127.0.0.1", "::1"})
+
+	// Payments defaults
+	viper.SetDefault("payments.enabled", false)
+	viper.SetDefault("payments.default", "stripe")
+	viper.SetDefault("payments.webhook_path", "/webhooks/payments")
+	viper.SetDefault("payments.idempotency_ttl", "24h")
+	viper.SetDefault("payments.stripe.base_url", "https://api.stripe.com")
+	viper.SetDefault("payments.paypal.mode", "sandbox")
+	viper.SetDefault("payments.mpesa.environment", "sandbox")
+
+	// Resumable upload defaults
+	viper.SetDefault("tus.enabled", false)
+	viper.SetDefault("tus.path", "/tus")
+	viper.SetDefault("tus.dir", "storage/framework/tus")
+	viper.SetDefault("tus.root", "storage/app")
+	viper.SetDefault("tus.prefix", "uploads")
+	viper.SetDefault("tus.disk", "")
+	viper.SetDefault("tus.max_size", 1<<30)
+	viper.SetDefault("tus.expiry", "24h")
+	viper.SetDefault("tus.cleanup_interval", "1h")
+
+	// Search defaults
+	viper.SetDefault("search.enabled", false)
+	viper.SetDefault("search.driver", "local")
+	viper.SetDefault("search.prefix", "")
+	viper.SetDefault("search.chunk_size", 500)
+	viper.SetDefault("search.meilisearch.host", "http://localhost:7700")
+	viper.SetDefault("search.elasticsearch.url", "http://localhost:9200")
+	viper.SetDefault("search.local.dir", "storage/framework/search")
+
+	// Presence defaults
+	viper.SetDefault("presence.enabled", false)
+	viper.SetDefault("presence.driver", "redis")
+	viper.SetDefault("presence.path", "/presence")
+	viper.SetDefault("presence.ttl", "30s")
+	viper.SetDefault("presence.heartbeat", "10s")
+	viper.SetDefault("presence.poll_interval", "2s")
+
+	// Broadcast defaults
+	viper.SetDefault("broadcast.driver", "memory")
+	viper.SetDefault("broadcast.prefix", "dolphin:broadcast:")
+
+	// SSE defaults
+	viper.SetDefault("sse.heartbeat", "15s")
+	viper.SetDefault("sse.retry", "3s")
+	viper.SetDefault("sse.history", 100)
+
+	// Workflow defaults
+	viper.SetDefault("workflow.enabled", false)
+	viper.SetDefault("workflow.poll_interval", "10s")
+	viper.SetDefault("workflow.lease", "5m")
+
+	// Async defaults
+	viper.SetDefault("async.enabled", false)
+	viper.SetDefault("async.path", "/api/operations")
+	viper.SetDefault("async.queue", "")
+	viper.SetDefault("async.retry_after", "2s")
+	viper.SetDefault("async.timeout", "30m")
+	viper.SetDefault("async.retention", "24h")
+
+	// Outbox defaults
+	viper.SetDefault("outbox.enabled", false)
+	viper.SetDefault("outbox.poll_interval", "10s")
+	viper.SetDefault("outbox.lease", "1m")
+	viper.SetDefault("outbox.max_attempts", 10)
+	viper.SetDefault("outbox.retention", "168h")
+
+	// Idempotency defaults
+	viper.SetDefault("idempotency.enabled", false)
+	viper.SetDefault("idempotency.ttl", "24h")
+	viper.SetDefault("idempotency.methods", []string{"POST", "PUT"})
+
+	// Signing defaults
+	viper.SetDefault("signing.max_skew", "5m")
+
+	// Webhooks defaults
+	viper.SetDefault("webhooks.capture", false)
+	viper.SetDefault("webhooks.retention", "168h")
+	viper.SetDefault("webhooks.max_body_size", 1<<20)
+
+	// Vite defaults
+	viper.SetDefault("vite.hot_file", "public/hot")
+	viper.SetDefault("vite.build_dir", "public/build")
+	viper.SetDefault("vite.url", "/static/build")
+	viper.SetDefault("vite.early_hints", false)
+
+	// Feature gates (off unless enabled by the project config)
+	viper.SetDefault("features.compression", false)
+	viper.SetDefault("features.compression_level", 5)
+	viper.SetDefault("features.security_headers", false)
+	viper.SetDefault("features.security_preset", "balanced")
+	viper.SetDefault("features.response_cache", false)
+	viper.SetDefault("features.response_cache_ttl", "60s")
 }
 
 // overrideWithEnv overrides configuration with environment variables
@@ -247,6 +2081,11 @@ func overrideWithEnv(config *Config) {
 	if val := os.Getenv("DB_PASSWORD"); val != "" {
 		config.Database.Password = val
 	}
+	if val := os.Getenv("DB_QUERY_TIMEOUT"); val != "" {
+		if timeout, err := time.ParseDuration(val); err == nil {
+			config.Database.QueryTimeout = timeout
+		}
+	}
 
 	// Log overrides
 	if val := os.Getenv("LOG_LEVEL"); val != "" {
@@ -255,6 +2094,9 @@ func overrideWithEnv(config *Config) {
 	if val := os.Getenv("LOG_FORMAT"); val != "" {
 		config.Log.Format = val
 	}
+	if val := os.Getenv("LOG_ADMIN_TOKEN"); val != "" {
+		config.Log.AdminToken = val
+	}
 
 	// Cache overrides
 	if val := os.Getenv("CACHE_HOST"); val != "" {
@@ -265,6 +2107,316 @@ func overrideWithEnv(config *Config) {
 			config.Cache.Port = port
 		}
 	}
+	if val := os.Getenv("CACHE_LOCKS"); val != "" {
+		config.Cache.Locks = val
+	}
+
+	// Startup overrides
+	if val := os.Getenv("TRACING_SERVER_TIMING"); val != "" {
+		config.Tracing.ServerTiming = val
+	}
+	if val := os.Getenv("STARTUP_POLICY"); val != "" {
+		config.Startup.Policy = val
+	}
+	if val := os.Getenv("STARTUP_TIMEOUT"); val != "" {
+		if timeout, err := time.ParseDuration(val); err == nil {
+			config.Startup.Timeout = timeout
+		}
+	}
+
+	// Mail overrides
+	if val := os.Getenv("MAIL_INLINE_CSS"); val != "" {
+		if inline, err := strconv.ParseBool(val); err == nil {
+			config.Mail.InlineCSS = inline
+		}
+	}
+	if val := os.Getenv("MAIL_PLAIN_TEXT"); val != "" {
+		if text, err := strconv.ParseBool(val); err == nil {
+			config.Mail.PlainText = text
+		}
+	}
+	if val := os.Getenv("MAIL_MAX_SIZE"); val != "" {
+		if size, err := strconv.ParseInt(val, 10, 64); err == nil {
+			config.Mail.MaxSize = size
+		}
+	}
+	if val := os.Getenv("MAIL_HOST"); val != "" {
+		if len(config.Mail.SMTP) == 0 {
+			config.Mail.SMTP = []SMTPConfig{{Port: 587}}
+		}
+		config.Mail.SMTP[0].Host = val
+	}
+	if len(config.Mail.SMTP) > 0 {
+		if val := os.Getenv("MAIL_PORT"); val != "" {
+			if port, err := strconv.Atoi(val); err == nil {
+				config.Mail.SMTP[0].Port = port
+			}
+		}
+		if val := os.Getenv("MAIL_USERNAME"); val != "" {
+			config.Mail.SMTP[0].Username = val
+		}
+		if val := os.Getenv("MAIL_PASSWORD"); val != "" {
+			config.Mail.SMTP[0].Password = val
+		}
+	}
+	if val := os.Getenv("MAIL_WEBHOOKS_ENABLED"); val != "" {
+		if enabled, err := strconv.ParseBool(val); err == nil {
+			config.Mail.Webhooks.Enabled = enabled
+		}
+	}
+	if val := os.Getenv("MAILGUN_WEBHOOK_SIGNING_KEY"); val != "" {
+		config.Mail.Webhooks.MailgunSigningKey = val
+	}
+
+	// Debug overrides
+	if val := os.Getenv("DEBUG_RECORD"); val != "" {
+		if record, err := strconv.ParseBool(val); err == nil {
+			config.Debug.Record = record
+		}
+	}
+	if val := os.Getenv("DEBUG_RECORD_FILE"); val != "" {
+		config.Debug.RecordFile = val
+	}
+
+	// Presence overrides
+	if val := os.Getenv("PRESENCE_ENABLED"); val != "" {
+		if enabled, err := strconv.ParseBool(val); err == nil {
+			config.Presence.Enabled = enabled
+		}
+	}
+	if val := os.Getenv("PRESENCE_DRIVER"); val != "" {
+		config.Presence.Driver = val
+	}
+
+	// Broadcast overrides
+	if val := os.Getenv("BROADCAST_DRIVER"); val != "" {
+		config.Broadcast.Driver = val
+	}
+
+	// Workflow overrides
+	if val := os.Getenv("WORKFLOW_ENABLED"); val != "" {
+		if enabled, err := strconv.ParseBool(val); err == nil {
+			config.Workflow.Enabled = enabled
+		}
+	}
+
+	// Async overrides
+	if val := os.Getenv("ASYNC_ENABLED"); val != "" {
+		if enabled, err := strconv.ParseBool(val); err == nil {
+			config.Async.Enabled = enabled
+		}
+	}
+
+	// Cookie overrides
+	if val := os.Getenv("COOKIES_SECURE"); val != "" {
+		if secure, err := strconv.ParseBool(val); err == nil {
+			config.Cookies.Secure = secure
+		}
+	}
+
+	// Translation overrides
+	if val := os.Getenv("APP_LOCALE"); val != "" {
+		config.I18n.Locale = val
+	}
+
+	// Preference overrides
+	if val := os.Getenv("PREFERENCES_ENABLED"); val != "" {
+		if enabled, err := strconv.ParseBool(val); err == nil {
+			config.Preferences.Enabled = enabled
+		}
+	}
+
+	// Experiment overrides
+	if val := os.Getenv("EXPERIMENTS_ENABLED"); val != "" {
+		if enabled, err := strconv.ParseBool(val); err == nil {
+			config.Experiments.Enabled = enabled
+		}
+	}
+
+	// SEO overrides
+	if val := os.Getenv("SECURITY_TXT_CONTACT"); val != "" {
+		config.SEO.SecurityTxt.Contact = []string{val}
+	}
+
+	// Intrusion detection overrides
+	if val := os.Getenv("INTRUSION_ENABLED"); val != "" {
+		if enabled, err := strconv.ParseBool(val); err == nil {
+			config.Intrusion.Enabled = enabled
+		}
+	}
+
+	// Artifacts overrides
+	if val := os.Getenv("ARTIFACTS_ENABLED"); val != "" {
+		if enabled, err := strconv.ParseBool(val); err == nil {
+			config.Artifacts.Enabled = enabled
+		}
+	}
+
+	// Outbox overrides
+	if val := os.Getenv("OUTBOX_ENABLED"); val != "" {
+		if enabled, err := strconv.ParseBool(val); err == nil {
+			config.Outbox.Enabled = enabled
+		}
+	}
+
+	// Idempotency overrides
+	if val := os.Getenv("IDEMPOTENCY_ENABLED"); val != "" {
+		if enabled, err := strconv.ParseBool(val); err == nil {
+			config.Idempotency.Enabled = enabled
+		}
+	}
+
+	// Signing overrides
+	if val := os.Getenv("SIGNING_SECRET"); val != "" {
+		config.Signing.Secret = val
+	}
+
+	// Webhooks overrides
+	if val := os.Getenv("WEBHOOKS_CAPTURE"); val != "" {
+		if capture, err := strconv.ParseBool(val); err == nil {
+			config.Webhooks.Capture = capture
+		}
+	}
+
+	// Queue overrides
+	if val := os.Getenv("QUEUE_CONNECTION"); val != "" {
+		config.Queue.Default = val
+	}
+
+	// Upload scanning overrides
+	if val := os.Getenv("SCAN_DRIVER"); val != "" {
+		config.Scan.Driver = val
+	}
+	if val := os.Getenv("CLAMAV_ADDRESS"); val != "" {
+		config.Scan.ClamAV.Address = val
+	}
+
+	// CDN overrides
+	if val := os.Getenv("CDN_DRIVER"); val != "" {
+		config.CDN.Driver = val
+	}
+	if val := os.Getenv("FASTLY_API_TOKEN"); val != "" {
+		config.CDN.Fastly.APIToken = val
+	}
+	if val := os.Getenv("FASTLY_SERVICE_ID"); val != "" {
+		config.CDN.Fastly.ServiceID = val
+	}
+	if val := os.Getenv("CLOUDFLARE_API_TOKEN"); val != "" {
+		config.CDN.Cloudflare.APIToken = val
+	}
+	if val := os.Getenv("CLOUDFLARE_ZONE_ID"); val != "" {
+		config.CDN.Cloudflare.ZoneID = val
+	}
+
+	// Notifications overrides
+	if val := os.Getenv("NOTIFICATIONS_ENABLED"); val != "" {
+		if enabled, err := strconv.ParseBool(val); err == nil {
+			config.Notify.Enabled = enabled
+		}
+	}
+	if val := os.Getenv("SMS_DRIVER"); val != "" {
+		config.Notify.SMS.Driver = val
+	}
+	if val := os.Getenv("SMS_FROM"); val != "" {
+		config.Notify.SMS.From = val
+	}
+	if val := os.Getenv("TWILIO_ACCOUNT_SID"); val != "" {
+		config.Notify.SMS.Twilio.AccountSID = val
+	}
+	if val := os.Getenv("TWILIO_AUTH_TOKEN"); val != "" {
+		config.Notify.SMS.Twilio.AuthToken = val
+	}
+	if val := os.Getenv("AFRICASTALKING_USERNAME"); val != "" {
+		config.Notify.SMS.AfricasTalking.Username = val
+	}
+	if val := os.Getenv("AFRICASTALKING_API_KEY"); val != "" {
+		config.Notify.SMS.AfricasTalking.APIKey = val
+	}
+	if val := os.Getenv("VONAGE_API_KEY"); val != "" {
+		config.Notify.SMS.Vonage.APIKey = val
+	}
+	if val := os.Getenv("VONAGE_API_SECRET"); val != "" {
+		config.Notify.SMS.Vonage.APISecret = val
+	}
+	if val := os.Getenv("FCM_CREDENTIALS_FILE"); val != "" {
+		config.Notify.Push.FCM.CredentialsFile = val
+	}
+	if val := os.Getenv("APNS_KEY_FILE"); val != "" {
+		config.Notify.Push.APNs.KeyFile = val
+	}
+	if val := os.Getenv("APNS_KEY_ID"); val != "" {
+		config.Notify.Push.APNs.KeyID = val
+	}
+	if val := os.Getenv("APNS_TEAM_ID"); val != "" {
+		config.Notify.Push.APNs.TeamID = val
+	}
+	if val := os.Getenv("VAPID_PUBLIC_KEY"); val != "" {
+		config.Notify.Push.WebPush.PublicKey = val
+	}
+	if val := os.Getenv("VAPID_PRIVATE_KEY"); val != "" {
+		config.Notify.Push.WebPush.PrivateKey = val
+	}
+
+	// Payments overrides
+	if val := os.Getenv("PAYMENTS_ENABLED"); val != "" {
+		if enabled, err := strconv.ParseBool(val); err == nil {
+			config.Payments.Enabled = enabled
+		}
+	}
+	if val := os.Getenv("STRIPE_SECRET_KEY"); val != "" {
+		config.Payments.Stripe.SecretKey = val
+	}
+	if val := os.Getenv("STRIPE_WEBHOOK_SECRET"); val != "" {
+		config.Payments.Stripe.WebhookSecret = val
+	}
+	if val := os.Getenv("PAYPAL_CLIENT_ID"); val != "" {
+		config.Payments.PayPal.ClientID = val
+	}
+	if val := os.Getenv("PAYPAL_CLIENT_SECRET"); val != "" {
+		config.Payments.PayPal.ClientSecret = val
+	}
+	if val := os.Getenv("MPESA_CONSUMER_KEY"); val != "" {
+		config.Payments.MPesa.ConsumerKey = val
+	}
+	if val := os.Getenv("MPESA_CONSUMER_SECRET"); val != "" {
+		config.Payments.MPesa.ConsumerSecret = val
+	}
+	if val := os.Getenv("MPESA_PASS_KEY"); val != "" {
+		config.Payments.MPesa.PassKey = val
+	}
+
+	// Resumable upload overrides
+	if val := os.Getenv("TUS_ENABLED"); val != "" {
+		if enabled, err := strconv.ParseBool(val); err == nil {
+			config.Tus.Enabled = enabled
+		}
+	}
+
+	// Search overrides
+	if val := os.Getenv("SEARCH_ENABLED"); val != "" {
+		if enabled, err := strconv.ParseBool(val); err == nil {
+			config.Search.Enabled = enabled
+		}
+	}
+	if val := os.Getenv("SEARCH_DRIVER"); val != "" {
+		config.Search.Driver = val
+	}
+	if val := os.Getenv("MEILISEARCH_HOST"); val != "" {
+		config.Search.Meilisearch.Host = val
+	}
+	if val := os.Getenv("MEILISEARCH_KEY"); val != "" {
+		config.Search.Meilisearch.Key = val
+	}
+	if val := os.Getenv("ELASTICSEARCH_URL"); val != "" {
+		config.Search.Elasticsearch.URL = val
+	}
+
+	// SLO overrides
+	if val := os.Getenv("SLO_ENABLED"); val != "" {
+		if enabled, err := strconv.ParseBool(val); err == nil {
+			config.SLO.Enabled = enabled
+		}
+	}
 
 	// JWT overrides
 	if val := os.Getenv("JWT_SECRET"); val != "" {
@@ -304,3 +2456,37 @@ func (c *Config) IsDevelopment() bool {
 func (c *Config) IsTesting() bool {
 	return c.App.Environment == "testing"
 }
+
+// ServerTimingEnabled reports whether responses get a Server-Timing header
+func (c *Config) ServerTimingEnabled() bool {
+	switch c.Tracing.ServerTiming {
+	case "on":
+		return true
+	case "auto":
+		return c.App.Debug || c.App.Environment == "staging"
+	}
+	return false
+}
+
+// Enabled reports whether uploads are scanned for malware
+func (c ScanConfig) Enabled() bool {
+	return c.Driver != "" && c.Driver != "none"
+}
+
+// URL returns where the server can be reached locally
+func (c ServerConfig) URL() string {
+	host := c.Host
+	if host == "" || host == "0.0.0.0" {
+		host = "localhost"
+	}
+	return fmt.Sprintf("http://%s:%d", host, c.Port)
+}
+
+// URL returns where the metrics endpoint can be reached locally
+func (c MetricsConfig) URL() string {
+	host := c.Host
+	if host == "" || host == "0.0.0.0" {
+		host = "localhost"
+	}
+	return fmt.Sprintf("http://%s:%d%s", host, c.Port, c.Path)
+}
@@ -0,0 +1,238 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/security"
+)
+
+// inProject runs the test in a directory holding files, starting from a
+// fresh viper
+func inProject(t *testing.T, files map[string]string) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	t.Chdir(dir)
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+}
+
+func TestLoadLayersEnvironmentOverlay(t *testing.T) {
+	inProject(t, map[string]string{
+		"config/config.yaml":  "app:\n  environment: staging\nserver:\n  port: 8080\nservices:\n  stripe:\n    key: pk_test\n    webhook_timeout: 5s\n",
+		"config/staging.yaml": "server:\n  port: 9090\nservices:\n  stripe:\n    key: pk_staging\n",
+	})
+	t.Setenv("APP_NAME", "Shop")
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, 9090, cfg.Server.Port)
+	assert.Equal(t, 9090, GetInt("server.port"))
+	assert.Equal(t, "pk_staging", GetString("services.stripe.key"))
+	assert.Equal(t, 5*time.Second, GetDuration("services.stripe.webhook_timeout"), "base keys the overlay doesn't set are kept")
+	assert.Equal(t, "Shop", GetString("app.name"), "environment overrides are visible to accessors")
+	assert.Equal(t, 30*time.Second, GetDuration("server.read_timeout"), "plain numbers are seconds")
+	assert.Equal(t, 200*time.Millisecond, GetDuration("database.slow_query_threshold"))
+	assert.False(t, IsSet("services.paypal"))
+
+	t.Setenv("APP_ENV", "development")
+	cfg, err = Load()
+	require.NoError(t, err)
+	assert.Equal(t, 8080, cfg.Server.Port, "APP_ENV picks the overlay")
+}
+
+func TestConfigCache(t *testing.T) {
+	inProject(t, map[string]string{
+		".env":               "DB_PASSWORD=from-dotenv\n",
+		"config/config.yaml": "server:\n  port: 8081\nservices:\n  mailer: smtp\n",
+	})
+	t.Cleanup(func() { os.Unsetenv("DB_PASSWORD") })
+
+	cached, err := Cache()
+	require.NoError(t, err)
+	assert.Equal(t, "from-dotenv", cached.Database.Password)
+	info, err := os.Stat(CachePath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// Once cached, the sources are no longer read
+	require.NoError(t, os.Remove(".env"))
+	os.Unsetenv("DB_PASSWORD")
+	require.NoError(t, os.WriteFile("config/config.yaml", []byte("server:\n  port: 9999\n"), 0644))
+	viper.Reset()
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, 8081, cfg.Server.Port)
+	assert.Equal(t, "from-dotenv", cfg.Database.Password)
+	assert.Equal(t, "smtp", GetString("services.mailer"))
+	assert.Equal(t, 200*time.Millisecond, cfg.Database.SlowQueryThreshold)
+
+	// The environment still wins over the cache
+	t.Setenv("DB_PASSWORD", "from-env")
+	cfg, err = Load()
+	require.NoError(t, err)
+	assert.Equal(t, "from-env", cfg.Database.Password)
+
+	cleared, err := ClearCache()
+	require.NoError(t, err)
+	assert.True(t, cleared)
+	cfg, err = Load()
+	require.NoError(t, err)
+	assert.Equal(t, 9999, cfg.Server.Port)
+
+	cleared, err = ClearCache()
+	require.NoError(t, err)
+	assert.False(t, cleared)
+}
+
+func TestLoadValidates(t *testing.T) {
+	inProject(t, map[string]string{
+		"config/config.yaml": "app:\n  environment: production\n  key: your-application-key-here\nserver:\n  port: 70000\njwt:\n  secret: s3cret\nrequired:\n  - services.stripe.secret\n  - app.name\n",
+	})
+
+	_, err := Load()
+	var invalid *ValidationError
+	require.True(t, errors.As(err, &invalid), "got %v", err)
+	assert.Equal(t, []string{
+		"services.stripe.secret is required but not set",
+		"server.port 70000 is not a valid port",
+		"app.key must be set to a secret in production (APP_KEY)",
+		"auth.jwt_secret must be set to a secret in production (AUTH_JWT_SECRET)",
+	}, invalid.Problems)
+
+	_, err = Cache()
+	assert.Error(t, err, "invalid configuration is not cached")
+	assert.NoFileExists(t, CachePath)
+}
+
+func TestLoadLayersHTTPPresets(t *testing.T) {
+	inProject(t, map[string]string{
+		"config/config.yaml":     "app:\n  environment: production\n",
+		"config/http.yaml":       HTTPPresets,
+		"config/production.yaml": "http:\n  cors:\n    allowed_origins: [\"https://app.example.com\"]\n",
+	})
+	t.Setenv("APP_ENV", "staging")
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"http://localhost:5173"}, cfg.HTTP.CORS.AllowedOrigins)
+	assert.Contains(t, cfg.HTTP.CORS.AllowedMethods, "PATCH")
+	assert.Equal(t, 600, cfg.HTTP.CORS.MaxAge)
+	assert.Equal(t, "web", cfg.HTTP.Auth.Guard)
+	assert.Equal(t, RateLimitConfig{Limit: 5, Window: time.Minute, By: "ip",
+		Paths: []string{"/auth/login", "/api/v1/auth/login", "/api/v1/auth/register"}}, cfg.HTTP.RateLimits["login"])
+	assert.Equal(t, "user", cfg.HTTP.RateLimits["api"].By)
+	assert.Equal(t, map[string][]string{"web": {}, "api": {"throttle:api", "formats:xml,csv,msgpack"}}, cfg.HTTP.MiddlewareGroups)
+	assert.Equal(t, RequestLimitsConfig{MaxBodySize: 10 << 20, Timeout: 30 * time.Second}, cfg.HTTP.Requests.RequestLimitsConfig)
+
+	t.Setenv("APP_ENV", "production")
+	t.Setenv("APP_KEY", "k")
+	t.Setenv("JWT_SECRET", "j")
+	t.Setenv("AUTH_JWT_SECRET", "a")
+	cfg, err = Load()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https://app.example.com"}, cfg.HTTP.CORS.AllowedOrigins, "the overlay wins")
+	assert.True(t, cfg.HTTP.CORS.AllowCredentials, "keys the overlay doesn't set are kept")
+}
+
+func TestLoadValidatesHTTPPresets(t *testing.T) {
+	inProject(t, map[string]string{
+		"config/http.yaml": "http:\n  auth:\n    guard: admin\n  rate_limits:\n    uploads:\n      limit: 10\n      by: tenant\n" +
+			"  requests:\n    routes:\n      /imports:\n        max_body_size: 1048576\n        timeout: -1s\n",
+	})
+
+	_, err := Load()
+	var invalid *ValidationError
+	require.True(t, errors.As(err, &invalid), "got %v", err)
+	assert.Equal(t, []string{
+		`http.auth.guard "admin" is not a guard (web or api)`,
+		"http.rate_limits.uploads needs a limit and a window",
+		`http.rate_limits.uploads.by "tenant" is not ip or user`,
+		`http.requests.routes["/imports"] limits may not be negative`,
+	}, invalid.Problems)
+}
+
+func TestLoadValidatesGateway(t *testing.T) {
+	inProject(t, map[string]string{
+		"config/config.yaml": "gateway:\n  upstreams:\n    orders:\n      url: http://orders.internal:8081\n      paths: [/orders]\n" +
+			"      retries: 2\n      circuit_breaker:\n        failure_threshold: 5\n" +
+			"    billing:\n      url: billing.internal\n      paths: [billing]\n      retries: -1\n      rate_limit: billing\n",
+	})
+
+	_, err := Load()
+	var invalid *ValidationError
+	require.True(t, errors.As(err, &invalid), "got %v", err)
+	assert.Equal(t, []string{
+		`gateway.upstreams.billing.url "billing.internal" is not an http or https URL`,
+		`gateway.upstreams.billing.paths "billing" must start with /`,
+		"gateway.upstreams.billing limits may not be negative",
+		`gateway.upstreams.billing.rate_limit "billing" is not in http.rate_limits`,
+	}, invalid.Problems)
+}
+
+func TestMailServerFromEnv(t *testing.T) {
+	inProject(t, map[string]string{
+		"config/config.yaml": "mail:\n  smtp:\n    - host: smtp.example.com\n      port: 587\n    - host: backup.example.com\n      port: 25\n  pool:\n    timeout: 15s\n",
+	})
+	t.Setenv("MAIL_HOST", "smtp.internal")
+	t.Setenv("MAIL_PASSWORD", "s3cret")
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, []SMTPConfig{
+		{Host: "smtp.internal", Port: 587, Password: "s3cret"},
+		{Host: "backup.example.com", Port: 25},
+	}, cfg.Mail.SMTP)
+	assert.Equal(t, 15*time.Second, cfg.Mail.Pool.Timeout)
+	assert.Equal(t, 4, cfg.Mail.Pool.MaxConnections)
+	assert.Equal(t, "smtp.internal", GetString("mail.smtp.0.host"))
+}
+
+func TestLoadDecryptsEncryptedEnv(t *testing.T) {
+	inProject(t, map[string]string{".env": "APP_NAME=FromDotenv\n"})
+	for _, key := range []string{"APP_NAME", "DB_PASSWORD", "JWT_SECRET"} {
+		t.Cleanup(func() { os.Unsetenv(key) })
+	}
+
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	t.Setenv(security.MasterKeyEnv, base64.StdEncoding.EncodeToString(key))
+	cm, err := security.NewCredentialManager(security.CredentialsKeyFile)
+	require.NoError(t, err)
+	require.NoError(t, cm.WriteEnv(security.EncryptedEnvFile, []byte("# production\nDB_PASSWORD=from-encrypted\nJWT_SECRET=\"s3cret\"\nAPP_NAME=FromEncrypted\n")))
+	assert.NoFileExists(t, security.CredentialsKeyFile, "the key came from the environment")
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, "from-encrypted", cfg.Database.Password)
+	assert.Equal(t, "s3cret", cfg.JWT.Secret)
+	assert.Equal(t, "FromDotenv", cfg.App.Name, ".env takes precedence")
+
+	// Without a key the file is skipped; with the wrong one boot fails
+	os.Unsetenv("DB_PASSWORD")
+	t.Setenv(security.MasterKeyEnv, "")
+	cfg, err = Load()
+	require.NoError(t, err)
+	assert.Equal(t, "password", cfg.Database.Password)
+
+	require.NoError(t, os.MkdirAll(".dolphin", 0700))
+	require.NoError(t, os.WriteFile(security.CredentialsKeyFile, make([]byte, 32), 0600))
+	_, err = Load()
+	assert.ErrorContains(t, err, "failed to decrypt .env.encrypted (wrong master key?)")
+}
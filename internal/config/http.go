@@ -0,0 +1,82 @@
+package config
+
+// HTTPFile is the file, beside config.yaml, that holds the HTTP presets.
+// Load layers it over config.yaml and under the environment's overlay.
+const HTTPFile = "http.yaml"
+
+// HTTPPresets is the config/http.yaml `dolphin new` writes: CORS for a
+// single-page app on its own origin, the default auth guard, rate limiters
+// for the API and the sign-in forms, the middleware groups and the request
+// limits, with commented examples of what else each takes
+const HTTPPresets = `# HTTP presets, layered over config.yaml and under the environment's
+# overlay (config/production.yaml overrides them in production).
+http:
+  # CORS for a single-page app served from its own origin, such as the Vite
+  # dev server. List every origin the app is served from; "*" allows any
+  # origin but then browsers never send cookies.
+  cors:
+    allowed_origins:
+      - "http://localhost:5173"
+      # - "https://app.example.com"
+      # - "https://*.example.com"   # one level of subdomains
+    allowed_methods: ["GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"]
+    allowed_headers: ["Accept", "Authorization", "Content-Type", "Idempotency-Key", "X-CSRF-Token", "X-Requested-With"]
+    exposed_headers: ["Link", "Location", "Retry-After", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset"]
+    allow_credentials: true   # send the session cookie cross-origin
+    max_age: 600              # seconds browsers may cache a preflight
+
+  # The guard requests authenticate with unless a route names another
+  auth:
+    guard: web
+    # guard: api   # for token-only APIs without sessions
+
+  # Named rate limiters. Each applies to its paths and to the routes that
+  # use it by name, as "throttle:uploads" or router.RateLimit("uploads").
+  # by: ip counts per client address; by: user per signed-in user, and
+  # guests per address.
+  rate_limits:
+    api:
+      limit: 120
+      window: 1m
+      by: user
+    login:
+      limit: 5
+      window: 1m
+      by: ip
+      paths: ["/auth/login", "/api/v1/auth/login", "/api/v1/auth/register"]
+    # uploads:
+    #   limit: 20
+    #   window: 1h
+    #   by: user
+
+  # Middleware groups, asked for by name with routing.Router.Group: the
+  # framework's /api routes and generated API resources are in "api", its
+  # pages in "web". Members are aliases or other groups:
+  #   auth, guest, verified     signed-in users, guests, verified users
+  #   role:admin,editor         users with one of the roles
+  #   can:posts.publish         users with the permission
+  #   throttle:60,1             60 requests a minute per user, or guest IP
+  #   throttle:<name>           a limiter above
+  #   formats:xml,csv           responses also in XML and CSV, besides JSON
+  #   body:100MB, timeout:5m    request limits other than those below
+  middleware_groups:
+    web: []
+    api: ["throttle:api", "formats:xml,csv,msgpack"]
+    # admin: ["web", "auth", "role:admin"]
+
+  # Request limits. Bodies over max_body_size bytes get 413; requests
+  # running past timeout have their context, and the queries run with it,
+  # canceled and get 408. slow_threshold replaces log.access.slow_threshold.
+  # Routes override them here, by route pattern or path prefix, or with the
+  # aliases body:100MB and timeout:5m.
+  requests:
+    max_body_size: 10485760   # 10 MB, bodies bound by ctx.Bind included
+    timeout: 30s
+    # routes:
+    #   "/tus":
+    #     max_body_size: 1073741824
+    #     timeout: 10m
+    #   "/api/v1/reports/{id}":
+    #     timeout: 2m
+    #     slow_threshold: 30s
+`
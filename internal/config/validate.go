@@ -0,0 +1,149 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// ValidationError lists every problem found in the configuration
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// productionSecrets are the secrets that must be replaced in production,
+// with the placeholder config.yaml ships and the variable that sets them
+var productionSecrets = []struct {
+	key, placeholder, env string
+}{
+	{"app.key", "your-application-key-here", "APP_KEY"},
+	{"jwt.secret", "your-secret-key", "JWT_SECRET"},
+	{"auth.jwt_secret", "your-jwt-secret-key", "AUTH_JWT_SECRET"},
+}
+
+// validate checks the loaded configuration: the keys it lists as required
+// are set, the server port is usable, the HTTP presets are complete, and
+// production has real secrets
+func validate(config *Config, settings *viper.Viper) error {
+	var problems []string
+
+	for _, key := range config.Required {
+		if isEmpty(settings.Get(key)) {
+			problems = append(problems, fmt.Sprintf("%s is required but not set", key))
+		}
+	}
+
+	if config.Server.Port < 1 || config.Server.Port > 65535 {
+		problems = append(problems, fmt.Sprintf("server.port %d is not a valid port", config.Server.Port))
+	}
+
+	if guard := config.HTTP.Auth.Guard; guard != "web" && guard != "api" {
+		problems = append(problems, fmt.Sprintf("http.auth.guard %q is not a guard (web or api)", guard))
+	}
+	names := make([]string, 0, len(config.HTTP.RateLimits))
+	for name := range config.HTTP.RateLimits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		limiter := config.HTTP.RateLimits[name]
+		if limiter.Limit < 1 || limiter.Window <= 0 {
+			problems = append(problems, fmt.Sprintf("http.rate_limits.%s needs a limit and a window", name))
+		}
+		if limiter.By != "" && limiter.By != "ip" && limiter.By != "user" {
+			problems = append(problems, fmt.Sprintf("http.rate_limits.%s.by %q is not ip or user", name, limiter.By))
+		}
+	}
+
+	requests := map[string]RequestLimitsConfig{"http.requests": config.HTTP.Requests.RequestLimitsConfig}
+	for route, limits := range config.HTTP.Requests.Routes {
+		requests[fmt.Sprintf("http.requests.routes[%q]", route)] = limits
+	}
+	names = names[:0]
+	for name := range requests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if limits := requests[name]; limits.MaxBodySize < 0 || limits.Timeout < 0 || limits.SlowThreshold < 0 {
+			problems = append(problems, fmt.Sprintf("%s limits may not be negative", name))
+		}
+	}
+
+	if config.Webhooks.Retention < 0 || config.Webhooks.MaxBodySize < 0 {
+		problems = append(problems, "webhooks limits may not be negative")
+	}
+	if config.SSE.Heartbeat < 0 || config.SSE.Retry < 0 || config.SSE.History < 0 {
+		problems = append(problems, "sse limits may not be negative")
+	}
+
+	names = names[:0]
+	for name := range config.Gateway.Upstreams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		problems = append(problems, validateUpstream(name, config.Gateway.Upstreams[name], config.HTTP.RateLimits)...)
+	}
+
+	if config.IsProduction() {
+		for _, secret := range productionSecrets {
+			if value := settings.GetString(secret.key); value == "" || value == secret.placeholder {
+				problems = append(problems, fmt.Sprintf("%s must be set to a secret in production (%s)", secret.key, secret.env))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func isEmpty(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+	return false
+}
+
+// validateUpstream checks a gateway upstream has an absolute URL and paths
+// to proxy, and that its rate limiter exists
+func validateUpstream(name string, upstream UpstreamConfig, rateLimits map[string]RateLimitConfig) []string {
+	var problems []string
+	key := "gateway.upstreams." + name
+	if u, err := url.Parse(upstream.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		problems = append(problems, fmt.Sprintf("%s.url %q is not an http or https URL", key, upstream.URL))
+	}
+	if len(upstream.Paths) == 0 {
+		problems = append(problems, fmt.Sprintf("%s needs paths to proxy", key))
+	}
+	for _, path := range upstream.Paths {
+		if !strings.HasPrefix(path, "/") {
+			problems = append(problems, fmt.Sprintf("%s.paths %q must start with /", key, path))
+		}
+	}
+	if upstream.Timeout < 0 || upstream.Retries < 0 || upstream.RetryBackoff < 0 ||
+		upstream.CircuitBreaker.FailureThreshold < 0 || upstream.CircuitBreaker.OpenTimeout < 0 {
+		problems = append(problems, fmt.Sprintf("%s limits may not be negative", key))
+	}
+	if upstream.RateLimit != "" {
+		if _, ok := rateLimits[upstream.RateLimit]; !ok {
+			problems = append(problems, fmt.Sprintf("%s.rate_limit %q is not in http.rate_limits", key, upstream.RateLimit))
+		}
+	}
+	return problems
+}
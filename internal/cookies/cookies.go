@@ -0,0 +1,318 @@
+// Package cookies sets and reads cookies encrypted with the app key:
+//
+//	cookies.Set(w, "remember", token, cookies.MaxAge(30*24*time.Hour))
+//	token, err := cookies.Get(r, "remember")
+//
+// Values are encrypted and authenticated by default, so the browser can't
+// read or change them. Signed cookies can be read but not changed, and
+// plain ones are left as they are, e.g. for scripts to read. Path, domain,
+// Secure, HttpOnly and SameSite default to the cookies config.
+package cookies
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+// maxSize is the largest cookie, name and attributes included, that
+// browsers are required to keep
+const maxSize = 4096
+
+var (
+	// ErrNoKey is returned by the package-level functions before a jar
+	// has been configured
+	ErrNoKey = errors.New("cookies: no jar configured; set app.key")
+
+	// ErrInvalid is returned for a cookie that was changed, or encrypted
+	// with another key
+	ErrInvalid = errors.New("cookies: invalid cookie value")
+
+	// ErrTooLarge is returned for a cookie browsers would drop
+	ErrTooLarge = errors.New("cookies: cookie exceeds 4096 bytes")
+)
+
+type mode int
+
+const (
+	encrypted mode = iota
+	signed
+	plain
+)
+
+// settings is a cookie being built and how its value is protected
+type settings struct {
+	cookie http.Cookie
+	mode   mode
+}
+
+// Option changes a cookie from the configured defaults
+type Option func(*settings)
+
+// MaxAge keeps the cookie for d; without it the cookie lasts until the
+// browser closes. A negative d deletes the cookie.
+func MaxAge(d time.Duration) Option {
+	return func(s *settings) {
+		if d < 0 {
+			s.cookie.MaxAge = -1
+			s.cookie.Expires = time.Unix(1, 0)
+			return
+		}
+		s.cookie.MaxAge = int(d / time.Second)
+		s.cookie.Expires = time.Now().Add(d)
+	}
+}
+
+// Path limits the cookie to URLs under path
+func Path(path string) Option {
+	return func(s *settings) { s.cookie.Path = path }
+}
+
+// Domain sends the cookie to domain and its subdomains
+func Domain(domain string) Option {
+	return func(s *settings) { s.cookie.Domain = domain }
+}
+
+// Secure sends the cookie over HTTPS only
+func Secure(secure bool) Option {
+	return func(s *settings) { s.cookie.Secure = secure }
+}
+
+// HTTPOnly hides the cookie from scripts
+func HTTPOnly(httpOnly bool) Option {
+	return func(s *settings) { s.cookie.HttpOnly = httpOnly }
+}
+
+// SameSite sets when the cookie is sent with cross-site requests
+func SameSite(sameSite http.SameSite) Option {
+	return func(s *settings) { s.cookie.SameSite = sameSite }
+}
+
+// Signed leaves the value readable but rejects it if it was changed. Read
+// it back with the Signed option too.
+func Signed() Option {
+	return func(s *settings) { s.mode = signed }
+}
+
+// Plain stores the value as it is. Read it back with the Plain option too.
+func Plain() Option {
+	return func(s *settings) { s.mode = plain }
+}
+
+// Jar encrypts, signs and writes cookies
+type Jar struct {
+	aead     cipher.AEAD
+	signKey  []byte
+	defaults http.Cookie
+}
+
+// New creates a jar whose keys are derived from the app key, which may be
+// given as base64:<key> as well as a plain string
+func New(key string, cfg config.CookiesConfig) (*Jar, error) {
+	secret := []byte(key)
+	if encoded, ok := strings.CutPrefix(key, "base64:"); ok {
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("cookies: decoding app key: %w", err)
+		}
+		secret = decoded
+	}
+	if len(secret) == 0 {
+		return nil, errors.New("cookies: app key is empty")
+	}
+
+	block, err := aes.NewCipher(deriveKey(secret, "dolphin cookies: encryption"))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	sameSite, err := parseSameSite(cfg.SameSite)
+	if err != nil {
+		return nil, err
+	}
+	return &Jar{
+		aead:    aead,
+		signKey: deriveKey(secret, "dolphin cookies: signing"),
+		defaults: http.Cookie{
+			Path:     cfg.Path,
+			Domain:   cfg.Domain,
+			Secure:   cfg.Secure,
+			HttpOnly: cfg.HttpOnly,
+			SameSite: sameSite,
+		},
+	}, nil
+}
+
+// deriveKey derives a 256-bit key for one purpose from the app key
+func deriveKey(secret []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+func parseSameSite(value string) (http.SameSite, error) {
+	switch strings.ToLower(value) {
+	case "":
+		return http.SameSiteDefaultMode, nil
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	}
+	return 0, fmt.Errorf("cookies: unknown same_site %q (want Lax, Strict or None)", value)
+}
+
+func (j *Jar) settings(name string, opts []Option) *settings {
+	s := &settings{cookie: j.defaults}
+	s.cookie.Name = name
+	for _, opt := range opts {
+		opt(s)
+	}
+	// Browsers reject SameSite=None cookies that aren't Secure
+	if s.cookie.SameSite == http.SameSiteNoneMode {
+		s.cookie.Secure = true
+	}
+	return s
+}
+
+// Cookie returns the cookie Set would write
+func (j *Jar) Cookie(name, value string, opts ...Option) (*http.Cookie, error) {
+	s := j.settings(name, opts)
+	switch s.mode {
+	case encrypted:
+		nonce := make([]byte, j.aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, err
+		}
+		// The name is authenticated so a value can't be moved to another cookie
+		sealed := j.aead.Seal(nonce, nonce, []byte(value), []byte(name))
+		s.cookie.Value = base64.RawURLEncoding.EncodeToString(sealed)
+	case signed:
+		s.cookie.Value = base64.RawURLEncoding.EncodeToString([]byte(value)) + "." +
+			base64.RawURLEncoding.EncodeToString(j.sign(name, value))
+	default:
+		s.cookie.Value = value
+	}
+
+	if len(s.cookie.String()) > maxSize {
+		return nil, fmt.Errorf("%w: %s", ErrTooLarge, name)
+	}
+	return &s.cookie, nil
+}
+
+func (j *Jar) sign(name, value string) []byte {
+	mac := hmac.New(sha256.New, j.signKey)
+	mac.Write([]byte(name + "=" + value))
+	return mac.Sum(nil)
+}
+
+// Set writes the cookie to w's headers, so it must be called before the
+// response is written; Queue works from anywhere in a request
+func (j *Jar) Set(w http.ResponseWriter, name, value string, opts ...Option) error {
+	cookie, err := j.Cookie(name, value, opts...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, cookie)
+	return nil
+}
+
+// Forget deletes the cookie. Path and Domain must match the ones it was
+// set with.
+func (j *Jar) Forget(w http.ResponseWriter, name string, opts ...Option) {
+	cookie, _ := j.Cookie(name, "", append(opts, Plain(), MaxAge(-1))...)
+	http.SetCookie(w, cookie)
+}
+
+// Get returns the value of the cookie sent with r. It returns
+// http.ErrNoCookie if there is none and ErrInvalid if it was changed.
+// Signed and plain cookies are read with the option they were set with.
+func (j *Jar) Get(r *http.Request, name string, opts ...Option) (string, error) {
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	return j.Decode(name, cookie.Value, opts...)
+}
+
+// Decode returns the value a cookie called name was set to
+func (j *Jar) Decode(name, value string, opts ...Option) (string, error) {
+	s := &settings{}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	switch s.mode {
+	case encrypted:
+		sealed, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil || len(sealed) < j.aead.NonceSize() {
+			return "", ErrInvalid
+		}
+		nonce, ciphertext := sealed[:j.aead.NonceSize()], sealed[j.aead.NonceSize():]
+		opened, err := j.aead.Open(nil, nonce, ciphertext, []byte(name))
+		if err != nil {
+			return "", ErrInvalid
+		}
+		return string(opened), nil
+	case signed:
+		encoded, encodedMAC, ok := strings.Cut(value, ".")
+		if !ok {
+			return "", ErrInvalid
+		}
+		decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+		if err != nil {
+			return "", ErrInvalid
+		}
+		mac, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+		if err != nil || !hmac.Equal(mac, j.sign(name, string(decoded))) {
+			return "", ErrInvalid
+		}
+		return string(decoded), nil
+	}
+	return value, nil
+}
+
+// Default is the jar used by the package-level functions, configured from
+// app.key when the router starts
+var Default *Jar
+
+// Set writes a cookie with the default jar
+func Set(w http.ResponseWriter, name, value string, opts ...Option) error {
+	if Default == nil {
+		return ErrNoKey
+	}
+	return Default.Set(w, name, value, opts...)
+}
+
+// Get reads a cookie with the default jar
+func Get(r *http.Request, name string, opts ...Option) (string, error) {
+	if Default == nil {
+		return "", ErrNoKey
+	}
+	return Default.Get(r, name, opts...)
+}
+
+// Forget deletes a cookie with the default jar
+func Forget(w http.ResponseWriter, name string, opts ...Option) error {
+	if Default == nil {
+		return ErrNoKey
+	}
+	Default.Forget(w, name, opts...)
+	return nil
+}
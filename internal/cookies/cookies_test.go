@@ -0,0 +1,185 @@
+package cookies
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+var testConfig = config.CookiesConfig{Path: "/", HttpOnly: true, SameSite: "Lax"}
+
+func newTestJar(t *testing.T, key string) *Jar {
+	jar, err := New(key, testConfig)
+	require.NoError(t, err)
+	return jar
+}
+
+// roundTrip sets a cookie on a response and returns a request sending it
+// back, along with the cookie as written
+func roundTrip(t *testing.T, set func(w http.ResponseWriter)) (*http.Request, *http.Cookie) {
+	w := httptest.NewRecorder()
+	set(w)
+	written := w.Result().Cookies()
+	require.Len(t, written, 1)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(written[0])
+	return r, written[0]
+}
+
+func TestEncryptedCookies(t *testing.T) {
+	jar := newTestJar(t, "app-key")
+
+	r, written := roundTrip(t, func(w http.ResponseWriter) {
+		require.NoError(t, jar.Set(w, "remember", "user:42", MaxAge(time.Hour)))
+	})
+	assert.NotContains(t, written.Value, "user")
+	assert.Equal(t, "/", written.Path)
+	assert.True(t, written.HttpOnly)
+	assert.Equal(t, http.SameSiteLaxMode, written.SameSite)
+	assert.Equal(t, 3600, written.MaxAge)
+
+	value, err := jar.Get(r, "remember")
+	require.NoError(t, err)
+	assert.Equal(t, "user:42", value)
+
+	// Each write uses a new nonce
+	again, _ := jar.Cookie("remember", "user:42")
+	assert.NotEqual(t, written.Value, again.Value)
+
+	// Changed values, values moved to another cookie and values from
+	// another key are rejected
+	tampered := []byte(written.Value)
+	tampered[len(tampered)/2] ^= 1
+	_, err = jar.Decode("remember", string(tampered))
+	assert.ErrorIs(t, err, ErrInvalid)
+	_, err = jar.Decode("session", written.Value)
+	assert.ErrorIs(t, err, ErrInvalid)
+	_, err = newTestJar(t, "other-key").Decode("remember", written.Value)
+	assert.ErrorIs(t, err, ErrInvalid)
+
+	_, err = jar.Get(httptest.NewRequest(http.MethodGet, "/", nil), "remember")
+	assert.ErrorIs(t, err, http.ErrNoCookie)
+}
+
+func TestSignedAndPlainCookies(t *testing.T) {
+	jar := newTestJar(t, "base64:"+"c2VjcmV0LWtleS1mb3ItdGVzdHM=")
+
+	r, written := roundTrip(t, func(w http.ResponseWriter) {
+		require.NoError(t, jar.Set(w, "theme", "dark mode", Signed()))
+	})
+	assert.True(t, strings.HasPrefix(written.Value, "ZGFyayBtb2Rl."), "the value stays readable")
+	value, err := jar.Get(r, "theme", Signed())
+	require.NoError(t, err)
+	assert.Equal(t, "dark mode", value)
+
+	forged, _ := jar.Cookie("theme", "light mode", Plain())
+	_, err = jar.Decode("theme", "bGlnaHQgbW9kZQ."+strings.SplitN(written.Value, ".", 2)[1])
+	assert.ErrorIs(t, err, ErrInvalid)
+	_, err = jar.Decode("theme", forged.Value, Signed())
+	assert.ErrorIs(t, err, ErrInvalid)
+
+	r, written = roundTrip(t, func(w http.ResponseWriter) {
+		require.NoError(t, jar.Set(w, "tz", "Africa/Nairobi", Plain(), HTTPOnly(false), Path("/app")))
+	})
+	assert.Equal(t, "Africa/Nairobi", written.Value)
+	assert.False(t, written.HttpOnly)
+	assert.Equal(t, "/app", written.Path)
+	value, err = jar.Get(r, "tz", Plain())
+	require.NoError(t, err)
+	assert.Equal(t, "Africa/Nairobi", value)
+}
+
+func TestCookieOptions(t *testing.T) {
+	jar, err := New("key", config.CookiesConfig{Path: "/", Domain: "example.com", Secure: true, SameSite: "Strict"})
+	require.NoError(t, err)
+	cookie, err := jar.Cookie("a", "b")
+	require.NoError(t, err)
+	assert.Equal(t, "example.com", cookie.Domain)
+	assert.True(t, cookie.Secure)
+	assert.Equal(t, http.SameSiteStrictMode, cookie.SameSite)
+
+	cookie, err = jar.Cookie("a", "b", SameSite(http.SameSiteNoneMode), Secure(false))
+	require.NoError(t, err)
+	assert.True(t, cookie.Secure, "SameSite=None cookies must be secure")
+
+	w := httptest.NewRecorder()
+	jar.Forget(w, "a", Domain("example.com"))
+	forgotten := w.Result().Cookies()
+	require.Len(t, forgotten, 1)
+	assert.Equal(t, -1, forgotten[0].MaxAge)
+	assert.Empty(t, forgotten[0].Value)
+
+	_, err = jar.Cookie("big", strings.Repeat("x", maxSize))
+	assert.ErrorIs(t, err, ErrTooLarge)
+
+	_, err = New("", testConfig)
+	assert.Error(t, err)
+	_, err = New("key", config.CookiesConfig{SameSite: "sometimes"})
+	assert.ErrorContains(t, err, `unknown same_site "sometimes"`)
+}
+
+func TestQueuedCookies(t *testing.T) {
+	jar := newTestJar(t, "app-key")
+
+	// Middleware queues before the handler, which replaces one cookie
+	// and writes nothing itself
+	queueing := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.NoError(t, jar.Queue(r.Context(), "visited", "yes", Plain()))
+			require.NoError(t, jar.Queue(r.Context(), "cart", "1"))
+			next.ServeHTTP(w, r)
+		})
+	}
+	handler := Middleware(queueing(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, jar.Queue(r.Context(), "cart", "2"))
+		assert.Len(t, Queued(r.Context()), 2)
+	})))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	written := w.Result().Cookies()
+	require.Len(t, written, 2)
+	assert.Equal(t, "visited", written[0].Name)
+	cart, err := jar.Decode("cart", written[1].Value)
+	require.NoError(t, err)
+	assert.Equal(t, "2", cart)
+
+	// Cookies queued after the response started are refused
+	handler = Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, jar.Queue(r.Context(), "early", "1"))
+		w.Write([]byte("hello"))
+		assert.ErrorIs(t, jar.Queue(r.Context(), "late", "1"), ErrWritten)
+	}))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Len(t, w.Result().Cookies(), 1)
+	assert.Equal(t, "early", w.Result().Cookies()[0].Name)
+
+	assert.ErrorIs(t, jar.Queue(context.Background(), "a", "b"), ErrNoQueue)
+}
+
+func TestDefaultJar(t *testing.T) {
+	previous := Default
+	defer func() { Default = previous }()
+
+	Default = nil
+	assert.ErrorIs(t, Set(httptest.NewRecorder(), "a", "b"), ErrNoKey)
+	_, err := Get(httptest.NewRequest(http.MethodGet, "/", nil), "a")
+	assert.ErrorIs(t, err, ErrNoKey)
+
+	Default = newTestJar(t, "app-key")
+	r, _ := roundTrip(t, func(w http.ResponseWriter) {
+		require.NoError(t, Set(w, "a", "b"))
+	})
+	value, err := Get(r, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "b", value)
+}
@@ -0,0 +1,139 @@
+package cookies
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+)
+
+var (
+	// ErrNoQueue is returned by Queue outside a request handled by
+	// Middleware
+	ErrNoQueue = errors.New("cookies: no cookie queue; add cookies.Middleware")
+
+	// ErrWritten is returned by Queue once the response header has been
+	// written
+	ErrWritten = errors.New("cookies: response already written")
+)
+
+type queueKey struct{}
+
+// queue holds the cookies queued for one response
+type queue struct {
+	mu      sync.Mutex
+	cookies []*http.Cookie
+	written bool
+}
+
+// add queues cookie, replacing a queued cookie with the same name, path and
+// domain
+func (q *queue) add(cookie *http.Cookie) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.written {
+		return ErrWritten
+	}
+	for i, queued := range q.cookies {
+		if queued.Name == cookie.Name && queued.Path == cookie.Path && queued.Domain == cookie.Domain {
+			q.cookies[i] = cookie
+			return nil
+		}
+	}
+	q.cookies = append(q.cookies, cookie)
+	return nil
+}
+
+// write adds the queued cookies to header, once
+func (q *queue) write(header http.Header) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.written {
+		return
+	}
+	q.written = true
+	for _, cookie := range q.cookies {
+		if v := cookie.String(); v != "" {
+			header.Add("Set-Cookie", v)
+		}
+	}
+}
+
+// Queue adds a cookie to the response to the request ctx belongs to, so
+// middleware and code without the ResponseWriter can set cookies. The
+// request must pass through Middleware. Queuing a cookie again replaces it;
+// MaxAge(-1) queues its deletion.
+func (j *Jar) Queue(ctx context.Context, name, value string, opts ...Option) error {
+	q, ok := ctx.Value(queueKey{}).(*queue)
+	if !ok {
+		return ErrNoQueue
+	}
+	cookie, err := j.Cookie(name, value, opts...)
+	if err != nil {
+		return err
+	}
+	return q.add(cookie)
+}
+
+// Queue queues a cookie with the default jar
+func Queue(ctx context.Context, name, value string, opts ...Option) error {
+	if Default == nil {
+		return ErrNoKey
+	}
+	return Default.Queue(ctx, name, value, opts...)
+}
+
+// Queued returns the cookies queued so far for the request ctx belongs to
+func Queued(ctx context.Context) []*http.Cookie {
+	q, ok := ctx.Value(queueKey{}).(*queue)
+	if !ok {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]*http.Cookie(nil), q.cookies...)
+}
+
+// Middleware writes the cookies queued while handling a request to its
+// response, just before the header is written
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := &queue{}
+		qw := &queueWriter{ResponseWriter: w, queue: q}
+		next.ServeHTTP(qw, r.WithContext(context.WithValue(r.Context(), queueKey{}, q)))
+		// Handlers that write nothing get their header written after
+		// returning
+		q.write(w.Header())
+	})
+}
+
+// queueWriter writes the queued cookies when the response starts
+type queueWriter struct {
+	http.ResponseWriter
+	queue *queue
+}
+
+// WriteHeader adds the queued cookies before writing the header
+func (w *queueWriter) WriteHeader(code int) {
+	w.queue.write(w.Header())
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write adds the queued cookies before the response starts
+func (w *queueWriter) Write(b []byte) (int, error) {
+	w.queue.write(w.Header())
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush forwards to the underlying writer when supported
+func (w *queueWriter) Flush() {
+	w.queue.write(w.Header())
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (w *queueWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
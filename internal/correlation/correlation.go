@@ -0,0 +1,240 @@
+// Package correlation carries what identifies a request — its ID, trace,
+// tenant and signed-in user — into the jobs and events it queues, so work
+// done later, in another goroutine or process, logs and traces as part of
+// the request:
+//
+//	job.Correlation = correlation.Capture(ctx)
+//	queue.Push("default", job)
+//
+//	// in the worker
+//	return correlation.Run(context.Background(), job.Correlation, "job "+job.Type, func(ctx context.Context) error {
+//		logger.FromContext(ctx).Info("Sending invoice") // has the request's request_id, trace_id, tenant and user_id
+//		return send(ctx)
+//	})
+//
+// The jobs of the media, search and workflow packages, queued events and
+// outbox messages are carried this way already.
+package correlation
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/logger"
+	"github.com/mrhoseah/dolphin/internal/observability"
+	"github.com/mrhoseah/dolphin/internal/tenancy"
+)
+
+// Keys of the fields carried
+const (
+	RequestIDKey = "request_id"
+	TenantKey    = "tenant"
+	UserKey      = "user_id"
+)
+
+// Fields identify the request work was queued from. Trace context is kept
+// under the W3C traceparent and tracestate keys.
+type Fields map[string]string
+
+// traceContext writes and reads trace context as W3C headers
+var traceContext = propagation.TraceContext{}
+
+// traceParentKey is the W3C header trace context is carried in
+const traceParentKey = "traceparent"
+
+type userKey struct{}
+
+// WithUser returns a copy of ctx carrying the ID of the user work is done
+// for
+func WithUser(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, userKey{}, id)
+}
+
+// UserID returns the ID of the user ctx carries, as restored from queued
+// work or set with WithUser
+func UserID(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(userKey{}).(string)
+	return id, ok && id != ""
+}
+
+// Propagator captures fields from contexts and restores them
+type Propagator struct {
+	mu          sync.RWMutex
+	logger      *zap.Logger
+	identify    func(ctx context.Context) (string, bool)
+	tenants     tenancy.Store
+	userHashKey string
+
+	// provider makes the spans of restored work, the global provider when
+	// nil
+	provider trace.TracerProvider
+}
+
+// NewPropagator creates a propagator tagging restored loggers from logger
+func NewPropagator(logger *zap.Logger) *Propagator {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &Propagator{logger: logger}
+}
+
+// Default is the process-wide propagator used by the package-level
+// functions
+var Default = NewPropagator(nil)
+
+// Capture returns the fields of ctx from the default propagator
+func Capture(ctx context.Context) Fields {
+	return Default.Capture(ctx)
+}
+
+// Restore returns ctx with fields restored by the default propagator
+func Restore(ctx context.Context, fields Fields) context.Context {
+	return Default.Restore(ctx, fields)
+}
+
+// Run runs fn with fields restored by the default propagator, in a span
+func Run(ctx context.Context, fields Fields, name string, fn func(ctx context.Context) error) error {
+	return Default.Run(ctx, fields, name, fn)
+}
+
+// SetLogger replaces the logger restored loggers are made from
+func (p *Propagator) SetLogger(logger *zap.Logger) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.logger = logger
+}
+
+// IdentifyUsers sets how the signed-in user is found when capturing a
+// context that doesn't carry one yet
+func (p *Propagator) IdentifyUsers(identify func(ctx context.Context) (string, bool)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.identify = identify
+}
+
+// UseTenants has restored contexts carry the tenant found in store, so
+// tenancy.FromContext works in queued work as in the request
+func (p *Propagator) UseTenants(store tenancy.Store) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tenants = store
+}
+
+// SetUserHashKey sets the key user IDs are hashed with in spans, as the
+// tracer does for requests
+func (p *Propagator) SetUserHashKey(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.userHashKey = key
+}
+
+// Capture returns the fields identifying the request ctx belongs to, or
+// the work it was restored into, so work queued from queued work stays
+// correlated with the original request
+func (p *Propagator) Capture(ctx context.Context) Fields {
+	fields := Fields{}
+	if id := middleware.GetReqID(ctx); id != "" {
+		fields[RequestIDKey] = id
+	}
+	traceContext.Inject(ctx, propagation.MapCarrier(fields))
+	if t, ok := tenancy.FromContext(ctx); ok {
+		fields[TenantKey] = t.ID
+	}
+
+	p.mu.RLock()
+	identify := p.identify
+	p.mu.RUnlock()
+	if id, ok := UserID(ctx); ok {
+		fields[UserKey] = id
+	} else if identify != nil {
+		if id, ok := identify(ctx); ok {
+			fields[UserKey] = id
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
+
+// Restore returns ctx carrying the request ID, remote span, tenant and
+// user of fields, with a logger for logger.FromContext tagged with them.
+// A tenant that can't be found is only logged.
+func (p *Propagator) Restore(ctx context.Context, fields Fields) context.Context {
+	p.mu.RLock()
+	base, tenants := p.logger, p.tenants
+	p.mu.RUnlock()
+
+	var tags []zap.Field
+	if id := fields[RequestIDKey]; id != "" {
+		ctx = context.WithValue(ctx, middleware.RequestIDKey, id)
+		tags = append(tags, zap.String("request_id", id))
+	}
+	ctx = traceContext.Extract(ctx, propagation.MapCarrier(fields))
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		tags = append(tags, zap.String("trace_id", sc.TraceID().String()))
+	}
+	if id := fields[TenantKey]; id != "" {
+		tags = append(tags, zap.String("tenant", id))
+		if tenants != nil {
+			if t, err := tenants.Find(ctx, id); err == nil {
+				ctx = tenancy.WithTenant(ctx, t)
+			} else {
+				base.Warn("Failed to restore the tenant of queued work", zap.String("tenant", id), zap.Error(err))
+			}
+		}
+	}
+	if id := fields[UserKey]; id != "" {
+		ctx = WithUser(ctx, id)
+		tags = append(tags, zap.String("user_id", id))
+	}
+	return logger.WithContext(ctx, base.With(tags...))
+}
+
+// Run restores fields into ctx and runs fn in a consumer span named name,
+// a child of the span the work was queued from. Work queued outside a
+// trace starts one, and its logger is tagged with that trace's ID.
+func (p *Propagator) Run(ctx context.Context, fields Fields, name string, fn func(ctx context.Context) error) (err error) {
+	ctx = p.Restore(ctx, fields)
+
+	p.mu.RLock()
+	provider, hashKey := p.provider, p.userHashKey
+	p.mu.RUnlock()
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	ctx, span := provider.Tracer("github.com/mrhoseah/dolphin/internal/correlation").
+		Start(ctx, name, trace.WithSpanKind(trace.SpanKindConsumer))
+	defer span.End()
+	if sc := span.SpanContext(); sc.HasTraceID() && fields[traceParentKey] == "" {
+		ctx = logger.WithContext(ctx, logger.FromContext(ctx).With(zap.String("trace_id", sc.TraceID().String())))
+	}
+	if id := fields[TenantKey]; id != "" {
+		span.SetAttributes(tenancy.TenantIDKey.String(id))
+	}
+	if id := fields[UserKey]; id != "" {
+		span.SetAttributes(semconv.EnduserIDKey.String(observability.HashUserID(hashKey, id)))
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			span.SetStatus(codes.Error, "panic")
+			panic(r)
+		}
+		if err != nil && !errors.Is(err, context.Canceled) {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+	}()
+	return fn(ctx)
+}
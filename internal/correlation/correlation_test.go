@@ -0,0 +1,135 @@
+package correlation
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/mrhoseah/dolphin/internal/auth"
+	"github.com/mrhoseah/dolphin/internal/logger"
+	"github.com/mrhoseah/dolphin/internal/observability"
+	"github.com/mrhoseah/dolphin/internal/tenancy"
+)
+
+func newTestPropagator() (*Propagator, *observer.ObservedLogs, *tracetest.InMemoryExporter, *sdktrace.TracerProvider) {
+	core, logs := observer.New(zap.InfoLevel)
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	p := NewPropagator(zap.New(core))
+	p.provider = provider
+	p.UseTenants(tenancy.NewMemoryStore(&tenancy.Tenant{ID: "acme"}))
+	p.SetUserHashKey("app-key")
+	p.IdentifyUsers(func(ctx context.Context) (string, bool) { return "42", true })
+	return p, logs, exporter, provider
+}
+
+func TestCaptureAndRun(t *testing.T) {
+	p, logs, exporter, provider := newTestPropagator()
+
+	// The request: its ID, span and tenant
+	ctx := context.WithValue(context.Background(), middleware.RequestIDKey, "req-1")
+	ctx = tenancy.WithTenant(ctx, &tenancy.Tenant{ID: "acme"})
+	ctx, request := provider.Tracer("test").Start(ctx, "GET /orders")
+	fields := p.Capture(ctx)
+	request.End()
+
+	assert.Equal(t, "req-1", fields[RequestIDKey])
+	assert.Equal(t, "acme", fields[TenantKey])
+	assert.Equal(t, "42", fields[UserKey])
+	assert.Contains(t, fields, traceParentKey)
+
+	// The worker
+	failed := errors.New("mail server down")
+	err := p.Run(context.Background(), fields, "job mail", func(ctx context.Context) error {
+		assert.Equal(t, "req-1", middleware.GetReqID(ctx))
+		tenant, ok := tenancy.FromContext(ctx)
+		require.True(t, ok)
+		assert.Equal(t, "acme", tenant.ID)
+		id, ok := UserID(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, "42", id)
+		assert.Equal(t, request.SpanContext().TraceID(), trace.SpanContextFromContext(ctx).TraceID())
+
+		logger.FromContext(ctx).Info("Sending mail")
+		nested := p.Capture(ctx)
+		assert.Equal(t, "req-1", nested[RequestIDKey], "work queued from the job stays correlated with the request")
+		assert.Equal(t, "42", nested[UserKey])
+		assert.Contains(t, nested[traceParentKey], request.SpanContext().TraceID().String())
+		return failed
+	})
+	assert.ErrorIs(t, err, failed)
+
+	entries := logs.FilterMessage("Sending mail").All()
+	require.Len(t, entries, 1)
+	tags := entries[0].ContextMap()
+	assert.Equal(t, "req-1", tags["request_id"])
+	assert.Equal(t, request.SpanContext().TraceID().String(), tags["trace_id"])
+	assert.Equal(t, "acme", tags["tenant"])
+	assert.Equal(t, "42", tags["user_id"])
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	job := spans[1]
+	assert.Equal(t, "job mail", job.Name)
+	assert.Equal(t, trace.SpanKindConsumer, job.SpanKind)
+	assert.Equal(t, request.SpanContext().SpanID(), job.Parent.SpanID())
+	attrs := map[string]string{}
+	for _, attr := range job.Attributes {
+		attrs[string(attr.Key)] = attr.Value.Emit()
+	}
+	assert.Equal(t, "acme", attrs["tenant.id"])
+	assert.Equal(t, observability.HashUserID("app-key", "42"), attrs["enduser.id"])
+	assert.Equal(t, "mail server down", job.Status.Description)
+}
+
+func TestRunOutsideARequest(t *testing.T) {
+	p, logs, exporter, _ := newTestPropagator()
+	p.IdentifyUsers(nil)
+
+	assert.Nil(t, p.Capture(context.Background()))
+
+	err := p.Run(context.Background(), nil, "job cleanup", func(ctx context.Context) error {
+		logger.FromContext(ctx).Info("Cleaning up")
+		return nil
+	})
+	require.NoError(t, err)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	assert.False(t, spans[0].Parent.IsValid(), "a trace of its own")
+	entries := logs.FilterMessage("Cleaning up").All()
+	require.Len(t, entries, 1)
+	assert.Equal(t, spans[0].SpanContext.TraceID().String(), entries[0].ContextMap()["trace_id"])
+
+	// A tenant that is gone is logged, and the work still runs
+	ran := false
+	p.Run(context.Background(), Fields{TenantKey: "gone"}, "job cleanup", func(ctx context.Context) error {
+		_, ok := tenancy.FromContext(ctx)
+		assert.False(t, ok)
+		ran = true
+		return nil
+	})
+	assert.True(t, ran)
+	assert.Equal(t, 1, logs.FilterMessage("Failed to restore the tenant of queued work").Len())
+}
+
+func TestCaptureRequestUsers(t *testing.T) {
+	p, _, _, _ := newTestPropagator()
+	p.IdentifyUsers(auth.UserID)
+
+	// Concurrent requests each capture the user authenticated for them
+	ada := auth.WithUser(context.Background(), &auth.User{ID: 1})
+	grace := auth.WithUser(context.Background(), &auth.User{ID: 2})
+	assert.Equal(t, "1", p.Capture(ada)[UserKey])
+	assert.Equal(t, "2", p.Capture(grace)[UserKey])
+	assert.NotContains(t, p.Capture(context.Background()), UserKey, "a guest")
+}
@@ -0,0 +1,289 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// AnonymizeConfig maps tables and columns to the strategies db:anonymize
+// replaces their values with, e.g.
+//
+//	tables:
+//	  users:
+//	    columns:
+//	      email: email
+//	      name: name
+//	      phone: phone
+//	      notes: "null"
+//	      password: "fixed:$2a$10$..."
+type AnonymizeConfig struct {
+	// ChunkSize is how many rows are updated per transaction
+	ChunkSize int `yaml:"chunk_size"`
+
+	// Seed makes the generated values repeatable; a random one is used
+	// when it is empty
+	Seed string `yaml:"seed"`
+
+	Tables map[string]AnonymizeTable `yaml:"tables"`
+}
+
+// AnonymizeTable lists the columns of a table to anonymize
+type AnonymizeTable struct {
+	// Key is the column rows are walked by; defaults to id
+	Key     string            `yaml:"key"`
+	Columns map[string]string `yaml:"columns"`
+}
+
+// AnonymizeResult reports how many rows of a table were rewritten
+type AnonymizeResult struct {
+	Table   string `json:"table"`
+	Rows    int64  `json:"rows"`
+	Columns int    `json:"columns"`
+}
+
+// defaultAnonymizeChunk bounds each transaction so large tables don't hold
+// long locks
+const defaultAnonymizeChunk = 1000
+
+// AnonymizeStrategies are the strategies a column can use, besides
+// "fixed:<value>" which sets every row to value
+var AnonymizeStrategies = []string{"email", "name", "first_name", "last_name", "username", "phone", "address", "city", "ip", "text", "null"}
+
+var (
+	firstNames = []string{"Ada", "Ben", "Chloe", "David", "Esther", "Felix", "Grace", "Hassan", "Imani", "James", "Kofi", "Lena", "Mei", "Noah", "Olivia", "Pedro", "Quinn", "Rosa", "Samir", "Tara", "Uma", "Victor", "Wanjiru", "Yusuf", "Zara"}
+	lastNames  = []string{"Anderson", "Banda", "Chen", "Diaz", "Evans", "Fischer", "Garcia", "Hughes", "Ito", "Jensen", "Kamau", "Lopez", "Mwangi", "Novak", "Okafor", "Patel", "Quist", "Rossi", "Smith", "Tanaka", "Usman", "Varga", "Walker", "Young", "Zulu"}
+	streets    = []string{"Acacia", "Birch", "Cedar", "Elm", "Highland", "Lake", "Maple", "Oak", "Park", "River", "Station", "Sunset"}
+	cities     = []string{"Springfield", "Riverton", "Lakeside", "Fairview", "Greenville", "Kingston", "Madison", "Oakridge", "Brookfield", "Westport"}
+	words      = []string{"lorem", "ipsum", "dolor", "sit", "amet", "consectetur", "adipiscing", "elit", "sed", "do", "eiusmod", "tempor", "incididunt", "ut", "labore", "et", "dolore", "magna", "aliqua"}
+)
+
+// LoadAnonymizeConfig reads and validates an anonymization config file
+func LoadAnonymizeConfig(path string) (*AnonymizeConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg AnonymizeConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// Validate checks every column names a known strategy, so nothing is
+// rewritten when the config has a mistake
+func (c *AnonymizeConfig) Validate() error {
+	if len(c.Tables) == 0 {
+		return fmt.Errorf("no tables to anonymize")
+	}
+	for _, table := range c.TableNames() {
+		if len(c.Tables[table].Columns) == 0 {
+			return fmt.Errorf("table %s lists no columns", table)
+		}
+		for column, strategy := range c.Tables[table].Columns {
+			if !validStrategy(strategy) {
+				return fmt.Errorf("unknown strategy %q for %s.%s (use one of %s or fixed:<value>)",
+					strategy, table, column, strings.Join(AnonymizeStrategies, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// TableNames returns the configured tables in order
+func (c *AnonymizeConfig) TableNames() []string {
+	names := make([]string, 0, len(c.Tables))
+	for table := range c.Tables {
+		names = append(names, table)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func validStrategy(strategy string) bool {
+	if strings.HasPrefix(strategy, "fixed:") {
+		return true
+	}
+	for _, s := range AnonymizeStrategies {
+		if s == strategy {
+			return true
+		}
+	}
+	return false
+}
+
+// Anonymize rewrites the configured columns of every configured table in
+// chunks, walking rows by key so each chunk is one short transaction.
+// Values are derived from the row's key, so unique columns such as email
+// stay unique, and NULLs stay NULL. progress is called after each chunk.
+func (m *Manager) Anonymize(ctx context.Context, cfg *AnonymizeConfig, progress func(table string, done, total int64)) ([]AnonymizeResult, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	seed := cfg.Seed
+	if seed == "" {
+		random := make([]byte, 16)
+		if _, err := rand.Read(random); err != nil {
+			return nil, err
+		}
+		seed = hex.EncodeToString(random)
+	}
+	chunk := cfg.ChunkSize
+	if chunk <= 0 {
+		chunk = defaultAnonymizeChunk
+	}
+
+	var results []AnonymizeResult
+	for _, table := range cfg.TableNames() {
+		result, err := m.anonymizeTable(ctx, table, cfg.Tables[table], seed, chunk, progress)
+		results = append(results, result)
+		if err != nil {
+			return results, fmt.Errorf("anonymize %s: %w", table, err)
+		}
+	}
+	return results, nil
+}
+
+func (m *Manager) anonymizeTable(ctx context.Context, table string, spec AnonymizeTable, seed string, chunk int, progress func(string, int64, int64)) (AnonymizeResult, error) {
+	result := AnonymizeResult{Table: table, Columns: len(spec.Columns)}
+	key := spec.Key
+	if key == "" {
+		key = "id"
+	}
+
+	migrator := m.db.Migrator()
+	if !migrator.HasTable(table) {
+		return result, fmt.Errorf("table %s does not exist", table)
+	}
+	columns := make([]string, 0, len(spec.Columns))
+	for column := range spec.Columns {
+		if !migrator.HasColumn(table, column) {
+			return result, fmt.Errorf("column %s.%s does not exist", table, column)
+		}
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	db := m.db.WithContext(ctx)
+	var total int64
+	if err := db.Table(table).Count(&total).Error; err != nil {
+		return result, err
+	}
+
+	var last interface{}
+	for {
+		query := db.Table(table).Order(m.quote(key)).Limit(chunk)
+		if last != nil {
+			query = query.Where(m.quote(key)+" > ?", last)
+		}
+		var keys []interface{}
+		if err := query.Pluck(key, &keys).Error; err != nil {
+			return result, err
+		}
+		if len(keys) == 0 {
+			return result, nil
+		}
+		for i, k := range keys {
+			if b, ok := k.([]byte); ok {
+				keys[i] = string(b)
+			}
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for _, k := range keys {
+				updates := make(map[string]interface{}, len(columns))
+				for _, column := range columns {
+					value := fakeValue(spec.Columns[column], seed, table, column, fmt.Sprint(k))
+					if value == nil {
+						updates[column] = nil
+						continue
+					}
+					quoted := m.quote(column)
+					updates[column] = gorm.Expr("CASE WHEN "+quoted+" IS NULL THEN NULL ELSE ? END", value)
+				}
+				if err := tx.Table(table).Where(m.quote(key)+" = ?", k).Updates(updates).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return result, err
+		}
+
+		result.Rows += int64(len(keys))
+		if progress != nil {
+			progress(table, result.Rows, max(total, result.Rows))
+		}
+		last = keys[len(keys)-1]
+		if len(keys) < chunk {
+			return result, nil
+		}
+	}
+}
+
+// fakeValue returns the replacement for one column of one row, derived from
+// the seed and the row's key; nil means NULL
+func fakeValue(strategy, seed, table, column, key string) interface{} {
+	if value, ok := strings.CutPrefix(strategy, "fixed:"); ok {
+		return value
+	}
+
+	sum := sha256.Sum256([]byte(seed + "\x00" + table + "\x00" + column + "\x00" + key))
+	n := binary.BigEndian.Uint64(sum[:8])
+	pick := func(list []string, salt uint64) string {
+		return list[(n>>salt)%uint64(len(list))]
+	}
+	// Keys become part of values that must stay unique
+	slug := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' {
+			return r
+		}
+		return -1
+	}, key)
+
+	switch strategy {
+	case "email":
+		return fmt.Sprintf("user%s@example.com", slug)
+	case "username":
+		return "user" + slug
+	case "first_name":
+		return pick(firstNames, 0)
+	case "last_name":
+		return pick(lastNames, 8)
+	case "name":
+		return pick(firstNames, 0) + " " + pick(lastNames, 8)
+	case "phone":
+		// 555-01xx numbers are reserved for fiction
+		return fmt.Sprintf("+1-%03d-555-01%02d", 200+n%800, (n>>16)%100)
+	case "address":
+		return fmt.Sprintf("%d %s Street", 1+n%999, pick(streets, 16))
+	case "city":
+		return pick(cities, 24)
+	case "ip":
+		// 192.0.2.0/24 is reserved for documentation
+		return fmt.Sprintf("192.0.2.%d", 1+n%254)
+	case "text":
+		count := 4 + int(n%8)
+		text := make([]string, count)
+		for i := range text {
+			text[i] = words[(n>>uint(i*4))%uint64(len(words))]
+		}
+		return strings.Join(text, " ")
+	default: // null
+		return nil
+	}
+}
@@ -0,0 +1,94 @@
+package database
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+type customer struct {
+	ID       uint
+	Email    string `gorm:"uniqueIndex"`
+	Name     string
+	Phone    *string
+	Notes    *string
+	Password string
+	Plan     string
+}
+
+func TestAnonymize(t *testing.T) {
+	m := newSQLiteManager(t, config.DatabaseConfig{})
+	require.NoError(t, m.GetDB().AutoMigrate(&customer{}))
+	phone, notes := "+254 700 000 001", "VIP, call before noon"
+	for i := 0; i < 25; i++ {
+		c := customer{Email: "real" + string(rune('a'+i)) + "@acme.io", Name: "Real Person", Password: "hash", Plan: "pro"}
+		if i%2 == 0 {
+			c.Phone, c.Notes = &phone, &notes
+		}
+		require.NoError(t, m.GetDB().Create(&c).Error)
+	}
+
+	cfg := &AnonymizeConfig{ChunkSize: 10, Seed: "staging", Tables: map[string]AnonymizeTable{
+		"customers": {Columns: map[string]string{"email": "email", "name": "name", "phone": "phone", "notes": "null", "password": "fixed:x"}},
+	}}
+	var progress []int64
+	results, err := m.Anonymize(context.Background(), cfg, func(table string, done, total int64) {
+		assert.Equal(t, "customers", table)
+		assert.Equal(t, int64(25), total)
+		progress = append(progress, done)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []AnonymizeResult{{Table: "customers", Rows: 25, Columns: 5}}, results)
+	assert.Equal(t, []int64{10, 20, 25}, progress, "updated in chunks")
+
+	var rows []customer
+	require.NoError(t, m.GetDB().Order("id").Find(&rows).Error)
+	emails := map[string]bool{}
+	for _, c := range rows {
+		assert.NotContains(t, c.Email, "acme.io")
+		assert.True(t, strings.HasSuffix(c.Email, "@example.com"), c.Email)
+		emails[c.Email] = true
+		assert.NotEqual(t, "Real Person", c.Name)
+		assert.Equal(t, "x", c.Password)
+		assert.Equal(t, "pro", c.Plan, "unlisted columns are kept")
+		assert.Nil(t, c.Notes)
+		if c.ID%2 == 1 {
+			require.NotNil(t, c.Phone)
+			assert.Contains(t, *c.Phone, "-555-01")
+		} else {
+			assert.Nil(t, c.Phone, "NULLs stay NULL")
+		}
+	}
+	assert.Len(t, emails, 25, "emails stay unique")
+
+	// The same seed gives the same values
+	_, err = m.Anonymize(context.Background(), cfg, nil)
+	require.NoError(t, err)
+	var again []customer
+	require.NoError(t, m.GetDB().Order("id").Find(&again).Error)
+	assert.Equal(t, rows, again)
+
+	cfg.Tables["customers"].Columns["ssn"] = "null"
+	_, err = m.Anonymize(context.Background(), cfg, nil)
+	assert.EqualError(t, err, "anonymize customers: column customers.ssn does not exist")
+}
+
+func TestLoadAnonymizeConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "anonymize.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("chunk_size: 500\ntables:\n  users:\n    key: uuid\n    columns:\n      email: email\n      notes: \"null\"\n"), 0644))
+	cfg, err := LoadAnonymizeConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, 500, cfg.ChunkSize)
+	assert.Equal(t, AnonymizeTable{Key: "uuid", Columns: map[string]string{"email": "email", "notes": "null"}}, cfg.Tables["users"])
+
+	require.NoError(t, os.WriteFile(path, []byte("tables:\n  users:\n    columns:\n      email: mail\n"), 0644))
+	_, err = LoadAnonymizeConfig(path)
+	assert.ErrorContains(t, err, `unknown strategy "mail" for users.email`)
+}
@@ -0,0 +1,524 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	raptor "github.com/mrhoseah/raptor/core"
+)
+
+// Builder renders fluent table definitions as DDL for one SQL dialect:
+//
+//	schema, err := database.NewBuilder(s)
+//	if err != nil {
+//		return err
+//	}
+//	return schema.Create("users", func(t *database.Table) {
+//		t.ID()
+//		t.String("email").Unique()
+//		t.Timestamps()
+//	})
+type Builder struct {
+	dialect dialect
+	exec    func(query string) error
+
+	// onDrop, when set, is told about every dropped table or column
+	onDrop func(table, column string)
+}
+
+// NewBuilder returns the builder of a migration's schema
+func NewBuilder(s raptor.Schema) (*Builder, error) {
+	if sb, ok := s.(interface{ Builder() *Builder }); ok {
+		return sb.Builder(), nil
+	}
+	return nil, fmt.Errorf("schema %T has no schema builder", s)
+}
+
+// Create creates a table
+func (b *Builder) Create(table string, fn func(*Table)) error {
+	t := &Table{name: table, create: true}
+	fn(t)
+	return b.run(b.createStatements(t))
+}
+
+// Table alters an existing table: added columns and indexes are created,
+// and drops and renames applied
+func (b *Builder) Table(table string, fn func(*Table)) error {
+	t := &Table{name: table}
+	fn(t)
+	for _, column := range t.dropColumns {
+		b.dropped(table, column)
+	}
+	return b.run(b.alterStatements(t))
+}
+
+// Drop drops a table
+func (b *Builder) Drop(table string) error {
+	b.dropped(table, "")
+	return b.run([]string{"DROP TABLE " + b.dialect.quote(table)})
+}
+
+// DropIfExists drops a table if it exists
+func (b *Builder) DropIfExists(table string) error {
+	b.dropped(table, "")
+	return b.run([]string{"DROP TABLE IF EXISTS " + b.dialect.quote(table)})
+}
+
+// Rename renames a table
+func (b *Builder) Rename(from, to string) error {
+	switch b.dialect.name {
+	case "mysql":
+		return b.run([]string{fmt.Sprintf("RENAME TABLE %s TO %s", b.dialect.quote(from), b.dialect.quote(to))})
+	case "sqlserver":
+		return b.run([]string{fmt.Sprintf("EXEC sp_rename %s, %s", b.dialect.literal(from), b.dialect.literal(to))})
+	}
+	return b.run([]string{fmt.Sprintf("ALTER TABLE %s RENAME TO %s", b.dialect.quote(from), b.dialect.quote(to))})
+}
+
+func (b *Builder) dropped(table, column string) {
+	if b.onDrop != nil {
+		b.onDrop(table, column)
+	}
+}
+
+func (b *Builder) run(statements []string) error {
+	for _, stmt := range statements {
+		if err := b.exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Builder) createStatements(t *Table) []string {
+	d := b.dialect
+	var defs, primary []string
+	for _, c := range t.columns {
+		defs = append(defs, d.column(c, false))
+		if c.primary {
+			primary = append(primary, d.quote(c.name))
+		}
+	}
+	if len(primary) > 0 {
+		defs = append(defs, "PRIMARY KEY ("+strings.Join(primary, ", ")+")")
+	}
+	for _, c := range t.columns {
+		if c.foreign != nil {
+			defs = append(defs, d.foreignKey(t.name, c))
+		}
+	}
+
+	stmt := fmt.Sprintf("CREATE TABLE %s (\n  %s\n)", d.quote(t.name), strings.Join(defs, ",\n  "))
+	if d.name == "mysql" {
+		stmt += " ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+	}
+	return append([]string{stmt}, b.indexStatements(t)...)
+}
+
+func (b *Builder) alterStatements(t *Table) []string {
+	d := b.dialect
+	table := d.quote(t.name)
+
+	var stmts []string
+	for _, r := range t.renames {
+		if d.name == "sqlserver" {
+			stmts = append(stmts, fmt.Sprintf("EXEC sp_rename %s, %s, 'COLUMN'", d.literal(t.name+"."+r[0]), d.literal(r[1])))
+			continue
+		}
+		stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s", table, d.quote(r[0]), d.quote(r[1])))
+	}
+	for _, name := range t.dropIndexes {
+		if d.name == "mysql" || d.name == "sqlserver" {
+			stmts = append(stmts, fmt.Sprintf("DROP INDEX %s ON %s", d.quote(name), table))
+		} else {
+			stmts = append(stmts, "DROP INDEX "+d.quote(name))
+		}
+	}
+	for _, name := range t.dropColumns {
+		stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", table, d.quote(name)))
+	}
+
+	// SQLite can't add constraints to existing tables, so its foreign keys
+	// go inline on the new column
+	inline := d.name == "sqlite"
+	add := "ADD COLUMN"
+	if d.name == "sqlserver" {
+		add = "ADD"
+	}
+	for _, c := range t.columns {
+		stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s %s %s", table, add, d.column(c, inline)))
+	}
+	if !inline {
+		for _, c := range t.columns {
+			if c.foreign != nil {
+				stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s ADD %s", table, d.foreignKey(t.name, c)))
+			}
+		}
+	}
+	return append(stmts, b.indexStatements(t)...)
+}
+
+func (b *Builder) indexStatements(t *Table) []string {
+	d := b.dialect
+	var stmts []string
+	for _, idx := range t.allIndexes() {
+		columns := make([]string, len(idx.columns))
+		for i, c := range idx.columns {
+			columns[i] = d.quote(c)
+		}
+		kind := "INDEX"
+		if idx.unique {
+			kind = "UNIQUE INDEX"
+		}
+		stmts = append(stmts, fmt.Sprintf("CREATE %s %s ON %s (%s)", kind, d.quote(idx.name), d.quote(t.name), strings.Join(columns, ", ")))
+	}
+	return stmts
+}
+
+// Table collects column and index definitions for Create and Table
+type Table struct {
+	name    string
+	create  bool
+	columns []*Column
+	indexes []tableIndex
+
+	dropColumns []string
+	dropIndexes []string
+	renames     [][2]string
+}
+
+type tableIndex struct {
+	name    string
+	columns []string
+	unique  bool
+}
+
+func (t *Table) add(name, kind string) *Column {
+	c := &Column{name: name, kind: kind}
+	t.columns = append(t.columns, c)
+	return c
+}
+
+// ID adds an auto-incrementing big integer primary key named id
+func (t *Table) ID() *Column {
+	return t.add("id", "id")
+}
+
+// String adds a VARCHAR column, 255 long unless a length is given
+func (t *Table) String(name string, length ...int) *Column {
+	c := t.add(name, "string")
+	c.length = 255
+	if len(length) > 0 {
+		c.length = length[0]
+	}
+	return c
+}
+
+// Text adds a TEXT column
+func (t *Table) Text(name string) *Column { return t.add(name, "text") }
+
+// Integer adds an INTEGER column
+func (t *Table) Integer(name string) *Column { return t.add(name, "integer") }
+
+// BigInteger adds a BIGINT column
+func (t *Table) BigInteger(name string) *Column { return t.add(name, "bigInteger") }
+
+// Boolean adds a boolean column
+func (t *Table) Boolean(name string) *Column { return t.add(name, "boolean") }
+
+// Decimal adds a fixed-point column
+func (t *Table) Decimal(name string, precision, scale int) *Column {
+	c := t.add(name, "decimal")
+	c.precision, c.scale = precision, scale
+	return c
+}
+
+// Float adds a double precision column
+func (t *Table) Float(name string) *Column { return t.add(name, "float") }
+
+// Timestamp adds a timestamp column
+func (t *Table) Timestamp(name string) *Column { return t.add(name, "timestamp") }
+
+// Date adds a DATE column
+func (t *Table) Date(name string) *Column { return t.add(name, "date") }
+
+// JSON adds a JSON column (JSONB on Postgres, TEXT on SQLite)
+func (t *Table) JSON(name string) *Column { return t.add(name, "json") }
+
+// UUID adds a UUID column (CHAR(36) on MySQL, TEXT on SQLite)
+func (t *Table) UUID(name string) *Column { return t.add(name, "uuid") }
+
+// Binary adds a binary column
+func (t *Table) Binary(name string) *Column { return t.add(name, "binary") }
+
+// ForeignID adds a column matching the type of ID, for use with Constrained
+func (t *Table) ForeignID(name string) *Column { return t.add(name, "foreignId") }
+
+// Timestamps adds nullable created_at and updated_at columns
+func (t *Table) Timestamps() {
+	t.Timestamp("created_at").Nullable()
+	t.Timestamp("updated_at").Nullable()
+}
+
+// SoftDeletes adds the nullable, indexed deleted_at column gorm.DeletedAt uses
+func (t *Table) SoftDeletes() {
+	t.Timestamp("deleted_at").Nullable().Index()
+}
+
+// Index adds an index over one or more columns, named like GORM's
+// idx_<table>_<columns>
+func (t *Table) Index(columns ...string) {
+	t.indexes = append(t.indexes, tableIndex{name: t.indexName(columns), columns: columns})
+}
+
+// Unique adds a unique index over one or more columns
+func (t *Table) Unique(columns ...string) {
+	t.indexes = append(t.indexes, tableIndex{name: t.indexName(columns), columns: columns, unique: true})
+}
+
+// DropColumn drops a column
+func (t *Table) DropColumn(name string) {
+	t.dropColumns = append(t.dropColumns, name)
+}
+
+// DropIndex drops an index by name
+func (t *Table) DropIndex(name string) {
+	t.dropIndexes = append(t.dropIndexes, name)
+}
+
+// RenameColumn renames a column
+func (t *Table) RenameColumn(from, to string) {
+	t.renames = append(t.renames, [2]string{from, to})
+}
+
+func (t *Table) indexName(columns []string) string {
+	return "idx_" + t.name + "_" + strings.Join(columns, "_")
+}
+
+// allIndexes returns table indexes followed by single-column ones declared
+// with Column.Index
+func (t *Table) allIndexes() []tableIndex {
+	indexes := append([]tableIndex(nil), t.indexes...)
+	for _, c := range t.columns {
+		if c.index {
+			indexes = append(indexes, tableIndex{name: t.indexName([]string{c.name}), columns: []string{c.name}})
+		}
+	}
+	return indexes
+}
+
+// Column is a column definition. Columns are NOT NULL unless Nullable.
+type Column struct {
+	name      string
+	kind      string
+	length    int
+	precision int
+	scale     int
+
+	nullable   bool
+	unique     bool
+	index      bool
+	unsigned   bool
+	primary    bool
+	hasDefault bool
+	value      interface{}
+	foreign    *foreignRef
+}
+
+type foreignRef struct {
+	table, column      string
+	onDelete, onUpdate string
+}
+
+// Nullable allows NULL values
+func (c *Column) Nullable() *Column { c.nullable = true; return c }
+
+// Unique adds a UNIQUE constraint
+func (c *Column) Unique() *Column { c.unique = true; return c }
+
+// Index adds an index on the column
+func (c *Column) Index() *Column { c.index = true; return c }
+
+// Unsigned makes a numeric column unsigned on MySQL; other dialects ignore it
+func (c *Column) Unsigned() *Column { c.unsigned = true; return c }
+
+// Primary makes the column (part of) the primary key
+func (c *Column) Primary() *Column { c.primary = true; return c }
+
+// Default sets the column default. Strings are quoted; wrap SQL
+// expressions in Raw, e.g. Raw("CURRENT_TIMESTAMP").
+func (c *Column) Default(value interface{}) *Column {
+	c.hasDefault, c.value = true, value
+	return c
+}
+
+// Constrained adds a foreign key to the id column of table
+func (c *Column) Constrained(table string) *Column {
+	return c.References(table, "id")
+}
+
+// References adds a foreign key to table.column
+func (c *Column) References(table, column string) *Column {
+	c.foreign = &foreignRef{table: table, column: column}
+	return c
+}
+
+// OnDelete sets the foreign key's ON DELETE action, e.g. "cascade"
+func (c *Column) OnDelete(action string) *Column {
+	if c.foreign != nil {
+		c.foreign.onDelete = strings.ToUpper(action)
+	}
+	return c
+}
+
+// OnUpdate sets the foreign key's ON UPDATE action
+func (c *Column) OnUpdate(action string) *Column {
+	if c.foreign != nil {
+		c.foreign.onUpdate = strings.ToUpper(action)
+	}
+	return c
+}
+
+// Raw is a default value rendered as written
+type Raw string
+
+// dialect holds how one database spells identifiers, types and defaults
+type dialect struct {
+	name  string
+	types map[string]string
+	id    string
+}
+
+var (
+	postgresDialect = dialect{
+		name: "postgres",
+		id:   "BIGSERIAL PRIMARY KEY",
+		types: map[string]string{
+			"string": "VARCHAR(%d)", "text": "TEXT", "integer": "INTEGER", "bigInteger": "BIGINT",
+			"boolean": "BOOLEAN", "decimal": "DECIMAL(%d, %d)", "float": "DOUBLE PRECISION",
+			"timestamp": "TIMESTAMPTZ", "date": "DATE", "json": "JSONB", "uuid": "UUID",
+			"binary": "BYTEA", "foreignId": "BIGINT",
+		},
+	}
+	mysqlDialect = dialect{
+		name: "mysql",
+		id:   "BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY",
+		types: map[string]string{
+			"string": "VARCHAR(%d)", "text": "TEXT", "integer": "INT", "bigInteger": "BIGINT",
+			"boolean": "TINYINT(1)", "decimal": "DECIMAL(%d, %d)", "float": "DOUBLE",
+			"timestamp": "DATETIME(3)", "date": "DATE", "json": "JSON", "uuid": "CHAR(36)",
+			"binary": "LONGBLOB", "foreignId": "BIGINT UNSIGNED",
+		},
+	}
+	sqliteDialect = dialect{
+		name: "sqlite",
+		id:   "INTEGER PRIMARY KEY AUTOINCREMENT",
+		types: map[string]string{
+			"string": "VARCHAR(%d)", "text": "TEXT", "integer": "INTEGER", "bigInteger": "INTEGER",
+			"boolean": "NUMERIC", "decimal": "NUMERIC(%d, %d)", "float": "REAL",
+			"timestamp": "DATETIME", "date": "DATE", "json": "TEXT", "uuid": "TEXT",
+			"binary": "BLOB", "foreignId": "INTEGER",
+		},
+	}
+
+	sqlserverDialect = dialect{
+		name: "sqlserver",
+		id:   "BIGINT IDENTITY(1,1) PRIMARY KEY",
+		types: map[string]string{
+			"string": "NVARCHAR(%d)", "text": "NVARCHAR(MAX)", "integer": "INT", "bigInteger": "BIGINT",
+			"boolean": "BIT", "decimal": "DECIMAL(%d, %d)", "float": "FLOAT",
+			"timestamp": "DATETIME2", "date": "DATE", "json": "NVARCHAR(MAX)", "uuid": "UNIQUEIDENTIFIER",
+			"binary": "VARBINARY(MAX)", "foreignId": "BIGINT",
+		},
+	}
+
+	// genericDialect is used when the driver is unknown
+	genericDialect = dialect{name: "generic", id: postgresDialect.id, types: postgresDialect.types}
+)
+
+func (d dialect) quote(name string) string {
+	switch d.name {
+	case "mysql":
+		return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+	case "sqlserver":
+		return "[" + strings.ReplaceAll(name, "]", "]]") + "]"
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func (d dialect) columnType(c *Column) string {
+	switch c.kind {
+	case "string":
+		return fmt.Sprintf(d.types[c.kind], c.length)
+	case "decimal":
+		return fmt.Sprintf(d.types[c.kind], c.precision, c.scale)
+	}
+	typ := d.types[c.kind]
+	if c.unsigned && d.name == "mysql" && !strings.HasSuffix(typ, "UNSIGNED") {
+		typ += " UNSIGNED"
+	}
+	return typ
+}
+
+// column renders a column definition; inlineForeign adds a column-level
+// REFERENCES clause instead of leaving the key to a table constraint
+func (d dialect) column(c *Column, inlineForeign bool) string {
+	if c.kind == "id" {
+		return d.quote(c.name) + " " + d.id
+	}
+
+	def := d.quote(c.name) + " " + d.columnType(c)
+	if !c.nullable && !c.primary {
+		def += " NOT NULL"
+	}
+	if c.hasDefault {
+		def += " DEFAULT " + d.literal(c.value)
+	}
+	if c.unique {
+		def += " UNIQUE"
+	}
+	if inlineForeign && c.foreign != nil {
+		def += " REFERENCES " + d.references(c.foreign)
+	}
+	return def
+}
+
+func (d dialect) foreignKey(table string, c *Column) string {
+	return fmt.Sprintf("CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s",
+		d.quote("fk_"+table+"_"+c.name), d.quote(c.name), d.references(c.foreign))
+}
+
+func (d dialect) references(f *foreignRef) string {
+	ref := fmt.Sprintf("%s (%s)", d.quote(f.table), d.quote(f.column))
+	if f.onDelete != "" {
+		ref += " ON DELETE " + f.onDelete
+	}
+	if f.onUpdate != "" {
+		ref += " ON UPDATE " + f.onUpdate
+	}
+	return ref
+}
+
+func (d dialect) literal(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case Raw:
+		return string(v)
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	case bool:
+		if d.name == "postgres" || d.name == "generic" {
+			if v {
+				return "TRUE"
+			}
+			return "FALSE"
+		}
+		if v {
+			return "1"
+		}
+		return "0"
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
@@ -0,0 +1,151 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+// pretendBuilder returns a builder for driver that collects its statements
+func pretendBuilder(driver string) (*Builder, *pretender) {
+	s, p := schemaFor(driver, nil)
+	p.pretend = true
+	return s.Builder(), p
+}
+
+func createPosts(t *Table) {
+	t.ID()
+	t.String("title", 120)
+	t.Boolean("published").Default(false)
+	t.JSON("meta").Nullable()
+	t.ForeignID("user_id").Constrained("users").OnDelete("cascade")
+	t.Timestamps()
+	t.SoftDeletes()
+	t.Unique("user_id", "title")
+}
+
+func TestBuilderCreateDialects(t *testing.T) {
+	b, p := pretendBuilder("postgres")
+	require.NoError(t, b.Create("posts", createPosts))
+	assert.Equal(t, []string{
+		`CREATE TABLE "posts" (
+  "id" BIGSERIAL PRIMARY KEY,
+  "title" VARCHAR(120) NOT NULL,
+  "published" BOOLEAN NOT NULL DEFAULT FALSE,
+  "meta" JSONB,
+  "user_id" BIGINT NOT NULL,
+  "created_at" TIMESTAMPTZ,
+  "updated_at" TIMESTAMPTZ,
+  "deleted_at" TIMESTAMPTZ,
+  CONSTRAINT "fk_posts_user_id" FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE
+)`,
+		`CREATE UNIQUE INDEX "idx_posts_user_id_title" ON "posts" ("user_id", "title")`,
+		`CREATE INDEX "idx_posts_deleted_at" ON "posts" ("deleted_at")`,
+	}, p.queries)
+
+	b, p = pretendBuilder("mysql")
+	require.NoError(t, b.Create("posts", createPosts))
+	assert.Contains(t, p.queries[0], "`id` BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY")
+	assert.Contains(t, p.queries[0], "`published` TINYINT(1) NOT NULL DEFAULT 0")
+	assert.Contains(t, p.queries[0], "`user_id` BIGINT UNSIGNED NOT NULL")
+	assert.Contains(t, p.queries[0], "`created_at` DATETIME(3)")
+	assert.Contains(t, p.queries[0], ") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4")
+
+	b, p = pretendBuilder("sqlite")
+	require.NoError(t, b.Create("posts", createPosts))
+	assert.Contains(t, p.queries[0], `"id" INTEGER PRIMARY KEY AUTOINCREMENT`)
+	assert.Contains(t, p.queries[0], `"meta" TEXT`)
+
+	b, p = pretendBuilder("sqlserver")
+	require.NoError(t, b.Create("posts", createPosts))
+	assert.Contains(t, p.queries[0], `[id] BIGINT IDENTITY(1,1) PRIMARY KEY`)
+	assert.Contains(t, p.queries[0], `[title] NVARCHAR(120) NOT NULL`)
+	assert.Contains(t, p.queries[0], `[published] BIT NOT NULL DEFAULT 0`)
+	assert.Contains(t, p.queries[0], `[created_at] DATETIME2`)
+}
+
+func TestBuilderAlterDialects(t *testing.T) {
+	alter := func(t *Table) {
+		t.RenameColumn("name", "full_name")
+		t.ForeignID("team_id").Nullable().Constrained("teams")
+		t.DropIndex("idx_users_code")
+		t.DropColumn("legacy")
+	}
+
+	b, p := pretendBuilder("postgres")
+	require.NoError(t, b.Table("users", alter))
+	assert.Equal(t, []string{
+		`ALTER TABLE "users" RENAME COLUMN "name" TO "full_name"`,
+		`DROP INDEX "idx_users_code"`,
+		`ALTER TABLE "users" DROP COLUMN "legacy"`,
+		`ALTER TABLE "users" ADD COLUMN "team_id" BIGINT`,
+		`ALTER TABLE "users" ADD CONSTRAINT "fk_users_team_id" FOREIGN KEY ("team_id") REFERENCES "teams" ("id")`,
+	}, p.queries)
+
+	b, p = pretendBuilder("mysql")
+	require.NoError(t, b.Table("users", alter))
+	assert.Equal(t, "DROP INDEX `idx_users_code` ON `users`", p.queries[1])
+
+	b, p = pretendBuilder("sqlite")
+	require.NoError(t, b.Table("users", alter))
+	assert.Equal(t, `ALTER TABLE "users" ADD COLUMN "team_id" INTEGER REFERENCES "teams" ("id")`, p.queries[3])
+	assert.Len(t, p.queries, 4)
+
+	b, p = pretendBuilder("sqlserver")
+	require.NoError(t, b.Table("users", alter))
+	assert.Equal(t, []string{
+		`EXEC sp_rename 'users.name', 'full_name', 'COLUMN'`,
+		`DROP INDEX [idx_users_code] ON [users]`,
+		`ALTER TABLE [users] DROP COLUMN [legacy]`,
+		`ALTER TABLE [users] ADD [team_id] BIGINT`,
+		`ALTER TABLE [users] ADD CONSTRAINT [fk_users_team_id] FOREIGN KEY ([team_id]) REFERENCES [teams] ([id])`,
+	}, p.queries)
+
+	b, p = pretendBuilder("mysql")
+	require.NoError(t, b.Rename("users", "members"))
+	assert.Equal(t, []string{"RENAME TABLE `users` TO `members`"}, p.queries)
+
+	b, p = pretendBuilder("sqlserver")
+	require.NoError(t, b.Rename("users", "members"))
+	assert.Equal(t, []string{"EXEC sp_rename 'users', 'members'"}, p.queries)
+}
+
+func TestBuilderRunsOnSQLite(t *testing.T) {
+	m := newSQLiteManager(t, config.DatabaseConfig{})
+	sqlDB, err := m.GetDB().DB()
+	require.NoError(t, err)
+	b := SchemaFor("sqlite", sqlDB).Builder()
+
+	require.NoError(t, b.Create("users", func(t *Table) {
+		t.ID()
+		t.String("email").Unique()
+		t.Timestamps()
+	}))
+	require.NoError(t, b.Create("posts", createPosts))
+	require.NoError(t, b.Table("posts", func(t *Table) {
+		t.Integer("views").Default(0)
+		t.Index("views")
+	}))
+
+	migrator := m.GetDB().Migrator()
+	assert.True(t, migrator.HasColumn("posts", "views"))
+	assert.True(t, migrator.HasIndex("posts", "idx_posts_user_id_title"))
+	assert.True(t, migrator.HasIndex("posts", "idx_posts_views"))
+	require.NoError(t, m.GetDB().Exec(`INSERT INTO posts (title, user_id) VALUES ('hello', 1)`).Error)
+
+	require.NoError(t, b.DropIfExists("posts"))
+	assert.False(t, migrator.HasTable("posts"))
+}
+
+func TestRecordingSchemaSeesBuilderDrops(t *testing.T) {
+	rec := &recordingSchema{}
+	schema, err := NewBuilder(rec)
+	require.NoError(t, err)
+
+	require.NoError(t, schema.Table("users", func(t *Table) { t.DropColumn("bio") }))
+	require.NoError(t, schema.DropIfExists("posts"))
+	assert.Equal(t, []drop{{table: "users", column: "bio"}, {table: "posts"}}, rec.drops)
+}
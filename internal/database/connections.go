@@ -0,0 +1,150 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	raptor "github.com/mrhoseah/raptor/core"
+)
+
+// DefaultConnection names the primary database
+const DefaultConnection = "default"
+
+// ConnectionNames returns the default connection followed by the
+// configured named connections, sorted
+func ConnectionNames(cfg *config.DatabaseConfig) []string {
+	names := make([]string, 0, len(cfg.Connections))
+	for name := range cfg.Connections {
+		if name != DefaultConnection {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return append([]string{DefaultConnection}, names...)
+}
+
+// ConnectionConfig returns the settings of a named connection, filling
+// empty fields from the primary. Replicas and pool settings other than the
+// limits are not inherited, nor is the port when the driver differs.
+func ConnectionConfig(cfg *config.DatabaseConfig, name string) (*config.DatabaseConfig, error) {
+	if name == "" || name == DefaultConnection {
+		return cfg, nil
+	}
+	conn, ok := cfg.Connections[name]
+	if !ok {
+		return nil, fmt.Errorf("database connection %q is not configured", name)
+	}
+
+	// A connection to another kind of server doesn't share the primary's port
+	driver := firstNonEmpty(conn.Driver, cfg.Driver)
+	port := firstNonZero(conn.Port, cfg.Port)
+	if conn.Port == 0 && driver != cfg.Driver {
+		port = DefaultPort(driver)
+	}
+
+	return &config.DatabaseConfig{
+		Driver:             driver,
+		Host:               firstNonEmpty(conn.Host, cfg.Host),
+		Port:               port,
+		Database:           firstNonEmpty(conn.Database, cfg.Database),
+		Username:           firstNonEmpty(conn.Username, cfg.Username),
+		Password:           firstNonEmpty(conn.Password, cfg.Password),
+		SSLMode:            firstNonEmpty(conn.SSLMode, cfg.SSLMode),
+		Schema:             conn.Schema,
+		Charset:            cfg.Charset,
+		MaxOpen:            cfg.MaxOpen,
+		MaxIdle:            cfg.MaxIdle,
+		MaxLife:            cfg.MaxLife,
+		SlowQueryThreshold: cfg.SlowQueryThreshold,
+		QueryLogSize:       cfg.QueryLogSize,
+		QueryTimeout:       firstNonZero(conn.QueryTimeout, cfg.QueryTimeout),
+	}, nil
+}
+
+// NewConnection opens a named connection
+func NewConnection(cfg *config.DatabaseConfig, name string) (*Manager, error) {
+	connCfg, err := ConnectionConfig(cfg, name)
+	if err != nil {
+		return nil, err
+	}
+	m, err := New(connCfg)
+	if err != nil {
+		return nil, fmt.Errorf("connection %s: %w", name, err)
+	}
+	if name != "" {
+		m.name = name
+	}
+	return m, nil
+}
+
+// Name returns the connection's name
+func (m *Manager) Name() string {
+	return firstNonEmpty(m.name, DefaultConnection)
+}
+
+// ConnectionMigration is implemented by migrations that run on a named
+// connection instead of the default one:
+//
+//	func (m *CreateEventsTable) Connection() string { return "analytics" }
+type ConnectionMigration interface {
+	raptor.Migration
+	Connection() string
+}
+
+// MigrationConnection returns the connection a migration targets
+func MigrationConnection(migration raptor.Migration) string {
+	if cm, ok := migration.(ConnectionMigration); ok && cm.Connection() != "" {
+		return cm.Connection()
+	}
+	return DefaultConnection
+}
+
+// MigrationsTable returns the table recording a connection's migrations.
+// Each connection has its own, so connections sharing a database don't see
+// each other's history.
+func MigrationsTable(connection string) string {
+	if connection == "" || connection == DefaultConnection {
+		return "migrations"
+	}
+	return "migrations_" + connection
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   []raptor.Migration
+)
+
+// RegisterMigration makes migrations known to every Migrator. Generated
+// migrations call it from init, so they run in file (timestamp) order.
+func RegisterMigration(migrations ...raptor.Migration) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	for _, m := range migrations {
+		replaced := false
+		for i, existing := range registry {
+			if existing.Name() == m.Name() {
+				registry[i], replaced = m, true
+			}
+		}
+		if !replaced {
+			registry = append(registry, m)
+		}
+	}
+}
+
+// registeredMigrations returns the registered migrations targeting a
+// connection in registration order
+func registeredMigrations(connection string) []raptor.Migration {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	var migrations []raptor.Migration
+	for _, m := range registry {
+		if MigrationConnection(m) == connection {
+			migrations = append(migrations, m)
+		}
+	}
+	return migrations
+}
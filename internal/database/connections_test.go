@@ -0,0 +1,96 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	raptor "github.com/mrhoseah/raptor/core"
+)
+
+type tableMigration struct {
+	name, table, connection string
+}
+
+func (m tableMigration) Name() string       { return m.name }
+func (m tableMigration) Connection() string { return m.connection }
+
+func (m tableMigration) Up(s raptor.Schema) error {
+	return s.CreateTable(m.table, []string{"id", "name"})
+}
+
+func (m tableMigration) Down(s raptor.Schema) error {
+	return s.DropTable(m.table)
+}
+
+func TestConnectionConfigInherits(t *testing.T) {
+	cfg := &config.DatabaseConfig{
+		Driver: "postgres", Host: "db", Port: 5432, Database: "app", Username: "app", MaxOpen: 7, QueryTimeout: time.Second,
+		Connections: map[string]config.ConnectionConfig{"analytics": {Host: "warehouse", Database: "events"}},
+	}
+
+	conn, err := ConnectionConfig(cfg, "analytics")
+	require.NoError(t, err)
+	assert.Equal(t, "postgres", conn.Driver)
+	assert.Equal(t, "warehouse", conn.Host)
+	assert.Equal(t, "events", conn.Database)
+	assert.Equal(t, "app", conn.Username)
+	assert.Equal(t, 7, conn.MaxOpen)
+	assert.Equal(t, time.Second, conn.QueryTimeout)
+
+	// Another driver's server isn't on the primary's port
+	cfg.Connections["clicks"] = config.ConnectionConfig{Driver: "clickhouse", QueryTimeout: time.Minute}
+	conn, err = ConnectionConfig(cfg, "clicks")
+	require.NoError(t, err)
+	assert.Equal(t, 9000, conn.Port)
+	assert.Equal(t, time.Minute, conn.QueryTimeout)
+
+	_, err = ConnectionConfig(cfg, "missing")
+	assert.Error(t, err)
+	assert.Equal(t, []string{"default", "analytics", "clicks"}, ConnectionNames(cfg))
+}
+
+func TestMigrationsTargetConnections(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.DatabaseConfig{
+		Driver:      "sqlite",
+		Database:    filepath.Join(dir, "app.db"),
+		Connections: map[string]config.ConnectionConfig{"analytics": {Database: filepath.Join(dir, "analytics.db")}},
+	}
+	RegisterMigration(
+		tableMigration{name: "test_create_accounts", table: "accounts"},
+		tableMigration{name: "test_create_events", table: "events", connection: "analytics"},
+	)
+
+	primary, err := NewConnection(cfg, DefaultConnection)
+	require.NoError(t, err)
+	defer primary.Close()
+	analytics, err := NewConnection(cfg, "analytics")
+	require.NoError(t, err)
+	defer analytics.Close()
+	assert.Equal(t, "analytics", analytics.Name())
+
+	result := analytics.Migrator("migrations").Migrate()
+	assert.Equal(t, []string{"test_create_events"}, result.Executed)
+	assert.True(t, analytics.GetDB().Migrator().HasTable("events"))
+	assert.True(t, analytics.GetDB().Migrator().HasTable("migrations_analytics"))
+	assert.False(t, primary.GetDB().Migrator().HasTable("migrations"))
+
+	status := primary.Migrator("migrations").Status()
+	require.Len(t, status, 1)
+	assert.Equal(t, "test_create_accounts", status[0].Migration)
+	assert.Equal(t, "pending", status[0].Status)
+
+	result = primary.Migrator("migrations").Migrate()
+	assert.Equal(t, []string{"test_create_accounts"}, result.Executed)
+	assert.False(t, primary.GetDB().Migrator().HasTable("events"))
+
+	result = analytics.Migrator("migrations").Rollback()
+	assert.Equal(t, []string{"test_create_events"}, result.RolledBack)
+	assert.False(t, analytics.GetDB().Migrator().HasTable("events"))
+	assert.True(t, primary.GetDB().Migrator().HasTable("accounts"))
+}
@@ -0,0 +1,181 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// IndexSpec is an index declared with a gorm index or uniqueIndex tag
+type IndexSpec struct {
+	Table   string
+	Name    string
+	Columns []string
+	Unique  bool
+}
+
+// ForeignKeySpec is a foreign key implied by a relationship field
+type ForeignKeySpec struct {
+	Table     string
+	Name      string
+	Column    string
+	RefTable  string
+	RefColumn string
+}
+
+// Indexes returns the model's tagged indexes, merging fields that share an
+// index name into one composite index ordered by priority. Names follow
+// GORM's defaults, so they match what AutoMigrate would create.
+func (s *ModelSource) Indexes(spec *ModelSpec) ([]IndexSpec, error) {
+	type column struct {
+		name     string
+		priority int
+	}
+	var order []string
+	columns := map[string][]column{}
+	unique := map[string]bool{}
+
+	for _, f := range spec.Fields {
+		if f.Ignored() {
+			continue
+		}
+		for _, value := range strings.Split(f.rawTag, ";") {
+			parts := strings.Split(value, ":")
+			key := strings.TrimSpace(strings.ToUpper(parts[0]))
+			if key != "INDEX" && key != "UNIQUEINDEX" {
+				continue
+			}
+
+			tag := strings.Join(parts[1:], ":")
+			name, options, _ := strings.Cut(tag, ",")
+			settings := schema.ParseTagSetting(options, ",")
+			if name == "" {
+				sub := f.Name
+				if composite, ok := settings["COMPOSITE"]; ok {
+					if composite == "" || composite == "COMPOSITE" {
+						return nil, fmt.Errorf("the composite tag of %s.%s cannot be empty", spec.Name, f.Name)
+					}
+					sub = composite
+				}
+				name = naming.IndexName(spec.Table, sub)
+			}
+
+			priority, err := strconv.Atoi(settings["PRIORITY"])
+			if err != nil {
+				priority = 10
+			}
+
+			if _, ok := columns[name]; !ok {
+				order = append(order, name)
+			}
+			columns[name] = append(columns[name], column{name: f.Column, priority: priority})
+			if key == "UNIQUEINDEX" || settings["UNIQUE"] != "" || strings.EqualFold(settings["CLASS"], "UNIQUE") {
+				unique[name] = true
+			}
+		}
+	}
+
+	indexes := make([]IndexSpec, 0, len(order))
+	for _, name := range order {
+		cols := columns[name]
+		sort.SliceStable(cols, func(i, j int) bool { return cols[i].priority < cols[j].priority })
+		idx := IndexSpec{Table: spec.Table, Name: name, Unique: unique[name]}
+		for _, c := range cols {
+			idx.Columns = append(idx.Columns, c.name)
+		}
+		indexes = append(indexes, idx)
+	}
+	return indexes, nil
+}
+
+// ForeignKeys returns the constraints implied by the model's relationship
+// fields: belongs-to keys on the model's own table and has-one/has-many keys
+// on the related tables. Fields tagged constraint:- and many2many fields are
+// skipped.
+func (s *ModelSource) ForeignKeys(spec *ModelSpec) ([]ForeignKeySpec, error) {
+	var keys []ForeignKeySpec
+	for _, f := range spec.Fields {
+		related := f.BaseType()
+		if f.Ignored() || !s.Has(related) || f.Tag["CONSTRAINT"] == "-" {
+			continue
+		}
+		if _, ok := f.Tag["MANY2MANY"]; ok {
+			continue
+		}
+
+		other, err := s.Model(related)
+		if err != nil {
+			return nil, err
+		}
+		name := naming.RelationshipFKName(schema.Relationship{Name: f.Name, Schema: &schema.Schema{Table: spec.Table}})
+		if tagged, _, _ := strings.Cut(f.Tag["CONSTRAINT"], ","); tagged != "" && !strings.Contains(tagged, ":") {
+			name = tagged
+		}
+
+		// belongs-to: the key lives on this model, e.g. Post.UserID -> users.id
+		if !strings.HasPrefix(f.GoType, "[]") {
+			if fk := field(spec, firstNonEmpty(f.Tag["FOREIGNKEY"], f.Name+"ID")); fk != nil {
+				ref := field(other, firstNonEmpty(f.Tag["REFERENCES"], "ID"))
+				if ref == nil {
+					return nil, fmt.Errorf("%s.%s references a field %s does not have", spec.Name, f.Name, related)
+				}
+				keys = append(keys, ForeignKeySpec{
+					Table: spec.Table, Name: name, Column: fk.Column,
+					RefTable: other.Table, RefColumn: ref.Column,
+				})
+				continue
+			}
+		}
+
+		// has-one/has-many: the key lives on the related model, e.g. Post.UserID
+		fk := field(other, firstNonEmpty(f.Tag["FOREIGNKEY"], spec.Name+"ID"))
+		if fk == nil {
+			return nil, fmt.Errorf("%s.%s: no foreign key field found on %s", spec.Name, f.Name, related)
+		}
+		ref := field(spec, firstNonEmpty(f.Tag["REFERENCES"], "ID"))
+		if ref == nil {
+			return nil, fmt.Errorf("%s.%s references a field %s does not have", spec.Name, f.Name, spec.Name)
+		}
+		keys = append(keys, ForeignKeySpec{
+			Table: other.Table, Name: name, Column: fk.Column,
+			RefTable: spec.Table, RefColumn: ref.Column,
+		})
+	}
+	return keys, nil
+}
+
+// field finds a field by Go name or column name
+func field(spec *ModelSpec, name string) *FieldSpec {
+	for i, f := range spec.Fields {
+		if f.Name == name || f.Column == name {
+			return &spec.Fields[i]
+		}
+	}
+	return nil
+}
+
+// MissingIndexes returns the indexes the database doesn't have yet
+func MissingIndexes(db *gorm.DB, indexes []IndexSpec) []IndexSpec {
+	var missing []IndexSpec
+	for _, idx := range indexes {
+		if !db.Migrator().HasIndex(idx.Table, idx.Name) {
+			missing = append(missing, idx)
+		}
+	}
+	return missing
+}
+
+// MissingForeignKeys returns the foreign keys the database doesn't have yet
+func MissingForeignKeys(db *gorm.DB, keys []ForeignKeySpec) []ForeignKeySpec {
+	var missing []ForeignKeySpec
+	for _, fk := range keys {
+		if !db.Migrator().HasConstraint(fk.Table, fk.Name) {
+			missing = append(missing, fk)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,114 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+const tagModels = `package models
+
+import "gorm.io/gorm"
+
+type Author struct {
+	gorm.Model
+	Email string ` + "`gorm:\"uniqueIndex\"`" + `
+	Posts []Post
+}
+
+type Post struct {
+	gorm.Model
+	AuthorID uint
+	Author   Author
+	Slug     string ` + "`gorm:\"index:idx_slug_lang,unique,priority:2\"`" + `
+	Lang     string ` + "`gorm:\"index:idx_slug_lang,unique,priority:1\"`" + `
+	Draft    bool   ` + "`gorm:\"-\"`" + `
+}
+
+func (Post) TableName() string { return "articles" }
+`
+
+// Twins of tagModels, migrated by GORM to check generated names match
+type Author struct {
+	gorm.Model
+	Email string `gorm:"uniqueIndex"`
+	Posts []Post
+}
+
+type Post struct {
+	gorm.Model
+	AuthorID uint
+	Author   Author
+	Slug     string `gorm:"index:idx_slug_lang,unique,priority:2"`
+	Lang     string `gorm:"index:idx_slug_lang,unique,priority:1"`
+}
+
+func (Post) TableName() string { return "articles" }
+
+func parseTagModels(t *testing.T) *ModelSource {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "models.go"), []byte(tagModels), 0644))
+	src, err := ParseModelDir(dir)
+	require.NoError(t, err)
+	return src
+}
+
+func TestModelSourceConstraints(t *testing.T) {
+	src := parseTagModels(t)
+
+	post, err := src.Model("Post")
+	require.NoError(t, err)
+	assert.Equal(t, "articles", post.Table)
+
+	indexes, err := src.Indexes(post)
+	require.NoError(t, err)
+	assert.Equal(t, []IndexSpec{
+		{Table: "articles", Name: "idx_articles_deleted_at", Columns: []string{"deleted_at"}},
+		{Table: "articles", Name: "idx_slug_lang", Columns: []string{"lang", "slug"}, Unique: true},
+	}, indexes)
+
+	keys, err := src.ForeignKeys(post)
+	require.NoError(t, err)
+	assert.Equal(t, []ForeignKeySpec{
+		{Table: "articles", Name: "fk_articles_author", Column: "author_id", RefTable: "authors", RefColumn: "id"},
+	}, keys)
+
+	author, err := src.Model("Author")
+	require.NoError(t, err)
+	keys, err = src.ForeignKeys(author)
+	require.NoError(t, err)
+	assert.Equal(t, []ForeignKeySpec{
+		{Table: "articles", Name: "fk_authors_posts", Column: "author_id", RefTable: "authors", RefColumn: "id"},
+	}, keys)
+}
+
+func TestMissingConstraints(t *testing.T) {
+	src := parseTagModels(t)
+	author, err := src.Model("Author")
+	require.NoError(t, err)
+	indexes, err := src.Indexes(author)
+	require.NoError(t, err)
+	keys, err := src.ForeignKeys(author)
+	require.NoError(t, err)
+
+	m := newSQLiteManager(t, config.DatabaseConfig{})
+	db := m.GetDB()
+	require.NoError(t, db.Exec("CREATE TABLE authors (id integer primary key, email text, created_at datetime, updated_at datetime, deleted_at datetime)").Error)
+	require.NoError(t, db.Exec("CREATE TABLE articles (id integer primary key, author_id integer)").Error)
+
+	assert.Len(t, MissingIndexes(db, indexes), 2)
+	assert.Equal(t, keys, MissingForeignKeys(db, keys))
+
+	// Once GORM has migrated the same models nothing is missing
+	require.NoError(t, db.Migrator().DropTable("articles", "authors"))
+	require.NoError(t, db.AutoMigrate(&Author{}, &Post{}))
+	assert.Empty(t, MissingIndexes(db, indexes))
+	assert.Empty(t, MissingForeignKeys(db, keys))
+}
@@ -0,0 +1,314 @@
+package database
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// SchemaStep is one SchemaBuilder call kept as data, so it can be applied,
+// previewed as SQL or rendered into a generated migration
+type SchemaStep struct {
+	Method string
+	Args   []interface{}
+}
+
+func step(method string, args ...interface{}) SchemaStep {
+	return SchemaStep{Method: method, Args: args}
+}
+
+// Apply calls the step's method on b
+func (s SchemaStep) Apply(b SchemaBuilder) error {
+	method := reflect.ValueOf(b).MethodByName(s.Method)
+	if !method.IsValid() {
+		return fmt.Errorf("schema has no method %s", s.Method)
+	}
+	args := make([]reflect.Value, len(s.Args))
+	for i, arg := range s.Args {
+		args[i] = reflect.ValueOf(arg)
+	}
+	if err, _ := method.Call(args)[0].Interface().(error); err != nil {
+		return err
+	}
+	return nil
+}
+
+// String renders the step as Go source calling a SchemaBuilder named b
+func (s SchemaStep) String() string {
+	args := make([]string, len(s.Args))
+	for i, arg := range s.Args {
+		args[i] = fmt.Sprintf("%#v", arg)
+	}
+	return fmt.Sprintf("b.%s(%s)", s.Method, strings.Join(args, ", "))
+}
+
+// ConstraintSteps returns the steps adding indexes and foreign keys and the
+// steps dropping them again, in reverse order
+func ConstraintSteps(indexes []IndexSpec, keys []ForeignKeySpec) (up, down []SchemaStep) {
+	for _, idx := range indexes {
+		method := "AddIndex"
+		if idx.Unique {
+			method = "AddUniqueIndex"
+		}
+		up = append(up, step(method, idx.Table, idx.Name, idx.Columns))
+		down = append(down, step("DropIndex", idx.Table, idx.Name))
+	}
+	for _, fk := range keys {
+		up = append(up, step("AddForeignKey", fk.Table, fk.Name, fk.Column, fk.RefTable, fk.RefColumn))
+		down = append(down, step("DropForeignKey", fk.Table, fk.Name))
+	}
+	return up, reverse(down)
+}
+
+// ModelDiff is what it takes to bring a table in line with its model
+type ModelDiff struct {
+	Table string
+	Up    []SchemaStep
+	Down  []SchemaStep
+
+	// Create is set when the table doesn't exist yet
+	Create bool
+
+	// Dropped lists columns the database has but the model doesn't; Up
+	// drops them, losing their data
+	Dropped []string
+
+	// Skipped lists fields whose column type can't be derived from source,
+	// e.g. types from other packages without a type tag
+	Skipped []string
+}
+
+// Empty reports whether the table already matches the model
+func (d *ModelDiff) Empty() bool {
+	return len(d.Up) == 0
+}
+
+// Diff compares a model with its table and returns the steps adding,
+// dropping and retyping columns and adding missing indexes. Nullability
+// and defaults of existing columns are not compared.
+func (s *ModelSource) Diff(db *gorm.DB, spec *ModelSpec) (*ModelDiff, error) {
+	driver := db.Dialector.Name()
+	diff := &ModelDiff{Table: spec.Table}
+
+	var columns []FieldSpec
+	for _, f := range spec.Fields {
+		if f.Ignored() || s.Has(f.BaseType()) {
+			continue
+		}
+		if _, ok := ColumnType(driver, f); !ok {
+			// Slices of other packages' types are relations, not columns
+			if !strings.HasPrefix(f.GoType, "[]") {
+				diff.Skipped = append(diff.Skipped, f.Name)
+			}
+			continue
+		}
+		columns = append(columns, f)
+	}
+
+	migrator := db.Migrator()
+	if !migrator.HasTable(spec.Table) {
+		diff.Create = true
+		pk := "id"
+		for _, f := range columns {
+			if _, ok := f.Tag["PRIMARYKEY"]; ok {
+				pk = f.Column
+				break
+			}
+		}
+		diff.Up = append(diff.Up, step("CreateTable", spec.Table, []string{pk}))
+		for _, f := range columns {
+			if f.Column != pk {
+				diff.Up = append(diff.Up, step("AddColumn", spec.Table, f.Column, ColumnDefinition(driver, f)))
+			}
+		}
+		diff.Down = []SchemaStep{step("DropTable", spec.Table)}
+	} else {
+		existing, err := migrator.ColumnTypes(spec.Table)
+		if err != nil {
+			return nil, err
+		}
+		current := map[string]string{}
+		var order []string
+		for _, ct := range existing {
+			typ, ok := ct.ColumnType()
+			if !ok || typ == "" {
+				typ = ct.DatabaseTypeName()
+			}
+			current[ct.Name()] = typ
+			order = append(order, ct.Name())
+		}
+
+		var down []SchemaStep
+		wanted := map[string]bool{}
+		for _, f := range columns {
+			wanted[f.Column] = true
+			typ, found := current[f.Column]
+			if !found {
+				diff.Up = append(diff.Up, step("AddColumn", spec.Table, f.Column, ColumnDefinition(driver, f)))
+				down = append(down, step("DropColumn", spec.Table, f.Column))
+				continue
+			}
+			if _, pk := f.Tag["PRIMARYKEY"]; pk || f.Column == "id" {
+				continue
+			}
+			// Only the type changes; nullability and defaults are left alone
+			if model, _ := ColumnType(driver, f); !SameColumnType(model, typ) {
+				diff.Up = append(diff.Up, step("ChangeColumn", spec.Table, f.Column, model))
+				down = append(down, step("ChangeColumn", spec.Table, f.Column, typ))
+			}
+		}
+		for _, name := range order {
+			if !wanted[name] {
+				diff.Dropped = append(diff.Dropped, name)
+				diff.Up = append(diff.Up, step("DropColumn", spec.Table, name))
+				down = append(down, step("AddColumn", spec.Table, name, current[name]))
+			}
+		}
+		diff.Down = reverse(down)
+	}
+
+	indexes, err := s.Indexes(spec)
+	if err != nil {
+		return nil, err
+	}
+	if !diff.Create {
+		indexes = MissingIndexes(db, indexes)
+	}
+	up, down := ConstraintSteps(indexes, nil)
+	diff.Up = append(diff.Up, up...)
+	if !diff.Create {
+		// Dropping the table takes its indexes with it
+		diff.Down = append(down, diff.Down...)
+	}
+	return diff, nil
+}
+
+// ColumnType returns the column type GORM would create for a field on the
+// driver, honouring type and size tags
+func ColumnType(driver string, f FieldSpec) (string, bool) {
+	if typ := f.Tag["TYPE"]; typ != "" {
+		return typ, true
+	}
+
+	size := f.Tag["SIZE"]
+	kind := strings.TrimPrefix(f.GoType, "*")
+	switch kind {
+	case "sql.NullString":
+		kind = "string"
+	case "sql.NullInt64":
+		kind = "int64"
+	case "sql.NullInt32":
+		kind = "int32"
+	case "sql.NullBool":
+		kind = "bool"
+	case "sql.NullFloat64":
+		kind = "float64"
+	case "sql.NullTime", "gorm.DeletedAt":
+		kind = "time.Time"
+	}
+
+	switch kind {
+	case "string":
+		if size != "" {
+			return pick(driver, "varchar", "varchar", "varchar", "nvarchar") + "(" + size + ")", true
+		}
+		return pick(driver, "text", "longtext", "text", "nvarchar(MAX)"), true
+	case "bool":
+		return pick(driver, "boolean", "boolean", "numeric", "bit"), true
+	case "int", "int64", "uint", "uint64":
+		if driver == "mysql" && strings.HasPrefix(kind, "u") {
+			return "bigint unsigned", true
+		}
+		return pick(driver, "bigint", "bigint", "integer", "bigint"), true
+	case "int32", "uint32", "int16", "uint16", "int8", "uint8":
+		return pick(driver, "integer", "int", "integer", "int"), true
+	case "float32", "float64":
+		return pick(driver, "decimal", "double", "real", "float"), true
+	case "time.Time":
+		return pick(driver, "timestamptz", "datetime(3)", "datetime", "datetimeoffset"), true
+	case "[]byte":
+		return pick(driver, "bytea", "longblob", "blob", "varbinary(MAX)"), true
+	}
+	return "", false
+}
+
+// ColumnDefinition is ColumnType plus the not null, unique and default
+// settings from the field's tag
+func ColumnDefinition(driver string, f FieldSpec) string {
+	def, _ := ColumnType(driver, f)
+	if _, ok := f.Tag["NOT NULL"]; ok {
+		def += " NOT NULL"
+	}
+	if _, ok := f.Tag["UNIQUE"]; ok {
+		def += " UNIQUE"
+	}
+	if value, ok := f.Tag["DEFAULT"]; ok {
+		def += " DEFAULT " + value
+	}
+	return def
+}
+
+// SameColumnType compares a model column type with one reported by the
+// database, ignoring case and the driver's spelling of the same type. A
+// length is only compared when both sides have one.
+func SameColumnType(model, current string) bool {
+	a, aArgs := normalizeType(model)
+	b, bArgs := normalizeType(current)
+	if a != b {
+		return false
+	}
+	return aArgs == "" || bArgs == "" || aArgs == bArgs
+}
+
+var typeAliases = map[string]string{
+	"timestamp with time zone": "timestamptz",
+	"character varying":        "varchar",
+	"bool":                     "boolean",
+	"int8":                     "bigint",
+	"int4":                     "integer",
+	"int":                      "integer",
+	"int2":                     "smallint",
+	"numeric":                  "decimal",
+	"double precision":         "double",
+	"float8":                   "double",
+}
+
+func normalizeType(typ string) (name, args string) {
+	typ = strings.ToLower(strings.TrimSpace(typ))
+	if typ == "tinyint(1)" {
+		return "boolean", ""
+	}
+	if open := strings.Index(typ, "("); open >= 0 {
+		if end := strings.Index(typ[open:], ")"); end >= 0 {
+			args = typ[open+1 : open+end]
+			typ = strings.TrimSpace(typ[:open] + typ[open+end+1:])
+		}
+	}
+	if alias, ok := typeAliases[typ]; ok {
+		typ = alias
+	}
+	return typ, args
+}
+
+// pick chooses a type by driver; unknown drivers get the postgres one
+func pick(driver, postgres, mysql, sqlite, sqlserver string) string {
+	switch driver {
+	case "mysql":
+		return mysql
+	case "sqlite":
+		return sqlite
+	case "sqlserver":
+		return sqlserver
+	default:
+		return postgres
+	}
+}
+
+func reverse(steps []SchemaStep) []SchemaStep {
+	for i, j := 0, len(steps)-1; i < j; i, j = i+1, j-1 {
+		steps[i], steps[j] = steps[j], steps[i]
+	}
+	return steps
+}
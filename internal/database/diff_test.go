@@ -0,0 +1,84 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+const diffModels = `package models
+
+type Account struct {
+	ID    uint
+	Name  string ` + "`gorm:\"size:100;not null\"`" + `
+	Age   int
+	Bio   string
+	Code  string ` + "`gorm:\"index\"`" + `
+	Photo media.Image
+}
+`
+
+func TestModelDiff(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "account.go"), []byte(diffModels), 0644))
+	src, err := ParseModelDir(dir)
+	require.NoError(t, err)
+	spec, err := src.Model("Account")
+	require.NoError(t, err)
+
+	m := newSQLiteManager(t, config.DatabaseConfig{})
+	db := m.GetDB()
+
+	diff, err := src.Diff(db, spec)
+	require.NoError(t, err)
+	assert.True(t, diff.Create)
+	assert.Equal(t, []string{"Photo"}, diff.Skipped)
+	assert.Equal(t, step("CreateTable", "accounts", []string{"id"}), diff.Up[0])
+	assert.Equal(t, []SchemaStep{step("DropTable", "accounts")}, diff.Down)
+
+	require.NoError(t, db.Exec("CREATE TABLE accounts (id integer primary key, name text, legacy text, age integer)").Error)
+	diff, err = src.Diff(db, spec)
+	require.NoError(t, err)
+	assert.False(t, diff.Create)
+	assert.Equal(t, []string{"legacy"}, diff.Dropped)
+	assert.Equal(t, []SchemaStep{
+		step("ChangeColumn", "accounts", "name", "varchar(100)"),
+		step("AddColumn", "accounts", "bio", "text"),
+		step("AddColumn", "accounts", "code", "text"),
+		step("DropColumn", "accounts", "legacy"),
+		step("AddIndex", "accounts", "idx_accounts_code", []string{"code"}),
+	}, diff.Up)
+	assert.Equal(t, []SchemaStep{
+		step("DropIndex", "accounts", "idx_accounts_code"),
+		step("AddColumn", "accounts", "legacy", "text"),
+		step("DropColumn", "accounts", "code"),
+		step("DropColumn", "accounts", "bio"),
+		step("ChangeColumn", "accounts", "name", "text"),
+	}, diff.Down)
+
+	assert.Equal(t, `b.AddIndex("accounts", "idx_accounts_code", []string{"code"})`, diff.Up[4].String())
+
+	queries, err := Pretend("postgres", diff.Up)
+	require.NoError(t, err)
+	assert.Equal(t, "ALTER TABLE accounts ALTER COLUMN name TYPE varchar(100)", queries[0])
+	assert.Equal(t, "CREATE INDEX idx_accounts_code ON accounts (code)", queries[4])
+
+	// Pretending never touches the database
+	_, err = Pretend("sqlite", []SchemaStep{step("AddColumn", "accounts", "bio", "text")})
+	require.NoError(t, err)
+	assert.False(t, db.Migrator().HasColumn("accounts", "bio"))
+}
+
+func TestSameColumnType(t *testing.T) {
+	assert.True(t, SameColumnType("timestamptz", "timestamp with time zone"))
+	assert.True(t, SameColumnType("varchar(100)", "character varying(100)"))
+	assert.True(t, SameColumnType("boolean", "tinyint(1)"))
+	assert.True(t, SameColumnType("bigint unsigned", "bigint(20) unsigned"))
+	assert.False(t, SameColumnType("varchar(100)", "varchar(255)"))
+	assert.False(t, SameColumnType("text", "bigint"))
+}
@@ -0,0 +1,132 @@
+package database
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ErrReadOnlyConnection is returned for writes on a read-only connection
+var ErrReadOnlyConnection = errors.New("database connection is read-only")
+
+// DefaultPort returns the usual port of a driver's server, or 0 for
+// drivers without one
+func DefaultPort(driver string) int {
+	switch driver {
+	case "postgres":
+		return 5432
+	case "mysql":
+		return 3306
+	case "sqlserver":
+		return 1433
+	case "clickhouse":
+		return 9000
+	default:
+		return 0
+	}
+}
+
+// ReadOnlyDriver reports whether connections with the driver only read.
+// ClickHouse connections are for analytics queries against data loaded by
+// other pipelines.
+func ReadOnlyDriver(driver string) bool {
+	return driver == "clickhouse"
+}
+
+// ReadOnly reports whether the connection refuses writes
+func (m *Manager) ReadOnly() bool {
+	return ReadOnlyDriver(m.config.Driver)
+}
+
+// sqlServerDSN builds a go-mssqldb URL. SSLMode "disable" turns encryption
+// off; "require" or "verify-full" turn it on.
+func sqlServerDSN(host string, port int, database, username, password, sslMode string) string {
+	query := url.Values{"database": {database}}
+	switch sslMode {
+	case "disable":
+		query.Set("encrypt", "disable")
+	case "require", "verify-ca", "verify-full":
+		query.Set("encrypt", "true")
+	}
+	return (&url.URL{
+		Scheme:   "sqlserver",
+		User:     url.UserPassword(username, password),
+		Host:     net.JoinHostPort(host, strconv.Itoa(port)),
+		RawQuery: query.Encode(),
+	}).String()
+}
+
+// clickHouseDSN builds a clickhouse-go URL for the native protocol
+func clickHouseDSN(host string, port int, database, username, password, sslMode string) string {
+	query := url.Values{}
+	if sslMode != "" && sslMode != "disable" {
+		query.Set("secure", "true")
+	}
+	return (&url.URL{
+		Scheme:   "clickhouse",
+		User:     url.UserPassword(username, password),
+		Host:     net.JoinHostPort(host, strconv.Itoa(port)),
+		Path:     "/" + database,
+		RawQuery: query.Encode(),
+	}).String()
+}
+
+// readOnlyGuard is a GORM plugin failing every write before it reaches
+// the database. Raw statements are allowed when they only read.
+type readOnlyGuard struct{}
+
+var _ gorm.Plugin = readOnlyGuard{}
+
+// Name implements gorm.Plugin
+func (readOnlyGuard) Name() string {
+	return "dolphin:read_only"
+}
+
+// Initialize implements gorm.Plugin
+func (g readOnlyGuard) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Create().Before("gorm:create").Register("dolphin:read_only_create", g.refuse); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register("dolphin:read_only_update", g.refuse); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:delete").Register("dolphin:read_only_delete", g.refuse); err != nil {
+		return err
+	}
+	if err := cb.Raw().Before("gorm:raw").Register("dolphin:read_only_raw", g.refuseWrites); err != nil {
+		return err
+	}
+	return cb.Row().Before("gorm:row").Register("dolphin:read_only_row", g.refuseWrites)
+}
+
+func (readOnlyGuard) refuse(db *gorm.DB) {
+	_ = db.AddError(ErrReadOnlyConnection)
+}
+
+func (g readOnlyGuard) refuseWrites(db *gorm.DB) {
+	// Statements GORM builds itself in the row chain are SELECTs
+	sql := db.Statement.SQL.String()
+	if sql != "" && !isAnalyticsReadSQL(sql) {
+		g.refuse(db)
+	}
+}
+
+// isAnalyticsReadSQL is isReadSQL plus the CTE and DESCRIBE forms common
+// in analytics queries
+func isAnalyticsReadSQL(sql string) bool {
+	if isReadSQL(sql) {
+		return true
+	}
+	sql = strings.ToUpper(strings.TrimSpace(sql))
+	for _, prefix := range []string{"WITH", "DESC", "EXISTS"} {
+		if strings.HasPrefix(sql, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,154 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Plan is the output of EXPLAIN for one statement
+type Plan struct {
+	Driver  string
+	Analyze bool
+	Columns []string
+	Rows    [][]string
+}
+
+// Explain runs EXPLAIN on a statement. With analyze, Postgres and MySQL
+// execute it to report actual timings; that is only done for SELECTs so
+// explaining a write never changes data. SQLite has no ANALYZE variant and
+// reports its query plan instead, and ClickHouse reports its plan without
+// timings.
+func (m *Manager) Explain(ctx context.Context, query string, analyze bool) (*Plan, error) {
+	query = strings.TrimSuffix(strings.TrimSpace(query), ";")
+	if query == "" {
+		return nil, fmt.Errorf("empty query")
+	}
+	analyze = analyze && isReadSQL(query) && m.config.Driver != "sqlite" && m.config.Driver != "clickhouse"
+
+	var stmt string
+	switch m.config.Driver {
+	case "postgres":
+		if analyze {
+			stmt = "EXPLAIN (ANALYZE, BUFFERS) " + query
+		} else {
+			stmt = "EXPLAIN " + query
+		}
+	case "mysql":
+		if analyze {
+			stmt = "EXPLAIN ANALYZE " + query
+		} else {
+			stmt = "EXPLAIN " + query
+		}
+	case "sqlite":
+		stmt = "EXPLAIN QUERY PLAN " + query
+	case "clickhouse":
+		stmt = "EXPLAIN " + query
+	default:
+		return nil, fmt.Errorf("unsupported database driver: %s", m.config.Driver)
+	}
+
+	rows, err := m.sqlDB.QueryContext(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{Driver: m.config.Driver, Analyze: analyze, Columns: columns}
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		row := make([]string, len(columns))
+		for i, v := range values {
+			if v.Valid {
+				row[i] = v.String
+			} else {
+				row[i] = "NULL"
+			}
+		}
+		plan.Rows = append(plan.Rows, row)
+	}
+
+	return plan, rows.Err()
+}
+
+// String renders the plan for a terminal: text plans line by line, SQLite
+// plans as an indented tree and tabular plans as an aligned table
+func (p *Plan) String() string {
+	if len(p.Columns) == 1 {
+		lines := make([]string, len(p.Rows))
+		for i, row := range p.Rows {
+			lines[i] = row[0]
+		}
+		return strings.Join(lines, "\n")
+	}
+	if p.Driver == "sqlite" && len(p.Columns) == 4 {
+		return p.sqliteTree()
+	}
+	return p.table()
+}
+
+// sqliteTree nests EXPLAIN QUERY PLAN rows (id, parent, notused, detail)
+func (p *Plan) sqliteTree() string {
+	depth := map[string]int{"0": -1}
+	var b strings.Builder
+	for _, row := range p.Rows {
+		id, parent, detail := row[0], row[1], row[3]
+		d := depth[parent] + 1
+		depth[id] = d
+		b.WriteString(strings.Repeat("   ", d))
+		b.WriteString("└─ ")
+		b.WriteString(detail)
+		b.WriteString("\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func (p *Plan) table() string {
+	widths := make([]int, len(p.Columns))
+	for i, c := range p.Columns {
+		widths[i] = len(c)
+	}
+	for _, row := range p.Rows {
+		for i, v := range row {
+			if len(v) > widths[i] {
+				widths[i] = len(v)
+			}
+		}
+	}
+
+	var b strings.Builder
+	writeRow := func(values []string) {
+		for i, v := range values {
+			if i > 0 {
+				b.WriteString(" | ")
+			}
+			b.WriteString(v + strings.Repeat(" ", widths[i]-len(v)))
+		}
+		b.WriteString("\n")
+	}
+
+	writeRow(p.Columns)
+	separators := make([]string, len(widths))
+	for i, w := range widths {
+		separators[i] = strings.Repeat("-", w)
+	}
+	writeRow(separators)
+	for _, row := range p.Rows {
+		writeRow(row)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
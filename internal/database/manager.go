@@ -3,13 +3,19 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/mrhoseah/dolphin/internal/config"
 	raptor "github.com/mrhoseah/raptor/core"
+	"gorm.io/driver/clickhouse"
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
+	"gorm.io/driver/sqlserver"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
@@ -19,43 +25,81 @@ type Manager struct {
 	config *config.DatabaseConfig
 	db     *gorm.DB
 	sqlDB  *sql.DB
+
+	// name is set for named connections; see connections.go
+	name string
+
+	queryLog      *QueryLog
+	queryTimeouts *QueryTimeouts
+
+	// Read replicas; see replicas.go
+	replicas      []*replica
+	next          atomic.Uint64
+	primaryReads  atomic.Int64
+	primaryWrites atomic.Int64
+	stop          chan struct{}
+	stopOnce      sync.Once
 }
 
 // New creates a new database manager
 func New(cfg *config.DatabaseConfig) (*Manager, error) {
 	manager := &Manager{
 		config: cfg,
+		stop:   make(chan struct{}),
 	}
 
 	if err := manager.connect(); err != nil {
 		return nil, err
 	}
 
+	if err := manager.connectReplicas(); err != nil {
+		manager.Close()
+		return nil, err
+	}
+
 	return manager, nil
 }
 
-// connect establishes database connection
-func (m *Manager) connect() error {
-	var dialector gorm.Dialector
-
+// dialector builds the GORM dialector for the configured driver
+func (m *Manager) dialector(host string, port int, database, username, password string) (gorm.Dialector, error) {
 	switch m.config.Driver {
 	case "postgres":
 		dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
-			m.config.Host, m.config.Port, m.config.Username, m.config.Password,
-			m.config.Database, m.config.SSLMode)
-		dialector = postgres.Open(dsn)
+			host, port, username, password, database, m.config.SSLMode)
+		if m.config.Schema != "" {
+			dsn += " search_path=" + m.config.Schema
+		}
+		return postgres.Open(dsn), nil
 	case "mysql":
 		dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=%s&parseTime=True&loc=Local",
-			m.config.Username, m.config.Password, m.config.Host, m.config.Port,
-			m.config.Database, m.config.Charset)
-		dialector = mysql.Open(dsn)
+			username, password, host, port, database, m.config.Charset)
+		return mysql.Open(dsn), nil
 	case "sqlite":
-		dialector = sqlite.Open(m.config.Database)
+		return sqlite.Open(database), nil
+	case "sqlserver":
+		return sqlserver.Open(sqlServerDSN(host, port, database, username, password, m.config.SSLMode)), nil
+	case "clickhouse":
+		return clickhouse.Open(clickHouseDSN(host, port, database, username, password, m.config.SSLMode)), nil
 	default:
-		return fmt.Errorf("unsupported database driver: %s", m.config.Driver)
+		return nil, fmt.Errorf("unsupported database driver: %s", m.config.Driver)
+	}
+}
+
+// configurePool applies the configured pool limits to a connection
+func (m *Manager) configurePool(db *sql.DB) {
+	db.SetMaxOpenConns(m.config.MaxOpen)
+	db.SetMaxIdleConns(m.config.MaxIdle)
+	db.SetConnMaxLifetime(time.Duration(m.config.MaxLife) * time.Second)
+}
+
+// connect establishes database connection
+func (m *Manager) connect() error {
+	dialector, err := m.dialector(m.config.Host, m.config.Port, m.config.Database,
+		m.config.Username, m.config.Password)
+	if err != nil {
+		return err
 	}
 
-	var err error
 	m.db, err = gorm.Open(dialector, &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Silent),
 	})
@@ -63,6 +107,21 @@ func (m *Manager) connect() error {
 		return err
 	}
 
+	// Time every statement for slow query detection and the debug dashboard
+	m.queryLog = NewQueryLog(m.config.QueryLogSize, m.config.SlowQueryThreshold)
+	if err := m.db.Use(m.queryLog); err != nil {
+		return err
+	}
+	m.queryTimeouts = NewQueryTimeouts(m.config.QueryTimeout)
+	if err := m.db.Use(m.queryTimeouts); err != nil {
+		return err
+	}
+	if m.ReadOnly() {
+		if err := m.db.Use(readOnlyGuard{}); err != nil {
+			return err
+		}
+	}
+
 	// Get underlying sql.DB for connection pool configuration
 	m.sqlDB, err = m.db.DB()
 	if err != nil {
@@ -70,25 +129,41 @@ func (m *Manager) connect() error {
 	}
 
 	// Configure connection pool
-	m.sqlDB.SetMaxOpenConns(m.config.MaxOpen)
-	m.sqlDB.SetMaxIdleConns(m.config.MaxIdle)
-	m.sqlDB.SetConnMaxLifetime(time.Duration(m.config.MaxLife) * time.Second)
+	m.configurePool(m.sqlDB)
 
 	return nil
 }
 
-// GetDB returns the GORM database instance
+// GetDB returns the GORM database instance. Queries made through it are
+// routed to read replicas when any are configured.
 func (m *Manager) GetDB() *gorm.DB {
 	return m.db
 }
 
-// GetSQLDB returns the underlying sql.DB instance
+// QueryLog returns the log of recent and slow queries
+func (m *Manager) QueryLog() *QueryLog {
+	return m.queryLog
+}
+
+// QueryTimeouts returns the statement timeout plugin, which counts the
+// statements canceled or timed out
+func (m *Manager) QueryTimeouts() *QueryTimeouts {
+	return m.queryTimeouts
+}
+
+// GetSQLDB returns the underlying sql.DB instance of the primary
 func (m *Manager) GetSQLDB() *sql.DB {
 	return m.sqlDB
 }
 
-// Close closes the database connection
+// Close closes the primary and replica connections
 func (m *Manager) Close() error {
+	m.stopOnce.Do(func() { close(m.stop) })
+
+	for _, r := range m.replicas {
+		r.sqlDB.Close()
+	}
+
 	if m.sqlDB != nil {
 		return m.sqlDB.Close()
 	}
@@ -100,6 +175,20 @@ type Migrator struct {
 	db            *sql.DB
 	migrationsDir string
 	schema        raptor.Schema
+
+	// connection selects the registered migrations to run and table is
+	// where they are recorded
+	connection string
+	table      string
+	driver     string
+
+	// ForceDataLoss lets Rollback run Down migrations that drop tables or
+	// columns still holding data
+	ForceDataLoss bool
+
+	// Progress, when set, is called as Migrate starts each pending
+	// migration, with how many of them have run so far
+	Progress func(name string, done, total int)
 }
 
 // MigrationResult represents the result of a migration operation
@@ -108,6 +197,11 @@ type MigrationResult struct {
 	Executed   []string
 	RolledBack []string
 	Batch      int
+
+	// DataLoss lists data the rollback destroyed, or would have destroyed
+	// when Blocked
+	DataLoss []DataLoss
+	Blocked  bool
 }
 
 // MigrationStatus represents the status of a migration
@@ -123,9 +217,33 @@ func NewMigrator(db *sql.DB, migrationsDir string) *Migrator {
 		db:            db,
 		migrationsDir: migrationsDir,
 		schema:        NewSchema(db),
+		connection:    DefaultConnection,
+		table:         MigrationsTable(DefaultConnection),
+	}
+}
+
+// Migrator returns a migrator for the connection's own migrations, recorded
+// in its own migrations table and run with its driver's schema
+func (m *Manager) Migrator(migrationsDir string) *Migrator {
+	return &Migrator{
+		db:            m.sqlDB,
+		migrationsDir: migrationsDir,
+		schema:        SchemaFor(m.config.Driver, m.sqlDB),
+		connection:    m.Name(),
+		table:         MigrationsTable(m.Name()),
+		driver:        m.config.Driver,
 	}
 }
 
+// readOnly reports why the migrator can't run migrations on a read-only
+// connection, or "" when it can
+func (m *Migrator) readOnly() string {
+	if !ReadOnlyDriver(m.driver) {
+		return ""
+	}
+	return fmt.Sprintf("Connection %s is read-only (%s); it has no migrations", m.connection, m.driver)
+}
+
 // NewSchema creates a new schema instance based on database driver
 func NewSchema(db *sql.DB) raptor.Schema {
 	// For now, return a generic schema
@@ -135,6 +253,11 @@ func NewSchema(db *sql.DB) raptor.Schema {
 
 // Migrate runs all pending migrations
 func (m *Migrator) Migrate() MigrationResult {
+	if reason := m.readOnly(); reason != "" {
+		return MigrationResult{Message: reason}
+	}
+	m.ensureTable()
+
 	// Get all migrations from the migrations directory
 	migrations := m.getMigrations()
 
@@ -158,7 +281,10 @@ func (m *Migrator) Migrate() MigrationResult {
 
 	// Execute pending migrations
 	var executedNames []string
-	for _, migration := range pending {
+	for i, migration := range pending {
+		if m.Progress != nil {
+			m.Progress(migration.Name(), i, len(pending))
+		}
 		if err := migration.Up(m.schema); err != nil {
 			return MigrationResult{Message: fmt.Sprintf("Migration failed: %s", err.Error())}
 		}
@@ -177,6 +303,11 @@ func (m *Migrator) Migrate() MigrationResult {
 
 // Rollback rolls back the last batch of migrations
 func (m *Migrator) Rollback() MigrationResult {
+	if reason := m.readOnly(); reason != "" {
+		return MigrationResult{Message: reason}
+	}
+	m.ensureTable()
+
 	// Get last batch
 	lastBatch := m.getLastBatchNumber()
 	if lastBatch == 0 {
@@ -189,33 +320,57 @@ func (m *Migrator) Rollback() MigrationResult {
 		return MigrationResult{Message: "No migrations to rollback"}
 	}
 
-	// Rollback migrations in reverse order
-	var rolledBack []string
+	// Dry-run every Down first so nothing is rolled back if any of them
+	// would destroy data
+	var pending []raptor.Migration
+	var losses []DataLoss
 	for i := len(migrations) - 1; i >= 0; i-- {
-		migrationName := migrations[i]
-		migration := m.findMigration(migrationName)
+		migration := m.findMigration(migrations[i])
 		if migration == nil {
 			continue
 		}
 
+		found, err := m.AnalyzeDown(migration)
+		if err != nil {
+			return MigrationResult{Message: fmt.Sprintf("Rollback failed: %s", err.Error())}
+		}
+		losses = append(losses, found...)
+		pending = append(pending, migration)
+	}
+
+	if len(losses) > 0 && !m.ForceDataLoss {
+		return MigrationResult{
+			Message:  (&DataLossError{Losses: losses}).Error(),
+			Batch:    lastBatch,
+			DataLoss: losses,
+			Blocked:  true,
+		}
+	}
+
+	// Rollback migrations in reverse order
+	var rolledBack []string
+	for _, migration := range pending {
 		if err := migration.Down(m.schema); err != nil {
 			return MigrationResult{Message: fmt.Sprintf("Rollback failed: %s", err.Error())}
 		}
 
 		// Remove migration record
-		m.removeMigration(migrationName)
-		rolledBack = append(rolledBack, migrationName)
+		m.removeMigration(migration.Name())
+		rolledBack = append(rolledBack, migration.Name())
 	}
 
 	return MigrationResult{
 		Message:    "Rollback completed successfully",
 		RolledBack: rolledBack,
 		Batch:      lastBatch,
+		DataLoss:   losses,
 	}
 }
 
 // Status returns the status of all migrations
 func (m *Migrator) Status() []MigrationStatus {
+	m.ensureTable()
+
 	allMigrations := m.getAllMigrationNames()
 	executed := m.getExecutedMigrations()
 
@@ -242,25 +397,74 @@ func (m *Migrator) Status() []MigrationStatus {
 // Helper methods for migration management
 
 func (m *Migrator) getMigrations() []raptor.Migration {
-	// This would typically scan the migrations directory
-	// For now, return empty slice - implement based on your migration structure
-	return []raptor.Migration{}
+	return registeredMigrations(m.connection)
 }
 
 func (m *Migrator) getAllMigrationNames() []string {
-	// This would typically scan the migrations directory for .go files
-	// For now, return empty slice - implement based on your migration structure
-	return []string{}
+	var names []string
+	for _, migration := range m.getMigrations() {
+		names = append(names, migration.Name())
+	}
+	return names
 }
 
 func (m *Migrator) findMigration(name string) raptor.Migration {
-	// This would find and instantiate the migration by name
-	// For now, return nil - implement based on your migration structure
+	for _, migration := range m.getMigrations() {
+		if migration.Name() == name {
+			return migration
+		}
+	}
 	return nil
 }
 
+// ensureTable creates the migrations table when the driver is known
+func (m *Migrator) ensureTable() {
+	var id string
+	switch m.driver {
+	case "postgres":
+		id = "id SERIAL PRIMARY KEY"
+	case "mysql":
+		id = "id INT AUTO_INCREMENT PRIMARY KEY"
+	case "sqlite":
+		id = "id INTEGER PRIMARY KEY AUTOINCREMENT"
+	case "sqlserver":
+		// SQL Server has no CREATE TABLE IF NOT EXISTS
+		m.db.Exec(fmt.Sprintf("IF OBJECT_ID(N'%s', N'U') IS NULL CREATE TABLE %s (id INT IDENTITY(1,1) PRIMARY KEY, migration NVARCHAR(255) NOT NULL, batch INT NOT NULL)", m.table, m.table))
+		return
+	default:
+		return
+	}
+	m.db.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s, migration VARCHAR(255) NOT NULL, batch INTEGER NOT NULL)", m.table, id))
+}
+
+// query formats a statement against the migrations table, switching to
+// numbered placeholders on Postgres and SQL Server
+func (m *Migrator) query(format string) string {
+	query := fmt.Sprintf(format, m.table)
+	var prefix string
+	switch m.driver {
+	case "postgres":
+		prefix = "$"
+	case "sqlserver":
+		prefix = "@p"
+	default:
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString(prefix + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
 func (m *Migrator) getExecutedMigrations() []string {
-	query := "SELECT migration FROM migrations ORDER BY id"
+	query := m.query("SELECT migration FROM %s ORDER BY id")
 	rows, err := m.db.Query(query)
 	if err != nil {
 		return []string{}
@@ -289,21 +493,21 @@ func (m *Migrator) isExecuted(migration string, executed []string) bool {
 }
 
 func (m *Migrator) getNextBatchNumber() int {
-	query := "SELECT COALESCE(MAX(batch), 0) + 1 FROM migrations"
+	query := m.query("SELECT COALESCE(MAX(batch), 0) + 1 FROM %s")
 	var batch int
 	m.db.QueryRow(query).Scan(&batch)
 	return batch
 }
 
 func (m *Migrator) getLastBatchNumber() int {
-	query := "SELECT COALESCE(MAX(batch), 0) FROM migrations"
+	query := m.query("SELECT COALESCE(MAX(batch), 0) FROM %s")
 	var batch int
 	m.db.QueryRow(query).Scan(&batch)
 	return batch
 }
 
 func (m *Migrator) getMigrationsByBatch(batch int) []string {
-	query := "SELECT migration FROM migrations WHERE batch = ? ORDER BY id"
+	query := m.query("SELECT migration FROM %s WHERE batch = ? ORDER BY id")
 	rows, err := m.db.Query(query, batch)
 	if err != nil {
 		return []string{}
@@ -323,7 +527,7 @@ func (m *Migrator) getMigrationsByBatch(batch int) []string {
 }
 
 func (m *Migrator) getMigrationBatch(migration string) *int {
-	query := "SELECT batch FROM migrations WHERE migration = ?"
+	query := m.query("SELECT batch FROM %s WHERE migration = ?")
 	var batch int
 	err := m.db.QueryRow(query, migration).Scan(&batch)
 	if err != nil {
@@ -333,11 +537,11 @@ func (m *Migrator) getMigrationBatch(migration string) *int {
 }
 
 func (m *Migrator) recordMigration(migration string, batch int) {
-	query := "INSERT INTO migrations (migration, batch) VALUES (?, ?)"
+	query := m.query("INSERT INTO %s (migration, batch) VALUES (?, ?)")
 	m.db.Exec(query, migration, batch)
 }
 
 func (m *Migrator) removeMigration(migration string) {
-	query := "DELETE FROM migrations WHERE migration = ?"
+	query := m.query("DELETE FROM %s WHERE migration = ?")
 	m.db.Exec(query, migration)
 }
@@ -0,0 +1,227 @@
+package database
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm/schema"
+)
+
+// ModelSpec is a GORM model read from Go source. The CLI can't load an
+// app's compiled models, so generators work from the source instead.
+type ModelSpec struct {
+	Name   string
+	Table  string
+	Fields []FieldSpec
+}
+
+// FieldSpec is one field of a model
+type FieldSpec struct {
+	Name   string
+	Column string
+
+	// GoType is the field type as written, e.g. "string", "*time.Time",
+	// "[]Post" or "gorm.DeletedAt"
+	GoType string
+
+	// Tag holds the parsed gorm tag with upper-cased keys, as GORM sees it
+	Tag map[string]string
+
+	// rawTag is the unparsed gorm tag; a field may repeat index settings,
+	// which Tag collapses
+	rawTag string
+}
+
+// Ignored reports whether GORM skips the field (gorm:"-")
+func (f FieldSpec) Ignored() bool {
+	_, ok := f.Tag["-"]
+	return ok
+}
+
+// BaseType is GoType without pointer and slice markers
+func (f FieldSpec) BaseType() string {
+	return strings.TrimLeft(f.GoType, "*[]")
+}
+
+// naming mirrors GORM's default naming so generated names match AutoMigrate
+var naming = schema.NamingStrategy{}
+
+// ModelSource holds the parsed files of a models package
+type ModelSource struct {
+	structs    map[string]*ast.StructType
+	tableNames map[string]string
+}
+
+// ParseModelDir parses every Go file in dir, e.g. app/models
+func ParseModelDir(dir string) (*ModelSource, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	fset := token.NewFileSet()
+	src := &ModelSource{structs: map[string]*ast.StructType{}, tableNames: map[string]string{}}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+
+		file, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, decl := range file.Decls {
+			switch d := decl.(type) {
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					if ts, ok := spec.(*ast.TypeSpec); ok {
+						if st, ok := ts.Type.(*ast.StructType); ok {
+							src.structs[ts.Name.Name] = st
+						}
+					}
+				}
+			case *ast.FuncDecl:
+				if recv, table, ok := tableNameMethod(d); ok {
+					src.tableNames[recv] = table
+				}
+			}
+		}
+	}
+	return src, nil
+}
+
+// tableNameMethod matches `func (T) TableName() string { return "name" }`
+func tableNameMethod(fn *ast.FuncDecl) (recv, table string, ok bool) {
+	if fn.Name.Name != "TableName" || fn.Recv == nil || len(fn.Recv.List) != 1 || fn.Body == nil {
+		return "", "", false
+	}
+	recv = strings.TrimPrefix(exprString(fn.Recv.List[0].Type), "*")
+	for _, stmt := range fn.Body.List {
+		ret, isReturn := stmt.(*ast.ReturnStmt)
+		if !isReturn || len(ret.Results) != 1 {
+			continue
+		}
+		if lit, isLit := ret.Results[0].(*ast.BasicLit); isLit && lit.Kind == token.STRING {
+			if value, err := strconv.Unquote(lit.Value); err == nil {
+				return recv, value, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// Model returns the spec of the named struct, expanding embedded structs
+// declared in the same package and gorm.Model
+func (s *ModelSource) Model(name string) (*ModelSpec, error) {
+	st, ok := s.structs[name]
+	if !ok {
+		return nil, fmt.Errorf("model %s not found", name)
+	}
+
+	spec := &ModelSpec{Name: name, Table: s.TableName(name)}
+	fields, err := s.fields(spec.Table, st, map[string]bool{name: true})
+	if err != nil {
+		return nil, err
+	}
+	spec.Fields = fields
+	return spec, nil
+}
+
+// Has reports whether the package declares the named struct
+func (s *ModelSource) Has(name string) bool {
+	_, ok := s.structs[name]
+	return ok
+}
+
+// TableName returns the model's table from its TableName method, or GORM's
+// default pluralized snake_case name
+func (s *ModelSource) TableName(name string) string {
+	if table, ok := s.tableNames[name]; ok {
+		return table
+	}
+	return naming.TableName(name)
+}
+
+func (s *ModelSource) fields(table string, st *ast.StructType, seen map[string]bool) ([]FieldSpec, error) {
+	var fields []FieldSpec
+	for _, f := range st.Fields.List {
+		goType := exprString(f.Type)
+		var rawTag string
+		if f.Tag != nil {
+			if raw, err := strconv.Unquote(f.Tag.Value); err == nil {
+				rawTag = reflect.StructTag(raw).Get("gorm")
+			}
+		}
+		tag := schema.ParseTagSetting(rawTag, ";")
+
+		if len(f.Names) == 0 {
+			embedded, err := s.embedded(table, goType, seen)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, embedded...)
+			continue
+		}
+
+		for _, n := range f.Names {
+			if !n.IsExported() {
+				continue
+			}
+			column := tag["COLUMN"]
+			if column == "" {
+				column = naming.ColumnName(table, n.Name)
+			}
+			fields = append(fields, FieldSpec{Name: n.Name, Column: column, GoType: goType, Tag: tag, rawTag: rawTag})
+		}
+	}
+	return fields, nil
+}
+
+// embedded expands an anonymous field
+func (s *ModelSource) embedded(table, goType string, seen map[string]bool) ([]FieldSpec, error) {
+	name := strings.TrimPrefix(goType, "*")
+	if name == "gorm.Model" {
+		return []FieldSpec{
+			{Name: "ID", Column: "id", GoType: "uint", Tag: map[string]string{"PRIMARYKEY": "PRIMARYKEY"}},
+			{Name: "CreatedAt", Column: "created_at", GoType: "time.Time", Tag: map[string]string{}},
+			{Name: "UpdatedAt", Column: "updated_at", GoType: "time.Time", Tag: map[string]string{}},
+			{Name: "DeletedAt", Column: "deleted_at", GoType: "gorm.DeletedAt", Tag: map[string]string{"INDEX": "INDEX"}, rawTag: "index"},
+		}, nil
+	}
+
+	st, ok := s.structs[name]
+	if !ok || seen[name] {
+		// Embedded types from other packages can't be expanded from source
+		return nil, nil
+	}
+	seen[name] = true
+	return s.fields(table, st, seen)
+}
+
+// exprString renders a type expression as written in source
+func exprString(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return e.Name
+	case *ast.StarExpr:
+		return "*" + exprString(e.X)
+	case *ast.SelectorExpr:
+		return exprString(e.X) + "." + e.Sel.Name
+	case *ast.ArrayType:
+		return "[]" + exprString(e.Elt)
+	case *ast.MapType:
+		return "map[" + exprString(e.Key) + "]" + exprString(e.Value)
+	case *ast.IndexExpr:
+		return exprString(e.X) + "[" + exprString(e.Index) + "]"
+	default:
+		return fmt.Sprintf("%T", expr)
+	}
+}
@@ -0,0 +1,190 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+// OptimizeResult reports the maintenance run on one table
+type OptimizeResult struct {
+	Table      string        `json:"table"`
+	Statements []string      `json:"statements"`
+	Duration   time.Duration `json:"duration"`
+}
+
+// OptimizeStatements returns the maintenance db:optimize runs on a table:
+// VACUUM (ANALYZE) on Postgres, OPTIMIZE TABLE on MySQL, REINDEX and ANALYZE
+// on SQLite and index reorganization plus fresh statistics on SQL Server
+func (m *Manager) OptimizeStatements(table string) ([]string, error) {
+	quoted := m.quote(table)
+	switch m.config.Driver {
+	case "postgres":
+		return []string{"VACUUM (ANALYZE) " + quoted}, nil
+	case "mysql":
+		return []string{"OPTIMIZE TABLE " + quoted}, nil
+	case "sqlite":
+		return []string{"REINDEX " + quoted, "ANALYZE " + quoted}, nil
+	case "sqlserver":
+		return []string{"ALTER INDEX ALL ON " + quoted + " REORGANIZE", "UPDATE STATISTICS " + quoted}, nil
+	default:
+		return nil, fmt.Errorf("db:optimize is not supported for database driver: %s", m.config.Driver)
+	}
+}
+
+// OptimizableTables returns the application's tables, leaving out the
+// database's own
+func (m *Manager) OptimizableTables() ([]string, error) {
+	tables, err := m.db.Migrator().GetTables()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, 0, len(tables))
+	for _, table := range tables {
+		if !strings.HasPrefix(table, "sqlite_") {
+			result = append(result, table)
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// Optimize runs the driver's maintenance statements on a table. Postgres
+// refuses VACUUM inside a transaction, so they run directly on the pool.
+func (m *Manager) Optimize(ctx context.Context, table string) (OptimizeResult, error) {
+	result := OptimizeResult{Table: table}
+	if !m.db.Migrator().HasTable(table) {
+		return result, fmt.Errorf("table %s does not exist", table)
+	}
+	statements, err := m.OptimizeStatements(table)
+	if err != nil {
+		return result, err
+	}
+
+	start := time.Now()
+	for _, stmt := range statements {
+		err := m.runMaintenance(ctx, stmt)
+		result.Duration = time.Since(start)
+		if err != nil {
+			return result, fmt.Errorf("%s: %w", stmt, err)
+		}
+		result.Statements = append(result.Statements, stmt)
+	}
+	return result, nil
+}
+
+// runMaintenance executes stmt and drains any rows it returns. MySQL reports
+// OPTIMIZE TABLE failures as result rows rather than errors.
+func (m *Manager) runMaintenance(ctx context.Context, stmt string) error {
+	rows, err := m.sqlDB.QueryContext(ctx, stmt)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		for i, column := range columns {
+			if strings.EqualFold(column, "Msg_type") && strings.EqualFold(values[i].String, "error") && i+1 < len(columns) {
+				return fmt.Errorf("%s", values[i+1].String)
+			}
+		}
+	}
+	return rows.Err()
+}
+
+func (m *Manager) quote(name string) string {
+	var b strings.Builder
+	m.db.Dialector.QuoteTo(&b, name)
+	return b.String()
+}
+
+// PeakHours are the daily windows when db:optimize holds off so maintenance
+// doesn't compete with traffic
+type PeakHours struct {
+	windows  []peakWindow
+	location *time.Location
+}
+
+// peakWindow is a span of minutes after midnight; end before start wraps
+// past midnight
+type peakWindow struct {
+	start, end int
+	text       string
+}
+
+// NewPeakHours parses database.optimize's "HH:MM-HH:MM" windows in its
+// timezone, or local time when none is set
+func NewPeakHours(cfg config.OptimizeConfig) (*PeakHours, error) {
+	p := &PeakHours{location: time.Local}
+	if cfg.Timezone != "" {
+		location, err := time.LoadLocation(cfg.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid database.optimize.timezone: %w", err)
+		}
+		p.location = location
+	}
+
+	for _, text := range cfg.PeakHours {
+		from, to, ok := strings.Cut(text, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid peak hours %q: expected HH:MM-HH:MM", text)
+		}
+		start, err := parseClock(from)
+		if err != nil {
+			return nil, fmt.Errorf("invalid peak hours %q: %w", text, err)
+		}
+		end, err := parseClock(to)
+		if err != nil {
+			return nil, fmt.Errorf("invalid peak hours %q: %w", text, err)
+		}
+		p.windows = append(p.windows, peakWindow{start: start, end: end, text: strings.TrimSpace(text)})
+	}
+	return p, nil
+}
+
+// Active returns the window t falls in, if any
+func (p *PeakHours) Active(t time.Time) (string, bool) {
+	t = t.In(p.location)
+	minute := t.Hour()*60 + t.Minute()
+	for _, w := range p.windows {
+		inside := minute >= w.start && minute < w.end
+		if w.end <= w.start {
+			inside = minute >= w.start || minute < w.end
+		}
+		if inside {
+			return w.text, true
+		}
+	}
+	return "", false
+}
+
+func parseClock(text string) (int, error) {
+	hours, minutes, ok := strings.Cut(strings.TrimSpace(text), ":")
+	h, err := strconv.Atoi(hours)
+	if !ok || err != nil || h < 0 || h > 24 {
+		return 0, fmt.Errorf("%q is not a time of day", text)
+	}
+	m, err := strconv.Atoi(minutes)
+	if err != nil || m < 0 || m > 59 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("%q is not a time of day", text)
+	}
+	return h*60 + m, nil
+}
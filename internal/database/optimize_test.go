@@ -0,0 +1,89 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+func TestOptimize(t *testing.T) {
+	m := newSQLiteManager(t, config.DatabaseConfig{})
+	require.NoError(t, m.GetDB().AutoMigrate(&item{}))
+	require.NoError(t, m.GetDB().Create(&item{Name: "a"}).Error)
+
+	tables, err := m.OptimizableTables()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"items"}, tables, "SQLite's own tables are left out")
+
+	result, err := m.Optimize(context.Background(), "items")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"REINDEX `items`", "ANALYZE `items`"}, result.Statements)
+	assert.Positive(t, result.Duration)
+
+	var analyzed int64
+	require.NoError(t, m.GetDB().Raw("SELECT count(*) FROM sqlite_stat1 WHERE tbl = 'items'").Scan(&analyzed).Error)
+	assert.Positive(t, analyzed)
+
+	_, err = m.Optimize(context.Background(), "missing; DROP TABLE items")
+	assert.EqualError(t, err, "table missing; DROP TABLE items does not exist")
+}
+
+func TestOptimizeStatements(t *testing.T) {
+	m := newSQLiteManager(t, config.DatabaseConfig{})
+	for driver, want := range map[string][]string{
+		"postgres":  {"VACUUM (ANALYZE) `orders`"},
+		"mysql":     {"OPTIMIZE TABLE `orders`"},
+		"sqlserver": {"ALTER INDEX ALL ON `orders` REORGANIZE", "UPDATE STATISTICS `orders`"},
+	} {
+		m.config.Driver = driver
+		statements, err := m.OptimizeStatements("orders")
+		require.NoError(t, err)
+		assert.Equal(t, want, statements, driver)
+	}
+
+	m.config.Driver = "clickhouse"
+	_, err := m.OptimizeStatements("orders")
+	assert.Error(t, err)
+}
+
+func TestPeakHours(t *testing.T) {
+	peak, err := NewPeakHours(config.OptimizeConfig{PeakHours: []string{"08:00-12:30", "22:00-02:00"}, Timezone: "Africa/Nairobi"})
+	require.NoError(t, err)
+
+	nairobi, err := time.LoadLocation("Africa/Nairobi")
+	require.NoError(t, err)
+	at := func(hour, minute int) time.Time { return time.Date(2024, 5, 1, hour, minute, 0, 0, nairobi) }
+
+	window, ok := peak.Active(at(9, 0))
+	assert.True(t, ok)
+	assert.Equal(t, "08:00-12:30", window)
+	_, ok = peak.Active(at(12, 30))
+	assert.False(t, ok, "windows end exclusively")
+	_, ok = peak.Active(at(23, 15))
+	assert.True(t, ok, "windows wrap past midnight")
+	_, ok = peak.Active(at(1, 59))
+	assert.True(t, ok)
+	_, ok = peak.Active(at(3, 0))
+	assert.False(t, ok)
+
+	// Times are compared in the configured timezone
+	_, ok = peak.Active(time.Date(2024, 5, 1, 6, 0, 0, 0, time.UTC))
+	assert.True(t, ok, "06:00 UTC is 09:00 in Nairobi")
+
+	none, err := NewPeakHours(config.OptimizeConfig{})
+	require.NoError(t, err)
+	_, ok = none.Active(time.Now())
+	assert.False(t, ok)
+
+	for _, bad := range []string{"8-20", "08:00", "25:00-26:00", "08:60-09:00"} {
+		_, err := NewPeakHours(config.OptimizeConfig{PeakHours: []string{bad}})
+		assert.Error(t, err, bad)
+	}
+	_, err = NewPeakHours(config.OptimizeConfig{Timezone: "Mars/Olympus"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,235 @@
+package database
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// QueryRecord is one statement seen by the query log
+type QueryRecord struct {
+	SQL      string        `json:"sql"`
+	Duration time.Duration `json:"duration"`
+	Rows     int64         `json:"rows"`
+	Error    string        `json:"error,omitempty"`
+	Slow     bool          `json:"slow"`
+	Time     time.Time     `json:"time"`
+}
+
+// QueryLog is a GORM plugin that times every statement and keeps the most
+// recent ones, flagging those slower than the threshold
+type QueryLog struct {
+	threshold time.Duration
+	size      int
+
+	// OnSlow, when set, is called for each slow query
+	OnSlow func(QueryRecord)
+
+	mu      sync.RWMutex
+	records []QueryRecord
+	next    int
+	total   int64
+	slow    int64
+}
+
+var _ gorm.Plugin = (*QueryLog)(nil)
+
+const queryStartKey = "dolphin:query_start"
+
+// NewQueryLog keeps the last size queries and flags those taking longer
+// than threshold; a zero threshold flags nothing
+func NewQueryLog(size int, threshold time.Duration) *QueryLog {
+	if size <= 0 {
+		size = 200
+	}
+	return &QueryLog{threshold: threshold, size: size}
+}
+
+// Name implements gorm.Plugin
+func (l *QueryLog) Name() string {
+	return "dolphin:query_log"
+}
+
+// Initialize implements gorm.Plugin by wrapping every callback chain
+func (l *QueryLog) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	chains := []struct {
+		name     string
+		register func(before, after string) error
+	}{
+		{"create", func(b, a string) error {
+			if err := cb.Create().Before("gorm:create").Register(b, l.before); err != nil {
+				return err
+			}
+			return cb.Create().After("gorm:create").Register(a, l.after)
+		}},
+		{"query", func(b, a string) error {
+			if err := cb.Query().Before("gorm:query").Register(b, l.before); err != nil {
+				return err
+			}
+			return cb.Query().After("gorm:query").Register(a, l.after)
+		}},
+		{"update", func(b, a string) error {
+			if err := cb.Update().Before("gorm:update").Register(b, l.before); err != nil {
+				return err
+			}
+			return cb.Update().After("gorm:update").Register(a, l.after)
+		}},
+		{"delete", func(b, a string) error {
+			if err := cb.Delete().Before("gorm:delete").Register(b, l.before); err != nil {
+				return err
+			}
+			return cb.Delete().After("gorm:delete").Register(a, l.after)
+		}},
+		{"row", func(b, a string) error {
+			if err := cb.Row().Before("gorm:row").Register(b, l.before); err != nil {
+				return err
+			}
+			return cb.Row().After("gorm:row").Register(a, l.after)
+		}},
+		{"raw", func(b, a string) error {
+			if err := cb.Raw().Before("gorm:raw").Register(b, l.before); err != nil {
+				return err
+			}
+			return cb.Raw().After("gorm:raw").Register(a, l.after)
+		}},
+	}
+
+	for _, c := range chains {
+		if err := c.register("dolphin:query_log_before_"+c.name, "dolphin:query_log_after_"+c.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *QueryLog) before(db *gorm.DB) {
+	db.InstanceSet(queryStartKey, time.Now())
+}
+
+func (l *QueryLog) after(db *gorm.DB) {
+	value, ok := db.InstanceGet(queryStartKey)
+	if !ok {
+		return
+	}
+	start := value.(time.Time)
+
+	sql := db.Statement.SQL.String()
+	if sql == "" {
+		return
+	}
+
+	record := QueryRecord{
+		SQL:      db.Dialector.Explain(sql, db.Statement.Vars...),
+		Duration: time.Since(start),
+		Rows:     db.RowsAffected,
+		Time:     start,
+	}
+	if db.Error != nil {
+		record.Error = db.Error.Error()
+	}
+	record.Slow = l.threshold > 0 && record.Duration >= l.threshold
+
+	l.add(record)
+	if ctx := db.Statement.Context; ctx != nil {
+		if c, ok := ctx.Value(queryCollectorKey{}).(*QueryCollector); ok {
+			c.add(record)
+		}
+	}
+
+	if record.Slow && l.OnSlow != nil {
+		l.OnSlow(record)
+	}
+}
+
+func (l *QueryLog) add(record QueryRecord) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.records) < l.size {
+		l.records = append(l.records, record)
+	} else {
+		l.records[l.next] = record
+	}
+	l.next = (l.next + 1) % l.size
+	l.total++
+	if record.Slow {
+		l.slow++
+	}
+}
+
+// Recent returns the logged queries, newest first
+func (l *QueryLog) Recent() []QueryRecord {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	result := make([]QueryRecord, 0, len(l.records))
+	for i := 1; i <= len(l.records); i++ {
+		result = append(result, l.records[(l.next-i+len(l.records))%len(l.records)])
+	}
+	return result
+}
+
+// Slow returns the logged queries over the threshold, newest first
+func (l *QueryLog) Slow() []QueryRecord {
+	var result []QueryRecord
+	for _, r := range l.Recent() {
+		if r.Slow {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+// Counts returns how many queries and slow queries were seen in total
+func (l *QueryLog) Counts() (total, slow int64) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.total, l.slow
+}
+
+// Threshold returns the slow query threshold
+func (l *QueryLog) Threshold() time.Duration {
+	return l.threshold
+}
+
+// Reset clears the log
+func (l *QueryLog) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.records = nil
+	l.next = 0
+	l.total = 0
+	l.slow = 0
+}
+
+type queryCollectorKey struct{}
+
+// QueryCollector gathers the queries run with one context, such as those of
+// a single request, in addition to the query log
+type QueryCollector struct {
+	mu      sync.Mutex
+	queries []QueryRecord
+}
+
+// CollectQueries returns a context whose queries are also passed to the
+// returned collector. Queries only reach it through db.WithContext.
+func CollectQueries(ctx context.Context) (context.Context, *QueryCollector) {
+	c := &QueryCollector{}
+	return context.WithValue(ctx, queryCollectorKey{}, c), c
+}
+
+func (c *QueryCollector) add(record QueryRecord) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.queries = append(c.queries, record)
+}
+
+// Queries returns the collected queries in the order they ran
+func (c *QueryCollector) Queries() []QueryRecord {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]QueryRecord(nil), c.queries...)
+}
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+func newSQLiteManager(t *testing.T, cfg config.DatabaseConfig) *Manager {
+	t.Helper()
+	cfg.Driver = "sqlite"
+	cfg.Database = filepath.Join(t.TempDir(), "app.db")
+	m, err := New(&cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+func TestQueryLogRecordsQueries(t *testing.T) {
+	m := newSQLiteManager(t, config.DatabaseConfig{QueryLogSize: 2})
+	require.NoError(t, m.GetDB().AutoMigrate(&item{}))
+	require.NoError(t, m.GetDB().Create(&item{Name: "a"}).Error)
+
+	var got item
+	require.NoError(t, m.GetDB().Where("name = ?", "a").First(&got).Error)
+
+	recent := m.QueryLog().Recent()
+	require.Len(t, recent, 2)
+	assert.Contains(t, recent[0].SQL, `name = "a"`)
+	assert.True(t, strings.HasPrefix(recent[1].SQL, "INSERT"))
+	assert.False(t, recent[0].Slow)
+
+	total, _ := m.QueryLog().Counts()
+	assert.GreaterOrEqual(t, total, int64(2))
+}
+
+func TestQueryLogFlagsSlowQueries(t *testing.T) {
+	m := newSQLiteManager(t, config.DatabaseConfig{SlowQueryThreshold: time.Nanosecond})
+	var flagged []QueryRecord
+	m.QueryLog().OnSlow = func(r QueryRecord) { flagged = append(flagged, r) }
+
+	var n int
+	require.NoError(t, m.GetDB().Raw("SELECT 1").Scan(&n).Error)
+
+	require.Len(t, flagged, 1)
+	assert.Equal(t, "SELECT 1", flagged[0].SQL)
+	assert.Equal(t, flagged, m.QueryLog().Slow())
+}
+
+func TestCollectQueries(t *testing.T) {
+	m := newSQLiteManager(t, config.DatabaseConfig{})
+	require.NoError(t, m.GetDB().AutoMigrate(&item{}))
+
+	ctx, collector := CollectQueries(context.Background())
+	require.NoError(t, m.GetDB().WithContext(ctx).Create(&item{Name: "a"}).Error)
+	var n int64
+	require.NoError(t, m.GetDB().Model(&item{}).Count(&n).Error)
+
+	queries := collector.Queries()
+	require.Len(t, queries, 1, "queries without the context are not collected")
+	assert.True(t, strings.HasPrefix(queries[0].SQL, "INSERT"))
+}
+
+func TestExplainSQLite(t *testing.T) {
+	m := newSQLiteManager(t, config.DatabaseConfig{})
+	require.NoError(t, m.GetDB().AutoMigrate(&item{}))
+
+	plan, err := m.Explain(context.Background(), "SELECT * FROM items WHERE id = 1;", true)
+	require.NoError(t, err)
+	assert.False(t, plan.Analyze)
+	assert.Contains(t, plan.String(), "└─ SEARCH items")
+}
@@ -0,0 +1,330 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Connection role labels used in metrics and stats
+const (
+	RolePrimary = "primary"
+	RoleReplica = "replica"
+)
+
+var (
+	queriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dolphin_db_queries_total",
+		Help: "Statements sent to each database connection, by kind (read or write)",
+	}, []string{"connection", "kind"})
+
+	replicaUp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "dolphin_db_replica_up",
+		Help: "Whether a read replica passed its last health check (1) or not (0)",
+	}, []string{"replica"})
+
+	replicaFailovers = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dolphin_db_replica_failovers_total",
+		Help: "Reads sent to the primary because no replica was healthy",
+	})
+)
+
+// replica is a read-only connection and the result of its last health check
+type replica struct {
+	name    string
+	sqlDB   *sql.DB
+	healthy atomic.Bool
+	reads   atomic.Int64
+}
+
+// ConnectionStats reports usage of one connection
+type ConnectionStats struct {
+	Name    string      `json:"name"`
+	Role    string      `json:"role"`
+	Healthy bool        `json:"healthy"`
+	Reads   int64       `json:"reads"`
+	Writes  int64       `json:"writes"`
+	Pool    sql.DBStats `json:"pool"`
+}
+
+// connectReplicas opens the configured replicas and installs the callbacks
+// that route reads to them
+func (m *Manager) connectReplicas() error {
+	if len(m.config.Replicas) == 0 {
+		return nil
+	}
+
+	for i, rc := range m.config.Replicas {
+		name := rc.Name
+		if name == "" {
+			name = fmt.Sprintf("replica-%d", i+1)
+		}
+
+		dialector, err := m.dialector(
+			firstNonEmpty(rc.Host, m.config.Host),
+			firstNonZero(rc.Port, m.config.Port),
+			firstNonEmpty(rc.Database, m.config.Database),
+			firstNonEmpty(rc.Username, m.config.Username),
+			firstNonEmpty(rc.Password, m.config.Password),
+		)
+		if err != nil {
+			return err
+		}
+
+		// A replica that is down at boot must not stop the app; the health
+		// check below marks it unhealthy and reads stay on the primary
+		gdb, err := gorm.Open(dialector, &gorm.Config{
+			Logger:               logger.Default.LogMode(logger.Silent),
+			DisableAutomaticPing: true,
+		})
+		if err != nil {
+			return fmt.Errorf("replica %s: %w", name, err)
+		}
+		sqlDB, err := gdb.DB()
+		if err != nil {
+			return fmt.Errorf("replica %s: %w", name, err)
+		}
+		m.configurePool(sqlDB)
+
+		m.replicas = append(m.replicas, &replica{name: name, sqlDB: sqlDB})
+	}
+
+	m.CheckReplicas(context.Background())
+
+	if err := m.registerRouting(); err != nil {
+		return err
+	}
+
+	interval := m.config.ReplicaHealthInterval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	go m.monitorReplicas(interval)
+
+	return nil
+}
+
+// registerRouting hooks read/write routing into GORM's callback chains
+func (m *Manager) registerRouting() error {
+	cb := m.db.Callback()
+	if err := cb.Query().Before("gorm:query").Register("dolphin:route_read", m.routeRead); err != nil {
+		return err
+	}
+	if err := cb.Row().Before("gorm:row").Register("dolphin:route_read", m.routeRead); err != nil {
+		return err
+	}
+	if err := cb.Raw().Before("gorm:raw").Register("dolphin:route_raw", m.routeRaw); err != nil {
+		return err
+	}
+	if err := cb.Create().Before("gorm:create").Register("dolphin:route_write", m.routeWrite); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register("dolphin:route_write", m.routeWrite); err != nil {
+		return err
+	}
+	return cb.Delete().Before("gorm:delete").Register("dolphin:route_write", m.routeWrite)
+}
+
+// routeRead sends a read to a healthy replica unless it must see the primary
+func (m *Manager) routeRead(db *gorm.DB) {
+	stmt := db.Statement
+	if inTransaction(stmt) || isSticky(stmt.Context) {
+		m.countPrimaryRead()
+		return
+	}
+	// SELECT ... FOR UPDATE and raw non-SELECT statements belong on the primary
+	if _, locking := stmt.Clauses["FOR"]; locking {
+		m.countPrimaryRead()
+		return
+	}
+	if sql := stmt.SQL.String(); sql != "" && !isReadSQL(sql) {
+		m.routeWrite(db)
+		return
+	}
+
+	r := m.pickReplica()
+	if r == nil {
+		m.countPrimaryRead()
+		return
+	}
+	stmt.ConnPool = r.sqlDB
+	r.reads.Add(1)
+	queriesTotal.WithLabelValues(r.name, "read").Inc()
+}
+
+// routeRaw handles Exec, which may carry either kind of statement
+func (m *Manager) routeRaw(db *gorm.DB) {
+	if isReadSQL(db.Statement.SQL.String()) {
+		m.routeRead(db)
+		return
+	}
+	m.routeWrite(db)
+}
+
+// routeWrite leaves the statement on the primary and makes the rest of the
+// request read from the primary too, so it sees its own writes
+func (m *Manager) routeWrite(db *gorm.DB) {
+	markWritten(db.Statement.Context)
+	m.primaryWrites.Add(1)
+	queriesTotal.WithLabelValues(RolePrimary, "write").Inc()
+}
+
+func (m *Manager) countPrimaryRead() {
+	m.primaryReads.Add(1)
+	queriesTotal.WithLabelValues(RolePrimary, "read").Inc()
+}
+
+// pickReplica returns the next healthy replica round-robin, or nil when all
+// are down and reads fail over to the primary
+func (m *Manager) pickReplica() *replica {
+	n := len(m.replicas)
+	start := m.next.Add(1)
+	for i := 0; i < n; i++ {
+		r := m.replicas[(int(start)+i)%n]
+		if r.healthy.Load() {
+			return r
+		}
+	}
+	replicaFailovers.Inc()
+	return nil
+}
+
+// CheckReplicas pings every replica once and records the result
+func (m *Manager) CheckReplicas(ctx context.Context) {
+	for _, r := range m.replicas {
+		pingCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		err := r.sqlDB.PingContext(pingCtx)
+		cancel()
+
+		r.healthy.Store(err == nil)
+		if err == nil {
+			replicaUp.WithLabelValues(r.name).Set(1)
+		} else {
+			replicaUp.WithLabelValues(r.name).Set(0)
+		}
+	}
+}
+
+// monitorReplicas re-checks replica health until the manager is closed
+func (m *Manager) monitorReplicas(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.CheckReplicas(context.Background())
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// Stats returns per-connection usage for the primary and each replica
+func (m *Manager) Stats() []ConnectionStats {
+	stats := []ConnectionStats{{
+		Name:    RolePrimary,
+		Role:    RolePrimary,
+		Healthy: true,
+		Reads:   m.primaryReads.Load(),
+		Writes:  m.primaryWrites.Load(),
+		Pool:    m.sqlDB.Stats(),
+	}}
+	for _, r := range m.replicas {
+		stats = append(stats, ConnectionStats{
+			Name:    r.name,
+			Role:    RoleReplica,
+			Healthy: r.healthy.Load(),
+			Reads:   r.reads.Load(),
+			Pool:    r.sqlDB.Stats(),
+		})
+	}
+	return stats
+}
+
+// stickyKey is the context key for the per-request write marker
+type stickyKey struct{}
+
+// WithSticky returns a context in which reads go to the primary once any
+// write has been made with it
+func WithSticky(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(stickyKey{}).(*atomic.Bool); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, stickyKey{}, new(atomic.Bool))
+}
+
+// MarkWritten pins the rest of a sticky context to the primary, e.g. after
+// a write made outside GORM
+func MarkWritten(ctx context.Context) {
+	markWritten(ctx)
+}
+
+// StickyMiddleware scopes read-your-writes to each HTTP request. Handlers
+// must pass r.Context() to GORM via WithContext for it to take effect.
+func StickyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(WithSticky(r.Context())))
+	})
+}
+
+func markWritten(ctx context.Context) {
+	if ctx == nil {
+		return
+	}
+	if written, ok := ctx.Value(stickyKey{}).(*atomic.Bool); ok {
+		written.Store(true)
+	}
+}
+
+func isSticky(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	written, ok := ctx.Value(stickyKey{}).(*atomic.Bool)
+	return ok && written.Load()
+}
+
+// inTransaction reports whether the statement runs inside a transaction,
+// which must stay on the connection that opened it
+func inTransaction(stmt *gorm.Statement) bool {
+	_, ok := stmt.ConnPool.(gorm.TxCommitter)
+	return ok
+}
+
+// isReadSQL reports whether a raw statement only reads
+func isReadSQL(sql string) bool {
+	sql = strings.ToUpper(strings.TrimSpace(sql))
+	if strings.Contains(sql, " FOR UPDATE") || strings.Contains(sql, " FOR SHARE") {
+		return false
+	}
+	return strings.HasPrefix(sql, "SELECT") || strings.HasPrefix(sql, "SHOW") ||
+		strings.HasPrefix(sql, "EXPLAIN")
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func firstNonZero[T int | time.Duration](values ...T) T {
+	for _, v := range values {
+		if v != 0 {
+			return v
+		}
+	}
+	return 0
+}
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+type item struct {
+	ID   uint
+	Name string
+}
+
+// newReplicatedManager opens a primary and a replica as separate SQLite
+// files seeded with different rows, so a read shows where it was routed
+func newReplicatedManager(t *testing.T) *Manager {
+	t.Helper()
+	dir := t.TempDir()
+
+	m, err := New(&config.DatabaseConfig{
+		Driver:   "sqlite",
+		Database: filepath.Join(dir, "primary.db"),
+		MaxOpen:  1,
+		MaxIdle:  1,
+		Replicas: []config.ReplicaConfig{{Name: "r1", Database: filepath.Join(dir, "replica.db")}},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { m.Close() })
+
+	require.NoError(t, m.GetDB().AutoMigrate(&item{}))
+	_, err = m.replicas[0].sqlDB.Exec("CREATE TABLE items (id integer primary key, name text)")
+	require.NoError(t, err)
+	_, err = m.replicas[0].sqlDB.Exec("INSERT INTO items (id, name) VALUES (1, 'replica')")
+	require.NoError(t, err)
+	require.NoError(t, m.GetDB().Create(&item{ID: 1, Name: "primary"}).Error)
+
+	return m
+}
+
+func TestReadsGoToReplica(t *testing.T) {
+	m := newReplicatedManager(t)
+
+	var got item
+	require.NoError(t, m.GetDB().First(&got, 1).Error)
+	assert.Equal(t, "replica", got.Name)
+
+	var name string
+	require.NoError(t, m.GetDB().Raw("SELECT name FROM items WHERE id = 1").Scan(&name).Error)
+	assert.Equal(t, "replica", name)
+}
+
+func TestStickyAfterWrite(t *testing.T) {
+	m := newReplicatedManager(t)
+	ctx := WithSticky(context.Background())
+
+	var got item
+	require.NoError(t, m.GetDB().WithContext(ctx).First(&got, 1).Error)
+	assert.Equal(t, "replica", got.Name)
+
+	require.NoError(t, m.GetDB().WithContext(ctx).Create(&item{ID: 2, Name: "new"}).Error)
+
+	got = item{}
+	require.NoError(t, m.GetDB().WithContext(ctx).First(&got, 1).Error)
+	assert.Equal(t, "primary", got.Name)
+
+	// Other requests keep reading from the replica
+	got = item{}
+	require.NoError(t, m.GetDB().WithContext(WithSticky(context.Background())).First(&got, 1).Error)
+	assert.Equal(t, "replica", got.Name)
+}
+
+func TestFailoverToPrimary(t *testing.T) {
+	m := newReplicatedManager(t)
+	m.replicas[0].healthy.Store(false)
+
+	var got item
+	require.NoError(t, m.GetDB().First(&got, 1).Error)
+	assert.Equal(t, "primary", got.Name)
+
+	stats := m.Stats()
+	require.Len(t, stats, 2)
+	assert.Equal(t, RolePrimary, stats[0].Role)
+	assert.NotZero(t, stats[0].Reads)
+	assert.False(t, stats[1].Healthy)
+}
+
+func TestIsReadSQL(t *testing.T) {
+	assert.True(t, isReadSQL("  select * from users"))
+	assert.False(t, isReadSQL("SELECT * FROM users FOR UPDATE"))
+	assert.False(t, isReadSQL("UPDATE users SET name = 'x'"))
+}
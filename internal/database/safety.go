@@ -0,0 +1,119 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	raptor "github.com/mrhoseah/raptor/core"
+)
+
+// DataLoss describes rows a Down migration would destroy
+type DataLoss struct {
+	Migration string
+	Table     string
+	Column    string // empty when the whole table is dropped
+	Rows      int64
+}
+
+func (d DataLoss) String() string {
+	if d.Column == "" {
+		return fmt.Sprintf("%s drops table %s (%d rows)", d.Migration, d.Table, d.Rows)
+	}
+	return fmt.Sprintf("%s drops column %s.%s (%d non-null values)", d.Migration, d.Table, d.Column, d.Rows)
+}
+
+// DataLossError is returned when a rollback would destroy data and
+// ForceDataLoss is not set
+type DataLossError struct {
+	Losses []DataLoss
+}
+
+func (e *DataLossError) Error() string {
+	lines := make([]string, len(e.Losses))
+	for i, loss := range e.Losses {
+		lines[i] = "  " + loss.String()
+	}
+	return "rollback would destroy data (use --force-data-loss to proceed):\n" + strings.Join(lines, "\n")
+}
+
+// drop is a destructive operation captured from a Down migration
+type drop struct {
+	table  string
+	column string
+}
+
+// recordingSchema stands in for the real schema while a Down migration is
+// dry-run, noting drops and executing nothing
+type recordingSchema struct {
+	drops []drop
+}
+
+var _ SchemaBuilder = (*recordingSchema)(nil)
+
+func (s *recordingSchema) CreateTable(name string, columns []string) error { return nil }
+
+func (s *recordingSchema) DropTable(name string) error {
+	s.drops = append(s.drops, drop{table: name})
+	return nil
+}
+
+func (s *recordingSchema) AddColumn(table, column, definition string) error { return nil }
+
+func (s *recordingSchema) DropColumn(table, column string) error {
+	s.drops = append(s.drops, drop{table: table, column: column})
+	return nil
+}
+
+func (s *recordingSchema) RenameColumn(table, oldName, newName string) error         { return nil }
+func (s *recordingSchema) ChangeColumn(table, column, definition string) error       { return nil }
+func (s *recordingSchema) AddIndex(table, name string, columns []string) error       { return nil }
+func (s *recordingSchema) AddUniqueIndex(table, name string, columns []string) error { return nil }
+func (s *recordingSchema) DropIndex(table, name string) error                        { return nil }
+
+func (s *recordingSchema) AddForeignKey(table, name, column, refTable, refColumn string) error {
+	return nil
+}
+
+func (s *recordingSchema) DropForeignKey(table, name string) error { return nil }
+
+func (s *recordingSchema) Builder() *Builder {
+	return &Builder{
+		dialect: genericDialect,
+		exec:    func(string) error { return nil },
+		onDrop: func(table, column string) {
+			s.drops = append(s.drops, drop{table: table, column: column})
+		},
+	}
+}
+
+// AnalyzeDown dry-runs a migration's Down and reports every dropped table or
+// column that still holds data. Tables that don't exist are skipped.
+func (m *Migrator) AnalyzeDown(migration raptor.Migration) ([]DataLoss, error) {
+	recorder := &recordingSchema{}
+	if err := migration.Down(recorder); err != nil {
+		return nil, fmt.Errorf("analyze %s: %w", migration.Name(), err)
+	}
+
+	var losses []DataLoss
+	for _, d := range recorder.drops {
+		var query string
+		if d.column == "" {
+			query = fmt.Sprintf("SELECT COUNT(*) FROM %s", d.table)
+		} else {
+			query = fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s IS NOT NULL", d.table, d.column)
+		}
+
+		var rows int64
+		if err := m.db.QueryRow(query).Scan(&rows); err != nil || rows == 0 {
+			continue
+		}
+		losses = append(losses, DataLoss{
+			Migration: migration.Name(),
+			Table:     d.table,
+			Column:    d.column,
+			Rows:      rows,
+		})
+	}
+
+	return losses, nil
+}
@@ -0,0 +1,54 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	raptor "github.com/mrhoseah/raptor/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type dropMigration struct{}
+
+func (dropMigration) Name() string             { return "20250101000000_create_posts" }
+func (dropMigration) Up(s raptor.Schema) error { return nil }
+
+func (dropMigration) Down(s raptor.Schema) error {
+	if err := s.(interface{ DropColumn(string, string) error }).DropColumn("users", "nickname"); err != nil {
+		return err
+	}
+	if err := s.DropTable("posts"); err != nil {
+		return err
+	}
+	return s.DropTable("missing")
+}
+
+func TestAnalyzeDownReportsData(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "app.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	for _, stmt := range []string{
+		"CREATE TABLE users (id integer primary key, nickname text)",
+		"INSERT INTO users (id, nickname) VALUES (1, 'fin'), (2, NULL)",
+		"CREATE TABLE posts (id integer primary key)",
+		"INSERT INTO posts (id) VALUES (1), (2), (3)",
+	} {
+		_, err := db.Exec(stmt)
+		require.NoError(t, err)
+	}
+
+	losses, err := NewMigrator(db, "migrations").AnalyzeDown(dropMigration{})
+	require.NoError(t, err)
+	require.Len(t, losses, 2)
+	assert.Equal(t, DataLoss{Migration: dropMigration{}.Name(), Table: "users", Column: "nickname", Rows: 1}, losses[0])
+	assert.Equal(t, DataLoss{Migration: dropMigration{}.Name(), Table: "posts", Rows: 3}, losses[1])
+
+	// Nothing was actually dropped
+	var count int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM posts").Scan(&count))
+	assert.Equal(t, 3, count)
+}
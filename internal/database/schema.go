@@ -8,12 +8,91 @@ import (
 	raptor "github.com/mrhoseah/raptor/core"
 )
 
+// SchemaBuilder is raptor.Schema plus the ALTER operations the dolphin
+// schemas provide. Generated migrations type-assert the schema they are
+// given to reach them.
+type SchemaBuilder interface {
+	raptor.Schema
+	AddColumn(table, column, definition string) error
+	DropColumn(table, column string) error
+	RenameColumn(table, oldName, newName string) error
+	ChangeColumn(table, column, definition string) error
+	AddIndex(table, name string, columns []string) error
+	AddUniqueIndex(table, name string, columns []string) error
+	DropIndex(table, name string) error
+	AddForeignKey(table, name, column, refTable, refColumn string) error
+	DropForeignKey(table, name string) error
+
+	// Builder returns the fluent table builder for the schema's dialect
+	Builder() *Builder
+}
+
+// pretender lets a schema collect the statements it would run instead of
+// running them, for dry runs
+type pretender struct {
+	pretend bool
+	queries []string
+}
+
+func (p *pretender) exec(db *sql.DB, query string) error {
+	if p.pretend {
+		p.queries = append(p.queries, query)
+		return nil
+	}
+	_, err := db.Exec(query)
+	return err
+}
+
+// SchemaFor returns the schema for a database driver
+func SchemaFor(driver string, db *sql.DB) SchemaBuilder {
+	b, _ := schemaFor(driver, db)
+	return b
+}
+
+func schemaFor(driver string, db *sql.DB) (SchemaBuilder, *pretender) {
+	switch driver {
+	case "postgres":
+		s := &PostgresSchema{DB: db}
+		return s, &s.pretender
+	case "mysql":
+		s := &MySQLSchema{DB: db}
+		return s, &s.pretender
+	case "sqlite":
+		s := &SQLiteSchema{DB: db}
+		return s, &s.pretender
+	case "sqlserver":
+		s := &SQLServerSchema{DB: db}
+		return s, &s.pretender
+	default:
+		s := &GenericSchema{DB: db}
+		return s, &s.pretender
+	}
+}
+
+// Pretend returns the SQL the steps would run on the driver without
+// touching a database
+func Pretend(driver string, steps []SchemaStep) ([]string, error) {
+	b, p := schemaFor(driver, nil)
+	p.pretend = true
+	for _, step := range steps {
+		if err := step.Apply(b); err != nil {
+			return p.queries, err
+		}
+	}
+	return p.queries, nil
+}
+
 // PostgresSchema implements raptor.Schema for PostgreSQL
 type PostgresSchema struct {
 	DB *sql.DB
+	pretender
 }
 
-var _ raptor.Schema = (*PostgresSchema)(nil)
+var _ SchemaBuilder = (*PostgresSchema)(nil)
+
+func (s *PostgresSchema) Builder() *Builder {
+	return &Builder{dialect: postgresDialect, exec: func(query string) error { return s.exec(s.DB, query) }}
+}
 
 func (s *PostgresSchema) CreateTable(name string, columns []string) error {
 	if len(columns) == 0 {
@@ -40,71 +119,71 @@ func (s *PostgresSchema) CreateTable(name string, columns []string) error {
 	}
 
 	query := fmt.Sprintf("CREATE TABLE %s (%s)", name, strings.Join(columnDefs, ", "))
-	_, err := s.DB.Exec(query)
-	return err
+	return s.exec(s.DB, query)
 }
 
 func (s *PostgresSchema) DropTable(name string) error {
 	query := fmt.Sprintf("DROP TABLE IF EXISTS %s", name)
-	_, err := s.DB.Exec(query)
-	return err
+	return s.exec(s.DB, query)
 }
 
 func (s *PostgresSchema) AddColumn(table, column, definition string) error {
 	query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)
-	_, err := s.DB.Exec(query)
-	return err
+	return s.exec(s.DB, query)
 }
 
 func (s *PostgresSchema) DropColumn(table, column string) error {
 	query := fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", table, column)
-	_, err := s.DB.Exec(query)
-	return err
+	return s.exec(s.DB, query)
 }
 
 func (s *PostgresSchema) RenameColumn(table, oldName, newName string) error {
 	query := fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s", table, oldName, newName)
-	_, err := s.DB.Exec(query)
-	return err
+	return s.exec(s.DB, query)
 }
 
 func (s *PostgresSchema) ChangeColumn(table, column, definition string) error {
 	query := fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE %s", table, column, definition)
-	_, err := s.DB.Exec(query)
-	return err
+	return s.exec(s.DB, query)
 }
 
 func (s *PostgresSchema) AddIndex(table, name string, columns []string) error {
 	query := fmt.Sprintf("CREATE INDEX %s ON %s (%s)", name, table, strings.Join(columns, ", "))
-	_, err := s.DB.Exec(query)
-	return err
+	return s.exec(s.DB, query)
+}
+
+func (s *PostgresSchema) AddUniqueIndex(table, name string, columns []string) error {
+	query := fmt.Sprintf("CREATE UNIQUE INDEX %s ON %s (%s)", name, table, strings.Join(columns, ", "))
+	return s.exec(s.DB, query)
 }
 
 func (s *PostgresSchema) DropIndex(table, name string) error {
 	query := fmt.Sprintf("DROP INDEX IF EXISTS %s", name)
-	_, err := s.DB.Exec(query)
-	return err
+	return s.exec(s.DB, query)
 }
 
 func (s *PostgresSchema) AddForeignKey(table, name, column, refTable, refColumn string) error {
 	query := fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s (%s)",
 		table, name, column, refTable, refColumn)
-	_, err := s.DB.Exec(query)
-	return err
+	return s.exec(s.DB, query)
 }
 
 func (s *PostgresSchema) DropForeignKey(table, name string) error {
 	query := fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", table, name)
-	_, err := s.DB.Exec(query)
-	return err
+	return s.exec(s.DB, query)
 }
 
 // MySQLSchema implements raptor.Schema for MySQL
 type MySQLSchema struct {
 	DB *sql.DB
+	pretender
 }
 
-var _ raptor.Schema = (*MySQLSchema)(nil)
+var _ SchemaBuilder = (*MySQLSchema)(nil)
+
+func (s *MySQLSchema) Builder() *Builder {
+	return &Builder{dialect: mysqlDialect, exec: func(query string) error { return s.exec(s.DB, query) }}
+}
 
 func (s *MySQLSchema) CreateTable(name string, columns []string) error {
 	if len(columns) == 0 {
@@ -131,71 +210,71 @@ func (s *MySQLSchema) CreateTable(name string, columns []string) error {
 	}
 
 	query := fmt.Sprintf("CREATE TABLE %s (%s) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4", name, strings.Join(columnDefs, ", "))
-	_, err := s.DB.Exec(query)
-	return err
+	return s.exec(s.DB, query)
 }
 
 func (s *MySQLSchema) DropTable(name string) error {
 	query := fmt.Sprintf("DROP TABLE IF EXISTS %s", name)
-	_, err := s.DB.Exec(query)
-	return err
+	return s.exec(s.DB, query)
 }
 
 func (s *MySQLSchema) AddColumn(table, column, definition string) error {
 	query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)
-	_, err := s.DB.Exec(query)
-	return err
+	return s.exec(s.DB, query)
 }
 
 func (s *MySQLSchema) DropColumn(table, column string) error {
 	query := fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", table, column)
-	_, err := s.DB.Exec(query)
-	return err
+	return s.exec(s.DB, query)
 }
 
 func (s *MySQLSchema) RenameColumn(table, oldName, newName string) error {
 	query := fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s", table, oldName, newName)
-	_, err := s.DB.Exec(query)
-	return err
+	return s.exec(s.DB, query)
 }
 
 func (s *MySQLSchema) ChangeColumn(table, column, definition string) error {
 	query := fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s %s", table, column, definition)
-	_, err := s.DB.Exec(query)
-	return err
+	return s.exec(s.DB, query)
 }
 
 func (s *MySQLSchema) AddIndex(table, name string, columns []string) error {
 	query := fmt.Sprintf("CREATE INDEX %s ON %s (%s)", name, table, strings.Join(columns, ", "))
-	_, err := s.DB.Exec(query)
-	return err
+	return s.exec(s.DB, query)
+}
+
+func (s *MySQLSchema) AddUniqueIndex(table, name string, columns []string) error {
+	query := fmt.Sprintf("CREATE UNIQUE INDEX %s ON %s (%s)", name, table, strings.Join(columns, ", "))
+	return s.exec(s.DB, query)
 }
 
 func (s *MySQLSchema) DropIndex(table, name string) error {
 	query := fmt.Sprintf("DROP INDEX %s ON %s", name, table)
-	_, err := s.DB.Exec(query)
-	return err
+	return s.exec(s.DB, query)
 }
 
 func (s *MySQLSchema) AddForeignKey(table, name, column, refTable, refColumn string) error {
 	query := fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s (%s)",
 		table, name, column, refTable, refColumn)
-	_, err := s.DB.Exec(query)
-	return err
+	return s.exec(s.DB, query)
 }
 
 func (s *MySQLSchema) DropForeignKey(table, name string) error {
 	query := fmt.Sprintf("ALTER TABLE %s DROP FOREIGN KEY %s", table, name)
-	_, err := s.DB.Exec(query)
-	return err
+	return s.exec(s.DB, query)
 }
 
 // SQLiteSchema implements raptor.Schema for SQLite
 type SQLiteSchema struct {
 	DB *sql.DB
+	pretender
 }
 
-var _ raptor.Schema = (*SQLiteSchema)(nil)
+var _ SchemaBuilder = (*SQLiteSchema)(nil)
+
+func (s *SQLiteSchema) Builder() *Builder {
+	return &Builder{dialect: sqliteDialect, exec: func(query string) error { return s.exec(s.DB, query) }}
+}
 
 func (s *SQLiteSchema) CreateTable(name string, columns []string) error {
 	if len(columns) == 0 {
@@ -222,20 +301,17 @@ func (s *SQLiteSchema) CreateTable(name string, columns []string) error {
 	}
 
 	query := fmt.Sprintf("CREATE TABLE %s (%s)", name, strings.Join(columnDefs, ", "))
-	_, err := s.DB.Exec(query)
-	return err
+	return s.exec(s.DB, query)
 }
 
 func (s *SQLiteSchema) DropTable(name string) error {
 	query := fmt.Sprintf("DROP TABLE IF EXISTS %s", name)
-	_, err := s.DB.Exec(query)
-	return err
+	return s.exec(s.DB, query)
 }
 
 func (s *SQLiteSchema) AddColumn(table, column, definition string) error {
 	query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)
-	_, err := s.DB.Exec(query)
-	return err
+	return s.exec(s.DB, query)
 }
 
 func (s *SQLiteSchema) DropColumn(table, column string) error {
@@ -256,14 +332,17 @@ func (s *SQLiteSchema) ChangeColumn(table, column, definition string) error {
 
 func (s *SQLiteSchema) AddIndex(table, name string, columns []string) error {
 	query := fmt.Sprintf("CREATE INDEX %s ON %s (%s)", name, table, strings.Join(columns, ", "))
-	_, err := s.DB.Exec(query)
-	return err
+	return s.exec(s.DB, query)
+}
+
+func (s *SQLiteSchema) AddUniqueIndex(table, name string, columns []string) error {
+	query := fmt.Sprintf("CREATE UNIQUE INDEX %s ON %s (%s)", name, table, strings.Join(columns, ", "))
+	return s.exec(s.DB, query)
 }
 
 func (s *SQLiteSchema) DropIndex(table, name string) error {
 	query := fmt.Sprintf("DROP INDEX IF EXISTS %s", name)
-	_, err := s.DB.Exec(query)
-	return err
+	return s.exec(s.DB, query)
 }
 
 func (s *SQLiteSchema) AddForeignKey(table, name, column, refTable, refColumn string) error {
@@ -276,12 +355,108 @@ func (s *SQLiteSchema) DropForeignKey(table, name string) error {
 	return fmt.Errorf("SQLite foreign key support is limited")
 }
 
+// SQLServerSchema implements raptor.Schema for Microsoft SQL Server
+type SQLServerSchema struct {
+	DB *sql.DB
+	pretender
+}
+
+var _ SchemaBuilder = (*SQLServerSchema)(nil)
+
+func (s *SQLServerSchema) Builder() *Builder {
+	return &Builder{dialect: sqlserverDialect, exec: func(query string) error { return s.exec(s.DB, query) }}
+}
+
+func (s *SQLServerSchema) CreateTable(name string, columns []string) error {
+	if len(columns) == 0 {
+		return fmt.Errorf("at least one column is required")
+	}
+
+	// Build column definitions
+	var columnDefs []string
+	for _, col := range columns {
+		switch col {
+		case "id":
+			columnDefs = append(columnDefs, "id INT IDENTITY(1,1) PRIMARY KEY")
+		case "email":
+			columnDefs = append(columnDefs, "email NVARCHAR(255) UNIQUE NOT NULL")
+		case "password":
+			columnDefs = append(columnDefs, "password NVARCHAR(255) NOT NULL")
+		case "created_at":
+			columnDefs = append(columnDefs, "created_at DATETIME2 DEFAULT CURRENT_TIMESTAMP")
+		case "updated_at":
+			columnDefs = append(columnDefs, "updated_at DATETIME2 DEFAULT CURRENT_TIMESTAMP")
+		default:
+			columnDefs = append(columnDefs, fmt.Sprintf("%s NVARCHAR(255)", col))
+		}
+	}
+
+	query := fmt.Sprintf("CREATE TABLE %s (%s)", name, strings.Join(columnDefs, ", "))
+	return s.exec(s.DB, query)
+}
+
+func (s *SQLServerSchema) DropTable(name string) error {
+	query := fmt.Sprintf("DROP TABLE IF EXISTS %s", name)
+	return s.exec(s.DB, query)
+}
+
+func (s *SQLServerSchema) AddColumn(table, column, definition string) error {
+	query := fmt.Sprintf("ALTER TABLE %s ADD %s %s", table, column, definition)
+	return s.exec(s.DB, query)
+}
+
+func (s *SQLServerSchema) DropColumn(table, column string) error {
+	query := fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", table, column)
+	return s.exec(s.DB, query)
+}
+
+func (s *SQLServerSchema) RenameColumn(table, oldName, newName string) error {
+	query := fmt.Sprintf("EXEC sp_rename '%s.%s', '%s', 'COLUMN'", table, oldName, newName)
+	return s.exec(s.DB, query)
+}
+
+func (s *SQLServerSchema) ChangeColumn(table, column, definition string) error {
+	query := fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s %s", table, column, definition)
+	return s.exec(s.DB, query)
+}
+
+func (s *SQLServerSchema) AddIndex(table, name string, columns []string) error {
+	query := fmt.Sprintf("CREATE INDEX %s ON %s (%s)", name, table, strings.Join(columns, ", "))
+	return s.exec(s.DB, query)
+}
+
+func (s *SQLServerSchema) AddUniqueIndex(table, name string, columns []string) error {
+	query := fmt.Sprintf("CREATE UNIQUE INDEX %s ON %s (%s)", name, table, strings.Join(columns, ", "))
+	return s.exec(s.DB, query)
+}
+
+func (s *SQLServerSchema) DropIndex(table, name string) error {
+	query := fmt.Sprintf("DROP INDEX %s ON %s", name, table)
+	return s.exec(s.DB, query)
+}
+
+func (s *SQLServerSchema) AddForeignKey(table, name, column, refTable, refColumn string) error {
+	query := fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s (%s)",
+		table, name, column, refTable, refColumn)
+	return s.exec(s.DB, query)
+}
+
+func (s *SQLServerSchema) DropForeignKey(table, name string) error {
+	query := fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", table, name)
+	return s.exec(s.DB, query)
+}
+
 // GenericSchema implements raptor.Schema for generic SQL databases
 type GenericSchema struct {
 	DB *sql.DB
+	pretender
 }
 
-var _ raptor.Schema = (*GenericSchema)(nil)
+var _ SchemaBuilder = (*GenericSchema)(nil)
+
+func (s *GenericSchema) Builder() *Builder {
+	return &Builder{dialect: genericDialect, exec: func(query string) error { return s.exec(s.DB, query) }}
+}
 
 func (s *GenericSchema) CreateTable(name string, columns []string) error {
 	if len(columns) == 0 {
@@ -308,61 +483,56 @@ func (s *GenericSchema) CreateTable(name string, columns []string) error {
 	}
 
 	query := fmt.Sprintf("CREATE TABLE %s (%s)", name, strings.Join(columnDefs, ", "))
-	_, err := s.DB.Exec(query)
-	return err
+	return s.exec(s.DB, query)
 }
 
 func (s *GenericSchema) DropTable(name string) error {
 	query := fmt.Sprintf("DROP TABLE IF EXISTS %s", name)
-	_, err := s.DB.Exec(query)
-	return err
+	return s.exec(s.DB, query)
 }
 
 func (s *GenericSchema) AddColumn(table, column, definition string) error {
 	query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)
-	_, err := s.DB.Exec(query)
-	return err
+	return s.exec(s.DB, query)
 }
 
 func (s *GenericSchema) DropColumn(table, column string) error {
 	query := fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", table, column)
-	_, err := s.DB.Exec(query)
-	return err
+	return s.exec(s.DB, query)
 }
 
 func (s *GenericSchema) RenameColumn(table, oldName, newName string) error {
 	query := fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s", table, oldName, newName)
-	_, err := s.DB.Exec(query)
-	return err
+	return s.exec(s.DB, query)
 }
 
 func (s *GenericSchema) ChangeColumn(table, column, definition string) error {
 	query := fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s %s", table, column, definition)
-	_, err := s.DB.Exec(query)
-	return err
+	return s.exec(s.DB, query)
 }
 
 func (s *GenericSchema) AddIndex(table, name string, columns []string) error {
 	query := fmt.Sprintf("CREATE INDEX %s ON %s (%s)", name, table, strings.Join(columns, ", "))
-	_, err := s.DB.Exec(query)
-	return err
+	return s.exec(s.DB, query)
+}
+
+func (s *GenericSchema) AddUniqueIndex(table, name string, columns []string) error {
+	query := fmt.Sprintf("CREATE UNIQUE INDEX %s ON %s (%s)", name, table, strings.Join(columns, ", "))
+	return s.exec(s.DB, query)
 }
 
 func (s *GenericSchema) DropIndex(table, name string) error {
 	query := fmt.Sprintf("DROP INDEX IF EXISTS %s", name)
-	_, err := s.DB.Exec(query)
-	return err
+	return s.exec(s.DB, query)
 }
 
 func (s *GenericSchema) AddForeignKey(table, name, column, refTable, refColumn string) error {
 	query := fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s (%s)",
 		table, name, column, refTable, refColumn)
-	_, err := s.DB.Exec(query)
-	return err
+	return s.exec(s.DB, query)
 }
 
 func (s *GenericSchema) DropForeignKey(table, name string) error {
 	query := fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", table, name)
-	_, err := s.DB.Exec(query)
-	return err
+	return s.exec(s.DB, query)
 }
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"fmt"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// Seeder fills the database with data for development, demos or a fresh
+// install, and is run by db:seed
+type Seeder interface {
+	Name() string
+	Run(db *gorm.DB) error
+}
+
+var (
+	seedersMu sync.RWMutex
+	seeders   []Seeder
+)
+
+// RegisterSeeder makes seeders known to db:seed. The application and its
+// modules call it from init; a seeder registered again under the same name
+// replaces the first.
+func RegisterSeeder(list ...Seeder) {
+	seedersMu.Lock()
+	defer seedersMu.Unlock()
+	for _, s := range list {
+		replaced := false
+		for i, existing := range seeders {
+			if existing.Name() == s.Name() {
+				seeders[i], replaced = s, true
+			}
+		}
+		if !replaced {
+			seeders = append(seeders, s)
+		}
+	}
+}
+
+// Seeders returns the registered seeders in registration order
+func Seeders() []Seeder {
+	seedersMu.RLock()
+	defer seedersMu.RUnlock()
+	return append([]Seeder(nil), seeders...)
+}
+
+// Seed runs the registered seeders over db in registration order, or only
+// those named, each in a transaction. It stops at the first that fails and
+// returns the names of those that ran.
+func Seed(db *gorm.DB, names ...string) ([]string, error) {
+	run := Seeders()
+	if len(names) > 0 {
+		byName := make(map[string]Seeder, len(run))
+		for _, s := range run {
+			byName[s.Name()] = s
+		}
+		run = make([]Seeder, 0, len(names))
+		for _, name := range names {
+			s, ok := byName[name]
+			if !ok {
+				return nil, fmt.Errorf("seeder %q is not registered", name)
+			}
+			run = append(run, s)
+		}
+	}
+
+	var ran []string
+	for _, s := range run {
+		if err := db.Transaction(s.Run); err != nil {
+			return ran, fmt.Errorf("seeder %s: %w", s.Name(), err)
+		}
+		ran = append(ran, s.Name())
+	}
+	return ran, nil
+}
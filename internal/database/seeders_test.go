@@ -0,0 +1,60 @@
+package database
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+type tableSeeder struct {
+	name, table string
+	err         error
+}
+
+func (s tableSeeder) Name() string { return s.name }
+
+func (s tableSeeder) Run(db *gorm.DB) error {
+	if err := db.Exec("INSERT INTO "+s.table+" (name) VALUES (?)", s.name).Error; err != nil {
+		return err
+	}
+	return s.err
+}
+
+func TestSeed(t *testing.T) {
+	db, err := NewConnection(&config.DatabaseConfig{Driver: "sqlite", Database: filepath.Join(t.TempDir(), "app.db")}, DefaultConnection)
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, db.GetDB().Exec("CREATE TABLE seeded (name TEXT)").Error)
+
+	RegisterSeeder(
+		tableSeeder{name: "test_users", table: "seeded"},
+		tableSeeder{name: "test_plans", table: "seeded"},
+		tableSeeder{name: "test_broken", table: "seeded", err: errors.New("boom")},
+	)
+	defer func() {
+		seedersMu.Lock()
+		seeders = nil
+		seedersMu.Unlock()
+	}()
+
+	ran, err := Seed(db.GetDB(), "test_plans", "test_users")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"test_plans", "test_users"}, ran)
+
+	_, err = Seed(db.GetDB(), "test_missing")
+	assert.EqualError(t, err, `seeder "test_missing" is not registered`)
+
+	// A failing seeder stops the run and its writes are rolled back
+	ran, err = Seed(db.GetDB())
+	assert.EqualError(t, err, "seeder test_broken: boom")
+	assert.Equal(t, []string{"test_users", "test_plans"}, ran)
+	var count int64
+	require.NoError(t, db.GetDB().Table("seeded").Count(&count).Error)
+	assert.Equal(t, int64(4), count)
+}
@@ -0,0 +1,182 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Reasons a statement was cut short
+const (
+	// CancelTimeout means the statement ran past its deadline
+	CancelTimeout = "timeout"
+	// CancelCanceled means its context was canceled, usually because the
+	// client went away
+	CancelCanceled = "canceled"
+)
+
+const (
+	queryTimeoutCancelKey = "dolphin:query_timeout_cancel"
+	queryTimeoutParentKey = "dolphin:query_timeout_parent"
+)
+
+type queryTimeoutKey struct{}
+
+// WithQueryTimeout overrides the connection's statement timeout for the
+// queries run with the returned context, e.g.
+//
+//	db.WithContext(database.WithQueryTimeout(ctx, time.Minute)).Find(&rows)
+//
+// A zero timeout leaves them bounded only by the context's own deadline.
+func WithQueryTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, queryTimeoutKey{}, timeout)
+}
+
+// QueryTimeouts is a GORM plugin that bounds every statement by the
+// connection's timeout, within its context's own deadline, and counts the
+// statements cut short. Row and Rows, and so Raw(...).Scan, hand back an
+// open cursor, so those are bounded by their context alone.
+type QueryTimeouts struct {
+	timeout time.Duration
+
+	// OnCancel, when set, is called for each statement cut short with its
+	// operation, table and reason
+	OnCancel func(operation, table, reason string)
+
+	canceled atomic.Int64
+	timedOut atomic.Int64
+}
+
+var _ gorm.Plugin = (*QueryTimeouts)(nil)
+
+// NewQueryTimeouts bounds statements by timeout; zero leaves them bounded
+// only by their context
+func NewQueryTimeouts(timeout time.Duration) *QueryTimeouts {
+	return &QueryTimeouts{timeout: timeout}
+}
+
+// Name implements gorm.Plugin
+func (q *QueryTimeouts) Name() string {
+	return "dolphin:query_timeouts"
+}
+
+// Initialize implements gorm.Plugin by wrapping the callback chains that
+// finish with their statement before returning
+func (q *QueryTimeouts) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	chains := []struct {
+		name     string
+		register func(before, after string, a func(*gorm.DB)) error
+	}{
+		{"create", func(b, a string, after func(*gorm.DB)) error {
+			if err := cb.Create().Before("gorm:create").Register(b, q.before); err != nil {
+				return err
+			}
+			return cb.Create().After("gorm:create").Register(a, after)
+		}},
+		{"query", func(b, a string, after func(*gorm.DB)) error {
+			if err := cb.Query().Before("gorm:query").Register(b, q.before); err != nil {
+				return err
+			}
+			return cb.Query().After("gorm:query").Register(a, after)
+		}},
+		{"update", func(b, a string, after func(*gorm.DB)) error {
+			if err := cb.Update().Before("gorm:update").Register(b, q.before); err != nil {
+				return err
+			}
+			return cb.Update().After("gorm:update").Register(a, after)
+		}},
+		{"delete", func(b, a string, after func(*gorm.DB)) error {
+			if err := cb.Delete().Before("gorm:delete").Register(b, q.before); err != nil {
+				return err
+			}
+			return cb.Delete().After("gorm:delete").Register(a, after)
+		}},
+		{"raw", func(b, a string, after func(*gorm.DB)) error {
+			if err := cb.Raw().Before("gorm:raw").Register(b, q.before); err != nil {
+				return err
+			}
+			return cb.Raw().After("gorm:raw").Register(a, after)
+		}},
+	}
+
+	for _, c := range chains {
+		operation := c.name
+		after := func(db *gorm.DB) { q.after(db, operation) }
+		if err := c.register("dolphin:query_timeout_before_"+c.name, "dolphin:query_timeout_after_"+c.name, after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// before runs after any transaction has begun, so only the statement, not
+// the transaction, is bound to the shorter deadline
+func (q *QueryTimeouts) before(db *gorm.DB) {
+	parent := db.Statement.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+	timeout := q.timeout
+	if override, ok := parent.Value(queryTimeoutKey{}).(time.Duration); ok {
+		timeout = override
+	}
+
+	// The statement's context is kept either way, so after can tell a
+	// canceled statement from a failed one
+	ctx, cancel := parent, context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(parent, timeout)
+	}
+	db.Statement.Context = ctx
+	db.InstanceSet(queryTimeoutCancelKey, cancel)
+	db.InstanceSet(queryTimeoutParentKey, parent)
+}
+
+func (q *QueryTimeouts) after(db *gorm.DB, operation string) {
+	value, ok := db.InstanceGet(queryTimeoutCancelKey)
+	if !ok {
+		return
+	}
+	ctx := db.Statement.Context
+	defer value.(context.CancelFunc)()
+	if parent, ok := db.InstanceGet(queryTimeoutParentKey); ok {
+		db.Statement.Context = parent.(context.Context)
+	}
+
+	// Drivers report an interrupted statement in their own words, so the
+	// context says why it stopped
+	if db.Error == nil || ctx == nil || ctx.Err() == nil {
+		return
+	}
+	reason := CancelCanceled
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		reason = CancelTimeout
+		q.timedOut.Add(1)
+	} else {
+		q.canceled.Add(1)
+	}
+	if q.OnCancel != nil {
+		q.OnCancel(operation, statementTable(db), reason)
+	}
+}
+
+// Timeout returns the connection's statement timeout
+func (q *QueryTimeouts) Timeout() time.Duration {
+	return q.timeout
+}
+
+// Counts returns how many statements were canceled and how many timed out
+func (q *QueryTimeouts) Counts() (canceled, timedOut int64) {
+	return q.canceled.Load(), q.timedOut.Load()
+}
+
+func statementTable(db *gorm.DB) string {
+	if db.Statement.Table == "" {
+		return "none"
+	}
+	return db.Statement.Table
+}
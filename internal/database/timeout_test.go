@@ -0,0 +1,97 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+// endless never finishes on its own; SQLite stops it when interrupted
+const endless = "WITH RECURSIVE n(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM n) SELECT count(*) FROM n"
+
+type cancellation struct {
+	operation, table, reason string
+}
+
+func watchCancellations(m *Manager) *[]cancellation {
+	var seen []cancellation
+	m.QueryTimeouts().OnCancel = func(operation, table, reason string) {
+		seen = append(seen, cancellation{operation, table, reason})
+	}
+	return &seen
+}
+
+func TestQueryTimeoutCancelsSlowQueries(t *testing.T) {
+	m := newSQLiteManager(t, config.DatabaseConfig{QueryTimeout: 50 * time.Millisecond})
+	seen := watchCancellations(m)
+
+	var n int64
+	start := time.Now()
+	assert.Error(t, m.GetDB().Raw(endless).Find(&n).Error)
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	assert.Equal(t, []cancellation{{"query", "none", CancelTimeout}}, *seen)
+	canceled, timedOut := m.QueryTimeouts().Counts()
+	assert.Equal(t, int64(0), canceled)
+	assert.Equal(t, int64(1), timedOut)
+}
+
+func TestQueryTimeoutOverride(t *testing.T) {
+	m := newSQLiteManager(t, config.DatabaseConfig{QueryTimeout: time.Nanosecond})
+
+	// The connection's timeout is too short for anything
+	var n int64
+	assert.Error(t, m.GetDB().Raw("SELECT 1").Find(&n).Error)
+
+	ctx := WithQueryTimeout(context.Background(), 0)
+	require.NoError(t, m.GetDB().WithContext(ctx).Raw("SELECT 1").Find(&n).Error)
+	assert.Equal(t, int64(1), n)
+
+	// And an override can be shorter than the connection's
+	m = newSQLiteManager(t, config.DatabaseConfig{})
+	ctx = WithQueryTimeout(context.Background(), 50*time.Millisecond)
+	assert.Error(t, m.GetDB().WithContext(ctx).Raw(endless).Find(&n).Error)
+	_, timedOut := m.QueryTimeouts().Counts()
+	assert.Equal(t, int64(1), timedOut)
+}
+
+func TestCanceledContextStopsQuery(t *testing.T) {
+	m := newSQLiteManager(t, config.DatabaseConfig{QueryTimeout: time.Minute})
+	seen := watchCancellations(m)
+
+	// As when a client disconnects mid-request
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	var n int64
+	assert.Error(t, m.GetDB().WithContext(ctx).Raw(endless).Find(&n).Error)
+	assert.Equal(t, []cancellation{{"query", "none", CancelCanceled}}, *seen)
+}
+
+func TestQueryTimeoutSparesCompletedStatements(t *testing.T) {
+	m := newSQLiteManager(t, config.DatabaseConfig{QueryTimeout: time.Minute})
+	seen := watchCancellations(m)
+	require.NoError(t, m.GetDB().AutoMigrate(&item{}))
+
+	// Writes commit in a transaction begun outside the statement's deadline
+	require.NoError(t, m.GetDB().Create(&item{Name: "a"}).Error)
+
+	// A statement reused for a second query gets its context back, not
+	// the first query's finished one
+	q := m.GetDB().Model(&item{}).Where("name = ?", "a")
+	var count int64
+	require.NoError(t, q.Count(&count).Error)
+	var items []item
+	require.NoError(t, q.Find(&items).Error)
+	assert.Equal(t, int64(1), count)
+	assert.Len(t, items, 1)
+
+	assert.Empty(t, *seen, "errors that aren't cancellations aren't counted")
+	assert.Error(t, m.GetDB().Exec("SELECT * FROM missing").Error)
+	assert.Empty(t, *seen)
+}
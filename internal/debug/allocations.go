@@ -0,0 +1,240 @@
+package debug
+
+import (
+	"math/rand"
+	"net/http"
+	"runtime/metrics"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mrhoseah/dolphin/internal/routing"
+)
+
+// allocationMetrics are the runtime metrics read around each request: bytes
+// and objects allocated so far, and the bytes of heap objects
+var allocationMetrics = []string{
+	"/gc/heap/allocs:bytes",
+	"/gc/heap/allocs:objects",
+	"/memory/classes/heap/objects:bytes",
+}
+
+// AllocationConfig configures an AllocationTracker
+type AllocationConfig struct {
+	// Budget is the bytes a request may allocate before its route is
+	// flagged, 1MB by default
+	Budget int64
+
+	// ObjectBudget is the heap objects a request may allocate before its
+	// route is flagged; zero doesn't limit them
+	ObjectBudget int64
+
+	// SampleRate is the share of requests measured, from 0 to 1; zero
+	// measures every request
+	SampleRate float64
+
+	// Skip lists path prefixes that are not measured
+	Skip []string
+
+	// OnExceeded, when set, is called with each request over budget
+	OnExceeded func(AllocationSample)
+}
+
+// AllocationSample is what one request allocated
+type AllocationSample struct {
+	Route      string        `json:"route"`
+	Bytes      int64         `json:"bytes"`
+	Objects    int64         `json:"objects"`
+	HeapGrowth int64         `json:"heap_growth"`
+	Duration   time.Duration `json:"duration"`
+}
+
+// RouteAllocations sums up the samples of a route
+type RouteAllocations struct {
+	Route         string    `json:"route"`
+	Samples       int64     `json:"samples"`
+	AvgBytes      int64     `json:"avg_bytes"`
+	AvgObjects    int64     `json:"avg_objects"`
+	MaxBytes      int64     `json:"max_bytes"`
+	MaxObjects    int64     `json:"max_objects"`
+	MaxHeapGrowth int64     `json:"max_heap_growth"`
+	OverBudget    int64     `json:"over_budget"`
+	LastOver      time.Time `json:"last_over,omitempty"`
+}
+
+// routeAllocations accumulates a route's samples
+type routeAllocations struct {
+	samples, bytes, objects         int64
+	maxBytes, maxObjects, maxGrowth int64
+	over                            int64
+	lastOver                        time.Time
+}
+
+// AllocationTracker is a middleware measuring the heap allocations of
+// requests by route, from runtime/metrics deltas, and flagging routes whose
+// requests go over budget.
+//
+// The deltas are process-wide, so allocations of concurrent requests and
+// background goroutines are counted too, and the runtime counts small
+// allocations a span at a time: figures are most telling under light load,
+// such as while stepping through pages in development.
+type AllocationTracker struct {
+	config AllocationConfig
+	sample func() float64
+
+	mu     sync.Mutex
+	routes map[string]*routeAllocations
+}
+
+// NewAllocationTracker returns a tracker with config's budgets
+func NewAllocationTracker(config AllocationConfig) *AllocationTracker {
+	if config.Budget <= 0 {
+		config.Budget = 1 << 20
+	}
+	if config.SampleRate <= 0 || config.SampleRate > 1 {
+		config.SampleRate = 1
+	}
+	return &AllocationTracker{
+		config: config,
+		sample: rand.Float64,
+		routes: make(map[string]*routeAllocations),
+	}
+}
+
+// Budget returns the bytes and objects a request may allocate; zero
+// objects doesn't limit them
+func (t *AllocationTracker) Budget() (bytes, objects int64) {
+	return t.config.Budget, t.config.ObjectBudget
+}
+
+// Middleware measures sampled requests. Routes are named by their chi
+// pattern, so it must be used on a chi router.
+func (t *AllocationTracker) Middleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if t.skipped(r.URL.Path) || (t.config.SampleRate < 1 && t.sample() >= t.config.SampleRate) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Both reads are allocated up front, so measuring isn't counted
+			before := make([]metrics.Sample, len(allocationMetrics))
+			after := make([]metrics.Sample, len(allocationMetrics))
+			for i, name := range allocationMetrics {
+				before[i].Name, after[i].Name = name, name
+			}
+			start := time.Now()
+			metrics.Read(before)
+
+			next.ServeHTTP(w, r)
+
+			metrics.Read(after)
+			t.record(AllocationSample{
+				Route:      r.Method + " " + routePattern(r),
+				Bytes:      delta(before[0], after[0]),
+				Objects:    delta(before[1], after[1]),
+				HeapGrowth: delta(before[2], after[2]),
+				Duration:   time.Since(start),
+			})
+		})
+	}
+}
+
+// skipped reports whether path is under a prefix that isn't measured
+func (t *AllocationTracker) skipped(path string) bool {
+	for _, prefix := range t.config.Skip {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// routePattern is the pattern of the route r matched, or "(unmatched)"
+func routePattern(r *http.Request) string {
+	if pattern := routing.Pattern(r); pattern != "" {
+		return pattern
+	}
+	return "(unmatched)"
+}
+
+// delta is how much a uint64 metric grew between two reads, negative
+// when it shrank
+func delta(before, after metrics.Sample) int64 {
+	if before.Value.Kind() != metrics.KindUint64 || after.Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return int64(after.Value.Uint64()) - int64(before.Value.Uint64())
+}
+
+// record adds a sample to its route, calling OnExceeded when it is over
+// budget
+func (t *AllocationTracker) record(sample AllocationSample) {
+	over := sample.Bytes > t.config.Budget ||
+		(t.config.ObjectBudget > 0 && sample.Objects > t.config.ObjectBudget)
+
+	t.mu.Lock()
+	route, ok := t.routes[sample.Route]
+	if !ok {
+		route = &routeAllocations{}
+		t.routes[sample.Route] = route
+	}
+	route.samples++
+	route.bytes += sample.Bytes
+	route.objects += sample.Objects
+	route.maxBytes = max(route.maxBytes, sample.Bytes)
+	route.maxObjects = max(route.maxObjects, sample.Objects)
+	route.maxGrowth = max(route.maxGrowth, sample.HeapGrowth)
+	if over {
+		route.over++
+		route.lastOver = time.Now()
+	}
+	t.mu.Unlock()
+
+	if over && t.config.OnExceeded != nil {
+		t.config.OnExceeded(sample)
+	}
+}
+
+// Worst returns up to n routes allocating the most per request on average,
+// routes over budget first; n <= 0 returns them all
+func (t *AllocationTracker) Worst(n int) []RouteAllocations {
+	t.mu.Lock()
+	routes := make([]RouteAllocations, 0, len(t.routes))
+	for name, route := range t.routes {
+		routes = append(routes, RouteAllocations{
+			Route:         name,
+			Samples:       route.samples,
+			AvgBytes:      route.bytes / route.samples,
+			AvgObjects:    route.objects / route.samples,
+			MaxBytes:      route.maxBytes,
+			MaxObjects:    route.maxObjects,
+			MaxHeapGrowth: route.maxGrowth,
+			OverBudget:    route.over,
+			LastOver:      route.lastOver,
+		})
+	}
+	t.mu.Unlock()
+
+	sort.Slice(routes, func(i, j int) bool {
+		if (routes[i].OverBudget > 0) != (routes[j].OverBudget > 0) {
+			return routes[i].OverBudget > 0
+		}
+		if routes[i].AvgBytes != routes[j].AvgBytes {
+			return routes[i].AvgBytes > routes[j].AvgBytes
+		}
+		return routes[i].Route < routes[j].Route
+	})
+	if n > 0 && len(routes) > n {
+		routes = routes[:n]
+	}
+	return routes
+}
+
+// Reset forgets every route's samples
+func (t *AllocationTracker) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.routes = make(map[string]*routeAllocations)
+}
@@ -0,0 +1,130 @@
+package debug
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// sink keeps the test handlers' allocations on the heap
+var sink []byte
+
+// newAllocatingApp returns a chi router behind tracker, whose /big route
+// allocates 4MB and /small route nothing to speak of
+func newAllocatingApp(tracker *AllocationTracker) http.Handler {
+	r := chi.NewRouter()
+	r.Use(tracker.Middleware())
+	r.Get("/big/{id}", func(w http.ResponseWriter, r *http.Request) {
+		sink = make([]byte, 4<<20)
+	})
+	r.Get("/small", func(w http.ResponseWriter, r *http.Request) {})
+	r.Get("/debug/stats", func(w http.ResponseWriter, r *http.Request) {
+		sink = make([]byte, 4<<20)
+	})
+	return r
+}
+
+func TestAllocationTrackerFlagsRoutesOverBudget(t *testing.T) {
+	var exceeded []AllocationSample
+	tracker := NewAllocationTracker(AllocationConfig{
+		Skip:       []string{"/debug"},
+		OnExceeded: func(sample AllocationSample) { exceeded = append(exceeded, sample) },
+	})
+	app := newAllocatingApp(tracker)
+
+	for _, path := range []string{"/big/1", "/big/2", "/small", "/debug/stats", "/missing"} {
+		app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	routes := tracker.Worst(0)
+	if len(routes) != 3 {
+		t.Fatalf("expected 3 routes, /debug skipped, got %+v", routes)
+	}
+	big := routes[0]
+	if big.Route != "GET /big/{id}" || big.Samples != 2 || big.OverBudget != 2 {
+		t.Fatalf("expected the big route first, over budget twice, got %+v", big)
+	}
+	if big.AvgBytes < 4<<20 || big.MaxBytes < 4<<20 || big.LastOver.IsZero() {
+		t.Fatalf("expected at least 4MB allocated per request, got %+v", big)
+	}
+	if len(exceeded) != 2 || exceeded[0].Route != "GET /big/{id}" {
+		t.Fatalf("expected OnExceeded for both big requests, got %+v", exceeded)
+	}
+	for _, route := range routes[1:] {
+		if route.OverBudget != 0 {
+			t.Fatalf("expected %s within budget, got %+v", route.Route, route)
+		}
+	}
+	if worst := tracker.Worst(1); len(worst) != 1 || worst[0].Route != big.Route {
+		t.Fatalf("expected only the worst route, got %+v", worst)
+	}
+
+	tracker.Reset()
+	if routes := tracker.Worst(0); len(routes) != 0 {
+		t.Fatalf("expected no routes after Reset, got %+v", routes)
+	}
+}
+
+func TestAllocationTrackerBudgets(t *testing.T) {
+	tracker := NewAllocationTracker(AllocationConfig{Budget: 100 << 20, ObjectBudget: 10})
+	tracker.record(AllocationSample{Route: "GET /many", Bytes: 1024, Objects: 50})
+	tracker.record(AllocationSample{Route: "GET /few", Bytes: 4096, Objects: 5})
+
+	routes := tracker.Worst(0)
+	if routes[0].Route != "GET /many" || routes[0].OverBudget != 1 {
+		t.Fatalf("expected the route over its object budget first, got %+v", routes)
+	}
+	if routes[1].OverBudget != 0 {
+		t.Fatalf("expected GET /few within budget, got %+v", routes[1])
+	}
+}
+
+func TestAllocationTrackerSamples(t *testing.T) {
+	tracker := NewAllocationTracker(AllocationConfig{SampleRate: 0.5})
+	draws := []float64{0.2, 0.7, 0.4, 0.9}
+	tracker.sample = func() float64 {
+		draw := draws[0]
+		draws = draws[1:]
+		return draw
+	}
+	app := newAllocatingApp(tracker)
+	for range 4 {
+		app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/small", nil))
+	}
+
+	if routes := tracker.Worst(0); len(routes) != 1 || routes[0].Samples != 2 {
+		t.Fatalf("expected half the requests measured, got %+v", routes)
+	}
+}
+
+func TestListAllocations(t *testing.T) {
+	d := NewDebugger(Config{Enabled: true})
+	list := func() map[string]interface{} {
+		w := httptest.NewRecorder()
+		d.Router().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/allocations", nil))
+		var body map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		return body
+	}
+
+	if body := list(); body["enabled"] != false {
+		t.Fatalf("expected tracking disabled without a tracker, got %v", body)
+	}
+
+	tracker := NewAllocationTracker(AllocationConfig{})
+	tracker.record(AllocationSample{Route: "GET /reports", Bytes: 8 << 20, Objects: 1000})
+	d.SetAllocations(tracker)
+	body := list()
+	routes := body["routes"].([]interface{})
+	if body["enabled"] != true || body["budget"] != float64(1<<20) || len(routes) != 1 {
+		t.Fatalf("unexpected allocations: %v", body)
+	}
+	if route := routes[0].(map[string]interface{}); route["route"] != "GET /reports" || route["over_budget"] != float64(1) {
+		t.Fatalf("unexpected route: %v", route)
+	}
+}
@@ -0,0 +1,147 @@
+package debug
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// SetAllocations shows the routes measured by tracker on the dashboard
+func (d *Debugger) SetAllocations(tracker *AllocationTracker) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.allocations = tracker
+}
+
+// listAllocations returns the routes allocating the most, all of them or
+// the ?limit worst
+func (d *Debugger) listAllocations(w http.ResponseWriter, r *http.Request) {
+	d.mu.RLock()
+	tracker := d.allocations
+	d.mu.RUnlock()
+
+	routes := []RouteAllocations{}
+	var budget, objectBudget int64
+	if tracker != nil {
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		routes = tracker.Worst(limit)
+		budget, objectBudget = tracker.Budget()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled":       tracker != nil,
+		"budget":        budget,
+		"object_budget": objectBudget,
+		"routes":        routes,
+	})
+}
+
+// resetAllocations forgets the routes measured so far
+func (d *Debugger) resetAllocations(w http.ResponseWriter, r *http.Request) {
+	d.mu.RLock()
+	tracker := d.allocations
+	d.mu.RUnlock()
+	if tracker == nil {
+		http.Error(w, "Allocation tracking is disabled", http.StatusNotFound)
+		return
+	}
+	tracker.Reset()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Allocations cleared"})
+}
+
+// allocationPage serves the page listing the routes allocating the most
+func (d *Debugger) allocationPage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(allocationHTML))
+}
+
+const allocationHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Allocations - Dolphin Debug</title>
+    <style>
+        body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; margin: 0; padding: 20px; background: #f5f5f5; }
+        .container { max-width: 1400px; margin: 0 auto; }
+        .header, .panel { background: white; padding: 20px; border-radius: 8px; box-shadow: 0 2px 4px rgba(0,0,0,0.1); margin-bottom: 20px; }
+        table { width: 100%; border-collapse: collapse; font-size: 14px; }
+        th, td { text-align: left; padding: 8px; border-bottom: 1px solid #eee; vertical-align: top; }
+        td.number, th.number { text-align: right; }
+        .ok { color: #28a745; } .alert { color: #dc3545; font-weight: bold; }
+        .btn { display: inline-block; padding: 8px 16px; background: #007bff; color: white; border: 0; border-radius: 4px; cursor: pointer; margin-right: 8px; text-decoration: none; font-size: 14px; }
+        .btn.secondary { background: #6c757d; }
+        .muted { color: #666; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>🧮 Allocations per Request</h1>
+            <a href="/debug/" class="btn secondary">Dashboard</a>
+            <button class="btn secondary" onclick="loadAllocations()">Refresh</button>
+            <button class="btn secondary" onclick="resetAllocations()">Clear</button>
+            <span class="muted" id="message"></span>
+            <p class="muted">Measured from process-wide runtime metrics, so concurrent requests add to each other's figures.</p>
+        </div>
+        <div class="panel">
+            <table>
+                <thead><tr><th>Route</th><th class="number">Samples</th><th class="number">Avg bytes</th><th class="number">Max bytes</th><th class="number">Avg objects</th><th class="number">Max objects</th><th class="number">Max heap growth</th><th>Over budget</th></tr></thead>
+                <tbody id="routes"></tbody>
+            </table>
+        </div>
+    </div>
+
+    <script>
+        function el(tag, text, className) {
+            const node = document.createElement(tag);
+            if (text !== undefined) node.textContent = text;
+            if (className) node.className = className;
+            return node;
+        }
+
+        function bytes(n) {
+            if (Math.abs(n) >= 1048576) return (n / 1048576).toFixed(1) + 'MB';
+            if (Math.abs(n) >= 1024) return (n / 1024).toFixed(1) + 'KB';
+            return n + 'B';
+        }
+
+        function loadAllocations() {
+            fetch('/debug/allocations')
+                .then(response => response.json())
+                .then(data => {
+                    const rows = document.getElementById('routes');
+                    rows.replaceChildren();
+                    document.getElementById('message').textContent = data.enabled ?
+                        'Budget: ' + bytes(data.budget) + (data.object_budget ? ', ' + data.object_budget + ' objects' : '') + ' per request' :
+                        'Allocation tracking is disabled (debug.allocations)';
+                    data.routes.forEach(route => {
+                        const row = el('tr');
+                        row.append(
+                            el('td', route.route),
+                            el('td', route.samples, 'number'),
+                            el('td', bytes(route.avg_bytes), 'number'),
+                            el('td', bytes(route.max_bytes), 'number'),
+                            el('td', route.avg_objects, 'number'),
+                            el('td', route.max_objects, 'number'),
+                            el('td', bytes(route.max_heap_growth), 'number'),
+                            el('td', route.over_budget ? route.over_budget + ' requests, last ' + new Date(route.last_over).toLocaleTimeString() : 'no',
+                                route.over_budget ? 'alert' : 'ok'));
+                        rows.append(row);
+                    });
+                })
+                .catch(error => console.error('Error loading allocations:', error));
+        }
+
+        function resetAllocations() {
+            fetch('/debug/allocations/reset').then(loadAllocations);
+        }
+
+        loadAllocations();
+        setInterval(loadAllocations, 5000);
+    </script>
+</body>
+</html>`
@@ -0,0 +1,349 @@
+package debug
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/mrhoseah/dolphin/internal/capture"
+	"github.com/mrhoseah/dolphin/internal/database"
+)
+
+const (
+	// RecordingHeader carries the ID of a response's recording
+	RecordingHeader = "X-Debug-Recording"
+
+	// ReplayHeader marks a replayed request with the ID of the recording
+	// it repeats
+	ReplayHeader = "X-Debug-Replay"
+)
+
+// ignoredHeaders are request headers a repeated request must not copy:
+// they describe the original connection or make curl print compressed
+// output
+var ignoredHeaders = map[string]bool{
+	"Accept-Encoding":   true,
+	"Connection":        true,
+	"Content-Length":    true,
+	"Keep-Alive":        true,
+	"Transfer-Encoding": true,
+	"Upgrade":           true,
+	ReplayHeader:        true,
+}
+
+// Recording is a request captured by the Recorder, with its response and
+// the database queries it ran
+type Recording struct {
+	ID            string                 `json:"id"`
+	RequestID     string                 `json:"request_id,omitempty"`
+	ReplayOf      string                 `json:"replay_of,omitempty"`
+	Method        string                 `json:"method"`
+	URL           string                 `json:"url"`
+	Headers       http.Header            `json:"headers"`
+	Body          string                 `json:"body,omitempty"`
+	BodyBase64    bool                   `json:"body_base64,omitempty"`
+	BodyTruncated bool                   `json:"body_truncated,omitempty"`
+	RemoteAddr    string                 `json:"remote_addr"`
+	Response      RecordedResponse       `json:"response"`
+	Queries       []database.QueryRecord `json:"queries"`
+	StartTime     time.Time              `json:"start_time"`
+	Duration      time.Duration          `json:"duration"`
+}
+
+// RecordedResponse is the response sent for a recorded request
+type RecordedResponse struct {
+	Status        int         `json:"status"`
+	Headers       http.Header `json:"headers"`
+	Body          string      `json:"body,omitempty"`
+	BodyBase64    bool        `json:"body_base64,omitempty"`
+	BodyTruncated bool        `json:"body_truncated,omitempty"`
+	Size          int         `json:"size"`
+}
+
+// RecorderConfig configures a Recorder
+type RecorderConfig struct {
+	// Size is how many recordings are kept, 200 by default
+	Size int
+
+	// File keeps recordings in a SQLite database at this path, so they
+	// survive restarts and `dolphin debug export` can read them; empty
+	// keeps them in memory
+	File string
+
+	// MaxBodySize caps the bytes kept of each request and response body,
+	// 64KB by default
+	MaxBodySize int
+
+	// Skip lists path prefixes that are not recorded
+	Skip []string
+
+	// OnError, when set, is called when a recording can't be saved
+	OnError func(error)
+}
+
+// Recorder is a middleware storing recent requests for the debug dashboard,
+// from which they can be replayed or exported as curl commands
+type Recorder struct {
+	config RecorderConfig
+	store  RecordingStore
+
+	mu      sync.RWMutex
+	handler http.Handler
+}
+
+// NewRecorder returns a recorder keeping recordings in memory, or in
+// config.File when set
+func NewRecorder(config RecorderConfig) (*Recorder, error) {
+	if config.Size <= 0 {
+		config.Size = 200
+	}
+	if config.MaxBodySize <= 0 {
+		config.MaxBodySize = 64 << 10
+	}
+
+	var store RecordingStore = newMemoryStore(config.Size)
+	if config.File != "" {
+		fileStore, err := OpenRecordingFile(config.File, config.Size)
+		if err != nil {
+			return nil, err
+		}
+		store = fileStore
+	}
+	return &Recorder{config: config, store: store}, nil
+}
+
+// SetHandler sets the handler replayed requests are served by, normally the
+// application's router with the recorder in its middleware
+func (rec *Recorder) SetHandler(handler http.Handler) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.handler = handler
+}
+
+// Get returns the recording with the given ID
+func (rec *Recorder) Get(id string) (*Recording, error) {
+	return rec.store.Get(id)
+}
+
+// List returns the kept recordings, newest first
+func (rec *Recorder) List() ([]*Recording, error) {
+	return rec.store.List()
+}
+
+// Clear removes every recording
+func (rec *Recorder) Clear() error {
+	return rec.store.Clear()
+}
+
+// Close releases the recording file, if any
+func (rec *Recorder) Close() error {
+	return rec.store.Close()
+}
+
+// Middleware records each request and its response
+func (rec *Recorder) Middleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if rec.skipped(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			recording := &Recording{
+				ID:         newRecordingID(),
+				RequestID:  middleware.GetReqID(r.Context()),
+				ReplayOf:   r.Header.Get(ReplayHeader),
+				Method:     r.Method,
+				URL:        requestURL(r),
+				Headers:    r.Header.Clone(),
+				RemoteAddr: r.RemoteAddr,
+				StartTime:  time.Now(),
+			}
+
+			// Read the start of the body and hand the handler all of it
+			if r.Body != nil && r.Body != http.NoBody {
+				head, _ := io.ReadAll(io.LimitReader(r.Body, int64(rec.config.MaxBodySize)+1))
+				recording.BodyTruncated = len(head) > rec.config.MaxBodySize
+				recording.Body, recording.BodyBase64 = encodeBody(head[:min(len(head), rec.config.MaxBodySize)])
+				r.Body = struct {
+					io.Reader
+					io.Closer
+				}{io.MultiReader(bytes.NewReader(head), r.Body), r.Body}
+			}
+
+			ctx, queries := database.CollectQueries(r.Context())
+			w.Header().Set(RecordingHeader, recording.ID)
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			body := capture.NewBuffer(rec.config.MaxBodySize)
+			ww.Tee(body)
+
+			next.ServeHTTP(ww, r.WithContext(ctx))
+
+			recording.Duration = time.Since(recording.StartTime)
+			recording.Queries = queries.Queries()
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			recording.Response = RecordedResponse{
+				Status:        status,
+				Headers:       ww.Header().Clone(),
+				BodyTruncated: body.Truncated(),
+				Size:          ww.BytesWritten(),
+			}
+			recording.Response.Body, recording.Response.BodyBase64 = encodeBody(body.Bytes())
+
+			if err := rec.store.Save(recording); err != nil && rec.config.OnError != nil {
+				rec.config.OnError(err)
+			}
+		})
+	}
+}
+
+// Replay serves the recorded request again and returns the recording of
+// the repeat
+func (rec *Recorder) Replay(id string) (*Recording, error) {
+	rec.mu.RLock()
+	handler := rec.handler
+	rec.mu.RUnlock()
+	if handler == nil {
+		return nil, errors.New("no handler set for replaying requests")
+	}
+
+	original, err := rec.store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if original.BodyTruncated {
+		return nil, fmt.Errorf("recording %s can't be replayed: its body was truncated", id)
+	}
+	body, err := original.body()
+	if err != nil {
+		return nil, err
+	}
+
+	// A fresh context, since the caller's carries the debug route
+	req, err := http.NewRequestWithContext(context.Background(), original.Method, original.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("recording %s can't be replayed: %w", id, err)
+	}
+	for name, values := range original.Headers {
+		if !ignoredHeaders[http.CanonicalHeaderKey(name)] {
+			req.Header[name] = append([]string(nil), values...)
+		}
+	}
+	req.Header.Set(ReplayHeader, id)
+	req.RequestURI = req.URL.RequestURI()
+	req.RemoteAddr = original.RemoteAddr
+
+	w := &capture.Discard{}
+	handler.ServeHTTP(w, req)
+
+	replayID := w.Header().Get(RecordingHeader)
+	if replayID == "" {
+		return nil, fmt.Errorf("replay of %s was not recorded", id)
+	}
+	return rec.store.Get(replayID)
+}
+
+// Curl returns a curl command repeating the request. Only the recorded
+// part of a truncated body is sent, which a comment line points out.
+func (r *Recording) Curl() string {
+	var b strings.Builder
+	if r.BodyTruncated {
+		b.WriteString("# The request body was truncated when recorded\n")
+	}
+	if r.BodyBase64 {
+		b.WriteString("printf %s " + shellQuote(r.Body) + " | base64 -d | ")
+	}
+
+	b.WriteString("curl")
+	if r.Method != http.MethodGet {
+		b.WriteString(" -X " + r.Method)
+	}
+	b.WriteString(" " + shellQuote(r.URL))
+
+	names := make([]string, 0, len(r.Headers))
+	for name := range r.Headers {
+		if !ignoredHeaders[http.CanonicalHeaderKey(name)] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range r.Headers[name] {
+			b.WriteString(" \\\n  -H " + shellQuote(name+": "+value))
+		}
+	}
+
+	switch {
+	case r.BodyBase64:
+		b.WriteString(" \\\n  --data-binary @-")
+	case r.Body != "":
+		b.WriteString(" \\\n  --data-raw " + shellQuote(r.Body))
+	}
+	return b.String()
+}
+
+// body returns the recorded request body
+func (r *Recording) body() ([]byte, error) {
+	if r.BodyBase64 {
+		return base64.StdEncoding.DecodeString(r.Body)
+	}
+	return []byte(r.Body), nil
+}
+
+func (rec *Recorder) skipped(path string) bool {
+	for _, prefix := range rec.config.Skip {
+		if path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// requestURL returns the absolute URL the client requested
+func requestURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host + r.URL.RequestURI()
+}
+
+// encodeBody returns body as text, or base64 encoded when it isn't UTF-8
+func encodeBody(body []byte) (string, bool) {
+	if utf8.Valid(body) {
+		return string(body), false
+	}
+	return base64.StdEncoding.EncodeToString(body), true
+}
+
+func newRecordingID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// shellQuote quotes s for POSIX shells
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
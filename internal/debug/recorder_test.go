@@ -0,0 +1,208 @@
+package debug
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newRecordedApp returns a handler echoing request bodies behind a recorder
+func newRecordedApp(t *testing.T, config RecorderConfig) (*Recorder, http.Handler) {
+	t.Helper()
+	rec, err := NewRecorder(config)
+	if err != nil {
+		t.Fatalf("NewRecorder: %v", err)
+	}
+	t.Cleanup(func() { rec.Close() })
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusCreated)
+		w.Write(body)
+	})
+	mux.HandleFunc("/debug/", func(w http.ResponseWriter, r *http.Request) {})
+
+	handler := rec.Middleware()(mux)
+	rec.SetHandler(handler)
+	return rec, handler
+}
+
+func TestRecorderRecordsRequests(t *testing.T) {
+	rec, app := newRecordedApp(t, RecorderConfig{Skip: []string{"/debug"}})
+
+	req := httptest.NewRequest(http.MethodPost, "http://example.com/echo?x=1", strings.NewReader(`{"name":"it's"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+	app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/debug/stats", nil))
+
+	if w.Body.String() != `{"name":"it's"}` {
+		t.Fatalf("handler should still read the whole body, got %q", w.Body.String())
+	}
+	recordings, _ := rec.List()
+	if len(recordings) != 1 {
+		t.Fatalf("expected 1 recording, got %d", len(recordings))
+	}
+	got := recordings[0]
+	if w.Header().Get(RecordingHeader) != got.ID {
+		t.Fatalf("expected the recording ID in the response header")
+	}
+	if got.URL != "http://example.com/echo?x=1" || got.Body != `{"name":"it's"}` {
+		t.Fatalf("unexpected request: %s %q", got.URL, got.Body)
+	}
+	if got.Response.Status != http.StatusCreated || got.Response.Body != `{"name":"it's"}` {
+		t.Fatalf("unexpected response: %d %q", got.Response.Status, got.Response.Body)
+	}
+
+	want := `curl -X POST 'http://example.com/echo?x=1' \
+  -H 'Content-Type: application/json' \
+  --data-raw '{"name":"it'\''s"}'`
+	if curl := got.Curl(); curl != want {
+		t.Fatalf("unexpected curl command:\n%s", curl)
+	}
+}
+
+func TestRecorderTruncatesBodies(t *testing.T) {
+	rec, app := newRecordedApp(t, RecorderConfig{MaxBodySize: 4})
+
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader("abcdefgh")))
+	if w.Body.String() != "abcdefgh" {
+		t.Fatalf("handler should read the whole body, got %q", w.Body.String())
+	}
+
+	recordings, _ := rec.List()
+	got := recordings[0]
+	if got.Body != "abcd" || !got.BodyTruncated {
+		t.Fatalf("expected a truncated request body, got %q", got.Body)
+	}
+	if got.Response.Body != "abcd" || !got.Response.BodyTruncated || got.Response.Size != 8 {
+		t.Fatalf("expected a truncated response body, got %q of %d", got.Response.Body, got.Response.Size)
+	}
+	if !strings.HasPrefix(got.Curl(), "# The request body was truncated") {
+		t.Fatalf("curl command should warn about the truncated body")
+	}
+	if _, err := rec.Replay(got.ID); err == nil {
+		t.Fatalf("truncated requests should not be replayed")
+	}
+}
+
+func TestRecorderReplay(t *testing.T) {
+	rec, app := newRecordedApp(t, RecorderConfig{})
+	app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader("hello")))
+	recordings, _ := rec.List()
+	original := recordings[0]
+
+	replay, err := rec.Replay(original.ID)
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	if replay.ID == original.ID || replay.ReplayOf != original.ID {
+		t.Fatalf("expected a new recording of the replay, got %+v", replay)
+	}
+	if replay.Body != "hello" || replay.Response.Body != "hello" {
+		t.Fatalf("unexpected replay: %q -> %q", replay.Body, replay.Response.Body)
+	}
+
+	if _, err := rec.Replay("missing"); !errors.Is(err, ErrRecordingNotFound) {
+		t.Fatalf("expected ErrRecordingNotFound, got %v", err)
+	}
+}
+
+func TestRecorderRingBuffer(t *testing.T) {
+	rec, app := newRecordedApp(t, RecorderConfig{Size: 2})
+	for _, body := range []string{"1", "2", "3"} {
+		app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(body)))
+	}
+
+	recordings, _ := rec.List()
+	if len(recordings) != 2 || recordings[0].Body != "3" || recordings[1].Body != "2" {
+		t.Fatalf("expected the 2 newest recordings, newest first")
+	}
+}
+
+func TestRecordingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "debug", "requests.db")
+	rec, app := newRecordedApp(t, RecorderConfig{Size: 2, File: path})
+	for _, body := range []string{"1", "2", "3"} {
+		app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(body)))
+	}
+	recordings, _ := rec.List()
+	if len(recordings) != 2 || recordings[0].Body != "3" {
+		t.Fatalf("expected the 2 newest recordings, got %d", len(recordings))
+	}
+
+	// The file can be read by another process, such as `dolphin debug export`
+	store, err := OpenRecordingFile(path, 0)
+	if err != nil {
+		t.Fatalf("OpenRecordingFile: %v", err)
+	}
+	defer store.Close()
+	got, err := store.Get(recordings[1].ID)
+	if err != nil || got.Body != "2" {
+		t.Fatalf("expected recording 2 from the file, got %v", err)
+	}
+	if _, err := store.Get(recordings[0].ID + "x"); !errors.Is(err, ErrRecordingNotFound) {
+		t.Fatalf("expected ErrRecordingNotFound, got %v", err)
+	}
+}
+
+func TestBinaryBodyCurl(t *testing.T) {
+	recording := &Recording{Method: http.MethodPut, URL: "http://localhost/upload"}
+	recording.Body, recording.BodyBase64 = encodeBody([]byte{0xff, 0x00})
+
+	want := `printf %s '/wA=' | base64 -d | curl -X PUT 'http://localhost/upload' \
+  --data-binary @-`
+	if curl := recording.Curl(); curl != want {
+		t.Fatalf("unexpected curl command:\n%s", curl)
+	}
+}
+
+func TestRecordingEndpoints(t *testing.T) {
+	rec, app := newRecordedApp(t, RecorderConfig{})
+	app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader("hi")))
+
+	dbg := newTestDebugger()
+	r := dbg.Router()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/recordings/abc", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 without a recorder, got %d", w.Code)
+	}
+
+	dbg.SetRecorder(rec)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/recordings", nil))
+	var list struct {
+		Enabled    bool               `json:"enabled"`
+		Recordings []recordingSummary `json:"recordings"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil || !list.Enabled || len(list.Recordings) != 1 {
+		t.Fatalf("unexpected recording list: %+v, %v", list, err)
+	}
+	id := list.Recordings[0].ID
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/recordings/"+id+"/replay", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected replay to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/recordings/"+id+"/curl", nil))
+	if !strings.HasPrefix(w.Body.String(), "curl -X POST 'http://example.com/echo'") {
+		t.Fatalf("unexpected curl command: %s", w.Body.String())
+	}
+
+	if recordings, _ := rec.List(); len(recordings) != 2 {
+		t.Fatalf("expected the replay to be recorded, got %d recordings", len(recordings))
+	}
+}
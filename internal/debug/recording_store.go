@@ -0,0 +1,199 @@
+package debug
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// ErrRecordingNotFound is returned for recordings that were never made or
+// have been evicted
+var ErrRecordingNotFound = errors.New("recording not found")
+
+// RecordingStore keeps the most recent recordings
+type RecordingStore interface {
+	Save(recording *Recording) error
+	Get(id string) (*Recording, error)
+	// List returns the recordings, newest first
+	List() ([]*Recording, error)
+	Clear() error
+	Close() error
+}
+
+// memoryStore keeps recordings in a ring buffer
+type memoryStore struct {
+	mu         sync.RWMutex
+	size       int
+	recordings []*Recording
+	next       int
+}
+
+func newMemoryStore(size int) *memoryStore {
+	return &memoryStore{size: size}
+}
+
+func (s *memoryStore) Save(recording *Recording) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.recordings) < s.size {
+		s.recordings = append(s.recordings, recording)
+	} else {
+		s.recordings[s.next] = recording
+	}
+	s.next = (s.next + 1) % s.size
+	return nil
+}
+
+func (s *memoryStore) Get(id string) (*Recording, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, recording := range s.recordings {
+		if recording.ID == id {
+			return recording, nil
+		}
+	}
+	return nil, ErrRecordingNotFound
+}
+
+func (s *memoryStore) List() ([]*Recording, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]*Recording, 0, len(s.recordings))
+	for i := 1; i <= len(s.recordings); i++ {
+		result = append(result, s.recordings[(s.next-i+len(s.recordings))%len(s.recordings)])
+	}
+	return result, nil
+}
+
+func (s *memoryStore) Clear() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recordings = nil
+	s.next = 0
+	return nil
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
+
+// recordingRow is a recording in the SQLite file, stored as JSON
+type recordingRow struct {
+	Seq  uint   `gorm:"primaryKey;autoIncrement"`
+	ID   string `gorm:"uniqueIndex;size:32"`
+	Data string
+}
+
+func (recordingRow) TableName() string {
+	return "debug_recordings"
+}
+
+// fileStore keeps recordings in a SQLite database
+type fileStore struct {
+	db   *gorm.DB
+	size int
+}
+
+// OpenRecordingFile opens the SQLite recording file at path, creating it
+// if needed. Saving beyond size recordings drops the oldest; a size of zero
+// keeps them all.
+func OpenRecordingFile(path string, size int) (RecordingStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create recording directory: %w", err)
+	}
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recording file %s: %w", path, err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows one writer; a single connection avoids lock errors
+	sqlDB.SetMaxOpenConns(1)
+
+	if err := db.AutoMigrate(&recordingRow{}); err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("failed to prepare recording file %s: %w", path, err)
+	}
+	return &fileStore{db: db, size: size}, nil
+}
+
+func (s *fileStore) Save(recording *Recording) error {
+	data, err := json.Marshal(recording)
+	if err != nil {
+		return err
+	}
+	if err := s.db.Create(&recordingRow{ID: recording.ID, Data: string(data)}).Error; err != nil {
+		return err
+	}
+	if s.size <= 0 {
+		return nil
+	}
+	return s.db.Exec(
+		"DELETE FROM debug_recordings WHERE seq <= (SELECT seq FROM debug_recordings ORDER BY seq DESC LIMIT 1 OFFSET ?)",
+		s.size,
+	).Error
+}
+
+func (s *fileStore) Get(id string) (*Recording, error) {
+	var rows []recordingRow
+	if err := s.db.Where("id = ?", id).Limit(1).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, ErrRecordingNotFound
+	}
+	return decodeRecording(rows[0])
+}
+
+func (s *fileStore) List() ([]*Recording, error) {
+	var rows []recordingRow
+	query := s.db.Order("seq DESC")
+	if s.size > 0 {
+		query = query.Limit(s.size)
+	}
+	if err := query.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]*Recording, 0, len(rows))
+	for _, row := range rows {
+		recording, err := decodeRecording(row)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, recording)
+	}
+	return result, nil
+}
+
+func (s *fileStore) Clear() error {
+	return s.db.Exec("DELETE FROM debug_recordings").Error
+}
+
+func (s *fileStore) Close() error {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+func decodeRecording(row recordingRow) (*Recording, error) {
+	var recording Recording
+	if err := json.Unmarshal([]byte(row.Data), &recording); err != nil {
+		return nil, fmt.Errorf("failed to decode recording %s: %w", row.ID, err)
+	}
+	return &recording, nil
+}
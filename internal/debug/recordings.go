@@ -0,0 +1,300 @@
+package debug
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// recordingSummary is a recording as listed, without bodies and queries
+type recordingSummary struct {
+	ID        string        `json:"id"`
+	ReplayOf  string        `json:"replay_of,omitempty"`
+	Method    string        `json:"method"`
+	URL       string        `json:"url"`
+	Status    int           `json:"status"`
+	Queries   int           `json:"queries"`
+	StartTime time.Time     `json:"start_time"`
+	Duration  time.Duration `json:"duration"`
+}
+
+// SetRecorder shows the requests recorded by rec on the dashboard
+func (d *Debugger) SetRecorder(rec *Recorder) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.recorder = rec
+}
+
+// getRecorder returns the recorder, answering 404 when there is none
+func (d *Debugger) getRecorder(w http.ResponseWriter) *Recorder {
+	d.mu.RLock()
+	rec := d.recorder
+	d.mu.RUnlock()
+	if rec == nil {
+		http.Error(w, "Request recording is disabled", http.StatusNotFound)
+	}
+	return rec
+}
+
+// listRecordings lists the recorded requests, newest first
+func (d *Debugger) listRecordings(w http.ResponseWriter, r *http.Request) {
+	d.mu.RLock()
+	rec := d.recorder
+	d.mu.RUnlock()
+
+	summaries := []recordingSummary{}
+	if rec != nil {
+		recordings, err := rec.List()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, recording := range recordings {
+			summaries = append(summaries, recordingSummary{
+				ID:        recording.ID,
+				ReplayOf:  recording.ReplayOf,
+				Method:    recording.Method,
+				URL:       recording.URL,
+				Status:    recording.Response.Status,
+				Queries:   len(recording.Queries),
+				StartTime: recording.StartTime,
+				Duration:  recording.Duration,
+			})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled":    rec != nil,
+		"recordings": summaries,
+	})
+}
+
+// getRecording returns a recording in full
+func (d *Debugger) getRecording(w http.ResponseWriter, r *http.Request) {
+	rec := d.getRecorder(w)
+	if rec == nil {
+		return
+	}
+	recording, err := rec.Get(chi.URLParam(r, "id"))
+	if err != nil {
+		writeRecordingError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(recording)
+}
+
+// recordingCurl returns a curl command repeating a recorded request
+func (d *Debugger) recordingCurl(w http.ResponseWriter, r *http.Request) {
+	rec := d.getRecorder(w)
+	if rec == nil {
+		return
+	}
+	recording, err := rec.Get(chi.URLParam(r, "id"))
+	if err != nil {
+		writeRecordingError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(recording.Curl() + "\n"))
+}
+
+// replayRecording serves a recorded request again and returns the new
+// recording
+func (d *Debugger) replayRecording(w http.ResponseWriter, r *http.Request) {
+	rec := d.getRecorder(w)
+	if rec == nil {
+		return
+	}
+	recording, err := rec.Replay(chi.URLParam(r, "id"))
+	if err != nil {
+		writeRecordingError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(recording)
+}
+
+// resetRecordings removes every recording
+func (d *Debugger) resetRecordings(w http.ResponseWriter, r *http.Request) {
+	rec := d.getRecorder(w)
+	if rec == nil {
+		return
+	}
+	if err := rec.Clear(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Recordings cleared"})
+}
+
+func writeRecordingError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	if errors.Is(err, ErrRecordingNotFound) {
+		status = http.StatusNotFound
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// recorderPage serves the page browsing the recorded requests
+func (d *Debugger) recorderPage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(recorderHTML))
+}
+
+const recorderHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Recorded Requests - Dolphin Debug</title>
+    <style>
+        body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; margin: 0; padding: 20px; background: #f5f5f5; }
+        .container { max-width: 1400px; margin: 0 auto; }
+        .header, .panel { background: white; padding: 20px; border-radius: 8px; box-shadow: 0 2px 4px rgba(0,0,0,0.1); margin-bottom: 20px; }
+        .layout { display: grid; grid-template-columns: minmax(0, 2fr) minmax(0, 3fr); gap: 20px; }
+        table { width: 100%; border-collapse: collapse; font-size: 14px; }
+        th, td { text-align: left; padding: 6px 8px; border-bottom: 1px solid #eee; white-space: nowrap; }
+        td.url { overflow: hidden; text-overflow: ellipsis; max-width: 320px; }
+        tbody tr { cursor: pointer; }
+        tbody tr:hover, tbody tr.selected { background: #eef6ff; }
+        .status-2 { color: #28a745; } .status-3 { color: #17a2b8; } .status-4 { color: #fd7e14; } .status-5 { color: #dc3545; }
+        pre { background: #f8f9fa; padding: 10px; border-radius: 4px; overflow: auto; max-height: 300px; font-size: 13px; white-space: pre-wrap; word-break: break-all; }
+        h4 { margin: 16px 0 6px; }
+        .btn { display: inline-block; padding: 8px 16px; background: #007bff; color: white; border: 0; border-radius: 4px; cursor: pointer; margin-right: 8px; text-decoration: none; font-size: 14px; }
+        .btn.secondary { background: #6c757d; }
+        .muted { color: #666; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>⏺ Recorded Requests</h1>
+            <a href="/debug/" class="btn secondary">Dashboard</a>
+            <button class="btn secondary" onclick="loadRecordings()">Refresh</button>
+            <a href="/debug/recordings/reset" class="btn secondary">Clear</a>
+            <span class="muted" id="message"></span>
+        </div>
+        <div class="layout">
+            <div class="panel">
+                <table>
+                    <thead><tr><th>Time</th><th>Method</th><th>URL</th><th>Status</th><th>Duration</th><th>Queries</th></tr></thead>
+                    <tbody id="recordings"></tbody>
+                </table>
+            </div>
+            <div class="panel" id="detail"><p class="muted">Select a request to see its details.</p></div>
+        </div>
+    </div>
+
+    <script>
+        let selected = null;
+
+        function el(tag, text, className) {
+            const node = document.createElement(tag);
+            if (text !== undefined) node.textContent = text;
+            if (className) node.className = className;
+            return node;
+        }
+
+        function ms(ns) {
+            return (ns / 1e6).toFixed(2) + 'ms';
+        }
+
+        function headers(h) {
+            return Object.keys(h || {}).sort().map(name => name + ': ' + h[name].join(', ')).join('\n');
+        }
+
+        function body(text, base64, truncated) {
+            if (!text) return '(empty)';
+            let shown = base64 ? '(binary, base64) ' + text : text;
+            if (!base64) {
+                try { shown = JSON.stringify(JSON.parse(text), null, 2); } catch (e) {}
+            }
+            return truncated ? shown + '\n… truncated' : shown;
+        }
+
+        function loadRecordings() {
+            fetch('/debug/recordings')
+                .then(response => response.json())
+                .then(data => {
+                    const rows = document.getElementById('recordings');
+                    rows.replaceChildren();
+                    document.getElementById('message').textContent = data.enabled ? '' : 'Recording is disabled (debug.record)';
+                    data.recordings.forEach(rec => {
+                        const row = el('tr');
+                        if (rec.id === selected) row.className = 'selected';
+                        row.append(
+                            el('td', new Date(rec.start_time).toLocaleTimeString()),
+                            el('td', rec.method),
+                            el('td', rec.url + (rec.replay_of ? ' ↻' : ''), 'url'),
+                            el('td', rec.status, 'status-' + String(rec.status)[0]),
+                            el('td', ms(rec.duration)),
+                            el('td', rec.queries));
+                        row.onclick = () => showRecording(rec.id);
+                        rows.append(row);
+                    });
+                })
+                .catch(error => console.error('Error loading recordings:', error));
+        }
+
+        function showRecording(id) {
+            selected = id;
+            fetch('/debug/recordings/' + id)
+                .then(response => response.json())
+                .then(rec => {
+                    const detail = document.getElementById('detail');
+                    detail.replaceChildren();
+                    detail.append(el('h3', rec.method + ' ' + rec.url));
+                    detail.append(el('p', 'Status ' + rec.response.status + ' in ' + ms(rec.duration) +
+                        (rec.request_id ? ' · request ' + rec.request_id : '') +
+                        (rec.replay_of ? ' · replay of ' + rec.replay_of : ''), 'muted'));
+
+                    const replay = el('button', 'Replay request', 'btn');
+                    replay.onclick = () => replayRecording(rec.id);
+                    const curl = el('button', 'Copy as curl', 'btn secondary');
+                    curl.onclick = () => copyCurl(rec.id);
+                    detail.append(replay, curl);
+
+                    detail.append(el('h4', 'Request headers'), el('pre', headers(rec.headers)));
+                    detail.append(el('h4', 'Request body'), el('pre', body(rec.body, rec.body_base64, rec.body_truncated)));
+                    detail.append(el('h4', 'Response headers'), el('pre', headers(rec.response.headers)));
+                    detail.append(el('h4', 'Response body (' + rec.response.size + ' bytes)'),
+                        el('pre', body(rec.response.body, rec.response.body_base64, rec.response.body_truncated)));
+
+                    const queries = rec.queries || [];
+                    detail.append(el('h4', 'Queries (' + queries.length + ')'));
+                    detail.append(el('pre', queries.map(q => ms(q.duration) + (q.slow ? ' SLOW' : '') + '  ' + q.sql +
+                        (q.error ? '\n  error: ' + q.error : '')).join('\n') || '(none)'));
+                    loadRecordings();
+                });
+        }
+
+        function replayRecording(id) {
+            fetch('/debug/recordings/' + id + '/replay', {method: 'POST'})
+                .then(response => response.ok ? response.json() : response.text().then(text => Promise.reject(text)))
+                .then(rec => showRecording(rec.id))
+                .catch(error => { document.getElementById('message').textContent = 'Replay failed: ' + error; });
+        }
+
+        function copyCurl(id) {
+            fetch('/debug/recordings/' + id + '/curl')
+                .then(response => response.text())
+                .then(text => navigator.clipboard.writeText(text))
+                .then(() => { document.getElementById('message').textContent = 'curl command copied'; })
+                .catch(error => { document.getElementById('message').textContent = 'Copy failed: ' + error; });
+        }
+
+        loadRecordings();
+        setInterval(loadRecordings, 5000);
+    </script>
+</body>
+</html>`
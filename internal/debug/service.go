@@ -13,6 +13,10 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/mrhoseah/dolphin/internal/database"
+	"github.com/mrhoseah/dolphin/internal/observability"
+	"github.com/mrhoseah/dolphin/internal/webhooks"
 )
 
 // Debugger provides debugging capabilities
@@ -25,6 +29,12 @@ type Debugger struct {
 	mu        sync.RWMutex
 	requests  map[string]*RequestInfo
 	stats     *Stats
+	queryLog  *database.QueryLog
+	recorder  *Recorder
+	slos      *observability.SLOTracker
+	webhooks  *webhooks.Capturer
+
+	allocations *AllocationTracker
 }
 
 // RequestInfo holds information about a request
@@ -112,6 +122,13 @@ func NewDebugger(config Config) *Debugger {
 	return d
 }
 
+// SetQueryLog shows the database query log on the dashboard
+func (d *Debugger) SetQueryLog(log *database.QueryLog) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.queryLog = log
+}
+
 // Middleware returns the debug middleware
 func (d *Debugger) Middleware() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -220,6 +237,33 @@ func (d *Debugger) Router() chi.Router {
 	// Goroutine information
 	r.Get("/goroutines", d.getGoroutines)
 
+	// Database queries
+	r.Get("/queries", d.listQueries)
+	r.Get("/queries/reset", d.resetQueries)
+
+	// Recorded requests
+	r.Get("/recorder", d.recorderPage)
+	r.Get("/recordings", d.listRecordings)
+	r.Get("/recordings/reset", d.resetRecordings)
+	r.Get("/recordings/{id}", d.getRecording)
+	r.Get("/recordings/{id}/curl", d.recordingCurl)
+	r.Post("/recordings/{id}/replay", d.replayRecording)
+
+	// Inbound webhooks
+	r.Get("/webhook", d.webhookPage)
+	r.Get("/webhooks", d.listWebhooks)
+	r.Get("/webhooks/{id}", d.getWebhook)
+	r.Post("/webhooks/{id}/replay", d.replayWebhook)
+
+	// Service level objectives
+	r.Get("/slo", d.sloPage)
+	r.Get("/slos", d.listSLOs)
+
+	// Allocations per route
+	r.Get("/allocation", d.allocationPage)
+	r.Get("/allocations", d.listAllocations)
+	r.Get("/allocations/reset", d.resetAllocations)
+
 	// Profiling
 	if d.profiler != nil {
 		r.Get("/profile/cpu", d.cpuProfile)
@@ -397,6 +441,69 @@ func (d *Debugger) dashboard(w http.ResponseWriter, r *http.Request) {
                 <a href="/debug/requests" class="btn">View All</a>
             </div>
             
+            <div class="card">
+                <h3>🗄️ Queries</h3>
+                <div class="stat">
+                    <span class="stat-label">Total Queries:</span>
+                    <span class="stat-value" id="queries-total">-</span>
+                </div>
+                <div class="stat">
+                    <span class="stat-label">Slow Queries:</span>
+                    <span class="stat-value" id="queries-slow">-</span>
+                </div>
+                <a href="/debug/queries" class="btn">View All</a>
+                <a href="/debug/queries?slow=1" class="btn">Slow Only</a>
+            </div>
+            
+            <div class="card">
+                <h3>⏺ Recordings</h3>
+                <div class="stat">
+                    <span class="stat-label">Recorded Requests:</span>
+                    <span class="stat-value" id="recordings-total">-</span>
+                </div>
+                <a href="/debug/recorder" class="btn">Browse</a>
+                <a href="/debug/recordings/reset" class="btn">Clear</a>
+            </div>
+            
+            <div class="card">
+                <h3>🪝 Webhooks</h3>
+                <div class="stat">
+                    <span class="stat-label">Recent Deliveries:</span>
+                    <span class="stat-value" id="webhooks-total">-</span>
+                </div>
+                <div class="stat">
+                    <span class="stat-label">Failed:</span>
+                    <span class="stat-value" id="webhooks-failed">-</span>
+                </div>
+                <a href="/debug/webhook" class="btn">Browse</a>
+            </div>
+            
+            <div class="card">
+                <h3>🎯 SLOs</h3>
+                <div class="stat">
+                    <span class="stat-label">Objectives:</span>
+                    <span class="stat-value" id="slos-total">-</span>
+                </div>
+                <div class="stat">
+                    <span class="stat-label">Alerting:</span>
+                    <span class="stat-value" id="slos-alerting">-</span>
+                </div>
+                <a href="/debug/slo" class="btn">View Budgets</a>
+            </div>
+            
+            <div class="card">
+                <h3>🧮 Allocations</h3>
+                <div class="stat">
+                    <span class="stat-label">Routes Over Budget:</span>
+                    <span class="stat-value" id="allocations-over">-</span>
+                </div>
+                <div class="stat">
+                    <span class="stat-label">Worst Route:</span>
+                    <span class="stat-value" id="allocations-worst">-</span>
+                </div>
+                <a href="/debug/allocation" class="btn">View Routes</a>
+            </div>
+            
             <div class="card">
                 <h3>📈 Profiling</h3>
                 <p>CPU and memory profiling tools</p>
@@ -429,6 +536,42 @@ func (d *Debugger) dashboard(w http.ResponseWriter, r *http.Request) {
                     document.getElementById('gc-runs').textContent = data.gc_stats.num_gc || 0;
                 })
                 .catch(error => console.error('Error updating stats:', error));
+            fetch('/debug/queries')
+                .then(response => response.json())
+                .then(data => {
+                    document.getElementById('queries-total').textContent = data.total || 0;
+                    document.getElementById('queries-slow').textContent = data.slow || 0;
+                })
+                .catch(error => console.error('Error updating queries:', error));
+            fetch('/debug/recordings')
+                .then(response => response.json())
+                .then(data => {
+                    document.getElementById('recordings-total').textContent = data.enabled ? data.recordings.length : 'off';
+                })
+                .catch(error => console.error('Error updating recordings:', error));
+            fetch('/debug/webhooks')
+                .then(response => response.json())
+                .then(data => {
+                    document.getElementById('webhooks-total').textContent = data.enabled ? data.deliveries.length : 'off';
+                    document.getElementById('webhooks-failed').textContent =
+                        data.deliveries.filter(delivery => delivery.status < 200 || delivery.status >= 300).length;
+                })
+                .catch(error => console.error('Error updating webhooks:', error));
+            fetch('/debug/slos')
+                .then(response => response.json())
+                .then(data => {
+                    document.getElementById('slos-total').textContent = data.enabled ? data.slos.length : 'off';
+                    document.getElementById('slos-alerting').textContent = data.slos.filter(slo => slo.alerting).length;
+                })
+                .catch(error => console.error('Error updating SLOs:', error));
+            fetch('/debug/allocations')
+                .then(response => response.json())
+                .then(data => {
+                    document.getElementById('allocations-over').textContent = data.enabled ?
+                        data.routes.filter(route => route.over_budget).length : 'off';
+                    document.getElementById('allocations-worst').textContent = data.routes.length ? data.routes[0].route : '-';
+                })
+                .catch(error => console.error('Error updating allocations:', error));
         }
         
         // Update stats on load and every 5 seconds
@@ -455,6 +598,48 @@ func (d *Debugger) listRequests(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(requests)
 }
 
+// listQueries lists recent database queries, or only slow ones with ?slow=1
+func (d *Debugger) listQueries(w http.ResponseWriter, r *http.Request) {
+	d.mu.RLock()
+	queryLog := d.queryLog
+	d.mu.RUnlock()
+
+	response := map[string]interface{}{
+		"total":     0,
+		"slow":      0,
+		"threshold": "",
+		"queries":   []database.QueryRecord{},
+	}
+	if queryLog != nil {
+		total, slow := queryLog.Counts()
+		queries := queryLog.Recent()
+		if r.URL.Query().Get("slow") != "" {
+			queries = queryLog.Slow()
+		}
+		response["total"] = total
+		response["slow"] = slow
+		response["threshold"] = queryLog.Threshold().String()
+		response["queries"] = queries
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// resetQueries clears the query log
+func (d *Debugger) resetQueries(w http.ResponseWriter, r *http.Request) {
+	d.mu.RLock()
+	queryLog := d.queryLog
+	d.mu.RUnlock()
+
+	if queryLog != nil {
+		queryLog.Reset()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Queries reset"})
+}
+
 // getRequest gets a specific request
 func (d *Debugger) getRequest(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
@@ -3,7 +3,11 @@ package debug
 import (
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/observability"
 )
 
 func newTestDebugger() *Debugger {
@@ -41,3 +45,30 @@ func TestMemoryGC(t *testing.T) {
 		t.Fatalf("expected status 200, got %d", w.Code)
 	}
 }
+
+func TestSLOsEndpoint(t *testing.T) {
+	dbg := newTestDebugger()
+	r := dbg.Router()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slos", nil))
+	if !strings.Contains(w.Body.String(), `"enabled":false`) {
+		t.Fatalf("expected SLOs to be disabled, got %s", w.Body.String())
+	}
+
+	metrics := observability.NewMetricsCollector(nil, nil)
+	defer metrics.Close()
+	tracker, err := observability.NewSLOTracker(metrics, config.SLOConfig{
+		Objectives: []config.SLOObjective{{Name: "api", Routes: []string{"/api/*"}, Target: 99.9}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbg.SetSLOs(tracker)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slos", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"name":"api"`) || !strings.Contains(w.Body.String(), `"budget_remaining":1`) {
+		t.Fatalf("expected the api objective, got %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,151 @@
+package debug
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/mrhoseah/dolphin/internal/observability"
+)
+
+// SetSLOs shows the objectives tracked by slos on the dashboard
+func (d *Debugger) SetSLOs(slos *observability.SLOTracker) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.slos = slos
+}
+
+// listSLOs returns how each objective stands
+func (d *Debugger) listSLOs(w http.ResponseWriter, r *http.Request) {
+	d.mu.RLock()
+	slos := d.slos
+	d.mu.RUnlock()
+
+	statuses := []observability.SLOStatus{}
+	if slos != nil {
+		statuses = slos.Status()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled": slos != nil,
+		"slos":    statuses,
+	})
+}
+
+// sloPage serves the page showing the objectives' budgets and burn rates
+func (d *Debugger) sloPage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(sloHTML))
+}
+
+const sloHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Service Level Objectives - Dolphin Debug</title>
+    <style>
+        body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; margin: 0; padding: 20px; background: #f5f5f5; }
+        .container { max-width: 1400px; margin: 0 auto; }
+        .header, .panel { background: white; padding: 20px; border-radius: 8px; box-shadow: 0 2px 4px rgba(0,0,0,0.1); margin-bottom: 20px; }
+        table { width: 100%; border-collapse: collapse; font-size: 14px; }
+        th, td { text-align: left; padding: 8px; border-bottom: 1px solid #eee; vertical-align: top; }
+        .bar { width: 160px; height: 10px; background: #eee; border-radius: 5px; overflow: hidden; margin-top: 4px; }
+        .bar div { height: 100%; }
+        .ok { color: #28a745; } .warn { color: #fd7e14; } .alert { color: #dc3545; font-weight: bold; }
+        .btn { display: inline-block; padding: 8px 16px; background: #007bff; color: white; border: 0; border-radius: 4px; cursor: pointer; margin-right: 8px; text-decoration: none; font-size: 14px; }
+        .btn.secondary { background: #6c757d; }
+        .muted { color: #666; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>🎯 Service Level Objectives</h1>
+            <a href="/debug/" class="btn secondary">Dashboard</a>
+            <button class="btn secondary" onclick="loadSLOs()">Refresh</button>
+            <span class="muted" id="message"></span>
+        </div>
+        <div class="panel">
+            <table>
+                <thead><tr><th>Objective</th><th>Routes</th><th>Window</th><th>SLI</th><th>Error budget</th><th>Burn rates</th><th>Status</th></tr></thead>
+                <tbody id="slos"></tbody>
+            </table>
+        </div>
+    </div>
+
+    <script>
+        function el(tag, text, className) {
+            const node = document.createElement(tag);
+            if (text !== undefined) node.textContent = text;
+            if (className) node.className = className;
+            return node;
+        }
+
+        function duration(ns) {
+            const minutes = ns / 6e10;
+            if (minutes >= 1440 && minutes % 1440 === 0) return (minutes / 1440) + 'd';
+            if (minutes >= 60 && minutes % 60 === 0) return (minutes / 60) + 'h';
+            if (minutes >= 1) return minutes + 'm';
+            return (ns / 1e6) + 'ms';
+        }
+
+        function objective(slo) {
+            return slo.target + '% ' + (slo.latency ? 'within ' + duration(slo.latency) : 'available');
+        }
+
+        function budget(slo) {
+            const cell = el('td');
+            const left = slo.budget_remaining;
+            const className = left <= 0 ? 'alert' : left < 0.25 ? 'warn' : 'ok';
+            cell.append(el('span', (left * 100).toFixed(1) + '% left', className));
+            const bar = el('div', undefined, 'bar');
+            const fill = el('div');
+            fill.style.width = Math.max(0, Math.min(1, left)) * 100 + '%';
+            fill.style.background = left <= 0 ? '#dc3545' : left < 0.25 ? '#fd7e14' : '#28a745';
+            bar.append(fill);
+            cell.append(bar);
+            cell.append(el('div', slo.bad + ' bad of ' + slo.requests + ' requests', 'muted'));
+            return cell;
+        }
+
+        function burnRates(slo) {
+            const cell = el('td');
+            (slo.burn_rates || []).forEach(rate => {
+                const line = el('div', rate.severity + ': ' + rate.long_rate.toFixed(1) + '× over ' + duration(rate.long) +
+                    ', ' + rate.short_rate.toFixed(1) + '× over ' + duration(rate.short) + ' (alerts at ' + rate.threshold + '×)',
+                    rate.firing ? 'alert' : '');
+                cell.append(line);
+            });
+            return cell;
+        }
+
+        function loadSLOs() {
+            fetch('/debug/slos')
+                .then(response => response.json())
+                .then(data => {
+                    const rows = document.getElementById('slos');
+                    rows.replaceChildren();
+                    document.getElementById('message').textContent = data.enabled ?
+                        (data.slos.length ? '' : 'No objectives configured (slo.objectives)') : 'SLO tracking is disabled (slo.enabled)';
+                    data.slos.forEach(slo => {
+                        const row = el('tr');
+                        row.append(
+                            el('td', slo.name + ' · ' + objective(slo)),
+                            el('td', (slo.routes || []).join(', ') || 'all'),
+                            el('td', duration(slo.window)),
+                            el('td', slo.sli.toFixed(3) + '%'),
+                            budget(slo),
+                            burnRates(slo),
+                            el('td', slo.alerting ? 'ALERTING' : 'OK', slo.alerting ? 'alert' : 'ok'));
+                        rows.append(row);
+                    });
+                })
+                .catch(error => console.error('Error loading SLOs:', error));
+        }
+
+        loadSLOs();
+        setInterval(loadSLOs, 5000);
+    </script>
+</body>
+</html>`
@@ -0,0 +1,265 @@
+package debug
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/mrhoseah/dolphin/internal/webhooks"
+)
+
+// deliverySummary is a webhook delivery as listed, without its payload
+type deliverySummary struct {
+	ID         string        `json:"id"`
+	Source     string        `json:"source"`
+	ReplayOf   string        `json:"replay_of,omitempty"`
+	Method     string        `json:"method"`
+	URL        string        `json:"url"`
+	Status     int           `json:"status"`
+	ReceivedAt time.Time     `json:"received_at"`
+	Duration   time.Duration `json:"duration"`
+}
+
+// SetWebhooks shows the inbound webhooks kept by c on the dashboard
+func (d *Debugger) SetWebhooks(c *webhooks.Capturer) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.webhooks = c
+}
+
+// getWebhooks returns the capturer, answering 404 when there is none
+func (d *Debugger) getWebhooks(w http.ResponseWriter) *webhooks.Capturer {
+	d.mu.RLock()
+	c := d.webhooks
+	d.mu.RUnlock()
+	if c == nil {
+		http.Error(w, "Webhook capture is disabled", http.StatusNotFound)
+	}
+	return c
+}
+
+// listWebhooks lists the kept deliveries, newest first, of ?source= and
+// only the failed ones with ?failed=1
+func (d *Debugger) listWebhooks(w http.ResponseWriter, r *http.Request) {
+	d.mu.RLock()
+	c := d.webhooks
+	d.mu.RUnlock()
+
+	summaries := []deliverySummary{}
+	if c != nil {
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		deliveries, err := c.Store().List(r.Context(), webhooks.Filter{
+			Source: r.URL.Query().Get("source"),
+			Failed: r.URL.Query().Get("failed") != "",
+			Limit:  limit,
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, delivery := range deliveries {
+			summaries = append(summaries, deliverySummary{
+				ID:         delivery.ID,
+				Source:     delivery.Source,
+				ReplayOf:   delivery.ReplayOf,
+				Method:     delivery.Method,
+				URL:        delivery.URL,
+				Status:     delivery.Status,
+				ReceivedAt: delivery.ReceivedAt,
+				Duration:   delivery.Duration,
+			})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled":    c != nil,
+		"deliveries": summaries,
+	})
+}
+
+// getWebhook returns a delivery in full
+func (d *Debugger) getWebhook(w http.ResponseWriter, r *http.Request) {
+	c := d.getWebhooks(w)
+	if c == nil {
+		return
+	}
+	delivery, err := c.Store().Get(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(delivery)
+}
+
+// replayWebhook processes a delivery again and returns the replay's
+// delivery
+func (d *Debugger) replayWebhook(w http.ResponseWriter, r *http.Request) {
+	c := d.getWebhooks(w)
+	if c == nil {
+		return
+	}
+	delivery, err := c.Replay(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(delivery)
+}
+
+func writeWebhookError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	if errors.Is(err, webhooks.ErrNotFound) {
+		status = http.StatusNotFound
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// webhookPage serves the page browsing the inbound webhooks
+func (d *Debugger) webhookPage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(webhookHTML))
+}
+
+const webhookHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Inbound Webhooks - Dolphin Debug</title>
+    <style>
+        body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; margin: 0; padding: 20px; background: #f5f5f5; }
+        .container { max-width: 1400px; margin: 0 auto; }
+        .header, .panel { background: white; padding: 20px; border-radius: 8px; box-shadow: 0 2px 4px rgba(0,0,0,0.1); margin-bottom: 20px; }
+        .layout { display: grid; grid-template-columns: minmax(0, 2fr) minmax(0, 3fr); gap: 20px; }
+        table { width: 100%; border-collapse: collapse; font-size: 14px; }
+        th, td { text-align: left; padding: 6px 8px; border-bottom: 1px solid #eee; white-space: nowrap; }
+        td.url { overflow: hidden; text-overflow: ellipsis; max-width: 280px; }
+        tbody tr { cursor: pointer; }
+        tbody tr:hover, tbody tr.selected { background: #eef6ff; }
+        .status-2 { color: #28a745; } .status-3 { color: #17a2b8; } .status-4 { color: #fd7e14; } .status-5 { color: #dc3545; }
+        pre { background: #f8f9fa; padding: 10px; border-radius: 4px; overflow: auto; max-height: 300px; font-size: 13px; white-space: pre-wrap; word-break: break-all; }
+        h4 { margin: 16px 0 6px; }
+        .btn { display: inline-block; padding: 8px 16px; background: #007bff; color: white; border: 0; border-radius: 4px; cursor: pointer; margin-right: 8px; text-decoration: none; font-size: 14px; }
+        .btn.secondary { background: #6c757d; }
+        .muted { color: #666; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>🪝 Inbound Webhooks</h1>
+            <a href="/debug/" class="btn secondary">Dashboard</a>
+            <button class="btn secondary" onclick="loadDeliveries()">Refresh</button>
+            <label><input type="checkbox" id="failed" onchange="loadDeliveries()"> Failed only</label>
+            <span class="muted" id="message"></span>
+        </div>
+        <div class="layout">
+            <div class="panel">
+                <table>
+                    <thead><tr><th>Received</th><th>Source</th><th>Method</th><th>URL</th><th>Status</th><th>Duration</th></tr></thead>
+                    <tbody id="deliveries"></tbody>
+                </table>
+            </div>
+            <div class="panel" id="detail"><p class="muted">Select a delivery to see its payload.</p></div>
+        </div>
+    </div>
+
+    <script>
+        let selected = null;
+
+        function el(tag, text, className) {
+            const node = document.createElement(tag);
+            if (text !== undefined) node.textContent = text;
+            if (className) node.className = className;
+            return node;
+        }
+
+        function ms(ns) {
+            return (ns / 1e6).toFixed(2) + 'ms';
+        }
+
+        function headers(h) {
+            return Object.keys(h || {}).sort().map(name => name + ': ' + h[name].join(', ')).join('\n');
+        }
+
+        function body(text, base64, truncated) {
+            if (!text) return '(empty)';
+            let shown = base64 ? '(binary, base64) ' + text : text;
+            if (!base64) {
+                try { shown = JSON.stringify(JSON.parse(text), null, 2); } catch (e) {}
+            }
+            return truncated ? shown + '\n… truncated, can\'t be replayed' : shown;
+        }
+
+        function loadDeliveries() {
+            const failed = document.getElementById('failed').checked;
+            fetch('/debug/webhooks' + (failed ? '?failed=1' : ''))
+                .then(response => response.json())
+                .then(data => {
+                    const rows = document.getElementById('deliveries');
+                    rows.replaceChildren();
+                    document.getElementById('message').textContent = data.enabled ? '' : 'Webhook capture is disabled (webhooks.capture)';
+                    data.deliveries.forEach(delivery => {
+                        const row = el('tr');
+                        if (delivery.id === selected) row.className = 'selected';
+                        row.append(
+                            el('td', new Date(delivery.received_at).toLocaleString()),
+                            el('td', delivery.source),
+                            el('td', delivery.method),
+                            el('td', delivery.url + (delivery.replay_of ? ' ↻' : ''), 'url'),
+                            el('td', delivery.status, 'status-' + String(delivery.status)[0]),
+                            el('td', ms(delivery.duration)));
+                        row.onclick = () => showDelivery(delivery.id);
+                        rows.append(row);
+                    });
+                })
+                .catch(error => console.error('Error loading webhooks:', error));
+        }
+
+        function showDelivery(id) {
+            selected = id;
+            fetch('/debug/webhooks/' + id)
+                .then(response => response.json())
+                .then(delivery => {
+                    const detail = document.getElementById('detail');
+                    detail.replaceChildren();
+                    detail.append(el('h3', delivery.source + ' · ' + delivery.method + ' ' + delivery.url));
+                    detail.append(el('p', 'Status ' + delivery.status + ' in ' + ms(delivery.duration) +
+                        ' · received ' + new Date(delivery.received_at).toLocaleString() +
+                        (delivery.replay_of ? ' · replay of ' + delivery.replay_of : ''), 'muted'));
+
+                    if (!delivery.body_truncated) {
+                        const replay = el('button', 'Replay webhook', 'btn');
+                        replay.onclick = () => replayDelivery(delivery.id);
+                        detail.append(replay);
+                    }
+                    detail.append(el('code', 'dolphin webhooks:replay ' + delivery.id, 'muted'));
+
+                    detail.append(el('h4', 'Headers'), el('pre', headers(delivery.headers)));
+                    detail.append(el('h4', 'Payload'), el('pre', body(delivery.body, delivery.body_base64, delivery.body_truncated)));
+                    detail.append(el('h4', 'Response'), el('pre', body(delivery.response)));
+                    loadDeliveries();
+                });
+        }
+
+        function replayDelivery(id) {
+            fetch('/debug/webhooks/' + id + '/replay', {method: 'POST'})
+                .then(response => response.ok ? response.json() : response.text().then(text => Promise.reject(text)))
+                .then(delivery => showDelivery(delivery.id))
+                .catch(error => { document.getElementById('message').textContent = 'Replay failed: ' + error; });
+        }
+
+        loadDeliveries();
+        setInterval(loadDeliveries, 5000);
+    </script>
+</body>
+</html>`
@@ -0,0 +1,283 @@
+// Package dolphin provides Context, a request and its response writer with
+// typed helpers for the work most handlers do: reading route params and
+// query values, binding and validating input, finding the signed-in user,
+// accepting uploads and responding with JSON, HTML, redirects or files, or
+// in the format the client negotiates.
+//
+// Handlers taking a Context return an error instead of writing one, and
+// Handler adapts them to http.HandlerFunc, so they are registered on chi
+// routers like any other handler:
+//
+//	r.Get("/{id}", dolphin.Handler(c.Show))
+//
+//	func (c *PostController) Show(ctx *dolphin.Context) error {
+//		id, err := ctx.ParamUint("id")
+//		if err != nil {
+//			return err
+//		}
+//		post, err := c.repo.Find(ctx.Context(), id)
+//		if err != nil {
+//			return problem.RecordNotFound(err, "post", id)
+//		}
+//		return ctx.Respond(http.StatusOK, post)
+//	}
+package dolphin
+
+import (
+	"bytes"
+	"context"
+	"html/template"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+
+	"github.com/mrhoseah/dolphin/internal/auth"
+	"github.com/mrhoseah/dolphin/internal/binding"
+	"github.com/mrhoseah/dolphin/internal/media"
+	"github.com/mrhoseah/dolphin/internal/problem"
+	"github.com/mrhoseah/dolphin/internal/resources"
+	"github.com/mrhoseah/dolphin/internal/sse"
+)
+
+// HandlerFunc handles a request through its Context. A returned error is
+// written as a problem, so it must only be returned before the response
+// has started; helpers that write their own failures, such as
+// export.Respond, are called without returning theirs.
+type HandlerFunc func(ctx *Context) error
+
+// Handler adapts fn to an http.HandlerFunc for chi routes and middleware
+func Handler(fn HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := fn(New(w, r)); err != nil {
+			problem.Write(w, r, err)
+		}
+	}
+}
+
+// Context wraps a request and its response writer
+type Context struct {
+	Writer  http.ResponseWriter
+	Request *http.Request
+}
+
+// New wraps w and r, for using the helpers in a plain http.HandlerFunc
+func New(w http.ResponseWriter, r *http.Request) *Context {
+	return &Context{Writer: w, Request: r}
+}
+
+// Context returns the request's context, for passing to repositories and
+// services
+func (c *Context) Context() context.Context {
+	return c.Request.Context()
+}
+
+// Param returns a route parameter, or "" when the route has none of that name
+func (c *Context) Param(name string) string {
+	return chi.URLParam(c.Request, name)
+}
+
+// ParamInt returns a route parameter as an int, failing with 400 Bad
+// Request when it isn't one
+func (c *Context) ParamInt(name string) (int, error) {
+	value, err := strconv.Atoi(c.Param(name))
+	if err != nil {
+		return 0, invalid(name)
+	}
+	return value, nil
+}
+
+// ParamUint returns a route parameter as a uint, such as a record's ID,
+// failing with 400 Bad Request when it isn't one
+func (c *Context) ParamUint(name string) (uint, error) {
+	value, err := strconv.ParseUint(c.Param(name), 10, 32)
+	if err != nil {
+		return 0, invalid(name)
+	}
+	return uint(value), nil
+}
+
+// Query returns a query string value, or "" when it isn't given
+func (c *Context) Query(name string) string {
+	return c.Request.URL.Query().Get(name)
+}
+
+// QueryDefault returns a query string value, or fallback when it is empty
+func (c *Context) QueryDefault(name, fallback string) string {
+	if value := c.Query(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// QueryInt returns a query string value as an int, or fallback when it is
+// empty, failing with 400 Bad Request when it isn't a number
+func (c *Context) QueryInt(name string, fallback int) (int, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return fallback, nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, invalid(name)
+	}
+	return value, nil
+}
+
+// QueryBool returns a query string value as a bool, or fallback when it is
+// empty, failing with 400 Bad Request when it isn't one
+func (c *Context) QueryBool(name string, fallback bool) (bool, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return fallback, nil
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, invalid(name)
+	}
+	return value, nil
+}
+
+// Header returns a request header
+func (c *Context) Header(name string) string {
+	return c.Request.Header.Get(name)
+}
+
+// Bind populates dst, a pointer to struct, from the route params, query
+// string and body, as binding.Bind does
+func (c *Context) Bind(dst interface{}) error {
+	return binding.Bind(c.Request, dst)
+}
+
+// Validate binds dst as Bind does, then checks its `validate` tag rules.
+// The errors are written as 400 or 422 problems listing each field.
+func (c *Context) Validate(dst interface{}) error {
+	return binding.BindAndValidate(c.Request, dst)
+}
+
+// File validates the file uploaded in a multipart form's field against
+// rules, ready to be stored with a media.Uploader
+func (c *Context) File(field string, rules media.Rules) (*media.File, error) {
+	return media.FromRequest(c.Request, field, rules)
+}
+
+// User returns the signed-in user, or nil for guests
+func (c *Context) User() auth.Authenticatable {
+	users.RLock()
+	identify := users.identify
+	users.RUnlock()
+	if identify != nil {
+		return identify(c.Request)
+	}
+	user, _ := auth.UserFromContext(c.Request.Context())
+	return user
+}
+
+// UserID returns the signed-in user's ID, failing with 401 Unauthorized
+// for guests
+func (c *Context) UserID() (uint, error) {
+	user := c.User()
+	if user == nil {
+		return 0, problem.Unauthorized("Sign in to continue")
+	}
+	return user.GetID(), nil
+}
+
+// JSON responds with v encoded as JSON
+func (c *Context) JSON(status int, v interface{}) error {
+	render.Status(c.Request, status)
+	render.JSON(c.Writer, c.Request, v)
+	return nil
+}
+
+// Respond responds with v in the format the request asks for with
+// ?format= or its Accept header: JSON unless the route enables others with
+// resources.WithFormats, such as the "formats:xml,csv,msgpack" alias.
+// Formats the route doesn't offer fail with 406 Not Acceptable.
+func (c *Context) Respond(status int, v interface{}) error {
+	return resources.Write(c.Writer, c.Request, status, v, nil)
+}
+
+// RespondPage responds as Respond does, and with the named template of t
+// executed with v for browsers, so one action serves both a page and its
+// API. Routes under /api only render the page for ?format=html.
+func (c *Context) RespondPage(status int, v interface{}, t *template.Template, name string) error {
+	return resources.Write(c.Writer, c.Request, status, v, func(w io.Writer, v interface{}) error {
+		return t.ExecuteTemplate(w, name, v)
+	})
+}
+
+// NoContent responds with 204 No Content
+func (c *Context) NoContent() error {
+	c.Writer.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// HTML responds with the named template of t executed with data. The
+// template is executed before anything is written, so a failure is
+// returned rather than sent as half a page.
+func (c *Context) HTML(status int, t *template.Template, name string, data interface{}) error {
+	var buf bytes.Buffer
+	if err := t.ExecuteTemplate(&buf, name, data); err != nil {
+		return err
+	}
+	c.Writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	c.Writer.WriteHeader(status)
+	_, err := buf.WriteTo(c.Writer)
+	return err
+}
+
+// Redirect responds with a redirect to url: 302 Found after a GET, and
+// 303 See Other after a form post so the browser follows it with a GET
+func (c *Context) Redirect(url string) error {
+	status := http.StatusFound
+	if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+		status = http.StatusSeeOther
+	}
+	http.Redirect(c.Writer, c.Request, url, status)
+	return nil
+}
+
+// Download responds with content as a file the browser saves as filename
+func (c *Context) Download(filename, contentType string, content io.Reader) error {
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Writer.Header().Set("Content-Type", contentType)
+	c.Writer.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	c.Writer.Header().Set("X-Content-Type-Options", "nosniff")
+	_, err := io.Copy(c.Writer, content)
+	return err
+}
+
+// EventStream starts a stream of server-sent events on the response, on
+// sse.Default so it ends when the server shuts down. It only fails while
+// the server is shutting down, before writing anything; send events with
+// the stream's Send or Run and return nil.
+func (c *Context) EventStream() (*sse.Stream, error) {
+	return sse.Default.Stream(c.Writer, c.Request)
+}
+
+// invalid is the error of a param or query value that doesn't parse
+func invalid(name string) error {
+	return problem.New(http.StatusBadRequest, "Invalid "+name)
+}
+
+// users finds the signed-in user of a request in place of the auth
+// middleware's record in its context
+var users struct {
+	sync.RWMutex
+	identify func(r *http.Request) auth.Authenticatable
+}
+
+// IdentifyUsers sets how Context.User finds the signed-in user, which by
+// default is the user the auth middleware authenticated for the request
+func IdentifyUsers(identify func(r *http.Request) auth.Authenticatable) {
+	users.Lock()
+	defer users.Unlock()
+	users.identify = identify
+}
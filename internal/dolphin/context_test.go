@@ -0,0 +1,189 @@
+package dolphin
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/auth"
+	"github.com/mrhoseah/dolphin/internal/resources"
+)
+
+type user struct {
+	auth.Authenticatable
+	id uint
+}
+
+func (u user) GetID() uint { return u.id }
+
+func serve(pattern, method, target string, body string, fn HandlerFunc) *httptest.ResponseRecorder {
+	r := chi.NewRouter()
+	r.Method(method, pattern, Handler(fn))
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestParamsAndQuery(t *testing.T) {
+	rec := serve("/posts/{id}", http.MethodGet, "/posts/42?page=3&draft=true", "", func(ctx *Context) error {
+		id, err := ctx.ParamUint("id")
+		require.NoError(t, err)
+		page, err := ctx.QueryInt("page", 1)
+		require.NoError(t, err)
+		size, err := ctx.QueryInt("size", 20)
+		require.NoError(t, err)
+		draft, err := ctx.QueryBool("draft", false)
+		require.NoError(t, err)
+		return ctx.JSON(http.StatusOK, map[string]interface{}{
+			"id": id, "page": page, "size": size, "draft": draft, "sort": ctx.QueryDefault("sort", "-created_at"),
+		})
+	})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"id":42,"page":3,"size":20,"draft":true,"sort":"-created_at"}`, rec.Body.String())
+
+	rec = serve("/posts/{id}", http.MethodGet, "/posts/first", "", func(ctx *Context) error {
+		_, err := ctx.ParamUint("id")
+		return err
+	})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Invalid id")
+
+	rec = serve("/posts", http.MethodGet, "/posts?page=two", "", func(ctx *Context) error {
+		_, err := ctx.QueryInt("page", 1)
+		return err
+	})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+type postInput struct {
+	Title string `json:"title" validate:"required"`
+}
+
+func TestBindAndValidate(t *testing.T) {
+	store := func(ctx *Context) error {
+		var input postInput
+		if err := ctx.Validate(&input); err != nil {
+			return err
+		}
+		return ctx.JSON(http.StatusCreated, input)
+	}
+
+	rec := serve("/posts", http.MethodPost, "/posts", `{"title":"Hello"}`, store)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.JSONEq(t, `{"title":"Hello"}`, rec.Body.String())
+
+	rec = serve("/posts", http.MethodPost, "/posts", `{"title":""}`, store)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Contains(t, rec.Body.String(), "title")
+}
+
+func TestResponders(t *testing.T) {
+	page := template.Must(template.New("post").Parse(`<h1>{{.}}</h1>`))
+	rec := serve("/", http.MethodGet, "/", "", func(ctx *Context) error {
+		return ctx.HTML(http.StatusOK, page, "post", "<Hello>")
+	})
+	assert.Equal(t, "<h1>&lt;Hello&gt;</h1>", rec.Body.String())
+	assert.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+
+	rec = serve("/", http.MethodGet, "/", "", func(ctx *Context) error {
+		return ctx.HTML(http.StatusOK, page, "missing", nil)
+	})
+	assert.Equal(t, http.StatusInternalServerError, rec.Code, "nothing written before the failure")
+
+	rec = serve("/", http.MethodPost, "/", "", func(ctx *Context) error { return ctx.Redirect("/posts") })
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	assert.Equal(t, "/posts", rec.Header().Get("Location"))
+	rec = serve("/", http.MethodGet, "/", "", func(ctx *Context) error { return ctx.Redirect("/posts") })
+	assert.Equal(t, http.StatusFound, rec.Code)
+
+	rec = serve("/", http.MethodDelete, "/", "", func(ctx *Context) error { return ctx.NoContent() })
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = serve("/", http.MethodGet, "/", "", func(ctx *Context) error {
+		return ctx.Download("report.csv", "text/csv", strings.NewReader("id\n1\n"))
+	})
+	assert.Equal(t, "id\n1\n", rec.Body.String())
+	assert.Equal(t, "attachment; filename=report.csv", rec.Header().Get("Content-Disposition"))
+
+	rec = serve("/", http.MethodGet, "/", "", func(ctx *Context) error { return errors.New("boom") })
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
+
+func TestRespondNegotiates(t *testing.T) {
+	page := template.Must(template.New("post").Parse(`<h1>{{.title}}</h1>`))
+	show := func(ctx *Context) error {
+		return ctx.RespondPage(http.StatusOK, map[string]string{"title": "Hello"}, page, "post")
+	}
+	r := chi.NewRouter()
+	r.Get("/posts/1", Handler(show))
+	r.With(resources.WithFormats(resources.FormatXML)).Get("/api/posts/1", Handler(func(ctx *Context) error {
+		return ctx.Respond(http.StatusOK, map[string]string{"title": "Hello"})
+	}))
+	get := func(target, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Accept", accept)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/posts/1", "text/html,*/*;q=0.8")
+	assert.Equal(t, "<h1>Hello</h1>", rec.Body.String())
+	rec = get("/posts/1", "application/json")
+	assert.JSONEq(t, `{"title":"Hello"}`, rec.Body.String())
+	rec = get("/api/posts/1", "application/xml")
+	assert.Contains(t, rec.Body.String(), "<title>Hello</title>")
+	assert.Equal(t, http.StatusNotAcceptable, get("/api/posts/1?format=csv", "").Code)
+}
+
+func TestUser(t *testing.T) {
+	t.Cleanup(func() { IdentifyUsers(nil) })
+	whoami := func(ctx *Context) error {
+		id, err := ctx.UserID()
+		if err != nil {
+			return err
+		}
+		return ctx.JSON(http.StatusOK, id)
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, serve("/", http.MethodGet, "/", "", whoami).Code)
+
+	// The user the auth middleware authenticated for the request
+	r := chi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			next.ServeHTTP(w, req.WithContext(auth.WithUser(req.Context(), user{id: 5})))
+		})
+	})
+	r.Get("/", Handler(whoami))
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, "5\n", rec.Body.String())
+
+	IdentifyUsers(func(r *http.Request) auth.Authenticatable {
+		if r.Header.Get("Authorization") == "" {
+			return nil
+		}
+		return user{id: 7}
+	})
+	assert.Equal(t, http.StatusUnauthorized, serve("/", http.MethodGet, "/", "", whoami).Code, "a guest")
+
+	r = chi.NewRouter()
+	r.Get("/", Handler(whoami))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	assert.Equal(t, "7\n", rec.Body.String())
+}
@@ -7,6 +7,8 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+
+	"github.com/mrhoseah/dolphin/internal/correlation"
 )
 
 // BaseEvent provides a default implementation of Event interface
@@ -101,6 +103,9 @@ func (d *eventDispatcher) Dispatch(ctx context.Context, event Event) error {
 }
 
 func (d *eventDispatcher) DispatchAsync(ctx context.Context, event Event) error {
+	// The request ctx came from may end before the listeners do, but its
+	// values still correlate their logs and spans
+	ctx = context.WithoutCancel(ctx)
 	go func() {
 		if err := d.Dispatch(ctx, event); err != nil {
 			// Log error or handle as needed
@@ -170,14 +175,21 @@ func (d *eventDispatcher) sortListeners(eventName string) {
 
 // EventQueue implementation using in-memory queue
 type eventQueue struct {
-	queue []Event
+	queue []queuedEvent
 	mutex sync.Mutex
 }
 
+// queuedEvent is an event with the request it was pushed from, for
+// Process to restore
+type queuedEvent struct {
+	event  Event
+	fields correlation.Fields
+}
+
 // NewEventQueue creates a new event queue
 func NewEventQueue() EventQueue {
 	return &eventQueue{
-		queue: make([]Event, 0),
+		queue: make([]queuedEvent, 0),
 	}
 }
 
@@ -185,21 +197,29 @@ func (q *eventQueue) Push(ctx context.Context, event Event) error {
 	q.mutex.Lock()
 	defer q.mutex.Unlock()
 
-	q.queue = append(q.queue, event)
+	q.queue = append(q.queue, queuedEvent{event: event, fields: correlation.Capture(ctx)})
 	return nil
 }
 
 func (q *eventQueue) Pop(ctx context.Context) (Event, error) {
+	queued, err := q.pop()
+	if err != nil {
+		return nil, err
+	}
+	return queued.event, nil
+}
+
+func (q *eventQueue) pop() (queuedEvent, error) {
 	q.mutex.Lock()
 	defer q.mutex.Unlock()
 
 	if len(q.queue) == 0 {
-		return nil, fmt.Errorf("queue is empty")
+		return queuedEvent{}, fmt.Errorf("queue is empty")
 	}
 
-	event := q.queue[0]
+	queued := q.queue[0]
 	q.queue = q.queue[1:]
-	return event, nil
+	return queued, nil
 }
 
 func (q *eventQueue) Size(ctx context.Context) (int, error) {
@@ -213,24 +233,29 @@ func (q *eventQueue) Clear(ctx context.Context) error {
 	q.mutex.Lock()
 	defer q.mutex.Unlock()
 
-	q.queue = make([]Event, 0)
+	q.queue = make([]queuedEvent, 0)
 	return nil
 }
 
+// Process dispatches queued events until ctx is done, each with the
+// request it was pushed from restored
 func (q *eventQueue) Process(ctx context.Context, dispatcher EventDispatcher) error {
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
-			event, err := q.Pop(ctx)
+			queued, err := q.pop()
 			if err != nil {
 				// Queue is empty, wait a bit
 				time.Sleep(100 * time.Millisecond)
 				continue
 			}
 
-			if err := dispatcher.Dispatch(ctx, event); err != nil {
+			err = correlation.Run(ctx, queued.fields, "event "+queued.event.GetName(), func(ctx context.Context) error {
+				return dispatcher.Dispatch(ctx, queued.event)
+			})
+			if err != nil {
 				// Log error or handle as needed
 				fmt.Printf("Event processing error: %v\n", err)
 			}
@@ -255,6 +280,15 @@ func NewEventBus() EventBus {
 	}
 }
 
+// NewEventBusWithQueue creates an event bus publishing asynchronous events
+// to queue, such as one kept by a queue connection
+func NewEventBusWithQueue(queue EventQueue) EventBus {
+	return &eventBus{
+		EventDispatcher: NewEventDispatcher(),
+		EventQueue:      queue,
+	}
+}
+
 func (b *eventBus) Subscribe(eventName string, listener Listener) {
 	b.Listen(eventName, listener)
 }
@@ -0,0 +1,373 @@
+// Package experiments runs A/B tests. Each experiment is a feature flag with
+// variants: units, signed-in users or guests by a visitor cookie, are
+// assigned one by weight and keep it on every request. The first time a
+// request reads a unit's variant, an Exposed event is published on the bus
+// and counted in Prometheus, so outcomes can be compared by variant:
+//
+//	switch experiments.Assigned(r.Context(), "checkout_button") {
+//	case "green":
+//		...
+//	}
+//
+// Templates read it with {{variant "checkout_button"}} or
+// {{if inVariant "checkout_button" "green"}}.
+package experiments
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/bus"
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+// Experiment is an experiment and its variants
+type Experiment struct {
+	Name    string
+	Enabled bool
+
+	// Traffic is the share of units enrolled, from 0 to 1
+	Traffic float64
+
+	// Variants are split by weight; the first is the control, which units
+	// not enrolled get
+	Variants []Variant
+}
+
+// Variant is a variant of an experiment and its share of units
+type Variant struct {
+	Name   string
+	Weight int
+}
+
+// Control returns the experiment's first variant
+func (e *Experiment) Control() string {
+	return e.Variants[0].Name
+}
+
+// has reports whether the experiment has a variant
+func (e *Experiment) has(variant string) bool {
+	for _, v := range e.Variants {
+		if v.Name == variant {
+			return true
+		}
+	}
+	return false
+}
+
+// pick returns the variant a unit hashes to, and false when the unit isn't
+// enrolled. The same unit always hashes to the same variant while the
+// experiment's traffic and weights stay the same.
+func (e *Experiment) pick(unit string) (string, bool) {
+	if fraction(e.Name, "traffic", unit) >= e.Traffic {
+		return e.Control(), false
+	}
+	total := 0
+	for _, v := range e.Variants {
+		total += v.Weight
+	}
+	bucket := int(fraction(e.Name, "variant", unit) * float64(total))
+	for _, v := range e.Variants {
+		if bucket < v.Weight {
+			return v.Name, true
+		}
+		bucket -= v.Weight
+	}
+	return e.Variants[len(e.Variants)-1].Name, true
+}
+
+// fraction hashes a unit into [0, 1), independently for each experiment
+// and purpose
+func fraction(experiment, purpose, unit string) float64 {
+	sum := sha256.Sum256([]byte(experiment + "\x00" + purpose + "\x00" + unit))
+	return float64(binary.BigEndian.Uint64(sum[:8])>>11) / (1 << 53)
+}
+
+// validName matches experiment and variant names, which label metrics
+var validName = regexp.MustCompile(`^[a-z0-9_.-]+$`)
+
+// validate checks an experiment, defaulting its traffic to everyone
+func (e *Experiment) validate() error {
+	if !validName.MatchString(e.Name) {
+		return fmt.Errorf("experiments: invalid name %q", e.Name)
+	}
+	if len(e.Variants) < 2 {
+		return fmt.Errorf("experiments: %s needs at least two variants", e.Name)
+	}
+	seen := map[string]bool{}
+	total := 0
+	for _, v := range e.Variants {
+		if !validName.MatchString(v.Name) || seen[v.Name] {
+			return fmt.Errorf("experiments: %s has an invalid or repeated variant %q", e.Name, v.Name)
+		}
+		if v.Weight < 0 {
+			return fmt.Errorf("experiments: %s variant %s has a negative weight", e.Name, v.Name)
+		}
+		seen[v.Name] = true
+		total += v.Weight
+	}
+	if total == 0 {
+		return fmt.Errorf("experiments: %s has no weighted variants", e.Name)
+	}
+	if e.Traffic == 0 {
+		e.Traffic = 1
+	}
+	if e.Traffic < 0 || e.Traffic > 1 || math.IsNaN(e.Traffic) {
+		return fmt.Errorf("experiments: %s traffic must be between 0 and 1", e.Name)
+	}
+	return nil
+}
+
+// Exposed is published on the bus the first time a request reads a unit's
+// variant of a running experiment
+type Exposed struct {
+	Experiment string    `json:"experiment"`
+	Variant    string    `json:"variant"`
+	Unit       string    `json:"unit"`
+	UserID     string    `json:"user_id,omitempty"`
+	At         time.Time `json:"at"`
+}
+
+// EventName names Exposed when bridged to the event dispatcher
+func (Exposed) EventName() string { return "experiment.exposed" }
+
+// IdentifyFunc returns the signed-in user making a request, or false for
+// guests, who are assigned by visitor cookie
+type IdentifyFunc func(r *http.Request) (string, bool)
+
+// Service assigns units their variants and logs exposures
+type Service struct {
+	experiments map[string]*Experiment
+	store       Store
+	identify    IdentifyFunc
+	cookie      string
+	bus         *bus.Bus
+	exposures   *prometheus.CounterVec
+	logger      *zap.Logger
+}
+
+// New creates a service running experiments. Without a store, variants
+// are assigned by hash alone; without identify, every unit is a visitor.
+func New(experiments []Experiment, store Store, identify IdentifyFunc, cookie string, logger *zap.Logger) (*Service, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if cookie == "" {
+		cookie = "experiments"
+	}
+	s := &Service{
+		experiments: make(map[string]*Experiment, len(experiments)),
+		store:       store,
+		identify:    identify,
+		cookie:      cookie,
+		bus:         bus.Default,
+		logger:      logger,
+	}
+	for i := range experiments {
+		e := experiments[i]
+		if err := e.validate(); err != nil {
+			return nil, err
+		}
+		s.experiments[e.Name] = &e
+	}
+	return s, nil
+}
+
+// FromConfig creates a service running the experiments of cfg
+func FromConfig(cfg config.ExperimentsConfig, store Store, identify IdentifyFunc, logger *zap.Logger) (*Service, error) {
+	experiments := make([]Experiment, 0, len(cfg.Definitions))
+	for name, def := range cfg.Definitions {
+		e := Experiment{Name: name, Enabled: def.Enabled, Traffic: def.Traffic}
+		for _, v := range def.Variants {
+			e.Variants = append(e.Variants, Variant{Name: v.Name, Weight: v.Weight})
+		}
+		experiments = append(experiments, e)
+	}
+	return New(experiments, store, identify, cfg.Cookie, logger)
+}
+
+// CountExposures counts exposures in counter, labeled by experiment and
+// variant
+func (s *Service) CountExposures(counter *prometheus.CounterVec) {
+	s.exposures = counter
+}
+
+// Experiments returns the experiments, by name
+func (s *Service) Experiments() []Experiment {
+	out := make([]Experiment, 0, len(s.experiments))
+	for _, e := range s.experiments {
+		out = append(out, *e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Assign returns a unit's variant of an experiment, and whether the unit
+// is enrolled in it. Stored assignments win while their variant exists;
+// new ones are stored. Unknown experiments return "".
+func (s *Service) Assign(ctx context.Context, experiment, unit string) (string, bool, error) {
+	e, ok := s.experiments[experiment]
+	if !ok {
+		return "", false, nil
+	}
+	if !e.Enabled {
+		return e.Control(), false, nil
+	}
+	if s.store != nil {
+		variant, found, err := s.store.Load(ctx, experiment, unit)
+		if err != nil {
+			return e.Control(), false, err
+		}
+		if found && e.has(variant) {
+			return variant, true, nil
+		}
+	}
+	variant, enrolled := e.pick(unit)
+	if enrolled && s.store != nil {
+		if err := s.store.Save(ctx, experiment, unit, variant); err != nil {
+			return variant, true, err
+		}
+	}
+	return variant, enrolled, nil
+}
+
+type stateKey struct{}
+
+// state is a request's unit, and the variants it has read
+type state struct {
+	service *Service
+	unit    string
+	userID  string
+
+	mu       sync.Mutex
+	variants map[string]string
+}
+
+// Middleware identifies the unit of each request, setting the visitor
+// cookie of guests who have none, so handlers and templates can read
+// variants. Run again behind authentication, it replaces the visitor with
+// the user identified there.
+func (s *Service) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		st := &state{service: s, variants: make(map[string]string)}
+		if userID, ok := s.user(r); ok {
+			st.unit, st.userID = "user:"+userID, userID
+		} else {
+			st.unit = "visitor:" + s.visitor(w, r)
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), stateKey{}, st)))
+	})
+}
+
+func (s *Service) user(r *http.Request) (string, bool) {
+	if s.identify == nil {
+		return "", false
+	}
+	return s.identify(r)
+}
+
+// visitor returns a guest's visitor ID, setting a new one in the cookie
+// when they have none
+func (s *Service) visitor(w http.ResponseWriter, r *http.Request) string {
+	if cookie, err := r.Cookie(s.cookie); err == nil && len(cookie.Value) == 32 {
+		if _, err := hex.DecodeString(cookie.Value); err == nil {
+			return cookie.Value
+		}
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	visitor := hex.EncodeToString(id)
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.cookie,
+		Value:    visitor,
+		Path:     "/",
+		MaxAge:   int(365 * 24 * time.Hour / time.Second),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return visitor
+}
+
+// Assigned returns the variant of an experiment the unit of a request
+// passed through Middleware is in, logging the exposure the first time
+// the request reads it. Without Middleware, or for unknown experiments,
+// it is "".
+func Assigned(ctx context.Context, experiment string) string {
+	st, ok := ctx.Value(stateKey{}).(*state)
+	if !ok {
+		return ""
+	}
+	return st.variant(ctx, experiment)
+}
+
+// In reports whether the unit of a request is in a variant of an
+// experiment
+func In(ctx context.Context, experiment, variant string) bool {
+	return Assigned(ctx, experiment) == variant
+}
+
+func (st *state) variant(ctx context.Context, experiment string) string {
+	st.mu.Lock()
+	if variant, ok := st.variants[experiment]; ok {
+		st.mu.Unlock()
+		return variant
+	}
+	st.mu.Unlock()
+
+	s := st.service
+	variant, enrolled, err := s.Assign(ctx, experiment, st.unit)
+	if err != nil {
+		s.logger.Warn("Failed to keep experiment assignment", zap.String("experiment", experiment), zap.Error(err))
+	}
+
+	st.mu.Lock()
+	if seen, ok := st.variants[experiment]; ok {
+		st.mu.Unlock()
+		return seen
+	}
+	st.variants[experiment] = variant
+	st.mu.Unlock()
+
+	if enrolled {
+		s.expose(ctx, Exposed{Experiment: experiment, Variant: variant, Unit: st.unit, UserID: st.userID, At: time.Now()})
+	}
+	return variant
+}
+
+// expose counts an exposure and publishes it
+func (s *Service) expose(ctx context.Context, event Exposed) {
+	if s.exposures != nil {
+		s.exposures.WithLabelValues(event.Experiment, event.Variant).Inc()
+	}
+	if err := s.bus.Publish(ctx, event); err != nil {
+		s.logger.Warn("Experiment exposure handler failed", zap.String("experiment", event.Experiment), zap.Error(err))
+	}
+}
+
+// TemplateHelpers returns template functions reading the variants of the
+// request whose context is ctx: {{variant "name"}} and
+// {{inVariant "name" "variant"}}
+func TemplateHelpers(ctx context.Context) template.FuncMap {
+	return template.FuncMap{
+		"variant": func(experiment string) string {
+			return Assigned(ctx, experiment)
+		},
+		"inVariant": func(experiment, variant string) bool {
+			return In(ctx, experiment, variant)
+		},
+	}
+}
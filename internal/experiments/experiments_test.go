@@ -0,0 +1,257 @@
+package experiments
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/auth"
+	"github.com/mrhoseah/dolphin/internal/bus"
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/database"
+)
+
+var checkout = Experiment{
+	Name:     "checkout_button",
+	Enabled:  true,
+	Variants: []Variant{{Name: "control", Weight: 50}, {Name: "green", Weight: 50}},
+}
+
+// newTestService returns a service with a database store whose signed-in
+// user is named by the X-User header, and the bus it publishes on
+func newTestService(t *testing.T, experiments ...Experiment) (*Service, *bus.Bus) {
+	db, err := database.New(&config.DatabaseConfig{Driver: "sqlite", Database: filepath.Join(t.TempDir(), "app.db")})
+	require.NoError(t, err)
+	store, err := NewDBStore(db.GetDB())
+	require.NoError(t, err)
+
+	identify := func(r *http.Request) (string, bool) {
+		user := r.Header.Get("X-User")
+		return user, user != ""
+	}
+	service, err := New(experiments, store, identify, "", nil)
+	require.NoError(t, err)
+	service.bus = bus.New()
+	return service, service.bus
+}
+
+func TestAssignSplitsByWeight(t *testing.T) {
+	service, _ := newTestService(t, checkout)
+	ctx := context.Background()
+
+	counts := map[string]int{}
+	for i := 0; i < 2000; i++ {
+		variant, enrolled, err := service.Assign(ctx, "checkout_button", fmt.Sprintf("visitor:%d", i))
+		require.NoError(t, err)
+		assert.True(t, enrolled)
+		counts[variant]++
+	}
+	assert.InDelta(t, 1000, counts["control"], 100)
+	assert.InDelta(t, 1000, counts["green"], 100)
+
+	variant, enrolled, err := service.Assign(ctx, "missing", "user:1")
+	require.NoError(t, err)
+	assert.False(t, enrolled)
+	assert.Empty(t, variant)
+}
+
+func TestAssignIsSticky(t *testing.T) {
+	service, _ := newTestService(t, checkout)
+	ctx := context.Background()
+
+	first, _, err := service.Assign(ctx, "checkout_button", "user:42")
+	require.NoError(t, err)
+
+	// Reweighting doesn't move units already assigned
+	service.experiments["checkout_button"].Variants = []Variant{{Name: "control", Weight: 1}, {Name: "green", Weight: 1}, {Name: "blue", Weight: 1000}}
+	again, _, err := service.Assign(ctx, "checkout_button", "user:42")
+	require.NoError(t, err)
+	assert.Equal(t, first, again)
+
+	// Units in removed variants are reassigned
+	service.experiments["checkout_button"].Variants = []Variant{{Name: "control", Weight: 0}, {Name: "blue", Weight: 1}}
+	again, _, err = service.Assign(ctx, "checkout_button", "user:42")
+	require.NoError(t, err)
+	if first == "green" {
+		assert.Equal(t, "blue", again)
+	} else {
+		assert.Equal(t, "control", again)
+	}
+}
+
+func TestAssignTrafficAndDisabled(t *testing.T) {
+	held := checkout
+	held.Name, held.Traffic = "held_back", 0.1
+	off := checkout
+	off.Name, off.Enabled = "off", false
+	service, _ := newTestService(t, held, off)
+	ctx := context.Background()
+
+	enrolled := 0
+	for i := 0; i < 1000; i++ {
+		variant, in, err := service.Assign(ctx, "held_back", fmt.Sprintf("user:%d", i))
+		require.NoError(t, err)
+		if in {
+			enrolled++
+		} else {
+			assert.Equal(t, "control", variant)
+		}
+	}
+	assert.InDelta(t, 100, enrolled, 40)
+
+	variant, in, err := service.Assign(ctx, "off", "user:1")
+	require.NoError(t, err)
+	assert.False(t, in)
+	assert.Equal(t, "control", variant)
+}
+
+func TestNewValidates(t *testing.T) {
+	for name, e := range map[string]Experiment{
+		"one variant":  {Name: "a", Variants: []Variant{{Name: "x", Weight: 1}}},
+		"bad name":     {Name: "A B", Variants: checkout.Variants},
+		"repeated":     {Name: "a", Variants: []Variant{{Name: "x", Weight: 1}, {Name: "x", Weight: 1}}},
+		"traffic":      {Name: "a", Traffic: 2, Variants: checkout.Variants},
+		"negative":     {Name: "a", Variants: []Variant{{Name: "x", Weight: -1}, {Name: "y", Weight: 1}}},
+		"bad variants": {Name: "a", Variants: []Variant{{Name: "x y", Weight: 1}, {Name: "y", Weight: 1}}},
+	} {
+		_, err := New([]Experiment{e}, nil, nil, "", nil)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestMiddlewareExposesOncePerRequest(t *testing.T) {
+	service, events := newTestService(t, checkout)
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "experiment_exposures_total"}, []string{"experiment", "variant"})
+	service.CountExposures(counter)
+
+	var exposed []Exposed
+	bus.SubscribeTo(events, func(ctx context.Context, e Exposed) error {
+		exposed = append(exposed, e)
+		return nil
+	})
+
+	var seen []string
+	handler := service.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = append(seen, Assigned(r.Context(), "checkout_button"), Assigned(r.Context(), "checkout_button"), Assigned(r.Context(), "missing"))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-User", "42")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	require.Len(t, seen, 3)
+	assert.Equal(t, seen[0], seen[1])
+	assert.Empty(t, seen[2])
+	assert.Empty(t, rec.Result().Cookies(), "signed-in users need no visitor cookie")
+	require.Len(t, exposed, 1)
+	assert.Equal(t, Exposed{Experiment: "checkout_button", Variant: seen[0], Unit: "user:42", UserID: "42", At: exposed[0].At}, exposed[0])
+	assert.Equal(t, "experiment.exposed", exposed[0].EventName())
+	var count dto.Metric
+	require.NoError(t, counter.WithLabelValues("checkout_button", seen[0]).Write(&count))
+	assert.Equal(t, 1.0, count.GetCounter().GetValue())
+}
+
+func TestMiddlewareKeepsVisitors(t *testing.T) {
+	service, _ := newTestService(t, checkout)
+	var variant string
+	handler := service.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		variant = Assigned(r.Context(), "checkout_button")
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	cookies := rec.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, "experiments", cookies[0].Name)
+	first := variant
+
+	for i := 0; i < 5; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(cookies[0])
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, first, variant)
+		assert.Empty(t, rec.Result().Cookies())
+	}
+}
+
+func TestMiddlewareBehindAuth(t *testing.T) {
+	service, events := newTestService(t, checkout)
+	service.identify = func(r *http.Request) (string, bool) { return auth.UserID(r.Context()) }
+	var exposed []Exposed
+	bus.SubscribeTo(events, func(ctx context.Context, e Exposed) error {
+		exposed = append(exposed, e)
+		return nil
+	})
+
+	// Run before and again behind the auth middleware, which identifies the
+	// user from the request, as the router does
+	authenticate := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var id uint
+			fmt.Sscan(r.Header.Get("X-User"), &id)
+			next.ServeHTTP(w, r.WithContext(auth.WithUser(r.Context(), &auth.User{ID: id})))
+		})
+	}
+	handler := auth.Identify(service.Middleware(authenticate(service.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Assigned(r.Context(), "checkout_button")
+	})))))
+
+	for _, user := range []string{"1", "2", "1"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-User", user)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	require.Len(t, exposed, 3)
+	for i, user := range []string{"1", "2", "1"} {
+		assert.Equal(t, "user:"+user, exposed[i].Unit, "each request is bucketed by its own user")
+		assert.Equal(t, user, exposed[i].UserID)
+	}
+	assert.Equal(t, exposed[0].Variant, exposed[2].Variant)
+}
+
+func TestTemplateHelpers(t *testing.T) {
+	service, _ := newTestService(t, checkout)
+	var out bytes.Buffer
+	handler := service.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tmpl := template.Must(template.New("page").Funcs(TemplateHelpers(r.Context())).Parse(
+			`{{variant "checkout_button"}}:{{if inVariant "checkout_button" "green"}}green{{else}}plain{{end}}`))
+		require.NoError(t, tmpl.Execute(&out, nil))
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-User", "7")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	variant, _, err := service.Assign(context.Background(), "checkout_button", "user:7")
+	require.NoError(t, err)
+	want := variant + ":plain"
+	if variant == "green" {
+		want = "green:green"
+	}
+	assert.Equal(t, want, out.String())
+}
+
+func TestFromConfig(t *testing.T) {
+	service, err := FromConfig(config.ExperimentsConfig{
+		Definitions: map[string]config.ExperimentConfig{
+			"pricing_page": {Enabled: true, Traffic: 0.5, Variants: []config.VariantConfig{{Name: "control", Weight: 1}, {Name: "annual_first", Weight: 1}}},
+		},
+	}, nil, nil, nil)
+	require.NoError(t, err)
+	experiments := service.Experiments()
+	require.Len(t, experiments, 1)
+	assert.Equal(t, "pricing_page", experiments[0].Name)
+	assert.Equal(t, 0.5, experiments[0].Traffic)
+	assert.Equal(t, "control", experiments[0].Control())
+}
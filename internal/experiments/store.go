@@ -0,0 +1,63 @@
+package experiments
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Store keeps the variants units were assigned
+type Store interface {
+	// Load returns a unit's variant of an experiment, or false if it has
+	// none yet
+	Load(ctx context.Context, experiment, unit string) (string, bool, error)
+	Save(ctx context.Context, experiment, unit, variant string) error
+}
+
+// Assignment is a unit's variant of an experiment in the
+// experiment_assignments table
+type Assignment struct {
+	Experiment string `gorm:"primaryKey;size:64"`
+	Unit       string `gorm:"primaryKey;size:128"`
+	Variant    string `gorm:"size:64"`
+	CreatedAt  time.Time
+}
+
+func (Assignment) TableName() string { return "experiment_assignments" }
+
+// DBStore keeps assignments in the database
+type DBStore struct {
+	db *gorm.DB
+}
+
+// NewDBStore creates a database assignment store, creating its table if
+// needed
+func NewDBStore(db *gorm.DB) (*DBStore, error) {
+	if err := db.AutoMigrate(&Assignment{}); err != nil {
+		return nil, err
+	}
+	return &DBStore{db: db}, nil
+}
+
+func (s *DBStore) Load(ctx context.Context, experiment, unit string) (string, bool, error) {
+	var assignment Assignment
+	err := s.db.WithContext(ctx).Where("experiment = ? AND unit = ?", experiment, unit).Take(&assignment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return assignment.Variant, true, nil
+}
+
+func (s *DBStore) Save(ctx context.Context, experiment, unit, variant string) error {
+	assignment := Assignment{Experiment: experiment, Unit: unit, Variant: variant}
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "experiment"}, {Name: "unit"}},
+		DoUpdates: clause.AssignmentColumns([]string{"variant"}),
+	}).Create(&assignment).Error
+}
@@ -0,0 +1,78 @@
+package export
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// cellValue reduces a cell to nil, a string, time.Time, bool, int64,
+// uint64 or float64
+func cellValue(cell any) any {
+	rv := reflect.ValueOf(cell)
+	if rv.Kind() == reflect.Pointer && rv.IsNil() {
+		return nil
+	}
+
+	switch v := cell.(type) {
+	case nil, string, time.Time, bool, int64, uint64, float64:
+		return zeroTime(v)
+	case float32:
+		// Formatted at its own precision, not float64's: 0.1, not 0.10000000149
+		f, _ := strconv.ParseFloat(strconv.FormatFloat(float64(v), 'g', -1, 32), 64)
+		return f
+	case []byte:
+		return string(v)
+	case driver.Valuer:
+		value, err := v.Value()
+		if err != nil {
+			return err.Error()
+		}
+		return cellValue(value)
+	case fmt.Stringer:
+		return v.String()
+	}
+
+	switch rv.Kind() {
+	case reflect.Pointer:
+		return cellValue(rv.Elem().Interface())
+	case reflect.String:
+		return rv.String()
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return rv.Uint()
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	}
+	return fmt.Sprint(cell)
+}
+
+// zeroTime turns the zero time, an unset timestamp, into an empty cell
+func zeroTime(v any) any {
+	if t, ok := v.(time.Time); ok && t.IsZero() {
+		return nil
+	}
+	return v
+}
+
+// flushDestination flushes what an export is written to, so a download
+// arrives as it is generated
+func flushDestination(dst io.Writer) error {
+	switch d := dst.(type) {
+	case http.ResponseWriter:
+		if err := http.NewResponseController(d).Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+	case interface{ Flush() error }:
+		return d.Flush()
+	}
+	return nil
+}
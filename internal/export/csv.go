@@ -0,0 +1,78 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+)
+
+// CSVWriter writes exports as RFC 4180 CSV
+type CSVWriter struct {
+	dst    io.Writer
+	csv    *csv.Writer
+	record []string
+}
+
+// NewCSVWriter creates a CSV writer on w
+func NewCSVWriter(w io.Writer) *CSVWriter {
+	return &CSVWriter{dst: w, csv: csv.NewWriter(w)}
+}
+
+// WriteHeader implements Writer
+func (w *CSVWriter) WriteHeader(headers []string) error {
+	return w.csv.Write(headers)
+}
+
+// WriteRow implements Writer. Times are written in RFC 3339 and text that
+// a spreadsheet would run as a formula is prefixed with a quote.
+func (w *CSVWriter) WriteRow(cells []any) error {
+	w.record = w.record[:0]
+	for _, cell := range cells {
+		var field string
+		switch v := cellValue(cell).(type) {
+		case nil:
+		case string:
+			field = escapeFormula(v)
+		case time.Time:
+			field = v.Format(time.RFC3339)
+		case bool:
+			field = strconv.FormatBool(v)
+		case int64:
+			field = strconv.FormatInt(v, 10)
+		case uint64:
+			field = strconv.FormatUint(v, 10)
+		case float64:
+			field = strconv.FormatFloat(v, 'f', -1, 64)
+		}
+		w.record = append(w.record, field)
+	}
+	return w.csv.Write(w.record)
+}
+
+// Flush implements Writer
+func (w *CSVWriter) Flush() error {
+	w.csv.Flush()
+	if err := w.csv.Error(); err != nil {
+		return err
+	}
+	return flushDestination(w.dst)
+}
+
+// Close implements Writer
+func (w *CSVWriter) Close() error {
+	return w.Flush()
+}
+
+// escapeFormula quotes text starting like a formula, so opening an export
+// can't run one an attacker saved in a field
+func escapeFormula(s string) string {
+	if s == "" {
+		return s
+	}
+	switch s[0] {
+	case '=', '+', '-', '@', '\t', '\r':
+		return "'" + s
+	}
+	return s
+}
@@ -0,0 +1,270 @@
+// Package export streams query results and other rows as CSV or XLSX
+// files, a batch at a time, so exports of large tables don't load them
+// whole:
+//
+//	rows := export.Chunks(1000, repo.WithContext(r.Context()).Chunk)
+//	export.Respond(w, r, "users", export.Columns[models.User](), rows)
+package export
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"reflect"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+
+	"github.com/mrhoseah/dolphin/internal/orm"
+)
+
+// FlushEvery is how many rows are written between flushes to the
+// underlying writer, such as an HTTP response
+const FlushEvery = 500
+
+// Column maps records to one column of an export
+type Column[T any] struct {
+	// Name selects the column, as in a sparse fieldset
+	Name string
+
+	// Header titles the column; Name when empty
+	Header string
+
+	// Value returns the cell for a record: a string, number, bool,
+	// time.Time, pointer to one, or anything else, which is formatted with
+	// fmt. Nil pointers are empty cells.
+	Value func(T) any
+}
+
+// title returns the column's header
+func (c Column[T]) title() string {
+	if c.Header != "" {
+		return c.Header
+	}
+	return c.Name
+}
+
+// Columns returns a column for each exported field of the struct T,
+// including those of embedded structs, named like GORM names their
+// columns. An export tag sets a field's header and "-" leaves it out, as
+// does a json tag of "-":
+//
+//	Email    string `export:"Email address"`
+//	Password string `export:"-"`
+//
+// Fields holding structs other than times, slices or maps, such as
+// associations or gorm.DeletedAt, are left out.
+func Columns[T any]() []Column[T] {
+	t := reflect.TypeFor[T]()
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("export: Columns needs a struct type, got %s", t))
+	}
+
+	var columns []Column[T]
+	var walk func(t reflect.Type, index []int)
+	walk = func(t reflect.Type, index []int) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			path := append(append([]int(nil), index...), i)
+			if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				walk(field.Type, path)
+				continue
+			}
+			header := field.Tag.Get("export")
+			if !field.IsExported() || header == "-" || field.Tag.Get("json") == "-" || !exportable(field.Type) {
+				continue
+			}
+			columns = append(columns, Column[T]{
+				Name:   schema.NamingStrategy{}.ColumnName("", field.Name),
+				Header: header,
+				Value:  fieldValue[T](path),
+			})
+		}
+	}
+	walk(t, nil)
+	return columns
+}
+
+var timeType = reflect.TypeFor[time.Time]()
+
+// exportable reports whether a field of type t makes a column
+func exportable(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		return t == timeType
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.Uint8
+	case reflect.Map, reflect.Array, reflect.Chan, reflect.Func, reflect.Interface, reflect.UnsafePointer:
+		return false
+	}
+	return true
+}
+
+// fieldValue reads the field at path from records, which may be pointers
+func fieldValue[T any](path []int) func(T) any {
+	return func(record T) any {
+		v := reflect.ValueOf(record)
+		for v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return nil
+			}
+			v = v.Elem()
+		}
+		return v.FieldByIndex(path).Interface()
+	}
+}
+
+// Select returns the named columns in the order given, or all of them when
+// no names are given, as for an empty sparse fieldset. Unknown names are
+// skipped.
+func Select[T any](columns []Column[T], names ...string) []Column[T] {
+	if len(names) == 0 {
+		return columns
+	}
+	var selected []Column[T]
+	for _, name := range names {
+		for _, c := range columns {
+			if strings.EqualFold(c.Name, name) {
+				selected = append(selected, c)
+				break
+			}
+		}
+	}
+	return selected
+}
+
+// errStop ends a chunked query early when the loop over it breaks
+var errStop = errors.New("export: stopped")
+
+// Chunks yields the records chunk passes to fn, fetched size at a time,
+// so only one batch is held in memory. chunk is a Chunk method such as a
+// generated repository's, or a closure over orm.Chunk:
+//
+//	export.Chunks(1000, func(size int, fn func([]models.User) error) error {
+//		return users.Chunk(ctx, size, fn)
+//	})
+func Chunks[T any](size int, chunk func(size int, fn func([]T) error) error) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		err := chunk(size, func(batch []T) error {
+			for _, record := range batch {
+				if !yield(record, nil) {
+					return errStop
+				}
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, errStop) {
+			var zero T
+			yield(zero, err)
+		}
+	}
+}
+
+// Query yields the results of db, which may already carry filters, in
+// batches of size keyed on the primary key
+func Query[T any](db *gorm.DB, size int) iter.Seq2[T, error] {
+	return Chunks(size, func(size int, fn func([]T) error) error {
+		return orm.Chunk(db, size, fn)
+	})
+}
+
+// Values yields rows that can't fail, such as a slice's with slices.Values
+func Values[T any](rows iter.Seq[T]) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for row := range rows {
+			if !yield(row, nil) {
+				return
+			}
+		}
+	}
+}
+
+// Writer writes a table in a file format
+type Writer interface {
+	// WriteHeader writes the row of column titles
+	WriteHeader(headers []string) error
+
+	// WriteRow writes a row of cells, formatted as Column.Value describes
+	WriteRow(cells []any) error
+
+	// Flush writes buffered rows through to the underlying writer,
+	// flushing it too when it is an http.ResponseWriter or has a Flush
+	// method
+	Flush() error
+
+	// Close finishes the file, flushing what is left
+	Close() error
+}
+
+// Format is a file format exports are written in
+type Format string
+
+const (
+	CSV  Format = "csv"
+	XLSX Format = "xlsx"
+)
+
+// ContentType returns the format's media type
+func (f Format) ContentType() string {
+	if f == XLSX {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// NewWriter creates a writer of the format on w
+func NewWriter(format Format, w io.Writer) (Writer, error) {
+	switch format {
+	case CSV:
+		return NewCSVWriter(w), nil
+	case XLSX:
+		return NewXLSXWriter(w, "Sheet1"), nil
+	default:
+		return nil, fmt.Errorf("unknown export format %q (use csv or xlsx)", format)
+	}
+}
+
+// Write writes the columns' header and a row per record to w, flushing
+// every FlushEvery rows, and closes it once they're all written. It
+// returns how many rows were written, which are all there are unless rows
+// yields an error.
+func Write[T any](w Writer, columns []Column[T], rows iter.Seq2[T, error]) (int, error) {
+	headers := make([]string, len(columns))
+	for i, c := range columns {
+		headers[i] = c.title()
+	}
+	if err := w.WriteHeader(headers); err != nil {
+		return 0, err
+	}
+
+	written := 0
+	cells := make([]any, len(columns))
+	for record, err := range rows {
+		if err != nil {
+			// Left unfinished, so the file can't pass for a whole one
+			return written, err
+		}
+		for i, c := range columns {
+			cells[i] = c.Value(record)
+		}
+		if err := w.WriteRow(cells); err != nil {
+			return written, err
+		}
+		written++
+		if written%FlushEvery == 0 {
+			if err := w.Flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, w.Close()
+}
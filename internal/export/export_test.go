@@ -0,0 +1,207 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/database"
+)
+
+type audit struct {
+	CreatedAt time.Time
+	DeletedAt gorm.DeletedAt
+}
+
+type order struct {
+	ID       uint
+	Customer string `export:"Customer name"`
+	Total    float64
+	Paid     bool
+	Note     *string
+	Secret   string `json:"-"`
+	Lines    []string
+	audit
+}
+
+var orderedAt = time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+
+func testOrders() []order {
+	note := "rush"
+	return []order{
+		{ID: 1, Customer: "Ada", Total: 12.5, Paid: true, Note: &note, Secret: "x", audit: audit{CreatedAt: orderedAt}},
+		{ID: 2, Customer: "=HYPERLINK(\"http://evil\")", Total: 3},
+	}
+}
+
+func TestColumns(t *testing.T) {
+	columns := Columns[order]()
+	var names, headers []string
+	for _, c := range columns {
+		names = append(names, c.Name)
+		headers = append(headers, c.title())
+	}
+	assert.Equal(t, []string{"id", "customer", "total", "paid", "note", "created_at"}, names)
+	assert.Equal(t, "Customer name", headers[1])
+
+	selected := Select(columns, "total", "ID", "unknown")
+	require.Len(t, selected, 2)
+	assert.Equal(t, "total", selected[0].Name)
+	assert.Equal(t, uint(2), selected[1].Value(testOrders()[1]))
+	assert.Len(t, Select(columns), len(columns))
+
+	assert.Len(t, Columns[*order](), len(columns))
+}
+
+func TestWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	written, err := Write(NewCSVWriter(&buf), Columns[order](), Values(slices.Values(testOrders())))
+	require.NoError(t, err)
+	assert.Equal(t, 2, written)
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"id", "Customer name", "total", "paid", "note", "created_at"},
+		{"1", "Ada", "12.5", "true", "rush", "2024-03-01T12:30:00Z"},
+		{"2", `'=HYPERLINK("http://evil")`, "3", "false", "", ""},
+	}, records)
+}
+
+func TestWriteXLSX(t *testing.T) {
+	var buf bytes.Buffer
+	columns := append(Columns[order](), Column[order]{Name: "ref", Value: func(o order) any { return int64(o.ID) * 1e16 }})
+	_, err := Write(NewXLSXWriter(&buf, "Orders: 2024/03"), columns, Values(slices.Values(testOrders())))
+	require.NoError(t, err)
+
+	files := readZip(t, buf.Bytes())
+	assert.Contains(t, files["xl/workbook.xml"], `<sheet name="Orders_ 2024_03"`)
+	sheet := files["xl/worksheets/sheet1.xml"]
+	assert.Contains(t, sheet, `state="frozen"`)
+	assert.Contains(t, sheet, `<c r="B1" t="inlineStr" s="2"><is><t xml:space="preserve">Customer name</t></is></c>`)
+	assert.Contains(t, sheet, `<c r="A2"><v>1</v></c>`)
+	assert.Contains(t, sheet, `<c r="C2"><v>12.5</v></c>`)
+	assert.Contains(t, sheet, `<c r="D2" t="b"><v>1</v></c>`)
+	assert.Contains(t, sheet, `<c r="F2" s="1"><v>45352.52083333333</v></c>`, "times are styled serial dates")
+	assert.Contains(t, sheet, `<t xml:space="preserve">=HYPERLINK(&#34;http://evil&#34;)</t>`, "inline strings are never formulas")
+	assert.Contains(t, sheet, `<c r="G2" t="inlineStr"><is><t xml:space="preserve">10000000000000000</t>`, "big integers keep their digits")
+	assert.NotContains(t, sheet, `r="E3"`, "nil cells are left out")
+	assert.True(t, strings.HasSuffix(sheet, `</sheetData></worksheet>`))
+
+	assert.Equal(t, "A", columnName(0))
+	assert.Equal(t, "AA", columnName(26))
+	assert.Equal(t, "XFD", columnName(16383))
+}
+
+func readZip(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		rc.Close()
+		files[f.Name] = string(content)
+	}
+	assert.Equal(t, "xl/worksheets/sheet1.xml", zr.File[len(zr.File)-1].Name)
+	return files
+}
+
+type widget struct {
+	ID   uint
+	Name string
+}
+
+func TestQueryChunks(t *testing.T) {
+	db, err := database.New(&config.DatabaseConfig{Driver: "sqlite", Database: filepath.Join(t.TempDir(), "app.db")})
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, db.GetDB().AutoMigrate(&widget{}))
+	widgets := make([]widget, 1200)
+	for i := range widgets {
+		widgets[i].Name = "w"
+	}
+	require.NoError(t, db.GetDB().CreateInBatches(widgets, 500).Error)
+
+	var batches []int
+	rows := Chunks(500, func(size int, fn func([]widget) error) error {
+		return db.GetDB().FindInBatches(&[]widget{}, size, func(tx *gorm.DB, _ int) error {
+			batch := *tx.Statement.Dest.(*[]widget)
+			batches = append(batches, len(batch))
+			return fn(batch)
+		}).Error
+	})
+	var buf bytes.Buffer
+	written, err := Write(NewCSVWriter(&buf), Columns[widget](), rows)
+	require.NoError(t, err)
+	assert.Equal(t, 1200, written)
+	assert.Equal(t, []int{500, 500, 200}, batches)
+	assert.Equal(t, 1201, strings.Count(buf.String(), "\n"))
+
+	// Breaking out of the loop stops the query
+	seen := 0
+	for _, err := range Query[widget](db.GetDB().Where("id > ?", 100), 50) {
+		require.NoError(t, err)
+		if seen++; seen == 60 {
+			break
+		}
+	}
+	assert.Equal(t, 60, seen)
+
+	for _, err := range Query[widget](db.GetDB().Table("missing"), 50) {
+		assert.Error(t, err)
+	}
+}
+
+func TestRespond(t *testing.T) {
+	orders := Values(slices.Values(testOrders()))
+
+	rec := httptest.NewRecorder()
+	require.NoError(t, Respond(rec, httptest.NewRequest(http.MethodGet, "/orders/export", nil), "orders", Columns[order](), orders))
+	assert.Equal(t, "text/csv; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename=orders.csv`, rec.Header().Get("Content-Disposition"))
+	assert.True(t, strings.HasPrefix(rec.Body.String(), "id,Customer name,"))
+
+	rec = httptest.NewRecorder()
+	require.NoError(t, Respond(rec, httptest.NewRequest(http.MethodGet, "/orders/export?format=xlsx", nil), "orders", Columns[order](), orders))
+	assert.Equal(t, XLSX.ContentType(), rec.Header().Get("Content-Type"))
+	assert.Contains(t, readZip(t, rec.Body.Bytes())["xl/worksheets/sheet1.xml"], "Ada")
+
+	req := httptest.NewRequest(http.MethodGet, "/orders/export", nil)
+	req.Header.Set("Accept", XLSX.ContentType())
+	assert.Equal(t, XLSX, FormatFromRequest(req))
+
+	// A query failing at once is answered with a problem
+	failing := func(yield func(order, error) bool) { yield(order{}, errors.New("no such table")) }
+	rec = httptest.NewRecorder()
+	assert.Error(t, Respond(rec, httptest.NewRequest(http.MethodGet, "/orders/export", nil), "orders", Columns[order](), failing))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Contains(t, rec.Header().Get("Content-Type"), "problem+json")
+
+	// Failing part way aborts the response
+	partial := func(yield func(order, error) bool) {
+		if yield(testOrders()[0], nil) {
+			yield(order{}, errors.New("connection lost"))
+		}
+	}
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		Respond(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/orders/export", nil), "orders", Columns[order](), partial)
+	})
+}
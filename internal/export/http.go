@@ -0,0 +1,74 @@
+package export
+
+import (
+	"iter"
+	"mime"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/logger"
+	"github.com/mrhoseah/dolphin/internal/problem"
+)
+
+// FormatFromRequest returns the format a request asks for: the format
+// query parameter, else XLSX when the Accept header names it, else CSV
+func FormatFromRequest(r *http.Request) Format {
+	switch strings.ToLower(r.URL.Query().Get("format")) {
+	case "xlsx", "excel":
+		return XLSX
+	case "csv":
+		return CSV
+	}
+	if strings.Contains(r.Header.Get("Accept"), "spreadsheetml") {
+		return XLSX
+	}
+	return CSV
+}
+
+// Respond streams rows as a download named name, in the format the request
+// asks for. Rows are fetched as they are written, so memory use doesn't
+// grow with the export.
+//
+// Respond reports failures itself. When the first row can't be read,
+// nothing has been sent yet, so the error is written as a problem and
+// returned. Once the file has started, the error is logged and the
+// handler aborted with http.ErrAbortHandler, which closes the connection
+// so the client sees a failed download rather than a short file.
+func Respond[T any](w http.ResponseWriter, r *http.Request, name string, columns []Column[T], rows iter.Seq2[T, error]) error {
+	next, stop := iter.Pull2(rows)
+	defer stop()
+
+	row, rowErr, ok := next()
+	if ok && rowErr != nil {
+		problem.Write(w, r, rowErr)
+		return rowErr
+	}
+
+	format := FormatFromRequest(r)
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": name + "." + string(format),
+	}))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	out, err := NewWriter(format, w)
+	if err != nil {
+		return err
+	}
+	written, err := Write(out, columns, func(yield func(T, error) bool) {
+		for ; ok; row, rowErr, ok = next() {
+			if !yield(row, rowErr) {
+				return
+			}
+		}
+	})
+	if err != nil {
+		logger.FromContext(r.Context()).Error("Export failed part way",
+			zap.String("export", name), zap.Int("rows", written), zap.Error(err))
+		panic(http.ErrAbortHandler)
+	}
+	return nil
+}
@@ -0,0 +1,299 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrTooManyRows is returned for rows beyond the most an XLSX sheet holds
+var ErrTooManyRows = errors.New("export: XLSX sheets hold at most 1,048,576 rows")
+
+const (
+	xlsxMaxRows = 1048576
+
+	// xlsxMaxText is the most characters a cell holds
+	xlsxMaxText = 32767
+
+	// xlsxMaxExact is where Excel starts rounding integers, which are
+	// written as text from there on so IDs keep their digits
+	xlsxMaxExact = 1e15
+
+	// Styles defined in xlsxStyles
+	xlsxDateStyle   = 1
+	xlsxHeaderStyle = 2
+)
+
+// XLSXWriter writes exports as an Excel workbook of one sheet. The sheet
+// is streamed into the zip file as rows are written, so it is never held
+// in memory.
+type XLSXWriter struct {
+	dst   io.Writer
+	zip   *zip.Writer
+	sheet *bufio.Writer
+	name  string
+	rows  int
+	err   error
+}
+
+// NewXLSXWriter creates an XLSX writer on w whose sheet is named sheet
+func NewXLSXWriter(w io.Writer, sheet string) *XLSXWriter {
+	return &XLSXWriter{dst: w, zip: zip.NewWriter(w), name: sheetName(sheet)}
+}
+
+// sheetName makes name one Excel accepts: up to 31 characters and none of
+// []:*?/\
+func sheetName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if utf8.RuneCountInString(name) > 31 {
+		name = string([]rune(name)[:31])
+	}
+	if name == "" {
+		return "Sheet1"
+	}
+	return name
+}
+
+// WriteHeader implements Writer. The header row is bold and frozen, so it
+// stays in view while scrolling.
+func (w *XLSXWriter) WriteHeader(headers []string) error {
+	if w.sheet == nil && w.err == nil {
+		w.start(true)
+	}
+	cells := make([]any, len(headers))
+	for i, h := range headers {
+		cells[i] = h
+	}
+	return w.writeRow(cells, xlsxHeaderStyle)
+}
+
+// WriteRow implements Writer. Numbers, booleans and times are typed
+// cells; times are shown in their own time zone.
+func (w *XLSXWriter) WriteRow(cells []any) error {
+	if w.sheet == nil && w.err == nil {
+		w.start(false)
+	}
+	return w.writeRow(cells, 0)
+}
+
+// Flush implements Writer
+func (w *XLSXWriter) Flush() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.sheet != nil {
+		if err := w.sheet.Flush(); err != nil {
+			return err
+		}
+	}
+	if err := w.zip.Flush(); err != nil {
+		return err
+	}
+	return flushDestination(w.dst)
+}
+
+// Close implements Writer
+func (w *XLSXWriter) Close() error {
+	if w.sheet == nil && w.err == nil {
+		w.start(false)
+	}
+	w.write(`</sheetData></worksheet>`)
+	if w.err != nil {
+		return w.err
+	}
+	if err := w.sheet.Flush(); err != nil {
+		return err
+	}
+	if err := w.zip.Close(); err != nil {
+		return err
+	}
+	return flushDestination(w.dst)
+}
+
+// start writes the workbook's fixed parts and opens the sheet, which must
+// be the last file in the zip to be streamed
+func (w *XLSXWriter) start(header bool) {
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRels},
+		{"xl/workbook.xml", fmt.Sprintf(xlsxWorkbook, xmlEscape(w.name))},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, part := range parts {
+		f, err := w.zip.Create(part.name)
+		if err == nil {
+			_, err = io.WriteString(f, xml.Header+part.content)
+		}
+		if err != nil {
+			w.err = err
+			return
+		}
+	}
+
+	f, err := w.zip.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		w.err = err
+		return
+	}
+	w.sheet = bufio.NewWriter(f)
+	w.write(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	if header {
+		w.write(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	}
+	w.write(`<sheetData>`)
+}
+
+// writeRow writes a row of cells, those without a type of their own in
+// style
+func (w *XLSXWriter) writeRow(cells []any, style int) error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.rows == xlsxMaxRows {
+		return ErrTooManyRows
+	}
+	w.rows++
+	row := strconv.Itoa(w.rows)
+
+	w.write(`<row r="` + row + `">`)
+	for i, cell := range cells {
+		ref := columnName(i) + row
+		switch v := cellValue(cell).(type) {
+		case nil:
+		case string:
+			w.writeText(ref, v, style)
+		case bool:
+			value := "0"
+			if v {
+				value = "1"
+			}
+			w.write(`<c r="` + ref + `" t="b"` + styleAttr(style) + `><v>` + value + `</v></c>`)
+		case int64:
+			if v > -xlsxMaxExact && v < xlsxMaxExact {
+				w.writeNumber(ref, strconv.FormatInt(v, 10), style)
+			} else {
+				w.writeText(ref, strconv.FormatInt(v, 10), style)
+			}
+		case uint64:
+			if v < xlsxMaxExact {
+				w.writeNumber(ref, strconv.FormatUint(v, 10), style)
+			} else {
+				w.writeText(ref, strconv.FormatUint(v, 10), style)
+			}
+		case float64:
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				w.writeText(ref, strconv.FormatFloat(v, 'g', -1, 64), style)
+			} else {
+				w.writeNumber(ref, strconv.FormatFloat(v, 'g', -1, 64), style)
+			}
+		case time.Time:
+			w.writeNumber(ref, strconv.FormatFloat(excelTime(v), 'f', -1, 64), xlsxDateStyle)
+		}
+	}
+	w.write(`</row>`)
+	return w.err
+}
+
+func (w *XLSXWriter) writeNumber(ref, value string, style int) {
+	w.write(`<c r="` + ref + `"` + styleAttr(style) + `><v>` + value + `</v></c>`)
+}
+
+// writeText writes an inline string cell, which unlike CSV text is never
+// read as a formula
+func (w *XLSXWriter) writeText(ref, text string, style int) {
+	if utf8.RuneCountInString(text) > xlsxMaxText {
+		text = string([]rune(text)[:xlsxMaxText])
+	}
+	w.write(`<c r="` + ref + `" t="inlineStr"` + styleAttr(style) + `><is><t xml:space="preserve">`)
+	w.write(xmlEscape(text))
+	w.write(`</t></is></c>`)
+}
+
+// write writes s to the sheet, keeping the first error
+func (w *XLSXWriter) write(s string) {
+	if w.err == nil {
+		_, w.err = w.sheet.WriteString(s)
+	}
+}
+
+func styleAttr(style int) string {
+	if style == 0 {
+		return ""
+	}
+	return ` s="` + strconv.Itoa(style) + `"`
+}
+
+// columnName returns the letters naming the i'th column, from 0: A, B, …,
+// Z, AA, AB, …
+func columnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// excelTime converts t's wall clock time to Excel's serial date: days
+// since 30 December 1899
+func excelTime(t time.Time) float64 {
+	_, offset := t.Zone()
+	seconds := float64(t.Unix()+int64(offset)) + float64(t.Nanosecond())/1e9
+	return seconds/86400 + 25569
+}
+
+// xmlEscape escapes text for XML, replacing characters XML can't hold
+func xmlEscape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+const xlsxContentTypes = `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+	`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+	`<Default Extension="xml" ContentType="application/xml"/>` +
+	`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+	`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+	`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+	`</Types>`
+
+const xlsxRels = `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+const xlsxWorkbook = `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+	`<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets>` +
+	`</workbook>`
+
+const xlsxWorkbookRels = `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+	`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+	`</Relationships>`
+
+// xlsxStyles defines the plain, date and header styles, in that order
+const xlsxStyles = `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="3">` +
+	`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`</cellXfs>` +
+	`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+	`</styleSheet>`
@@ -0,0 +1,170 @@
+package features
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Gate is a feature flag guarding framework middleware that existing apps
+// did not have when they were created
+type Gate struct {
+	Key         string
+	Description string
+}
+
+// Gates lists every feature gate, in the order they were introduced
+var Gates = []Gate{
+	{Key: "compression", Description: "gzip/deflate compression of responses"},
+	{Key: "security_headers", Description: "HSTS, CSP, X-Frame-Options and related headers"},
+	{Key: "response_cache", Description: "shared cache for anonymous GET responses"},
+}
+
+// Lookup returns the gate with the given key
+func Lookup(key string) (Gate, bool) {
+	for _, g := range Gates {
+		if g.Key == key {
+			return g, true
+		}
+	}
+	return Gate{}, false
+}
+
+// Keys returns the keys of all gates
+func Keys() []string {
+	keys := make([]string, len(Gates))
+	for i, g := range Gates {
+		keys[i] = g.Key
+	}
+	return keys
+}
+
+// ScaffoldYAML returns the features block written into new projects, which
+// opt into every gate from the start
+func ScaffoldYAML() string {
+	var b strings.Builder
+	b.WriteString("features:\n")
+	for _, g := range Gates {
+		fmt.Fprintf(&b, "  %s: true  # %s\n", g.Key, g.Description)
+	}
+	return b.String()
+}
+
+// Change describes one gate flipped by Upgrade
+type Change struct {
+	Gate Gate
+	From bool
+}
+
+// Plan reports which of keys are not yet enabled in the config file at path.
+// Unknown keys are rejected; a missing file or features block counts as off.
+func Plan(path string, keys []string) ([]Change, error) {
+	doc, err := load(path)
+	if err != nil {
+		return nil, err
+	}
+	features := mappingValue(root(doc), "features")
+
+	var changes []Change
+	for _, key := range keys {
+		gate, ok := Lookup(key)
+		if !ok {
+			return nil, fmt.Errorf("unknown feature gate %q (available: %s)", key, strings.Join(Keys(), ", "))
+		}
+		current := false
+		if features != nil {
+			if node := mappingValue(features, key); node != nil {
+				current = node.Value == "true"
+			}
+		}
+		if !current {
+			changes = append(changes, Change{Gate: gate, From: current})
+		}
+	}
+	return changes, nil
+}
+
+// Upgrade enables the given gates in the config file at path, preserving
+// the rest of the file and its comments, and returns what changed
+func Upgrade(path string, keys []string) ([]Change, error) {
+	changes, err := Plan(path, keys)
+	if err != nil || len(changes) == 0 {
+		return changes, err
+	}
+
+	doc, err := load(path)
+	if err != nil {
+		return nil, err
+	}
+	top := root(doc)
+	features := mappingValue(top, "features")
+	if features == nil {
+		features = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		top.Content = append(top.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "features", HeadComment: "Feature gates enabled by `dolphin upgrade`"},
+			features,
+		)
+	}
+	for _, c := range changes {
+		if node := mappingValue(features, c.Gate.Key); node != nil {
+			node.Kind, node.Tag, node.Value = yaml.ScalarNode, "!!bool", "true"
+			continue
+		}
+		features.Content = append(features.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: c.Gate.Key},
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: "true", LineComment: c.Gate.Description},
+		)
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// load parses the config file, returning an empty document if it is missing
+func load(path string) (*yaml.Node, error) {
+	doc := &yaml.Node{}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, doc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if doc.Kind == 0 {
+		doc.Kind = yaml.DocumentNode
+		doc.Content = []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}
+	}
+	return doc, nil
+}
+
+// root returns the top level mapping of a document
+func root(doc *yaml.Node) *yaml.Node {
+	return doc.Content[0]
+}
+
+// mappingValue returns the value node for key in a mapping node
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
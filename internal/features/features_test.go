@@ -0,0 +1,46 @@
+package features
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUpgradePreservesConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	original := "# App settings\napp:\n  name: demo\nfeatures:\n  compression: false\n"
+	if err := os.WriteFile(path, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := Upgrade(path, []string{"compression", "security_headers"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 changes, got %v", changes)
+	}
+
+	data, _ := os.ReadFile(path)
+	content := string(data)
+	for _, want := range []string{"# App settings", "name: demo", "compression: true", "security_headers: true"} {
+		if !strings.Contains(content, want) {
+			t.Fatalf("expected %q in upgraded config:\n%s", want, content)
+		}
+	}
+
+	changes, err = Plan(path, Keys())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Gate.Key != "response_cache" {
+		t.Fatalf("expected only response_cache pending, got %v", changes)
+	}
+}
+
+func TestPlanRejectsUnknownGate(t *testing.T) {
+	if _, err := Plan(filepath.Join(t.TempDir(), "missing.yaml"), []string{"nope"}); err == nil {
+		t.Fatal("expected error for unknown gate")
+	}
+}
@@ -0,0 +1,227 @@
+package frontend
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/mrhoseah/dolphin/internal/routing"
+)
+
+var (
+	// viteCall finds the entries of {{vite "..."}} in a layout
+	viteCall = regexp.MustCompile(`\{\{-?\s*vite((?:\s+"[^"]*")+)\s*-?\}\}`)
+
+	// quoted finds the quoted strings of a vite call
+	quoted = regexp.MustCompile(`"([^"]*)"`)
+
+	// preloadDeclaration finds <!-- preload: a.js, /static/b.css --> in a
+	// layout or page
+	preloadDeclaration = regexp.MustCompile(`<!--\s*preload:\s*(.*?)\s*-->`)
+
+	// stylesheetLink finds the stylesheets a layout's head links
+	stylesheetLink = regexp.MustCompile(`<link\s[^>]*rel=["']?stylesheet["']?[^>]*>`)
+	href           = regexp.MustCompile(`href=["']?([^"'\s>]+)`)
+)
+
+// CriticalAssets returns the assets templates need before first paint: the
+// entries their {{vite}} calls load, the same-origin stylesheets their head
+// links, and what they declare with <!-- preload: ... -->, comma or space
+// separated. Entries are Vite paths such as resources/js/app.js, others
+// URLs such as /static/app.css.
+func CriticalAssets(sources ...string) []string {
+	var assets []string
+	seen := map[string]bool{}
+	add := func(asset string) {
+		if asset != "" && !seen[asset] {
+			seen[asset] = true
+			assets = append(assets, asset)
+		}
+	}
+	for _, source := range sources {
+		for _, call := range viteCall.FindAllStringSubmatch(source, -1) {
+			for _, entry := range quoted.FindAllStringSubmatch(call[1], -1) {
+				add(entry[1])
+			}
+		}
+
+		head := source
+		if end := strings.Index(strings.ToLower(head), "</head>"); end != -1 {
+			head = head[:end]
+		}
+		for _, link := range stylesheetLink.FindAllString(head, -1) {
+			if m := href.FindStringSubmatch(link); m != nil && sameOrigin(m[1]) {
+				add(m[1])
+			}
+		}
+
+		for _, declaration := range preloadDeclaration.FindAllStringSubmatch(source, -1) {
+			for _, asset := range strings.FieldsFunc(declaration[1], func(r rune) bool { return r == ',' || r == ' ' }) {
+				add(asset)
+			}
+		}
+	}
+	return assets
+}
+
+// Preloads returns the Link header values preloading assets, as
+// CriticalAssets names them: built entries with their CSS and imported
+// chunks from the manifest, and URLs by their extension. While the dev
+// server runs, entries are left to it.
+func (v *Vite) Preloads(assets ...string) ([]string, error) {
+	var entries, urls []string
+	for _, asset := range assets {
+		if sameOrigin(asset) {
+			urls = append(urls, asset)
+		} else {
+			entries = append(entries, asset)
+		}
+	}
+
+	var links []string
+	seen := map[string]bool{}
+	add := func(link string) {
+		if link != "" && !seen[link] {
+			seen[link] = true
+			links = append(links, link)
+		}
+	}
+	if _, hot := v.Hot(); !hot && len(entries) > 0 {
+		css, preloads, scripts, err := v.resolve(entries)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range css {
+			add(PreloadLink(v.url + "/" + file))
+		}
+		for _, file := range append(scripts, preloads...) {
+			add("<" + v.url + "/" + file + ">; rel=modulepreload")
+		}
+	}
+	for _, url := range urls {
+		add(PreloadLink(url))
+	}
+	return links, nil
+}
+
+// PreloadLink returns the Link header value preloading a URL, typed by its
+// extension, or "" for files browsers can't preload by type
+func PreloadLink(url string) string {
+	var as string
+	switch strings.ToLower(path.Ext(strings.SplitN(url, "?", 2)[0])) {
+	case ".css":
+		as = "style"
+	case ".js":
+		as = "script"
+	case ".mjs":
+		return "<" + url + ">; rel=modulepreload"
+	case ".woff2", ".woff", ".ttf", ".otf":
+		// Fonts are always fetched in CORS mode
+		return "<" + url + ">; rel=preload; as=font; crossorigin"
+	case ".png", ".jpg", ".jpeg", ".gif", ".webp", ".avif", ".svg":
+		as = "image"
+	default:
+		return ""
+	}
+	return "<" + url + ">; rel=preload; as=" + as
+}
+
+// sameOrigin reports whether an asset is a URL on the app's own origin,
+// rather than a Vite entry or another origin's URL
+func sameOrigin(asset string) bool {
+	return strings.HasPrefix(asset, "/") && !strings.HasPrefix(asset, "//")
+}
+
+// EarlyHints sends a 103 Early Hints response with the preload links of a
+// route's page before its handler runs, so browsers fetch critical CSS and
+// JS while the page is rendered. The links are learned from the last
+// response Hint was called for on the route.
+//
+// Middleware must wrap the router's writer directly: wrappers take the 103
+// for the response's status.
+type EarlyHints struct {
+	mu    sync.RWMutex
+	links map[string][]string
+}
+
+// NewEarlyHints returns middleware that has learned no links yet
+func NewEarlyHints() *EarlyHints {
+	return &EarlyHints{links: make(map[string][]string)}
+}
+
+type hintsKey struct{}
+
+// hintsRoute is where Hint records the links of a request's route
+type hintsRoute struct {
+	hints *EarlyHints
+	route string
+}
+
+// Middleware sends the learned links of page requests' routes as early
+// hints. HTMX requests for fragments get none.
+func (h *EarlyHints) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || !r.ProtoAtLeast(1, 1) || !wantsPage(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		pattern := routing.Match(r)
+		if pattern == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		route := r.Method + " " + pattern
+		if links := h.Links(route); len(links) > 0 {
+			header := w.Header()
+			for _, link := range links {
+				header.Add("Link", link)
+			}
+			w.WriteHeader(http.StatusEarlyHints)
+			// The final response repeats them, added by Hint
+			header.Del("Link")
+		}
+		ctx := context.WithValue(r.Context(), hintsKey{}, &hintsRoute{hints: h, route: route})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Links returns the links learned for a route pattern
+func (h *EarlyHints) Links(route string) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.links[route]
+}
+
+// Hint adds preload links to a page's response, and has EarlyHints send
+// them before the handler of later requests to its route runs
+func Hint(w http.ResponseWriter, r *http.Request, links []string) {
+	for _, link := range links {
+		w.Header().Add("Link", link)
+	}
+	at, ok := r.Context().Value(hintsKey{}).(*hintsRoute)
+	if !ok {
+		return
+	}
+	at.hints.mu.Lock()
+	defer at.hints.mu.Unlock()
+	if len(links) == 0 {
+		delete(at.hints.links, at.route)
+		return
+	}
+	at.hints.links[at.route] = append([]string(nil), links...)
+}
+
+// wantsPage reports whether a request navigates to a page, rather than
+// fetching data or an HTMX fragment
+func wantsPage(r *http.Request) bool {
+	if r.Header.Get("HX-Request") != "" {
+		return false
+	}
+	if mode := r.Header.Get("Sec-Fetch-Mode"); mode != "" {
+		return mode == "navigate"
+	}
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
@@ -0,0 +1,114 @@
+package frontend
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCriticalAssets(t *testing.T) {
+	layout := `<html><head>
+  <link rel="stylesheet" href="/static/app.css">
+  <link rel="stylesheet" href="https://fonts.example.com/inter.css">
+  <link rel="icon" href="/static/favicon.ico">
+  {{vite "resources/js/app.js" "resources/css/print.css"}}
+  <!-- preload: /static/fonts/inter.woff2 -->
+</head><body><link rel="stylesheet" href="/static/late.css">{{.Body}}</body></html>`
+	page := `<!-- preload: resources/js/dashboard.js, /static/hero.webp -->
+<h1>Dashboard</h1>`
+
+	assert.Equal(t, []string{
+		"resources/js/app.js",
+		"resources/css/print.css",
+		"/static/app.css",
+		"/static/fonts/inter.woff2",
+		"resources/js/dashboard.js",
+		"/static/hero.webp",
+	}, CriticalAssets(layout, page))
+}
+
+func TestPreloads(t *testing.T) {
+	vite, dir := newTestVite(t)
+	writeManifest(t, dir, map[string]ManifestChunk{
+		"resources/js/app.js": {File: "assets/app-4ed993c7.js", IsEntry: true, CSS: []string{"assets/app-a1b2.css"}, Imports: []string{"_vendor-5f2a.js"}},
+		"_vendor-5f2a.js":     {File: "assets/vendor-5f2a.js", CSS: []string{"assets/vendor-77e1.css"}},
+	})
+
+	links, err := vite.Preloads("resources/js/app.js", "/static/app.css", "/static/fonts/inter.woff2", "/static/data.json")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"</static/build/assets/vendor-77e1.css>; rel=preload; as=style",
+		"</static/build/assets/app-a1b2.css>; rel=preload; as=style",
+		"</static/build/assets/app-4ed993c7.js>; rel=modulepreload",
+		"</static/build/assets/vendor-5f2a.js>; rel=modulepreload",
+		"</static/app.css>; rel=preload; as=style",
+		"</static/fonts/inter.woff2>; rel=preload; as=font; crossorigin",
+	}, links)
+
+	_, err = vite.Preloads("resources/js/missing.js")
+	assert.ErrorContains(t, err, "isn't in the manifest")
+
+	// The dev server serves entries itself
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "hot"), []byte("http://localhost:5173"), 0644))
+	links, err = vite.Preloads("resources/js/missing.js", "/static/app.css")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"</static/app.css>; rel=preload; as=style"}, links)
+}
+
+func TestEarlyHints(t *testing.T) {
+	hints := NewEarlyHints()
+	r := chi.NewRouter()
+	r.Use(hints.Middleware)
+	r.Get("/posts/{id}", func(w http.ResponseWriter, r *http.Request) {
+		Hint(w, r, []string{"</static/app.css>; rel=preload; as=style"})
+		w.Write([]byte("<h1>Post</h1>"))
+	})
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	get := func(path string, header http.Header) ([]textproto.MIMEHeader, *http.Response) {
+		var early []textproto.MIMEHeader
+		trace := &httptrace.ClientTrace{
+			Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+				if code == http.StatusEarlyHints {
+					early = append(early, header)
+				}
+				return nil
+			},
+		}
+		req, err := http.NewRequestWithContext(httptrace.WithClientTrace(t.Context(), trace), http.MethodGet, server.URL+path, nil)
+		require.NoError(t, err)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return early, resp
+	}
+	page := http.Header{"Accept": {"text/html,application/xhtml+xml"}}
+
+	early, resp := get("/posts/1", page)
+	assert.Empty(t, early, "nothing learned yet")
+	assert.Equal(t, []string{"</static/app.css>; rel=preload; as=style"}, resp.Header.Values("Link"))
+
+	early, resp = get("/posts/2", page)
+	require.Len(t, early, 1, "learned for the route")
+	assert.Equal(t, []string{"</static/app.css>; rel=preload; as=style"}, early[0].Values("Link"))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, resp.Header.Values("Link"), 1, "not repeated")
+
+	early, _ = get("/posts/3", http.Header{"Accept": {"text/html"}, "Hx-Request": {"true"}})
+	assert.Empty(t, early, "HTMX fragments")
+	early, _ = get("/posts/3", http.Header{"Accept": {"application/json"}})
+	assert.Empty(t, early, "not a page")
+	assert.Equal(t, []string{"</static/app.css>; rel=preload; as=style"}, hints.Links("GET /posts/{id}"))
+}
@@ -0,0 +1,216 @@
+package frontend
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Frontends lists the stacks ScaffoldVite can create
+var Frontends = []string{"vite-react", "vite-vue"}
+
+// viteEntries maps each stack to its entry, relative to the project
+var viteEntries = map[string]string{
+	"vite-react": "resources/js/app.jsx",
+	"vite-vue":   "resources/js/app.js",
+}
+
+// ViteLayoutTags returns what new projects put in their layout's head to
+// load the stack's entry
+func ViteLayoutTags(stack string) string {
+	tags := fmt.Sprintf(`{{vite %q}}`, viteEntries[stack])
+	if stack == "vite-react" {
+		tags = `{{viteReactRefresh}}` + tags
+	}
+	return tags
+}
+
+// ScaffoldVite writes a Vite frontend for stack into the project at dir:
+// package.json with dev and build scripts, vite.config.js building to
+// public/build and writing public/hot while the dev server runs, and an app
+// under resources/ mounted on #app
+func ScaffoldVite(dir, name, stack string) error {
+	entry, ok := viteEntries[stack]
+	if !ok {
+		return fmt.Errorf("unknown frontend %q (want %s)", stack, strings.Join(Frontends, " or "))
+	}
+
+	files := map[string]string{
+		"package.json":          packageJSON(name, stack),
+		"vite.config.js":        viteConfig(stack, entry),
+		"resources/css/app.css": appCSS,
+	}
+	if stack == "vite-react" {
+		files[entry] = reactEntry
+		files["resources/js/App.jsx"] = reactApp
+	} else {
+		files[entry] = vueEntry
+		files["resources/js/App.vue"] = vueApp
+	}
+	for path, content := range files {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+	return appendLines(filepath.Join(dir, ".gitignore"), "node_modules/", "public/hot", "public/build/")
+}
+
+// appendLines adds the lines missing from the file at path
+func appendLines(path string, lines ...string) error {
+	existing, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	content := string(existing)
+	present := map[string]bool{}
+	for _, line := range strings.Split(content, "\n") {
+		present[strings.TrimSpace(line)] = true
+	}
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	for _, line := range lines {
+		if !present[line] {
+			content += line + "\n"
+		}
+	}
+	return os.WriteFile(path, []byte(content), 0644)
+}
+
+func packageJSON(name, stack string) string {
+	deps := `"react": "^18.3.1",
+    "react-dom": "^18.3.1"`
+	devDeps := `"@vitejs/plugin-react": "^4.3.1",
+    "vite": "^5.4.0"`
+	if stack == "vite-vue" {
+		deps = `"vue": "^3.4.38"`
+		devDeps = `"@vitejs/plugin-vue": "^5.1.2",
+    "vite": "^5.4.0"`
+	}
+	return fmt.Sprintf(`{
+  "name": %q,
+  "private": true,
+  "type": "module",
+  "scripts": {
+    "dev": "vite",
+    "build": "vite build"
+  },
+  "dependencies": {
+    %s
+  },
+  "devDependencies": {
+    %s
+  }
+}
+`, strings.ToLower(filepath.Base(name)), deps, devDeps)
+}
+
+func viteConfig(stack, entry string) string {
+	plugin, pluginImport := "react()", `import react from '@vitejs/plugin-react'`
+	if stack == "vite-vue" {
+		plugin, pluginImport = "vue()", `import vue from '@vitejs/plugin-vue'`
+	}
+	return fmt.Sprintf(`import fs from 'node:fs'
+import { defineConfig } from 'vite'
+%s
+
+// dolphinHot writes the dev server's URL to public/hot, which makes the
+// {{vite}} template helper load assets from it, and removes it on exit
+function dolphinHot(file = 'public/hot') {
+  return {
+    name: 'dolphin-hot',
+    configureServer(server) {
+      server.httpServer?.once('listening', () => {
+        fs.writeFileSync(file, server.config.server.origin + server.config.base)
+      })
+      const clean = () => fs.existsSync(file) && fs.rmSync(file)
+      process.on('exit', clean)
+      process.on('SIGINT', () => process.exit())
+      process.on('SIGTERM', () => process.exit())
+    },
+  }
+}
+
+export default defineConfig({
+  plugins: [%s, dolphinHot()],
+  // Must match vite.url in config/config.yaml
+  base: '/static/build/',
+  publicDir: false,
+  server: {
+    // Pages are served by the Go app, so assets need absolute URLs
+    port: 5173,
+    strictPort: true,
+    cors: true,
+    origin: 'http://localhost:5173',
+  },
+  build: {
+    outDir: 'public/build',
+    emptyOutDir: true,
+    manifest: true,
+    rollupOptions: {
+      input: [%q],
+    },
+  },
+})
+`, pluginImport, plugin, entry)
+}
+
+const appCSS = `#app {
+  max-width: 1100px;
+  margin: 24px auto;
+  padding: 0 16px;
+}
+`
+
+const reactEntry = `import React from 'react'
+import { createRoot } from 'react-dom/client'
+import App from './App.jsx'
+import '../css/app.css'
+
+const el = document.getElementById('app')
+if (el) {
+  createRoot(el).render(<App {...el.dataset} />)
+}
+`
+
+const reactApp = `import { useState } from 'react'
+
+export default function App() {
+  const [count, setCount] = useState(0)
+  return (
+    <div>
+      <h2>React is running</h2>
+      <button onClick={() => setCount(count + 1)}>Clicked {count} times</button>
+    </div>
+  )
+}
+`
+
+const vueEntry = `import { createApp } from 'vue'
+import App from './App.vue'
+import '../css/app.css'
+
+const el = document.getElementById('app')
+if (el) {
+  createApp(App, { ...el.dataset }).mount(el)
+}
+`
+
+const vueApp = `<script setup>
+import { ref } from 'vue'
+
+const count = ref(0)
+</script>
+
+<template>
+  <div>
+    <h2>Vue is running</h2>
+    <button @click="count++">Clicked {{ count }} times</button>
+  </div>
+</template>
+`
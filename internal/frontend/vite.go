@@ -0,0 +1,238 @@
+package frontend
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+// ManifestChunk is an entry of Vite's build manifest
+type ManifestChunk struct {
+	File    string   `json:"file"`
+	Src     string   `json:"src"`
+	IsEntry bool     `json:"isEntry"`
+	CSS     []string `json:"css"`
+	Imports []string `json:"imports"`
+}
+
+// Vite links pages to assets served by the Vite dev server while its hot
+// file exists, and to the hashed files of the production build otherwise
+type Vite struct {
+	hotFile  string
+	buildDir string
+	url      string
+
+	mu       sync.Mutex
+	manifest map[string]ManifestChunk
+	modTime  time.Time
+}
+
+// NewVite creates the helper from the vite config
+func NewVite(cfg config.ViteConfig) *Vite {
+	if cfg.HotFile == "" {
+		cfg.HotFile = "public/hot"
+	}
+	if cfg.BuildDir == "" {
+		cfg.BuildDir = "public/build"
+	}
+	if cfg.URL == "" {
+		cfg.URL = "/static/build"
+	}
+	return &Vite{
+		hotFile:  cfg.HotFile,
+		buildDir: cfg.BuildDir,
+		url:      strings.TrimSuffix(cfg.URL, "/"),
+	}
+}
+
+// Hot returns the dev server's URL when it is running
+func (v *Vite) Hot() (string, bool) {
+	data, err := os.ReadFile(v.hotFile)
+	if err != nil {
+		return "", false
+	}
+	url := strings.TrimSuffix(strings.TrimSpace(string(data)), "/")
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return "", false
+	}
+	return url, true
+}
+
+// Tags returns the tags loading entries, which are paths relative to the
+// Vite root such as resources/js/app.js. In production every entry's CSS
+// is linked and its imports preloaded.
+func (v *Vite) Tags(entries ...string) (template.HTML, error) {
+	var b strings.Builder
+	if hot, ok := v.Hot(); ok {
+		b.WriteString(scriptTag(hot + "/@vite/client"))
+		for _, entry := range entries {
+			b.WriteString(entryTag(hot + "/" + strings.TrimPrefix(entry, "/")))
+		}
+		return template.HTML(b.String()), nil
+	}
+
+	css, preloads, scripts, err := v.resolve(entries)
+	if err != nil {
+		return "", err
+	}
+
+	linked := map[string]bool{}
+	for _, file := range css {
+		if !linked[file] {
+			linked[file] = true
+			fmt.Fprintf(&b, `<link rel="stylesheet" href="%s">`, template.HTMLEscapeString(v.url+"/"+file))
+		}
+	}
+	for _, file := range preloads {
+		fmt.Fprintf(&b, `<link rel="modulepreload" href="%s">`, template.HTMLEscapeString(v.url+"/"+file))
+	}
+	for _, file := range scripts {
+		b.WriteString(scriptTag(v.url + "/" + file))
+	}
+	return template.HTML(b.String()), nil
+}
+
+// resolve returns the files of the built entries: the CSS they link, the
+// chunks they import, and the entry scripts themselves
+func (v *Vite) resolve(entries []string) (css, preloads, scripts []string, err error) {
+	manifest, err := v.loadManifest()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	seen := map[string]bool{}
+	var collect func(name string, entry bool) error
+	collect = func(name string, entry bool) error {
+		if seen[name] {
+			return nil
+		}
+		seen[name] = true
+		chunk, ok := manifest[name]
+		if !ok {
+			return fmt.Errorf("vite: %s isn't in the manifest; run `npm run build` or `npm run dev`", name)
+		}
+		for _, imported := range chunk.Imports {
+			if err := collect(imported, false); err != nil {
+				return err
+			}
+		}
+		css = append(css, chunk.CSS...)
+		switch {
+		case isCSS(chunk.File):
+			css = append(css, chunk.File)
+		case entry:
+			scripts = append(scripts, chunk.File)
+		default:
+			preloads = append(preloads, chunk.File)
+		}
+		return nil
+	}
+	for _, entry := range entries {
+		if err := collect(strings.TrimPrefix(entry, "/"), true); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return css, preloads, scripts, nil
+}
+
+// Asset returns the URL of a file processed by Vite, such as an image
+// imported by the frontend
+func (v *Vite) Asset(path string) (string, error) {
+	path = strings.TrimPrefix(path, "/")
+	if hot, ok := v.Hot(); ok {
+		return hot + "/" + path, nil
+	}
+	manifest, err := v.loadManifest()
+	if err != nil {
+		return "", err
+	}
+	chunk, ok := manifest[path]
+	if !ok {
+		return "", fmt.Errorf("vite: %s isn't in the manifest", path)
+	}
+	return v.url + "/" + chunk.File, nil
+}
+
+// ReactRefresh returns the preamble @vitejs/plugin-react needs before the
+// entry tags when pages aren't served by Vite itself; it is empty in
+// production
+func (v *Vite) ReactRefresh() template.HTML {
+	hot, ok := v.Hot()
+	if !ok {
+		return ""
+	}
+	return template.HTML(fmt.Sprintf(`<script type="module">
+import RefreshRuntime from %q
+RefreshRuntime.injectIntoGlobalHook(window)
+window.$RefreshReg$ = () => {}
+window.$RefreshSig$ = () => (type) => type
+window.__vite_plugin_react_preamble_installed__ = true
+</script>`, hot+"/@react-refresh"))
+}
+
+// TemplateHelpers returns template functions for layouts:
+// {{vite "resources/js/app.js"}} loads entries, {{viteAsset "path"}}
+// returns a file's URL and {{viteReactRefresh}} goes before the entries of
+// React apps
+func (v *Vite) TemplateHelpers() template.FuncMap {
+	return template.FuncMap{
+		"vite":             v.Tags,
+		"viteAsset":        v.Asset,
+		"viteReactRefresh": v.ReactRefresh,
+	}
+}
+
+// loadManifest reads the build manifest, again whenever it changes so that
+// deploys needn't restart the app
+func (v *Vite) loadManifest() (map[string]ManifestChunk, error) {
+	path := filepath.Join(v.buildDir, ".vite", "manifest.json")
+	info, err := os.Stat(path)
+	if err != nil {
+		// Vite before 5 writes the manifest to the build dir itself
+		path = filepath.Join(v.buildDir, "manifest.json")
+		if info, err = os.Stat(path); err != nil {
+			return nil, fmt.Errorf("vite: no manifest in %s; run `npm run build` or `npm run dev`", v.buildDir)
+		}
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.manifest != nil && info.ModTime().Equal(v.modTime) {
+		return v.manifest, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var manifest map[string]ManifestChunk
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("vite: invalid manifest %s: %w", path, err)
+	}
+	v.manifest, v.modTime = manifest, info.ModTime()
+	return manifest, nil
+}
+
+func entryTag(src string) string {
+	if isCSS(src) {
+		return fmt.Sprintf(`<link rel="stylesheet" href="%s">`, template.HTMLEscapeString(src))
+	}
+	return scriptTag(src)
+}
+
+func scriptTag(src string) string {
+	return fmt.Sprintf(`<script type="module" src="%s"></script>`, template.HTMLEscapeString(src))
+}
+
+func isCSS(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".css", ".scss", ".sass", ".less", ".styl", ".stylus", ".pcss", ".postcss":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+package frontend
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+func newTestVite(t *testing.T) (*Vite, string) {
+	dir := t.TempDir()
+	return NewVite(config.ViteConfig{
+		HotFile:  filepath.Join(dir, "hot"),
+		BuildDir: filepath.Join(dir, "build"),
+		URL:      "/static/build/",
+	}), dir
+}
+
+func writeManifest(t *testing.T, dir string, manifest map[string]ManifestChunk) {
+	data, err := json.Marshal(manifest)
+	require.NoError(t, err)
+	path := filepath.Join(dir, "build", ".vite", "manifest.json")
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, data, 0644))
+}
+
+func TestViteProduction(t *testing.T) {
+	vite, dir := newTestVite(t)
+	_, err := vite.Tags("resources/js/app.js")
+	assert.ErrorContains(t, err, "no manifest")
+
+	writeManifest(t, dir, map[string]ManifestChunk{
+		"resources/js/app.js":     {File: "assets/app-4ed993c7.js", IsEntry: true, CSS: []string{"assets/app-a1b2.css"}, Imports: []string{"_vendor-5f2a.js"}},
+		"resources/js/admin.js":   {File: "assets/admin-9c1d.js", IsEntry: true, Imports: []string{"_vendor-5f2a.js"}},
+		"_vendor-5f2a.js":         {File: "assets/vendor-5f2a.js", CSS: []string{"assets/vendor-77e1.css"}},
+		"resources/css/print.css": {File: "assets/print-0d3c.css", IsEntry: true},
+		"resources/img/logo.svg":  {File: "assets/logo-3b8e.svg"},
+	})
+
+	tags, err := vite.Tags("resources/js/app.js", "/resources/js/admin.js", "resources/css/print.css")
+	require.NoError(t, err)
+	assert.Equal(t, template.HTML(
+		`<link rel="stylesheet" href="/static/build/assets/vendor-77e1.css">`+
+			`<link rel="stylesheet" href="/static/build/assets/app-a1b2.css">`+
+			`<link rel="stylesheet" href="/static/build/assets/print-0d3c.css">`+
+			`<link rel="modulepreload" href="/static/build/assets/vendor-5f2a.js">`+
+			`<script type="module" src="/static/build/assets/app-4ed993c7.js"></script>`+
+			`<script type="module" src="/static/build/assets/admin-9c1d.js"></script>`), tags)
+
+	url, err := vite.Asset("resources/img/logo.svg")
+	require.NoError(t, err)
+	assert.Equal(t, "/static/build/assets/logo-3b8e.svg", url)
+	assert.Empty(t, vite.ReactRefresh())
+
+	_, err = vite.Tags("resources/js/missing.js")
+	assert.ErrorContains(t, err, "resources/js/missing.js isn't in the manifest")
+
+	// A new build is picked up without a restart
+	writeManifest(t, dir, map[string]ManifestChunk{"resources/js/app.js": {File: "assets/app-new.js", IsEntry: true}})
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "build", ".vite", "manifest.json"), future, future))
+	tags, err = vite.Tags("resources/js/app.js")
+	require.NoError(t, err)
+	assert.Equal(t, template.HTML(`<script type="module" src="/static/build/assets/app-new.js"></script>`), tags)
+}
+
+func TestViteDevServer(t *testing.T) {
+	vite, dir := newTestVite(t)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "hot"), []byte("http://localhost:5173/static/build/\n"), 0644))
+
+	tags, err := vite.Tags("resources/js/app.jsx", "resources/css/app.css")
+	require.NoError(t, err)
+	assert.Equal(t, template.HTML(
+		`<script type="module" src="http://localhost:5173/static/build/@vite/client"></script>`+
+			`<script type="module" src="http://localhost:5173/static/build/resources/js/app.jsx"></script>`+
+			`<link rel="stylesheet" href="http://localhost:5173/static/build/resources/css/app.css">`), tags)
+	assert.Contains(t, vite.ReactRefresh(), `import RefreshRuntime from "http://localhost:5173/static/build/@react-refresh"`)
+
+	// Helpers work in layouts
+	layout := template.Must(template.New("layout").Funcs(vite.TemplateHelpers()).Parse(`<head>{{viteReactRefresh}}{{vite "resources/js/app.jsx"}}</head>`))
+	var out bytes.Buffer
+	require.NoError(t, layout.Execute(&out, nil))
+	assert.Contains(t, out.String(), `@vite/client"></script><script type="module" src="http://localhost:5173/static/build/resources/js/app.jsx">`)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "hot"), []byte("garbage"), 0644))
+	_, ok := vite.Hot()
+	assert.False(t, ok)
+}
+
+func TestScaffoldVite(t *testing.T) {
+	for _, stack := range Frontends {
+		t.Run(stack, func(t *testing.T) {
+			dir := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(dir, ".gitignore"), []byte("/bin\nnode_modules/"), 0644))
+			require.NoError(t, ScaffoldVite(dir, "Shop", stack))
+
+			var pkg struct {
+				Name    string            `json:"name"`
+				Scripts map[string]string `json:"scripts"`
+			}
+			data, err := os.ReadFile(filepath.Join(dir, "package.json"))
+			require.NoError(t, err)
+			require.NoError(t, json.Unmarshal(data, &pkg))
+			assert.Equal(t, "shop", pkg.Name)
+			assert.Equal(t, map[string]string{"dev": "vite", "build": "vite build"}, pkg.Scripts)
+
+			viteConfig, err := os.ReadFile(filepath.Join(dir, "vite.config.js"))
+			require.NoError(t, err)
+			assert.Contains(t, string(viteConfig), `input: ["`+viteEntries[stack]+`"]`)
+			assert.FileExists(t, filepath.Join(dir, viteEntries[stack]))
+
+			gitignore, err := os.ReadFile(filepath.Join(dir, ".gitignore"))
+			require.NoError(t, err)
+			assert.Equal(t, "/bin\nnode_modules/\npublic/hot\npublic/build/\n", string(gitignore))
+
+			// The layout tags parse with the helpers
+			_, err = template.New("layout").Funcs(NewVite(config.ViteConfig{}).TemplateHelpers()).Parse(ViteLayoutTags(stack))
+			assert.NoError(t, err)
+		})
+	}
+	assert.ErrorContains(t, ScaffoldVite(t.TempDir(), "shop", "svelte"), `unknown frontend "svelte"`)
+}
@@ -0,0 +1,367 @@
+// Package gateway lets the application front existing services, proxying
+// the paths of each upstream configured under gateway.upstreams:
+//
+//	gateway:
+//	  upstreams:
+//	    orders:
+//	      url: http://orders.internal:8081
+//	      paths: [/orders]
+//	      retries: 2
+//	      circuit_breaker: {failure_threshold: 5, open_timeout: 30s}
+//
+// Requests to an upstream are retried when that is safe, refused while its
+// circuit is open, have their headers rewritten both ways, and may be
+// counted by a rate limiter of their own. Failures are answered as
+// problems: 503 while the circuit is open, 504 when the service times out
+// and 502 otherwise.
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/circuitbreaker"
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/problem"
+)
+
+// ErrUnavailable is returned for requests refused while an upstream's
+// circuit is open
+var ErrUnavailable = errors.New("gateway: upstream unavailable")
+
+// errServerError marks a 5xx response as a failure to the circuit breaker
+// while the response itself is still passed on
+var errServerError = errors.New("gateway: upstream server error")
+
+// Upstream is a service the gateway proxies to
+type Upstream struct {
+	Name string
+	URL  *url.URL
+
+	// Paths are the path prefixes proxied to the service, with the prefix
+	// removed first when StripPrefix is set
+	Paths       []string
+	StripPrefix bool
+
+	// Timeout bounds each attempt, reading the response included
+	Timeout time.Duration
+
+	// Retries retries bodiless requests with idempotent methods that can't
+	// connect or get 502, 503 or 504, waiting RetryBackoff, then twice as
+	// long, between attempts
+	Retries      int
+	RetryBackoff time.Duration
+
+	// RequestHeaders and ResponseHeaders are set on requests to the
+	// service and on its responses; an empty value removes the header
+	RequestHeaders  map[string]string
+	ResponseHeaders map[string]string
+
+	// Breaker refuses requests while the service keeps failing; nil never
+	// refuses
+	Breaker *circuitbreaker.CircuitBreaker
+
+	// Limit wraps the proxy, to count requests by a rate limiter
+	Limit func(http.Handler) http.Handler
+
+	// Transport sends the requests, http.DefaultTransport when nil
+	Transport http.RoundTripper
+
+	// openTimeout is how long the breaker stays open, which refused
+	// requests are told to wait
+	openTimeout time.Duration
+	logger      *zap.Logger
+}
+
+// NewUpstream creates the upstream of cfg, with a circuit breaker when
+// cfg sets a failure threshold
+func NewUpstream(name string, cfg config.UpstreamConfig, logger *zap.Logger) (*Upstream, error) {
+	target, err := url.Parse(cfg.URL)
+	if err != nil || target.Host == "" {
+		return nil, fmt.Errorf("gateway: upstream %s: invalid url %q", name, cfg.URL)
+	}
+	u := &Upstream{
+		Name:            name,
+		URL:             target,
+		Paths:           cfg.Paths,
+		StripPrefix:     cfg.StripPrefix,
+		Timeout:         cfg.Timeout,
+		Retries:         cfg.Retries,
+		RetryBackoff:    cfg.RetryBackoff,
+		RequestHeaders:  cfg.RequestHeaders,
+		ResponseHeaders: cfg.ResponseHeaders,
+		logger:          logger,
+	}
+	if threshold := cfg.CircuitBreaker.FailureThreshold; threshold > 0 {
+		breaker := circuitbreaker.DefaultConfig()
+		breaker.FailureThreshold = threshold
+		if cfg.CircuitBreaker.OpenTimeout > 0 {
+			breaker.OpenTimeout = cfg.CircuitBreaker.OpenTimeout
+		}
+		// Attempts are bounded by Timeout instead, and clients going away
+		// aren't the service failing
+		breaker.RequestTimeout = 0
+		breaker.IsFailure = func(err error) bool { return err != nil && !errors.Is(err, context.Canceled) }
+		u.Breaker = circuitbreaker.NewCircuitBreaker("gateway:"+name, breaker, logger)
+		u.openTimeout = breaker.OpenTimeout
+	}
+	return u, nil
+}
+
+// Handler returns the handler proxying requests to the service
+func (u *Upstream) Handler() http.Handler {
+	var h http.Handler = &httputil.ReverseProxy{
+		Rewrite:        u.rewrite,
+		Transport:      retrying{u},
+		ModifyResponse: u.modifyResponse,
+		ErrorHandler:   u.fail,
+	}
+	if u.Limit != nil {
+		h = u.Limit(h)
+	}
+	return h
+}
+
+// rewrite points a request at the service
+func (u *Upstream) rewrite(pr *httputil.ProxyRequest) {
+	if u.StripPrefix {
+		if prefix := u.prefixOf(pr.In.URL.Path); prefix != "" {
+			pr.Out.URL.Path = "/" + strings.TrimPrefix(strings.TrimPrefix(pr.In.URL.Path, prefix), "/")
+			pr.Out.URL.RawPath = ""
+			if raw := pr.In.URL.RawPath; strings.HasPrefix(raw, prefix) {
+				pr.Out.URL.RawPath = "/" + strings.TrimPrefix(strings.TrimPrefix(raw, prefix), "/")
+			}
+		}
+	}
+	pr.SetURL(u.URL)
+	pr.SetXForwarded()
+	setHeaders(pr.Out.Header, u.RequestHeaders)
+}
+
+// prefixOf returns the longest of the paths path falls under
+func (u *Upstream) prefixOf(path string) string {
+	longest := ""
+	for _, prefix := range u.Paths {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if (path == prefix || strings.HasPrefix(path, prefix+"/")) && len(prefix) > len(longest) {
+			longest = prefix
+		}
+	}
+	return longest
+}
+
+func (u *Upstream) modifyResponse(resp *http.Response) error {
+	setHeaders(resp.Header, u.ResponseHeaders)
+	return nil
+}
+
+// setHeaders sets headers, removing those whose value is empty
+func setHeaders(header http.Header, headers map[string]string) {
+	for name, value := range headers {
+		if value == "" {
+			header.Del(name)
+		} else {
+			header.Set(name, value)
+		}
+	}
+}
+
+// fail answers a request the service didn't
+func (u *Upstream) fail(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, context.Canceled) {
+		// The client went away; there is no one to answer
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	p := problem.New(http.StatusBadGateway, "The upstream service failed to respond")
+	switch {
+	case errors.Is(err, ErrUnavailable):
+		p = problem.New(http.StatusServiceUnavailable, "The upstream service is unavailable")
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(u.openTimeout.Seconds()))))
+	case errors.Is(err, context.DeadlineExceeded):
+		p = problem.New(http.StatusGatewayTimeout, "The upstream service took too long to respond")
+	}
+	u.logger.Warn("Gateway request failed",
+		zap.String("upstream", u.Name),
+		zap.String("method", r.Method),
+		zap.String("path", r.URL.Path),
+		zap.Error(err))
+	problem.Write(w, r, p)
+}
+
+// retrying sends a request to the upstream, retrying it when that is safe
+type retrying struct {
+	upstream *Upstream
+}
+
+func (t retrying) RoundTrip(req *http.Request) (*http.Response, error) {
+	u := t.upstream
+	attempts := 1
+	if retryable(req) {
+		attempts += u.Retries
+	}
+	backoff := u.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		resp, err := u.attempt(req)
+		if attempt >= attempts || errors.Is(err, ErrUnavailable) || req.Context().Err() != nil || !failed(resp, err) {
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		select {
+		case <-time.After(backoff):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		backoff *= 2
+	}
+}
+
+// retryable reports whether sending req again is safe: it has no body and
+// an idempotent method
+func retryable(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody {
+		return false
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// failed reports whether an attempt is worth retrying
+func failed(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// attempt sends req to the service once, through the circuit breaker
+func (u *Upstream) attempt(req *http.Request) (*http.Response, error) {
+	ctx, cancel := req.Context(), context.CancelFunc(func() {})
+	if u.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, u.Timeout)
+	}
+	transport := u.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	send := func() (interface{}, error) {
+		resp, err := transport.RoundTrip(req.WithContext(ctx))
+		if err == nil && resp.StatusCode >= http.StatusInternalServerError {
+			return resp, errServerError
+		}
+		return resp, err
+	}
+
+	var resp *http.Response
+	var err error
+	if u.Breaker == nil {
+		var value interface{}
+		value, err = send()
+		resp, _ = value.(*http.Response)
+	} else {
+		var sent atomic.Bool
+		var value interface{}
+		value, err = u.Breaker.Execute(ctx, func() (interface{}, error) {
+			sent.Store(true)
+			return send()
+		})
+		resp, _ = value.(*http.Response)
+		if err != nil && !sent.Load() {
+			err = fmt.Errorf("%w: %s", ErrUnavailable, err)
+		}
+	}
+	if errors.Is(err, errServerError) {
+		err = nil
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// The attempt's context lasts until the response has been read
+	resp.Body = cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelOnClose cancels an attempt's context once its response is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// Gateway proxies the paths of its upstreams
+type Gateway struct {
+	upstreams []*Upstream
+}
+
+// New creates the gateway of cfg. limits holds the middleware of the named
+// rate limiters upstreams may count their requests by.
+func New(cfg config.GatewayConfig, limits map[string]func(http.Handler) http.Handler, logger *zap.Logger) (*Gateway, error) {
+	g := &Gateway{}
+	for name, upstreamCfg := range cfg.Upstreams {
+		u, err := NewUpstream(name, upstreamCfg, logger)
+		if err != nil {
+			return nil, err
+		}
+		if upstreamCfg.RateLimit != "" {
+			limit, ok := limits[upstreamCfg.RateLimit]
+			if !ok {
+				return nil, fmt.Errorf("gateway: upstream %s: no rate limiter named %q", name, upstreamCfg.RateLimit)
+			}
+			u.Limit = limit
+		}
+		g.upstreams = append(g.upstreams, u)
+	}
+	sort.Slice(g.upstreams, func(i, j int) bool { return g.upstreams[i].Name < g.upstreams[j].Name })
+	return g, nil
+}
+
+// Upstreams returns the upstreams sorted by name
+func (g *Gateway) Upstreams() []*Upstream {
+	return append([]*Upstream(nil), g.upstreams...)
+}
+
+// Mount registers the upstreams' paths on r, each prefix along with the
+// paths below it
+func (g *Gateway) Mount(r chi.Router) {
+	for _, u := range g.upstreams {
+		h := u.Handler()
+		for _, prefix := range u.Paths {
+			prefix = strings.TrimSuffix(prefix, "/")
+			if prefix != "" {
+				r.Handle(prefix, h)
+			}
+			r.Handle(prefix+"/*", h)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package gateway
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/ratelimit"
+)
+
+// newGateway mounts a gateway with the orders upstream on a router
+func newGateway(t *testing.T, upstream config.UpstreamConfig, limits map[string]func(http.Handler) http.Handler) http.Handler {
+	t.Helper()
+	g, err := New(config.GatewayConfig{Upstreams: map[string]config.UpstreamConfig{"orders": upstream}}, limits, zap.NewNop())
+	require.NoError(t, err)
+	r := chi.NewRouter()
+	g.Mount(r)
+	return r
+}
+
+func serve(h http.Handler, method, target string, body io.Reader) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, target, body))
+	return w
+}
+
+func TestProxy(t *testing.T) {
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "orders/1.2")
+		w.Header().Set("X-Path", r.URL.RequestURI())
+		w.Header().Set("X-Gateway", r.Header.Get("X-Gateway"))
+		w.Header().Set("X-Cookie", r.Header.Get("Cookie"))
+		w.Header().Set("X-Forwarded", r.Header.Get("X-Forwarded-Host"))
+	}))
+	defer service.Close()
+
+	gateway := newGateway(t, config.UpstreamConfig{
+		URL:             service.URL + "/v2",
+		Paths:           []string{"/orders", "/carts/"},
+		StripPrefix:     true,
+		RequestHeaders:  map[string]string{"x-gateway": "dolphin", "cookie": ""},
+		ResponseHeaders: map[string]string{"server": ""},
+	}, nil)
+
+	r := httptest.NewRequest(http.MethodGet, "http://shop.example.com/orders/42?expand=items", nil)
+	r.Header.Set("Cookie", "session=secret")
+	w := httptest.NewRecorder()
+	gateway.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "/v2/42?expand=items", w.Header().Get("X-Path"))
+	assert.Equal(t, "dolphin", w.Header().Get("X-Gateway"))
+	assert.Empty(t, w.Header().Get("X-Cookie"), "removed request headers don't reach the service")
+	assert.Equal(t, "shop.example.com", w.Header().Get("X-Forwarded"))
+	assert.Empty(t, w.Header().Get("Server"), "removed response headers don't reach the client")
+
+	assert.Equal(t, "/v2/", serve(gateway, http.MethodGet, "/carts", nil).Header().Get("X-Path"))
+	assert.Equal(t, http.StatusNotFound, serve(gateway, http.MethodGet, "/ordersx", nil).Code)
+}
+
+func TestRetries(t *testing.T) {
+	var hits atomic.Int32
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1)%3 != 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, "ok")
+	}))
+	defer service.Close()
+	gateway := newGateway(t, config.UpstreamConfig{URL: service.URL, Paths: []string{"/orders"}, Retries: 2, RetryBackoff: time.Millisecond}, nil)
+
+	w := serve(gateway, http.MethodGet, "/orders", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ok", w.Body.String())
+	assert.Equal(t, int32(3), hits.Load())
+
+	// Requests with a body aren't sent twice
+	hits.Store(0)
+	assert.Equal(t, http.StatusServiceUnavailable, serve(gateway, http.MethodPost, "/orders", strings.NewReader(`{}`)).Code)
+	assert.Equal(t, int32(1), hits.Load())
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var hits atomic.Int32
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer service.Close()
+	gateway := newGateway(t, config.UpstreamConfig{
+		URL:            service.URL,
+		Paths:          []string{"/orders"},
+		CircuitBreaker: config.UpstreamBreakerConfig{FailureThreshold: 2, OpenTimeout: time.Minute},
+	}, nil)
+
+	assert.Equal(t, http.StatusInternalServerError, serve(gateway, http.MethodGet, "/orders", nil).Code)
+	assert.Equal(t, http.StatusInternalServerError, serve(gateway, http.MethodGet, "/orders", nil).Code)
+
+	w := serve(gateway, http.MethodGet, "/orders", nil)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), "The upstream service is unavailable")
+	assert.Equal(t, int32(2), hits.Load(), "an open circuit doesn't reach the service")
+}
+
+func TestFailures(t *testing.T) {
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer service.Close()
+
+	slow := newGateway(t, config.UpstreamConfig{URL: service.URL, Paths: []string{"/orders"}, Timeout: 20 * time.Millisecond}, nil)
+	assert.Equal(t, http.StatusGatewayTimeout, serve(slow, http.MethodGet, "/orders", nil).Code)
+
+	down := newGateway(t, config.UpstreamConfig{URL: "http://127.0.0.1:1", Paths: []string{"/orders"}}, nil)
+	w := serve(down, http.MethodGet, "/orders", nil)
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Contains(t, w.Body.String(), "The upstream service failed to respond")
+}
+
+func TestRateLimit(t *testing.T) {
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer service.Close()
+	limits := map[string]func(http.Handler) http.Handler{
+		"orders": ratelimit.NamedRateLimitMiddleware("orders", 1, time.Minute, ratelimit.RemoteIP, ratelimit.NewMemoryRateLimiter(), zap.NewNop()),
+	}
+	gateway := newGateway(t, config.UpstreamConfig{URL: service.URL, Paths: []string{"/orders"}, RateLimit: "orders"}, limits)
+
+	assert.Equal(t, http.StatusOK, serve(gateway, http.MethodGet, "/orders", nil).Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve(gateway, http.MethodGet, "/orders", nil).Code)
+
+	_, err := New(config.GatewayConfig{Upstreams: map[string]config.UpstreamConfig{
+		"orders": {URL: service.URL, Paths: []string{"/orders"}, RateLimit: "missing"},
+	}}, nil, zap.NewNop())
+	assert.EqualError(t, err, `gateway: upstream orders: no rate limiter named "missing"`)
+}
@@ -6,6 +6,7 @@ import (
 	"math"
 
 	"github.com/graphql-go/graphql"
+	"github.com/mrhoseah/dolphin/internal/orm"
 	"go.uber.org/zap"
 )
 
@@ -165,6 +166,49 @@ func CreateConnectionField(
 	}
 }
 
+// CursorParamsFromArgs converts connection arguments into keyset pagination
+// params ordered by orderBy, so resolvers can page directly in the database
+func CursorParamsFromArgs(args ConnectionArgs, orderBy string, desc bool) orm.CursorParams {
+	params := orm.CursorParams{OrderBy: orderBy, Desc: desc}
+	if args.First != nil {
+		params.Limit = *args.First
+	}
+	if args.Last != nil {
+		params.Limit = *args.Last
+	}
+	if args.After != nil {
+		params.After = *args.After
+	}
+	if args.Before != nil {
+		params.Before = *args.Before
+	}
+	return params
+}
+
+// NewCursorConnection builds a connection from a keyset page, using the
+// opaque repository cursors for every edge
+func NewCursorConnection[T any](page *orm.CursorResult[T]) *Connection {
+	edges := make([]Edge, len(page.Data))
+	for i := range page.Data {
+		edges[i] = Edge{
+			Node:   page.Data[i],
+			Cursor: page.Cursors[i],
+		}
+	}
+
+	pageInfo := PageInfo{
+		HasNextPage:     page.HasNext,
+		HasPreviousPage: page.HasPrev,
+	}
+	if len(edges) > 0 {
+		start, end := edges[0].Cursor, edges[len(edges)-1].Cursor
+		pageInfo.StartCursor = &start
+		pageInfo.EndCursor = &end
+	}
+
+	return &Connection{Edges: edges, PageInfo: pageInfo}
+}
+
 // PaginationHelper provides helper functions for pagination
 type PaginationHelper struct {
 	logger *zap.Logger
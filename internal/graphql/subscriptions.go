@@ -11,6 +11,9 @@ import (
 	"github.com/gorilla/websocket"
 	"github.com/graphql-go/graphql"
 	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/broadcast"
+	"github.com/mrhoseah/dolphin/internal/sse"
 )
 
 // SubscriptionManager manages GraphQL subscriptions
@@ -20,6 +23,15 @@ type SubscriptionManager struct {
 	mu       sync.RWMutex
 	logger   *zap.Logger
 	upgrader websocket.Upgrader
+
+	// broadcaster carries published events to the subscribers on other
+	// instances
+	broadcaster broadcast.Broadcaster
+	unsubscribe func()
+
+	// hub shares topics with the streams of its channels, replacing the
+	// broadcaster
+	hub *sse.Hub
 }
 
 // SubscriptionClient represents a WebSocket client
@@ -172,8 +184,77 @@ func (sm *SubscriptionManager) unsubscribeFromTopic(clientID, topic string) erro
 	return nil
 }
 
-// Publish publishes an event to all subscribers of a topic
+// subscriptionsChannel is the broadcast channel published events are
+// shared on
+const subscriptionsChannel = "graphql.subscriptions"
+
+// UseBroadcaster has events published on any instance reach the
+// subscribers connected to this one, so clients can be spread over
+// instances
+func (sm *SubscriptionManager) UseBroadcaster(b broadcast.Broadcaster) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if sm.unsubscribe != nil {
+		sm.unsubscribe()
+	}
+	sm.broadcaster, sm.hub = b, nil
+	sm.unsubscribe = b.Subscribe(subscriptionsChannel, func(ctx context.Context, msg broadcast.Message) error {
+		var payload interface{}
+		if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+			return err
+		}
+		sm.publishLocal(msg.Name, payload)
+		return nil
+	})
+}
+
+// UseHub shares topics with the event streams of hub's channels of the
+// same name: events published on either reach both the WebSocket
+// subscribers and the streams, on every instance the hub's broadcaster
+// reaches, which replaces the manager's own
+func (sm *SubscriptionManager) UseHub(hub *sse.Hub) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if sm.unsubscribe != nil {
+		sm.unsubscribe()
+	}
+	sm.broadcaster, sm.hub = nil, hub
+	sm.unsubscribe = hub.Watch(func(channel string, e sse.Event) {
+		sm.publishLocal(channel, e.Data)
+	})
+}
+
+// Publish publishes an event to all subscribers of a topic, on every
+// instance when a broadcaster or hub is set. It fails if nobody on this
+// instance subscribes to the topic.
 func (sm *SubscriptionManager) Publish(topic string, payload interface{}) error {
+	sm.mu.RLock()
+	b, hub := sm.broadcaster, sm.hub
+	sm.mu.RUnlock()
+	if hub != nil {
+		// The hub hands the event back to publishLocal
+		if err := hub.Publish(context.Background(), topic, sse.Event{Data: payload}); err != nil {
+			return err
+		}
+		sm.mu.RLock()
+		_, exists := sm.topics[topic]
+		sm.mu.RUnlock()
+		if !exists {
+			return fmt.Errorf("topic not found: %s", topic)
+		}
+		return nil
+	}
+	if b != nil {
+		if err := b.Publish(context.Background(), subscriptionsChannel, topic, payload); err != nil {
+			sm.logger.Warn("Failed to broadcast event", zap.String("topic", topic), zap.Error(err))
+		}
+	}
+	return sm.publishLocal(topic, payload)
+}
+
+// publishLocal sends an event to the subscribers of a topic connected to
+// this instance
+func (sm *SubscriptionManager) publishLocal(topic string, payload interface{}) error {
 	sm.mu.RLock()
 	clients, exists := sm.topics[topic]
 	sm.mu.RUnlock()
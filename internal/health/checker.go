@@ -2,218 +2,77 @@ package health
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
-	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 )
 
-// HealthChecker defines the interface for health checks
-type HealthChecker interface {
+// Check statuses, from best to worst
+const (
+	StatusHealthy   = "healthy"
+	StatusDegraded  = "degraded"
+	StatusUnhealthy = "unhealthy"
+)
+
+// DefaultTimeout bounds each check unless the manager is given another
+const DefaultTimeout = 5 * time.Second
+
+// Checker is a registerable health check. Check must honour ctx, which is
+// cancelled when the check's timeout expires.
+type Checker interface {
 	Check(ctx context.Context) HealthStatus
 	GetName() string
 }
 
 // HealthStatus represents the status of a health check
 type HealthStatus struct {
-	Name      string            `json:"name"`
-	Status    string            `json:"status"` // "healthy", "unhealthy", "degraded"
-	Message   string            `json:"message,omitempty"`
+	Name      string                 `json:"name"`
+	Status    string                 `json:"status"` // "healthy", "unhealthy", "degraded"
+	Message   string                 `json:"message,omitempty"`
 	Details   map[string]interface{} `json:"details,omitempty"`
-	Timestamp time.Time         `json:"timestamp"`
-	Duration  time.Duration     `json:"duration"`
+	Timestamp time.Time              `json:"timestamp"`
+	Duration  time.Duration          `json:"duration"`
 }
 
 // HealthResponse represents the overall health response
 type HealthResponse struct {
-	Status    string                    `json:"status"` // "healthy", "unhealthy", "degraded"
-	Timestamp time.Time                 `json:"timestamp"`
-	Duration  time.Duration             `json:"duration"`
-	Checks    map[string]HealthStatus   `json:"checks"`
-	Version   string                    `json:"version,omitempty"`
-	Uptime    time.Duration             `json:"uptime,omitempty"`
-}
-
-// DatabaseHealthChecker checks database connectivity
-type DatabaseHealthChecker struct {
-	db     *sql.DB
-	name   string
-	logger *zap.Logger
-}
-
-// NewDatabaseHealthChecker creates a new database health checker
-func NewDatabaseHealthChecker(db *sql.DB, name string, logger *zap.Logger) *DatabaseHealthChecker {
-	return &DatabaseHealthChecker{
-		db:     db,
-		name:   name,
-		logger: logger,
-	}
-}
-
-func (d *DatabaseHealthChecker) GetName() string {
-	return d.name
-}
-
-func (d *DatabaseHealthChecker) Check(ctx context.Context) HealthStatus {
-	start := time.Now()
-	
-	// Set a timeout for the database check
-	checkCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
-	defer cancel()
-	
-	// Ping the database
-	err := d.db.PingContext(checkCtx)
-	duration := time.Since(start)
-	
-	status := HealthStatus{
-		Name:      d.name,
-		Timestamp: time.Now(),
-		Duration:  duration,
-		Details:   make(map[string]interface{}),
-	}
-	
-	if err != nil {
-		status.Status = "unhealthy"
-		status.Message = fmt.Sprintf("Database connection failed: %v", err)
-		d.logger.Error("Database health check failed", zap.Error(err))
-	} else {
-		status.Status = "healthy"
-		status.Message = "Database connection successful"
-		
-		// Get additional database stats
-		stats := d.db.Stats()
-		status.Details["open_connections"] = stats.OpenConnections
-		status.Details["in_use"] = stats.InUse
-		status.Details["idle"] = stats.Idle
-		status.Details["wait_count"] = stats.WaitCount
-		status.Details["wait_duration"] = stats.WaitDuration.String()
-	}
-	
-	return status
+	Status    string                  `json:"status"` // "healthy", "unhealthy", "degraded"
+	Timestamp time.Time               `json:"timestamp"`
+	Duration  time.Duration           `json:"duration"`
+	Checks    map[string]HealthStatus `json:"checks"`
+	Version   string                  `json:"version,omitempty"`
+	Uptime    time.Duration           `json:"uptime,omitempty"`
 }
 
-// RedisHealthChecker checks Redis connectivity
-type RedisHealthChecker struct {
-	client *redis.Client
-	name   string
-	logger *zap.Logger
+// optional reports a failing check as degraded rather than unhealthy
+type optional struct {
+	Checker
 }
 
-// NewRedisHealthChecker creates a new Redis health checker
-func NewRedisHealthChecker(client *redis.Client, name string, logger *zap.Logger) *RedisHealthChecker {
-	return &RedisHealthChecker{
-		client: client,
-		name:   name,
-		logger: logger,
-	}
-}
-
-func (r *RedisHealthChecker) GetName() string {
-	return r.name
+// Optional wraps a checker whose failure shouldn't take the application
+// out of rotation, such as a cache or a third-party API
+func Optional(checker Checker) Checker {
+	return optional{checker}
 }
 
-func (r *RedisHealthChecker) Check(ctx context.Context) HealthStatus {
-	start := time.Now()
-	
-	// Set a timeout for the Redis check
-	checkCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
-	defer cancel()
-	
-	// Ping Redis
-	err := r.client.Ping(checkCtx).Err()
-	duration := time.Since(start)
-	
-	status := HealthStatus{
-		Name:      r.name,
-		Timestamp: time.Now(),
-		Duration:  duration,
-		Details:   make(map[string]interface{}),
-	}
-	
-	if err != nil {
-		status.Status = "unhealthy"
-		status.Message = fmt.Sprintf("Redis connection failed: %v", err)
-		r.logger.Error("Redis health check failed", zap.Error(err))
-	} else {
-		status.Status = "healthy"
-		status.Message = "Redis connection successful"
-		
-		// Get Redis info
-		info, err := r.client.Info(checkCtx).Result()
-		if err == nil {
-			status.Details["info"] = info
-		}
+func (o optional) Check(ctx context.Context) HealthStatus {
+	status := o.Checker.Check(ctx)
+	if status.Status == StatusUnhealthy {
+		status.Status = StatusDegraded
 	}
-	
-	return status
-}
-
-// HTTPHealthChecker checks external HTTP service
-type HTTPHealthChecker struct {
-	url    string
-	name   string
-	client *http.Client
-	logger *zap.Logger
-}
-
-// NewHTTPHealthChecker creates a new HTTP health checker
-func NewHTTPHealthChecker(url, name string, logger *zap.Logger) *HTTPHealthChecker {
-	return &HTTPHealthChecker{
-		url:    url,
-		name:   name,
-		client: &http.Client{Timeout: 5 * time.Second},
-		logger: logger,
-	}
-}
-
-func (h *HTTPHealthChecker) GetName() string {
-	return h.name
-}
-
-func (h *HTTPHealthChecker) Check(ctx context.Context) HealthStatus {
-	start := time.Now()
-	
-	// Make HTTP request
-	resp, err := h.client.Get(h.url)
-	duration := time.Since(start)
-	
-	status := HealthStatus{
-		Name:      h.name,
-		Timestamp: time.Now(),
-		Duration:  duration,
-		Details:   make(map[string]interface{}),
-	}
-	
-	if err != nil {
-		status.Status = "unhealthy"
-		status.Message = fmt.Sprintf("HTTP check failed: %v", err)
-		h.logger.Error("HTTP health check failed", zap.Error(err))
-	} else {
-		defer resp.Body.Close()
-		
-		status.Details["status_code"] = resp.StatusCode
-		status.Details["response_time"] = duration.String()
-		
-		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-			status.Status = "healthy"
-			status.Message = "HTTP service is responding"
-		} else {
-			status.Status = "unhealthy"
-			status.Message = fmt.Sprintf("HTTP service returned status %d", resp.StatusCode)
-		}
-	}
-	
 	return status
 }
 
 // HealthManager manages all health checks
 type HealthManager struct {
-	checkers []HealthChecker
+	mu        sync.RWMutex
+	checkers  []Checker
+	timeout   time.Duration
 	startTime time.Time
 	version   string
 	logger    *zap.Logger
@@ -221,66 +80,128 @@ type HealthManager struct {
 
 // NewHealthManager creates a new health manager
 func NewHealthManager(version string, logger *zap.Logger) *HealthManager {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
 	return &HealthManager{
-		checkers:  make([]HealthChecker, 0),
+		checkers:  make([]Checker, 0),
+		timeout:   DefaultTimeout,
 		startTime: time.Now(),
 		version:   version,
 		logger:    logger,
 	}
 }
 
+// SetTimeout sets how long each check may run before it is reported unhealthy
+func (h *HealthManager) SetTimeout(timeout time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if timeout > 0 {
+		h.timeout = timeout
+	}
+}
+
 // AddChecker adds a health checker
-func (h *HealthManager) AddChecker(checker HealthChecker) {
+func (h *HealthManager) AddChecker(checker Checker) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
 	h.checkers = append(h.checkers, checker)
 }
 
-// CheckAll performs all health checks
+// Checkers returns the names of the registered checks
+func (h *HealthManager) Checkers() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	names := make([]string, len(h.checkers))
+	for i, c := range h.checkers {
+		names[i] = c.GetName()
+	}
+	return names
+}
+
+// CheckAll runs every check in parallel, each bounded by the timeout
 func (h *HealthManager) CheckAll(ctx context.Context) HealthResponse {
+	h.mu.RLock()
+	checkers := append([]Checker(nil), h.checkers...)
+	timeout := h.timeout
+	h.mu.RUnlock()
+
 	start := time.Now()
-	checks := make(map[string]HealthStatus)
-	
-	// Run all checks concurrently
-	results := make(chan HealthStatus, len(h.checkers))
-	
-	for _, checker := range h.checkers {
-		go func(c HealthChecker) {
-			results <- c.Check(ctx)
+	results := make(chan HealthStatus, len(checkers))
+	for _, checker := range checkers {
+		go func(c Checker) {
+			results <- h.run(ctx, c, timeout)
 		}(checker)
 	}
-	
-	// Collect results
-	for i := 0; i < len(h.checkers); i++ {
+
+	checks := make(map[string]HealthStatus, len(checkers))
+	for range checkers {
 		status := <-results
 		checks[status.Name] = status
 	}
-	
-	duration := time.Since(start)
-	
+
 	// Determine overall status
-	overallStatus := "healthy"
+	overallStatus := StatusHealthy
 	for _, status := range checks {
-		if status.Status == "unhealthy" {
-			overallStatus = "unhealthy"
-			break
-		} else if status.Status == "degraded" && overallStatus == "healthy" {
-			overallStatus = "degraded"
+		if status.Status == StatusUnhealthy {
+			overallStatus = StatusUnhealthy
+		} else if status.Status == StatusDegraded && overallStatus == StatusHealthy {
+			overallStatus = StatusDegraded
 		}
 	}
-	
+
 	return HealthResponse{
 		Status:    overallStatus,
 		Timestamp: time.Now(),
-		Duration:  duration,
+		Duration:  time.Since(start),
 		Checks:    checks,
 		Version:   h.version,
 		Uptime:    time.Since(h.startTime),
 	}
 }
 
-// CheckLiveness performs a basic liveness check
+// run runs one check, turning timeouts and panics into unhealthy results
+func (h *HealthManager) run(ctx context.Context, c Checker, timeout time.Duration) HealthStatus {
+	checkCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan HealthStatus, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- HealthStatus{Status: StatusUnhealthy, Message: fmt.Sprintf("check panicked: %v", r)}
+			}
+		}()
+		done <- c.Check(checkCtx)
+	}()
+
+	var status HealthStatus
+	select {
+	case status = <-done:
+	case <-checkCtx.Done():
+		message := fmt.Sprintf("check timed out after %s", timeout)
+		if ctx.Err() != nil {
+			// The caller gave up first, e.g. the request was canceled
+			message = fmt.Sprintf("check canceled: %v", ctx.Err())
+		}
+		status = HealthStatus{Status: StatusUnhealthy, Message: message}
+	}
+
+	status.Name = c.GetName()
+	status.Timestamp = time.Now()
+	status.Duration = time.Since(start)
+	if status.Status == "" {
+		status.Status = StatusHealthy
+	}
+	return status
+}
+
+// CheckLiveness performs a basic liveness check: the process is up and
+// serving requests, whatever its dependencies are doing
 func (h *HealthManager) CheckLiveness(ctx context.Context) HealthResponse {
 	return HealthResponse{
-		Status:    "healthy",
+		Status:    StatusHealthy,
 		Timestamp: time.Now(),
 		Duration:  0,
 		Checks:    make(map[string]HealthStatus),
@@ -292,42 +213,27 @@ func (h *HealthManager) CheckLiveness(ctx context.Context) HealthResponse {
 // SetupHealthRoutes sets up health check routes
 func SetupHealthRoutes(r chi.Router, manager *HealthManager) {
 	r.Get("/health/live", func(w http.ResponseWriter, r *http.Request) {
-		response := manager.CheckLiveness(r.Context())
-		
-		statusCode := http.StatusOK
-		if response.Status != "healthy" {
-			statusCode = http.StatusServiceUnavailable
-		}
-		
-		render.Status(r, statusCode)
-		render.JSON(w, r, response)
+		respond(w, r, manager.CheckLiveness(r.Context()))
 	})
-	
+
 	r.Get("/health/ready", func(w http.ResponseWriter, r *http.Request) {
-		response := manager.CheckAll(r.Context())
-		
-		statusCode := http.StatusOK
-		if response.Status == "unhealthy" {
-			statusCode = http.StatusServiceUnavailable
-		} else if response.Status == "degraded" {
-			statusCode = http.StatusOK // Still OK but degraded
-		}
-		
-		render.Status(r, statusCode)
-		render.JSON(w, r, response)
+		respond(w, r, manager.CheckAll(r.Context()))
 	})
-	
+
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
-		response := manager.CheckAll(r.Context())
-		
-		statusCode := http.StatusOK
-		if response.Status == "unhealthy" {
-			statusCode = http.StatusServiceUnavailable
-		} else if response.Status == "degraded" {
-			statusCode = http.StatusOK // Still OK but degraded
-		}
-		
-		render.Status(r, statusCode)
-		render.JSON(w, r, response)
+		respond(w, r, manager.CheckAll(r.Context()))
 	})
 }
+
+// respond writes a health response; degraded is still OK so optional
+// dependencies don't take the application out of rotation
+func respond(w http.ResponseWriter, r *http.Request, response HealthResponse) {
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	statusCode := http.StatusOK
+	if response.Status == StatusUnhealthy {
+		statusCode = http.StatusServiceUnavailable
+	}
+
+	render.Status(r, statusCode)
+	render.JSON(w, r, response)
+}
@@ -0,0 +1,196 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/database"
+	raptor "github.com/mrhoseah/raptor/core"
+)
+
+type funcCheck struct {
+	name  string
+	check func(ctx context.Context) HealthStatus
+}
+
+func (f funcCheck) GetName() string                        { return f.name }
+func (f funcCheck) Check(ctx context.Context) HealthStatus { return f.check(ctx) }
+
+func status(s string) func(context.Context) HealthStatus {
+	return func(context.Context) HealthStatus { return HealthStatus{Status: s} }
+}
+
+func TestCheckAllRunsInParallelWithTimeouts(t *testing.T) {
+	m := NewHealthManager("test", nil)
+	m.SetTimeout(50 * time.Millisecond)
+	slow := func(ctx context.Context) HealthStatus {
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		return HealthStatus{Status: StatusHealthy}
+	}
+	m.AddChecker(funcCheck{"slow1", slow})
+	m.AddChecker(funcCheck{"slow2", slow})
+	m.AddChecker(funcCheck{"ok", status(StatusHealthy)})
+	m.AddChecker(funcCheck{"panics", func(context.Context) HealthStatus { panic("boom") }})
+
+	start := time.Now()
+	response := m.CheckAll(context.Background())
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+
+	assert.Equal(t, StatusUnhealthy, response.Status)
+	assert.Equal(t, StatusUnhealthy, response.Checks["slow1"].Status)
+	assert.Contains(t, response.Checks["slow2"].Message, "timed out")
+	assert.Equal(t, StatusHealthy, response.Checks["ok"].Status)
+	assert.Contains(t, response.Checks["panics"].Message, "boom")
+	assert.Equal(t, "ok", response.Checks["ok"].Name)
+
+	// A caller that gives up isn't reported as the check timing out
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	response = m.CheckAll(ctx)
+	assert.Equal(t, "check canceled: context canceled", response.Checks["slow1"].Message)
+}
+
+func TestOptionalDegrades(t *testing.T) {
+	m := NewHealthManager("test", nil)
+	m.AddChecker(funcCheck{"db", status(StatusHealthy)})
+	m.AddChecker(Optional(funcCheck{"cache", status(StatusUnhealthy)}))
+
+	response := m.CheckAll(context.Background())
+	assert.Equal(t, StatusDegraded, response.Status)
+	assert.Equal(t, StatusDegraded, response.Checks["cache"].Status)
+}
+
+func TestHealthRoutes(t *testing.T) {
+	m := NewHealthManager("1.2.3", nil)
+	m.AddChecker(funcCheck{"db", status(StatusUnhealthy)})
+	r := chi.NewRouter()
+	SetupHealthRoutes(r, m)
+
+	get := func(path string) (*httptest.ResponseRecorder, HealthResponse) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var response HealthResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w, response
+	}
+
+	w, response := get("/health/live")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, response.Checks)
+	assert.Equal(t, "1.2.3", response.Version)
+
+	w, response = get("/health/ready")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, StatusUnhealthy, response.Checks["db"].Status)
+
+	w, _ = get("/health")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+}
+
+func TestBuiltinChecks(t *testing.T) {
+	ctx := context.Background()
+
+	disk := NewDiskSpaceHealthChecker(t.TempDir(), 1, "disk").Check(ctx)
+	assert.Equal(t, StatusHealthy, disk.Status)
+	disk = NewDiskSpaceHealthChecker(t.TempDir(), 1<<62, "disk").Check(ctx)
+	assert.Equal(t, StatusUnhealthy, disk.Status)
+
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer up.Close()
+	assert.Equal(t, StatusHealthy, NewHTTPHealthChecker(up.URL, "api", nil).Check(ctx).Status)
+	assert.Equal(t, StatusUnhealthy, NewHTTPHealthChecker(up.URL+"/down", "api", nil).Check(ctx).Status)
+}
+
+type pendingMigration struct{}
+
+func (pendingMigration) Name() string               { return "health_test_pending" }
+func (pendingMigration) Up(s raptor.Schema) error   { return nil }
+func (pendingMigration) Down(s raptor.Schema) error { return nil }
+
+func TestRegisterDefaults(t *testing.T) {
+	cfg := &config.Config{
+		Database: config.DatabaseConfig{Driver: "sqlite", Database: filepath.Join(t.TempDir(), "app.db")},
+		Health:   config.HealthConfig{Migrations: true, DiskPath: t.TempDir(), DiskMinFreeMB: 1},
+	}
+	db, err := database.New(&cfg.Database)
+	require.NoError(t, err)
+	defer db.Close()
+
+	m := NewHealthManager("test", nil)
+	require.NoError(t, RegisterDefaults(m, cfg, db))
+	assert.Equal(t, []string{"database", "migrations", "disk"}, m.Checkers())
+
+	response := m.CheckAll(context.Background())
+	assert.Equal(t, StatusHealthy, response.Checks["database"].Status)
+	assert.Equal(t, StatusHealthy, response.Checks["disk"].Status)
+
+	database.RegisterMigration(pendingMigration{})
+	response = m.CheckAll(context.Background())
+	assert.Equal(t, StatusUnhealthy, response.Checks["migrations"].Status)
+	assert.Equal(t, []string{"health_test_pending"}, response.Checks["migrations"].Details["pending"])
+}
+
+func TestNamedConnectionChecks(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{
+		Database: config.DatabaseConfig{
+			Driver: "sqlite", Database: filepath.Join(dir, "app.db"),
+			Connections: map[string]config.ConnectionConfig{
+				"analytics": {Database: filepath.Join(dir, "events.db")},
+				"legacy":    {Driver: "oracle"},
+			},
+		},
+	}
+
+	m := NewHealthManager("test", nil)
+	require.NoError(t, RegisterDefaults(m, cfg, nil))
+	assert.Equal(t, []string{"database:analytics", "database:legacy"}, m.Checkers())
+
+	response := m.CheckAll(context.Background())
+	assert.Equal(t, StatusHealthy, response.Checks["database:analytics"].Status)
+	assert.Equal(t, "sqlite", response.Checks["database:analytics"].Details["driver"])
+	assert.Equal(t, false, response.Checks["database:analytics"].Details["read_only"])
+
+	// A broken named connection degrades health without failing readiness
+	assert.Equal(t, StatusDegraded, response.Checks["database:legacy"].Status)
+	assert.Contains(t, response.Checks["database:legacy"].Message, "unsupported database driver: oracle")
+	assert.Equal(t, StatusDegraded, response.Status)
+}
+
+func TestStorageChecks(t *testing.T) {
+	cfg := &config.Config{
+		Storage: config.StorageConfig{Disks: map[string]config.DiskConfig{
+			"local": {Driver: "local", Options: map[string]string{"root": t.TempDir()}},
+			"s3":    {Driver: "s3", Options: map[string]string{"bucket": "uploads"}},
+		}},
+		Health: config.HealthConfig{Storage: []string{"local", "s3"}},
+	}
+
+	m := NewHealthManager("test", nil)
+	require.NoError(t, RegisterDefaults(m, cfg, nil))
+	assert.Equal(t, []string{"storage:local", "storage:s3"}, m.Checkers())
+
+	response := m.CheckAll(context.Background())
+	assert.Equal(t, StatusHealthy, response.Checks["storage:local"].Status)
+	assert.Equal(t, StatusDegraded, response.Checks["storage:s3"].Status)
+	assert.Equal(t, "connect", response.Checks["storage:s3"].Details["step"])
+
+	cfg.Health.Storage = []string{"missing"}
+	assert.Error(t, RegisterDefaults(NewHealthManager("test", nil), cfg, nil))
+}
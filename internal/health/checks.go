@@ -0,0 +1,337 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/database"
+	"github.com/mrhoseah/dolphin/internal/storage"
+)
+
+// DatabaseHealthChecker checks database connectivity
+type DatabaseHealthChecker struct {
+	db     *sql.DB
+	name   string
+	logger *zap.Logger
+}
+
+// NewDatabaseHealthChecker creates a new database health checker
+func NewDatabaseHealthChecker(db *sql.DB, name string, logger *zap.Logger) *DatabaseHealthChecker {
+	return &DatabaseHealthChecker{
+		db:     db,
+		name:   name,
+		logger: logger,
+	}
+}
+
+func (d *DatabaseHealthChecker) GetName() string {
+	return d.name
+}
+
+func (d *DatabaseHealthChecker) Check(ctx context.Context) HealthStatus {
+	status := HealthStatus{Details: make(map[string]interface{})}
+
+	if err := d.db.PingContext(ctx); err != nil {
+		status.Status = StatusUnhealthy
+		status.Message = fmt.Sprintf("Database connection failed: %v", err)
+		if d.logger != nil {
+			d.logger.Warn("Database health check failed", zap.Error(err))
+		}
+		return status
+	}
+
+	status.Status = StatusHealthy
+	status.Message = "Database connection successful"
+
+	// Get additional database stats
+	stats := d.db.Stats()
+	status.Details["open_connections"] = stats.OpenConnections
+	status.Details["in_use"] = stats.InUse
+	status.Details["idle"] = stats.Idle
+	status.Details["wait_count"] = stats.WaitCount
+	status.Details["wait_duration"] = stats.WaitDuration.String()
+	return status
+}
+
+// RedisHealthChecker checks Redis connectivity
+type RedisHealthChecker struct {
+	client *redis.Client
+	name   string
+	logger *zap.Logger
+}
+
+// NewRedisHealthChecker creates a new Redis health checker
+func NewRedisHealthChecker(client *redis.Client, name string, logger *zap.Logger) *RedisHealthChecker {
+	return &RedisHealthChecker{
+		client: client,
+		name:   name,
+		logger: logger,
+	}
+}
+
+func (r *RedisHealthChecker) GetName() string {
+	return r.name
+}
+
+func (r *RedisHealthChecker) Check(ctx context.Context) HealthStatus {
+	status := HealthStatus{Details: make(map[string]interface{})}
+
+	if err := r.client.Ping(ctx).Err(); err != nil {
+		status.Status = StatusUnhealthy
+		status.Message = fmt.Sprintf("Redis connection failed: %v", err)
+		if r.logger != nil {
+			r.logger.Warn("Redis health check failed", zap.Error(err))
+		}
+		return status
+	}
+
+	status.Status = StatusHealthy
+	status.Message = "Redis connection successful"
+
+	stats := r.client.PoolStats()
+	status.Details["addr"] = r.client.Options().Addr
+	status.Details["total_connections"] = stats.TotalConns
+	status.Details["idle_connections"] = stats.IdleConns
+	status.Details["timeouts"] = stats.Timeouts
+	return status
+}
+
+// HTTPHealthChecker checks external HTTP service
+type HTTPHealthChecker struct {
+	url    string
+	name   string
+	client *http.Client
+	logger *zap.Logger
+}
+
+// NewHTTPHealthChecker creates a new HTTP health checker. The request is
+// bounded by the manager's timeout.
+func NewHTTPHealthChecker(url, name string, logger *zap.Logger) *HTTPHealthChecker {
+	return &HTTPHealthChecker{
+		url:    url,
+		name:   name,
+		client: &http.Client{},
+		logger: logger,
+	}
+}
+
+func (h *HTTPHealthChecker) GetName() string {
+	return h.name
+}
+
+func (h *HTTPHealthChecker) Check(ctx context.Context) HealthStatus {
+	status := HealthStatus{Details: map[string]interface{}{"url": h.url}}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.url, nil)
+	if err != nil {
+		status.Status = StatusUnhealthy
+		status.Message = fmt.Sprintf("Invalid URL: %v", err)
+		return status
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		status.Status = StatusUnhealthy
+		status.Message = fmt.Sprintf("HTTP check failed: %v", err)
+		if h.logger != nil {
+			h.logger.Warn("HTTP health check failed", zap.String("url", h.url), zap.Error(err))
+		}
+		return status
+	}
+	defer resp.Body.Close()
+
+	status.Details["status_code"] = resp.StatusCode
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		status.Status = StatusHealthy
+		status.Message = "HTTP service is responding"
+	} else {
+		status.Status = StatusUnhealthy
+		status.Message = fmt.Sprintf("HTTP service returned status %d", resp.StatusCode)
+	}
+	return status
+}
+
+// DiskSpaceHealthChecker checks free space on the filesystem holding a path
+type DiskSpaceHealthChecker struct {
+	path    string
+	minFree uint64
+	name    string
+}
+
+// NewDiskSpaceHealthChecker creates a disk space checker that is unhealthy
+// once less than minFree bytes are available
+func NewDiskSpaceHealthChecker(path string, minFree uint64, name string) *DiskSpaceHealthChecker {
+	return &DiskSpaceHealthChecker{path: path, minFree: minFree, name: name}
+}
+
+func (d *DiskSpaceHealthChecker) GetName() string {
+	return d.name
+}
+
+func (d *DiskSpaceHealthChecker) Check(ctx context.Context) HealthStatus {
+	free, total, err := diskUsage(d.path)
+	if err != nil {
+		return HealthStatus{Status: StatusUnhealthy, Message: fmt.Sprintf("Disk usage unavailable: %v", err)}
+	}
+
+	status := HealthStatus{Details: map[string]interface{}{
+		"path":        d.path,
+		"free_bytes":  free,
+		"total_bytes": total,
+		"min_free":    d.minFree,
+	}}
+	if free < d.minFree {
+		status.Status = StatusUnhealthy
+		status.Message = fmt.Sprintf("Only %d MB free, need %d MB", free>>20, d.minFree>>20)
+	} else {
+		status.Status = StatusHealthy
+		status.Message = fmt.Sprintf("%d MB free", free>>20)
+	}
+	return status
+}
+
+// MigrationsHealthChecker is unhealthy while migrations are pending, so a
+// new release isn't sent traffic before its schema is in place
+type MigrationsHealthChecker struct {
+	migrator *database.Migrator
+	name     string
+}
+
+// NewMigrationsHealthChecker creates a pending migrations checker
+func NewMigrationsHealthChecker(migrator *database.Migrator, name string) *MigrationsHealthChecker {
+	return &MigrationsHealthChecker{migrator: migrator, name: name}
+}
+
+func (m *MigrationsHealthChecker) GetName() string {
+	return m.name
+}
+
+func (m *MigrationsHealthChecker) Check(ctx context.Context) HealthStatus {
+	var pending []string
+	for _, s := range m.migrator.Status() {
+		if s.Status == "pending" {
+			pending = append(pending, s.Migration)
+		}
+	}
+
+	if len(pending) > 0 {
+		return HealthStatus{
+			Status:  StatusUnhealthy,
+			Message: fmt.Sprintf("%d pending migration(s)", len(pending)),
+			Details: map[string]interface{}{"pending": pending},
+		}
+	}
+	return HealthStatus{Status: StatusHealthy, Message: "All migrations have run"}
+}
+
+// ConnectionHealthChecker checks a named database connection, such as an
+// analytics warehouse. The connection is opened on the first check, so one
+// that is down is reported rather than stopping the application starting.
+type ConnectionHealthChecker struct {
+	config     *config.DatabaseConfig
+	connection string
+	name       string
+	logger     *zap.Logger
+
+	mu   sync.Mutex
+	conn *database.Manager
+}
+
+// NewConnectionHealthChecker creates a checker for a named connection
+func NewConnectionHealthChecker(cfg *config.DatabaseConfig, connection, name string, logger *zap.Logger) *ConnectionHealthChecker {
+	return &ConnectionHealthChecker{config: cfg, connection: connection, name: name, logger: logger}
+}
+
+func (c *ConnectionHealthChecker) GetName() string {
+	return c.name
+}
+
+func (c *ConnectionHealthChecker) Check(ctx context.Context) HealthStatus {
+	conn, err := c.open()
+	if err != nil {
+		return HealthStatus{
+			Status:  StatusUnhealthy,
+			Message: fmt.Sprintf("Database connection failed: %v", err),
+		}
+	}
+
+	status := NewDatabaseHealthChecker(conn.GetSQLDB(), c.name, c.logger).Check(ctx)
+	status.Details["driver"] = c.driver()
+	status.Details["read_only"] = conn.ReadOnly()
+	return status
+}
+
+func (c *ConnectionHealthChecker) open() (*database.Manager, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil {
+		return c.conn, nil
+	}
+	conn, err := database.NewConnection(c.config, c.connection)
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+	return conn, nil
+}
+
+func (c *ConnectionHealthChecker) driver() string {
+	cfg, err := database.ConnectionConfig(c.config, c.connection)
+	if err != nil {
+		return ""
+	}
+	return cfg.Driver
+}
+
+// Close closes the connection if a check opened it
+func (c *ConnectionHealthChecker) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// StorageHealthChecker checks a storage disk by writing, reading back and
+// deleting a small file
+type StorageHealthChecker struct {
+	driver storage.Driver
+	name   string
+}
+
+// NewStorageHealthChecker creates a storage disk checker
+func NewStorageHealthChecker(driver storage.Driver, name string) *StorageHealthChecker {
+	return &StorageHealthChecker{driver: driver, name: name}
+}
+
+func (s *StorageHealthChecker) GetName() string {
+	return s.name
+}
+
+func (s *StorageHealthChecker) Check(ctx context.Context) HealthStatus {
+	report := storage.Verify(ctx, s.driver, storage.VerifyOptions{Rounds: 1, Size: 1 << 10})
+	details := map[string]interface{}{
+		"put_ms":    report.Put.Max.Milliseconds(),
+		"get_ms":    report.Get.Max.Milliseconds(),
+		"delete_ms": report.Delete.Max.Milliseconds(),
+	}
+	if !report.OK() {
+		details["step"] = report.Step
+		return HealthStatus{
+			Status:  StatusUnhealthy,
+			Message: fmt.Sprintf("Storage %s failed: %s", report.Step, report.Error),
+			Details: details,
+		}
+	}
+	return HealthStatus{Status: StatusHealthy, Message: "Storage round trip succeeded", Details: details}
+}
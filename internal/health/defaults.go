@@ -0,0 +1,65 @@
+package health
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/database"
+	"github.com/mrhoseah/dolphin/internal/storage"
+)
+
+// RegisterDefaults adds the built-in checks the configuration calls for:
+// the database, pending migrations and disk space, plus named database
+// connections, Redis, storage disks and external URLs as optional checks
+// that degrade rather than fail readiness
+func RegisterDefaults(m *HealthManager, cfg *config.Config, db *database.Manager) error {
+	m.SetTimeout(cfg.Health.Timeout)
+
+	if db != nil {
+		sqlDB, err := db.GetDB().DB()
+		if err != nil {
+			return fmt.Errorf("database health check: %w", err)
+		}
+		m.AddChecker(NewDatabaseHealthChecker(sqlDB, "database", m.logger))
+		if cfg.Health.Migrations {
+			m.AddChecker(NewMigrationsHealthChecker(db.Migrator("migrations"), "migrations"))
+		}
+	}
+
+	for _, name := range database.ConnectionNames(&cfg.Database)[1:] {
+		m.AddChecker(Optional(NewConnectionHealthChecker(&cfg.Database, name, "database:"+name, m.logger)))
+	}
+
+	if cfg.Health.DiskMinFreeMB > 0 {
+		m.AddChecker(NewDiskSpaceHealthChecker(cfg.Health.DiskPath, uint64(cfg.Health.DiskMinFreeMB)<<20, "disk"))
+	}
+
+	if cfg.Cache.Driver == "redis" {
+		client := redis.NewClient(&redis.Options{
+			Addr: fmt.Sprintf("%s:%d", cfg.Cache.Host, cfg.Cache.Port),
+			DB:   cfg.Cache.DB,
+		})
+		m.AddChecker(Optional(NewRedisHealthChecker(client, "redis", m.logger)))
+	}
+
+	for _, name := range cfg.Health.Storage {
+		driver, err := storage.Disk(&cfg.Storage, name)
+		if err != nil {
+			return fmt.Errorf("storage health check: %w", err)
+		}
+		m.AddChecker(Optional(NewStorageHealthChecker(driver, "storage:"+name)))
+	}
+
+	names := make([]string, 0, len(cfg.Health.URLs))
+	for name := range cfg.Health.URLs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		m.AddChecker(Optional(NewHTTPHealthChecker(cfg.Health.URLs[name], name, m.logger)))
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+
+package health
+
+import "syscall"
+
+// diskUsage returns the bytes available to unprivileged users and the size
+// of the filesystem holding path
+func diskUsage(path string) (free, total uint64, err error) {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil {
+		return 0, 0, err
+	}
+	return fs.Bavail * uint64(fs.Bsize), fs.Blocks * uint64(fs.Bsize), nil
+}
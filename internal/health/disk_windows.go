@@ -0,0 +1,16 @@
+//go:build windows
+
+package health
+
+import "golang.org/x/sys/windows"
+
+// diskUsage returns the bytes available to the caller and the size of the
+// volume holding path
+func diskUsage(path string) (free, total uint64, err error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	err = windows.GetDiskFreeSpaceEx(p, &free, &total, nil)
+	return free, total, err
+}
@@ -14,6 +14,9 @@ import (
 	"time"
 
 	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/observability"
+	"github.com/mrhoseah/dolphin/internal/signing"
 )
 
 // HTTPMethod represents HTTP methods
@@ -63,6 +66,11 @@ type Config struct {
 	APIKey       string `yaml:"api_key" json:"api_key"`
 	APIKeyHeader string `yaml:"api_key_header" json:"api_key_header"`
 
+	// Request signing for calls to the app's other services, verified by
+	// their signing.keys
+	SigningKeyID  string `yaml:"signing_key_id" json:"signing_key_id"`
+	SigningSecret string `yaml:"signing_secret" json:"signing_secret"`
+
 	// Headers
 	DefaultHeaders map[string]string `yaml:"default_headers" json:"default_headers"`
 
@@ -86,6 +94,9 @@ type Config struct {
 	// Metrics
 	EnableMetrics bool `yaml:"enable_metrics" json:"enable_metrics"`
 
+	// Tracing gives each request a client span and propagates the trace
+	EnableTracing bool `yaml:"enable_tracing" json:"enable_tracing"`
+
 	// Correlation ID
 	EnableCorrelationID bool   `yaml:"enable_correlation_id" json:"enable_correlation_id"`
 	CorrelationIDHeader string `yaml:"correlation_id_header" json:"correlation_id_header"`
@@ -121,6 +132,7 @@ func DefaultConfig() *Config {
 		LogRequestBody:       false,
 		LogResponseBody:      false,
 		EnableMetrics:        true,
+		EnableTracing:        true,
 		EnableCorrelationID:  true,
 		CorrelationIDHeader:  "X-Correlation-ID",
 	}
@@ -257,8 +269,16 @@ func createHTTPClient(config *Config) (*http.Client, error) {
 		transport.TLSClientConfig = tlsConfig
 	}
 
+	var roundTripper http.RoundTripper = transport
+	if config.SigningSecret != "" {
+		roundTripper = signing.NewSigner(config.SigningKeyID, config.SigningSecret).Transport(roundTripper)
+	}
+	if config.EnableTracing {
+		roundTripper = observability.TracingTransport(roundTripper)
+	}
+
 	return &http.Client{
-		Transport: transport,
+		Transport: roundTripper,
 		Timeout:   config.Timeout,
 	}, nil
 }
@@ -634,9 +654,7 @@ func (c *Client) Request(method HTTPMethod, url string, options ...RequestOption
 func (c *Client) Close() error {
 	if c.httpClient != nil {
 		// Close idle connections
-		if transport, ok := c.httpClient.Transport.(*http.Transport); ok {
-			transport.CloseIdleConnections()
-		}
+		c.httpClient.CloseIdleConnections()
 	}
 	return nil
 }
@@ -0,0 +1,375 @@
+// Package i18n translates messages from per-locale JSON or YAML files:
+//
+//	// lang/en.json
+//	{"welcome": "Welcome, {name}!", "cart": {"items": "one item|{count} items"}}
+//
+//	i18n.T(ctx, "welcome", i18n.Params{"name": user.Name})
+//	i18n.Choice(ctx, "cart.items", len(items))
+//
+// Nested keys are joined with dots, and files in lang/<locale>/ are
+// prefixed with their name, so lang/fr/auth.yaml holds the auth.* keys.
+// Plural messages list their forms separated by "|" in the order of the
+// locale's plural categories, or as an object keyed by category ("zero",
+// "one", "two", "few", "many", "other"). A "zero" form is used for a count
+// of zero in every locale.
+package i18n
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+// Params are substituted for {name} placeholders in a message
+type Params map[string]interface{}
+
+// message is a translation, or the forms of a plural translation
+type message struct {
+	text  string
+	forms map[string]string
+}
+
+// Translator holds the translations for every locale
+type Translator struct {
+	cfg config.I18nConfig
+
+	mu       sync.RWMutex
+	messages map[string]map[string]message
+	routes   []localizedRoute
+}
+
+// New creates a translator and loads the translation files under
+// cfg.Path, which need not exist
+func New(cfg config.I18nConfig) (*Translator, error) {
+	if cfg.Locale == "" {
+		cfg.Locale = "en"
+	}
+	if cfg.Fallback == "" {
+		cfg.Fallback = cfg.Locale
+	}
+	cfg.Locale, cfg.Fallback = Canonical(cfg.Locale), Canonical(cfg.Fallback)
+	for i, locale := range cfg.Locales {
+		cfg.Locales[i] = Canonical(locale)
+	}
+
+	t := &Translator{cfg: cfg, messages: make(map[string]map[string]message)}
+	if cfg.Path == "" {
+		return t, nil
+	}
+	if _, err := os.Stat(cfg.Path); os.IsNotExist(err) {
+		return t, nil
+	}
+	if err := t.Load(cfg.Path); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Load adds the translations in dir, from <locale>.json, .yaml or .yml
+// files and from <locale>/<group> directories of them
+func (t *Translator) Load(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("i18n: %w", err)
+	}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if !entry.IsDir() {
+			locale, ok := translationFile(entry.Name())
+			if !ok {
+				continue
+			}
+			if err := t.loadFile(locale, "", path); err != nil {
+				return err
+			}
+			continue
+		}
+
+		groups, err := os.ReadDir(path)
+		if err != nil {
+			return fmt.Errorf("i18n: %w", err)
+		}
+		for _, group := range groups {
+			name, ok := translationFile(group.Name())
+			if group.IsDir() || !ok {
+				continue
+			}
+			if err := t.loadFile(entry.Name(), name, filepath.Join(path, group.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// translationFile returns the name of a translation file without its
+// extension
+func translationFile(filename string) (string, bool) {
+	switch ext := filepath.Ext(filename); ext {
+	case ".json", ".yaml", ".yml":
+		return strings.TrimSuffix(filename, ext), true
+	}
+	return "", false
+}
+
+func (t *Translator) loadFile(locale, group, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("i18n: %w", err)
+	}
+	var tree interface{}
+	if filepath.Ext(path) == ".json" {
+		err = json.Unmarshal(data, &tree)
+	} else {
+		err = yaml.Unmarshal(data, &tree)
+	}
+	if err != nil {
+		return fmt.Errorf("i18n: parsing %s: %w", path, err)
+	}
+	if tree == nil {
+		return nil
+	}
+	root, ok := tree.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("i18n: %s must hold an object of translations", path)
+	}
+
+	messages := make(map[string]message)
+	flatten(group, root, messages)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.add(Canonical(locale), messages)
+	return nil
+}
+
+// flatten adds the translations in tree to messages, joining nested keys
+// with dots
+func flatten(prefix string, tree map[string]interface{}, messages map[string]message) {
+	for key, value := range tree {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if forms, ok := pluralForms(v); ok {
+				messages[key] = message{forms: forms}
+			} else {
+				flatten(key, v, messages)
+			}
+		case nil:
+		default:
+			messages[key] = message{text: fmt.Sprint(v)}
+		}
+	}
+}
+
+// pluralForms returns an object of plural forms, which has an "other" form
+// and no keys that aren't plural categories
+func pluralForms(tree map[string]interface{}) (map[string]string, bool) {
+	if _, ok := tree["other"]; !ok {
+		return nil, false
+	}
+	forms := make(map[string]string, len(tree))
+	for category, value := range tree {
+		text, ok := value.(string)
+		if !ok || !isCategory(category) {
+			return nil, false
+		}
+		forms[category] = text
+	}
+	return forms, true
+}
+
+// Add adds translations for locale, replacing any with the same keys.
+// Plural forms are separated by "|".
+func (t *Translator) Add(locale string, messages map[string]string) {
+	added := make(map[string]message, len(messages))
+	for key, text := range messages {
+		added[key] = message{text: text}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.add(Canonical(locale), added)
+}
+
+func (t *Translator) add(locale string, messages map[string]message) {
+	if t.messages[locale] == nil {
+		t.messages[locale] = make(map[string]message, len(messages))
+	}
+	for key, msg := range messages {
+		t.messages[locale][key] = msg
+	}
+}
+
+// Locale returns the locale used when a request asks for no supported one
+func (t *Translator) Locale() string {
+	return t.cfg.Locale
+}
+
+// Locales returns the locales requests can choose: the configured ones, or
+// every locale with translations along with the default
+func (t *Translator) Locales() []string {
+	if len(t.cfg.Locales) > 0 {
+		return append([]string(nil), t.cfg.Locales...)
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	locales := []string{t.cfg.Locale}
+	for locale := range t.messages {
+		if locale != t.cfg.Locale {
+			locales = append(locales, locale)
+		}
+	}
+	sort.Strings(locales[1:])
+	return locales
+}
+
+// Keys returns the keys translated for locale, sorted
+func (t *Translator) Keys(locale string) []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	messages := t.messages[Canonical(locale)]
+	keys := make([]string, 0, len(messages))
+	for key := range messages {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Has reports whether locale itself translates key, without falling back
+func (t *Translator) Has(locale, key string) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	_, ok := t.messages[Canonical(locale)][key]
+	return ok
+}
+
+// lookup finds key in locale, its language, the default locale and then
+// the fallback, returning the locale it was found in
+func (t *Translator) lookup(locale, key string) (message, string, bool) {
+	locale = Canonical(locale)
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for _, candidate := range []string{locale, language(locale), t.cfg.Locale, t.cfg.Fallback} {
+		if msg, ok := t.messages[candidate][key]; ok {
+			return msg, candidate, true
+		}
+	}
+	return message{}, "", false
+}
+
+// T translates key into locale, returning the key itself when no locale
+// translates it. Plural messages give their singular form.
+func (t *Translator) T(locale, key string, params ...Params) string {
+	msg, found, ok := t.lookup(locale, key)
+	if !ok {
+		return key
+	}
+	return replace(msg.pick(found, 1), params)
+}
+
+// Choice translates the form of a plural message for count, which is
+// also available to it as {count}
+func (t *Translator) Choice(locale, key string, count int, params ...Params) string {
+	msg, found, ok := t.lookup(locale, key)
+	if !ok {
+		return key
+	}
+	return replace(msg.pick(found, count), append([]Params{{"count": count}}, params...))
+}
+
+// pick returns the form of msg for count in locale
+func (m message) pick(locale string, count int) string {
+	category := pluralCategory(locale, count)
+	if m.forms != nil {
+		if count == 0 {
+			if text, ok := m.forms["zero"]; ok {
+				return text
+			}
+		}
+		if text, ok := m.forms[category]; ok {
+			return text
+		}
+		return m.forms["other"]
+	}
+
+	forms := strings.Split(m.text, "|")
+	if len(forms) == 1 {
+		return m.text
+	}
+	for i, c := range pluralCategories(locale) {
+		if c == category && i < len(forms) {
+			return strings.TrimSpace(forms[i])
+		}
+	}
+	return strings.TrimSpace(forms[len(forms)-1])
+}
+
+// replace substitutes params for their {name} placeholders, later params
+// taking precedence
+func replace(text string, params []Params) string {
+	if len(params) == 0 || !strings.Contains(text, "{") {
+		return text
+	}
+	merged := make(map[string]string)
+	for _, p := range params {
+		for name, value := range p {
+			merged["{"+name+"}"] = fmt.Sprint(value)
+		}
+	}
+	pairs := make([]string, 0, len(merged)*2)
+	for placeholder, value := range merged {
+		pairs = append(pairs, placeholder, value)
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+// Canonical formats a locale tag as language-REGION, e.g. en_us as en-US
+func Canonical(tag string) string {
+	parts := strings.Split(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"), "-")
+	parts[0] = strings.ToLower(parts[0])
+	for i := 1; i < len(parts); i++ {
+		if len(parts[i]) == 2 {
+			parts[i] = strings.ToUpper(parts[i])
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// language returns the language of a canonical tag
+func language(tag string) string {
+	lang, _, _ := strings.Cut(tag, "-")
+	return lang
+}
+
+// Default is the translator used by the package-level functions, loaded
+// from the i18n config when the router starts
+var Default *Translator
+
+// T translates key into the locale of the request ctx belongs to
+func T(ctx context.Context, key string, params ...Params) string {
+	if Default == nil {
+		return key
+	}
+	return Default.T(Locale(ctx), key, params...)
+}
+
+// Choice translates the form of a plural message for count into the
+// locale of the request ctx belongs to
+func Choice(ctx context.Context, key string, count int, params ...Params) string {
+	if Default == nil {
+		return key
+	}
+	return Default.Choice(Locale(ctx), key, count, params...)
+}
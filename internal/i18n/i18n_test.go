@@ -0,0 +1,272 @@
+package i18n
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+var testConfig = config.I18nConfig{Locale: "en", Fallback: "en", Query: "lang", Cookie: "locale"}
+
+// writeFiles writes files under a new directory and returns it
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	return dir
+}
+
+func newTestTranslator(t *testing.T) *Translator {
+	cfg := testConfig
+	cfg.Path = writeFiles(t, map[string]string{
+		"en.json": `{"welcome": "Welcome, {name}!", "cart": {"items": "one item|{count} items"},
+			"inbox": {"zero": "No messages", "one": "One message", "other": "{count} messages"}}`,
+		"en/auth.yaml": "failed: These credentials do not match our records.\n",
+		"fr.yaml":      "welcome: Bienvenue, {name} !\ncart:\n  items: \"{count} article|{count} articles\"\n",
+		"ru.json":      `{"cart": {"items": "{count} товар|{count} товара|{count} товаров"}}`,
+		"README.md":    "not a translation",
+	})
+	translator, err := New(cfg)
+	require.NoError(t, err)
+	return translator
+}
+
+func TestTranslate(t *testing.T) {
+	translator := newTestTranslator(t)
+
+	assert.Equal(t, "Welcome, Ada!", translator.T("en", "welcome", Params{"name": "Ada"}))
+	assert.Equal(t, "Bienvenue, Ada !", translator.T("fr", "welcome", Params{"name": "Ada"}))
+	assert.Equal(t, "These credentials do not match our records.", translator.T("fr-CA", "auth.failed"),
+		"falls back through the language to the default locale")
+	assert.Equal(t, "auth.unknown", translator.T("fr", "auth.unknown"))
+
+	assert.Equal(t, []string{"en", "fr", "ru"}, translator.Locales())
+	assert.True(t, translator.Has("en", "auth.failed"))
+	assert.False(t, translator.Has("fr", "auth.failed"))
+	assert.Equal(t, []string{"cart.items", "welcome"}, translator.Keys("fr"))
+
+	translator.Add("fr", map[string]string{"auth.failed": "Identifiants incorrects."})
+	assert.Equal(t, "Identifiants incorrects.", translator.T("fr_ca", "auth.failed"))
+
+	_, err := New(config.I18nConfig{Path: writeFiles(t, map[string]string{"en.json": `{"broken"`})})
+	assert.ErrorContains(t, err, "en.json")
+	_, err = New(config.I18nConfig{Path: filepath.Join(t.TempDir(), "missing")})
+	assert.NoError(t, err, "no lang directory is no translations")
+}
+
+func TestPlurals(t *testing.T) {
+	translator := newTestTranslator(t)
+
+	assert.Equal(t, "one item", translator.Choice("en", "cart.items", 1))
+	assert.Equal(t, "0 items", translator.Choice("en", "cart.items", 0))
+	assert.Equal(t, "3 items", translator.Choice("en", "cart.items", 3))
+	assert.Equal(t, "one item", translator.T("en", "cart.items"), "T gives the singular")
+
+	// French counts zero as singular
+	assert.Equal(t, "0 article", translator.Choice("fr", "cart.items", 0))
+	assert.Equal(t, "2 articles", translator.Choice("fr", "cart.items", 2))
+
+	for count, want := range map[int]string{1: "1 товар", 21: "21 товар", 3: "3 товара", 5: "5 товаров", 12: "12 товаров", 112: "112 товаров"} {
+		assert.Equal(t, want, translator.Choice("ru", "cart.items", count), count)
+	}
+
+	// Object forms, with a zero form in any locale
+	assert.Equal(t, "No messages", translator.Choice("en", "inbox", 0))
+	assert.Equal(t, "One message", translator.Choice("en", "inbox", 1))
+	assert.Equal(t, "7 messages", translator.Choice("fr", "inbox", 7))
+
+	assert.Equal(t, "few", pluralCategory("pl", 22))
+	assert.Equal(t, "many", pluralCategory("pl", 25))
+	assert.Equal(t, "other", pluralCategory("ja", 1))
+	assert.Equal(t, "two", pluralCategory("ar", 2))
+	assert.Equal(t, "many", pluralCategory("ar", 11))
+	assert.Equal(t, "one", pluralCategory("pt-BR", 0))
+	assert.Equal(t, "other", pluralCategory("pt-PT", 0))
+}
+
+func TestMiddleware(t *testing.T) {
+	translator := newTestTranslator(t)
+	var seen string
+	handler := translator.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = Locale(r.Context())
+	}))
+
+	request := func(target, cookie, acceptLanguage string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		if cookie != "" {
+			r.AddCookie(&http.Cookie{Name: "locale", Value: cookie})
+		}
+		if acceptLanguage != "" {
+			r.Header.Set("Accept-Language", acceptLanguage)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := request("/", "", "de-DE,ru;q=0.8,fr;q=0.9")
+	assert.Equal(t, "fr", seen)
+	assert.Equal(t, "fr", w.Header().Get("Content-Language"))
+	assert.Empty(t, w.Result().Cookies())
+
+	request("/", "ru", "fr")
+	assert.Equal(t, "ru", seen, "the cookie wins over the header")
+
+	w = request("/?lang=fr_FR", "ru", "en")
+	assert.Equal(t, "fr", seen, "the query wins and is remembered")
+	require.Len(t, w.Result().Cookies(), 1)
+	assert.Equal(t, "fr", w.Result().Cookies()[0].Value)
+
+	// A locale set before the middleware, like a saved preference, wins
+	// over the cookie but not the query
+	preferred := httptest.NewRequest(http.MethodGet, "/", nil)
+	preferred.AddCookie(&http.Cookie{Name: "locale", Value: "fr"})
+	preferred = preferred.WithContext(WithLocale(preferred.Context(), "ru"))
+	assert.Equal(t, "ru", translator.Detect(preferred))
+	preferred.URL.RawQuery = "lang=en"
+	assert.Equal(t, "en", translator.Detect(preferred))
+
+	request("/?lang=xx", "", "de, *")
+	assert.Equal(t, "en", seen, "unsupported locales give the default")
+
+	limited := testConfig
+	limited.Path = translator.cfg.Path
+	limited.Locales = []string{"en", "fr"}
+	only, err := New(limited)
+	require.NoError(t, err)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Language", "ru")
+	assert.Equal(t, "en", only.Detect(r))
+}
+
+func TestPackageFunctions(t *testing.T) {
+	previous := Default
+	defer func() { Default = previous }()
+
+	Default = nil
+	assert.Equal(t, "welcome", T(context.Background(), "welcome"))
+
+	Default = newTestTranslator(t)
+	assert.Equal(t, "en", Locale(context.Background()))
+	ctx := WithLocale(context.Background(), "fr")
+	assert.Equal(t, "Bienvenue, Ada !", T(ctx, "welcome", Params{"name": "Ada"}))
+	assert.Equal(t, "4 articles", Choice(ctx, "cart.items", 4))
+}
+
+func TestTemplateHelpers(t *testing.T) {
+	translator := newTestTranslator(t)
+	tmpl := template.Must(template.New("page").Funcs(translator.TemplateHelpers("fr")).Parse(
+		`{{locale}}: {{t "welcome" "name" .Name}} {{choice "cart.items" .Count}} {{t "welcome" .}}`))
+
+	var out strings.Builder
+	require.NoError(t, tmpl.Execute(&out, map[string]interface{}{"Name": "<Ada>", "Count": 2, "locale": "en"}))
+	assert.Equal(t, "fr: Bienvenue, &lt;Ada&gt; ! 2 articles Welcome, {name}!", out.String(),
+		"a locale param switches locale, and params are escaped")
+}
+
+func TestLocalizedRoutes(t *testing.T) {
+	cfg := testConfig
+	cfg.Redirect = true
+	cfg.Path = writeFiles(t, map[string]string{
+		"en.yaml": "routes:\n  about: /about\n  products:\n    show: /products/{id}\n",
+		"fr.yaml": "routes:\n  about: /a-propos/\n  products:\n    show: /produits/{id:[0-9]+}\n",
+		"de.yaml": "welcome: Willkommen\n",
+	})
+	translator, err := New(cfg)
+	require.NoError(t, err)
+
+	router := chi.NewRouter()
+	router.Use(translator.Middleware)
+	show := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, Locale(r.Context()), " ", chi.URLParam(r, "id"))
+	})
+	translator.Localize(router, http.MethodGet, "about", show)
+	translator.Localize(router, http.MethodGet, "products.show", show)
+	assert.Panics(t, func() { translator.Localize(router, http.MethodGet, "contact", show) })
+
+	request := func(target, acceptLanguage string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		r.Header.Set("Accept-Language", acceptLanguage)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := request("/fr/produits/42", "de")
+	assert.Equal(t, "fr 42", w.Body.String(), "the prefix wins over the header")
+	assert.Equal(t, "fr", w.Header().Get("Content-Language"))
+	assert.Equal(t, "de ", request("/de/about", "en").Body.String(), "locales without the path use the fallback's")
+	assert.Equal(t, http.StatusNotFound, request("/fr/about", "fr").Code)
+
+	w = request("/about?ref=mail", "fr-CA")
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/fr/a-propos?ref=mail", w.Header().Get("Location"))
+	assert.Equal(t, "/de/products/7", request("/produits/7", "de").Header().Get("Location"))
+	assert.Equal(t, http.StatusNotFound, request("/contact", "fr").Code)
+
+	url, err := translator.URL("fr", "products.show", Params{"id": 42, "page": 2})
+	require.NoError(t, err)
+	assert.Equal(t, "/fr/produits/42?page=2", url)
+	_, err = translator.URL("fr", "products.show")
+	assert.EqualError(t, err, "i18n: route products.show needs the id parameter")
+	_, err = translator.URL("fr", "contact")
+	assert.EqualError(t, err, "i18n: route contact has no path")
+
+	tmpl := template.Must(template.New("page").Funcs(translator.TemplateHelpers("fr")).Parse(
+		`{{route "about"}} {{route "products.show" "id" .ID}} {{route "about" "locale" "en"}}`))
+	var out strings.Builder
+	require.NoError(t, tmpl.Execute(&out, map[string]interface{}{"ID": 42}))
+	assert.Equal(t, "/fr/a-propos /fr/produits/42 /en/about", out.String())
+}
+
+func TestMissing(t *testing.T) {
+	translator := newTestTranslator(t)
+	root := writeFiles(t, map[string]string{
+		"ui/views/home.html":     `<h1>{{t "welcome" "name" .Name}}</h1><p>{{ choice "cart.items" .Count }}</p>` + "\n" + `<p>don't "quote" me</p>{{template "nav" (t "nav.home")}}`,
+		"app/controller.go":      `msg := i18n.T(r.Context(), "auth.failed")` + "\n" + `n := translator.Choice(locale, "cart.items", 3)`,
+		"app/controller_test.go": `i18n.T(ctx, "test.only")`,
+		"node_modules/x.html":    `{{t "vendored"}}`,
+	})
+
+	usages, err := Scan(root)
+	require.NoError(t, err)
+	keys := []string{}
+	for _, usage := range usages {
+		keys = append(keys, usage.Key)
+	}
+	assert.ElementsMatch(t, []string{"welcome", "cart.items", "nav.home", "auth.failed", "cart.items"}, keys)
+
+	missing := translator.Missing(usages)
+	assert.Equal(t, []string{"nav.home"}, usageKeys(missing["en"]))
+	assert.Equal(t, []string{"auth.failed", "nav.home"}, usageKeys(missing["fr"]))
+	assert.Equal(t, []string{"auth.failed", "nav.home", "welcome"}, usageKeys(missing["ru"]))
+	assert.Equal(t, 2, missing["en"][0].Line)
+	assert.Equal(t, filepath.Join(root, "ui/views/home.html"), missing["en"][0].File)
+
+	only := translator.Missing(usages, "fr")
+	assert.Len(t, only, 1)
+}
+
+func usageKeys(usages []Usage) []string {
+	keys := make([]string, len(usages))
+	for i, usage := range usages {
+		keys[i] = usage.Key
+	}
+	return keys
+}
@@ -0,0 +1,215 @@
+package i18n
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rememberFor is how long the locale cookie is kept
+const rememberFor = 365 * 24 * time.Hour
+
+type localeKey struct{}
+
+// WithLocale returns a context whose translations use locale
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, localeKey{}, Canonical(locale))
+}
+
+// Locale returns the locale chosen for the request ctx belongs to, or the
+// default locale
+func Locale(ctx context.Context) string {
+	if locale, ok := ctx.Value(localeKey{}).(string); ok {
+		return locale
+	}
+	if Default != nil {
+		return Default.Locale()
+	}
+	return ""
+}
+
+// Match returns the supported locale closest to tag: the same locale,
+// then its language, then another region of that language
+func (t *Translator) Match(tag string) (string, bool) {
+	tag = Canonical(tag)
+	if tag == "" {
+		return "", false
+	}
+	supported := t.Locales()
+	for _, locale := range supported {
+		if locale == tag {
+			return locale, true
+		}
+	}
+	lang := language(tag)
+	for _, locale := range supported {
+		if locale == lang {
+			return locale, true
+		}
+	}
+	for _, locale := range supported {
+		if language(locale) == lang {
+			return locale, true
+		}
+	}
+	return "", false
+}
+
+// Detect returns the locale a request asks for: from the query parameter,
+// then a locale already in its context, such as a user's saved preference,
+// then the cookie, then the Accept-Language header, or the default
+func (t *Translator) Detect(r *http.Request) string {
+	locale, _ := t.detect(r)
+	return locale
+}
+
+func (t *Translator) detect(r *http.Request) (locale string, fromQuery bool) {
+	if t.cfg.Query != "" {
+		if locale, ok := t.Match(r.URL.Query().Get(t.cfg.Query)); ok {
+			return locale, true
+		}
+	}
+	if preferred, ok := r.Context().Value(localeKey{}).(string); ok {
+		if locale, ok := t.Match(preferred); ok {
+			return locale, false
+		}
+	}
+	if t.cfg.Cookie != "" {
+		if cookie, err := r.Cookie(t.cfg.Cookie); err == nil {
+			if locale, ok := t.Match(cookie.Value); ok {
+				return locale, false
+			}
+		}
+	}
+	for _, tag := range acceptLanguages(r.Header.Get("Accept-Language")) {
+		if locale, ok := t.Match(tag); ok {
+			return locale, false
+		}
+	}
+	return t.cfg.Locale, false
+}
+
+// acceptLanguages returns the tags of an Accept-Language header, most
+// preferred first
+func acceptLanguages(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q > 0 {
+			tags = append(tags, weighted{tag, q})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+
+	ordered := make([]string, len(tags))
+	for i, w := range tags {
+		ordered[i] = w.tag
+	}
+	return ordered
+}
+
+// Middleware sets the locale of each request, available through Locale.
+// A locale chosen with the query parameter is remembered in the cookie.
+// With Redirect configured, a GET for one of the paths of a localized route
+// without its locale prefix is redirected to the route's path in the
+// request's locale: /about to /fr/a-propos for a French speaker.
+func (t *Translator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		locale, fromQuery := t.detect(r)
+		if fromQuery && t.cfg.Cookie != "" {
+			http.SetCookie(w, &http.Cookie{
+				Name:     t.cfg.Cookie,
+				Value:    locale,
+				Path:     "/",
+				MaxAge:   int(rememberFor / time.Second),
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+		w.Header().Set("Content-Language", locale)
+		w.Header().Add("Vary", "Accept-Language")
+		if t.cfg.Redirect && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+			if target, ok := t.localizedPath(r.URL.Path, locale); ok {
+				if r.URL.RawQuery != "" {
+					target += "?" + r.URL.RawQuery
+				}
+				http.Redirect(w, r, target, http.StatusFound)
+				return
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(WithLocale(r.Context(), locale)))
+	})
+}
+
+// TemplateHelpers returns the translation helpers for templates rendered
+// in locale:
+//
+//	{{t "welcome" "name" .User.Name}}
+//	{{choice "cart.items" .Count}}
+//	<a href="{{route "products.show" "id" .Product.ID}}">
+//
+// Params are given as name/value pairs or maps, such as the page data. A
+// "locale" param renders the message, or the route's path, in that locale
+// instead.
+func (t *Translator) TemplateHelpers(locale string) template.FuncMap {
+	return template.FuncMap{
+		"t": func(key string, args ...interface{}) string {
+			params, in := templateParams(locale, args)
+			return t.T(in, key, params)
+		},
+		"choice": func(key string, count int, args ...interface{}) string {
+			params, in := templateParams(locale, args)
+			return t.Choice(in, key, count, params)
+		},
+		"route": func(name string, args ...interface{}) (string, error) {
+			params, in := templateParams(locale, args)
+			delete(params, "locale")
+			return t.URL(in, name, params)
+		},
+		"locale": func() string { return locale },
+	}
+}
+
+// templateParams collects the params given to a template helper and the
+// locale they ask for
+func templateParams(locale string, args []interface{}) (Params, string) {
+	params := Params{}
+	for i := 0; i < len(args); i++ {
+		if name, ok := args[i].(string); ok {
+			if i+1 < len(args) {
+				params[name] = args[i+1]
+				i++
+			}
+			continue
+		}
+		value := reflect.ValueOf(args[i])
+		if value.Kind() != reflect.Map || value.Type().Key().Kind() != reflect.String {
+			continue
+		}
+		iter := value.MapRange()
+		for iter.Next() {
+			params[iter.Key().String()] = iter.Value().Interface()
+		}
+	}
+	if in, ok := params["locale"].(string); ok && in != "" {
+		locale = in
+	}
+	return params, locale
+}
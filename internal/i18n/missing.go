@@ -0,0 +1,114 @@
+package i18n
+
+import (
+	"bufio"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Usage is a translation key used in a template or Go file
+type Usage struct {
+	Key  string
+	File string
+	Line int
+}
+
+var (
+	// templateKey matches {{t "key"}} and {{choice "key" n}}, also inside
+	// parentheses and pipelines
+	templateKey = regexp.MustCompile(`(?:\{\{-?|\(|\|)\s*(?:t|choice)\s+"([^"\\]+)"`)
+
+	// goKey matches i18n.T(ctx, "key"), translator.T(locale, "key") and
+	// the same calls to Choice
+	goKey = regexp.MustCompile(`\b(?:T|Choice)\((?:[^,()"]|\([^()]*\))*,\s*"([^"\\]+)"`)
+)
+
+// skipDirs are never scanned for keys
+var skipDirs = map[string]bool{".git": true, "vendor": true, "node_modules": true, "storage": true}
+
+// Scan finds the translation keys used in the templates and Go files
+// under roots, skipping tests
+func Scan(roots ...string) ([]Usage, error) {
+	var usages []Usage
+	for _, root := range roots {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if path != root && skipDirs[d.Name()] {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			var pattern *regexp.Regexp
+			switch ext := filepath.Ext(path); {
+			case ext == ".go" && !strings.HasSuffix(path, "_test.go"):
+				pattern = goKey
+			case ext == ".html" || ext == ".tmpl" || ext == ".gohtml":
+				pattern = templateKey
+			default:
+				return nil
+			}
+			found, err := scanFile(path, pattern)
+			usages = append(usages, found...)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return usages, nil
+}
+
+func scanFile(path string, pattern *regexp.Regexp) ([]Usage, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var usages []Usage
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		for _, match := range pattern.FindAllStringSubmatch(scanner.Text(), -1) {
+			usages = append(usages, Usage{Key: match[1], File: path, Line: line})
+		}
+	}
+	return usages, scanner.Err()
+}
+
+// Missing returns, for each of locales, the first use of every key that
+// locale doesn't translate itself, in key order
+func (t *Translator) Missing(usages []Usage, locales ...string) map[string][]Usage {
+	if len(locales) == 0 {
+		locales = t.Locales()
+	}
+	first := make(map[string]Usage)
+	for _, usage := range usages {
+		if _, seen := first[usage.Key]; !seen {
+			first[usage.Key] = usage
+		}
+	}
+	keys := make([]string, 0, len(first))
+	for key := range first {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	missing := make(map[string][]Usage)
+	for _, locale := range locales {
+		for _, key := range keys {
+			if !t.Has(locale, key) {
+				missing[Canonical(locale)] = append(missing[Canonical(locale)], first[key])
+			}
+		}
+	}
+	return missing
+}
@@ -0,0 +1,151 @@
+package i18n
+
+// pluralRule gives the CLDR plural category of a whole number, and the
+// order of a locale's categories in "|"-separated messages
+type pluralRule struct {
+	categories []string
+	category   func(n int) string
+}
+
+var (
+	oneOther = pluralRule{
+		categories: []string{"one", "other"},
+		category: func(n int) string {
+			if n == 1 {
+				return "one"
+			}
+			return "other"
+		},
+	}
+
+	// zeroOrOneOther treats 0 as singular, as French and Portuguese do
+	zeroOrOneOther = pluralRule{
+		categories: []string{"one", "other"},
+		category: func(n int) string {
+			if n == 0 || n == 1 {
+				return "one"
+			}
+			return "other"
+		},
+	}
+
+	other = pluralRule{
+		categories: []string{"other"},
+		category:   func(int) string { return "other" },
+	}
+
+	eastSlavic = pluralRule{
+		categories: []string{"one", "few", "many"},
+		category: func(n int) string {
+			return slavic(n, "many")
+		},
+	}
+
+	// southSlavic has "other" where the east Slavic languages have "many"
+	southSlavic = pluralRule{
+		categories: []string{"one", "few", "other"},
+		category: func(n int) string {
+			return slavic(n, "other")
+		},
+	}
+
+	polish = pluralRule{
+		categories: []string{"one", "few", "many"},
+		category: func(n int) string {
+			if n == 1 {
+				return "one"
+			}
+			if n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14) {
+				return "few"
+			}
+			return "many"
+		},
+	}
+
+	westSlavic = pluralRule{
+		categories: []string{"one", "few", "other"},
+		category: func(n int) string {
+			switch {
+			case n == 1:
+				return "one"
+			case n >= 2 && n <= 4:
+				return "few"
+			}
+			return "other"
+		},
+	}
+
+	arabic = pluralRule{
+		categories: []string{"zero", "one", "two", "few", "many", "other"},
+		category: func(n int) string {
+			switch {
+			case n == 0:
+				return "zero"
+			case n == 1:
+				return "one"
+			case n == 2:
+				return "two"
+			case n%100 >= 3 && n%100 <= 10:
+				return "few"
+			case n%100 >= 11:
+				return "many"
+			}
+			return "other"
+		},
+	}
+)
+
+func slavic(n int, rest string) string {
+	switch {
+	case n%10 == 1 && n%100 != 11:
+		return "one"
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+		return "few"
+	}
+	return rest
+}
+
+// pluralRules maps locales and languages to their rules; other languages
+// use oneOther
+var pluralRules = map[string]pluralRule{
+	"fr": zeroOrOneOther, "pt": zeroOrOneOther, "hi": zeroOrOneOther, "bn": zeroOrOneOther,
+	"fa": zeroOrOneOther, "am": zeroOrOneOther, "zu": zeroOrOneOther, "pt-PT": oneOther,
+
+	"ja": other, "zh": other, "ko": other, "vi": other, "th": other,
+	"id": other, "ms": other, "lo": other, "my": other, "km": other,
+
+	"ru": eastSlavic, "uk": eastSlavic, "be": eastSlavic,
+	"hr": southSlavic, "sr": southSlavic, "bs": southSlavic,
+	"pl": polish,
+	"cs": westSlavic, "sk": westSlavic,
+	"ar": arabic,
+}
+
+func ruleFor(locale string) pluralRule {
+	if rule, ok := pluralRules[locale]; ok {
+		return rule
+	}
+	if rule, ok := pluralRules[language(locale)]; ok {
+		return rule
+	}
+	return oneOther
+}
+
+func pluralCategory(locale string, n int) string {
+	if n < 0 {
+		n = -n
+	}
+	return ruleFor(locale).category(n)
+}
+
+func pluralCategories(locale string) []string {
+	return ruleFor(locale).categories
+}
+
+func isCategory(name string) bool {
+	switch name {
+	case "zero", "one", "two", "few", "many", "other":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+package i18n
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// RoutesKey prefixes the translation keys holding the paths of localized
+// routes, so the about route's French path is the fr routes.about key:
+//
+//	# lang/fr.yaml
+//	routes:
+//	  about: /a-propos
+//	  products:
+//	    show: /produits/{id}
+const RoutesKey = "routes."
+
+// localizedRoute is the path of a localized route in one locale
+type localizedRoute struct {
+	name     string
+	locale   string
+	segments []string
+}
+
+// Localize registers h for method on router under the path of route name
+// in every supported locale, prefixed with the locale: /en/about and
+// /fr/a-propos. A locale without the path uses its fallback's, and a route
+// no locale has a path for panics, like chi's bad patterns. Requests
+// handled there are in the locale of their prefix, whatever they ask for.
+func (t *Translator) Localize(router chi.Router, method, name string, h http.Handler) {
+	for _, locale := range t.Locales() {
+		pattern, ok := t.routePath(locale, name)
+		if !ok {
+			panic(fmt.Sprintf("i18n: route %s has no path; add %s%s to the translations", name, RoutesKey, name))
+		}
+		router.Method(method, strings.TrimSuffix("/"+locale+pattern, "/"), inLocale(locale, h))
+
+		t.mu.Lock()
+		t.routes = append(t.routes, localizedRoute{name: name, locale: locale, segments: segments(pattern)})
+		t.mu.Unlock()
+	}
+}
+
+// inLocale serves h in locale, replacing the locale the request asked for
+func inLocale(locale string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Language", locale)
+		h.ServeHTTP(w, r.WithContext(WithLocale(r.Context(), locale)))
+	})
+}
+
+// routePath returns the path of route name in locale, or its fallback's
+func (t *Translator) routePath(locale, name string) (string, bool) {
+	msg, _, ok := t.lookup(locale, RoutesKey+name)
+	if !ok || msg.text == "" {
+		return "", false
+	}
+	return "/" + strings.Trim(msg.text, "/"), true
+}
+
+// URL returns the path of route name in locale, prefixed with the locale.
+// Params fill the route's {placeholders}, and any left over are added as
+// the query string.
+func (t *Translator) URL(locale, name string, params ...Params) (string, error) {
+	if match, ok := t.Match(locale); ok {
+		locale = match
+	} else {
+		locale = t.cfg.Locale
+	}
+	pattern, ok := t.routePath(locale, name)
+	if !ok {
+		return "", fmt.Errorf("i18n: route %s has no path", name)
+	}
+
+	values := make(map[string]string)
+	for _, p := range params {
+		for key, value := range p {
+			values[key] = fmt.Sprint(value)
+		}
+	}
+	parts := segments(pattern)
+	for i, segment := range parts {
+		param, ok := placeholder(segment)
+		if !ok {
+			parts[i] = url.PathEscape(segment)
+			continue
+		}
+		value, ok := values[param]
+		if !ok || value == "" {
+			return "", fmt.Errorf("i18n: route %s needs the %s parameter", name, param)
+		}
+		parts[i] = url.PathEscape(value)
+		delete(values, param)
+	}
+
+	path := "/" + locale
+	if len(parts) > 0 {
+		path += "/" + strings.Join(parts, "/")
+	}
+	if len(values) > 0 {
+		query := url.Values{}
+		for key, value := range values {
+			query.Set(key, value)
+		}
+		path += "?" + query.Encode()
+	}
+	return path, nil
+}
+
+// Route returns the path of route name in the locale of the request ctx
+// belongs to, as URL does
+func Route(ctx context.Context, name string, params ...Params) (string, error) {
+	if Default == nil {
+		return "", errors.New("i18n: no translator")
+	}
+	return Default.URL(Locale(ctx), name, params...)
+}
+
+// localizedPath returns the path of the localized route a path without a
+// locale prefix is one of the paths of, in locale
+func (t *Translator) localizedPath(path, locale string) (string, bool) {
+	requested := segments(path)
+	t.mu.RLock()
+	routes := t.routes
+	t.mu.RUnlock()
+
+	// A path that has a locale prefix already is left alone, even where a
+	// route's placeholders would match it
+	for _, route := range routes {
+		if len(requested) > 0 && requested[0] == route.locale {
+			return "", false
+		}
+	}
+	for _, route := range routes {
+		if params, ok := matchSegments(route.segments, requested); ok {
+			target, err := t.URL(locale, route.name, params)
+			return target, err == nil
+		}
+	}
+	return "", false
+}
+
+// segments splits a path into its segments, none for the root
+func segments(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// placeholder returns the name of a {name} or {name:regexp} segment
+func placeholder(segment string) (string, bool) {
+	if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") {
+		return "", false
+	}
+	name, _, _ := strings.Cut(segment[1:len(segment)-1], ":")
+	return name, true
+}
+
+// matchSegments matches a path's segments with a route's, returning the
+// values of its placeholders
+func matchSegments(pattern, path []string) (Params, bool) {
+	if len(pattern) != len(path) {
+		return nil, false
+	}
+	params := Params{}
+	for i, segment := range pattern {
+		if name, ok := placeholder(segment); ok && path[i] != "" {
+			params[name] = path[i]
+		} else if segment != path[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
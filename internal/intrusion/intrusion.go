@@ -0,0 +1,378 @@
+// Package intrusion detects intruders probing the app and bans their IPs.
+// Honeytokens are paths and credentials no legitimate client uses: a
+// request for /wp-login.php, or a decoy API key planted in a config file,
+// alerts and bans at once. Scanners are caught by volume: requests for
+// paths matching scan patterns, and 404s, count against each IP, and an IP
+// over the threshold within the window is banned.
+//
+// Bans go to the rate limiter's ban list, which refuses the IP until the
+// ban expires. Every detection is logged and published on the bus as
+// Detected, and alerts through the Alerter, such as SMS and push
+// notifications, at most once per IP and kind every ten minutes.
+package intrusion
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/bus"
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/notify"
+	"github.com/mrhoseah/dolphin/internal/ratelimit"
+)
+
+// Kinds of detection
+const (
+	KindHoneyPath       = "honey_path"
+	KindHoneyCredential = "honey_credential"
+	KindScan            = "scan"
+)
+
+// alertInterval is how long alerts for an IP and kind are suppressed after
+// one is sent
+const alertInterval = 10 * time.Minute
+
+// Detected is published on the bus for every detection
+type Detected struct {
+	Kind      string    `json:"kind"`
+	IP        string    `json:"ip"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	UserAgent string    `json:"user_agent"`
+	Detail    string    `json:"detail,omitempty"`
+	Banned    bool      `json:"banned"`
+	At        time.Time `json:"at"`
+}
+
+// EventName names Detected when bridged to the event dispatcher
+func (Detected) EventName() string { return "intrusion.detected" }
+
+// Message describes a detection for alerts
+func (d Detected) Message() notify.Message {
+	body := fmt.Sprintf("%s from %s: %s %s", d.Kind, d.IP, d.Method, d.Path)
+	if d.Detail != "" {
+		body += " (" + d.Detail + ")"
+	}
+	if d.Banned {
+		body += ", banned"
+	}
+	return notify.Message{Title: "Intrusion detected", Body: body}
+}
+
+// Alerter tells someone about a detection
+type Alerter interface {
+	Alert(ctx context.Context, d Detected) error
+}
+
+// NotifyAlerter alerts by SMS to phone numbers and by push notification to
+// users' devices
+type NotifyAlerter struct {
+	notifier *notify.Notifier
+	phones   []string
+	users    []string
+}
+
+// NewNotifyAlerter creates an alerter sending through notifier
+func NewNotifyAlerter(notifier *notify.Notifier, phones, users []string) *NotifyAlerter {
+	return &NotifyAlerter{notifier: notifier, phones: phones, users: users}
+}
+
+func (a *NotifyAlerter) Alert(ctx context.Context, d Detected) error {
+	msg := d.Message()
+	var errs []error
+	for _, phone := range a.phones {
+		errs = append(errs, a.notifier.SendSMS(ctx, phone, msg.Text()))
+	}
+	for _, user := range a.users {
+		errs = append(errs, a.notifier.Send(ctx, notify.Recipient{UserID: user}, msg, notify.ChannelPush))
+	}
+	return errors.Join(errs...)
+}
+
+// Detector watches requests for honeytokens and scanning
+type Detector struct {
+	honeyPaths  []string
+	credentials map[string]bool
+	patterns    []*regexp.Regexp
+	threshold   int
+	window      time.Duration
+	banDuration time.Duration
+	trusted     []netip.Prefix
+
+	bans    *ratelimit.BanList
+	alerter Alerter
+	bus     *bus.Bus
+	logger  *zap.Logger
+
+	mu        sync.Mutex
+	counts    map[string]*scanCount
+	alerted   map[string]time.Time
+	lastSweep time.Time
+}
+
+// scanCount counts an IP's suspicious requests in the current window
+type scanCount struct {
+	n   int
+	end time.Time
+}
+
+// New creates a detector banning on bans, which may be nil to only alert,
+// and alerting through alerter, which may be nil to only log and publish
+func New(cfg config.IntrusionConfig, bans *ratelimit.BanList, alerter Alerter, logger *zap.Logger) (*Detector, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	d := &Detector{
+		credentials: make(map[string]bool, len(cfg.HoneyCredentials)),
+		threshold:   cfg.ScanThreshold,
+		window:      cfg.ScanWindow,
+		banDuration: cfg.BanDuration,
+		bans:        bans,
+		alerter:     alerter,
+		bus:         bus.Default,
+		logger:      logger,
+		counts:      make(map[string]*scanCount),
+		alerted:     make(map[string]time.Time),
+	}
+	for _, path := range cfg.HoneyPaths {
+		d.honeyPaths = append(d.honeyPaths, strings.ToLower(strings.TrimRight(path, "/")))
+	}
+	for _, credential := range cfg.HoneyCredentials {
+		if credential != "" {
+			d.credentials[credential] = true
+		}
+	}
+	for _, pattern := range cfg.ScanPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("intrusion: invalid scan pattern %q: %w", pattern, err)
+		}
+		d.patterns = append(d.patterns, re)
+	}
+	trusted, err := ratelimit.ParsePrefixes(cfg.Trusted)
+	if err != nil {
+		return nil, fmt.Errorf("intrusion: invalid trusted IP: %w", err)
+	}
+	d.trusted = trusted
+	if d.threshold > 0 && d.window <= 0 {
+		return nil, errors.New("intrusion: scan_window must be positive")
+	}
+	return d, nil
+}
+
+// Middleware detects honeytokens in requests and counts suspicious ones.
+// Honey paths get a plain 404 and honey credentials a 401, so intruders
+// learn nothing. It goes after ratelimit.BanMiddleware and
+// ratelimit.RealIP: the IPs it trusts, counts and bans are those the
+// trusted proxies forwarded, or the peer's, never a header a client sent
+// directly.
+func (d *Detector) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if d.trustedIP(ratelimit.RemoteIP(r)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if d.honeyPath(r.URL.Path) {
+			d.detect(r, KindHoneyPath, "")
+			http.NotFound(w, r)
+			return
+		}
+		if credential, ok := d.requestCredential(r); ok {
+			d.detect(r, KindHoneyCredential, credentialHint(credential))
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		suspicious := d.suspicious(r.URL.Path)
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+		if suspicious || ww.Status() == http.StatusNotFound {
+			d.count(r)
+		}
+	})
+}
+
+// Credential reports whether a credential submitted to a login form or
+// API is a honeytoken, and detects it when it is. Handlers then refuse it
+// as they would any wrong credential.
+func (d *Detector) Credential(r *http.Request, credential string) bool {
+	if !d.credentials[credential] {
+		return false
+	}
+	d.detect(r, KindHoneyCredential, credentialHint(credential))
+	return true
+}
+
+// requestCredential finds a honeytoken in the Authorization or X-API-Key
+// header
+func (d *Detector) requestCredential(r *http.Request) (string, bool) {
+	if len(d.credentials) == 0 {
+		return "", false
+	}
+	candidates := []string{r.Header.Get("X-API-Key")}
+	if scheme, value, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok {
+		switch strings.ToLower(scheme) {
+		case "bearer", "token":
+			candidates = append(candidates, value)
+		case "basic":
+			if decoded, err := base64.StdEncoding.DecodeString(value); err == nil {
+				user, password, _ := strings.Cut(string(decoded), ":")
+				candidates = append(candidates, user, password)
+			}
+		}
+	}
+	for _, candidate := range candidates {
+		if d.credentials[candidate] {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// credentialHint identifies a honeytoken in alerts without repeating it
+func credentialHint(credential string) string {
+	if len(credential) <= 4 {
+		return "credential ****"
+	}
+	return "credential " + credential[:4] + "****"
+}
+
+func (d *Detector) honeyPath(path string) bool {
+	path = strings.ToLower(strings.TrimRight(path, "/"))
+	for _, honey := range d.honeyPaths {
+		if path == honey || strings.HasPrefix(path, honey+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Detector) suspicious(path string) bool {
+	for _, re := range d.patterns {
+		if re.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Detector) trustedIP(ip string) bool {
+	return ratelimit.ContainsIP(d.trusted, ip)
+}
+
+// count counts a suspicious request, detecting a scan when its IP goes
+// over the threshold
+func (d *Detector) count(r *http.Request) {
+	if d.threshold <= 0 {
+		return
+	}
+	ip := ratelimit.RemoteIP(r)
+	now := time.Now()
+
+	d.mu.Lock()
+	d.sweep(now)
+	c, ok := d.counts[ip]
+	if !ok || !now.Before(c.end) {
+		c = &scanCount{end: now.Add(d.window)}
+		d.counts[ip] = c
+	}
+	c.n++
+	over := c.n == d.threshold
+	d.mu.Unlock()
+
+	if over {
+		d.detect(r, KindScan, fmt.Sprintf("%d suspicious requests within %s", d.threshold, d.window))
+	}
+}
+
+// sweep drops finished windows and expired alert suppressions, once a
+// window
+func (d *Detector) sweep(now time.Time) {
+	interval := d.window
+	if interval <= 0 {
+		interval = alertInterval
+	}
+	if now.Sub(d.lastSweep) < interval {
+		return
+	}
+	d.lastSweep = now
+	for ip, c := range d.counts {
+		if !now.Before(c.end) {
+			delete(d.counts, ip)
+		}
+	}
+	for key, at := range d.alerted {
+		if now.Sub(at) >= alertInterval {
+			delete(d.alerted, key)
+		}
+	}
+}
+
+// detect bans the IP of a request unless it is trusted, then logs,
+// publishes and alerts
+func (d *Detector) detect(r *http.Request, kind, detail string) {
+	ctx := r.Context()
+	detected := Detected{
+		Kind:      kind,
+		IP:        ratelimit.RemoteIP(r),
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		UserAgent: r.UserAgent(),
+		Detail:    detail,
+		At:        time.Now(),
+	}
+	if d.bans != nil && d.banDuration > 0 && !d.trustedIP(detected.IP) {
+		if err := d.bans.Ban(ctx, detected.IP, kind+": "+detected.Path, d.banDuration); err != nil {
+			d.logger.Error("Failed to ban IP", zap.String("ip", detected.IP), zap.Error(err))
+		} else {
+			detected.Banned = true
+		}
+	}
+
+	d.logger.Warn("Intrusion detected",
+		zap.String("kind", kind),
+		zap.String("ip", detected.IP),
+		zap.String("path", detected.Path),
+		zap.String("detail", detail),
+		zap.Bool("banned", detected.Banned))
+	if err := d.bus.Publish(ctx, detected); err != nil {
+		d.logger.Warn("Intrusion handler failed", zap.Error(err))
+	}
+
+	if d.alerter == nil || !d.shouldAlert(detected) {
+		return
+	}
+	// Alerts are sent after the response, outliving the request
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+		defer cancel()
+		if err := d.alerter.Alert(ctx, detected); err != nil {
+			d.logger.Error("Failed to send intrusion alert", zap.Error(err))
+		}
+	}()
+}
+
+// shouldAlert reports whether no alert for the IP and kind was sent
+// within alertInterval, recording this one
+func (d *Detector) shouldAlert(detected Detected) bool {
+	key := detected.Kind + " " + detected.IP
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.sweep(detected.At)
+	if at, ok := d.alerted[key]; ok && detected.At.Sub(at) < alertInterval {
+		return false
+	}
+	d.alerted[key] = detected.At
+	return true
+}
@@ -0,0 +1,248 @@
+package intrusion
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/bus"
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/database"
+	"github.com/mrhoseah/dolphin/internal/ratelimit"
+)
+
+var testConfig = config.IntrusionConfig{
+	Enabled:          true,
+	HoneyPaths:       []string{"/wp-login.php", "/wp-admin"},
+	HoneyCredentials: []string{"decoy-api-key-7f3a", "backup-admin@example.com"},
+	ScanPatterns:     []string{`\.php$`, `/\.git/`},
+	ScanThreshold:    3,
+	ScanWindow:       time.Minute,
+	BanDuration:      time.Hour,
+	Trusted:          []string{"10.0.0.0/8"},
+}
+
+// fakeAlerter records alerts
+type fakeAlerter struct {
+	mu     sync.Mutex
+	alerts []Detected
+	sent   chan struct{}
+}
+
+func (a *fakeAlerter) Alert(ctx context.Context, d Detected) error {
+	a.mu.Lock()
+	a.alerts = append(a.alerts, d)
+	a.mu.Unlock()
+	a.sent <- struct{}{}
+	return nil
+}
+
+type testApp struct {
+	detector *Detector
+	bans     *ratelimit.BanList
+	alerter  *fakeAlerter
+	events   *[]Detected
+	handler  http.Handler
+}
+
+func newTestApp(t *testing.T, cfg config.IntrusionConfig) *testApp {
+	db, err := database.New(&config.DatabaseConfig{Driver: "sqlite", Database: filepath.Join(t.TempDir(), "app.db")})
+	require.NoError(t, err)
+	bans, err := ratelimit.NewBanList(db.GetDB(), time.Hour)
+	require.NoError(t, err)
+
+	alerter := &fakeAlerter{sent: make(chan struct{}, 10)}
+	detector, err := New(cfg, bans, alerter, nil)
+	require.NoError(t, err)
+	detector.bus = bus.New()
+	var events []Detected
+	bus.SubscribeTo(detector.bus, func(ctx context.Context, e Detected) error {
+		events = append(events, e)
+		return nil
+	})
+
+	proxies, err := ratelimit.ParsePrefixes([]string{"172.16.0.0/12"})
+	require.NoError(t, err)
+	r := chi.NewRouter()
+	r.Use(ratelimit.RealIP(proxies))
+	r.Use(ratelimit.BanMiddleware(bans, detector.logger))
+	r.Use(detector.Middleware)
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("home")) })
+	r.Post("/login", func(w http.ResponseWriter, r *http.Request) {
+		if detector.Credential(r, r.FormValue("email")) {
+			http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("welcome"))
+	})
+	return &testApp{detector: detector, bans: bans, alerter: alerter, events: &events, handler: r}
+}
+
+func (a *testApp) request(method, path, ip string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = ip + ":54321"
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rec := httptest.NewRecorder()
+	a.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func (a *testApp) waitForAlert(t *testing.T) {
+	select {
+	case <-a.alerter.sent:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no alert sent")
+	}
+}
+
+func TestHoneyPathBansAndAlerts(t *testing.T) {
+	app := newTestApp(t, testConfig)
+
+	rec := app.request(http.MethodGet, "/wp-admin/install.php", "203.0.113.9", nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	app.waitForAlert(t)
+
+	require.Len(t, *app.events, 1)
+	detected := (*app.events)[0]
+	assert.Equal(t, KindHoneyPath, detected.Kind)
+	assert.Equal(t, "203.0.113.9", detected.IP)
+	assert.Equal(t, "/wp-admin/install.php", detected.Path)
+	assert.True(t, detected.Banned)
+	assert.Equal(t, "intrusion.detected", detected.EventName())
+	assert.Equal(t, "honey_path from 203.0.113.9: GET /wp-admin/install.php, banned", detected.Message().Body)
+
+	rec = app.request(http.MethodGet, "/", "203.0.113.9", nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code, "banned")
+	rec = app.request(http.MethodGet, "/", "203.0.113.10", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	bans, err := app.bans.List(context.Background())
+	require.NoError(t, err)
+	require.Len(t, bans, 1)
+	assert.Equal(t, "honey_path: /wp-admin/install.php", bans[0].Reason)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), *bans[0].ExpiresAt, time.Minute)
+}
+
+func TestHoneyCredentials(t *testing.T) {
+	app := newTestApp(t, testConfig)
+
+	rec := app.request(http.MethodGet, "/", "198.51.100.1", http.Header{"X-Api-Key": {"decoy-api-key-7f3a"}})
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	app.waitForAlert(t)
+	assert.Equal(t, "credential deco****", app.alerter.alerts[0].Detail, "not repeated in alerts")
+
+	rec = app.request(http.MethodGet, "/", "198.51.100.2", http.Header{"Authorization": {"Bearer decoy-api-key-7f3a"}})
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	req := httptest.NewRequest(http.MethodPost, "/login", nil)
+	req.RemoteAddr = "198.51.100.3:1234"
+	req.Form = map[string][]string{"email": {"backup-admin@example.com"}}
+	rec = httptest.NewRecorder()
+	app.handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	require.Len(t, *app.events, 3)
+	for _, detected := range *app.events {
+		assert.Equal(t, KindHoneyCredential, detected.Kind)
+		assert.True(t, detected.Banned)
+	}
+}
+
+func TestScanDetection(t *testing.T) {
+	app := newTestApp(t, testConfig)
+
+	for _, path := range []string{"/index.php", "/missing", "/"} {
+		assert.NotEqual(t, http.StatusForbidden, app.request(http.MethodGet, path, "192.0.2.7", nil).Code)
+	}
+	assert.Empty(t, *app.events, "under the threshold")
+
+	app.request(http.MethodGet, "/.git/HEAD", "192.0.2.7", nil)
+	app.waitForAlert(t)
+	require.Len(t, *app.events, 1)
+	assert.Equal(t, KindScan, (*app.events)[0].Kind)
+	assert.Equal(t, "3 suspicious requests within 1m0s", (*app.events)[0].Detail)
+	assert.Equal(t, http.StatusForbidden, app.request(http.MethodGet, "/", "192.0.2.7", nil).Code)
+}
+
+func TestTrustedIPsAreNeverBanned(t *testing.T) {
+	app := newTestApp(t, testConfig)
+
+	for i := 0; i < 5; i++ {
+		app.request(http.MethodGet, "/wp-login.php", "10.1.2.3", nil)
+	}
+	assert.Equal(t, http.StatusOK, app.request(http.MethodGet, "/", "10.1.2.3", nil).Code)
+	assert.Empty(t, *app.events)
+}
+
+func TestForwardedIPsOnlyFromTrustedProxies(t *testing.T) {
+	app := newTestApp(t, testConfig)
+
+	// A client connecting directly can't pass for a trusted IP, nor dodge
+	// its ban by changing the header
+	spoofed := http.Header{"X-Forwarded-For": {"10.1.2.3"}, "X-Real-Ip": {"10.1.2.3"}}
+	app.request(http.MethodGet, "/wp-login.php", "203.0.113.20", spoofed)
+	app.waitForAlert(t)
+	require.Len(t, *app.events, 1)
+	assert.Equal(t, "203.0.113.20", (*app.events)[0].IP)
+	rotated := http.Header{"X-Forwarded-For": {"198.51.100.99"}}
+	assert.Equal(t, http.StatusForbidden, app.request(http.MethodGet, "/", "203.0.113.20", rotated).Code)
+	assert.Equal(t, http.StatusOK, app.request(http.MethodGet, "/", "198.51.100.99", nil).Code, "not banned for another's request")
+
+	// Through the load balancer, the client is the last hop it added
+	forwarded := http.Header{"X-Forwarded-For": {"10.1.2.3, 198.51.100.7"}}
+	app.request(http.MethodGet, "/wp-login.php", "172.16.0.5", forwarded)
+	app.waitForAlert(t)
+	require.Len(t, *app.events, 2)
+	assert.Equal(t, "198.51.100.7", (*app.events)[1].IP)
+	assert.Equal(t, http.StatusForbidden, app.request(http.MethodGet, "/", "172.16.0.5", http.Header{"X-Forwarded-For": {"198.51.100.7"}}).Code)
+	assert.Equal(t, http.StatusOK, app.request(http.MethodGet, "/", "172.16.0.5", http.Header{"X-Real-Ip": {"198.51.100.8"}}).Code)
+}
+
+func TestAlertsAreThrottled(t *testing.T) {
+	cfg := testConfig
+	cfg.BanDuration = 0
+	app := newTestApp(t, cfg)
+
+	for i := 0; i < 3; i++ {
+		app.request(http.MethodGet, "/wp-login.php", "203.0.113.50", nil)
+	}
+	app.waitForAlert(t)
+	require.Len(t, *app.events, 3, "every detection is published")
+	assert.False(t, (*app.events)[0].Banned)
+
+	select {
+	case <-app.alerter.sent:
+		t.Fatal("alerted again within the interval")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestBanList(t *testing.T) {
+	app := newTestApp(t, testConfig)
+	ctx := context.Background()
+
+	require.NoError(t, app.bans.Ban(ctx, "2001:db8::/32", "manual", 0))
+	ban, banned, err := app.bans.Banned(ctx, "2001:db8::1")
+	require.NoError(t, err)
+	assert.True(t, banned)
+	assert.Nil(t, ban.ExpiresAt, "forever")
+
+	require.NoError(t, app.bans.Unban(ctx, "2001:db8::/32"))
+	_, banned, err = app.bans.Banned(ctx, "2001:db8::1")
+	require.NoError(t, err)
+	assert.False(t, banned)
+
+	assert.Error(t, app.bans.Ban(ctx, "not-an-ip", "", 0))
+	_, err = New(config.IntrusionConfig{ScanPatterns: []string{"("}}, nil, nil, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,198 @@
+package livereload
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Environment variables the supervisor sets for the app it runs, so the app
+// injects the live reload script into its pages
+const (
+	PortEnv  = "DOLPHIN_LIVERELOAD_PORT"
+	PathsEnv = "DOLPHIN_LIVERELOAD_PATHS"
+)
+
+// InjectFromEnv returns the script injection middleware when the app runs
+// under `dolphin dev` with hot reload on, and nil otherwise
+func InjectFromEnv() func(http.Handler) http.Handler {
+	port, err := strconv.Atoi(os.Getenv(PortEnv))
+	if err != nil || port <= 0 {
+		return nil
+	}
+	var paths []string
+	if value := os.Getenv(PathsEnv); value != "" {
+		paths = strings.Split(value, ",")
+	}
+	return Inject(port, paths)
+}
+
+// Inject adds the live reload script before </body> of HTML responses to
+// requests under paths (all requests when empty). A Content-Security-Policy
+// set by inner handlers or earlier middleware is widened to allow the
+// script and its WebSocket.
+func Inject(port int, paths []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet || !injectable(r.URL.Path, paths) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			host := r.Host
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			origin := fmt.Sprintf("%s:%d", host, port)
+			iw := &injectWriter{ResponseWriter: w, origin: origin, status: http.StatusOK}
+			next.ServeHTTP(iw, r)
+			iw.finish()
+		})
+	}
+}
+
+func injectable(path string, paths []string) bool {
+	if len(paths) == 0 {
+		return true
+	}
+	for _, prefix := range paths {
+		if strings.HasPrefix(path, strings.TrimSpace(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// injectWriter buffers HTML responses to add the script and passes
+// everything else straight through
+type injectWriter struct {
+	http.ResponseWriter
+	origin      string
+	status      int
+	wroteHeader bool
+	decided     bool
+	html        bool
+	buf         bytes.Buffer
+}
+
+func (w *injectWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = status
+
+	// Without a Content-Type it is sniffed from the first write, as
+	// net/http does
+	if w.Header().Get("Content-Type") != "" {
+		w.decide()
+	}
+}
+
+// decide passes the header on unless the response is an HTML page
+func (w *injectWriter) decide() {
+	w.decided = true
+	header := w.Header()
+	w.html = strings.HasPrefix(header.Get("Content-Type"), "text/html") && header.Get("Content-Encoding") == ""
+	if !w.html {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+}
+
+func (w *injectWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	if !w.decided {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		w.decide()
+	}
+	if !w.html {
+		return w.ResponseWriter.Write(p)
+	}
+	return w.buf.Write(p)
+}
+
+// Flush passes through for streamed responses, which aren't HTML pages
+func (w *injectWriter) Flush() {
+	if w.wroteHeader && !w.decided {
+		w.decide()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok && !w.html {
+		flusher.Flush()
+	}
+}
+
+func (w *injectWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// finish writes the buffered page with the script added
+func (w *injectWriter) finish() {
+	if w.wroteHeader && !w.decided {
+		w.decide()
+	}
+	if !w.html {
+		return
+	}
+
+	tag := []byte(fmt.Sprintf(`<script src="http://%s/livereload.js"></script>`, w.origin))
+	page := w.buf.Bytes()
+	if i := bytes.LastIndex(bytes.ToLower(page), []byte("</body>")); i >= 0 {
+		page = append(page[:i:i], append(tag, page[i:]...)...)
+	} else {
+		page = append(page, tag...)
+	}
+
+	header := w.Header()
+	header.Del("Content-Length")
+	if csp := header.Get("Content-Security-Policy"); csp != "" {
+		header.Set("Content-Security-Policy", allowOrigin(csp, w.origin))
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.Write(page)
+}
+
+// allowOrigin adds the live reload server to the script-src and connect-src
+// directives of a policy, or to default-src where they fall back to it
+func allowOrigin(csp, origin string) string {
+	sources := map[string]string{
+		"script-src":  "http://" + origin,
+		"connect-src": "ws://" + origin,
+	}
+	directives := strings.Split(csp, ";")
+	seen := map[string]bool{}
+	for i, directive := range directives {
+		fields := strings.Fields(directive)
+		if len(fields) == 0 {
+			continue
+		}
+		name := strings.ToLower(fields[0])
+		if source, ok := sources[name]; ok {
+			directives[i] = strings.TrimSpace(directive) + " " + source
+			seen[name] = true
+		}
+	}
+	for i, directive := range directives {
+		fields := strings.Fields(directive)
+		if len(fields) > 0 && strings.ToLower(fields[0]) == "default-src" {
+			for _, name := range []string{"script-src", "connect-src"} {
+				if !seen[name] {
+					directive = strings.TrimSpace(directive) + " " + sources[name]
+				}
+			}
+			directives[i] = directive
+		}
+	}
+	result := directives[:0]
+	for _, directive := range directives {
+		if directive = strings.TrimSpace(directive); directive != "" {
+			result = append(result, directive)
+		}
+	}
+	return strings.Join(result, "; ")
+}
@@ -0,0 +1,55 @@
+package livereload
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInjectAddsScriptToHTML(t *testing.T) {
+	handler := Inject(35729, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Length", "40")
+		w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'self';")
+		w.Write([]byte("<html><body><h1>Hi</h1></BODY></html>"))
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil))
+
+	assert.Equal(t, `<html><body><h1>Hi</h1><script src="http://localhost:35729/livereload.js"></script></BODY></html>`, rec.Body.String())
+	assert.Empty(t, rec.Header().Get("Content-Length"))
+	assert.Equal(t, "default-src 'self' ws://localhost:35729; script-src 'self' http://localhost:35729", rec.Header().Get("Content-Security-Policy"))
+}
+
+func TestInjectPassesOtherResponsesThrough(t *testing.T) {
+	handler := Inject(35729, []string{"/app"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api" {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("<html><body></body></html>"))
+	}))
+
+	for _, path := range []string{"/api", "/other"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusCreated, rec.Code, path)
+		assert.Equal(t, "<html><body></body></html>", rec.Body.String(), path)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/app/home", nil))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Contains(t, rec.Body.String(), "livereload.js", "HTML is detected without a Content-Type")
+}
+
+func TestInjectFromEnv(t *testing.T) {
+	t.Setenv(PortEnv, "")
+	assert.Nil(t, InjectFromEnv())
+
+	t.Setenv(PortEnv, "4000")
+	assert.NotNil(t, InjectFromEnv())
+}
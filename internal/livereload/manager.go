@@ -2,24 +2,30 @@ package livereload
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
 )
 
 // ReloadStrategy represents the reload strategy
 type ReloadStrategy int
 
 const (
+	// StrategyRestart rebuilds when Go files changed and restarts the app
 	StrategyRestart ReloadStrategy = iota
+	// StrategyRebuild rebuilds and restarts the app on every change
 	StrategyRebuild
+	// StrategyHotReload only refreshes connected browsers
 	StrategyHotReload
 )
 
@@ -36,6 +42,26 @@ func (s ReloadStrategy) String() string {
 	}
 }
 
+// MarshalText writes the strategy by name
+func (s ReloadStrategy) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText reads a strategy name, so config files can say "rebuild"
+func (s *ReloadStrategy) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "restart":
+		*s = StrategyRestart
+	case "rebuild":
+		*s = StrategyRebuild
+	case "hot_reload":
+		*s = StrategyHotReload
+	default:
+		return fmt.Errorf("unknown reload strategy %q (restart, rebuild or hot_reload)", text)
+	}
+	return nil
+}
+
 // Config represents live reload configuration
 type Config struct {
 	// Watch configuration
@@ -50,17 +76,26 @@ type Config struct {
 	BuildCommand string        `yaml:"build_command" json:"build_command"`
 	RunCommand   string        `yaml:"run_command" json:"run_command"`
 	BuildTimeout time.Duration `yaml:"build_timeout" json:"build_timeout"`
+
+	// RestartDelay is the first wait before restarting a crashed app; it
+	// doubles with each crash in a row up to MaxBackoff
 	RestartDelay time.Duration `yaml:"restart_delay" json:"restart_delay"`
+	MaxBackoff   time.Duration `yaml:"max_backoff" json:"max_backoff"`
 
 	// Hot reload configuration
 	EnableHotReload bool     `yaml:"enable_hot_reload" json:"enable_hot_reload"`
 	HotReloadPort   int      `yaml:"hot_reload_port" json:"hot_reload_port"`
 	HotReloadPaths  []string `yaml:"hot_reload_paths" json:"hot_reload_paths"`
 
-	// Debouncing
+	// Debouncing: a reload waits for DebounceDelay of quiet, but never
+	// more than MaxDebounce after the first change
 	DebounceDelay time.Duration `yaml:"debounce_delay" json:"debounce_delay"`
 	MaxDebounce   time.Duration `yaml:"max_debounce" json:"max_debounce"`
 
+	// StateFile is where status and statistics are persisted for
+	// `dolphin dev status`
+	StateFile string `yaml:"state_file" json:"state_file"`
+
 	// Logging
 	EnableLogging  bool `yaml:"enable_logging" json:"enable_logging"`
 	VerboseLogging bool `yaml:"verbose_logging" json:"verbose_logging"`
@@ -81,6 +116,8 @@ func DefaultConfig() *Config {
 			".git",
 			"node_modules",
 			"vendor",
+			"storage",
+			"bin",
 			"*.log",
 			"*.tmp",
 			".env",
@@ -99,17 +136,55 @@ func DefaultConfig() *Config {
 		RunCommand:      "./bin/app serve",
 		BuildTimeout:    30 * time.Second,
 		RestartDelay:    1 * time.Second,
-		EnableHotReload: false,
+		MaxBackoff:      30 * time.Second,
+		EnableHotReload: true,
 		HotReloadPort:   35729,
 		HotReloadPaths:  []string{"/"},
 		DebounceDelay:   500 * time.Millisecond,
 		MaxDebounce:     5 * time.Second,
+		StateFile:       DefaultStateFile,
 		EnableLogging:   true,
 		VerboseLogging:  false,
 	}
 }
 
-// LiveReloadManager manages live reload functionality
+// LoadConfig reads the livereload section of a YAML file over the defaults.
+// A missing file leaves the defaults.
+func LoadConfig(path string) (*Config, error) {
+	config := DefaultConfig()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	file := struct {
+		LiveReload *Config `yaml:"livereload"`
+	}{LiveReload: config}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// stableAfter is how long the app must run before a crash no longer counts
+// toward the backoff
+const stableAfter = 10 * time.Second
+
+// process is one run of the app
+type process struct {
+	cmd      *exec.Cmd
+	started  time.Time
+	exited   chan struct{}
+	err      error
+	stopping atomic.Bool
+}
+
+// LiveReloadManager supervises the app: it watches files, rebuilds and
+// restarts the app after changes, restarts it with backoff when it crashes,
+// refreshes connected browsers and persists its state
 type LiveReloadManager struct {
 	config *Config
 	logger *zap.Logger
@@ -120,9 +195,11 @@ type LiveReloadManager struct {
 	watchMu  sync.RWMutex
 
 	// Process management
-	process   *exec.Cmd
+	process   *process
 	processMu sync.RWMutex
 	isRunning bool
+	status    string
+	backoff   time.Duration
 
 	// Hot reload
 	hotReloadServer *HotReloadServer
@@ -130,12 +207,21 @@ type LiveReloadManager struct {
 
 	// Debouncing
 	debounceTimer *time.Timer
+	pendingSince  time.Time
+	pendingGo     bool
 	debounceMu    sync.Mutex
 
+	// reloads and restarts are handled one at a time by run; crashed
+	// receives processes that exited without being stopped
+	reloads  chan bool
+	restarts chan struct{}
+	crashed  chan *process
+
 	// Control
-	ctx    context.Context
-	cancel context.CancelFunc
-	done   chan struct{}
+	ctx       context.Context
+	cancel    context.CancelFunc
+	done      chan struct{}
+	startedAt time.Time
 
 	// Statistics
 	stats *Stats
@@ -146,6 +232,9 @@ func NewLiveReloadManager(config *Config, logger *zap.Logger) (*LiveReloadManage
 	if config == nil {
 		config = DefaultConfig()
 	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
 
 	// Create file watcher
 	watcher, err := fsnotify.NewWatcher()
@@ -160,6 +249,10 @@ func NewLiveReloadManager(config *Config, logger *zap.Logger) (*LiveReloadManage
 		logger:   logger,
 		watcher:  watcher,
 		watchMap: make(map[string]bool),
+		backoff:  config.RestartDelay,
+		reloads:  make(chan bool, 1),
+		restarts: make(chan struct{}, 1),
+		crashed:  make(chan *process, 1),
 		ctx:      ctx,
 		cancel:   cancel,
 		done:     make(chan struct{}),
@@ -178,8 +271,11 @@ func NewLiveReloadManager(config *Config, logger *zap.Logger) (*LiveReloadManage
 	return lrm, nil
 }
 
-// Start starts the live reload manager
+// Start watches for changes and builds and starts the app. A failing first
+// build doesn't stop the manager; it waits for a change that fixes it.
 func (lrm *LiveReloadManager) Start() error {
+	lrm.startedAt = time.Now()
+
 	// Start file watching
 	if err := lrm.startWatching(); err != nil {
 		return fmt.Errorf("failed to start file watching: %w", err)
@@ -192,46 +288,42 @@ func (lrm *LiveReloadManager) Start() error {
 		}
 	}
 
-	// Start the main process
-	if err := lrm.startProcess(); err != nil {
-		return fmt.Errorf("failed to start main process: %w", err)
-	}
-
-	// Start the main loop
-	go lrm.mainLoop()
-
-	if lrm.config.EnableLogging && lrm.logger != nil {
+	if lrm.config.EnableLogging {
 		lrm.logger.Info("Live reload manager started",
 			zap.String("strategy", lrm.config.Strategy.String()),
 			zap.Strings("watch_paths", lrm.config.WatchPaths),
+			zap.Int("watched_dirs", len(lrm.GetWatchedPaths())),
 			zap.Bool("hot_reload_enabled", lrm.config.EnableHotReload))
 	}
 
+	// The first reload builds and starts the app
+	lrm.reloads <- true
+	go lrm.mainLoop()
 	return nil
 }
 
-// Stop stops the live reload manager
+// Stop stops watching, stops the app and the hot reload server, and
+// records the manager as stopped
 func (lrm *LiveReloadManager) Stop() error {
-	// Cancel context
 	lrm.cancel()
+	lrm.watcher.Close()
+	if !lrm.startedAt.IsZero() {
+		<-lrm.done
+	}
 
-	// Stop file watcher
-	if lrm.watcher != nil {
-		lrm.watcher.Close()
+	lrm.debounceMu.Lock()
+	if lrm.debounceTimer != nil {
+		lrm.debounceTimer.Stop()
 	}
+	lrm.debounceMu.Unlock()
 
-	// Stop hot reload server
 	if lrm.hotReloadServer != nil {
 		lrm.hotReloadServer.Stop()
 	}
-
-	// Stop main process
 	lrm.stopProcess()
+	lrm.setStatus(StatusStopped)
 
-	// Wait for main loop to finish
-	<-lrm.done
-
-	if lrm.config.EnableLogging && lrm.logger != nil {
+	if lrm.config.EnableLogging {
 		lrm.logger.Info("Live reload manager stopped")
 	}
 
@@ -245,6 +337,9 @@ func (lrm *LiveReloadManager) startWatching() error {
 
 	// Add watch paths
 	for _, path := range lrm.config.WatchPaths {
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
 		if err := lrm.addWatchPath(path); err != nil {
 			return fmt.Errorf("failed to watch path %s: %w", path, err)
 		}
@@ -253,67 +348,56 @@ func (lrm *LiveReloadManager) startWatching() error {
 	return nil
 }
 
-// addWatchPath adds a path to watch
+// addWatchPath watches a directory and, recursively, the directories in it
 func (lrm *LiveReloadManager) addWatchPath(path string) error {
-	// Check if path should be ignored
-	if lrm.shouldIgnorePath(path) {
-		return nil
-	}
-
-	// Add to watcher
-	if err := lrm.watcher.Add(path); err != nil {
-		return err
-	}
-
-	// Add to watch map
-	lrm.watchMap[path] = true
-
-	// Recursively add subdirectories
-	return filepath.Walk(path, func(subPath string, info os.FileInfo, err error) error {
+	return filepath.WalkDir(path, func(subPath string, entry os.DirEntry, err error) error {
 		if err != nil {
-			return err
-		}
-
-		// Skip if should be ignored
-		if lrm.shouldIgnorePath(subPath) {
-			if info.IsDir() {
-				return filepath.SkipDir
+			if subPath == path {
+				return err
 			}
 			return nil
 		}
+		if !entry.IsDir() {
+			return nil
+		}
+		if subPath != path && lrm.shouldIgnorePath(subPath) {
+			return filepath.SkipDir
+		}
+		if lrm.watchMap[filepath.Clean(subPath)] {
+			return nil
+		}
 
-		// Add directory to watcher
-		if info.IsDir() && subPath != path {
-			if err := lrm.watcher.Add(subPath); err != nil {
-				// Log error but continue
-				if lrm.config.EnableLogging && lrm.logger != nil {
-					lrm.logger.Debug("Failed to watch directory",
-						zap.String("path", subPath),
-						zap.Error(err))
-				}
-			} else {
-				lrm.watchMap[subPath] = true
+		if err := lrm.watcher.Add(subPath); err != nil {
+			// Log error but continue
+			if lrm.config.EnableLogging {
+				lrm.logger.Debug("Failed to watch directory",
+					zap.String("path", subPath),
+					zap.Error(err))
 			}
+			return nil
 		}
-
+		lrm.watchMap[filepath.Clean(subPath)] = true
 		return nil
 	})
 }
 
-// shouldIgnorePath checks if a path should be ignored
+// shouldIgnorePath checks whether any element of path matches an ignore
+// pattern, e.g. ".git" or "*.log"
 func (lrm *LiveReloadManager) shouldIgnorePath(path string) bool {
-	// Check ignore paths
-	for _, ignorePath := range lrm.config.IgnorePaths {
-		if strings.Contains(path, ignorePath) {
-			return true
-		}
-	}
-
-	// Check file extensions
-	if !lrm.isWatchedFile(path) {
+	path = filepath.Clean(path)
+	if path == filepath.Clean(lrm.stateFile()) || path == filepath.Clean(lrm.stateFile()+".tmp") {
 		return true
 	}
-
+	for _, element := range strings.Split(filepath.ToSlash(path), "/") {
+		if element == "." {
+			continue
+		}
+		for _, pattern := range lrm.config.IgnorePaths {
+			if matched, _ := filepath.Match(pattern, element); matched {
+				return true
+			}
+		}
+	}
 	return false
 }
 
@@ -340,29 +424,47 @@ func (lrm *LiveReloadManager) startHotReloadServer() error {
 	return lrm.hotReloadServer.Start()
 }
 
-// startProcess starts the main process
+// startProcess starts the app. Under hot reload it is told the port, so
+// that it injects the live reload script into its pages.
 func (lrm *LiveReloadManager) startProcess() error {
 	lrm.processMu.Lock()
 	defer lrm.processMu.Unlock()
 
-	// Build the application
-	if err := lrm.buildProcess(); err != nil {
-		return fmt.Errorf("failed to build process: %w", err)
-	}
-
-	// Start the process
-	cmd := exec.CommandContext(lrm.ctx, "sh", "-c", lrm.config.RunCommand)
+	cmd := exec.Command("sh", "-c", lrm.config.RunCommand)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+	if lrm.hotReloadServer != nil {
+		cmd.Env = append(cmd.Env,
+			fmt.Sprintf("%s=%d", PortEnv, lrm.hotReloadServer.Port()),
+			PathsEnv+"="+strings.Join(lrm.config.HotReloadPaths, ","))
+	}
+	setProcessGroup(cmd)
 
 	if err := cmd.Start(); err != nil {
 		return fmt.Errorf("failed to start process: %w", err)
 	}
 
-	lrm.process = cmd
+	p := &process{cmd: cmd, started: time.Now(), exited: make(chan struct{})}
+	go func() {
+		p.err = cmd.Wait()
+		// Children left behind in the process group would hold on to
+		// the app's port
+		killProcess(cmd)
+		close(p.exited)
+		if !p.stopping.Load() {
+			select {
+			case lrm.crashed <- p:
+			case <-lrm.ctx.Done():
+			}
+		}
+	}()
+
+	lrm.process = p
 	lrm.isRunning = true
+	lrm.stats.RecordProcessStart()
 
-	if lrm.config.EnableLogging && lrm.logger != nil {
+	if lrm.config.EnableLogging {
 		lrm.logger.Info("Process started",
 			zap.Int("pid", cmd.Process.Pid),
 			zap.String("command", lrm.config.RunCommand))
@@ -376,62 +478,76 @@ func (lrm *LiveReloadManager) buildProcess() error {
 	ctx, cancel := context.WithTimeout(lrm.ctx, lrm.config.BuildTimeout)
 	defer cancel()
 
+	start := time.Now()
 	cmd := exec.CommandContext(ctx, "sh", "-c", lrm.config.BuildCommand)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Run(); err != nil {
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		os.Stderr.Write(output)
+		if message := strings.TrimSpace(string(output)); message != "" {
+			err = fmt.Errorf("%w\n%s", err, message)
+		}
 		return fmt.Errorf("build failed: %w", err)
 	}
+	os.Stdout.Write(output)
 
-	if lrm.config.EnableLogging && lrm.logger != nil {
+	if lrm.config.EnableLogging {
 		lrm.logger.Info("Build completed",
-			zap.String("command", lrm.config.BuildCommand))
+			zap.String("command", lrm.config.BuildCommand),
+			zap.Duration("duration", time.Since(start)))
 	}
 
 	return nil
 }
 
-// stopProcess stops the main process
+// stopProcess interrupts the app and kills it if it hasn't exited after 5s
 func (lrm *LiveReloadManager) stopProcess() {
 	lrm.processMu.Lock()
 	defer lrm.processMu.Unlock()
 
-	if lrm.process != nil && lrm.isRunning {
-		// Send SIGTERM
-		if err := lrm.process.Process.Signal(os.Interrupt); err != nil {
-			if lrm.config.EnableLogging && lrm.logger != nil {
-				lrm.logger.Warn("Failed to send interrupt signal",
-					zap.Error(err))
-			}
-		}
+	p := lrm.process
+	if p == nil {
+		return
+	}
+	lrm.process = nil
+	lrm.isRunning = false
 
-		// Wait for process to exit
-		done := make(chan error, 1)
-		go func() {
-			done <- lrm.process.Wait()
-		}()
+	p.stopping.Store(true)
+	defer lrm.stats.RecordProcessStop()
+	select {
+	case <-p.exited:
+		return
+	default:
+	}
 
-		select {
-		case <-time.After(5 * time.Second):
-			// Force kill if it doesn't exit
-			lrm.process.Process.Kill()
-			if lrm.config.EnableLogging && lrm.logger != nil {
-				lrm.logger.Warn("Process force killed")
-			}
-		case <-done:
-			// Process exited normally
+	if err := interruptProcess(p.cmd); err != nil && lrm.config.EnableLogging {
+		lrm.logger.Warn("Failed to send interrupt signal", zap.Error(err))
+	}
+	select {
+	case <-p.exited:
+	case <-time.After(5 * time.Second):
+		// Force kill if it doesn't exit
+		killProcess(p.cmd)
+		<-p.exited
+		if lrm.config.EnableLogging {
+			lrm.logger.Warn("Process force killed")
 		}
-
-		lrm.isRunning = false
-		lrm.process = nil
 	}
 }
 
-// mainLoop is the main event loop
+// mainLoop handles file events, reloads, restarts and crashes until the
+// manager is stopped; doing them all here keeps builds from overlapping
 func (lrm *LiveReloadManager) mainLoop() {
 	defer close(lrm.done)
 
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+	var restartTimer *time.Timer
+	defer func() {
+		if restartTimer != nil {
+			restartTimer.Stop()
+		}
+	}()
+
 	for {
 		select {
 		case <-lrm.ctx.Done():
@@ -445,27 +561,55 @@ func (lrm *LiveReloadManager) mainLoop() {
 			if !ok {
 				return
 			}
-			if lrm.config.EnableLogging && lrm.logger != nil {
+			if lrm.config.EnableLogging {
 				lrm.logger.Error("File watcher error", zap.Error(err))
 			}
+		case rebuild := <-lrm.reloads:
+			if restartTimer != nil {
+				restartTimer.Stop()
+			}
+			lrm.backoff = lrm.config.RestartDelay
+			lrm.performReload(rebuild)
+		case <-lrm.restarts:
+			lrm.restart()
+		case p := <-lrm.crashed:
+			if delay, ok := lrm.handleCrash(p); ok {
+				restartTimer = time.AfterFunc(delay, func() {
+					select {
+					case lrm.restarts <- struct{}{}:
+					default:
+					}
+				})
+			}
+		case <-ticker.C:
+			lrm.saveState()
 		}
 	}
 }
 
 // handleFileEvent handles file system events
 func (lrm *LiveReloadManager) handleFileEvent(event fsnotify.Event) {
-	// Check if file should be watched
-	if !lrm.isWatchedFile(event.Name) {
+	if lrm.shouldIgnorePath(event.Name) {
 		return
 	}
 
-	// Check if path should be ignored
-	if lrm.shouldIgnorePath(event.Name) {
+	// Watch directories created after start
+	if event.Has(fsnotify.Create) {
+		if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+			lrm.watchMu.Lock()
+			lrm.addWatchPath(event.Name)
+			lrm.watchMu.Unlock()
+			return
+		}
+	}
+
+	// Check if file should be watched
+	if !lrm.isWatchedFile(event.Name) || event.Op == fsnotify.Chmod {
 		return
 	}
 
 	// Log file change
-	if lrm.config.VerboseLogging && lrm.logger != nil {
+	if lrm.config.VerboseLogging {
 		lrm.logger.Debug("File changed",
 			zap.String("file", event.Name),
 			zap.String("op", event.Op.String()))
@@ -475,82 +619,215 @@ func (lrm *LiveReloadManager) handleFileEvent(event fsnotify.Event) {
 	lrm.stats.RecordFileChange(event.Name, event.Op)
 
 	// Trigger reload with debouncing
-	lrm.triggerReload()
+	lrm.triggerReload(filepath.Ext(event.Name) == ".go")
 }
 
-// triggerReload triggers a reload with debouncing
-func (lrm *LiveReloadManager) triggerReload() {
+// triggerReload schedules a reload once changes have been quiet for
+// DebounceDelay, or MaxDebounce after the first change at the latest
+func (lrm *LiveReloadManager) triggerReload(goChanged bool) {
 	lrm.debounceMu.Lock()
 	defer lrm.debounceMu.Unlock()
 
+	now := time.Now()
+	if lrm.debounceTimer == nil || lrm.pendingSince.IsZero() {
+		lrm.pendingSince = now
+	}
+	lrm.pendingGo = lrm.pendingGo || goChanged
+
+	delay := lrm.config.DebounceDelay
+	if lrm.config.MaxDebounce > 0 {
+		if remaining := lrm.pendingSince.Add(lrm.config.MaxDebounce).Sub(now); remaining < delay {
+			delay = max(remaining, 0)
+		}
+	}
+
 	// Cancel existing timer
 	if lrm.debounceTimer != nil {
 		lrm.debounceTimer.Stop()
 	}
+	lrm.debounceTimer = time.AfterFunc(delay, func() {
+		lrm.debounceMu.Lock()
+		rebuild := lrm.pendingGo || lrm.config.Strategy == StrategyRebuild
+		lrm.pendingGo = false
+		lrm.pendingSince = time.Time{}
+		lrm.debounceMu.Unlock()
 
-	// Create new timer
-	lrm.debounceTimer = time.AfterFunc(lrm.config.DebounceDelay, func() {
-		lrm.performReload()
+		select {
+		case lrm.reloads <- rebuild:
+		default:
+			// A reload is already queued; make sure it rebuilds if needed
+			if rebuild {
+				select {
+				case <-lrm.reloads:
+				default:
+				}
+				select {
+				case lrm.reloads <- true:
+				default:
+				}
+			}
+		}
 	})
 }
 
-// performReload performs the actual reload
-func (lrm *LiveReloadManager) performReload() {
-	if lrm.config.EnableLogging && lrm.logger != nil {
-		lrm.logger.Info("Performing reload",
-			zap.String("strategy", lrm.config.Strategy.String()))
+// performReload rebuilds if needed and restarts the app, then refreshes the
+// browsers. A failed build leaves the running app alone.
+func (lrm *LiveReloadManager) performReload(rebuild bool) {
+	start := time.Now()
+	first := lrm.stats.Snapshot().ProcessStarts == 0 && lrm.currentProcess() == nil
+	if !first {
+		lrm.stats.RecordReload()
 	}
 
-	// Update statistics
-	lrm.stats.RecordReload()
-
-	switch lrm.config.Strategy {
-	case StrategyRestart:
-		lrm.performRestart()
-	case StrategyRebuild:
-		lrm.performRebuild()
-	case StrategyHotReload:
-		lrm.performHotReload()
+	if lrm.config.Strategy == StrategyHotReload && !first {
+		lrm.notifyBrowsers()
+		lrm.stats.RecordReloadDuration(time.Since(start))
+		return
 	}
-}
 
-// performRestart performs a restart
-func (lrm *LiveReloadManager) performRestart() {
-	// Stop current process
-	lrm.stopProcess()
+	if lrm.config.EnableLogging && !first {
+		lrm.logger.Info("Performing reload",
+			zap.String("strategy", lrm.config.Strategy.String()),
+			zap.Bool("rebuild", rebuild))
+	}
 
-	// Wait for restart delay
-	time.Sleep(lrm.config.RestartDelay)
+	if rebuild || first {
+		lrm.setStatus(StatusBuilding)
+		if err := lrm.buildProcess(); err != nil {
+			lrm.stats.RecordBuildFailure(err)
+			if lrm.currentProcess() != nil {
+				lrm.setStatus(StatusRunning)
+			} else {
+				lrm.setStatus(StatusBuildFailed)
+			}
+			if lrm.config.EnableLogging {
+				lrm.logger.Error("Build failed; waiting for changes", zap.Error(err))
+			}
+			return
+		}
+	}
 
-	// Start new process
+	lrm.stopProcess()
 	if err := lrm.startProcess(); err != nil {
-		if lrm.config.EnableLogging && lrm.logger != nil {
+		lrm.setStatus(StatusCrashed)
+		if lrm.config.EnableLogging {
 			lrm.logger.Error("Failed to restart process", zap.Error(err))
 		}
+		return
+	}
+	lrm.setStatus(StatusRunning)
+	lrm.stats.RecordReloadDuration(time.Since(start))
+	if !first {
+		lrm.notifyBrowsers()
 	}
 }
 
-// performRebuild performs a rebuild
-func (lrm *LiveReloadManager) performRebuild() {
-	// Build the application
-	if err := lrm.buildProcess(); err != nil {
-		if lrm.config.EnableLogging && lrm.logger != nil {
-			lrm.logger.Error("Failed to rebuild process", zap.Error(err))
+// handleCrash records an app that exited on its own and returns how long
+// to wait before restarting it
+func (lrm *LiveReloadManager) handleCrash(p *process) (time.Duration, bool) {
+	lrm.processMu.Lock()
+	current := lrm.process == p
+	if current {
+		lrm.process = nil
+		lrm.isRunning = false
+	}
+	lrm.processMu.Unlock()
+	if !current {
+		return 0, false
+	}
+
+	lrm.stats.RecordCrash()
+	lrm.stats.RecordProcessStop()
+	lrm.setStatus(StatusCrashed)
+
+	if time.Since(p.started) >= stableAfter || lrm.backoff <= 0 {
+		lrm.backoff = lrm.config.RestartDelay
+	}
+	delay := lrm.backoff
+	lrm.backoff = min(max(lrm.backoff*2, time.Millisecond), max(lrm.config.MaxBackoff, lrm.config.RestartDelay))
+
+	if lrm.config.EnableLogging {
+		lrm.logger.Warn("Process exited; restarting",
+			zap.Error(p.err),
+			zap.Duration("after", delay))
+	}
+	return delay, true
+}
+
+// restart starts the app again after a crash, without rebuilding
+func (lrm *LiveReloadManager) restart() {
+	if lrm.currentProcess() != nil {
+		return
+	}
+	if err := lrm.startProcess(); err != nil {
+		if lrm.config.EnableLogging {
+			lrm.logger.Error("Failed to restart process", zap.Error(err))
 		}
 		return
 	}
-
-	// Restart the process
-	lrm.performRestart()
+	lrm.setStatus(StatusRunning)
 }
 
-// performHotReload performs hot reload
-func (lrm *LiveReloadManager) performHotReload() {
+// notifyBrowsers asks connected browsers to reload
+func (lrm *LiveReloadManager) notifyBrowsers() {
 	lrm.hotReloadMu.RLock()
 	defer lrm.hotReloadMu.RUnlock()
 
 	if lrm.hotReloadServer != nil {
 		lrm.hotReloadServer.NotifyReload()
+		lrm.stats.RecordHotReload()
+	}
+}
+
+func (lrm *LiveReloadManager) currentProcess() *process {
+	lrm.processMu.RLock()
+	defer lrm.processMu.RUnlock()
+	return lrm.process
+}
+
+func (lrm *LiveReloadManager) setStatus(status string) {
+	lrm.processMu.Lock()
+	lrm.status = status
+	lrm.processMu.Unlock()
+	lrm.saveState()
+}
+
+func (lrm *LiveReloadManager) stateFile() string {
+	if lrm.config.StateFile == "" {
+		return DefaultStateFile
+	}
+	return lrm.config.StateFile
+}
+
+// State returns a snapshot of the manager, as persisted to its state file
+func (lrm *LiveReloadManager) State() State {
+	lrm.processMu.RLock()
+	state := State{
+		PID:         os.Getpid(),
+		Status:      lrm.status,
+		StartedAt:   lrm.startedAt,
+		UpdatedAt:   time.Now(),
+		Strategy:    lrm.config.Strategy.String(),
+		WatchedDirs: len(lrm.GetWatchedPaths()),
+		HotReload:   lrm.hotReloadServer != nil,
+		Stats:       lrm.stats.Snapshot(),
+	}
+	if lrm.process != nil {
+		state.AppPID = lrm.process.cmd.Process.Pid
+	}
+	lrm.processMu.RUnlock()
+
+	if lrm.hotReloadServer != nil {
+		state.Port = lrm.hotReloadServer.Port()
+		state.Connections = lrm.hotReloadServer.GetConnectionCount()
+	}
+	return state
+}
+
+// saveState persists the state; failures are logged, not fatal
+func (lrm *LiveReloadManager) saveState() {
+	if err := writeState(lrm.stateFile(), lrm.State()); err != nil && lrm.config.EnableLogging {
+		lrm.logger.Warn("Failed to save live reload state", zap.Error(err))
 	}
 }
 
@@ -0,0 +1,141 @@
+//go:build !windows
+
+package livereload
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testConfig supervises a shell "app" that logs its builds and runs in dir
+func testConfig(t *testing.T, run string) (*Config, string) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	require.NoError(t, os.Mkdir(src, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "main.go"), []byte("package main\n"), 0644))
+
+	config := DefaultConfig()
+	config.WatchPaths = []string{src}
+	config.BuildCommand = "echo build >> " + filepath.Join(dir, "builds")
+	config.RunCommand = run
+	config.RestartDelay = 20 * time.Millisecond
+	config.MaxBackoff = 80 * time.Millisecond
+	config.DebounceDelay = 20 * time.Millisecond
+	config.EnableHotReload = false
+	config.EnableLogging = false
+	config.StateFile = filepath.Join(dir, "state.json")
+	return config, dir
+}
+
+func lines(t *testing.T, path string) int {
+	data, _ := os.ReadFile(path)
+	return strings.Count(string(data), "\n")
+}
+
+func TestManagerRebuildsOnChangeAndPersistsState(t *testing.T) {
+	config, dir := testConfig(t, "")
+	config.RunCommand = "echo $" + PortEnv + " >> " + filepath.Join(dir, "runs") + "; exec sleep 30"
+	config.EnableHotReload = true
+	config.HotReloadPort = 0
+	manager, err := NewLiveReloadManager(config, nil)
+	require.NoError(t, err)
+	require.NoError(t, manager.Start())
+
+	require.Eventually(t, func() bool { return lines(t, filepath.Join(dir, "runs")) == 1 }, 5*time.Second, 10*time.Millisecond)
+	data, _ := os.ReadFile(filepath.Join(dir, "runs"))
+	assert.Equal(t, strconv.Itoa(manager.hotReloadServer.Port())+"\n", string(data), "the app is told the hot reload port")
+	assert.True(t, manager.IsRunning())
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "src", "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644))
+	require.Eventually(t, func() bool { return lines(t, filepath.Join(dir, "runs")) == 2 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 2, lines(t, filepath.Join(dir, "builds")))
+
+	state, err := ReadState(config.StateFile)
+	require.NoError(t, err)
+	assert.True(t, state.Alive())
+	assert.Equal(t, StatusRunning, state.Status)
+	assert.NotZero(t, state.AppPID)
+	assert.Equal(t, manager.hotReloadServer.Port(), state.Port)
+
+	require.NoError(t, manager.Stop())
+	state, err = ReadState(config.StateFile)
+	require.NoError(t, err)
+	assert.Equal(t, StatusStopped, state.Status)
+	assert.False(t, state.Alive())
+	assert.Equal(t, int64(1), state.Stats.Reloads)
+	assert.Equal(t, int64(2), state.Stats.ProcessStarts)
+	assert.Equal(t, int64(2), state.Stats.ProcessStops)
+	assert.Zero(t, state.Stats.Crashes)
+}
+
+func TestManagerRestartsCrashedAppWithBackoff(t *testing.T) {
+	config, dir := testConfig(t, "")
+	config.RunCommand = "echo run >> " + filepath.Join(dir, "runs") + "; exit 1"
+	manager, err := NewLiveReloadManager(config, nil)
+	require.NoError(t, err)
+	require.NoError(t, manager.Start())
+
+	require.Eventually(t, func() bool { return lines(t, filepath.Join(dir, "runs")) >= 4 }, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, manager.Stop())
+	assert.Equal(t, 1, lines(t, filepath.Join(dir, "builds")), "crashes restart without rebuilding")
+	assert.GreaterOrEqual(t, manager.GetStats().Snapshot().Crashes, int64(3))
+	assert.Equal(t, config.MaxBackoff, manager.backoff)
+}
+
+func TestManagerKeepsAppWhenBuildFails(t *testing.T) {
+	config, dir := testConfig(t, "exec sleep 30")
+	manager, err := NewLiveReloadManager(config, nil)
+	require.NoError(t, err)
+	require.NoError(t, manager.Start())
+	defer manager.Stop()
+	require.Eventually(t, manager.IsRunning, 5*time.Second, 10*time.Millisecond)
+	pid := manager.State().AppPID
+
+	manager.config.BuildCommand = "echo 'main.go:3: syntax error' >&2; exit 2"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "src", "main.go"), []byte("package main\n\nfunc {\n"), 0644))
+	require.Eventually(t, func() bool { return manager.GetStats().Snapshot().BuildFailures == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	state := manager.State()
+	assert.Equal(t, StatusRunning, state.Status)
+	assert.Equal(t, pid, state.AppPID, "the old app keeps running")
+	assert.Contains(t, state.Stats.LastBuildError, "main.go:3: syntax error")
+}
+
+func TestShouldIgnorePath(t *testing.T) {
+	manager := &LiveReloadManager{config: DefaultConfig()}
+
+	assert.True(t, manager.shouldIgnorePath(".git/HEAD"))
+	assert.True(t, manager.shouldIgnorePath("node_modules"))
+	assert.True(t, manager.shouldIgnorePath("storage/logs/app.log"))
+	assert.True(t, manager.shouldIgnorePath("internal/debug.log"))
+	assert.False(t, manager.shouldIgnorePath(".github/workflows/ci.yml"))
+	assert.False(t, manager.shouldIgnorePath("internal/vendors/client.go"))
+	assert.False(t, manager.shouldIgnorePath("."))
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "livereload.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("livereload:\n  strategy: rebuild\n  run_command: ./bin/app serve --port 9000\n  debounce_delay: 1s\n"), 0644))
+
+	config, err := LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, StrategyRebuild, config.Strategy)
+	assert.Equal(t, "./bin/app serve --port 9000", config.RunCommand)
+	assert.Equal(t, time.Second, config.DebounceDelay)
+	assert.Equal(t, DefaultConfig().BuildCommand, config.BuildCommand, "unset keys keep their defaults")
+
+	config, err = LoadConfig(filepath.Join(t.TempDir(), "missing.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, DefaultConfig(), config)
+
+	require.NoError(t, os.WriteFile(path, []byte("livereload:\n  strategy: fast\n"), 0644))
+	_, err = LoadConfig(path)
+	assert.ErrorContains(t, err, `unknown reload strategy "fast"`)
+}
@@ -0,0 +1,31 @@
+//go:build windows
+
+package livereload
+
+import (
+	"os"
+	"os/exec"
+)
+
+// setProcessGroup is a no-op; Windows has no process groups to signal
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// interruptProcess kills cmd; Windows can't deliver SIGTERM
+func interruptProcess(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
+
+// killProcess kills cmd
+func killProcess(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
+
+// processAlive reports whether a process with pid exists
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
@@ -3,6 +3,7 @@ package livereload
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"sync"
 	"time"
@@ -22,7 +23,8 @@ type HotReloadServer struct {
 	connMu      sync.RWMutex
 
 	// HTTP server
-	server *http.Server
+	server   *http.Server
+	listener net.Listener
 
 	// Control
 	ctx    context.Context
@@ -59,16 +61,22 @@ func (hrs *HotReloadServer) Start() error {
 	// Health check endpoint
 	mux.HandleFunc("/health", hrs.handleHealth)
 
-	hrs.server = &http.Server{
-		Addr:    fmt.Sprintf(":%d", hrs.port),
-		Handler: mux,
+	// Listen before returning so a port in use is reported to the caller;
+	// port 0 picks a free one
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", hrs.port))
+	if err != nil {
+		return err
 	}
+	hrs.listener = listener
+	hrs.port = listener.Addr().(*net.TCPAddr).Port
+
+	hrs.server = &http.Server{Handler: mux}
 
 	// Start server in goroutine
 	go func() {
 		defer close(hrs.done)
 
-		if err := hrs.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := hrs.server.Serve(listener); err != nil && err != http.ErrServerClosed {
 			if hrs.logger != nil {
 				hrs.logger.Error("Hot reload server error", zap.Error(err))
 			}
@@ -108,7 +116,9 @@ func (hrs *HotReloadServer) Stop() error {
 	}
 
 	// Wait for server to stop
-	<-hrs.done
+	if hrs.listener != nil {
+		<-hrs.done
+	}
 
 	if hrs.logger != nil {
 		hrs.logger.Info("Hot reload server stopped")
@@ -134,6 +144,9 @@ func (hrs *HotReloadServer) handleWebSocket(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	// Greet before registering, so NotifyReload never writes concurrently
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"command":"hello"}`))
+
 	// Add connection
 	hrs.connMu.Lock()
 	hrs.connections[conn] = true
@@ -158,9 +171,6 @@ func (hrs *HotReloadServer) handleConnection(conn *websocket.Conn) {
 		conn.Close()
 	}()
 
-	// Send initial message
-	conn.WriteMessage(websocket.TextMessage, []byte(`{"command":"hello"}`))
-
 	// Keep connection alive
 	for {
 		select {
@@ -188,38 +198,39 @@ func (hrs *HotReloadServer) handleScript(w http.ResponseWriter, r *http.Request)
 	w.Write(script)
 }
 
-// generateScript generates the livereload script
+// generateScript generates the livereload script. It connects back to the
+// host it was loaded from, reconnects when the supervisor restarts, and on
+// reload waits for the app to answer again before refreshing the page.
 func (hrs *HotReloadServer) generateScript() []byte {
-	script := fmt.Sprintf(`
-(function() {
-  var script = document.createElement('script');
-  script.src = 'http://localhost:%d/livereload.js';
-  script.async = true;
-  document.head.appendChild(script);
-  
-  var ws = new WebSocket('ws://localhost:%d/livereload');
-  
-  ws.onopen = function() {
-    console.log('Live reload connected');
-  };
-  
-  ws.onmessage = function(event) {
-    var data = JSON.parse(event.data);
-    if (data.command === 'reload') {
-      console.log('Live reload triggered');
-      window.location.reload();
-    }
-  };
-  
-  ws.onclose = function() {
-    console.log('Live reload disconnected');
-  };
-  
-  ws.onerror = function(error) {
-    console.error('Live reload error:', error);
-  };
+	script := fmt.Sprintf(`(function() {
+  if (window.__dolphinLiveReload) return;
+  window.__dolphinLiveReload = true;
+
+  var current = document.currentScript;
+  var host = current ? new URL(current.src).hostname : location.hostname;
+  var url = 'ws://' + host + ':%d/livereload';
+
+  function whenReady(fn, attempts) {
+    fetch(location.href, { method: 'HEAD', cache: 'no-store' })
+      .then(function(res) { if (res.status < 500) fn(); else throw res; })
+      .catch(function() { if (attempts > 0) setTimeout(function() { whenReady(fn, attempts - 1); }, 250); });
+  }
+
+  function connect() {
+    var ws = new WebSocket(url);
+    ws.onopen = function() { console.log('[dolphin] live reload connected'); };
+    ws.onmessage = function(event) {
+      var data = JSON.parse(event.data);
+      if (data.command === 'reload') {
+        console.log('[dolphin] reloading');
+        whenReady(function() { location.reload(); }, 120);
+      }
+    };
+    ws.onclose = function() { setTimeout(connect, 1000); };
+  }
+  connect();
 })();
-`, hrs.port, hrs.port)
+`, hrs.port)
 
 	return []byte(script)
 }
@@ -243,8 +254,8 @@ func (hrs *HotReloadServer) handleHealth(w http.ResponseWriter, r *http.Request)
 
 // NotifyReload notifies all connected clients to reload
 func (hrs *HotReloadServer) NotifyReload() {
-	hrs.connMu.RLock()
-	defer hrs.connMu.RUnlock()
+	hrs.connMu.Lock()
+	defer hrs.connMu.Unlock()
 
 	message := []byte(`{"command":"reload"}`)
 
@@ -265,6 +276,11 @@ func (hrs *HotReloadServer) NotifyReload() {
 	}
 }
 
+// Port returns the port the server listens on
+func (hrs *HotReloadServer) Port() int {
+	return hrs.port
+}
+
 // GetConnectionCount returns the number of active connections
 func (hrs *HotReloadServer) GetConnectionCount() int {
 	hrs.connMu.RLock()
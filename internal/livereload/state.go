@@ -0,0 +1,137 @@
+package livereload
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultStateFile is where a running supervisor persists its state for
+// `dolphin dev status` and `dolphin dev stats`
+const DefaultStateFile = "storage/framework/livereload.json"
+
+// Supervisor and app states reported in State.Status
+const (
+	StatusBuilding    = "building"
+	StatusRunning     = "running"
+	StatusBuildFailed = "build_failed"
+	StatusCrashed     = "crashed"
+	StatusStopped     = "stopped"
+)
+
+// State is a snapshot of a supervisor, written to its state file as it runs
+type State struct {
+	PID         int       `json:"pid"`
+	AppPID      int       `json:"app_pid,omitempty"`
+	Status      string    `json:"status"`
+	StartedAt   time.Time `json:"started_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Strategy    string    `json:"strategy"`
+	WatchedDirs int       `json:"watched_dirs"`
+	HotReload   bool      `json:"hot_reload"`
+	Port        int       `json:"port,omitempty"`
+	Connections int       `json:"connections"`
+	Stats       Snapshot  `json:"stats"`
+}
+
+// Snapshot is a copy of Stats that can be persisted and read back
+type Snapshot struct {
+	FileChanges       int64            `json:"file_changes"`
+	MostChangedFiles  []FileChangeInfo `json:"most_changed_files"`
+	ChangeTypes       map[string]int64 `json:"change_types"`
+	Reloads           int64            `json:"reloads"`
+	LastReload        time.Time        `json:"last_reload"`
+	ReloadDuration    time.Duration    `json:"reload_duration"`
+	AverageReloadTime time.Duration    `json:"average_reload_time"`
+	ProcessStarts     int64            `json:"process_starts"`
+	ProcessStops      int64            `json:"process_stops"`
+	LastStart         time.Time        `json:"last_start"`
+	LastStop          time.Time        `json:"last_stop"`
+	Crashes           int64            `json:"crashes"`
+	LastCrash         time.Time        `json:"last_crash"`
+	BuildFailures     int64            `json:"build_failures"`
+	LastBuildError    string           `json:"last_build_error,omitempty"`
+	HotReloads        int64            `json:"hot_reloads"`
+	LastHotReload     time.Time        `json:"last_hot_reload"`
+	StartTime         time.Time        `json:"start_time"`
+	FileChangesPerMin float64          `json:"file_changes_per_min"`
+	ReloadsPerMin     float64          `json:"reloads_per_min"`
+}
+
+// Snapshot copies the statistics, keeping the ten most changed files
+func (s *Stats) Snapshot() Snapshot {
+	files := s.GetMostChangedFiles(10)
+	types := s.GetChangeTypeStats()
+	fileRate, reloadRate := s.GetFileChangeRate(), s.GetReloadRate()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	snapshot := Snapshot{
+		FileChanges:       s.FileChanges,
+		MostChangedFiles:  files,
+		ChangeTypes:       types,
+		Reloads:           s.Reloads,
+		LastReload:        s.LastReload,
+		ReloadDuration:    s.ReloadDuration,
+		ProcessStarts:     s.ProcessStarts,
+		ProcessStops:      s.ProcessStops,
+		LastStart:         s.LastStart,
+		LastStop:          s.LastStop,
+		Crashes:           s.Crashes,
+		LastCrash:         s.LastCrash,
+		BuildFailures:     s.BuildFailures,
+		LastBuildError:    s.LastBuildError,
+		HotReloads:        s.HotReloads,
+		LastHotReload:     s.LastHotReload,
+		StartTime:         s.StartTime,
+		FileChangesPerMin: fileRate,
+		ReloadsPerMin:     reloadRate,
+	}
+	if s.timedReloads > 0 {
+		snapshot.AverageReloadTime = s.TotalReloadDuration / time.Duration(s.timedReloads)
+	}
+	return snapshot
+}
+
+// ReadState reads the state a supervisor persisted
+func ReadState(path string) (*State, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// Alive reports whether the supervisor that wrote the state is still running
+func (s *State) Alive() bool {
+	return s.Status != StatusStopped && s.PID > 0 && processAlive(s.PID)
+}
+
+// Uptime is how long the supervisor has been running, or ran
+func (s *State) Uptime() time.Duration {
+	if s.Alive() {
+		return time.Since(s.StartedAt)
+	}
+	return s.UpdatedAt.Sub(s.StartedAt)
+}
+
+// writeState replaces path atomically so readers never see a partial file
+func writeState(path string, state State) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -18,12 +18,20 @@ type Stats struct {
 	Reloads        int64     `json:"reloads"`
 	LastReload     time.Time `json:"last_reload"`
 	ReloadDuration time.Duration `json:"reload_duration"`
+	TotalReloadDuration time.Duration `json:"total_reload_duration"`
+	timedReloads   int64
 	
 	// Process
 	ProcessStarts  int64     `json:"process_starts"`
 	ProcessStops   int64     `json:"process_stops"`
 	LastStart      time.Time `json:"last_start"`
 	LastStop       time.Time `json:"last_stop"`
+	Crashes        int64     `json:"crashes"`
+	LastCrash      time.Time `json:"last_crash"`
+	
+	// Builds
+	BuildFailures  int64     `json:"build_failures"`
+	LastBuildError string    `json:"last_build_error"`
 	
 	// Hot reload
 	HotReloads     int64     `json:"hot_reloads"`
@@ -83,6 +91,24 @@ func (s *Stats) RecordProcessStop() {
 	s.LastStop = time.Now()
 }
 
+// RecordCrash records the process exiting without being stopped
+func (s *Stats) RecordCrash() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	
+	s.Crashes++
+	s.LastCrash = time.Now()
+}
+
+// RecordBuildFailure records a failed build and its output
+func (s *Stats) RecordBuildFailure(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	
+	s.BuildFailures++
+	s.LastBuildError = err.Error()
+}
+
 // RecordHotReload records a hot reload
 func (s *Stats) RecordHotReload() {
 	s.mu.Lock()
@@ -98,6 +124,9 @@ func (s *Stats) RecordReloadDuration(duration time.Duration) {
 	defer s.mu.Unlock()
 	
 	s.ReloadDuration = duration
+	s.TotalReloadDuration += duration
+	s.timedReloads++
+	s.LastBuildError = ""
 }
 
 // GetStats returns current statistics
@@ -207,10 +236,16 @@ func (s *Stats) Reset() {
 	s.Reloads = 0
 	s.LastReload = time.Time{}
 	s.ReloadDuration = 0
+	s.TotalReloadDuration = 0
+	s.timedReloads = 0
 	s.ProcessStarts = 0
 	s.ProcessStops = 0
 	s.LastStart = time.Time{}
 	s.LastStop = time.Time{}
+	s.Crashes = 0
+	s.LastCrash = time.Time{}
+	s.BuildFailures = 0
+	s.LastBuildError = ""
 	s.HotReloads = 0
 	s.LastHotReload = time.Time{}
 	s.StartTime = time.Now()
@@ -0,0 +1,315 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/routing"
+)
+
+// RequestIDHeader carries the request ID in from callers and back out in
+// responses. X-Correlation-ID is accepted on the way in too.
+const RequestIDHeader = "X-Request-ID"
+
+const (
+	correlationIDHeader = "X-Correlation-ID"
+	redacted            = "[REDACTED]"
+	maxRequestIDLength  = 128
+)
+
+// AccessLogger logs one entry per request through a zap logger
+type AccessLogger struct {
+	logger *zap.Logger
+	config config.AccessLogConfig
+
+	headers       []string
+	redactHeaders map[string]bool
+	redactParams  map[string]bool
+	routes        []routeLevel
+	sampler       *sampler
+}
+
+// routeLevel is a per-route level override; off drops the entries
+type routeLevel struct {
+	route string
+	level zapcore.Level
+	off   bool
+}
+
+// NewAccessLogger creates an access logger, rejecting unknown levels in
+// the route overrides
+func NewAccessLogger(logger *zap.Logger, cfg config.AccessLogConfig) (*AccessLogger, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	a := &AccessLogger{
+		logger:        logger,
+		config:        cfg,
+		redactHeaders: lowerSet(cfg.RedactHeaders),
+		redactParams:  lowerSet(cfg.RedactParams),
+		sampler:       newSampler(cfg.SampleThreshold, cfg.SampleEvery),
+	}
+	for _, header := range cfg.Headers {
+		a.headers = append(a.headers, http.CanonicalHeaderKey(header))
+	}
+
+	for route, name := range cfg.Routes {
+		rl := routeLevel{route: strings.ToLower(route)}
+		if strings.EqualFold(name, "off") {
+			rl.off = true
+		} else {
+			level, err := zapcore.ParseLevel(name)
+			if err != nil {
+				return nil, fmt.Errorf("access log level for %s: %w", route, err)
+			}
+			rl.level = level
+		}
+		a.routes = append(a.routes, rl)
+	}
+	// Longest first, so the most specific prefix wins
+	sort.Slice(a.routes, func(i, j int) bool { return len(a.routes[i].route) > len(a.routes[j].route) })
+
+	return a, nil
+}
+
+// Handler is the middleware. It gives every request an ID, echoed in
+// X-Request-ID, and a logger tagged with it for FromContext, then logs the
+// request once it is served.
+func (a *AccessLogger) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := requestID(r)
+		ctx := contextWithRequestID(r.Context(), id)
+		w.Header().Set(RequestIDHeader, id)
+
+		fields := []zap.Field{zap.String("request_id", id)}
+		if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+			fields = append(fields, zap.String("trace_id", sc.TraceID().String()))
+		}
+		ctx = WithContext(ctx, a.logger.With(fields...))
+		slowThreshold := a.config.SlowThreshold
+		ctx = context.WithValue(ctx, slowThresholdKey{}, &slowThreshold)
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		if a.config.Enabled {
+			a.log(r, ww, time.Since(start), slowThreshold, fields)
+		}
+	})
+}
+
+func (a *AccessLogger) log(r *http.Request, ww middleware.WrapResponseWriter, duration, slowThreshold time.Duration, fields []zap.Field) {
+	status := ww.Status()
+	if status == 0 {
+		status = http.StatusOK
+	}
+	route := routing.Pattern(r)
+	slow := slowThreshold > 0 && duration >= slowThreshold
+
+	level := zapcore.InfoLevel
+	switch {
+	case status >= 500:
+		level = zapcore.ErrorLevel
+	case status >= 400, slow:
+		level = zapcore.WarnLevel
+	default:
+		if rl, ok := a.routeLevel(route, r.URL.Path); ok {
+			if rl.off {
+				return
+			}
+			level = rl.level
+		}
+	}
+
+	// Only routine successes are sampled away
+	var every int
+	if level < zapcore.WarnLevel {
+		keep, sampled := a.sampler.keep()
+		if !keep {
+			return
+		}
+		if sampled {
+			every = a.sampler.every
+		}
+	}
+
+	ce := a.logger.Check(level, "HTTP Request")
+	if ce == nil {
+		return
+	}
+	fields = append(fields,
+		zap.String("method", r.Method),
+		zap.String("url", a.redactURL(r.URL)),
+		zap.String("route", route),
+		zap.Int("status", status),
+		zap.Int("bytes", ww.BytesWritten()),
+		zap.Duration("duration", duration),
+		zap.String("remote_addr", r.RemoteAddr),
+		zap.String("user_agent", r.UserAgent()),
+	)
+	for _, header := range a.headers {
+		if value := r.Header.Get(header); value != "" {
+			if a.redactHeaders[strings.ToLower(header)] {
+				value = redacted
+			}
+			fields = append(fields, zap.String("header."+strings.ToLower(header), value))
+		}
+	}
+	if slow {
+		fields = append(fields, zap.Bool("slow", true))
+	}
+	if every > 0 {
+		// Each sampled entry stands for this many requests
+		fields = append(fields, zap.Int("sample_every", every))
+	}
+	ce.Write(fields...)
+}
+
+type slowThresholdKey struct{}
+
+// SetSlowThreshold overrides log.access.slow_threshold for the request ctx
+// belongs to, for routes expected to be slower or faster than the rest;
+// zero keeps its entry from being flagged slow
+func SetSlowThreshold(ctx context.Context, threshold time.Duration) {
+	if current, ok := ctx.Value(slowThresholdKey{}).(*time.Duration); ok {
+		*current = threshold
+	}
+}
+
+// routeLevel finds the override for a request: the route pattern exactly,
+// else the longest prefix of the path ending at a segment boundary
+func (a *AccessLogger) routeLevel(route, path string) (routeLevel, bool) {
+	route, path = strings.ToLower(route), strings.ToLower(path)
+	for _, rl := range a.routes {
+		if rl.route == route {
+			return rl, true
+		}
+	}
+	for _, rl := range a.routes {
+		prefix := strings.TrimSuffix(rl.route, "/")
+		if path == rl.route || strings.HasPrefix(path, prefix+"/") {
+			return rl, true
+		}
+	}
+	return routeLevel{}, false
+}
+
+// redactURL renders the path and query with sensitive parameter values
+// replaced
+func (a *AccessLogger) redactURL(u *url.URL) string {
+	if u.RawQuery == "" || len(a.redactParams) == 0 {
+		return u.RequestURI()
+	}
+	query := u.Query()
+	changed := false
+	for key, values := range query {
+		if a.redactParams[strings.ToLower(key)] {
+			for i := range values {
+				values[i] = redacted
+			}
+			changed = true
+		}
+	}
+	if !changed {
+		return u.RequestURI()
+	}
+	return u.EscapedPath() + "?" + query.Encode()
+}
+
+// requestID takes the caller's ID when it is safe to log, otherwise the one
+// chi's RequestID middleware made, otherwise a new one
+func requestID(r *http.Request) string {
+	for _, header := range []string{RequestIDHeader, correlationIDHeader} {
+		if id := r.Header.Get(header); validRequestID(id) {
+			return id
+		}
+	}
+	if id := middleware.GetReqID(r.Context()); id != "" {
+		return id
+	}
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// contextWithRequestID stores the ID where chi's GetReqID looks for it
+func contextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, middleware.RequestIDKey, id)
+}
+
+// validRequestID keeps caller-chosen IDs short and printable so they can't
+// forge log lines
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func lowerSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[strings.ToLower(v)] = true
+	}
+	return set
+}
+
+// sampler keeps every entry up to threshold a second, then one in every
+type sampler struct {
+	threshold int
+	every     int
+	now       func() time.Time
+
+	mu     sync.Mutex
+	second int64
+	count  int
+}
+
+func newSampler(threshold, every int) *sampler {
+	if every < 1 {
+		every = 1
+	}
+	return &sampler{threshold: threshold, every: every, now: time.Now}
+}
+
+// keep reports whether to log the entry and whether sampling is dropping
+// others
+func (s *sampler) keep() (keep, sampled bool) {
+	if s.threshold <= 0 {
+		return true, false
+	}
+
+	s.mu.Lock()
+	if second := s.now().Unix(); second != s.second {
+		s.second, s.count = second, 0
+	}
+	s.count++
+	n := s.count
+	s.mu.Unlock()
+
+	if n <= s.threshold {
+		return true, false
+	}
+	return (n-s.threshold)%s.every == 0, true
+}
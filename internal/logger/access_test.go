@@ -0,0 +1,180 @@
+package logger
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+func newAccessRouter(t *testing.T, cfg config.AccessLogConfig) (*chi.Mux, *observer.ObservedLogs) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	access, err := NewAccessLogger(zap.New(core), cfg)
+	require.NoError(t, err)
+
+	r := chi.NewRouter()
+	r.Use(access.Handler)
+	r.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		FromContext(r.Context()).Info("loading user")
+		w.Write([]byte(middleware.GetReqID(r.Context())))
+	})
+	r.Get("/health/live", func(w http.ResponseWriter, r *http.Request) {})
+	r.Get("/fail", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusBadGateway) })
+	r.Get("/missing", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNotFound) })
+	r.Get("/slow", func(w http.ResponseWriter, r *http.Request) { time.Sleep(20 * time.Millisecond) })
+	r.Get("/export", func(w http.ResponseWriter, r *http.Request) {
+		SetSlowThreshold(r.Context(), time.Minute)
+		time.Sleep(20 * time.Millisecond)
+	})
+	return r, logs
+}
+
+func get(r http.Handler, target string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func accessEntries(logs *observer.ObservedLogs) []observer.LoggedEntry {
+	return logs.FilterMessage("HTTP Request").AllUntimed()
+}
+
+func TestAccessLogRequestIDs(t *testing.T) {
+	r, logs := newAccessRouter(t, config.AccessLogConfig{Enabled: true})
+
+	rec := get(r, "/users/7", map[string]string{"X-Correlation-ID": "abc-123"})
+	assert.Equal(t, "abc-123", rec.Header().Get(RequestIDHeader))
+	assert.Equal(t, "abc-123", rec.Body.String(), "chi sees the same ID")
+
+	// The handler's own log line carries the request ID
+	handlerLog := logs.FilterMessage("loading user").AllUntimed()
+	require.Len(t, handlerLog, 1)
+	assert.Equal(t, "abc-123", handlerLog[0].ContextMap()["request_id"])
+
+	entry := accessEntries(logs)[0].ContextMap()
+	assert.Equal(t, "abc-123", entry["request_id"])
+	assert.Equal(t, "/users/{id}", entry["route"])
+	assert.Equal(t, int64(200), entry["status"])
+
+	// IDs that could forge log lines are replaced
+	rec = get(r, "/users/7", map[string]string{RequestIDHeader: "x\nlevel=error"})
+	assert.Len(t, rec.Header().Get(RequestIDHeader), 32)
+}
+
+func TestAccessLogRedaction(t *testing.T) {
+	r, logs := newAccessRouter(t, config.AccessLogConfig{
+		Enabled:       true,
+		Headers:       []string{"authorization", "X-Client"},
+		RedactHeaders: []string{"Authorization"},
+		RedactParams:  []string{"password", "token"},
+	})
+
+	get(r, "/users/7?name=ann&Password=hunter2&token=a&token=b", map[string]string{
+		"Authorization": "Bearer secret",
+		"X-Client":      "ios",
+	})
+	entry := accessEntries(logs)[0].ContextMap()
+	assert.Equal(t, "/users/7?Password=%5BREDACTED%5D&name=ann&token=%5BREDACTED%5D&token=%5BREDACTED%5D", entry["url"])
+	assert.Equal(t, "[REDACTED]", entry["header.authorization"])
+	assert.Equal(t, "ios", entry["header.x-client"])
+
+	get(r, "/users/7?name=ann", nil)
+	assert.Equal(t, "/users/7?name=ann", accessEntries(logs)[1].ContextMap()["url"])
+}
+
+func TestAccessLogLevels(t *testing.T) {
+	r, logs := newAccessRouter(t, config.AccessLogConfig{
+		Enabled:       true,
+		SlowThreshold: 10 * time.Millisecond,
+		Routes:        map[string]string{"/health": "debug", "/users/{id}": "off"},
+	})
+
+	get(r, "/fail", nil)
+	get(r, "/missing", nil)
+	get(r, "/slow", nil)
+	get(r, "/export", nil)      // slow for most routes, not this one
+	get(r, "/health/live", nil) // debug, below the observer's level
+	get(r, "/users/7", nil)     // off
+
+	entries := accessEntries(logs)
+	require.Len(t, entries, 4)
+	assert.Equal(t, zapcore.ErrorLevel, entries[0].Level)
+	assert.Equal(t, zapcore.WarnLevel, entries[1].Level)
+	assert.Equal(t, zapcore.WarnLevel, entries[2].Level)
+	assert.Equal(t, true, entries[2].ContextMap()["slow"])
+	assert.Equal(t, zapcore.InfoLevel, entries[3].Level)
+	assert.NotContains(t, entries[3].ContextMap(), "slow")
+
+	_, err := NewAccessLogger(nil, config.AccessLogConfig{Routes: map[string]string{"/x": "loud"}})
+	assert.ErrorContains(t, err, "access log level for /x")
+}
+
+func TestAccessLogDisabledStillTagsRequests(t *testing.T) {
+	r, logs := newAccessRouter(t, config.AccessLogConfig{})
+
+	rec := get(r, "/users/7", nil)
+	assert.NotEmpty(t, rec.Header().Get(RequestIDHeader))
+	assert.Empty(t, accessEntries(logs))
+	assert.Len(t, logs.FilterMessage("loading user").AllUntimed(), 1)
+}
+
+func TestSampler(t *testing.T) {
+	now := time.Unix(1000, 0)
+	s := newSampler(2, 3)
+	s.now = func() time.Time { return now }
+
+	var kept []int
+	for i := 1; i <= 8; i++ {
+		if keep, _ := s.keep(); keep {
+			kept = append(kept, i)
+		}
+	}
+	assert.Equal(t, []int{1, 2, 5, 8}, kept)
+
+	_, sampled := s.keep()
+	assert.True(t, sampled)
+
+	// A new second starts over
+	now = now.Add(time.Second)
+	keep, sampled := s.keep()
+	assert.True(t, keep)
+	assert.False(t, sampled)
+}
+
+func TestSampledEntriesAreMarked(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	access, err := NewAccessLogger(zap.New(core), config.AccessLogConfig{Enabled: true, SampleThreshold: 1, SampleEvery: 2})
+	require.NoError(t, err)
+	access.sampler.now = func() time.Time { return time.Unix(1000, 0) }
+
+	r := chi.NewRouter()
+	r.Use(access.Handler)
+	r.Get("/ok", func(w http.ResponseWriter, r *http.Request) {})
+	r.Get("/fail", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusInternalServerError) })
+
+	for i := 0; i < 4; i++ {
+		get(r, "/ok", nil)
+	}
+	get(r, "/fail", nil) // errors are never sampled away
+
+	// The first in full, then one in two of the rest
+	entries := accessEntries(logs)
+	require.Len(t, entries, 3)
+	assert.Nil(t, entries[0].ContextMap()["sample_every"])
+	assert.Equal(t, int64(2), entries[1].ContextMap()["sample_every"])
+	assert.Equal(t, zapcore.ErrorLevel, entries[2].Level)
+}
@@ -0,0 +1,26 @@
+package logger
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+type contextKey struct{}
+
+var nop = zap.NewNop()
+
+// WithContext returns a copy of ctx carrying logger
+func WithContext(ctx context.Context, logger *zap.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx. Within a request that is
+// the access logger's, tagged with the request and trace IDs so handler
+// logs can be matched to the request; elsewhere it is a no-op logger.
+func FromContext(ctx context.Context) *zap.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*zap.Logger); ok {
+		return logger
+	}
+	return nop
+}
@@ -0,0 +1,93 @@
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// levelBody is the JSON read and written by LevelHandler
+type levelBody struct {
+	Level string `json:"level"`
+}
+
+// LevelHandler reports level on GET and changes it on PUT with a body of
+// {"level":"debug"}. Callers are expected to check who is asking first.
+func LevelHandler(level zap.AtomicLevel, logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var body levelBody
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, "invalid JSON body", http.StatusBadRequest)
+				return
+			}
+			next, err := zapcore.ParseLevel(body.Level)
+			if err != nil || body.Level == "" {
+				http.Error(w, "unknown log level "+body.Level, http.StatusBadRequest)
+				return
+			}
+			setLevel(level, next, logger, zap.String("remote", r.RemoteAddr))
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(levelBody{Level: level.Level().String()})
+	})
+}
+
+// ReloadLevelOnSignal sets level to the one reload returns each time the
+// process gets SIGHUP, until ctx ends. reload re-reads the configuration.
+func ReloadLevelOnSignal(ctx context.Context, level zap.AtomicLevel, logger *zap.Logger, reload func() (string, error)) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				reloadLevel(level, logger, reload)
+			}
+		}
+	}()
+}
+
+func reloadLevel(level zap.AtomicLevel, logger *zap.Logger, reload func() (string, error)) {
+	name, err := reload()
+	if err != nil {
+		logger.Error("Failed to reload config; log level unchanged", zap.Error(err))
+		return
+	}
+	next, err := zapcore.ParseLevel(name)
+	if err != nil {
+		logger.Error("Unknown log level in config; log level unchanged", zap.String("level", name))
+		return
+	}
+	setLevel(level, next, logger, zap.String("source", "SIGHUP"))
+}
+
+// setLevel changes level, logging the change at warn so it shows unless
+// only errors are logged
+func setLevel(level zap.AtomicLevel, next zapcore.Level, logger *zap.Logger, fields ...zap.Field) {
+	previous := level.Level()
+	if previous == next {
+		return
+	}
+	level.SetLevel(next)
+	logger.Warn("Log level changed", append(fields,
+		zap.String("from", previous.String()),
+		zap.String("to", next.String()),
+	)...)
+}
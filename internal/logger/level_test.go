@@ -0,0 +1,86 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestParseLevel(t *testing.T) {
+	assert.Equal(t, zapcore.DebugLevel, ParseLevel("debug"))
+	assert.Equal(t, zapcore.FatalLevel, ParseLevel("fatal"))
+	assert.Equal(t, zapcore.InfoLevel, ParseLevel("loud"))
+}
+
+func TestLevelHandler(t *testing.T) {
+	level := zap.NewAtomicLevelAt(zapcore.InfoLevel)
+	core, logs := observer.New(zapcore.DebugLevel)
+	h := LevelHandler(level, zap.New(core))
+
+	serve := func(method, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, "/maintenance/log-level", strings.NewReader(body)))
+		return rec
+	}
+
+	rec := serve(http.MethodGet, "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"level":"info"}`, rec.Body.String())
+
+	rec = serve(http.MethodPut, `{"level":"debug"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"level":"debug"}`, rec.Body.String())
+	assert.Equal(t, zapcore.DebugLevel, level.Level())
+
+	changes := logs.FilterMessage("Log level changed").AllUntimed()
+	require.Len(t, changes, 1)
+	assert.Equal(t, "info", changes[0].ContextMap()["from"])
+	assert.Equal(t, "debug", changes[0].ContextMap()["to"])
+
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPut, `{"level":"loud"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPut, `{}`).Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(http.MethodPost, `{"level":"info"}`).Code)
+	assert.Equal(t, zapcore.DebugLevel, level.Level())
+}
+
+func TestReloadLevel(t *testing.T) {
+	level := zap.NewAtomicLevelAt(zapcore.InfoLevel)
+	core, logs := observer.New(zapcore.DebugLevel)
+
+	reloadLevel(level, zap.New(core), func() (string, error) { return "warn", nil })
+	assert.Equal(t, zapcore.WarnLevel, level.Level())
+
+	// A broken config leaves the level alone
+	reloadLevel(level, zap.New(core), func() (string, error) { return "", errors.New("bad yaml") })
+	reloadLevel(level, zap.New(core), func() (string, error) { return "loud", nil })
+	assert.Equal(t, zapcore.WarnLevel, level.Level())
+	assert.Len(t, logs.FilterLevelExact(zapcore.ErrorLevel).AllUntimed(), 2)
+}
+
+func TestReloadLevelOnSignal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no SIGHUP on windows")
+	}
+	level := zap.NewAtomicLevelAt(zapcore.InfoLevel)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ReloadLevelOnSignal(ctx, level, zap.NewNop(), func() (string, error) { return "error", nil })
+
+	self, err := os.FindProcess(os.Getpid())
+	require.NoError(t, err)
+	require.NoError(t, self.Signal(syscall.SIGHUP))
+	assert.Eventually(t, func() bool { return level.Level() == zapcore.ErrorLevel }, 2*time.Second, 10*time.Millisecond)
+}
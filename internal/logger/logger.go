@@ -9,6 +9,12 @@ import (
 
 // New creates a new logger instance
 func New(level, format string) *zap.Logger {
+	return NewWithLevel(zap.NewAtomicLevelAt(ParseLevel(level)), format)
+}
+
+// NewWithLevel creates a logger whose level can be changed while it runs,
+// through level
+func NewWithLevel(level zap.AtomicLevel, format string) *zap.Logger {
 	var config zap.Config
 
 	if format == "json" {
@@ -16,20 +22,7 @@ func New(level, format string) *zap.Logger {
 	} else {
 		config = zap.NewDevelopmentConfig()
 	}
-
-	// Set log level
-	switch level {
-	case "debug":
-		config.Level = zap.NewAtomicLevelAt(zapcore.DebugLevel)
-	case "info":
-		config.Level = zap.NewAtomicLevelAt(zapcore.InfoLevel)
-	case "warn":
-		config.Level = zap.NewAtomicLevelAt(zapcore.WarnLevel)
-	case "error":
-		config.Level = zap.NewAtomicLevelAt(zapcore.ErrorLevel)
-	default:
-		config.Level = zap.NewAtomicLevelAt(zapcore.InfoLevel)
-	}
+	config.Level = level
 
 	// Set output
 	config.OutputPaths = []string{"stdout"}
@@ -44,6 +37,16 @@ func New(level, format string) *zap.Logger {
 	return logger
 }
 
+// ParseLevel maps a configured level name to a zap level; unknown names
+// are info
+func ParseLevel(name string) zapcore.Level {
+	level, err := zapcore.ParseLevel(name)
+	if err != nil {
+		return zapcore.InfoLevel
+	}
+	return level
+}
+
 // NewFileLogger creates a logger that writes to a file
 func NewFileLogger(level, format, filepath string) *zap.Logger {
 	var config zap.Config
@@ -0,0 +1,188 @@
+package mail
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mrhoseah/dolphin/internal/storage"
+)
+
+// DefaultMaxSize is the largest message sent by default, counted once its
+// attachments are encoded. Gmail and Outlook.com refuse anything bigger.
+const DefaultMaxSize = 25 << 20
+
+// ErrMessageTooLarge is returned, before any delivery is attempted, for
+// messages over the size limit
+var ErrMessageTooLarge = errors.New("email is too large")
+
+// cidPattern matches the cid: URLs an HTML body refers to inline images by
+var cidPattern = regexp.MustCompile(`(?i)["'(]\s*cid:([^"')\s]+)`)
+
+// Attachment represents an email attachment. Its content is Data, or is
+// streamed from Open each time the message is sent so that large files are
+// never held in memory. An attachment with a ContentID is an inline image,
+// shown by the HTML with <img src="cid:ContentID">.
+type Attachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
+
+	// Open, when set, returns the content instead of Data
+	Open func() (io.ReadCloser, error) `json:"-"`
+
+	// Size is the size of the content Open returns, checked against the
+	// size limit before sending
+	Size int64
+
+	// ContentID makes the attachment inline
+	ContentID string
+}
+
+// AttachFile attaches the file at path, read as the message is sent
+func AttachFile(path string) (Attachment, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return Attachment{}, fmt.Errorf("failed to attach %s: %w", path, err)
+	}
+	if info.IsDir() {
+		return Attachment{}, fmt.Errorf("failed to attach %s: it is a directory", path)
+	}
+
+	return Attachment{
+		Name: filepath.Base(path),
+		Size: info.Size(),
+		Open: func() (io.ReadCloser, error) {
+			return os.Open(path)
+		},
+	}, nil
+}
+
+// AttachFromStorage attaches the file at path on a storage disk, streamed
+// from the disk as the message is sent
+func AttachFromStorage(disk *storage.StorageManager, filePath string) (Attachment, error) {
+	size, err := disk.Size(filePath)
+	if err != nil {
+		return Attachment{}, fmt.Errorf("failed to attach %s from storage: %w", filePath, err)
+	}
+
+	return Attachment{
+		Name: path.Base(filePath),
+		Size: size,
+		Open: func() (io.ReadCloser, error) {
+			return disk.Get(filePath)
+		},
+	}, nil
+}
+
+// Inline returns the attachment as an inline image, which the HTML shows
+// with <img src="cid:contentID">
+func (a Attachment) Inline(contentID string) Attachment {
+	a.ContentID = contentID
+	return a
+}
+
+func (a Attachment) size() int64 {
+	if a.Open != nil {
+		return a.Size
+	}
+	return int64(len(a.Data))
+}
+
+func (a Attachment) open() (io.ReadCloser, error) {
+	if a.Open != nil {
+		return a.Open()
+	}
+	return io.NopCloser(bytes.NewReader(a.Data)), nil
+}
+
+// mediaType returns the attachment's content type, guessed from its name
+// when not set
+func (a Attachment) mediaType() string {
+	if a.ContentType != "" {
+		return a.ContentType
+	}
+	if t := mime.TypeByExtension(path.Ext(a.Name)); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// Validate checks message before it is sent: every cid: reference in its
+// HTML needs an inline attachment with that content ID, and the message
+// must fit within maxSize bytes once encoded. A maxSize of zero allows
+// any size.
+func Validate(message *Message, maxSize int64) error {
+	inline := make(map[string]bool)
+	for i, a := range message.Attachments {
+		if a.Name == "" && a.ContentID == "" {
+			return fmt.Errorf("email attachment %d has no name", i+1)
+		}
+		if a.ContentID != "" {
+			inline[a.ContentID] = true
+		}
+	}
+	for _, m := range cidPattern.FindAllStringSubmatch(message.HTML, -1) {
+		if !inline[m[1]] {
+			return fmt.Errorf("email refers to cid:%s but has no inline attachment with that content ID", m[1])
+		}
+	}
+
+	if maxSize <= 0 {
+		return nil
+	}
+	if size := estimatedSize(message); size > maxSize {
+		return tooLarge(message, size, maxSize, "")
+	}
+	return nil
+}
+
+// estimatedSize returns about how many bytes message takes once encoded:
+// base64 grows attachments by a third, plus a line break every 76
+// characters
+func estimatedSize(message *Message) int64 {
+	size := int64(len(message.Text) + len(message.HTML) + len(message.Subject) + 1024)
+	for _, a := range message.Attachments {
+		encoded := (a.size() + 2) / 3 * 4
+		size += encoded + encoded/76*2 + 256
+	}
+	return size
+}
+
+// tooLarge describes why message can't be sent, listing its attachments
+// from the largest
+func tooLarge(message *Message, size, limit int64, whose string) error {
+	attachments := append([]Attachment(nil), message.Attachments...)
+	sort.SliceStable(attachments, func(i, j int) bool {
+		return attachments[i].size() > attachments[j].size()
+	})
+
+	described := make([]string, len(attachments))
+	for i, a := range attachments {
+		described[i] = fmt.Sprintf("%s (%s)", a.Name, formatSize(a.size()))
+	}
+	err := fmt.Errorf("%w: about %s encoded, over the %slimit of %s", ErrMessageTooLarge, formatSize(size), whose, formatSize(limit))
+	if len(described) > 0 {
+		err = fmt.Errorf("%w; attachments: %s", err, strings.Join(described, ", "))
+	}
+	return err
+}
+
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
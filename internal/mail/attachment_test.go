@@ -0,0 +1,342 @@
+package mail
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/storage"
+)
+
+// mimeLeaf is a leaf of a parsed message with the multipart types above it
+type mimeLeaf struct {
+	path   string
+	header map[string]string
+	body   string
+}
+
+// readParts flattens a MIME body into its leaves
+func readParts(t *testing.T, path, contentType string, header map[string]string, body io.Reader) []mimeLeaf {
+	t.Helper()
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	require.NoError(t, err)
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		raw, err := io.ReadAll(body)
+		require.NoError(t, err)
+		return []mimeLeaf{{path: path, header: header, body: string(raw)}}
+	}
+
+	var leaves []mimeLeaf
+	reader := multipart.NewReader(body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return leaves
+		}
+		require.NoError(t, err)
+		h := map[string]string{}
+		for k := range part.Header {
+			h[k] = part.Header.Get(k)
+		}
+		leaves = append(leaves, readParts(t, path+"/"+strings.TrimPrefix(mediaType, "multipart/"), h["Content-Type"], h, part)...)
+	}
+}
+
+func TestWriteMessageAttachments(t *testing.T) {
+	dir := t.TempDir()
+	report := filepath.Join(dir, "report.pdf")
+	content := strings.Repeat("%PDF-1.4 large report ", 500)
+	require.NoError(t, os.WriteFile(report, []byte(content), 0644))
+
+	file, err := AttachFile(report)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), file.Size)
+
+	disk := storage.NewStorageManager(storage.NewLocalDriver(dir, "/storage"))
+	require.NoError(t, disk.PutString("images/logo.png", "PNG"))
+	logo, err := AttachFromStorage(disk, "images/logo.png")
+	require.NoError(t, err)
+
+	message := &Message{
+		From:    "noreply@example.com",
+		To:      []string{"ada@example.com"},
+		Subject: "Report",
+		Text:    "Your report",
+		HTML:    `<img src="cid:logo" alt="Logo"><p>Your report</p>`,
+		Attachments: []Attachment{
+			file,
+			logo.Inline("logo"),
+			{Name: "résumé.txt", Data: []byte("CV")},
+		},
+	}
+	raw, err := buildMessage(message, time.Now())
+	require.NoError(t, err)
+	for _, line := range strings.Split(string(raw), "\r\n") {
+		assert.LessOrEqual(t, len(line), 998, "SMTP line limit")
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	require.NoError(t, err)
+	leaves := readParts(t, "", msg.Header.Get("Content-Type"), nil, msg.Body)
+	require.Len(t, leaves, 5)
+
+	paths := make([]string, len(leaves))
+	for i, leaf := range leaves {
+		paths[i] = leaf.path
+	}
+	assert.Equal(t, []string{"/mixed/alternative", "/mixed/alternative/related", "/mixed/alternative/related", "/mixed", "/mixed"}, paths)
+
+	image := leaves[2]
+	assert.Equal(t, "<logo>", image.header["Content-Id"])
+	assert.Equal(t, `inline; filename=logo.png`, image.header["Content-Disposition"])
+	assert.Equal(t, "image/png; name=logo.png", image.header["Content-Type"])
+
+	pdf := leaves[3]
+	assert.Equal(t, "application/pdf; name=report.pdf", pdf.header["Content-Type"])
+	for _, line := range strings.Split(strings.TrimSpace(pdf.body), "\r\n") {
+		assert.LessOrEqual(t, len(line), 76)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(pdf.body, "\r\n", ""))
+	require.NoError(t, err)
+	assert.Equal(t, content, string(decoded))
+
+	_, params, err := mime.ParseMediaType(leaves[4].header["Content-Disposition"])
+	require.NoError(t, err)
+	assert.Equal(t, "résumé.txt", params["filename"])
+}
+
+func TestWriteMessageAttachmentErrors(t *testing.T) {
+	missing := Attachment{Name: "gone.pdf", Open: func() (io.ReadCloser, error) {
+		return nil, os.ErrNotExist
+	}}
+	_, err := buildMessage(&Message{Text: "Hi", Attachments: []Attachment{missing}}, time.Now())
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.Contains(t, err.Error(), "failed to open attachment gone.pdf")
+
+	_, err = AttachFile(filepath.Join(t.TempDir(), "nope.pdf"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestValidate(t *testing.T) {
+	big := Attachment{Name: "video.mp4", Size: 30 << 20, Open: func() (io.ReadCloser, error) {
+		t.Fatal("validation must not read attachments")
+		return nil, nil
+	}}
+	small := Attachment{Name: "notes.txt", Data: []byte("notes")}
+
+	err := Validate(&Message{HTML: "<p>Hi</p>", Attachments: []Attachment{small, big}}, DefaultMaxSize)
+	assert.ErrorIs(t, err, ErrMessageTooLarge)
+	assert.Equal(t, "email is too large: about 41.1 MB encoded, over the limit of 25.0 MB; attachments: video.mp4 (30.0 MB), notes.txt (5 B)", err.Error())
+	assert.NoError(t, Validate(&Message{Attachments: []Attachment{big}}, 0))
+
+	err = Validate(&Message{HTML: `<img src="cid:logo"><td style="background: url(cid:bg)">`, Attachments: []Attachment{small.Inline("logo")}}, 0)
+	assert.EqualError(t, err, "email refers to cid:bg but has no inline attachment with that content ID")
+
+	assert.EqualError(t, Validate(&Message{Attachments: []Attachment{{Data: []byte("x")}}}, 0), "email attachment 1 has no name")
+}
+
+// fakeServer is an SMTP server advertising a size limit, answering MAIL
+// with mailReply, and passing on the data of each message it accepts
+type fakeServer struct {
+	addr      string
+	messages  chan string
+	sessions  atomic.Int32
+	mailReply string
+
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+// drop closes the open sessions, as servers do with idle clients
+func (s *fakeServer) drop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+func fakeSMTP(t *testing.T, size int, mailReply string) *fakeServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	server := &fakeServer{addr: ln.Addr().String(), messages: make(chan string, 100), mailReply: mailReply}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			server.sessions.Add(1)
+			server.mu.Lock()
+			server.conns = append(server.conns, conn)
+			server.mu.Unlock()
+			go server.serve(conn, size)
+		}
+	}()
+	return server
+}
+
+func (s *fakeServer) serve(conn net.Conn, size int) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	fmt.Fprint(conn, "220 fake ESMTP\r\n")
+	var data strings.Builder
+	inData := false
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		if inData {
+			if line == ".\r\n" {
+				inData = false
+				s.messages <- data.String()
+				data.Reset()
+				fmt.Fprint(conn, "250 queued\r\n")
+				continue
+			}
+			data.WriteString(line)
+			continue
+		}
+		switch cmd := strings.ToUpper(strings.Fields(line)[0]); cmd {
+		case "EHLO":
+			fmt.Fprintf(conn, "250-fake\r\n250 SIZE %d\r\n", size)
+		case "MAIL":
+			fmt.Fprint(conn, s.mailReply+"\r\n")
+		case "DATA":
+			inData = true
+			fmt.Fprint(conn, "354 go ahead\r\n")
+		case "QUIT":
+			fmt.Fprint(conn, "221 bye\r\n")
+			return
+		default:
+			fmt.Fprint(conn, "250 ok\r\n")
+		}
+	}
+}
+
+func newTestSMTPDriver(t *testing.T, addr string) *SMTPDriver {
+	host, port, err := net.SplitHostPort(addr)
+	require.NoError(t, err)
+	var p int
+	fmt.Sscan(port, &p)
+	driver := NewSMTPDriver(host, p, "", "", zap.NewNop())
+	t.Cleanup(func() { driver.Close() })
+	return driver
+}
+
+func TestSMTPDriverStreamsAttachments(t *testing.T) {
+	server := fakeSMTP(t, 10<<20, "250 ok")
+	driver := newTestSMTPDriver(t, server.addr)
+
+	err := driver.Send(context.Background(), &Message{
+		From:        "noreply@example.com",
+		To:          []string{"ada@example.com"},
+		Subject:     "Hi",
+		Text:        ".leading dot survives",
+		Attachments: []Attachment{{Name: "a.txt", Data: []byte("attached")}},
+	})
+	require.NoError(t, err)
+
+	data := <-server.messages
+	msg, err := mail.ReadMessage(strings.NewReader(data))
+	require.NoError(t, err)
+	leaves := readParts(t, "", msg.Header.Get("Content-Type"), nil, msg.Body)
+	require.Len(t, leaves, 2)
+	assert.Equal(t, "..leading dot survives", leaves[0].body, "dot-stuffed on the wire")
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("attached")), leaves[1].body)
+}
+
+func TestSMTPDriverRefusesOversizedMessages(t *testing.T) {
+	server := fakeSMTP(t, 1000, "250 ok")
+	driver := newTestSMTPDriver(t, server.addr)
+
+	err := driver.Send(context.Background(), &Message{
+		From:        "noreply@example.com",
+		To:          []string{"ada@example.com"},
+		Attachments: []Attachment{{Name: "big.bin", Data: make([]byte, 4000)}},
+	})
+	require.ErrorIs(t, err, ErrMessageTooLarge)
+	assert.Contains(t, err.Error(), "over the server's limit of 1000 B")
+	assert.Empty(t, server.messages, "no data is sent")
+}
+
+func TestMailgunDriverAttachments(t *testing.T) {
+	var fields map[string][]string
+	var files map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, key, _ := r.BasicAuth()
+		assert.Equal(t, "api", user)
+		assert.Equal(t, "key-123", key)
+		require.NoError(t, r.ParseMultipartForm(1<<20))
+		fields = r.MultipartForm.Value
+		files = map[string]string{}
+		for field, headers := range r.MultipartForm.File {
+			for _, h := range headers {
+				f, err := h.Open()
+				require.NoError(t, err)
+				content, _ := io.ReadAll(f)
+				f.Close()
+				files[field+":"+h.Filename] = string(content)
+			}
+		}
+	}))
+	defer server.Close()
+
+	driver := NewMailgunDriver("mg.example.com", "key-123", zap.NewNop())
+	driver.baseURL = server.URL
+	err := driver.Send(context.Background(), &Message{
+		From:    "noreply@example.com",
+		To:      []string{"ada@example.com"},
+		Subject: "Hi",
+		HTML:    `<img src="cid:logo">`,
+		Attachments: []Attachment{
+			{Name: "a.txt", Data: []byte("attached")},
+			{Name: "logo.png", Data: []byte("PNG"), ContentID: "logo"},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"Hi"}, fields["subject"])
+	assert.Equal(t, map[string]string{"attachment:a.txt": "attached", "inline:logo": "PNG"}, files)
+}
+
+func TestMailgunDriverAttachmentError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+	}))
+	defer server.Close()
+
+	driver := NewMailgunDriver("mg.example.com", "key-123", zap.NewNop())
+	driver.baseURL = server.URL
+	broken := Attachment{Name: "gone.pdf", Open: func() (io.ReadCloser, error) {
+		return nil, errors.New("disk unavailable")
+	}}
+	err := driver.Send(context.Background(), &Message{From: "a@example.com", Attachments: []Attachment{broken}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to open attachment gone.pdf")
+}
@@ -0,0 +1,247 @@
+package mail
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dkimHeaders are the header fields signed when a message has them
+var dkimHeaders = []string{
+	"From", "Reply-To", "Subject", "Date", "To", "Cc", "Message-ID",
+	"In-Reply-To", "References", "MIME-Version", "Content-Type",
+}
+
+// DKIMKey is the key mail from Domain is signed with. Its public half is
+// published in DNS as a TXT record at <Selector>._domainkey.<Domain>.
+type DKIMKey struct {
+	Domain   string
+	Selector string
+	// Signer is an *rsa.PrivateKey or an ed25519.PrivateKey
+	Signer crypto.Signer
+}
+
+// LoadDKIMKey reads the PEM private key at path, RSA (PKCS #1 or #8) or
+// Ed25519 (PKCS #8), as the key for domain
+func LoadDKIMKey(domain, selector, path string) (DKIMKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return DKIMKey{}, fmt.Errorf("failed to read DKIM key for %s: %w", domain, err)
+	}
+	signer, err := ParseDKIMPrivateKey(data)
+	if err != nil {
+		return DKIMKey{}, fmt.Errorf("invalid DKIM key for %s in %s: %w", domain, path, err)
+	}
+	return DKIMKey{Domain: strings.ToLower(domain), Selector: selector, Signer: signer}, nil
+}
+
+// ParseDKIMPrivateKey parses a PEM encoded RSA or Ed25519 private key
+func ParseDKIMPrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return key, nil
+	case ed25519.PrivateKey:
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %T, want RSA or Ed25519", key)
+}
+
+// DKIMSigner signs messages with the key of the domain they are from, with
+// relaxed canonicalization of headers and body. Messages from a domain it
+// has no key for are sent unsigned.
+type DKIMSigner struct {
+	keys map[string]DKIMKey
+	now  func() time.Time
+}
+
+// NewDKIMSigner creates a signer holding keys
+func NewDKIMSigner(keys ...DKIMKey) *DKIMSigner {
+	s := &DKIMSigner{keys: make(map[string]DKIMKey, len(keys)), now: time.Now}
+	for _, key := range keys {
+		s.keys[strings.ToLower(key.Domain)] = key
+	}
+	return s
+}
+
+// keyFor returns the key for the domain of the From address
+func (s *DKIMSigner) keyFor(from string) (DKIMKey, bool) {
+	if s == nil {
+		return DKIMKey{}, false
+	}
+	address := from
+	if parsed, err := mail.ParseAddress(from); err == nil {
+		address = parsed.Address
+	}
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return DKIMKey{}, false
+	}
+	key, ok := s.keys[strings.ToLower(address[at+1:])]
+	return key, ok
+}
+
+// header returns the DKIM-Signature field, folded, for a message with
+// headers, written in order, and a body written by writeBody. The body is
+// written to a hash only, so attachments are read once more when the
+// message is sent.
+func (s *DKIMSigner) header(key DKIMKey, headers []headerField, writeBody func(io.Writer) error) (string, error) {
+	algorithm := "rsa-sha256"
+	var hashOpt crypto.SignerOpts = crypto.SHA256
+	if _, ok := key.Signer.(ed25519.PrivateKey); ok {
+		algorithm = "ed25519-sha256"
+		hashOpt = crypto.Hash(0)
+	}
+
+	bodyHash := sha256.New()
+	canonical := &relaxedBody{w: bodyHash}
+	if err := writeBody(canonical); err != nil {
+		return "", err
+	}
+	canonical.Close()
+
+	var signed []headerField
+	var names []string
+	for _, name := range dkimHeaders {
+		for _, h := range headers {
+			if strings.EqualFold(h.name, name) {
+				signed = append(signed, h)
+				names = append(names, strings.ToLower(name))
+				break
+			}
+		}
+	}
+
+	value := fmt.Sprintf("v=1; a=%s; c=relaxed/relaxed; d=%s; s=%s;\r\n\tt=%s; h=%s;\r\n\tbh=%s;\r\n\tb=",
+		algorithm, key.Domain, key.Selector, strconv.FormatInt(s.now().Unix(), 10),
+		strings.Join(names, ":"), base64.StdEncoding.EncodeToString(bodyHash.Sum(nil)))
+
+	digest := sha256.New()
+	for _, h := range signed {
+		io.WriteString(digest, relaxedHeader(h.name, h.value)+"\r\n")
+	}
+	io.WriteString(digest, relaxedHeader("DKIM-Signature", value))
+
+	// Ed25519 signs the SHA-256 digest itself, as RFC 8463 specifies
+	signature, err := key.Signer.Sign(rand.Reader, digest.Sum(nil), hashOpt)
+	if err != nil {
+		return "", fmt.Errorf("failed to DKIM sign message for %s: %w", key.Domain, err)
+	}
+	return "DKIM-Signature: " + value + fold(base64.StdEncoding.EncodeToString(signature), 72) + "\r\n", nil
+}
+
+// fold breaks s into lines of width characters, continued with a tab
+func fold(s string, width int) string {
+	var b strings.Builder
+	for len(s) > width {
+		b.WriteString(s[:width])
+		b.WriteString("\r\n\t")
+		s = s[width:]
+	}
+	b.WriteString(s)
+	return b.String()
+}
+
+// relaxedHeader canonicalizes a header field as RFC 6376 section 3.4.2
+// describes: the name lowercased, the value unfolded with runs of
+// whitespace reduced to one space and trimmed
+func relaxedHeader(name, value string) string {
+	value = strings.NewReplacer("\r\n", "", "\n", "").Replace(value)
+	return strings.ToLower(strings.TrimSpace(name)) + ":" + strings.Join(strings.FieldsFunc(value, isWSP), " ")
+}
+
+func isWSP(r rune) bool {
+	return r == ' ' || r == '\t'
+}
+
+// relaxedBody canonicalizes a body as it is written, as RFC 6376 section
+// 3.4.4 describes: runs of whitespace within a line become one space,
+// whitespace at the end of lines and empty lines at the end of the body
+// are removed, and a non-empty body ends with one line break
+type relaxedBody struct {
+	w          io.Writer
+	buf        []byte
+	cr         bool
+	space      bool
+	lineBreaks int
+	content    bool
+}
+
+func (b *relaxedBody) Write(p []byte) (int, error) {
+	b.buf = b.buf[:0]
+	for _, c := range p {
+		if b.cr && c != '\n' {
+			b.emit('\r')
+		}
+		b.cr = false
+
+		switch c {
+		case '\r':
+			b.cr = true
+		case '\n':
+			b.space = false
+			b.lineBreaks++
+		case ' ', '\t':
+			b.space = true
+		default:
+			b.emit(c)
+		}
+	}
+	if _, err := b.w.Write(b.buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// emit writes c after the line breaks and whitespace held back before it
+func (b *relaxedBody) emit(c byte) {
+	for ; b.lineBreaks > 0; b.lineBreaks-- {
+		b.buf = append(b.buf, '\r', '\n')
+	}
+	if b.space {
+		b.buf = append(b.buf, ' ')
+		b.space = false
+	}
+	b.buf = append(b.buf, c)
+	b.content = true
+}
+
+// Close ends the body with a line break
+func (b *relaxedBody) Close() error {
+	if b.cr {
+		b.buf = b.buf[:0]
+		b.emit('\r')
+		b.cr = false
+		if _, err := b.w.Write(b.buf); err != nil {
+			return err
+		}
+	}
+	if !b.content {
+		return nil
+	}
+	_, err := io.WriteString(b.w, "\r\n")
+	return err
+}
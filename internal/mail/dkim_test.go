@@ -0,0 +1,204 @@
+package mail
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func canonicalBody(t *testing.T, body string, chunk int) string {
+	t.Helper()
+	var out bytes.Buffer
+	b := &relaxedBody{w: &out}
+	for len(body) > 0 {
+		n := min(chunk, len(body))
+		_, err := b.Write([]byte(body[:n]))
+		require.NoError(t, err)
+		body = body[n:]
+	}
+	require.NoError(t, b.Close())
+	return out.String()
+}
+
+func TestRelaxedBody(t *testing.T) {
+	tests := map[string]string{
+		" C \r\nD \t E\r\n\r\n\r\n": " C\r\nD E\r\n",
+		"no line break":             "no line break\r\n",
+		"":                          "",
+		"\r\n\r\n":                  "",
+		"a\r\n \t\r\nb  \r\n":       "a\r\n\r\nb\r\n",
+		"bare\rcr\r":                "bare\rcr\r\r\n",
+	}
+	for body, want := range tests {
+		for _, chunk := range []int{1, 3, 1 << 10} {
+			assert.Equal(t, want, canonicalBody(t, body, chunk), "%q in chunks of %d", body, chunk)
+		}
+	}
+
+	// The body of the examples in RFC 8463
+	sum := sha256.Sum256([]byte(canonicalBody(t, "Hi.\r\n\r\nWe lost the game.  Are you hungry yet?\r\n\r\nJoe.\r\n", 7)))
+	assert.Equal(t, "2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8=", base64.StdEncoding.EncodeToString(sum[:]))
+}
+
+func TestRelaxedHeader(t *testing.T) {
+	assert.Equal(t, "subject:Is dinner ready?", relaxedHeader("Subject ", " Is \tdinner\r\n ready? "))
+}
+
+// verifyDKIM checks the signature of a raw message the way a receiving
+// server does
+func verifyDKIM(t *testing.T, raw []byte, publicKey crypto.PublicKey) map[string]string {
+	t.Helper()
+	head, body, ok := bytes.Cut(raw, []byte("\r\n\r\n"))
+	require.True(t, ok)
+
+	// Unfold the header fields
+	var fields []string
+	for _, line := range strings.Split(string(head), "\r\n") {
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			fields[len(fields)-1] += "\r\n" + line
+		} else {
+			fields = append(fields, line)
+		}
+	}
+	canonical := func(field string) string {
+		name, value, _ := strings.Cut(field, ":")
+		value = strings.ReplaceAll(value, "\r\n", "")
+		return strings.ToLower(strings.TrimSpace(name)) + ":" + strings.Join(strings.Fields(value), " ")
+	}
+	find := func(name string) string {
+		for _, f := range fields {
+			if strings.EqualFold(strings.TrimSpace(strings.SplitN(f, ":", 2)[0]), name) {
+				return f
+			}
+		}
+		return ""
+	}
+
+	signature := find("DKIM-Signature")
+	require.NotEmpty(t, signature, "message is signed")
+	tags := map[string]string{}
+	for _, tag := range strings.Split(strings.SplitN(signature, ":", 2)[1], ";") {
+		k, v, _ := strings.Cut(tag, "=")
+		tags[strings.TrimSpace(k)] = strings.Join(strings.Fields(strings.ReplaceAll(v, "\r\n", "")), "")
+	}
+
+	// Body hash, canonicalized a line at a time
+	lines := strings.Split(string(body), "\r\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(regexp.MustCompile(`[ \t]+`).ReplaceAllString(line, " "), " ")
+	}
+	canonicalBody := strings.TrimRight(strings.Join(lines, "\r\n"), "\r\n") + "\r\n"
+	bodySum := sha256.Sum256([]byte(canonicalBody))
+	assert.Equal(t, tags["bh"], base64.StdEncoding.EncodeToString(bodySum[:]), "body hash")
+
+	digest := sha256.New()
+	for _, name := range strings.Split(tags["h"], ":") {
+		digest.Write([]byte(canonical(find(name)) + "\r\n"))
+	}
+	unsigned := regexp.MustCompile(`([;\s]b=)[^;]*$`).ReplaceAllString(signature, "$1")
+	digest.Write([]byte(canonical(unsigned)))
+
+	sig, err := base64.StdEncoding.DecodeString(tags["b"])
+	require.NoError(t, err)
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		assert.NoError(t, rsa.VerifyPKCS1v15(key, crypto.SHA256, digest.Sum(nil), sig), "signature")
+	case ed25519.PublicKey:
+		assert.True(t, ed25519.Verify(key, digest.Sum(nil), sig), "signature")
+	}
+	return tags
+}
+
+func TestWriteMessageDKIM(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	edPublic, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	signer := NewDKIMSigner(
+		DKIMKey{Domain: "example.com", Selector: "mail", Signer: rsaKey},
+		DKIMKey{Domain: "Shop.example.org", Selector: "ed", Signer: edKey},
+	)
+	signer.now = func() time.Time { return time.Unix(1700000000, 0) }
+
+	message := &Message{
+		From:        "Acme <noreply@example.com>",
+		To:          []string{"ada@example.net"},
+		Subject:     "Your   invoice",
+		Text:        "Trailing spaces   \r\n\r\n\r\n",
+		HTML:        `<img src="cid:logo"><p>Invoice</p>`,
+		Headers:     map[string]string{"Reply-To": "billing@example.com"},
+		Attachments: []Attachment{{Name: "logo.png", Data: []byte("PNG"), ContentID: "logo"}, {Name: "invoice.pdf", Data: bytes.Repeat([]byte("%PDF "), 100)}},
+	}
+
+	var raw bytes.Buffer
+	require.NoError(t, writeMessage(&raw, message, time.Now(), signer))
+	tags := verifyDKIM(t, raw.Bytes(), &rsaKey.PublicKey)
+	assert.Equal(t, "rsa-sha256", tags["a"])
+	assert.Equal(t, "example.com", tags["d"])
+	assert.Equal(t, "mail", tags["s"])
+	assert.Equal(t, "1700000000", tags["t"])
+	assert.Equal(t, "from:reply-to:subject:date:to:mime-version:content-type", tags["h"])
+	for _, line := range strings.Split(raw.String(), "\r\n") {
+		assert.LessOrEqual(t, len(line), 998, "SMTP line limit")
+	}
+
+	message.From = "orders@shop.example.org"
+	raw.Reset()
+	require.NoError(t, writeMessage(&raw, message, time.Now(), signer))
+	tags = verifyDKIM(t, raw.Bytes(), edPublic)
+	assert.Equal(t, "ed25519-sha256", tags["a"])
+
+	message.From = "someone@elsewhere.test"
+	raw.Reset()
+	require.NoError(t, writeMessage(&raw, message, time.Now(), signer))
+	assert.NotContains(t, raw.String(), "DKIM-Signature")
+}
+
+func TestLoadDKIMKey(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	edDER, err := x509.MarshalPKCS8PrivateKey(edKey)
+	require.NoError(t, err)
+
+	files := map[string]*pem.Block{
+		"rsa.pem": {Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)},
+		"ed.pem":  {Type: "PRIVATE KEY", Bytes: edDER},
+	}
+	for name, block := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), pem.EncodeToMemory(block), 0600))
+	}
+
+	key, err := LoadDKIMKey("Example.com", "mail", filepath.Join(dir, "rsa.pem"))
+	require.NoError(t, err)
+	assert.Equal(t, "example.com", key.Domain)
+	assert.IsType(t, &rsa.PrivateKey{}, key.Signer)
+
+	key, err = LoadDKIMKey("example.org", "ed", filepath.Join(dir, "ed.pem"))
+	require.NoError(t, err)
+	assert.IsType(t, ed25519.PrivateKey{}, key.Signer)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bad.pem"), []byte("not a key"), 0600))
+	_, err = LoadDKIMKey("example.com", "mail", filepath.Join(dir, "bad.pem"))
+	assert.ErrorContains(t, err, "invalid DKIM key for example.com")
+	_, err = LoadDKIMKey("example.com", "mail", filepath.Join(dir, "missing.pem"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -1,13 +1,23 @@
 package mail
 
 import (
-	"bytes"
 	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
 	"net/http"
 	"net/smtp"
+	"net/textproto"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
@@ -26,27 +36,51 @@ type Message struct {
 	Headers     map[string]string `json:"headers,omitempty"`
 }
 
-// Attachment represents an email attachment
-type Attachment struct {
-	Name        string
-	ContentType string
-	Data        []byte
-}
-
 // Driver defines the interface for mail drivers
 type Driver interface {
 	Send(ctx context.Context, message *Message) error
 	SendBatch(ctx context.Context, messages []*Message) error
 }
 
-// SMTPDriver implements mail sending using SMTP
+// SMTPDriver implements mail sending using SMTP. Connections are kept open
+// and reused, up to SMTPOptions.MaxConnections at once, so that mail sent
+// at volume doesn't pay for a handshake per message; Close closes them.
 type SMTPDriver struct {
 	host     string
 	port     int
 	username string
 	password string
 	auth     smtp.Auth
+	options  SMTPOptions
+	dkim     *DKIMSigner
 	logger   *zap.Logger
+
+	slots  chan struct{}
+	mu     sync.Mutex
+	idle   []*smtpConn
+	closed bool
+}
+
+// SMTPOptions controls the connections an SMTPDriver keeps to its server,
+// mirroring mail.pool in the configuration
+type SMTPOptions struct {
+	// MaxConnections caps the connections open at once; senders beyond it
+	// wait for one to be free
+	MaxConnections int
+	// MaxMessages replaces a connection after it has sent this many
+	// messages; zero keeps it for as long as it works
+	MaxMessages int
+	// IdleTimeout closes connections unused for this long
+	IdleTimeout time.Duration
+	// Timeout bounds the delivery of each message, connecting included;
+	// zero leaves it to the context
+	Timeout time.Duration
+}
+
+// DefaultSMTPOptions keeps up to 4 connections, each for 100 messages or
+// 30 seconds idle, and gives each message a minute
+func DefaultSMTPOptions() SMTPOptions {
+	return SMTPOptions{MaxConnections: 4, MaxMessages: 100, IdleTimeout: 30 * time.Second, Timeout: time.Minute}
 }
 
 // NewSMTPDriver creates a new SMTP mail driver
@@ -56,7 +90,7 @@ func NewSMTPDriver(host string, port int, username, password string, logger *zap
 		auth = smtp.PlainAuth("", username, password, host)
 	}
 
-	return &SMTPDriver{
+	d := &SMTPDriver{
 		host:     host,
 		port:     port,
 		username: username,
@@ -64,59 +98,451 @@ func NewSMTPDriver(host string, port int, username, password string, logger *zap
 		auth:     auth,
 		logger:   logger,
 	}
+	d.SetOptions(DefaultSMTPOptions())
+	return d
+}
+
+// SetOptions replaces the connection options; call it before sending
+func (d *SMTPDriver) SetOptions(options SMTPOptions) {
+	if options.MaxConnections < 1 {
+		options.MaxConnections = 1
+	}
+	d.options = options
+	d.slots = make(chan struct{}, options.MaxConnections)
+}
+
+// SetDKIM signs messages with signer from now on
+func (d *SMTPDriver) SetDKIM(signer *DKIMSigner) {
+	d.dkim = signer
 }
 
 func (d *SMTPDriver) Send(ctx context.Context, message *Message) error {
-	addr := fmt.Sprintf("%s:%d", d.host, d.port)
+	// Send email
+	recipients := append(message.To, message.Cc...)
+	recipients = append(recipients, message.Bcc...)
+
+	err := d.sendMail(ctx, message, recipients)
+	if err != nil {
+		d.logger.Error("Failed to send email via SMTP", zap.String("host", d.host), zap.Error(err))
+		return err
+	}
+
+	d.logger.Info("Email sent successfully via SMTP",
+		zap.String("to", strings.Join(message.To, ",")),
+		zap.String("subject", message.Subject))
 
-	// Build email headers
-	headers := make(map[string]string)
-	headers["From"] = message.From
-	headers["To"] = strings.Join(message.To, ", ")
-	headers["Subject"] = message.Subject
-	headers["Date"] = time.Now().Format(time.RFC1123Z)
-	headers["MIME-Version"] = "1.0"
+	return nil
+}
+
+// Close closes the idle connections, and those in use once their message
+// is sent
+func (d *SMTPDriver) Close() error {
+	d.mu.Lock()
+	idle := d.idle
+	d.idle = nil
+	d.closed = true
+	d.mu.Unlock()
+
+	for _, c := range idle {
+		c.quit()
+	}
+	return nil
+}
+
+// smtpConn is a connection to the server, past the handshake
+type smtpConn struct {
+	client   *smtp.Client
+	conn     net.Conn
+	sent     int
+	lastUsed time.Time
+	stop     func() bool
+}
+
+// watch applies the deadline and cancellation of ctx to the connection
+// until release
+func (c *smtpConn) watch(ctx context.Context) {
+	deadline, _ := ctx.Deadline()
+	c.conn.SetDeadline(deadline)
+	c.stop = context.AfterFunc(ctx, func() {
+		c.conn.SetDeadline(time.Now())
+	})
+}
+
+// quit ends the session politely, without waiting long for the server
+func (c *smtpConn) quit() {
+	c.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	c.client.Quit()
+	c.client.Close()
+}
+
+// sendMail works like smtp.SendMail over a pooled connection, but writes
+// the message to the server as it is built so that attachments are
+// streamed rather than buffered. A message over the size limit the server
+// advertises is refused before its data is sent.
+func (d *SMTPDriver) sendMail(ctx context.Context, message *Message, recipients []string) error {
+	if d.options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.options.Timeout)
+		defer cancel()
+	}
+
+	select {
+	case d.slots <- struct{}{}:
+		defer func() { <-d.slots }()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	c, err := d.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	err = d.transmit(c.client, message, recipients)
+	d.release(c, err)
+	return err
+}
+
+func (d *SMTPDriver) transmit(c *smtp.Client, message *Message, recipients []string) error {
+	if ok, param := c.Extension("SIZE"); ok {
+		if limit, err := strconv.ParseInt(param, 10, 64); err == nil && limit > 0 {
+			if size := estimatedSize(message); size > limit {
+				return tooLarge(message, size, limit, "server's ")
+			}
+		}
+	}
+
+	if err := c.Mail(message.From); err != nil {
+		return err
+	}
+	for _, recipient := range recipients {
+		if err := c.Rcpt(recipient); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if err := writeMessage(w, message, time.Now(), d.dkim); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// acquire returns an idle connection that still answers, or a new one
+func (d *SMTPDriver) acquire(ctx context.Context) (*smtpConn, error) {
+	for {
+		d.mu.Lock()
+		var c *smtpConn
+		if n := len(d.idle); n > 0 {
+			c = d.idle[n-1]
+			d.idle = d.idle[:n-1]
+		}
+		d.mu.Unlock()
+		if c == nil {
+			break
+		}
+
+		if d.options.IdleTimeout > 0 && time.Since(c.lastUsed) > d.options.IdleTimeout {
+			c.quit()
+			continue
+		}
+		c.watch(ctx)
+		if err := c.client.Reset(); err != nil {
+			c.stop()
+			c.client.Close()
+			continue
+		}
+		return c, nil
+	}
+
+	return d.dial(ctx)
+}
+
+// dial connects to the server, switching to TLS when it offers STARTTLS,
+// and authenticates
+func (d *SMTPDriver) dial(ctx context.Context) (*smtpConn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(d.host, strconv.Itoa(d.port)))
+	if err != nil {
+		return nil, err
+	}
+	c := &smtpConn{conn: conn}
+	c.watch(ctx)
+
+	fail := func(err error) (*smtpConn, error) {
+		c.stop()
+		conn.Close()
+		return nil, err
+	}
+	if c.client, err = smtp.NewClient(conn, d.host); err != nil {
+		return fail(err)
+	}
+	if ok, _ := c.client.Extension("STARTTLS"); ok {
+		if err := c.client.StartTLS(&tls.Config{ServerName: d.host}); err != nil {
+			return fail(err)
+		}
+	}
+	if d.auth != nil {
+		if ok, _ := c.client.Extension("AUTH"); !ok {
+			return fail(errors.New("smtp: server doesn't support AUTH"))
+		}
+		if err := c.client.Auth(d.auth); err != nil {
+			return fail(err)
+		}
+	}
+	return c, nil
+}
+
+// release returns a connection to the pool after a message, unless the
+// message failed, leaving the session in an unknown state, or the
+// connection has sent its share
+func (d *SMTPDriver) release(c *smtpConn, err error) {
+	watching := c.stop()
+	c.sent++
+	if err != nil || !watching {
+		c.client.Close()
+		return
+	}
+	c.conn.SetDeadline(time.Time{})
+
+	d.mu.Lock()
+	keep := !d.closed && (d.options.MaxMessages <= 0 || c.sent < d.options.MaxMessages)
+	if keep {
+		c.lastUsed = time.Now()
+		d.idle = append(d.idle, c)
+	}
+	d.mu.Unlock()
+	if !keep {
+		c.quit()
+	}
+}
+
+// headerField is a header field of a message, written as "Name: value"
+type headerField struct {
+	name, value string
+}
+
+// writeMessage formats message for SMTP. Messages with both an HTML and a
+// text part are sent as multipart/alternative, text first so that clients
+// able to show HTML pick it. Inline images are related to the HTML part,
+// and other attachments are mixed in around the whole. Bodies are
+// quoted-printable and attachments base64, which keeps lines within SMTP's
+// 998 character limit; attachments are read as they are written. Messages
+// from a domain signer has a key for are DKIM signed, which reads their
+// attachments twice.
+func writeMessage(w io.Writer, message *Message, date time.Time, signer *DKIMSigner) error {
+	headers := map[string]string{
+		"From":         message.From,
+		"To":           strings.Join(message.To, ", "),
+		"Subject":      mime.QEncoding.Encode("utf-8", message.Subject),
+		"Date":         date.Format(time.RFC1123Z),
+		"MIME-Version": "1.0",
+	}
+	if len(message.Cc) > 0 {
+		headers["Cc"] = strings.Join(message.Cc, ", ")
+	}
 
 	// Add custom headers
 	for k, v := range message.Headers {
 		headers[k] = v
 	}
 
-	// Build email body
-	var body bytes.Buffer
+	body := messageBody(message)
+	for k := range body.header {
+		headers[k] = body.header.Get(k)
+	}
 
 	// Write headers
-	for k, v := range headers {
-		body.WriteString(fmt.Sprintf("%s: %s\r\n", k, v))
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fields := make([]headerField, len(keys))
+	for i, k := range keys {
+		fields[i] = headerField{k, headers[k]}
 	}
-	body.WriteString("\r\n")
 
-	// Write content
+	if key, ok := signer.keyFor(message.From); ok {
+		signature, err := signer.header(key, fields, body.writeTo)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, signature); err != nil {
+			return err
+		}
+	}
+	for _, f := range fields {
+		if _, err := fmt.Fprintf(w, "%s: %s\r\n", f.name, f.value); err != nil {
+			return err
+		}
+	}
+	if _, err := io.WriteString(w, "\r\n"); err != nil {
+		return err
+	}
+	return body.writeTo(w)
+}
+
+// mimePart is a node of a message's MIME tree: a leaf written by body, or
+// a multipart holding parts
+type mimePart struct {
+	header   textproto.MIMEHeader
+	body     func(io.Writer) error
+	parts    []*mimePart
+	boundary string
+}
+
+// messageBody returns the MIME tree of message's content
+func messageBody(message *Message) *mimePart {
+	var inline, attached []*mimePart
+	for _, a := range message.Attachments {
+		if a.ContentID != "" && message.HTML != "" {
+			inline = append(inline, attachmentPart(a))
+		} else {
+			attached = append(attached, attachmentPart(a))
+		}
+	}
+
+	var body *mimePart
 	if message.HTML != "" {
-		body.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
-		body.WriteString("\r\n")
-		body.WriteString(message.HTML)
+		body = textPart("text/html; charset=UTF-8", message.HTML)
+		if len(inline) > 0 {
+			body = multipartOf("related", append([]*mimePart{body}, inline...)...)
+		}
+		if message.Text != "" {
+			body = multipartOf("alternative", textPart("text/plain; charset=UTF-8", message.Text), body)
+		}
 	} else {
-		body.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
-		body.WriteString("\r\n")
-		body.WriteString(message.Text)
+		body = textPart("text/plain; charset=UTF-8", message.Text)
 	}
 
-	// Send email
-	recipients := append(message.To, message.Cc...)
-	recipients = append(recipients, message.Bcc...)
+	if len(attached) > 0 {
+		body = multipartOf("mixed", append([]*mimePart{body}, attached...)...)
+	}
+	return body
+}
+
+func multipartOf(subtype string, parts ...*mimePart) *mimePart {
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+	return &mimePart{
+		header:   textproto.MIMEHeader{"Content-Type": {"multipart/" + subtype + "; boundary=" + boundary}},
+		parts:    parts,
+		boundary: boundary,
+	}
+}
+
+func textPart(contentType, text string) *mimePart {
+	return &mimePart{
+		header: textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		},
+		body: func(w io.Writer) error {
+			return writeQuotedPrintable(w, text)
+		},
+	}
+}
 
-	err := smtp.SendMail(addr, d.auth, message.From, recipients, body.Bytes())
+func attachmentPart(a Attachment) *mimePart {
+	disposition := "attachment"
+	if a.ContentID != "" {
+		disposition = "inline"
+	}
+	header := textproto.MIMEHeader{
+		"Content-Type":              {withParam(a.mediaType(), "name", a.Name)},
+		"Content-Disposition":       {withParam(disposition, "filename", a.Name)},
+		"Content-Transfer-Encoding": {"base64"},
+	}
+	if a.ContentID != "" {
+		header.Set("Content-ID", "<"+a.ContentID+">")
+	}
+
+	return &mimePart{
+		header: header,
+		body: func(w io.Writer) error {
+			content, err := a.open()
+			if err != nil {
+				return fmt.Errorf("failed to open attachment %s: %w", a.Name, err)
+			}
+			defer content.Close()
+
+			encoder := base64.NewEncoder(base64.StdEncoding, &lineWriter{w: w})
+			if _, err := io.Copy(encoder, content); err != nil {
+				return fmt.Errorf("failed to read attachment %s: %w", a.Name, err)
+			}
+			return encoder.Close()
+		},
+	}
+}
+
+// withParam adds a parameter to a media type or disposition, encoding it
+// as RFC 2231 asks when it isn't ASCII
+func withParam(value, name, param string) string {
+	mediaType, params, err := mime.ParseMediaType(value)
 	if err != nil {
-		d.logger.Error("Failed to send email via SMTP", zap.Error(err))
+		return value
+	}
+	if param != "" {
+		params[name] = param
+	}
+	return mime.FormatMediaType(mediaType, params)
+}
+
+func (p *mimePart) writeTo(w io.Writer) error {
+	if p.parts == nil {
+		return p.body(w)
+	}
+
+	mw := multipart.NewWriter(w)
+	if err := mw.SetBoundary(p.boundary); err != nil {
 		return err
 	}
+	for _, part := range p.parts {
+		pw, err := mw.CreatePart(part.header)
+		if err != nil {
+			return err
+		}
+		if err := part.writeTo(pw); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
 
-	d.logger.Info("Email sent successfully via SMTP",
-		zap.String("to", strings.Join(message.To, ",")),
-		zap.String("subject", message.Subject))
+func writeQuotedPrintable(w io.Writer, body string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
 
-	return nil
+// lineWriter breaks base64 output into lines of 76 characters
+type lineWriter struct {
+	w    io.Writer
+	line int
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), 76-l.line)
+		if _, err := l.w.Write(p[:n]); err != nil {
+			return written, err
+		}
+		written += n
+		l.line += n
+		p = p[n:]
+		if l.line == 76 {
+			if _, err := io.WriteString(l.w, "\r\n"); err != nil {
+				return written, err
+			}
+			l.line = 0
+		}
+	}
+	return written, nil
 }
 
 func (d *SMTPDriver) SendBatch(ctx context.Context, messages []*Message) error {
@@ -156,18 +582,34 @@ func (d *MailgunDriver) Send(ctx context.Context, message *Message) error {
 	data["to"] = strings.Join(message.To, ",")
 	data["cc"] = strings.Join(message.Cc, ",")
 	data["bcc"] = strings.Join(message.Bcc, ",")
+	if message.Text != "" {
+		data["text"] = message.Text
+	}
+	if message.HTML != "" {
+		data["html"] = message.HTML
+	}
 	for k, v := range message.Headers {
 		data[fmt.Sprintf("h:%s", k)] = v
 	}
 
-	// Convert map[string]string to url.Values
-	form := make(map[string][]string)
-	for k, v := range data {
-		form[k] = []string{v}
+	// Stream the form, attachments included, as the request is sent
+	body, form := io.Pipe()
+	fields := multipart.NewWriter(form)
+	go func() {
+		form.CloseWithError(writeMailgunForm(fields, data, message.Attachments))
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/%s/messages", d.baseURL, d.domain), body)
+	if err != nil {
+		body.Close()
+		return err
 	}
+	req.Header.Set("Content-Type", fields.FormDataContentType())
+	req.SetBasicAuth("api", d.apiKey)
 
 	// Send request
-	resp, err := d.httpClient.PostForm(fmt.Sprintf("%s/%s/messages", d.baseURL, d.domain), form)
+	resp, err := d.httpClient.Do(req)
+	body.Close()
 	if err != nil {
 		d.logger.Error("Failed to send email via Mailgun", zap.Error(err))
 		return err
@@ -192,3 +634,44 @@ func (d *MailgunDriver) Send(ctx context.Context, message *Message) error {
 		zap.String("response", resp.Status))
 	return nil
 }
+
+// writeMailgunForm writes the fields of a Mailgun message and its files.
+// Mailgun refers to inline images by file name, so those are named after
+// their content ID.
+func writeMailgunForm(form *multipart.Writer, data map[string]string, attachments []Attachment) error {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := form.WriteField(k, data[k]); err != nil {
+			return err
+		}
+	}
+
+	for _, a := range attachments {
+		field, name := "attachment", a.Name
+		if a.ContentID != "" {
+			field, name = "inline", a.ContentID
+		}
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", mime.FormatMediaType("form-data", map[string]string{"name": field, "filename": name}))
+		header.Set("Content-Type", a.mediaType())
+		w, err := form.CreatePart(header)
+		if err != nil {
+			return err
+		}
+
+		content, err := a.open()
+		if err != nil {
+			return fmt.Errorf("failed to open attachment %s: %w", a.Name, err)
+		}
+		_, err = io.Copy(w, content)
+		content.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read attachment %s: %w", a.Name, err)
+		}
+	}
+	return form.Close()
+}
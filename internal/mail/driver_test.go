@@ -0,0 +1,75 @@
+package mail
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func buildMessage(message *Message, date time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	err := writeMessage(&buf, message, date, nil)
+	return buf.Bytes(), err
+}
+
+func TestBuildMessageMultipart(t *testing.T) {
+	long := strings.Repeat("x", 2000)
+	raw, err := buildMessage(&Message{
+		From:    "noreply@example.com",
+		To:      []string{"ada@example.com"},
+		Cc:      []string{"bob@example.com"},
+		Subject: "Café menu",
+		Text:    "Hello",
+		HTML:    `<p style="color: red">Hello</p>` + long,
+	}, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	require.NoError(t, err)
+
+	for _, line := range strings.Split(string(raw), "\r\n") {
+		assert.LessOrEqual(t, len(line), 998, "SMTP line limit")
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	require.NoError(t, err)
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	require.NoError(t, err)
+	assert.Equal(t, "Café menu", subject)
+	assert.Equal(t, "bob@example.com", msg.Header.Get("Cc"))
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/alternative", mediaType)
+
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	var types, bodies []string
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		body, err := io.ReadAll(part)
+		require.NoError(t, err)
+		types = append(types, part.Header.Get("Content-Type"))
+		bodies = append(bodies, string(body))
+	}
+	assert.Equal(t, []string{"text/plain; charset=UTF-8", "text/html; charset=UTF-8"}, types)
+	assert.Equal(t, []string{"Hello", `<p style="color: red">Hello</p>` + long}, bodies)
+}
+
+func TestBuildMessageSinglePart(t *testing.T) {
+	raw, err := buildMessage(&Message{To: []string{"ada@example.com"}, Text: "Just text"}, time.Now())
+	require.NoError(t, err)
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain; charset=UTF-8", msg.Header.Get("Content-Type"))
+	assert.Equal(t, "quoted-printable", msg.Header.Get("Content-Transfer-Encoding"))
+}
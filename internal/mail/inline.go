@@ -0,0 +1,555 @@
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// InlineCSS copies the rules of document's <style> elements into the style
+// attributes of the elements they match, because Gmail, Outlook and most
+// webmail clients drop or ignore style sheets. The usual cascade applies:
+// !important beats specificity, which beats source order, and existing
+// style attributes win over non-important rules.
+//
+// Rules that can't be inlined stay in the <style> element for the clients
+// that support them: @media and other at-rules, and selectors with pseudo
+// classes or sibling combinators. Style elements with a media attribute
+// other than all or screen are left alone.
+//
+// Tables, cells and images also get the bgcolor, width, height, align and
+// valign attributes Outlook's Word renderer reads instead of CSS.
+func InlineCSS(document string) (string, error) {
+	doc, err := html.Parse(strings.NewReader(document))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse email HTML: %w", err)
+	}
+
+	var sheet []cssRule
+	for _, style := range findAll(doc, atom.Style) {
+		if media := strings.ToLower(strings.TrimSpace(attr(style, "media"))); media != "" && media != "all" && media != "screen" {
+			continue
+		}
+
+		rules, keep := parseCSS(textContent(style), len(sheet))
+		sheet = append(sheet, rules...)
+		if keep == "" {
+			style.Parent.RemoveChild(style)
+			continue
+		}
+		for c := style.FirstChild; c != nil; c = style.FirstChild {
+			style.RemoveChild(c)
+		}
+		style.AppendChild(&html.Node{Type: html.TextNode, Data: keep})
+	}
+
+	if body := findFirst(doc, atom.Body); body != nil && len(sheet) > 0 {
+		applyRules(body, sheet)
+	}
+
+	var buf bytes.Buffer
+	if !isDocument(document) {
+		// html.Parse wraps fragments in html, head and body; give back only
+		// what was passed in
+		for _, n := range []*html.Node{findFirst(doc, atom.Head), findFirst(doc, atom.Body)} {
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				if err := html.Render(&buf, c); err != nil {
+					return "", err
+				}
+			}
+		}
+		return buf.String(), nil
+	}
+	if err := html.Render(&buf, doc); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// cssRule is one selector of a style rule with the declarations it sets
+type cssRule struct {
+	selector     *cssSelector
+	declarations []cssDeclaration
+	order        int
+}
+
+type cssDeclaration struct {
+	property  string
+	value     string
+	important bool
+}
+
+var (
+	cssComment   = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	cssImportant = regexp.MustCompile(`(?i)\s*!\s*important\s*$`)
+)
+
+// parseCSS splits css into the rules that can be inlined, numbered from
+// order, and the text of those that have to stay in a style sheet
+func parseCSS(css string, order int) ([]cssRule, string) {
+	css = cssComment.ReplaceAllString(css, "")
+
+	var rules []cssRule
+	var keep []string
+	for css = strings.TrimSpace(css); css != ""; css = strings.TrimSpace(css) {
+		if css[0] == '@' {
+			end := atRuleEnd(css)
+			keep = append(keep, strings.TrimSpace(css[:end]))
+			css = css[end:]
+			continue
+		}
+
+		open := strings.IndexByte(css, '{')
+		if open < 0 {
+			break
+		}
+		end := strings.IndexByte(css[open:], '}')
+		if end < 0 {
+			break
+		}
+		end += open
+		selectors, body := css[:open], css[open+1:end]
+		css = css[end+1:]
+
+		declarations := parseDeclarations(body)
+		var unsupported []string
+		for _, s := range strings.Split(selectors, ",") {
+			s = strings.TrimSpace(s)
+			if s == "" {
+				continue
+			}
+			sel, ok := parseSelector(s)
+			if !ok {
+				unsupported = append(unsupported, s)
+				continue
+			}
+			rules = append(rules, cssRule{selector: sel, declarations: declarations, order: order})
+			order++
+		}
+		if len(unsupported) > 0 {
+			keep = append(keep, strings.Join(unsupported, ", ")+" { "+strings.TrimSpace(body)+" }")
+		}
+	}
+	return rules, strings.Join(keep, "\n")
+}
+
+// atRuleEnd returns the length of the at-rule css starts with: up to the
+// semicolon of a statement such as @import, or the brace closing a block
+// such as @media
+func atRuleEnd(css string) int {
+	depth := 0
+	for i := 0; i < len(css); i++ {
+		switch css[i] {
+		case ';':
+			if depth == 0 {
+				return i + 1
+			}
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(css)
+}
+
+// parseDeclarations parses the declarations of a rule or style attribute,
+// splitting on semicolons outside quotes and parentheses
+func parseDeclarations(block string) []cssDeclaration {
+	var declarations []cssDeclaration
+	var quote byte
+	depth, start := 0, 0
+	for i := 0; i <= len(block); i++ {
+		if i < len(block) {
+			switch c := block[i]; {
+			case quote != 0:
+				if c == quote {
+					quote = 0
+				}
+				continue
+			case c == '"' || c == '\'':
+				quote = c
+				continue
+			case c == '(':
+				depth++
+				continue
+			case c == ')':
+				depth--
+				continue
+			case c != ';' || depth > 0:
+				continue
+			}
+		}
+
+		property, value, ok := strings.Cut(block[start:i], ":")
+		start = i + 1
+		property = strings.ToLower(strings.TrimSpace(property))
+		if !ok || property == "" {
+			continue
+		}
+		d := cssDeclaration{property: property, value: strings.TrimSpace(value)}
+		if loc := cssImportant.FindStringIndex(d.value); loc != nil {
+			d.value, d.important = strings.TrimSpace(d.value[:loc[0]]), true
+		}
+		if d.value != "" {
+			declarations = append(declarations, d)
+		}
+	}
+	return declarations
+}
+
+// cssSelector is a selector made of compound selectors joined by descendant
+// (' ') or child ('>') combinators
+type cssSelector struct {
+	compounds   []cssCompound
+	combinators []byte
+	specificity [3]int
+}
+
+type cssCompound struct {
+	tag     string
+	id      string
+	classes []string
+	attrs   []cssAttr
+}
+
+type cssAttr struct {
+	name     string
+	value    string
+	hasValue bool
+}
+
+// parseSelector parses the selectors inlining supports: type, universal,
+// class, ID and attribute (presence or exact value) selectors, combined
+// with descendant and child combinators
+func parseSelector(s string) (*cssSelector, bool) {
+	sel := &cssSelector{}
+	current := cssCompound{}
+	empty := true
+	var combinator byte
+
+	push := func() {
+		if len(sel.compounds) > 0 {
+			if combinator == 0 {
+				combinator = ' '
+			}
+			sel.combinators = append(sel.combinators, combinator)
+		}
+		sel.compounds = append(sel.compounds, current)
+		current, empty, combinator = cssCompound{}, true, 0
+	}
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if !empty {
+				push()
+			}
+			i++
+		case c == '>':
+			if !empty {
+				push()
+			}
+			if len(sel.compounds) == 0 || combinator != 0 {
+				return nil, false
+			}
+			combinator = '>'
+			i++
+		case c == '*':
+			empty = false
+			i++
+		case c == '.' || c == '#':
+			name, n := cssIdent(s[i+1:])
+			if name == "" {
+				return nil, false
+			}
+			if c == '.' {
+				current.classes = append(current.classes, name)
+				sel.specificity[1]++
+			} else {
+				current.id = name
+				sel.specificity[0]++
+			}
+			empty = false
+			i += 1 + n
+		case c == '[':
+			end := strings.IndexByte(s[i:], ']')
+			if end < 0 {
+				return nil, false
+			}
+			a, ok := parseAttrSelector(s[i+1 : i+end])
+			if !ok {
+				return nil, false
+			}
+			current.attrs = append(current.attrs, a)
+			sel.specificity[1]++
+			empty = false
+			i += end + 1
+		default:
+			name, n := cssIdent(s[i:])
+			if name == "" || !empty {
+				// Pseudo classes, sibling combinators and escapes
+				return nil, false
+			}
+			current.tag = strings.ToLower(name)
+			sel.specificity[2]++
+			empty = false
+			i += n
+		}
+	}
+	if empty {
+		return nil, false
+	}
+	push()
+	return sel, true
+}
+
+func parseAttrSelector(s string) (cssAttr, bool) {
+	name, value, hasValue := strings.Cut(s, "=")
+	name = strings.ToLower(strings.TrimSpace(name))
+	if ident, n := cssIdent(name); ident == "" || n != len(name) {
+		return cssAttr{}, false
+	}
+	value = strings.TrimSpace(value)
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		value = value[1 : len(value)-1]
+	}
+	return cssAttr{name: name, value: value, hasValue: hasValue}, true
+}
+
+// cssIdent returns the identifier s starts with and its length
+func cssIdent(s string) (string, int) {
+	n := 0
+	for n < len(s) {
+		c := s[n]
+		if c == '-' || c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80 {
+			n++
+			continue
+		}
+		break
+	}
+	return s[:n], n
+}
+
+func (sel *cssSelector) matches(n *html.Node) bool {
+	return sel.matchFrom(n, len(sel.compounds)-1)
+}
+
+func (sel *cssSelector) matchFrom(n *html.Node, i int) bool {
+	if !sel.compounds[i].matches(n) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+	for p := n.Parent; p != nil && p.Type == html.ElementNode; p = p.Parent {
+		if sel.matchFrom(p, i-1) {
+			return true
+		}
+		if sel.combinators[i-1] == '>' {
+			break
+		}
+	}
+	return false
+}
+
+func (c *cssCompound) matches(n *html.Node) bool {
+	if c.tag != "" && c.tag != n.Data {
+		return false
+	}
+	if c.id != "" && attr(n, "id") != c.id {
+		return false
+	}
+	if len(c.classes) > 0 {
+		classes := strings.Fields(attr(n, "class"))
+		for _, want := range c.classes {
+			found := false
+			for _, class := range classes {
+				if class == want {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+	for _, a := range c.attrs {
+		value, ok := lookupAttr(n, a.name)
+		if !ok || a.hasValue && value != a.value {
+			return false
+		}
+	}
+	return true
+}
+
+// applied is a declaration matched to an element, ranked by the cascade
+type applied struct {
+	cssDeclaration
+	inline      bool
+	specificity [3]int
+	order       int
+}
+
+func (a applied) less(b applied) bool {
+	if a.important != b.important {
+		return !a.important
+	}
+	if a.inline != b.inline {
+		return !a.inline
+	}
+	if a.specificity != b.specificity {
+		for i := range a.specificity {
+			if a.specificity[i] != b.specificity[i] {
+				return a.specificity[i] < b.specificity[i]
+			}
+		}
+	}
+	return a.order < b.order
+}
+
+// applyRules writes the declarations of the matching rules into the style
+// attribute of n and each element below it
+func applyRules(n *html.Node, sheet []cssRule) {
+	if n.Type == html.ElementNode {
+		var matched []applied
+		for _, rule := range sheet {
+			if !rule.selector.matches(n) {
+				continue
+			}
+			for _, d := range rule.declarations {
+				matched = append(matched, applied{cssDeclaration: d, specificity: rule.selector.specificity, order: rule.order})
+			}
+		}
+		if len(matched) > 0 {
+			for i, d := range parseDeclarations(attr(n, "style")) {
+				matched = append(matched, applied{cssDeclaration: d, inline: true, order: i})
+			}
+			sort.SliceStable(matched, func(i, j int) bool { return matched[i].less(matched[j]) })
+
+			values := make(map[string]string)
+			var properties []string
+			for _, d := range matched {
+				if _, seen := values[d.property]; !seen {
+					properties = append(properties, d.property)
+				}
+				values[d.property] = d.value
+			}
+			declarations := make([]string, len(properties))
+			for i, property := range properties {
+				declarations[i] = property + ": " + values[property]
+			}
+			setAttr(n, "style", strings.Join(declarations, "; "))
+			legacyAttributes(n, values)
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		applyRules(c, sheet)
+	}
+}
+
+var dimension = regexp.MustCompile(`^(\d+)(px|%)?$`)
+
+// legacyAttributes mirrors styles as the presentational attributes Outlook
+// renders with, without replacing attributes that are already set
+func legacyAttributes(n *html.Node, styles map[string]string) {
+	switch n.DataAtom {
+	case atom.Table, atom.Td, atom.Th:
+		if color, ok := styles["background-color"]; ok {
+			setDefaultAttr(n, "bgcolor", color)
+		}
+		if n.DataAtom != atom.Table {
+			if align, ok := styles["text-align"]; ok {
+				setDefaultAttr(n, "align", align)
+			}
+			if valign, ok := styles["vertical-align"]; ok {
+				setDefaultAttr(n, "valign", valign)
+			}
+		}
+	case atom.Img:
+	default:
+		return
+	}
+	for _, property := range []string{"width", "height"} {
+		if m := dimension.FindStringSubmatch(styles[property]); m != nil {
+			value := m[1]
+			if m[2] == "%" {
+				value += "%"
+			}
+			setDefaultAttr(n, property, value)
+		}
+	}
+}
+
+func isDocument(document string) bool {
+	lower := strings.ToLower(document)
+	return strings.Contains(lower, "<html") || strings.Contains(lower, "<!doctype")
+}
+
+func findAll(n *html.Node, a atom.Atom) []*html.Node {
+	var found []*html.Node
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		found = append(found, n)
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		found = append(found, findAll(c, a)...)
+	}
+	return found
+}
+
+func findFirst(n *html.Node, a atom.Atom) *html.Node {
+	if found := findAll(n, a); len(found) > 0 {
+		return found[0]
+	}
+	return nil
+}
+
+func textContent(n *html.Node) string {
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.TextNode {
+			b.WriteString(c.Data)
+		}
+	}
+	return b.String()
+}
+
+func lookupAttr(n *html.Node, name string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == name {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+func attr(n *html.Node, name string) string {
+	value, _ := lookupAttr(n, name)
+	return value
+}
+
+func setAttr(n *html.Node, name, value string) {
+	for i, a := range n.Attr {
+		if a.Namespace == "" && a.Key == name {
+			n.Attr[i].Val = value
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: name, Val: value})
+}
+
+func setDefaultAttr(n *html.Node, name, value string) {
+	if _, ok := lookupAttr(n, name); !ok {
+		n.Attr = append(n.Attr, html.Attribute{Key: name, Val: value})
+	}
+}
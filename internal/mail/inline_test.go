@@ -0,0 +1,77 @@
+package mail
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInlineCSSCascade(t *testing.T) {
+	html, err := InlineCSS(`<style>
+		p { color: black; margin: 0 }
+		.note { color: gray; }
+		#lead { color: navy }
+		p.note { font-size: 14px }
+		div > .note { font-weight: bold }
+		.quiet { color: silver !important }
+	</style>
+	<div><p id="lead" class="note">Lead</p></div>
+	<p class="note quiet" style="color: red">Quiet</p>
+	<section><p class="note">Deep</p></section>`)
+	require.NoError(t, err)
+
+	// IDs beat classes beat types; existing style attributes beat rules but
+	// not !important ones, which are inlined without the flag
+	assert.Contains(t, html, `<p id="lead" class="note" style="color: navy; margin: 0; font-size: 14px; font-weight: bold">Lead</p>`)
+	assert.Contains(t, html, `<p class="note quiet" style="color: silver; margin: 0; font-size: 14px">Quiet</p>`)
+	assert.Contains(t, html, `<p class="note" style="color: gray; margin: 0; font-size: 14px">Deep</p>`)
+	assert.NotContains(t, html, "<style>")
+	assert.NotContains(t, html, "<html>", "fragments stay fragments")
+}
+
+func TestInlineCSSKeepsWhatCannotBeInlined(t *testing.T) {
+	html, err := InlineCSS(`<!DOCTYPE html><html><head><style>
+		/* Gmail keeps head styles for media queries, so they stay */
+		@media only screen and (max-width: 600px) { .container { width: 100% !important; } }
+		a { color: #0a7; }
+		a:hover, a.button { text-decoration: underline }
+	</style><style media="print">a { color: black }</style></head>
+	<body><a class="button" href="https://example.com">Go</a></body></html>`)
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(html, "<!DOCTYPE html>"))
+	assert.Contains(t, html, "@media only screen and (max-width: 600px) { .container { width: 100% !important; } }")
+	assert.Contains(t, html, "a:hover { text-decoration: underline }")
+	assert.Contains(t, html, `<style media="print">a { color: black }</style>`)
+	assert.Contains(t, html, `<a class="button" href="https://example.com" style="color: #0a7; text-decoration: underline">Go</a>`)
+	assert.NotContains(t, html, "Gmail keeps", "comments are dropped")
+}
+
+func TestInlineCSSOutlookAttributes(t *testing.T) {
+	html, err := InlineCSS(`<style>
+		table.wrapper { width: 600px; background-color: #ffffff }
+		td { background-color: #f4f4f4; text-align: center; vertical-align: top }
+		img { width: 100%; height: auto }
+		td.bordered { background: url("data:image/png;base64,AAAA;BBBB") }
+	</style>
+	<table class="wrapper"><tr><td align="left" class="bordered"><img src="logo.png"></td></tr></table>`)
+	require.NoError(t, err)
+
+	assert.Contains(t, html, `<table class="wrapper" style="width: 600px; background-color: #ffffff" bgcolor="#ffffff" width="600">`)
+	// Attributes already set are kept, and semicolons inside url() survive
+	assert.Contains(t, html, `<td align="left" class="bordered" style="background-color: #f4f4f4; text-align: center; vertical-align: top; background: url(&#34;data:image/png;base64,AAAA;BBBB&#34;)" bgcolor="#f4f4f4" valign="top">`)
+	assert.Contains(t, html, `<img src="logo.png" style="width: 100%; height: auto" width="100%"/>`)
+}
+
+func TestParseSelector(t *testing.T) {
+	for _, s := range []string{"p", "*", ".a.b", "#id", "td[align=center]", "a[href]", "div > p", "table td .x", "DIV.note"} {
+		_, ok := parseSelector(s)
+		assert.True(t, ok, s)
+	}
+	for _, s := range []string{"a:hover", "p::first-line", "h1 + p", "h1 ~ p", "> p", "p >", "a[href^=http]", `.a\:b`} {
+		_, ok := parseSelector(s)
+		assert.False(t, ok, s)
+	}
+}
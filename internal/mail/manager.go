@@ -3,11 +3,16 @@ package mail
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"html/template"
+	"io"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
+	views "github.com/mrhoseah/dolphin/internal/template"
 	"go.uber.org/zap"
 )
 
@@ -42,12 +47,33 @@ func (m *BaseMailable) GetFrom() string {
 	return m.From
 }
 
+// Options controls how messages rendered from templates are prepared
+// before sending, mirroring the mail section of the configuration
+type Options struct {
+	// InlineCSS copies <style> rules into style attributes, see InlineCSS
+	InlineCSS bool
+	// PlainText adds a text part derived from the HTML, see PlainText
+	PlainText bool
+	// MaxSize refuses messages larger than this many bytes once encoded,
+	// see Validate; zero allows any size
+	MaxSize int64
+}
+
+// DefaultOptions inlines CSS, adds plain text parts and refuses messages
+// over DefaultMaxSize
+func DefaultOptions() Options {
+	return Options{InlineCSS: true, PlainText: true, MaxSize: DefaultMaxSize}
+}
+
 // MailManager manages mail sending
 type MailManager struct {
-	driver      Driver
-	templates   map[string]*template.Template
-	templateDir string
-	logger      *zap.Logger
+	driver       Driver
+	templates    map[string]*template.Template
+	templateDir  string
+	views        *views.Engine
+	options      Options
+	suppressions SuppressionStore
+	logger       *zap.Logger
 }
 
 // NewMailManager creates a new mail manager
@@ -56,24 +82,95 @@ func NewMailManager(driver Driver, templateDir string, logger *zap.Logger) *Mail
 		driver:      driver,
 		templates:   make(map[string]*template.Template),
 		templateDir: templateDir,
+		options:     DefaultOptions(),
 		logger:      logger,
 	}
 }
 
-// Send sends an email message
+// Send sends an email message. Recipients on the suppression list, when
+// one is set, are left out; ErrSuppressed is returned when none are left.
 func (m *MailManager) Send(ctx context.Context, message *Message) error {
+	if err := Validate(message, m.options.MaxSize); err != nil {
+		return err
+	}
+	message, err := m.withoutSuppressed(ctx, message)
+	if err != nil {
+		return err
+	}
 	return m.driver.Send(ctx, message)
 }
 
-// SendBatch sends multiple email messages
+// SendBatch sends multiple email messages, none of them unless all are
+// valid. Messages to suppressed recipients only are skipped.
 func (m *MailManager) SendBatch(ctx context.Context, messages []*Message) error {
-	return m.driver.SendBatch(ctx, messages)
+	for _, message := range messages {
+		if err := Validate(message, m.options.MaxSize); err != nil {
+			return err
+		}
+	}
+
+	sendable := make([]*Message, 0, len(messages))
+	for _, message := range messages {
+		message, err := m.withoutSuppressed(ctx, message)
+		if errors.Is(err, ErrSuppressed) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		sendable = append(sendable, message)
+	}
+	if len(sendable) == 0 {
+		return nil
+	}
+	return m.driver.SendBatch(ctx, sendable)
+}
+
+// withoutSuppressed returns message without its suppressed recipients
+func (m *MailManager) withoutSuppressed(ctx context.Context, message *Message) (*Message, error) {
+	if m.suppressions == nil {
+		return message, nil
+	}
+
+	recipients := append(append(append([]string(nil), message.To...), message.Cc...), message.Bcc...)
+	suppressed, err := m.suppressions.Suppressed(ctx, recipients)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check the suppression list: %w", err)
+	}
+	if len(suppressed) == 0 {
+		return message, nil
+	}
+
+	keep := func(addresses []string) []string {
+		var kept []string
+		for _, address := range addresses {
+			if _, ok := suppressed[normalizeEmail(address)]; !ok {
+				kept = append(kept, address)
+			}
+		}
+		return kept
+	}
+	filtered := *message
+	filtered.To, filtered.Cc, filtered.Bcc = keep(message.To), keep(message.Cc), keep(message.Bcc)
+
+	left := make([]string, 0, len(suppressed))
+	for email, suppression := range suppressed {
+		left = append(left, email)
+		m.logger.Info("Left out suppressed recipient",
+			zap.String("email", email),
+			zap.String("reason", suppression.Reason),
+			zap.String("subject", message.Subject))
+	}
+	if len(filtered.To)+len(filtered.Cc)+len(filtered.Bcc) == 0 {
+		sort.Strings(left)
+		return nil, fmt.Errorf("%w: %s", ErrSuppressed, strings.Join(left, ", "))
+	}
+	return &filtered, nil
 }
 
 // SendMailable sends a mailable class
 func (m *MailManager) SendMailable(ctx context.Context, mailable Mailable) error {
-	message := mailable.Build()
-	return m.driver.Send(ctx, message)
+	return m.Send(ctx, mailable.Build())
 }
 
 // SendMailableBatch sends multiple mailable classes
@@ -82,7 +179,7 @@ func (m *MailManager) SendMailableBatch(ctx context.Context, mailables []Mailabl
 	for i, mailable := range mailables {
 		messages[i] = mailable.Build()
 	}
-	return m.driver.SendBatch(ctx, messages)
+	return m.SendBatch(ctx, messages)
 }
 
 // SendTemplate sends an email using a template
@@ -106,8 +203,59 @@ func (m *MailManager) SendTemplate(ctx context.Context, templateName string, dat
 		HTML:    html.String(),
 		From:    m.getDefaultFrom(),
 	}
+	if err := m.Prepare(message); err != nil {
+		return err
+	}
 
-	return m.driver.Send(ctx, message)
+	return m.Send(ctx, message)
+}
+
+// SendEmail renders the email template name (a TypeEmail template of the
+// engine set with SetViews, such as ui/views/emails/welcome.html) and sends
+// it prepared as Options ask, with attachments. Inline attachments are the
+// images the template shows with <img src="cid:...">.
+func (m *MailManager) SendEmail(ctx context.Context, name string, data views.TemplateData, to []string, subject string, attachments ...Attachment) error {
+	if m.views == nil {
+		return fmt.Errorf("failed to render email %s: no template engine set", name)
+	}
+
+	html, err := m.views.RenderEmail(name, data)
+	if err != nil {
+		return err
+	}
+
+	message := &Message{
+		To:          to,
+		Subject:     subject,
+		HTML:        html,
+		From:        m.getDefaultFrom(),
+		Attachments: attachments,
+	}
+	if err := m.Prepare(message); err != nil {
+		return err
+	}
+
+	return m.Send(ctx, message)
+}
+
+// Prepare makes message's HTML safe for email clients as Options ask:
+// inlining its CSS and, when it has no text part, deriving one
+func (m *MailManager) Prepare(message *Message) error {
+	if message.HTML == "" {
+		return nil
+	}
+	if m.options.InlineCSS {
+		inlined, err := InlineCSS(message.HTML)
+		if err != nil {
+			return err
+		}
+		message.HTML = inlined
+	}
+	// After inlining, so that elements hidden by class are left out too
+	if m.options.PlainText && message.Text == "" {
+		message.Text = PlainText(message.HTML)
+	}
+	return nil
 }
 
 // SendTemplateWithText sends an email using both HTML and text templates
@@ -144,8 +292,11 @@ func (m *MailManager) SendTemplateWithText(ctx context.Context, templateName str
 		Text:    text.String(),
 		From:    m.getDefaultFrom(),
 	}
+	if err := m.Prepare(message); err != nil {
+		return err
+	}
 
-	return m.driver.Send(ctx, message)
+	return m.Send(ctx, message)
 }
 
 // loadTemplate loads a template from the template directory
@@ -174,13 +325,22 @@ func (m *MailManager) getDefaultFrom() string {
 	return "noreply@example.com"
 }
 
-// QueueMail queues an email for later sending
+// QueueMail queues an email for later sending. Invalid messages are
+// refused when queued rather than when sent.
 func (m *MailManager) QueueMail(ctx context.Context, message *Message, delay time.Duration) error {
+	if err := Validate(message, m.options.MaxSize); err != nil {
+		return err
+	}
+
 	// This is a simplified implementation
 	// In a real implementation, you'd use a proper queue system like Redis, RabbitMQ, etc.
 	go func() {
 		time.Sleep(delay)
-		if err := m.driver.Send(context.Background(), message); err != nil {
+		message, err := m.withoutSuppressed(context.Background(), message)
+		if err == nil {
+			err = m.driver.Send(context.Background(), message)
+		}
+		if err != nil {
 			m.logger.Error("Failed to send queued email", zap.Error(err))
 		}
 	}()
@@ -217,6 +377,30 @@ func (m *MailManager) SetDriver(driver Driver) {
 	m.driver = driver
 }
 
+// SetViews sets the template engine SendEmail renders with
+func (m *MailManager) SetViews(engine *views.Engine) {
+	m.views = engine
+}
+
+// SetOptions sets how messages rendered from templates are prepared
+func (m *MailManager) SetOptions(options Options) {
+	m.options = options
+}
+
+// SetSuppressions leaves recipients on the list out of every message sent
+// from now on
+func (m *MailManager) SetSuppressions(store SuppressionStore) {
+	m.suppressions = store
+}
+
+// Close closes the connections the driver keeps open, if any
+func (m *MailManager) Close() error {
+	if closer, ok := m.driver.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
 // Common email templates and helpers
 
 // WelcomeEmail represents a welcome email
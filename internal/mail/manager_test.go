@@ -0,0 +1,106 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	views "github.com/mrhoseah/dolphin/internal/template"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type recordingDriver struct {
+	sent []*Message
+}
+
+func (d *recordingDriver) Send(ctx context.Context, message *Message) error {
+	d.sent = append(d.sent, message)
+	return nil
+}
+
+func (d *recordingDriver) SendBatch(ctx context.Context, messages []*Message) error {
+	d.sent = append(d.sent, messages...)
+	return nil
+}
+
+func newEmailViews(t *testing.T, emails map[string]string) *views.Engine {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range emails {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name+".html"), []byte(content), 0644))
+	}
+	config := views.DefaultConfig()
+	config.LayoutsDir, config.PartialsDir, config.PagesDir = "", "", ""
+	config.ComponentsDir, config.ErrorsDir = "", ""
+	config.EmailsDir = dir
+	config.AutoReload = false
+	config.EnableLogging = false
+	engine, err := views.NewEngine(config, nil)
+	require.NoError(t, err)
+	return engine
+}
+
+func TestSendEmail(t *testing.T) {
+	engine := newEmailViews(t, map[string]string{
+		"welcome": `<html><head><style>.preheader { display: none } h1 { color: #0a7 }</style></head>` +
+			`<body><span class="preheader">Get started</span><h1>Hi {{.Name}}</h1></body></html>`,
+	})
+
+	tests := []struct {
+		name    string
+		options Options
+		html    string
+		text    string
+	}{
+		{"default", DefaultOptions(), `<h1 style="color: #0a7">Hi Ada</h1>`, "Hi Ada"},
+		{"off", Options{}, `<h1>Hi Ada</h1>`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driver := &recordingDriver{}
+			m := NewMailManager(driver, "", zap.NewNop())
+			m.SetViews(engine)
+			m.SetOptions(tt.options)
+
+			require.NoError(t, m.SendEmail(context.Background(), "welcome", views.TemplateData{"Name": "Ada"}, []string{"ada@example.com"}, "Welcome"))
+			require.Len(t, driver.sent, 1)
+			assert.Contains(t, driver.sent[0].HTML, tt.html)
+			assert.Equal(t, tt.text, driver.sent[0].Text)
+		})
+	}
+}
+
+func TestSendEmailWithoutViews(t *testing.T) {
+	m := NewMailManager(&recordingDriver{}, "", zap.NewNop())
+	assert.EqualError(t, m.SendEmail(context.Background(), "welcome", nil, nil, ""), "failed to render email welcome: no template engine set")
+}
+
+func TestSendEmailAttachments(t *testing.T) {
+	engine := newEmailViews(t, map[string]string{
+		"invoice": `<img src="cid:logo" alt="Acme"><p>Invoice {{.Number}}</p>`,
+	})
+	driver := &recordingDriver{}
+	m := NewMailManager(driver, "", zap.NewNop())
+	m.SetViews(engine)
+
+	logo := Attachment{Name: "logo.png", Data: []byte("PNG")}
+	invoice := Attachment{Name: "invoice.pdf", Data: []byte("PDF")}
+	data := views.TemplateData{"Number": 42}
+
+	err := m.SendEmail(context.Background(), "invoice", data, []string{"ada@example.com"}, "Invoice", invoice)
+	assert.EqualError(t, err, "email refers to cid:logo but has no inline attachment with that content ID")
+	assert.Empty(t, driver.sent, "invalid emails are not handed to the driver")
+
+	m.SetOptions(Options{MaxSize: 100})
+	err = m.SendEmail(context.Background(), "invoice", data, []string{"ada@example.com"}, "Invoice", invoice, logo.Inline("logo"))
+	assert.ErrorIs(t, err, ErrMessageTooLarge)
+
+	m.SetOptions(DefaultOptions())
+	require.NoError(t, m.SendEmail(context.Background(), "invoice", data, []string{"ada@example.com"}, "Invoice", invoice, logo.Inline("logo")))
+	require.Len(t, driver.sent, 1)
+	assert.Len(t, driver.sent[0].Attachments, 2)
+	assert.Equal(t, "Acme\n\nInvoice 42", driver.sent[0].Text)
+}
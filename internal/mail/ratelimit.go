@@ -0,0 +1,140 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mrhoseah/dolphin/internal/ratelimit"
+	"go.uber.org/zap"
+)
+
+// DefaultRateLimit is the key of RateLimitedDriver limits applying to the
+// domains not listed
+const DefaultRateLimit = "default"
+
+// ErrRateLimited is returned for messages that would wait for a rate limit
+// beyond their context's deadline
+var ErrRateLimited = errors.New("email rate limit reached")
+
+// RateLimit caps the messages sent to a recipient domain
+type RateLimit struct {
+	Messages int
+	Per      time.Duration
+}
+
+// RateLimitedDriver paces the messages a driver sends to each recipient
+// domain, since providers such as Gmail defer or block senders that go
+// faster than they like. A message over a limit waits for the next window,
+// or fails with ErrRateLimited when its deadline comes first. Limits are
+// counted by a ratelimit.RateLimiter, shared between processes when it is
+// backed by Redis.
+type RateLimitedDriver struct {
+	driver  Driver
+	limiter ratelimit.RateLimiter
+	limits  map[string]RateLimit
+	logger  *zap.Logger
+}
+
+// NewRateLimitedDriver creates a driver sending through driver within
+// limits, keyed by lowercase domain or DefaultRateLimit
+func NewRateLimitedDriver(driver Driver, limiter ratelimit.RateLimiter, limits map[string]RateLimit, logger *zap.Logger) *RateLimitedDriver {
+	normalized := make(map[string]RateLimit, len(limits))
+	for domain, limit := range limits {
+		if limit.Messages > 0 && limit.Per > 0 {
+			normalized[strings.ToLower(domain)] = limit
+		}
+	}
+	return &RateLimitedDriver{driver: driver, limiter: limiter, limits: normalized, logger: logger}
+}
+
+func (d *RateLimitedDriver) Send(ctx context.Context, message *Message) error {
+	if err := d.wait(ctx, message); err != nil {
+		return err
+	}
+	return d.driver.Send(ctx, message)
+}
+
+func (d *RateLimitedDriver) SendBatch(ctx context.Context, messages []*Message) error {
+	for _, message := range messages {
+		if err := d.Send(ctx, message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the driver, if it holds connections
+func (d *RateLimitedDriver) Close() error {
+	if closer, ok := d.driver.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// wait returns once each domain message goes to has room for it
+func (d *RateLimitedDriver) wait(ctx context.Context, message *Message) error {
+	for _, domain := range recipientDomains(message) {
+		limit, ok := d.limits[domain]
+		if !ok {
+			limit, ok = d.limits[DefaultRateLimit]
+		}
+		if !ok {
+			continue
+		}
+		if err := d.waitFor(ctx, domain, limit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *RateLimitedDriver) waitFor(ctx context.Context, domain string, limit RateLimit) error {
+	for {
+		allowed, err := d.limiter.Allow(ctx, "mail:"+domain, limit.Messages, limit.Per)
+		if err != nil {
+			// Mail isn't held back because the limiter is unavailable
+			d.logger.Warn("Mail rate limiter unavailable", zap.String("domain", domain), zap.Error(err))
+			return nil
+		}
+		if allowed {
+			return nil
+		}
+
+		next := time.Now().Truncate(limit.Per).Add(limit.Per)
+		if deadline, ok := ctx.Deadline(); ok && deadline.Before(next) {
+			return fmt.Errorf("%w: %s allows %d messages per %s", ErrRateLimited, domain, limit.Messages, limit.Per)
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// recipientDomains returns the lowercase domains of the recipients of
+// message, sorted
+func recipientDomains(message *Message) []string {
+	seen := make(map[string]bool)
+	for _, list := range [][]string{message.To, message.Cc, message.Bcc} {
+		for _, address := range list {
+			email := normalizeEmail(address)
+			if at := strings.LastIndex(email, "@"); at >= 0 {
+				seen[email[at+1:]] = true
+			}
+		}
+	}
+	domains := make([]string, 0, len(seen))
+	for domain := range seen {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+	return domains
+}
@@ -0,0 +1,72 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/ratelimit"
+)
+
+// failingLimiter is a rate limiter whose store is unavailable
+type failingLimiter struct {
+	ratelimit.RateLimiter
+}
+
+func (failingLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (bool, error) {
+	return false, errors.New("redis: connection refused")
+}
+
+func TestRateLimitedDriver(t *testing.T) {
+	sent := &recordingDriver{}
+	driver := NewRateLimitedDriver(sent, ratelimit.NewMemoryRateLimiter(), map[string]RateLimit{
+		"Gmail.com":      {Messages: 2, Per: time.Hour},
+		DefaultRateLimit: {Messages: 3, Per: time.Hour},
+	}, zap.NewNop())
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, driver.Send(ctx, &Message{To: []string{"ada@gmail.com"}}))
+	}
+
+	// Waiting for the next hour is past the deadline
+	short, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	err := driver.Send(short, &Message{To: []string{"Bob <bob@GMAIL.com>"}})
+	assert.ErrorIs(t, err, ErrRateLimited)
+	assert.EqualError(t, err, "email rate limit reached: gmail.com allows 2 messages per 1h0m0s")
+	assert.True(t, IsTransient(err))
+
+	// Other domains have limits of their own
+	for i := 0; i < 3; i++ {
+		require.NoError(t, driver.Send(short, &Message{To: []string{"carol@example.com"}}))
+	}
+	assert.ErrorIs(t, driver.Send(short, &Message{To: []string{"dave@example.com"}}), ErrRateLimited)
+	assert.Len(t, sent.sent, 5)
+
+	// Messages wait for the next window
+	driver = NewRateLimitedDriver(sent, ratelimit.NewMemoryRateLimiter(), map[string]RateLimit{
+		"example.com": {Messages: 1, Per: 200 * time.Millisecond},
+	}, zap.NewNop())
+	require.NoError(t, driver.Send(ctx, &Message{To: []string{"ada@example.com"}}))
+	require.NoError(t, driver.Send(ctx, &Message{To: []string{"bob@example.com"}}))
+	assert.Len(t, sent.sent, 7)
+
+	// Mail isn't held back when the limiter fails
+	driver = NewRateLimitedDriver(sent, failingLimiter{}, map[string]RateLimit{DefaultRateLimit: {Messages: 1, Per: time.Hour}}, zap.NewNop())
+	require.NoError(t, driver.Send(ctx, &Message{To: []string{"ada@example.com"}}))
+}
+
+func TestRecipientDomains(t *testing.T) {
+	domains := recipientDomains(&Message{
+		To:  []string{"Ada <ada@Example.com>", "bob@gmail.com"},
+		Cc:  []string{"carol@example.com"},
+		Bcc: []string{"not-an-address"},
+	})
+	assert.Equal(t, []string{"example.com", "gmail.com"}, domains)
+}
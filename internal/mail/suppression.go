@@ -0,0 +1,217 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"net/mail"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Reasons an address is suppressed
+const (
+	ReasonBounce    = "bounce"
+	ReasonComplaint = "complaint"
+	ReasonManual    = "manual"
+)
+
+// ErrSuppressed is returned, without sending, for messages whose
+// recipients are all on the suppression list
+var ErrSuppressed = errors.New("email not sent: all recipients are suppressed")
+
+// Suppression is an address mail is no longer sent to, because mail to it
+// bounced or its owner marked mail as spam. Sending to such addresses
+// anyway hurts the sender's reputation with every provider.
+type Suppression struct {
+	Email string `json:"email"`
+	// Reason is ReasonBounce, ReasonComplaint or ReasonManual
+	Reason string `json:"reason"`
+	// Source is where the suppression came from, such as "ses" or "mailgun"
+	Source string `json:"source"`
+	// Detail is the provider's diagnostic, such as "550 5.1.1 user unknown"
+	Detail    string    `json:"detail,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SuppressionStore keeps the suppression list. Addresses are compared
+// without regard to case.
+type SuppressionStore interface {
+	// Suppress adds an address, or updates its reason if already listed
+	Suppress(ctx context.Context, suppression Suppression) error
+
+	// Suppressed returns the suppressions of the listed addresses among
+	// emails, keyed by lowercase address
+	Suppressed(ctx context.Context, emails []string) (map[string]Suppression, error)
+
+	// Remove takes an address off the list, reporting whether it was listed
+	Remove(ctx context.Context, email string) (bool, error)
+
+	// List returns the whole list, most recent first
+	List(ctx context.Context) ([]Suppression, error)
+}
+
+// normalizeEmail returns the lowercase address of email, which may have a
+// display name, as in "Ada <ada@example.com>"
+func normalizeEmail(email string) string {
+	if parsed, err := mail.ParseAddress(email); err == nil {
+		email = parsed.Address
+	}
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// MemorySuppressionStore keeps the suppression list in memory, for tests
+// and single-process setups
+type MemorySuppressionStore struct {
+	mu           sync.RWMutex
+	suppressions map[string]Suppression
+}
+
+// NewMemorySuppressionStore creates an in-memory suppression list
+func NewMemorySuppressionStore() *MemorySuppressionStore {
+	return &MemorySuppressionStore{suppressions: make(map[string]Suppression)}
+}
+
+func (s *MemorySuppressionStore) Suppress(ctx context.Context, suppression Suppression) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	suppression.Email = normalizeEmail(suppression.Email)
+	if existing, ok := s.suppressions[suppression.Email]; ok {
+		suppression.CreatedAt = existing.CreatedAt
+	} else if suppression.CreatedAt.IsZero() {
+		suppression.CreatedAt = time.Now()
+	}
+	s.suppressions[suppression.Email] = suppression
+	return nil
+}
+
+func (s *MemorySuppressionStore) Suppressed(ctx context.Context, emails []string) (map[string]Suppression, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	found := make(map[string]Suppression)
+	for _, email := range emails {
+		if suppression, ok := s.suppressions[normalizeEmail(email)]; ok {
+			found[suppression.Email] = suppression
+		}
+	}
+	return found, nil
+}
+
+func (s *MemorySuppressionStore) Remove(ctx context.Context, email string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	email = normalizeEmail(email)
+	_, ok := s.suppressions[email]
+	delete(s.suppressions, email)
+	return ok, nil
+}
+
+func (s *MemorySuppressionStore) List(ctx context.Context) ([]Suppression, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]Suppression, 0, len(s.suppressions))
+	for _, suppression := range s.suppressions {
+		list = append(list, suppression)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+	return list, nil
+}
+
+// SuppressionRecord is the row DBSuppressionStore keeps per address
+type SuppressionRecord struct {
+	ID        uint   `gorm:"primarykey"`
+	Email     string `gorm:"size:255;uniqueIndex;not null"`
+	Reason    string `gorm:"size:20;not null"`
+	Source    string `gorm:"size:50"`
+	Detail    string `gorm:"size:1000"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// TableName returns the table name for the SuppressionRecord model
+func (SuppressionRecord) TableName() string {
+	return "mail_suppressions"
+}
+
+func (r SuppressionRecord) suppression() Suppression {
+	return Suppression{Email: r.Email, Reason: r.Reason, Source: r.Source, Detail: r.Detail, CreatedAt: r.CreatedAt}
+}
+
+// DBSuppressionStore keeps the suppression list in the application
+// database, shared by every process sending mail
+type DBSuppressionStore struct {
+	db *gorm.DB
+}
+
+// NewDBSuppressionStore creates a database suppression list, creating its
+// table if needed
+func NewDBSuppressionStore(db *gorm.DB) (*DBSuppressionStore, error) {
+	if err := db.AutoMigrate(&SuppressionRecord{}); err != nil {
+		return nil, err
+	}
+	return &DBSuppressionStore{db: db}, nil
+}
+
+func (s *DBSuppressionStore) Suppress(ctx context.Context, suppression Suppression) error {
+	record := SuppressionRecord{
+		Email:     normalizeEmail(suppression.Email),
+		Reason:    suppression.Reason,
+		Source:    suppression.Source,
+		Detail:    truncate(suppression.Detail, 1000),
+		CreatedAt: suppression.CreatedAt,
+	}
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "email"}},
+		DoUpdates: clause.AssignmentColumns([]string{"reason", "source", "detail", "updated_at"}),
+	}).Create(&record).Error
+}
+
+func (s *DBSuppressionStore) Suppressed(ctx context.Context, emails []string) (map[string]Suppression, error) {
+	found := make(map[string]Suppression)
+	if len(emails) == 0 {
+		return found, nil
+	}
+	normalized := make([]string, len(emails))
+	for i, email := range emails {
+		normalized[i] = normalizeEmail(email)
+	}
+
+	var records []SuppressionRecord
+	if err := s.db.WithContext(ctx).Where("email IN ?", normalized).Find(&records).Error; err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		found[record.Email] = record.suppression()
+	}
+	return found, nil
+}
+
+func (s *DBSuppressionStore) Remove(ctx context.Context, email string) (bool, error) {
+	result := s.db.WithContext(ctx).Where("email = ?", normalizeEmail(email)).Delete(&SuppressionRecord{})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (s *DBSuppressionStore) List(ctx context.Context) ([]Suppression, error) {
+	var records []SuppressionRecord
+	if err := s.db.WithContext(ctx).Order("created_at DESC, id DESC").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	list := make([]Suppression, len(records))
+	for i, record := range records {
+		list[i] = record.suppression()
+	}
+	return list, nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n], "")
+}
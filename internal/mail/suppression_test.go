@@ -0,0 +1,97 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/database"
+)
+
+func testSuppressionStore(t *testing.T, store SuppressionStore) {
+	ctx := context.Background()
+	require.NoError(t, store.Suppress(ctx, Suppression{Email: "Ada@Example.com", Reason: ReasonBounce, Source: "ses", Detail: "550 5.1.1 user unknown"}))
+	require.NoError(t, store.Suppress(ctx, Suppression{Email: "bob@example.com", Reason: ReasonComplaint, Source: "mailgun"}))
+
+	found, err := store.Suppressed(ctx, []string{"ADA@example.com", "Bob <bob@example.com>", "carol@example.com"})
+	require.NoError(t, err)
+	require.Len(t, found, 2)
+	assert.Equal(t, ReasonBounce, found["ada@example.com"].Reason)
+	assert.Equal(t, "550 5.1.1 user unknown", found["ada@example.com"].Detail)
+	assert.Equal(t, ReasonComplaint, found["bob@example.com"].Reason)
+	assert.False(t, found["ada@example.com"].CreatedAt.IsZero())
+
+	// Suppressing again updates the reason
+	require.NoError(t, store.Suppress(ctx, Suppression{Email: "ada@example.com", Reason: ReasonComplaint, Source: "ses"}))
+	found, err = store.Suppressed(ctx, []string{"ada@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, ReasonComplaint, found["ada@example.com"].Reason)
+
+	list, err := store.List(ctx)
+	require.NoError(t, err)
+	assert.Len(t, list, 2)
+
+	removed, err := store.Remove(ctx, "ADA@example.com")
+	require.NoError(t, err)
+	assert.True(t, removed)
+	removed, err = store.Remove(ctx, "ada@example.com")
+	require.NoError(t, err)
+	assert.False(t, removed)
+
+	found, err = store.Suppressed(ctx, nil)
+	require.NoError(t, err)
+	assert.Empty(t, found)
+}
+
+func TestMemorySuppressionStore(t *testing.T) {
+	testSuppressionStore(t, NewMemorySuppressionStore())
+}
+
+func TestDBSuppressionStore(t *testing.T) {
+	db, err := database.New(&config.DatabaseConfig{Driver: "sqlite", Database: filepath.Join(t.TempDir(), "app.db")})
+	require.NoError(t, err)
+	defer db.Close()
+
+	store, err := NewDBSuppressionStore(db.GetDB())
+	require.NoError(t, err)
+	testSuppressionStore(t, store)
+}
+
+func TestMailManagerSkipsSuppressedRecipients(t *testing.T) {
+	ctx := context.Background()
+	driver := &recordingDriver{}
+	manager := NewMailManager(driver, "", zap.NewNop())
+	store := NewMemorySuppressionStore()
+	manager.SetSuppressions(store)
+	require.NoError(t, store.Suppress(ctx, Suppression{Email: "bounced@example.com", Reason: ReasonBounce}))
+
+	message := &Message{
+		From: "noreply@example.com",
+		To:   []string{"ada@example.com", "Bounced <BOUNCED@example.com>"},
+		Bcc:  []string{"bounced@example.com"},
+		Text: "Hi",
+	}
+	require.NoError(t, manager.Send(ctx, message))
+	require.Len(t, driver.sent, 1)
+	assert.Equal(t, []string{"ada@example.com"}, driver.sent[0].To)
+	assert.Empty(t, driver.sent[0].Bcc)
+	assert.Len(t, message.To, 2, "the caller's message is left alone")
+
+	err := manager.Send(ctx, &Message{To: []string{"bounced@example.com"}, Text: "Hi"})
+	assert.True(t, errors.Is(err, ErrSuppressed))
+	assert.EqualError(t, err, "email not sent: all recipients are suppressed: bounced@example.com")
+	assert.Len(t, driver.sent, 1)
+
+	require.NoError(t, manager.SendBatch(ctx, []*Message{
+		{To: []string{"bounced@example.com"}, Text: "skipped"},
+		{To: []string{"bob@example.com"}, Text: "sent"},
+	}))
+	require.Len(t, driver.sent, 2)
+	assert.Equal(t, "sent", driver.sent[1].Text)
+}
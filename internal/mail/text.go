@@ -0,0 +1,191 @@
+package mail
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var (
+	hiddenStyle = regexp.MustCompile(`(?i)display\s*:\s*none`)
+	blankLines  = regexp.MustCompile(`\n{3,}`)
+)
+
+// PlainText renders an HTML email as the text/plain alternative sent with
+// it: paragraphs and headings are separated by blank lines, list items are
+// bulleted or numbered, links are followed by their URL in parentheses and
+// images are replaced by their alt text. The head, scripts, styles and
+// elements hidden with display:none, such as preheaders, are left out.
+func PlainText(document string) string {
+	doc, err := html.Parse(strings.NewReader(document))
+	if err != nil {
+		return ""
+	}
+
+	w := &textWriter{}
+	w.node(doc)
+
+	lines := strings.Split(w.buf.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	text := blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(text)
+}
+
+// textWriter collapses whitespace the way a browser does, writing the
+// spaces and line breaks owed between pieces of text only when more text
+// follows
+type textWriter struct {
+	buf    strings.Builder
+	breaks int
+	space  bool
+	pre    int
+}
+
+func (w *textWriter) write(s string) {
+	if s == "" {
+		return
+	}
+	if w.buf.Len() > 0 {
+		if w.breaks > 0 {
+			w.buf.WriteString(strings.Repeat("\n", w.breaks))
+		} else if w.space {
+			w.buf.WriteByte(' ')
+		}
+	}
+	w.breaks, w.space = 0, false
+	w.buf.WriteString(s)
+}
+
+// lineBreak ends the current line, or with n of 2 the paragraph
+func (w *textWriter) lineBreak(n int) {
+	if n > w.breaks {
+		w.breaks = n
+	}
+}
+
+func (w *textWriter) text(s string) {
+	if w.pre > 0 {
+		w.write(s)
+		return
+	}
+	if strings.TrimSpace(s) == "" {
+		w.space = w.space || s != ""
+		return
+	}
+	if s[0] == ' ' || s[0] == '\t' || s[0] == '\n' || s[0] == '\r' {
+		w.space = true
+	}
+	w.write(strings.Join(strings.Fields(s), " "))
+	last := s[len(s)-1]
+	w.space = last == ' ' || last == '\t' || last == '\n' || last == '\r'
+}
+
+func (w *textWriter) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.node(c)
+	}
+}
+
+func (w *textWriter) node(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.text(n.Data)
+		return
+	case html.DocumentNode:
+		w.children(n)
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+
+	if hiddenStyle.MatchString(attr(n, "style")) {
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Head, atom.Script, atom.Style, atom.Template:
+		return
+	case atom.Br:
+		if w.buf.Len() > 0 && w.breaks < 2 {
+			w.breaks++
+		}
+	case atom.Hr:
+		w.lineBreak(2)
+		w.write("---")
+		w.lineBreak(2)
+	case atom.Img:
+		if alt := strings.TrimSpace(attr(n, "alt")); alt != "" {
+			w.text(alt)
+		}
+	case atom.A:
+		start := w.buf.Len()
+		w.children(n)
+		w.link(attr(n, "href"), w.buf.String()[start:])
+	case atom.Ul, atom.Ol:
+		w.lineBreak(2)
+		number := 0
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode || c.DataAtom != atom.Li {
+				w.node(c)
+				continue
+			}
+			w.lineBreak(1)
+			if n.DataAtom == atom.Ol {
+				number++
+				w.write(strconv.Itoa(number) + ".")
+			} else {
+				w.write("-")
+			}
+			w.space = true
+			w.children(c)
+		}
+		w.lineBreak(2)
+	case atom.Pre:
+		w.lineBreak(2)
+		w.pre++
+		w.children(n)
+		w.pre--
+		w.lineBreak(2)
+	case atom.P, atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6,
+		atom.Blockquote, atom.Table:
+		w.lineBreak(2)
+		w.children(n)
+		w.lineBreak(2)
+	case atom.Div, atom.Tr, atom.Li, atom.Section, atom.Article, atom.Header,
+		atom.Footer, atom.Center, atom.Dt, atom.Dd:
+		w.lineBreak(1)
+		w.children(n)
+		w.lineBreak(1)
+	case atom.Td, atom.Th:
+		w.space = true
+		w.children(n)
+		w.space = true
+	default:
+		w.children(n)
+	}
+}
+
+// link writes href after the link text, unless it adds nothing: fragment
+// and javascript links, and links whose text is the address itself
+func (w *textWriter) link(href, label string) {
+	href = strings.TrimSpace(href)
+	if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+		return
+	}
+	label = strings.TrimSpace(label)
+	if label == href || label == strings.TrimPrefix(href, "mailto:") {
+		return
+	}
+	if label == "" {
+		w.text(href)
+		return
+	}
+	w.space = true
+	w.write("(" + href + ")")
+}
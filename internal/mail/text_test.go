@@ -0,0 +1,43 @@
+package mail
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlainText(t *testing.T) {
+	text := PlainText(`<!DOCTYPE html><html><head><title>Welcome</title><style>p { color: red }</style></head>
+<body>
+	<div style="display: none; max-height: 0">Your account is ready</div>
+	<table><tr><td>
+		<h1>Welcome,   Ada</h1>
+		<p>Thanks for joining.<br>Here is what to do next:</p>
+		<ol><li>Confirm your email</li><li>Read the <a href="https://example.com/docs">docs</a></li></ol>
+		<ul><li>Questions? <a href="mailto:help@example.com">help@example.com</a></li></ul>
+		<p><a href="https://example.com/login"><img src="button.png" alt="Log in"></a></p>
+		<table><tr><th>Plan</th><th>Price</th></tr><tr><td>Pro</td><td>$9</td></tr></table>
+		<pre>code   stays
+  as is</pre>
+	</td></tr></table>
+	<script>track()</script>
+</body></html>`)
+
+	assert.Equal(t, `Welcome, Ada
+
+Thanks for joining.
+Here is what to do next:
+
+1. Confirm your email
+2. Read the docs (https://example.com/docs)
+
+- Questions? help@example.com
+
+Log in (https://example.com/login)
+
+Plan Price
+Pro $9
+
+code   stays
+  as is`, text)
+}
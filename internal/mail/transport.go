@@ -0,0 +1,195 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/ratelimit"
+	"go.uber.org/zap"
+)
+
+// DefaultFailoverCooldown is how long a FailoverDriver passes over a
+// transport after a transient failure
+const DefaultFailoverCooldown = 30 * time.Second
+
+// IsTransient reports whether err is a failure that may not happen again:
+// the server couldn't be reached, dropped the connection or timed out, or
+// answered with a 4xx reply, or a rate limit was reached. Other failures,
+// such as a rejected recipient or a message that is too large, would fail
+// on any server.
+func IsTransient(err error) bool {
+	if errors.Is(err, ErrRateLimited) {
+		return true
+	}
+	var reply *textproto.Error
+	if errors.As(err, &reply) {
+		return reply.Code >= 400 && reply.Code < 500
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// FailoverDriver sends each message through the first of its drivers that
+// accepts it, so that an outage of one SMTP server doesn't drop mail. A
+// driver failing with a transient error is tried last for a cooldown, so
+// that while it is down messages go straight to the next. Other errors
+// are returned without trying further drivers.
+type FailoverDriver struct {
+	drivers  []Driver
+	cooldown time.Duration
+	logger   *zap.Logger
+
+	mu        sync.Mutex
+	downUntil []time.Time
+}
+
+// NewFailoverDriver creates a driver sending through drivers, in order of
+// preference
+func NewFailoverDriver(drivers []Driver, logger *zap.Logger) *FailoverDriver {
+	return &FailoverDriver{
+		drivers:   drivers,
+		cooldown:  DefaultFailoverCooldown,
+		logger:    logger,
+		downUntil: make([]time.Time, len(drivers)),
+	}
+}
+
+// SetCooldown sets how long a driver that failed is tried last
+func (d *FailoverDriver) SetCooldown(cooldown time.Duration) {
+	d.cooldown = cooldown
+}
+
+// order returns the indexes of the drivers to try: those up in order of
+// preference, then those cooling down
+func (d *FailoverDriver) order() []int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	order := make([]int, len(d.drivers))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return !now.Before(d.downUntil[order[i]]) && now.Before(d.downUntil[order[j]])
+	})
+	return order
+}
+
+func (d *FailoverDriver) markDown(i int, down bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if down {
+		d.downUntil[i] = time.Now().Add(d.cooldown)
+	} else {
+		d.downUntil[i] = time.Time{}
+	}
+}
+
+func (d *FailoverDriver) Send(ctx context.Context, message *Message) error {
+	var errs []error
+	for _, i := range d.order() {
+		err := d.drivers[i].Send(ctx, message)
+		if err == nil {
+			d.markDown(i, false)
+			return nil
+		}
+		if !IsTransient(err) {
+			return err
+		}
+
+		d.markDown(i, true)
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+		d.logger.Warn("Mail transport failed, trying the next",
+			zap.Int("transport", i), zap.Error(err))
+	}
+	return fmt.Errorf("failed to send email through any of %d transports: %w", len(d.drivers), errors.Join(errs...))
+}
+
+func (d *FailoverDriver) SendBatch(ctx context.Context, messages []*Message) error {
+	for _, message := range messages {
+		if err := d.Send(ctx, message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the drivers that hold connections
+func (d *FailoverDriver) Close() error {
+	var errs []error
+	for _, driver := range d.drivers {
+		if closer, ok := driver.(io.Closer); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// NewTransport creates the driver for the SMTP servers of the mail
+// configuration: a pooled SMTPDriver, DKIM signing for the domains with a
+// key, failover between servers when there are several, and rate limits
+// per recipient domain counted in memory
+func NewTransport(cfg config.MailConfig, logger *zap.Logger) (Driver, error) {
+	if len(cfg.SMTP) == 0 {
+		return nil, errors.New("no SMTP servers configured in mail.smtp")
+	}
+
+	var signer *DKIMSigner
+	if len(cfg.DKIM) > 0 {
+		keys := make([]DKIMKey, 0, len(cfg.DKIM))
+		for domain, dkim := range cfg.DKIM {
+			key, err := LoadDKIMKey(domain, dkim.Selector, dkim.PrivateKey)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+		}
+		signer = NewDKIMSigner(keys...)
+	}
+
+	options := SMTPOptions{
+		MaxConnections: cfg.Pool.MaxConnections,
+		MaxMessages:    cfg.Pool.MaxMessages,
+		IdleTimeout:    cfg.Pool.IdleTimeout,
+		Timeout:        cfg.Pool.Timeout,
+	}
+	drivers := make([]Driver, len(cfg.SMTP))
+	for i, server := range cfg.SMTP {
+		if server.Host == "" {
+			return nil, fmt.Errorf("mail.smtp[%d] has no host", i)
+		}
+		driver := NewSMTPDriver(server.Host, server.Port, server.Username, server.Password, logger)
+		driver.SetOptions(options)
+		driver.SetDKIM(signer)
+		drivers[i] = driver
+	}
+
+	driver := drivers[0]
+	if len(drivers) > 1 {
+		driver = NewFailoverDriver(drivers, logger)
+	}
+
+	if len(cfg.RateLimits) > 0 {
+		limits := make(map[string]RateLimit, len(cfg.RateLimits))
+		for domain, limit := range cfg.RateLimits {
+			limits[domain] = RateLimit{Messages: limit.Messages, Per: limit.Per}
+		}
+		driver = NewRateLimitedDriver(driver, ratelimit.NewMemoryRateLimiter(), limits, logger)
+	}
+	return driver, nil
+}
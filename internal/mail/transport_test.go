@@ -0,0 +1,170 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+func testMessage(subject string) *Message {
+	return &Message{From: "noreply@example.com", To: []string{"ada@example.com"}, Subject: subject, Text: "Hi"}
+}
+
+func TestSMTPDriverReusesConnections(t *testing.T) {
+	server := fakeSMTP(t, 10<<20, "250 ok")
+	driver := newTestSMTPDriver(t, server.addr)
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, driver.Send(ctx, testMessage(fmt.Sprint(i))))
+	}
+	assert.Len(t, server.messages, 5)
+	assert.Equal(t, int32(1), server.sessions.Load())
+
+	// A connection the server dropped while idle is replaced
+	server.drop()
+	require.NoError(t, driver.Send(ctx, testMessage("after drop")))
+	assert.Equal(t, int32(2), server.sessions.Load())
+
+	options := DefaultSMTPOptions()
+	options.MaxMessages = 2
+	driver.SetOptions(options)
+	for i := 0; i < 4; i++ {
+		require.NoError(t, driver.Send(ctx, testMessage(fmt.Sprint(i))))
+	}
+	assert.Equal(t, int32(4), server.sessions.Load(), "one more message on the old connection, then two per connection")
+}
+
+func TestSMTPDriverLimitsConnections(t *testing.T) {
+	server := fakeSMTP(t, 10<<20, "250 ok")
+	driver := newTestSMTPDriver(t, server.addr)
+	options := DefaultSMTPOptions()
+	options.MaxConnections = 2
+	driver.SetOptions(options)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, driver.Send(context.Background(), testMessage(fmt.Sprint(i))))
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, server.messages, 20)
+	assert.LessOrEqual(t, server.sessions.Load(), int32(2))
+
+	require.NoError(t, driver.Close())
+	require.NoError(t, driver.Send(context.Background(), testMessage("after close")))
+	assert.Equal(t, int32(3), server.sessions.Load(), "closed drivers don't keep connections")
+}
+
+func TestSMTPDriverTimeout(t *testing.T) {
+	// A server that accepts connections but never greets
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	driver := newTestSMTPDriver(t, ln.Addr().String())
+	options := DefaultSMTPOptions()
+	options.Timeout = 100 * time.Millisecond
+	driver.SetOptions(options)
+
+	start := time.Now()
+	err = driver.Send(context.Background(), testMessage("Hi"))
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+	assert.True(t, IsTransient(err), "got %v", err)
+}
+
+func TestIsTransient(t *testing.T) {
+	assert.True(t, IsTransient(&textproto.Error{Code: 421, Msg: "try again later"}))
+	assert.True(t, IsTransient(fmt.Errorf("send: %w", &textproto.Error{Code: 451})))
+	assert.False(t, IsTransient(&textproto.Error{Code: 550, Msg: "no such user"}))
+	assert.True(t, IsTransient(&net.OpError{Op: "dial", Err: errors.New("connection refused")}))
+	assert.True(t, IsTransient(io.EOF))
+	assert.False(t, IsTransient(ErrMessageTooLarge))
+	assert.False(t, IsTransient(os.ErrNotExist))
+}
+
+func TestFailoverDriver(t *testing.T) {
+	down := fakeSMTP(t, 10<<20, "421 try again later")
+	up := fakeSMTP(t, 10<<20, "250 ok")
+	failover := NewFailoverDriver([]Driver{newTestSMTPDriver(t, down.addr), newTestSMTPDriver(t, up.addr)}, zap.NewNop())
+	ctx := context.Background()
+
+	require.NoError(t, failover.Send(ctx, testMessage("first")))
+	require.NoError(t, failover.Send(ctx, testMessage("second")))
+	assert.Len(t, up.messages, 2)
+	assert.Equal(t, int32(1), down.sessions.Load(), "a failed transport is passed over while cooling down")
+
+	failover.SetCooldown(0)
+	failover.markDown(0, true)
+	require.NoError(t, failover.Send(ctx, testMessage("third")))
+	assert.Equal(t, int32(2), down.sessions.Load(), "and tried first again after")
+
+	// Permanent failures aren't retried elsewhere
+	rejecting := fakeSMTP(t, 10<<20, "550 sender rejected")
+	failover = NewFailoverDriver([]Driver{newTestSMTPDriver(t, rejecting.addr), newTestSMTPDriver(t, up.addr)}, zap.NewNop())
+	err := failover.Send(ctx, testMessage("rejected"))
+	assert.EqualError(t, err, `550 "sender rejected"`)
+	assert.Len(t, up.messages, 3)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	unreachable := ln.Addr().String()
+	ln.Close()
+	failover = NewFailoverDriver([]Driver{newTestSMTPDriver(t, down.addr), newTestSMTPDriver(t, unreachable)}, zap.NewNop())
+	err = failover.Send(ctx, testMessage("lost"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to send email through any of 2 transports")
+	assert.Contains(t, err.Error(), `421 "try again later"`)
+	assert.True(t, IsTransient(err), "callers can retry later")
+}
+
+func TestNewTransport(t *testing.T) {
+	cfg := config.MailConfig{
+		SMTP: []config.SMTPConfig{{Host: "smtp.example.com", Port: 587}},
+		Pool: config.MailPoolConfig{MaxConnections: 8, MaxMessages: 50, IdleTimeout: time.Minute, Timeout: 10 * time.Second},
+	}
+	driver, err := NewTransport(cfg, zap.NewNop())
+	require.NoError(t, err)
+	smtpDriver := driver.(*SMTPDriver)
+	assert.Equal(t, SMTPOptions{MaxConnections: 8, MaxMessages: 50, IdleTimeout: time.Minute, Timeout: 10 * time.Second}, smtpDriver.options)
+	assert.Nil(t, smtpDriver.dkim)
+
+	cfg.SMTP = append(cfg.SMTP, config.SMTPConfig{Host: "backup.example.com", Port: 25})
+	driver, err = NewTransport(cfg, zap.NewNop())
+	require.NoError(t, err)
+	assert.IsType(t, &FailoverDriver{}, driver)
+
+	cfg.DKIM = map[string]config.DKIMConfig{"example.com": {Selector: "mail", PrivateKey: filepath.Join(t.TempDir(), "missing.pem")}}
+	_, err = NewTransport(cfg, zap.NewNop())
+	assert.ErrorContains(t, err, "failed to read DKIM key for example.com")
+
+	_, err = NewTransport(config.MailConfig{}, zap.NewNop())
+	assert.EqualError(t, err, "no SMTP servers configured in mail.smtp")
+}
@@ -0,0 +1,424 @@
+package mail
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/webhooks"
+)
+
+// maxWebhookBody caps the notifications read, which are a few KB
+const maxWebhookBody = 1 << 20
+
+// mailgunTolerance is how old a Mailgun signature may be, which keeps
+// captured requests from being replayed later
+const mailgunTolerance = 15 * time.Minute
+
+// snsHost matches the hosts SNS signing certificates and subscription
+// confirmations are served from
+var snsHost = regexp.MustCompile(`^sns\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+
+// Webhooks takes the bounce and complaint notifications of Amazon SES,
+// delivered by SNS, and of Mailgun into a suppression list. Only permanent
+// bounces suppress an address; temporary ones, such as a full mailbox, are
+// retried by the provider.
+type Webhooks struct {
+	store      SuppressionStore
+	sesTopics  []string
+	mailgunKey string
+	client     *http.Client
+	logger     *zap.Logger
+	now        func() time.Time
+
+	// certURL checks where an SNS signing certificate is fetched from,
+	// replaced by tests
+	certURL func(*url.URL) error
+
+	mu    sync.Mutex
+	certs map[string]*x509.Certificate
+}
+
+// NewWebhooks creates the webhook endpoints from the mail webhooks config
+func NewWebhooks(store SuppressionStore, cfg config.MailWebhooksConfig, logger *zap.Logger) *Webhooks {
+	return &Webhooks{
+		store:      store,
+		sesTopics:  cfg.SESTopics,
+		mailgunKey: cfg.MailgunSigningKey,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		logger:     logger,
+		now:        time.Now,
+		certURL:    checkSNSURL,
+		certs:      make(map[string]*x509.Certificate),
+	}
+}
+
+// Routes registers POST /ses, and POST /mailgun when a Mailgun signing key
+// is configured
+func (h *Webhooks) Routes(r chi.Router) {
+	r.Post("/ses", h.SES)
+	if h.mailgunKey != "" {
+		r.Post("/mailgun", h.Mailgun)
+	}
+}
+
+// snsMessage is an SNS HTTP notification
+type snsMessage struct {
+	Type             string
+	MessageID        string `json:"MessageId"`
+	Token            string
+	TopicArn         string
+	Subject          string
+	Message          string
+	Timestamp        string
+	SignatureVersion string
+	Signature        string
+	SigningCertURL   string
+	SubscribeURL     string
+}
+
+// signedString returns what SNS signs: the message's fields, by type, as
+// name and value lines
+func (m *snsMessage) signedString() string {
+	fields := [][2]string{{"Message", m.Message}, {"MessageId", m.MessageID}}
+	if m.Type == "Notification" {
+		if m.Subject != "" {
+			fields = append(fields, [2]string{"Subject", m.Subject})
+		}
+	} else {
+		fields = append(fields, [2]string{"SubscribeURL", m.SubscribeURL})
+	}
+	fields = append(fields, [2]string{"Timestamp", m.Timestamp})
+	if m.Type != "Notification" {
+		fields = append(fields, [2]string{"Token", m.Token})
+	}
+	fields = append(fields, [2]string{"TopicArn", m.TopicArn}, [2]string{"Type", m.Type})
+
+	var b strings.Builder
+	for _, f := range fields {
+		b.WriteString(f[0] + "\n" + f[1] + "\n")
+	}
+	return b.String()
+}
+
+// sesNotification is an SES bounce or complaint, from notifications
+// (notificationType) or event publishing (eventType)
+type sesNotification struct {
+	NotificationType string `json:"notificationType"`
+	EventType        string `json:"eventType"`
+	Bounce           struct {
+		BounceType        string `json:"bounceType"`
+		BounceSubType     string `json:"bounceSubType"`
+		BouncedRecipients []struct {
+			EmailAddress   string `json:"emailAddress"`
+			DiagnosticCode string `json:"diagnosticCode"`
+		} `json:"bouncedRecipients"`
+	} `json:"bounce"`
+	Complaint struct {
+		ComplaintFeedbackType string `json:"complaintFeedbackType"`
+		ComplainedRecipients  []struct {
+			EmailAddress string `json:"emailAddress"`
+		} `json:"complainedRecipients"`
+	} `json:"complaint"`
+}
+
+// SES handles SNS notifications of SES bounces and complaints, confirming
+// the topic subscription when SNS asks
+func (h *Webhooks) SES(w http.ResponseWriter, r *http.Request) {
+	var message snsMessage
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxWebhookBody)).Decode(&message); err != nil {
+		http.Error(w, "invalid SNS message", http.StatusBadRequest)
+		return
+	}
+	if len(h.sesTopics) > 0 && !slices.Contains(h.sesTopics, message.TopicArn) {
+		http.Error(w, "unknown SNS topic", http.StatusForbidden)
+		return
+	}
+	if err := h.verifySNS(r.Context(), &message); err != nil {
+		h.logger.Warn("Refused SNS message with an invalid signature", zap.String("topic", message.TopicArn), zap.Error(err))
+		http.Error(w, "invalid SNS signature", http.StatusForbidden)
+		return
+	}
+
+	switch message.Type {
+	case "SubscriptionConfirmation":
+		if err := h.confirmSubscription(r.Context(), message.SubscribeURL); err != nil {
+			h.logger.Error("Failed to confirm SNS subscription", zap.String("topic", message.TopicArn), zap.Error(err))
+			http.Error(w, "failed to confirm subscription", http.StatusBadGateway)
+			return
+		}
+		h.logger.Info("Confirmed SNS subscription", zap.String("topic", message.TopicArn))
+	case "Notification":
+		var notification sesNotification
+		if err := json.Unmarshal([]byte(message.Message), &notification); err != nil {
+			http.Error(w, "invalid SES notification", http.StatusBadRequest)
+			return
+		}
+		if err := h.suppressSES(r.Context(), &notification); err != nil {
+			h.logger.Error("Failed to suppress SES recipients", zap.Error(err))
+			http.Error(w, "failed to update the suppression list", http.StatusInternalServerError)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Webhooks) suppressSES(ctx context.Context, n *sesNotification) error {
+	kind := n.NotificationType
+	if kind == "" {
+		kind = n.EventType
+	}
+
+	var suppressions []Suppression
+	switch kind {
+	case "Bounce":
+		if n.Bounce.BounceType != "Permanent" {
+			return nil
+		}
+		for _, recipient := range n.Bounce.BouncedRecipients {
+			detail := recipient.DiagnosticCode
+			if detail == "" {
+				detail = n.Bounce.BounceSubType
+			}
+			suppressions = append(suppressions, Suppression{Email: recipient.EmailAddress, Reason: ReasonBounce, Source: "ses", Detail: detail})
+		}
+	case "Complaint":
+		for _, recipient := range n.Complaint.ComplainedRecipients {
+			suppressions = append(suppressions, Suppression{Email: recipient.EmailAddress, Reason: ReasonComplaint, Source: "ses", Detail: n.Complaint.ComplaintFeedbackType})
+		}
+	}
+	return h.suppress(ctx, suppressions)
+}
+
+func (h *Webhooks) suppress(ctx context.Context, suppressions []Suppression) error {
+	for _, suppression := range suppressions {
+		if suppression.Email == "" {
+			continue
+		}
+		if err := h.store.Suppress(ctx, suppression); err != nil {
+			return err
+		}
+		h.logger.Info("Suppressed email address",
+			zap.String("email", suppression.Email),
+			zap.String("reason", suppression.Reason),
+			zap.String("source", suppression.Source))
+	}
+	return nil
+}
+
+// verifySNS checks the signature of an SNS message against the signing
+// certificate it names, which must be served by SNS
+func (h *Webhooks) verifySNS(ctx context.Context, m *snsMessage) error {
+	var hash crypto.Hash
+	switch m.SignatureVersion {
+	case "1":
+		hash = crypto.SHA1
+	case "2":
+		hash = crypto.SHA256
+	default:
+		return fmt.Errorf("unsupported signature version %q", m.SignatureVersion)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(m.Signature)
+	if err != nil {
+		return fmt.Errorf("malformed signature: %w", err)
+	}
+	cert, err := h.signingCert(ctx, m.SigningCertURL)
+	if err != nil {
+		return err
+	}
+	key, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return errors.New("signing certificate has no RSA key")
+	}
+
+	var digest []byte
+	if hash == crypto.SHA1 {
+		sum := sha1.Sum([]byte(m.signedString()))
+		digest = sum[:]
+	} else {
+		sum := sha256.Sum256([]byte(m.signedString()))
+		digest = sum[:]
+	}
+	return rsa.VerifyPKCS1v15(key, hash, digest, signature)
+}
+
+// signingCert returns the certificate at rawURL, fetched once
+func (h *Webhooks) signingCert(ctx context.Context, rawURL string) (*x509.Certificate, error) {
+	h.mu.Lock()
+	cert, ok := h.certs[rawURL]
+	h.mu.Unlock()
+	if ok {
+		return cert, nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing certificate URL: %w", err)
+	}
+	if err := h.certURL(u); err != nil {
+		return nil, fmt.Errorf("refused signing certificate URL %s: %w", rawURL, err)
+	}
+	body, err := h.get(ctx, rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch signing certificate: %w", err)
+	}
+	block, _ := pem.Decode(body)
+	if block == nil {
+		return nil, errors.New("signing certificate is not PEM encoded")
+	}
+	if cert, err = x509.ParseCertificate(block.Bytes); err != nil {
+		return nil, fmt.Errorf("invalid signing certificate: %w", err)
+	}
+
+	h.mu.Lock()
+	h.certs[rawURL] = cert
+	h.mu.Unlock()
+	return cert, nil
+}
+
+// confirmSubscription visits the subscribe URL of a SubscriptionConfirmation
+func (h *Webhooks) confirmSubscription(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if err := h.certURL(u); err != nil {
+		return fmt.Errorf("refused subscribe URL %s: %w", rawURL, err)
+	}
+	_, err = h.get(ctx, rawURL)
+	return err
+}
+
+func (h *Webhooks) get(ctx context.Context, rawURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxWebhookBody))
+}
+
+// checkSNSURL allows only HTTPS URLs on SNS hosts, so that a forged message
+// can't name a certificate of its own
+func checkSNSURL(u *url.URL) error {
+	if u.Scheme != "https" {
+		return errors.New("not HTTPS")
+	}
+	if !snsHost.MatchString(u.Hostname()) {
+		return errors.New("not an SNS host")
+	}
+	return nil
+}
+
+// mailgunEvent is a Mailgun webhook request
+type mailgunEvent struct {
+	Signature struct {
+		Timestamp string `json:"timestamp"`
+		Token     string `json:"token"`
+		Signature string `json:"signature"`
+	} `json:"signature"`
+	EventData struct {
+		Event          string `json:"event"`
+		Severity       string `json:"severity"`
+		Recipient      string `json:"recipient"`
+		DeliveryStatus struct {
+			Code        int    `json:"code"`
+			Message     string `json:"message"`
+			Description string `json:"description"`
+		} `json:"delivery-status"`
+	} `json:"event-data"`
+}
+
+// Mailgun handles Mailgun's failed and complained webhooks
+func (h *Webhooks) Mailgun(w http.ResponseWriter, r *http.Request) {
+	var event mailgunEvent
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxWebhookBody)).Decode(&event); err != nil {
+		http.Error(w, "invalid Mailgun event", http.StatusBadRequest)
+		return
+	}
+	// A replay is verified as of when the webhook arrived
+	now := h.now()
+	if receivedAt, ok := webhooks.ReceivedAt(r.Context()); ok {
+		now = receivedAt
+	}
+	if err := h.verifyMailgun(&event, now); err != nil {
+		h.logger.Warn("Refused Mailgun webhook with an invalid signature", zap.Error(err))
+		// 406 tells Mailgun not to retry
+		http.Error(w, "invalid Mailgun signature", http.StatusNotAcceptable)
+		return
+	}
+
+	data := event.EventData
+	var suppressions []Suppression
+	switch {
+	case data.Event == "failed" && data.Severity == "permanent":
+		detail := data.DeliveryStatus.Description
+		if detail == "" {
+			detail = data.DeliveryStatus.Message
+		}
+		if data.DeliveryStatus.Code != 0 {
+			detail = strings.TrimSpace(strconv.Itoa(data.DeliveryStatus.Code) + " " + detail)
+		}
+		suppressions = append(suppressions, Suppression{Email: data.Recipient, Reason: ReasonBounce, Source: "mailgun", Detail: detail})
+	case data.Event == "complained":
+		suppressions = append(suppressions, Suppression{Email: data.Recipient, Reason: ReasonComplaint, Source: "mailgun"})
+	}
+	if err := h.suppress(r.Context(), suppressions); err != nil {
+		h.logger.Error("Failed to suppress Mailgun recipient", zap.Error(err))
+		http.Error(w, "failed to update the suppression list", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// verifyMailgun checks the HMAC-SHA256 of the timestamp and token, signed
+// with the webhook signing key, and that the timestamp was recent at now
+func (h *Webhooks) verifyMailgun(event *mailgunEvent, now time.Time) error {
+	sig := event.Signature
+	timestamp, err := strconv.ParseInt(sig.Timestamp, 10, 64)
+	if err != nil {
+		return errors.New("malformed timestamp")
+	}
+	if age := now.Sub(time.Unix(timestamp, 0)); age > mailgunTolerance || age < -mailgunTolerance {
+		return fmt.Errorf("timestamp is %s off", age.Round(time.Second))
+	}
+
+	mac := hmac.New(sha256.New, []byte(h.mailgunKey))
+	mac.Write([]byte(sig.Timestamp + sig.Token))
+	expected := hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(sig.Signature)) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
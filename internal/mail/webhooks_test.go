@@ -0,0 +1,217 @@
+package mail
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+// fakeSNS serves a signing certificate and subscription confirmations, and
+// signs messages as SNS does
+type fakeSNS struct {
+	server    *httptest.Server
+	key       *rsa.PrivateKey
+	confirmed atomic.Int32
+}
+
+func newFakeSNS(t *testing.T) *fakeSNS {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sns.amazonaws.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	sns := &fakeSNS{key: key}
+	sns.server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cert.pem":
+			pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+		case "/confirm":
+			sns.confirmed.Add(1)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(sns.server.Close)
+	return sns
+}
+
+func (s *fakeSNS) message(t *testing.T, kind, body string) snsMessage {
+	m := snsMessage{
+		Type:             kind,
+		MessageID:        "b3a0e5c4-1",
+		TopicArn:         "arn:aws:sns:us-east-1:123456789012:ses-notifications",
+		Message:          body,
+		Timestamp:        "2024-05-01T12:00:00.000Z",
+		SignatureVersion: "2",
+		SigningCertURL:   s.server.URL + "/cert.pem",
+	}
+	if kind == "SubscriptionConfirmation" {
+		m.Token = "token-1"
+		m.SubscribeURL = s.server.URL + "/confirm"
+	}
+	sum := sha256.Sum256([]byte(m.signedString()))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, sum[:])
+	require.NoError(t, err)
+	m.Signature = base64.StdEncoding.EncodeToString(signature)
+	return m
+}
+
+func newTestWebhooks(t *testing.T, sns *fakeSNS, cfg config.MailWebhooksConfig) (*Webhooks, *MemorySuppressionStore, http.Handler) {
+	store := NewMemorySuppressionStore()
+	webhooks := NewWebhooks(store, cfg, zap.NewNop())
+	if sns != nil {
+		webhooks.client = sns.server.Client()
+		webhooks.certURL = func(u *url.URL) error {
+			if u.Host != strings.TrimPrefix(sns.server.URL, "https://") {
+				return fmt.Errorf("unexpected host %s", u.Host)
+			}
+			return nil
+		}
+	}
+	r := chi.NewRouter()
+	r.Route("/webhooks/mail", webhooks.Routes)
+	return webhooks, store, r
+}
+
+func post(t *testing.T, handler http.Handler, path string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	data, err := json.Marshal(body)
+	require.NoError(t, err)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, strings.NewReader(string(data))))
+	return rec
+}
+
+func TestSESWebhook(t *testing.T) {
+	sns := newFakeSNS(t)
+	_, store, handler := newTestWebhooks(t, sns, config.MailWebhooksConfig{})
+	ctx := context.Background()
+
+	rec := post(t, handler, "/webhooks/mail/ses", sns.message(t, "SubscriptionConfirmation", "You have chosen to subscribe"))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, int32(1), sns.confirmed.Load())
+
+	bounce := `{"notificationType":"Bounce","bounce":{"bounceType":"Permanent","bounceSubType":"General",
+		"bouncedRecipients":[{"emailAddress":"Ada@example.com","diagnosticCode":"smtp; 550 5.1.1 user unknown"}]}}`
+	rec = post(t, handler, "/webhooks/mail/ses", sns.message(t, "Notification", bounce))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	transient := `{"notificationType":"Bounce","bounce":{"bounceType":"Transient","bouncedRecipients":[{"emailAddress":"full@example.com"}]}}`
+	post(t, handler, "/webhooks/mail/ses", sns.message(t, "Notification", transient))
+
+	complaint := `{"eventType":"Complaint","complaint":{"complaintFeedbackType":"abuse","complainedRecipients":[{"emailAddress":"bob@example.com"}]}}`
+	post(t, handler, "/webhooks/mail/ses", sns.message(t, "Notification", complaint))
+
+	found, err := store.Suppressed(ctx, []string{"ada@example.com", "full@example.com", "bob@example.com"})
+	require.NoError(t, err)
+	require.Len(t, found, 2, "temporary bounces don't suppress")
+	assert.Equal(t, Suppression{Email: "ada@example.com", Reason: ReasonBounce, Source: "ses", Detail: "smtp; 550 5.1.1 user unknown", CreatedAt: found["ada@example.com"].CreatedAt}, found["ada@example.com"])
+	assert.Equal(t, ReasonComplaint, found["bob@example.com"].Reason)
+	assert.Equal(t, "abuse", found["bob@example.com"].Detail)
+
+	// Forged and tampered messages are refused
+	forged := sns.message(t, "Notification", complaint)
+	forged.Message = strings.Replace(forged.Message, "bob@", "carol@", 1)
+	assert.Equal(t, http.StatusForbidden, post(t, handler, "/webhooks/mail/ses", forged).Code)
+
+	elsewhere := sns.message(t, "Notification", complaint)
+	elsewhere.SigningCertURL = "https://attacker.example.com/cert.pem"
+	assert.Equal(t, http.StatusForbidden, post(t, handler, "/webhooks/mail/ses", elsewhere).Code)
+
+	_, _, handler = newTestWebhooks(t, sns, config.MailWebhooksConfig{SESTopics: []string{"arn:aws:sns:us-east-1:123456789012:other"}})
+	assert.Equal(t, http.StatusForbidden, post(t, handler, "/webhooks/mail/ses", sns.message(t, "Notification", complaint)).Code)
+
+	found, err = store.Suppressed(ctx, []string{"carol@example.com"})
+	require.NoError(t, err)
+	assert.Empty(t, found)
+}
+
+func TestCheckSNSURL(t *testing.T) {
+	for raw, ok := range map[string]bool{
+		"https://sns.us-east-1.amazonaws.com/SimpleNotificationService-abc.pem": true,
+		"https://sns.cn-north-1.amazonaws.com.cn/cert.pem":                      true,
+		"http://sns.us-east-1.amazonaws.com/cert.pem":                           false,
+		"https://sns.us-east-1.amazonaws.com.attacker.com/cert.pem":             false,
+		"https://attacker.com/sns.us-east-1.amazonaws.com/cert.pem":             false,
+	} {
+		u, err := url.Parse(raw)
+		require.NoError(t, err)
+		assert.Equal(t, ok, checkSNSURL(u) == nil, raw)
+	}
+}
+
+func mailgunEventBody(key string, timestamp time.Time, eventData map[string]interface{}) map[string]interface{} {
+	ts := fmt.Sprint(timestamp.Unix())
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(ts + "token-1"))
+	return map[string]interface{}{
+		"signature":  map[string]string{"timestamp": ts, "token": "token-1", "signature": hex.EncodeToString(mac.Sum(nil))},
+		"event-data": eventData,
+	}
+}
+
+func TestMailgunWebhook(t *testing.T) {
+	_, store, handler := newTestWebhooks(t, nil, config.MailWebhooksConfig{MailgunSigningKey: "key-1"})
+	ctx := context.Background()
+	now := time.Now()
+
+	failed := map[string]interface{}{
+		"event": "failed", "severity": "permanent", "recipient": "ada@example.com",
+		"delivery-status": map[string]interface{}{"code": 550, "description": "No such mailbox"},
+	}
+	assert.Equal(t, http.StatusNoContent, post(t, handler, "/webhooks/mail/mailgun", mailgunEventBody("key-1", now, failed)).Code)
+
+	temporary := map[string]interface{}{"event": "failed", "severity": "temporary", "recipient": "full@example.com"}
+	post(t, handler, "/webhooks/mail/mailgun", mailgunEventBody("key-1", now, temporary))
+	complained := map[string]interface{}{"event": "complained", "recipient": "bob@example.com"}
+	post(t, handler, "/webhooks/mail/mailgun", mailgunEventBody("key-1", now, complained))
+
+	found, err := store.Suppressed(ctx, []string{"ada@example.com", "full@example.com", "bob@example.com"})
+	require.NoError(t, err)
+	require.Len(t, found, 2)
+	assert.Equal(t, "550 No such mailbox", found["ada@example.com"].Detail)
+	assert.Equal(t, "mailgun", found["bob@example.com"].Source)
+
+	forged := map[string]interface{}{"event": "complained", "recipient": "carol@example.com"}
+	assert.Equal(t, http.StatusNotAcceptable, post(t, handler, "/webhooks/mail/mailgun", mailgunEventBody("wrong-key", now, forged)).Code)
+	assert.Equal(t, http.StatusNotAcceptable, post(t, handler, "/webhooks/mail/mailgun", mailgunEventBody("key-1", now.Add(-time.Hour), forged)).Code, "replayed")
+	found, err = store.Suppressed(ctx, []string{"carol@example.com"})
+	require.NoError(t, err)
+	assert.Empty(t, found)
+
+	// Without a signing key there is no Mailgun endpoint
+	_, _, handler = newTestWebhooks(t, nil, config.MailWebhooksConfig{})
+	assert.Equal(t, http.StatusNotFound, post(t, handler, "/webhooks/mail/mailgun", mailgunEventBody("", now, complained)).Code)
+}
@@ -6,6 +6,8 @@ import (
 	"net/http"
 	"strings"
 	"time"
+
+	"github.com/mrhoseah/dolphin/internal/problem"
 )
 
 // Middleware provides maintenance mode middleware
@@ -93,10 +95,10 @@ func (m *Middleware) checkBypassSecret(r *http.Request) bool {
 	return false
 }
 
-// returnMaintenanceResponse returns the maintenance mode response
+// returnMaintenanceResponse returns the maintenance mode response: the 503
+// error page with the maintenance message for browsers, JSON otherwise
 func (m *Middleware) returnMaintenanceResponse(w http.ResponseWriter, r *http.Request) {
 	// Set headers
-	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
 	w.Header().Set("Pragma", "no-cache")
 	w.Header().Set("Expires", "0")
@@ -106,6 +108,12 @@ func (m *Middleware) returnMaintenanceResponse(w http.ResponseWriter, r *http.Re
 		w.Header().Set("Retry-After", fmt.Sprintf("%d", retryAfter))
 	}
 
+	if problem.WantsHTML(r) {
+		problem.Write(w, r, problem.New(http.StatusServiceUnavailable, m.manager.GetMessage()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
 	// Set status code
 	w.WriteHeader(http.StatusServiceUnavailable)
 
@@ -3,6 +3,7 @@ package maintenance
 import (
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -42,3 +43,32 @@ func TestMaintenanceMiddleware_Enabled(t *testing.T) {
 		t.Fatalf("expected 503 when enabled, got %d", w.Code)
 	}
 }
+
+func TestMaintenanceMiddleware_BrowserGetsErrorPage(t *testing.T) {
+	m := NewManager("testdata/maintenance.json")
+	_ = m.Enable("Back at 5pm", 60, nil, "")
+	defer m.Disable()
+
+	mw := NewMiddleware(m)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/dashboard", nil)
+	req.Header.Set("Accept", "text/html")
+	w := httptest.NewRecorder()
+	mw.Handle(next).ServeHTTP(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 when enabled, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Fatalf("expected an HTML page, got %q", ct)
+	}
+	if !strings.Contains(w.Body.String(), "Back at 5pm") {
+		t.Fatalf("expected the maintenance message on the page, got %q", w.Body.String())
+	}
+	if w.Header().Get("Retry-After") != "60" {
+		t.Fatalf("expected Retry-After 60, got %q", w.Header().Get("Retry-After"))
+	}
+}
@@ -0,0 +1,197 @@
+package maintenance
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+// ReadOnlyInfo holds read-only mode state
+type ReadOnlyInfo struct {
+	Enabled    bool      `json:"enabled"`
+	Message    string    `json:"message"`
+	RetryAfter int       `json:"retry_after"`
+	StartedAt  time.Time `json:"started_at,omitempty"`
+
+	// Forced is set when config turns read-only mode on, in which case the
+	// runtime toggle can't turn it off
+	Forced bool `json:"forced"`
+}
+
+// ReadOnly manages read-only mode: reads keep working while writes are
+// refused, e.g. during a database failover. Unlike maintenance mode the
+// site stays up. The runtime toggle is a file so the CLI and every process
+// sharing it see the same state.
+type ReadOnly struct {
+	filePath string
+	config   config.ReadOnlyConfig
+	mu       sync.RWMutex
+}
+
+// NewReadOnly creates a read-only mode manager
+func NewReadOnly(filePath string, cfg config.ReadOnlyConfig) *ReadOnly {
+	if filePath == "" {
+		filePath = "storage/framework/read_only.json"
+	}
+	if cfg.Message == "" {
+		cfg.Message = "The application is temporarily read-only. You can keep browsing, but changes are paused."
+	}
+	return &ReadOnly{filePath: filePath, config: cfg}
+}
+
+// Enable turns read-only mode on; empty message and zero retryAfter fall
+// back to the configured ones
+func (r *ReadOnly) Enable(message string, retryAfter int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	info := ReadOnlyInfo{
+		Enabled:    true,
+		Message:    message,
+		RetryAfter: retryAfter,
+		StartedAt:  time.Now(),
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.filePath), 0755); err != nil {
+		return fmt.Errorf("failed to create read-only directory: %w", err)
+	}
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(r.filePath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write read-only file: %w", err)
+	}
+	return nil
+}
+
+// Disable turns the runtime toggle off. Read-only mode stays on while
+// config forces it.
+func (r *ReadOnly) Disable() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := os.Remove(r.filePath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove read-only file: %w", err)
+	}
+	return nil
+}
+
+// IsEnabled reports whether writes are currently refused
+func (r *ReadOnly) IsEnabled() bool {
+	return r.Info().Enabled
+}
+
+// Info returns the current state, merging the runtime toggle with config
+func (r *ReadOnly) Info() ReadOnlyInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var info ReadOnlyInfo
+	if data, err := os.ReadFile(r.filePath); err == nil {
+		json.Unmarshal(data, &info)
+	}
+	if r.config.Enabled {
+		info.Enabled = true
+		info.Forced = true
+	}
+	if info.Message == "" {
+		info.Message = r.config.Message
+	}
+	if info.RetryAfter == 0 {
+		info.RetryAfter = r.config.RetryAfter
+	}
+	return info
+}
+
+// ReadOnlyMiddleware refuses state-changing requests while read-only mode
+// is on
+type ReadOnlyMiddleware struct {
+	readOnly *ReadOnly
+	exempt   []string
+}
+
+// NewReadOnlyMiddleware creates the middleware. Requests under the exempt
+// path prefixes, such as the admin toggle, are always let through.
+func NewReadOnlyMiddleware(readOnly *ReadOnly, exempt ...string) *ReadOnlyMiddleware {
+	return &ReadOnlyMiddleware{readOnly: readOnly, exempt: exempt}
+}
+
+// Handle returns the read-only middleware handler
+func (m *ReadOnlyMiddleware) Handle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := m.readOnly.Info()
+		if !info.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("X-Read-Only", "true")
+		if isSafeMethod(r.Method) || m.isExempt(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		m.returnReadOnlyResponse(w, r, info)
+	})
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+func (m *ReadOnlyMiddleware) isExempt(path string) bool {
+	for _, prefix := range m.exempt {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// returnReadOnlyResponse answers a refused write with 503, as JSON or as a
+// short page for browsers submitting forms
+func (m *ReadOnlyMiddleware) returnReadOnlyResponse(w http.ResponseWriter, r *http.Request, info ReadOnlyInfo) {
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	if info.RetryAfter > 0 {
+		w.Header().Set("Retry-After", fmt.Sprintf("%d", info.RetryAfter))
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "text/html") {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, `<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="UTF-8"><title>Read-only mode</title></head>
+<body style="font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; text-align: center; padding: 4rem;">
+    <div style="font-size: 3rem;">🐬</div>
+    <h1>Changes are paused</h1>
+    <p>%s</p>
+    <p><a href="javascript:history.back()">Go back</a></p>
+</body>
+</html>`, html.EscapeString(info.Message))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":       "Service Unavailable",
+		"message":     info.Message,
+		"status":      "read_only",
+		"code":        503,
+		"retry_after": info.RetryAfter,
+	})
+}
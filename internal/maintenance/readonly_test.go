@@ -0,0 +1,80 @@
+package maintenance
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+func serveReadOnly(ro *ReadOnly, method, path string) *httptest.ResponseRecorder {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	w := httptest.NewRecorder()
+	NewReadOnlyMiddleware(ro, "/maintenance/").Handle(next).ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	return w
+}
+
+func TestReadOnlyMiddleware_Disabled(t *testing.T) {
+	ro := NewReadOnly(filepath.Join(t.TempDir(), "read_only.json"), config.ReadOnlyConfig{})
+
+	if w := serveReadOnly(ro, http.MethodPost, "/api/users"); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 when disabled, got %d", w.Code)
+	}
+}
+
+func TestReadOnlyMiddleware_Enabled(t *testing.T) {
+	ro := NewReadOnly(filepath.Join(t.TempDir(), "read_only.json"), config.ReadOnlyConfig{RetryAfter: 30})
+	if err := ro.Enable("failover in progress", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	w := serveReadOnly(ro, http.MethodGet, "/api/users")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected GET to pass, got %d", w.Code)
+	}
+	if w.Header().Get("X-Read-Only") != "true" {
+		t.Fatal("expected X-Read-Only header")
+	}
+
+	w = serveReadOnly(ro, http.MethodPost, "/api/users")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 for POST, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "30" {
+		t.Fatalf("expected configured Retry-After, got %q", w.Header().Get("Retry-After"))
+	}
+	if !strings.Contains(w.Body.String(), "failover in progress") {
+		t.Fatalf("expected message in body, got %s", w.Body.String())
+	}
+
+	if w := serveReadOnly(ro, http.MethodDelete, "/maintenance/read-only"); w.Code != http.StatusOK {
+		t.Fatalf("expected exempt path to pass, got %d", w.Code)
+	}
+
+	if err := ro.Disable(); err != nil {
+		t.Fatal(err)
+	}
+	if w := serveReadOnly(ro, http.MethodPost, "/api/users"); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 after disable, got %d", w.Code)
+	}
+}
+
+func TestReadOnly_ForcedByConfig(t *testing.T) {
+	ro := NewReadOnly(filepath.Join(t.TempDir(), "read_only.json"), config.ReadOnlyConfig{Enabled: true})
+	if err := ro.Disable(); err != nil {
+		t.Fatal(err)
+	}
+
+	info := ro.Info()
+	if !info.Enabled || !info.Forced {
+		t.Fatalf("expected config to force read-only mode, got %+v", info)
+	}
+	if w := serveReadOnly(ro, http.MethodPut, "/api/users/1"); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", w.Code)
+	}
+}
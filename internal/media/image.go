@@ -0,0 +1,244 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+)
+
+// Image formats, as named by image.Decode
+const (
+	JPEG = "jpeg"
+	PNG  = "png"
+	GIF  = "gif"
+)
+
+// DefaultQuality is the JPEG quality images are encoded at unless told
+// otherwise
+const DefaultQuality = 85
+
+// ErrUnsupportedFormat is returned for images in a format that can't be
+// processed
+var ErrUnsupportedFormat = errors.New("media: unsupported image format")
+
+// Fit is how a variant fills its box
+type Fit string
+
+const (
+	// Contain scales the image to fit inside the box, keeping its aspect
+	// ratio; the result may be smaller than the box on one side
+	Contain Fit = "contain"
+	// Cover scales the image to cover the box and crops what is left over,
+	// keeping the center
+	Cover Fit = "cover"
+	// Stretch scales the image to the box exactly
+	Stretch Fit = "stretch"
+)
+
+// Decode reads an image and turns it upright as its EXIF orientation
+// says, returning it with its format. The metadata itself is dropped:
+// images encoded again carry none.
+func Decode(r io.Reader) (image.Image, string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, "", err
+	}
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	if format == JPEG {
+		if orientation := exifOrientation(data); orientation > 1 {
+			img = orient(toRGBA(img), orientation)
+		}
+	}
+	return img, format, nil
+}
+
+// Encode writes img in format, JPEG at quality (DefaultQuality when 0).
+// Transparent images written as JPEG are flattened onto white.
+func Encode(w io.Writer, img image.Image, format string, quality int) error {
+	switch format {
+	case JPEG:
+		if quality <= 0 || quality > 100 {
+			quality = DefaultQuality
+		}
+		return jpeg.Encode(w, flatten(img), &jpeg.Options{Quality: quality})
+	case PNG:
+		return png.Encode(w, img)
+	case GIF:
+		return gif.Encode(w, img, nil)
+	default:
+		return fmt.Errorf("%w: %q", ErrUnsupportedFormat, format)
+	}
+}
+
+// Resize scales img to fit in width × height as fit says. A zero width or
+// height is worked out from the other, keeping the aspect ratio. Images
+// are never scaled up beyond their own size, except by Stretch.
+func Resize(img image.Image, width, height int, fit Fit) image.Image {
+	b := img.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	if sw == 0 || sh == 0 || (width <= 0 && height <= 0) {
+		return img
+	}
+	if width <= 0 {
+		width = max(1, int(math.Round(float64(sw)*float64(height)/float64(sh))))
+	}
+	if height <= 0 {
+		height = max(1, int(math.Round(float64(sh)*float64(width)/float64(sw))))
+	}
+
+	switch fit {
+	case Stretch:
+		return scale(img, width, height)
+	case Cover:
+		// Crop the source to the box's aspect ratio, then scale it down
+		ratio := math.Max(float64(width)/float64(sw), float64(height)/float64(sh))
+		cw := min(sw, int(math.Round(float64(width)/ratio)))
+		ch := min(sh, int(math.Round(float64(height)/ratio)))
+		x := b.Min.X + (sw-cw)/2
+		y := b.Min.Y + (sh-ch)/2
+		cropped := Crop(img, image.Rect(x, y, x+cw, y+ch))
+		if ratio >= 1 {
+			return cropped
+		}
+		return scale(cropped, width, height)
+	default:
+		ratio := math.Min(float64(width)/float64(sw), float64(height)/float64(sh))
+		if ratio >= 1 {
+			return img
+		}
+		return scale(img, max(1, int(math.Round(float64(sw)*ratio))), max(1, int(math.Round(float64(sh)*ratio))))
+	}
+}
+
+// Crop returns the part of img inside rect, which is clipped to the image
+func Crop(img image.Image, rect image.Rectangle) image.Image {
+	rect = rect.Intersect(img.Bounds())
+	dst := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, rect.Min, draw.Src)
+	return dst
+}
+
+// toRGBA returns img as an RGBA image whose bounds start at 0, 0
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+	return dst
+}
+
+// flatten draws images that may be transparent onto white, as JPEG has no
+// alpha channel
+func flatten(img image.Image) image.Image {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok && opaque.Opaque() {
+		return img
+	}
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Over)
+	return dst
+}
+
+// scale resamples img to width × height with a triangle filter widened
+// when shrinking, so every source pixel counts and thumbnails don't alias
+func scale(img image.Image, width, height int) *image.RGBA {
+	src := toRGBA(img)
+	b := src.Bounds()
+	tmp := image.NewRGBA(image.Rect(0, 0, width, b.Dy()))
+	resampleAxis(tmp, src, weights(b.Dx(), width), true)
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	resampleAxis(dst, tmp, weights(b.Dy(), height), false)
+	return dst
+}
+
+// contribution is the source pixels making one destination pixel along an
+// axis, from start, and how much each counts
+type contribution struct {
+	start   int
+	weights []float64
+}
+
+// weights works out the contributions for scaling an axis of srcSize
+// pixels to dstSize
+func weights(srcSize, dstSize int) []contribution {
+	ratio := float64(srcSize) / float64(dstSize)
+	support := math.Max(ratio, 1)
+	contributions := make([]contribution, dstSize)
+	for i := range contributions {
+		center := (float64(i) + 0.5) * ratio
+		start := max(0, int(math.Floor(center-support)))
+		end := min(srcSize, int(math.Ceil(center+support)))
+
+		var sum float64
+		ws := make([]float64, 0, end-start)
+		for j := start; j < end; j++ {
+			w := 1 - math.Abs((float64(j)+0.5-center)/support)
+			if w < 0 {
+				w = 0
+			}
+			ws = append(ws, w)
+			sum += w
+		}
+		if sum == 0 {
+			// Upscaling exactly between pixels; take the nearest
+			start, ws, sum = min(int(center), srcSize-1), []float64{1}, 1
+		}
+		for j := range ws {
+			ws[j] /= sum
+		}
+		contributions[i] = contribution{start: start, weights: ws}
+	}
+	return contributions
+}
+
+// resampleAxis fills dst from src along x when horizontal, else along y,
+// the other axis being the same size in both
+func resampleAxis(dst, src *image.RGBA, contributions []contribution, horizontal bool) {
+	db := dst.Bounds()
+	for y := 0; y < db.Dy(); y++ {
+		for x := 0; x < db.Dx(); x++ {
+			var c contribution
+			if horizontal {
+				c = contributions[x]
+			} else {
+				c = contributions[y]
+			}
+			var r, g, b, a float64
+			for k, w := range c.weights {
+				var i int
+				if horizontal {
+					i = src.PixOffset(c.start+k, y)
+				} else {
+					i = src.PixOffset(x, c.start+k)
+				}
+				r += float64(src.Pix[i]) * w
+				g += float64(src.Pix[i+1]) * w
+				b += float64(src.Pix[i+2]) * w
+				a += float64(src.Pix[i+3]) * w
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = clampByte(r)
+			dst.Pix[i+1] = clampByte(g)
+			dst.Pix[i+2] = clampByte(b)
+			dst.Pix[i+3] = clampByte(a)
+		}
+	}
+}
+
+func clampByte(v float64) uint8 {
+	return uint8(math.Max(0, math.Min(255, math.Round(v))))
+}
@@ -0,0 +1,219 @@
+// Package media accepts file uploads and processes images. Uploads are
+// checked by their content rather than by what the client claims, then
+// stored on a storage driver; images are turned upright and stripped of
+// their EXIF metadata on the way, and thumbnails are made after the
+// request has been answered:
+//
+//	file, err := media.FromRequest(r, "avatar", media.Rules{MaxBytes: 5 << 20, Types: media.ImageTypes})
+//	if err != nil {
+//		problem.Write(w, r, err) // 422 for invalid files
+//		return
+//	}
+//	stored, err := media.Default.Store(file, "avatars",
+//		media.Variant{Name: "thumb", Width: 200, Height: 200, Fit: media.Cover})
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/mrhoseah/dolphin/internal/binding"
+	"github.com/mrhoseah/dolphin/internal/correlation"
+	"github.com/mrhoseah/dolphin/internal/validation"
+)
+
+const (
+	// DefaultMaxBytes is the largest upload accepted when Rules don't say
+	DefaultMaxBytes = 10 << 20
+
+	// DefaultMaxPixels is the largest image, in pixels, accepted when Rules
+	// don't say
+	DefaultMaxPixels = 40_000_000
+)
+
+// ImageTypes are the image types that can be resized and converted
+var ImageTypes = []string{"image/jpeg", "image/png", "image/gif"}
+
+// Rules limit the uploads accepted
+type Rules struct {
+	// MaxBytes is the largest file accepted; DefaultMaxBytes when 0
+	MaxBytes int64
+
+	// Types lists the media types accepted, such as "application/pdf", or
+	// "image/*" for any image. Types are sniffed from the content. Any type
+	// is accepted when empty.
+	Types []string
+
+	// MaxPixels bounds an image's width × height, so a small file can't
+	// decode into a huge bitmap; DefaultMaxPixels when 0
+	MaxPixels int
+}
+
+func (r Rules) maxBytes() int64 {
+	if r.MaxBytes > 0 {
+		return r.MaxBytes
+	}
+	return DefaultMaxBytes
+}
+
+func (r Rules) maxPixels() int {
+	if r.MaxPixels > 0 {
+		return r.MaxPixels
+	}
+	return DefaultMaxPixels
+}
+
+// accepts reports whether contentType is one of the rules' types
+func (r Rules) accepts(contentType string) bool {
+	if len(r.Types) == 0 {
+		return true
+	}
+	for _, t := range r.Types {
+		if t == contentType || (strings.HasSuffix(t, "/*") && strings.HasPrefix(contentType, strings.TrimSuffix(t, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// File is an upload that passed its rules
+type File struct {
+	// Field is the form field the file was sent in
+	Field string
+
+	// Name is the file name the client gave, without any directories. It
+	// is for display only: stored files get names of their own.
+	Name string
+
+	Size int64
+
+	// ContentType is sniffed from the content
+	ContentType string
+
+	// Format is the image format, such as "jpeg", for images that can be
+	// processed, with their Width and Height
+	Format        string
+	Width, Height int
+
+	header *multipart.FileHeader
+
+	// correlation identifies the request the file was uploaded in, for
+	// the jobs making its variants
+	correlation correlation.Fields
+}
+
+// Open opens the uploaded file for reading
+func (f *File) Open() (multipart.File, error) {
+	return f.header.Open()
+}
+
+// IsImage reports whether the file is an image that can be processed
+func (f *File) IsImage() bool {
+	return f.Format != ""
+}
+
+// Validate checks an uploaded file against rules, returning it as a File.
+// A file that breaks them is reported as validation.ValidationErrors for
+// field, which problem.Write answers with 422.
+func Validate(field string, header *multipart.FileHeader, rules Rules) (*File, error) {
+	invalid := func(format string, args ...any) error {
+		var errs validation.ValidationErrors
+		errs.AddError(field, fmt.Sprintf(format, args...), header.Filename)
+		return errs
+	}
+
+	if header.Size > rules.maxBytes() {
+		return nil, invalid("must not be larger than %s", formatBytes(rules.maxBytes()))
+	}
+
+	f, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	head = head[:n]
+	if n == 0 {
+		return nil, invalid("must not be empty")
+	}
+
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if !rules.accepts(contentType) {
+		return nil, invalid("must be a file of type %s", strings.Join(rules.Types, ", "))
+	}
+
+	file := &File{
+		Field:       field,
+		Name:        filepath.Base(strings.ReplaceAll(header.Filename, `\`, "/")),
+		Size:        header.Size,
+		ContentType: contentType,
+		header:      header,
+	}
+	if contentType == "image/jpeg" || contentType == "image/png" || contentType == "image/gif" {
+		config, format, err := image.DecodeConfig(io.MultiReader(bytes.NewReader(head), f))
+		if err != nil {
+			return nil, invalid("must be a valid image")
+		}
+		if config.Width*config.Height > rules.maxPixels() {
+			return nil, invalid("must not be larger than %d pixels", rules.maxPixels())
+		}
+		file.Format, file.Width, file.Height = format, config.Width, config.Height
+	}
+	return file, nil
+}
+
+// FromRequest validates the file uploaded in a multipart form's field.
+// The form is parsed if it hasn't been, allowing a body big enough for
+// rules.MaxBytes even when the route's body limit is smaller.
+func FromRequest(r *http.Request, field string, rules Rules) (*File, error) {
+	if r.MultipartForm == nil {
+		limits := binding.LimitsFromContext(r.Context())
+		if size := rules.maxBytes() + 1<<20; limits.MaxBytes < size {
+			limits.MaxBytes = size
+		}
+		if _, err := binding.ParseBody(r, limits); err != nil {
+			return nil, err
+		}
+	}
+
+	var files []*multipart.FileHeader
+	if r.MultipartForm != nil {
+		files = r.MultipartForm.File[field]
+	}
+	if len(files) == 0 {
+		var errs validation.ValidationErrors
+		errs.AddError(field, "is required", nil)
+		return nil, errs
+	}
+	file, err := Validate(field, files[0], rules)
+	if err != nil {
+		return nil, err
+	}
+	file.correlation = correlation.Capture(r.Context())
+	return file, nil
+}
+
+// formatBytes writes a size in the largest whole unit, e.g. 5MB
+func formatBytes(n int64) string {
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}} {
+		if n >= unit.size && n%unit.size == 0 {
+			return fmt.Sprintf("%d%s", n/unit.size, unit.suffix)
+		}
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
@@ -0,0 +1,281 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/problem"
+	"github.com/mrhoseah/dolphin/internal/providers"
+	"github.com/mrhoseah/dolphin/internal/scan"
+	"github.com/mrhoseah/dolphin/internal/storage"
+	"github.com/mrhoseah/dolphin/internal/validation"
+)
+
+// testImage is a w × h image, red on its left half and blue on its right
+func testImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= w/2 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+// withOrientation inserts an EXIF segment recording orientation after a
+// JPEG's start marker
+func withOrientation(data []byte, orientation uint16) []byte {
+	tiff := []byte("II*\x00\x08\x00\x00\x00")
+	tiff = binary.LittleEndian.AppendUint16(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, exifOrientationTag)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 3) // SHORT
+	tiff = binary.LittleEndian.AppendUint32(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+
+	out := []byte{0xFF, 0xD8, 0xFF, 0xE1}
+	out = binary.BigEndian.AppendUint16(out, uint16(len(segment)+2))
+	out = append(out, segment...)
+	return append(out, data[2:]...)
+}
+
+// uploadRequest is a multipart request sending content as field
+func uploadRequest(t *testing.T, field, filename string, content []byte) *http.Request {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile(field, filename)
+	require.NoError(t, err)
+	_, err = part.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, mw.Close())
+
+	r := httptest.NewRequest(http.MethodPost, "/avatars", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return r
+}
+
+func fieldError(t *testing.T, err error) string {
+	t.Helper()
+	var errs validation.ValidationErrors
+	require.ErrorAs(t, err, &errs)
+	require.Len(t, errs.Errors, 1)
+	return errs.Errors[0].Field + " " + errs.Errors[0].Message
+}
+
+func TestFromRequest(t *testing.T) {
+	rules := Rules{MaxBytes: 1 << 20, Types: []string{"image/*"}}
+
+	file, err := FromRequest(uploadRequest(t, "avatar", `C:\photos\me.png`, encodePNG(t, testImage(40, 20))), "avatar", rules)
+	require.NoError(t, err)
+	assert.Equal(t, "me.png", file.Name)
+	assert.Equal(t, "image/png", file.ContentType)
+	assert.Equal(t, PNG, file.Format)
+	assert.Equal(t, 40, file.Width)
+
+	// The content decides the type, not the name
+	_, err = FromRequest(uploadRequest(t, "avatar", "me.png", []byte("<?php echo 1; ?>")), "avatar", rules)
+	assert.Equal(t, "avatar must be a file of type image/*", fieldError(t, err))
+
+	_, err = FromRequest(uploadRequest(t, "other", "me.png", encodePNG(t, testImage(4, 4))), "avatar", rules)
+	assert.Equal(t, "avatar is required", fieldError(t, err))
+
+	_, err = FromRequest(uploadRequest(t, "avatar", "me.png", encodePNG(t, testImage(40, 20))), "avatar", Rules{MaxBytes: 10})
+	assert.Equal(t, "avatar must not be larger than 10 bytes", fieldError(t, err))
+
+	_, err = FromRequest(uploadRequest(t, "avatar", "me.png", encodePNG(t, testImage(40, 20))), "avatar", Rules{MaxPixels: 100})
+	assert.Equal(t, "avatar must not be larger than 100 pixels", fieldError(t, err))
+
+	truncated := encodePNG(t, testImage(40, 20))[:20]
+	_, err = FromRequest(uploadRequest(t, "avatar", "me.png", truncated), "avatar", rules)
+	assert.Equal(t, "avatar must be a valid image", fieldError(t, err))
+}
+
+func TestDecodeAppliesOrientation(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, testImage(40, 20), &jpeg.Options{Quality: 95}))
+
+	img, format, err := Decode(bytes.NewReader(withOrientation(buf.Bytes(), 6)))
+	require.NoError(t, err)
+	assert.Equal(t, JPEG, format)
+	assert.Equal(t, image.Rect(0, 0, 20, 40), img.Bounds(), "turned a quarter clockwise")
+	// The red left half is now the top
+	r, _, b, _ := img.At(10, 5).RGBA()
+	assert.Greater(t, r, b)
+
+	var out bytes.Buffer
+	require.NoError(t, Encode(&out, img, JPEG, 0))
+	assert.Equal(t, 0, exifOrientation(out.Bytes()), "metadata is not written back")
+}
+
+func TestResize(t *testing.T) {
+	img := testImage(400, 200)
+
+	assert.Equal(t, image.Rect(0, 0, 100, 50), Resize(img, 100, 100, Contain).Bounds())
+	assert.Equal(t, image.Rect(0, 0, 100, 100), Resize(img, 100, 100, Cover).Bounds())
+	assert.Equal(t, image.Rect(0, 0, 100, 30), Resize(img, 100, 30, Stretch).Bounds())
+	assert.Equal(t, image.Rect(0, 0, 50, 25), Resize(img, 50, 0, Contain).Bounds())
+	assert.Equal(t, img.Bounds(), Resize(img, 800, 800, Contain).Bounds(), "never scaled up")
+
+	// Colors survive, blending only at the seam
+	thumb := Resize(img, 40, 20, Contain)
+	r, _, b, a := thumb.At(5, 10).RGBA()
+	assert.Equal(t, uint32(0xFFFF), r)
+	assert.Equal(t, uint32(0), b)
+	assert.Equal(t, uint32(0xFFFF), a)
+
+	assert.Equal(t, image.Rect(0, 0, 5, 5), Crop(img, image.Rect(395, 195, 410, 210)).Bounds(), "clipped to the image")
+}
+
+type recordingQueue struct {
+	providers.QueueProvider
+	jobs []providers.Job
+}
+
+func (q *recordingQueue) Push(queue string, job providers.Job) error {
+	q.jobs = append(q.jobs, job)
+	return nil
+}
+
+func TestUploaderStore(t *testing.T) {
+	dir := t.TempDir()
+	uploader := New(storage.NewLocalDriver(dir, "/uploads"), nil)
+	thumb := Variant{Name: "thumb", Width: 50, Height: 50, Fit: Cover, Format: JPEG}
+
+	file, err := FromRequest(uploadRequest(t, "avatar", "me.png", encodePNG(t, testImage(400, 200))), "avatar", Rules{})
+	require.NoError(t, err)
+	stored, err := uploader.Store(file, "avatars", thumb)
+	require.NoError(t, err)
+	uploader.Close()
+
+	assert.True(t, strings.HasPrefix(stored.Path, "avatars/"))
+	assert.True(t, strings.HasSuffix(stored.Path, ".png"))
+	assert.Equal(t, "/uploads/"+stored.Path, stored.URL)
+	thumbPath := strings.TrimSuffix(stored.Path, ".png") + "-thumb.jpg"
+	assert.Equal(t, "/uploads/"+thumbPath, stored.Variants["thumb"])
+
+	data, err := os.ReadFile(filepath.Join(dir, thumbPath))
+	require.NoError(t, err)
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, JPEG, format)
+	assert.Equal(t, 50, config.Width)
+	assert.Equal(t, 50, config.Height)
+
+	require.NoError(t, uploader.Delete(stored.Path, thumb))
+	assert.NoFileExists(t, filepath.Join(dir, thumbPath))
+	assert.NoFileExists(t, filepath.Join(dir, stored.Path))
+
+	// Other files are kept as they are, named by their content
+	pdf := []byte("%PDF-1.4\n%%EOF\n")
+	file, err = FromRequest(uploadRequest(t, "doc", "invoice.exe", pdf), "doc", Rules{Types: []string{"application/pdf"}})
+	require.NoError(t, err)
+	stored, err = uploader.Store(file, "docs", thumb)
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(stored.Path, ".pdf"))
+	assert.Empty(t, stored.Variants)
+	data, err = os.ReadFile(filepath.Join(dir, stored.Path))
+	require.NoError(t, err)
+	assert.Equal(t, pdf, data)
+}
+
+func TestUploaderQueuesVariants(t *testing.T) {
+	dir := t.TempDir()
+	queue := &recordingQueue{}
+	uploader := New(storage.NewLocalDriver(dir, "/uploads"), nil)
+	uploader.UseQueue(queue, "media")
+	thumb := Variant{Name: "thumb", Width: 20}
+
+	file, err := FromRequest(uploadRequest(t, "avatar", "me.png", encodePNG(t, testImage(40, 20))), "avatar", Rules{})
+	require.NoError(t, err)
+	stored, err := uploader.Store(file, "avatars", thumb)
+	require.NoError(t, err)
+
+	require.Len(t, queue.jobs, 1)
+	thumbPath := filepath.Join(dir, VariantPath(stored.Path, thumb))
+	assert.NoFileExists(t, thumbPath, "made by the worker")
+
+	require.NoError(t, uploader.JobHandler()(queue.jobs[0]))
+	assert.FileExists(t, thumbPath)
+
+	assert.Error(t, uploader.JobHandler()(providers.Job{ID: "1", Type: "mail"}))
+}
+
+// flaggingScanner finds every file containing "virus" infected
+type flaggingScanner struct{}
+
+func (flaggingScanner) Scan(ctx context.Context, r io.Reader) (scan.Result, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return scan.Result{}, err
+	}
+	if bytes.Contains(data, []byte("virus")) {
+		return scan.Result{Infected: true, Signature: "Test-Signature"}, nil
+	}
+	return scan.Result{}, nil
+}
+
+func (flaggingScanner) Name() string { return "test" }
+
+func TestUploaderScans(t *testing.T) {
+	dir := t.TempDir()
+	uploader := New(storage.NewLocalDriver(dir, "/uploads"), nil)
+	guard, err := scan.NewGuard(flaggingScanner{}, config.ScanConfig{AsyncAbove: 100}, nil, nil)
+	require.NoError(t, err)
+	uploader.UseScanner(guard)
+	rules := Rules{Types: []string{"text/plain"}}
+
+	file, err := FromRequest(uploadRequest(t, "doc", "notes.txt", []byte("a virus")), "doc", rules)
+	require.NoError(t, err)
+	_, err = uploader.Store(file, "docs")
+	require.True(t, scan.IsInfected(err), err)
+	assert.Equal(t, map[string]string{"doc": "must not contain malware"}, problem.From(err).Errors)
+	entries, _ := os.ReadDir(dir)
+	assert.Empty(t, entries, "nothing is stored")
+
+	file, err = FromRequest(uploadRequest(t, "doc", "notes.txt", []byte("clean")), "doc", rules)
+	require.NoError(t, err)
+	stored, err := uploader.Store(file, "docs")
+	require.NoError(t, err)
+	assert.False(t, stored.ScanPending)
+
+	// Large files are stored and scanned by a queue job
+	queue := &recordingQueue{}
+	guard.UseQueue(queue, "scans")
+	file, err = FromRequest(uploadRequest(t, "doc", "big.txt", []byte(strings.Repeat("a virus ", 20))), "doc", rules)
+	require.NoError(t, err)
+	stored, err = uploader.Store(file, "docs")
+	require.NoError(t, err)
+	assert.True(t, stored.ScanPending)
+	require.Len(t, queue.jobs, 1)
+	assert.FileExists(t, filepath.Join(dir, stored.Path))
+	require.NoError(t, guard.JobHandler()(queue.jobs[0]))
+	assert.NoFileExists(t, filepath.Join(dir, stored.Path))
+}
@@ -0,0 +1,331 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/correlation"
+	"github.com/mrhoseah/dolphin/internal/logger"
+	"github.com/mrhoseah/dolphin/internal/providers"
+	"github.com/mrhoseah/dolphin/internal/scan"
+	"github.com/mrhoseah/dolphin/internal/storage"
+)
+
+// JobType is the type of the queue jobs that make variants
+const JobType = "media.variants"
+
+// ScanDisk is the name the uploader's disk is added to a scan.Guard under
+const ScanDisk = "media"
+
+// storeQuality is the JPEG quality uploads are encoded again at, high
+// enough that the copy can't be told from the original
+const storeQuality = 90
+
+// Variant is a resized copy of an uploaded image, such as a thumbnail
+type Variant struct {
+	// Name tells the variant's file apart, e.g. photo-thumb.jpg
+	Name string `json:"name"`
+
+	// Width and Height bound the variant; one may be 0 to keep the aspect
+	// ratio
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+
+	// Fit is how the image fills the box; Contain when empty
+	Fit Fit `json:"fit,omitempty"`
+
+	// Format converts the variant, e.g. to "jpeg"; the original's when empty
+	Format string `json:"format,omitempty"`
+
+	// Quality is the JPEG quality; DefaultQuality when 0
+	Quality int `json:"quality,omitempty"`
+}
+
+// Stored is an upload saved on a disk
+type Stored struct {
+	// Path is where the file is on the disk, and URL where it is served
+	Path string `json:"path"`
+	URL  string `json:"url"`
+
+	// Name is the file name the client gave
+	Name        string `json:"name"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type"`
+	Width       int    `json:"width,omitempty"`
+	Height      int    `json:"height,omitempty"`
+
+	// Variants maps each variant's name to the URL it is served at once
+	// made
+	Variants map[string]string `json:"variants,omitempty"`
+
+	// ScanPending is set when the file is too large to be scanned before
+	// it was stored, and a queue job will scan it
+	ScanPending bool `json:"scan_pending,omitempty"`
+}
+
+// Uploader stores uploads on a storage disk and makes images' variants,
+// through a queue when it has one
+type Uploader struct {
+	disk      storage.Driver
+	logger    *zap.Logger
+	queue     providers.QueueProvider
+	queueName string
+	guard     *scan.Guard
+	wg        sync.WaitGroup
+}
+
+// Default stores uploads under storage/uploads, which the router serves at
+// /uploads
+var Default = New(storage.NewLocalDriver("./storage/uploads", "/uploads"), nil)
+
+// New creates an uploader storing files on disk
+func New(disk storage.Driver, logger *zap.Logger) *Uploader {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &Uploader{disk: disk, logger: logger}
+}
+
+// SetDisk replaces the disk files are stored on
+func (u *Uploader) SetDisk(disk storage.Driver) {
+	u.disk = disk
+	if u.guard != nil {
+		u.guard.AddDisk(ScanDisk, disk)
+	}
+}
+
+// SetLogger replaces the logger
+func (u *Uploader) SetLogger(logger *zap.Logger) {
+	u.logger = logger
+}
+
+// UseQueue makes variants through jobs pushed to the named queue. The
+// queue's workers must process them with JobHandler. Without a queue,
+// variants are made in the background of the process storing the upload.
+func (u *Uploader) UseQueue(queue providers.QueueProvider, name string) {
+	u.queue = queue
+	u.queueName = name
+}
+
+// UseScanner has uploads scanned for malware by guard before they are
+// stored. Infected files are refused with a *scan.InfectedError, which
+// problem.Write answers with 422. Files the guard scans asynchronously
+// are stored first and marked ScanPending.
+func (u *Uploader) UseScanner(guard *scan.Guard) {
+	u.guard = guard
+	guard.AddDisk(ScanDisk, u.disk)
+}
+
+// URL returns where a stored file is served, as the disk says: a path
+// under the local disk's base URL, a bucket URL and so on
+func (u *Uploader) URL(file string) string {
+	return u.disk.URL(file)
+}
+
+// VariantPath returns where the named variant of the image at file is
+// stored
+func VariantPath(file string, v Variant) string {
+	ext := path.Ext(file)
+	if v.Format != "" {
+		ext = extension(v.Format)
+	}
+	return strings.TrimSuffix(file, path.Ext(file)) + "-" + v.Name + ext
+}
+
+// Store saves file under dir with a new random name and queues the
+// variants of images. Images are turned upright and encoded again, which
+// drops their EXIF metadata, such as where a photo was taken; GIFs, which
+// carry none, are stored as they are so animations are kept. With a
+// scanner, infected files are refused before anything is stored.
+func (u *Uploader) Store(file *File, dir string, variants ...Variant) (*Stored, error) {
+	src, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	name := path.Join(dir, uuid.NewString()+contentExtension(file))
+	ctx := correlation.Restore(context.Background(), file.correlation)
+	async := u.guard != nil && u.guard.Async(file.Size)
+	if u.guard != nil && !async {
+		if err := u.guard.Check(ctx, ScanDisk, name, src); err != nil {
+			var infected *scan.InfectedError
+			if errors.As(err, &infected) {
+				infected.Field = file.Field
+			}
+			return nil, err
+		}
+	}
+	stored := &Stored{
+		Path:        name,
+		Name:        file.Name,
+		Size:        file.Size,
+		ContentType: file.ContentType,
+		Width:       file.Width,
+		Height:      file.Height,
+	}
+
+	var content io.Reader = src
+	if file.Format == JPEG || file.Format == PNG {
+		img, format, err := Decode(src)
+		if err != nil {
+			return nil, fmt.Errorf("media: decoding %s: %w", file.Name, err)
+		}
+		var buf bytes.Buffer
+		if err := Encode(&buf, img, format, storeQuality); err != nil {
+			return nil, err
+		}
+		b := img.Bounds()
+		stored.Size, stored.Width, stored.Height = int64(buf.Len()), b.Dx(), b.Dy()
+		content = &buf
+	}
+	if err := u.disk.Put(name, content); err != nil {
+		return nil, fmt.Errorf("media: storing %s: %w", name, err)
+	}
+	stored.URL = u.disk.URL(name)
+
+	if async {
+		queued, err := u.guard.Scan(ctx, ScanDisk, name, file.Size)
+		if err != nil {
+			var infected *scan.InfectedError
+			if errors.As(err, &infected) {
+				infected.Field = file.Field
+			}
+			return nil, err
+		}
+		stored.ScanPending = queued
+	}
+
+	if file.IsImage() && len(variants) > 0 {
+		stored.Variants = make(map[string]string, len(variants))
+		for _, v := range variants {
+			stored.Variants[v.Name] = u.disk.URL(VariantPath(name, v))
+		}
+		u.enqueue(name, variants, file.correlation)
+	}
+	return stored, nil
+}
+
+// MakeVariants makes the variants of the stored image at file
+func (u *Uploader) MakeVariants(file string, variants ...Variant) error {
+	src, err := u.disk.Get(file)
+	if err != nil {
+		return err
+	}
+	img, format, err := Decode(src)
+	src.Close()
+	if err != nil {
+		return fmt.Errorf("media: decoding %s: %w", file, err)
+	}
+
+	for _, v := range variants {
+		target := format
+		if v.Format != "" {
+			target = v.Format
+		}
+		var buf bytes.Buffer
+		if err := Encode(&buf, Resize(img, v.Width, v.Height, v.Fit), target, v.Quality); err != nil {
+			return fmt.Errorf("media: variant %s of %s: %w", v.Name, file, err)
+		}
+		if err := u.disk.Put(VariantPath(file, v), &buf); err != nil {
+			return fmt.Errorf("media: storing variant %s of %s: %w", v.Name, file, err)
+		}
+	}
+	return nil
+}
+
+// Delete removes a stored file and the variants made of it
+func (u *Uploader) Delete(file string, variants ...Variant) error {
+	for _, v := range variants {
+		if variant := VariantPath(file, v); u.disk.Exists(variant) {
+			if err := u.disk.Delete(variant); err != nil {
+				return err
+			}
+		}
+	}
+	return u.disk.Delete(file)
+}
+
+// JobHandler makes the variants of the jobs pushed to the uploader's queue
+func (u *Uploader) JobHandler() providers.JobHandler {
+	return func(job providers.Job) error {
+		file, _ := job.Payload["path"].(string)
+		encoded, _ := job.Payload["variants"].(string)
+		var variants []Variant
+		if job.Type != JobType || file == "" || json.Unmarshal([]byte(encoded), &variants) != nil {
+			return fmt.Errorf("media: not a variants job: %s", job.ID)
+		}
+		return correlation.Run(context.Background(), job.Correlation, "job "+job.Type, func(ctx context.Context) error {
+			return u.MakeVariants(file, variants...)
+		})
+	}
+}
+
+// Close waits for the variants being made in the background
+func (u *Uploader) Close() {
+	u.wg.Wait()
+}
+
+// enqueue hands the making of an image's variants to the queue, or to a
+// goroutine, carrying fields along
+func (u *Uploader) enqueue(file string, variants []Variant, fields correlation.Fields) {
+	if u.queue == nil {
+		u.wg.Add(1)
+		go func() {
+			defer u.wg.Done()
+			correlation.Run(context.Background(), fields, "job "+JobType, func(ctx context.Context) error {
+				err := u.MakeVariants(file, variants...)
+				if err != nil {
+					logger.FromContext(ctx).Error("Failed to make image variants", zap.String("path", file), zap.Error(err))
+				}
+				return err
+			})
+		}()
+		return
+	}
+
+	encoded, _ := json.Marshal(variants)
+	err := u.queue.Push(u.queueName, providers.Job{
+		ID:          file,
+		Type:        JobType,
+		Payload:     map[string]interface{}{"path": file, "variants": string(encoded)},
+		Correlation: fields,
+	})
+	if err != nil {
+		u.logger.Warn("Failed to queue image variants; making them now", zap.String("path", file), zap.Error(err))
+		if err := u.MakeVariants(file, variants...); err != nil {
+			u.logger.Error("Failed to make image variants", zap.String("path", file), zap.Error(err))
+		}
+	}
+}
+
+// contentExtension returns the extension a stored file gets, from its
+// sniffed type rather than the client's file name
+func contentExtension(file *File) string {
+	if file.Format != "" {
+		return extension(file.Format)
+	}
+	if exts, _ := mime.ExtensionsByType(file.ContentType); len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
+
+// extension returns the file extension of an image format
+func extension(format string) string {
+	if format == JPEG {
+		return ".jpg"
+	}
+	return "." + format
+}
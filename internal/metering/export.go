@@ -0,0 +1,105 @@
+package metering
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Exporter hands usage to a billing system
+type Exporter interface {
+	Export(ctx context.Context, usage []Usage) error
+}
+
+// CSVExporter writes usage as CSV with a header row
+type CSVExporter struct {
+	w io.Writer
+}
+
+// NewCSVExporter creates a CSV exporter writing to w
+func NewCSVExporter(w io.Writer) *CSVExporter {
+	return &CSVExporter{w: w}
+}
+
+func (e *CSVExporter) Export(ctx context.Context, usage []Usage) error {
+	w := csv.NewWriter(e.w)
+	if err := w.Write([]string{"tenant", "metric", "window_start", "window_end", "quantity", "events"}); err != nil {
+		return err
+	}
+	for _, u := range usage {
+		if err := w.Write([]string{
+			u.Tenant,
+			u.Metric,
+			u.WindowStart.UTC().Format(time.RFC3339),
+			u.WindowEnd.UTC().Format(time.RFC3339),
+			strconv.FormatInt(u.Quantity, 10),
+			strconv.FormatInt(u.Events, 10),
+		}); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// SignatureHeader carries the webhook body's HMAC-SHA256 when a secret is set
+const SignatureHeader = "X-Dolphin-Signature"
+
+// WebhookExporter POSTs usage as JSON, {"usage": [...]}, to a billing
+// endpoint. With a secret the body is signed so the receiver can verify it
+// came from this application.
+type WebhookExporter struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+// NewWebhookExporter creates a webhook exporter
+func NewWebhookExporter(url, secret string) *WebhookExporter {
+	return &WebhookExporter{url: url, secret: secret, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+func (e *WebhookExporter) Export(ctx context.Context, usage []Usage) error {
+	if usage == nil {
+		usage = []Usage{}
+	}
+	body, err := json.Marshal(map[string]interface{}{"usage": usage})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.secret != "" {
+		req.Header.Set(SignatureHeader, "sha256="+Sign(body, e.secret))
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("usage webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("usage webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the hex HMAC-SHA256 of body, as sent in SignatureHeader
+func Sign(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
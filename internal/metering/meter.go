@@ -0,0 +1,233 @@
+package metering
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/tenancy"
+)
+
+// Built-in billable metrics
+const (
+	MetricAPICalls     = "api_calls"
+	MetricStorageBytes = "storage_bytes"
+	MetricJobs         = "jobs_executed"
+)
+
+// Usage is the total of one metric for one tenant over an aggregation window
+type Usage struct {
+	Tenant      string    `json:"tenant"`
+	Metric      string    `json:"metric"`
+	WindowStart time.Time `json:"window_start"`
+	WindowEnd   time.Time `json:"window_end"`
+	Quantity    int64     `json:"quantity"`
+
+	// Events is how many events were recorded in the window
+	Events int64 `json:"events"`
+}
+
+type usageKey struct {
+	tenant, metric string
+	start          time.Time
+}
+
+// Meter aggregates billable events in memory per tenant, metric and window,
+// and saves each window to the store once it has closed. Recording never
+// touches the database, so it is cheap enough for every request.
+type Meter struct {
+	store  Store
+	window time.Duration
+	now    func() time.Time
+	logger *zap.Logger
+
+	mu   sync.Mutex
+	open map[usageKey]*Usage
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewMeter creates a meter aggregating into windows of the given size
+func NewMeter(store Store, window time.Duration, logger *zap.Logger) *Meter {
+	if window <= 0 {
+		window = time.Hour
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &Meter{
+		store:  store,
+		window: window,
+		now:    time.Now,
+		logger: logger,
+		open:   make(map[usageKey]*Usage),
+	}
+}
+
+// Window returns the aggregation window size
+func (m *Meter) Window() time.Duration {
+	return m.window
+}
+
+// Record records quantity of metric for the tenant in ctx. Events outside
+// a tenant are recorded under an empty tenant.
+func (m *Meter) Record(ctx context.Context, metric string, quantity int64) {
+	tenant := ""
+	if t, ok := tenancy.FromContext(ctx); ok {
+		tenant = t.ID
+	}
+	m.RecordTenant(tenant, metric, quantity)
+}
+
+// RecordTenant records quantity of metric for a tenant
+func (m *Meter) RecordTenant(tenant, metric string, quantity int64) {
+	start := m.now().UTC().Truncate(m.window)
+	key := usageKey{tenant: tenant, metric: metric, start: start}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.open[key]
+	if !ok {
+		u = &Usage{Tenant: tenant, Metric: metric, WindowStart: start, WindowEnd: start.Add(m.window)}
+		m.open[key] = u
+	}
+	u.Quantity += quantity
+	u.Events++
+}
+
+// Pending returns the usage not yet saved, including open windows
+func (m *Meter) Pending() []Usage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	usage := make([]Usage, 0, len(m.open))
+	for _, u := range m.open {
+		usage = append(usage, *u)
+	}
+	sortUsage(usage)
+	return usage
+}
+
+// Flush saves the windows that have closed
+func (m *Meter) Flush(ctx context.Context) error {
+	return m.flush(ctx, false)
+}
+
+// flush saves closed windows, or every window when all is set. Windows
+// that fail to save are kept and retried on the next flush.
+func (m *Meter) flush(ctx context.Context, all bool) error {
+	now := m.now().UTC()
+
+	m.mu.Lock()
+	var usage []Usage
+	for key, u := range m.open {
+		if all || !u.WindowEnd.After(now) {
+			usage = append(usage, *u)
+			delete(m.open, key)
+		}
+	}
+	m.mu.Unlock()
+
+	if len(usage) == 0 {
+		return nil
+	}
+	sortUsage(usage)
+	if err := m.store.Save(ctx, usage); err != nil {
+		m.restore(usage)
+		return err
+	}
+	return nil
+}
+
+// restore merges usage that failed to save back into the open windows
+func (m *Meter) restore(usage []Usage) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, u := range usage {
+		key := usageKey{tenant: u.Tenant, metric: u.Metric, start: u.WindowStart}
+		if existing, ok := m.open[key]; ok {
+			existing.Quantity += u.Quantity
+			existing.Events += u.Events
+		} else {
+			restored := u
+			m.open[key] = &restored
+		}
+	}
+}
+
+// Start flushes closed windows every interval until Close
+func (m *Meter) Start(interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	m.stop = make(chan struct{})
+	m.done = make(chan struct{})
+
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := m.Flush(context.Background()); err != nil {
+					m.logger.Error("Failed to save usage", zap.Error(err))
+				}
+			case <-m.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the flush loop and saves every window, including open ones,
+// so nothing recorded is lost on shutdown
+func (m *Meter) Close(ctx context.Context) error {
+	if m.stop != nil {
+		close(m.stop)
+		<-m.done
+		m.stop = nil
+	}
+	return m.flush(ctx, true)
+}
+
+// Rollup re-aggregates usage into coarser windows, e.g. hourly usage into
+// daily totals for an invoice
+func Rollup(usage []Usage, window time.Duration) []Usage {
+	totals := make(map[usageKey]*Usage)
+	for _, u := range usage {
+		start := u.WindowStart.UTC().Truncate(window)
+		key := usageKey{tenant: u.Tenant, metric: u.Metric, start: start}
+		t, ok := totals[key]
+		if !ok {
+			t = &Usage{Tenant: u.Tenant, Metric: u.Metric, WindowStart: start, WindowEnd: start.Add(window)}
+			totals[key] = t
+		}
+		t.Quantity += u.Quantity
+		t.Events += u.Events
+	}
+
+	rolled := make([]Usage, 0, len(totals))
+	for _, t := range totals {
+		rolled = append(rolled, *t)
+	}
+	sortUsage(rolled)
+	return rolled
+}
+
+// sortUsage orders usage by window, tenant and metric
+func sortUsage(usage []Usage) {
+	sort.Slice(usage, func(i, j int) bool {
+		a, b := usage[i], usage[j]
+		if !a.WindowStart.Equal(b.WindowStart) {
+			return a.WindowStart.Before(b.WindowStart)
+		}
+		if a.Tenant != b.Tenant {
+			return a.Tenant < b.Tenant
+		}
+		return a.Metric < b.Metric
+	})
+}
@@ -0,0 +1,172 @@
+package metering
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/database"
+	"github.com/mrhoseah/dolphin/internal/providers"
+	"github.com/mrhoseah/dolphin/internal/storage"
+	"github.com/mrhoseah/dolphin/internal/tenancy"
+)
+
+var base = time.Date(2026, 10, 17, 10, 15, 0, 0, time.UTC)
+
+// failingStore fails saves until ok is set
+type failingStore struct {
+	*MemoryStore
+	ok bool
+}
+
+func (s *failingStore) Save(ctx context.Context, usage []Usage) error {
+	if !s.ok {
+		return errors.New("database down")
+	}
+	return s.MemoryStore.Save(ctx, usage)
+}
+
+func newTestMeter(store Store) (*Meter, *time.Time) {
+	now := base
+	m := NewMeter(store, time.Hour, nil)
+	m.now = func() time.Time { return now }
+	return m, &now
+}
+
+func TestMeterAggregatesWindows(t *testing.T) {
+	store := NewMemoryStore()
+	m, now := newTestMeter(store)
+	ctx := tenancy.WithTenant(context.Background(), &tenancy.Tenant{ID: "acme"})
+
+	m.Record(ctx, MetricAPICalls, 1)
+	m.Record(ctx, MetricAPICalls, 1)
+	m.RecordTenant("globex", MetricJobs, 1)
+	*now = base.Add(time.Hour)
+	m.Record(ctx, MetricAPICalls, 1)
+
+	// Only the closed 10:00 window is saved
+	require.NoError(t, m.Flush(context.Background()))
+	saved, _ := store.Query(context.Background(), Filter{})
+	require.Len(t, saved, 2)
+	assert.Equal(t, Usage{
+		Tenant: "acme", Metric: MetricAPICalls,
+		WindowStart: base.Truncate(time.Hour), WindowEnd: base.Truncate(time.Hour).Add(time.Hour),
+		Quantity: 2, Events: 2,
+	}, saved[0])
+	assert.Equal(t, "globex", saved[1].Tenant)
+	assert.Len(t, m.Pending(), 1)
+
+	require.NoError(t, m.Close(context.Background()))
+	saved, _ = store.Query(context.Background(), Filter{Tenant: "acme"})
+	assert.Len(t, saved, 2)
+	assert.Empty(t, m.Pending())
+
+	daily := Rollup(saved, 24*time.Hour)
+	require.Len(t, daily, 1)
+	assert.Equal(t, int64(3), daily[0].Quantity)
+}
+
+func TestMeterKeepsUsageWhenSaveFails(t *testing.T) {
+	store := &failingStore{MemoryStore: NewMemoryStore()}
+	m, now := newTestMeter(store)
+
+	m.RecordTenant("acme", MetricStorageBytes, 100)
+	*now = base.Add(2 * time.Hour)
+	assert.Error(t, m.Flush(context.Background()))
+	m.RecordTenant("acme", MetricStorageBytes, 50)
+	assert.Len(t, m.Pending(), 2)
+
+	store.ok = true
+	require.NoError(t, m.Close(context.Background()))
+	saved, _ := store.Query(context.Background(), Filter{})
+	require.Len(t, saved, 2)
+	assert.Equal(t, int64(100), saved[0].Quantity)
+	assert.Equal(t, int64(50), saved[1].Quantity)
+}
+
+func TestDBStoreAccumulates(t *testing.T) {
+	db, err := database.New(&config.DatabaseConfig{Driver: "sqlite", Database: filepath.Join(t.TempDir(), "app.db")})
+	require.NoError(t, err)
+	defer db.Close()
+	store, err := NewDBStore(db.GetDB())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	window := Usage{Tenant: "acme", Metric: MetricAPICalls, WindowStart: base.Truncate(time.Hour), WindowEnd: base.Truncate(time.Hour).Add(time.Hour), Quantity: 5, Events: 5}
+	require.NoError(t, store.Save(ctx, []Usage{window}))
+	require.NoError(t, store.Save(ctx, []Usage{window, {Tenant: "globex", Metric: MetricJobs, WindowStart: base.Truncate(time.Hour), WindowEnd: window.WindowEnd, Quantity: 1, Events: 1}}))
+
+	usage, err := store.Query(ctx, Filter{Tenant: "acme"})
+	require.NoError(t, err)
+	require.Len(t, usage, 1)
+	assert.Equal(t, int64(10), usage[0].Quantity)
+	assert.True(t, usage[0].WindowStart.Equal(window.WindowStart))
+
+	usage, err = store.Query(ctx, Filter{From: base.Add(time.Hour)})
+	require.NoError(t, err)
+	assert.Empty(t, usage)
+}
+
+func TestExporters(t *testing.T) {
+	usage := []Usage{{Tenant: "acme", Metric: MetricAPICalls, WindowStart: base.Truncate(time.Hour), WindowEnd: base.Truncate(time.Hour).Add(time.Hour), Quantity: 7, Events: 7}}
+
+	var buf bytes.Buffer
+	require.NoError(t, NewCSVExporter(&buf).Export(context.Background(), usage))
+	assert.Equal(t, "tenant,metric,window_start,window_end,quantity,events\nacme,api_calls,2026-10-17T10:00:00Z,2026-10-17T11:00:00Z,7,7\n", buf.String())
+
+	var body []byte
+	var signature string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get(SignatureHeader)
+	}))
+	defer server.Close()
+
+	require.NoError(t, NewWebhookExporter(server.URL, "s3cret").Export(context.Background(), usage))
+	assert.Equal(t, "sha256="+Sign(body, "s3cret"), signature)
+	var payload struct{ Usage []Usage }
+	require.NoError(t, json.Unmarshal(body, &payload))
+	assert.Equal(t, int64(7), payload.Usage[0].Quantity)
+}
+
+func TestIntegrationPoints(t *testing.T) {
+	m, _ := newTestMeter(NewMemoryStore())
+
+	handler := Middleware(m, "/health")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for _, path := range []string{"/api/users", "/api/posts", "/health/ready"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req = req.WithContext(tenancy.WithTenant(req.Context(), &tenancy.Tenant{ID: "acme"}))
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	job := Jobs(m, func(job providers.Job) error {
+		if job.Type == "fail" {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	require.NoError(t, job(providers.Job{Type: "ok", Payload: map[string]interface{}{TenantPayloadKey: "acme"}}))
+	assert.Error(t, job(providers.Job{Type: "fail", Payload: map[string]interface{}{TenantPayloadKey: "acme"}}))
+
+	disk := storage.NewLocalDriver(t.TempDir(), "/storage")
+	require.NoError(t, NewStorage(disk, m, "acme").Put("a.txt", strings.NewReader("hello")))
+
+	quantities := map[string]int64{}
+	for _, u := range m.Pending() {
+		assert.Equal(t, "acme", u.Tenant)
+		quantities[u.Metric] = u.Quantity
+	}
+	assert.Equal(t, map[string]int64{MetricAPICalls: 2, MetricJobs: 1, MetricStorageBytes: 5}, quantities)
+}
@@ -0,0 +1,76 @@
+package metering
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/mrhoseah/dolphin/internal/providers"
+	"github.com/mrhoseah/dolphin/internal/storage"
+)
+
+// Middleware records an API call for every request except those under the
+// exempt path prefixes. Install it after tenant resolution so calls are
+// billed to the right tenant.
+func Middleware(m *Meter, exempt ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r)
+			for _, path := range exempt {
+				if r.URL.Path == strings.TrimSuffix(path, "/") || strings.HasPrefix(r.URL.Path, path) {
+					return
+				}
+			}
+			m.Record(r.Context(), MetricAPICalls, 1)
+		})
+	}
+}
+
+// TenantPayloadKey is the job payload field naming the tenant a job runs for
+const TenantPayloadKey = "tenant_id"
+
+// Jobs wraps a queue worker's handler to record every job that completes
+// successfully, billed to the tenant in its payload
+func Jobs(m *Meter, handler providers.JobHandler) providers.JobHandler {
+	return func(job providers.Job) error {
+		if err := handler(job); err != nil {
+			return err
+		}
+		tenant, _ := job.Payload[TenantPayloadKey].(string)
+		m.RecordTenant(tenant, MetricJobs, 1)
+		return nil
+	}
+}
+
+// Storage records the bytes a tenant writes through a storage driver
+type Storage struct {
+	storage.Driver
+	meter  *Meter
+	tenant string
+}
+
+// NewStorage wraps a storage driver, billing writes to tenant
+func NewStorage(inner storage.Driver, m *Meter, tenant string) *Storage {
+	return &Storage{Driver: inner, meter: m, tenant: tenant}
+}
+
+// Put stores content and records its size
+func (s *Storage) Put(path string, content io.Reader) error {
+	counter := &countingReader{r: content}
+	if err := s.Driver.Put(path, counter); err != nil {
+		return err
+	}
+	s.meter.RecordTenant(s.tenant, MetricStorageBytes, counter.n)
+	return nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,171 @@
+package metering
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Store persists aggregated usage
+type Store interface {
+	// Save adds usage to the stored totals of the same tenant, metric and
+	// window, so saving a window twice accumulates
+	Save(ctx context.Context, usage []Usage) error
+
+	// Query returns stored usage matching the filter, ordered by window
+	Query(ctx context.Context, filter Filter) ([]Usage, error)
+}
+
+// Filter selects stored usage. Zero fields match everything; windows
+// starting in [From, To) match.
+type Filter struct {
+	Tenant string
+	Metric string
+	From   time.Time
+	To     time.Time
+}
+
+func (f Filter) matches(u Usage) bool {
+	return (f.Tenant == "" || u.Tenant == f.Tenant) &&
+		(f.Metric == "" || u.Metric == f.Metric) &&
+		(f.From.IsZero() || !u.WindowStart.Before(f.From)) &&
+		(f.To.IsZero() || u.WindowStart.Before(f.To))
+}
+
+// MemoryStore keeps usage in memory, for tests and single-process setups
+// that export before exiting
+type MemoryStore struct {
+	mu    sync.Mutex
+	usage map[usageKey]*Usage
+}
+
+// NewMemoryStore creates an in-memory usage store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{usage: make(map[usageKey]*Usage)}
+}
+
+func (s *MemoryStore) Save(ctx context.Context, usage []Usage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range usage {
+		key := usageKey{tenant: u.Tenant, metric: u.Metric, start: u.WindowStart.UTC()}
+		if existing, ok := s.usage[key]; ok {
+			existing.Quantity += u.Quantity
+			existing.Events += u.Events
+		} else {
+			saved := u
+			s.usage[key] = &saved
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Query(ctx context.Context, filter Filter) ([]Usage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var usage []Usage
+	for _, u := range s.usage {
+		if filter.matches(*u) {
+			usage = append(usage, *u)
+		}
+	}
+	sortUsage(usage)
+	return usage, nil
+}
+
+// UsageRecord is the row DBStore keeps per tenant, metric and window
+type UsageRecord struct {
+	ID          uint      `gorm:"primarykey"`
+	Tenant      string    `gorm:"size:100;uniqueIndex:idx_metering_usage_window;not null"`
+	Metric      string    `gorm:"size:100;uniqueIndex:idx_metering_usage_window;not null"`
+	WindowStart time.Time `gorm:"uniqueIndex:idx_metering_usage_window;index;not null"`
+	WindowEnd   time.Time `gorm:"not null"`
+	Quantity    int64     `gorm:"not null"`
+	Events      int64     `gorm:"not null"`
+	UpdatedAt   time.Time
+}
+
+// TableName returns the table name for the UsageRecord model
+func (UsageRecord) TableName() string {
+	return "metering_usage"
+}
+
+// DBStore keeps usage in the application database
+type DBStore struct {
+	db *gorm.DB
+}
+
+// NewDBStore creates a database usage store, creating its table if needed
+func NewDBStore(db *gorm.DB) (*DBStore, error) {
+	if err := db.AutoMigrate(&UsageRecord{}); err != nil {
+		return nil, err
+	}
+	return &DBStore{db: db}, nil
+}
+
+func (s *DBStore) Save(ctx context.Context, usage []Usage) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, u := range usage {
+			result := tx.Model(&UsageRecord{}).
+				Where("tenant = ? AND metric = ? AND window_start = ?", u.Tenant, u.Metric, u.WindowStart.UTC()).
+				Updates(map[string]interface{}{
+					"quantity":   gorm.Expr("quantity + ?", u.Quantity),
+					"events":     gorm.Expr("events + ?", u.Events),
+					"updated_at": time.Now(),
+				})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected > 0 {
+				continue
+			}
+			record := UsageRecord{
+				Tenant:      u.Tenant,
+				Metric:      u.Metric,
+				WindowStart: u.WindowStart.UTC(),
+				WindowEnd:   u.WindowEnd.UTC(),
+				Quantity:    u.Quantity,
+				Events:      u.Events,
+			}
+			if err := tx.Create(&record).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *DBStore) Query(ctx context.Context, filter Filter) ([]Usage, error) {
+	q := s.db.WithContext(ctx).Model(&UsageRecord{})
+	if filter.Tenant != "" {
+		q = q.Where("tenant = ?", filter.Tenant)
+	}
+	if filter.Metric != "" {
+		q = q.Where("metric = ?", filter.Metric)
+	}
+	if !filter.From.IsZero() {
+		q = q.Where("window_start >= ?", filter.From.UTC())
+	}
+	if !filter.To.IsZero() {
+		q = q.Where("window_start < ?", filter.To.UTC())
+	}
+
+	var records []UsageRecord
+	if err := q.Order("window_start, tenant, metric").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	usage := make([]Usage, len(records))
+	for i, r := range records {
+		usage[i] = Usage{
+			Tenant:      r.Tenant,
+			Metric:      r.Metric,
+			WindowStart: r.WindowStart.UTC(),
+			WindowEnd:   r.WindowEnd.UTC(),
+			Quantity:    r.Quantity,
+			Events:      r.Events,
+		}
+	}
+	return usage, nil
+}
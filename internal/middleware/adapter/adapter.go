@@ -0,0 +1,201 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/mrhoseah/dolphin/internal/problem"
+)
+
+// Transport identifies where a call originated
+type Transport string
+
+const (
+	TransportHTTP Transport = "http"
+	TransportGRPC Transport = "grpc"
+)
+
+// Metadata holds transport headers (HTTP headers or gRPC metadata)
+type Metadata map[string][]string
+
+// Get returns the first value for key, matched case-insensitively
+func (m Metadata) Get(key string) string {
+	if v, ok := m[key]; ok && len(v) > 0 {
+		return v[0]
+	}
+	for k, v := range m {
+		if strings.EqualFold(k, key) && len(v) > 0 {
+			return v[0]
+		}
+	}
+	return ""
+}
+
+// Call describes a single inbound invocation independent of transport
+type Call struct {
+	Transport  Transport
+	Method     string // HTTP method or gRPC full method name
+	Path       string // URL path or gRPC full method name
+	Route      string // Route pattern: chi's, "" when no route matches; otherwise Path
+	RemoteAddr string
+	Metadata   Metadata
+	Stream     bool // true for gRPC streaming calls
+
+	// Request is the original HTTP request; nil for gRPC calls
+	Request *http.Request
+}
+
+// Handler continues the middleware chain with a possibly enriched context
+type Handler func(ctx context.Context) error
+
+// Middleware is a cross-cutting concern written once for every transport
+type Middleware interface {
+	Handle(ctx context.Context, call *Call, next Handler) error
+}
+
+// MiddlewareFunc adapts a function to the Middleware interface
+type MiddlewareFunc func(ctx context.Context, call *Call, next Handler) error
+
+// Handle calls f(ctx, call, next)
+func (f MiddlewareFunc) Handle(ctx context.Context, call *Call, next Handler) error {
+	return f(ctx, call, next)
+}
+
+// Chain composes middleware so the first one runs outermost
+func Chain(mws ...Middleware) Middleware {
+	return MiddlewareFunc(func(ctx context.Context, call *Call, next Handler) error {
+		h := next
+		for i := len(mws) - 1; i >= 0; i-- {
+			mw, inner := mws[i], h
+			h = func(ctx context.Context) error {
+				return mw.Handle(ctx, call, inner)
+			}
+		}
+		return h(ctx)
+	})
+}
+
+// Error is a transport-neutral error carrying an HTTP status code.
+// gRPC adapters translate the status into the matching gRPC code.
+type Error struct {
+	Status  int
+	Message string
+	Err     error
+}
+
+// Error implements error
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+// Unwrap returns the wrapped error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Problem reports the error to HTTP clients with its status and message
+func (e *Error) Problem() *problem.Problem {
+	return problem.New(e.Status, e.Message)
+}
+
+// NewError creates a transport-neutral error
+func NewError(status int, message string) *Error {
+	return &Error{Status: status, Message: message}
+}
+
+// Common errors returned by built-in middleware
+var (
+	ErrUnauthenticated   = NewError(http.StatusUnauthorized, "Unauthenticated")
+	ErrForbidden         = NewError(http.StatusForbidden, "Forbidden")
+	ErrRateLimitExceeded = NewError(http.StatusTooManyRequests, "Rate limit exceeded")
+	ErrInternal          = NewError(http.StatusInternalServerError, "Internal server error")
+)
+
+// statusOf extracts the HTTP status for err, defaulting to 500
+func statusOf(err error) (int, string) {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Status, e.Message
+	}
+	return http.StatusInternalServerError, "Internal server error"
+}
+
+// HTTP adapts a middleware to the net/http middleware signature
+func HTTP(mw Middleware) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			call := newHTTPCall(r)
+			serveHTTP(mw, call, w, r, next)
+		})
+	}
+}
+
+// WrapHandler wraps a single http.Handler with a middleware
+func WrapHandler(mw Middleware, h http.Handler) http.Handler {
+	return HTTP(mw)(h)
+}
+
+// serveHTTP runs mw around next and reports the error with problem.Write
+// if the chain fails before the downstream handler produced a response
+func serveHTTP(mw Middleware, call *Call, w http.ResponseWriter, r *http.Request, next http.Handler) {
+	tw := &trackingWriter{ResponseWriter: w}
+	err := mw.Handle(r.Context(), call, func(ctx context.Context) error {
+		call.Request = r.WithContext(ctx)
+		next.ServeHTTP(tw, call.Request)
+		return nil
+	})
+	if err == nil || tw.wroteHeader {
+		return
+	}
+
+	problem.Write(w, r, err)
+}
+
+// newHTTPCall builds a Call from an HTTP request
+func newHTTPCall(r *http.Request) *Call {
+	return &Call{
+		Transport:  TransportHTTP,
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		Route:      r.URL.Path,
+		RemoteAddr: r.RemoteAddr,
+		Metadata:   Metadata(r.Header),
+		Request:    r,
+	}
+}
+
+// trackingWriter records whether a response has been started
+type trackingWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+// WriteHeader records that the header was written
+func (t *trackingWriter) WriteHeader(code int) {
+	t.wroteHeader = true
+	t.ResponseWriter.WriteHeader(code)
+}
+
+// Write records that the response was started
+func (t *trackingWriter) Write(b []byte) (int, error) {
+	t.wroteHeader = true
+	return t.ResponseWriter.Write(b)
+}
+
+// Flush forwards to the underlying writer when supported
+func (t *trackingWriter) Flush() {
+	if f, ok := t.ResponseWriter.(http.Flusher); ok {
+		t.wroteHeader = true
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (t *trackingWriter) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
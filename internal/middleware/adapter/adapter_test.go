@@ -0,0 +1,187 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type userKey struct{}
+
+// tokenAuth accepts the bearer token "secret", putting its user in the
+// context
+var tokenAuth = Auth(func(ctx context.Context, call *Call) (context.Context, error) {
+	if BearerToken(call) != "secret" {
+		return nil, errors.New("bad token")
+	}
+	return context.WithValue(ctx, userKey{}, "ada"), nil
+})
+
+// fakeLimiter allows limit calls per key and records the keys asked for
+type fakeLimiter struct {
+	mu     sync.Mutex
+	counts map[string]int
+	keys   []string
+}
+
+func (l *fakeLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.counts == nil {
+		l.counts = make(map[string]int)
+	}
+	l.keys = append(l.keys, key)
+	l.counts[key]++
+	return l.counts[key] <= limit, nil
+}
+
+func (l *fakeLimiter) Remaining(ctx context.Context, key string, limit int, window time.Duration) (int, error) {
+	return 0, nil
+}
+
+func (l *fakeLimiter) Reset(ctx context.Context, key string) error { return nil }
+
+func serve(handler http.Handler, method, path string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestHTTP(t *testing.T) {
+	var order []string
+	trace := func(name string) Middleware {
+		return MiddlewareFunc(func(ctx context.Context, call *Call, next Handler) error {
+			order = append(order, name)
+			return next(ctx)
+		})
+	}
+	handler := HTTP(Chain(trace("outer"), trace("inner"), tokenAuth))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Context().Value(userKey{}).(string)))
+	}))
+
+	w := serve(handler, http.MethodGet, "/me", http.Header{"Authorization": {"Bearer secret"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ada", w.Body.String(), "the handler gets the context the middleware enriched")
+	assert.Equal(t, []string{"outer", "inner"}, order)
+
+	w = serve(handler, http.MethodGet, "/me", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "Unauthenticated")
+
+	// An error after the handler answered leaves its response alone
+	late := HTTP(MiddlewareFunc(func(ctx context.Context, call *Call, next Handler) error {
+		next(ctx)
+		return ErrForbidden
+	}))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	assert.Equal(t, http.StatusAccepted, serve(late, http.MethodPost, "/", nil).Code)
+}
+
+func TestRecovery(t *testing.T) {
+	handler := HTTP(Recovery(zap.NewNop()))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/abort" {
+			panic(http.ErrAbortHandler)
+		}
+		panic("boom")
+	}))
+
+	w := serve(handler, http.MethodGet, "/", nil)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.NotContains(t, w.Body.String(), "boom", "the panic isn't shown outside debug mode")
+
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() { serve(handler, http.MethodGet, "/abort", nil) })
+}
+
+func TestChi(t *testing.T) {
+	limiter := &fakeLimiter{}
+	var routes []string
+	r := chi.NewRouter()
+	r.Use(Chi(MiddlewareFunc(func(ctx context.Context, call *Call, next Handler) error {
+		routes = append(routes, call.Route)
+		return next(ctx)
+	})))
+	r.Use(Chi(RateLimit(limiter, 2, time.Minute, nil)))
+	r.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {})
+
+	assert.Equal(t, http.StatusOK, serve(r, http.MethodGet, "/users/1", nil).Code)
+	assert.Equal(t, http.StatusOK, serve(r, http.MethodGet, "/users/2", http.Header{"X-Forwarded-For": {"203.0.113.9"}}).Code)
+	w := serve(r, http.MethodGet, "/users/3", http.Header{"X-Real-Ip": {"203.0.113.10"}})
+	assert.Equal(t, http.StatusTooManyRequests, w.Code, "one bucket per route and client, whatever headers it sends")
+	serve(r, http.MethodGet, "/missing", nil)
+
+	assert.Equal(t, []string{"/users/{id}", "/users/{id}", "/users/{id}", ""}, routes)
+	assert.Equal(t, "http:/users/{id}:192.0.2.1", limiter.keys[0])
+	assert.Equal(t, limiter.keys[0], limiter.keys[2])
+}
+
+// fakeStream is a server stream carrying ctx
+type fakeStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *fakeStream) Context() context.Context { return s.ctx }
+
+func TestGRPC(t *testing.T) {
+	interceptor := UnaryInterceptor(Chain(Recovery(zap.NewNop()), tokenAuth))
+	info := &grpc.UnaryServerInfo{FullMethod: "/users.Users/Get"}
+	authed := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer secret"))
+	handlerErr := status.Error(codes.NotFound, "no such user")
+
+	resp, err := interceptor(authed, "req", info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return ctx.Value(userKey{}), nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "ada", resp)
+
+	_, err = interceptor(context.Background(), "req", info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		t.Fatal("handler called without credentials")
+		return nil, nil
+	})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = interceptor(authed, "req", info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		panic("boom")
+	})
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.False(t, strings.Contains(err.Error(), "boom"))
+
+	_, err = interceptor(authed, "req", info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, handlerErr
+	})
+	assert.Equal(t, handlerErr, err, "handler errors pass through")
+
+	limiter := &fakeLimiter{}
+	stream := StreamInterceptor(Chain(RateLimit(limiter, 1, time.Minute, nil), tokenAuth))
+	streamInfo := &grpc.StreamServerInfo{FullMethod: "/users.Users/Watch", IsServerStream: true}
+	var user interface{}
+	handler := func(srv interface{}, ss grpc.ServerStream) error {
+		user = ss.Context().Value(userKey{})
+		return nil
+	}
+	require.NoError(t, stream(nil, &fakeStream{ctx: authed}, streamInfo, handler))
+	assert.Equal(t, "ada", user)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(stream(nil, &fakeStream{ctx: authed}, streamInfo, handler)))
+	assert.Equal(t, "grpc:/users.Users/Watch:", limiter.keys[0])
+}
@@ -0,0 +1,31 @@
+package adapter
+
+import (
+	"net/http"
+
+	"github.com/mrhoseah/dolphin/internal/routing"
+)
+
+// Chi adapts a middleware for use with chi routers. Unlike HTTP it fills
+// Call.Route with the pattern of the chi route the request will be served
+// by, matched up front since middleware added with Use runs before chi
+// routes the request, and "" when none matches, so that rate limits and
+// spans aren't keyed per URL.
+func Chi(mw Middleware) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			call := newHTTPCall(r)
+			call.Route = routing.Match(r)
+			serveHTTP(mw, call, w, r, next)
+		})
+	}
+}
+
+// ChiGroup adapts several middleware in order for chi's Use
+func ChiGroup(mws ...Middleware) []func(http.Handler) http.Handler {
+	result := make([]func(http.Handler) http.Handler, 0, len(mws))
+	for _, mw := range mws {
+		result = append(result, Chi(mw))
+	}
+	return result
+}
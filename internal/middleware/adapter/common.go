@@ -0,0 +1,157 @@
+package adapter
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime"
+	"strings"
+	"time"
+
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/mrhoseah/dolphin/internal/problem"
+	"github.com/mrhoseah/dolphin/internal/ratelimit"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// Recovery turns panics into 500s on every transport, logged with their
+// stack: HTTP clients get the error page, with the stack in debug mode,
+// and gRPC clients codes.Internal. http.ErrAbortHandler is panicked
+// again, for net/http to abort the response.
+func Recovery(logger *zap.Logger) Middleware {
+	return MiddlewareFunc(func(ctx context.Context, call *Call, next Handler) (err error) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				if rec == http.ErrAbortHandler {
+					panic(rec)
+				}
+				stack := make([]byte, 4096)
+				length := runtime.Stack(stack, false)
+
+				logger.Error("Panic recovered",
+					zap.Any("error", rec),
+					zap.String("stack", string(stack[:length])),
+					zap.String("transport", string(call.Transport)),
+					zap.String("method", call.Method),
+					zap.String("path", call.Path),
+					zap.String("request_id", chimiddleware.GetReqID(ctx)),
+				)
+				err = problem.Panic(rec, stack[:length])
+			}
+		}()
+		return next(ctx)
+	})
+}
+
+// Logging logs each call with its duration and outcome
+func Logging(logger *zap.Logger) Middleware {
+	return MiddlewareFunc(func(ctx context.Context, call *Call, next Handler) error {
+		start := time.Now()
+		err := next(ctx)
+
+		fields := []zap.Field{
+			zap.String("transport", string(call.Transport)),
+			zap.String("method", call.Method),
+			zap.String("path", call.Path),
+			zap.String("remote_addr", call.RemoteAddr),
+			zap.Duration("duration", time.Since(start)),
+		}
+		if err != nil {
+			logger.Warn("Call failed", append(fields, zap.Error(err))...)
+			return err
+		}
+		logger.Info("Call handled", fields...)
+		return nil
+	})
+}
+
+// Authenticator validates credentials found on a call and returns an
+// enriched context (e.g. carrying the user) or an error
+type Authenticator func(ctx context.Context, call *Call) (context.Context, error)
+
+// Auth rejects calls the authenticator does not accept
+func Auth(authenticate Authenticator) Middleware {
+	return MiddlewareFunc(func(ctx context.Context, call *Call, next Handler) error {
+		authCtx, err := authenticate(ctx, call)
+		if err != nil {
+			if _, ok := err.(*Error); ok {
+				return err
+			}
+			return &Error{Status: ErrUnauthenticated.Status, Message: ErrUnauthenticated.Message, Err: err}
+		}
+		return next(authCtx)
+	})
+}
+
+// BearerToken extracts a bearer token from the Authorization header or metadata
+func BearerToken(call *Call) string {
+	header := call.Metadata.Get("authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "bearer ") {
+		return header[7:]
+	}
+	return ""
+}
+
+// KeyFunc derives a rate limit key from a call
+type KeyFunc func(call *Call) string
+
+// ClientIPKey keys rate limits by the client's address: for HTTP the one
+// ratelimit.RealIP resolved through the trusted proxies, for gRPC the
+// peer's. X-Forwarded-For and X-Real-IP aren't read here, as any client
+// could send them.
+func ClientIPKey(call *Call) string {
+	host, _, err := net.SplitHostPort(call.RemoteAddr)
+	if err != nil {
+		return call.RemoteAddr
+	}
+	return host
+}
+
+// RateLimit enforces limit calls per window using the shared limiter
+func RateLimit(limiter ratelimit.RateLimiter, limit int, window time.Duration, key KeyFunc) Middleware {
+	if key == nil {
+		key = ClientIPKey
+	}
+	return MiddlewareFunc(func(ctx context.Context, call *Call, next Handler) error {
+		k := fmt.Sprintf("%s:%s:%s", call.Transport, call.Route, key(call))
+		allowed, err := limiter.Allow(ctx, k, limit, window)
+		if err != nil {
+			return &Error{Status: ErrInternal.Status, Message: "Rate limit check failed", Err: err}
+		}
+		if !allowed {
+			return ErrRateLimitExceeded
+		}
+		return next(ctx)
+	})
+}
+
+// Tracing starts a server span around each call
+func Tracing(tracer trace.Tracer) Middleware {
+	return MiddlewareFunc(func(ctx context.Context, call *Call, next Handler) error {
+		name := call.Route
+		if call.Transport == TransportHTTP {
+			name = strings.TrimSpace(call.Method + " " + call.Route)
+		}
+
+		ctx, span := tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
+
+		span.SetAttributes(
+			attribute.String("dolphin.transport", string(call.Transport)),
+			attribute.String("dolphin.method", call.Method),
+			attribute.String("dolphin.path", call.Path),
+			attribute.Bool("dolphin.stream", call.Stream),
+		)
+
+		err := next(ctx)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return err
+	})
+}
@@ -0,0 +1,117 @@
+package adapter
+
+import (
+	"context"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryInterceptor adapts a middleware to a gRPC unary server interceptor
+func UnaryInterceptor(mw Middleware) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		call := newGRPCCall(ctx, info.FullMethod, false)
+
+		var resp interface{}
+		var handlerErr error
+		err := mw.Handle(ctx, call, func(ctx context.Context) error {
+			resp, handlerErr = handler(ctx, req)
+			return handlerErr
+		})
+		if err != nil {
+			if err == handlerErr {
+				return resp, err
+			}
+			return nil, toGRPCError(err)
+		}
+		return resp, nil
+	}
+}
+
+// StreamInterceptor adapts a middleware to a gRPC stream server interceptor
+func StreamInterceptor(mw Middleware) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		call := newGRPCCall(ss.Context(), info.FullMethod, true)
+
+		var handlerErr error
+		err := mw.Handle(ss.Context(), call, func(ctx context.Context) error {
+			handlerErr = handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+			return handlerErr
+		})
+		if err != nil && err != handlerErr {
+			return toGRPCError(err)
+		}
+		return err
+	}
+}
+
+// newGRPCCall builds a Call from incoming gRPC context
+func newGRPCCall(ctx context.Context, fullMethod string, stream bool) *Call {
+	call := &Call{
+		Transport: TransportGRPC,
+		Method:    fullMethod,
+		Path:      fullMethod,
+		Route:     fullMethod,
+		Metadata:  Metadata{},
+		Stream:    stream,
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for k, v := range md {
+			call.Metadata[k] = v
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		call.RemoteAddr = p.Addr.String()
+	}
+	return call
+}
+
+// contextStream overrides the stream context with the middleware context
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the enriched context
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+// toGRPCError converts a middleware error into a gRPC status error
+func toGRPCError(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	httpStatus, message := statusOf(err)
+	return status.Error(grpcCode(httpStatus), message)
+}
+
+// grpcCode maps HTTP status codes onto gRPC codes
+func grpcCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout, http.StatusRequestTimeout:
+		return codes.DeadlineExceeded
+	default:
+		return codes.Internal
+	}
+}
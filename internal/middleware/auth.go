@@ -22,10 +22,12 @@ func NewAuthMiddleware(authManager *auth.AuthManager, logger *zap.Logger) *AuthM
 	}
 }
 
-// Authenticate middleware that requires authentication
+// Authenticate middleware that requires authentication. The user is kept
+// in the request context, where auth.UserFromContext finds it.
 func (m *AuthMiddleware) Authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !m.authManager.Check() {
+		user := m.authManager.User()
+		if user == nil {
 			m.logger.Warn("Unauthenticated request")
 			render.Status(r, http.StatusUnauthorized)
 			render.JSON(w, r, map[string]string{
@@ -34,10 +36,19 @@ func (m *AuthMiddleware) Authenticate(next http.Handler) http.Handler {
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(auth.WithUser(r.Context(), user)))
 	})
 }
 
+// user returns the user Authenticate recorded for the request, or the one
+// the auth manager authenticates
+func (m *AuthMiddleware) user(r *http.Request) auth.Authenticatable {
+	if user, ok := auth.UserFromContext(r.Context()); ok {
+		return user
+	}
+	return m.authManager.User()
+}
+
 // RedirectIfAuthenticated middleware that redirects authenticated users
 func (m *AuthMiddleware) RedirectIfAuthenticated(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -54,7 +65,7 @@ func (m *AuthMiddleware) RedirectIfAuthenticated(next http.Handler) http.Handler
 // EnsureEmailIsVerified middleware that ensures user's email is verified
 func (m *AuthMiddleware) EnsureEmailIsVerified(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		user := m.authManager.User()
+		user := m.user(r)
 		if user == nil {
 			render.Status(r, http.StatusUnauthorized)
 			render.JSON(w, r, map[string]string{
@@ -62,6 +73,7 @@ func (m *AuthMiddleware) EnsureEmailIsVerified(next http.Handler) http.Handler {
 			})
 			return
 		}
+		r = r.WithContext(auth.WithUser(r.Context(), user))
 
 		// Check if user has verified email (you'll need to add this field to your User model)
 		// For now, we'll assume all users are verified
@@ -98,7 +110,7 @@ func (m *AuthMiddleware) ThrottleLoginAttempts(maxAttempts int, decayMinutes int
 func (m *AuthMiddleware) RoleMiddleware(roles ...string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			user := m.authManager.User()
+			user := m.user(r)
 			if user == nil {
 				render.Status(r, http.StatusUnauthorized)
 				render.JSON(w, r, map[string]string{
@@ -127,7 +139,7 @@ func (m *AuthMiddleware) RoleMiddleware(roles ...string) func(http.Handler) http
 				return
 			}
 
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(w, r.WithContext(auth.WithUser(r.Context(), user)))
 		})
 	}
 }
@@ -136,7 +148,7 @@ func (m *AuthMiddleware) RoleMiddleware(roles ...string) func(http.Handler) http
 func (m *AuthMiddleware) PermissionMiddleware(permissions ...string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			user := m.authManager.User()
+			user := m.user(r)
 			if user == nil {
 				render.Status(r, http.StatusUnauthorized)
 				render.JSON(w, r, map[string]string{
@@ -165,7 +177,7 @@ func (m *AuthMiddleware) PermissionMiddleware(permissions ...string) func(http.H
 				return
 			}
 
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(w, r.WithContext(auth.WithUser(r.Context(), user)))
 		})
 	}
 }
@@ -221,6 +233,9 @@ func (m *AuthMiddleware) OptionalAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// This middleware doesn't block requests, just adds user info to context
 		// if available
+		if user := m.authManager.User(); user != nil {
+			r = r.WithContext(auth.WithUser(r.Context(), user))
+		}
 		next.ServeHTTP(w, r)
 	})
 }
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mrhoseah/dolphin/internal/cache"
+)
+
+// cachedResponse is the stored form of a cached response
+type cachedResponse struct {
+	Status int                 `json:"status"`
+	Header map[string][]string `json:"header"`
+	Body   []byte              `json:"body"`
+}
+
+// ResponseCacheMiddleware caches successful GET responses for ttl.
+// Requests with an Authorization header or cookies are never cached, nor are
+// responses that set cookies or opt out with Cache-Control: no-store/private.
+// Cache failures fall through to the handler.
+func ResponseCacheMiddleware(store cache.Cache, ttl time.Duration) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !cacheableRequest(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := "response:" + r.URL.RequestURI()
+			if raw, err := store.Get(r.Context(), key); err == nil {
+				var cached cachedResponse
+				if json.Unmarshal([]byte(raw), &cached) == nil {
+					for name, values := range cached.Header {
+						w.Header()[name] = values
+					}
+					w.Header().Set("X-Cache", "HIT")
+					w.WriteHeader(cached.Status)
+					w.Write(cached.Body)
+					return
+				}
+			}
+
+			recorder := &cacheRecorder{ResponseWriter: w, status: http.StatusOK}
+			w.Header().Set("X-Cache", "MISS")
+			next.ServeHTTP(recorder, r)
+
+			if recorder.status != http.StatusOK || !cacheableResponse(w.Header()) {
+				return
+			}
+			header := w.Header().Clone()
+			header.Del("X-Cache")
+			_ = store.Set(r.Context(), key, cachedResponse{
+				Status: recorder.status,
+				Header: header,
+				Body:   recorder.body.Bytes(),
+			}, ttl)
+		})
+	}
+}
+
+// cacheableRequest reports whether a request may be served from cache
+func cacheableRequest(r *http.Request) bool {
+	if r.Method != http.MethodGet {
+		return false
+	}
+	if r.Header.Get("Authorization") != "" || r.Header.Get("Cookie") != "" {
+		return false
+	}
+	return !strings.Contains(r.Header.Get("Cache-Control"), "no-cache")
+}
+
+// cacheableResponse reports whether response headers allow shared caching
+func cacheableResponse(header http.Header) bool {
+	if header.Get("Set-Cookie") != "" {
+		return false
+	}
+	control := header.Get("Cache-Control")
+	return !strings.Contains(control, "no-store") && !strings.Contains(control, "private")
+}
+
+// cacheRecorder captures the status and body while writing through
+type cacheRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *cacheRecorder) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *cacheRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
@@ -0,0 +1,266 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// DefaultCompressionExclusions are content types that are never compressed:
+// streams that must reach the client as written, and formats that are
+// already compressed. A trailing "/*" matches a whole family.
+var DefaultCompressionExclusions = []string{
+	"text/event-stream",
+	"image/*",
+	"video/*",
+	"audio/*",
+	"font/woff",
+	"font/woff2",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/x-7z-compressed",
+	"application/x-rar-compressed",
+	"application/zstd",
+	"application/pdf",
+	"application/octet-stream",
+	"application/grpc",
+}
+
+// CompressionOptions configures CompressionMiddleware
+type CompressionOptions struct {
+	// Level is the gzip/deflate level, 1 (fastest) to 9 (smallest)
+	Level int
+
+	// ExcludedContentTypes are added to DefaultCompressionExclusions
+	ExcludedContentTypes []string
+
+	// ExcludedPaths are URL path prefixes that are never compressed
+	ExcludedPaths []string
+}
+
+// CompressionMiddleware gzip or deflate encodes responses the client
+// accepts. WebSocket upgrades, SSE requests, excluded paths and excluded
+// content types pass through untouched, and Flush/Hijack keep working so
+// streaming handlers are not buffered.
+func CompressionMiddleware(opts CompressionOptions) func(next http.Handler) http.Handler {
+	level := opts.Level
+	if level < flate.BestSpeed || level > flate.BestCompression {
+		level = flate.DefaultCompression
+	}
+	excluded := append(append([]string{}, DefaultCompressionExclusions...), opts.ExcludedContentTypes...)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encoding := acceptedEncoding(r)
+			if encoding == "" || isUpgrade(r) || acceptsEventStream(r) || hasPathPrefix(r.URL.Path, opts.ExcludedPaths) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{
+				ResponseWriter: w,
+				request:        r,
+				encoding:       encoding,
+				level:          level,
+				excluded:       excluded,
+			}
+			defer cw.Close()
+
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// acceptedEncoding picks gzip or deflate from Accept-Encoding
+func acceptedEncoding(r *http.Request) string {
+	var deflate bool
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.ReplaceAll(strings.TrimSpace(params), " ", "") == "q=0" {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "gzip":
+			return "gzip"
+		case "deflate":
+			deflate = true
+		}
+	}
+	if deflate {
+		return "deflate"
+	}
+	return ""
+}
+
+// isUpgrade reports whether the request asks to switch protocols, e.g. to
+// a WebSocket
+func isUpgrade(r *http.Request) bool {
+	return r.Header.Get("Upgrade") != "" &&
+		strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade")
+}
+
+// acceptsEventStream reports whether the client is opening an SSE stream
+func acceptsEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+func hasPathPrefix(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// excludedContentType reports whether contentType matches the exclusion list
+func excludedContentType(contentType string, excluded []string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.TrimSpace(strings.Split(contentType, ";")[0])
+	}
+	mediaType = strings.ToLower(mediaType)
+
+	for _, pattern := range excluded {
+		pattern = strings.ToLower(pattern)
+		if family, ok := strings.CutSuffix(pattern, "/*"); ok {
+			// SVG is text and compresses well despite being an image
+			if strings.HasPrefix(mediaType, family+"/") && mediaType != "image/svg+xml" {
+				return true
+			}
+			continue
+		}
+		if mediaType == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// compressWriter decides on the first write whether to encode the body,
+// since only then are the handler's headers known
+type compressWriter struct {
+	http.ResponseWriter
+	request  *http.Request
+	encoding string
+	level    int
+	excluded []string
+
+	decided     bool
+	wroteHeader bool
+	encoder     io.WriteCloser
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.decide(code, nil)
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if !w.decided {
+		w.decide(http.StatusOK, data)
+	}
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.ResponseWriter.WriteHeader(http.StatusOK)
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// decide starts an encoder unless the response must pass through as is
+func (w *compressWriter) decide(code int, firstChunk []byte) {
+	if w.decided {
+		return
+	}
+	w.decided = true
+
+	header := w.Header()
+	if w.request.Method == http.MethodHead || code < http.StatusOK ||
+		code == http.StatusNoContent || code == http.StatusNotModified {
+		return
+	}
+	if header.Get("Content-Encoding") != "" {
+		return
+	}
+
+	contentType := header.Get("Content-Type")
+	if contentType == "" && firstChunk != nil {
+		contentType = http.DetectContentType(firstChunk)
+		header.Set("Content-Type", contentType)
+	}
+	if contentType == "" || excludedContentType(contentType, w.excluded) {
+		return
+	}
+
+	switch w.encoding {
+	case "gzip":
+		w.encoder, _ = gzip.NewWriterLevel(w.ResponseWriter, w.level)
+	case "deflate":
+		w.encoder, _ = flate.NewWriter(w.ResponseWriter, w.level)
+	}
+	if w.encoder == nil {
+		return
+	}
+
+	header.Set("Content-Encoding", w.encoding)
+	header.Add("Vary", "Accept-Encoding")
+	header.Del("Content-Length")
+	header.Del("Accept-Ranges")
+}
+
+// Flush pushes buffered compressed bytes to the client so streamed
+// responses arrive as they are written
+func (w *compressWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.encoder != nil {
+		if f, ok := w.encoder.(interface{ Flush() error }); ok {
+			f.Flush()
+		}
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack hands the raw connection to the handler; nothing has been encoded
+// at that point since hijacking happens before any write
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if w.encoder != nil {
+		return nil, nil, fmt.Errorf("compression: cannot hijack after the response started")
+	}
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("compression: underlying ResponseWriter does not support hijacking")
+	}
+	w.decided = true
+	return h.Hijack()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Close finishes the encoded stream
+func (w *compressWriter) Close() error {
+	if w.encoder != nil {
+		return w.encoder.Close()
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serveCompressed(opts CompressionOptions, req *http.Request, handler http.HandlerFunc) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	CompressionMiddleware(opts)(handler).ServeHTTP(rec, req)
+	return rec
+}
+
+func gzipRequest(path string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	return req
+}
+
+func TestCompressionEncodesText(t *testing.T) {
+	body := strings.Repeat("hello dolphin ", 100)
+	rec := serveCompressed(CompressionOptions{}, gzipRequest("/"), func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Length", "1400")
+		io.WriteString(w, body)
+	})
+
+	assert.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+	assert.Empty(t, rec.Header().Get("Content-Length"))
+	zr, err := gzip.NewReader(rec.Body)
+	require.NoError(t, err)
+	decoded, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, body, string(decoded))
+}
+
+func TestCompressionSkipsEventStream(t *testing.T) {
+	req := gzipRequest("/events")
+	req.Header.Set("Accept", "text/event-stream")
+	rec := serveCompressed(CompressionOptions{}, req, func(w http.ResponseWriter, r *http.Request) {
+		_, ok := w.(http.Flusher)
+		assert.True(t, ok)
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: hi\n\n")
+	})
+
+	assert.Empty(t, rec.Header().Get("Content-Encoding"))
+	assert.Equal(t, "data: hi\n\n", rec.Body.String())
+}
+
+func TestCompressionSkipsWebSocketUpgrade(t *testing.T) {
+	req := gzipRequest("/ws")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	serveCompressed(CompressionOptions{}, req, func(w http.ResponseWriter, r *http.Request) {
+		_, wrapped := w.(*compressWriter)
+		assert.False(t, wrapped)
+	})
+}
+
+func TestCompressionExclusions(t *testing.T) {
+	opts := CompressionOptions{
+		ExcludedContentTypes: []string{"application/x-ndjson"},
+		ExcludedPaths:        []string{"/downloads"},
+	}
+	cases := []struct {
+		path, contentType string
+		compressed        bool
+	}{
+		{"/", "image/png", false},
+		{"/", "image/svg+xml", true},
+		{"/", "application/x-ndjson", false},
+		{"/downloads/report", "text/csv", false},
+		{"/", "application/json", true},
+	}
+	for _, tc := range cases {
+		rec := serveCompressed(opts, gzipRequest(tc.path), func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", tc.contentType)
+			io.WriteString(w, "payload")
+		})
+		assert.Equal(t, tc.compressed, rec.Header().Get("Content-Encoding") == "gzip", "%s %s", tc.path, tc.contentType)
+	}
+}
+
+func TestCompressionFlushStreams(t *testing.T) {
+	rec := serveCompressed(CompressionOptions{}, gzipRequest("/"), func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		io.WriteString(w, "<p>first</p>")
+		w.(http.Flusher).Flush()
+	})
+
+	assert.True(t, rec.Flushed)
+	zr, err := gzip.NewReader(rec.Body)
+	require.NoError(t, err)
+	decoded, _ := io.ReadAll(zr)
+	assert.Equal(t, "<p>first</p>", string(decoded))
+}
@@ -0,0 +1,187 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/mrhoseah/dolphin/internal/auth"
+	"github.com/mrhoseah/dolphin/internal/binding"
+	"github.com/mrhoseah/dolphin/internal/cache"
+	"github.com/mrhoseah/dolphin/internal/problem"
+)
+
+// IdempotencyKeyHeader names the header a client sets to make a write safe
+// to retry
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// idempotencyLockTTL is how long a request may hold its key while being
+// handled, longer than the router's timeout. The key of an instance that
+// crashed mid-request frees then.
+const idempotencyLockTTL = time.Minute
+
+// maxIdempotencyKey is the longest key accepted
+const maxIdempotencyKey = 255
+
+// IdempotencyOptions configures IdempotencyMiddleware
+type IdempotencyOptions struct {
+	// TTL is how long a response is replayed for
+	TTL time.Duration
+
+	// Methods are the methods honoring the header, POST and PUT by default
+	Methods []string
+
+	// User identifies the signed-in user, so that users sending the same
+	// key don't get each other's responses. It is auth.UserID by default,
+	// the user the auth middleware in front recorded in the context.
+	User func(ctx context.Context) (string, bool)
+
+	// Locker holds a key while its first request is handled, cache.Locks
+	// by default
+	Locker cache.Locker
+
+	// MaxBodySize caps the bodies read to fingerprint a request, larger
+	// ones getting 413. Zero takes the body limit in force, that of
+	// middleware.Limits or BodyLimit in front, else ctx.Bind's 1 MB.
+	MaxBodySize int64
+}
+
+// idempotentResponse is the stored form of a response to replay
+type idempotentResponse struct {
+	Status      int                 `json:"status"`
+	Header      map[string][]string `json:"header"`
+	Body        []byte              `json:"body"`
+	Fingerprint string              `json:"fingerprint"`
+}
+
+// IdempotencyMiddleware honors an Idempotency-Key header on writes. The
+// first response for a key, route and user is stored for opts.TTL and
+// replayed to retries, marked with Idempotent-Replayed: true, so a retried
+// payment isn't taken twice. A retry while the first request is still
+// handled gets 409 Conflict, and a key reused with a different body 422.
+// Server errors aren't stored, so the request can be retried. Mount it
+// behind the auth middleware, which identifies the user.
+func IdempotencyMiddleware(store cache.Cache, opts IdempotencyOptions) func(next http.Handler) http.Handler {
+	if len(opts.Methods) == 0 {
+		opts.Methods = []string{http.MethodPost, http.MethodPut}
+	}
+	if opts.Locker == nil {
+		opts.Locker = cache.Locks
+	}
+	if opts.User == nil {
+		opts.User = auth.UserID
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" || !slices.Contains(opts.Methods, r.Method) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKey {
+				problem.Write(w, r, problem.New(http.StatusBadRequest, "Idempotency-Key is longer than 255 characters"))
+				return
+			}
+
+			maxBytes := opts.MaxBodySize
+			if maxBytes <= 0 {
+				maxBytes = binding.LimitsFromContext(r.Context()).MaxBytes
+			}
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBytes))
+			if err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					problem.Write(w, r, err)
+				} else {
+					problem.Write(w, r, problem.New(http.StatusBadRequest, "Failed to read the request body"))
+				}
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			sum := sha256.Sum256(body)
+			fingerprint := hex.EncodeToString(sum[:])
+
+			user, _ := opts.User(r.Context())
+			cacheKey := idempotencyCacheKey(key, r.Method+" "+r.URL.Path, user)
+
+			if replayIdempotent(w, r, store, cacheKey, fingerprint) {
+				return
+			}
+
+			// The lock outlives a client hanging up, since the handler may
+			// still be running
+			ctx := context.WithoutCancel(r.Context())
+			lock := cache.NewMutex(opts.Locker, cacheKey, idempotencyLockTTL)
+			acquired, err := lock.TryAcquire(ctx)
+			if err != nil {
+				problem.Write(w, r, problem.New(http.StatusServiceUnavailable, "Idempotency keys are unavailable"))
+				return
+			}
+			if !acquired {
+				problem.Write(w, r, problem.New(http.StatusConflict, "A request with this Idempotency-Key is in progress"))
+				return
+			}
+			defer lock.Release(ctx)
+
+			// The first request may have finished since the lookup above
+			if replayIdempotent(w, r, store, cacheKey, fingerprint) {
+				return
+			}
+
+			recorder := &cacheRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(recorder, r)
+			if recorder.status >= http.StatusInternalServerError {
+				return
+			}
+			_ = store.Set(ctx, cacheKey, idempotentResponse{
+				Status:      recorder.status,
+				Header:      w.Header().Clone(),
+				Body:        recorder.body.Bytes(),
+				Fingerprint: fingerprint,
+			}, opts.TTL)
+		})
+	}
+}
+
+// idempotencyCacheKey scopes a client's key to the route and user, hashed
+// so keys of any content make safe cache keys
+func idempotencyCacheKey(key, route, user string) string {
+	sum := sha256.Sum256([]byte(key + "\x00" + route + "\x00" + user))
+	return "idempotency:" + hex.EncodeToString(sum[:])
+}
+
+// replayIdempotent writes the stored response for cacheKey, reporting
+// whether there was one. Headers this request's middleware already set,
+// such as its request ID, are kept.
+func replayIdempotent(w http.ResponseWriter, r *http.Request, store cache.Cache, cacheKey, fingerprint string) bool {
+	raw, err := store.Get(r.Context(), cacheKey)
+	if err != nil {
+		return false
+	}
+	var stored idempotentResponse
+	if json.Unmarshal([]byte(raw), &stored) != nil {
+		return false
+	}
+	if stored.Fingerprint != fingerprint {
+		problem.Write(w, r, problem.New(http.StatusUnprocessableEntity, "Idempotency-Key was already used with a different request body"))
+		return true
+	}
+
+	for name, values := range stored.Header {
+		if _, ok := w.Header()[name]; !ok {
+			w.Header()[name] = values
+		}
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(stored.Status)
+	w.Write(stored.Body)
+	return true
+}
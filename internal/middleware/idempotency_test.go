@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mrhoseah/dolphin/internal/auth"
+	"github.com/mrhoseah/dolphin/internal/cache"
+)
+
+func idempotentRequest(method, key, body string) *http.Request {
+	req := httptest.NewRequest(method, "/payments", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	return req
+}
+
+func TestIdempotencyReplaysTheFirstResponse(t *testing.T) {
+	var charges atomic.Int32
+	store := cache.NewMemoryCache()
+	handler := IdempotencyMiddleware(store, IdempotencyOptions{TTL: time.Hour, Locker: store})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			n := charges.Add(1)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"charge":%d,"amount":%s}`, n, body)
+		}))
+
+	first := httptest.NewRecorder()
+	handler.ServeHTTP(first, idempotentRequest(http.MethodPost, "pay-1", "100"))
+	retry := httptest.NewRecorder()
+	handler.ServeHTTP(retry, idempotentRequest(http.MethodPost, "pay-1", "100"))
+
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Equal(t, `{"charge":1,"amount":100}`, retry.Body.String())
+	assert.Equal(t, "application/json", retry.Header().Get("Content-Type"))
+	assert.Equal(t, "true", retry.Header().Get("Idempotent-Replayed"))
+	assert.Empty(t, first.Header().Get("Idempotent-Replayed"))
+	assert.EqualValues(t, 1, charges.Load())
+
+	other := httptest.NewRecorder()
+	handler.ServeHTTP(other, idempotentRequest(http.MethodPost, "pay-2", "100"))
+	handler.ServeHTTP(httptest.NewRecorder(), idempotentRequest(http.MethodPost, "", "100"))
+	handler.ServeHTTP(httptest.NewRecorder(), idempotentRequest(http.MethodDelete, "pay-1", ""))
+	assert.EqualValues(t, 4, charges.Load(), "other keys, no key and other methods aren't replayed")
+
+	reused := httptest.NewRecorder()
+	handler.ServeHTTP(reused, idempotentRequest(http.MethodPost, "pay-1", "250"))
+	assert.Equal(t, http.StatusUnprocessableEntity, reused.Code)
+}
+
+func TestIdempotencyScopesKeysToUsers(t *testing.T) {
+	var calls atomic.Int32
+	store := cache.NewMemoryCache()
+	handler := IdempotencyMiddleware(store, IdempotencyOptions{TTL: time.Hour, Locker: store})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, _ := auth.UserFromContext(r.Context())
+			fmt.Fprintf(w, "call %d for %s", calls.Add(1), user.GetAuthIdentifier())
+		}))
+	// signedIn stands in for the auth middleware, which records the user
+	signedIn := func(user *auth.User) *httptest.ResponseRecorder {
+		req := idempotentRequest(http.MethodPut, "same", "{}")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req.WithContext(auth.WithUser(req.Context(), user)))
+		return w
+	}
+	ada, grace := &auth.User{ID: 1, Email: "ada@example.com"}, &auth.User{ID: 2, Email: "grace@example.com"}
+
+	assert.Equal(t, "call 1 for ada@example.com", signedIn(ada).Body.String())
+	assert.Equal(t, "call 2 for grace@example.com", signedIn(grace).Body.String(), "another user's key isn't replayed")
+	replayed := signedIn(ada)
+	assert.Equal(t, "call 1 for ada@example.com", replayed.Body.String())
+	assert.Equal(t, "true", replayed.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, "call 2 for grace@example.com", signedIn(grace).Body.String())
+	assert.EqualValues(t, 2, calls.Load())
+}
+
+func TestIdempotencyRejectsInFlightDuplicates(t *testing.T) {
+	store := cache.NewMemoryCache()
+	started, finish := make(chan struct{}), make(chan struct{})
+	var calls atomic.Int32
+	handler := IdempotencyMiddleware(store, IdempotencyOptions{TTL: time.Hour, Locker: store})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) == 1 {
+				close(started)
+				<-finish
+				http.Error(w, "gateway down", http.StatusBadGateway)
+			}
+		}))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(httptest.NewRecorder(), idempotentRequest(http.MethodPost, "pay-1", "100"))
+	}()
+	<-started
+	duplicate := httptest.NewRecorder()
+	handler.ServeHTTP(duplicate, idempotentRequest(http.MethodPost, "pay-1", "100"))
+	assert.Equal(t, http.StatusConflict, duplicate.Code)
+	close(finish)
+	<-done
+
+	retry := httptest.NewRecorder()
+	handler.ServeHTTP(retry, idempotentRequest(http.MethodPost, "pay-1", "100"))
+	assert.Equal(t, http.StatusOK, retry.Code, "server errors aren't stored")
+	assert.EqualValues(t, 2, calls.Load())
+}
+
+func TestIdempotencyCapsTheBodyRead(t *testing.T) {
+	var calls atomic.Int32
+	store := cache.NewMemoryCache()
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { calls.Add(1) })
+
+	capped := IdempotencyMiddleware(store, IdempotencyOptions{TTL: time.Hour, Locker: store, MaxBodySize: 8})(next)
+	w := httptest.NewRecorder()
+	capped.ServeHTTP(w, idempotentRequest(http.MethodPost, "big-1", strings.Repeat("x", 9)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	w = httptest.NewRecorder()
+	capped.ServeHTTP(w, idempotentRequest(http.MethodPost, "small-1", strings.Repeat("x", 8)))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Without a cap of its own, the body limit in force applies
+	limited := BodyLimit(4)(IdempotencyMiddleware(store, IdempotencyOptions{TTL: time.Hour, Locker: store})(next))
+	w = httptest.NewRecorder()
+	limited.ServeHTTP(w, idempotentRequest(http.MethodPost, "big-2", "12345"))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.EqualValues(t, 1, calls.Load())
+}
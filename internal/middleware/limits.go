@@ -0,0 +1,207 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+
+	"github.com/mrhoseah/dolphin/internal/binding"
+	"github.com/mrhoseah/dolphin/internal/logger"
+	"github.com/mrhoseah/dolphin/internal/problem"
+	"github.com/mrhoseah/dolphin/internal/routing"
+)
+
+// RequestLimits bounds a request. Zero fields of a route's limits take the
+// global ones.
+type RequestLimits struct {
+	// MaxBodySize caps the request body in bytes, the body ctx.Bind parses
+	// included; larger bodies get 413. Zero leaves bodies to ctx.Bind's
+	// own limit.
+	MaxBodySize int64
+
+	// Timeout cancels the request's context, and with it the queries run
+	// with the context, and answers 408 if nothing was written by then
+	Timeout time.Duration
+
+	// SlowThreshold replaces the access log's, flagging the request slow
+	// once it takes this long
+	SlowThreshold time.Duration
+}
+
+// or fills the zero fields of l from defaults
+func (l RequestLimits) or(defaults RequestLimits) RequestLimits {
+	if l.MaxBodySize == 0 {
+		l.MaxBodySize = defaults.MaxBodySize
+	}
+	if l.Timeout == 0 {
+		l.Timeout = defaults.Timeout
+	}
+	if l.SlowThreshold == 0 {
+		l.SlowThreshold = defaults.SlowThreshold
+	}
+	return l
+}
+
+type limitsKey struct{}
+
+// limitsState is what the outermost limit leaves in the request context,
+// so that BodyLimit and Timeout on a route replace the limits in force
+// instead of nesting within them
+type limitsState struct {
+	// body and parent are the request's body and context before any limit
+	body   io.ReadCloser
+	parent context.Context
+
+	// timeout is the context of the timeout in force, nil before one
+	timeout context.Context
+}
+
+// limitsOf returns the limits state of r's context, adding it to r first
+// when r has none
+func limitsOf(r *http.Request) (*limitsState, *http.Request) {
+	if state, ok := r.Context().Value(limitsKey{}).(*limitsState); ok {
+		return state, r
+	}
+	state := &limitsState{body: r.Body, parent: r.Context()}
+	return state, r.WithContext(context.WithValue(r.Context(), limitsKey{}, state))
+}
+
+// Limits bounds every request by defaults, overridden by the first of
+// routes that matches it: by chi route pattern, else by the longest path
+// prefix ending at a segment boundary. Routes may override their limits
+// again with BodyLimit and Timeout, which the body and timeout middleware
+// aliases apply. Handlers aren't interrupted at the timeout: one ignoring
+// its context runs on, and gets 408 if it returns without writing.
+func Limits(defaults RequestLimits, routes map[string]RequestLimits) func(http.Handler) http.Handler {
+	byRoute := make(map[string]RequestLimits, len(routes))
+	prefixes := make([]string, 0, len(routes))
+	for route, limits := range routes {
+		route = strings.ToLower(route)
+		byRoute[route] = limits.or(defaults)
+		prefixes = append(prefixes, route)
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limits, ok := byRoute[strings.ToLower(routing.Match(r))]
+			if !ok {
+				limits = defaults
+				path := strings.ToLower(r.URL.Path)
+				for _, prefix := range prefixes {
+					if path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/") {
+						limits = byRoute[prefix]
+						break
+					}
+				}
+			}
+			if limits.SlowThreshold > 0 {
+				logger.SetSlowThreshold(r.Context(), limits.SlowThreshold)
+			}
+
+			_, r = limitsOf(r)
+			h := next
+			if limits.MaxBodySize > 0 {
+				h = BodyLimit(limits.MaxBodySize)(h)
+			}
+			if limits.Timeout > 0 {
+				h = Timeout(limits.Timeout)(h)
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// BodyLimit caps the bodies of the requests it wraps at maxBytes, in place
+// of the cap of Limits or another BodyLimit in front of it. Reading past
+// the cap fails with an *http.MaxBytesError, which problem.Write reports
+// as 413; reading a body declared longer fails before any of it is read.
+func BodyLimit(maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			state, r := limitsOf(r)
+			// ctx.Bind parses up to the same cap
+			limits := binding.LimitsFromContext(r.Context())
+			limits.MaxBytes = maxBytes
+			r.Body = http.MaxBytesReader(w, state.body, maxBytes)
+			if r.ContentLength > maxBytes {
+				r.Body = tooLarge{ReadCloser: state.body, limit: maxBytes}
+			}
+			binding.WithLimits(limits)(next).ServeHTTP(w, r)
+		})
+	}
+}
+
+// tooLarge is a body whose Content-Length is over its cap
+type tooLarge struct {
+	io.ReadCloser
+	limit int64
+}
+
+func (b tooLarge) Read([]byte) (int, error) {
+	return 0, &http.MaxBytesError{Limit: b.limit}
+}
+
+// Timeout cancels the context of the requests it wraps after timeout, in
+// place of the timeout of Limits or another Timeout in front of it, which
+// may be shorter or longer. A request whose handler wrote nothing by the
+// time it returns gets 408, as do the server errors problem.Write reports
+// for it.
+func Timeout(timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			state, r := limitsOf(r)
+			parent := r.Context()
+			if state.timeout != nil {
+				// Detach from the timeout in force, keeping the context's
+				// values and the client going away
+				detached, cancel := context.WithCancel(context.WithoutCancel(parent))
+				defer cancel()
+				stop := context.AfterFunc(state.parent, cancel)
+				defer stop()
+				parent = detached
+			}
+
+			ctx, cancel := context.WithTimeoutCause(parent, timeout, problem.ErrRequestTimeout)
+			defer cancel()
+			state.timeout = ctx
+			ww := chimiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			r = r.WithContext(ctx)
+			next.ServeHTTP(ww, r)
+
+			// A Timeout behind this one answers for its own
+			if state.timeout == ctx && ww.Status() == 0 && errors.Is(context.Cause(ctx), problem.ErrRequestTimeout) {
+				problem.Write(ww, r, problem.ErrRequestTimeout)
+			}
+		})
+	}
+}
+
+// ParseSize parses a size in bytes, optionally with a KB, MB or GB suffix
+// counting in 1024s, as in 512KB or 10MB
+func ParseSize(size string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(size))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		bytes  int64
+	}{{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"B", 1}} {
+		if strings.HasSuffix(s, unit.suffix) {
+			s, multiplier = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix)), unit.bytes
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+	return n * multiplier, nil
+}
@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/binding"
+	"github.com/mrhoseah/dolphin/internal/problem"
+)
+
+func newLimitedRouter() *chi.Mux {
+	r := chi.NewRouter()
+	r.Use(Limits(RequestLimits{MaxBodySize: 16, Timeout: 20 * time.Millisecond}, map[string]RequestLimits{
+		"/uploads":         {MaxBodySize: 1 << 10},
+		"/reports/{id}":    {Timeout: time.Second},
+		"/reports/{id}/ok": {},
+	}))
+
+	echo := func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			problem.Write(w, r, err)
+			return
+		}
+		w.Write(body)
+	}
+	r.Post("/echo", echo)
+	r.Post("/uploads/avatar", echo)
+	r.With(BodyLimit(64)).Post("/import", func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		json.NewEncoder(w).Encode(binding.LimitsFromContext(r.Context()).MaxBytes)
+	})
+
+	wait := func(d time.Duration) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-time.After(d):
+				w.Write([]byte("done"))
+			case <-r.Context().Done():
+				// as a query cut short returns its error
+				problem.Write(w, r, r.Context().Err())
+			}
+		}
+	}
+	r.Get("/wait", wait(time.Second))
+	r.Get("/quiet", func(w http.ResponseWriter, r *http.Request) { <-r.Context().Done() })
+	r.Get("/reports/{id}", wait(50*time.Millisecond))
+	r.With(Timeout(time.Second)).Get("/export", wait(50*time.Millisecond))
+	r.With(Timeout(5*time.Millisecond)).Get("/ping", wait(time.Second))
+	return r
+}
+
+func serveLimited(r http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestLimitsBodySize(t *testing.T) {
+	r := newLimitedRouter()
+	small := strings.Repeat("a", 8)
+	large := strings.Repeat("a", 32)
+
+	rec := serveLimited(r, httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(small)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, small, rec.Body.String())
+
+	// Declared too long, and found too long while reading
+	rec = serveLimited(r, httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(large)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Contains(t, rec.Body.String(), "at most 16 bytes")
+	req := httptest.NewRequest(http.MethodPost, "/echo", io.NopCloser(strings.NewReader(large)))
+	req.ContentLength = -1
+	assert.Equal(t, http.StatusRequestEntityTooLarge, serveLimited(r, req).Code)
+
+	// Routes may take larger bodies, by configured prefix or on the route
+	assert.Equal(t, http.StatusOK, serveLimited(r, httptest.NewRequest(http.MethodPost, "/uploads/avatar", strings.NewReader(large))).Code)
+	rec = serveLimited(r, httptest.NewRequest(http.MethodPost, "/import", strings.NewReader(large)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "64\n", rec.Body.String(), "ctx.Bind's limit follows the route's")
+}
+
+func TestLimitsTimeout(t *testing.T) {
+	r := newLimitedRouter()
+
+	// Work cut short is reported as a timeout, as is a handler that
+	// writes nothing
+	rec := serveLimited(r, httptest.NewRequest(http.MethodGet, "/wait", nil))
+	assert.Equal(t, http.StatusRequestTimeout, rec.Code)
+	assert.Equal(t, problem.ContentType, rec.Header().Get("Content-Type"))
+	assert.Equal(t, http.StatusRequestTimeout, serveLimited(r, httptest.NewRequest(http.MethodGet, "/quiet", nil)).Code)
+
+	// Longer by route pattern in the config, or on the route, and shorter
+	for path, status := range map[string]int{"/reports/7": 200, "/export": 200, "/ping": 408} {
+		assert.Equal(t, status, serveLimited(r, httptest.NewRequest(http.MethodGet, path, nil)).Code, path)
+	}
+
+	// A longer timeout still ends with the client
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rec = serveLimited(r, httptest.NewRequest(http.MethodGet, "/export", nil).WithContext(ctx))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code, "a canceled request isn't a timeout")
+}
+
+func TestParseSize(t *testing.T) {
+	for input, want := range map[string]int64{"512": 512, "512B": 512, "64KB": 64 << 10, "10mb": 10 << 20, "1 GB": 1 << 30} {
+		got, err := ParseSize(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, want, got, input)
+	}
+	for _, input := range []string{"", "MB", "-1", "1TB", "ten"} {
+		_, err := ParseSize(input)
+		assert.Error(t, err, input)
+	}
+}
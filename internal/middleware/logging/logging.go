@@ -1,35 +0,0 @@
-package middleware
-
-import (
-	"net/http"
-	"time"
-
-	"github.com/go-chi/chi/v5/middleware"
-	"go.uber.org/zap"
-)
-
-// Logging middleware for request logging
-func New(logger *zap.Logger) func(next http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			start := time.Now()
-
-			// Wrap the response writer to capture status code
-			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
-
-			// Process the request
-			next.ServeHTTP(ww, r)
-
-			// Log the request
-			logger.Info("HTTP Request",
-				zap.String("method", r.Method),
-				zap.String("url", r.URL.String()),
-				zap.String("remote_addr", r.RemoteAddr),
-				zap.String("user_agent", r.UserAgent()),
-				zap.Int("status", ww.Status()),
-				zap.Int("bytes", ww.BytesWritten()),
-				zap.Duration("duration", time.Since(start)),
-			)
-		})
-	}
-}
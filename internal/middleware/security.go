@@ -6,6 +6,8 @@ import (
 	"net/http"
 	"strings"
 	"time"
+
+	"github.com/mrhoseah/dolphin/internal/problem"
 )
 
 // SecurityHeadersMiddleware adds security headers to responses
@@ -56,7 +58,7 @@ func CSRFProtectionMiddleware(secret string) func(next http.Handler) http.Handle
 
 			// Validate CSRF token
 			if !isValidCSRFToken(token, secret) {
-				http.Error(w, "CSRF token mismatch", http.StatusForbidden)
+				problem.Write(w, r, problem.New(problem.StatusPageExpired, "CSRF token mismatch"))
 				return
 			}
 
@@ -0,0 +1,162 @@
+// Package modules is the registry through which application modules and
+// plugins contribute migrations, seeders, routes, views and assets without
+// putting them in the application's top-level directories. A module
+// registers itself from init, so importing it is enough:
+//
+//	func init() {
+//		modules.Register(modules.Module{
+//			Name:       "billing",
+//			Dir:        "modules/billing",
+//			Migrations: []raptor.Migration{createInvoices{}},
+//			Seeders:    []database.Seeder{plans{}},
+//			Routes:     routes,
+//		})
+//	}
+//
+// The framework merges what modules contribute with the application's own:
+// migrations and seeders run with the application's, routes are mounted on
+// its router, the views in Dir/views are pages named billing::index and
+// the files in Dir/assets are served under /modules/billing/.
+package modules
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mrhoseah/dolphin/internal/database"
+	raptor "github.com/mrhoseah/raptor/core"
+)
+
+// AssetsPrefix is where modules' assets are served, each under its name
+const AssetsPrefix = "/modules/"
+
+// ViewsDir and AssetsDir are the directories in a module's Dir holding its
+// views and its assets
+const (
+	ViewsDir  = "views"
+	AssetsDir = "assets"
+)
+
+// Module is what a module or plugin contributes to the application
+type Module struct {
+	// Name namespaces the module's views and assets
+	Name string
+
+	// Dir holds the module's views and assets directories, relative to the
+	// application's working directory; empty when it has neither
+	Dir string
+
+	// Migrations and Seeders run with the application's
+	Migrations []raptor.Migration
+	Seeders    []database.Seeder
+
+	// Routes registers the module's routes on the application's router
+	Routes func(r chi.Router)
+}
+
+// ViewsPath returns the directory of the module's views, or "" without Dir
+func (m Module) ViewsPath() string {
+	if m.Dir == "" {
+		return ""
+	}
+	return filepath.Join(m.Dir, ViewsDir)
+}
+
+// AssetsPath returns the directory of the module's assets, or "" without
+// Dir
+func (m Module) AssetsPath() string {
+	if m.Dir == "" {
+		return ""
+	}
+	return filepath.Join(m.Dir, AssetsDir)
+}
+
+// moduleName is what module names look like, being view namespaces and URL paths
+var moduleName = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+var (
+	mu       sync.RWMutex
+	registry = make(map[string]Module)
+)
+
+// Register adds a module, registering its migrations and seeders with the
+// database package. Modules register from init, so a bad or repeated name
+// is a programming error and panics.
+func Register(m Module) {
+	if !moduleName.MatchString(m.Name) {
+		panic(fmt.Sprintf("modules: invalid module name %q", m.Name))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if _, exists := registry[m.Name]; exists {
+		panic(fmt.Sprintf("modules: module %s registered twice", m.Name))
+	}
+	registry[m.Name] = m
+
+	database.RegisterMigration(m.Migrations...)
+	database.RegisterSeeder(m.Seeders...)
+}
+
+// Get returns a registered module by name
+func Get(name string) (Module, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	m, ok := registry[name]
+	return m, ok
+}
+
+// All returns the registered modules sorted by name
+func All() []Module {
+	mu.RLock()
+	defer mu.RUnlock()
+	all := make([]Module, 0, len(registry))
+	for _, m := range registry {
+		all = append(all, m)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+	return all
+}
+
+// Views maps the name of each module with views to its views directory,
+// ready for template.Config.Namespaces
+func Views() map[string]string {
+	views := make(map[string]string)
+	for _, m := range All() {
+		if dir := m.ViewsPath(); dir != "" && isDir(dir) {
+			views[m.Name] = dir
+		}
+	}
+	return views
+}
+
+// Asset returns the URL of a file in a module's assets directory
+func Asset(module, path string) string {
+	return AssetsPrefix + module + "/" + strings.TrimPrefix(path, "/")
+}
+
+// Mount registers the modules' routes on r, and serves each module's
+// assets directory under AssetsPrefix
+func Mount(r chi.Router) {
+	for _, m := range All() {
+		if m.Routes != nil {
+			m.Routes(r)
+		}
+		if dir := m.AssetsPath(); dir != "" && isDir(dir) {
+			prefix := AssetsPrefix + m.Name + "/"
+			r.Handle(prefix+"*", http.StripPrefix(prefix, http.FileServer(http.Dir(dir))))
+		}
+	}
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,70 @@
+package modules
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/mrhoseah/dolphin/internal/database"
+)
+
+type plansSeeder struct{}
+
+func (plansSeeder) Name() string          { return "test_billing_plans" }
+func (plansSeeder) Run(db *gorm.DB) error { return nil }
+
+// reset forgets the modules a test registered
+func reset(t *testing.T) {
+	t.Cleanup(func() {
+		mu.Lock()
+		registry = make(map[string]Module)
+		mu.Unlock()
+	})
+}
+
+func TestRegisterAndMount(t *testing.T) {
+	reset(t)
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, ViewsDir), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, AssetsDir, "css"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, AssetsDir, "css", "billing.css"), []byte("body{}"), 0644))
+
+	Register(Module{
+		Name:    "billing",
+		Dir:     dir,
+		Seeders: []database.Seeder{plansSeeder{}},
+		Routes: func(r chi.Router) {
+			r.Get("/billing/invoices", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("invoices")) })
+		},
+	})
+	Register(Module{Name: "audit"})
+
+	assert.Equal(t, []string{"audit", "billing"}, []string{All()[0].Name, All()[1].Name})
+	assert.Equal(t, map[string]string{"billing": filepath.Join(dir, ViewsDir)}, Views())
+	assert.Contains(t, database.Seeders(), database.Seeder(plansSeeder{}))
+	assert.Equal(t, "/modules/billing/css/billing.css", Asset("billing", "/css/billing.css"))
+
+	r := chi.NewRouter()
+	Mount(r)
+	for path, body := range map[string]string{
+		"/billing/invoices":                "invoices",
+		"/modules/billing/css/billing.css": "body{}",
+	} {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, http.StatusOK, rec.Code, path)
+		got, _ := io.ReadAll(rec.Body)
+		assert.Equal(t, body, string(got))
+	}
+
+	assert.PanicsWithValue(t, "modules: module billing registered twice", func() { Register(Module{Name: "billing"}) })
+	assert.PanicsWithValue(t, `modules: invalid module name "Billing"`, func() { Register(Module{Name: "Billing"}) })
+}
@@ -0,0 +1,225 @@
+// Package notify sends notifications by SMS, through Twilio, Africa's
+// Talking or Vonage, and by push to the devices users register, through
+// FCM, APNs and Web Push. Each user chooses the channels they get, which
+// are saved in the database:
+//
+//	err := notifier.Send(ctx, notify.Recipient{UserID: user.ID, Phone: user.Phone},
+//		notify.Message{Title: "Order shipped", Body: "Order #1042 is on its way", URL: "/orders/1042"},
+//		notify.ChannelSMS, notify.ChannelPush)
+//
+// `dolphin notify:test --channel sms <to>` checks a driver's setup.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+// Channels notifications are sent through
+const (
+	ChannelSMS  = "sms"
+	ChannelPush = "push"
+)
+
+// Platforms of push devices
+const (
+	PlatformFCM     = "fcm"
+	PlatformAPNs    = "apns"
+	PlatformWebPush = "webpush"
+)
+
+// ErrInvalidDevice is returned by push senders for devices the platform no
+// longer delivers to, such as uninstalled apps, which are then removed
+var ErrInvalidDevice = errors.New("notify: device is no longer registered")
+
+// ErrNotConfigured is returned for channels and platforms without a driver
+var ErrNotConfigured = errors.New("notify: not configured")
+
+// Message is a notification, sent as text by SMS
+type Message struct {
+	Title string
+	Body  string
+
+	// URL is opened when a push notification is tapped
+	URL string
+
+	// Data is passed to the app receiving a push notification
+	Data map[string]string
+}
+
+// Text is the message as sent by SMS
+func (m Message) Text() string {
+	if m.Title == "" {
+		return m.Body
+	}
+	if m.Body == "" {
+		return m.Title
+	}
+	return m.Title + "\n" + m.Body
+}
+
+// Recipient is who a notification is sent to: a user, whose preferences
+// and push devices are looked up, and their phone number for SMS
+type Recipient struct {
+	UserID string
+	Phone  string
+}
+
+// SMSSender sends text messages
+type SMSSender interface {
+	SendSMS(ctx context.Context, to, text string) error
+}
+
+// PushSender sends push notifications to the devices of a platform
+type PushSender interface {
+	Push(ctx context.Context, device *Device, msg Message) error
+}
+
+// Notifier sends notifications through the channels users have chosen
+type Notifier struct {
+	sms    SMSSender
+	push   map[string]PushSender
+	store  *Store
+	logger *zap.Logger
+}
+
+// New creates a notifier without drivers. Without a store, every channel is
+// enabled and nothing is sent by push.
+func New(store *Store, logger *zap.Logger) *Notifier {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &Notifier{push: make(map[string]PushSender), store: store, logger: logger}
+}
+
+// FromConfig creates a notifier with the SMS driver of cfg and each push
+// platform whose credentials are set
+func FromConfig(cfg config.NotifyConfig, store *Store, logger *zap.Logger) (*Notifier, error) {
+	n := New(store, logger)
+	sms, err := smsFromConfig(cfg.SMS, n.logger)
+	if err != nil {
+		return nil, err
+	}
+	n.SetSMS(sms)
+
+	if cfg.Push.FCM.CredentialsFile != "" {
+		fcm, err := NewFCM(cfg.Push.FCM)
+		if err != nil {
+			return nil, err
+		}
+		n.SetPush(PlatformFCM, fcm)
+	}
+	if cfg.Push.APNs.KeyFile != "" {
+		apns, err := NewAPNs(cfg.Push.APNs)
+		if err != nil {
+			return nil, err
+		}
+		n.SetPush(PlatformAPNs, apns)
+	}
+	if cfg.Push.WebPush.PrivateKey != "" {
+		webPush, err := NewWebPush(cfg.Push.WebPush)
+		if err != nil {
+			return nil, err
+		}
+		n.SetPush(PlatformWebPush, webPush)
+	}
+	return n, nil
+}
+
+// SetSMS replaces the SMS driver
+func (n *Notifier) SetSMS(sender SMSSender) {
+	n.sms = sender
+}
+
+// SetPush replaces the sender of a push platform
+func (n *Notifier) SetPush(platform string, sender PushSender) {
+	n.push[platform] = sender
+}
+
+// Store returns the preference and device store, or nil
+func (n *Notifier) Store() *Store {
+	return n.store
+}
+
+// Send sends msg to a recipient through each of channels they haven't
+// turned off. A failing channel doesn't stop the others; their errors are
+// joined.
+func (n *Notifier) Send(ctx context.Context, to Recipient, msg Message, channels ...string) error {
+	var errs []error
+	for _, channel := range channels {
+		if to.UserID != "" && n.store != nil {
+			enabled, err := n.store.Enabled(ctx, to.UserID, channel)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if !enabled {
+				continue
+			}
+		}
+
+		switch channel {
+		case ChannelSMS:
+			if to.Phone == "" {
+				continue
+			}
+			errs = append(errs, n.SendSMS(ctx, to.Phone, msg.Text()))
+		case ChannelPush:
+			errs = append(errs, n.pushUser(ctx, to.UserID, msg))
+		default:
+			errs = append(errs, fmt.Errorf("notify: unknown channel %q", channel))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SendSMS sends a text message, whatever the recipient's preferences
+func (n *Notifier) SendSMS(ctx context.Context, to, text string) error {
+	if n.sms == nil {
+		return fmt.Errorf("%w: sms", ErrNotConfigured)
+	}
+	return n.sms.SendSMS(ctx, to, text)
+}
+
+// Push sends a push notification to a device, whatever its user's
+// preferences
+func (n *Notifier) Push(ctx context.Context, device *Device, msg Message) error {
+	sender, ok := n.push[device.Platform]
+	if !ok {
+		return fmt.Errorf("%w: %s push", ErrNotConfigured, device.Platform)
+	}
+	return sender.Push(ctx, device, msg)
+}
+
+// pushUser sends a push notification to each of a user's devices,
+// removing those their platform no longer delivers to
+func (n *Notifier) pushUser(ctx context.Context, userID string, msg Message) error {
+	if userID == "" || n.store == nil {
+		return nil
+	}
+	devices, err := n.store.Devices(ctx, userID)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for i := range devices {
+		device := &devices[i]
+		if _, ok := n.push[device.Platform]; !ok {
+			continue
+		}
+		err := n.Push(ctx, device, msg)
+		if errors.Is(err, ErrInvalidDevice) {
+			n.logger.Info("Removing push device no longer registered",
+				zap.String("user_id", userID), zap.String("platform", device.Platform))
+			errs = append(errs, n.store.RemoveDevice(ctx, device.Token))
+			continue
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,442 @@
+package notify
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/database"
+)
+
+func TestMessageText(t *testing.T) {
+	assert.Equal(t, "Shipped\nOrder #1042 is on its way", Message{Title: "Shipped", Body: "Order #1042 is on its way"}.Text())
+	assert.Equal(t, "Shipped", Message{Title: "Shipped"}.Text())
+	assert.Equal(t, "On its way", Message{Body: "On its way"}.Text())
+}
+
+func TestTwilio(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/2010-04-01/Accounts/AC123/Messages.json", r.URL.Path)
+		sid, token, _ := r.BasicAuth()
+		assert.Equal(t, "AC123", sid)
+		assert.Equal(t, "secret", token)
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "+15005550006", r.PostForm.Get("From"))
+		assert.Equal(t, "hello", r.PostForm.Get("Body"))
+		if r.PostForm.Get("To") == "+15005550001" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"code":21211,"message":"The 'To' number +15005550001 is not a valid phone number.","status":400}`))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"sid":"SM1","status":"queued"}`))
+	}))
+	defer server.Close()
+
+	twilio := NewTwilio(config.TwilioConfig{AccountSID: "AC123", AuthToken: "secret", BaseURL: server.URL}, "+15005550006")
+	require.NoError(t, twilio.SendSMS(context.Background(), "+254712345678", "hello"))
+	err := twilio.SendSMS(context.Background(), "+15005550001", "hello")
+	assert.EqualError(t, err, "notify: twilio failed with 400: The 'To' number +15005550001 is not a valid phone number.")
+}
+
+func TestAfricasTalking(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/version1/messaging", r.URL.Path)
+		if r.Header.Get("apiKey") != "key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte("The supplied authentication is invalid"))
+			return
+		}
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "sandbox", r.PostForm.Get("username"))
+		assert.Empty(t, r.PostForm.Get("from"))
+		status := `"statusCode":101,"status":"Success"`
+		if r.PostForm.Get("to") == "+254700000000" {
+			status = `"statusCode":403,"status":"InvalidPhoneNumber"`
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"SMSMessageData":{"Message":"Sent to 1/1","Recipients":[{` + status + `,"number":"` + r.PostForm.Get("to") + `"}]}}`))
+	}))
+	defer server.Close()
+
+	at := NewAfricasTalking(config.AfricasTalkingConfig{Username: "sandbox", APIKey: "key", BaseURL: server.URL}, "")
+	require.NoError(t, at.SendSMS(context.Background(), "+254712345678", "hello"))
+	assert.EqualError(t, at.SendSMS(context.Background(), "+254700000000", "hello"), "notify: africastalking failed with 403: InvalidPhoneNumber")
+
+	at = NewAfricasTalking(config.AfricasTalkingConfig{Username: "sandbox", APIKey: "wrong", BaseURL: server.URL}, "")
+	assert.EqualError(t, at.SendSMS(context.Background(), "+254712345678", "hello"), "notify: africastalking failed with 401: The supplied authentication is invalid")
+
+	assert.Equal(t, "https://api.sandbox.africastalking.com", NewAfricasTalking(config.AfricasTalkingConfig{Username: "sandbox"}, "").baseURL)
+	assert.Equal(t, "https://api.africastalking.com", NewAfricasTalking(config.AfricasTalkingConfig{Username: "shop"}, "").baseURL)
+}
+
+func TestVonage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/sms/json", r.URL.Path)
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "Dolphin", r.PostForm.Get("from"))
+		if r.PostForm.Get("api_secret") != "secret" {
+			w.Write([]byte(`{"message-count":"1","messages":[{"status":"4","error-text":"Bad Credentials"}]}`))
+			return
+		}
+		assert.Equal(t, "254712345678", r.PostForm.Get("to"))
+		w.Write([]byte(`{"message-count":"1","messages":[{"to":"254712345678","message-id":"0A1","status":"0"}]}`))
+	}))
+	defer server.Close()
+
+	vonage := NewVonage(config.VonageConfig{APIKey: "key", APISecret: "secret", BaseURL: server.URL}, "Dolphin")
+	require.NoError(t, vonage.SendSMS(context.Background(), "+254712345678", "hello"))
+	vonage = NewVonage(config.VonageConfig{APIKey: "key", APISecret: "wrong", BaseURL: server.URL}, "Dolphin")
+	assert.EqualError(t, vonage.SendSMS(context.Background(), "+254712345678", "hello"), "notify: vonage failed with status 4: Bad Credentials")
+}
+
+func TestSMSFromConfig(t *testing.T) {
+	sms, err := smsFromConfig(config.SMSConfig{Driver: "log"}, nil)
+	require.NoError(t, err)
+	assert.IsType(t, &LogSMS{}, sms)
+
+	sms, err = smsFromConfig(config.SMSConfig{Driver: "vonage", Vonage: config.VonageConfig{APIKey: "key", APISecret: "secret"}}, nil)
+	require.NoError(t, err)
+	assert.IsType(t, &Vonage{}, sms)
+
+	_, err = smsFromConfig(config.SMSConfig{Driver: "twilio"}, nil)
+	assert.Error(t, err)
+	_, err = smsFromConfig(config.SMSConfig{Driver: "pigeon"}, nil)
+	assert.Error(t, err)
+}
+
+// writePEM writes a PKCS #8 key to a file in dir
+func writePEM(t *testing.T, dir, name string, key interface{}) string {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600))
+	return path
+}
+
+func TestFCM(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	tokens := 0
+	var sent []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			tokens++
+			require.NoError(t, r.ParseForm())
+			claims := jwt.MapClaims{}
+			_, err := jwt.ParseWithClaims(r.PostForm.Get("assertion"), claims, func(*jwt.Token) (interface{}, error) {
+				return &key.PublicKey, nil
+			})
+			require.NoError(t, err)
+			assert.Equal(t, "push@app.iam.gserviceaccount.com", claims["iss"])
+			assert.Equal(t, fcmScope, claims["scope"])
+			w.Write([]byte(`{"access_token":"ya29.token","expires_in":3599,"token_type":"Bearer"}`))
+			return
+		}
+		assert.Equal(t, "/v1/projects/dolphin-app/messages:send", r.URL.Path)
+		assert.Equal(t, "Bearer ya29.token", r.Header.Get("Authorization"))
+		var body map[string]map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		sent = append(sent, body["message"])
+		if body["message"]["token"] == "stale" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"code":404,"message":"Requested entity was not found.","status":"NOT_FOUND","details":[{"errorCode":"UNREGISTERED"}]}}`))
+			return
+		}
+		w.Write([]byte(`{"name":"projects/dolphin-app/messages/1"}`))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	keyFile := writePEM(t, dir, "key.pem", key)
+	keyPEM, _ := os.ReadFile(keyFile)
+	creds, _ := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"project_id":   "dolphin-app",
+		"private_key":  string(keyPEM),
+		"client_email": "push@app.iam.gserviceaccount.com",
+		"token_uri":    server.URL + "/token",
+	})
+	credsFile := filepath.Join(dir, "service-account.json")
+	require.NoError(t, os.WriteFile(credsFile, creds, 0600))
+
+	fcm, err := NewFCM(config.FCMConfig{CredentialsFile: credsFile, BaseURL: server.URL})
+	require.NoError(t, err)
+	msg := Message{Title: "Shipped", Body: "On its way", URL: "/orders/1042", Data: map[string]string{"order": "1042"}}
+	require.NoError(t, fcm.Push(context.Background(), &Device{Platform: PlatformFCM, Token: "device-1"}, msg))
+	assert.ErrorIs(t, fcm.Push(context.Background(), &Device{Platform: PlatformFCM, Token: "stale"}, msg), ErrInvalidDevice)
+
+	assert.Equal(t, 1, tokens, "the access token is reused")
+	require.Len(t, sent, 2)
+	assert.Equal(t, map[string]interface{}{"title": "Shipped", "body": "On its way"}, sent[0]["notification"])
+	assert.Equal(t, map[string]interface{}{"order": "1042", "url": "/orders/1042"}, sent[0]["data"])
+}
+
+func TestAPNs(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	var payload map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "bearer ")
+		parsed, err := jwt.Parse(token, func(*jwt.Token) (interface{}, error) { return &key.PublicKey, nil })
+		require.NoError(t, err)
+		assert.Equal(t, "ABC123DEFG", parsed.Header["kid"])
+		assert.Equal(t, "com.example.app", r.Header.Get("apns-topic"))
+		assert.Equal(t, "alert", r.Header.Get("apns-push-type"))
+		if r.URL.Path == "/3/device/uninstalled" {
+			w.WriteHeader(http.StatusGone)
+			w.Write([]byte(`{"reason":"Unregistered","timestamp":1700000000000}`))
+			return
+		}
+		if r.URL.Path == "/3/device/busy" {
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"reason":"TooManyRequests"}`))
+			return
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+	}))
+	defer server.Close()
+
+	apns, err := NewAPNs(config.APNsConfig{
+		KeyFile: writePEM(t, t.TempDir(), "AuthKey.p8", key),
+		KeyID:   "ABC123DEFG",
+		TeamID:  "TEAM123456",
+		Topic:   "com.example.app",
+		BaseURL: server.URL,
+	})
+	require.NoError(t, err)
+	msg := Message{Title: "Shipped", Body: "On its way", URL: "/orders/1042"}
+	require.NoError(t, apns.Push(context.Background(), &Device{Token: "device-1"}, msg))
+	assert.Equal(t, map[string]interface{}{"title": "Shipped", "body": "On its way"}, payload["aps"].(map[string]interface{})["alert"])
+	assert.Equal(t, "/orders/1042", payload["url"])
+
+	assert.ErrorIs(t, apns.Push(context.Background(), &Device{Token: "uninstalled"}, msg), ErrInvalidDevice)
+	assert.EqualError(t, apns.Push(context.Background(), &Device{Token: "busy"}, msg), "notify: apns failed with 429: TooManyRequests")
+
+	assert.Equal(t, "https://api.sandbox.push.apple.com", apnsBaseURL(t, key, false))
+	assert.Equal(t, "https://api.push.apple.com", apnsBaseURL(t, key, true))
+}
+
+// apnsBaseURL returns the address an APNs sender sends to
+func apnsBaseURL(t *testing.T, key *ecdsa.PrivateKey, production bool) string {
+	apns, err := NewAPNs(config.APNsConfig{
+		KeyFile: writePEM(t, t.TempDir(), "AuthKey.p8", key), KeyID: "K", TeamID: "T", Topic: "app", Production: production,
+	})
+	require.NoError(t, err)
+	return apns.baseURL
+}
+
+// decryptWebPush decrypts a message as the browser holding uaKey does
+func decryptWebPush(t *testing.T, body []byte, uaKey *ecdh.PrivateKey, authSecret []byte) []byte {
+	salt := body[:16]
+	assert.Equal(t, uint32(webPushRecordSize), binary.BigEndian.Uint32(body[16:20]))
+	idLen := int(body[20])
+	asPublic := body[21 : 21+idLen]
+	asKey, err := ecdh.P256().NewPublicKey(asPublic)
+	require.NoError(t, err)
+	shared, err := uaKey.ECDH(asKey)
+	require.NoError(t, err)
+	cek, nonce, err := webPushKeys(shared, authSecret, salt, uaKey.PublicKey().Bytes(), asPublic)
+	require.NoError(t, err)
+	block, err := aes.NewCipher(cek)
+	require.NoError(t, err)
+	gcm, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+	plaintext, err := gcm.Open(nil, nonce, body[21+idLen:], nil)
+	require.NoError(t, err)
+	require.Equal(t, byte(0x02), plaintext[len(plaintext)-1], "the last record")
+	return plaintext[:len(plaintext)-1]
+}
+
+func TestWebPush(t *testing.T) {
+	publicKey, privateKey, err := GenerateVAPIDKeys()
+	require.NoError(t, err)
+	uaKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	authSecret := make([]byte, 16)
+	rand.Read(authSecret)
+
+	var received []byte
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/push/expired" {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		assert.Equal(t, "aes128gcm", r.Header.Get("Content-Encoding"))
+		assert.Equal(t, "86400", r.Header.Get("TTL"))
+
+		var token, k string
+		for _, part := range strings.Split(strings.TrimPrefix(r.Header.Get("Authorization"), "vapid "), ", ") {
+			if v, ok := strings.CutPrefix(part, "t="); ok {
+				token = v
+			}
+			if v, ok := strings.CutPrefix(part, "k="); ok {
+				k = v
+			}
+		}
+		assert.Equal(t, publicKey, k)
+		raw, _ := base64.RawURLEncoding.DecodeString(k)
+		vapidKey, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), raw)
+		require.NoError(t, err)
+		claims := jwt.MapClaims{}
+		_, err = jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) { return vapidKey, nil })
+		require.NoError(t, err)
+		assert.Equal(t, server.URL, claims["aud"])
+		assert.Equal(t, "mailto:ops@example.com", claims["sub"])
+
+		body, _ := io.ReadAll(r.Body)
+		received = decryptWebPush(t, body, uaKey, authSecret)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	webPush, err := NewWebPush(config.WebPushConfig{PublicKey: publicKey, PrivateKey: privateKey, Subject: "mailto:ops@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, publicKey, webPush.PublicKey())
+
+	device := &Device{
+		Platform: PlatformWebPush,
+		Token:    server.URL + "/push/abc",
+		P256dh:   base64.URLEncoding.EncodeToString(uaKey.PublicKey().Bytes()),
+		Auth:     base64.RawURLEncoding.EncodeToString(authSecret),
+	}
+	require.NoError(t, webPush.Push(context.Background(), device, Message{Title: "Shipped", Body: "On its way", URL: "/orders/1042"}))
+	var payload map[string]interface{}
+	require.NoError(t, json.Unmarshal(received, &payload))
+	assert.Equal(t, "Shipped", payload["title"])
+	assert.Equal(t, "/orders/1042", payload["url"])
+
+	device.Token = server.URL + "/push/expired"
+	assert.ErrorIs(t, webPush.Push(context.Background(), device, Message{Title: "Hi"}), ErrInvalidDevice)
+
+	big := Message{Body: strings.Repeat("x", webPushMaxPayload)}
+	assert.Error(t, webPush.Push(context.Background(), device, big))
+
+	otherPublic, _, _ := GenerateVAPIDKeys()
+	_, err = NewWebPush(config.WebPushConfig{PublicKey: otherPublic, PrivateKey: privateKey, Subject: "mailto:ops@example.com"})
+	assert.Error(t, err, "mismatched keys")
+}
+
+func newStore(t *testing.T) *Store {
+	db, err := database.New(&config.DatabaseConfig{Driver: "sqlite", Database: filepath.Join(t.TempDir(), "app.db")})
+	require.NoError(t, err)
+	store, err := NewStore(db.GetDB())
+	require.NoError(t, err)
+	return store
+}
+
+func TestStore(t *testing.T) {
+	store := newStore(t)
+	ctx := context.Background()
+
+	enabled, err := store.Enabled(ctx, "1", ChannelSMS)
+	require.NoError(t, err)
+	assert.True(t, enabled, "channels are on until turned off")
+	require.NoError(t, store.SetEnabled(ctx, "1", ChannelSMS, false))
+	require.NoError(t, store.SetEnabled(ctx, "1", ChannelPush, false))
+	require.NoError(t, store.SetEnabled(ctx, "1", ChannelPush, true))
+	enabled, err = store.Enabled(ctx, "1", ChannelSMS)
+	require.NoError(t, err)
+	assert.False(t, enabled)
+	prefs, err := store.Preferences(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{ChannelSMS: false, ChannelPush: true}, prefs)
+
+	require.NoError(t, store.RegisterDevice(ctx, &Device{UserID: "1", Platform: PlatformFCM, Token: "phone"}))
+	require.NoError(t, store.RegisterDevice(ctx, &Device{UserID: "1", Platform: PlatformAPNs, Token: "tablet"}))
+	// Someone else signs in on the phone
+	require.NoError(t, store.RegisterDevice(ctx, &Device{UserID: "2", Platform: PlatformFCM, Token: "phone"}))
+	devices, err := store.Devices(ctx, "1")
+	require.NoError(t, err)
+	require.Len(t, devices, 1)
+	assert.Equal(t, "tablet", devices[0].Token)
+
+	require.NoError(t, store.RemoveDevice(ctx, "tablet"))
+	devices, err = store.Devices(ctx, "1")
+	require.NoError(t, err)
+	assert.Empty(t, devices)
+}
+
+type fakeSMS struct {
+	sent []string
+}
+
+func (f *fakeSMS) SendSMS(ctx context.Context, to, text string) error {
+	f.sent = append(f.sent, to+": "+text)
+	return nil
+}
+
+type fakePush struct {
+	invalid map[string]bool
+	sent    []string
+}
+
+func (f *fakePush) Push(ctx context.Context, device *Device, msg Message) error {
+	if f.invalid[device.Token] {
+		return ErrInvalidDevice
+	}
+	if device.Token == "broken" {
+		return errors.New("push service down")
+	}
+	f.sent = append(f.sent, device.Token+": "+msg.Title)
+	return nil
+}
+
+func TestNotifierSend(t *testing.T) {
+	store := newStore(t)
+	ctx := context.Background()
+	sms := &fakeSMS{}
+	push := &fakePush{invalid: map[string]bool{"uninstalled": true}}
+	n := New(store, nil)
+	n.SetSMS(sms)
+	n.SetPush(PlatformFCM, push)
+
+	for _, token := range []string{"phone", "uninstalled"} {
+		require.NoError(t, store.RegisterDevice(ctx, &Device{UserID: "1", Platform: PlatformFCM, Token: token}))
+	}
+	require.NoError(t, store.RegisterDevice(ctx, &Device{UserID: "1", Platform: PlatformWebPush, Token: "https://push.example.com/1"}))
+
+	msg := Message{Title: "Shipped", Body: "On its way"}
+	to := Recipient{UserID: "1", Phone: "+254712345678"}
+	require.NoError(t, n.Send(ctx, to, msg, ChannelSMS, ChannelPush))
+	assert.Equal(t, []string{"+254712345678: Shipped\nOn its way"}, sms.sent)
+	assert.Equal(t, []string{"phone: Shipped"}, push.sent, "platforms without a sender are skipped")
+	devices, _ := store.Devices(ctx, "1")
+	assert.Len(t, devices, 2, "the uninstalled device is removed")
+
+	require.NoError(t, store.SetEnabled(ctx, "1", ChannelSMS, false))
+	require.NoError(t, n.Send(ctx, to, msg, ChannelSMS))
+	assert.Len(t, sms.sent, 1, "turned off")
+
+	require.NoError(t, store.RegisterDevice(ctx, &Device{UserID: "1", Platform: PlatformFCM, Token: "broken"}))
+	err := n.Send(ctx, to, msg, ChannelPush, "pigeon")
+	assert.ErrorContains(t, err, "push service down")
+	assert.ErrorContains(t, err, `unknown channel "pigeon"`)
+	assert.Len(t, push.sent, 2, "a failing device doesn't stop the others")
+
+	assert.ErrorIs(t, New(nil, nil).SendSMS(ctx, "+254712345678", "hi"), ErrNotConfigured)
+}
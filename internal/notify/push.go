@@ -0,0 +1,332 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+// fcmScope is the OAuth scope FCM's access tokens are asked for
+const fcmScope = "https://www.googleapis.com/auth/firebase.messaging"
+
+// apnsTokenTTL is how long an APNs provider token is reused; Apple refuses
+// tokens older than an hour
+const apnsTokenTTL = 50 * time.Minute
+
+// pushPayload is what a push notification carries to the app
+func pushPayload(msg Message) map[string]string {
+	data := make(map[string]string, len(msg.Data)+1)
+	for key, value := range msg.Data {
+		data[key] = value
+	}
+	if msg.URL != "" {
+		data["url"] = msg.URL
+	}
+	return data
+}
+
+// FCM sends push notifications to Android, iOS and web apps through
+// Firebase Cloud Messaging's HTTP v1 API
+type FCM struct {
+	projectID   string
+	clientEmail string
+	tokenURL    string
+	key         *rsa.PrivateKey
+	baseURL     string
+	client      *http.Client
+
+	mu          sync.Mutex
+	accessToken string
+	expires     time.Time
+}
+
+// fcmCredentials is the service account key downloaded from Firebase
+type fcmCredentials struct {
+	ProjectID   string `json:"project_id"`
+	PrivateKey  string `json:"private_key"`
+	ClientEmail string `json:"client_email"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// NewFCM returns a sender authenticating with the config's service account
+func NewFCM(cfg config.FCMConfig) (*FCM, error) {
+	data, err := os.ReadFile(cfg.CredentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("notify: fcm credentials: %w", err)
+	}
+	var creds fcmCredentials
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return nil, fmt.Errorf("notify: fcm credentials: %w", err)
+	}
+	parsed, err := parsePrivateKey([]byte(creds.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("notify: fcm credentials: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("notify: fcm credentials: private_key isn't an RSA key")
+	}
+
+	projectID := cfg.ProjectID
+	if projectID == "" {
+		projectID = creds.ProjectID
+	}
+	tokenURL := creds.TokenURI
+	if tokenURL == "" {
+		tokenURL = "https://oauth2.googleapis.com/token"
+	}
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = "https://fcm.googleapis.com"
+	}
+	return &FCM{
+		projectID:   projectID,
+		clientEmail: creds.ClientEmail,
+		tokenURL:    tokenURL,
+		key:         key,
+		baseURL:     strings.TrimSuffix(baseURL, "/"),
+		client:      &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (f *FCM) Push(ctx context.Context, device *Device, msg Message) error {
+	token, err := f.token(ctx)
+	if err != nil {
+		return err
+	}
+	message := map[string]interface{}{
+		"token":        device.Token,
+		"notification": map[string]string{"title": msg.Title, "body": msg.Body},
+	}
+	if data := pushPayload(msg); len(data) > 0 {
+		message["data"] = data
+	}
+	if msg.URL != "" {
+		message["webpush"] = map[string]interface{}{"fcm_options": map[string]string{"link": msg.URL}}
+	}
+	body, err := json.Marshal(map[string]interface{}{"message": message})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.baseURL+"/v1/projects/"+url.PathEscape(f.projectID)+"/messages:send", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	status, data, err := send(f.client, req, "fcm")
+	if err != nil {
+		return err
+	}
+	if status >= 200 && status < 300 {
+		return nil
+	}
+	var resp struct {
+		Error struct {
+			Message string `json:"message"`
+			Status  string `json:"status"`
+			Details []struct {
+				ErrorCode string `json:"errorCode"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	json.Unmarshal(data, &resp)
+	if status == http.StatusNotFound || resp.Error.Status == "NOT_FOUND" {
+		return ErrInvalidDevice
+	}
+	for _, detail := range resp.Error.Details {
+		if detail.ErrorCode == "UNREGISTERED" {
+			return ErrInvalidDevice
+		}
+	}
+	return failed("fcm", status, resp.Error.Message)
+}
+
+// token returns an access token, exchanging a JWT signed with the service
+// account's key for one when the last has expired
+func (f *FCM) token(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.accessToken != "" && time.Now().Before(f.expires) {
+		return f.accessToken, nil
+	}
+
+	now := time.Now()
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   f.clientEmail,
+		"scope": fcmScope,
+		"aud":   f.tokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}).SignedString(f.key)
+	if err != nil {
+		return "", err
+	}
+	req, err := newFormRequest(ctx, f.tokenURL, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	})
+	if err != nil {
+		return "", err
+	}
+	status, data, err := send(f.client, req, "fcm")
+	if err != nil {
+		return "", err
+	}
+	var resp struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int    `json:"expires_in"`
+		ErrorDescription string `json:"error_description"`
+	}
+	json.Unmarshal(data, &resp)
+	if status < 200 || status >= 300 || resp.AccessToken == "" {
+		return "", failed("fcm", status, resp.ErrorDescription)
+	}
+	f.accessToken = resp.AccessToken
+	// Renewed a minute early, so it doesn't expire in flight
+	f.expires = now.Add(time.Duration(resp.ExpiresIn)*time.Second - time.Minute)
+	return f.accessToken, nil
+}
+
+// APNs sends push notifications to Apple devices, authenticating with a
+// token signing key
+type APNs struct {
+	keyID   string
+	teamID  string
+	topic   string
+	key     *ecdsa.PrivateKey
+	baseURL string
+	// Go's client speaks the HTTP/2 APNs requires over TLS
+	client *http.Client
+
+	mu     sync.Mutex
+	token  string
+	issued time.Time
+}
+
+// NewAPNs returns a sender signing with the config's .p8 key
+func NewAPNs(cfg config.APNsConfig) (*APNs, error) {
+	data, err := os.ReadFile(cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("notify: apns key: %w", err)
+	}
+	parsed, err := parsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("notify: apns key: %w", err)
+	}
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("notify: apns key isn't an EC key")
+	}
+	if cfg.KeyID == "" || cfg.TeamID == "" || cfg.Topic == "" {
+		return nil, fmt.Errorf("notify: apns needs a key_id, team_id and topic")
+	}
+
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = "https://api.sandbox.push.apple.com"
+		if cfg.Production {
+			baseURL = "https://api.push.apple.com"
+		}
+	}
+	return &APNs{
+		keyID:   cfg.KeyID,
+		teamID:  cfg.TeamID,
+		topic:   cfg.Topic,
+		key:     key,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (a *APNs) Push(ctx context.Context, device *Device, msg Message) error {
+	token, err := a.providerToken()
+	if err != nil {
+		return err
+	}
+	payload := map[string]interface{}{
+		"aps": map[string]interface{}{
+			"alert": map[string]string{"title": msg.Title, "body": msg.Body},
+			"sound": "default",
+		},
+	}
+	for key, value := range pushPayload(msg) {
+		if key != "aps" {
+			payload[key] = value
+		}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.baseURL+"/3/device/"+url.PathEscape(device.Token), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "bearer "+token)
+	req.Header.Set("apns-topic", a.topic)
+	req.Header.Set("apns-push-type", "alert")
+	req.Header.Set("apns-priority", "10")
+	req.Header.Set("Content-Type", "application/json")
+
+	status, data, err := send(a.client, req, "apns")
+	if err != nil {
+		return err
+	}
+	if status >= 200 && status < 300 {
+		return nil
+	}
+	var resp struct {
+		Reason string `json:"reason"`
+	}
+	json.Unmarshal(data, &resp)
+	switch {
+	case status == http.StatusGone, resp.Reason == "BadDeviceToken", resp.Reason == "Unregistered":
+		return ErrInvalidDevice
+	}
+	return failed("apns", status, resp.Reason)
+}
+
+// providerToken returns the signed JWT requests are authorized with,
+// signing another when it's due
+func (a *APNs) providerToken() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token != "" && time.Since(a.issued) < apnsTokenTTL {
+		return a.token, nil
+	}
+	now := time.Now()
+	t := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{"iss": a.teamID, "iat": now.Unix()})
+	t.Header["kid"] = a.keyID
+	token, err := t.SignedString(a.key)
+	if err != nil {
+		return "", err
+	}
+	a.token, a.issued = token, now
+	return token, nil
+}
+
+// parsePrivateKey parses a PEM encoded PKCS #8 private key
+func parsePrivateKey(data []byte) (interface{}, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM encoded key found")
+	}
+	return x509.ParsePKCS8PrivateKey(block.Bytes)
+}
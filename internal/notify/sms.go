@@ -0,0 +1,280 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+// smsFromConfig returns the SMS driver of cfg.Driver
+func smsFromConfig(cfg config.SMSConfig, logger *zap.Logger) (SMSSender, error) {
+	switch cfg.Driver {
+	case "", "log":
+		return NewLogSMS(logger), nil
+	case "twilio":
+		if cfg.Twilio.AccountSID == "" || cfg.Twilio.AuthToken == "" {
+			return nil, fmt.Errorf("notify: twilio needs an account_sid and auth_token")
+		}
+		return NewTwilio(cfg.Twilio, cfg.From), nil
+	case "africastalking":
+		if cfg.AfricasTalking.Username == "" || cfg.AfricasTalking.APIKey == "" {
+			return nil, fmt.Errorf("notify: africastalking needs a username and api_key")
+		}
+		return NewAfricasTalking(cfg.AfricasTalking, cfg.From), nil
+	case "vonage":
+		if cfg.Vonage.APIKey == "" || cfg.Vonage.APISecret == "" {
+			return nil, fmt.Errorf("notify: vonage needs an api_key and api_secret")
+		}
+		return NewVonage(cfg.Vonage, cfg.From), nil
+	default:
+		return nil, fmt.Errorf("notify: unknown sms driver %q", cfg.Driver)
+	}
+}
+
+// LogSMS logs text messages instead of sending them, for development
+type LogSMS struct {
+	logger *zap.Logger
+}
+
+// NewLogSMS returns a driver logging to logger
+func NewLogSMS(logger *zap.Logger) *LogSMS {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &LogSMS{logger: logger}
+}
+
+func (l *LogSMS) SendSMS(ctx context.Context, to, text string) error {
+	l.logger.Info("SMS", zap.String("to", to), zap.String("text", text))
+	return nil
+}
+
+// Twilio sends text messages through Twilio's Messaging API
+type Twilio struct {
+	accountSID string
+	authToken  string
+	serviceSID string
+	from       string
+	baseURL    string
+	client     *http.Client
+}
+
+// NewTwilio returns a driver sending from from, or the config's messaging
+// service
+func NewTwilio(cfg config.TwilioConfig, from string) *Twilio {
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = "https://api.twilio.com"
+	}
+	return &Twilio{
+		accountSID: cfg.AccountSID,
+		authToken:  cfg.AuthToken,
+		serviceSID: cfg.MessagingServiceSID,
+		from:       from,
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		client:     &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (t *Twilio) SendSMS(ctx context.Context, to, text string) error {
+	form := url.Values{"To": {to}, "Body": {text}}
+	if t.serviceSID != "" {
+		form.Set("MessagingServiceSid", t.serviceSID)
+	} else {
+		form.Set("From", t.from)
+	}
+	req, err := newFormRequest(ctx, t.baseURL+"/2010-04-01/Accounts/"+url.PathEscape(t.accountSID)+"/Messages.json", form)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(t.accountSID, t.authToken)
+
+	status, data, err := send(t.client, req, "twilio")
+	if err != nil {
+		return err
+	}
+	if status >= 200 && status < 300 {
+		return nil
+	}
+	var body struct {
+		Message string `json:"message"`
+	}
+	json.Unmarshal(data, &body)
+	return failed("twilio", status, body.Message)
+}
+
+// AfricasTalking sends text messages through Africa's Talking
+type AfricasTalking struct {
+	username string
+	apiKey   string
+	from     string
+	baseURL  string
+	client   *http.Client
+}
+
+// NewAfricasTalking returns a driver sending from from, a short code or
+// sender ID, or Africa's Talking's own when empty. The sandbox username
+// sends to the sandbox.
+func NewAfricasTalking(cfg config.AfricasTalkingConfig, from string) *AfricasTalking {
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = "https://api.africastalking.com"
+		if cfg.Username == "sandbox" {
+			baseURL = "https://api.sandbox.africastalking.com"
+		}
+	}
+	return &AfricasTalking{
+		username: cfg.Username,
+		apiKey:   cfg.APIKey,
+		from:     from,
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (a *AfricasTalking) SendSMS(ctx context.Context, to, text string) error {
+	form := url.Values{"username": {a.username}, "to": {to}, "message": {text}}
+	if a.from != "" {
+		form.Set("from", a.from)
+	}
+	req, err := newFormRequest(ctx, a.baseURL+"/version1/messaging", form)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("apiKey", a.apiKey)
+
+	status, data, err := send(a.client, req, "africastalking")
+	if err != nil {
+		return err
+	}
+	if status < 200 || status >= 300 {
+		// Errors come as plain text
+		return failed("africastalking", status, strings.TrimSpace(string(data)))
+	}
+	var body struct {
+		SMSMessageData struct {
+			Message    string `json:"Message"`
+			Recipients []struct {
+				StatusCode int    `json:"statusCode"`
+				Status     string `json:"status"`
+			} `json:"Recipients"`
+		} `json:"SMSMessageData"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return fmt.Errorf("notify: africastalking: %w", err)
+	}
+	recipients := body.SMSMessageData.Recipients
+	if len(recipients) == 0 {
+		return fmt.Errorf("notify: africastalking sent nothing: %s", body.SMSMessageData.Message)
+	}
+	// 100 to 102 are processed, sent and queued
+	if code := recipients[0].StatusCode; code < 100 || code > 102 {
+		return fmt.Errorf("notify: africastalking failed with %d: %s", code, recipients[0].Status)
+	}
+	return nil
+}
+
+// Vonage sends text messages through Vonage's SMS API
+type Vonage struct {
+	apiKey    string
+	apiSecret string
+	from      string
+	baseURL   string
+	client    *http.Client
+}
+
+// NewVonage returns a driver sending from from
+func NewVonage(cfg config.VonageConfig, from string) *Vonage {
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = "https://rest.nexmo.com"
+	}
+	return &Vonage{
+		apiKey:    cfg.APIKey,
+		apiSecret: cfg.APISecret,
+		from:      from,
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (v *Vonage) SendSMS(ctx context.Context, to, text string) error {
+	form := url.Values{
+		"api_key":    {v.apiKey},
+		"api_secret": {v.apiSecret},
+		"from":       {v.from},
+		// Vonage takes numbers without the +
+		"to":   {strings.TrimPrefix(to, "+")},
+		"text": {text},
+	}
+	req, err := newFormRequest(ctx, v.baseURL+"/sms/json", form)
+	if err != nil {
+		return err
+	}
+
+	status, data, err := send(v.client, req, "vonage")
+	if err != nil {
+		return err
+	}
+	if status < 200 || status >= 300 {
+		return failed("vonage", status, "")
+	}
+	// Vonage answers 200 with a status per message part, 0 when sent
+	var body struct {
+		Messages []struct {
+			Status    string `json:"status"`
+			ErrorText string `json:"error-text"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return fmt.Errorf("notify: vonage: %w", err)
+	}
+	for _, message := range body.Messages {
+		if message.Status != "0" {
+			return fmt.Errorf("notify: vonage failed with status %s: %s", message.Status, message.ErrorText)
+		}
+	}
+	return nil
+}
+
+// newFormRequest returns a POST request sending form
+func newFormRequest(ctx context.Context, endpoint string, form url.Values) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	return req, nil
+}
+
+// send sends req, returning the status and body of the response
+func send(client *http.Client, req *http.Request, driver string) (int, []byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("notify: %s: %w", driver, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return 0, nil, fmt.Errorf("notify: %s: %w", driver, err)
+	}
+	return resp.StatusCode, data, nil
+}
+
+// failed returns the error of a driver's error status
+func failed(driver string, status int, message string) error {
+	if message == "" {
+		message = http.StatusText(status)
+	}
+	return fmt.Errorf("notify: %s failed with %d: %s", driver, status, message)
+}
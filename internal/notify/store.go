@@ -0,0 +1,117 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Preference is whether a user gets notifications through a channel, in
+// the notification_preferences table. Channels without one are enabled.
+type Preference struct {
+	UserID    string `gorm:"primaryKey;size:64"`
+	Channel   string `gorm:"primaryKey;size:32"`
+	Enabled   bool
+	UpdatedAt time.Time
+}
+
+func (Preference) TableName() string { return "notification_preferences" }
+
+// Device is a device a user gets push notifications on, in the
+// push_devices table
+type Device struct {
+	ID     uint   `json:"id" gorm:"primaryKey"`
+	UserID string `json:"user_id" gorm:"size:64;index"`
+
+	// Platform is fcm, apns or webpush
+	Platform string `json:"platform" gorm:"size:16"`
+
+	// Token is the FCM or APNs device token, or the Web Push subscription
+	// endpoint
+	Token string `json:"token" gorm:"type:text"`
+
+	// P256dh and Auth are the keys of a Web Push subscription
+	P256dh string `json:"p256dh,omitempty" gorm:"size:128"`
+	Auth   string `json:"auth,omitempty" gorm:"size:64"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (Device) TableName() string { return "push_devices" }
+
+// Store saves users' channel preferences and push devices
+type Store struct {
+	db *gorm.DB
+}
+
+// NewStore creates a store, creating its tables if needed
+func NewStore(db *gorm.DB) (*Store, error) {
+	if err := db.AutoMigrate(&Preference{}, &Device{}); err != nil {
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// Enabled reports whether a user gets notifications through a channel
+func (s *Store) Enabled(ctx context.Context, userID, channel string) (bool, error) {
+	var pref Preference
+	err := s.db.WithContext(ctx).Where("user_id = ? AND channel = ?", userID, channel).Take(&pref).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return pref.Enabled, nil
+}
+
+// SetEnabled turns a channel on or off for a user
+func (s *Store) SetEnabled(ctx context.Context, userID, channel string, enabled bool) error {
+	pref := Preference{UserID: userID, Channel: channel, Enabled: enabled}
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(&pref).Error
+}
+
+// Preferences returns the channels a user has turned on or off
+func (s *Store) Preferences(ctx context.Context, userID string) (map[string]bool, error) {
+	var prefs []Preference
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).Find(&prefs).Error; err != nil {
+		return nil, err
+	}
+	channels := make(map[string]bool, len(prefs))
+	for _, pref := range prefs {
+		channels[pref.Channel] = pref.Enabled
+	}
+	return channels, nil
+}
+
+// RegisterDevice saves a device for its user. A token already registered
+// moves to the user, as when someone else signs in on the device.
+func (s *Store) RegisterDevice(ctx context.Context, device *Device) error {
+	var existing Device
+	err := s.db.WithContext(ctx).Where("token = ?", device.Token).Take(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return s.db.WithContext(ctx).Create(device).Error
+	}
+	if err != nil {
+		return err
+	}
+	device.ID = existing.ID
+	device.CreatedAt = existing.CreatedAt
+	return s.db.WithContext(ctx).Save(device).Error
+}
+
+// Devices returns a user's devices
+func (s *Store) Devices(ctx context.Context, userID string) ([]Device, error) {
+	var devices []Device
+	err := s.db.WithContext(ctx).Where("user_id = ?", userID).Order("id").Find(&devices).Error
+	return devices, err
+}
+
+// RemoveDevice removes the device with a token
+func (s *Store) RemoveDevice(ctx context.Context, token string) error {
+	return s.db.WithContext(ctx).Where("token = ?", token).Delete(&Device{}).Error
+}
@@ -0,0 +1,249 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+const (
+	// webPushRecordSize is the record size of encrypted messages; the
+	// whole message fits in one record
+	webPushRecordSize = 4096
+
+	// webPushMaxPayload is the most plaintext one record holds, less its
+	// padding delimiter and authentication tag
+	webPushMaxPayload = webPushRecordSize - 17
+
+	// vapidTTL is how long the VAPID JWT of a request is valid
+	vapidTTL = 12 * time.Hour
+)
+
+// WebPush sends push notifications to browsers, signing requests with a
+// VAPID key pair and encrypting messages as RFC 8291 describes
+type WebPush struct {
+	key       *ecdsa.PrivateKey
+	publicKey string
+	subject   string
+	ttl       time.Duration
+	client    *http.Client
+}
+
+// NewWebPush returns a sender signing with the config's VAPID keys
+func NewWebPush(cfg config.WebPushConfig) (*WebPush, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cfg.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("notify: vapid_private_key: %w", err)
+	}
+	key, err := ecdsa.ParseRawPrivateKey(elliptic.P256(), raw)
+	if err != nil {
+		return nil, fmt.Errorf("notify: vapid_private_key: %w", err)
+	}
+	ecdhKey, err := key.ECDH()
+	if err != nil {
+		return nil, fmt.Errorf("notify: vapid_private_key: %w", err)
+	}
+	publicKey := base64.RawURLEncoding.EncodeToString(ecdhKey.PublicKey().Bytes())
+	if cfg.PublicKey != "" && cfg.PublicKey != publicKey {
+		return nil, fmt.Errorf("notify: vapid_public_key doesn't match vapid_private_key")
+	}
+	if cfg.Subject == "" {
+		return nil, fmt.Errorf("notify: webpush needs a subject, a mailto: or https: URL")
+	}
+	ttl := cfg.TTL
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	return &WebPush{
+		key:       key,
+		publicKey: publicKey,
+		subject:   cfg.Subject,
+		ttl:       ttl,
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// PublicKey returns the VAPID public key browsers subscribe with, as the
+// applicationServerKey of pushManager.subscribe
+func (p *WebPush) PublicKey() string {
+	return p.publicKey
+}
+
+func (p *WebPush) Push(ctx context.Context, device *Device, msg Message) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"title": msg.Title,
+		"body":  msg.Body,
+		"url":   msg.URL,
+		"data":  msg.Data,
+	})
+	if err != nil {
+		return err
+	}
+	body, err := encryptWebPush(payload, device.P256dh, device.Auth)
+	if err != nil {
+		return err
+	}
+	authorization, err := p.vapid(device.Token)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, device.Token, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", strconv.Itoa(int(p.ttl/time.Second)))
+	req.Header.Set("Urgency", "normal")
+
+	status, data, err := send(p.client, req, "webpush")
+	if err != nil {
+		return err
+	}
+	switch {
+	case status >= 200 && status < 300:
+		return nil
+	case status == http.StatusNotFound || status == http.StatusGone:
+		return ErrInvalidDevice
+	}
+	return failed("webpush", status, string(bytes.TrimSpace(data)))
+}
+
+// vapid returns the Authorization header of a request to endpoint: a JWT
+// for the push service's origin and the key verifying it
+func (p *WebPush) vapid(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("notify: invalid webpush endpoint %q", endpoint)
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": time.Now().Add(vapidTTL).Unix(),
+		"sub": p.subject,
+	}).SignedString(p.key)
+	if err != nil {
+		return "", err
+	}
+	return "vapid t=" + token + ", k=" + p.publicKey, nil
+}
+
+// GenerateVAPIDKeys returns a new VAPID key pair, URL-safe base64 encoded
+// as the webpush config takes them
+func GenerateVAPIDKeys() (publicKey, privateKey string, err error) {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes()),
+		base64.RawURLEncoding.EncodeToString(key.Bytes()), nil
+}
+
+// encryptWebPush encrypts payload for a subscription's p256dh and auth
+// keys with the aes128gcm content encoding (RFC 8188, RFC 8291)
+func encryptWebPush(payload []byte, p256dh, auth string) ([]byte, error) {
+	if len(payload) > webPushMaxPayload {
+		return nil, fmt.Errorf("notify: webpush message is %d bytes, over %d", len(payload), webPushMaxPayload)
+	}
+	uaRaw, err := decodeKey(p256dh)
+	if err != nil {
+		return nil, fmt.Errorf("notify: invalid p256dh key: %w", err)
+	}
+	uaPublic, err := ecdh.P256().NewPublicKey(uaRaw)
+	if err != nil {
+		return nil, fmt.Errorf("notify: invalid p256dh key: %w", err)
+	}
+	authSecret, err := decodeKey(auth)
+	if err != nil || len(authSecret) != 16 {
+		return nil, fmt.Errorf("notify: invalid auth secret")
+	}
+
+	// A key pair for this message only
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := asPrivate.PublicKey().Bytes()
+	sharedSecret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	cek, nonce, err := webPushKeys(sharedSecret, authSecret, salt, uaRaw, asPublic)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// The header: salt, record size, and the sender's public key
+	header := make([]byte, 0, 21+len(asPublic))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, webPushRecordSize)
+	header = append(header, byte(len(asPublic)))
+	header = append(header, asPublic...)
+
+	// 0x02 marks the last record
+	plaintext := append(append([]byte{}, payload...), 0x02)
+	return gcm.Seal(header, nonce, plaintext, nil), nil
+}
+
+// webPushKeys derives the content encryption key and nonce of a message
+func webPushKeys(sharedSecret, authSecret, salt, uaPublic, asPublic []byte) (cek, nonce []byte, err error) {
+	prkKey, err := hkdf.Extract(sha256.New, sharedSecret, authSecret)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyInfo := "WebPush: info\x00" + string(uaPublic) + string(asPublic)
+	ikm, err := hkdf.Expand(sha256.New, prkKey, keyInfo, 32)
+	if err != nil {
+		return nil, nil, err
+	}
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cek, err = hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16); err != nil {
+		return nil, nil, err
+	}
+	if nonce, err = hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12); err != nil {
+		return nil, nil, err
+	}
+	return cek, nonce, nil
+}
+
+// decodeKey decodes a subscription key, which browsers send URL-safe base64
+// encoded, with or without padding
+func decodeKey(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
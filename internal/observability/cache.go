@@ -0,0 +1,145 @@
+package observability
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/mrhoseah/dolphin/internal/cache"
+)
+
+// InstrumentCache wraps a cache so its hits, misses and operations are
+// recorded under name. Keys are labelled by their prefix up to the first
+// colon, e.g. "users" for "users:42".
+func (mc *MetricsCollector) InstrumentCache(name string, c cache.Cache) cache.Cache {
+	return &instrumentedCache{Cache: c, mc: mc, name: name}
+}
+
+type instrumentedCache struct {
+	cache.Cache
+	mc   *MetricsCollector
+	name string
+}
+
+func (c *instrumentedCache) Get(ctx context.Context, key string) (string, error) {
+	value, err := c.Cache.Get(ctx, key)
+	// The cache drivers report a missing or expired key as an error
+	if err != nil {
+		c.mc.RecordCacheMiss(c.name, keyPattern(key))
+		c.mc.RecordCacheOperation(c.name, "get", keyPattern(key), "miss")
+		return value, err
+	}
+	c.mc.RecordCacheHit(c.name, keyPattern(key))
+	c.mc.RecordCacheOperation(c.name, "get", keyPattern(key), "hit")
+	return value, nil
+}
+
+func (c *instrumentedCache) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	err := c.Cache.Set(ctx, key, value, expiration)
+	c.mc.RecordCacheOperation(c.name, "set", keyPattern(key), operationStatus(err))
+	return err
+}
+
+func (c *instrumentedCache) Delete(ctx context.Context, key string) error {
+	err := c.Cache.Delete(ctx, key)
+	c.mc.RecordCacheOperation(c.name, "delete", keyPattern(key), operationStatus(err))
+	return err
+}
+
+func (c *instrumentedCache) Exists(ctx context.Context, key string) (bool, error) {
+	exists, err := c.Cache.Exists(ctx, key)
+	c.mc.RecordCacheOperation(c.name, "exists", keyPattern(key), operationStatus(err))
+	return exists, err
+}
+
+func (c *instrumentedCache) Flush(ctx context.Context) error {
+	err := c.Cache.Flush(ctx)
+	c.mc.RecordCacheOperation(c.name, "flush", "*", operationStatus(err))
+	return err
+}
+
+// InstrumentCache wraps a cache so each operation gets a span named
+// cache.<operation> under the span in its context. Keys are recorded by
+// their prefix, as for metrics.
+func (tm *TracerManager) InstrumentCache(name string, c cache.Cache) cache.Cache {
+	return &tracedCache{Cache: c, tm: tm, name: name}
+}
+
+type tracedCache struct {
+	cache.Cache
+	tm   *TracerManager
+	name string
+}
+
+// start starts the span of an operation on keys matching pattern
+func (c *tracedCache) start(ctx context.Context, operation, pattern string) (context.Context, trace.Span) {
+	return c.tm.StartSpan(ctx, "cache."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("cache.name", c.name),
+			attribute.String("cache.operation", operation),
+			attribute.String("cache.key_pattern", pattern),
+		),
+	)
+}
+
+func (c *tracedCache) Get(ctx context.Context, key string) (string, error) {
+	ctx, span := c.start(ctx, "get", keyPattern(key))
+	defer span.End()
+	value, err := c.Cache.Get(ctx, key)
+	// A miss is reported as an error, but isn't one for the trace
+	span.SetAttributes(attribute.Bool("cache.hit", err == nil))
+	return value, err
+}
+
+func (c *tracedCache) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	ctx, span := c.start(ctx, "set", keyPattern(key))
+	defer span.End()
+	return recordCacheError(span, c.Cache.Set(ctx, key, value, expiration))
+}
+
+func (c *tracedCache) Delete(ctx context.Context, key string) error {
+	ctx, span := c.start(ctx, "delete", keyPattern(key))
+	defer span.End()
+	return recordCacheError(span, c.Cache.Delete(ctx, key))
+}
+
+func (c *tracedCache) Exists(ctx context.Context, key string) (bool, error) {
+	ctx, span := c.start(ctx, "exists", keyPattern(key))
+	defer span.End()
+	exists, err := c.Cache.Exists(ctx, key)
+	return exists, recordCacheError(span, err)
+}
+
+func (c *tracedCache) Flush(ctx context.Context) error {
+	ctx, span := c.start(ctx, "flush", "*")
+	defer span.End()
+	return recordCacheError(span, c.Cache.Flush(ctx))
+}
+
+// recordCacheError marks span failed by err, returning err
+func recordCacheError(span trace.Span, err error) error {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+func keyPattern(key string) string {
+	if i := strings.Index(key, ":"); i > 0 {
+		return key[:i]
+	}
+	return "*"
+}
+
+func operationStatus(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
@@ -0,0 +1,116 @@
+package observability
+
+import (
+	"net/http"
+	"sort"
+
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/zap"
+)
+
+// OtherLabelValue is recorded in place of label values an allowlist
+// doesn't name, and for request methods outside the standard ones
+const OtherLabelValue = "other"
+
+// standardMethods are the request methods recorded as they are
+var standardMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true,
+	http.MethodPut: true, http.MethodPatch: true, http.MethodDelete: true,
+	http.MethodConnect: true, http.MethodOptions: true, http.MethodTrace: true,
+}
+
+// requestMethod labels a request with its method, folding made up methods
+// into one series
+func requestMethod(r *http.Request) string {
+	if standardMethods[r.Method] {
+		return r.Method
+	}
+	return OtherLabelValue
+}
+
+// newLabelAllowlist indexes the values each label may take
+func newLabelAllowlist(allowed map[string][]string) map[string]map[string]bool {
+	allowlist := make(map[string]map[string]bool, len(allowed))
+	for label, values := range allowed {
+		allowlist[label] = make(map[string]bool, len(values))
+		for _, value := range values {
+			allowlist[label][value] = true
+		}
+	}
+	return allowlist
+}
+
+// LabelValue returns value as the collector records it for label: value
+// itself, unless the config's LabelAllowlist lists the values label may
+// take and value isn't among them, when it is OtherLabelValue. Custom
+// metrics whose labels come from requests or users can pass them through
+// it too.
+func (mc *MetricsCollector) LabelValue(label, value string) string {
+	if allowed, ok := mc.allowlist[label]; ok && !allowed[value] {
+		return OtherLabelValue
+	}
+	return value
+}
+
+// checkCardinality counts the series of each metric and warns, once until
+// it drops back, about those with more than the config's MaxSeries,
+// naming the label with the most values as the likely cause
+func (mc *MetricsCollector) checkCardinality() {
+	if mc.config.MaxSeries <= 0 {
+		return
+	}
+	families, err := mc.registry.Gather()
+	if err != nil {
+		mc.logger.Warn("Failed to gather metrics", zap.Error(err))
+	}
+
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	over := make(map[string]bool)
+	for _, mf := range families {
+		name := mf.GetName()
+		series := len(mf.GetMetric())
+		if series <= mc.config.MaxSeries {
+			continue
+		}
+		over[name] = true
+		if mc.overSeries[name] {
+			continue
+		}
+		label, values := widestLabel(mf)
+		mc.logger.Warn("Metric has more series than expected; check its labels for unbounded values such as IDs or raw paths",
+			zap.String("metric", name),
+			zap.Int("series", series),
+			zap.Int("max_series", mc.config.MaxSeries),
+			zap.String("label", label),
+			zap.Int("label_values", values))
+	}
+	mc.overSeries = over
+}
+
+// widestLabel returns the label of a family's series with the most
+// distinct values, and how many it has
+func widestLabel(mf *dto.MetricFamily) (string, int) {
+	values := make(map[string]map[string]bool)
+	for _, m := range mf.GetMetric() {
+		for _, pair := range m.GetLabel() {
+			if values[pair.GetName()] == nil {
+				values[pair.GetName()] = make(map[string]bool)
+			}
+			values[pair.GetName()][pair.GetValue()] = true
+		}
+	}
+	labels := make([]string, 0, len(values))
+	for label := range values {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	widest, count := "", 0
+	for _, label := range labels {
+		if n := len(values[label]); n > count {
+			widest, count = label, n
+		}
+	}
+	return widest, count
+}
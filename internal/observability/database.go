@@ -0,0 +1,201 @@
+package observability
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const (
+	metricsStartKey = "dolphin:metrics_start"
+	tracingSpanKey  = "dolphin:tracing_span"
+	tracingCtxKey   = "dolphin:tracing_parent"
+)
+
+// registerCallbacks registers before and after around each of GORM's
+// callback chains, named with prefix and told which operation they wrap
+func registerCallbacks(db *gorm.DB, prefix string, before, after func(db *gorm.DB, operation string)) error {
+	cb := db.Callback()
+	chains := map[string]func(b, a func(*gorm.DB)) error{
+		"create": func(b, a func(*gorm.DB)) error {
+			if err := cb.Create().Before("gorm:create").Register(prefix+"_before_create", b); err != nil {
+				return err
+			}
+			return cb.Create().After("gorm:create").Register(prefix+"_after_create", a)
+		},
+		"query": func(b, a func(*gorm.DB)) error {
+			if err := cb.Query().Before("gorm:query").Register(prefix+"_before_query", b); err != nil {
+				return err
+			}
+			return cb.Query().After("gorm:query").Register(prefix+"_after_query", a)
+		},
+		"update": func(b, a func(*gorm.DB)) error {
+			if err := cb.Update().Before("gorm:update").Register(prefix+"_before_update", b); err != nil {
+				return err
+			}
+			return cb.Update().After("gorm:update").Register(prefix+"_after_update", a)
+		},
+		"delete": func(b, a func(*gorm.DB)) error {
+			if err := cb.Delete().Before("gorm:delete").Register(prefix+"_before_delete", b); err != nil {
+				return err
+			}
+			return cb.Delete().After("gorm:delete").Register(prefix+"_after_delete", a)
+		},
+		"row": func(b, a func(*gorm.DB)) error {
+			if err := cb.Row().Before("gorm:row").Register(prefix+"_before_row", b); err != nil {
+				return err
+			}
+			return cb.Row().After("gorm:row").Register(prefix+"_after_row", a)
+		},
+		"raw": func(b, a func(*gorm.DB)) error {
+			if err := cb.Raw().Before("gorm:raw").Register(prefix+"_before_raw", b); err != nil {
+				return err
+			}
+			return cb.Raw().After("gorm:raw").Register(prefix+"_after_raw", a)
+		},
+	}
+
+	for operation, register := range chains {
+		b := func(db *gorm.DB) { before(db, operation) }
+		a := func(db *gorm.DB) { after(db, operation) }
+		if err := register(b, a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// statementTable names the table a statement ran against
+func statementTable(db *gorm.DB) string {
+	if db.Statement.Table == "" {
+		return "none"
+	}
+	return db.Statement.Table
+}
+
+// statementError is the statement's error, except that a lookup finding
+// nothing is an answer, not a failed query
+func statementError(db *gorm.DB) error {
+	if errors.Is(db.Error, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	return db.Error
+}
+
+// InstrumentDB records the duration and errors of every statement run
+// through db, labelled by operation and table, and samples its connection
+// pool into the database connection gauges
+func (mc *MetricsCollector) InstrumentDB(db *gorm.DB) error {
+	if err := db.Use(&dbMetrics{mc: mc}); err != nil {
+		return err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	mc.mu.Lock()
+	mc.sqlDB = sqlDB
+	mc.mu.Unlock()
+	return nil
+}
+
+// dbMetrics is the GORM plugin behind MetricsCollector.InstrumentDB
+type dbMetrics struct {
+	mc *MetricsCollector
+}
+
+var _ gorm.Plugin = (*dbMetrics)(nil)
+
+// Name implements gorm.Plugin
+func (p *dbMetrics) Name() string {
+	return "dolphin:metrics"
+}
+
+// Initialize implements gorm.Plugin by timing every callback chain
+func (p *dbMetrics) Initialize(db *gorm.DB) error {
+	return registerCallbacks(db, "dolphin:metrics", p.before, p.after)
+}
+
+func (p *dbMetrics) before(db *gorm.DB, operation string) {
+	db.InstanceSet(metricsStartKey, time.Now())
+}
+
+func (p *dbMetrics) after(db *gorm.DB, operation string) {
+	value, ok := db.InstanceGet(metricsStartKey)
+	if !ok {
+		return
+	}
+	p.mc.RecordDatabaseQuery(operation, statementTable(db), time.Since(value.(time.Time)), statementError(db))
+}
+
+// InstrumentDB traces every statement run through db as a child of the
+// span in the statement's context, so use db.WithContext(r.Context()) in
+// handlers to see queries under their request
+func (tm *TracerManager) InstrumentDB(db *gorm.DB) error {
+	return db.Use(&dbTracing{tm: tm})
+}
+
+// dbTracing is the GORM plugin behind TracerManager.InstrumentDB
+type dbTracing struct {
+	tm *TracerManager
+}
+
+var _ gorm.Plugin = (*dbTracing)(nil)
+
+// Name implements gorm.Plugin
+func (p *dbTracing) Name() string {
+	return "dolphin:tracing"
+}
+
+// Initialize implements gorm.Plugin by wrapping every callback chain in a
+// span
+func (p *dbTracing) Initialize(db *gorm.DB) error {
+	return registerCallbacks(db, "dolphin:tracing", p.before, p.after)
+}
+
+func (p *dbTracing) before(db *gorm.DB, operation string) {
+	parent := db.Statement.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, span := p.tm.StartSpan(parent, operation+" "+statementTable(db),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemKey.String(db.Dialector.Name()),
+			semconv.DBOperationKey.String(operation),
+			semconv.DBSQLTableKey.String(statementTable(db)),
+		),
+	)
+	db.Statement.Context = ctx
+	db.InstanceSet(tracingSpanKey, span)
+	db.InstanceSet(tracingCtxKey, parent)
+}
+
+func (p *dbTracing) after(db *gorm.DB, operation string) {
+	value, ok := db.InstanceGet(tracingSpanKey)
+	if !ok {
+		return
+	}
+	span := value.(trace.Span)
+	if parent, ok := db.InstanceGet(tracingCtxKey); ok {
+		db.Statement.Context = parent.(context.Context)
+	}
+
+	// The SQL keeps its placeholders so bound values stay out of traces
+	span.SetAttributes(
+		semconv.DBStatementKey.String(db.Statement.SQL.String()),
+		attribute.Int64("db.rows_affected", db.RowsAffected),
+	)
+	if err := statementError(db); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -172,8 +172,8 @@ func (om *ObservabilityManager) Stop(ctx context.Context) error {
 	}
 
 	// Stop tracing provider
-	if om.tracing != nil && om.tracing.provider != nil {
-		if err := om.tracing.provider.Shutdown(ctx); err != nil {
+	if om.tracing != nil {
+		if err := om.tracing.Shutdown(ctx); err != nil {
 			om.logger.Error("Failed to shutdown tracer provider", zap.Error(err))
 		}
 	}
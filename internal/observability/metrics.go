@@ -1,18 +1,27 @@
 package observability
 
 import (
+	"database/sql"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"runtime"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
 	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/routing"
 )
 
 // MetricsCollector manages application metrics
@@ -25,7 +34,7 @@ type MetricsCollector struct {
 	httpActiveRequests  prometheus.Gauge
 
 	// Application metrics
-	appUptime          prometheus.Counter
+	appUptime          prometheus.CounterFunc
 	appMemoryUsage     prometheus.Gauge
 	appGoroutineCount  prometheus.Gauge
 	appGCPauseDuration *prometheus.HistogramVec
@@ -35,6 +44,7 @@ type MetricsCollector struct {
 	dbConnectionsIdle   prometheus.Gauge
 	dbQueryDuration     *prometheus.HistogramVec
 	dbQueryErrors       *prometheus.CounterVec
+	dbQueriesCanceled   *prometheus.CounterVec
 
 	// Cache metrics
 	cacheHits       *prometheus.CounterVec
@@ -54,9 +64,17 @@ type MetricsCollector struct {
 	customHistograms map[string]*prometheus.HistogramVec
 
 	// Internal state
-	startTime time.Time
-	mu        sync.RWMutex
-	logger    *zap.Logger
+	config     *MetricsConfig
+	allowlist  map[string]map[string]bool
+	overSeries map[string]bool
+	registry   *prometheus.Registry
+	factory    promauto.Factory
+	sqlDB      *sql.DB
+	startTime  time.Time
+	stop       chan struct{}
+	stopOnce   sync.Once
+	mu         sync.RWMutex
+	logger     *zap.Logger
 }
 
 // MetricsConfig represents metrics configuration
@@ -70,6 +88,15 @@ type MetricsConfig struct {
 	Buckets              []float64         `yaml:"buckets" json:"buckets"`
 	EnableGoMetrics      bool              `yaml:"enable_go_metrics" json:"enable_go_metrics"`
 	EnableProcessMetrics bool              `yaml:"enable_process_metrics" json:"enable_process_metrics"`
+
+	// LabelAllowlist lists, by label name, the values recorded as they
+	// are; others are recorded as OtherLabelValue
+	LabelAllowlist map[string][]string `yaml:"label_allowlist" json:"label_allowlist"`
+
+	// MaxSeries is how many series a metric may have before a warning is
+	// logged, checked every CardinalityInterval; 0 turns the check off
+	MaxSeries           int           `yaml:"max_series" json:"max_series"`
+	CardinalityInterval time.Duration `yaml:"cardinality_interval" json:"cardinality_interval"`
 }
 
 // DefaultMetricsConfig returns default metrics configuration
@@ -84,25 +111,51 @@ func DefaultMetricsConfig() *MetricsConfig {
 		Buckets:              prometheus.DefBuckets,
 		EnableGoMetrics:      true,
 		EnableProcessMetrics: true,
+		MaxSeries:            1000,
+		CardinalityInterval:  time.Minute,
 	}
 }
 
-// NewMetricsCollector creates a new metrics collector
+// NewMetricsCollector creates a new metrics collector. Each collector has
+// its own registry, served by GetMetricsHandler, so several can coexist in
+// one process.
 func NewMetricsCollector(config *MetricsConfig, logger *zap.Logger) *MetricsCollector {
 	if config == nil {
 		config = DefaultMetricsConfig()
 	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
 
 	mc := &MetricsCollector{
+		config:           config,
+		allowlist:        newLabelAllowlist(config.LabelAllowlist),
+		registry:         prometheus.NewRegistry(),
 		startTime:        time.Now(),
+		stop:             make(chan struct{}),
 		logger:           logger,
 		customCounters:   make(map[string]*prometheus.CounterVec),
 		customGauges:     make(map[string]*prometheus.GaugeVec),
 		customHistograms: make(map[string]*prometheus.HistogramVec),
 	}
 
+	// Constant labels from the config are attached to every metric
+	var registerer prometheus.Registerer = mc.registry
+	if len(config.Labels) > 0 {
+		registerer = prometheus.WrapRegistererWith(prometheus.Labels(config.Labels), registerer)
+	}
+	mc.factory = promauto.With(registerer)
+
+	// Go runtime and process metrics (go_*, process_*)
+	if config.EnableGoMetrics {
+		registerer.MustRegister(collectors.NewGoCollector())
+	}
+	if config.EnableProcessMetrics {
+		registerer.MustRegister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	}
+
 	// Initialize HTTP metrics
-	mc.httpRequestsTotal = promauto.NewCounterVec(
+	mc.httpRequestsTotal = mc.factory.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: config.Namespace,
 			Subsystem: config.Subsystem,
@@ -112,7 +165,7 @@ func NewMetricsCollector(config *MetricsConfig, logger *zap.Logger) *MetricsColl
 		[]string{"method", "path", "status_code", "handler"},
 	)
 
-	mc.httpRequestDuration = promauto.NewHistogramVec(
+	mc.httpRequestDuration = mc.factory.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Namespace: config.Namespace,
 			Subsystem: config.Subsystem,
@@ -123,7 +176,7 @@ func NewMetricsCollector(config *MetricsConfig, logger *zap.Logger) *MetricsColl
 		[]string{"method", "path", "status_code", "handler"},
 	)
 
-	mc.httpRequestSize = promauto.NewHistogramVec(
+	mc.httpRequestSize = mc.factory.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Namespace: config.Namespace,
 			Subsystem: config.Subsystem,
@@ -134,7 +187,7 @@ func NewMetricsCollector(config *MetricsConfig, logger *zap.Logger) *MetricsColl
 		[]string{"method", "path", "handler"},
 	)
 
-	mc.httpResponseSize = promauto.NewHistogramVec(
+	mc.httpResponseSize = mc.factory.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Namespace: config.Namespace,
 			Subsystem: config.Subsystem,
@@ -145,7 +198,7 @@ func NewMetricsCollector(config *MetricsConfig, logger *zap.Logger) *MetricsColl
 		[]string{"method", "path", "status_code", "handler"},
 	)
 
-	mc.httpActiveRequests = promauto.NewGauge(
+	mc.httpActiveRequests = mc.factory.NewGauge(
 		prometheus.GaugeOpts{
 			Namespace: config.Namespace,
 			Subsystem: config.Subsystem,
@@ -155,16 +208,17 @@ func NewMetricsCollector(config *MetricsConfig, logger *zap.Logger) *MetricsColl
 	)
 
 	// Initialize application metrics
-	mc.appUptime = promauto.NewCounter(
+	mc.appUptime = mc.factory.NewCounterFunc(
 		prometheus.CounterOpts{
 			Namespace: config.Namespace,
 			Subsystem: config.Subsystem,
 			Name:      "uptime_seconds_total",
 			Help:      "Application uptime in seconds",
 		},
+		func() float64 { return time.Since(mc.startTime).Seconds() },
 	)
 
-	mc.appMemoryUsage = promauto.NewGauge(
+	mc.appMemoryUsage = mc.factory.NewGauge(
 		prometheus.GaugeOpts{
 			Namespace: config.Namespace,
 			Subsystem: config.Subsystem,
@@ -173,7 +227,7 @@ func NewMetricsCollector(config *MetricsConfig, logger *zap.Logger) *MetricsColl
 		},
 	)
 
-	mc.appGoroutineCount = promauto.NewGauge(
+	mc.appGoroutineCount = mc.factory.NewGauge(
 		prometheus.GaugeOpts{
 			Namespace: config.Namespace,
 			Subsystem: config.Subsystem,
@@ -182,7 +236,7 @@ func NewMetricsCollector(config *MetricsConfig, logger *zap.Logger) *MetricsColl
 		},
 	)
 
-	mc.appGCPauseDuration = promauto.NewHistogramVec(
+	mc.appGCPauseDuration = mc.factory.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Namespace: config.Namespace,
 			Subsystem: config.Subsystem,
@@ -194,7 +248,7 @@ func NewMetricsCollector(config *MetricsConfig, logger *zap.Logger) *MetricsColl
 	)
 
 	// Initialize database metrics
-	mc.dbConnectionsActive = promauto.NewGauge(
+	mc.dbConnectionsActive = mc.factory.NewGauge(
 		prometheus.GaugeOpts{
 			Namespace: config.Namespace,
 			Subsystem: "database",
@@ -203,7 +257,7 @@ func NewMetricsCollector(config *MetricsConfig, logger *zap.Logger) *MetricsColl
 		},
 	)
 
-	mc.dbConnectionsIdle = promauto.NewGauge(
+	mc.dbConnectionsIdle = mc.factory.NewGauge(
 		prometheus.GaugeOpts{
 			Namespace: config.Namespace,
 			Subsystem: "database",
@@ -212,7 +266,7 @@ func NewMetricsCollector(config *MetricsConfig, logger *zap.Logger) *MetricsColl
 		},
 	)
 
-	mc.dbQueryDuration = promauto.NewHistogramVec(
+	mc.dbQueryDuration = mc.factory.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Namespace: config.Namespace,
 			Subsystem: "database",
@@ -223,7 +277,7 @@ func NewMetricsCollector(config *MetricsConfig, logger *zap.Logger) *MetricsColl
 		[]string{"operation", "table"},
 	)
 
-	mc.dbQueryErrors = promauto.NewCounterVec(
+	mc.dbQueryErrors = mc.factory.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: config.Namespace,
 			Subsystem: "database",
@@ -233,8 +287,18 @@ func NewMetricsCollector(config *MetricsConfig, logger *zap.Logger) *MetricsColl
 		[]string{"operation", "table", "error_type"},
 	)
 
+	mc.dbQueriesCanceled = mc.factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: config.Namespace,
+			Subsystem: "database",
+			Name:      "queries_canceled_total",
+			Help:      "Total number of database queries cut short by a timeout or a canceled request",
+		},
+		[]string{"operation", "table", "reason"},
+	)
+
 	// Initialize cache metrics
-	mc.cacheHits = promauto.NewCounterVec(
+	mc.cacheHits = mc.factory.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: config.Namespace,
 			Subsystem: "cache",
@@ -244,7 +308,7 @@ func NewMetricsCollector(config *MetricsConfig, logger *zap.Logger) *MetricsColl
 		[]string{"cache_name", "key_pattern"},
 	)
 
-	mc.cacheMisses = promauto.NewCounterVec(
+	mc.cacheMisses = mc.factory.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: config.Namespace,
 			Subsystem: "cache",
@@ -254,7 +318,7 @@ func NewMetricsCollector(config *MetricsConfig, logger *zap.Logger) *MetricsColl
 		[]string{"cache_name", "key_pattern"},
 	)
 
-	mc.cacheOperations = promauto.NewCounterVec(
+	mc.cacheOperations = mc.factory.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: config.Namespace,
 			Subsystem: "cache",
@@ -264,7 +328,7 @@ func NewMetricsCollector(config *MetricsConfig, logger *zap.Logger) *MetricsColl
 		[]string{"cache_name", "operation", "status"},
 	)
 
-	mc.cacheSize = promauto.NewGaugeVec(
+	mc.cacheSize = mc.factory.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: config.Namespace,
 			Subsystem: "cache",
@@ -275,7 +339,7 @@ func NewMetricsCollector(config *MetricsConfig, logger *zap.Logger) *MetricsColl
 	)
 
 	// Initialize business metrics
-	mc.businessEvents = promauto.NewCounterVec(
+	mc.businessEvents = mc.factory.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: config.Namespace,
 			Subsystem: "business",
@@ -285,7 +349,7 @@ func NewMetricsCollector(config *MetricsConfig, logger *zap.Logger) *MetricsColl
 		[]string{"event_type", "status"},
 	)
 
-	mc.userRegistrations = promauto.NewCounter(
+	mc.userRegistrations = mc.factory.NewCounter(
 		prometheus.CounterOpts{
 			Namespace: config.Namespace,
 			Subsystem: "business",
@@ -294,7 +358,7 @@ func NewMetricsCollector(config *MetricsConfig, logger *zap.Logger) *MetricsColl
 		},
 	)
 
-	mc.userLogins = promauto.NewCounter(
+	mc.userLogins = mc.factory.NewCounter(
 		prometheus.CounterOpts{
 			Namespace: config.Namespace,
 			Subsystem: "business",
@@ -303,7 +367,7 @@ func NewMetricsCollector(config *MetricsConfig, logger *zap.Logger) *MetricsColl
 		},
 	)
 
-	mc.apiCalls = promauto.NewCounterVec(
+	mc.apiCalls = mc.factory.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: config.Namespace,
 			Subsystem: "api",
@@ -341,7 +405,7 @@ func (mc *MetricsCollector) HTTPMetricsMiddleware(next http.Handler) http.Handle
 		handler := "unknown"
 		if h := r.Context().Value("handler"); h != nil {
 			if handlerName, ok := h.(string); ok {
-				handler = handlerName
+				handler = mc.LabelValue("handler", handlerName)
 			}
 		}
 
@@ -351,16 +415,30 @@ func (mc *MetricsCollector) HTTPMetricsMiddleware(next http.Handler) http.Handle
 		// Record metrics
 		duration := time.Since(start).Seconds()
 		statusCode := fmt.Sprintf("%d", wrapped.statusCode)
+		method := requestMethod(r)
+		path := mc.LabelValue("path", routePath(r))
 
-		mc.httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path, statusCode, handler).Inc()
-		mc.httpRequestDuration.WithLabelValues(r.Method, r.URL.Path, statusCode, handler).Observe(duration)
-		mc.httpRequestSize.WithLabelValues(r.Method, r.URL.Path, handler).Observe(float64(requestSize))
-		mc.httpResponseSize.WithLabelValues(r.Method, r.URL.Path, statusCode, handler).Observe(float64(wrapped.size))
+		mc.httpRequestsTotal.WithLabelValues(method, path, statusCode, handler).Inc()
+		mc.httpRequestDuration.WithLabelValues(method, path, statusCode, handler).Observe(duration)
+		mc.httpRequestSize.WithLabelValues(method, path, handler).Observe(float64(requestSize))
+		mc.httpResponseSize.WithLabelValues(method, path, statusCode, handler).Observe(float64(wrapped.size))
 	})
 }
 
+// routePath labels a request with its route pattern, e.g.
+// /api/v1/users/{id}, chi's or http.ServeMux's, so IDs in URLs don't
+// create a series per request. Requests no route matched share one label;
+// the raw path is never used.
+func routePath(r *http.Request) string {
+	if pattern := routing.Pattern(r); pattern != "" {
+		return pattern
+	}
+	return "unmatched"
+}
+
 // RecordDatabaseQuery records database query metrics
 func (mc *MetricsCollector) RecordDatabaseQuery(operation, table string, duration time.Duration, err error) {
+	operation, table = mc.LabelValue("operation", operation), mc.LabelValue("table", table)
 	mc.dbQueryDuration.WithLabelValues(operation, table).Observe(duration.Seconds())
 
 	if err != nil {
@@ -372,24 +450,30 @@ func (mc *MetricsCollector) RecordDatabaseQuery(operation, table string, duratio
 	}
 }
 
+// RecordQueryCanceled counts a database query cut short; reason is timeout
+// or canceled
+func (mc *MetricsCollector) RecordQueryCanceled(operation, table, reason string) {
+	mc.dbQueriesCanceled.WithLabelValues(mc.LabelValue("operation", operation), mc.LabelValue("table", table), reason).Inc()
+}
+
 // RecordCacheOperation records cache operation metrics
 func (mc *MetricsCollector) RecordCacheOperation(cacheName, operation, keyPattern, status string) {
-	mc.cacheOperations.WithLabelValues(cacheName, operation, status).Inc()
+	mc.cacheOperations.WithLabelValues(mc.LabelValue("cache_name", cacheName), operation, status).Inc()
 }
 
 // RecordCacheHit records a cache hit
 func (mc *MetricsCollector) RecordCacheHit(cacheName, keyPattern string) {
-	mc.cacheHits.WithLabelValues(cacheName, keyPattern).Inc()
+	mc.cacheHits.WithLabelValues(mc.LabelValue("cache_name", cacheName), mc.LabelValue("key_pattern", keyPattern)).Inc()
 }
 
 // RecordCacheMiss records a cache miss
 func (mc *MetricsCollector) RecordCacheMiss(cacheName, keyPattern string) {
-	mc.cacheMisses.WithLabelValues(cacheName, keyPattern).Inc()
+	mc.cacheMisses.WithLabelValues(mc.LabelValue("cache_name", cacheName), mc.LabelValue("key_pattern", keyPattern)).Inc()
 }
 
 // RecordBusinessEvent records a business event
 func (mc *MetricsCollector) RecordBusinessEvent(eventType, status string) {
-	mc.businessEvents.WithLabelValues(eventType, status).Inc()
+	mc.businessEvents.WithLabelValues(mc.LabelValue("event_type", eventType), mc.LabelValue("status", status)).Inc()
 }
 
 // RecordUserRegistration records a user registration
@@ -404,7 +488,7 @@ func (mc *MetricsCollector) RecordUserLogin() {
 
 // RecordAPICall records an API call
 func (mc *MetricsCollector) RecordAPICall(endpoint, method, status string) {
-	mc.apiCalls.WithLabelValues(endpoint, method, status).Inc()
+	mc.apiCalls.WithLabelValues(mc.LabelValue("endpoint", endpoint), mc.LabelValue("method", method), mc.LabelValue("status", status)).Inc()
 }
 
 // SetDatabaseConnections sets database connection metrics
@@ -415,7 +499,7 @@ func (mc *MetricsCollector) SetDatabaseConnections(active, idle int) {
 
 // SetCacheSize sets cache size metric
 func (mc *MetricsCollector) SetCacheSize(cacheName string, size int64) {
-	mc.cacheSize.WithLabelValues(cacheName).Set(float64(size))
+	mc.cacheSize.WithLabelValues(mc.LabelValue("cache_name", cacheName)).Set(float64(size))
 }
 
 // CreateCustomCounter creates a custom counter metric
@@ -427,9 +511,9 @@ func (mc *MetricsCollector) CreateCustomCounter(name, help string, labels []stri
 		return counter
 	}
 
-	counter := promauto.NewCounterVec(
+	counter := mc.factory.NewCounterVec(
 		prometheus.CounterOpts{
-			Namespace: "dolphin",
+			Namespace: mc.config.Namespace,
 			Subsystem: "custom",
 			Name:      name,
 			Help:      help,
@@ -450,9 +534,9 @@ func (mc *MetricsCollector) CreateCustomGauge(name, help string, labels []string
 		return gauge
 	}
 
-	gauge := promauto.NewGaugeVec(
+	gauge := mc.factory.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Namespace: "dolphin",
+			Namespace: mc.config.Namespace,
 			Subsystem: "custom",
 			Name:      name,
 			Help:      help,
@@ -477,9 +561,9 @@ func (mc *MetricsCollector) CreateCustomHistogram(name, help string, buckets []f
 		buckets = prometheus.DefBuckets
 	}
 
-	histogram := promauto.NewHistogramVec(
+	histogram := mc.factory.NewHistogramVec(
 		prometheus.HistogramOpts{
-			Namespace: "dolphin",
+			Namespace: mc.config.Namespace,
 			Subsystem: "custom",
 			Name:      name,
 			Help:      help,
@@ -492,9 +576,28 @@ func (mc *MetricsCollector) CreateCustomHistogram(name, help string, buckets []f
 	return histogram
 }
 
-// GetMetricsHandler returns the Prometheus metrics handler
+// GetMetricsHandler returns the Prometheus handler for this collector's
+// registry
 func (mc *MetricsCollector) GetMetricsHandler() http.Handler {
-	return promhttp.Handler()
+	return promhttp.HandlerFor(mc.registry, promhttp.HandlerOpts{ErrorLog: zap.NewStdLog(mc.logger)})
+}
+
+// Registry returns the registry the collector's metrics are registered in,
+// for registering further collectors
+func (mc *MetricsCollector) Registry() *prometheus.Registry {
+	return mc.registry
+}
+
+// NewServer creates an HTTP server exposing the metrics at path on addr.
+// The caller starts and shuts it down.
+func (mc *MetricsCollector) NewServer(addr, path string) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle(path, mc.GetMetricsHandler())
+	return &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
 }
 
 // StartMetricsServer starts the metrics server
@@ -503,13 +606,7 @@ func (mc *MetricsCollector) StartMetricsServer(config *MetricsConfig) error {
 		return nil
 	}
 
-	mux := http.NewServeMux()
-	mux.Handle(config.Path, mc.GetMetricsHandler())
-
-	server := &http.Server{
-		Addr:    fmt.Sprintf(":%d", config.Port),
-		Handler: mux,
-	}
+	server := mc.NewServer(fmt.Sprintf(":%d", config.Port), config.Path)
 
 	go func() {
 		mc.logger.Info("Starting metrics server",
@@ -549,29 +646,60 @@ func MetricsConfigFromEnv() *MetricsConfig {
 	return config
 }
 
-// collectSystemMetrics collects system metrics in the background
+// collectSystemMetrics collects system metrics and checks the series
+// counts in the background until Close is called
 func (mc *MetricsCollector) collectSystemMetrics() {
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		// Update uptime
-		mc.appUptime.Add(time.Since(mc.startTime).Seconds())
-		mc.startTime = time.Now()
+	var cardinality <-chan time.Time
+	if mc.config.MaxSeries > 0 && mc.config.CardinalityInterval > 0 {
+		check := time.NewTicker(mc.config.CardinalityInterval)
+		defer check.Stop()
+		cardinality = check.C
+	}
+
+	mc.sampleSystemMetrics()
+	for {
+		select {
+		case <-ticker.C:
+			mc.sampleSystemMetrics()
+		case <-cardinality:
+			mc.checkCardinality()
+		case <-mc.stop:
+			return
+		}
+	}
+}
+
+// sampleSystemMetrics updates the runtime and connection pool gauges
+func (mc *MetricsCollector) sampleSystemMetrics() {
+	// Update memory usage
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	mc.appMemoryUsage.Set(float64(m.Alloc))
 
-		// Update memory usage
-		var m runtime.MemStats
-		runtime.ReadMemStats(&m)
-		mc.appMemoryUsage.Set(float64(m.Alloc))
+	// Update goroutine count
+	mc.appGoroutineCount.Set(float64(runtime.NumGoroutine()))
 
-		// Update goroutine count
-		mc.appGoroutineCount.Set(float64(runtime.NumGoroutine()))
+	// Update GC metrics
+	mc.appGCPauseDuration.WithLabelValues("GC").Observe(float64(m.PauseNs[(m.NumGC+255)%256]) / 1e9)
 
-		// Update GC metrics
-		mc.appGCPauseDuration.WithLabelValues("GC").Observe(float64(m.PauseNs[(m.NumGC+255)%256]) / 1e9)
+	// Update database pool metrics
+	mc.mu.RLock()
+	sqlDB := mc.sqlDB
+	mc.mu.RUnlock()
+	if sqlDB != nil {
+		stats := sqlDB.Stats()
+		mc.SetDatabaseConnections(stats.InUse, stats.Idle)
 	}
 }
 
+// Close stops the background collection
+func (mc *MetricsCollector) Close() {
+	mc.stopOnce.Do(func() { close(mc.stop) })
+}
+
 // responseWriter wraps http.ResponseWriter to capture status code and size
 type responseWriter struct {
 	http.ResponseWriter
@@ -592,29 +720,106 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 
 // MetricsSummary represents a summary of metrics
 type MetricsSummary struct {
-	HTTPRequests    int64   `json:"http_requests"`
-	HTTPDuration    float64 `json:"http_duration_avg"`
-	MemoryUsage     int64   `json:"memory_usage_bytes"`
-	GoroutineCount  int     `json:"goroutine_count"`
-	DatabaseQueries int64   `json:"database_queries"`
-	CacheHits       int64   `json:"cache_hits"`
-	CacheMisses     int64   `json:"cache_misses"`
-	Uptime          float64 `json:"uptime_seconds"`
+	HTTPRequests              int64   `json:"http_requests"`
+	HTTPServerErrors          int64   `json:"http_server_errors"`
+	HTTPActiveRequests        int64   `json:"http_active_requests"`
+	HTTPDuration              float64 `json:"http_duration_avg"`
+	MemoryUsage               int64   `json:"memory_usage_bytes"`
+	GoroutineCount            int     `json:"goroutine_count"`
+	DatabaseQueries           int64   `json:"database_queries"`
+	DatabaseErrors            int64   `json:"database_errors"`
+	DatabaseConnectionsActive int64   `json:"database_connections_active"`
+	DatabaseConnectionsIdle   int64   `json:"database_connections_idle"`
+	CacheHits                 int64   `json:"cache_hits"`
+	CacheMisses               int64   `json:"cache_misses"`
+	Uptime                    float64 `json:"uptime_seconds"`
 }
 
 // GetSummary returns a summary of current metrics
 func (mc *MetricsCollector) GetSummary() *MetricsSummary {
-	var m runtime.MemStats
-	runtime.ReadMemStats(&m)
+	families, err := mc.registry.Gather()
+	if err != nil {
+		mc.logger.Warn("Failed to gather metrics", zap.Error(err))
+	}
+	byName := make(map[string]*dto.MetricFamily, len(families))
+	for _, mf := range families {
+		byName[mf.GetName()] = mf
+	}
+	return summarize(byName, mc.config)
+}
+
+// ParseMetricsSummary summarizes a scrape of a metrics endpoint, in the
+// Prometheus text format, served by a collector with the given config
+func ParseMetricsSummary(r io.Reader, config *MetricsConfig) (*MetricsSummary, error) {
+	if config == nil {
+		config = DefaultMetricsConfig()
+	}
+	parser := expfmt.NewTextParser(model.UTF8Validation)
+	families, err := parser.TextToMetricFamilies(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse metrics: %w", err)
+	}
+	return summarize(families, config), nil
+}
+
+func summarize(families map[string]*dto.MetricFamily, config *MetricsConfig) *MetricsSummary {
+	app := func(name string) *dto.MetricFamily {
+		return families[prometheus.BuildFQName(config.Namespace, config.Subsystem, name)]
+	}
+	family := func(subsystem, name string) *dto.MetricFamily {
+		return families[prometheus.BuildFQName(config.Namespace, subsystem, name)]
+	}
+	serverError := func(m *dto.Metric) bool {
+		for _, label := range m.GetLabel() {
+			if label.GetName() == "status_code" {
+				return strings.HasPrefix(label.GetValue(), "5")
+			}
+		}
+		return false
+	}
+
+	summary := &MetricsSummary{
+		HTTPRequests:              int64(sumMetrics(app("http_requests_total"), nil)),
+		HTTPServerErrors:          int64(sumMetrics(app("http_requests_total"), serverError)),
+		HTTPActiveRequests:        int64(sumMetrics(app("http_active_requests"), nil)),
+		MemoryUsage:               int64(sumMetrics(app("memory_usage_bytes"), nil)),
+		GoroutineCount:            int(sumMetrics(app("goroutines_total"), nil)),
+		DatabaseErrors:            int64(sumMetrics(family("database", "query_errors_total"), nil)),
+		DatabaseConnectionsActive: int64(sumMetrics(family("database", "connections_active"), nil)),
+		DatabaseConnectionsIdle:   int64(sumMetrics(family("database", "connections_idle"), nil)),
+		CacheHits:                 int64(sumMetrics(family("cache", "hits_total"), nil)),
+		CacheMisses:               int64(sumMetrics(family("cache", "misses_total"), nil)),
+		Uptime:                    sumMetrics(app("uptime_seconds_total"), nil),
+	}
+
+	if count, total := histogramTotals(app("http_request_duration_seconds")); count > 0 {
+		summary.HTTPDuration = total / float64(count)
+	}
+	queries, _ := histogramTotals(family("database", "query_duration_seconds"))
+	summary.DatabaseQueries = int64(queries)
+
+	return summary
+}
+
+// sumMetrics adds up the counter, gauge or untyped values of a family's
+// series, optionally only those keep accepts
+func sumMetrics(mf *dto.MetricFamily, keep func(*dto.Metric) bool) float64 {
+	var total float64
+	for _, m := range mf.GetMetric() {
+		if keep != nil && !keep(m) {
+			continue
+		}
+		total += m.GetCounter().GetValue() + m.GetGauge().GetValue() + m.GetUntyped().GetValue()
+	}
+	return total
+}
 
-	return &MetricsSummary{
-		HTTPRequests:    0, // Would need to track this separately
-		HTTPDuration:    0, // Would need to track this separately
-		MemoryUsage:     int64(m.Alloc),
-		GoroutineCount:  runtime.NumGoroutine(),
-		DatabaseQueries: 0, // Would need to track this separately
-		CacheHits:       0, // Would need to track this separately
-		CacheMisses:     0, // Would need to track this separately
-		Uptime:          time.Since(mc.startTime).Seconds(),
+// histogramTotals returns the observation count and sum across a histogram
+// family's series
+func histogramTotals(mf *dto.MetricFamily) (count uint64, sum float64) {
+	for _, m := range mf.GetMetric() {
+		count += m.GetHistogram().GetSampleCount()
+		sum += m.GetHistogram().GetSampleSum()
 	}
+	return count, sum
 }
@@ -0,0 +1,176 @@
+package observability
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/mrhoseah/dolphin/internal/cache"
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/database"
+)
+
+func newTestCollector(t *testing.T) *MetricsCollector {
+	mc := NewMetricsCollector(nil, nil)
+	t.Cleanup(mc.Close)
+	return mc
+}
+
+func scrape(t *testing.T, mc *MetricsCollector) string {
+	rec := httptest.NewRecorder()
+	mc.GetMetricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	return rec.Body.String()
+}
+
+func TestHTTPMetricsUseRoutePatterns(t *testing.T) {
+	mc := newTestCollector(t)
+	// A second collector must not clash with the first's registrations
+	newTestCollector(t)
+
+	r := chi.NewRouter()
+	r.Use(mc.HTTPMetricsMiddleware)
+	r.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	r.Get("/boom", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusInternalServerError) })
+
+	for _, path := range []string{"/users/1", "/users/2", "/boom", "/missing"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	body := scrape(t, mc)
+	assert.Contains(t, body, `dolphin_app_http_requests_total{handler="unknown",method="GET",path="/users/{id}",status_code="200"} 2`)
+	assert.Contains(t, body, `path="unmatched",status_code="404"`)
+	assert.NotContains(t, body, `path="/users/1"`)
+	assert.Contains(t, body, "go_goroutines")
+
+	summary, err := ParseMetricsSummary(strings.NewReader(body), nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), summary.HTTPRequests)
+	assert.Equal(t, int64(1), summary.HTTPServerErrors)
+	assert.Greater(t, summary.GoroutineCount, 0)
+	assert.Greater(t, summary.Uptime, 0.0)
+	assert.Equal(t, summary.HTTPRequests, mc.GetSummary().HTTPRequests)
+}
+
+func TestMetricsCardinalityGuard(t *testing.T) {
+	core, logs := observer.New(zap.WarnLevel)
+	cfg := DefaultMetricsConfig()
+	cfg.MaxSeries = 5
+	cfg.LabelAllowlist = map[string][]string{"key_pattern": {"users"}}
+	mc := NewMetricsCollector(cfg, zap.New(core))
+	t.Cleanup(mc.Close)
+
+	// Without chi, http.ServeMux patterns label requests
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /orders/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	handler := mc.HTTPMetricsMiddleware(mux)
+	for _, path := range []string{"/orders/1", "/orders/2", "/nowhere/3"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PURGE", "/orders/1", nil))
+
+	for i := range 10 {
+		mc.RecordCacheHit("response", fmt.Sprintf("session%d", i))
+	}
+	mc.RecordCacheHit("response", "users")
+	for i := range 8 {
+		mc.RecordAPICall(fmt.Sprintf("/api/items/%d", i), "GET", "200")
+	}
+
+	body := scrape(t, mc)
+	assert.Contains(t, body, `dolphin_app_http_requests_total{handler="unknown",method="GET",path="/orders/{id}",status_code="200"} 2`)
+	assert.Contains(t, body, `method="GET",path="unmatched",status_code="404"`)
+	assert.Contains(t, body, `method="other",path="unmatched",status_code="405"`)
+	assert.NotContains(t, body, `/orders/1`)
+	assert.Contains(t, body, `dolphin_cache_hits_total{cache_name="response",key_pattern="other"} 10`)
+	assert.Contains(t, body, `dolphin_cache_hits_total{cache_name="response",key_pattern="users"} 1`)
+
+	mc.checkCardinality()
+	mc.checkCardinality()
+	warnings := logs.FilterMessageSnippet("more series than expected").All()
+	require.Len(t, warnings, 1, "each metric is warned about once")
+	fields := warnings[0].ContextMap()
+	assert.Equal(t, "dolphin_api_calls_total", fields["metric"])
+	assert.Equal(t, int64(8), fields["series"])
+	assert.Equal(t, "endpoint", fields["label"])
+}
+
+type widget struct {
+	ID   uint
+	Name string
+}
+
+func TestInstrumentDB(t *testing.T) {
+	db, err := database.New(&config.DatabaseConfig{Driver: "sqlite", Database: filepath.Join(t.TempDir(), "app.db"), MaxOpen: 2, MaxIdle: 2})
+	require.NoError(t, err)
+	defer db.Close()
+
+	mc := newTestCollector(t)
+	require.NoError(t, mc.InstrumentDB(db.GetDB()))
+
+	gdb := db.GetDB()
+	require.NoError(t, gdb.AutoMigrate(&widget{}))
+	require.NoError(t, gdb.Create(&widget{Name: "gear"}).Error)
+	var found widget
+	require.NoError(t, gdb.First(&found).Error)
+	assert.Error(t, gdb.First(&found, 99).Error, "not found is not a query error")
+	assert.Error(t, gdb.Exec("SELECT * FROM missing").Error)
+	mc.sampleSystemMetrics()
+
+	body := scrape(t, mc)
+	assert.Contains(t, body, `dolphin_database_query_duration_seconds_count{operation="create",table="widgets"} 1`)
+	assert.Contains(t, body, `dolphin_database_query_duration_seconds_count{operation="query",table="widgets"} 2`)
+	assert.Contains(t, body, `dolphin_database_query_errors_total{error_type="query_error",operation="raw",table="none"} 1`)
+
+	summary := mc.GetSummary()
+	assert.GreaterOrEqual(t, summary.DatabaseQueries, int64(4))
+	assert.Equal(t, int64(1), summary.DatabaseErrors)
+	assert.Greater(t, summary.DatabaseConnectionsActive+summary.DatabaseConnectionsIdle, int64(0))
+}
+
+func TestQueriesCanceledMetric(t *testing.T) {
+	db, err := database.New(&config.DatabaseConfig{Driver: "sqlite", Database: filepath.Join(t.TempDir(), "app.db")})
+	require.NoError(t, err)
+	defer db.Close()
+
+	mc := newTestCollector(t)
+	db.QueryTimeouts().OnCancel = mc.RecordQueryCanceled
+
+	ctx := database.WithQueryTimeout(context.Background(), time.Nanosecond)
+	var n int
+	assert.Error(t, db.GetDB().WithContext(ctx).Raw("SELECT 1").Find(&n).Error)
+
+	assert.Contains(t, scrape(t, mc), `dolphin_database_queries_canceled_total{operation="query",reason="timeout",table="none"} 1`)
+}
+
+func TestInstrumentCache(t *testing.T) {
+	mc := newTestCollector(t)
+	c := mc.InstrumentCache("response", cache.NewMemoryCache())
+	ctx := context.Background()
+
+	_, err := c.Get(ctx, "users:1")
+	assert.Error(t, err)
+	require.NoError(t, c.Set(ctx, "users:1", "alice", time.Minute))
+	value, err := c.Get(ctx, "users:1")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", value)
+
+	body := scrape(t, mc)
+	assert.Contains(t, body, `dolphin_cache_hits_total{cache_name="response",key_pattern="users"} 1`)
+	assert.Contains(t, body, `dolphin_cache_operations_total{cache_name="response",operation="set",status="success"} 1`)
+
+	summary := mc.GetSummary()
+	assert.Equal(t, int64(1), summary.CacheHits)
+	assert.Equal(t, int64(1), summary.CacheMisses)
+}
@@ -0,0 +1,114 @@
+package observability
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RouteNameKey is the attribute NameRoute gives server spans
+const RouteNameKey = attribute.Key("http.route.name")
+
+// NameRoute names the routes it wraps in their server spans, e.g.
+//
+//	r.With(observability.NameRoute("users.show")).Get("/users/{id}", show)
+func NameRoute(name string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			trace.SpanFromContext(r.Context()).SetAttributes(RouteNameKey.String(name))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// IdentifyUsers has server spans record the signed-in user identify
+// returns, hashed with the config's UserHashKey so traces don't carry
+// user IDs, as enduser.id
+func (tm *TracerManager) IdentifyUsers(identify func(r *http.Request) (string, bool)) {
+	tm.identify = identify
+}
+
+// HashUserID returns the value traces record for a user: an HMAC of id
+// when there is a key, else its SHA-256 hash
+func HashUserID(key, id string) string {
+	var sum []byte
+	if key != "" {
+		mac := hmac.New(sha256.New, []byte(key))
+		mac.Write([]byte(id))
+		sum = mac.Sum(nil)
+	} else {
+		digest := sha256.Sum256([]byte(id))
+		sum = digest[:]
+	}
+	return hex.EncodeToString(sum[:16])
+}
+
+// routeRatio samples the requests to a route or below a path prefix
+type routeRatio struct {
+	route   string
+	sampler sdktrace.Sampler
+}
+
+// routeSampler samples requests to the routes it has a ratio for with
+// that ratio, and everything else with base
+type routeSampler struct {
+	base   sdktrace.Sampler
+	routes []routeRatio
+}
+
+// newRouteSampler overrides base for the requests to routes, by route
+// pattern or path prefix
+func newRouteSampler(base sdktrace.Sampler, routes map[string]float64) (sdktrace.Sampler, error) {
+	s := &routeSampler{base: base}
+	for route, ratio := range routes {
+		if ratio < 0 || ratio > 1 {
+			return nil, fmt.Errorf("trace sampling ratio for %s must be between 0 and 1", route)
+		}
+		s.routes = append(s.routes, routeRatio{route: strings.ToLower(route), sampler: sdktrace.TraceIDRatioBased(ratio)})
+	}
+	// Longest first, so the most specific prefix wins
+	sort.Slice(s.routes, func(i, j int) bool { return len(s.routes[i].route) > len(s.routes[j].route) })
+	return s, nil
+}
+
+// ShouldSample implements sdktrace.Sampler from the route and target
+// attributes server spans start with
+func (s *routeSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	var route, path string
+	for _, attr := range p.Attributes {
+		switch attr.Key {
+		case semconv.HTTPRouteKey:
+			route = strings.ToLower(attr.Value.AsString())
+		case semconv.HTTPTargetKey:
+			path, _, _ = strings.Cut(strings.ToLower(attr.Value.AsString()), "?")
+		}
+	}
+	if route != "" || path != "" {
+		for _, rr := range s.routes {
+			if rr.route == route {
+				return rr.sampler.ShouldSample(p)
+			}
+		}
+		for _, rr := range s.routes {
+			prefix := strings.TrimSuffix(rr.route, "/")
+			if path == rr.route || strings.HasPrefix(path, prefix+"/") {
+				return rr.sampler.ShouldSample(p)
+			}
+		}
+	}
+	return s.base.ShouldSample(p)
+}
+
+// Description implements sdktrace.Sampler
+func (s *routeSampler) Description() string {
+	return fmt.Sprintf("RouteSampler{%s,routes:%d}", s.base.Description(), len(s.routes))
+}
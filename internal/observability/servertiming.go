@@ -0,0 +1,181 @@
+package observability
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// serverTimingMetrics are the Server-Timing metrics reported for every
+// request besides total, with how their spans are counted in the
+// description
+var serverTimingMetrics = []struct{ name, one, many string }{
+	{"db", "query", "queries"},
+	{"cache", "operation", "operations"},
+	{"template", "render", "renders"},
+}
+
+// ServerTiming adds up how long each request's spans spend in the database,
+// the cache and templates, and reports it with the total in a
+// Server-Timing header, which browsers show in the network panel of their
+// devtools:
+//
+//	Server-Timing: db;dur=12.4;desc="3 queries", cache;dur=0.3;desc="1 operation", template;dur=4.1;desc="1 render", total;dur=21.7
+//
+// Database spans are those with a db.system attribute, and cache and
+// template spans those named cache.* and template.*. Only sampled requests
+// have spans to add up; the others report the total alone.
+type ServerTiming struct {
+	requests sync.Map // trace.TraceID -> *requestTimings
+}
+
+var _ sdktrace.SpanProcessor = (*ServerTiming)(nil)
+
+// EnableServerTiming adds up the spans tm records for ServerTiming's
+// middleware, which must run inside TracingMiddleware
+func (tm *TracerManager) EnableServerTiming() (*ServerTiming, error) {
+	if tm.provider == nil {
+		return nil, fmt.Errorf("server timing needs a tracer that records spans")
+	}
+	st := &ServerTiming{}
+	tm.provider.RegisterSpanProcessor(st)
+	return st, nil
+}
+
+// requestTimings are the time a request's spans took, by metric
+type requestTimings struct {
+	mu        sync.Mutex
+	durations map[string]time.Duration
+	counts    map[string]int
+}
+
+// OnStart implements sdktrace.SpanProcessor
+func (st *ServerTiming) OnStart(ctx context.Context, span sdktrace.ReadWriteSpan) {}
+
+// OnEnd implements sdktrace.SpanProcessor by adding the span's duration to
+// its request's metric
+func (st *ServerTiming) OnEnd(span sdktrace.ReadOnlySpan) {
+	metric := serverTimingMetric(span)
+	if metric == "" {
+		return
+	}
+	value, ok := st.requests.Load(span.SpanContext().TraceID())
+	if !ok {
+		return
+	}
+	timings := value.(*requestTimings)
+	timings.mu.Lock()
+	timings.durations[metric] += span.EndTime().Sub(span.StartTime())
+	timings.counts[metric]++
+	timings.mu.Unlock()
+}
+
+// Shutdown implements sdktrace.SpanProcessor
+func (st *ServerTiming) Shutdown(ctx context.Context) error { return nil }
+
+// ForceFlush implements sdktrace.SpanProcessor
+func (st *ServerTiming) ForceFlush(ctx context.Context) error { return nil }
+
+// serverTimingMetric returns the metric a span counts towards, or "" for
+// none
+func serverTimingMetric(span sdktrace.ReadOnlySpan) string {
+	for _, attr := range span.Attributes() {
+		if attr.Key == semconv.DBSystemKey {
+			return "db"
+		}
+	}
+	switch name := span.Name(); {
+	case strings.HasPrefix(name, "cache."):
+		return "cache"
+	case strings.HasPrefix(name, "template."):
+		return "template"
+	}
+	return ""
+}
+
+// Middleware sets the Server-Timing header of each response from the spans
+// that ended before its headers were written
+func (st *ServerTiming) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		var timings *requestTimings
+		if span := trace.SpanFromContext(r.Context()); span.IsRecording() {
+			traceID := span.SpanContext().TraceID()
+			timings = &requestTimings{durations: map[string]time.Duration{}, counts: map[string]int{}}
+			// Requests continuing the same trace report their own
+			// spans; a second one at once reports the total alone
+			if _, loaded := st.requests.LoadOrStore(traceID, timings); loaded {
+				timings = nil
+			} else {
+				defer st.requests.Delete(traceID)
+			}
+		}
+
+		sw := &serverTimingWriter{ResponseWriter: w, header: func() string {
+			return timings.header(time.Since(start))
+		}}
+		next.ServeHTTP(sw, r)
+		// Handlers that write nothing leave the headers to the server
+		if !sw.wroteHeader {
+			w.Header().Set("Server-Timing", sw.header())
+		}
+	})
+}
+
+// header formats the Server-Timing header for a request that has taken
+// total so far
+func (t *requestTimings) header(total time.Duration) string {
+	var metrics []string
+	if t != nil {
+		t.mu.Lock()
+		for _, m := range serverTimingMetrics {
+			count, unit := t.counts[m.name], m.many
+			if count == 1 {
+				unit = m.one
+			}
+			metrics = append(metrics, fmt.Sprintf(`%s;dur=%s;desc="%d %s"`, m.name, milliseconds(t.durations[m.name]), count, unit))
+		}
+		t.mu.Unlock()
+	}
+	return strings.Join(append(metrics, "total;dur="+milliseconds(total)), ", ")
+}
+
+// milliseconds formats d as Server-Timing durations are given
+func milliseconds(d time.Duration) string {
+	return fmt.Sprintf("%.1f", float64(d)/float64(time.Millisecond))
+}
+
+// serverTimingWriter sets the Server-Timing header just before the
+// response's headers are written
+type serverTimingWriter struct {
+	http.ResponseWriter
+	header      func() string
+	wroteHeader bool
+}
+
+func (w *serverTimingWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.ResponseWriter.Header().Set("Server-Timing", w.header())
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *serverTimingWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *serverTimingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
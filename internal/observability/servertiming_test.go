@@ -0,0 +1,94 @@
+package observability
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/cache"
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/database"
+)
+
+// newServerTimingRouter returns a router timing its requests with a tracer
+// that exports nothing
+func newServerTimingRouter(t *testing.T, sampler string) (*TracerManager, chi.Router) {
+	cfg := DefaultTraceConfig()
+	cfg.Sampler = sampler
+	tm, err := NewTracerManagerWithExporter(cfg, nil, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = tm.Shutdown(context.Background()) })
+	st, err := tm.EnableServerTiming()
+	require.NoError(t, err)
+
+	r := chi.NewRouter()
+	r.Use(TracingMiddleware(tm), st.Middleware)
+	return tm, r
+}
+
+func TestServerTiming(t *testing.T) {
+	tm, r := newServerTimingRouter(t, "always_on")
+
+	db, err := database.New(&config.DatabaseConfig{Driver: "sqlite", Database: filepath.Join(t.TempDir(), "app.db")})
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, db.GetDB().AutoMigrate(&widget{}))
+	require.NoError(t, tm.InstrumentDB(db.GetDB()))
+	store := tm.InstrumentCache("test", cache.NewMemoryCache())
+
+	r.Get("/widgets", func(w http.ResponseWriter, r *http.Request) {
+		var widgets []widget
+		db.GetDB().WithContext(r.Context()).Find(&widgets)
+		db.GetDB().WithContext(r.Context()).Where("name = ?", "x").Find(&widgets)
+		_, _ = store.Get(r.Context(), "widgets:all")
+
+		_, span := StartTemplateSpan(r.Context(), "widgets/index")
+		time.Sleep(2 * time.Millisecond)
+		span.End()
+
+		w.Write([]byte("ok"))
+		// Spans ending after the headers are sent are left out
+		_ = store.Set(r.Context(), "widgets:all", "ok", time.Minute)
+	})
+	r.Get("/empty", func(w http.ResponseWriter, r *http.Request) {})
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/widgets", nil))
+	assert.Regexp(t, `^db;dur=\d+\.\d;desc="2 queries", `+
+		`cache;dur=\d+\.\d;desc="1 operation", `+
+		`template;dur=[1-9]\d*\.\d;desc="1 render", `+
+		`total;dur=\d+\.\d$`, rec.Header().Get("Server-Timing"))
+
+	// Handlers that write nothing still get the header
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/empty", nil))
+	assert.Regexp(t, `^db;dur=0\.0;desc="0 queries", .*, total;dur=\d+\.\d$`, rec.Header().Get("Server-Timing"))
+}
+
+func TestServerTimingUnsampled(t *testing.T) {
+	_, r := newServerTimingRouter(t, "always_off")
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		_, span := StartTemplateSpan(r.Context(), "home")
+		span.End()
+	})
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Regexp(t, `^total;dur=\d+\.\d$`, rec.Header().Get("Server-Timing"))
+}
+
+func TestServerTimingNeedsRecorder(t *testing.T) {
+	cfg := DefaultTraceConfig()
+	cfg.Enabled = false
+	tm, err := NewTracerManager(cfg, nil)
+	require.NoError(t, err)
+	_, err = tm.EnableServerTiming()
+	assert.Error(t, err)
+}
@@ -0,0 +1,510 @@
+package observability
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+// DefaultBurnAlerts are the burn rates that alert when the config lists
+// none: a page when a 30 day budget would be gone in about two days, and
+// a ticket when it would be gone in five
+var DefaultBurnAlerts = []config.SLOBurnAlert{
+	{Severity: "page", Rate: 14.4, Long: time.Hour, Short: 5 * time.Minute},
+	{Severity: "ticket", Rate: 6, Long: 6 * time.Hour, Short: 30 * time.Minute},
+}
+
+// SLOStatus is how an objective stands over its window
+type SLOStatus struct {
+	Name    string        `json:"name"`
+	Routes  []string      `json:"routes"`
+	Target  float64       `json:"target"`
+	Latency time.Duration `json:"latency,omitempty"`
+	Window  time.Duration `json:"window"`
+
+	// Requests counted over the window, and how many of them were bad
+	Requests float64 `json:"requests"`
+	Bad      float64 `json:"bad"`
+
+	// SLI is the percentage of good requests over the window; 100 without
+	// requests
+	SLI float64 `json:"sli"`
+
+	// BudgetRemaining is the share of the error budget left, from 1 down;
+	// below 0 once the objective is missed
+	BudgetRemaining float64 `json:"budget_remaining"`
+
+	BurnRates []BurnRate `json:"burn_rates"`
+
+	// Alerting is whether any burn rate alert is firing
+	Alerting  bool      `json:"alerting"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BurnRate is how fast the error budget burned over a burn alert's
+// windows, as a multiple of the pace that spends it exactly over the
+// objective's window
+type BurnRate struct {
+	Severity  string        `json:"severity"`
+	Threshold float64       `json:"threshold"`
+	Long      time.Duration `json:"long"`
+	LongRate  float64       `json:"long_rate"`
+	Short     time.Duration `json:"short"`
+	ShortRate float64       `json:"short_rate"`
+	Firing    bool          `json:"firing"`
+}
+
+// sloSample is what an objective's requests had added up to at a time
+type sloSample struct {
+	at         time.Time
+	total, bad float64
+}
+
+// sloState is an objective and its history. Counters only grow, so the
+// requests over a window are the latest sample less the one taken when
+// the window started: samples are kept every interval for the longest
+// alert window, and sparser ones for the objective's window.
+type sloState struct {
+	objective config.SLOObjective
+	fine      []sloSample
+	coarse    []sloSample
+	status    SLOStatus
+	alerted   map[string]time.Time
+}
+
+// SLOTracker tracks service level objectives from a metrics collector's
+// request metrics and alerts when their error budgets burn too fast
+type SLOTracker struct {
+	metrics    *MetricsCollector
+	config     config.SLOConfig
+	alerts     []config.SLOBurnAlert
+	resolution time.Duration
+	logger     *zap.Logger
+
+	budgetGauge *prometheus.GaugeVec
+	burnGauge   *prometheus.GaugeVec
+
+	mu        sync.RWMutex
+	slos      []*sloState
+	notifiers []SLONotifier
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewSLOTracker creates a tracker for the objectives in cfg, read from the
+// metrics' request counts and durations. A latency objective counts the
+// requests in the duration buckets up to its latency, so the buckets
+// should include it; see SLOBuckets.
+func NewSLOTracker(metrics *MetricsCollector, cfg config.SLOConfig, logger *zap.Logger) (*SLOTracker, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = 30 * 24 * time.Hour
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Minute
+	}
+	alerts := cfg.BurnAlerts
+	if len(alerts) == 0 {
+		alerts = DefaultBurnAlerts
+	}
+	if err := validateSLOs(cfg, alerts); err != nil {
+		return nil, err
+	}
+
+	t := &SLOTracker{
+		metrics:    metrics,
+		config:     cfg,
+		alerts:     alerts,
+		resolution: max(cfg.Interval, cfg.Window/720),
+		logger:     logger,
+		stop:       make(chan struct{}),
+	}
+	for _, objective := range cfg.Objectives {
+		t.slos = append(t.slos, &sloState{
+			objective: objective,
+			alerted:   make(map[string]time.Time),
+			status: SLOStatus{
+				Name:            objective.Name,
+				Routes:          objective.Routes,
+				Target:          objective.Target,
+				Latency:         objective.Latency,
+				Window:          cfg.Window,
+				SLI:             100,
+				BudgetRemaining: 1,
+			},
+		})
+	}
+	for _, url := range cfg.Alerts.Webhooks {
+		t.notifiers = append(t.notifiers, WebhookNotifier(url))
+	}
+
+	t.budgetGauge = metrics.factory.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metrics.config.Namespace,
+		Subsystem: "slo",
+		Name:      "error_budget_remaining_ratio",
+		Help:      "Share of the error budget left over the objective's window",
+	}, []string{"slo"})
+	t.burnGauge = metrics.factory.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metrics.config.Namespace,
+		Subsystem: "slo",
+		Name:      "burn_rate",
+		Help:      "Error budget burn rate over the window",
+	}, []string{"slo", "window"})
+	return t, nil
+}
+
+// validateSLOs reports every problem with the objectives and alerts
+func validateSLOs(cfg config.SLOConfig, alerts []config.SLOBurnAlert) error {
+	var errs []error
+	names := make(map[string]bool)
+	for i, o := range cfg.Objectives {
+		switch {
+		case o.Name == "":
+			errs = append(errs, fmt.Errorf("slo objective %d has no name", i+1))
+		case names[o.Name]:
+			errs = append(errs, fmt.Errorf("slo objective %s is listed twice", o.Name))
+		}
+		names[o.Name] = true
+		if o.Target <= 0 || o.Target >= 100 {
+			errs = append(errs, fmt.Errorf("slo objective %s: target must be above 0 and below 100", o.Name))
+		}
+		if o.Latency < 0 {
+			errs = append(errs, fmt.Errorf("slo objective %s: latency must not be negative", o.Name))
+		}
+	}
+	for _, a := range alerts {
+		if a.Rate <= 0 || a.Short <= 0 || a.Long <= a.Short {
+			errs = append(errs, fmt.Errorf("slo burn alert %s needs a rate, and a long window longer than its short one", a.Severity))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SLOBuckets adds the objectives' latencies to duration buckets, in
+// seconds, so latency objectives are counted exactly
+func SLOBuckets(buckets []float64, cfg config.SLOConfig) []float64 {
+	out := slices.Clone(buckets)
+	for _, o := range cfg.Objectives {
+		if o.Latency > 0 && !slices.Contains(out, o.Latency.Seconds()) {
+			out = append(out, o.Latency.Seconds())
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+// UseNotifications sends alerts to the config's alert channels through
+// provider
+func (t *SLOTracker) UseNotifications(provider NotificationSender) {
+	if len(t.config.Alerts.Channels) > 0 {
+		t.Notify(ChannelNotifier(provider, t.config.Alerts.Channels...))
+	}
+}
+
+// Notify sends alerts to n too. Alerts are always logged.
+func (t *SLOTracker) Notify(n SLONotifier) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.notifiers = append(t.notifiers, n)
+}
+
+// Start samples the metrics and checks the budgets every interval until
+// Close is called
+func (t *SLOTracker) Start() {
+	t.Check(time.Now())
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		ticker := time.NewTicker(t.config.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				t.Check(now)
+			case <-t.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops sampling
+func (t *SLOTracker) Close() {
+	t.stopOnce.Do(func() { close(t.stop) })
+	t.wg.Wait()
+}
+
+// Status returns how each objective stands, as of the last check
+func (t *SLOTracker) Status() []SLOStatus {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	statuses := make([]SLOStatus, len(t.slos))
+	for i, s := range t.slos {
+		statuses[i] = s.status
+		statuses[i].BurnRates = slices.Clone(s.status.BurnRates)
+	}
+	return statuses
+}
+
+// Check samples the request metrics as of now, works out each
+// objective's budget and burn rates and sends the alerts that start,
+// repeat after the cooldown or resolve
+func (t *SLOTracker) Check(now time.Time) {
+	families, err := t.metrics.registry.Gather()
+	if err != nil {
+		t.logger.Warn("Failed to gather metrics", zap.Error(err))
+	}
+	byName := make(map[string]*dto.MetricFamily, len(families))
+	for _, mf := range families {
+		byName[mf.GetName()] = mf
+	}
+	requests := byName[prometheus.BuildFQName(t.metrics.config.Namespace, t.metrics.config.Subsystem, "http_requests_total")]
+	durations := byName[prometheus.BuildFQName(t.metrics.config.Namespace, t.metrics.config.Subsystem, "http_request_duration_seconds")]
+
+	var alerts []SLOAlert
+	t.mu.Lock()
+	for _, s := range t.slos {
+		sample := sloSample{at: now}
+		if s.objective.Latency > 0 {
+			sample.total, sample.bad = countSlow(durations, s.objective)
+		} else {
+			sample.total, sample.bad = countFailed(requests, s.objective)
+		}
+		t.record(s, sample)
+		alerts = append(alerts, t.evaluate(s, now)...)
+	}
+	notifiers := slices.Clone(t.notifiers)
+	t.mu.Unlock()
+
+	for _, alert := range alerts {
+		t.send(alert, notifiers)
+	}
+}
+
+// record adds a sample to an objective's history and drops those no
+// window reaches back to, keeping one from before each window's start
+func (t *SLOTracker) record(s *sloState, sample sloSample) {
+	s.fine = append(s.fine, sample)
+	if len(s.coarse) == 0 || sample.at.Sub(s.coarse[len(s.coarse)-1].at) >= t.resolution {
+		s.coarse = append(s.coarse, sample)
+	}
+
+	var longest time.Duration
+	for _, a := range t.alerts {
+		longest = max(longest, a.Long)
+	}
+	s.fine = trimSamples(s.fine, sample.at.Add(-longest))
+	s.coarse = trimSamples(s.coarse, sample.at.Add(-t.config.Window))
+}
+
+// trimSamples drops the samples before the last one taken at or before
+// from
+func trimSamples(samples []sloSample, from time.Time) []sloSample {
+	i := 0
+	for i+1 < len(samples) && !samples[i+1].at.After(from) {
+		i++
+	}
+	return samples[i:]
+}
+
+// since returns the requests and bad ones counted over the window ending
+// at the latest sample. History shorter than the window counts since the
+// first sample.
+func (s *sloState) since(window time.Duration) (total, bad float64) {
+	latest := s.fine[len(s.fine)-1]
+	from := latest.at.Add(-window)
+	start := s.coarse[0]
+	for _, samples := range [][]sloSample{s.fine, s.coarse} {
+		if !samples[0].at.After(from) {
+			i := sort.Search(len(samples), func(i int) bool { return samples[i].at.After(from) })
+			start = samples[i-1]
+			break
+		}
+	}
+	return latest.total - start.total, latest.bad - start.bad
+}
+
+// evaluate updates an objective's status and returns the alerts to send
+func (t *SLOTracker) evaluate(s *sloState, now time.Time) []SLOAlert {
+	o := s.objective
+	budget := (100 - o.Target) / 100
+	burn := func(window time.Duration) (rate, total float64) {
+		total, bad := s.since(window)
+		if total == 0 {
+			return 0, 0
+		}
+		return bad / total / budget, total
+	}
+
+	total, bad := s.since(t.config.Window)
+	status := SLOStatus{
+		Name:            o.Name,
+		Routes:          o.Routes,
+		Target:          o.Target,
+		Latency:         o.Latency,
+		Window:          t.config.Window,
+		Requests:        total,
+		Bad:             bad,
+		SLI:             100,
+		BudgetRemaining: 1,
+		UpdatedAt:       now,
+	}
+	if total > 0 {
+		status.SLI = 100 * (total - bad) / total
+		status.BudgetRemaining = 1 - bad/total/budget
+	}
+	t.budgetGauge.WithLabelValues(o.Name).Set(status.BudgetRemaining)
+
+	var alerts []SLOAlert
+	for _, a := range t.alerts {
+		longRate, longTotal := burn(a.Long)
+		shortRate, _ := burn(a.Short)
+		rate := BurnRate{
+			Severity:  a.Severity,
+			Threshold: a.Rate,
+			Long:      a.Long,
+			LongRate:  longRate,
+			Short:     a.Short,
+			ShortRate: shortRate,
+			Firing:    longTotal >= float64(t.config.MinRequests) && longRate >= a.Rate && shortRate >= a.Rate,
+		}
+		status.BurnRates = append(status.BurnRates, rate)
+		status.Alerting = status.Alerting || rate.Firing
+		t.burnGauge.WithLabelValues(o.Name, formatWindow(a.Long)).Set(longRate)
+		t.burnGauge.WithLabelValues(o.Name, formatWindow(a.Short)).Set(shortRate)
+
+		last, firing := s.alerted[a.Severity]
+		switch {
+		case rate.Firing && (!firing || now.Sub(last) >= t.config.Alerts.Cooldown):
+			s.alerted[a.Severity] = now
+			alerts = append(alerts, newSLOAlert(status, rate, false))
+		case !rate.Firing && firing:
+			delete(s.alerted, a.Severity)
+			alerts = append(alerts, newSLOAlert(status, rate, true))
+		}
+	}
+	s.status = status
+	return alerts
+}
+
+// send logs an alert and hands it to the notifiers
+func (t *SLOTracker) send(alert SLOAlert, notifiers []SLONotifier) {
+	fields := []zap.Field{
+		zap.String("slo", alert.SLO),
+		zap.String("severity", alert.Severity),
+		zap.Float64("burn_rate", alert.LongRate),
+		zap.Float64("budget_remaining", alert.BudgetRemaining),
+	}
+	if alert.Resolved {
+		t.logger.Info(alert.Title(), fields...)
+	} else {
+		t.logger.Warn(alert.Title(), fields...)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, n := range notifiers {
+		if err := n.NotifySLO(ctx, alert); err != nil {
+			t.logger.Error("Failed to send SLO alert", zap.String("slo", alert.SLO), zap.Error(err))
+		}
+	}
+}
+
+// countFailed adds up an objective's requests from the request counter,
+// and those that failed with a 5xx status
+func countFailed(mf *dto.MetricFamily, o config.SLOObjective) (total, bad float64) {
+	for _, m := range mf.GetMetric() {
+		if !matchesRoutes(labelValue(m, "path"), o.Routes) {
+			continue
+		}
+		value := m.GetCounter().GetValue()
+		total += value
+		if strings.HasPrefix(labelValue(m, "status_code"), "5") {
+			bad += value
+		}
+	}
+	return total, bad
+}
+
+// countSlow adds up an objective's requests from the duration histogram,
+// and those slower than its latency: those outside the largest bucket
+// that doesn't go beyond it
+func countSlow(mf *dto.MetricFamily, o config.SLOObjective) (total, bad float64) {
+	limit := o.Latency.Seconds()
+	for _, m := range mf.GetMetric() {
+		if !matchesRoutes(labelValue(m, "path"), o.Routes) {
+			continue
+		}
+		h := m.GetHistogram()
+		var fast uint64
+		for _, b := range h.GetBucket() {
+			if b.GetUpperBound() <= limit {
+				fast = b.GetCumulativeCount()
+			}
+		}
+		total += float64(h.GetSampleCount())
+		bad += float64(h.GetSampleCount() - fast)
+	}
+	return total, bad
+}
+
+// matchesRoutes reports whether a route pattern is one of routes, or is
+// prefixed by one ending in *
+func matchesRoutes(pattern string, routes []string) bool {
+	if len(routes) == 0 {
+		return true
+	}
+	for _, route := range routes {
+		if prefix, ok := strings.CutSuffix(route, "*"); (ok && strings.HasPrefix(pattern, prefix)) || route == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+func labelValue(m *dto.Metric, name string) string {
+	for _, label := range m.GetLabel() {
+		if label.GetName() == name {
+			return label.GetValue()
+		}
+	}
+	return ""
+}
+
+// formatWindow writes a window in its largest whole unit, e.g. 30d or 5m
+func formatWindow(d time.Duration) string {
+	switch {
+	case d >= 24*time.Hour && d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d >= time.Hour && d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d >= time.Minute && d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	}
+	return d.String()
+}
+
+// formatPercent writes a percentage without trailing zeros, e.g. 99.9%
+func formatPercent(p float64) string {
+	return strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.3f", p), "0"), ".") + "%"
+}
+
+// formatRate writes a burn rate, e.g. 14.4×
+func formatRate(rate float64) string {
+	return fmt.Sprintf("%.1f×", rate)
+}
@@ -0,0 +1,142 @@
+package observability
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SLOAlert reports an objective's error budget burning faster than a burn
+// alert allows, or that it no longer does
+type SLOAlert struct {
+	SLO      string `json:"slo"`
+	Severity string `json:"severity"`
+
+	// Resolved is set when the burn rate has dropped back under the
+	// threshold
+	Resolved bool `json:"resolved"`
+
+	Target  float64       `json:"target"`
+	Latency time.Duration `json:"latency,omitempty"`
+	Routes  []string      `json:"routes"`
+
+	Threshold float64       `json:"threshold"`
+	Long      time.Duration `json:"long"`
+	LongRate  float64       `json:"long_rate"`
+	Short     time.Duration `json:"short"`
+	ShortRate float64       `json:"short_rate"`
+
+	Window          time.Duration `json:"window"`
+	BudgetRemaining float64       `json:"budget_remaining"`
+	At              time.Time     `json:"at"`
+}
+
+func newSLOAlert(status SLOStatus, rate BurnRate, resolved bool) SLOAlert {
+	return SLOAlert{
+		SLO:             status.Name,
+		Severity:        rate.Severity,
+		Resolved:        resolved,
+		Target:          status.Target,
+		Latency:         status.Latency,
+		Routes:          status.Routes,
+		Threshold:       rate.Threshold,
+		Long:            rate.Long,
+		LongRate:        rate.LongRate,
+		Short:           rate.Short,
+		ShortRate:       rate.ShortRate,
+		Window:          status.Window,
+		BudgetRemaining: status.BudgetRemaining,
+		At:              status.UpdatedAt,
+	}
+}
+
+// Title sums the alert up in a line
+func (a SLOAlert) Title() string {
+	if a.Resolved {
+		return fmt.Sprintf("[%s] SLO %s resolved", a.Severity, a.SLO)
+	}
+	return fmt.Sprintf("[%s] SLO %s is burning its error budget", a.Severity, a.SLO)
+}
+
+// Message describes the objective and how fast its budget burned
+func (a SLOAlert) Message() string {
+	objective := formatPercent(a.Target) + " of requests succeed"
+	if a.Latency > 0 {
+		objective = formatPercent(a.Target) + " of requests within " + a.Latency.String()
+	}
+	routes := "all routes"
+	if len(a.Routes) > 0 {
+		routes = strings.Join(a.Routes, ", ")
+	}
+	return fmt.Sprintf("%s (%s on %s): the error budget burned at %s over the last %s and %s over %s, against %s. %s of the %s budget remains.",
+		a.SLO, objective, routes,
+		formatRate(a.LongRate), formatWindow(a.Long), formatRate(a.ShortRate), formatWindow(a.Short),
+		formatRate(a.Threshold), formatPercent(100*a.BudgetRemaining), formatWindow(a.Window))
+}
+
+// SLONotifier delivers SLO alerts
+type SLONotifier interface {
+	NotifySLO(ctx context.Context, alert SLOAlert) error
+}
+
+// SLONotifierFunc is a function delivering SLO alerts
+type SLONotifierFunc func(ctx context.Context, alert SLOAlert) error
+
+// NotifySLO implements SLONotifier
+func (f SLONotifierFunc) NotifySLO(ctx context.Context, alert SLOAlert) error {
+	return f(ctx, alert)
+}
+
+// NotificationSender sends notifications to named channels, as
+// providers.NotificationProvider does
+type NotificationSender interface {
+	SendToChannel(channel string, title, message string) error
+}
+
+// ChannelNotifier sends alerts to notification channels
+func ChannelNotifier(sender NotificationSender, channels ...string) SLONotifier {
+	return SLONotifierFunc(func(ctx context.Context, alert SLOAlert) error {
+		var errs []error
+		for _, channel := range channels {
+			if err := sender.SendToChannel(channel, alert.Title(), alert.Message()); err != nil {
+				errs = append(errs, fmt.Errorf("channel %s: %w", channel, err))
+			}
+		}
+		return errors.Join(errs...)
+	})
+}
+
+// WebhookNotifier POSTs alerts to url as JSON: the alert's fields, with
+// its title and message as text, which chat webhooks such as Slack's show
+func WebhookNotifier(url string) SLONotifier {
+	client := &http.Client{Timeout: 10 * time.Second}
+	return SLONotifierFunc(func(ctx context.Context, alert SLOAlert) error {
+		body, err := json.Marshal(struct {
+			Text string `json:"text"`
+			SLOAlert
+		}{alert.Title() + "\n" + alert.Message(), alert})
+		if err != nil {
+			return err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("slo webhook: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("slo webhook returned status %d", resp.StatusCode)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,156 @@
+package observability
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+type channelRecorder struct {
+	titles map[string][]string
+}
+
+func (c *channelRecorder) SendToChannel(channel, title, message string) error {
+	c.titles[channel] = append(c.titles[channel], title)
+	return nil
+}
+
+func TestSLOTrackerBurnRateAlerts(t *testing.T) {
+	cfg := config.SLOConfig{
+		Window:      24 * time.Hour,
+		Interval:    time.Minute,
+		MinRequests: 10,
+		Objectives: []config.SLOObjective{
+			{Name: "api", Routes: []string{"/api/*"}, Target: 99},
+			{Name: "api-latency", Routes: []string{"/api/*"}, Target: 90, Latency: 50 * time.Millisecond},
+		},
+		BurnAlerts: []config.SLOBurnAlert{{Severity: "page", Rate: 10, Long: time.Hour, Short: 5 * time.Minute}},
+		Alerts:     config.SLOAlertsConfig{Channels: []string{"ops"}, Cooldown: time.Hour},
+	}
+	metricsConfig := DefaultMetricsConfig()
+	metricsConfig.Buckets = SLOBuckets(prometheus.DefBuckets, cfg)
+	assert.Contains(t, metricsConfig.Buckets, 0.05)
+	mc := NewMetricsCollector(metricsConfig, nil)
+	t.Cleanup(mc.Close)
+
+	var hooked []SLOAlert
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert SLOAlert
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&alert))
+		hooked = append(hooked, alert)
+	}))
+	defer hook.Close()
+	cfg.Alerts.Webhooks = []string{hook.URL}
+
+	tracker, err := NewSLOTracker(mc, cfg, nil)
+	require.NoError(t, err)
+	channels := &channelRecorder{titles: make(map[string][]string)}
+	tracker.UseNotifications(channels)
+
+	r := chi.NewRouter()
+	r.Use(mc.HTTPMetricsMiddleware)
+	r.Get("/api/users/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	r.Get("/api/boom", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusBadGateway) })
+	r.Get("/api/slow", func(w http.ResponseWriter, r *http.Request) { time.Sleep(60 * time.Millisecond) })
+	r.Get("/health", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusServiceUnavailable) })
+	serve := func(path string, n int) {
+		for range n {
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+		}
+	}
+
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tracker.Check(start)
+	serve("/api/users/1", 99)
+	serve("/api/slow", 1)
+	serve("/health", 50)
+	tracker.Check(start.Add(time.Minute))
+
+	status := tracker.Status()
+	require.Len(t, status, 2)
+	assert.Equal(t, 100.0, status[0].Requests, "other routes aren't counted")
+	assert.Equal(t, 100.0, status[0].SLI)
+	assert.False(t, status[0].Alerting)
+	assert.Equal(t, 1.0, status[1].Bad, "the slow request")
+	assert.InDelta(t, 0.9, status[1].BudgetRemaining, 1e-9)
+	assert.Empty(t, hooked)
+
+	// 20 of 200 requests failing burns a 1% budget ten times too fast
+	serve("/api/boom", 20)
+	serve("/api/users/2", 80)
+	tracker.Check(start.Add(2 * time.Minute))
+
+	status = tracker.Status()
+	assert.Equal(t, 20.0, status[0].Bad)
+	assert.Equal(t, 90.0, status[0].SLI)
+	assert.InDelta(t, -9, status[0].BudgetRemaining, 1e-9)
+	require.Len(t, status[0].BurnRates, 1)
+	assert.InDelta(t, 10, status[0].BurnRates[0].LongRate, 1e-9)
+	assert.True(t, status[0].Alerting)
+	require.Len(t, hooked, 1)
+	assert.Equal(t, "api", hooked[0].SLO)
+	assert.False(t, hooked[0].Resolved)
+	assert.Equal(t, []string{"[page] SLO api is burning its error budget"}, channels.titles["ops"])
+	assert.Contains(t, scrape(t, mc), `dolphin_slo_burn_rate{slo="api",window="1h"} 10`)
+
+	// Still firing, but not repeated within the cooldown
+	tracker.Check(start.Add(3 * time.Minute))
+	assert.Len(t, hooked, 1)
+
+	// Once the short window is clean the alert resolves
+	serve("/api/users/3", 100)
+	tracker.Check(start.Add(10 * time.Minute))
+	assert.False(t, tracker.Status()[0].Alerting)
+	require.Len(t, hooked, 2)
+	assert.True(t, hooked[1].Resolved)
+	assert.Equal(t, "[page] SLO api resolved", channels.titles["ops"][1])
+}
+
+func TestSLOTrackerWindows(t *testing.T) {
+	mc := newTestCollector(t)
+	cfg := config.SLOConfig{
+		Window:     24 * time.Hour,
+		Interval:   5 * time.Minute,
+		Objectives: []config.SLOObjective{{Name: "all", Target: 99.9}},
+	}
+	tracker, err := NewSLOTracker(mc, cfg, nil)
+	require.NoError(t, err)
+
+	r := chi.NewRouter()
+	r.Use(mc.HTTPMetricsMiddleware)
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+	r.Get("/boom", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusInternalServerError) })
+
+	// An error early on, then a day and a half of good requests, checked
+	// every five minutes
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tracker.Check(start)
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/boom", nil))
+	for minute := 5; minute <= 36*60; minute += 5 {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		tracker.Check(start.Add(time.Duration(minute) * time.Minute))
+	}
+
+	status := tracker.Status()[0]
+	assert.Equal(t, 0.0, status.Bad, "the error has left the window")
+	assert.Equal(t, 24*12.0, status.Requests, "a day's requests")
+	assert.Equal(t, 1.0, status.BudgetRemaining)
+	for _, s := range tracker.slos {
+		assert.LessOrEqual(t, len(s.fine), 6*12+1, "samples for the longest alert window")
+		assert.LessOrEqual(t, len(s.coarse), 24*12+1, "samples for the objective's window")
+	}
+
+	_, err = NewSLOTracker(mc, config.SLOConfig{Objectives: []config.SLOObjective{{Name: "api", Target: 100}, {Target: 99}}}, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "slo objective api: target must be above 0 and below 100")
+	assert.Contains(t, err.Error(), "slo objective 2 has no name")
+}
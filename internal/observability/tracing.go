@@ -5,18 +5,27 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/exporters/jaeger"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	"go.opentelemetry.io/otel/exporters/zipkin"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
 	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/routing"
+	"github.com/mrhoseah/dolphin/internal/version"
 )
 
 // TraceConfig represents tracing configuration
@@ -25,12 +34,25 @@ type TraceConfig struct {
 	ServiceName string  `yaml:"service_name" json:"service_name"`
 	Version     string  `yaml:"version" json:"version"`
 	Environment string  `yaml:"environment" json:"environment"`
-	Sampler     string  `yaml:"sampler" json:"sampler"` // always_on, always_off, traceid_ratio
+	Sampler     string  `yaml:"sampler" json:"sampler"` // always_on, always_off, traceidratio or parentbased_*
 	Ratio       float64 `yaml:"ratio" json:"ratio"`
 
-	// Exporters
-	JaegerEndpoint string `yaml:"jaeger_endpoint" json:"jaeger_endpoint"`
-	ZipkinEndpoint string `yaml:"zipkin_endpoint" json:"zipkin_endpoint"`
+	// Routes overrides Ratio for the requests to a route pattern or below
+	// a path prefix, e.g. {"/health": 0}
+	Routes map[string]float64 `yaml:"routes" json:"routes"`
+
+	// UserHashKey keys the hash of the user IDs spans record
+	UserHashKey string `yaml:"-" json:"-"`
+
+	// Exporters; spans go to every one with an endpoint. OTLPEndpoint is
+	// host:port, or a URL whose scheme decides TLS, and OTLPProtocol is
+	// grpc or http.
+	OTLPEndpoint   string            `yaml:"otlp_endpoint" json:"otlp_endpoint"`
+	OTLPProtocol   string            `yaml:"otlp_protocol" json:"otlp_protocol"`
+	OTLPInsecure   bool              `yaml:"otlp_insecure" json:"otlp_insecure"`
+	OTLPHeaders    map[string]string `yaml:"otlp_headers" json:"otlp_headers"`
+	JaegerEndpoint string            `yaml:"jaeger_endpoint" json:"jaeger_endpoint"`
+	ZipkinEndpoint string            `yaml:"zipkin_endpoint" json:"zipkin_endpoint"`
 
 	// Headers
 	TraceHeader string `yaml:"trace_header" json:"trace_header"`
@@ -40,16 +62,17 @@ type TraceConfig struct {
 // DefaultTraceConfig returns default tracing configuration
 func DefaultTraceConfig() *TraceConfig {
 	return &TraceConfig{
-		Enabled:        true,
-		ServiceName:    "dolphin-app",
-		Version:        "1.0.0",
-		Environment:    "development",
-		Sampler:        "traceid_ratio",
-		Ratio:          1.0,
-		JaegerEndpoint: "http://localhost:14268/api/traces",
-		ZipkinEndpoint: "http://localhost:9411/api/v2/spans",
-		TraceHeader:    "X-Trace-Id",
-		SpanHeader:     "X-Span-Id",
+		Enabled:      true,
+		ServiceName:  "dolphin-app",
+		Version:      "1.0.0",
+		Environment:  "development",
+		Sampler:      "parentbased_traceidratio",
+		Ratio:        1.0,
+		OTLPEndpoint: "localhost:4317",
+		OTLPProtocol: "grpc",
+		OTLPInsecure: true,
+		TraceHeader:  "X-Trace-Id",
+		SpanHeader:   "X-Span-Id",
 	}
 }
 
@@ -59,51 +82,41 @@ type TracerManager struct {
 	provider *sdktrace.TracerProvider
 	config   *TraceConfig
 	logger   *zap.Logger
+	identify func(r *http.Request) (string, bool)
 }
 
-// NewTracerManager creates a new tracer manager
+// NewTracerManager creates a tracer manager exporting to the endpoints in
+// config, and installs it as the global tracer provider
 func NewTracerManager(config *TraceConfig, logger *zap.Logger) (*TracerManager, error) {
 	if config == nil {
 		config = DefaultTraceConfig()
 	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
 
 	if !config.Enabled {
 		// Return a no-op tracer
 		return &TracerManager{
-			tracer: trace.NewNoopTracerProvider().Tracer("noop"),
+			tracer: noop.NewTracerProvider().Tracer("noop"),
 			config: config,
 			logger: logger,
 		}, nil
 	}
 
-	// Create resource
-	res, err := resource.New(context.Background(),
-		resource.WithAttributes(
-			semconv.ServiceNameKey.String(config.ServiceName),
-			semconv.ServiceVersionKey.String(config.Version),
-			semconv.DeploymentEnvironmentKey.String(config.Environment),
-		),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create resource: %w", err)
-	}
-
-	// Create sampler
-	var sampler sdktrace.Sampler
-	switch config.Sampler {
-	case "always_on":
-		sampler = sdktrace.AlwaysSample()
-	case "always_off":
-		sampler = sdktrace.NeverSample()
-	case "traceid_ratio":
-		sampler = sdktrace.TraceIDRatioBased(config.Ratio)
-	default:
-		sampler = sdktrace.TraceIDRatioBased(config.Ratio)
-	}
-
 	// Create exporters
 	var exporters []sdktrace.SpanExporter
 
+	// OTLP exporter, understood by the OpenTelemetry Collector, Jaeger,
+	// Tempo and most tracing backends
+	if config.OTLPEndpoint != "" {
+		otlpExporter, err := newOTLPExporter(config)
+		if err != nil {
+			return nil, err
+		}
+		exporters = append(exporters, otlpExporter)
+	}
+
 	// Jaeger exporter
 	if config.JaegerEndpoint != "" {
 		jaegerExporter, err := jaeger.New(jaeger.WithCollectorEndpoint(jaeger.WithEndpoint(config.JaegerEndpoint)))
@@ -124,19 +137,54 @@ func NewTracerManager(config *TraceConfig, logger *zap.Logger) (*TracerManager,
 		}
 	}
 
-	if len(exporters) == 0 {
+	switch len(exporters) {
+	case 0:
 		return nil, fmt.Errorf("no exporters configured")
+	case 1:
+		return NewTracerManagerWithExporter(config, exporters[0], logger)
+	default:
+		return NewTracerManagerWithExporter(config, &MultiSpanExporter{exporters: exporters}, logger)
 	}
+}
 
-	// Create multi-exporter
-	multiExporter := &MultiSpanExporter{exporters: exporters}
+// NewTracerManagerWithExporter creates a tracer manager sending spans to
+// exporter, e.g. an in-memory one in tests, and installs it as the global
+// tracer provider. A nil exporter keeps spans in the process, for server
+// timing without a tracing backend.
+func NewTracerManagerWithExporter(config *TraceConfig, exporter sdktrace.SpanExporter, logger *zap.Logger) (*TracerManager, error) {
+	if config == nil {
+		config = DefaultTraceConfig()
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	// Create resource
+	res, err := resource.New(context.Background(),
+		resource.WithAttributes(
+			semconv.ServiceNameKey.String(config.ServiceName),
+			semconv.ServiceVersionKey.String(config.Version),
+			semconv.DeploymentEnvironmentKey.String(config.Environment),
+		),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create resource: %w", err)
+	}
+
+	sampler, err := NewSampler(config.Sampler, config.Ratio, config.Routes)
+	if err != nil {
+		return nil, err
+	}
 
 	// Create tracer provider
-	provider := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(multiExporter),
+	options := []sdktrace.TracerProviderOption{
 		sdktrace.WithResource(res),
 		sdktrace.WithSampler(sampler),
-	)
+	}
+	if exporter != nil {
+		options = append(options, sdktrace.WithBatcher(exporter))
+	}
+	provider := sdktrace.NewTracerProvider(options...)
 
 	// Set global tracer provider
 	otel.SetTracerProvider(provider)
@@ -158,6 +206,89 @@ func NewTracerManager(config *TraceConfig, logger *zap.Logger) (*TracerManager,
 	}, nil
 }
 
+// NewSampler creates the sampler named by the OpenTelemetry sampler names:
+// always_on, always_off and traceidratio, which keeps ratio of traces, or
+// their parentbased_ forms, which follow the caller's decision when a
+// request arrives with a trace. Routes overrides ratio for the server
+// spans of some routes; see TraceConfig.
+func NewSampler(name string, ratio float64, routes map[string]float64) (sdktrace.Sampler, error) {
+	base := strings.TrimPrefix(name, "parentbased_")
+
+	var sampler sdktrace.Sampler
+	switch base {
+	case "always_on":
+		sampler = sdktrace.AlwaysSample()
+	case "always_off":
+		sampler = sdktrace.NeverSample()
+	case "traceidratio", "traceid_ratio", "":
+		sampler = sdktrace.TraceIDRatioBased(ratio)
+	default:
+		return nil, fmt.Errorf("unknown trace sampler %q", name)
+	}
+	if len(routes) > 0 {
+		var err error
+		if sampler, err = newRouteSampler(sampler, routes); err != nil {
+			return nil, err
+		}
+	}
+
+	if base != name {
+		sampler = sdktrace.ParentBased(sampler)
+	}
+	return sampler, nil
+}
+
+// newOTLPExporter creates an OTLP exporter over gRPC or HTTP. Connections
+// are made lazily, so an unreachable collector doesn't stop the app.
+func newOTLPExporter(config *TraceConfig) (sdktrace.SpanExporter, error) {
+	ctx := context.Background()
+	isURL := strings.Contains(config.OTLPEndpoint, "://")
+
+	switch config.OTLPProtocol {
+	case "grpc", "":
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithHeaders(config.OTLPHeaders)}
+		if isURL {
+			opts = append(opts, otlptracegrpc.WithEndpointURL(config.OTLPEndpoint))
+		} else {
+			opts = append(opts, otlptracegrpc.WithEndpoint(config.OTLPEndpoint))
+			if config.OTLPInsecure {
+				opts = append(opts, otlptracegrpc.WithInsecure())
+			}
+		}
+		return otlptracegrpc.New(ctx, opts...)
+	case "http", "http/protobuf":
+		opts := []otlptracehttp.Option{otlptracehttp.WithHeaders(config.OTLPHeaders)}
+		if isURL {
+			opts = append(opts, otlptracehttp.WithEndpointURL(config.OTLPEndpoint))
+		} else {
+			opts = append(opts, otlptracehttp.WithEndpoint(config.OTLPEndpoint))
+			if config.OTLPInsecure {
+				opts = append(opts, otlptracehttp.WithInsecure())
+			}
+		}
+		return otlptracehttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("unknown OTLP protocol %q (use grpc or http)", config.OTLPProtocol)
+	}
+}
+
+// ForceFlush exports the spans still buffered, returning the export error
+func (tm *TracerManager) ForceFlush(ctx context.Context) error {
+	if tm.provider == nil {
+		return nil
+	}
+	return tm.provider.ForceFlush(ctx)
+}
+
+// Shutdown exports the spans still buffered and stops the exporters. Call
+// it after the server has shut down.
+func (tm *TracerManager) Shutdown(ctx context.Context) error {
+	if tm.provider == nil {
+		return nil
+	}
+	return tm.provider.Shutdown(ctx)
+}
+
 // GetTracer returns the tracer
 func (tm *TracerManager) GetTracer() trace.Tracer {
 	return tm.tracer
@@ -291,27 +422,40 @@ func (tm *TracerManager) GetSpanID(ctx context.Context) string {
 	return ""
 }
 
-// TracingMiddleware creates HTTP tracing middleware
+// TracingMiddleware starts a server span for each request, continuing the
+// caller's trace from its traceparent header. Spans are named by method
+// and route pattern, never by URL, and sampled by route. Handlers get the
+// span in the request context and the trace ID is returned in the
+// TraceHeader response header.
 func TracingMiddleware(tracer *TracerManager) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Extract trace context from request
 			ctx := tracer.ExtractTraceContext(r.Context(), r.Header)
 
-			// Start span
-			spanName := fmt.Sprintf("%s %s", r.Method, r.URL.Path)
-			ctx, span := tracer.StartSpan(ctx, spanName, trace.WithSpanKind(trace.SpanKindServer))
-
-			// Add span attributes
-			span.SetAttributes(
+			// Start span named by the route the request will match, so it
+			// can be sampled by route; routers other than chi only tell
+			// once the request is served
+			name := r.Method
+			attrs := []attribute.KeyValue{
 				semconv.HTTPMethodKey.String(r.Method),
-				semconv.HTTPURLKey.String(r.URL.String()),
+				semconv.HTTPTargetKey.String(r.URL.RequestURI()),
 				semconv.HTTPUserAgentKey.String(r.UserAgent()),
 				semconv.HTTPClientIPKey.String(r.RemoteAddr),
+			}
+			if route := routing.Match(r); route != "" {
+				name += " " + route
+				attrs = append(attrs, semconv.HTTPRouteKey.String(route))
+			}
+			ctx, span := tracer.StartSpan(ctx, name,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(attrs...),
 			)
+			defer span.End()
 
-			// Add trace headers to response
-			tracer.InjectTraceContext(ctx, w.Header())
+			if tracer.config.TraceHeader != "" && span.SpanContext().HasTraceID() {
+				w.Header().Set(tracer.config.TraceHeader, span.SpanContext().TraceID().String())
+			}
 
 			// Wrap response writer
 			wrapped := &tracingResponseWriter{
@@ -320,31 +464,93 @@ func TracingMiddleware(tracer *TracerManager) func(http.Handler) http.Handler {
 			}
 
 			// Process request
+			r = r.WithContext(ctx)
 			next.ServeHTTP(wrapped, r)
 
-			// Set span status based on response
-			if wrapped.statusCode >= 400 {
-				span.SetStatus(codes.Error, fmt.Sprintf("HTTP %d", wrapped.statusCode))
-			} else {
-				span.SetStatus(codes.Ok, "")
+			if route := routing.Pattern(r); route != "" {
+				span.SetName(r.Method + " " + route)
+				span.SetAttributes(semconv.HTTPRouteKey.String(route))
+			}
+			if tracer.identify != nil && span.IsRecording() {
+				if id, ok := tracer.identify(r); ok {
+					span.SetAttributes(semconv.EnduserIDKey.String(HashUserID(tracer.config.UserHashKey, id)))
+				}
 			}
 
-			// Add final attributes
+			// Only server errors fail a server span; 4xx are the client's
+			if wrapped.statusCode >= 500 {
+				span.SetStatus(codes.Error, fmt.Sprintf("HTTP %d", wrapped.statusCode))
+			}
 			span.SetAttributes(
 				semconv.HTTPStatusCodeKey.Int(wrapped.statusCode),
-				attribute.Int64("http.response_size", int64(wrapped.size)),
-				attribute.String("http.method", r.Method),
-				attribute.String("http.url", r.URL.String()),
-				attribute.String("http.user_agent", r.UserAgent()),
-				attribute.String("http.remote_addr", r.RemoteAddr),
+				semconv.HTTPResponseContentLengthKey.Int64(wrapped.size),
 			)
-
-			// Finish span
-			span.End()
 		})
 	}
 }
 
+// TracingTransport wraps an HTTP client transport, nil meaning
+// http.DefaultTransport, so each outgoing request gets a client span under
+// the span in its context and carries the trace to the server it calls. It
+// uses the global tracer provider, so it records nothing until a
+// TracerManager is created.
+func TracingTransport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &tracingTransport{base: base}
+}
+
+type tracingTransport struct {
+	base http.RoundTripper
+}
+
+func (t *tracingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	ctx, span := otel.Tracer(instrumentationName).Start(r.Context(), "HTTP "+r.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPMethodKey.String(r.Method),
+			semconv.HTTPURLKey.String(r.URL.Redacted()),
+			semconv.NetPeerNameKey.String(r.URL.Hostname()),
+		),
+	)
+	defer span.End()
+
+	// Requests must not be modified, so propagate on a copy
+	r = r.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(r.Header))
+
+	resp, err := t.base.RoundTrip(r)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(semconv.HTTPStatusCodeKey.Int(resp.StatusCode))
+	if resp.StatusCode >= 400 {
+		span.SetStatus(codes.Error, fmt.Sprintf("HTTP %d", resp.StatusCode))
+	}
+	return resp, nil
+}
+
+// CloseIdleConnections closes the wrapped transport's idle connections
+func (t *tracingTransport) CloseIdleConnections() {
+	if closer, ok := t.base.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// StartTemplateSpan starts the span of rendering the template name, which
+// server timing counts as template time. Like TracingTransport it uses the
+// global tracer provider.
+func StartTemplateSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, "template.render "+name,
+		trace.WithAttributes(attribute.String("template.name", name)))
+}
+
+// instrumentationName identifies spans created outside a TracerManager
+const instrumentationName = "github.com/mrhoseah/dolphin/internal/observability"
+
 // DatabaseTracingMiddleware creates database tracing middleware
 func DatabaseTracingMiddleware(tracer *TracerManager) func(string, string, func() error) error {
 	return func(operation, table string, fn func() error) error {
@@ -483,6 +689,17 @@ func TraceConfigFromEnv() *TraceConfig {
 	if sampler := os.Getenv("TRACE_SAMPLER"); sampler != "" {
 		config.Sampler = sampler
 	}
+	if ratio := os.Getenv("TRACE_SAMPLER_RATIO"); ratio != "" {
+		if r, err := strconv.ParseFloat(ratio, 64); err == nil {
+			config.Ratio = r
+		}
+	}
+	if otlpEndpoint := os.Getenv("TRACE_OTLP_ENDPOINT"); otlpEndpoint != "" {
+		config.OTLPEndpoint = otlpEndpoint
+	}
+	if otlpProtocol := os.Getenv("TRACE_OTLP_PROTOCOL"); otlpProtocol != "" {
+		config.OTLPProtocol = otlpProtocol
+	}
 	if jaegerEndpoint := os.Getenv("TRACE_JAEGER_ENDPOINT"); jaegerEndpoint != "" {
 		config.JaegerEndpoint = jaegerEndpoint
 	}
@@ -492,3 +709,27 @@ func TraceConfigFromEnv() *TraceConfig {
 
 	return config
 }
+
+// TraceConfigFromConfig creates trace config from the application config
+func TraceConfigFromConfig(cfg *config.Config) *TraceConfig {
+	tc := cfg.Tracing
+	config := DefaultTraceConfig()
+	config.Enabled = tc.Enabled
+	config.ServiceName = tc.ServiceName
+	if config.ServiceName == "" {
+		config.ServiceName = cfg.App.Name
+	}
+	config.Version = version.GetVersion()
+	config.Environment = cfg.App.Environment
+	config.Sampler = tc.Sampler
+	config.Ratio = tc.Ratio
+	config.Routes = tc.Routes
+	config.UserHashKey = cfg.App.Key
+	config.OTLPEndpoint = tc.OTLPEndpoint
+	config.OTLPProtocol = tc.OTLPProtocol
+	config.OTLPInsecure = tc.OTLPInsecure
+	config.OTLPHeaders = tc.OTLPHeaders
+	config.JaegerEndpoint = tc.JaegerEndpoint
+	config.ZipkinEndpoint = tc.ZipkinEndpoint
+	return config
+}
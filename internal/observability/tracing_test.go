@@ -0,0 +1,222 @@
+package observability
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/database"
+	"github.com/mrhoseah/dolphin/internal/tenancy"
+)
+
+func newTestTracer(t *testing.T, sampler string) (*TracerManager, *tracetest.InMemoryExporter) {
+	cfg := DefaultTraceConfig()
+	cfg.Sampler = sampler
+	exporter := tracetest.NewInMemoryExporter()
+	tm, err := NewTracerManagerWithExporter(cfg, exporter, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = tm.Shutdown(context.Background()) })
+	return tm, exporter
+}
+
+func spansByName(t *testing.T, tm *TracerManager, exporter *tracetest.InMemoryExporter) map[string]tracetest.SpanStub {
+	require.NoError(t, tm.ForceFlush(context.Background()))
+	spans := map[string]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	return spans
+}
+
+func TestRequestTrace(t *testing.T) {
+	tm, exporter := newTestTracer(t, "always_on")
+
+	db, err := database.New(&config.DatabaseConfig{Driver: "sqlite", Database: filepath.Join(t.TempDir(), "app.db")})
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, tm.InstrumentDB(db.GetDB()))
+	require.NoError(t, db.GetDB().AutoMigrate(&widget{}))
+
+	var propagated string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		propagated = r.Header.Get("traceparent")
+	}))
+	defer upstream.Close()
+	client := &http.Client{Transport: TracingTransport(nil)}
+
+	r := chi.NewRouter()
+	r.Use(TracingMiddleware(tm))
+	r.Get("/widgets/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var found widget
+		db.GetDB().WithContext(r.Context()).First(&found, chi.URLParam(r, "id"))
+
+		req, _ := http.NewRequestWithContext(r.Context(), http.MethodGet, upstream.URL, nil)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/widgets/7", nil)
+	// The caller's trace is continued
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", rec.Header().Get("X-Trace-Id"))
+
+	spans := spansByName(t, tm, exporter)
+	server, ok := spans["GET /widgets/{id}"]
+	require.True(t, ok, "server span is named by route")
+	assert.Equal(t, trace.SpanKindServer, server.SpanKind)
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent.SpanID().String())
+
+	query, ok := spans["query widgets"]
+	require.True(t, ok)
+	assert.Equal(t, server.SpanContext.SpanID(), query.Parent.SpanID())
+	assert.Contains(t, query.Attributes, semconvDBStatement(t, query))
+
+	outgoing, ok := spans["HTTP GET"]
+	require.True(t, ok)
+	assert.Equal(t, server.SpanContext.SpanID(), outgoing.Parent.SpanID())
+	assert.Contains(t, propagated, outgoing.SpanContext.SpanID().String())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", outgoing.SpanContext.TraceID().String())
+}
+
+// semconvDBStatement returns the query span's statement attribute after
+// checking bound values were left out
+func semconvDBStatement(t *testing.T, span tracetest.SpanStub) interface{} {
+	for _, attr := range span.Attributes {
+		if attr.Key == "db.statement" {
+			assert.Contains(t, attr.Value.AsString(), "?")
+			assert.NotContains(t, attr.Value.AsString(), "7")
+			return attr
+		}
+	}
+	t.Fatal("no db.statement attribute")
+	return nil
+}
+
+func TestSamplers(t *testing.T) {
+	for _, name := range []string{"always_on", "always_off", "traceidratio", "traceid_ratio", "parentbased_always_on", "parentbased_traceidratio"} {
+		_, err := NewSampler(name, 0.5, nil)
+		assert.NoError(t, err, name)
+	}
+	_, err := NewSampler("sometimes", 1, nil)
+	assert.Error(t, err)
+
+	// A parent-based sampler follows the caller even when it would drop
+	tm, exporter := newTestTracer(t, "parentbased_always_off")
+	r := chi.NewRouter()
+	r.Use(TracingMiddleware(tm))
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	require.NoError(t, tm.ForceFlush(context.Background()))
+	require.Len(t, exporter.GetSpans(), 1)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", exporter.GetSpans()[0].SpanContext.TraceID().String())
+}
+
+func TestRouteSpans(t *testing.T) {
+	cfg := DefaultTraceConfig()
+	cfg.Sampler = "parentbased_always_on"
+	cfg.Routes = map[string]float64{"/health": 0, "/Admin": 0, "/admin/reports/{id}": 1}
+	cfg.UserHashKey = "app-key"
+	exporter := tracetest.NewInMemoryExporter()
+	tm, err := NewTracerManagerWithExporter(cfg, exporter, nil)
+	require.NoError(t, err)
+	defer tm.Shutdown(context.Background())
+	tm.IdentifyUsers(func(r *http.Request) (string, bool) { return "42", r.Header.Get("Cookie") != "" })
+
+	r := chi.NewRouter()
+	r.Use(TracingMiddleware(tm))
+	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {})
+	r.Route("/admin", func(r chi.Router) {
+		r.Get("/users", func(w http.ResponseWriter, r *http.Request) {})
+		r.Get("/reports/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	})
+	r.Route("/t/{tenant}", func(r chi.Router) {
+		r.Use(tenancy.Middleware(tenancy.NewMemoryStore(&tenancy.Tenant{ID: "acme"}), tenancy.HeaderResolver{Header: "X-Tenant"}))
+		r.With(NameRoute("orders.show")).Get("/orders/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	})
+
+	for _, path := range []string{"/health", "/admin/users", "/admin/reports/9", "/t/acme/orders/17", "/missing/17"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-Tenant", "acme")
+		req.Header.Set("Cookie", "session=1")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	spans := spansByName(t, tm, exporter)
+	assert.Len(t, spans, 3, "/health and /admin/users are never sampled")
+	assert.Contains(t, spans, "GET /admin/reports/{id}", "the route's own ratio beats its prefix's")
+	assert.Contains(t, spans, "GET", "unmatched requests aren't named by URL")
+
+	order, ok := spans["GET /t/{tenant}/orders/{id}"]
+	require.True(t, ok)
+	attrs := map[attribute.Key]string{}
+	for _, attr := range order.Attributes {
+		attrs[attr.Key] = attr.Value.Emit()
+	}
+	assert.Equal(t, "/t/{tenant}/orders/{id}", attrs["http.route"])
+	assert.Equal(t, "orders.show", attrs[RouteNameKey])
+	assert.Equal(t, "acme", attrs[tenancy.TenantIDKey])
+	assert.Equal(t, HashUserID("app-key", "42"), attrs["enduser.id"])
+	assert.Len(t, attrs["enduser.id"], 32)
+	assert.NotEqual(t, HashUserID("", "42"), attrs["enduser.id"])
+
+	// http.ServeMux's patterns name spans too
+	exporter.Reset()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET example.com/items/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	TracingMiddleware(tm)(mux).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://example.com/items/5", nil))
+	assert.Contains(t, spansByName(t, tm, exporter), "GET /items/{id}")
+
+	_, err = NewSampler("always_on", 1, map[string]float64{"/health": 2})
+	assert.ErrorContains(t, err, "between 0 and 1")
+}
+
+func TestOTLPHTTPExport(t *testing.T) {
+	var path, contentType string
+	var body []byte
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, contentType = r.URL.Path, r.Header.Get("Content-Type")
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer collector.Close()
+
+	cfg := DefaultTraceConfig()
+	cfg.OTLPProtocol = "http"
+	cfg.OTLPEndpoint = collector.URL + "/v1/traces"
+	tm, err := NewTracerManager(cfg, nil)
+	require.NoError(t, err)
+	defer tm.Shutdown(context.Background())
+
+	_, span := tm.StartSpan(context.Background(), "exported")
+	span.End()
+	require.NoError(t, tm.ForceFlush(context.Background()))
+
+	assert.Equal(t, "/v1/traces", path)
+	assert.Equal(t, "application/x-protobuf", contentType)
+	assert.Contains(t, string(body), "exported")
+
+	cfg.OTLPProtocol = "thrift"
+	_, err = NewTracerManager(cfg, nil)
+	assert.ErrorContains(t, err, "unknown OTLP protocol")
+}
+
+var _ sdktrace.SpanExporter = (*MultiSpanExporter)(nil)
@@ -0,0 +1,184 @@
+// Package observers reacts to models being written without GORM hooks on
+// the models themselves. An observer is any value with some of the methods
+// Created, Updated, Deleted and Restored, taking the model:
+//
+//	type UserObserver struct{}
+//
+//	func (UserObserver) Created(ctx context.Context, user *models.User) error {
+//		return mail.Send(ctx, welcome(user))
+//	}
+//
+//	observers.Register[models.User](UserObserver{})
+//
+// The router installs the Plugin on the application database. It publishes
+// Created[T], Updated[T], Deleted[T] and Restored[T] on the event bus once
+// a write commits, for the models of types that have observers. Observers are
+// subscribers of those events, so other code can subscribe to them too.
+//
+// Events are published for models written as values: Create(&user),
+// Save(&user), Model(&user).Updates(...), Delete(&user). Writes by
+// condition, such as Delete(&User{}, id) or Where(...).Updates(...),
+// change rows rather than models and publish nothing; load the model
+// first when it must be observed.
+package observers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/mrhoseah/dolphin/internal/bus"
+)
+
+// Created is published after a model is inserted
+type Created[T any] struct{ Model *T }
+
+// Updated is published after a model is updated, other than by restoring
+// it
+type Updated[T any] struct{ Model *T }
+
+// Deleted is published after a model is deleted, softly or not
+type Deleted[T any] struct{ Model *T }
+
+// Restored is published after a soft-deleted model's deletion mark is
+// cleared
+type Restored[T any] struct{ Model *T }
+
+// EventName names events when bridged to the event dispatcher, such as
+// blog_post.created
+func (Created[T]) EventName() string  { return eventName[T]("created") }
+func (Updated[T]) EventName() string  { return eventName[T]("updated") }
+func (Deleted[T]) EventName() string  { return eventName[T]("deleted") }
+func (Restored[T]) EventName() string { return eventName[T]("restored") }
+
+// CreatedObserver reacts to models of type T being created
+type CreatedObserver[T any] interface {
+	Created(ctx context.Context, model *T) error
+}
+
+// UpdatedObserver reacts to models of type T being updated
+type UpdatedObserver[T any] interface {
+	Updated(ctx context.Context, model *T) error
+}
+
+// DeletedObserver reacts to models of type T being deleted
+type DeletedObserver[T any] interface {
+	Deleted(ctx context.Context, model *T) error
+}
+
+// RestoredObserver reacts to soft-deleted models of type T being restored
+type RestoredObserver[T any] interface {
+	Restored(ctx context.Context, model *T) error
+}
+
+// kind is what happened to a model
+type kind int
+
+const (
+	created kind = iota
+	updated
+	deleted
+	restored
+)
+
+// publisher publishes the event of a kind for a model of its type
+type publisher func(ctx context.Context, b *bus.Bus, k kind, model interface{}) error
+
+var (
+	mu         sync.RWMutex
+	publishers = map[reflect.Type]publisher{}
+)
+
+// Register subscribes observer to the events of models of type T on the
+// default bus. It panics when observer has none of the observer methods
+// for T. The returned function unsubscribes it.
+func Register[T any](observer interface{}) (unregister func()) {
+	return RegisterOn[T](bus.Default, observer)
+}
+
+// RegisterOn subscribes observer to the events of models of type T on b
+func RegisterOn[T any](b *bus.Bus, observer interface{}) (unregister func()) {
+	var unsubscribe []func()
+	if o, ok := observer.(CreatedObserver[T]); ok {
+		unsubscribe = append(unsubscribe, bus.SubscribeTo(b, func(ctx context.Context, e Created[T]) error {
+			return o.Created(ctx, e.Model)
+		}))
+	}
+	if o, ok := observer.(UpdatedObserver[T]); ok {
+		unsubscribe = append(unsubscribe, bus.SubscribeTo(b, func(ctx context.Context, e Updated[T]) error {
+			return o.Updated(ctx, e.Model)
+		}))
+	}
+	if o, ok := observer.(DeletedObserver[T]); ok {
+		unsubscribe = append(unsubscribe, bus.SubscribeTo(b, func(ctx context.Context, e Deleted[T]) error {
+			return o.Deleted(ctx, e.Model)
+		}))
+	}
+	if o, ok := observer.(RestoredObserver[T]); ok {
+		unsubscribe = append(unsubscribe, bus.SubscribeTo(b, func(ctx context.Context, e Restored[T]) error {
+			return o.Restored(ctx, e.Model)
+		}))
+	}
+	if len(unsubscribe) == 0 {
+		panic(fmt.Sprintf("observers: %T has no Created, Updated, Deleted or Restored method for *%s", observer, reflect.TypeFor[T]()))
+	}
+	Observe[T]()
+
+	return func() {
+		for _, fn := range unsubscribe {
+			fn()
+		}
+	}
+}
+
+// Observe has the plugin publish the events of models of type T, for
+// subscribers that aren't registered observers
+func Observe[T any]() {
+	mu.Lock()
+	defer mu.Unlock()
+	publishers[reflect.TypeFor[T]()] = func(ctx context.Context, b *bus.Bus, k kind, model interface{}) error {
+		m, ok := model.(*T)
+		if !ok {
+			value := model.(T)
+			m = &value
+		}
+		switch k {
+		case created:
+			return b.Publish(ctx, Created[T]{Model: m})
+		case updated:
+			return b.Publish(ctx, Updated[T]{Model: m})
+		case deleted:
+			return b.Publish(ctx, Deleted[T]{Model: m})
+		default:
+			return b.Publish(ctx, Restored[T]{Model: m})
+		}
+	}
+}
+
+// publisherFor returns the publisher of an observed model type
+func publisherFor(t reflect.Type) (publisher, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	p, ok := publishers[t]
+	return p, ok
+}
+
+// eventName returns the snake_cased name of T with an action, such as
+// blog_post.created
+func eventName[T any](action string) string {
+	var b strings.Builder
+	name := []rune(reflect.TypeFor[T]().Name())
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(name[i-1]) || i+1 < len(name) && unicode.IsLower(name[i+1])) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String() + "." + action
+}
@@ -0,0 +1,118 @@
+package observers
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/mrhoseah/dolphin/internal/bus"
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/database"
+)
+
+type BlogPost struct {
+	gorm.Model
+	Title string
+}
+
+type Comment struct {
+	ID   uint
+	Body string
+}
+
+// recorder is a BlogPost observer recording what happened to which post
+type recorder struct {
+	seen *[]string
+}
+
+func (o recorder) Created(ctx context.Context, post *BlogPost) error {
+	*o.seen = append(*o.seen, "created "+post.Title)
+	return nil
+}
+
+func (o recorder) Updated(ctx context.Context, post *BlogPost) error {
+	*o.seen = append(*o.seen, "updated "+post.Title)
+	return nil
+}
+
+func (o recorder) Deleted(ctx context.Context, post *BlogPost) error {
+	*o.seen = append(*o.seen, "deleted "+post.Title)
+	return errors.New("logged, not returned")
+}
+
+func (o recorder) Restored(ctx context.Context, post *BlogPost) error {
+	*o.seen = append(*o.seen, "restored "+post.Title)
+	return nil
+}
+
+func newTestDB(t *testing.T, b *bus.Bus) *gorm.DB {
+	manager, err := database.New(&config.DatabaseConfig{Driver: "sqlite", Database: filepath.Join(t.TempDir(), "app.db")})
+	require.NoError(t, err)
+	db := manager.GetDB()
+	require.NoError(t, db.Use(&Plugin{bus: b}))
+	require.NoError(t, db.AutoMigrate(&BlogPost{}, &Comment{}))
+	return db
+}
+
+func TestObserverLifecycle(t *testing.T) {
+	b := bus.New()
+	db := newTestDB(t, b)
+	var seen []string
+	unregister := RegisterOn[BlogPost](b, recorder{seen: &seen})
+
+	post := BlogPost{Title: "Hello"}
+	require.NoError(t, db.Create(&post).Error)
+	require.NoError(t, db.Model(&post).Update("title", "Hello, world").Error)
+	require.NoError(t, db.Delete(&post).Error)
+	require.NoError(t, db.Unscoped().Model(&post).Update("deleted_at", nil).Error)
+	assert.Equal(t, []string{"created Hello", "updated Hello, world", "deleted Hello, world", "restored Hello, world"}, seen)
+
+	unregister()
+	require.NoError(t, db.Save(&post).Error)
+	assert.Len(t, seen, 4, "unregistered")
+}
+
+func TestWritesByConditionPublishNothing(t *testing.T) {
+	b := bus.New()
+	db := newTestDB(t, b)
+	var seen []string
+	RegisterOn[BlogPost](b, recorder{seen: &seen})
+
+	posts := []BlogPost{{Title: "One"}, {Title: "Two"}}
+	require.NoError(t, db.Create(&posts).Error)
+	assert.Equal(t, []string{"created One", "created Two"}, seen, "each model of a batch")
+
+	seen = nil
+	require.NoError(t, db.Model(&BlogPost{}).Where("title = ?", "One").Update("title", "Uno").Error)
+	require.NoError(t, db.Delete(&BlogPost{}, posts[1].ID).Error)
+	require.NoError(t, db.Model(&BlogPost{}).Where("id = ?", 999).Update("title", "missing").Error)
+	assert.Empty(t, seen)
+}
+
+func TestSubscribersOfObservedTypes(t *testing.T) {
+	b := bus.New()
+	db := newTestDB(t, b)
+	var names []string
+	bus.SubscribeTo(b, func(ctx context.Context, e Created[Comment]) error {
+		names = append(names, e.EventName())
+		return nil
+	})
+
+	require.NoError(t, db.Create(&Comment{Body: "unobserved"}).Error)
+	assert.Empty(t, names)
+
+	Observe[Comment]()
+	require.NoError(t, db.Create(&Comment{Body: "observed"}).Error)
+	assert.Equal(t, []string{"comment.created"}, names)
+	assert.Equal(t, "blog_post.restored", Restored[BlogPost]{}.EventName())
+}
+
+func TestRegisterRequiresObserverMethods(t *testing.T) {
+	assert.Panics(t, func() { Register[BlogPost](struct{}{}) })
+	assert.Panics(t, func() { Register[Comment](recorder{}) }, "methods for another model")
+}
@@ -0,0 +1,150 @@
+package observers
+
+import (
+	"context"
+	"database/sql/driver"
+	"log"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+
+	"github.com/mrhoseah/dolphin/internal/bus"
+)
+
+const pluginName = "dolphin:observers"
+
+// Plugin publishes the events of observed models after each write
+// commits. The write has committed, so observer errors are logged rather
+// than returned.
+type Plugin struct {
+	bus *bus.Bus
+}
+
+var _ gorm.Plugin = (*Plugin)(nil)
+
+// NewPlugin creates a plugin publishing on the default bus
+func NewPlugin() *Plugin {
+	return &Plugin{bus: bus.Default}
+}
+
+// Name implements gorm.Plugin
+func (p *Plugin) Name() string {
+	return pluginName
+}
+
+// Initialize implements gorm.Plugin
+func (p *Plugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Create().After("gorm:commit_or_rollback_transaction").Register(pluginName+"_create", p.created); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:commit_or_rollback_transaction").Register(pluginName+"_update", p.updated); err != nil {
+		return err
+	}
+	return cb.Delete().After("gorm:commit_or_rollback_transaction").Register(pluginName+"_delete", p.deleted)
+}
+
+func (p *Plugin) created(db *gorm.DB) {
+	p.dispatch(db, created)
+}
+
+func (p *Plugin) updated(db *gorm.DB) {
+	if db.Statement.Schema != nil && restoring(db) {
+		p.dispatch(db, restored)
+		return
+	}
+	p.dispatch(db, updated)
+}
+
+func (p *Plugin) deleted(db *gorm.DB) {
+	p.dispatch(db, deleted)
+}
+
+// dispatch publishes an event for each observed model a write changed.
+// Models without a primary key, as in writes by condition, are skipped.
+func (p *Plugin) dispatch(db *gorm.DB, k kind) {
+	s := db.Statement.Schema
+	if db.Error != nil || s == nil || db.RowsAffected == 0 {
+		return
+	}
+	publish, ok := publisherFor(s.ModelType)
+	if !ok {
+		return
+	}
+	ctx := db.Statement.Context
+	eachModel(db.Statement.ReflectValue, s.ModelType, func(value reflect.Value, model interface{}) {
+		if !hasPrimaryKey(ctx, s, value) {
+			return
+		}
+		if err := publish(ctx, p.bus, k, model); err != nil {
+			log.Printf("observers: %s observer failed: %v", s.ModelType, err)
+		}
+	})
+}
+
+// restoring reports whether an update clears the soft-delete column, as in
+// Unscoped().Model(&user).Update("deleted_at", nil)
+func restoring(db *gorm.DB) bool {
+	values, ok := db.Statement.Dest.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	for name, value := range values {
+		field := db.Statement.Schema.LookUpField(name)
+		if field != nil && field.FieldType == reflect.TypeOf(gorm.DeletedAt{}) {
+			return isNull(value)
+		}
+	}
+	return false
+}
+
+// isNull reports whether a value is written as NULL
+func isNull(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	if valuer, ok := value.(driver.Valuer); ok {
+		v, err := valuer.Value()
+		return err == nil && v == nil
+	}
+	rv := reflect.ValueOf(value)
+	return rv.Kind() == reflect.Ptr && rv.IsNil()
+}
+
+// eachModel calls fn with each model of type t in value, a model, a
+// pointer to one or a slice of either
+func eachModel(value reflect.Value, t reflect.Type, fn func(value reflect.Value, model interface{})) {
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !value.IsNil() {
+			eachModel(value.Elem(), t, fn)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			eachModel(value.Index(i), t, fn)
+		}
+	case reflect.Struct:
+		if value.Type() != t {
+			return
+		}
+		model := value.Interface()
+		if value.CanAddr() {
+			model = value.Addr().Interface()
+		}
+		fn(value, model)
+	}
+}
+
+// hasPrimaryKey reports whether a model's primary key is set
+func hasPrimaryKey(ctx context.Context, s *schema.Schema, value reflect.Value) bool {
+	if len(s.PrimaryFields) == 0 {
+		return false
+	}
+	for _, field := range s.PrimaryFields {
+		if _, zero := field.ValueOf(ctx, value); zero {
+			return false
+		}
+	}
+	return true
+}
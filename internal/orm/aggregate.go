@@ -0,0 +1,42 @@
+package orm
+
+// Aggregate is implemented by models that record domain events while they
+// change. The outbox stores an aggregate's events in the transaction that
+// saves it and publishes them once that transaction commits.
+type Aggregate interface {
+	PendingEvents() []interface{}
+	ClearEvents()
+}
+
+// AggregateRoot is embedded in models to record domain events:
+//
+//	type Order struct {
+//		orm.BaseModel
+//		orm.AggregateRoot
+//		Status string
+//	}
+//
+//	func (o *Order) Ship() {
+//		o.Status = "shipped"
+//		o.RecordEvent(OrderShipped{OrderID: o.ID})
+//	}
+//
+// Events are held in memory and never stored as columns of the model.
+type AggregateRoot struct {
+	events []interface{}
+}
+
+// RecordEvent records event to be published after the model is saved
+func (a *AggregateRoot) RecordEvent(event interface{}) {
+	a.events = append(a.events, event)
+}
+
+// PendingEvents returns the events recorded since the model was last saved
+func (a *AggregateRoot) PendingEvents() []interface{} {
+	return a.events
+}
+
+// ClearEvents forgets the recorded events
+func (a *AggregateRoot) ClearEvents() {
+	a.events = nil
+}
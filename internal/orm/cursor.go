@@ -0,0 +1,255 @@
+package orm
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// ErrInvalidCursor is returned when a cursor cannot be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// MaxCursorLimit caps the page size of a keyset page, whatever the caller asks for
+const MaxCursorLimit = 100
+
+// CursorParams describes a keyset pagination request
+type CursorParams struct {
+	After   string // Opaque cursor to continue forwards from
+	Before  string // Opaque cursor to continue backwards from
+	Limit   int    // Defaults to 15, capped at MaxCursorLimit
+	OrderBy string // Column to order by; ties are broken by the primary key
+	Desc    bool
+}
+
+// CursorResult is a single keyset page
+type CursorResult[T any] struct {
+	Data       []T      `json:"data"`
+	Cursors    []string `json:"-"` // Cursor for each item, for GraphQL edges
+	NextCursor string   `json:"next_cursor,omitempty"`
+	PrevCursor string   `json:"prev_cursor,omitempty"`
+	HasNext    bool     `json:"has_next"`
+	HasPrev    bool     `json:"has_prev"`
+	Limit      int      `json:"limit"`
+}
+
+// cursorPayload is the decoded form of an opaque cursor
+type cursorPayload struct {
+	Order string      `json:"o"`
+	Value interface{} `json:"v"`
+	Key   interface{} `json:"k"`
+}
+
+// EncodeCursor encodes an order value and primary key into an opaque cursor
+func EncodeCursor(orderBy string, value, key interface{}) string {
+	data, _ := json.Marshal(cursorPayload{Order: orderBy, Value: value, Key: key})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor decodes an opaque cursor
+func decodeCursor(cursor string) (*cursorPayload, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var payload cursorPayload
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&payload); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &payload, nil
+}
+
+// CursorPaginate returns a keyset page from the repository
+func (r *Repository[T]) CursorPaginate(ctx context.Context, params CursorParams) (*CursorResult[T], error) {
+	return CursorPaginate[T](r.db.WithContext(ctx), params)
+}
+
+// CursorListParams filter and keyset paginate a listing; query.Params
+// parses them from a request's query string
+type CursorListParams interface {
+	ApplyFiltersAndFields(db *gorm.DB) *gorm.DB
+	Cursor() CursorParams
+}
+
+// CursorList returns a filtered keyset page of records
+func (r *Repository[T]) CursorList(ctx context.Context, params CursorListParams) (*CursorResult[T], error) {
+	return CursorPaginate[T](params.ApplyFiltersAndFields(r.db.WithContext(ctx)), params.Cursor())
+}
+
+// CursorPaginate runs a keyset paginated query on db, which may already
+// carry filters. Results are ordered by params.OrderBy and the primary key,
+// so pages stay stable on large tables where OFFSET degrades.
+func CursorPaginate[T any](db *gorm.DB, params CursorParams) (*CursorResult[T], error) {
+	if params.Limit <= 0 {
+		params.Limit = 15
+	}
+	if params.Limit > MaxCursorLimit {
+		params.Limit = MaxCursorLimit
+	}
+
+	var model T
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(&model); err != nil {
+		return nil, err
+	}
+	if stmt.Schema.PrioritizedPrimaryField == nil {
+		return nil, fmt.Errorf("cursor pagination requires a primary key")
+	}
+	pk := stmt.Schema.PrioritizedPrimaryField
+
+	orderField := pk
+	if params.OrderBy != "" && params.OrderBy != pk.DBName {
+		orderField = stmt.Schema.LookUpField(params.OrderBy)
+		if orderField == nil {
+			return nil, fmt.Errorf("unknown cursor column %q", params.OrderBy)
+		}
+	}
+
+	backward := params.Before != "" && params.After == ""
+	raw := params.After
+	if backward {
+		raw = params.Before
+	}
+
+	// Walking backwards flips the order, the result is reversed afterwards
+	desc := params.Desc != backward
+	direction, cmp := "ASC", ">"
+	if desc {
+		direction, cmp = "DESC", "<"
+	}
+
+	query := db.Model(&model)
+	if raw != "" {
+		payload, err := decodeCursor(raw)
+		if err != nil {
+			return nil, err
+		}
+		if payload.Order != orderField.DBName {
+			return nil, ErrInvalidCursor
+		}
+		key, err := cursorValue(pk, payload.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		if orderField == pk {
+			query = query.Where(fmt.Sprintf("%s %s ?", pk.DBName, cmp), key)
+		} else {
+			value, err := cursorValue(orderField, payload.Value)
+			if err != nil {
+				return nil, err
+			}
+			query = query.Where(
+				fmt.Sprintf("((%s %s ?) OR (%s = ? AND %s %s ?))", orderField.DBName, cmp, orderField.DBName, pk.DBName, cmp),
+				value, value, key,
+			)
+		}
+	}
+
+	if orderField != pk {
+		query = query.Order(fmt.Sprintf("%s %s", orderField.DBName, direction))
+	}
+	query = query.Order(fmt.Sprintf("%s %s", pk.DBName, direction))
+
+	var items []T
+	if err := query.Limit(params.Limit + 1).Find(&items).Error; err != nil {
+		return nil, err
+	}
+
+	more := len(items) > params.Limit
+	if more {
+		items = items[:params.Limit]
+	}
+	if backward {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+
+	result := &CursorResult[T]{
+		Data:    items,
+		Cursors: make([]string, len(items)),
+		Limit:   params.Limit,
+	}
+	for i := range items {
+		rv := reflect.ValueOf(&items[i]).Elem()
+		keyValue, _ := pk.ValueOf(db.Statement.Context, rv)
+		orderValue, _ := orderField.ValueOf(db.Statement.Context, rv)
+		result.Cursors[i] = EncodeCursor(orderField.DBName, orderValue, keyValue)
+	}
+
+	if backward {
+		result.HasPrev = more
+		result.HasNext = true
+	} else {
+		result.HasNext = more
+		result.HasPrev = raw != ""
+	}
+	if len(items) > 0 {
+		if result.HasNext {
+			result.NextCursor = result.Cursors[len(items)-1]
+		}
+		if result.HasPrev {
+			result.PrevCursor = result.Cursors[0]
+		}
+	}
+	return result, nil
+}
+
+// cursorValue converts a decoded JSON value back into the column's Go type
+// so drivers bind it the same way they bind the stored value
+func cursorValue(field *schema.Field, value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	target := field.FieldType
+	for target.Kind() == reflect.Ptr {
+		target = target.Elem()
+	}
+
+	switch v := value.(type) {
+	case json.Number:
+		switch target.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n, err := v.Int64()
+			if err != nil {
+				return nil, ErrInvalidCursor
+			}
+			return n, nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			n, err := v.Int64()
+			if err != nil || n < 0 {
+				return nil, ErrInvalidCursor
+			}
+			return uint64(n), nil
+		default:
+			f, err := v.Float64()
+			if err != nil {
+				return nil, ErrInvalidCursor
+			}
+			return f, nil
+		}
+	case string:
+		if target == reflect.TypeOf(time.Time{}) {
+			t, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				return nil, ErrInvalidCursor
+			}
+			return t, nil
+		}
+		return v, nil
+	default:
+		return v, nil
+	}
+}
@@ -0,0 +1,146 @@
+package orm
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ids(articles []article) []uint {
+	var result []uint
+	for _, a := range articles {
+		result = append(result, a.ID)
+	}
+	return result
+}
+
+func TestCursorPaginate(t *testing.T) {
+	_, repo := newArticles(t, 7)
+	ctx := context.Background()
+
+	first, err := repo.CursorPaginate(ctx, CursorParams{Limit: 3})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a1", "a2", "a3"}, titles(first.Data))
+	assert.True(t, first.HasNext)
+	assert.False(t, first.HasPrev)
+	assert.Empty(t, first.PrevCursor)
+	assert.Len(t, first.Cursors, 3)
+
+	second, err := repo.CursorPaginate(ctx, CursorParams{Limit: 3, After: first.NextCursor})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a4", "a5", "a6"}, titles(second.Data))
+	assert.True(t, second.HasNext)
+	assert.True(t, second.HasPrev)
+
+	last, err := repo.CursorPaginate(ctx, CursorParams{Limit: 3, After: second.NextCursor})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a7"}, titles(last.Data))
+	assert.False(t, last.HasNext)
+	assert.Empty(t, last.NextCursor)
+
+	// Walking backwards returns the page in the requested order
+	back, err := repo.CursorPaginate(ctx, CursorParams{Limit: 3, Before: last.PrevCursor})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a4", "a5", "a6"}, titles(back.Data))
+	assert.True(t, back.HasPrev)
+	assert.True(t, back.HasNext)
+
+	back, err = repo.CursorPaginate(ctx, CursorParams{Limit: 3, Before: back.PrevCursor})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a1", "a2", "a3"}, titles(back.Data))
+	assert.False(t, back.HasPrev, "nothing before the first row")
+	assert.Empty(t, back.PrevCursor)
+
+	desc, err := repo.CursorPaginate(ctx, CursorParams{Limit: 3, Desc: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a7", "a6", "a5"}, titles(desc.Data))
+	desc, err = repo.CursorPaginate(ctx, CursorParams{Limit: 3, Desc: true, After: desc.NextCursor})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a4", "a3", "a2"}, titles(desc.Data))
+}
+
+func TestCursorPaginateBreaksTiesByPrimaryKey(t *testing.T) {
+	db, repo := newArticles(t, 5)
+	ctx := context.Background()
+	require.NoError(t, db.Model(&article{}).Where("id IN ?", []uint{2, 3, 4}).Update("title", "same").Error)
+
+	var pages [][]uint
+	params := CursorParams{Limit: 2, OrderBy: "title"}
+	for {
+		page, err := repo.CursorPaginate(ctx, params)
+		require.NoError(t, err)
+		pages = append(pages, ids(page.Data))
+		if !page.HasNext {
+			break
+		}
+		params.After = page.NextCursor
+	}
+	assert.Equal(t, [][]uint{{1, 5}, {2, 3}, {4}}, pages, "rows sharing a title are neither skipped nor repeated")
+
+	last, err := repo.CursorPaginate(ctx, CursorParams{Limit: 2, OrderBy: "title", After: params.After})
+	require.NoError(t, err)
+	back, err := repo.CursorPaginate(ctx, CursorParams{Limit: 2, OrderBy: "title", Before: last.PrevCursor})
+	require.NoError(t, err)
+	assert.Equal(t, []uint{2, 3}, ids(back.Data))
+}
+
+func TestCursorPaginateByTime(t *testing.T) {
+	db, repo := newArticles(t, 5)
+	ctx := context.Background()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for id, hours := range map[uint]int{1: 0, 2: 1, 3: 2, 4: 2, 5: 3} {
+		require.NoError(t, db.Model(&article{}).Where("id = ?", id).UpdateColumn("created_at", base.Add(time.Duration(hours)*time.Hour)).Error)
+	}
+
+	first, err := repo.CursorPaginate(ctx, CursorParams{Limit: 2, OrderBy: "created_at", Desc: true})
+	require.NoError(t, err)
+	assert.Equal(t, []uint{5, 4}, ids(first.Data))
+
+	second, err := repo.CursorPaginate(ctx, CursorParams{Limit: 2, OrderBy: "created_at", Desc: true, After: first.NextCursor})
+	require.NoError(t, err)
+	assert.Equal(t, []uint{3, 2}, ids(second.Data), "the time in the cursor decodes back into a comparable value")
+
+	back, err := repo.CursorPaginate(ctx, CursorParams{Limit: 2, OrderBy: "created_at", Desc: true, Before: second.PrevCursor})
+	require.NoError(t, err)
+	assert.Equal(t, []uint{5, 4}, ids(back.Data))
+}
+
+func TestCursorPaginateRejectsBadCursors(t *testing.T) {
+	_, repo := newArticles(t, 3)
+	ctx := context.Background()
+
+	byID, err := repo.CursorPaginate(ctx, CursorParams{Limit: 1})
+	require.NoError(t, err)
+	_, err = repo.CursorPaginate(ctx, CursorParams{Limit: 1, OrderBy: "title", After: byID.NextCursor})
+	assert.ErrorIs(t, err, ErrInvalidCursor, "a cursor for another order")
+
+	_, err = repo.CursorPaginate(ctx, CursorParams{After: "not a cursor!"})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+	_, err = repo.CursorPaginate(ctx, CursorParams{After: EncodeCursor("id", -1, -1)})
+	assert.ErrorIs(t, err, ErrInvalidCursor, "a negative key for an unsigned primary key")
+	_, err = repo.CursorPaginate(ctx, CursorParams{After: EncodeCursor("created_at", "yesterday", 1), OrderBy: "created_at"})
+	assert.ErrorIs(t, err, ErrInvalidCursor, "a time that doesn't parse")
+
+	page, err := repo.CursorPaginate(ctx, CursorParams{After: EncodeCursor("id", 1, 1)})
+	require.NoError(t, err)
+	assert.Equal(t, []uint{2, 3}, ids(page.Data))
+}
+
+func TestCursorPaginateCapsTheLimit(t *testing.T) {
+	db, repo := newArticles(t, 0)
+	batch := make([]article, MaxCursorLimit+1)
+	for i := range batch {
+		batch[i].Title = fmt.Sprintf("a%d", i+1)
+	}
+	require.NoError(t, db.CreateInBatches(batch, 50).Error)
+
+	page, err := repo.CursorPaginate(context.Background(), CursorParams{Limit: 10000})
+	require.NoError(t, err)
+	assert.Len(t, page.Data, MaxCursorLimit)
+	assert.Equal(t, MaxCursorLimit, page.Limit)
+	assert.True(t, page.HasNext)
+}
@@ -0,0 +1,143 @@
+package orm
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Prunable is implemented by soft-deleting models whose deleted rows should
+// be permanently removed once they are older than the retention period
+type Prunable interface {
+	Model
+	PruneAfter() time.Duration
+}
+
+// PruneScoper optionally narrows which soft-deleted rows are pruned
+type PruneScoper interface {
+	PruneQuery(db *gorm.DB) *gorm.DB
+}
+
+// PruneResult reports how many rows were removed from a table
+type PruneResult struct {
+	Table   string        `json:"table"`
+	Deleted int64         `json:"deleted"`
+	After   time.Duration `json:"after"`
+}
+
+// pruneChunkSize bounds how many rows are deleted per statement so large
+// backlogs don't hold long locks
+const pruneChunkSize = 1000
+
+var (
+	prunablesMu sync.RWMutex
+	prunables   = map[string]Prunable{}
+)
+
+// RegisterPrunable registers models for PruneAll, keyed by table name
+func RegisterPrunable(models ...Prunable) {
+	prunablesMu.Lock()
+	defer prunablesMu.Unlock()
+	for _, m := range models {
+		prunables[m.TableName()] = m
+	}
+}
+
+// Prunables returns the registered prunable models sorted by table name
+func Prunables() []Prunable {
+	prunablesMu.RLock()
+	defer prunablesMu.RUnlock()
+
+	result := make([]Prunable, 0, len(prunables))
+	for _, m := range prunables {
+		result = append(result, m)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].TableName() < result[j].TableName()
+	})
+	return result
+}
+
+// Prune permanently deletes soft-deleted rows of model older than its retention
+func Prune(ctx context.Context, db *gorm.DB, model Prunable) (PruneResult, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return PruneResult{Table: model.TableName(), After: model.PruneAfter()}, err
+	}
+	pk := stmt.Schema.PrioritizedPrimaryField
+	if pk == nil {
+		return PruneResult{Table: model.TableName(), After: model.PruneAfter()}, fmt.Errorf("pruning %s requires a primary key", model.TableName())
+	}
+
+	scope := func(tx *gorm.DB) *gorm.DB { return tx }
+	if scoper, ok := model.(PruneScoper); ok {
+		scope = scoper.PruneQuery
+	}
+	return pruneTable(ctx, db, model.TableName(), pk.DBName, model.PruneAfter(), scope)
+}
+
+// PruneTable permanently deletes soft-deleted rows of table older than after.
+// It is used for tables configured outside of the model registry, and
+// expects the primary key in an id column of any type.
+func PruneTable(ctx context.Context, db *gorm.DB, table string, after time.Duration) (PruneResult, error) {
+	return pruneTable(ctx, db, table, "id", after, func(tx *gorm.DB) *gorm.DB { return tx })
+}
+
+// PruneAll prunes every registered model, continuing past failures
+func PruneAll(ctx context.Context, db *gorm.DB) ([]PruneResult, error) {
+	var results []PruneResult
+	var firstErr error
+	for _, model := range Prunables() {
+		result, err := Prune(ctx, db, model)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		results = append(results, result)
+	}
+	return results, firstErr
+}
+
+// pruneTable deletes expired rows in chunks by their key column
+func pruneTable(ctx context.Context, db *gorm.DB, table, key string, after time.Duration, scope func(*gorm.DB) *gorm.DB) (PruneResult, error) {
+	result := PruneResult{Table: table, After: after}
+	if after <= 0 {
+		return result, fmt.Errorf("prune retention for %s must be positive", table)
+	}
+
+	cutoff := time.Now().Add(-after)
+	// The table and key are bound as clauses so the dialect quotes them
+	from, column := clause.Table{Name: table}, clause.Column{Name: key}
+	for {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		// Keys are scanned untyped so UUID and string keys work as well
+		var ids []interface{}
+		err := scope(db.WithContext(ctx).Table("?", from)).
+			Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+			Limit(pruneChunkSize).
+			Pluck(key, &ids).Error
+		if err != nil {
+			return result, err
+		}
+		if len(ids) == 0 {
+			return result, nil
+		}
+
+		deleted := db.WithContext(ctx).Exec("DELETE FROM ? WHERE ? IN ?", from, column, ids)
+		if deleted.Error != nil {
+			return result, deleted.Error
+		}
+		result.Deleted += deleted.RowsAffected
+
+		if len(ids) < pruneChunkSize {
+			return result, nil
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package orm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// expiringArticle prunes deleted articles after a day, except those titled
+// keep
+type expiringArticle struct {
+	BaseModel
+	Title string
+}
+
+func (expiringArticle) TableName() string { return "articles" }
+
+func (expiringArticle) PruneAfter() time.Duration { return 24 * time.Hour }
+
+func (expiringArticle) PruneQuery(db *gorm.DB) *gorm.DB {
+	return db.Where("title <> ?", "keep")
+}
+
+// note is keyed by a UUID string
+type note struct {
+	ID        string `gorm:"primaryKey"`
+	DeletedAt gorm.DeletedAt
+}
+
+func (note) TableName() string { return "notes" }
+
+func (note) PruneAfter() time.Duration { return 24 * time.Hour }
+
+// orderRow lives in a table named by a reserved word
+type orderRow struct {
+	ID        uint `gorm:"primaryKey"`
+	DeletedAt gorm.DeletedAt
+}
+
+func (orderRow) TableName() string { return "order" }
+
+// deleteAt soft deletes the rows of model matching ids at the given time
+func deleteAt(t *testing.T, db *gorm.DB, model interface{}, at time.Time, ids ...interface{}) {
+	t.Helper()
+	require.NoError(t, db.Unscoped().Model(model).Where("id IN ?", ids).UpdateColumn("deleted_at", at).Error)
+}
+
+func TestPrune(t *testing.T) {
+	db, _ := newArticles(t, 0)
+	ctx := context.Background()
+	old, recent := time.Now().Add(-48*time.Hour), time.Now().Add(-time.Hour)
+
+	for _, title := range []string{"old", "keep", "recent", "live"} {
+		require.NoError(t, db.Create(&expiringArticle{Title: title}).Error)
+	}
+	deleteAt(t, db, &article{}, old, 1, 2)
+	deleteAt(t, db, &article{}, recent, 3)
+
+	result, err := Prune(ctx, db, expiringArticle{})
+	require.NoError(t, err)
+	assert.Equal(t, PruneResult{Table: "articles", Deleted: 1, After: 24 * time.Hour}, result)
+	var left []article
+	require.NoError(t, db.Unscoped().Order("id").Find(&left).Error)
+	assert.Equal(t, []string{"keep", "recent", "live"}, titles(left), "only old deletions outside the scope go")
+
+	require.NoError(t, db.AutoMigrate(&note{}))
+	ids := []interface{}{
+		"0f8fad5b-d9cb-469f-a165-70867728950e",
+		"7c9e6679-7425-40de-944b-e07fc1f90ae7",
+		"9b2f4c1e-3a5d-4e8f-9c0b-1d2e3f4a5b6c",
+	}
+	for _, id := range ids {
+		require.NoError(t, db.Create(&note{ID: id.(string)}).Error)
+	}
+	deleteAt(t, db, &note{}, old, ids[0], ids[1])
+
+	result, err = Prune(ctx, db, note{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), result.Deleted, "string keys are pruned as well")
+	var count int64
+	require.NoError(t, db.Unscoped().Model(&note{}).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestPruneTable(t *testing.T) {
+	db, _ := newArticles(t, 0)
+	ctx := context.Background()
+	require.NoError(t, db.AutoMigrate(&orderRow{}))
+	for i := 0; i < 3; i++ {
+		require.NoError(t, db.Create(&orderRow{}).Error)
+	}
+	deleteAt(t, db, &orderRow{}, time.Now().Add(-48*time.Hour), 1, 2)
+
+	result, err := PruneTable(ctx, db, "order", 24*time.Hour)
+	require.NoError(t, err, "the table name is quoted")
+	assert.Equal(t, int64(2), result.Deleted)
+	var count int64
+	require.NoError(t, db.Unscoped().Model(&orderRow{}).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+
+	_, err = PruneTable(ctx, db, "order", 0)
+	assert.Error(t, err, "a retention is required")
+}
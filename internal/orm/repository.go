@@ -23,20 +23,72 @@ type BaseModel struct {
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
 }
 
-// Repository provides database operations for models
-type Repository[T Model] struct {
+// Repository provides database operations for models: CRUD, pagination,
+// scopes, soft deletes and transactions. Model repositories embed it and
+// add only their own queries:
+//
+//	type UserRepository struct {
+//		*orm.Repository[models.User]
+//	}
+//
+//	func (r *UserRepository) Admins(ctx context.Context) ([]models.User, error) {
+//		var users []models.User
+//		err := r.DB(ctx).Where("role = ?", "admin").Find(&users).Error
+//		return users, err
+//	}
+type Repository[T any] struct {
 	db    *gorm.DB
 	model T
 }
 
 // NewRepository creates a new repository instance
-func NewRepository[T Model](db *gorm.DB, model T) *Repository[T] {
+func NewRepository[T any](db *gorm.DB, model T) *Repository[T] {
 	return &Repository[T]{
 		db:    db,
 		model: model,
 	}
 }
 
+// DB returns the repository's query, with its scopes, under ctx for
+// custom queries
+func (r *Repository[T]) DB(ctx context.Context) *gorm.DB {
+	return r.db.WithContext(ctx)
+}
+
+// Scopes returns a repository whose queries all apply scopes, such as
+// query.Params.ApplyFilters
+func (r *Repository[T]) Scopes(scopes ...func(*gorm.DB) *gorm.DB) *Repository[T] {
+	return r.with(r.db.Scopes(scopes...).Session(&gorm.Session{}))
+}
+
+// WithTx returns a repository running its queries in tx, for transactions
+// spanning several repositories
+func (r *Repository[T]) WithTx(tx *gorm.DB) *Repository[T] {
+	return r.with(tx)
+}
+
+// Transaction calls fn with a repository running its queries in a
+// transaction, committed if fn returns nil and rolled back otherwise
+func (r *Repository[T]) Transaction(ctx context.Context, fn func(tx *Repository[T]) error) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(r.with(tx))
+	})
+}
+
+// WithTrashed returns a repository including soft-deleted records
+func (r *Repository[T]) WithTrashed() *Repository[T] {
+	return r.with(r.db.Unscoped())
+}
+
+// OnlyTrashed returns a repository limited to soft-deleted records
+func (r *Repository[T]) OnlyTrashed() *Repository[T] {
+	return r.with(r.db.Unscoped().Where("deleted_at IS NOT NULL").Session(&gorm.Session{}))
+}
+
+func (r *Repository[T]) with(db *gorm.DB) *Repository[T] {
+	return &Repository[T]{db: db, model: r.model}
+}
+
 // Create creates a new record
 func (r *Repository[T]) Create(ctx context.Context, model *T) error {
 	return r.db.WithContext(ctx).Create(model).Error
@@ -89,17 +141,35 @@ func (r *Repository[T]) Update(ctx context.Context, model *T) error {
 
 // UpdateBy updates a record by ID
 func (r *Repository[T]) UpdateBy(ctx context.Context, id uint, updates map[string]interface{}) error {
-	return r.db.WithContext(ctx).Model(r.model).Where("id = ?", id).Updates(updates).Error
+	return r.db.WithContext(ctx).Model(new(T)).Where("id = ?", id).Updates(updates).Error
 }
 
 // Delete soft deletes a record
 func (r *Repository[T]) Delete(ctx context.Context, id uint) error {
-	return r.db.WithContext(ctx).Delete(r.model, id).Error
+	return r.db.WithContext(ctx).Delete(new(T), id).Error
 }
 
-// ForceDelete permanently deletes a record
+// ForceDelete permanently deletes a record, whether or not it was soft
+// deleted, returning gorm.ErrRecordNotFound when there is none
 func (r *Repository[T]) ForceDelete(ctx context.Context, id uint) error {
-	return r.db.WithContext(ctx).Unscoped().Delete(r.model, id).Error
+	result := r.db.WithContext(ctx).Unscoped().Delete(new(T), id)
+	if result.Error == nil && result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return result.Error
+}
+
+// Restore clears the deletion mark of a soft-deleted record
+func (r *Repository[T]) Restore(ctx context.Context, id uint) (*T, error) {
+	var model T
+	db := r.db.WithContext(ctx)
+	if err := db.Unscoped().Where("deleted_at IS NOT NULL").First(&model, id).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Unscoped().Model(&model).Update("deleted_at", nil).Error; err != nil {
+		return nil, err
+	}
+	return &model, nil
 }
 
 // Count counts records
@@ -169,8 +239,29 @@ func (r *Repository[T]) Paginate(ctx context.Context, page, limit int) (*Paginat
 	}, nil
 }
 
+// ListParams filter, sort and paginate a listing; query.Params parses them
+// from a request's query string
+type ListParams interface {
+	ApplyFilters(db *gorm.DB) *gorm.DB
+	Apply(db *gorm.DB) *gorm.DB
+	Paginate(db *gorm.DB) *gorm.DB
+}
+
+// List returns a filtered, sorted page of records and the number of
+// records matching the filters
+func (r *Repository[T]) List(ctx context.Context, params ListParams) ([]T, int64, error) {
+	var models []T
+	var total int64
+	db := r.db.WithContext(ctx)
+	if err := params.ApplyFilters(db.Model(r.model)).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := params.Paginate(params.Apply(db)).Find(&models).Error
+	return models, total, err
+}
+
 // PaginatedResult represents paginated query results
-type PaginatedResult[T Model] struct {
+type PaginatedResult[T any] struct {
 	Data       []T   `json:"data"`
 	Total      int64 `json:"total"`
 	Page       int   `json:"page"`
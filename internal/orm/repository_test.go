@@ -0,0 +1,97 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// titlePrefix lists articles whose titles start with a prefix, newest
+// first, two to a page
+type titlePrefix struct {
+	prefix string
+	page   int
+}
+
+func (p titlePrefix) ApplyFilters(db *gorm.DB) *gorm.DB {
+	return db.Where("title LIKE ?", p.prefix+"%")
+}
+
+func (p titlePrefix) Apply(db *gorm.DB) *gorm.DB {
+	return p.ApplyFilters(db).Order("id DESC")
+}
+
+func (p titlePrefix) Paginate(db *gorm.DB) *gorm.DB {
+	return db.Offset((p.page - 1) * 2).Limit(2)
+}
+
+func TestRepositoryScopesAndList(t *testing.T) {
+	_, repo := newArticles(t, 12)
+	ctx := context.Background()
+
+	items, total, err := repo.List(ctx, titlePrefix{prefix: "a1", page: 1})
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), total)
+	assert.Equal(t, []string{"a12", "a11"}, titles(items))
+
+	scoped := repo.Scopes(func(db *gorm.DB) *gorm.DB { return db.Where("id > ?", 10) })
+	count, err := scoped.Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+	found, err := scoped.FindAll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a11", "a12"}, titles(found), "scopes apply to every query")
+	count, err = repo.Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(12), count, "the original is unscoped")
+}
+
+func TestRepositorySoftDeletes(t *testing.T) {
+	_, repo := newArticles(t, 3)
+	ctx := context.Background()
+
+	require.NoError(t, repo.Delete(ctx, 2))
+	count, err := repo.Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+	trashed, err := repo.OnlyTrashed().FindAll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a2"}, titles(trashed))
+	count, err = repo.WithTrashed().Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+
+	restored, err := repo.Restore(ctx, 2)
+	require.NoError(t, err)
+	assert.False(t, restored.DeletedAt.Valid)
+	_, err = repo.Restore(ctx, 2)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound, "not deleted")
+
+	require.NoError(t, repo.ForceDelete(ctx, 2))
+	assert.ErrorIs(t, repo.ForceDelete(ctx, 2), gorm.ErrRecordNotFound)
+	count, err = repo.WithTrashed().Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+}
+
+func TestRepositoryTransaction(t *testing.T) {
+	db, repo := newArticles(t, 0)
+	ctx := context.Background()
+
+	err := repo.Transaction(ctx, func(tx *Repository[article]) error {
+		require.NoError(t, tx.Create(ctx, &article{Title: "rolled back"}))
+		return errors.New("abort")
+	})
+	assert.EqualError(t, err, "abort")
+
+	require.NoError(t, db.Transaction(func(tx *gorm.DB) error {
+		return repo.WithTx(tx).Create(ctx, &article{Title: "committed"})
+	}))
+	all, err := repo.FindAll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"committed"}, titles(all))
+}
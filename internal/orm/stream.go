@@ -0,0 +1,88 @@
+package orm
+
+import (
+	"context"
+	"fmt"
+	"iter"
+
+	"gorm.io/gorm"
+)
+
+// Chunk calls fn with successive batches of up to size records in primary
+// key order, so large tables can be exported or reindexed without loading
+// them whole. Returning an error from fn stops the walk with that error.
+func (r *Repository[T]) Chunk(ctx context.Context, size int, fn func([]T) error) error {
+	return Chunk(r.db.WithContext(ctx), size, fn)
+}
+
+// Cursor streams every record one at a time over a single query, for
+// example:
+//
+//	for user, err := range users.Cursor(ctx) {
+//		if err != nil {
+//			return err
+//		}
+//		index(user)
+//	}
+//
+// Breaking out of the loop closes the query.
+func (r *Repository[T]) Cursor(ctx context.Context) iter.Seq2[T, error] {
+	return Cursor[T](r.db.WithContext(ctx))
+}
+
+// Chunk calls fn with successive batches of the query's results
+func (qb *QueryBuilder[T]) Chunk(ctx context.Context, size int, fn func([]T) error) error {
+	return Chunk(qb.db.WithContext(ctx), size, fn)
+}
+
+// Cursor streams the query's results one at a time
+func (qb *QueryBuilder[T]) Cursor(ctx context.Context) iter.Seq2[T, error] {
+	return Cursor[T](qb.db.WithContext(ctx))
+}
+
+// Chunk runs db, which may already carry filters, in batches of up to size
+// records keyed on the primary key, calling fn with each. Each batch is a
+// separate query that seeks past the last key seen, so it stays fast deep
+// into a table and rows deleted by fn don't shift later batches.
+func Chunk[T any](db *gorm.DB, size int, fn func([]T) error) error {
+	if size <= 0 {
+		return fmt.Errorf("chunk size must be positive, got %d", size)
+	}
+	var batch []T
+	return db.FindInBatches(&batch, size, func(tx *gorm.DB, _ int) error {
+		if err := tx.Statement.Context.Err(); err != nil {
+			return err
+		}
+		return fn(batch)
+	}).Error
+}
+
+// Cursor runs db, which may already carry filters, as one query and yields
+// its rows one at a time, holding a single connection until the loop ends.
+// A failed query or scan is yielded as the error and ends the loop.
+func Cursor[T any](db *gorm.DB) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		tx := db.Model(&zero)
+		rows, err := tx.Rows()
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var record T
+			if err := tx.ScanRows(rows, &record); err != nil {
+				yield(zero, err)
+				return
+			}
+			if !yield(record, nil) {
+				return
+			}
+		}
+		if err := rows.Err(); err != nil {
+			yield(zero, err)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type article struct {
+	BaseModel
+	Title string
+}
+
+func (article) TableName() string { return "articles" }
+
+func newArticles(t *testing.T, n int) (*gorm.DB, *Repository[article]) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "app.db")), &gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	require.NoError(t, db.AutoMigrate(&article{}))
+	for i := 1; i <= n; i++ {
+		require.NoError(t, db.Create(&article{Title: fmt.Sprintf("a%d", i)}).Error)
+	}
+	return db, NewRepository(db, article{})
+}
+
+func titles(articles []article) []string {
+	var result []string
+	for _, a := range articles {
+		result = append(result, a.Title)
+	}
+	return result
+}
+
+func TestChunk(t *testing.T) {
+	db, repo := newArticles(t, 7)
+	ctx := context.Background()
+	require.NoError(t, db.Delete(&article{}, 2).Error)
+
+	var batches [][]string
+	require.NoError(t, repo.Chunk(ctx, 3, func(batch []article) error {
+		batches = append(batches, titles(batch))
+		return nil
+	}))
+	assert.Equal(t, [][]string{{"a1", "a3", "a4"}, {"a5", "a6", "a7"}}, batches, "soft-deleted rows are skipped")
+
+	// Deleting what was just processed doesn't skip the rest
+	var seen []string
+	require.NoError(t, repo.Chunk(ctx, 2, func(batch []article) error {
+		seen = append(seen, titles(batch)...)
+		return db.Unscoped().Delete(&batch).Error
+	}))
+	assert.Equal(t, []string{"a1", "a3", "a4", "a5", "a6", "a7"}, seen)
+}
+
+func TestChunkStops(t *testing.T) {
+	_, repo := newArticles(t, 5)
+
+	stop := errors.New("stop")
+	calls := 0
+	err := repo.Chunk(context.Background(), 2, func([]article) error {
+		calls++
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 1, calls)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	calls = 0
+	err = repo.Chunk(ctx, 2, func([]article) error {
+		calls++
+		cancel()
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, calls)
+
+	assert.Error(t, repo.Chunk(context.Background(), 0, func([]article) error { return nil }))
+}
+
+func TestCursor(t *testing.T) {
+	db, repo := newArticles(t, 5)
+	ctx := context.Background()
+	require.NoError(t, db.Delete(&article{}, 5).Error)
+
+	var seen []string
+	for a, err := range repo.Cursor(ctx) {
+		require.NoError(t, err)
+		seen = append(seen, a.Title)
+	}
+	assert.Equal(t, []string{"a1", "a2", "a3", "a4"}, seen)
+
+	seen = nil
+	for a, err := range NewQueryBuilder(db, article{}).WhereIn("title", []interface{}{"a2", "a4"}).Cursor(ctx) {
+		require.NoError(t, err)
+		seen = append(seen, a.Title)
+	}
+	assert.Equal(t, []string{"a2", "a4"}, seen)
+}
+
+func TestCursorReleasesConnectionOnBreak(t *testing.T) {
+	db, repo := newArticles(t, 5)
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+
+	for range repo.Cursor(context.Background()) {
+		break
+	}
+
+	// With the only connection still held this would block
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	count, err := repo.Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), count)
+}
+
+func TestCursorYieldsQueryErrors(t *testing.T) {
+	db, _ := newArticles(t, 0)
+	missing := NewRepository(db.Table("missing"), article{})
+
+	var errs []error
+	for _, err := range missing.Cursor(context.Background()) {
+		errs = append(errs, err)
+	}
+	require.Len(t, errs, 1)
+	assert.Error(t, errs[0])
+}
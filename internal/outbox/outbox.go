@@ -0,0 +1,332 @@
+// Package outbox publishes the domain events of aggregates only after the
+// transaction that saved them commits. Installed on a database, it stores
+// the events a model recorded (see orm.AggregateRoot) in the outbox table
+// within the same transaction as the model's own rows, then publishes them
+// on a bus once the commit succeeds:
+//
+//	err := outbox.Transaction(ctx, db, func(tx *gorm.DB) error {
+//		order.Ship() // records OrderShipped
+//		return tx.Save(order).Error
+//	})
+//
+// A rolled back transaction takes its events with it. Events that were
+// committed but not published, because the process stopped or a handler
+// failed, are published by the relay, so delivery is at least once and
+// handlers should be idempotent.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mrhoseah/dolphin/internal/bus"
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/correlation"
+	"github.com/mrhoseah/dolphin/internal/orm"
+)
+
+const (
+	pluginName = "dolphin:outbox"
+	pendingKey = "dolphin:outbox_pending"
+)
+
+// Message is an event stored in the outbox table
+type Message struct {
+	// ID is time ordered, so messages sort in the order they were recorded
+	ID           string     `gorm:"primaryKey;size:36"`
+	Name         string     `gorm:"size:255;index;not null"`
+	Payload      string     `gorm:"type:text;not null"`
+	Attempts     int        `gorm:"not null;default:0"`
+	LastError    string     `gorm:"type:text"`
+	AvailableAt  time.Time  `gorm:"index;not null"`
+	DispatchedAt *time.Time `gorm:"index"`
+	// Correlation is the JSON encoded correlation.Fields of the request
+	// the event was recorded in, restored when the relay publishes it
+	Correlation string `gorm:"type:text"`
+	CreatedAt   time.Time
+}
+
+// TableName returns the table name for the Message model
+func (Message) TableName() string {
+	return "outbox_messages"
+}
+
+// delivery is a stored message and the event it was encoded from
+type delivery struct {
+	id    string
+	event interface{}
+}
+
+// Outbox stores and publishes the events of a database's aggregates
+type Outbox struct {
+	db          *gorm.DB
+	bus         *bus.Bus
+	logger      *zap.Logger
+	lease       time.Duration
+	maxAttempts int
+	retention   time.Duration
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+var _ gorm.Plugin = (*Outbox)(nil)
+
+// New installs an outbox on db that publishes events on b, creating its
+// table if needed
+func New(db *gorm.DB, b *bus.Bus, cfg config.OutboxConfig, logger *zap.Logger) (*Outbox, error) {
+	if err := db.AutoMigrate(&Message{}); err != nil {
+		return nil, err
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	o := &Outbox{
+		db:          db,
+		bus:         b,
+		logger:      logger,
+		lease:       cfg.Lease,
+		maxAttempts: cfg.MaxAttempts,
+		retention:   cfg.Retention,
+	}
+	if o.lease <= 0 {
+		o.lease = time.Minute
+	}
+	if err := db.Use(o); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// From returns the outbox installed on db, if any
+func From(db *gorm.DB) (*Outbox, bool) {
+	o, ok := db.Config.Plugins[pluginName].(*Outbox)
+	return o, ok
+}
+
+// Name implements gorm.Plugin
+func (o *Outbox) Name() string {
+	return pluginName
+}
+
+// Initialize implements gorm.Plugin by storing events after each write and
+// publishing them after the write's own transaction commits
+func (o *Outbox) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Create().Before("gorm:commit_or_rollback_transaction").Register(pluginName+"_store_create", o.store); err != nil {
+		return err
+	}
+	if err := cb.Create().After("gorm:commit_or_rollback_transaction").Register(pluginName+"_publish_create", o.committed); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:commit_or_rollback_transaction").Register(pluginName+"_store_update", o.store); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:commit_or_rollback_transaction").Register(pluginName+"_publish_update", o.committed); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:commit_or_rollback_transaction").Register(pluginName+"_store_delete", o.store); err != nil {
+		return err
+	}
+	return cb.Delete().After("gorm:commit_or_rollback_transaction").Register(pluginName+"_publish_delete", o.committed)
+}
+
+// Transaction runs fn in a transaction on db and publishes the events of
+// the aggregates saved in it once it commits. Without an outbox installed
+// on db it is a plain transaction.
+func Transaction(ctx context.Context, db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	if o, ok := From(db); ok {
+		return o.Transaction(ctx, fn)
+	}
+	return db.WithContext(ctx).Transaction(fn)
+}
+
+type collectorKey struct{}
+
+// collector gathers the deliveries of a transaction until it commits
+type collector struct {
+	mu         sync.Mutex
+	deliveries []delivery
+}
+
+// Transaction runs fn in a transaction and publishes the events of the
+// aggregates saved in it once it commits. Nothing is published if fn
+// returns an error or the commit fails.
+func (o *Outbox) Transaction(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	c := &collector{}
+	if err := o.db.WithContext(context.WithValue(ctx, collectorKey{}, c)).Transaction(fn); err != nil {
+		return err
+	}
+	o.deliver(ctx, c.deliveries)
+	return nil
+}
+
+// store writes the pending events of the statement's aggregates to the
+// outbox in the statement's transaction, failing the write if they can't
+// be stored
+func (o *Outbox) store(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return
+	}
+
+	var (
+		messages   []Message
+		deliveries []delivery
+	)
+	now := time.Now()
+	var fields string
+	if captured := correlation.Capture(db.Statement.Context); captured != nil {
+		encoded, _ := json.Marshal(captured)
+		fields = string(encoded)
+	}
+	eachAggregate(db.Statement.ReflectValue, func(aggregate orm.Aggregate) {
+		for _, event := range aggregate.PendingEvents() {
+			if event == nil {
+				continue
+			}
+			payload, err := json.Marshal(event)
+			if err != nil {
+				db.AddError(fmt.Errorf("outbox: encoding %T: %w", event, err))
+				return
+			}
+			name := bus.EventName(event)
+			register(name, reflect.TypeOf(event))
+			id := uuid.Must(uuid.NewV7()).String()
+			messages = append(messages, Message{
+				ID:      id,
+				Name:    name,
+				Payload: string(payload),
+				// Reserved for publishing after the commit; the relay
+				// takes over if that doesn't happen
+				AvailableAt: now.Add(o.lease),
+				Correlation: fields,
+				CreatedAt:   now,
+			})
+			deliveries = append(deliveries, delivery{id: id, event: event})
+		}
+		aggregate.ClearEvents()
+	})
+	if len(messages) == 0 || db.Error != nil {
+		return
+	}
+
+	if err := db.Session(&gorm.Session{NewDB: true}).Create(&messages).Error; err != nil {
+		db.AddError(fmt.Errorf("outbox: storing events: %w", err))
+		return
+	}
+	db.InstanceSet(pendingKey, deliveries)
+}
+
+// committed publishes the statement's events if its own transaction has
+// committed, or hands them to the Transaction it is part of
+func (o *Outbox) committed(db *gorm.DB) {
+	value, ok := db.InstanceGet(pendingKey)
+	if !ok || db.Error != nil {
+		return
+	}
+	deliveries := value.([]delivery)
+
+	if _, started := db.InstanceGet("gorm:started_transaction"); started || !inTransaction(db.Statement) {
+		o.deliver(db.Statement.Context, deliveries)
+		return
+	}
+	if c, ok := db.Statement.Context.Value(collectorKey{}).(*collector); ok {
+		c.mu.Lock()
+		c.deliveries = append(c.deliveries, deliveries...)
+		c.mu.Unlock()
+	}
+	// Otherwise the write is part of a transaction the outbox can't see
+	// commit, and the relay publishes its events once their lease expires
+}
+
+// deliver publishes events stored by a committed transaction. Messages
+// already taken by the relay, or rolled back to a savepoint, are skipped.
+func (o *Outbox) deliver(ctx context.Context, deliveries []delivery) {
+	ctx = context.WithoutCancel(ctx)
+	for _, d := range deliveries {
+		res := o.db.WithContext(ctx).Model(&Message{}).
+			Where("id = ? AND attempts = 0 AND dispatched_at IS NULL", d.id).
+			Update("attempts", 1)
+		if res.Error != nil {
+			o.logger.Error("Failed to claim outbox message", zap.String("id", d.id), zap.Error(res.Error))
+			continue
+		}
+		if res.RowsAffected == 0 {
+			continue
+		}
+		o.publish(ctx, d.id, d.event, 1)
+	}
+}
+
+// publish publishes one message's event and records the outcome, backing
+// off before the relay retries a failure
+func (o *Outbox) publish(ctx context.Context, id string, event interface{}, attempts int) error {
+	err := o.bus.Publish(ctx, event)
+	if err != nil {
+		o.fail(ctx, id, attempts, err)
+		return err
+	}
+	now := time.Now()
+	if err := o.db.WithContext(ctx).Model(&Message{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"dispatched_at": &now, "last_error": ""}).Error; err != nil {
+		o.logger.Error("Failed to mark outbox message published", zap.String("id", id), zap.Error(err))
+	}
+	return nil
+}
+
+// fail records why a message couldn't be published
+func (o *Outbox) fail(ctx context.Context, id string, attempts int, err error) {
+	o.logger.Warn("Failed to publish outbox message",
+		zap.String("id", id), zap.Int("attempts", attempts), zap.Error(err))
+	if err := o.db.WithContext(ctx).Model(&Message{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"last_error":   err.Error(),
+		"available_at": time.Now().Add(backoff(attempts)),
+	}).Error; err != nil {
+		o.logger.Error("Failed to record outbox failure", zap.String("id", id), zap.Error(err))
+	}
+}
+
+// backoff is how long to wait before retrying a message that has failed
+// attempts times: 2s, 8s, 18s... up to ten minutes
+func backoff(attempts int) time.Duration {
+	delay := time.Duration(2*attempts*attempts) * time.Second
+	if delay > 10*time.Minute || delay <= 0 {
+		return 10 * time.Minute
+	}
+	return delay
+}
+
+// eachAggregate calls fn with every aggregate in value, a model or a slice
+// of models
+func eachAggregate(value reflect.Value, fn func(orm.Aggregate)) {
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !value.IsNil() {
+			eachAggregate(value.Elem(), fn)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			eachAggregate(value.Index(i), fn)
+		}
+	case reflect.Struct:
+		if value.CanAddr() {
+			if aggregate, ok := value.Addr().Interface().(orm.Aggregate); ok {
+				fn(aggregate)
+			}
+		}
+	}
+}
+
+// inTransaction reports whether the statement runs inside a transaction
+func inTransaction(stmt *gorm.Statement) bool {
+	_, ok := stmt.ConnPool.(gorm.TxCommitter)
+	return ok
+}
@@ -0,0 +1,249 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/mrhoseah/dolphin/internal/bus"
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/database"
+	"github.com/mrhoseah/dolphin/internal/orm"
+)
+
+type order struct {
+	orm.BaseModel
+	orm.AggregateRoot
+	Status string
+}
+
+func (order) TableName() string { return "orders" }
+
+func (o *order) ship() {
+	o.Status = "shipped"
+	o.RecordEvent(orderShipped{OrderID: o.ID})
+}
+
+type orderShipped struct {
+	OrderID uint `json:"order_id"`
+}
+
+// received collects the events published on a bus
+type received struct {
+	mu     sync.Mutex
+	events []orderShipped
+	fail   error
+}
+
+func (r *received) all() []orderShipped {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]orderShipped(nil), r.events...)
+}
+
+func newTestOutbox(t *testing.T) (*Outbox, *gorm.DB, *received) {
+	db, err := database.New(&config.DatabaseConfig{Driver: "sqlite", Database: filepath.Join(t.TempDir(), "app.db")})
+	require.NoError(t, err)
+	gdb := db.GetDB()
+	require.NoError(t, gdb.AutoMigrate(&order{}))
+
+	b := bus.New()
+	got := &received{}
+	bus.SubscribeTo(b, func(ctx context.Context, e orderShipped) error {
+		got.mu.Lock()
+		defer got.mu.Unlock()
+		if got.fail != nil {
+			return got.fail
+		}
+		got.events = append(got.events, e)
+		return nil
+	})
+
+	o, err := New(gdb, b, config.OutboxConfig{Lease: time.Minute, MaxAttempts: 3}, nil)
+	require.NoError(t, err)
+	found, ok := From(gdb)
+	require.True(t, ok)
+	assert.Same(t, o, found)
+	return o, gdb, got
+}
+
+func messages(t *testing.T, db *gorm.DB) []Message {
+	var all []Message
+	require.NoError(t, db.Order("id").Find(&all).Error)
+	return all
+}
+
+// expireLeases lets the relay take messages reserved for their committer
+func expireLeases(t *testing.T, db *gorm.DB) {
+	require.NoError(t, db.Model(&Message{}).Where("1 = 1").Update("available_at", time.Now().Add(-time.Second)).Error)
+}
+
+func TestPublishAfterCommit(t *testing.T) {
+	o, db, got := newTestOutbox(t)
+	ctx := context.Background()
+
+	// A save outside a transaction publishes once its own commits
+	first := &order{Status: "new"}
+	require.NoError(t, db.Create(first).Error)
+	first.ship()
+	require.NoError(t, db.Save(first).Error)
+	assert.Equal(t, []orderShipped{{OrderID: first.ID}}, got.all())
+	assert.Empty(t, first.PendingEvents())
+
+	// Inside a transaction nothing is published until it commits
+	second := &order{Status: "new"}
+	require.NoError(t, db.Create(second).Error)
+	err := o.Transaction(ctx, func(tx *gorm.DB) error {
+		second.ship()
+		if err := tx.Save(second).Error; err != nil {
+			return err
+		}
+		assert.Len(t, got.all(), 1, "published before commit")
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []orderShipped{{OrderID: first.ID}, {OrderID: second.ID}}, got.all())
+
+	stored := messages(t, db)
+	require.Len(t, stored, 2)
+	for _, msg := range stored {
+		assert.Equal(t, "outbox.orderShipped", msg.Name)
+		assert.NotNil(t, msg.DispatchedAt)
+		assert.Equal(t, 1, msg.Attempts)
+	}
+	assert.JSONEq(t, `{"order_id":1}`, stored[0].Payload)
+
+	// Published messages can be pruned
+	pruned, err := o.Prune(ctx, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), pruned)
+}
+
+func TestRollbackDropsEvents(t *testing.T) {
+	o, db, got := newTestOutbox(t)
+	ctx := context.Background()
+	shipped := &order{Status: "new"}
+	require.NoError(t, db.Create(shipped).Error)
+
+	boom := errors.New("boom")
+	err := o.Transaction(ctx, func(tx *gorm.DB) error {
+		shipped.ship()
+		if err := tx.Save(shipped).Error; err != nil {
+			return err
+		}
+		return boom
+	})
+	assert.ErrorIs(t, err, boom)
+
+	// A savepoint rolled back inside a committed transaction
+	err = Transaction(ctx, db, func(tx *gorm.DB) error {
+		err := tx.Transaction(func(tx *gorm.DB) error {
+			shipped.ship()
+			if err := tx.Save(shipped).Error; err != nil {
+				return err
+			}
+			return boom
+		})
+		assert.ErrorIs(t, err, boom)
+		return nil
+	})
+	require.NoError(t, err)
+
+	assert.Empty(t, got.all())
+	assert.Empty(t, messages(t, db))
+
+	published, err := o.Relay(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, published)
+}
+
+func TestRelay(t *testing.T) {
+	o, db, got := newTestOutbox(t)
+	ctx := context.Background()
+	shipped := &order{Status: "new"}
+	require.NoError(t, db.Create(shipped).Error)
+
+	// A plain transaction commits where the outbox can't see it, so the
+	// relay publishes its events once their lease runs out
+	require.NoError(t, db.Transaction(func(tx *gorm.DB) error {
+		shipped.ship()
+		return tx.Save(shipped).Error
+	}))
+	assert.Empty(t, got.all())
+
+	published, err := o.Relay(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, published, "reserved for the committing process")
+
+	expireLeases(t, db)
+	published, err = o.Relay(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, published)
+	assert.Equal(t, []orderShipped{{OrderID: shipped.ID}}, got.all())
+
+	published, err = o.Relay(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, published, "published once")
+}
+
+func TestRelayRetriesFailures(t *testing.T) {
+	o, db, got := newTestOutbox(t)
+	ctx := context.Background()
+	got.fail = errors.New("mailer down")
+
+	shipped := &order{Status: "new"}
+	shipped.RecordEvent(orderShipped{OrderID: 7})
+	require.NoError(t, db.Create(shipped).Error, "a failing handler doesn't fail the save")
+
+	stored := messages(t, db)
+	require.Len(t, stored, 1)
+	assert.Nil(t, stored[0].DispatchedAt)
+	assert.Equal(t, 1, stored[0].Attempts)
+	assert.Equal(t, "mailer down", stored[0].LastError)
+	assert.True(t, stored[0].AvailableAt.After(time.Now()), "backs off")
+
+	for attempt := 2; attempt <= 3; attempt++ {
+		expireLeases(t, db)
+		published, err := o.Relay(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, published)
+		assert.Equal(t, attempt, messages(t, db)[0].Attempts)
+	}
+
+	// Given up after MaxAttempts
+	got.mu.Lock()
+	got.fail = nil
+	got.mu.Unlock()
+	expireLeases(t, db)
+	published, err := o.Relay(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, published)
+
+	require.NoError(t, db.Model(&Message{}).Where("1 = 1").Update("attempts", 1).Error)
+	published, err = o.Relay(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, published)
+	assert.Equal(t, []orderShipped{{OrderID: 7}}, got.all())
+}
+
+func TestDecode(t *testing.T) {
+	Register[*orderShipped]()
+	event, err := decode(Message{Name: "outbox.orderShipped", Payload: `{"order_id":3}`})
+	require.NoError(t, err)
+	assert.Equal(t, &orderShipped{OrderID: 3}, event)
+
+	Register[orderShipped]()
+	event, err = decode(Message{Name: "outbox.orderShipped", Payload: `{"order_id":3}`})
+	require.NoError(t, err)
+	assert.Equal(t, orderShipped{OrderID: 3}, event)
+
+	_, err = decode(Message{Name: "billing.InvoicePaid", Payload: `{}`})
+	assert.ErrorContains(t, err, `no event type registered for "billing.InvoicePaid"`)
+}
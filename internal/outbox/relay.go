@@ -0,0 +1,168 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/bus"
+	"github.com/mrhoseah/dolphin/internal/correlation"
+)
+
+// relayBatch bounds how many messages one Relay call publishes
+const relayBatch = 100
+
+var (
+	typesMu sync.RWMutex
+	types   = map[string]reflect.Type{}
+)
+
+// Register lets the relay decode stored events of type T, which it needs to
+// publish events recorded before the process restarted. Events recorded
+// since it started are registered automatically.
+func Register[T any]() {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	var sample interface{}
+	if t.Kind() == reflect.Ptr {
+		sample = reflect.New(t.Elem()).Interface()
+	} else {
+		sample = reflect.New(t).Elem().Interface()
+	}
+	register(bus.EventName(sample), t)
+}
+
+func register(name string, t reflect.Type) {
+	typesMu.RLock()
+	known := types[name] == t
+	typesMu.RUnlock()
+	if known {
+		return
+	}
+	typesMu.Lock()
+	types[name] = t
+	typesMu.Unlock()
+}
+
+// decode rebuilds the event a message was stored from
+func decode(msg Message) (interface{}, error) {
+	typesMu.RLock()
+	t, ok := types[msg.Name]
+	typesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("outbox: no event type registered for %q", msg.Name)
+	}
+
+	if t.Kind() == reflect.Ptr {
+		event := reflect.New(t.Elem())
+		if err := json.Unmarshal([]byte(msg.Payload), event.Interface()); err != nil {
+			return nil, fmt.Errorf("outbox: decoding %s: %w", msg.Name, err)
+		}
+		return event.Interface(), nil
+	}
+	event := reflect.New(t)
+	if err := json.Unmarshal([]byte(msg.Payload), event.Interface()); err != nil {
+		return nil, fmt.Errorf("outbox: decoding %s: %w", msg.Name, err)
+	}
+	return event.Elem().Interface(), nil
+}
+
+// Relay publishes the messages that are due: ones committed in a
+// transaction the outbox couldn't see commit, ones a stopped process left
+// unpublished, and failed ones whose backoff has passed. Messages that
+// failed MaxAttempts times are left for inspection. It returns how many
+// were published.
+func (o *Outbox) Relay(ctx context.Context) (int, error) {
+	query := o.db.WithContext(ctx).Where("dispatched_at IS NULL AND available_at <= ?", time.Now())
+	if o.maxAttempts > 0 {
+		query = query.Where("attempts < ?", o.maxAttempts)
+	}
+	var due []Message
+	if err := query.Order("id").Limit(relayBatch).Find(&due).Error; err != nil {
+		return 0, err
+	}
+
+	published := 0
+	for _, msg := range due {
+		// Take the message, unless another relay or the committing
+		// process got there first
+		attempts := msg.Attempts + 1
+		res := o.db.WithContext(ctx).Model(&Message{}).
+			Where("id = ? AND attempts = ? AND dispatched_at IS NULL", msg.ID, msg.Attempts).
+			Updates(map[string]interface{}{"attempts": attempts, "available_at": time.Now().Add(o.lease)})
+		if res.Error != nil {
+			return published, res.Error
+		}
+		if res.RowsAffected == 0 {
+			continue
+		}
+
+		event, err := decode(msg)
+		if err != nil {
+			o.fail(ctx, msg.ID, attempts, err)
+			continue
+		}
+		// Published as part of the request that recorded it
+		var fields correlation.Fields
+		json.Unmarshal([]byte(msg.Correlation), &fields)
+		err = correlation.Run(ctx, fields, "outbox "+msg.Name, func(ctx context.Context) error {
+			return o.publish(ctx, msg.ID, event, attempts)
+		})
+		if err == nil {
+			published++
+		}
+	}
+	return published, nil
+}
+
+// Prune deletes messages published before the given time, returning how
+// many were removed
+func (o *Outbox) Prune(ctx context.Context, before time.Time) (int64, error) {
+	res := o.db.WithContext(ctx).Where("dispatched_at IS NOT NULL AND dispatched_at < ?", before).Delete(&Message{})
+	return res.RowsAffected, res.Error
+}
+
+// Start relays due messages every interval until Close, pruning published
+// ones older than the retention period
+func (o *Outbox) Start(interval time.Duration) {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	o.stop = make(chan struct{})
+	o.done = make(chan struct{})
+
+	go func() {
+		defer close(o.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				ctx := context.Background()
+				if _, err := o.Relay(ctx); err != nil {
+					o.logger.Error("Failed to relay outbox messages", zap.Error(err))
+				}
+				if o.retention > 0 {
+					if _, err := o.Prune(ctx, time.Now().Add(-o.retention)); err != nil {
+						o.logger.Error("Failed to prune outbox messages", zap.Error(err))
+					}
+				}
+			case <-o.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the relay loop
+func (o *Outbox) Close() {
+	if o.stop != nil {
+		close(o.stop)
+		<-o.done
+		o.stop = nil
+	}
+}
@@ -0,0 +1,381 @@
+package payments
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/cache"
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/problem"
+)
+
+// maxWebhookBody caps the webhooks read, which are a few KB
+const maxWebhookBody = 1 << 20
+
+// lockTTL is how long a charge, refund or webhook event may hold its key
+// while the provider is called, longer than any provider takes
+const lockTTL = time.Minute
+
+// ErrInProgress is returned for a request repeating the idempotency key of
+// one still being handled
+var ErrInProgress error = problem.New(http.StatusConflict, "A payment with this idempotency key is in progress")
+
+// ErrKeyReused is returned for a request repeating an idempotency key with
+// different details, such as another amount
+var ErrKeyReused error = problem.New(http.StatusUnprocessableEntity, "The idempotency key was already used for a different payment")
+
+// EventHandler processes a webhook event. An error answers the webhook
+// with 500, so the provider delivers it again.
+type EventHandler func(ctx context.Context, event *Event) error
+
+// Manager charges and refunds through the configured providers and takes
+// their webhooks. Charges and refunds are kept in store for the
+// idempotency TTL, by provider and idempotency key.
+type Manager struct {
+	def    string
+	store  cache.Cache
+	locker cache.Locker
+	ttl    time.Duration
+	logger *zap.Logger
+
+	mu        sync.RWMutex
+	providers map[string]Provider
+	handlers  map[string][]EventHandler
+}
+
+// idempotentResult is the stored form of a charge or refund
+type idempotentResult struct {
+	Fingerprint string          `json:"fingerprint"`
+	Result      json.RawMessage `json:"result"`
+}
+
+// FromConfig creates the manager of the payments config, with the built-in
+// providers whose credentials are set and every registered one
+func FromConfig(cfg config.PaymentsConfig, store cache.Cache, locker cache.Locker, logger *zap.Logger) (*Manager, error) {
+	m := NewManager(cfg.Default, store, locker, cfg.IdempotencyTTL, logger)
+	if cfg.Stripe.SecretKey != "" {
+		m.Add(NewStripe(cfg.Stripe))
+	}
+	if cfg.PayPal.ClientID != "" {
+		m.Add(NewPayPal(cfg.PayPal))
+	}
+	if cfg.MPesa.ConsumerKey != "" {
+		provider, err := NewMPesa(cfg.MPesa)
+		if err != nil {
+			return nil, err
+		}
+		m.Add(provider)
+	}
+	for _, name := range Registered() {
+		provider, err := factory(name)(cfg.Providers[name])
+		if err != nil {
+			return nil, fmt.Errorf("payments: %s: %w", name, err)
+		}
+		m.Add(provider)
+	}
+	return m, nil
+}
+
+// NewManager creates a manager charging through the provider named def
+// when none is named, keeping idempotency keys in store for ttl and
+// holding them with locker while they are used
+func NewManager(def string, store cache.Cache, locker cache.Locker, ttl time.Duration, logger *zap.Logger) *Manager {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	return &Manager{
+		def:       def,
+		store:     store,
+		locker:    locker,
+		ttl:       ttl,
+		logger:    logger,
+		providers: make(map[string]Provider),
+		handlers:  make(map[string][]EventHandler),
+	}
+}
+
+// Add makes a provider available under its name, replacing any other
+func (m *Manager) Add(provider Provider) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.providers[provider.Name()] = provider
+}
+
+// Provider returns the provider named name, or the default one when name
+// is empty
+func (m *Manager) Provider(name string) (Provider, error) {
+	if name == "" {
+		name = m.def
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	provider, ok := m.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownProvider, name)
+	}
+	return provider, nil
+}
+
+// Providers lists the names of the providers available
+func (m *Manager) Providers() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	names := make([]string, 0, len(m.providers))
+	for name := range m.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Charge takes a payment through the named provider. A request repeating
+// an idempotency key gets the first charge back, marked Replayed, without
+// calling the provider; ErrKeyReused when its details differ, and
+// ErrInProgress while the first is still being made.
+func (m *Manager) Charge(ctx context.Context, provider string, req ChargeRequest) (*Charge, error) {
+	p, err := m.Provider(provider)
+	if err != nil {
+		return nil, err
+	}
+	req.Currency = strings.ToUpper(req.Currency)
+	if req.Amount <= 0 || req.Currency == "" {
+		return nil, problem.Validation(map[string]string{"amount": "must be a positive amount in a currency"})
+	}
+	if req.IdempotencyKey == "" {
+		req.IdempotencyKey = uuid.NewString()
+	}
+
+	var charge Charge
+	replayed, err := m.idempotent(ctx, "charge", p.Name(), req.IdempotencyKey, req, &charge, func() (interface{}, error) {
+		return p.Charge(ctx, req)
+	})
+	if err != nil {
+		return nil, err
+	}
+	charge.Replayed = replayed
+	if !replayed {
+		m.logger.Info("Payment charged",
+			zap.String("provider", p.Name()),
+			zap.String("charge", charge.ID),
+			zap.String("status", charge.Status),
+			zap.Int64("amount", charge.Amount),
+			zap.String("currency", charge.Currency))
+	}
+	return &charge, nil
+}
+
+// Refund gives back some or all of a charge through the named provider,
+// idempotently as Charge does
+func (m *Manager) Refund(ctx context.Context, provider string, req RefundRequest) (*Refund, error) {
+	p, err := m.Provider(provider)
+	if err != nil {
+		return nil, err
+	}
+	if req.ChargeID == "" || req.Amount < 0 {
+		return nil, problem.Validation(map[string]string{"charge_id": "must name the charge refunded"})
+	}
+	if req.IdempotencyKey == "" {
+		req.IdempotencyKey = uuid.NewString()
+	}
+
+	var refund Refund
+	replayed, err := m.idempotent(ctx, "refund", p.Name(), req.IdempotencyKey, req, &refund, func() (interface{}, error) {
+		return p.Refund(ctx, req)
+	})
+	if err != nil {
+		return nil, err
+	}
+	refund.Replayed = replayed
+	if !replayed {
+		m.logger.Info("Payment refunded",
+			zap.String("provider", p.Name()),
+			zap.String("charge", refund.ChargeID),
+			zap.String("refund", refund.ID),
+			zap.String("status", refund.Status))
+	}
+	return &refund, nil
+}
+
+// idempotent decodes into out the result stored for key, or stores the
+// result of do, holding key meanwhile. It reports whether the result was
+// stored before. Errors aren't stored, so a failed request can be retried.
+func (m *Manager) idempotent(ctx context.Context, kind, provider, key string, request, out interface{}, do func() (interface{}, error)) (bool, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return false, err
+	}
+	sum := sha256.Sum256(body)
+	fingerprint := hex.EncodeToString(sum[:])
+	sum = sha256.Sum256([]byte(provider + "\x00" + key))
+	storeKey := "payments:" + kind + ":" + hex.EncodeToString(sum[:])
+
+	if found, err := m.stored(ctx, storeKey, fingerprint, out); found || err != nil {
+		return found, err
+	}
+	lock := cache.NewMutex(m.locker, storeKey, lockTTL)
+	acquired, err := lock.TryAcquire(context.WithoutCancel(ctx))
+	if err != nil {
+		return false, fmt.Errorf("payments: holding the idempotency key: %w", err)
+	}
+	if !acquired {
+		return false, ErrInProgress
+	}
+	defer lock.Release(context.WithoutCancel(ctx))
+	// The first request may have finished since the lookup above
+	if found, err := m.stored(ctx, storeKey, fingerprint, out); found || err != nil {
+		return found, err
+	}
+
+	result, err := do()
+	if err != nil {
+		return false, err
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return false, err
+	}
+	// The payment is made; failing to remember it only loses the replay
+	if err := m.store.Set(context.WithoutCancel(ctx), storeKey, idempotentResult{Fingerprint: fingerprint, Result: data}, m.ttl); err != nil {
+		m.logger.Warn("Failed to store a payment for its idempotency key", zap.String("provider", provider), zap.Error(err))
+	}
+	return false, nil
+}
+
+// stored decodes the result stored at storeKey into out, reporting
+// whether there was one
+func (m *Manager) stored(ctx context.Context, storeKey, fingerprint string, out interface{}) (bool, error) {
+	raw, err := m.store.Get(ctx, storeKey)
+	if err != nil {
+		return false, nil
+	}
+	var stored idempotentResult
+	if json.Unmarshal([]byte(raw), &stored) != nil {
+		return false, nil
+	}
+	if stored.Fingerprint != fingerprint {
+		return false, ErrKeyReused
+	}
+	return true, json.Unmarshal(stored.Result, out)
+}
+
+// On has fn process the webhook events of eventType, or of every type when
+// it is "*". Handlers run in the order added; the first error stops them.
+func (m *Manager) On(eventType string, fn EventHandler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.handlers[eventType] = append(m.handlers[eventType], fn)
+}
+
+// Dispatch runs the handlers of an event, as webhooks do
+func (m *Manager) Dispatch(ctx context.Context, event *Event) error {
+	m.mu.RLock()
+	handlers := append(append([]EventHandler{}, m.handlers[event.Type]...), m.handlers["*"]...)
+	m.mu.RUnlock()
+	for _, fn := range handlers {
+		if err := fn(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Routes registers POST /{provider}, taking each provider's webhooks
+func (m *Manager) Routes(r chi.Router) {
+	r.Post("/{provider}", m.Webhook)
+}
+
+// Webhook verifies a provider's webhook and dispatches its event. Events
+// already processed, which providers deliver again when unsure, are
+// acknowledged without running the handlers twice.
+func (m *Manager) Webhook(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "provider")
+	provider, err := m.Provider(name)
+	if err != nil || name == "" {
+		http.Error(w, "unknown payment provider", http.StatusNotFound)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBody))
+	if err != nil {
+		http.Error(w, "invalid webhook", http.StatusBadRequest)
+		return
+	}
+
+	event, err := provider.Webhook(r, body)
+	var providerErr *ProviderError
+	switch {
+	case errors.Is(err, ErrInvalidSignature):
+		m.logger.Warn("Refused payment webhook with an invalid signature", zap.String("provider", name), zap.Error(err))
+		http.Error(w, "invalid webhook signature", http.StatusBadRequest)
+		return
+	case errors.As(err, &providerErr):
+		// Verifying with the provider failed; it delivers the event again
+		m.logger.Error("Failed to verify payment webhook", zap.String("provider", name), zap.Error(err))
+		http.Error(w, "failed to verify the webhook", http.StatusBadGateway)
+		return
+	case err != nil:
+		m.logger.Warn("Refused invalid payment webhook", zap.String("provider", name), zap.Error(err))
+		http.Error(w, "invalid webhook", http.StatusBadRequest)
+		return
+	case event == nil:
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	event.Provider = name
+	if event.Raw == nil {
+		event.Raw = body
+	}
+
+	ctx := r.Context()
+	seenKey := "payments:event:" + name + ":" + event.ID
+	if seen, _ := m.store.Exists(ctx, seenKey); seen {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	lock := cache.NewMutex(m.locker, seenKey, lockTTL)
+	if acquired, err := lock.TryAcquire(context.WithoutCancel(ctx)); err != nil || !acquired {
+		// Another delivery is being processed; this one is retried
+		http.Error(w, "the event is being processed", http.StatusConflict)
+		return
+	}
+	defer lock.Release(context.WithoutCancel(ctx))
+
+	if err := m.Dispatch(ctx, event); err != nil {
+		m.logger.Error("Failed to process payment event",
+			zap.String("provider", name),
+			zap.String("event", event.ID),
+			zap.String("type", event.Type),
+			zap.Error(err))
+		http.Error(w, "failed to process the event", http.StatusInternalServerError)
+		return
+	}
+	if err := m.store.Set(context.WithoutCancel(ctx), seenKey, "1", m.ttl); err != nil {
+		m.logger.Warn("Failed to remember a payment event", zap.String("provider", name), zap.String("event", event.ID), zap.Error(err))
+	}
+	m.logger.Info("Payment event",
+		zap.String("provider", name),
+		zap.String("event", event.ID),
+		zap.String("type", event.Type),
+		zap.String("charge", event.ChargeID))
+	// 200 rather than 204: Daraja expects it
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,415 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/problem"
+)
+
+// nairobi is the zone of Daraja's timestamps
+var nairobi = time.FixedZone("EAT", 3*60*60)
+
+// MPesa charges with M-Pesa STK push through Safaricom's Daraja API: the
+// customer confirms the payment on their phone and Daraja calls back with
+// the result, which arrives as a charge event. Refunds are reversals,
+// likewise settled by a callback.
+type MPesa struct {
+	baseURL        string
+	consumerKey    string
+	consumerSecret string
+	shortCode      string
+	passKey        string
+	callbackURL    string
+	webhookSecret  string
+	allowed        []*net.IPNet
+
+	initiator  string
+	credential string
+	resultURL  string
+	timeoutURL string
+
+	client *http.Client
+	now    func() time.Time
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// NewMPesa creates a provider for the config's Daraja app, in the sandbox
+// or production
+func NewMPesa(cfg config.MPesaConfig) (*MPesa, error) {
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = "https://sandbox.safaricom.co.ke"
+		if cfg.Environment == "production" {
+			baseURL = "https://api.safaricom.co.ke"
+		}
+	}
+	m := &MPesa{
+		baseURL:        strings.TrimSuffix(baseURL, "/"),
+		consumerKey:    cfg.ConsumerKey,
+		consumerSecret: cfg.ConsumerSecret,
+		shortCode:      cfg.ShortCode,
+		passKey:        cfg.PassKey,
+		callbackURL:    cfg.CallbackURL,
+		webhookSecret:  cfg.WebhookSecret,
+		initiator:      cfg.Initiator,
+		credential:     cfg.SecurityCredential,
+		resultURL:      cfg.ResultURL,
+		timeoutURL:     cfg.TimeoutURL,
+		client:         &http.Client{Timeout: 30 * time.Second},
+		now:            time.Now,
+	}
+	for _, entry := range cfg.AllowedIPs {
+		if !strings.Contains(entry, "/") {
+			if strings.Contains(entry, ":") {
+				entry += "/128"
+			} else {
+				entry += "/32"
+			}
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("payments: mpesa.allowed_ips: %w", err)
+		}
+		m.allowed = append(m.allowed, network)
+	}
+	if m.resultURL == "" {
+		m.resultURL = m.callbackURL
+	}
+	if m.timeoutURL == "" {
+		m.timeoutURL = m.resultURL
+	}
+	return m, nil
+}
+
+func (m *MPesa) Name() string {
+	return "mpesa"
+}
+
+// Charge sends an STK push prompting the phone in Source to pay. M-Pesa
+// takes whole Kenyan shillings, so the amount must be KES in whole units.
+func (m *MPesa) Charge(ctx context.Context, req ChargeRequest) (*Charge, error) {
+	if req.Currency != "KES" {
+		return nil, problem.Validation(map[string]string{"currency": "must be KES for M-Pesa"})
+	}
+	if req.Amount%100 != 0 {
+		return nil, problem.Validation(map[string]string{"amount": "must be whole shillings for M-Pesa"})
+	}
+	phone, ok := normalizePhone(req.Source)
+	if !ok {
+		return nil, problem.Validation(map[string]string{"source": "must be a Kenyan phone number"})
+	}
+	if m.callbackURL == "" || m.webhookSecret == "" {
+		return nil, fmt.Errorf("payments: M-Pesa needs mpesa.callback_url and mpesa.webhook_secret for its results")
+	}
+
+	timestamp := m.now().In(nairobi).Format("20060102150405")
+	reference := req.Reference
+	if reference == "" {
+		reference = m.shortCode
+	}
+	description := req.Description
+	if description == "" {
+		description = "Payment"
+	}
+	var response struct {
+		MerchantRequestID   string `json:"MerchantRequestID"`
+		CheckoutRequestID   string `json:"CheckoutRequestID"`
+		ResponseCode        string `json:"ResponseCode"`
+		ResponseDescription string `json:"ResponseDescription"`
+	}
+	err := m.do(ctx, "/mpesa/stkpush/v1/processrequest", map[string]interface{}{
+		"BusinessShortCode": m.shortCode,
+		"Password":          base64.StdEncoding.EncodeToString([]byte(m.shortCode + m.passKey + timestamp)),
+		"Timestamp":         timestamp,
+		"TransactionType":   "CustomerPayBillOnline",
+		"Amount":            req.Amount / 100,
+		"PartyA":            phone,
+		"PartyB":            m.shortCode,
+		"PhoneNumber":       phone,
+		"CallBackURL":       m.signedURL(m.callbackURL, req.IdempotencyKey),
+		"AccountReference":  truncate(reference, 12),
+		"TransactionDesc":   truncate(description, 13),
+	}, &response)
+	if err != nil {
+		return nil, err
+	}
+	if response.ResponseCode != "0" {
+		return nil, &ProviderError{Provider: m.Name(), Status: http.StatusOK, Code: response.ResponseCode, Message: response.ResponseDescription}
+	}
+	return &Charge{
+		ID:        response.CheckoutRequestID,
+		Provider:  m.Name(),
+		Status:    StatusPending,
+		Amount:    req.Amount,
+		Currency:  req.Currency,
+		Reference: req.Reference,
+	}, nil
+}
+
+// Refund reverses the M-Pesa transaction whose receipt number is the
+// request's ChargeID. Reversals need the amount and the initiator's
+// credentials.
+func (m *MPesa) Refund(ctx context.Context, req RefundRequest) (*Refund, error) {
+	if req.Amount <= 0 || req.Amount%100 != 0 {
+		return nil, problem.Validation(map[string]string{"amount": "must be whole shillings for M-Pesa reversals"})
+	}
+	if m.initiator == "" || m.credential == "" || m.resultURL == "" {
+		return nil, fmt.Errorf("payments: M-Pesa reversals need mpesa.initiator, mpesa.security_credential and a result URL")
+	}
+	remarks := req.Reason
+	if remarks == "" {
+		remarks = "Refund"
+	}
+	var response struct {
+		ConversationID      string `json:"ConversationID"`
+		ResponseCode        string `json:"ResponseCode"`
+		ResponseDescription string `json:"ResponseDescription"`
+	}
+	err := m.do(ctx, "/mpesa/reversal/v1/request", map[string]interface{}{
+		"Initiator":              m.initiator,
+		"SecurityCredential":     m.credential,
+		"CommandID":              "TransactionReversal",
+		"TransactionID":          req.ChargeID,
+		"Amount":                 req.Amount / 100,
+		"ReceiverParty":          m.shortCode,
+		"RecieverIdentifierType": "11",
+		"ResultURL":              m.signedURL(m.resultURL, req.IdempotencyKey),
+		"QueueTimeOutURL":        m.signedURL(m.timeoutURL, req.IdempotencyKey),
+		"Remarks":                truncate(remarks, 100),
+		"Occasion":               "",
+	}, &response)
+	if err != nil {
+		return nil, err
+	}
+	if response.ResponseCode != "0" {
+		return nil, &ProviderError{Provider: m.Name(), Status: http.StatusOK, Code: response.ResponseCode, Message: response.ResponseDescription}
+	}
+	return &Refund{ID: response.ConversationID, Provider: m.Name(), ChargeID: req.ChargeID, Status: StatusPending, Amount: req.Amount}, nil
+}
+
+// mpesaCallback is an STK push result or a reversal result
+type mpesaCallback struct {
+	Body *struct {
+		StkCallback struct {
+			MerchantRequestID string `json:"MerchantRequestID"`
+			CheckoutRequestID string `json:"CheckoutRequestID"`
+			ResultCode        int    `json:"ResultCode"`
+			ResultDesc        string `json:"ResultDesc"`
+			CallbackMetadata  struct {
+				Item []struct {
+					Name  string      `json:"Name"`
+					Value interface{} `json:"Value"`
+				} `json:"Item"`
+			} `json:"CallbackMetadata"`
+		} `json:"stkCallback"`
+	} `json:"Body"`
+	Result *struct {
+		ResultCode     int    `json:"ResultCode"`
+		ResultDesc     string `json:"ResultDesc"`
+		ConversationID string `json:"ConversationID"`
+		TransactionID  string `json:"TransactionID"`
+	} `json:"Result"`
+}
+
+// Webhook takes Daraja's callbacks. Daraja doesn't sign them, so each
+// callback URL carries an HMAC of a reference made for the request, and
+// callbacks may be limited to Safaricom's addresses with allowed_ips.
+func (m *MPesa) Webhook(r *http.Request, body []byte) (*Event, error) {
+	if err := m.verify(r); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	var callback mpesaCallback
+	if err := json.Unmarshal(body, &callback); err != nil {
+		return nil, fmt.Errorf("payments: invalid M-Pesa callback: %w", err)
+	}
+
+	switch {
+	case callback.Body != nil:
+		stk := callback.Body.StkCallback
+		e := &Event{ID: stk.CheckoutRequestID, Type: EventChargeSucceeded, ChargeID: stk.CheckoutRequestID, Currency: "KES", Raw: body}
+		if stk.ResultCode != 0 {
+			e.Type, e.Message = EventChargeFailed, stk.ResultDesc
+			return e, nil
+		}
+		for _, item := range stk.CallbackMetadata.Item {
+			switch item.Name {
+			case "Amount":
+				if amount, ok := item.Value.(float64); ok {
+					e.Amount = int64(math.Round(amount * 100))
+				}
+			case "MpesaReceiptNumber":
+				e.Receipt = fmt.Sprint(item.Value)
+			}
+		}
+		return e, nil
+	case callback.Result != nil:
+		result := callback.Result
+		e := &Event{ID: result.ConversationID, Type: EventRefundSucceeded, RefundID: result.ConversationID, ChargeID: result.TransactionID, Currency: "KES", Raw: body}
+		if result.ResultCode != 0 {
+			e.Type, e.Message = EventRefundFailed, result.ResultDesc
+		}
+		return e, nil
+	}
+	return nil, nil
+}
+
+// verify checks the callback comes from an allowed address and carries
+// the HMAC its URL was given
+func (m *MPesa) verify(r *http.Request) error {
+	if len(m.allowed) > 0 {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		ip := net.ParseIP(host)
+		allowed := false
+		for _, network := range m.allowed {
+			if ip != nil && network.Contains(ip) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("%s is not an allowed address", host)
+		}
+	}
+	if m.webhookSecret == "" {
+		return fmt.Errorf("no webhook secret configured")
+	}
+	ref, signature := r.URL.Query().Get("ref"), r.URL.Query().Get("sig")
+	if ref == "" || !hmac.Equal([]byte(m.sign(ref)), []byte(signature)) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+// signedURL adds ref and its HMAC to a callback URL
+func (m *MPesa) signedURL(rawURL, ref string) string {
+	query := url.Values{"ref": {ref}, "sig": {m.sign(ref)}}.Encode()
+	if strings.Contains(rawURL, "?") {
+		return rawURL + "&" + query
+	}
+	return rawURL + "?" + query
+}
+
+func (m *MPesa) sign(ref string) string {
+	mac := hmac.New(sha256.New, []byte(m.webhookSecret))
+	mac.Write([]byte(ref))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// accessToken returns an OAuth token for the Daraja app, fetched again a
+// minute before it expires
+func (m *MPesa) accessToken(ctx context.Context) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.token != "" && m.now().Before(m.expires) {
+		return m.token, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.baseURL+"/oauth/v1/generate?grant_type=client_credentials", nil)
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(m.consumerKey, m.consumerSecret)
+	var token struct {
+		AccessToken string `json:"access_token"`
+		// ExpiresIn is a string of seconds
+		ExpiresIn string `json:"expires_in"`
+	}
+	if err := m.send(req, &token); err != nil {
+		return "", err
+	}
+	seconds, _ := strconv.Atoi(token.ExpiresIn)
+	m.token = token.AccessToken
+	m.expires = m.now().Add(time.Duration(seconds)*time.Second - time.Minute)
+	return m.token, nil
+}
+
+// do posts a JSON request to Daraja and decodes its answer into out
+func (m *MPesa) do(ctx context.Context, path string, body, out interface{}) error {
+	token, err := m.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.baseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	return m.send(req, out)
+}
+
+func (m *MPesa) send(req *http.Request, out interface{}) error {
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("payments: mpesa: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxWebhookBody))
+	if err != nil {
+		return fmt.Errorf("payments: reading the mpesa response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var body struct {
+			ErrorCode    string `json:"errorCode"`
+			ErrorMessage string `json:"errorMessage"`
+		}
+		json.Unmarshal(data, &body)
+		return &ProviderError{Provider: m.Name(), Status: resp.StatusCode, Code: body.ErrorCode, Message: body.ErrorMessage}
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("payments: reading the mpesa response: %w", err)
+	}
+	return nil
+}
+
+// normalizePhone writes a Kenyan phone number as Daraja takes it,
+// 2547XXXXXXXX, from the forms people type: 07..., +2547... or 2547...
+func normalizePhone(phone string) (string, bool) {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, phone)
+	switch {
+	case strings.HasPrefix(digits, "0") && len(digits) == 10:
+		digits = "254" + digits[1:]
+	case len(digits) == 9:
+		digits = "254" + digits
+	}
+	return digits, len(digits) == 12 && strings.HasPrefix(digits, "254")
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
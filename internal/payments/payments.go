@@ -0,0 +1,284 @@
+// Package payments takes payments through Stripe, PayPal and M-Pesa behind
+// one interface. Charges and refunds are idempotent, so a retried request
+// doesn't take a payment twice, and provider webhooks are verified before
+// their events reach the application:
+//
+//	charge, err := manager.Charge(ctx, "mpesa", payments.ChargeRequest{
+//		Amount:         150000, // KES 1,500.00
+//		Currency:       "KES",
+//		Source:         "0712345678",
+//		Reference:      order.Number,
+//		IdempotencyKey: "order-" + order.ID,
+//	})
+//
+//	manager.On(payments.EventChargeSucceeded, func(ctx context.Context, e *payments.Event) error {
+//		return orders.MarkPaid(ctx, e.ChargeID, e.Receipt)
+//	})
+//
+// Other providers are added with Register; `dolphin make:payment-handler`
+// generates one to fill in.
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mrhoseah/dolphin/internal/problem"
+)
+
+// Statuses of charges and refunds
+const (
+	// StatusPending waits on the customer or the provider, such as a
+	// prompt on the customer's phone; a webhook event settles it
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// Types of the events webhooks deliver
+const (
+	EventChargeSucceeded = "charge.succeeded"
+	EventChargeFailed    = "charge.failed"
+	EventRefundSucceeded = "refund.succeeded"
+	EventRefundFailed    = "refund.failed"
+)
+
+// ErrInvalidSignature is returned for webhooks whose signature doesn't
+// verify, which are refused
+var ErrInvalidSignature = errors.New("payments: invalid webhook signature")
+
+// ErrUnknownProvider is returned for providers that aren't configured
+var ErrUnknownProvider = errors.New("payments: unknown provider")
+
+// ChargeRequest asks a provider to take a payment
+type ChargeRequest struct {
+	// Amount is in the currency's minor unit, such as cents
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+
+	// Source is what is charged: a Stripe payment method ID, a PayPal order
+	// the buyer approved, or an M-Pesa phone number. Without one, Stripe
+	// returns a ClientSecret for Stripe.js and PayPal a RedirectURL.
+	Source string `json:"source,omitempty"`
+
+	Description string `json:"description,omitempty"`
+
+	// Reference is the application's own reference, such as an order
+	// number, shown to the customer where the provider allows
+	Reference string            `json:"reference,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+
+	// ReturnURL is where the customer comes back to after completing the
+	// payment on the provider's pages
+	ReturnURL string `json:"return_url,omitempty"`
+
+	// IdempotencyKey identifies the charge, so a request repeating it gets
+	// the first charge back instead of making another. One is made up when
+	// empty, which only guards against the provider's own retries.
+	IdempotencyKey string `json:"-"`
+}
+
+// Charge is a payment taken, or being taken, by a provider
+type Charge struct {
+	ID        string `json:"id"`
+	Provider  string `json:"provider"`
+	Status    string `json:"status"`
+	Amount    int64  `json:"amount"`
+	Currency  string `json:"currency"`
+	Reference string `json:"reference,omitempty"`
+
+	// RedirectURL is where the customer completes the payment, such as
+	// PayPal's approval page or a 3-D Secure check
+	RedirectURL string `json:"redirect_url,omitempty"`
+
+	// ClientSecret lets Stripe.js confirm a charge made without a Source
+	ClientSecret string `json:"client_secret,omitempty"`
+
+	// Replayed is set when the charge was made by an earlier request with
+	// the same idempotency key
+	Replayed bool `json:"-"`
+}
+
+// RefundRequest asks a provider to give back some or all of a charge
+type RefundRequest struct {
+	// ChargeID is the charge's ID; for M-Pesa, the receipt number of the
+	// payment (Event.Receipt), which reversals name
+	ChargeID string `json:"charge_id"`
+
+	// Amount is in the charge currency's minor unit; 0 refunds the whole
+	// charge, except on M-Pesa, which needs the amount
+	Amount int64  `json:"amount,omitempty"`
+	Reason string `json:"reason,omitempty"`
+
+	// IdempotencyKey works as ChargeRequest's does
+	IdempotencyKey string `json:"-"`
+}
+
+// Refund is money given back, or being given back, by a provider
+type Refund struct {
+	ID       string `json:"id"`
+	Provider string `json:"provider"`
+	ChargeID string `json:"charge_id"`
+	Status   string `json:"status"`
+	Amount   int64  `json:"amount,omitempty"`
+
+	Replayed bool `json:"-"`
+}
+
+// Event is something a provider's webhook reported about a charge or
+// refund
+type Event struct {
+	// ID is the provider's ID of the event, the same on redeliveries
+	ID       string `json:"id"`
+	Provider string `json:"provider"`
+	Type     string `json:"type"`
+
+	ChargeID string `json:"charge_id,omitempty"`
+	RefundID string `json:"refund_id,omitempty"`
+	Amount   int64  `json:"amount,omitempty"`
+	Currency string `json:"currency,omitempty"`
+
+	// Receipt is the provider's reference for the settled payment, such as
+	// an M-Pesa receipt number or a PayPal capture ID
+	Receipt string `json:"receipt,omitempty"`
+
+	// Message explains failures, as the provider put it
+	Message string `json:"message,omitempty"`
+
+	// Raw is the webhook's body
+	Raw json.RawMessage `json:"raw,omitempty"`
+}
+
+// Provider takes payments through a payment service
+type Provider interface {
+	// Name identifies the provider in webhook URLs and events
+	Name() string
+
+	// Charge takes a payment. The request's idempotency key is always set
+	// and should be passed on to providers supporting one.
+	Charge(ctx context.Context, req ChargeRequest) (*Charge, error)
+
+	// Refund gives back some or all of a charge
+	Refund(ctx context.Context, req RefundRequest) (*Refund, error)
+
+	// Webhook verifies the signature of a webhook request, whose body has
+	// been read, and returns its event. A nil event is one the application
+	// doesn't need, such as a customer update; ErrInvalidSignature refuses
+	// the request.
+	Webhook(r *http.Request, body []byte) (*Event, error)
+}
+
+// Factory creates a provider registered with Register from its settings
+// under payments.providers.<name>
+type Factory func(settings map[string]string) (Provider, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{}
+)
+
+// Register adds a provider the manager of the payments config creates,
+// typically from an init function. Registering a name again replaces its
+// factory.
+func Register(name string, factory Factory) {
+	if name == "" || factory == nil {
+		panic("payments: Register needs a name and a factory")
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = factory
+}
+
+// Registered lists the names of registered providers
+func Registered() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func factory(name string) Factory {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return registry[name]
+}
+
+// ProviderError is a provider refusing a request
+type ProviderError struct {
+	Provider string
+	Status   int
+	Code     string
+	Message  string
+
+	// Declined is set when the customer's payment was refused, such as a
+	// declined card, rather than the request
+	Declined bool
+}
+
+func (e *ProviderError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("payments: %s returned status %d (%s): %s", e.Provider, e.Status, e.Code, e.Message)
+	}
+	return fmt.Sprintf("payments: %s returned status %d: %s", e.Provider, e.Status, e.Message)
+}
+
+// Problem reports declined payments as 402 with the provider's message,
+// which is meant for customers, and other failures as 502
+func (e *ProviderError) Problem() *problem.Problem {
+	if e.Declined {
+		p := problem.New(http.StatusPaymentRequired, e.Message)
+		p.Code = e.Code
+		return p
+	}
+	return problem.New(http.StatusBadGateway, "The payment provider failed to handle the request")
+}
+
+// minorUnits returns how many digits a currency has after the point
+func minorUnits(currency string) int {
+	switch strings.ToUpper(currency) {
+	case "BIF", "CLP", "DJF", "GNF", "HUF", "JPY", "KMF", "KRW", "MGA", "PYG", "RWF", "TWD", "UGX", "VND", "VUV", "XAF", "XOF", "XPF":
+		return 0
+	}
+	return 2
+}
+
+// formatAmount writes an amount in minor units as a decimal, e.g. 1050
+// USD as "10.50"
+func formatAmount(amount int64, currency string) string {
+	digits := minorUnits(currency)
+	if digits == 0 {
+		return strconv.FormatInt(amount, 10)
+	}
+	sign := ""
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, amount/100, amount%100)
+}
+
+// parseAmount reads a decimal amount into minor units, e.g. "10.5" USD as
+// 1050
+func parseAmount(value, currency string) (int64, error) {
+	whole, fraction, _ := strings.Cut(value, ".")
+	digits := minorUnits(currency)
+	if len(fraction) > digits {
+		return 0, fmt.Errorf("payments: %s has more than %d decimals", value, digits)
+	}
+	fraction += strings.Repeat("0", digits-len(fraction))
+	amount, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("payments: invalid amount %q", value)
+	}
+	return amount, nil
+}
@@ -0,0 +1,513 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/mrhoseah/dolphin/internal/cache"
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/problem"
+	"github.com/mrhoseah/dolphin/internal/webhooks"
+)
+
+// fakeProvider counts the charges and refunds it is asked for
+type fakeProvider struct {
+	charges atomic.Int32
+	refunds atomic.Int32
+	event   *Event
+}
+
+func (p *fakeProvider) Name() string { return "fake" }
+
+func (p *fakeProvider) Charge(ctx context.Context, req ChargeRequest) (*Charge, error) {
+	n := p.charges.Add(1)
+	if req.Source == "declined" {
+		return nil, &ProviderError{Provider: "fake", Status: 402, Code: "card_declined", Message: "Your card was declined.", Declined: true}
+	}
+	return &Charge{ID: fmt.Sprintf("ch_%d", n), Provider: "fake", Status: StatusSucceeded, Amount: req.Amount, Currency: req.Currency}, nil
+}
+
+func (p *fakeProvider) Refund(ctx context.Context, req RefundRequest) (*Refund, error) {
+	n := p.refunds.Add(1)
+	return &Refund{ID: fmt.Sprintf("re_%d", n), Provider: "fake", ChargeID: req.ChargeID, Status: StatusSucceeded, Amount: req.Amount}, nil
+}
+
+func (p *fakeProvider) Webhook(r *http.Request, body []byte) (*Event, error) {
+	if r.Header.Get("Signature") != "valid" {
+		return nil, ErrInvalidSignature
+	}
+	return p.event, nil
+}
+
+func newTestManager(providers ...Provider) *Manager {
+	m := NewManager("fake", cache.NewMemoryCache(), cache.NewMemoryCache(), time.Hour, nil)
+	for _, p := range providers {
+		m.Add(p)
+	}
+	return m
+}
+
+func TestManagerChargesOncePerKey(t *testing.T) {
+	provider := &fakeProvider{}
+	m := newTestManager(provider)
+	ctx := context.Background()
+	req := ChargeRequest{Amount: 1000, Currency: "usd", Source: "pm_card", IdempotencyKey: "order-1"}
+
+	first, err := m.Charge(ctx, "", req)
+	require.NoError(t, err)
+	assert.Equal(t, "ch_1", first.ID)
+	assert.Equal(t, "USD", first.Currency)
+	assert.False(t, first.Replayed)
+
+	again, err := m.Charge(ctx, "fake", req)
+	require.NoError(t, err)
+	assert.Equal(t, "ch_1", again.ID)
+	assert.True(t, again.Replayed)
+	assert.EqualValues(t, 1, provider.charges.Load())
+
+	req.Amount = 2000
+	_, err = m.Charge(ctx, "", req)
+	assert.ErrorIs(t, err, ErrKeyReused)
+	assert.Equal(t, http.StatusUnprocessableEntity, problem.From(err).Status)
+
+	// Failures aren't kept, so they can be retried
+	declined := ChargeRequest{Amount: 1000, Currency: "USD", Source: "declined", IdempotencyKey: "order-2"}
+	_, err = m.Charge(ctx, "", declined)
+	p := problem.From(err)
+	assert.Equal(t, http.StatusPaymentRequired, p.Status)
+	assert.Equal(t, "Your card was declined.", p.Detail)
+	_, err = m.Charge(ctx, "", declined)
+	assert.Error(t, err)
+	assert.EqualValues(t, 3, provider.charges.Load())
+
+	_, err = m.Charge(ctx, "", ChargeRequest{Currency: "USD"})
+	assert.Equal(t, http.StatusUnprocessableEntity, problem.From(err).Status)
+	_, err = m.Charge(ctx, "stripe", req)
+	assert.ErrorIs(t, err, ErrUnknownProvider)
+
+	refund, err := m.Refund(ctx, "", RefundRequest{ChargeID: "ch_1", IdempotencyKey: "refund-1"})
+	require.NoError(t, err)
+	again2, err := m.Refund(ctx, "", RefundRequest{ChargeID: "ch_1", IdempotencyKey: "refund-1"})
+	require.NoError(t, err)
+	assert.Equal(t, refund.ID, again2.ID)
+	assert.True(t, again2.Replayed)
+	assert.EqualValues(t, 1, provider.refunds.Load())
+}
+
+func TestManagerChargeInProgress(t *testing.T) {
+	locks := cache.NewMemoryCache()
+	m := NewManager("fake", cache.NewMemoryCache(), locks, time.Hour, nil)
+	m.Add(&fakeProvider{})
+	ctx := context.Background()
+
+	// Another instance is charging with the key
+	req := ChargeRequest{Amount: 1000, Currency: "USD", IdempotencyKey: "order-1"}
+	_, err := m.idempotent(ctx, "charge", "fake", "order-1", req, &Charge{}, func() (interface{}, error) {
+		_, err := m.Charge(ctx, "", req)
+		return &Charge{}, err
+	})
+	assert.ErrorIs(t, err, ErrInProgress)
+	assert.Equal(t, http.StatusConflict, problem.From(err).Status)
+}
+
+func TestManagerWebhook(t *testing.T) {
+	provider := &fakeProvider{event: &Event{ID: "evt_1", Type: EventChargeSucceeded, ChargeID: "ch_1"}}
+	m := newTestManager(provider)
+	var handled []string
+	m.On(EventChargeSucceeded, func(ctx context.Context, e *Event) error {
+		handled = append(handled, e.Provider+":"+e.ChargeID)
+		return nil
+	})
+	failing := true
+	m.On("*", func(ctx context.Context, e *Event) error {
+		if failing {
+			return errors.New("database is down")
+		}
+		return nil
+	})
+	r := chi.NewRouter()
+	r.Route("/webhooks/payments", m.Routes)
+	send := func(provider, signature string) int {
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/payments/"+provider, strings.NewReader(`{}`))
+		req.Header.Set("Signature", signature)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusNotFound, send("stripe", "valid"))
+	assert.Equal(t, http.StatusBadRequest, send("fake", "forged"))
+	assert.Empty(t, handled)
+
+	assert.Equal(t, http.StatusInternalServerError, send("fake", "valid"), "retried by the provider")
+	failing = false
+	assert.Equal(t, http.StatusOK, send("fake", "valid"))
+	assert.Equal(t, http.StatusOK, send("fake", "valid"), "redelivered")
+	assert.Equal(t, []string{"fake:ch_1", "fake:ch_1"}, handled, "once after the failed delivery")
+
+	provider.event = nil
+	assert.Equal(t, http.StatusOK, send("fake", "valid"), "events the application doesn't need")
+}
+
+func TestFromConfig(t *testing.T) {
+	Register("test-gateway", func(settings map[string]string) (Provider, error) {
+		if settings["api_key"] == "" {
+			return nil, errors.New("api_key is required")
+		}
+		return &fakeProvider{}, nil
+	})
+	defer func() {
+		registryMu.Lock()
+		delete(registry, "test-gateway")
+		registryMu.Unlock()
+	}()
+
+	cfg := config.PaymentsConfig{
+		Default: "stripe",
+		Stripe:  config.StripeConfig{SecretKey: "sk_test"},
+		MPesa:   config.MPesaConfig{ConsumerKey: "key", AllowedIPs: []string{"196.201.214.0/24", "196.201.213.114"}},
+		Providers: map[string]map[string]string{
+			"test-gateway": {"api_key": "secret"},
+		},
+	}
+	m, err := FromConfig(cfg, cache.NewMemoryCache(), cache.NewMemoryCache(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"fake", "mpesa", "stripe"}, m.Providers())
+	provider, err := m.Provider("")
+	require.NoError(t, err)
+	assert.Equal(t, "stripe", provider.Name())
+
+	cfg.Providers = nil
+	_, err = FromConfig(cfg, cache.NewMemoryCache(), cache.NewMemoryCache(), nil)
+	assert.ErrorContains(t, err, "api_key is required")
+}
+
+func TestAmounts(t *testing.T) {
+	assert.Equal(t, "10.50", formatAmount(1050, "USD"))
+	assert.Equal(t, "0.05", formatAmount(5, "EUR"))
+	assert.Equal(t, "1050", formatAmount(1050, "JPY"))
+
+	amount, err := parseAmount("10.5", "USD")
+	require.NoError(t, err)
+	assert.EqualValues(t, 1050, amount)
+	amount, err = parseAmount("1050", "JPY")
+	require.NoError(t, err)
+	assert.EqualValues(t, 1050, amount)
+	_, err = parseAmount("10.505", "USD")
+	assert.Error(t, err)
+}
+
+// stripeSignature signs a webhook body as Stripe does
+func stripeSignature(secret string, at time.Time, body string) string {
+	timestamp := fmt.Sprint(at.Unix())
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + body))
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestStripe(t *testing.T) {
+	var requests []*http.Request
+	var forms []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		requests = append(requests, r)
+		forms = append(forms, r.PostForm)
+		switch {
+		case r.URL.Path == "/v1/payment_intents" && r.PostForm.Get("payment_method") == "pm_card_chargeDeclined":
+			w.WriteHeader(http.StatusPaymentRequired)
+			w.Write([]byte(`{"error":{"type":"card_error","code":"card_declined","message":"Your card was declined."}}`))
+		case r.URL.Path == "/v1/payment_intents":
+			w.Write([]byte(`{"id":"pi_1","status":"succeeded","amount":1000,"currency":"usd","client_secret":"pi_1_secret"}`))
+		case r.URL.Path == "/v1/refunds":
+			w.Write([]byte(`{"id":"re_1","status":"succeeded","amount":400,"payment_intent":"pi_1"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	stripe := NewStripe(config.StripeConfig{SecretKey: "sk_test", WebhookSecret: "whsec_test", BaseURL: server.URL})
+	ctx := context.Background()
+
+	charge, err := stripe.Charge(ctx, ChargeRequest{Amount: 1000, Currency: "USD", Source: "pm_card_visa", Reference: "order-1", IdempotencyKey: "key-1"})
+	require.NoError(t, err)
+	assert.Equal(t, &Charge{ID: "pi_1", Provider: "stripe", Status: StatusSucceeded, Amount: 1000, Currency: "USD", Reference: "order-1"}, charge)
+	user, _, _ := requests[0].BasicAuth()
+	assert.Equal(t, "sk_test", user)
+	assert.Equal(t, "key-1", requests[0].Header.Get("Idempotency-Key"))
+	assert.Equal(t, "usd", forms[0].Get("currency"))
+	assert.Equal(t, "true", forms[0].Get("confirm"))
+	assert.Equal(t, "order-1", forms[0].Get("metadata[reference]"))
+
+	_, err = stripe.Charge(ctx, ChargeRequest{Amount: 1000, Currency: "USD", Source: "pm_card_chargeDeclined"})
+	var providerErr *ProviderError
+	require.ErrorAs(t, err, &providerErr)
+	assert.True(t, providerErr.Declined)
+	assert.Equal(t, "card_declined", providerErr.Code)
+
+	refund, err := stripe.Refund(ctx, RefundRequest{ChargeID: "pi_1", Amount: 400, Reason: "requested_by_customer"})
+	require.NoError(t, err)
+	assert.Equal(t, StatusSucceeded, refund.Status)
+	assert.Equal(t, "pi_1", forms[2].Get("payment_intent"))
+	assert.Equal(t, "400", forms[2].Get("amount"))
+
+	now := time.Unix(1700000000, 0)
+	stripe.now = func() time.Time { return now }
+	body := `{"id":"evt_1","type":"payment_intent.succeeded","data":{"object":{"id":"pi_1","amount":1000,"currency":"usd","latest_charge":"ch_1"}}}`
+	webhook := func(signature string) (*Event, error) {
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/payments/stripe", nil)
+		req.Header.Set("Stripe-Signature", signature)
+		return stripe.Webhook(req, []byte(body))
+	}
+	event, err := webhook(stripeSignature("whsec_test", now, body))
+	require.NoError(t, err)
+	assert.Equal(t, "evt_1", event.ID)
+	assert.Equal(t, EventChargeSucceeded, event.Type)
+	assert.Equal(t, "pi_1", event.ChargeID)
+	assert.Equal(t, "ch_1", event.Receipt)
+	assert.EqualValues(t, 1000, event.Amount)
+
+	_, err = webhook(stripeSignature("whsec_other", now, body))
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+	_, err = webhook(stripeSignature("whsec_test", now.Add(-time.Hour), body))
+	assert.ErrorIs(t, err, ErrInvalidSignature, "too old to be trusted")
+}
+
+func TestStripeWebhookReplay(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "webhooks.db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	require.NoError(t, err)
+	store, err := webhooks.NewStore(db)
+	require.NoError(t, err)
+	capturer := webhooks.New(store, config.WebhooksConfig{}, nil)
+
+	stripe := NewStripe(config.StripeConfig{WebhookSecret: "whsec_test"})
+	handler := capturer.Middleware("payments")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if _, err := stripe.Webhook(r, body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}))
+	capturer.SetHandler(handler)
+
+	body := `{"id":"evt_1","type":"payment_intent.succeeded","data":{"object":{"id":"pi_1"}}}`
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/payments/stripe", strings.NewReader(body))
+	req.Header.Set("Stripe-Signature", stripeSignature("whsec_test", time.Now(), body))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	deliveries, err := store.List(context.Background(), webhooks.Filter{})
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+
+	// Replayed hours later, the signature is checked as of when it arrived
+	stripe.now = func() time.Time { return time.Now().Add(3 * time.Hour) }
+	replay, err := capturer.Replay(context.Background(), deliveries[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, replay.Status, replay.Response)
+
+	req = httptest.NewRequest(http.MethodPost, "/webhooks/payments/stripe", strings.NewReader(body))
+	req.Header = deliveries[0].Headers
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "resending it is still refused")
+}
+
+func TestPayPal(t *testing.T) {
+	var tokens atomic.Int32
+	var requestIDs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/oauth2/token" {
+			tokens.Add(1)
+			w.Write([]byte(`{"access_token":"token-1","expires_in":32400}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer token-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		requestIDs = append(requestIDs, r.Header.Get("PayPal-Request-Id"))
+		body, _ := io.ReadAll(r.Body)
+		switch r.URL.Path {
+		case "/v2/checkout/orders":
+			assert.Contains(t, string(body), `"value":"25.00"`)
+			w.Write([]byte(`{"id":"ORDER-1","status":"CREATED","links":[{"href":"https://www.sandbox.paypal.com/checkoutnow?token=ORDER-1","rel":"approve"}]}`))
+		case "/v2/checkout/orders/ORDER-1/capture":
+			w.Write([]byte(`{"id":"ORDER-1","status":"COMPLETED","purchase_units":[{"payments":{"captures":[{"id":"CAPTURE-1","status":"COMPLETED","amount":{"currency_code":"USD","value":"25.00"}}]}}]}`))
+		case "/v2/checkout/orders/ORDER-2/capture":
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write([]byte(`{"name":"UNPROCESSABLE_ENTITY","message":"The requested action could not be performed.","details":[{"issue":"INSTRUMENT_DECLINED"}]}`))
+		case "/v2/checkout/orders/ORDER-1":
+			w.Write([]byte(`{"id":"ORDER-1","status":"COMPLETED","purchase_units":[{"payments":{"captures":[{"id":"CAPTURE-1","status":"COMPLETED","amount":{"currency_code":"USD","value":"25.00"}}]}}]}`))
+		case "/v2/payments/captures/CAPTURE-1/refund":
+			w.Write([]byte(`{"id":"REFUND-1","status":"COMPLETED"}`))
+		case "/v1/notifications/verify-webhook-signature":
+			var verification map[string]interface{}
+			json.Unmarshal(body, &verification)
+			status := "FAILURE"
+			if verification["transmission_sig"] == "valid" && verification["webhook_id"] == "WH-1" {
+				status = "SUCCESS"
+			}
+			w.Write([]byte(`{"verification_status":"` + status + `"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	paypal := NewPayPal(config.PayPalConfig{ClientID: "client", ClientSecret: "secret", WebhookID: "WH-1", BaseURL: server.URL})
+	ctx := context.Background()
+
+	order, err := paypal.Charge(ctx, ChargeRequest{Amount: 2500, Currency: "USD", IdempotencyKey: "key-1"})
+	require.NoError(t, err)
+	assert.Equal(t, StatusPending, order.Status)
+	assert.Equal(t, "https://www.sandbox.paypal.com/checkoutnow?token=ORDER-1", order.RedirectURL)
+
+	// Once the buyer approved the order
+	charge, err := paypal.Charge(ctx, ChargeRequest{Amount: 2500, Currency: "USD", Source: "ORDER-1", IdempotencyKey: "key-2"})
+	require.NoError(t, err)
+	assert.Equal(t, StatusSucceeded, charge.Status)
+	assert.EqualValues(t, 2500, charge.Amount)
+	assert.Equal(t, []string{"key-1", "key-2"}, requestIDs)
+	assert.EqualValues(t, 1, tokens.Load(), "the token is reused")
+
+	_, err = paypal.Charge(ctx, ChargeRequest{Amount: 2500, Currency: "USD", Source: "ORDER-2"})
+	var providerErr *ProviderError
+	require.ErrorAs(t, err, &providerErr)
+	assert.True(t, providerErr.Declined)
+
+	refund, err := paypal.Refund(ctx, RefundRequest{ChargeID: "ORDER-1"})
+	require.NoError(t, err)
+	assert.Equal(t, &Refund{ID: "REFUND-1", Provider: "paypal", ChargeID: "ORDER-1", Status: StatusSucceeded, Amount: 2500}, refund)
+
+	body := `{"id":"WH-EVT-1","event_type":"PAYMENT.CAPTURE.COMPLETED","resource":{"id":"CAPTURE-1","status":"COMPLETED","amount":{"currency_code":"USD","value":"25.00"},"supplementary_data":{"related_ids":{"order_id":"ORDER-1"}}}}`
+	webhook := func(signature string) (*Event, error) {
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/payments/paypal", nil)
+		req.Header.Set("Paypal-Transmission-Sig", signature)
+		return paypal.Webhook(req, []byte(body))
+	}
+	event, err := webhook("valid")
+	require.NoError(t, err)
+	assert.Equal(t, EventChargeSucceeded, event.Type)
+	assert.Equal(t, "ORDER-1", event.ChargeID)
+	assert.Equal(t, "CAPTURE-1", event.Receipt)
+	assert.EqualValues(t, 2500, event.Amount)
+	_, err = webhook("forged")
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+}
+
+func TestMPesa(t *testing.T) {
+	var pushed map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth/v1/generate":
+			w.Write([]byte(`{"access_token":"token-1","expires_in":"3599"}`))
+		case "/mpesa/stkpush/v1/processrequest":
+			assert.Equal(t, "Bearer token-1", r.Header.Get("Authorization"))
+			json.NewDecoder(r.Body).Decode(&pushed)
+			w.Write([]byte(`{"MerchantRequestID":"29115-34620561-1","CheckoutRequestID":"ws_CO_191220191020363925","ResponseCode":"0","ResponseDescription":"Success. Request accepted for processing"}`))
+		case "/mpesa/reversal/v1/request":
+			w.Write([]byte(`{"OriginatorConversationID":"1","ConversationID":"AG_20191219_00005797af5d7d75f652","ResponseCode":"0","ResponseDescription":"Accept the service request successfully."}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	mpesa, err := NewMPesa(config.MPesaConfig{
+		BaseURL:            server.URL,
+		ConsumerKey:        "key",
+		ConsumerSecret:     "secret",
+		ShortCode:          "174379",
+		PassKey:            "passkey",
+		CallbackURL:        "https://shop.example.com/webhooks/payments/mpesa",
+		WebhookSecret:      "callback-secret",
+		AllowedIPs:         []string{"196.201.214.0/24"},
+		Initiator:          "api",
+		SecurityCredential: "credential",
+	})
+	require.NoError(t, err)
+	mpesa.now = func() time.Time { return time.Date(2019, 12, 19, 7, 20, 36, 0, time.UTC) }
+	ctx := context.Background()
+
+	charge, err := mpesa.Charge(ctx, ChargeRequest{Amount: 150000, Currency: "KES", Source: "0712 345 678", Reference: "INV-42", IdempotencyKey: "order-42"})
+	require.NoError(t, err)
+	assert.Equal(t, &Charge{ID: "ws_CO_191220191020363925", Provider: "mpesa", Status: StatusPending, Amount: 150000, Currency: "KES", Reference: "INV-42"}, charge)
+	assert.Equal(t, "254712345678", pushed["PhoneNumber"])
+	assert.EqualValues(t, 1500, pushed["Amount"])
+	assert.Equal(t, "20191219102036", pushed["Timestamp"], "in Nairobi time")
+	callbackURL, err := url.Parse(pushed["CallBackURL"].(string))
+	require.NoError(t, err)
+	assert.Equal(t, "order-42", callbackURL.Query().Get("ref"))
+
+	for source, want := range map[string]string{"+254712345678": "currency", "0712345678": "amount", "12345": "source"} {
+		req := ChargeRequest{Amount: 150000, Currency: "KES", Source: source}
+		switch want {
+		case "currency":
+			req.Currency = "USD"
+		case "amount":
+			req.Amount = 150050
+		}
+		_, err := mpesa.Charge(ctx, req)
+		assert.Contains(t, problem.From(err).Errors, want, source)
+	}
+
+	refund, err := mpesa.Refund(ctx, RefundRequest{ChargeID: "NLJ7RT61SV", Amount: 150000})
+	require.NoError(t, err)
+	assert.Equal(t, StatusPending, refund.Status)
+	assert.Equal(t, "AG_20191219_00005797af5d7d75f652", refund.ID)
+
+	body := `{"Body":{"stkCallback":{"MerchantRequestID":"29115-34620561-1","CheckoutRequestID":"ws_CO_191220191020363925","ResultCode":0,"ResultDesc":"The service request is processed successfully.","CallbackMetadata":{"Item":[{"Name":"Amount","Value":1500.00},{"Name":"MpesaReceiptNumber","Value":"NLJ7RT61SV"},{"Name":"TransactionDate","Value":20191219102115},{"Name":"PhoneNumber","Value":254712345678}]}}}}`
+	webhook := func(target, remote string) (*Event, error) {
+		req := httptest.NewRequest(http.MethodPost, target, nil)
+		req.RemoteAddr = remote
+		return mpesa.Webhook(req, []byte(body))
+	}
+	event, err := webhook(callbackURL.RequestURI(), "196.201.214.200:443")
+	require.NoError(t, err)
+	assert.Equal(t, &Event{
+		ID:       "ws_CO_191220191020363925",
+		Type:     EventChargeSucceeded,
+		ChargeID: "ws_CO_191220191020363925",
+		Amount:   150000,
+		Currency: "KES",
+		Receipt:  "NLJ7RT61SV",
+		Raw:      json.RawMessage(body),
+	}, event)
+
+	_, err = webhook(callbackURL.Path+"?ref=order-42&sig=forged", "196.201.214.200:443")
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+	_, err = webhook(callbackURL.RequestURI(), "203.0.113.9:443")
+	assert.ErrorIs(t, err, ErrInvalidSignature, "not from Safaricom")
+
+	body = `{"Body":{"stkCallback":{"CheckoutRequestID":"ws_CO_2","ResultCode":1032,"ResultDesc":"Request cancelled by user"}}}`
+	event, err = webhook(callbackURL.RequestURI(), "196.201.214.200:443")
+	require.NoError(t, err)
+	assert.Equal(t, EventChargeFailed, event.Type)
+	assert.Equal(t, "Request cancelled by user", event.Message)
+}
+
+func TestNormalizePhone(t *testing.T) {
+	for _, phone := range []string{"0712345678", "+254 712 345 678", "254712345678", "712345678"} {
+		normalized, ok := normalizePhone(phone)
+		assert.True(t, ok, phone)
+		assert.Equal(t, "254712345678", normalized, phone)
+	}
+	_, ok := normalizePhone("+1 555 0100")
+	assert.False(t, ok)
+}
@@ -0,0 +1,383 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+// PayPal charges with PayPal Checkout orders. An order is created and the
+// buyer sent to approve it, then charging again with the order as Source
+// captures the payment.
+type PayPal struct {
+	clientID     string
+	clientSecret string
+	webhookID    string
+	baseURL      string
+	returnURL    string
+	cancelURL    string
+	client       *http.Client
+	now          func() time.Time
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// NewPayPal creates a provider for the config's REST app, in sandbox or
+// live mode
+func NewPayPal(cfg config.PayPalConfig) *PayPal {
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = "https://api-m.sandbox.paypal.com"
+		if cfg.Mode == "live" {
+			baseURL = "https://api-m.paypal.com"
+		}
+	}
+	return &PayPal{
+		clientID:     cfg.ClientID,
+		clientSecret: cfg.ClientSecret,
+		webhookID:    cfg.WebhookID,
+		baseURL:      strings.TrimSuffix(baseURL, "/"),
+		returnURL:    cfg.ReturnURL,
+		cancelURL:    cfg.CancelURL,
+		client:       &http.Client{Timeout: 30 * time.Second},
+		now:          time.Now,
+	}
+}
+
+func (p *PayPal) Name() string {
+	return "paypal"
+}
+
+// paypalAmount is an amount as PayPal writes it
+type paypalAmount struct {
+	CurrencyCode string `json:"currency_code"`
+	Value        string `json:"value"`
+}
+
+// paypalCapture is the part of a captured payment read
+type paypalCapture struct {
+	ID                string       `json:"id"`
+	Status            string       `json:"status"`
+	Amount            paypalAmount `json:"amount"`
+	CustomID          string       `json:"custom_id"`
+	SupplementaryData struct {
+		RelatedIDs struct {
+			OrderID string `json:"order_id"`
+		} `json:"related_ids"`
+	} `json:"supplementary_data"`
+}
+
+// paypalOrder is the part of an order read
+type paypalOrder struct {
+	ID            string `json:"id"`
+	Status        string `json:"status"`
+	PurchaseUnits []struct {
+		CustomID string       `json:"custom_id"`
+		Amount   paypalAmount `json:"amount"`
+		Payments struct {
+			Captures []paypalCapture `json:"captures"`
+		} `json:"payments"`
+	} `json:"purchase_units"`
+	Links []struct {
+		Href string `json:"href"`
+		Rel  string `json:"rel"`
+	} `json:"links"`
+}
+
+// capture returns the order's first capture
+func (o *paypalOrder) capture() *paypalCapture {
+	for _, unit := range o.PurchaseUnits {
+		if len(unit.Payments.Captures) > 0 {
+			return &unit.Payments.Captures[0]
+		}
+	}
+	return nil
+}
+
+func (p *PayPal) Charge(ctx context.Context, req ChargeRequest) (*Charge, error) {
+	if req.Source != "" {
+		return p.captureOrder(ctx, req)
+	}
+
+	unit := map[string]interface{}{
+		"amount": paypalAmount{CurrencyCode: req.Currency, Value: formatAmount(req.Amount, req.Currency)},
+	}
+	if req.Description != "" {
+		unit["description"] = req.Description
+	}
+	if req.Reference != "" {
+		unit["custom_id"] = req.Reference
+	}
+	order := map[string]interface{}{
+		"intent":         "CAPTURE",
+		"purchase_units": []interface{}{unit},
+	}
+	returnURL := req.ReturnURL
+	if returnURL == "" {
+		returnURL = p.returnURL
+	}
+	if returnURL != "" || p.cancelURL != "" {
+		order["application_context"] = map[string]string{"return_url": returnURL, "cancel_url": p.cancelURL}
+	}
+
+	var created paypalOrder
+	if err := p.do(ctx, http.MethodPost, "/v2/checkout/orders", order, req.IdempotencyKey, &created); err != nil {
+		return nil, err
+	}
+	charge := &Charge{
+		ID:        created.ID,
+		Provider:  p.Name(),
+		Status:    StatusPending,
+		Amount:    req.Amount,
+		Currency:  req.Currency,
+		Reference: req.Reference,
+	}
+	for _, link := range created.Links {
+		if link.Rel == "approve" || link.Rel == "payer-action" {
+			charge.RedirectURL = link.Href
+		}
+	}
+	return charge, nil
+}
+
+// captureOrder takes the payment of an order the buyer approved
+func (p *PayPal) captureOrder(ctx context.Context, req ChargeRequest) (*Charge, error) {
+	var order paypalOrder
+	path := "/v2/checkout/orders/" + url.PathEscape(req.Source) + "/capture"
+	if err := p.do(ctx, http.MethodPost, path, map[string]interface{}{}, req.IdempotencyKey, &order); err != nil {
+		return nil, err
+	}
+	charge := &Charge{ID: order.ID, Provider: p.Name(), Status: StatusPending, Reference: req.Reference}
+	capture := order.capture()
+	if capture == nil {
+		return nil, fmt.Errorf("payments: paypal order %s has no capture", order.ID)
+	}
+	switch capture.Status {
+	case "COMPLETED":
+		charge.Status = StatusSucceeded
+	case "DECLINED", "FAILED":
+		charge.Status = StatusFailed
+	}
+	charge.Currency = capture.Amount.CurrencyCode
+	amount, err := parseAmount(capture.Amount.Value, charge.Currency)
+	if err != nil {
+		return nil, err
+	}
+	charge.Amount = amount
+	return charge, nil
+}
+
+// Refund refunds the capture of the order named by the request
+func (p *PayPal) Refund(ctx context.Context, req RefundRequest) (*Refund, error) {
+	var order paypalOrder
+	if err := p.do(ctx, http.MethodGet, "/v2/checkout/orders/"+url.PathEscape(req.ChargeID), nil, "", &order); err != nil {
+		return nil, err
+	}
+	capture := order.capture()
+	if capture == nil {
+		return nil, fmt.Errorf("payments: paypal order %s has no capture to refund", req.ChargeID)
+	}
+
+	body := map[string]interface{}{}
+	amount := req.Amount
+	if amount > 0 {
+		body["amount"] = paypalAmount{CurrencyCode: capture.Amount.CurrencyCode, Value: formatAmount(amount, capture.Amount.CurrencyCode)}
+	} else if whole, err := parseAmount(capture.Amount.Value, capture.Amount.CurrencyCode); err == nil {
+		amount = whole
+	}
+	if req.Reason != "" {
+		body["note_to_payer"] = req.Reason
+	}
+
+	var refund struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}
+	if err := p.do(ctx, http.MethodPost, "/v2/payments/captures/"+url.PathEscape(capture.ID)+"/refund", body, req.IdempotencyKey, &refund); err != nil {
+		return nil, err
+	}
+	status := StatusPending
+	switch refund.Status {
+	case "COMPLETED":
+		status = StatusSucceeded
+	case "CANCELLED", "FAILED":
+		status = StatusFailed
+	}
+	return &Refund{ID: refund.ID, Provider: p.Name(), ChargeID: req.ChargeID, Status: status, Amount: amount}, nil
+}
+
+// Webhook has PayPal verify the webhook's transmission signature against
+// the webhook ID, as PayPal recommends over checking its certificates here
+func (p *PayPal) Webhook(r *http.Request, body []byte) (*Event, error) {
+	if p.webhookID == "" {
+		return nil, fmt.Errorf("%w: no webhook ID configured", ErrInvalidSignature)
+	}
+	if !json.Valid(body) {
+		return nil, fmt.Errorf("payments: invalid PayPal event")
+	}
+	verification := map[string]interface{}{
+		"auth_algo":         r.Header.Get("Paypal-Auth-Algo"),
+		"cert_url":          r.Header.Get("Paypal-Cert-Url"),
+		"transmission_id":   r.Header.Get("Paypal-Transmission-Id"),
+		"transmission_sig":  r.Header.Get("Paypal-Transmission-Sig"),
+		"transmission_time": r.Header.Get("Paypal-Transmission-Time"),
+		"webhook_id":        p.webhookID,
+		"webhook_event":     json.RawMessage(body),
+	}
+	var result struct {
+		VerificationStatus string `json:"verification_status"`
+	}
+	if err := p.do(r.Context(), http.MethodPost, "/v1/notifications/verify-webhook-signature", verification, "", &result); err != nil {
+		return nil, err
+	}
+	if result.VerificationStatus != "SUCCESS" {
+		return nil, fmt.Errorf("%w: PayPal answered %s", ErrInvalidSignature, result.VerificationStatus)
+	}
+
+	var event struct {
+		ID        string          `json:"id"`
+		EventType string          `json:"event_type"`
+		Resource  json.RawMessage `json:"resource"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, fmt.Errorf("payments: invalid PayPal event: %w", err)
+	}
+	e := &Event{ID: event.ID, Raw: body}
+	switch event.EventType {
+	case "PAYMENT.CAPTURE.COMPLETED", "PAYMENT.CAPTURE.DENIED", "PAYMENT.CAPTURE.DECLINED":
+		e.Type = EventChargeSucceeded
+		if event.EventType != "PAYMENT.CAPTURE.COMPLETED" {
+			e.Type = EventChargeFailed
+		}
+	case "PAYMENT.CAPTURE.REFUNDED":
+		e.Type = EventRefundSucceeded
+	default:
+		return nil, nil
+	}
+
+	var resource paypalCapture
+	if err := json.Unmarshal(event.Resource, &resource); err != nil {
+		return nil, fmt.Errorf("payments: invalid PayPal event: %w", err)
+	}
+	e.ChargeID = resource.SupplementaryData.RelatedIDs.OrderID
+	e.Currency = resource.Amount.CurrencyCode
+	if resource.Amount.Value != "" {
+		amount, err := parseAmount(resource.Amount.Value, e.Currency)
+		if err != nil {
+			return nil, err
+		}
+		e.Amount = amount
+	}
+	if e.Type == EventRefundSucceeded {
+		e.RefundID = resource.ID
+	} else {
+		e.Receipt = resource.ID
+	}
+	return e, nil
+}
+
+// accessToken returns an OAuth token for the REST app, fetched again a
+// minute before it expires
+func (p *PayPal) accessToken(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.token != "" && p.now().Before(p.expires) {
+		return p.token, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/v1/oauth2/token", strings.NewReader("grant_type=client_credentials"))
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(p.clientID, p.clientSecret)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := p.send(req, &token); err != nil {
+		return "", err
+	}
+	p.token = token.AccessToken
+	p.expires = p.now().Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)
+	return p.token, nil
+}
+
+// do sends a JSON request to PayPal's API, with PayPal-Request-Id set to
+// the idempotency key, and decodes its answer into out
+func (p *PayPal) do(ctx context.Context, method, path string, body interface{}, idempotencyKey string, out interface{}) error {
+	token, err := p.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, p.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	if idempotencyKey != "" {
+		req.Header.Set("PayPal-Request-Id", idempotencyKey)
+	}
+	return p.send(req, out)
+}
+
+func (p *PayPal) send(req *http.Request, out interface{}) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("payments: paypal: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxWebhookBody))
+	if err != nil {
+		return fmt.Errorf("payments: reading the paypal response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var body struct {
+			Name        string `json:"name"`
+			Message     string `json:"message"`
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+			Details     []struct {
+				Issue string `json:"issue"`
+			} `json:"details"`
+		}
+		json.Unmarshal(data, &body)
+		e := &ProviderError{Provider: p.Name(), Status: resp.StatusCode, Code: body.Name, Message: body.Message}
+		if e.Code == "" {
+			e.Code, e.Message = body.Error, body.Description
+		}
+		for _, detail := range body.Details {
+			// The buyer's funding source was refused, or the order
+			// wasn't approved
+			switch detail.Issue {
+			case "INSTRUMENT_DECLINED", "PAYER_ACTION_REQUIRED", "ORDER_NOT_APPROVED", "TRANSACTION_REFUSED":
+				e.Declined, e.Code = true, detail.Issue
+			}
+		}
+		return e
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("payments: reading the paypal response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,312 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/webhooks"
+)
+
+// stripeTolerance is how old a Stripe signature may be, which keeps
+// captured webhooks from being replayed later
+const stripeTolerance = 5 * time.Minute
+
+// Stripe charges with Stripe's PaymentIntents, confirmed at once when the
+// request names a payment method
+type Stripe struct {
+	secretKey     string
+	webhookSecret string
+	baseURL       string
+	client        *http.Client
+	now           func() time.Time
+}
+
+// NewStripe creates a provider authenticating with the config's secret key
+func NewStripe(cfg config.StripeConfig) *Stripe {
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = "https://api.stripe.com"
+	}
+	return &Stripe{
+		secretKey:     cfg.SecretKey,
+		webhookSecret: cfg.WebhookSecret,
+		baseURL:       strings.TrimSuffix(baseURL, "/"),
+		client:        &http.Client{Timeout: 30 * time.Second},
+		now:           time.Now,
+	}
+}
+
+func (s *Stripe) Name() string {
+	return "stripe"
+}
+
+// stripePaymentIntent is the part of a PaymentIntent read
+type stripePaymentIntent struct {
+	ID               string `json:"id"`
+	Status           string `json:"status"`
+	Amount           int64  `json:"amount"`
+	Currency         string `json:"currency"`
+	ClientSecret     string `json:"client_secret"`
+	LatestCharge     string `json:"latest_charge"`
+	LastPaymentError *struct {
+		Message string `json:"message"`
+	} `json:"last_payment_error"`
+	NextAction *struct {
+		RedirectToURL *struct {
+			URL string `json:"url"`
+		} `json:"redirect_to_url"`
+	} `json:"next_action"`
+}
+
+func (s *Stripe) Charge(ctx context.Context, req ChargeRequest) (*Charge, error) {
+	form := url.Values{
+		"amount":   {strconv.FormatInt(req.Amount, 10)},
+		"currency": {strings.ToLower(req.Currency)},
+	}
+	if req.Description != "" {
+		form.Set("description", req.Description)
+	}
+	if req.Reference != "" {
+		form.Set("metadata[reference]", req.Reference)
+	}
+	for name, value := range req.Metadata {
+		form.Set("metadata["+name+"]", value)
+	}
+	if req.Source != "" {
+		form.Set("payment_method", req.Source)
+		form.Set("confirm", "true")
+		if req.ReturnURL != "" {
+			form.Set("return_url", req.ReturnURL)
+		} else {
+			// Without somewhere to come back to, only payment methods
+			// completing without a redirect can be confirmed
+			form.Set("automatic_payment_methods[enabled]", "true")
+			form.Set("automatic_payment_methods[allow_redirects]", "never")
+		}
+	}
+
+	var intent stripePaymentIntent
+	if err := s.post(ctx, "/v1/payment_intents", form, req.IdempotencyKey, &intent); err != nil {
+		return nil, err
+	}
+	charge := &Charge{
+		ID:        intent.ID,
+		Provider:  s.Name(),
+		Status:    stripeStatus(intent.Status, req.Source != ""),
+		Amount:    intent.Amount,
+		Currency:  strings.ToUpper(intent.Currency),
+		Reference: req.Reference,
+	}
+	if req.Source == "" {
+		charge.ClientSecret = intent.ClientSecret
+	}
+	if intent.NextAction != nil && intent.NextAction.RedirectToURL != nil {
+		charge.RedirectURL = intent.NextAction.RedirectToURL.URL
+	}
+	return charge, nil
+}
+
+// stripeStatus maps a PaymentIntent's status. Once confirmed, needing a
+// payment method again means the one given failed.
+func stripeStatus(status string, confirmed bool) string {
+	switch status {
+	case "succeeded":
+		return StatusSucceeded
+	case "canceled":
+		return StatusFailed
+	case "requires_payment_method":
+		if confirmed {
+			return StatusFailed
+		}
+	}
+	return StatusPending
+}
+
+func (s *Stripe) Refund(ctx context.Context, req RefundRequest) (*Refund, error) {
+	form := url.Values{"payment_intent": {req.ChargeID}}
+	if req.Amount > 0 {
+		form.Set("amount", strconv.FormatInt(req.Amount, 10))
+	}
+	switch req.Reason {
+	case "duplicate", "fraudulent", "requested_by_customer":
+		form.Set("reason", req.Reason)
+	case "":
+	default:
+		form.Set("metadata[reason]", req.Reason)
+	}
+
+	var refund struct {
+		ID            string `json:"id"`
+		Status        string `json:"status"`
+		Amount        int64  `json:"amount"`
+		PaymentIntent string `json:"payment_intent"`
+	}
+	if err := s.post(ctx, "/v1/refunds", form, req.IdempotencyKey, &refund); err != nil {
+		return nil, err
+	}
+	status := StatusPending
+	switch refund.Status {
+	case "succeeded":
+		status = StatusSucceeded
+	case "failed", "canceled":
+		status = StatusFailed
+	}
+	return &Refund{ID: refund.ID, Provider: s.Name(), ChargeID: req.ChargeID, Status: status, Amount: refund.Amount}, nil
+}
+
+// Webhook verifies the Stripe-Signature header, an HMAC-SHA256 of the
+// timestamp and body signed with the endpoint's secret
+func (s *Stripe) Webhook(r *http.Request, body []byte) (*Event, error) {
+	// A replay is verified as of when the webhook arrived
+	now := s.now()
+	if receivedAt, ok := webhooks.ReceivedAt(r.Context()); ok {
+		now = receivedAt
+	}
+	if err := s.verify(r.Header.Get("Stripe-Signature"), body, now); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+
+	var event struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+		Data struct {
+			Object json.RawMessage `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, fmt.Errorf("payments: invalid Stripe event: %w", err)
+	}
+
+	e := &Event{ID: event.ID, Raw: body}
+	switch event.Type {
+	case "payment_intent.succeeded", "payment_intent.payment_failed":
+		var intent stripePaymentIntent
+		if err := json.Unmarshal(event.Data.Object, &intent); err != nil {
+			return nil, fmt.Errorf("payments: invalid Stripe event: %w", err)
+		}
+		e.Type = EventChargeSucceeded
+		if event.Type == "payment_intent.payment_failed" {
+			e.Type = EventChargeFailed
+		}
+		e.ChargeID, e.Amount, e.Currency, e.Receipt = intent.ID, intent.Amount, strings.ToUpper(intent.Currency), intent.LatestCharge
+		if intent.LastPaymentError != nil {
+			e.Message = intent.LastPaymentError.Message
+		}
+	case "refund.created", "refund.updated", "refund.failed":
+		var refund struct {
+			ID            string `json:"id"`
+			Status        string `json:"status"`
+			Amount        int64  `json:"amount"`
+			Currency      string `json:"currency"`
+			PaymentIntent string `json:"payment_intent"`
+			FailureReason string `json:"failure_reason"`
+		}
+		if err := json.Unmarshal(event.Data.Object, &refund); err != nil {
+			return nil, fmt.Errorf("payments: invalid Stripe event: %w", err)
+		}
+		switch refund.Status {
+		case "succeeded":
+			e.Type = EventRefundSucceeded
+		case "failed", "canceled":
+			e.Type = EventRefundFailed
+		default:
+			return nil, nil
+		}
+		e.ChargeID, e.RefundID, e.Amount, e.Currency, e.Message = refund.PaymentIntent, refund.ID, refund.Amount, strings.ToUpper(refund.Currency), refund.FailureReason
+	default:
+		return nil, nil
+	}
+	return e, nil
+}
+
+// verify checks a Stripe-Signature header, t=<timestamp>,v1=<signature>,
+// which may carry several v1 signatures while a secret is rolled, as of now
+func (s *Stripe) verify(header string, body []byte, now time.Time) error {
+	if s.webhookSecret == "" {
+		return fmt.Errorf("no webhook secret configured")
+	}
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch name {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return fmt.Errorf("malformed signature header")
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > stripeTolerance || age < -stripeTolerance {
+		return fmt.Errorf("timestamp is %s off", age.Round(time.Second))
+	}
+
+	mac := hmac.New(sha256.New, []byte(s.webhookSecret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	for _, signature := range signatures {
+		if hmac.Equal([]byte(expected), []byte(signature)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("signature mismatch")
+}
+
+// post sends a form to Stripe's API, with the idempotency key Stripe keeps
+// for 24 hours, and decodes its answer into out
+func (s *Stripe) post(ctx context.Context, path string, form url.Values, idempotencyKey string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.baseURL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(s.secretKey, "")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("payments: stripe: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxWebhookBody))
+	if err != nil {
+		return fmt.Errorf("payments: reading the stripe response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var body struct {
+			Error struct {
+				Type    string `json:"type"`
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.Unmarshal(data, &body)
+		return &ProviderError{
+			Provider: s.Name(),
+			Status:   resp.StatusCode,
+			Code:     body.Error.Code,
+			Message:  body.Error.Message,
+			Declined: body.Error.Type == "card_error",
+		}
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("payments: reading the stripe response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package preferences
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/i18n"
+)
+
+// SwitcherTemplate renders the form for switching preferences, which
+// saves each change with HTMX and reloads the page to apply it. Languages
+// are offered once there are translations for more than one. Replace it
+// before serving to change the markup; it is executed with the Path, the
+// current Preferences and Locale, and the Locales, Timezones and Themes
+// to choose from.
+var SwitcherTemplate = template.Must(template.New("preferences").Parse(
+	`<form class="preferences" method="post" action="{{.Path}}" hx-post="{{.Path}}" hx-trigger="change">` +
+		`{{if gt (len .Locales) 1}}<label>Language <select name="locale">{{range .Locales}}<option value="{{.}}"{{if eq . $.Locale}} selected{{end}}>{{.}}</option>{{end}}</select></label>{{end}}` +
+		`<label>Timezone <select name="timezone">{{range .Timezones}}<option value="{{.}}"{{if eq . $.Preferences.Timezone}} selected{{end}}>{{.}}</option>{{end}}</select></label>` +
+		`{{if .Themes}}<label>Theme <select name="theme">{{range .Themes}}<option value="{{.}}"{{if eq . $.Preferences.Theme}} selected{{end}}>{{.}}</option>{{end}}</select></label>{{end}}` +
+		`<noscript><button type="submit">Save</button></noscript></form>`))
+
+// Routes registers, relative to where they are mounted:
+//
+//	GET  /  the preferences as JSON, or the switcher for HTMX requests
+//	POST /  save a form or JSON body of locale, timezone and/or theme
+func (s *Service) Routes(r chi.Router) {
+	r.Get("/", s.show)
+	r.Post("/", s.save)
+}
+
+func (s *Service) show(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("HX-Request") == "true" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := s.Switcher(w, r); err != nil {
+			s.logger.Error("Failed to render the preference switcher", zap.Error(err))
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.Resolve(r))
+}
+
+// Switcher renders SwitcherTemplate for a request
+func (s *Service) Switcher(w http.ResponseWriter, r *http.Request) error {
+	prefs := FromContext(r.Context())
+	if prefs == (Preferences{}) {
+		prefs = s.Resolve(r)
+	}
+	locale := i18n.Locale(r.Context())
+	var locales []string
+	if s.translator != nil {
+		locales = s.translator.Locales()
+	}
+	timezones := s.cfg.Timezones
+	if prefs.Timezone != "" && !slices.Contains(timezones, prefs.Timezone) {
+		timezones = append([]string{prefs.Timezone}, timezones...)
+	}
+	return SwitcherTemplate.Execute(w, map[string]interface{}{
+		"Path":        s.cfg.Path,
+		"Preferences": prefs,
+		"Locale":      locale,
+		"Locales":     locales,
+		"Timezones":   timezones,
+		"Themes":      s.cfg.Themes,
+	})
+}
+
+func (s *Service) save(w http.ResponseWriter, r *http.Request) {
+	var choices Preferences
+	isJSON := strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+	if isJSON {
+		if err := json.NewDecoder(r.Body).Decode(&choices); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+	} else {
+		choices = Preferences{Locale: r.FormValue("locale"), Timezone: r.FormValue("timezone"), Theme: r.FormValue("theme")}
+	}
+
+	prefs, err := s.Save(w, r, choices)
+	if errors.Is(err, ErrInvalid) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		s.logger.Error("Failed to save preferences", zap.Error(err))
+		http.Error(w, "preferences are unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch {
+	case r.Header.Get("HX-Request") == "true":
+		// Reload so the whole page picks up the new locale and theme
+		w.Header().Set("HX-Refresh", "true")
+		w.WriteHeader(http.StatusNoContent)
+	case isJSON:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(prefs)
+	default:
+		http.Redirect(w, r, backTo(r), http.StatusSeeOther)
+	}
+}
+
+// backTo returns the local page a form was posted from, or /
+func backTo(r *http.Request) string {
+	referer, err := url.Parse(r.Referer())
+	if err != nil || !strings.HasPrefix(referer.Path, "/") || strings.HasPrefix(referer.Path, "//") ||
+		(referer.Host != "" && referer.Host != r.Host) {
+		return "/"
+	}
+	if referer.RawQuery != "" {
+		return referer.Path + "?" + referer.RawQuery
+	}
+	return referer.Path
+}
@@ -0,0 +1,271 @@
+// Package preferences remembers the locale, timezone and theme each user
+// chooses, in the database for signed-in users and in a cookie for guests.
+// Its middleware resolves them for every request:
+//
+//	prefs := preferences.FromContext(r.Context())
+//	fmt.Fprintf(w, "<html data-theme=%q>", prefs.Theme)
+//
+// A chosen locale is handed to the i18n middleware, which runs after it,
+// and the timezone is available for the time template helpers with
+// TemplateHelpersIn(prefs.Location()).
+package preferences
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/i18n"
+)
+
+// ErrInvalid is returned by Save for a locale, timezone or theme that
+// can't be chosen
+var ErrInvalid = errors.New("preferences: invalid preference")
+
+// Preferences are a user's UI choices. An empty Locale leaves the locale
+// to the request's cookie and Accept-Language header.
+type Preferences struct {
+	Locale   string `json:"locale" gorm:"size:35"`
+	Timezone string `json:"timezone" gorm:"size:64"`
+	Theme    string `json:"theme" gorm:"size:32"`
+}
+
+// Location returns the timezone, or UTC when it isn't valid
+func (p Preferences) Location() *time.Location {
+	if loc, err := time.LoadLocation(p.Timezone); err == nil && p.Timezone != "" {
+		return loc
+	}
+	return time.UTC
+}
+
+// overlay returns p with the fields set in choices replaced
+func (p Preferences) overlay(choices Preferences) Preferences {
+	if choices.Locale != "" {
+		p.Locale = choices.Locale
+	}
+	if choices.Timezone != "" {
+		p.Timezone = choices.Timezone
+	}
+	if choices.Theme != "" {
+		p.Theme = choices.Theme
+	}
+	return p
+}
+
+// Store saves signed-in users' preferences
+type Store interface {
+	// Load returns the preferences saved for a user, or false if none are
+	Load(ctx context.Context, userID string) (Preferences, bool, error)
+	Save(ctx context.Context, userID string, prefs Preferences) error
+}
+
+// Record is a user's saved preferences in the user_preferences table
+type Record struct {
+	UserID string `gorm:"primaryKey;size:64"`
+	Preferences
+	UpdatedAt time.Time
+}
+
+func (Record) TableName() string { return "user_preferences" }
+
+// DBStore saves preferences in the database
+type DBStore struct {
+	db *gorm.DB
+}
+
+// NewDBStore creates a database preference store, creating its table if
+// needed
+func NewDBStore(db *gorm.DB) (*DBStore, error) {
+	if err := db.AutoMigrate(&Record{}); err != nil {
+		return nil, err
+	}
+	return &DBStore{db: db}, nil
+}
+
+func (s *DBStore) Load(ctx context.Context, userID string) (Preferences, bool, error) {
+	var record Record
+	err := s.db.WithContext(ctx).Where("user_id = ?", userID).Take(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Preferences{}, false, nil
+	}
+	if err != nil {
+		return Preferences{}, false, err
+	}
+	return record.Preferences, true, nil
+}
+
+func (s *DBStore) Save(ctx context.Context, userID string, prefs Preferences) error {
+	record := Record{UserID: userID, Preferences: prefs}
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(&record).Error
+}
+
+// IdentifyFunc returns the signed-in user making a request, or false for
+// guests, whose preferences are only kept in the cookie
+type IdentifyFunc func(r *http.Request) (string, bool)
+
+// Service resolves and saves preferences
+type Service struct {
+	store      Store
+	identify   IdentifyFunc
+	translator *i18n.Translator
+	cfg        config.PreferencesConfig
+	logger     *zap.Logger
+}
+
+// New creates a preference service. Without a store or identify, every
+// user's preferences are kept in the cookie; without a translator, any
+// locale can be chosen.
+func New(store Store, identify IdentifyFunc, translator *i18n.Translator, cfg config.PreferencesConfig, logger *zap.Logger) *Service {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if cfg.Cookie == "" {
+		cfg.Cookie = "preferences"
+	}
+	return &Service{store: store, identify: identify, translator: translator, cfg: cfg, logger: logger}
+}
+
+// Defaults returns the preferences of someone who hasn't chosen any
+func (s *Service) Defaults() Preferences {
+	return Preferences{Timezone: s.cfg.Timezone, Theme: s.cfg.Theme}
+}
+
+// Resolve returns the preferences for a request: the signed-in user's saved
+// choices, then those in the cookie, then the defaults
+func (s *Service) Resolve(r *http.Request) Preferences {
+	return s.Defaults().overlay(s.chosen(r))
+}
+
+// chosen returns the valid choices made for a request
+func (s *Service) chosen(r *http.Request) Preferences {
+	var choices Preferences
+	if cookie, err := r.Cookie(s.cfg.Cookie); err == nil {
+		if values, err := url.ParseQuery(cookie.Value); err == nil {
+			choices = Preferences{Locale: values.Get("locale"), Timezone: values.Get("timezone"), Theme: values.Get("theme")}
+		}
+	}
+	if userID, ok := s.user(r); ok {
+		saved, found, err := s.store.Load(r.Context(), userID)
+		if err != nil {
+			s.logger.Warn("Failed to load preferences", zap.String("user", userID), zap.Error(err))
+		} else if found {
+			choices = choices.overlay(saved)
+		}
+	}
+	return s.valid(choices)
+}
+
+func (s *Service) user(r *http.Request) (string, bool) {
+	if s.store == nil || s.identify == nil {
+		return "", false
+	}
+	return s.identify(r)
+}
+
+// valid drops the choices that can no longer be made, such as a theme
+// removed from the config
+func (s *Service) valid(p Preferences) Preferences {
+	if s.validate(Preferences{Locale: p.Locale}) != nil {
+		p.Locale = ""
+	}
+	if s.validate(Preferences{Timezone: p.Timezone}) != nil {
+		p.Timezone = ""
+	}
+	if s.validate(Preferences{Theme: p.Theme}) != nil {
+		p.Theme = ""
+	}
+	return p
+}
+
+// validate checks the choices that are set
+func (s *Service) validate(p Preferences) error {
+	if p.Locale != "" && s.translator != nil {
+		if _, ok := s.translator.Match(p.Locale); !ok {
+			return fmt.Errorf("%w: unsupported locale %q", ErrInvalid, p.Locale)
+		}
+	}
+	if p.Timezone != "" {
+		if _, err := time.LoadLocation(p.Timezone); err != nil || p.Timezone == "Local" {
+			return fmt.Errorf("%w: unknown timezone %q", ErrInvalid, p.Timezone)
+		}
+	}
+	if p.Theme != "" && len(s.cfg.Themes) > 0 && !slices.Contains(s.cfg.Themes, p.Theme) {
+		return fmt.Errorf("%w: unknown theme %q", ErrInvalid, p.Theme)
+	}
+	return nil
+}
+
+// Save changes the preferences set in choices, keeping the others. They
+// are saved for the signed-in user and in the cookie, so they outlast
+// signing out. The cookie is written to w, so Save must be called before
+// the response is written.
+func (s *Service) Save(w http.ResponseWriter, r *http.Request, choices Preferences) (Preferences, error) {
+	if choices.Locale != "" && s.translator != nil {
+		locale, ok := s.translator.Match(choices.Locale)
+		if !ok {
+			return Preferences{}, fmt.Errorf("%w: unsupported locale %q", ErrInvalid, choices.Locale)
+		}
+		choices.Locale = locale
+	}
+	if err := s.validate(choices); err != nil {
+		return Preferences{}, err
+	}
+	chosen := s.chosen(r).overlay(choices)
+	if userID, ok := s.user(r); ok {
+		if err := s.store.Save(r.Context(), userID, chosen); err != nil {
+			return Preferences{}, err
+		}
+	}
+
+	values := url.Values{}
+	for name, value := range map[string]string{"locale": chosen.Locale, "timezone": chosen.Timezone, "theme": chosen.Theme} {
+		if value != "" {
+			values.Set(name, value)
+		}
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.cfg.Cookie,
+		Value:    values.Encode(),
+		Path:     "/",
+		MaxAge:   int(365 * 24 * time.Hour / time.Second),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return s.Defaults().overlay(chosen), nil
+}
+
+type preferencesKey struct{}
+
+// WithPreferences returns a context carrying prefs
+func WithPreferences(ctx context.Context, prefs Preferences) context.Context {
+	return context.WithValue(ctx, preferencesKey{}, prefs)
+}
+
+// FromContext returns the preferences Middleware resolved for a request,
+// or empty preferences outside one
+func FromContext(ctx context.Context) Preferences {
+	prefs, _ := ctx.Value(preferencesKey{}).(Preferences)
+	return prefs
+}
+
+// Middleware resolves each request's preferences, available through
+// FromContext, and hands a chosen locale to the i18n middleware after it
+func (s *Service) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefs := s.Resolve(r)
+		ctx := WithPreferences(r.Context(), prefs)
+		if prefs.Locale != "" {
+			ctx = i18n.WithLocale(ctx, prefs.Locale)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
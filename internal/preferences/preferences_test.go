@@ -0,0 +1,189 @@
+package preferences
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/database"
+	"github.com/mrhoseah/dolphin/internal/i18n"
+)
+
+var testConfig = config.PreferencesConfig{
+	Path:      "/preferences",
+	Cookie:    "preferences",
+	Theme:     "system",
+	Themes:    []string{"system", "light", "dark"},
+	Timezone:  "UTC",
+	Timezones: []string{"UTC", "Africa/Nairobi"},
+}
+
+// newTestService returns a service whose signed-in user is named by the
+// X-User header
+func newTestService(t *testing.T) (*Service, *i18n.Translator) {
+	db, err := database.New(&config.DatabaseConfig{Driver: "sqlite", Database: filepath.Join(t.TempDir(), "app.db")})
+	require.NoError(t, err)
+	store, err := NewDBStore(db.GetDB())
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	for locale, content := range map[string]string{"en": `{"hello": "Hello"}`, "sw": `{"hello": "Habari"}`} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, locale+".json"), []byte(content), 0644))
+	}
+	translator, err := i18n.New(config.I18nConfig{Path: dir, Locale: "en", Query: "lang", Cookie: "locale"})
+	require.NoError(t, err)
+
+	identify := func(r *http.Request) (string, bool) {
+		user := r.Header.Get("X-User")
+		return user, user != ""
+	}
+	return New(store, identify, translator, testConfig, nil), translator
+}
+
+// post saves choices as a form, returning the response and the request
+// that sends its cookies back
+func post(t *testing.T, s *Service, user string, cookies []*http.Cookie, form url.Values) (*httptest.ResponseRecorder, *http.Request) {
+	r := httptest.NewRequest(http.MethodPost, "/preferences", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Referer", "http://example.com/dashboard?tab=2")
+	r.Host = "example.com"
+	r.Header.Set("X-User", user)
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	router := chi.NewRouter()
+	router.Route("/preferences", s.Routes)
+	router.ServeHTTP(w, r)
+
+	next := httptest.NewRequest(http.MethodGet, "/", nil)
+	next.Header.Set("X-User", user)
+	for _, cookie := range w.Result().Cookies() {
+		next.AddCookie(cookie)
+	}
+	return w, next
+}
+
+func TestGuestPreferences(t *testing.T) {
+	s, _ := newTestService(t)
+
+	assert.Equal(t, Preferences{Timezone: "UTC", Theme: "system"}, s.Resolve(httptest.NewRequest(http.MethodGet, "/", nil)))
+
+	w, next := post(t, s, "", nil, url.Values{"locale": {"sw-KE"}, "theme": {"dark"}})
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, "/dashboard?tab=2", w.Header().Get("Location"))
+	assert.Equal(t, Preferences{Locale: "sw", Timezone: "UTC", Theme: "dark"}, s.Resolve(next))
+
+	// Later changes keep the other choices
+	_, next = post(t, s, "", next.Cookies(), url.Values{"timezone": {"Africa/Nairobi"}})
+	prefs := s.Resolve(next)
+	assert.Equal(t, Preferences{Locale: "sw", Timezone: "Africa/Nairobi", Theme: "dark"}, prefs)
+	assert.Equal(t, "Africa/Nairobi", prefs.Location().String())
+
+	for _, invalid := range []url.Values{{"locale": {"fr"}}, {"timezone": {"Mars/Olympus"}}, {"theme": {"neon"}}} {
+		w, _ = post(t, s, "", nil, invalid)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code, invalid)
+	}
+
+	// Tampered cookies are ignored field by field
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: "preferences", Value: "theme=neon&timezone=Africa%2FNairobi"})
+	assert.Equal(t, Preferences{Timezone: "Africa/Nairobi", Theme: "system"}, s.Resolve(r))
+}
+
+func TestUserPreferences(t *testing.T) {
+	s, _ := newTestService(t)
+
+	_, next := post(t, s, "42", nil, url.Values{"theme": {"light"}})
+	assert.Equal(t, "light", s.Resolve(next).Theme)
+
+	// Saved for the user on another device, over that device's cookie
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-User", "42")
+	r.AddCookie(&http.Cookie{Name: "preferences", Value: "theme=dark&locale=sw"})
+	assert.Equal(t, Preferences{Locale: "sw", Timezone: "UTC", Theme: "light"}, s.Resolve(r))
+
+	saved, found, err := s.store.Load(context.Background(), "42")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, Preferences{Theme: "light"}, saved)
+
+	// Saving again updates the same row
+	_, _ = post(t, s, "42", nil, url.Values{"theme": {"dark"}})
+	saved, _, err = s.store.Load(context.Background(), "42")
+	require.NoError(t, err)
+	assert.Equal(t, "dark", saved.Theme)
+}
+
+func TestMiddlewareAppliesLocale(t *testing.T) {
+	s, translator := newTestService(t)
+	var prefs Preferences
+	var locale string
+	handler := s.Middleware(translator.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefs, locale = FromContext(r.Context()), i18n.Locale(r.Context())
+	})))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Language", "en")
+	r.AddCookie(&http.Cookie{Name: "preferences", Value: "locale=sw&theme=dark"})
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, "dark", prefs.Theme)
+	assert.Equal(t, "sw", locale, "the saved locale wins over the header")
+
+	r.URL.RawQuery = "lang=en"
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, "en", locale, "but not over the query")
+}
+
+func TestSwitcherAndJSON(t *testing.T) {
+	s, translator := newTestService(t)
+	router := chi.NewRouter()
+	router.Use(s.Middleware, translator.Middleware)
+	router.Route("/preferences", s.Routes)
+
+	r := httptest.NewRequest(http.MethodGet, "/preferences", nil)
+	r.Header.Set("HX-Request", "true")
+	r.AddCookie(&http.Cookie{Name: "preferences", Value: "locale=sw&timezone=Asia%2FTokyo"})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	html := w.Body.String()
+	assert.Contains(t, html, `hx-post="/preferences"`)
+	assert.Contains(t, html, `<option value="sw" selected>`)
+	assert.Contains(t, html, `<option value="Asia/Tokyo" selected>`, "the chosen timezone is offered")
+	assert.Contains(t, html, `<option value="system" selected>`)
+
+	r = httptest.NewRequest(http.MethodPost, "/preferences", strings.NewReader(`{"theme": "dark"}`))
+	r.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	var saved Preferences
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&saved))
+	assert.Equal(t, Preferences{Timezone: "UTC", Theme: "dark"}, saved)
+
+	r = httptest.NewRequest(http.MethodPost, "/preferences", strings.NewReader("theme=light"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("HX-Request", "true")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "true", w.Header().Get("HX-Refresh"))
+
+	// Redirects stay on this site
+	r = httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("Referer", "http://example.com//evil.test/x")
+	assert.Equal(t, "/", backTo(r))
+	r.Header.Set("Referer", "http://other.test/x")
+	assert.Equal(t, "/", backTo(r))
+}
@@ -0,0 +1,298 @@
+package presence
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"html/template"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/problem"
+	"github.com/mrhoseah/dolphin/internal/sse"
+)
+
+// IdentifyFunc returns the member making a request, or false for guests,
+// who can't join or see channels
+type IdentifyFunc func(r *http.Request) (Member, bool)
+
+// ListTemplate renders the member list swapped into widgets. Replace it
+// before serving to change the markup; it is executed with []Member.
+var ListTemplate = template.Must(template.New("presence").Parse(
+	`<ul class="presence-list" data-count="{{len .}}">{{range .}}<li data-member="{{.ID}}" title="{{.Name}}">{{.Name}}</li>{{end}}</ul>`))
+
+// widgetTemplate wraps the list in an element that follows the channel's
+// event stream with the HTMX SSE extension
+var widgetTemplate = template.Must(template.New("widget").Parse(
+	`<div class="presence" hx-ext="sse" sse-connect="{{.Stream}}" sse-swap="presence">{{.List}}</div>`))
+
+// Handler serves presence over HTTP for the members IdentifyFunc resolves
+type Handler struct {
+	tracker   *Tracker
+	identify  IdentifyFunc
+	streams   *sse.Hub // sse.Default when nil
+	path      string
+	heartbeat time.Duration
+	poll      time.Duration
+	logger    *zap.Logger
+}
+
+// NewHandler creates a handler for routes mounted at cfg.Path
+func NewHandler(tracker *Tracker, identify IdentifyFunc, cfg config.PresenceConfig, logger *zap.Logger) *Handler {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if cfg.Heartbeat <= 0 {
+		cfg.Heartbeat = 10 * time.Second
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 2 * time.Second
+	}
+	return &Handler{
+		tracker:   tracker,
+		identify:  identify,
+		path:      strings.TrimSuffix(cfg.Path, "/"),
+		heartbeat: cfg.Heartbeat,
+		poll:      cfg.PollInterval,
+		logger:    logger,
+	}
+}
+
+// Routes registers, for each channel:
+//
+//	GET  /{channel}            members as JSON, or the list for HTMX requests
+//	POST /{channel}/heartbeat  join or stay present, answering like GET
+//	POST /{channel}/leave      leave straight away
+//	GET  /{channel}/stream     server-sent "presence" events with the list
+//	GET  /{channel}/widget     an element that joins and follows the stream
+func (h *Handler) Routes(r chi.Router) {
+	r.Route("/{channel}", func(r chi.Router) {
+		r.Use(h.member)
+		r.Get("/", h.members)
+		r.Post("/heartbeat", h.heartbeatMember)
+		r.Post("/leave", h.leave)
+		r.Get("/stream", h.stream)
+		r.Get("/widget", h.widget)
+	})
+}
+
+type memberKey struct{}
+
+// member identifies the caller and checks the channel name
+func (h *Handler) member(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !ValidChannel(chi.URLParam(r, "channel")) {
+			http.Error(w, ErrInvalidChannel.Error(), http.StatusNotFound)
+			return
+		}
+		member, ok := h.identify(r)
+		if !ok {
+			http.Error(w, "Unauthenticated", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), memberKey{}, member)))
+	})
+}
+
+func (h *Handler) members(w http.ResponseWriter, r *http.Request) {
+	channel := chi.URLParam(r, "channel")
+	members, err := h.tracker.Members(r.Context(), channel)
+	if err != nil {
+		h.fail(w, "list", channel, err)
+		return
+	}
+	h.respond(w, r, channel, members)
+}
+
+func (h *Handler) heartbeatMember(w http.ResponseWriter, r *http.Request) {
+	channel := chi.URLParam(r, "channel")
+	if err := h.tracker.Heartbeat(r.Context(), channel, r.Context().Value(memberKey{}).(Member)); err != nil {
+		h.fail(w, "heartbeat", channel, err)
+		return
+	}
+	h.members(w, r)
+}
+
+func (h *Handler) leave(w http.ResponseWriter, r *http.Request) {
+	channel := chi.URLParam(r, "channel")
+	member := r.Context().Value(memberKey{}).(Member)
+	if err := h.tracker.Leave(r.Context(), channel, member.ID); err != nil {
+		h.fail(w, "leave", channel, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// stream keeps the caller present while it is connected and sends the list
+// whenever it changes
+func (h *Handler) stream(w http.ResponseWriter, r *http.Request) {
+	channel := chi.URLParam(r, "channel")
+	member := r.Context().Value(memberKey{}).(Member)
+
+	// Watch before joining so our own join is sent
+	changes, stop := h.tracker.Watch(channel)
+	defer stop()
+	if err := h.tracker.Heartbeat(r.Context(), channel, member); err != nil {
+		h.fail(w, "heartbeat", channel, err)
+		return
+	}
+
+	streams := h.streams
+	if streams == nil {
+		streams = sse.Default
+	}
+	stream, err := streams.Stream(w, r)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	stream.Run(h.lists(stream.Context(), channel, member, changes))
+}
+
+// lists sends the channel's member list whenever it changes, keeping member
+// present, until ctx is done
+func (h *Handler) lists(ctx context.Context, channel string, member Member, changes <-chan struct{}) <-chan sse.Event {
+	events := make(chan sse.Event)
+	go func() {
+		defer close(events)
+		heartbeat := time.NewTicker(h.heartbeat)
+		defer heartbeat.Stop()
+		poll := time.NewTicker(h.poll)
+		defer poll.Stop()
+
+		var last []byte
+		for {
+			var list bytes.Buffer
+			if members, err := h.tracker.Members(ctx, channel); err != nil {
+				if ctx.Err() == nil {
+					h.logger.Warn("Failed to list presence", zap.String("channel", channel), zap.Error(err))
+				}
+			} else if err := ListTemplate.Execute(&list, members); err != nil {
+				h.logger.Error("Failed to render presence", zap.Error(err))
+				return
+			} else if !bytes.Equal(list.Bytes(), last) {
+				last = list.Bytes()
+				select {
+				case events <- sse.Event{Name: "presence", Data: last}:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-changes:
+			case <-poll.C:
+			case <-heartbeat.C:
+				if err := h.tracker.Heartbeat(ctx, channel, member); err != nil && ctx.Err() == nil {
+					h.logger.Warn("Presence heartbeat failed", zap.String("channel", channel), zap.Error(err))
+				}
+			}
+		}
+	}()
+	return events
+}
+
+func (h *Handler) widget(w http.ResponseWriter, r *http.Request) {
+	widget, err := h.Widget(r.Context(), chi.URLParam(r, "channel"))
+	if err != nil {
+		h.fail(w, "render", chi.URLParam(r, "channel"), err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	io.WriteString(w, string(widget))
+}
+
+// Widget renders the current members in an element that follows the
+// channel's stream, which also keeps the viewer present. Pages need the
+// HTMX SSE extension (htmx.org/dist/ext/sse.js).
+func (h *Handler) Widget(ctx context.Context, channel string) (template.HTML, error) {
+	members, err := h.tracker.Members(ctx, channel)
+	if err != nil {
+		return "", err
+	}
+	var list, widget bytes.Buffer
+	if err := ListTemplate.Execute(&list, members); err != nil {
+		return "", err
+	}
+	err = widgetTemplate.Execute(&widget, map[string]interface{}{
+		"Stream": h.path + "/" + channel + "/stream",
+		"List":   template.HTML(list.String()),
+	})
+	return template.HTML(widget.String()), err
+}
+
+// TemplateHelpers returns template functions for pages rendered with
+// html/template: {{presence "doc:42"}} renders the widget and
+// {{presenceMembers "doc:42"}} the members
+func (h *Handler) TemplateHelpers() template.FuncMap {
+	return template.FuncMap{
+		"presence": func(channel string) (template.HTML, error) {
+			return h.Widget(context.Background(), channel)
+		},
+		"presenceMembers": func(channel string) ([]Member, error) {
+			return h.tracker.Members(context.Background(), channel)
+		},
+	}
+}
+
+func (h *Handler) respond(w http.ResponseWriter, r *http.Request, channel string, members []Member) {
+	if r.Header.Get("HX-Request") == "true" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := ListTemplate.Execute(w, members); err != nil {
+			h.logger.Error("Failed to render presence", zap.Error(err))
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"channel": channel,
+		"members": members,
+	})
+}
+
+func (h *Handler) fail(w http.ResponseWriter, action, channel string, err error) {
+	h.logger.Error("Presence request failed", zap.String("action", action), zap.String("channel", channel), zap.Error(err))
+	http.Error(w, "presence is unavailable", http.StatusServiceUnavailable)
+}
+
+// Track keeps identified members present on the channel each GET request
+// maps to, such as PathChannel, without any script on the page. Requests
+// mapped to "" and HTMX requests aren't tracked; failures are logged.
+func Track(tracker *Tracker, identify IdentifyFunc, channel func(r *http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet && r.Header.Get("HX-Request") == "" {
+				if name := channel(r); name != "" {
+					if member, ok := identify(r); ok {
+						if err := tracker.Heartbeat(r.Context(), name, member); err != nil {
+							tracker.logger.Warn("Presence heartbeat failed", zap.String("channel", name), zap.Error(err))
+						}
+					}
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// PathChannel maps a request to a channel per page: /dashboard/reports
+// becomes "page:dashboard:reports" and / becomes "page"
+func PathChannel(r *http.Request) string {
+	path := strings.Trim(r.URL.Path, "/")
+	if path == "" {
+		return "page"
+	}
+	channel := "page:" + strings.ReplaceAll(path, "/", ":")
+	if !ValidChannel(channel) {
+		return ""
+	}
+	return channel
+}
@@ -0,0 +1,178 @@
+package presence
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/bus"
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/problem"
+	"github.com/mrhoseah/dolphin/internal/sse"
+)
+
+// newTestServer serves presence for the member named by the X-User header,
+// behind middlewares
+func newTestServer(t *testing.T, middlewares ...func(http.Handler) http.Handler) (*httptest.Server, *Tracker) {
+	tracker := NewTracker(NewMemoryStore(), time.Minute, nil)
+	tracker.bus = bus.New()
+	handler := NewHandler(tracker, func(r *http.Request) (Member, bool) {
+		name := r.Header.Get("X-User")
+		return Member{ID: name, Name: name}, name != ""
+	}, config.PresenceConfig{Path: "/presence/", Heartbeat: time.Minute, PollInterval: 20 * time.Millisecond}, nil)
+	handler.streams = sse.NewHub(config.SSEConfig{Heartbeat: 20 * time.Millisecond}, nil)
+
+	router := chi.NewRouter()
+	router.Use(middlewares...)
+	router.Route("/presence", handler.Routes)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server, tracker
+}
+
+func request(t *testing.T, method, url, user string, headers ...string) *http.Response {
+	req, err := http.NewRequest(method, url, nil)
+	require.NoError(t, err)
+	req.Header.Set("X-User", user)
+	for i := 0; i < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestHandler(t *testing.T) {
+	server, _ := newTestServer(t)
+	url := server.URL + "/presence/doc:1"
+
+	resp := request(t, http.MethodPost, url+"/heartbeat", "ada")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var body struct {
+		Channel string   `json:"channel"`
+		Members []Member `json:"members"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, "doc:1", body.Channel)
+	require.Len(t, body.Members, 1)
+	assert.Equal(t, "ada", body.Members[0].Name)
+
+	request(t, http.MethodPost, url+"/heartbeat", "<b>bob</b>")
+	resp = request(t, http.MethodGet, url, "ada", "HX-Request", "true")
+	assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+	var html strings.Builder
+	bufio.NewReader(resp.Body).WriteTo(&html)
+	assert.Equal(t, `<ul class="presence-list" data-count="2"><li data-member="&lt;b&gt;bob&lt;/b&gt;" title="&lt;b&gt;bob&lt;/b&gt;">&lt;b&gt;bob&lt;/b&gt;</li><li data-member="ada" title="ada">ada</li></ul>`, html.String())
+
+	assert.Equal(t, http.StatusNoContent, request(t, http.MethodPost, url+"/leave", "ada").StatusCode)
+	resp = request(t, http.MethodGet, url, "ada")
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Len(t, body.Members, 1)
+
+	assert.Equal(t, http.StatusUnauthorized, request(t, http.MethodGet, url, "").StatusCode)
+	assert.Equal(t, http.StatusNotFound, request(t, http.MethodGet, server.URL+"/presence/doc%20one", "ada").StatusCode)
+}
+
+func TestHandlerWidget(t *testing.T) {
+	server, _ := newTestServer(t)
+	resp := request(t, http.MethodGet, server.URL+"/presence/doc:1/widget", "ada")
+	var html strings.Builder
+	bufio.NewReader(resp.Body).WriteTo(&html)
+	assert.Equal(t, `<div class="presence" hx-ext="sse" sse-connect="/presence/doc:1/stream" sse-swap="presence"><ul class="presence-list" data-count="0"></ul></div>`, html.String())
+}
+
+func TestHandlerStream(t *testing.T) {
+	// Requests time out long before the stream ends
+	server, tracker := newTestServer(t, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeoutCause(r.Context(), 20*time.Millisecond, problem.ErrRequestTimeout)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/presence/doc:1/stream", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-User", "ada")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	events := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		var event []string
+		for scanner.Scan() {
+			// Comments, such as heartbeats, aren't events
+			if strings.HasPrefix(scanner.Text(), ":") {
+				continue
+			}
+			if scanner.Text() == "" {
+				if event != nil {
+					events <- strings.Join(event, "\n")
+				}
+				event = nil
+				continue
+			}
+			event = append(event, scanner.Text())
+		}
+		close(events)
+	}()
+	next := func() string {
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatal("no presence event")
+			return ""
+		}
+	}
+
+	// The stream joins its viewer
+	assert.Equal(t, "event: presence\ndata: "+`<ul class="presence-list" data-count="1"><li data-member="ada" title="ada">ada</li></ul>`, next())
+
+	// Joins through the tracker are sent straight away, expiries on the
+	// next poll, past the request timeout
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, tracker.Heartbeat(ctx, "doc:1", Member{ID: "bob", Name: "bob"}))
+	assert.Contains(t, next(), `data-count="2"`)
+	_, err = tracker.store.Touch(ctx, "doc:1", Member{ID: "bob", Name: "bob"}, 10*time.Millisecond)
+	require.NoError(t, err)
+	assert.Contains(t, next(), `data-count="1"`)
+}
+
+func TestTrack(t *testing.T) {
+	tracker := NewTracker(NewMemoryStore(), time.Minute, nil)
+	tracker.bus = bus.New()
+	handler := Track(tracker, func(r *http.Request) (Member, bool) {
+		return Member{ID: "1", Name: "ada"}, true
+	}, PathChannel)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/dashboard/reports/", nil))
+	hx := httptest.NewRequest(http.MethodGet, "/dashboard", nil)
+	hx.Header.Set("HX-Request", "true")
+	handler.ServeHTTP(httptest.NewRecorder(), hx)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/dashboard", nil))
+
+	members, err := tracker.Members(context.Background(), "page:dashboard:reports")
+	require.NoError(t, err)
+	assert.Len(t, members, 1)
+	members, err = tracker.Members(context.Background(), "page:dashboard")
+	require.NoError(t, err)
+	assert.Empty(t, members, "HTMX requests and POSTs aren't page views")
+
+	assert.Equal(t, "page", PathChannel(httptest.NewRequest(http.MethodGet, "/", nil)))
+}
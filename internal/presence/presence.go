@@ -0,0 +1,167 @@
+// Package presence tracks who is online per channel, such as a page or a
+// document being edited together. Members stay present for a TTL after
+// each heartbeat; the HTTP handler serves heartbeats, member lists and a
+// server-sent event stream that HTMX widgets swap in as members come and go:
+//
+//	<div hx-get="/presence/doc:42/widget" hx-trigger="load" hx-swap="outerHTML"></div>
+//
+// Joins and explicit leaves are published on the bus as Joined and Left.
+package presence
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/bus"
+)
+
+// Member is someone present in a channel
+type Member struct {
+	ID       string            `json:"id"`
+	Name     string            `json:"name"`
+	Meta     map[string]string `json:"meta,omitempty"`
+	LastSeen time.Time         `json:"last_seen"`
+}
+
+// Joined is published when a member enters a channel
+type Joined struct {
+	Channel string
+	Member  Member
+}
+
+// EventName names Joined when bridged to the event dispatcher
+func (Joined) EventName() string { return "presence.joined" }
+
+// Left is published when a member leaves a channel. Members whose presence
+// expires leave without an event.
+type Left struct {
+	Channel  string
+	MemberID string
+}
+
+// EventName names Left when bridged to the event dispatcher
+func (Left) EventName() string { return "presence.left" }
+
+// ErrInvalidChannel is returned for channel names other than letters,
+// digits and . _ : -
+var ErrInvalidChannel = errors.New("presence: invalid channel name")
+
+var channelPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// ValidChannel reports whether name can be used as a channel
+func ValidChannel(name string) bool {
+	return channelPattern.MatchString(name)
+}
+
+// Tracker records heartbeats and leaves in a store, publishes joins and
+// leaves, and wakes up the streams watching a channel on this instance
+type Tracker struct {
+	store  Store
+	ttl    time.Duration
+	bus    *bus.Bus
+	logger *zap.Logger
+
+	mu       sync.Mutex
+	watchers map[string]map[chan struct{}]struct{}
+}
+
+// NewTracker creates a tracker keeping members present for ttl after each
+// heartbeat
+func NewTracker(store Store, ttl time.Duration, logger *zap.Logger) *Tracker {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &Tracker{
+		store:    store,
+		ttl:      ttl,
+		bus:      bus.Default,
+		logger:   logger,
+		watchers: make(map[string]map[chan struct{}]struct{}),
+	}
+}
+
+// Heartbeat marks member present in channel for another TTL
+func (t *Tracker) Heartbeat(ctx context.Context, channel string, member Member) error {
+	if !ValidChannel(channel) {
+		return ErrInvalidChannel
+	}
+	member.LastSeen = time.Now()
+	joined, err := t.store.Touch(ctx, channel, member, t.ttl)
+	if err != nil {
+		return err
+	}
+	if joined {
+		t.changed(channel)
+		t.publish(ctx, Joined{Channel: channel, Member: member})
+	}
+	return nil
+}
+
+// Leave removes a member from channel straight away
+func (t *Tracker) Leave(ctx context.Context, channel, id string) error {
+	if !ValidChannel(channel) {
+		return ErrInvalidChannel
+	}
+	left, err := t.store.Leave(ctx, channel, id)
+	if err != nil {
+		return err
+	}
+	if left {
+		t.changed(channel)
+		t.publish(ctx, Left{Channel: channel, MemberID: id})
+	}
+	return nil
+}
+
+// Members lists the members present in channel, ordered by name
+func (t *Tracker) Members(ctx context.Context, channel string) ([]Member, error) {
+	if !ValidChannel(channel) {
+		return nil, ErrInvalidChannel
+	}
+	return t.store.Members(ctx, channel)
+}
+
+// Watch returns a channel that receives a value when members join or leave
+// channel through this tracker. Changes on other instances and expiries
+// aren't signalled; watchers poll for those. Call stop when done.
+func (t *Tracker) Watch(channel string) (changes <-chan struct{}, stop func()) {
+	ch := make(chan struct{}, 1)
+
+	t.mu.Lock()
+	if t.watchers[channel] == nil {
+		t.watchers[channel] = make(map[chan struct{}]struct{})
+	}
+	t.watchers[channel][ch] = struct{}{}
+	t.mu.Unlock()
+
+	return ch, func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		delete(t.watchers[channel], ch)
+		if len(t.watchers[channel]) == 0 {
+			delete(t.watchers, channel)
+		}
+	}
+}
+
+func (t *Tracker) changed(channel string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for ch := range t.watchers[channel] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (t *Tracker) publish(ctx context.Context, event interface{}) {
+	if err := t.bus.Publish(ctx, event); err != nil {
+		t.logger.Warn("Presence event handler failed", zap.String("event", bus.EventName(event)), zap.Error(err))
+	}
+}
@@ -0,0 +1,111 @@
+package presence
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/bus"
+)
+
+// testStore checks a store's joins, expiry and leaves
+func testStore(t *testing.T, store Store) {
+	ctx := context.Background()
+	channel := "doc:" + t.Name()
+
+	joined, err := store.Touch(ctx, channel, Member{ID: "2", Name: "grace"}, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, joined)
+	joined, err = store.Touch(ctx, channel, Member{ID: "2", Name: "grace"}, time.Minute)
+	require.NoError(t, err)
+	assert.False(t, joined, "a heartbeat isn't a join")
+	_, err = store.Touch(ctx, channel, Member{ID: "1", Name: "ada", Meta: map[string]string{"color": "red"}}, time.Minute)
+	require.NoError(t, err)
+	_, err = store.Touch(ctx, channel, Member{ID: "3", Name: "brief"}, 50*time.Millisecond)
+	require.NoError(t, err)
+
+	members, err := store.Members(ctx, channel)
+	require.NoError(t, err)
+	assert.Equal(t, []Member{
+		{ID: "1", Name: "ada", Meta: map[string]string{"color": "red"}},
+		{ID: "3", Name: "brief"},
+		{ID: "2", Name: "grace"},
+	}, members)
+
+	time.Sleep(100 * time.Millisecond)
+	members, err = store.Members(ctx, channel)
+	require.NoError(t, err)
+	assert.Len(t, members, 2, "expired members drop out")
+	joined, err = store.Touch(ctx, channel, Member{ID: "3", Name: "brief"}, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, joined, "coming back after expiry is a join")
+
+	left, err := store.Leave(ctx, channel, "1")
+	require.NoError(t, err)
+	assert.True(t, left)
+	left, err = store.Leave(ctx, channel, "1")
+	require.NoError(t, err)
+	assert.False(t, left)
+
+	members, err = store.Members(ctx, channel)
+	require.NoError(t, err)
+	assert.Equal(t, []Member{{ID: "3", Name: "brief"}, {ID: "2", Name: "grace"}}, members)
+	members, err = store.Members(ctx, "empty")
+	require.NoError(t, err)
+	assert.Empty(t, members)
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestRedisStore(t *testing.T) {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_ADDR not set")
+	}
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	defer client.Close()
+	store := NewRedisStore(client)
+	client.Del(context.Background(), store.keys("doc:"+t.Name())...)
+
+	testStore(t, store)
+}
+
+func TestTrackerPublishesAndWakesWatchers(t *testing.T) {
+	ctx := context.Background()
+	tracker := NewTracker(NewMemoryStore(), time.Minute, nil)
+	tracker.bus = bus.New()
+	var events []interface{}
+	bus.SubscribeTo(tracker.bus, func(ctx context.Context, e interface{}) error {
+		events = append(events, e)
+		return nil
+	})
+	changes, stop := tracker.Watch("doc:1")
+	defer stop()
+
+	ada := Member{ID: "1", Name: "ada"}
+	require.NoError(t, tracker.Heartbeat(ctx, "doc:1", ada))
+	require.Len(t, events, 1)
+	joined := events[0].(Joined)
+	assert.Equal(t, "doc:1", joined.Channel)
+	assert.Equal(t, "ada", joined.Member.Name)
+	assert.WithinDuration(t, time.Now(), joined.Member.LastSeen, time.Second)
+	assert.Len(t, changes, 1)
+	<-changes
+
+	require.NoError(t, tracker.Heartbeat(ctx, "doc:1", ada))
+	assert.Len(t, events, 1, "heartbeats aren't published")
+	assert.Empty(t, changes)
+
+	require.NoError(t, tracker.Leave(ctx, "doc:1", "1"))
+	assert.Equal(t, Left{Channel: "doc:1", MemberID: "1"}, events[1])
+	assert.Len(t, changes, 1)
+
+	assert.ErrorIs(t, tracker.Heartbeat(ctx, "doc/1", ada), ErrInvalidChannel)
+}
@@ -0,0 +1,229 @@
+package presence
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+// Store keeps the members of each channel until their presence expires
+type Store interface {
+	// Touch adds or refreshes a member until ttl from now and reports
+	// whether it wasn't present before
+	Touch(ctx context.Context, channel string, member Member, ttl time.Duration) (joined bool, err error)
+
+	// Leave removes a member and reports whether it was present
+	Leave(ctx context.Context, channel, id string) (left bool, err error)
+
+	// Members lists the members present, ordered by name
+	Members(ctx context.Context, channel string) ([]Member, error)
+}
+
+// NewStore creates the store for the configured driver. The redis driver
+// connects to the cache's Redis server.
+func NewStore(cfg config.PresenceConfig, cache config.CacheConfig) (Store, error) {
+	switch cfg.Driver {
+	case "memory":
+		return NewMemoryStore(), nil
+	case "redis", "":
+		client := redis.NewClient(&redis.Options{
+			Addr: fmt.Sprintf("%s:%d", cache.Host, cache.Port),
+			DB:   cache.DB,
+		})
+		return NewRedisStore(client), nil
+	default:
+		return nil, fmt.Errorf("unknown presence driver %q (redis or memory)", cfg.Driver)
+	}
+}
+
+// sortMembers orders members by name, then ID
+func sortMembers(members []Member) {
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].Name != members[j].Name {
+			return members[i].Name < members[j].Name
+		}
+		return members[i].ID < members[j].ID
+	})
+}
+
+// MemoryStore keeps presence in memory, for a single instance
+type MemoryStore struct {
+	mu       sync.Mutex
+	channels map[string]map[string]memoryEntry
+}
+
+type memoryEntry struct {
+	member  Member
+	expires time.Time
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{channels: make(map[string]map[string]memoryEntry)}
+}
+
+// Touch adds or refreshes a member
+func (s *MemoryStore) Touch(ctx context.Context, channel string, member Member, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	members := s.channels[channel]
+	if members == nil {
+		members = make(map[string]memoryEntry)
+		s.channels[channel] = members
+	}
+	old, ok := members[member.ID]
+	members[member.ID] = memoryEntry{member: member, expires: now.Add(ttl)}
+	return !ok || !old.expires.After(now), nil
+}
+
+// Leave removes a member
+func (s *MemoryStore) Leave(ctx context.Context, channel, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.channels[channel][id]
+	if !ok {
+		return false, nil
+	}
+	delete(s.channels[channel], id)
+	if len(s.channels[channel]) == 0 {
+		delete(s.channels, channel)
+	}
+	return entry.expires.After(time.Now()), nil
+}
+
+// Members lists the members present, dropping expired ones
+func (s *MemoryStore) Members(ctx context.Context, channel string) ([]Member, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	members := []Member{}
+	for id, entry := range s.channels[channel] {
+		if !entry.expires.After(now) {
+			delete(s.channels[channel], id)
+			continue
+		}
+		members = append(members, entry.member)
+	}
+	if len(s.channels[channel]) == 0 {
+		delete(s.channels, channel)
+	}
+	sortMembers(members)
+	return members, nil
+}
+
+// RedisStore keeps presence in Redis so that every instance sees the same
+// members. Each channel is a sorted set of member IDs scored by expiry and
+// a hash of the members themselves; both expire with the last member.
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore creates a Redis-backed store
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+// keys returns the sorted set and hash of a channel, hash-tagged to share a
+// cluster slot
+func (s *RedisStore) keys(channel string) []string {
+	return []string{"presence:{" + channel + "}", "presence:{" + channel + "}:members"}
+}
+
+var touchScript = redis.NewScript(`
+local old = redis.call('ZSCORE', KEYS[1], ARGV[1])
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[3])
+redis.call('PEXPIRE', KEYS[1], ARGV[4])
+redis.call('PEXPIRE', KEYS[2], ARGV[4])
+if old and tonumber(old) > tonumber(ARGV[5]) then
+	return 0
+end
+return 1
+`)
+
+// Touch adds or refreshes a member
+func (s *RedisStore) Touch(ctx context.Context, channel string, member Member, ttl time.Duration) (bool, error) {
+	data, err := json.Marshal(member)
+	if err != nil {
+		return false, err
+	}
+	now := time.Now()
+	joined, err := touchScript.Run(ctx, s.client, s.keys(channel),
+		member.ID,
+		strconv.FormatInt(now.Add(ttl).UnixMilli(), 10),
+		data,
+		ttl.Milliseconds(),
+		strconv.FormatInt(now.UnixMilli(), 10),
+	).Int()
+	if err != nil {
+		return false, fmt.Errorf("presence: %w", err)
+	}
+	return joined == 1, nil
+}
+
+var leaveScript = redis.NewScript(`
+local score = redis.call('ZSCORE', KEYS[1], ARGV[1])
+redis.call('ZREM', KEYS[1], ARGV[1])
+redis.call('HDEL', KEYS[2], ARGV[1])
+if score and tonumber(score) > tonumber(ARGV[2]) then
+	return 1
+end
+return 0
+`)
+
+// Leave removes a member
+func (s *RedisStore) Leave(ctx context.Context, channel, id string) (bool, error) {
+	left, err := leaveScript.Run(ctx, s.client, s.keys(channel), id, strconv.FormatInt(time.Now().UnixMilli(), 10)).Int()
+	if err != nil {
+		return false, fmt.Errorf("presence: %w", err)
+	}
+	return left == 1, nil
+}
+
+var membersScript = redis.NewScript(`
+local expired = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+if #expired > 0 then
+	redis.call('ZREM', KEYS[1], unpack(expired))
+	redis.call('HDEL', KEYS[2], unpack(expired))
+end
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '(' .. ARGV[1], '+inf')
+if #ids == 0 then
+	return {}
+end
+return redis.call('HMGET', KEYS[2], unpack(ids))
+`)
+
+// Members lists the members present, dropping expired ones
+func (s *RedisStore) Members(ctx context.Context, channel string) ([]Member, error) {
+	values, err := membersScript.Run(ctx, s.client, s.keys(channel), strconv.FormatInt(time.Now().UnixMilli(), 10)).Slice()
+	if err != nil {
+		return nil, fmt.Errorf("presence: %w", err)
+	}
+
+	members := make([]Member, 0, len(values))
+	for _, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var member Member
+		if err := json.Unmarshal([]byte(data), &member); err != nil {
+			continue
+		}
+		members = append(members, member)
+	}
+	sortMembers(members)
+	return members, nil
+}
@@ -0,0 +1,177 @@
+package problem
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Error is implemented by errors that decide how they are reported to
+// clients. The types below cover the common cases; an application error
+// type can implement it to pick its own status and fields.
+type Error interface {
+	error
+	Problem() *Problem
+}
+
+// ValidationError reports input that failed validation, field by field
+type ValidationError struct {
+	// Detail summarizes the failure; it defaults to a generic message
+	Detail string
+	// Fields maps each invalid field to what is wrong with it
+	Fields map[string]string
+}
+
+// Validation returns a ValidationError for the given field messages
+func Validation(fields map[string]string) *ValidationError {
+	return &ValidationError{Fields: fields}
+}
+
+// Error implements error
+func (e *ValidationError) Error() string {
+	parts := make([]string, 0, len(e.Fields))
+	for _, field := range sortedKeys(e.Fields) {
+		parts = append(parts, field+": "+e.Fields[field])
+	}
+	if len(parts) == 0 {
+		return e.detail()
+	}
+	return "validation failed: " + strings.Join(parts, "; ")
+}
+
+// Problem reports the error as 422 Unprocessable Entity
+func (e *ValidationError) Problem() *Problem {
+	p := New(http.StatusUnprocessableEntity, e.detail())
+	p.Errors = e.Fields
+	return p
+}
+
+func (e *ValidationError) detail() string {
+	if e.Detail == "" {
+		return "The request contains invalid fields"
+	}
+	return e.Detail
+}
+
+// NotFoundError reports a resource that doesn't exist
+type NotFoundError struct {
+	Resource string
+	ID       any
+}
+
+// NotFound returns a NotFoundError for the resource with the given ID
+func NotFound(resource string, id any) *NotFoundError {
+	return &NotFoundError{Resource: resource, ID: id}
+}
+
+// Error implements error
+func (e *NotFoundError) Error() string {
+	if e.ID == nil {
+		return e.Resource + " not found"
+	}
+	return fmt.Sprintf("%s %v not found", e.Resource, e.ID)
+}
+
+// Problem reports the error as 404 Not Found
+func (e *NotFoundError) Problem() *Problem {
+	return New(http.StatusNotFound, e.Error())
+}
+
+// UnauthorizedError reports a request without valid credentials
+type UnauthorizedError struct {
+	Detail string
+}
+
+// Unauthorized returns an UnauthorizedError with the given detail
+func Unauthorized(detail string) *UnauthorizedError {
+	return &UnauthorizedError{Detail: detail}
+}
+
+// Error implements error
+func (e *UnauthorizedError) Error() string {
+	if e.Detail == "" {
+		return "unauthorized"
+	}
+	return e.Detail
+}
+
+// Problem reports the error as 401 Unauthorized
+func (e *UnauthorizedError) Problem() *Problem {
+	return New(http.StatusUnauthorized, e.Detail)
+}
+
+// DomainError reports a request that broke a business rule, such as
+// cancelling an order that has already shipped
+type DomainError struct {
+	// Code identifies the rule for clients, e.g. "order_already_shipped"
+	Code   string
+	Detail string
+	// Status defaults to 422 Unprocessable Entity
+	Status int
+	// Err is the underlying cause, which is never shown to clients
+	Err error
+}
+
+// Domain returns a DomainError for the rule identified by code
+func Domain(code, detail string) *DomainError {
+	return &DomainError{Code: code, Detail: detail}
+}
+
+// Error implements error
+func (e *DomainError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Detail, e.Err)
+	}
+	return e.Code + ": " + e.Detail
+}
+
+// Unwrap returns the underlying cause
+func (e *DomainError) Unwrap() error {
+	return e.Err
+}
+
+// Problem reports the error with its status and code
+func (e *DomainError) Problem() *Problem {
+	status := e.Status
+	if status == 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	p := New(status, e.Detail)
+	p.Code = e.Code
+	return p
+}
+
+// PanicError is a panic recovered while serving a request
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+// Panic returns a PanicError for the recovered value and its stack
+func Panic(value any, stack []byte) *PanicError {
+	return &PanicError{Value: value, Stack: stack}
+}
+
+// Error implements error
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Problem reports the panic as a 500 that carries its stack for debug pages
+func (e *PanicError) Problem() *Problem {
+	p := New(http.StatusInternalServerError, "")
+	p.Stack = string(e.Stack)
+	return p
+}
+
+// RecordNotFound reports gorm.ErrRecordNotFound as a NotFoundError for the
+// resource with the given ID and returns any other error unchanged
+func RecordNotFound(err error, resource string, id any) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return NotFound(resource, id)
+	}
+	return err
+}
@@ -0,0 +1,154 @@
+// Package problem maps errors to RFC 7807 problem details, rendered as
+// application/problem+json for APIs and as an HTML error page for web routes.
+package problem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/mrhoseah/dolphin/internal/binding"
+	"github.com/mrhoseah/dolphin/internal/orm"
+	"github.com/mrhoseah/dolphin/internal/query"
+	"github.com/mrhoseah/dolphin/internal/validation"
+	"gorm.io/gorm"
+)
+
+// ContentType is the media type of JSON problem responses
+const ContentType = "application/problem+json"
+
+// StatusPageExpired is sent when a form's CSRF token is missing or stale
+const StatusPageExpired = 419
+
+// ErrRequestTimeout is the cause of the context of a request that ran past
+// its timeout. It is reported as a 408, as are the server errors of work
+// the timeout cut short.
+var ErrRequestTimeout = errors.New("request timed out")
+
+// Problem is an RFC 7807 problem details object. It is itself an Error, so
+// New(http.StatusBadRequest, "Invalid ID") can be returned or written as is.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+
+	// Code is a machine readable error code, set by DomainError
+	Code string `json:"code,omitempty"`
+	// Errors maps invalid fields to their messages
+	Errors map[string]string `json:"errors,omitempty"`
+
+	// Stack is the stack of a recovered panic, shown on error pages in
+	// debug mode only and never sent as JSON
+	Stack string `json:"-"`
+}
+
+// New returns a problem with the given status and detail, titled with the
+// status text
+func New(status int, detail string) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  statusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// Error implements error
+func (p *Problem) Error() string {
+	if p.Detail == "" {
+		return p.Title
+	}
+	return p.Title + ": " + p.Detail
+}
+
+// Problem implements Error
+func (p *Problem) Problem() *Problem {
+	return p
+}
+
+// From maps err to the problem reported to clients. Besides the Error
+// implementations it knows the framework's own errors: missing records,
+// body, binding, query and validation failures, invalid cursors, and
+// requests that timed out or sent too large a body.
+// Anything else is a 500 whose detail is withheld.
+func From(err error) *Problem {
+	var known Error
+	var body *binding.BodyError
+	var bindErrs *binding.Errors
+	var queryErr *query.Error
+	var validationErrs validation.ValidationErrors
+	var maxBytes *http.MaxBytesError
+	switch {
+	case err == nil:
+		return New(http.StatusInternalServerError, "")
+	case errors.As(err, &known):
+		p := *known.Problem()
+		return &p
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return New(http.StatusNotFound, "The requested resource was not found")
+	case errors.As(err, &body):
+		return New(body.Status, body.Error())
+	case errors.As(err, &bindErrs):
+		fields := make(map[string]string, len(bindErrs.Errors))
+		for _, fe := range bindErrs.Errors {
+			addField(fields, fe.Field, fe.Message)
+		}
+		return Validation(fields).Problem()
+	case errors.As(err, &validationErrs):
+		fields := make(map[string]string, len(validationErrs.Errors))
+		for _, fe := range validationErrs.Errors {
+			addField(fields, fe.Field, fe.Message)
+		}
+		return Validation(fields).Problem()
+	case errors.As(err, &queryErr):
+		p := New(http.StatusBadRequest, "Invalid query")
+		p.Errors = queryErr.Problems
+		return p
+	case errors.Is(err, orm.ErrInvalidCursor):
+		return New(http.StatusBadRequest, err.Error())
+	case errors.Is(err, ErrRequestTimeout):
+		return New(http.StatusRequestTimeout, "The request took too long to process")
+	case errors.As(err, &maxBytes):
+		return New(http.StatusRequestEntityTooLarge, fmt.Sprintf("The request body may be at most %d bytes", maxBytes.Limit))
+	case errors.Is(err, context.DeadlineExceeded):
+		return New(http.StatusGatewayTimeout, "")
+	default:
+		return New(http.StatusInternalServerError, "")
+	}
+}
+
+func statusText(status int) string {
+	if status == StatusPageExpired {
+		return "Page Expired"
+	}
+	return http.StatusText(status)
+}
+
+func addField(fields map[string]string, field, message string) {
+	if existing, ok := fields[field]; ok {
+		fields[field] = existing + "; " + message
+		return
+	}
+	fields[field] = message
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// WantsHTML reports whether the client prefers an HTML page, as browsers do,
+// on a route outside /api
+func WantsHTML(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "text/html") && !strings.HasPrefix(r.URL.Path, "/api/")
+}
@@ -0,0 +1,199 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mrhoseah/dolphin/internal/binding"
+	"github.com/mrhoseah/dolphin/internal/orm"
+	"github.com/mrhoseah/dolphin/internal/query"
+	views "github.com/mrhoseah/dolphin/internal/template"
+	"github.com/mrhoseah/dolphin/internal/validation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"gorm.io/gorm"
+)
+
+func TestFrom(t *testing.T) {
+	var validationErrs validation.ValidationErrors
+	validationErrs.AddError("email", "is required", nil)
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		detail string
+		errors map[string]string
+	}{
+		{"validation", Validation(map[string]string{"name": "is required"}), 422, "The request contains invalid fields", map[string]string{"name": "is required"}},
+		{"not found", NotFound("post", 7), 404, "post 7 not found", nil},
+		{"unauthorized", Unauthorized("token expired"), 401, "token expired", nil},
+		{"wrapped domain", fmt.Errorf("cancel: %w", Domain("order_shipped", "Order already shipped")), 422, "Order already shipped", nil},
+		{"problem", New(http.StatusBadRequest, "Invalid ID"), 400, "Invalid ID", nil},
+		{"record not found", gorm.ErrRecordNotFound, 404, "The requested resource was not found", nil},
+		{"record not found by id", RecordNotFound(gorm.ErrRecordNotFound, "post", 3), 404, "post 3 not found", nil},
+		{"body", &binding.BodyError{Status: 413, Err: errors.New("request body too large")}, 413, "request body too large", nil},
+		{"binding", &binding.Errors{Errors: []binding.FieldError{{Field: "age", Message: "must be a number"}}}, 422, "The request contains invalid fields", map[string]string{"age": "must be a number"}},
+		{"validator", validationErrs, 422, "The request contains invalid fields", map[string]string{"email": "is required"}},
+		{"query", &query.Error{Problems: map[string]string{"sort": "unknown field"}}, 400, "Invalid query", map[string]string{"sort": "unknown field"}},
+		{"cursor", orm.ErrInvalidCursor, 400, orm.ErrInvalidCursor.Error(), nil},
+		{"request timeout", fmt.Errorf("list posts: %w", ErrRequestTimeout), 408, "The request took too long to process", nil},
+		{"body too large", &http.MaxBytesError{Limit: 1024}, 413, "The request body may be at most 1024 bytes", nil},
+		{"unknown", errors.New("connection refused"), 500, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := From(tt.err)
+			assert.Equal(t, tt.status, p.Status)
+			assert.Equal(t, http.StatusText(tt.status), p.Title)
+			assert.Equal(t, tt.detail, p.Detail)
+			assert.Equal(t, tt.errors, p.Errors)
+		})
+	}
+
+	domain := &DomainError{Code: "insufficient_funds", Detail: "Balance too low", Status: http.StatusConflict}
+	p := From(domain)
+	assert.Equal(t, http.StatusConflict, p.Status)
+	assert.Equal(t, "insufficient_funds", p.Code)
+}
+
+func TestWriteJSON(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/posts/7", nil)
+
+	Write(w, r, NotFound("post", 7))
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, ContentType, w.Header().Get("Content-Type"))
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, map[string]any{
+		"type":     "about:blank",
+		"title":    "Not Found",
+		"status":   float64(404),
+		"detail":   "post 7 not found",
+		"instance": "/api/v1/posts/7",
+	}, body)
+}
+
+func TestWriteNegotiatesWithoutMiddleware(t *testing.T) {
+	browser := httptest.NewRequest(http.MethodGet, "/posts/7", nil)
+	browser.Header.Set("Accept", "text/html,application/xhtml+xml")
+	w := httptest.NewRecorder()
+	Write(w, browser, NotFound("post", 7))
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, w.Body.String(), "post 7 not found")
+
+	api := httptest.NewRequest(http.MethodGet, "/api/v1/posts/7", nil)
+	api.Header.Set("Accept", "text/html")
+	w = httptest.NewRecorder()
+	Write(w, api, NotFound("post", 7))
+	assert.Equal(t, ContentType, w.Header().Get("Content-Type"))
+}
+
+func TestMiddlewareRendersAndLogsServerErrors(t *testing.T) {
+	core, logs := observer.New(zapcore.ErrorLevel)
+	failing := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Write(w, r, errors.New("connection refused"))
+	})
+	h := Middleware(HTML(DefaultPage), zap.New(core))(failing)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/dashboard", nil))
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+	assert.NotContains(t, w.Body.String(), "connection refused")
+	require.Equal(t, 1, logs.Len())
+	assert.Equal(t, "connection refused", logs.All()[0].ContextMap()["error"])
+}
+
+func TestHandlerReusesProblem(t *testing.T) {
+	h := Handler(New(http.StatusNotFound, ""))
+
+	for _, path := range []string{"/api/missing", "/api/other"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var p Problem
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+		assert.Equal(t, path, p.Instance)
+	}
+}
+
+func newErrorViews(t *testing.T, pages map[string]string) *views.Engine {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range pages {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	config := views.DefaultConfig()
+	config.LayoutsDir, config.PartialsDir, config.PagesDir = "", "", ""
+	config.ComponentsDir, config.EmailsDir = "", ""
+	config.ErrorsDir = dir
+	config.AutoReload = false
+	config.EnableLogging = false
+	engine, err := views.NewEngine(config, nil)
+	require.NoError(t, err)
+	return engine
+}
+
+func TestPagesUseStatusThenClassTemplates(t *testing.T) {
+	engine := newErrorViews(t, map[string]string{
+		"404.html": `missing {{.Instance}}`,
+		"5xx.html": `broken {{.Status}} {{.Title}}`,
+	})
+	render := Pages(engine, false)
+
+	tests := []struct {
+		status int
+		body   string
+	}{
+		{http.StatusNotFound, "missing /posts"},
+		{http.StatusServiceUnavailable, "broken 503 Service Unavailable"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/posts", nil)
+		p := New(tt.status, "")
+		p.Instance = r.URL.Path
+		render(w, r, p)
+		assert.Equal(t, tt.status, w.Code)
+		assert.Equal(t, tt.body, w.Body.String())
+	}
+
+	// No template for 419, so the built-in page is used
+	w := httptest.NewRecorder()
+	render(w, httptest.NewRequest(http.MethodPost, "/login", nil), New(StatusPageExpired, "CSRF token mismatch"))
+	assert.Equal(t, StatusPageExpired, w.Code)
+	assert.Contains(t, w.Body.String(), "Page Expired")
+	assert.Contains(t, w.Body.String(), "CSRF token mismatch")
+}
+
+func TestPagesShowStacksInDebugOnly(t *testing.T) {
+	engine := newErrorViews(t, map[string]string{"500.html": `error{{if .Stack}}: {{.Stack}}{{end}}`})
+	panicked := Panic("boom", []byte("goroutine 1 [running]"))
+
+	for _, debug := range []bool{false, true} {
+		for _, engine := range []*views.Engine{engine, nil} {
+			w := httptest.NewRecorder()
+			Pages(engine, debug)(w, httptest.NewRequest(http.MethodGet, "/", nil), From(panicked))
+			assert.Equal(t, http.StatusInternalServerError, w.Code)
+			assert.Equal(t, debug, strings.Contains(w.Body.String(), "goroutine 1 [running]"))
+		}
+	}
+
+	// Stacks never reach JSON clients
+	w := httptest.NewRecorder()
+	Write(w, httptest.NewRequest(http.MethodGet, "/api/v1/posts", nil), panicked)
+	assert.NotContains(t, w.Body.String(), "goroutine")
+}
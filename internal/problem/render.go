@@ -0,0 +1,177 @@
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	views "github.com/mrhoseah/dolphin/internal/template"
+	"go.uber.org/zap"
+)
+
+// Renderer writes a problem as the response
+type Renderer func(w http.ResponseWriter, r *http.Request, p *Problem)
+
+// JSON renders the problem as application/problem+json
+func JSON(w http.ResponseWriter, r *http.Request, p *Problem) {
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// DefaultPage is the error page used when the application has none for the
+// status. It is executed with the page data described at Pages.
+var DefaultPage = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>{{.Status}} {{.Title}}</title>
+    <script src="https://cdn.tailwindcss.com"></script>
+</head>
+<body class="bg-gray-50 min-h-screen flex items-center justify-center">
+    <div class="text-center max-w-3xl px-4">
+        <p class="text-6xl font-bold text-gray-300">{{.Status}}</p>
+        <h1 class="mt-4 text-2xl font-semibold text-gray-900">{{.Title}}</h1>
+        {{if .Detail}}<p class="mt-2 text-gray-600">{{.Detail}}</p>{{end}}
+        {{range $field, $message := .Errors}}<p class="mt-1 text-sm text-red-600">{{$field}}: {{$message}}</p>{{end}}
+        {{if .Stack}}<pre class="mt-6 p-4 text-left text-xs bg-gray-900 text-gray-100 rounded overflow-x-auto">{{.Stack}}</pre>{{end}}
+        {{if .RequestID}}<p class="mt-6 text-xs text-gray-400">Request ID: {{.RequestID}}</p>{{end}}
+        <a href="/" class="mt-6 inline-block text-blue-600 hover:text-blue-800">Back to home</a>
+    </div>
+</body>
+</html>
+`))
+
+// pageData is what error pages are executed with
+func pageData(r *http.Request, p *Problem, debug bool) views.TemplateData {
+	data := views.TemplateData{
+		"Status":    p.Status,
+		"Title":     p.Title,
+		"Detail":    p.Detail,
+		"Code":      p.Code,
+		"Errors":    p.Errors,
+		"Instance":  p.Instance,
+		"RequestID": middleware.GetReqID(r.Context()),
+		"Debug":     debug,
+		"Stack":     "",
+	}
+	if debug {
+		data["Stack"] = p.Stack
+	}
+	return data
+}
+
+// HTML renders the problem as an error page by executing page with it
+func HTML(page *template.Template) Renderer {
+	return func(w http.ResponseWriter, r *http.Request, p *Problem) {
+		writePage(w, p, func(w http.ResponseWriter) error {
+			return page.Execute(w, pageData(r, p, false))
+		})
+	}
+}
+
+// Pages renders the problem with the engine's error template for its
+// status, errors.404 or errors.4xx (resources/views/errors/404.html or
+// 4xx.html), falling back to DefaultPage. Pages are executed with Status,
+// Title, Detail, Code, Errors, Instance and RequestID, and with debug set,
+// the Stack of a recovered panic. engine may be nil.
+func Pages(engine *views.Engine, debug bool) Renderer {
+	return func(w http.ResponseWriter, r *http.Request, p *Problem) {
+		data := pageData(r, p, debug)
+		if engine != nil {
+			if name, ok := engine.ErrorPage(p.Status); ok {
+				if html, err := engine.Render(name, data); err == nil {
+					writePage(w, p, func(w http.ResponseWriter) error {
+						_, err := w.Write([]byte(html))
+						return err
+					})
+					return
+				}
+			}
+		}
+		writePage(w, p, func(w http.ResponseWriter) error {
+			return DefaultPage.Execute(w, data)
+		})
+	}
+}
+
+func writePage(w http.ResponseWriter, p *Problem, write func(http.ResponseWriter) error) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(p.Status)
+	write(w)
+}
+
+// Negotiate renders problems with html for browsers outside /api and as
+// problem+json for everything else
+func Negotiate(html Renderer) Renderer {
+	return func(w http.ResponseWriter, r *http.Request, p *Problem) {
+		if WantsHTML(r) {
+			html(w, r, p)
+			return
+		}
+		JSON(w, r, p)
+	}
+}
+
+var defaultRenderer = Negotiate(Pages(nil, false))
+
+type handlerKey struct{}
+
+type handler struct {
+	render Renderer
+	logger *zap.Logger
+}
+
+// Middleware makes Write use render for the requests it wraps and log
+// server errors with logger, which may be nil
+func Middleware(render Renderer, logger *zap.Logger) func(http.Handler) http.Handler {
+	h := &handler{render: render, logger: logger}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), handlerKey{}, h)))
+		})
+	}
+}
+
+// Write reports err as the response, mapped by From; server errors of a
+// request that timed out are reported as its timeout. Routes below
+// Middleware use its renderer; elsewhere browsers get DefaultPage and
+// everything else problem+json.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	p := From(err)
+	if p.Status >= http.StatusInternalServerError && errors.Is(context.Cause(r.Context()), ErrRequestTimeout) {
+		p = From(ErrRequestTimeout)
+	}
+	if p.Instance == "" {
+		p.Instance = r.URL.Path
+	}
+
+	h, _ := r.Context().Value(handlerKey{}).(*handler)
+	if h != nil && h.logger != nil && p.Status >= http.StatusInternalServerError {
+		h.logger.Error("Request failed",
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
+			zap.Int("status", p.Status),
+			zap.Error(err),
+		)
+	}
+
+	if h != nil {
+		h.render(w, r, p)
+		return
+	}
+	defaultRenderer(w, r, p)
+}
+
+// Handler returns a handler that always writes err, for use as a router's
+// NotFound or MethodNotAllowed handler
+func Handler(err error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		Write(w, r, err)
+	}
+}
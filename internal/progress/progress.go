@@ -0,0 +1,311 @@
+// Package progress shows how far long-running commands have got: bars with
+// an ETA for work of known size, and spinners for the rest. On a terminal
+// they redraw one line in place. Piped, logged or next to JSON output they
+// print a plain line every few seconds instead, with no escape codes:
+//
+//	ui := progress.New(os.Stdout)
+//	bar := ui.Bar("🕶️  users", total)
+//	for ... {
+//		bar.Add(1)
+//	}
+//	bar.Done()
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// barWidth is how many cells a drawn bar has
+const barWidth = 24
+
+// spinnerFrames are drawn in turn while a spinner runs
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// UI draws the bars and spinners of one command
+type UI struct {
+	out         io.Writer
+	interactive bool
+
+	// redraw is how often a terminal line is drawn again, and plainEvery
+	// how often a plain line is printed
+	redraw     time.Duration
+	plainEvery time.Duration
+	now        func() time.Time
+}
+
+// New returns a UI writing to out, redrawing in place when out is a
+// terminal and printing plain lines otherwise
+func New(out io.Writer) *UI {
+	ui := Plain(out)
+	ui.interactive = IsTerminal(out)
+	return ui
+}
+
+// Plain returns a UI printing plain lines to out, e.g. stderr when stdout
+// carries JSON
+func Plain(out io.Writer) *UI {
+	return &UI{
+		out:        out,
+		redraw:     100 * time.Millisecond,
+		plainEvery: 5 * time.Second,
+		now:        time.Now,
+	}
+}
+
+// IsTerminal reports whether w is a terminal that can redraw lines
+func IsTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Bar shows the progress of work counted in steps, such as rows. With a
+// total it shows the share done and the time left; without one, the count
+// and rate.
+type Bar struct {
+	ui *UI
+
+	mu      sync.Mutex
+	label   string
+	done    int64
+	total   int64
+	started time.Time
+	drawn   time.Time
+	ended   bool
+}
+
+// Bar starts a bar for total steps, or an unknown number when total is 0
+func (u *UI) Bar(label string, total int64) *Bar {
+	now := u.now()
+	b := &Bar{ui: u, label: label, total: total, started: now}
+	if u.interactive {
+		b.draw()
+		return b
+	}
+	// The first line says the work started; later ones wait
+	b.drawn = now
+	fmt.Fprintf(u.out, "%s: started\n", label)
+	return b
+}
+
+// Add counts n more steps done
+func (b *Bar) Add(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.done += n
+	b.draw()
+}
+
+// Set sets the steps done
+func (b *Bar) Set(done int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.done = done
+	b.draw()
+}
+
+// SetTotal changes the number of steps, once it is known
+func (b *Bar) SetTotal(total int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.total = total
+	b.draw()
+}
+
+// SetLabel changes what the bar says is being done, such as the name of
+// the current step
+func (b *Bar) SetLabel(label string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.label = label
+	b.draw()
+}
+
+// Done ends the bar with a line saying how much was done and how long it
+// took
+func (b *Bar) Done() {
+	b.end("✅")
+}
+
+// Fail ends the bar where it stopped, so an error printed next starts on a
+// line of its own
+func (b *Bar) Fail() {
+	b.end("❌")
+}
+
+func (b *Bar) end(mark string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.ended {
+		return
+	}
+	b.ended = true
+	count := fmt.Sprint(b.done)
+	if b.total > 0 {
+		count = fmt.Sprintf("%d/%d", b.done, b.total)
+	}
+	line := fmt.Sprintf("%s %s: %s in %s", mark, b.label, count, formatDuration(b.ui.now().Sub(b.started)))
+	if b.ui.interactive {
+		fmt.Fprintf(b.ui.out, "\r\033[K%s\n", line)
+	} else {
+		fmt.Fprintln(b.ui.out, line)
+	}
+}
+
+// draw redraws the bar, or prints a plain line, unless it was done too
+// recently
+func (b *Bar) draw() {
+	if b.ended {
+		return
+	}
+	now := b.ui.now()
+	every := b.ui.plainEvery
+	if b.ui.interactive {
+		every = b.ui.redraw
+	}
+	if now.Sub(b.drawn) < every {
+		return
+	}
+	b.drawn = now
+
+	elapsed := now.Sub(b.started)
+	if b.ui.interactive {
+		fmt.Fprintf(b.ui.out, "\r\033[K%s %s", b.label, b.status(elapsed, true))
+		return
+	}
+	fmt.Fprintf(b.ui.out, "%s: %s\n", b.label, b.status(elapsed, false))
+}
+
+// status describes the progress: the bar itself on a terminal, the share
+// done, the count and the time left
+func (b *Bar) status(elapsed time.Duration, graphic bool) string {
+	if b.total <= 0 {
+		status := fmt.Sprintf("%d done", b.done)
+		if seconds := elapsed.Seconds(); seconds >= 1 {
+			status += fmt.Sprintf(" (%.0f/s)", float64(b.done)/seconds)
+		}
+		return status
+	}
+
+	done := min(b.done, b.total)
+	percent := done * 100 / b.total
+	status := fmt.Sprintf("%d%% (%d/%d)", percent, b.done, b.total)
+	if graphic {
+		filled := int(done * barWidth / b.total)
+		status = "[" + strings.Repeat("█", filled) + strings.Repeat("░", barWidth-filled) + "] " + status
+	}
+	if done > 0 && done < b.total {
+		left := time.Duration(float64(elapsed) * float64(b.total-done) / float64(done))
+		status += ", " + formatDuration(left) + " left"
+	}
+	return status
+}
+
+// Spinner shows that work of unknown size is still going
+type Spinner struct {
+	ui *UI
+
+	mu      sync.Mutex
+	label   string
+	started time.Time
+	frame   int
+	ended   bool
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// Spinner starts a spinner, which turns on a terminal until Done or Fail.
+// Elsewhere it prints one line as it starts and one as it ends.
+func (u *UI) Spinner(label string) *Spinner {
+	s := &Spinner{ui: u, label: label, started: u.now()}
+	if !u.interactive {
+		fmt.Fprintf(u.out, "%s...\n", label)
+		return s
+	}
+
+	s.stop = make(chan struct{})
+	s.stopped = make(chan struct{})
+	s.draw()
+	go func() {
+		defer close(s.stopped)
+		ticker := time.NewTicker(u.redraw)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.draw()
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+	return s
+}
+
+// SetLabel changes what the spinner says is being done
+func (s *Spinner) SetLabel(label string) {
+	s.mu.Lock()
+	s.label = label
+	s.mu.Unlock()
+	if !s.ui.interactive {
+		fmt.Fprintf(s.ui.out, "%s...\n", label)
+	}
+}
+
+// Done stops the spinner with a line saying how long the work took
+func (s *Spinner) Done() {
+	s.end("✅")
+}
+
+// Fail stops the spinner, marking the work failed
+func (s *Spinner) Fail() {
+	s.end("❌")
+}
+
+func (s *Spinner) end(mark string) {
+	s.mu.Lock()
+	ended := s.ended
+	s.ended = true
+	s.mu.Unlock()
+	if ended {
+		return
+	}
+	if s.stop != nil {
+		close(s.stop)
+		<-s.stopped
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	line := fmt.Sprintf("%s %s in %s", mark, s.label, formatDuration(s.ui.now().Sub(s.started)))
+	if s.ui.interactive {
+		fmt.Fprintf(s.ui.out, "\r\033[K%s\n", line)
+	} else {
+		fmt.Fprintln(s.ui.out, line)
+	}
+}
+
+func (s *Spinner) draw() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	frame := spinnerFrames[s.frame%len(spinnerFrames)]
+	s.frame++
+	fmt.Fprintf(s.ui.out, "\r\033[K%s %s (%s)", frame, s.label, formatDuration(s.ui.now().Sub(s.started)))
+}
+
+// formatDuration rounds d for people: tenths of a second under ten seconds,
+// whole seconds after
+func formatDuration(d time.Duration) string {
+	if d < 10*time.Second {
+		return d.Round(100 * time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
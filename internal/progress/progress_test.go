@@ -0,0 +1,100 @@
+package progress
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock is a clock tests move by hand
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time          { return c.now }
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func newTestUI(interactive bool) (*UI, *bytes.Buffer, *fakeClock) {
+	var out bytes.Buffer
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	ui := Plain(&out)
+	ui.interactive = interactive
+	ui.now = clock.Now
+	return ui, &out, clock
+}
+
+func TestPlainBar(t *testing.T) {
+	ui, out, clock := newTestUI(false)
+	bar := ui.Bar("users", 1000)
+	for i := 0; i < 10; i++ {
+		clock.Advance(time.Second)
+		bar.Add(50)
+	}
+	bar.Done()
+	bar.Done()
+
+	assert.Equal(t, []string{
+		"users: started",
+		"users: 25% (250/1000), 15s left",
+		"users: 50% (500/1000), 10s left",
+		"✅ users: 500/1000 in 10s",
+	}, strings.Split(strings.TrimSpace(out.String()), "\n"), "a line every five seconds, and one at the end")
+	assert.NotContains(t, out.String(), "\033")
+}
+
+func TestTerminalBar(t *testing.T) {
+	ui, out, clock := newTestUI(true)
+	bar := ui.Bar("🕶️  users", 4)
+	clock.Advance(2 * time.Second)
+	bar.Add(1)
+	bar.Add(1) // too soon to redraw
+	clock.Advance(time.Second)
+	bar.SetLabel("🕶️  orders")
+	bar.Fail()
+
+	assert.Equal(t, "\r\033[K🕶️  users [░░░░░░░░░░░░░░░░░░░░░░░░] 0% (0/4)"+
+		"\r\033[K🕶️  users [██████░░░░░░░░░░░░░░░░░░] 25% (1/4), 6s left"+
+		"\r\033[K🕶️  orders [████████████░░░░░░░░░░░░] 50% (2/4), 3s left"+
+		"\r\033[K❌ 🕶️  orders: 2/4 in 3s\n", out.String())
+}
+
+func TestBarWithoutTotal(t *testing.T) {
+	ui, out, clock := newTestUI(false)
+	bar := ui.Bar("posts", 0)
+	clock.Advance(5 * time.Second)
+	bar.Set(500)
+	clock.Advance(12500 * time.Millisecond)
+	bar.Done()
+
+	assert.Equal(t, "posts: started\nposts: 500 done (100/s)\n✅ posts: 500 in 18s\n", out.String())
+}
+
+func TestSpinner(t *testing.T) {
+	ui, out, clock := newTestUI(false)
+	spinner := ui.Spinner("Migrating main")
+	spinner.SetLabel("Migrating analytics")
+	clock.Advance(1500 * time.Millisecond)
+	spinner.Done()
+	spinner.Fail()
+	assert.Equal(t, "Migrating main...\nMigrating analytics...\n✅ Migrating analytics in 1.5s\n", out.String())
+
+	ui, out, _ = newTestUI(true)
+	ui.redraw = time.Millisecond
+	spinner = ui.Spinner("Building")
+	time.Sleep(20 * time.Millisecond)
+	spinner.Done()
+	assert.True(t, strings.HasPrefix(out.String(), "\r\033[K⠋ Building (0s)\r\033[K⠙ Building"))
+	assert.True(t, strings.HasSuffix(out.String(), "\r\033[K✅ Building in 0s\n"))
+}
+
+func TestIsTerminal(t *testing.T) {
+	assert.False(t, IsTerminal(&bytes.Buffer{}))
+	f, err := os.CreateTemp(t.TempDir(), "out")
+	assert.NoError(t, err)
+	defer f.Close()
+	assert.False(t, IsTerminal(f), "a file is not a terminal")
+}
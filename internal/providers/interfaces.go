@@ -318,6 +318,10 @@ type Job struct {
 	Payload  map[string]interface{} `json:"payload"`
 	Attempts int                    `json:"attempts"`
 	Delay    time.Duration          `json:"delay"`
+
+	// Correlation identifies the request the job was pushed from, for
+	// correlation.Run to restore in the worker
+	Correlation map[string]string `json:"correlation,omitempty"`
 }
 
 type JobHandler func(job Job) error
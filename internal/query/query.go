@@ -0,0 +1,412 @@
+package query
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mrhoseah/dolphin/internal/orm"
+	"gorm.io/gorm"
+)
+
+// Operator is a filter comparison operator
+type Operator string
+
+const (
+	OpEq      Operator = "eq"
+	OpNe      Operator = "ne"
+	OpGt      Operator = "gt"
+	OpGte     Operator = "gte"
+	OpLt      Operator = "lt"
+	OpLte     Operator = "lte"
+	OpLike    Operator = "like"
+	OpIn      Operator = "in"
+	OpNull    Operator = "null"
+	OpNotNull Operator = "notnull"
+)
+
+// sqlOperators maps operators onto SQL fragments
+var sqlOperators = map[Operator]string{
+	OpEq:   "=",
+	OpNe:   "<>",
+	OpGt:   ">",
+	OpGte:  ">=",
+	OpLt:   "<",
+	OpLte:  "<=",
+	OpLike: "LIKE",
+}
+
+// Config is the per-repository allowlist of query capabilities
+type Config struct {
+	// Resource is the type name used for fields[<resource>]
+	Resource string
+
+	// Filterable maps query names onto columns; an empty column means same name
+	Filterable map[string]string
+
+	// Sortable maps query names onto columns; an empty column means same name
+	Sortable map[string]string
+
+	// Fields lists the columns that may be selected via sparse fieldsets
+	Fields []string
+
+	// PrimaryKey is always selected when sparse fieldsets are used
+	PrimaryKey string
+
+	DefaultSort     string
+	DefaultPageSize int
+	MaxPageSize     int
+}
+
+// Filter is a single parsed filter condition
+type Filter struct {
+	Field    string
+	Column   string
+	Operator Operator
+	Values   []string
+}
+
+// Sort is a single parsed sort directive
+type Sort struct {
+	Field  string
+	Column string
+	Desc   bool
+}
+
+// Params holds the parsed, allowlisted query parameters
+type Params struct {
+	Filters  []Filter
+	Sorts    []Sort
+	Fields   map[string][]string
+	Page     int
+	PageSize int
+
+	// After and Before carry opaque cursors from page[after] / page[before]
+	After  string
+	Before string
+
+	config Config
+}
+
+// Params drive the listings of orm.Repository
+var (
+	_ orm.ListParams       = (*Params)(nil)
+	_ orm.CursorListParams = (*Params)(nil)
+)
+
+// Error aggregates every invalid query parameter
+type Error struct {
+	Problems map[string]string
+}
+
+// Error implements error
+func (e *Error) Error() string {
+	keys := make([]string, 0, len(e.Problems))
+	for k := range e.Problems {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s: %s", k, e.Problems[k]))
+	}
+	return "invalid query: " + strings.Join(parts, "; ")
+}
+
+// bracketPattern matches filter[field], filter[field][op] and fields[type]
+var bracketPattern = regexp.MustCompile(`^(\w+)\[([\w.]+)\](?:\[(\w+)\])?$`)
+
+// Parse maps query string values onto Params, rejecting anything not allowlisted
+func Parse(values url.Values, config Config) (*Params, error) {
+	if config.DefaultPageSize <= 0 {
+		config.DefaultPageSize = 15
+	}
+	if config.MaxPageSize <= 0 {
+		config.MaxPageSize = 100
+	}
+	if config.PrimaryKey == "" {
+		config.PrimaryKey = "id"
+	}
+
+	params := &Params{
+		Fields:   map[string][]string{},
+		Page:     1,
+		PageSize: config.DefaultPageSize,
+		config:   config,
+	}
+	problems := map[string]string{}
+
+	// Iterate in a stable order so filters apply deterministically
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := values.Get(key)
+		if key == "sort" {
+			continue
+		}
+
+		m := bracketPattern.FindStringSubmatch(key)
+		if m == nil {
+			continue
+		}
+
+		switch m[1] {
+		case "filter":
+			filter, err := parseFilter(config, m[2], m[3], value)
+			if err != nil {
+				problems[key] = err.Error()
+				continue
+			}
+			params.Filters = append(params.Filters, filter)
+		case "fields":
+			fields, err := parseFields(config, value)
+			if err != nil {
+				problems[key] = err.Error()
+				continue
+			}
+			params.Fields[m[2]] = fields
+		case "page":
+			if m[2] == "after" || m[2] == "before" {
+				if m[2] == "after" {
+					params.After = value
+				} else {
+					params.Before = value
+				}
+				continue
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				problems[key] = "must be a positive integer"
+				continue
+			}
+			switch m[2] {
+			case "number":
+				params.Page = n
+			case "size":
+				if n > config.MaxPageSize {
+					n = config.MaxPageSize
+				}
+				params.PageSize = n
+			default:
+				problems[key] = "unknown page parameter"
+			}
+		}
+	}
+
+	rawSort := values.Get("sort")
+	if rawSort == "" {
+		rawSort = config.DefaultSort
+	}
+	sorts, err := parseSorts(config, rawSort)
+	if err != nil {
+		problems["sort"] = err.Error()
+	}
+	params.Sorts = sorts
+
+	if len(problems) > 0 {
+		return nil, &Error{Problems: problems}
+	}
+	return params, nil
+}
+
+// parseFilter validates a single filter against the allowlist
+func parseFilter(config Config, field, op, value string) (Filter, error) {
+	column, ok := config.Filterable[field]
+	if !ok {
+		return Filter{}, fmt.Errorf("filtering by %q is not allowed", field)
+	}
+	if column == "" {
+		column = field
+	}
+
+	operator := OpEq
+	if op != "" {
+		operator = Operator(strings.ToLower(op))
+	}
+
+	filter := Filter{Field: field, Column: column, Operator: operator}
+	switch operator {
+	case OpIn:
+		filter.Values = splitList(value)
+	case OpNull, OpNotNull:
+	case OpEq:
+		// A comma separated equality filter is treated as IN
+		if list := splitList(value); len(list) > 1 {
+			filter.Operator = OpIn
+			filter.Values = list
+		} else {
+			filter.Values = []string{value}
+		}
+	default:
+		if _, ok := sqlOperators[operator]; !ok {
+			return Filter{}, fmt.Errorf("unknown operator %q", op)
+		}
+		filter.Values = []string{value}
+	}
+	return filter, nil
+}
+
+// parseFields validates a sparse fieldset against the allowlist
+func parseFields(config Config, value string) ([]string, error) {
+	allowed := make(map[string]bool, len(config.Fields))
+	for _, f := range config.Fields {
+		allowed[f] = true
+	}
+
+	fields := splitList(value)
+	for _, f := range fields {
+		if !allowed[f] {
+			return nil, fmt.Errorf("field %q is not selectable", f)
+		}
+	}
+	return fields, nil
+}
+
+// parseSorts validates a sort expression such as "-created_at,name"
+func parseSorts(config Config, raw string) ([]Sort, error) {
+	var sorts []Sort
+	for _, part := range splitList(raw) {
+		desc := strings.HasPrefix(part, "-")
+		field := strings.TrimPrefix(strings.TrimPrefix(part, "-"), "+")
+
+		column, ok := config.Sortable[field]
+		if !ok {
+			return nil, fmt.Errorf("sorting by %q is not allowed", field)
+		}
+		if column == "" {
+			column = field
+		}
+		sorts = append(sorts, Sort{Field: field, Column: column, Desc: desc})
+	}
+	return sorts, nil
+}
+
+// splitList splits a comma separated list, dropping blanks
+func splitList(value string) []string {
+	var result []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			result = append(result, part)
+		}
+	}
+	return result
+}
+
+// Apply adds filters, sorts and the sparse fieldset for the configured resource
+func (p *Params) Apply(db *gorm.DB) *gorm.DB {
+	db = p.ApplyFilters(db)
+
+	for _, s := range p.Sorts {
+		direction := "ASC"
+		if s.Desc {
+			direction = "DESC"
+		}
+		db = db.Order(fmt.Sprintf("%s %s", s.Column, direction))
+	}
+
+	if fields := p.SelectedFields(); len(fields) > 0 {
+		db = db.Select(fields)
+	}
+	return db
+}
+
+// ApplyFilters adds only the filter conditions, for use with Count
+func (p *Params) ApplyFilters(db *gorm.DB) *gorm.DB {
+	for _, f := range p.Filters {
+		switch f.Operator {
+		case OpIn:
+			db = db.Where(fmt.Sprintf("%s IN ?", f.Column), f.Values)
+		case OpNull:
+			db = db.Where(fmt.Sprintf("%s IS NULL", f.Column))
+		case OpNotNull:
+			db = db.Where(fmt.Sprintf("%s IS NOT NULL", f.Column))
+		case OpLike:
+			db = db.Where(fmt.Sprintf("%s LIKE ?", f.Column), "%"+f.Values[0]+"%")
+		default:
+			db = db.Where(fmt.Sprintf("%s %s ?", f.Column, sqlOperators[f.Operator]), f.Values[0])
+		}
+	}
+	return db
+}
+
+// Cursor converts the params into keyset pagination params. The first
+// sort directive becomes the cursor column.
+func (p *Params) Cursor() orm.CursorParams {
+	cursor := orm.CursorParams{
+		After:  p.After,
+		Before: p.Before,
+		Limit:  p.pageSize(),
+	}
+	if len(p.Sorts) > 0 {
+		cursor.OrderBy = p.Sorts[0].Column
+		cursor.Desc = p.Sorts[0].Desc
+	}
+	return cursor
+}
+
+// ApplyFiltersAndFields adds filters and the sparse fieldset but no ordering,
+// for use with cursor pagination which controls ordering itself. The cursor
+// column is always selected so cursors can be built from the rows.
+func (p *Params) ApplyFiltersAndFields(db *gorm.DB) *gorm.DB {
+	db = p.ApplyFilters(db)
+	fields := p.SelectedFields()
+	if len(fields) == 0 {
+		return db
+	}
+	if len(p.Sorts) > 0 {
+		column := p.Sorts[0].Column
+		selected := false
+		for _, f := range fields {
+			if f == column {
+				selected = true
+				break
+			}
+		}
+		if !selected {
+			fields = append(fields, column)
+		}
+	}
+	return db.Select(fields)
+}
+
+// Paginate applies offset and limit for the requested page
+func (p *Params) Paginate(db *gorm.DB) *gorm.DB {
+	size := p.pageSize()
+	return db.Offset((p.Page - 1) * size).Limit(size)
+}
+
+// pageSize returns PageSize capped at the configured maximum, so params
+// built or changed outside Parse can't ask for unbounded pages
+func (p *Params) pageSize() int {
+	limit := p.config.MaxPageSize
+	if limit <= 0 {
+		limit = 100
+	}
+	if p.PageSize > limit {
+		return limit
+	}
+	return p.PageSize
+}
+
+// SelectedFields returns the sparse fieldset for the configured resource,
+// always including the primary key
+func (p *Params) SelectedFields() []string {
+	fields, ok := p.Fields[p.config.Resource]
+	if !ok || len(fields) == 0 {
+		return nil
+	}
+	for _, f := range fields {
+		if f == p.config.PrimaryKey {
+			return fields
+		}
+	}
+	return append([]string{p.config.PrimaryKey}, fields...)
+}
@@ -0,0 +1,71 @@
+package query
+
+import (
+	"net/url"
+	"testing"
+)
+
+func testConfig() Config {
+	return Config{
+		Resource:   "users",
+		Filterable: map[string]string{"status": "", "age": ""},
+		Sortable:   map[string]string{"created_at": "", "name": ""},
+		Fields:     []string{"id", "name", "email"},
+	}
+}
+
+func TestParse(t *testing.T) {
+	values, _ := url.ParseQuery("filter[status]=active,pending&filter[age][gte]=18&sort=-created_at,name&fields[users]=name&page[size]=500")
+	params, err := Parse(values, testConfig())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(params.Filters) != 2 {
+		t.Fatalf("expected 2 filters, got %d", len(params.Filters))
+	}
+	if params.Filters[0].Operator != OpGte || params.Filters[1].Operator != OpIn {
+		t.Fatalf("unexpected operators: %+v", params.Filters)
+	}
+	if len(params.Sorts) != 2 || !params.Sorts[0].Desc || params.Sorts[1].Desc {
+		t.Fatalf("unexpected sorts: %+v", params.Sorts)
+	}
+	if params.PageSize != 100 {
+		t.Fatalf("expected page size to be capped at 100, got %d", params.PageSize)
+	}
+	if fields := params.SelectedFields(); len(fields) != 2 || fields[0] != "id" {
+		t.Fatalf("expected primary key to be selected, got %v", fields)
+	}
+}
+
+func TestParseRejectsUnlistedFields(t *testing.T) {
+	values, _ := url.ParseQuery("filter[password]=x&sort=secret&fields[users]=password")
+	_, err := Parse(values, testConfig())
+	qerr, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("expected *Error, got %v", err)
+	}
+	if len(qerr.Problems) != 3 {
+		t.Fatalf("expected 3 problems, got %v", qerr.Problems)
+	}
+}
+
+func TestCursorCapsThePageSize(t *testing.T) {
+	values, _ := url.ParseQuery("sort=-created_at")
+	params, err := Parse(values, testConfig())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	params.PageSize = 5000
+
+	cursor := params.Cursor()
+	if cursor.Limit != 100 {
+		t.Fatalf("expected the cursor limit to be capped at 100, got %d", cursor.Limit)
+	}
+	if cursor.OrderBy != "created_at" || !cursor.Desc {
+		t.Fatalf("unexpected cursor order: %+v", cursor)
+	}
+	if limit := (&Params{PageSize: 5000}).Cursor().Limit; limit != 100 {
+		t.Fatalf("expected params built by hand to be capped too, got %d", limit)
+	}
+}
@@ -0,0 +1,91 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mrhoseah/dolphin/internal/correlation"
+	"github.com/mrhoseah/dolphin/internal/events"
+	"github.com/mrhoseah/dolphin/internal/providers"
+)
+
+// EventJobType is the type of the jobs carrying queued events
+const EventJobType = "event"
+
+// eventQueue queues events as jobs on a driver, so events published
+// asynchronously survive restarts and are shared by every instance
+type eventQueue struct {
+	driver Driver
+	queue  string
+}
+
+// Events returns an event queue keeping events on the named queue of
+// driver, for events.NewEventBusWithQueue
+func Events(driver Driver, queue string) events.EventQueue {
+	return &eventQueue{driver: driver, queue: queue}
+}
+
+func (q *eventQueue) Push(ctx context.Context, event events.Event) error {
+	return q.driver.Push(q.queue, providers.Job{
+		ID:   event.GetID(),
+		Type: EventJobType,
+		Payload: map[string]interface{}{
+			"name":      event.GetName(),
+			"payload":   event.GetPayload(),
+			"timestamp": event.GetTimestamp().Format(time.RFC3339Nano),
+		},
+		Correlation: correlation.Capture(ctx),
+	})
+}
+
+func (q *eventQueue) Pop(ctx context.Context) (events.Event, error) {
+	job, err := q.driver.Pop(q.queue)
+	if err != nil {
+		return nil, err
+	}
+	return jobEvent(job)
+}
+
+func (q *eventQueue) Size(ctx context.Context) (int, error) {
+	return q.driver.Size(q.queue)
+}
+
+func (q *eventQueue) Clear(ctx context.Context) error {
+	return q.driver.Clear(q.queue)
+}
+
+// Process dispatches queued events until ctx is done, each with the
+// request it was pushed from restored. A dispatch error fails the job, so
+// it is retried like any other.
+func (q *eventQueue) Process(ctx context.Context, dispatcher events.EventDispatcher) error {
+	err := q.driver.Work(ctx, q.queue, func(job providers.Job) error {
+		event, err := jobEvent(job)
+		if err != nil {
+			return err
+		}
+		return correlation.Run(ctx, job.Correlation, "event "+event.GetName(), func(ctx context.Context) error {
+			return dispatcher.Dispatch(ctx, event)
+		})
+	})
+	if errors.Is(err, context.Canceled) {
+		return ctx.Err()
+	}
+	return err
+}
+
+// jobEvent reads the event a job carries
+func jobEvent(job providers.Job) (events.Event, error) {
+	name, _ := job.Payload["name"].(string)
+	if job.Type != EventJobType || name == "" {
+		return nil, fmt.Errorf("%w: job %s doesn't carry an event", ErrInvalidJob, job.ID)
+	}
+	event := events.NewBaseEventWithID(job.ID, name, job.Payload["payload"])
+	if timestamp, ok := job.Payload["timestamp"].(string); ok {
+		if parsed, err := time.Parse(time.RFC3339Nano, timestamp); err == nil {
+			event.Timestamp = parsed
+		}
+	}
+	return event, nil
+}
@@ -0,0 +1,363 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/providers"
+)
+
+const (
+	// kafkaV2 is the REST Proxy's content type for requests without
+	// records
+	kafkaV2 = "application/vnd.kafka.v2+json"
+
+	// kafkaJSON is its content type for JSON records
+	kafkaJSON = "application/vnd.kafka.json.v2+json"
+
+	// kafkaPollTimeout is how long a fetch waits for records, in
+	// milliseconds
+	kafkaPollTimeout = 1000
+)
+
+// KafkaQueue queues jobs on Kafka topics through a Confluent REST Proxy.
+// Workers consume in the connection's consumer group with automatic
+// commits off: a record's offset is committed once its job is done or has
+// failed every attempt, so a worker that dies mid-job leaves it to the
+// next.
+type KafkaQueue struct {
+	opts        options
+	url         string
+	username    string
+	password    string
+	offsetReset string
+	client      *http.Client
+	logger      *zap.Logger
+	now         func() time.Time
+
+	mu        sync.Mutex
+	consumers map[string]*kafkaConsumer
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// kafkaConsumer is a REST Proxy consumer instance subscribed to a topic,
+// with records fetched but not yet handed out
+type kafkaConsumer struct {
+	mu       sync.Mutex
+	baseURI  string
+	buffered []kafkaRecord
+}
+
+type kafkaRecord struct {
+	Topic     string          `json:"topic"`
+	Partition int             `json:"partition"`
+	Offset    int64           `json:"offset"`
+	Value     json.RawMessage `json:"value"`
+}
+
+// kafkaError is an error response of the REST Proxy
+type kafkaError struct {
+	Status    int
+	ErrorCode int    `json:"error_code"`
+	Message   string `json:"message"`
+}
+
+func (e *kafkaError) Error() string {
+	return fmt.Sprintf("queue: kafka rest proxy: %s (%d)", e.Message, e.ErrorCode)
+}
+
+// NewKafkaQueue creates a Kafka queue on the REST Proxy at
+// cfg.Kafka.RestURL. Nothing is sent until jobs are pushed or consumed.
+func NewKafkaQueue(cfg config.QueueConnectionConfig, logger *zap.Logger) (*KafkaQueue, error) {
+	if cfg.Kafka.RestURL == "" {
+		return nil, errors.New("queue: kafka.rest_url is required")
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	offsetReset := cfg.Kafka.OffsetReset
+	if offsetReset == "" {
+		offsetReset = "earliest"
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &KafkaQueue{
+		opts:        newOptions(cfg),
+		url:         strings.TrimSuffix(cfg.Kafka.RestURL, "/"),
+		username:    cfg.Kafka.Username,
+		password:    cfg.Kafka.Password,
+		offsetReset: offsetReset,
+		client:      &http.Client{Timeout: 30 * time.Second},
+		logger:      logger,
+		now:         time.Now,
+		consumers:   make(map[string]*kafkaConsumer),
+		ctx:         ctx,
+		cancel:      cancel,
+	}, nil
+}
+
+// call sends a request to the REST Proxy, decoding the response into out
+func (k *KafkaQueue) call(ctx context.Context, method, url, contentType string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return err
+	}
+	if method != http.MethodGet {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if out != nil {
+		req.Header.Set("Accept", contentType)
+	}
+	if k.username != "" {
+		req.SetBasicAuth(k.username, k.password)
+	}
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("queue: kafka rest proxy: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		kafkaErr := &kafkaError{Status: resp.StatusCode}
+		if json.NewDecoder(resp.Body).Decode(kafkaErr) != nil || kafkaErr.Message == "" {
+			kafkaErr.Message = resp.Status
+		}
+		return kafkaErr
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (k *KafkaQueue) Push(queue string, job providers.Job) error {
+	data, err := encodeJob(job, k.now())
+	if err != nil {
+		return err
+	}
+	record := map[string]interface{}{"value": json.RawMessage(data)}
+	if job.ID != "" {
+		// Jobs with the same ID go to the same partition, in order
+		record["key"] = job.ID
+	}
+	var response struct {
+		Offsets []struct {
+			Error string `json:"error"`
+		} `json:"offsets"`
+	}
+	err = k.call(context.Background(), http.MethodPost, k.url+"/topics/"+k.opts.topic(queue), kafkaJSON,
+		map[string]interface{}{"records": []interface{}{record}}, &response)
+	if err != nil {
+		return err
+	}
+	for _, offset := range response.Offsets {
+		if offset.Error != "" {
+			return fmt.Errorf("queue: kafka: %s", offset.Error)
+		}
+	}
+	return nil
+}
+
+// consumer returns the consumer instance reading queue's topic, creating
+// and subscribing it the first time
+func (k *KafkaQueue) consumer(ctx context.Context, queue string) (*kafkaConsumer, error) {
+	topic := k.opts.topic(queue)
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if c, ok := k.consumers[topic]; ok {
+		return c, nil
+	}
+
+	var created struct {
+		BaseURI string `json:"base_uri"`
+	}
+	err := k.call(ctx, http.MethodPost, k.url+"/consumers/"+k.opts.group, kafkaV2, map[string]string{
+		"name":               sanitize(topic) + "-" + uuid.NewString(),
+		"format":             "json",
+		"auto.offset.reset":  k.offsetReset,
+		"auto.commit.enable": "false",
+	}, &created)
+	if err != nil {
+		return nil, err
+	}
+	err = k.call(ctx, http.MethodPost, created.BaseURI+"/subscription", kafkaV2, map[string][]string{"topics": {topic}}, nil)
+	if err != nil {
+		k.call(context.Background(), http.MethodDelete, created.BaseURI, kafkaV2, nil, nil)
+		return nil, err
+	}
+	c := &kafkaConsumer{baseURI: created.BaseURI}
+	k.consumers[topic] = c
+	return c, nil
+}
+
+// drop forgets a consumer instance the proxy no longer knows, such as one
+// removed after being idle, so the next fetch creates another
+func (k *KafkaQueue) drop(queue string, c *kafkaConsumer) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.consumers[k.opts.topic(queue)] == c {
+		delete(k.consumers, k.opts.topic(queue))
+	}
+}
+
+// next returns the next record of queue's topic, fetching more when none
+// are buffered; ok is false when none arrived
+func (k *KafkaQueue) next(ctx context.Context, queue string) (c *kafkaConsumer, record kafkaRecord, ok bool, err error) {
+	c, err = k.consumer(ctx, queue)
+	if err != nil {
+		return nil, record, false, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.buffered) == 0 {
+		var records []kafkaRecord
+		err := k.call(ctx, http.MethodGet, fmt.Sprintf("%s/records?timeout=%d", c.baseURI, kafkaPollTimeout), kafkaJSON, nil, &records)
+		var kafkaErr *kafkaError
+		if errors.As(err, &kafkaErr) && kafkaErr.Status == http.StatusNotFound {
+			k.drop(queue, c)
+		}
+		if err != nil {
+			return nil, record, false, err
+		}
+		c.buffered = records
+	}
+	if len(c.buffered) == 0 {
+		return c, record, false, nil
+	}
+	record, c.buffered = c.buffered[0], c.buffered[1:]
+	return c, record, true, nil
+}
+
+// commit records that the group is done with record
+func (k *KafkaQueue) commit(c *kafkaConsumer, record kafkaRecord) error {
+	return k.call(context.Background(), http.MethodPost, c.baseURI+"/offsets", kafkaV2, map[string]interface{}{
+		"offsets": []map[string]interface{}{{"topic": record.Topic, "partition": record.Partition, "offset": record.Offset}},
+	}, nil)
+}
+
+func (k *KafkaQueue) Pop(queue string) (providers.Job, error) {
+	c, record, ok, err := k.next(context.Background(), queue)
+	if err != nil {
+		return providers.Job{}, err
+	}
+	if !ok {
+		return providers.Job{}, ErrEmpty
+	}
+	if err := k.commit(c, record); err != nil {
+		return providers.Job{}, err
+	}
+	e, err := decodeJob(record.Value)
+	if err != nil {
+		return providers.Job{}, err
+	}
+	e.Attempts = 1
+	return e.Job, nil
+}
+
+// Work handles the records of queue's topic in order. A failed job is
+// retried in place, since a partition can't skip ahead of it, so keep
+// max_attempts and backoff small for queues that must keep moving.
+func (k *KafkaQueue) Work(ctx context.Context, queue string, handler providers.JobHandler) error {
+	for ctx.Err() == nil {
+		c, record, ok, err := k.next(ctx, queue)
+		if err != nil {
+			if ctx.Err() == nil {
+				k.logger.Warn("Failed to fetch jobs", zap.String("queue", queue), zap.Error(err))
+				sleep(ctx, time.Second)
+			}
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		e, err := decodeJob(record.Value)
+		if err != nil {
+			k.logger.Error("Dropping undecodable job", zap.String("queue", queue), zap.Int64("offset", record.Offset), zap.Error(err))
+		} else if !k.handle(ctx, queue, e, handler) {
+			// Stopped mid-job; the record is left for the group
+			return ctx.Err()
+		}
+		if err := k.commit(c, record); err != nil {
+			k.logger.Warn("Failed to commit offset", zap.String("queue", queue), zap.Int64("offset", record.Offset), zap.Error(err))
+		}
+	}
+	return ctx.Err()
+}
+
+// handle runs a job until it succeeds or fails every attempt, reporting
+// false when ctx was done first
+func (k *KafkaQueue) handle(ctx context.Context, queue string, e envelope, handler providers.JobHandler) bool {
+	if !sleep(ctx, e.AvailableAt.Sub(k.now())) {
+		return false
+	}
+	for attempt := 1; ; attempt++ {
+		e.Attempts = attempt
+		err := handler(e.Job)
+		if err == nil {
+			return true
+		}
+		if attempt >= k.opts.maxAttempts {
+			failed(k.logger, queue, e.Job, err)
+			return true
+		}
+		if !sleep(ctx, k.opts.retryDelay(attempt)) {
+			return false
+		}
+	}
+}
+
+func (k *KafkaQueue) Process(queue string, handler providers.JobHandler) error {
+	if err := k.Work(k.ctx, queue, handler); !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
+
+// Size isn't available through the REST Proxy; use consumer lag metrics
+func (k *KafkaQueue) Size(queue string) (int, error) {
+	return 0, fmt.Errorf("queue: kafka: size: %w", errors.ErrUnsupported)
+}
+
+// Clear isn't available through the REST Proxy; topics keep records for
+// their retention
+func (k *KafkaQueue) Clear(queue string) error {
+	return fmt.Errorf("queue: kafka: clear: %w", errors.ErrUnsupported)
+}
+
+// Close stops the workers and deletes the consumer instances, so the
+// group rebalances their partitions at once
+func (k *KafkaQueue) Close() error {
+	k.cancel()
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	var errs []error
+	for topic, c := range k.consumers {
+		if err := k.call(context.Background(), http.MethodDelete, c.baseURI, kafkaV2, nil, nil); err != nil {
+			errs = append(errs, err)
+		}
+		delete(k.consumers, topic)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,223 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/providers"
+)
+
+// fakeRestProxy is a Kafka REST Proxy with single-partition topics
+type fakeRestProxy struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	records   map[string][]kafkaRecord
+	keys      []string
+	committed map[string]int64
+	instances map[string]*fakeInstance
+	created   []map[string]string
+}
+
+type fakeInstance struct {
+	group    string
+	topic    string
+	position int64
+}
+
+func newFakeRestProxy(t *testing.T) *fakeRestProxy {
+	p := &fakeRestProxy{
+		records:   make(map[string][]kafkaRecord),
+		committed: make(map[string]int64),
+		instances: make(map[string]*fakeInstance),
+	}
+	p.Server = httptest.NewServer(http.HandlerFunc(p.serve))
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *fakeRestProxy) serve(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if user, password, _ := r.BasicAuth(); user != "app" || password != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error_code": 40101, "message": "unauthorized"})
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	var body map[string]json.RawMessage
+	json.NewDecoder(r.Body).Decode(&body)
+
+	switch {
+	case r.Method == http.MethodPost && len(parts) == 2 && parts[0] == "topics":
+		if r.Header.Get("Content-Type") != kafkaJSON {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		var records []struct {
+			Key   string          `json:"key"`
+			Value json.RawMessage `json:"value"`
+		}
+		json.Unmarshal(body["records"], &records)
+		var offsets []map[string]interface{}
+		for _, record := range records {
+			offset := int64(len(p.records[parts[1]]))
+			p.records[parts[1]] = append(p.records[parts[1]], kafkaRecord{Topic: parts[1], Offset: offset, Value: record.Value})
+			p.keys = append(p.keys, record.Key)
+			offsets = append(offsets, map[string]interface{}{"partition": 0, "offset": offset})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"offsets": offsets})
+	case r.Method == http.MethodPost && len(parts) == 2 && parts[0] == "consumers":
+		settings := map[string]string{}
+		for key, value := range body {
+			var s string
+			json.Unmarshal(value, &s)
+			settings[key] = s
+		}
+		p.created = append(p.created, settings)
+		p.instances[settings["name"]] = &fakeInstance{group: parts[1]}
+		json.NewEncoder(w).Encode(map[string]string{
+			"instance_id": settings["name"],
+			"base_uri":    p.URL + "/consumers/" + parts[1] + "/instances/" + settings["name"],
+		})
+	case len(parts) >= 4 && parts[0] == "consumers":
+		instance, ok := p.instances[parts[3]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error_code": 40403, "message": "Consumer instance not found."})
+			return
+		}
+		switch {
+		case r.Method == http.MethodDelete:
+			delete(p.instances, parts[3])
+			w.WriteHeader(http.StatusNoContent)
+		case parts[len(parts)-1] == "subscription":
+			var topics []string
+			json.Unmarshal(body["topics"], &topics)
+			instance.topic = topics[0]
+			instance.position = p.committed[instance.group+"/"+instance.topic]
+			w.WriteHeader(http.StatusNoContent)
+		case parts[len(parts)-1] == "records":
+			records := p.records[instance.topic]
+			fetched := []kafkaRecord{}
+			if instance.position < int64(len(records)) {
+				fetched = records[instance.position:]
+				instance.position = int64(len(records))
+			}
+			json.NewEncoder(w).Encode(fetched)
+		case parts[len(parts)-1] == "offsets":
+			var offsets []kafkaRecord
+			json.Unmarshal(body["offsets"], &offsets)
+			for _, offset := range offsets {
+				p.committed[instance.group+"/"+offset.Topic] = offset.Offset + 1
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (p *fakeRestProxy) queue(t *testing.T) *KafkaQueue {
+	q, err := NewKafkaQueue(config.QueueConnectionConfig{
+		Topics:      map[string]string{"orders": "shop.orders"},
+		Group:       "workers",
+		MaxAttempts: 2,
+		Backoff:     time.Millisecond,
+		Kafka:       config.KafkaQueueConfig{RestURL: p.URL + "/", Username: "app", Password: "secret"},
+	}, nil)
+	require.NoError(t, err)
+	return q
+}
+
+func TestKafkaQueue(t *testing.T) {
+	proxy := newFakeRestProxy(t)
+	q := proxy.queue(t)
+
+	require.NoError(t, q.Push("orders", providers.Job{ID: "1", Type: "order.ship"}))
+	require.NoError(t, q.Push("orders", providers.Job{ID: "2", Type: "order.ship", Delay: time.Hour}))
+	assert.Len(t, proxy.records["shop.orders"], 2)
+	assert.Equal(t, []string{"1", "2"}, proxy.keys)
+
+	job, err := q.Pop("orders")
+	require.NoError(t, err)
+	assert.Equal(t, "1", job.ID)
+	assert.Equal(t, int64(1), proxy.committed["workers/shop.orders"])
+	require.Len(t, proxy.created, 1)
+	assert.Equal(t, "false", proxy.created[0]["auto.commit.enable"])
+	assert.Equal(t, "earliest", proxy.created[0]["auto.offset.reset"])
+
+	_, err = q.Size("orders")
+	assert.ErrorIs(t, err, errors.ErrUnsupported)
+	assert.ErrorIs(t, q.Clear("orders"), errors.ErrUnsupported)
+
+	// Closing deletes the consumer instances, and a new one resumes from
+	// the group's committed offset
+	require.NoError(t, q.Close())
+	assert.Empty(t, proxy.instances)
+	q = proxy.queue(t)
+	defer q.Close()
+	job, err = q.Pop("orders")
+	require.NoError(t, err)
+	assert.Equal(t, "2", job.ID)
+	_, err = q.Pop("orders")
+	assert.ErrorIs(t, err, ErrEmpty)
+
+	// An instance the proxy dropped is recreated
+	proxy.mu.Lock()
+	proxy.instances = map[string]*fakeInstance{}
+	proxy.mu.Unlock()
+	_, err = q.Pop("orders")
+	var kafkaErr *kafkaError
+	require.ErrorAs(t, err, &kafkaErr)
+	assert.Equal(t, http.StatusNotFound, kafkaErr.Status)
+	_, err = q.Pop("orders")
+	assert.ErrorIs(t, err, ErrEmpty)
+}
+
+func TestKafkaQueueWork(t *testing.T) {
+	proxy := newFakeRestProxy(t)
+	q := proxy.queue(t)
+	defer q.Close()
+
+	require.NoError(t, q.Push("default", providers.Job{ID: "flaky"}))
+	require.NoError(t, q.Push("default", providers.Job{ID: "broken"}))
+	require.NoError(t, q.Push("default", providers.Job{ID: "done"}))
+
+	var calls []string
+	var attempts []int
+	work(t, q, "default", 5, func(job providers.Job) error {
+		calls = append(calls, job.ID)
+		attempts = append(attempts, job.Attempts)
+		if job.ID == "flaky" && job.Attempts == 1 || job.ID == "broken" {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	// Failed jobs are retried in place, keeping the partition's order
+	assert.Equal(t, []string{"flaky", "flaky", "broken", "broken", "done"}, calls)
+	assert.Equal(t, []int{1, 2, 1, 2, 1}, attempts)
+	proxy.mu.Lock()
+	defer proxy.mu.Unlock()
+	assert.Equal(t, int64(3), proxy.committed["workers/jobs.default"])
+}
+
+func TestKafkaErrors(t *testing.T) {
+	proxy := newFakeRestProxy(t)
+	q, err := NewKafkaQueue(config.QueueConnectionConfig{Kafka: config.KafkaQueueConfig{RestURL: proxy.URL}}, nil)
+	require.NoError(t, err)
+	defer q.Close()
+
+	err = q.Push("default", providers.Job{ID: "1"})
+	assert.EqualError(t, err, "queue: kafka rest proxy: unauthorized (40101)")
+}
@@ -0,0 +1,163 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/providers"
+)
+
+// Manager opens the configured queue connections as they are first used
+// and checks jobs against the validators registered for their type
+type Manager struct {
+	cfg    config.QueueConfig
+	logger *zap.Logger
+
+	mu          sync.RWMutex
+	connections map[string]Driver
+	validators  map[string]Validator
+}
+
+// NewManager creates a manager for the queue config, loading the schemas
+// in cfg.Schemas
+func NewManager(cfg config.QueueConfig, logger *zap.Logger) (*Manager, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	m := &Manager{
+		cfg:         cfg,
+		logger:      logger,
+		connections: make(map[string]Driver),
+		validators:  make(map[string]Validator),
+	}
+	if cfg.Schemas != "" {
+		validators, err := LoadSchemas(cfg.Schemas)
+		if err != nil {
+			return nil, err
+		}
+		for jobType, validator := range validators {
+			m.Validate(jobType, validator)
+		}
+	}
+	return m, nil
+}
+
+// Validate has jobs of jobType checked by validator when pushed, and again
+// before they are handled. Invalid jobs are refused with ErrInvalidJob,
+// and those already queued are dropped and logged rather than retried.
+func (m *Manager) Validate(jobType string, validator Validator) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.validators[jobType] = validator
+}
+
+// check runs the validator of job's type, if any
+func (m *Manager) check(job providers.Job) error {
+	m.mu.RLock()
+	validator, ok := m.validators[job.Type]
+	m.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	if err := validator(job); err != nil {
+		return fmt.Errorf("%w %s: %v", ErrInvalidJob, job.Type, err)
+	}
+	return nil
+}
+
+// Connection returns the named connection, or the default one when name
+// is empty, connecting the first time
+func (m *Manager) Connection(name string) (Driver, error) {
+	if name == "" {
+		name = m.cfg.Default
+	}
+	m.mu.RLock()
+	driver, ok := m.connections[name]
+	m.mu.RUnlock()
+	if ok {
+		return driver, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if driver, ok := m.connections[name]; ok {
+		return driver, nil
+	}
+	cfg, ok := m.cfg.Connections[name]
+	if !ok {
+		return nil, fmt.Errorf("queue: no connection named %q", name)
+	}
+	opened, err := Open(cfg, m.logger.With(zap.String("connection", name)))
+	if err != nil {
+		return nil, fmt.Errorf("queue connection %s: %w", name, err)
+	}
+	driver = &validated{Driver: opened, manager: m, logger: m.logger}
+	m.connections[name] = driver
+	return driver, nil
+}
+
+// ConnectionNames returns the names of the configured connections, sorted
+func (m *Manager) ConnectionNames() []string {
+	names := make([]string, 0, len(m.cfg.Connections))
+	for name := range m.cfg.Connections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Close closes the connections opened
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var errs []error
+	for name, driver := range m.connections {
+		if err := driver.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		delete(m.connections, name)
+	}
+	return errors.Join(errs...)
+}
+
+// validated checks the jobs of a driver with the manager's validators
+type validated struct {
+	Driver
+	manager *Manager
+	logger  *zap.Logger
+}
+
+func (v *validated) Push(queue string, job providers.Job) error {
+	if err := v.manager.check(job); err != nil {
+		return err
+	}
+	return v.Driver.Push(queue, job)
+}
+
+func (v *validated) Work(ctx context.Context, queue string, handler providers.JobHandler) error {
+	return v.Driver.Work(ctx, queue, v.wrap(queue, handler))
+}
+
+func (v *validated) Process(queue string, handler providers.JobHandler) error {
+	return v.Driver.Process(queue, v.wrap(queue, handler))
+}
+
+// wrap drops the jobs failing their validator before handler sees them
+func (v *validated) wrap(queue string, handler providers.JobHandler) providers.JobHandler {
+	return func(job providers.Job) error {
+		if err := v.manager.check(job); err != nil {
+			v.logger.Error("Dropping invalid job",
+				zap.String("queue", queue),
+				zap.String("id", job.ID),
+				zap.Error(err))
+			return nil
+		}
+		return handler(job)
+	}
+}
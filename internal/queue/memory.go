@@ -0,0 +1,131 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/providers"
+)
+
+// memoryPoll is how often an idle memory worker looks for jobs
+const memoryPoll = 50 * time.Millisecond
+
+// MemoryQueue keeps jobs in the process, for development, tests and
+// single instances. Jobs are lost when the process exits.
+type MemoryQueue struct {
+	opts   options
+	logger *zap.Logger
+	now    func() time.Time
+
+	mu   sync.Mutex
+	jobs map[string][]envelope
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewMemoryQueue creates an empty in-process queue
+func NewMemoryQueue(cfg config.QueueConnectionConfig, logger *zap.Logger) *MemoryQueue {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &MemoryQueue{
+		opts:   newOptions(cfg),
+		logger: logger,
+		now:    time.Now,
+		jobs:   make(map[string][]envelope),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+func (q *MemoryQueue) Push(queue string, job providers.Job) error {
+	e := envelope{Job: job}
+	if job.Delay > 0 {
+		e.AvailableAt = q.now().Add(job.Delay)
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.jobs[queue] = append(q.jobs[queue], e)
+	return nil
+}
+
+func (q *MemoryQueue) Pop(queue string) (providers.Job, error) {
+	e, ok := q.take(queue)
+	if !ok {
+		return providers.Job{}, ErrEmpty
+	}
+	e.Attempts++
+	return e.Job, nil
+}
+
+// take removes the first job of queue that is due
+func (q *MemoryQueue) take(queue string) (envelope, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := q.now()
+	for i, e := range q.jobs[queue] {
+		if !e.AvailableAt.After(now) {
+			q.jobs[queue] = append(q.jobs[queue][:i:i], q.jobs[queue][i+1:]...)
+			return e, true
+		}
+	}
+	return envelope{}, false
+}
+
+func (q *MemoryQueue) Work(ctx context.Context, queue string, handler providers.JobHandler) error {
+	for {
+		e, ok := q.take(queue)
+		if !ok {
+			if !sleep(ctx, memoryPoll) {
+				return ctx.Err()
+			}
+			continue
+		}
+
+		e.Attempts++
+		err := handler(e.Job)
+		if err == nil {
+			continue
+		}
+		if e.Attempts >= q.opts.maxAttempts {
+			failed(q.logger, queue, e.Job, err)
+			continue
+		}
+		e.AvailableAt = q.now().Add(q.opts.retryDelay(e.Attempts))
+		q.mu.Lock()
+		q.jobs[queue] = append(q.jobs[queue], e)
+		q.mu.Unlock()
+	}
+}
+
+func (q *MemoryQueue) Process(queue string, handler providers.JobHandler) error {
+	if err := q.Work(q.ctx, queue, handler); !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
+
+func (q *MemoryQueue) Size(queue string) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.jobs[queue]), nil
+}
+
+func (q *MemoryQueue) Clear(queue string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.jobs, queue)
+	return nil
+}
+
+func (q *MemoryQueue) Close() error {
+	q.cancel()
+	return nil
+}
@@ -0,0 +1,345 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/providers"
+)
+
+const (
+	defaultStream  = "JOBS"
+	defaultAckWait = 30 * time.Second
+
+	// natsRequestTimeout bounds JetStream API calls
+	natsRequestTimeout = 5 * time.Second
+
+	// natsPullWait is how long a worker's pull request waits for a job
+	natsPullWait = 5 * time.Second
+
+	// jsStreamNotFound is JetStream's error code for a missing stream
+	jsStreamNotFound = 10059
+)
+
+// NATSQueue queues jobs on a NATS JetStream stream. Each queue is a
+// subject, read by a durable pull consumer per consumer group, so jobs are
+// kept until a worker acknowledges them and resume where the group left
+// off.
+type NATSQueue struct {
+	opts    options
+	stream  string
+	ackWait time.Duration
+	conn    *natsConn
+	logger  *zap.Logger
+	now     func() time.Time
+
+	mu        sync.Mutex
+	consumers map[string]bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// jsError is the error of a JetStream API response
+type jsError struct {
+	Code        int    `json:"code"`
+	ErrCode     int    `json:"err_code"`
+	Description string `json:"description"`
+}
+
+func (e *jsError) Error() string {
+	return fmt.Sprintf("queue: jetstream: %s (%d)", e.Description, e.ErrCode)
+}
+
+// NewNATSQueue connects to the NATS server and creates the stream when it
+// is missing
+func NewNATSQueue(cfg config.QueueConnectionConfig, logger *zap.Logger) (*NATSQueue, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	conn, err := dialNATS(cfg.NATS, logger)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &NATSQueue{
+		opts:      newOptions(cfg),
+		stream:    cfg.NATS.Stream,
+		ackWait:   cfg.NATS.AckWait,
+		conn:      conn,
+		logger:    logger,
+		now:       time.Now,
+		consumers: make(map[string]bool),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+	if q.stream == "" {
+		q.stream = defaultStream
+	}
+	if q.ackWait <= 0 {
+		q.ackWait = defaultAckWait
+	}
+	if err := q.ensureStream(); err != nil {
+		q.Close()
+		return nil, err
+	}
+	return q, nil
+}
+
+// api calls a JetStream API subject, decoding the response into out
+func (q *NATSQueue) api(subject string, request, out interface{}) error {
+	var data []byte
+	if request != nil {
+		data, _ = json.Marshal(request)
+	}
+	msg, err := q.conn.request("$JS.API."+subject, data, natsRequestTimeout)
+	if err != nil {
+		return err
+	}
+	var response struct {
+		Error *jsError `json:"error"`
+	}
+	if err := json.Unmarshal(msg.Data, &response); err != nil {
+		return fmt.Errorf("queue: jetstream: %w", err)
+	}
+	if response.Error != nil {
+		return response.Error
+	}
+	if out != nil {
+		return json.Unmarshal(msg.Data, out)
+	}
+	return nil
+}
+
+// ensureStream creates the stream, holding the prefix's subjects and the
+// configured topics, unless it exists
+func (q *NATSQueue) ensureStream() error {
+	err := q.api("STREAM.INFO."+q.stream, nil, nil)
+	var jsErr *jsError
+	if !errors.As(err, &jsErr) || jsErr.ErrCode != jsStreamNotFound {
+		return err
+	}
+
+	subjects := []string{q.opts.prefix + ">"}
+	for _, topic := range q.opts.topics {
+		if !strings.HasPrefix(topic, q.opts.prefix) {
+			subjects = append(subjects, topic)
+		}
+	}
+	return q.api("STREAM.CREATE."+q.stream, map[string]interface{}{
+		"name":      q.stream,
+		"subjects":  subjects,
+		"storage":   "file",
+		"retention": "limits",
+	}, nil)
+}
+
+// consumer returns the durable consumer of the connection's group on
+// queue, creating it the first time
+func (q *NATSQueue) consumer(queue string) (string, error) {
+	name := sanitize(q.opts.group + "_" + queue)
+	q.mu.Lock()
+	ready := q.consumers[name]
+	q.mu.Unlock()
+	if ready {
+		return name, nil
+	}
+
+	err := q.api("CONSUMER.DURABLE.CREATE."+q.stream+"."+name, map[string]interface{}{
+		"stream_name": q.stream,
+		"config": map[string]interface{}{
+			"durable_name":    name,
+			"deliver_policy":  "all",
+			"ack_policy":      "explicit",
+			"ack_wait":        q.ackWait.Nanoseconds(),
+			"filter_subject":  q.opts.topic(queue),
+			"max_ack_pending": 1000,
+		},
+	}, nil)
+	if err != nil {
+		return "", err
+	}
+	q.mu.Lock()
+	q.consumers[name] = true
+	q.mu.Unlock()
+	return name, nil
+}
+
+func (q *NATSQueue) Push(queue string, job providers.Job) error {
+	data, err := encodeJob(job, q.now())
+	if err != nil {
+		return err
+	}
+	msg, err := q.conn.request(q.opts.topic(queue), data, natsRequestTimeout)
+	if err != nil {
+		return err
+	}
+	var ack struct {
+		Error *jsError `json:"error"`
+	}
+	if err := json.Unmarshal(msg.Data, &ack); err != nil {
+		return fmt.Errorf("queue: jetstream: %w", err)
+	}
+	if ack.Error != nil {
+		return ack.Error
+	}
+	return nil
+}
+
+// fetch pulls the next message of queue's consumer, waiting up to wait.
+// It returns nil when none arrived.
+func (q *NATSQueue) fetch(queue string, wait time.Duration) (*natsMsg, error) {
+	name, err := q.consumer(queue)
+	if err != nil {
+		return nil, err
+	}
+	request, _ := json.Marshal(map[string]interface{}{"batch": 1, "expires": wait.Nanoseconds()})
+	msg, err := q.conn.request("$JS.API.CONSUMER.MSG.NEXT."+q.stream+"."+name, request, wait+natsRequestTimeout)
+	if err != nil {
+		return nil, err
+	}
+	switch msg.Status {
+	case "":
+		return msg, nil
+	case "404", "408", "409":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("queue: jetstream: pull failed with status %s", msg.Status)
+	}
+}
+
+// ack answers a message: +ACK when done, -NAK to redeliver it, with a
+// delay, or +TERM to drop it
+func (q *NATSQueue) ack(msg *natsMsg, answer string, delay time.Duration) error {
+	data := []byte(answer)
+	if answer == "-NAK" && delay > 0 {
+		data = fmt.Appendf(nil, `-NAK {"delay":%d}`, delay.Nanoseconds())
+	}
+	return q.conn.publish(msg.Reply, "", data)
+}
+
+func (q *NATSQueue) Pop(queue string) (providers.Job, error) {
+	msg, err := q.fetch(queue, time.Second)
+	if err != nil {
+		return providers.Job{}, err
+	}
+	if msg == nil {
+		return providers.Job{}, ErrEmpty
+	}
+	e, err := decodeJob(msg.Data)
+	if err != nil {
+		q.ack(msg, "+TERM", 0)
+		return providers.Job{}, err
+	}
+	e.Attempts = deliveries(msg.Reply)
+	return e.Job, q.ack(msg, "+ACK", 0)
+}
+
+func (q *NATSQueue) Work(ctx context.Context, queue string, handler providers.JobHandler) error {
+	for ctx.Err() == nil {
+		msg, err := q.fetch(queue, natsPullWait)
+		if err != nil {
+			// A connection closed or given up won't come back
+			if errors.Is(err, errNATSClosed) {
+				return err
+			}
+			q.logger.Warn("Failed to fetch jobs", zap.String("queue", queue), zap.Error(err))
+			sleep(ctx, time.Second)
+			continue
+		}
+		if msg == nil {
+			continue
+		}
+
+		e, err := decodeJob(msg.Data)
+		if err != nil {
+			q.logger.Error("Dropping undecodable job", zap.String("queue", queue), zap.Error(err))
+			q.ack(msg, "+TERM", 0)
+			continue
+		}
+		// A delayed job is put back until it is due, which counts as
+		// a delivery
+		if wait := e.AvailableAt.Sub(q.now()); wait > 0 {
+			q.ack(msg, "-NAK", wait)
+			continue
+		}
+		e.Attempts = deliveries(msg.Reply)
+		if !e.AvailableAt.IsZero() && e.Attempts > 1 {
+			e.Attempts--
+		}
+
+		err = handler(e.Job)
+		switch {
+		case err == nil:
+			q.ack(msg, "+ACK", 0)
+		case e.Attempts >= q.opts.maxAttempts:
+			failed(q.logger, queue, e.Job, err)
+			q.ack(msg, "+TERM", 0)
+		default:
+			q.ack(msg, "-NAK", q.opts.retryDelay(e.Attempts))
+		}
+	}
+	return ctx.Err()
+}
+
+// deliveries reads how many times a message has been delivered from its
+// ack subject: $JS.ACK.<stream>.<consumer>.<delivered>.<stream seq>...,
+// or with a domain and account hash after ACK on newer servers
+func deliveries(reply string) int {
+	tokens := strings.Split(reply, ".")
+	index := 4
+	if len(tokens) >= 12 {
+		index = 6
+	}
+	if len(tokens) <= index {
+		return 1
+	}
+	n, err := strconv.Atoi(tokens[index])
+	if err != nil || n < 1 {
+		return 1
+	}
+	return n
+}
+
+func (q *NATSQueue) Process(queue string, handler providers.JobHandler) error {
+	if err := q.Work(q.ctx, queue, handler); !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
+
+// Size is the number of the queue's jobs its consumer group hasn't
+// finished, waiting or being handled
+func (q *NATSQueue) Size(queue string) (int, error) {
+	name, err := q.consumer(queue)
+	if err != nil {
+		return 0, err
+	}
+	var info struct {
+		NumPending    int `json:"num_pending"`
+		NumAckPending int `json:"num_ack_pending"`
+	}
+	if err := q.api("CONSUMER.INFO."+q.stream+"."+name, nil, &info); err != nil {
+		return 0, err
+	}
+	return info.NumPending + info.NumAckPending, nil
+}
+
+// Clear purges the queue's jobs from the stream, for every group
+func (q *NATSQueue) Clear(queue string) error {
+	return q.api("STREAM.PURGE."+q.stream, map[string]string{"filter": q.opts.topic(queue)}, nil)
+}
+
+func (q *NATSQueue) Close() error {
+	q.cancel()
+	return q.conn.close()
+}
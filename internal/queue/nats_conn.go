@@ -0,0 +1,514 @@
+package queue
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+// natsDialTimeout bounds connecting and the handshake
+const natsDialTimeout = 5 * time.Second
+
+const (
+	// natsReconnectWait is the wait before the first attempt to reconnect,
+	// doubling after each failed one up to natsMaxReconnectWait
+	natsReconnectWait    = 250 * time.Millisecond
+	natsMaxReconnectWait = 5 * time.Second
+
+	// natsMaxReconnects is how many attempts are made by default before
+	// the connection is given up
+	natsMaxReconnects = 60
+)
+
+// errNATSClosed is returned by requests on a closed connection, and one
+// given up after failing to reconnect
+var errNATSClosed = errors.New("queue: nats connection closed")
+
+// natsMsg is a message delivered to the connection's inbox
+type natsMsg struct {
+	Subject string
+	Reply   string
+
+	// Status is the code of a status message sent in place of a reply,
+	// such as 404 when a pull request found no messages
+	Status string
+	Data   []byte
+}
+
+// natsConn speaks as much of the NATS protocol as JetStream's API needs:
+// publishing, and requests answered on a wildcard inbox subscription. It
+// reconnects with backoff when the connection drops, over TLS when the
+// config or the server asks for it.
+type natsConn struct {
+	address       string
+	options       map[string]interface{}
+	tls           *tls.Config
+	requireTLS    bool
+	maxReconnects int
+	logger        *zap.Logger
+	inbox         string
+
+	wmu sync.Mutex
+	w   *bufio.Writer
+
+	mu      sync.Mutex
+	conn    net.Conn
+	replies map[string]chan *natsMsg
+
+	// down is why the connection dropped, nil once reconnected, and
+	// dropped is closed when the current connection drops
+	down    error
+	dropped chan struct{}
+
+	// err is set for good once the connection is closed or given up
+	err    error
+	closed chan struct{}
+}
+
+// dialNATS connects and authenticates to the server at cfg.URL
+func dialNATS(cfg config.NATSQueueConfig, logger *zap.Logger) (*natsConn, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	address, auth, err := natsAddress(cfg)
+	if err != nil {
+		return nil, err
+	}
+	host, _, _ := net.SplitHostPort(address)
+	tlsConfig, err := natsTLS(cfg, host)
+	if err != nil {
+		return nil, err
+	}
+
+	token := make([]byte, 8)
+	rand.Read(token)
+	c := &natsConn{
+		address:       address,
+		tls:           tlsConfig,
+		requireTLS:    cfg.TLS || cfg.CAFile != "" || strings.HasPrefix(cfg.URL, "tls://"),
+		maxReconnects: cfg.MaxReconnects,
+		logger:        logger,
+		inbox:         "_INBOX." + hex.EncodeToString(token) + ".",
+		replies:       make(map[string]chan *natsMsg),
+		closed:        make(chan struct{}),
+		options: map[string]interface{}{
+			"verbose": false, "pedantic": false, "headers": true, "no_responders": true,
+			"lang": "go", "version": "dolphin", "name": "dolphin-queue",
+		},
+	}
+	if c.maxReconnects == 0 {
+		c.maxReconnects = natsMaxReconnects
+	}
+	for key, value := range auth {
+		c.options[key] = value
+	}
+
+	r, err := c.connect()
+	if err != nil {
+		return nil, err
+	}
+	go c.run(r)
+	return c, nil
+}
+
+// natsTLS returns the TLS config of connections to host, trusting
+// cfg.CAFile besides the system's CAs
+func natsTLS(cfg config.NATSQueueConfig, host string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("queue: reading the nats ca_file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("queue: nats ca_file %s holds no certificates", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+// connect dials the server, upgrading to TLS when required, and
+// subscribes the inbox, returning the reader of the new connection
+func (c *natsConn) connect() (*bufio.Reader, error) {
+	conn, err := net.DialTimeout("tcp", c.address, natsDialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("queue: connecting to nats: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(natsDialTimeout))
+
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "INFO ") {
+		conn.Close()
+		return nil, fmt.Errorf("queue: %s is not a nats server", c.address)
+	}
+	var info struct {
+		TLSRequired  bool `json:"tls_required"`
+		TLSAvailable bool `json:"tls_available"`
+	}
+	json.Unmarshal([]byte(line[len("INFO "):]), &info)
+
+	// Credentials go over TLS when the server offers it and the config
+	// asks for it, or when the server requires it
+	options := c.options
+	if c.requireTLS || info.TLSRequired {
+		if !info.TLSRequired && !info.TLSAvailable {
+			conn.Close()
+			return nil, fmt.Errorf("queue: the nats server at %s doesn't offer TLS", c.address)
+		}
+		tlsConn := tls.Client(conn, c.tls)
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("queue: connecting to nats over TLS: %w", err)
+		}
+		conn, r = tlsConn, bufio.NewReader(tlsConn)
+		options = maps.Clone(options)
+		options["tls_required"] = true
+	}
+
+	w := bufio.NewWriter(conn)
+	connect, _ := json.Marshal(options)
+	fmt.Fprintf(w, "CONNECT %s\r\nSUB %s* 1\r\nPING\r\n", connect, c.inbox)
+	if err := w.Flush(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("queue: connecting to nats: %w", err)
+	}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("queue: connecting to nats: %w", err)
+		}
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "-ERR") {
+			conn.Close()
+			return nil, fmt.Errorf("queue: nats: %s", strings.Trim(strings.TrimSpace(line[4:]), "'"))
+		}
+		if line == "PONG" {
+			break
+		}
+	}
+	conn.SetDeadline(time.Time{})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		conn.Close()
+		return nil, c.err
+	}
+	c.wmu.Lock()
+	c.w = w
+	c.wmu.Unlock()
+	c.conn, c.down, c.dropped = conn, nil, make(chan struct{})
+	return r, nil
+}
+
+// natsAddress returns the host:port of cfg.URL and the credentials to
+// connect with, from the URL or the config
+func natsAddress(cfg config.NATSQueueConfig) (string, map[string]string, error) {
+	raw := cfg.URL
+	if raw == "" {
+		raw = "nats://localhost:4222"
+	}
+	if !strings.Contains(raw, "://") {
+		raw = "nats://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", nil, fmt.Errorf("queue: invalid nats url: %w", err)
+	}
+	address := u.Host
+	if u.Port() == "" {
+		address = net.JoinHostPort(u.Hostname(), "4222")
+	}
+
+	auth := map[string]string{}
+	user, password := cfg.User, cfg.Password
+	if u.User != nil {
+		user = u.User.Username()
+		password, _ = u.User.Password()
+	}
+	if user != "" {
+		auth["user"], auth["pass"] = user, password
+	}
+	if cfg.Token != "" {
+		auth["auth_token"] = cfg.Token
+	}
+	return address, auth, nil
+}
+
+// run handles what the server sends, reconnecting when the connection
+// drops, until it is closed or given up
+func (c *natsConn) run(r *bufio.Reader) {
+	for {
+		err := c.readLoop(r)
+		if !c.drop(err) {
+			return
+		}
+		if r = c.reconnect(); r == nil {
+			return
+		}
+	}
+}
+
+// drop marks the connection down, failing the requests waiting on it. It
+// reports false when the connection was closed instead.
+func (c *natsConn) drop(err error) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return false
+	}
+	c.down = fmt.Errorf("queue: nats connection lost, reconnecting: %w", err)
+	close(c.dropped)
+	c.conn.Close()
+	return true
+}
+
+// reconnect connects again with backoff, returning the new connection's
+// reader, or nil once closed or given up after c.maxReconnects attempts;
+// a negative maxReconnects never gives up
+func (c *natsConn) reconnect() *bufio.Reader {
+	c.mu.Lock()
+	lost := c.down
+	c.mu.Unlock()
+	c.logger.Warn("Lost the nats connection, reconnecting", zap.String("address", c.address), zap.Error(lost))
+
+	wait := natsReconnectWait
+	for attempt := 1; c.maxReconnects < 0 || attempt <= c.maxReconnects; attempt++ {
+		timer := time.NewTimer(wait)
+		select {
+		case <-c.closed:
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+		wait = min(wait*2, natsMaxReconnectWait)
+
+		r, err := c.connect()
+		if err == nil {
+			c.logger.Info("Reconnected to nats", zap.String("address", c.address), zap.Int("attempts", attempt))
+			return r
+		}
+		if errors.Is(err, errNATSClosed) {
+			return nil
+		}
+		lost = err
+	}
+
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = fmt.Errorf("%w: gave up reconnecting after %d attempts: %w", errNATSClosed, c.maxReconnects, lost)
+	}
+	c.mu.Unlock()
+	c.logger.Error("Gave up reconnecting to nats", zap.String("address", c.address), zap.Error(lost))
+	c.shutdown()
+	return nil
+}
+
+func (c *natsConn) readLoop(r *bufio.Reader) error {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		op, args, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(op) {
+		case "MSG", "HMSG":
+			msg, err := readNATSMsg(r, strings.ToUpper(op) == "HMSG", strings.Fields(args))
+			if err != nil {
+				return err
+			}
+			c.deliver(msg)
+		case "PING":
+			c.write("PONG\r\n")
+		case "-ERR":
+			return fmt.Errorf("queue: nats: %s", strings.Trim(args, "'"))
+		}
+	}
+}
+
+// readNATSMsg reads the payload of a MSG or HMSG, whose arguments are the
+// subject, subscription ID, optional reply subject and sizes
+func readNATSMsg(r *bufio.Reader, headers bool, args []string) (*natsMsg, error) {
+	sizes := 1
+	if headers {
+		sizes = 2
+	}
+	if len(args) != 2+sizes && len(args) != 3+sizes {
+		return nil, fmt.Errorf("queue: nats: malformed message")
+	}
+	msg := &natsMsg{Subject: args[0]}
+	if len(args) == 3+sizes {
+		msg.Reply = args[2]
+	}
+	total, err := strconv.Atoi(args[len(args)-1])
+	if err != nil {
+		return nil, fmt.Errorf("queue: nats: malformed message")
+	}
+	payload := make([]byte, total+2)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	payload = payload[:total]
+
+	if headers {
+		size, err := strconv.Atoi(args[len(args)-2])
+		if err != nil || size > total {
+			return nil, fmt.Errorf("queue: nats: malformed message")
+		}
+		header := payload[:size]
+		payload = payload[size:]
+		// NATS/1.0 404 No Messages
+		first, _, _ := bytes.Cut(header, []byte("\r\n"))
+		if fields := strings.Fields(string(first)); len(fields) > 1 {
+			msg.Status = fields[1]
+		}
+	}
+	msg.Data = payload
+	return msg, nil
+}
+
+// deliver hands a message to the request waiting on its inbox subject
+func (c *natsConn) deliver(msg *natsMsg) {
+	token := strings.TrimPrefix(msg.Subject, c.inbox)
+	c.mu.Lock()
+	ch, ok := c.replies[token]
+	c.mu.Unlock()
+	if !ok {
+		return
+	}
+	select {
+	case ch <- msg:
+	default:
+	}
+}
+
+func (c *natsConn) write(s string, payload ...[]byte) error {
+	if err := c.unavailable(); err != nil {
+		return err
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.w.WriteString(s)
+	for _, p := range payload {
+		c.w.Write(p)
+		c.w.WriteString("\r\n")
+	}
+	return c.w.Flush()
+}
+
+// unavailable returns why the connection can't be used, closed or
+// reconnecting, or nil
+func (c *natsConn) unavailable() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	return c.down
+}
+
+// publish sends data to subject, with a reply subject when reply isn't
+// empty
+func (c *natsConn) publish(subject, reply string, data []byte) error {
+	if reply != "" {
+		reply += " "
+	}
+	if err := c.write(fmt.Sprintf("PUB %s %s%d\r\n", subject, reply, len(data)), data); err != nil {
+		return fmt.Errorf("queue: nats publish: %w", err)
+	}
+	return nil
+}
+
+// request publishes data to subject and waits up to timeout for the
+// first reply
+func (c *natsConn) request(subject string, data []byte, timeout time.Duration) (*natsMsg, error) {
+	token := make([]byte, 12)
+	rand.Read(token)
+	id := hex.EncodeToString(token)
+	ch := make(chan *natsMsg, 1)
+
+	if err := c.unavailable(); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	dropped := c.dropped
+	c.replies[id] = ch
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.replies, id)
+		c.mu.Unlock()
+	}()
+
+	if err := c.publish(subject, c.inbox+id, data); err != nil {
+		return nil, err
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case msg := <-ch:
+		if msg.Status == "503" {
+			return nil, fmt.Errorf("queue: nats: no responders on %s; is JetStream enabled?", subject)
+		}
+		return msg, nil
+	case <-timer.C:
+		return nil, fmt.Errorf("queue: nats: request to %s timed out", subject)
+	case <-dropped:
+		return nil, fmt.Errorf("queue: nats: connection lost during the request to %s", subject)
+	case <-c.closed:
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return nil, c.err
+	}
+}
+
+func (c *natsConn) shutdown() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		c.err = errNATSClosed
+	}
+	select {
+	case <-c.closed:
+	default:
+		close(c.closed)
+		c.conn.Close()
+	}
+}
+
+func (c *natsConn) close() error {
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = errNATSClosed
+	}
+	c.mu.Unlock()
+	c.shutdown()
+	return nil
+}
@@ -0,0 +1,452 @@
+package queue
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/providers"
+)
+
+// fakeJetStream is a NATS server answering as much of the JetStream API
+// as NATSQueue uses, with one stream
+type fakeJetStream struct {
+	ln net.Listener
+
+	// tls, when set, makes the server require TLS
+	tls *tls.Config
+
+	mu         sync.Mutex
+	conns      []net.Conn
+	connect    map[string]interface{}
+	subjects   []string
+	consumers  map[string]string
+	messages   []*fakeMessage
+	seq        int
+	terminated []string
+}
+
+type fakeMessage struct {
+	seq         int
+	subject     string
+	data        []byte
+	deliveries  int
+	inFlight    bool
+	availableAt time.Time
+}
+
+func newFakeJetStream(t *testing.T) *fakeJetStream {
+	return newFakeJetStreamTLS(t, nil)
+}
+
+// newFakeJetStreamTLS starts a server requiring TLS with tlsConfig, or
+// none when nil
+func newFakeJetStreamTLS(t *testing.T, tlsConfig *tls.Config) *fakeJetStream {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &fakeJetStream{ln: ln, tls: tlsConfig, consumers: make(map[string]string)}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns = append(s.conns, conn)
+			s.mu.Unlock()
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeJetStream) url() string {
+	return "nats://" + s.ln.Addr().String()
+}
+
+// drop closes the connections of the server's clients
+func (s *fakeJetStream) drop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+func (s *fakeJetStream) serve(conn net.Conn) {
+	defer conn.Close()
+	if s.tls != nil {
+		fmt.Fprintf(conn, "INFO {\"server_id\":\"fake\",\"tls_required\":true}\r\n")
+		tlsConn := tls.Server(conn, s.tls)
+		if tlsConn.Handshake() != nil {
+			return
+		}
+		conn = tlsConn
+	}
+	var wmu sync.Mutex
+	send := func(format string, args ...interface{}) {
+		wmu.Lock()
+		defer wmu.Unlock()
+		fmt.Fprintf(conn, format, args...)
+	}
+	reply := func(subject string, data []byte) {
+		send("MSG %s 1 %d\r\n%s\r\n", subject, len(data), data)
+	}
+	deliver := func(subject, ack string, data []byte) {
+		send("MSG %s 1 %s %d\r\n%s\r\n", subject, ack, len(data), data)
+	}
+	status := func(subject, code string) {
+		header := "NATS/1.0 " + code + "\r\n\r\n"
+		send("HMSG %s 1 %d %d\r\n%s\r\n", subject, len(header), len(header), header)
+	}
+
+	if s.tls == nil {
+		send("INFO {\"server_id\":\"fake\",\"jetstream\":true,\"headers\":true}\r\n")
+	}
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		op, args, _ := strings.Cut(strings.TrimSpace(line), " ")
+		switch op {
+		case "CONNECT":
+			s.mu.Lock()
+			json.Unmarshal([]byte(args), &s.connect)
+			s.mu.Unlock()
+		case "PING":
+			send("PONG\r\n")
+		case "PUB":
+			fields := strings.Fields(args)
+			size, _ := strconv.Atoi(fields[len(fields)-1])
+			data := make([]byte, size+2)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return
+			}
+			var to string
+			if len(fields) == 3 {
+				to = fields[1]
+			}
+			s.handle(fields[0], to, data[:size], reply, deliver, status)
+		}
+	}
+}
+
+func (s *fakeJetStream) handle(subject, to string, data []byte, reply func(string, []byte), deliver func(string, string, []byte), status func(string, string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	respond := func(v interface{}) {
+		out, _ := json.Marshal(v)
+		reply(to, out)
+	}
+	tokens := strings.Split(subject, ".")
+
+	switch {
+	case strings.HasPrefix(subject, "$JS.API.STREAM.INFO."):
+		if s.subjects == nil {
+			respond(map[string]interface{}{"error": map[string]interface{}{"code": 404, "err_code": jsStreamNotFound, "description": "stream not found"}})
+			return
+		}
+		respond(map[string]interface{}{"config": map[string]interface{}{"subjects": s.subjects}})
+	case strings.HasPrefix(subject, "$JS.API.STREAM.CREATE."):
+		var request struct {
+			Subjects []string `json:"subjects"`
+		}
+		json.Unmarshal(data, &request)
+		s.subjects = request.Subjects
+		respond(map[string]interface{}{"config": request})
+	case strings.HasPrefix(subject, "$JS.API.CONSUMER.DURABLE.CREATE."):
+		var request struct {
+			Config struct {
+				Durable string `json:"durable_name"`
+				Filter  string `json:"filter_subject"`
+			} `json:"config"`
+		}
+		json.Unmarshal(data, &request)
+		s.consumers[request.Config.Durable] = request.Config.Filter
+		respond(map[string]interface{}{"name": request.Config.Durable})
+	case strings.HasPrefix(subject, "$JS.API.CONSUMER.INFO."):
+		filter := s.consumers[tokens[len(tokens)-1]]
+		pending, ackPending := 0, 0
+		for _, m := range s.messages {
+			if m.subject != filter {
+				continue
+			}
+			if m.inFlight {
+				ackPending++
+			} else {
+				pending++
+			}
+		}
+		respond(map[string]interface{}{"num_pending": pending, "num_ack_pending": ackPending})
+	case strings.HasPrefix(subject, "$JS.API.CONSUMER.MSG.NEXT."):
+		name := tokens[len(tokens)-1]
+		filter := s.consumers[name]
+		for _, m := range s.messages {
+			if m.subject == filter && !m.inFlight && !m.availableAt.After(time.Now()) {
+				m.inFlight = true
+				m.deliveries++
+				ack := fmt.Sprintf("$JS.ACK.%s.%s.%d.%d.%d.%d.0", tokens[5], name, m.deliveries, m.seq, m.seq, time.Now().UnixNano())
+				deliver(to, ack, m.data)
+				return
+			}
+		}
+		// Wait a little, as a pull request does, before saying none came
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			status(to, "408 Request Timeout")
+		}()
+	case strings.HasPrefix(subject, "$JS.API.STREAM.PURGE."):
+		var request struct {
+			Filter string `json:"filter"`
+		}
+		json.Unmarshal(data, &request)
+		kept := s.messages[:0]
+		for _, m := range s.messages {
+			if m.subject != request.Filter {
+				kept = append(kept, m)
+			}
+		}
+		s.messages = kept
+		respond(map[string]interface{}{"success": true})
+	case strings.HasPrefix(subject, "$JS.ACK."):
+		seq, _ := strconv.Atoi(tokens[5])
+		for i, m := range s.messages {
+			if m.seq != seq {
+				continue
+			}
+			answer, options, _ := strings.Cut(string(data), " ")
+			switch answer {
+			case "+ACK":
+				s.messages = append(s.messages[:i], s.messages[i+1:]...)
+			case "+TERM":
+				s.messages = append(s.messages[:i], s.messages[i+1:]...)
+				s.terminated = append(s.terminated, string(m.data))
+			case "-NAK":
+				var delay struct {
+					Delay int64 `json:"delay"`
+				}
+				json.Unmarshal([]byte(options), &delay)
+				m.inFlight = false
+				m.availableAt = time.Now().Add(time.Duration(delay.Delay))
+			}
+			return
+		}
+	case s.stored(subject):
+		s.seq++
+		s.messages = append(s.messages, &fakeMessage{seq: s.seq, subject: subject, data: data})
+		if to != "" {
+			respond(map[string]interface{}{"stream": "JOBS", "seq": s.seq})
+		}
+	case to != "":
+		status(to, "503")
+	}
+}
+
+// stored reports whether the stream holds subject
+func (s *fakeJetStream) stored(subject string) bool {
+	for _, pattern := range s.subjects {
+		if pattern == subject || strings.HasSuffix(pattern, ">") && strings.HasPrefix(subject, strings.TrimSuffix(pattern, ">")) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestNATSQueue(t *testing.T) {
+	server := newFakeJetStream(t)
+	q, err := NewNATSQueue(config.QueueConnectionConfig{
+		Topics:      map[string]string{"orders": "shop.orders"},
+		MaxAttempts: 2,
+		Backoff:     time.Millisecond,
+		NATS:        config.NATSQueueConfig{URL: server.url(), Token: "secret"},
+	}, nil)
+	require.NoError(t, err)
+	defer q.Close()
+
+	server.mu.Lock()
+	assert.Equal(t, []string{"jobs.>", "shop.orders"}, server.subjects)
+	assert.Equal(t, "secret", server.connect["auth_token"])
+	assert.Equal(t, true, server.connect["headers"])
+	server.mu.Unlock()
+
+	require.NoError(t, q.Push("orders", providers.Job{ID: "1", Type: "order.ship"}))
+	require.NoError(t, q.Push("orders", providers.Job{ID: "2", Type: "order.ship"}))
+	size, err := q.Size("orders")
+	require.NoError(t, err)
+	assert.Equal(t, 2, size)
+	assert.Contains(t, q.consumers, "dolphin_orders")
+
+	job, err := q.Pop("orders")
+	require.NoError(t, err)
+	assert.Equal(t, "1", job.ID)
+	assert.Equal(t, 1, job.Attempts)
+
+	require.NoError(t, q.Clear("orders"))
+	_, err = q.Pop("orders")
+	assert.ErrorIs(t, err, ErrEmpty)
+
+	// A subject outside the stream has no responders
+	err = q.Push("emails", providers.Job{ID: "3"})
+	require.NoError(t, err)
+	server.mu.Lock()
+	server.subjects = []string{"shop.orders"}
+	server.mu.Unlock()
+	assert.ErrorContains(t, q.Push("emails", providers.Job{ID: "4"}), "no responders")
+}
+
+func TestNATSQueueWork(t *testing.T) {
+	server := newFakeJetStream(t)
+	q, err := NewNATSQueue(config.QueueConnectionConfig{
+		MaxAttempts: 2,
+		Backoff:     time.Millisecond,
+		NATS:        config.NATSQueueConfig{URL: server.url()},
+	}, nil)
+	require.NoError(t, err)
+	defer q.Close()
+
+	require.NoError(t, q.Push("default", providers.Job{ID: "flaky"}))
+	require.NoError(t, q.Push("default", providers.Job{ID: "broken"}))
+	require.NoError(t, q.Push("default", providers.Job{ID: "later", Delay: 50 * time.Millisecond}))
+
+	var calls []string
+	var attempts = map[string][]int{}
+	work(t, q, "default", 5, func(job providers.Job) error {
+		calls = append(calls, job.ID)
+		attempts[job.ID] = append(attempts[job.ID], job.Attempts)
+		if job.ID == "flaky" && job.Attempts == 1 || job.ID == "broken" {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	assert.ElementsMatch(t, []string{"flaky", "flaky", "broken", "broken", "later"}, calls)
+	assert.Equal(t, []int{1, 2}, attempts["flaky"])
+	assert.Equal(t, []int{1, 2}, attempts["broken"])
+	// Being put back until due doesn't use up an attempt
+	assert.Equal(t, []int{1}, attempts["later"])
+
+	// The last ack reaches the server after Work returns
+	assert.Eventually(t, func() bool {
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		return len(server.messages) == 0
+	}, time.Second, 5*time.Millisecond)
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	require.Len(t, server.terminated, 1)
+	assert.Contains(t, server.terminated[0], `"id":"broken"`)
+}
+
+func TestNATSUnavailable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := ln.Addr().String()
+	ln.Close()
+
+	_, err = NewNATSQueue(config.QueueConnectionConfig{NATS: config.NATSQueueConfig{URL: address}}, nil)
+	assert.ErrorContains(t, err, "connecting to nats")
+}
+
+func TestNATSReconnects(t *testing.T) {
+	server := newFakeJetStream(t)
+	q, err := NewNATSQueue(config.QueueConnectionConfig{NATS: config.NATSQueueConfig{URL: server.url()}}, nil)
+	require.NoError(t, err)
+	defer q.Close()
+	require.NoError(t, q.Push("default", providers.Job{ID: "1"}))
+
+	server.drop()
+	assert.Eventually(t, func() bool {
+		return q.Push("default", providers.Job{ID: "2"}) == nil
+	}, 5*time.Second, 50*time.Millisecond)
+	size, err := q.Size("default")
+	require.NoError(t, err)
+	assert.Equal(t, 2, size)
+}
+
+func TestNATSWorkStopsWhenTheConnectionIsGivenUp(t *testing.T) {
+	server := newFakeJetStream(t)
+	q, err := NewNATSQueue(config.QueueConnectionConfig{NATS: config.NATSQueueConfig{URL: server.url(), MaxReconnects: 1}}, nil)
+	require.NoError(t, err)
+	defer q.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- q.Work(context.Background(), "default", func(providers.Job) error { return nil })
+	}()
+	server.ln.Close()
+	server.drop()
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, errNATSClosed)
+		assert.ErrorContains(t, err, "gave up reconnecting")
+	case <-time.After(5 * time.Second):
+		t.Fatal("Work kept going on a dead connection")
+	}
+	assert.ErrorIs(t, q.Push("default", providers.Job{ID: "1"}), errNATSClosed)
+}
+
+func TestNATSTLS(t *testing.T) {
+	certServer := httptest.NewTLSServer(http.NotFoundHandler())
+	certServer.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certServer.Certificate().Raw}), 0o600))
+
+	server := newFakeJetStreamTLS(t, &tls.Config{Certificates: certServer.TLS.Certificates})
+	q, err := NewNATSQueue(config.QueueConnectionConfig{NATS: config.NATSQueueConfig{URL: server.url(), Password: "pw", User: "app", CAFile: caFile}}, nil)
+	require.NoError(t, err)
+	defer q.Close()
+	require.NoError(t, q.Push("default", providers.Job{ID: "1"}))
+	server.mu.Lock()
+	assert.Equal(t, true, server.connect["tls_required"])
+	server.mu.Unlock()
+
+	// The server's certificate isn't trusted without the CA
+	_, err = NewNATSQueue(config.QueueConnectionConfig{NATS: config.NATSQueueConfig{URL: server.url()}}, nil)
+	assert.ErrorContains(t, err, "over TLS")
+
+	// Nor are credentials sent in clear text to a server without TLS when
+	// it is asked for
+	plain := newFakeJetStream(t)
+	_, err = NewNATSQueue(config.QueueConnectionConfig{NATS: config.NATSQueueConfig{URL: plain.url(), TLS: true}}, nil)
+	assert.ErrorContains(t, err, "doesn't offer TLS")
+}
+
+func TestNATSAddress(t *testing.T) {
+	address, auth, err := natsAddress(config.NATSQueueConfig{URL: "nats://app:pw@broker"})
+	require.NoError(t, err)
+	assert.Equal(t, "broker:4222", address)
+	assert.Equal(t, map[string]string{"user": "app", "pass": "pw"}, auth)
+
+	address, auth, err = natsAddress(config.NATSQueueConfig{User: "app", Password: "pw"})
+	require.NoError(t, err)
+	assert.Equal(t, "localhost:4222", address)
+	assert.Equal(t, "app", auth["user"])
+}
+
+func TestDeliveries(t *testing.T) {
+	assert.Equal(t, 3, deliveries("$JS.ACK.JOBS.dolphin_default.3.10.10.1700000000.0"))
+	assert.Equal(t, 2, deliveries("$JS.ACK.hub.acchash.JOBS.dolphin_default.2.10.10.1700000000.0.token"))
+	assert.Equal(t, 1, deliveries("inbox"))
+}
@@ -0,0 +1,242 @@
+// Package queue runs jobs and queued events on an in-process queue or a
+// broker: Kafka, through its REST Proxy, or NATS JetStream. Connections
+// are configured under queue.connections and workers started with
+// `dolphin queue:work --connection kafka`.
+//
+//	q, _ := router.Queue().Connection("")
+//	q.Push("emails", providers.Job{Type: "mail.welcome", Payload: payload})
+//
+//	queue.Handle("mail.welcome", sendWelcome)
+//	q.Work(ctx, "emails", queue.Dispatch)
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/providers"
+)
+
+// ErrEmpty is returned by Pop when no job is waiting
+var ErrEmpty = errors.New("queue: empty")
+
+// ErrInvalidJob wraps the errors of jobs failing their schema
+var ErrInvalidJob = errors.New("queue: invalid job")
+
+// ErrNoHandler is returned by Dispatch for jobs of a type nothing handles
+var ErrNoHandler = errors.New("queue: no handler")
+
+const (
+	// defaultPrefix is put before queue names without a configured topic
+	defaultPrefix = "jobs."
+
+	// defaultGroup is the consumer group workers join unless configured
+	defaultGroup = "dolphin"
+
+	defaultMaxAttempts = 3
+	defaultBackoff     = 10 * time.Second
+
+	// maxBackoff caps the wait between attempts
+	maxBackoff = 10 * time.Minute
+)
+
+// Driver is a queue connection. Jobs pushed to a queue are handled by one
+// worker of the connection's consumer group; Pop takes one without a
+// worker, acknowledging it at once.
+type Driver interface {
+	providers.QueueProvider
+
+	// Work hands the jobs of queue to handler until ctx is done. Failed
+	// jobs are retried after a backoff, then dropped and logged once they
+	// have been tried the connection's max attempts.
+	Work(ctx context.Context, queue string, handler providers.JobHandler) error
+
+	// Close stops the workers started by Process and disconnects
+	Close() error
+}
+
+// Open connects to a queue connection's broker
+func Open(cfg config.QueueConnectionConfig, logger *zap.Logger) (Driver, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	switch cfg.Driver {
+	case "memory", "":
+		return NewMemoryQueue(cfg, logger), nil
+	case "kafka":
+		return NewKafkaQueue(cfg, logger)
+	case "nats":
+		return NewNATSQueue(cfg, logger)
+	default:
+		return nil, fmt.Errorf("queue: unknown driver %q", cfg.Driver)
+	}
+}
+
+// envelope is a job as sent to a broker, with when it may run
+type envelope struct {
+	providers.Job
+	AvailableAt time.Time `json:"available_at,omitempty"`
+}
+
+func encodeJob(job providers.Job, now time.Time) ([]byte, error) {
+	e := envelope{Job: job}
+	if job.Delay > 0 {
+		e.AvailableAt = now.Add(job.Delay)
+	}
+	return json.Marshal(e)
+}
+
+func decodeJob(data []byte) (envelope, error) {
+	var e envelope
+	if err := json.Unmarshal(data, &e); err != nil {
+		return e, fmt.Errorf("%w: %v", ErrInvalidJob, err)
+	}
+	return e, nil
+}
+
+// options holds a connection's settings with the defaults filled in
+type options struct {
+	topics      map[string]string
+	prefix      string
+	group       string
+	maxAttempts int
+	backoff     time.Duration
+}
+
+func newOptions(cfg config.QueueConnectionConfig) options {
+	o := options{
+		topics:      cfg.Topics,
+		prefix:      cfg.Prefix,
+		group:       cfg.Group,
+		maxAttempts: cfg.MaxAttempts,
+		backoff:     cfg.Backoff,
+	}
+	if o.prefix == "" {
+		o.prefix = defaultPrefix
+	}
+	if o.group == "" {
+		o.group = defaultGroup
+	}
+	if o.maxAttempts <= 0 {
+		o.maxAttempts = defaultMaxAttempts
+	}
+	if o.backoff <= 0 {
+		o.backoff = defaultBackoff
+	}
+	return o
+}
+
+// topic returns the topic or subject a queue's jobs go to
+func (o options) topic(queue string) string {
+	if topic, ok := o.topics[queue]; ok {
+		return topic
+	}
+	return o.prefix + queue
+}
+
+// retryDelay is the wait after a job's attempt-th failure
+func (o options) retryDelay(attempt int) time.Duration {
+	delay := o.backoff
+	for i := 1; i < attempt && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxBackoff)
+}
+
+// failed logs a job that won't be tried again
+func failed(logger *zap.Logger, queue string, job providers.Job, err error) {
+	logger.Error("Job failed",
+		zap.String("queue", queue),
+		zap.String("type", job.Type),
+		zap.String("id", job.ID),
+		zap.Int("attempts", job.Attempts),
+		zap.Error(err))
+}
+
+// sleep waits for d or until ctx is done, reporting whether d passed
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Mux hands jobs to the handler registered for their type
+type Mux struct {
+	mu       sync.RWMutex
+	handlers map[string]providers.JobHandler
+}
+
+// NewMux creates an empty Mux
+func NewMux() *Mux {
+	return &Mux{handlers: make(map[string]providers.JobHandler)}
+}
+
+// Handle registers handler for the jobs of jobType
+func (m *Mux) Handle(jobType string, handler providers.JobHandler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.handlers[jobType] = handler
+}
+
+// Dispatch runs the handler of job's type
+func (m *Mux) Dispatch(job providers.Job) error {
+	m.mu.RLock()
+	handler, ok := m.handlers[job.Type]
+	m.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w for %q", ErrNoHandler, job.Type)
+	}
+	return handler(job)
+}
+
+// Types returns the job types with a handler
+func (m *Mux) Types() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	types := make([]string, 0, len(m.handlers))
+	for jobType := range m.handlers {
+		types = append(types, jobType)
+	}
+	return types
+}
+
+// DefaultMux routes the jobs of queue:work
+var DefaultMux = NewMux()
+
+// Handle registers handler for the jobs of jobType on DefaultMux
+func Handle(jobType string, handler providers.JobHandler) {
+	DefaultMux.Handle(jobType, handler)
+}
+
+// Dispatch runs the handler DefaultMux has for job's type
+func Dispatch(job providers.Job) error {
+	return DefaultMux.Dispatch(job)
+}
+
+// sanitize makes name safe as a NATS consumer or Kafka consumer instance
+// name, which can't hold dots, wildcards or spaces
+func sanitize(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '*', '>', ' ', '/', '\\':
+			return '_'
+		}
+		return r
+	}, name)
+}
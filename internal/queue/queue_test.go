@@ -0,0 +1,290 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/events"
+	"github.com/mrhoseah/dolphin/internal/providers"
+)
+
+// work runs handler on queue until it has been called n times
+func work(t *testing.T, driver Driver, queue string, n int, handler providers.JobHandler) []providers.Job {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var mu sync.Mutex
+	var jobs []providers.Job
+	done := make(chan error, 1)
+	go func() {
+		done <- driver.Work(ctx, queue, func(job providers.Job) error {
+			mu.Lock()
+			jobs = append(jobs, job)
+			if len(jobs) == n {
+				cancel()
+			}
+			mu.Unlock()
+			return handler(job)
+		})
+	}()
+	<-done
+	require.Len(t, jobs, n, "handler wasn't called %d times before the timeout", n)
+	return jobs
+}
+
+func TestMemoryQueue(t *testing.T) {
+	q := NewMemoryQueue(config.QueueConnectionConfig{}, nil)
+	defer q.Close()
+
+	require.NoError(t, q.Push("emails", providers.Job{ID: "1", Type: "mail"}))
+	require.NoError(t, q.Push("emails", providers.Job{ID: "2", Type: "mail", Delay: time.Hour}))
+	size, err := q.Size("emails")
+	require.NoError(t, err)
+	assert.Equal(t, 2, size)
+
+	job, err := q.Pop("emails")
+	require.NoError(t, err)
+	assert.Equal(t, "1", job.ID)
+	assert.Equal(t, 1, job.Attempts)
+
+	// The delayed job isn't due yet
+	_, err = q.Pop("emails")
+	assert.ErrorIs(t, err, ErrEmpty)
+	q.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	job, err = q.Pop("emails")
+	require.NoError(t, err)
+	assert.Equal(t, "2", job.ID)
+
+	require.NoError(t, q.Push("emails", providers.Job{ID: "3"}))
+	require.NoError(t, q.Clear("emails"))
+	_, err = q.Pop("emails")
+	assert.ErrorIs(t, err, ErrEmpty)
+}
+
+func TestMemoryQueueRetries(t *testing.T) {
+	q := NewMemoryQueue(config.QueueConnectionConfig{MaxAttempts: 3, Backoff: time.Millisecond}, nil)
+	defer q.Close()
+
+	require.NoError(t, q.Push("default", providers.Job{ID: "flaky"}))
+	require.NoError(t, q.Push("default", providers.Job{ID: "broken"}))
+	var calls []string
+	work(t, q, "default", 5, func(job providers.Job) error {
+		calls = append(calls, job.ID)
+		if job.ID == "flaky" && job.Attempts < 2 || job.ID == "broken" {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	assert.ElementsMatch(t, []string{"flaky", "flaky", "broken", "broken", "broken"}, calls)
+
+	// Both are done with: flaky succeeded and broken ran out of attempts
+	time.Sleep(10 * time.Millisecond)
+	size, _ := q.Size("default")
+	assert.Zero(t, size)
+}
+
+func TestRetryDelay(t *testing.T) {
+	o := newOptions(config.QueueConnectionConfig{Backoff: time.Second})
+	assert.Equal(t, time.Second, o.retryDelay(1))
+	assert.Equal(t, 4*time.Second, o.retryDelay(3))
+	assert.Equal(t, maxBackoff, o.retryDelay(30))
+
+	o = newOptions(config.QueueConnectionConfig{Topics: map[string]string{"orders": "shop.orders"}})
+	assert.Equal(t, "shop.orders", o.topic("orders"))
+	assert.Equal(t, "jobs.emails", o.topic("emails"))
+	assert.Equal(t, defaultGroup, o.group)
+	assert.Equal(t, defaultMaxAttempts, o.maxAttempts)
+}
+
+func TestMux(t *testing.T) {
+	mux := NewMux()
+	var handled providers.Job
+	mux.Handle("mail", func(job providers.Job) error {
+		handled = job
+		return nil
+	})
+
+	require.NoError(t, mux.Dispatch(providers.Job{ID: "1", Type: "mail"}))
+	assert.Equal(t, "1", handled.ID)
+	assert.ErrorIs(t, mux.Dispatch(providers.Job{Type: "sms"}), ErrNoHandler)
+	assert.Equal(t, []string{"mail"}, mux.Types())
+}
+
+func TestOpen(t *testing.T) {
+	driver, err := Open(config.QueueConnectionConfig{Driver: "memory"}, nil)
+	require.NoError(t, err)
+	assert.IsType(t, &MemoryQueue{}, driver)
+
+	_, err = Open(config.QueueConnectionConfig{Driver: "kafka"}, nil)
+	assert.ErrorContains(t, err, "rest_url")
+	_, err = Open(config.QueueConnectionConfig{Driver: "sqs"}, nil)
+	assert.ErrorContains(t, err, "unknown driver")
+}
+
+func TestSchema(t *testing.T) {
+	schema, err := ParseSchema([]byte(`{
+		"type": "object",
+		"required": ["email", "plan"],
+		"additionalProperties": false,
+		"properties": {
+			"email": {"type": "string", "minLength": 3, "maxLength": 50},
+			"plan": {"enum": ["free", "pro"]},
+			"seats": {"type": "integer", "minimum": 1, "maximum": 100},
+			"tags": {"type": "array", "items": {"type": "string"}},
+			"note": {"type": ["string", "null"]}
+		}
+	}`))
+	require.NoError(t, err)
+	validate := schema.Validator()
+
+	tests := []struct {
+		payload map[string]interface{}
+		err     string
+	}{
+		{map[string]interface{}{"email": "a@b.co", "plan": "pro", "seats": 5, "tags": []string{"x"}, "note": nil}, ""},
+		{map[string]interface{}{"plan": "pro"}, "payload.email is required"},
+		{map[string]interface{}{"email": "a@b.co", "plan": "gold"}, "payload.plan must be one of [free pro]"},
+		{map[string]interface{}{"email": "a", "plan": "free"}, "payload.email must be at least 3 characters"},
+		{map[string]interface{}{"email": "a@b.co", "plan": "free", "seats": 1.5}, "payload.seats must be integer"},
+		{map[string]interface{}{"email": "a@b.co", "plan": "free", "seats": 0}, "payload.seats must be at least 1"},
+		{map[string]interface{}{"email": "a@b.co", "plan": "free", "tags": []interface{}{"x", 2}}, "payload.tags[1] must be string"},
+		{map[string]interface{}{"email": "a@b.co", "plan": "free", "admin": true}, "payload.admin is not allowed"},
+	}
+	for _, test := range tests {
+		err := validate(providers.Job{Payload: test.payload})
+		if test.err == "" {
+			assert.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, test.err)
+		}
+	}
+
+	_, err = ParseSchema([]byte(`{"type":`))
+	assert.Error(t, err)
+}
+
+func TestManager(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "mail.welcome.json"),
+		[]byte(`{"type": "object", "required": ["email"]}`), 0644))
+
+	manager, err := NewManager(config.QueueConfig{
+		Default: "memory",
+		Connections: map[string]config.QueueConnectionConfig{
+			"memory": {Driver: "memory"},
+			"broken": {Driver: "sqs"},
+		},
+		Schemas: dir,
+	}, nil)
+	require.NoError(t, err)
+	defer manager.Close()
+	assert.Equal(t, []string{"broken", "memory"}, manager.ConnectionNames())
+
+	q, err := manager.Connection("")
+	require.NoError(t, err)
+	same, err := manager.Connection("memory")
+	require.NoError(t, err)
+	assert.Same(t, q, same)
+	_, err = manager.Connection("broken")
+	assert.ErrorContains(t, err, "unknown driver")
+	_, err = manager.Connection("missing")
+	assert.ErrorContains(t, err, "no connection")
+
+	// Invalid jobs are refused when pushed
+	err = q.Push("default", providers.Job{ID: "1", Type: "mail.welcome", Payload: map[string]interface{}{}})
+	assert.ErrorIs(t, err, ErrInvalidJob)
+	assert.ErrorContains(t, err, "payload.email is required")
+	require.NoError(t, q.Push("default", providers.Job{ID: "2", Type: "mail.welcome", Payload: map[string]interface{}{"email": "a@b.co"}}))
+
+	// and dropped when a schema registered later rejects them
+	manager.Validate("mail.welcome", func(job providers.Job) error { return errors.New("no longer accepted") })
+	var handled int
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	q.Work(ctx, "default", func(job providers.Job) error {
+		handled++
+		return nil
+	})
+	assert.Zero(t, handled)
+	size, _ := q.Size("default")
+	assert.Zero(t, size)
+
+	_, err = NewManager(config.QueueConfig{Schemas: writeFile(t, "broken.json", "{")}, nil)
+	assert.Error(t, err)
+}
+
+// writeFile writes a file named name in a temporary directory, returning
+// the directory
+func writeFile(t *testing.T, name, content string) string {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	return dir
+}
+
+type recordingListener struct {
+	mu     sync.Mutex
+	events []events.Event
+	ids    []string
+}
+
+func (l *recordingListener) Handle(ctx context.Context, event events.Event) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, event)
+	l.ids = append(l.ids, middleware.GetReqID(ctx))
+	return nil
+}
+
+func (l *recordingListener) GetPriority() int  { return 0 }
+func (l *recordingListener) ShouldQueue() bool { return false }
+
+func TestEvents(t *testing.T) {
+	q := NewMemoryQueue(config.QueueConnectionConfig{}, nil)
+	defer q.Close()
+	bus := events.NewEventBusWithQueue(Events(q, "events"))
+	listener := &recordingListener{}
+	bus.Subscribe("user.created", listener)
+
+	event := events.NewBaseEvent("user.created", map[string]interface{}{"id": 7})
+	ctx := context.WithValue(context.Background(), middleware.RequestIDKey, "req-1")
+	require.NoError(t, bus.PublishAsync(ctx, event))
+	size, err := bus.Size(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, size)
+
+	job, err := q.Pop("events")
+	require.NoError(t, err)
+	assert.Equal(t, EventJobType, job.Type)
+	assert.Equal(t, event.ID, job.ID)
+	require.NoError(t, q.Push("events", job))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, bus.StartWorker(ctx))
+	assert.Eventually(t, func() bool {
+		listener.mu.Lock()
+		defer listener.mu.Unlock()
+		return len(listener.events) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+	cancel()
+	bus.StopWorker()
+
+	received := listener.events[0]
+	assert.Equal(t, event.ID, received.GetID())
+	assert.Equal(t, "user.created", received.GetName())
+	assert.Equal(t, map[string]interface{}{"id": 7}, received.GetPayload())
+	assert.WithinDuration(t, event.Timestamp, received.GetTimestamp(), time.Microsecond)
+	assert.Equal(t, []string{"req-1"}, listener.ids)
+
+	_, err = jobEvent(providers.Job{Type: "mail"})
+	assert.ErrorIs(t, err, ErrInvalidJob)
+}
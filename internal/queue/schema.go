@@ -0,0 +1,181 @@
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mrhoseah/dolphin/internal/providers"
+)
+
+// Validator checks a job before it is pushed and before it is handled,
+// returning why it is invalid
+type Validator func(job providers.Job) error
+
+// Schema is the part of JSON Schema job payloads are checked against:
+// type, required, properties, additionalProperties, enum, minimum,
+// maximum, minLength, maxLength and items
+type Schema struct {
+	Type                 interface{}        `json:"type,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+}
+
+// ParseSchema reads a JSON schema
+func ParseSchema(data []byte) (*Schema, error) {
+	var schema Schema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("queue: invalid schema: %w", err)
+	}
+	return &schema, nil
+}
+
+// Validator checks job payloads against the schema
+func (s *Schema) Validator() Validator {
+	return func(job providers.Job) error {
+		// Round trip the payload so it holds what a worker decodes
+		data, err := json.Marshal(job.Payload)
+		if err != nil {
+			return err
+		}
+		var payload interface{}
+		if err := json.Unmarshal(data, &payload); err != nil {
+			return err
+		}
+		if payload == nil {
+			payload = map[string]interface{}{}
+		}
+		return s.validate("payload", payload)
+	}
+}
+
+// validate checks value at path against the schema
+func (s *Schema) validate(path string, value interface{}) error {
+	if types := s.types(); len(types) > 0 && !slices.ContainsFunc(types, func(t string) bool { return isType(value, t) }) {
+		return fmt.Errorf("%s must be %s", path, strings.Join(types, " or "))
+	}
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(v interface{}) bool { return reflect.DeepEqual(v, value) }) {
+		return fmt.Errorf("%s must be one of %v", path, s.Enum)
+	}
+
+	switch v := value.(type) {
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			return fmt.Errorf("%s must be at least %v", path, *s.Minimum)
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			return fmt.Errorf("%s must be at most %v", path, *s.Maximum)
+		}
+	case string:
+		length := utf8.RuneCountInString(v)
+		if s.MinLength != nil && length < *s.MinLength {
+			return fmt.Errorf("%s must be at least %d characters", path, *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			return fmt.Errorf("%s must be at most %d characters", path, *s.MaxLength)
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range v {
+				if err := s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+					return err
+				}
+			}
+		}
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				return fmt.Errorf("%s.%s is required", path, name)
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			property, ok := s.Properties[name]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					return fmt.Errorf("%s.%s is not allowed", path, name)
+				}
+				continue
+			}
+			if err := property.validate(path+"."+name, v[name]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// types returns the types the schema allows, given as a string or a list
+func (s *Schema) types() []string {
+	switch t := s.Type.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		var types []string
+		for _, name := range t {
+			if name, ok := name.(string); ok {
+				types = append(types, name)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+// isType reports whether a decoded JSON value is of a JSON Schema type
+func isType(value interface{}, t string) bool {
+	switch v := value.(type) {
+	case nil:
+		return t == "null"
+	case bool:
+		return t == "boolean"
+	case string:
+		return t == "string"
+	case float64:
+		return t == "number" || (t == "integer" && v == math.Trunc(v))
+	case []interface{}:
+		return t == "array"
+	case map[string]interface{}:
+		return t == "object"
+	}
+	return false
+}
+
+// LoadSchemas reads the JSON schemas in dir, each named <job type>.json,
+// returning a validator per job type
+func LoadSchemas(dir string) (map[string]Validator, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	validators := make(map[string]Validator, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		schema, err := ParseSchema(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		validators[strings.TrimSuffix(filepath.Base(path), ".json")] = schema.Validator()
+	}
+	return validators, nil
+}
@@ -0,0 +1,206 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Ban refuses every request from an IP address or CIDR range, until it
+// expires or forever
+type Ban struct {
+	IP        string `gorm:"primaryKey;size:64"`
+	Reason    string `gorm:"size:255"`
+	ExpiresAt *time.Time
+	CreatedAt time.Time
+}
+
+func (Ban) TableName() string { return "ip_bans" }
+
+// Expired reports whether the ban no longer applies at t
+func (b Ban) Expired(t time.Time) bool {
+	return b.ExpiresAt != nil && !t.Before(*b.ExpiresAt)
+}
+
+// BanList keeps banned IPs in the database, shared by every instance and
+// the CLI. Lookups are served from memory, reloaded every refresh, so bans
+// made elsewhere apply within that long.
+type BanList struct {
+	db      *gorm.DB
+	refresh time.Duration
+
+	mu       sync.RWMutex
+	ips      map[netip.Addr]Ban
+	ranges   map[netip.Prefix]Ban
+	loadedAt time.Time
+}
+
+// NewBanList creates a ban list, creating its table if needed
+func NewBanList(db *gorm.DB, refresh time.Duration) (*BanList, error) {
+	if err := db.AutoMigrate(&Ban{}); err != nil {
+		return nil, err
+	}
+	return &BanList{db: db, refresh: refresh}, nil
+}
+
+// ParseBanTarget normalizes an IP address or CIDR range
+func ParseBanTarget(target string) (string, error) {
+	if prefix, err := netip.ParsePrefix(target); err == nil {
+		return prefix.Masked().String(), nil
+	}
+	addr, err := netip.ParseAddr(target)
+	if err != nil {
+		return "", fmt.Errorf("ratelimit: %q is not an IP address or CIDR range", target)
+	}
+	return addr.Unmap().String(), nil
+}
+
+// Ban bans an IP address or CIDR range for duration, or forever when it is
+// zero. Banning again replaces the reason and expiry.
+func (b *BanList) Ban(ctx context.Context, target, reason string, duration time.Duration) error {
+	ip, err := ParseBanTarget(target)
+	if err != nil {
+		return err
+	}
+	ban := Ban{IP: ip, Reason: reason, CreatedAt: time.Now()}
+	if duration > 0 {
+		expires := ban.CreatedAt.Add(duration)
+		ban.ExpiresAt = &expires
+	}
+	err = b.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "ip"}},
+		DoUpdates: clause.AssignmentColumns([]string{"reason", "expires_at", "created_at"}),
+	}).Create(&ban).Error
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	if b.ips != nil {
+		b.add(ban)
+	}
+	b.mu.Unlock()
+	return nil
+}
+
+// Unban lifts the ban on an IP address or CIDR range
+func (b *BanList) Unban(ctx context.Context, target string) error {
+	ip, err := ParseBanTarget(target)
+	if err != nil {
+		return err
+	}
+	if err := b.db.WithContext(ctx).Where("ip = ?", ip).Delete(&Ban{}).Error; err != nil {
+		return err
+	}
+	b.mu.Lock()
+	b.loadedAt = time.Time{}
+	b.mu.Unlock()
+	return nil
+}
+
+// List returns the bans in force, newest first, removing expired ones
+func (b *BanList) List(ctx context.Context) ([]Ban, error) {
+	db := b.db.WithContext(ctx)
+	now := time.Now()
+	if err := db.Where("expires_at IS NOT NULL AND expires_at <= ?", now).Delete(&Ban{}).Error; err != nil {
+		return nil, err
+	}
+	var bans []Ban
+	err := db.Order("created_at DESC").Find(&bans).Error
+	return bans, err
+}
+
+// Banned returns the ban covering an IP, if any
+func (b *BanList) Banned(ctx context.Context, ip string) (Ban, bool, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return Ban{}, false, nil
+	}
+	addr = addr.Unmap()
+	if err := b.load(ctx); err != nil {
+		return Ban{}, false, err
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	now := time.Now()
+	if ban, ok := b.ips[addr]; ok && !ban.Expired(now) {
+		return ban, true, nil
+	}
+	for prefix, ban := range b.ranges {
+		if prefix.Contains(addr) && !ban.Expired(now) {
+			return ban, true, nil
+		}
+	}
+	return Ban{}, false, nil
+}
+
+// load reloads the bans once refresh has passed
+func (b *BanList) load(ctx context.Context) error {
+	b.mu.RLock()
+	fresh := b.ips != nil && time.Since(b.loadedAt) < b.refresh
+	b.mu.RUnlock()
+	if fresh {
+		return nil
+	}
+
+	var bans []Ban
+	if err := b.db.WithContext(ctx).Where("expires_at IS NULL OR expires_at > ?", time.Now()).Find(&bans).Error; err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.ips = make(map[netip.Addr]Ban, len(bans))
+	b.ranges = make(map[netip.Prefix]Ban)
+	for _, ban := range bans {
+		b.add(ban)
+	}
+	b.loadedAt = time.Now()
+	return nil
+}
+
+func (b *BanList) add(ban Ban) {
+	if prefix, err := netip.ParsePrefix(ban.IP); err == nil {
+		b.ranges[prefix] = ban
+	} else if addr, err := netip.ParseAddr(ban.IP); err == nil {
+		b.ips[addr] = ban
+	}
+}
+
+// BanMiddleware refuses requests from banned IPs with 403 Forbidden. It
+// goes after RealIP, whose address it checks; ban list errors let
+// requests through.
+func BanMiddleware(bans *BanList, logger *zap.Logger) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := RemoteIP(r)
+			ban, banned, err := bans.Banned(r.Context(), ip)
+			if err != nil {
+				logger.Error("Ban list check failed", zap.Error(err))
+			}
+			if banned {
+				logger.Debug("Refused banned IP", zap.String("ip", ip), zap.String("reason", ban.Reason))
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RemoteIP returns the IP of r.RemoteAddr, which RealIP sets from the
+// trusted proxies' headers
+func RemoteIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
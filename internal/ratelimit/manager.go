@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -89,7 +90,9 @@ func (r *RedisRateLimiter) Reset(ctx context.Context, key string) error {
 
 // MemoryRateLimiter implements rate limiting using in-memory storage
 type MemoryRateLimiter struct {
+	mu    sync.Mutex
 	store map[string]*rateLimitData
+	swept time.Time
 }
 
 type rateLimitData struct {
@@ -106,10 +109,15 @@ func NewMemoryRateLimiter() *MemoryRateLimiter {
 
 // Allow checks if a request is allowed within the rate limit
 func (m *MemoryRateLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	now := time.Now()
 	windowStart := now.Truncate(window)
 	windowKey := fmt.Sprintf("%s:%d", key, windowStart.Unix())
 
+	m.sweep(now)
+
 	data, exists := m.store[windowKey]
 	if !exists || now.After(data.windowEnd) {
 		// New window or expired window
@@ -128,8 +136,25 @@ func (m *MemoryRateLimiter) Allow(ctx context.Context, key string, limit int, wi
 	return true, nil
 }
 
+// sweep drops the windows that have ended, at most once a minute, so
+// counts for clients long gone don't pile up
+func (m *MemoryRateLimiter) sweep(now time.Time) {
+	if now.Sub(m.swept) < time.Minute {
+		return
+	}
+	m.swept = now
+	for k, data := range m.store {
+		if now.After(data.windowEnd) {
+			delete(m.store, k)
+		}
+	}
+}
+
 // Remaining returns the number of remaining requests
 func (m *MemoryRateLimiter) Remaining(ctx context.Context, key string, limit int, window time.Duration) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	now := time.Now()
 	windowStart := now.Truncate(window)
 	windowKey := fmt.Sprintf("%s:%d", key, windowStart.Unix())
@@ -149,6 +174,9 @@ func (m *MemoryRateLimiter) Remaining(ctx context.Context, key string, limit int
 
 // Reset resets the rate limit for a key
 func (m *MemoryRateLimiter) Reset(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	// Remove all windows for this key
 	for k := range m.store {
 		if strings.HasPrefix(k, key+":") {
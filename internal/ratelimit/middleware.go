@@ -1,6 +1,7 @@
 package ratelimit
 
 import (
+	"math"
 	"net"
 	"net/http"
 	"strconv"
@@ -10,6 +11,8 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
 	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/problem"
 )
 
 // RateLimitMiddleware creates a rate limiting middleware
@@ -196,3 +199,40 @@ func getClientIP(r *http.Request) string {
 
 	return ip
 }
+
+// NamedRateLimitMiddleware limits requests per key under a named limiter,
+// whose counts are kept apart from other limiters'. Refused requests get
+// 429 Too Many Requests with Retry-After; limiter errors let them through.
+func NamedRateLimitMiddleware(name string, limit int, window time.Duration, key func(r *http.Request) string, limiter RateLimiter, logger *zap.Logger) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			counted := name + ":" + key(r)
+
+			allowed, err := limiter.Allow(ctx, counted, limit, window)
+			if err != nil {
+				logger.Error("Rate limit check failed", zap.String("limiter", name), zap.Error(err))
+				next.ServeHTTP(w, r)
+				return
+			}
+			remaining, err := limiter.Remaining(ctx, counted, limit, window)
+			if err != nil {
+				remaining = 0
+			}
+
+			reset := time.Now().Truncate(window).Add(window)
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+
+			if !allowed {
+				logger.Warn("Rate limit exceeded", zap.String("limiter", name), zap.String("key", counted))
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(reset).Seconds()))))
+				problem.Write(w, r, problem.New(http.StatusTooManyRequests, "Too many requests. Please try again later."))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
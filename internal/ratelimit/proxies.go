@@ -0,0 +1,91 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ParsePrefixes parses IP addresses and CIDR ranges, an address becoming
+// the range of just itself
+func ParsePrefixes(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		target, err := ParseBanTarget(strings.TrimSpace(entry))
+		if err != nil {
+			return nil, err
+		}
+		prefix, err := netip.ParsePrefix(target)
+		if err != nil {
+			addr := netip.MustParseAddr(target)
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes, nil
+}
+
+// ContainsIP reports whether one of prefixes contains ip
+func ContainsIP(prefixes []netip.Prefix, ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// RealIP sets r.RemoteAddr to the client's IP from X-Forwarded-For,
+// X-Real-IP or True-Client-IP, believing them only from trusted proxies.
+// Unlike chi's middleware.RealIP, a client connecting directly can't
+// claim another IP, so RemoteIP can be relied on for bans and rate
+// limits. X-Forwarded-For is read from the right, the client being the
+// first hop that isn't a trusted proxy.
+func RealIP(trusted []netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ip, ok := forwardedIP(r, trusted); ok {
+				r.RemoteAddr = ip
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// forwardedIP returns the client IP the trusted proxies in front of r
+// forwarded, false when r didn't come through one
+func forwardedIP(r *http.Request, trusted []netip.Prefix) (string, bool) {
+	if !ContainsIP(trusted, RemoteIP(r)) {
+		return "", false
+	}
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		client := ""
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if _, err := netip.ParseAddr(hop); err != nil {
+				break
+			}
+			client = hop
+			if !ContainsIP(trusted, hop) {
+				break
+			}
+		}
+		if client != "" {
+			return client, true
+		}
+	}
+	for _, header := range []string{"X-Real-IP", "True-Client-IP"} {
+		if ip := strings.TrimSpace(r.Header.Get(header)); ip != "" {
+			if _, err := netip.ParseAddr(ip); err == nil {
+				return ip, true
+			}
+		}
+	}
+	return "", false
+}
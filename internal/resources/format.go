@@ -0,0 +1,620 @@
+package resources
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/vmihailenco/msgpack/v5"
+
+	"github.com/mrhoseah/dolphin/internal/problem"
+)
+
+// Format is a response serialization format
+type Format string
+
+const (
+	FormatJSON    Format = "json"
+	FormatXML     Format = "xml"
+	FormatCSV     Format = "csv"
+	FormatMsgpack Format = "msgpack"
+
+	// FormatHTML is offered by responses with a Page, see Write
+	FormatHTML Format = "html"
+)
+
+// Renderer writes v as a response body in one format
+type Renderer func(w io.Writer, v interface{}) error
+
+// Page writes v as the HTML page browsers are shown, such as a template
+// executed with it
+type Page func(w io.Writer, v interface{}) error
+
+// renderer is a registered format and the Content-Type it is sent with
+type renderer struct {
+	contentType string
+	render      Renderer
+}
+
+// formats holds the registered renderers and the media types of Accept
+// headers that select them
+var formats = struct {
+	sync.RWMutex
+	renderers map[Format]renderer
+	types     map[string]Format
+}{
+	renderers: map[Format]renderer{},
+	types:     map[string]Format{"text/html": FormatHTML, "application/xhtml+xml": FormatHTML},
+}
+
+func init() {
+	RegisterFormat(FormatJSON, "application/json", renderJSON)
+	RegisterFormat(FormatXML, "application/xml; charset=utf-8", renderXML, "text/xml")
+	RegisterFormat(FormatCSV, "text/csv; charset=utf-8", renderCSV)
+	RegisterFormat(FormatMsgpack, "application/msgpack", renderMsgpack, "application/x-msgpack", "application/vnd.msgpack")
+}
+
+// RegisterFormat adds a response format, or replaces the renderer of one.
+// Responses in it are sent with contentType, and Accept headers select it
+// by that media type or any of mediaTypes. Like XML and CSV, the format
+// must still be enabled on the routes that offer it with WithFormats.
+func RegisterFormat(format Format, contentType string, render Renderer, mediaTypes ...string) {
+	formats.Lock()
+	defer formats.Unlock()
+	formats.renderers[format] = renderer{contentType: contentType, render: render}
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		formats.types[mediaType] = format
+	}
+	for _, mediaType := range mediaTypes {
+		formats.types[mediaType] = format
+	}
+}
+
+// Registered reports whether format has a renderer
+func Registered(format Format) bool {
+	formats.RLock()
+	defer formats.RUnlock()
+	_, ok := formats.renderers[format]
+	return ok
+}
+
+// formatsKey is the context key for the formats allowed on a route group
+type formatsKey struct{}
+
+// WithFormats returns middleware that enables extra response formats for a
+// route group, adding to those enabled around it. JSON is always
+// available; XML, CSV, msgpack and formats added with RegisterFormat must
+// be opted into.
+func WithFormats(formats ...Format) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			allowed := maps.Clone(allowedFormats(r))
+			for _, f := range formats {
+				allowed[f] = true
+			}
+			ctx := context.WithValue(r.Context(), formatsKey{}, allowed)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// allowedFormats returns the formats enabled for the request
+func allowedFormats(r *http.Request) map[Format]bool {
+	if allowed, ok := r.Context().Value(formatsKey{}).(map[Format]bool); ok {
+		return allowed
+	}
+	return map[Format]bool{FormatJSON: true}
+}
+
+// Negotiate picks the response format from ?format= or the Accept header.
+// An explicit ?format= that is not enabled reports ok=false; Accept values
+// that cannot be satisfied fall back to JSON.
+func Negotiate(r *http.Request) (format Format, ok bool) {
+	return negotiate(r, allowedFormats(r))
+}
+
+// negotiate picks a format among allowed. HTML is only chosen by Accept
+// outside /api, where it is also what */* and unsatisfiable Accept
+// headers get instead of JSON.
+func negotiate(r *http.Request, allowed map[Format]bool) (Format, bool) {
+	if raw := r.URL.Query().Get("format"); raw != "" {
+		format := Format(strings.ToLower(raw))
+		return format, allowed[format] && (format == FormatHTML || Registered(format))
+	}
+
+	fallback := FormatJSON
+	if allowed[FormatHTML] && !strings.HasPrefix(r.URL.Path, "/api/") {
+		fallback = FormatHTML
+	}
+	formats.RLock()
+	defer formats.RUnlock()
+	for _, mediaType := range acceptedTypes(r.Header.Get("Accept")) {
+		if mediaType == "*/*" {
+			return fallback, true
+		}
+		if mediaType == "application/*" {
+			return FormatJSON, true
+		}
+		f, known := formats.types[mediaType]
+		if !known || !allowed[f] || (f == FormatHTML && fallback != FormatHTML) {
+			continue
+		}
+		if _, ok := formats.renderers[f]; ok || f == FormatHTML {
+			return f, true
+		}
+	}
+	return fallback, true
+}
+
+// acceptedTypes returns the media types of an Accept header ordered by q
+func acceptedTypes(header string) []string {
+	type accepted struct {
+		mediaType string
+		q         float64
+	}
+	var types []accepted
+	for _, part := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if raw, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(raw, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q > 0 {
+			types = append(types, accepted{mediaType: mediaType, q: q})
+		}
+	}
+	sort.SliceStable(types, func(i, j int) bool { return types[i].q > types[j].q })
+
+	result := make([]string, len(types))
+	for i, t := range types {
+		result[i] = t.mediaType
+	}
+	return result
+}
+
+// Respond writes v in the negotiated format. Resource envelopes, plain maps
+// and structs are supported; structs honor `xml` and `csv` tags.
+func Respond(w http.ResponseWriter, r *http.Request, v interface{}) {
+	format, ok := Negotiate(r)
+	if !ok {
+		render.Status(r, http.StatusNotAcceptable)
+		render.JSON(w, r, map[string]string{"error": fmt.Sprintf("Format %q is not available", format)})
+		return
+	}
+
+	status := http.StatusOK
+	if s, ok := r.Context().Value(render.StatusCtxKey).(int); ok {
+		status = s
+	}
+	if err := send(w, format, status, v, nil); err != nil {
+		http.Error(w, "Failed to encode "+strings.ToUpper(string(format)), http.StatusInternalServerError)
+	}
+}
+
+// Write writes v with status in the format the request negotiates, as
+// Respond does, or as HTML with page for browsers when page isn't nil.
+// Nothing is written on failure, so the error can be reported instead: a
+// 406 problem when the requested format isn't available, or why v
+// couldn't be encoded.
+func Write(w http.ResponseWriter, r *http.Request, status int, v interface{}, page Page) error {
+	allowed := allowedFormats(r)
+	if page != nil {
+		allowed = maps.Clone(allowed)
+		allowed[FormatHTML] = true
+	}
+	format, ok := negotiate(r, allowed)
+	if !ok {
+		return problem.New(http.StatusNotAcceptable, fmt.Sprintf("Format %q is not available", format))
+	}
+	return send(w, format, status, v, page)
+}
+
+// send encodes v in format before sending it, so a failure is returned
+// rather than sent as half a body
+func send(w http.ResponseWriter, format Format, status int, v interface{}, page Page) error {
+	contentType, render := "text/html; charset=utf-8", Renderer(page)
+	if format != FormatHTML {
+		formats.RLock()
+		registered := formats.renderers[format]
+		formats.RUnlock()
+		contentType, render = registered.contentType, registered.render
+	}
+
+	var buf bytes.Buffer
+	if err := render(&buf, v); err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(status)
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// renderJSON encodes v as render.JSON does
+func renderJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(true)
+	return enc.Encode(v)
+}
+
+func renderXML(w io.Writer, v interface{}) error {
+	body, err := EncodeXML("response", v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(body)
+	return err
+}
+
+func renderCSV(w io.Writer, v interface{}) error {
+	body, err := EncodeCSV(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(body)
+	return err
+}
+
+// renderMsgpack encodes the JSON shape of v, so field names and custom
+// marshalers match the JSON API
+func renderMsgpack(w io.Writer, v interface{}) error {
+	generic, err := jsonShape(v)
+	if err != nil {
+		return err
+	}
+	return msgpack.NewEncoder(w).Encode(msgpackNumbers(generic))
+}
+
+// msgpackNumbers replaces the json.Numbers of a JSON shape with integers,
+// or floats when they have a fraction
+func msgpackNumbers(v interface{}) interface{} {
+	switch val := v.(type) {
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return i
+		}
+		f, _ := val.Float64()
+		return f
+	case map[string]interface{}:
+		for k, item := range val {
+			val[k] = msgpackNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range val {
+			val[i] = msgpackNumbers(item)
+		}
+	}
+	return v
+}
+
+// enveloped is implemented by responses whose CSV form is only their data
+type enveloped interface {
+	payload() interface{}
+}
+
+func (p PaginatedResponse) payload() interface{}       { return p.Data }
+func (p CursorPaginatedResponse) payload() interface{} { return p.Data }
+
+// EncodeXML encodes v as an XML document with the given root element.
+// Maps become elements named after their keys and slices repeat <item>.
+func EncodeXML(root string, v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	if err := writeXML(enc, root, v); err != nil {
+		return nil, err
+	}
+	if err := enc.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeXML writes a single named element
+func writeXML(enc *xml.Encoder, name string, v interface{}) error {
+	start := xml.StartElement{Name: xml.Name{Local: xmlName(name)}}
+
+	if v == nil {
+		return enc.EncodeElement("", start)
+	}
+
+	switch val := v.(type) {
+	case map[string]interface{}:
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		for _, k := range sortedKeys(val) {
+			if err := writeXML(enc, k, val[k]); err != nil {
+				return err
+			}
+		}
+		return enc.EncodeToken(start.End())
+	case time.Time:
+		return enc.EncodeElement(val.Format(time.RFC3339), start)
+	case json.Number, string, bool, int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64, float32, float64:
+		return enc.EncodeElement(val, start)
+	case fmt.Stringer:
+		return enc.EncodeElement(val.String(), start)
+	}
+
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return enc.EncodeElement("", start)
+		}
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return enc.EncodeElement(rv.Interface(), start)
+		}
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		for i := 0; i < rv.Len(); i++ {
+			if err := writeXML(enc, "item", rv.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		return enc.EncodeToken(start.End())
+	case reflect.Struct:
+		// Structs with xml tags are encoded as declared
+		if hasTag(rv.Type(), "xml") {
+			return enc.EncodeElement(rv.Interface(), start)
+		}
+	}
+
+	// Anything else takes its JSON shape, so field names match the JSON API
+	generic, err := jsonShape(rv.Interface())
+	if err != nil {
+		return err
+	}
+	return writeXML(enc, name, generic)
+}
+
+// xmlName turns a key into a valid XML element name
+func xmlName(name string) string {
+	if name == "" {
+		return "item"
+	}
+	var b strings.Builder
+	for i, r := range name {
+		valid := r == '_' || r == '-' || r == '.' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+		if !valid || (i == 0 && (r == '-' || r == '.' || (r >= '0' && r <= '9'))) {
+			b.WriteByte('_')
+			if valid {
+				b.WriteRune(r)
+			}
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// EncodeCSV encodes v as CSV with a header row. Envelopes are unwrapped to
+// their data; nested maps are flattened to dotted columns and lists are
+// written as JSON.
+func EncodeCSV(v interface{}) ([]byte, error) {
+	if env, ok := v.(enveloped); ok {
+		v = env.payload()
+	} else if m, ok := v.(map[string]interface{}); ok {
+		if data, ok := m["data"]; ok {
+			v = data
+		}
+	}
+
+	var rows [][]csvCell
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() != reflect.Uint8 {
+		for i := 0; i < rv.Len(); i++ {
+			row, err := csvRow(rv.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, row)
+		}
+	} else if v != nil {
+		row, err := csvRow(v)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+
+	// Columns follow first appearance so struct field order is kept
+	var header []string
+	index := map[string]int{}
+	for _, row := range rows {
+		for _, cell := range row {
+			if _, seen := index[cell.column]; !seen {
+				index[cell.column] = len(header)
+				header = append(header, cell.column)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	if err := writer.Write(header); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		record := make([]string, len(header))
+		for _, cell := range row {
+			record[index[cell.column]] = cell.value
+		}
+		if err := writer.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+// csvCell is one column of a CSV row
+type csvCell struct {
+	column string
+	value  string
+}
+
+// csvRow flattens a single item into cells
+func csvRow(v interface{}) ([]csvCell, error) {
+	var cells []csvCell
+	if err := flattenCSV("", v, &cells); err != nil {
+		return nil, err
+	}
+	// Scalar rows have no column name of their own
+	for i := range cells {
+		if cells[i].column == "" {
+			cells[i].column = "value"
+		}
+	}
+	return cells, nil
+}
+
+// flattenCSV appends the cells for v under prefix
+func flattenCSV(prefix string, v interface{}, cells *[]csvCell) error {
+	column := func(name string) string {
+		if prefix == "" {
+			return name
+		}
+		return prefix + "." + name
+	}
+
+	switch val := v.(type) {
+	case nil:
+		*cells = append(*cells, csvCell{column: prefix, value: ""})
+		return nil
+	case map[string]interface{}:
+		for _, k := range sortedKeys(val) {
+			if err := flattenCSV(column(k), val[k], cells); err != nil {
+				return err
+			}
+		}
+		return nil
+	case time.Time:
+		*cells = append(*cells, csvCell{column: prefix, value: val.Format(time.RFC3339)})
+		return nil
+	case fmt.Stringer:
+		*cells = append(*cells, csvCell{column: prefix, value: val.String()})
+		return nil
+	}
+
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			*cells = append(*cells, csvCell{column: prefix, value: ""})
+			return nil
+		}
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Struct:
+		typ := rv.Type()
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, skip := csvFieldName(field)
+			if skip {
+				continue
+			}
+			if field.Anonymous && field.Type.Kind() == reflect.Struct && field.Tag.Get("csv") == "" {
+				if err := flattenCSV(prefix, rv.Field(i).Interface(), cells); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := flattenCSV(column(name), rv.Field(i).Interface(), cells); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map, reflect.Slice, reflect.Array:
+		raw, err := json.Marshal(rv.Interface())
+		if err != nil {
+			return err
+		}
+		*cells = append(*cells, csvCell{column: prefix, value: string(raw)})
+		return nil
+	default:
+		*cells = append(*cells, csvCell{column: prefix, value: fmt.Sprint(rv.Interface())})
+		return nil
+	}
+}
+
+// csvFieldName returns the column for a struct field from its csv tag,
+// then json tag, then Go name
+func csvFieldName(field reflect.StructField) (string, bool) {
+	for _, key := range []string{"csv", "json"} {
+		tag := field.Tag.Get(key)
+		if tag == "-" {
+			return "", true
+		}
+		if name := strings.Split(tag, ",")[0]; name != "" {
+			return name, false
+		}
+	}
+	return field.Name, false
+}
+
+// hasTag reports whether any field of a struct type declares the tag
+func hasTag(typ reflect.Type, key string) bool {
+	for i := 0; i < typ.NumField(); i++ {
+		if _, ok := typ.Field(i).Tag.Lookup(key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonShape converts v into generic maps and slices via its JSON encoding
+func jsonShape(v interface{}) (interface{}, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return generic, nil
+}
+
+// sortedKeys returns map keys in a stable order
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
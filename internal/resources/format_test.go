@@ -0,0 +1,164 @@
+package resources
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/vmihailenco/msgpack/v5"
+
+	"github.com/mrhoseah/dolphin/internal/problem"
+)
+
+type taggedUser struct {
+	ID       int    `xml:"id,attr" csv:"user_id"`
+	Name     string `xml:"full-name" csv:"name"`
+	Password string `xml:"-" csv:"-"`
+}
+
+func TestNegotiate(t *testing.T) {
+	handler := WithFormats(FormatXML)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Respond(w, r, map[string]interface{}{"data": map[string]interface{}{"id": 1}})
+	}))
+
+	tests := []struct {
+		target, accept, contentType string
+		status                      int
+	}{
+		{"/users", "", "application/json", http.StatusOK},
+		{"/users", "application/xml", "application/xml", http.StatusOK},
+		{"/users", "text/csv;q=0.9, application/xml;q=0.5", "application/xml", http.StatusOK},
+		{"/users?format=xml", "application/json", "application/xml", http.StatusOK},
+		{"/users", "text/csv", "application/json", http.StatusOK},
+		{"/users?format=csv", "", "application/json", http.StatusNotAcceptable},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.target, nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != tt.status || !strings.HasPrefix(rec.Header().Get("Content-Type"), tt.contentType) {
+			t.Errorf("%s (Accept %q): got %d %s", tt.target, tt.accept, rec.Code, rec.Header().Get("Content-Type"))
+		}
+	}
+}
+
+func TestEncodeXML(t *testing.T) {
+	body, err := EncodeXML("response", map[string]interface{}{
+		"data": []interface{}{
+			map[string]interface{}{"id": 1, "2fa": true},
+			taggedUser{ID: 2, Name: "Ada", Password: "secret"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	out := string(body)
+	for _, want := range []string{"<response><data><item>", "<_2fa>true</_2fa>", `<item id="2"><full-name>Ada</full-name></item>`} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %q in %s", want, out)
+		}
+	}
+	if strings.Contains(out, "secret") {
+		t.Fatalf("expected xml:\"-\" field to be skipped: %s", out)
+	}
+}
+
+func TestEncodeCSV(t *testing.T) {
+	body, err := EncodeCSV(map[string]interface{}{
+		"data": []map[string]interface{}{
+			{"id": 1, "author": map[string]interface{}{"name": "Ada"}, "tags": []string{"a", "b"}},
+			{"id": 2, "title": "Hello, world"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "author.name,id,tags,title\nAda,1,\"[\"\"a\"\",\"\"b\"\"]\",\n,2,,\"Hello, world\"\n"
+	if string(body) != want {
+		t.Fatalf("unexpected CSV:\n%s", body)
+	}
+
+	body, _ = EncodeCSV([]taggedUser{{ID: 1, Name: "Ada", Password: "secret"}})
+	if string(body) != "user_id,name\n1,Ada\n" {
+		t.Fatalf("expected csv tags to be honored, got:\n%s", body)
+	}
+}
+
+func TestWriteNegotiatesPagesAndRegisteredFormats(t *testing.T) {
+	page := func(w io.Writer, v interface{}) error {
+		_, err := fmt.Fprintf(w, "<h1>%v</h1>", v.(map[string]interface{})["id"])
+		return err
+	}
+	handler := WithFormats(FormatMsgpack)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := Write(w, r, http.StatusCreated, map[string]interface{}{"id": 7}, page); err != nil {
+			problem.Write(w, r, err)
+		}
+	}))
+
+	tests := []struct {
+		target, accept, contentType string
+		status                      int
+	}{
+		{"/posts", "text/html,application/xhtml+xml,*/*;q=0.8", "text/html", http.StatusCreated},
+		{"/posts", "*/*", "text/html", http.StatusCreated},
+		{"/posts", "application/json", "application/json", http.StatusCreated},
+		{"/posts", "application/x-msgpack", "application/msgpack", http.StatusCreated},
+		{"/api/posts", "text/html,*/*;q=0.8", "application/json", http.StatusCreated},
+		{"/api/posts?format=html", "", "text/html", http.StatusCreated},
+		{"/api/posts?format=xml", "", "application/problem+json", http.StatusNotAcceptable},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.target, nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != tt.status || !strings.HasPrefix(rec.Header().Get("Content-Type"), tt.contentType) {
+			t.Errorf("%s (Accept %q): got %d %s", tt.target, tt.accept, rec.Code, rec.Header().Get("Content-Type"))
+		}
+		if tt.status == http.StatusCreated && rec.Header().Get("Vary") != "Accept" {
+			t.Errorf("%s (Accept %q): expected Vary: Accept", tt.target, tt.accept)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/api/posts?format=msgpack", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	var decoded struct {
+		ID int `msgpack:"id"`
+	}
+	if err := msgpack.Unmarshal(rec.Body.Bytes(), &decoded); err != nil || decoded.ID != 7 {
+		t.Fatalf("expected the id as an integer, got %#v (%v)", decoded, err)
+	}
+
+	RegisterFormat("text", "text/plain; charset=utf-8", func(w io.Writer, v interface{}) error {
+		_, err := fmt.Fprint(w, v)
+		return err
+	})
+	req = httptest.NewRequest("GET", "/api/posts", nil)
+	req.Header.Set("Accept", "text/plain")
+	rec = httptest.NewRecorder()
+	WithFormats("text")(handler).ServeHTTP(rec, req)
+	if rec.Body.String() != "map[id:7]" {
+		t.Fatalf("expected the registered format, got %q", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	err := Write(rec, httptest.NewRequest("GET", "/posts", nil), http.StatusOK, nil, func(w io.Writer, v interface{}) error {
+		return errors.New("missing template")
+	})
+	if err == nil || rec.Body.Len() != 0 {
+		t.Fatalf("expected a failing page to write nothing, got %q (%v)", rec.Body.String(), err)
+	}
+}
@@ -0,0 +1,178 @@
+package resources
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// PageMeta describes an offset-paginated result set
+type PageMeta struct {
+	CurrentPage int   `json:"current_page"`
+	PerPage     int   `json:"per_page"`
+	Total       int64 `json:"total"`
+	LastPage    int   `json:"last_page"`
+	From        int   `json:"from"`
+	To          int   `json:"to"`
+}
+
+// PageLinks holds navigation links for a paginated result set
+type PageLinks struct {
+	First string `json:"first"`
+	Last  string `json:"last"`
+	Prev  string `json:"prev,omitempty"`
+	Next  string `json:"next,omitempty"`
+}
+
+// PaginatedResponse is the envelope returned for paginated collections
+type PaginatedResponse struct {
+	Data  []map[string]interface{} `json:"data"`
+	Meta  PageMeta                 `json:"meta"`
+	Links PageLinks                `json:"links"`
+}
+
+// NewPageMeta computes pagination metadata
+func NewPageMeta(page, perPage int, total int64, count int) PageMeta {
+	if perPage <= 0 {
+		perPage = 15
+	}
+	if page <= 0 {
+		page = 1
+	}
+
+	lastPage := int(math.Ceil(float64(total) / float64(perPage)))
+	if lastPage < 1 {
+		lastPage = 1
+	}
+
+	meta := PageMeta{
+		CurrentPage: page,
+		PerPage:     perPage,
+		Total:       total,
+		LastPage:    lastPage,
+	}
+	if count > 0 {
+		meta.From = (page-1)*perPage + 1
+		meta.To = meta.From + count - 1
+	}
+	return meta
+}
+
+// Paginate builds a paginated envelope for the given resources
+func Paginate(ctx context.Context, base *url.URL, items []Resource, page, perPage int, total int64) PaginatedResponse {
+	meta := NewPageMeta(page, perPage, total, len(items))
+	return PaginatedResponse{
+		Data:  Collection(ctx, items),
+		Meta:  meta,
+		Links: pageLinks(base, meta),
+	}
+}
+
+// RenderPaginated writes a paginated envelope using the request URL for links
+func RenderPaginated(w http.ResponseWriter, r *http.Request, items []Resource, page, perPage int, total int64) {
+	Respond(w, r, Paginate(FromRequest(r), r.URL, items, page, perPage, total))
+}
+
+// PageParams reads page and per_page from the query string with defaults
+func PageParams(r *http.Request, defaultPerPage, maxPerPage int) (page, perPage int) {
+	page, _ = strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	perPage, _ = strconv.Atoi(r.URL.Query().Get("per_page"))
+	if perPage < 1 {
+		perPage = defaultPerPage
+	}
+	if maxPerPage > 0 && perPage > maxPerPage {
+		perPage = maxPerPage
+	}
+	return page, perPage
+}
+
+// pageLinks builds first/last/prev/next links preserving other query params
+func pageLinks(base *url.URL, meta PageMeta) PageLinks {
+	link := func(page int) string {
+		if base == nil {
+			return "?page=" + strconv.Itoa(page)
+		}
+		u := *base
+		q := u.Query()
+		q.Set("page", strconv.Itoa(page))
+		q.Set("per_page", strconv.Itoa(meta.PerPage))
+		u.RawQuery = q.Encode()
+		return u.RequestURI()
+	}
+
+	links := PageLinks{
+		First: link(1),
+		Last:  link(meta.LastPage),
+	}
+	if meta.CurrentPage > 1 {
+		links.Prev = link(meta.CurrentPage - 1)
+	}
+	if meta.CurrentPage < meta.LastPage {
+		links.Next = link(meta.CurrentPage + 1)
+	}
+	return links
+}
+
+// CursorMeta describes a keyset-paginated result set
+type CursorMeta struct {
+	PerPage    int    `json:"per_page"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+}
+
+// CursorLinks holds navigation links for a keyset-paginated result set
+type CursorLinks struct {
+	Prev string `json:"prev,omitempty"`
+	Next string `json:"next,omitempty"`
+}
+
+// CursorPaginatedResponse is the envelope returned for cursor paginated collections
+type CursorPaginatedResponse struct {
+	Data  []map[string]interface{} `json:"data"`
+	Meta  CursorMeta               `json:"meta"`
+	Links CursorLinks              `json:"links"`
+}
+
+// CursorPaginate builds a cursor paginated envelope for the given resources.
+// Links use page[after] / page[before] so they round-trip through the query package.
+func CursorPaginate(ctx context.Context, base *url.URL, items []Resource, perPage int, next, prev string) CursorPaginatedResponse {
+	link := func(param, cursor string) string {
+		if cursor == "" {
+			return ""
+		}
+		u := url.URL{}
+		if base != nil {
+			u = *base
+		}
+		q := u.Query()
+		q.Del("page[after]")
+		q.Del("page[before]")
+		q.Set(param, cursor)
+		q.Set("page[size]", strconv.Itoa(perPage))
+		u.RawQuery = q.Encode()
+		return u.RequestURI()
+	}
+
+	return CursorPaginatedResponse{
+		Data: Collection(ctx, items),
+		Meta: CursorMeta{
+			PerPage:    perPage,
+			NextCursor: next,
+			PrevCursor: prev,
+		},
+		Links: CursorLinks{
+			Prev: link("page[before]", prev),
+			Next: link("page[after]", next),
+		},
+	}
+}
+
+// RenderCursorPaginated writes a cursor paginated envelope using the request URL for links
+func RenderCursorPaginated(w http.ResponseWriter, r *http.Request, items []Resource, perPage int, next, prev string) {
+	Respond(w, r, CursorPaginate(FromRequest(r), r.URL, items, perPage, next, prev))
+}
@@ -0,0 +1,226 @@
+package resources
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Resource transforms a model into its serialized API representation
+type Resource interface {
+	ToMap(ctx context.Context) map[string]interface{}
+}
+
+// ResourceFunc adapts a plain function to the Resource interface
+type ResourceFunc func(ctx context.Context) map[string]interface{}
+
+// ToMap calls f(ctx)
+func (f ResourceFunc) ToMap(ctx context.Context) map[string]interface{} {
+	return f(ctx)
+}
+
+// missingValue marks a conditional field that should be omitted
+type missingValue struct{}
+
+// Missing is returned by conditional helpers when a field should be dropped
+var Missing = missingValue{}
+
+// When returns value if condition is true, otherwise the field is omitted
+func When(condition bool, value interface{}) interface{} {
+	if condition {
+		return value
+	}
+	return Missing
+}
+
+// WhenFunc lazily evaluates fn only if condition is true
+func WhenFunc(condition bool, fn func() interface{}) interface{} {
+	if condition {
+		return fn()
+	}
+	return Missing
+}
+
+// WhenNotNil omits the field when value is nil
+func WhenNotNil(value interface{}) interface{} {
+	if value == nil {
+		return Missing
+	}
+	return value
+}
+
+// MergeWhen merges attributes into the output map when condition is true
+func MergeWhen(condition bool, attributes map[string]interface{}) interface{} {
+	if condition {
+		return mergeValue(attributes)
+	}
+	return Missing
+}
+
+// mergeValue carries attributes to be flattened into the parent map
+type mergeValue map[string]interface{}
+
+// WhenIncluded evaluates fn with a context scoped to the relation when it
+// was requested via ?include=, otherwise the field is omitted
+func WhenIncluded(ctx context.Context, relation string, fn func(ctx context.Context) interface{}) interface{} {
+	if !Included(ctx, relation) {
+		return Missing
+	}
+	nested := Nested(ctx, relation)
+	return resolveValue(nested, fn(nested))
+}
+
+// Item resolves a single resource into a clean map
+func Item(ctx context.Context, res Resource) map[string]interface{} {
+	if res == nil {
+		return nil
+	}
+	return resolve(ctx, res.ToMap(ctx))
+}
+
+// Collection resolves a list of resources
+func Collection(ctx context.Context, items []Resource) []map[string]interface{} {
+	result := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		result = append(result, Item(ctx, item))
+	}
+	return result
+}
+
+// CollectionOf maps a typed slice through a resource constructor
+func CollectionOf[T any](ctx context.Context, items []T, fn func(T) Resource) []map[string]interface{} {
+	result := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		result = append(result, Item(ctx, fn(item)))
+	}
+	return result
+}
+
+// resolve drops missing values, flattens merges and resolves nested resources
+func resolve(ctx context.Context, data map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(data))
+
+	// Sorted keys keep merge precedence deterministic
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		switch v := data[k].(type) {
+		case missingValue:
+			continue
+		case mergeValue:
+			for mk, mv := range resolve(ctx, v) {
+				out[mk] = mv
+			}
+		default:
+			out[k] = resolveValue(ctx, v)
+		}
+	}
+	return out
+}
+
+// resolveValue converts nested resources into maps
+func resolveValue(ctx context.Context, value interface{}) interface{} {
+	switch v := value.(type) {
+	case Resource:
+		return Item(ctx, v)
+	case []Resource:
+		return Collection(ctx, v)
+	case map[string]interface{}:
+		return resolve(ctx, v)
+	default:
+		return v
+	}
+}
+
+// Render writes a single resource wrapped in a data envelope
+func Render(w http.ResponseWriter, r *http.Request, res Resource) {
+	ctx := FromRequest(r)
+	Respond(w, r, map[string]interface{}{
+		"data": Item(ctx, res),
+	})
+}
+
+// RenderCollection writes a list of resources wrapped in a data envelope
+func RenderCollection(w http.ResponseWriter, r *http.Request, items []Resource) {
+	ctx := FromRequest(r)
+	Respond(w, r, map[string]interface{}{
+		"data": Collection(ctx, items),
+	})
+}
+
+// FromRequest returns the request context carrying parsed includes
+func FromRequest(r *http.Request) context.Context {
+	ctx := r.Context()
+	if _, ok := ctx.Value(includesKey{}).(IncludeTree); ok {
+		return ctx
+	}
+	return WithIncludes(ctx, ParseIncludes(r.URL.Query().Get("include")))
+}
+
+// includesKey is the context key for the include tree
+type includesKey struct{}
+
+// IncludeTree is a nested set of requested relations
+type IncludeTree map[string]IncludeTree
+
+// ParseIncludes parses "posts.comments,author" into an include tree
+func ParseIncludes(raw string) IncludeTree {
+	tree := IncludeTree{}
+	for _, path := range strings.Split(raw, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		node := tree
+		for _, part := range strings.Split(path, ".") {
+			if part == "" {
+				break
+			}
+			child, ok := node[part]
+			if !ok {
+				child = IncludeTree{}
+				node[part] = child
+			}
+			node = child
+		}
+	}
+	return tree
+}
+
+// WithIncludes attaches an include tree to the context
+func WithIncludes(ctx context.Context, includes IncludeTree) context.Context {
+	return context.WithValue(ctx, includesKey{}, includes)
+}
+
+// Included reports whether a relation was requested at the current level
+func Included(ctx context.Context, relation string) bool {
+	tree, _ := ctx.Value(includesKey{}).(IncludeTree)
+	_, ok := tree[relation]
+	return ok
+}
+
+// Nested returns a context scoped to the includes below relation
+func Nested(ctx context.Context, relation string) context.Context {
+	tree, _ := ctx.Value(includesKey{}).(IncludeTree)
+	child := tree[relation]
+	if child == nil {
+		child = IncludeTree{}
+	}
+	return WithIncludes(ctx, child)
+}
+
+// Includes returns the requested relations at the current level
+func Includes(ctx context.Context) []string {
+	tree, _ := ctx.Value(includesKey{}).(IncludeTree)
+	names := make([]string, 0, len(tree))
+	for name := range tree {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,49 @@
+package resources
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestConditionalFieldsAndIncludes(t *testing.T) {
+	post := ResourceFunc(func(ctx context.Context) map[string]interface{} {
+		return map[string]interface{}{
+			"id":       1,
+			"comments": WhenIncluded(ctx, "comments", func(ctx context.Context) interface{} { return []int{1, 2} }),
+		}
+	})
+	user := ResourceFunc(func(ctx context.Context) map[string]interface{} {
+		return map[string]interface{}{
+			"id":     7,
+			"secret": When(false, "hidden"),
+			"posts":  WhenIncluded(ctx, "posts", func(ctx context.Context) interface{} { return []Resource{post} }),
+		}
+	})
+
+	req := httptest.NewRequest("GET", "/users/7?include=posts.comments", nil)
+	out := Item(FromRequest(req), user)
+
+	if _, ok := out["secret"]; ok {
+		t.Fatalf("expected conditional field to be omitted")
+	}
+	posts, ok := out["posts"].([]map[string]interface{})
+	if !ok || len(posts) != 1 {
+		t.Fatalf("expected included posts, got %#v", out["posts"])
+	}
+	if _, ok := posts[0]["comments"]; !ok {
+		t.Fatalf("expected nested comments to be included")
+	}
+
+	plain := Item(FromRequest(httptest.NewRequest("GET", "/users/7", nil)), user)
+	if _, ok := plain["posts"]; ok {
+		t.Fatalf("expected posts to be omitted without include")
+	}
+}
+
+func TestPageMeta(t *testing.T) {
+	meta := NewPageMeta(2, 10, 25, 10)
+	if meta.LastPage != 3 || meta.From != 11 || meta.To != 20 {
+		t.Fatalf("unexpected meta: %+v", meta)
+	}
+}
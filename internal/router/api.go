@@ -14,6 +14,9 @@ func (r *Router) setupAPIRoutes(router chi.Router) {
 	// Setup Dolphin-style authentication
 	sessionStore := auth.NewMemorySessionStore()
 	authManager := auth.SetupAuth(r.app.DB().GetDB(), sessionStore)
+	if guard := r.app.Config().HTTP.Auth.Guard; guard != "" {
+		authManager.SetDefaultGuard(guard)
+	}
 
 	// Initialize Dolphin-style auth middleware
 	dolphinAuthMiddleware := dolphinMiddleware.NewAuthMiddleware(authManager, r.app.Logger())
@@ -32,7 +35,7 @@ func (r *Router) setupAPIRoutes(router chi.Router) {
 
 		// Protected routes (authenticated users only)
 		auth.Group(func(protected chi.Router) {
-			protected.Use(dolphinAuthMiddleware.Authenticate)
+			protected.Use(r.authenticate(dolphinAuthMiddleware))
 			protected.Post("/logout", dolphinAuthController.Logout)
 			protected.Get("/me", dolphinAuthController.Me)
 		})
@@ -44,7 +47,7 @@ func (r *Router) setupAPIRoutes(router chi.Router) {
 
 	// Protected API routes
 	router.Route("/api", func(api chi.Router) {
-		api.Use(dolphinAuthMiddleware.Authenticate)
+		api.Use(r.authenticate(dolphinAuthMiddleware))
 
 		// User routes
 		api.Route("/users", func(users chi.Router) {
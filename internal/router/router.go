@@ -1,19 +1,78 @@
 package router
 
 import (
+	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
+	"github.com/redis/go-redis/v9"
 
 	"github.com/mrhoseah/dolphin/internal/app"
+	"github.com/mrhoseah/dolphin/internal/artifacts"
+	"github.com/mrhoseah/dolphin/internal/async"
 	"github.com/mrhoseah/dolphin/internal/auth"
+	"github.com/mrhoseah/dolphin/internal/broadcast"
+	"github.com/mrhoseah/dolphin/internal/bus"
+	"github.com/mrhoseah/dolphin/internal/cache"
+	"github.com/mrhoseah/dolphin/internal/cdn"
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/cookies"
+	"github.com/mrhoseah/dolphin/internal/correlation"
+	"github.com/mrhoseah/dolphin/internal/database"
+	"github.com/mrhoseah/dolphin/internal/debug"
+	"github.com/mrhoseah/dolphin/internal/experiments"
+	"github.com/mrhoseah/dolphin/internal/frontend"
+	"github.com/mrhoseah/dolphin/internal/gateway"
+	"github.com/mrhoseah/dolphin/internal/health"
+	"github.com/mrhoseah/dolphin/internal/i18n"
+	"github.com/mrhoseah/dolphin/internal/intrusion"
+	"github.com/mrhoseah/dolphin/internal/livereload"
+	"github.com/mrhoseah/dolphin/internal/logger"
+	"github.com/mrhoseah/dolphin/internal/mail"
 	"github.com/mrhoseah/dolphin/internal/maintenance"
-	loggingMiddleware "github.com/mrhoseah/dolphin/internal/middleware/logging"
+	"github.com/mrhoseah/dolphin/internal/media"
+	"github.com/mrhoseah/dolphin/internal/metering"
+	dolphinMiddleware "github.com/mrhoseah/dolphin/internal/middleware"
 	recoveryMiddleware "github.com/mrhoseah/dolphin/internal/middleware/recovery"
+	"github.com/mrhoseah/dolphin/internal/modules"
+	"github.com/mrhoseah/dolphin/internal/notify"
+	"github.com/mrhoseah/dolphin/internal/observability"
+	"github.com/mrhoseah/dolphin/internal/observers"
+	"github.com/mrhoseah/dolphin/internal/outbox"
+	"github.com/mrhoseah/dolphin/internal/payments"
+	"github.com/mrhoseah/dolphin/internal/preferences"
+	"github.com/mrhoseah/dolphin/internal/presence"
+	"github.com/mrhoseah/dolphin/internal/problem"
+	"github.com/mrhoseah/dolphin/internal/queue"
+	"github.com/mrhoseah/dolphin/internal/ratelimit"
+	"github.com/mrhoseah/dolphin/internal/resources"
+	"github.com/mrhoseah/dolphin/internal/routing"
+	"github.com/mrhoseah/dolphin/internal/scan"
+	"github.com/mrhoseah/dolphin/internal/search"
+	"github.com/mrhoseah/dolphin/internal/security"
+	"github.com/mrhoseah/dolphin/internal/seo"
+	"github.com/mrhoseah/dolphin/internal/signing"
+	"github.com/mrhoseah/dolphin/internal/sse"
+	"github.com/mrhoseah/dolphin/internal/storage"
+	"github.com/mrhoseah/dolphin/internal/template"
+	"github.com/mrhoseah/dolphin/internal/tenancy"
+	"github.com/mrhoseah/dolphin/internal/version"
+	"github.com/mrhoseah/dolphin/internal/webhooks"
+	"github.com/mrhoseah/dolphin/internal/workflow"
 	httpSwagger "github.com/swaggo/http-swagger"
+	"go.uber.org/zap"
 )
 
 // Router handles HTTP routing
@@ -21,7 +80,48 @@ type Router struct {
 	app                *app.App
 	router             *chi.Mux
 	maintenanceManager *maintenance.Manager
+	readOnly           *maintenance.ReadOnly
+	health             *health.HealthManager
+	meter              *metering.Meter
+	metrics            *observability.MetricsCollector
+	slos               *observability.SLOTracker
+	tracer             *observability.TracerManager
+	serverTiming       *observability.ServerTiming
+	recorder           *debug.Recorder
+	allocations        *debug.AllocationTracker
 	authManager        *auth.AuthManager
+	errorViews         *template.Engine
+	errorPages         problem.Renderer
+	presence           *presence.Handler
+	presenceTracker    *presence.Tracker
+	tus                *storage.TusServer
+	search             *search.Manager
+	queue              *queue.Manager
+	scanner            *scan.Guard
+	workflows          *workflow.Engine
+	operations         *async.Manager
+	outbox             *outbox.Outbox
+	payments           *payments.Manager
+	purger             cdn.Purger
+	notifier           *notify.Notifier
+	bans               *ratelimit.BanList
+	limiter            ratelimit.RateLimiter
+	rateLimits         map[string]func(http.Handler) http.Handler
+	redis              *redis.Client
+	idempotency        func(http.Handler) http.Handler
+	intrusion          *intrusion.Detector
+	signing            *signing.Verifier
+	artifacts          *artifacts.Cache
+	gateway            *gateway.Gateway
+	webhooks           *webhooks.Capturer
+	vite               *frontend.Vite
+	earlyHints         *frontend.EarlyHints
+	translator         *i18n.Translator
+	preferences        *preferences.Service
+	experiments        *experiments.Service
+	seo                *seo.Files
+	broadcaster        broadcast.Broadcaster
+	stopBroadcasting   func()
 }
 
 // New creates a new router instance
@@ -30,18 +130,891 @@ func New(app *app.App) *Router {
 		app:                app,
 		router:             chi.NewRouter(),
 		maintenanceManager: maintenance.NewManager("storage/framework/maintenance.json"),
+		readOnly:           maintenance.NewReadOnly("storage/framework/read_only.json", app.Config().ReadOnly),
+		health:             health.NewHealthManager(version.GetVersion(), app.Logger()),
+		vite:               frontend.NewVite(app.Config().Vite),
+	}
+	if err := health.RegisterDefaults(r.health, app.Config(), app.DB()); err != nil {
+		app.Logger().Warn("Health checks incomplete", zap.Error(err))
 	}
 
 	// Initialize web auth manager (session-based)
 	sessionStore := auth.NewMemorySessionStore()
 	r.authManager = auth.SetupAuth(r.app.DB().GetDB(), sessionStore)
+	if guard := app.Config().HTTP.Auth.Guard; guard != "" {
+		r.authManager.SetDefaultGuard(guard)
+	}
+	r.limiter, r.rateLimits = r.newRateLimits()
+	if app.Config().Webhooks.Capture {
+		r.webhooks = r.newWebhooks()
+	}
+	r.registerMiddleware()
+
+	if app.Config().Metering.Enabled {
+		r.meter = r.newMeter()
+	}
+
+	if app.Config().Metrics.Enabled {
+		r.metrics = r.newMetrics()
+		if app.Config().SLO.Enabled {
+			r.slos = r.newSLOs()
+		}
+	}
+
+	if app.Config().Tracing.Enabled || app.Config().ServerTimingEnabled() {
+		r.tracer = r.newTracer()
+	}
+
+	if app.Config().App.Debug && app.Config().Debug.Record {
+		r.recorder = r.newRecorder()
+	}
+
+	if app.Config().App.Debug && app.Config().Debug.Allocations {
+		r.allocations = r.newAllocations()
+	}
+
+	if app.Config().Presence.Enabled {
+		r.newPresence()
+	}
+
+	if app.Config().Workflow.Enabled {
+		r.workflows = r.newWorkflows()
+	}
+
+	if app.Config().Tus.Enabled {
+		r.tus = r.newTus()
+	}
+
+	if app.Config().Search.Enabled {
+		r.search = r.newSearch()
+	}
+
+	r.queue = r.newQueue()
+
+	if app.Config().Scan.Enabled() {
+		r.scanner = r.newScanner()
+	}
+
+	if app.Config().Async.Enabled {
+		r.operations = r.newOperations()
+	}
+
+	jar, err := cookies.New(app.Config().App.Key, app.Config().Cookies)
+	if err != nil {
+		app.Logger().Warn("Encrypted cookies are unavailable", zap.Error(err))
+	} else {
+		cookies.Default = jar
+	}
+
+	r.broadcaster = r.newBroadcaster()
+	sse.Default = sse.NewHub(app.Config().SSE, app.Logger())
+	sse.Default.UseBroadcaster(r.broadcaster)
+	cache.Locks = r.newLocker()
+
+	media.Default.SetLogger(app.Logger())
+	correlation.Default.SetLogger(app.Logger())
+	correlation.Default.SetUserHashKey(app.Config().App.Key)
+	correlation.Default.IdentifyUsers(auth.UserID)
+
+	if app.Config().Outbox.Enabled {
+		r.outbox = r.newOutbox()
+	}
+
+	if app.Config().Payments.Enabled {
+		r.payments = r.newPayments()
+	}
+
+	r.purger = r.newPurger()
+
+	if err := app.DB().GetDB().Use(observers.NewPlugin()); err != nil {
+		app.Logger().Fatal("Failed to dispatch model observers", zap.Error(err))
+	}
+
+	if app.Config().Notify.Enabled {
+		r.notifier = r.newNotifier()
+	}
+
+	if app.Config().Intrusion.Enabled {
+		r.newIntrusion()
+	}
+
+	if cfg := app.Config().Signing; cfg.Secret != "" {
+		signing.Default = signing.NewSigner(cfg.KeyID, cfg.Secret)
+	}
+	if cfg := app.Config().Signing; len(cfg.Keys) > 0 {
+		r.signing = signing.NewVerifier(cfg.Keys, cfg.MaxSkew, cache.Locks, app.Logger())
+	}
+
+	if app.Config().Artifacts.Enabled {
+		r.artifacts = r.newArtifacts()
+	}
+
+	if len(app.Config().Gateway.Upstreams) > 0 {
+		r.gateway = r.newGateway()
+	}
+
+	r.translator = r.newTranslator()
+
+	if app.Config().Preferences.Enabled {
+		r.preferences = r.newPreferences()
+	}
+
+	if app.Config().Experiments.Enabled {
+		r.experiments = r.newExperiments()
+	}
+
+	r.errorPages = r.newErrorPages()
+
+	if cfg := app.Config().SEO; cfg.Robots.Enabled || cfg.SecurityTxt.Enabled {
+		r.seo = r.newSEO()
+	}
+
+	if app.Config().Vite.EarlyHints {
+		r.earlyHints = frontend.NewEarlyHints()
+	}
 
 	r.setupMiddleware()
 	r.setupRoutes()
 
+	// Replays go through the whole stack, and are recorded in turn
+	if r.recorder != nil {
+		r.recorder.SetHandler(r.router)
+	}
+	if r.webhooks != nil {
+		r.webhooks.SetHandler(r.router)
+	}
+
 	return r
 }
 
+// newErrorPages renders error pages from resources/views/errors through the
+// template engine when the application has that directory, and the
+// built-in page otherwise. Stacks of recovered panics are shown in debug mode.
+func (r *Router) newErrorPages() problem.Renderer {
+	debug := r.app.Config().App.Debug
+	config := template.DefaultConfig()
+	if _, err := os.Stat(config.ErrorsDir); err != nil {
+		return problem.Pages(nil, debug)
+	}
+
+	// Only the error pages are loaded, reloaded on change while debugging
+	config.LayoutsDir, config.PartialsDir, config.PagesDir = "", "", ""
+	config.ComponentsDir, config.EmailsDir = "", ""
+	config.AutoReload = debug
+	config.EnableLogging = false
+	engine, err := template.NewEngine(config, r.app.Logger())
+	if err != nil {
+		r.app.Logger().Warn("Using the default error pages", zap.Error(err))
+		return problem.Pages(nil, debug)
+	}
+	r.errorViews = engine
+	return problem.Pages(engine, debug)
+}
+
+// newMeter creates the usage meter from the metering config and starts
+// saving closed windows
+func (r *Router) newMeter() *metering.Meter {
+	cfg := r.app.Config().Metering
+	var store metering.Store = metering.NewMemoryStore()
+	if cfg.Store != "memory" {
+		dbStore, err := metering.NewDBStore(r.app.DB().GetDB())
+		if err != nil {
+			r.app.Logger().Fatal("Failed to set up usage metering", zap.Error(err))
+		}
+		store = dbStore
+	}
+	meter := metering.NewMeter(store, cfg.Window, r.app.Logger())
+	meter.Start(cfg.FlushInterval)
+	return meter
+}
+
+// newRecorder creates the request recorder from the debug config. Requests
+// to the debug dashboard itself are not recorded.
+func (r *Router) newRecorder() *debug.Recorder {
+	cfg := r.app.Config().Debug
+	recorder, err := debug.NewRecorder(debug.RecorderConfig{
+		Size:        cfg.RecordSize,
+		File:        cfg.RecordFile,
+		MaxBodySize: cfg.MaxBodySize,
+		Skip:        []string{"/debug"},
+		OnError: func(err error) {
+			r.app.Logger().Warn("Failed to save request recording", zap.Error(err))
+		},
+	})
+	if err != nil {
+		r.app.Logger().Warn("Request recording disabled", zap.Error(err))
+		return nil
+	}
+	return recorder
+}
+
+// newAllocations creates the allocation tracker from the debug config,
+// warning about each request over budget. The debug dashboard itself is
+// not measured.
+func (r *Router) newAllocations() *debug.AllocationTracker {
+	cfg := r.app.Config().Debug
+	return debug.NewAllocationTracker(debug.AllocationConfig{
+		Budget:       cfg.AllocationBudget,
+		ObjectBudget: cfg.AllocationObjectBudget,
+		SampleRate:   cfg.AllocationSampleRate,
+		Skip:         []string{"/debug"},
+		OnExceeded: func(sample debug.AllocationSample) {
+			r.app.Logger().Warn("Request over allocation budget",
+				zap.String("route", sample.Route),
+				zap.Int64("bytes", sample.Bytes),
+				zap.Int64("objects", sample.Objects),
+				zap.Duration("duration", sample.Duration))
+		},
+	})
+}
+
+// newWorkflows keeps the default workflow engine's instances in the
+// database and starts resuming them
+func (r *Router) newWorkflows() *workflow.Engine {
+	cfg := r.app.Config().Workflow
+	store, err := workflow.NewDBStore(r.app.DB().GetDB())
+	if err != nil {
+		r.app.Logger().Fatal("Failed to set up workflows", zap.Error(err))
+	}
+	engine := workflow.Default
+	engine.SetStore(store)
+	engine.SetLogger(r.app.Logger())
+	engine.SetLease(cfg.Lease)
+	engine.Work(cfg.PollInterval)
+	return engine
+}
+
+// newOperations keeps the default async manager's operations in the
+// database, pushing them to async.queue when it is set, and starts failing
+// abandoned operations and deleting old ones
+func (r *Router) newOperations() *async.Manager {
+	cfg := r.app.Config().Async
+	store, err := async.NewDBStore(r.app.DB().GetDB())
+	if err != nil {
+		r.app.Logger().Fatal("Failed to set up async operations", zap.Error(err))
+	}
+	manager := async.Default
+	manager.SetStore(store)
+	manager.SetLogger(r.app.Logger())
+	manager.SetPath(cfg.Path)
+	manager.SetRetryAfter(cfg.RetryAfter)
+	manager.SetTimeout(cfg.Timeout)
+	manager.SetRetention(cfg.Retention)
+	if cfg.Queue != "" {
+		connection, err := r.queue.Connection("")
+		if err != nil {
+			r.app.Logger().Fatal("Failed to connect to the async queue", zap.Error(err))
+		}
+		manager.UseQueue(connection, cfg.Queue)
+	}
+	manager.Work(time.Minute)
+	return manager
+}
+
+// newOutbox installs the outbox on the application database, publishing
+// aggregates' events on the default bus, and starts its relay
+func (r *Router) newOutbox() *outbox.Outbox {
+	cfg := r.app.Config().Outbox
+	o, err := outbox.New(r.app.DB().GetDB(), bus.Default, cfg, r.app.Logger())
+	if err != nil {
+		r.app.Logger().Fatal("Failed to set up the outbox", zap.Error(err))
+	}
+	o.Start(cfg.PollInterval)
+	return o
+}
+
+// newBroadcaster connects the app's instances as the broadcast config says,
+// forwarding the shared events of the default bus. The cache config's
+// store becomes the default cache, and tag flushes of a memory cache reach
+// every instance.
+func (r *Router) newBroadcaster() broadcast.Broadcaster {
+	b, err := broadcast.New(r.app.Config().Broadcast, r.app.Config().Cache, r.app.Logger())
+	if err != nil {
+		r.app.Logger().Fatal("Invalid broadcast config", zap.Error(err))
+	}
+	stops := []func(){broadcast.Forward(b, bus.Default)}
+
+	if cfg := r.app.Config().Cache; cfg.Driver == "redis" {
+		cache.Default = cache.NewRedisCache(cfg.Host, cfg.Port, cfg.DB)
+	} else if store, ok := cache.Default.(*cache.MemoryCache); ok {
+		stops = append(stops, broadcast.FlushTagsAcross(b, store))
+	}
+	r.stopBroadcasting = func() {
+		for _, stop := range stops {
+			stop()
+		}
+	}
+	return b
+}
+
+// newLocker returns the store cache.locks names for the locks of
+// cache.Lock: the default cache, so Redis when it is the cache driver, or
+// the app database
+func (r *Router) newLocker() cache.Locker {
+	switch locks := r.app.Config().Cache.Locks; locks {
+	case "", "cache":
+		if locker, ok := cache.Default.(cache.Locker); ok {
+			return locker
+		}
+		return cache.Locks
+	case "database":
+		locker, err := cache.NewDatabaseLocker(r.app.DB().GetDB())
+		if err != nil {
+			r.app.Logger().Fatal("Failed to set up database locks", zap.Error(err))
+		}
+		return locker
+	default:
+		r.app.Logger().Fatal("Unknown cache.locks store", zap.String("locks", locks))
+		return nil
+	}
+}
+
+// newTranslator loads the translation files from the i18n config and makes
+// them the default translations
+func (r *Router) newTranslator() *i18n.Translator {
+	translator, err := i18n.New(r.app.Config().I18n)
+	if err != nil {
+		r.app.Logger().Fatal("Failed to load translations", zap.Error(err))
+	}
+	i18n.Default = translator
+	return translator
+}
+
+// newPreferences saves signed-in users' preferences in the application
+// database, defaulting to the app timezone
+func (r *Router) newPreferences() *preferences.Service {
+	cfg := r.app.Config().Preferences
+	if cfg.Timezone == "" {
+		cfg.Timezone = r.app.Config().App.Timezone
+	}
+	store, err := preferences.NewDBStore(r.app.DB().GetDB())
+	if err != nil {
+		r.app.Logger().Fatal("Failed to set up preferences", zap.Error(err))
+	}
+	return preferences.New(store, r.signedInUser, r.translator, cfg, r.app.Logger())
+}
+
+// newExperiments creates the experiments from the experiments config,
+// assigning signed-in users by ID and keeping assignments in the
+// application database unless experiments.store is none. Exposures are
+// counted when metrics are enabled.
+func (r *Router) newExperiments() *experiments.Service {
+	cfg := r.app.Config().Experiments
+	var store experiments.Store
+	if cfg.Store != "none" {
+		db, err := experiments.NewDBStore(r.app.DB().GetDB())
+		if err != nil {
+			r.app.Logger().Fatal("Failed to set up experiments", zap.Error(err))
+		}
+		store = db
+	}
+	service, err := experiments.FromConfig(cfg, store, r.signedInUser, r.app.Logger())
+	if err != nil {
+		r.app.Logger().Fatal("Invalid experiments config", zap.Error(err))
+	}
+	if r.metrics != nil {
+		service.CountExposures(r.metrics.CreateCustomCounter("experiment_exposures_total",
+			"Units exposed to experiment variants", []string{"experiment", "variant"}))
+	}
+	return service
+}
+
+// newSEO creates robots.txt and security.txt from the seo config for the
+// app's environment
+func (r *Router) newSEO() *seo.Files {
+	files, err := seo.New(r.app.Config().SEO, r.app.Config().App, r.app.Logger())
+	if err != nil {
+		r.app.Logger().Fatal("Invalid seo config", zap.Error(err))
+	}
+	return files
+}
+
+// signedInUser identifies the signed-in user, whose preferences are saved
+// and who experiments are assigned by: the user the auth middleware
+// recorded in the request context
+func (r *Router) signedInUser(req *http.Request) (string, bool) {
+	return auth.UserID(req.Context())
+}
+
+// afterAuth returns the middleware that need the signed-in user before the
+// handler runs. They are mounted behind every authentication, where the
+// request context carries the user the auth middleware recorded.
+func (r *Router) afterAuth() chi.Middlewares {
+	var chain chi.Middlewares
+
+	// Named limiters counting per user, on their paths
+	chain = append(chain, r.rateLimitPaths(true))
+
+	// The signed-in user's saved preferences, and the locale they choose
+	if r.preferences != nil {
+		chain = append(chain, r.preferences.Middleware, r.translator.Middleware)
+	}
+
+	// Experiments are assigned by the signed-in user in place of the
+	// visitor cookie
+	if r.experiments != nil {
+		chain = append(chain, r.experiments.Middleware)
+	}
+
+	// Writes retried with the same Idempotency-Key get the first response,
+	// kept per user so nobody is replayed another's
+	if r.idempotency != nil {
+		chain = append(chain, r.idempotency)
+	}
+	return chain
+}
+
+// authenticate refuses guests with m, then runs afterAuth. The chain is
+// made as routes are mounted, once everything in it has been set up.
+func (r *Router) authenticate(m *dolphinMiddleware.AuthMiddleware) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return append(chi.Middlewares{m.Authenticate}, r.afterAuth()...).Handler(next)
+	}
+}
+
+// identify records the signed-in user of the web guard for routes guests
+// reach too, running afterAuth when there is one
+func (r *Router) identify(next http.Handler) http.Handler {
+	authenticated := r.afterAuth().Handler(next)
+	return dolphinMiddleware.NewAuthMiddleware(r.authManager, r.app.Logger()).OptionalAuth(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if _, ok := auth.UserFromContext(req.Context()); ok {
+			authenticated.ServeHTTP(w, req)
+			return
+		}
+		next.ServeHTTP(w, req)
+	}))
+}
+
+// newPresence creates the presence tracker and its handler from the
+// presence config, identifying members as the signed-in user
+func (r *Router) newPresence() {
+	cfg := r.app.Config().Presence
+	store, err := presence.NewStore(cfg, r.app.Config().Cache)
+	if err != nil {
+		r.app.Logger().Fatal("Invalid presence config", zap.Error(err))
+	}
+	r.presenceTracker = presence.NewTracker(store, cfg.TTL, r.app.Logger())
+	r.presence = presence.NewHandler(r.presenceTracker, r.presenceMember, cfg, r.app.Logger())
+}
+
+// newTus creates the resumable upload server from the tus config, storing
+// completed uploads on its disk, and starts removing expired ones
+func (r *Router) newTus() *storage.TusServer {
+	cfg := r.app.Config().Tus
+	disk, err := storage.TusDisk(r.app.Config())
+	if err != nil {
+		r.app.Logger().Fatal("Invalid tus disk", zap.Error(err))
+	}
+	server, err := storage.NewTusServer(disk, cfg, r.app.Logger())
+	if err != nil {
+		r.app.Logger().Fatal("Invalid tus config", zap.Error(err))
+	}
+	server.Start(cfg.CleanupInterval)
+	return server
+}
+
+// newQueue creates the queue manager from the queue config, loading the
+// job schemas in queue.schemas
+func (r *Router) newQueue() *queue.Manager {
+	manager, err := queue.NewManager(r.app.Config().Queue, r.app.Logger())
+	if err != nil {
+		r.app.Logger().Fatal("Invalid queue config", zap.Error(err))
+	}
+	return manager
+}
+
+// newScanner creates the guard scanning uploads for malware, for the
+// media uploader and tus uploads. With scan.queue set, large files are
+// scanned by jobs on the default queue connection.
+func (r *Router) newScanner() *scan.Guard {
+	cfg := r.app.Config()
+	guard, err := scan.FromConfig(cfg, r.app.Logger())
+	if err != nil {
+		r.app.Logger().Fatal("Invalid scan config", zap.Error(err))
+	}
+	if cfg.Scan.Queue != "" {
+		connection, err := r.queue.Connection("")
+		if err != nil {
+			r.app.Logger().Fatal("Failed to connect to the scan queue", zap.Error(err))
+		}
+		guard.UseQueue(connection, cfg.Scan.Queue)
+	}
+	media.Default.UseScanner(guard)
+	if r.tus != nil {
+		r.tus.OnStored(guard.CheckUpload)
+	}
+	return guard
+}
+
+// newPayments creates the payment manager from the payments config. Charges
+// are kept for their idempotency keys in the default cache, locked with the
+// default locker so instances never charge the same key twice.
+func (r *Router) newPayments() *payments.Manager {
+	manager, err := payments.FromConfig(r.app.Config().Payments, r.idempotencyStore(), cache.Locks, r.app.Logger())
+	if err != nil {
+		r.app.Logger().Fatal("Invalid payments config", zap.Error(err))
+	}
+	return manager
+}
+
+// newPurger creates the CDN purger of cdn.driver, or nil for none. With
+// cdn.purge_on_write, models' keys are purged as they are written.
+func (r *Router) newPurger() cdn.Purger {
+	cfg := r.app.Config().CDN
+	purger, err := cdn.FromConfig(cfg)
+	if err != nil {
+		r.app.Logger().Fatal("Invalid CDN config", zap.Error(err))
+	}
+	if purger != nil && cfg.PurgeOnWrite {
+		if err := r.app.DB().GetDB().Use(cdn.NewInvalidator(purger, r.app.Logger())); err != nil {
+			r.app.Logger().Fatal("Failed to purge the CDN on writes", zap.Error(err))
+		}
+	}
+	return purger
+}
+
+// newNotifier creates the notifier from the notifications config, keeping
+// channel preferences and push devices in the application database
+func (r *Router) newNotifier() *notify.Notifier {
+	store, err := notify.NewStore(r.app.DB().GetDB())
+	if err != nil {
+		r.app.Logger().Fatal("Failed to set up notifications", zap.Error(err))
+	}
+	notifier, err := notify.FromConfig(r.app.Config().Notify, store, r.app.Logger())
+	if err != nil {
+		r.app.Logger().Fatal("Invalid notifications config", zap.Error(err))
+	}
+	return notifier
+}
+
+// newRateLimits creates the limiter and the middleware of the named
+// limiters of http.rate_limits, counting in Redis when it is the cache
+// driver so every instance shares the counts
+func (r *Router) newRateLimits() (ratelimit.RateLimiter, map[string]func(http.Handler) http.Handler) {
+	var limiter ratelimit.RateLimiter = ratelimit.NewMemoryRateLimiter()
+	if cfg := r.app.Config().Cache; cfg.Driver == "redis" {
+		r.redis = redis.NewClient(&redis.Options{
+			Addr: fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+			DB:   cfg.DB,
+		})
+		limiter = ratelimit.NewRedisRateLimiter(r.redis)
+	}
+
+	limits := map[string]func(http.Handler) http.Handler{}
+	for name, cfg := range r.app.Config().HTTP.RateLimits {
+		key := ratelimit.RemoteIP
+		if cfg.By == "user" {
+			key = r.userOrIP
+		}
+		limits[name] = ratelimit.NamedRateLimitMiddleware(name, cfg.Limit, cfg.Window, key, limiter, r.app.Logger())
+	}
+	return limiter, limits
+}
+
+// userOrIP keys rate limits by the signed-in user, and guests by IP
+func (r *Router) userOrIP(req *http.Request) string {
+	if id, ok := auth.UserID(req.Context()); ok {
+		return "user:" + id
+	}
+	return ratelimit.RemoteIP(req)
+}
+
+// registerMiddleware names the framework's middleware for routes, and
+// defines the groups of http.middleware_groups:
+//
+//	auth, guest, verified  signed-in users, guests, verified users
+//	role:admin,editor      users with one of the roles
+//	can:posts.publish      users with one of the permissions
+//	throttle:60,1          60 requests a minute per user, or guest IP
+//	throttle:login         the named limiter of http.rate_limits
+//	formats:xml,csv        responses also in these formats
+//	body:10MB, timeout:2m  request limits other than http.requests'
+//	webhook:github         deliveries kept for replays, with webhooks.capture
+func (r *Router) registerMiddleware() {
+	kernel := routing.Default
+	authMiddleware := dolphinMiddleware.NewAuthMiddleware(r.authManager, r.app.Logger())
+	kernel.Alias("auth", routing.Plain(r.authenticate(authMiddleware)))
+	kernel.Alias("guest", routing.Plain(authMiddleware.Guest))
+	kernel.Alias("verified", routing.Plain(authMiddleware.EnsureEmailIsVerified))
+	kernel.Alias("role", func(params []string) (func(http.Handler) http.Handler, error) {
+		if len(params) == 0 {
+			return nil, errors.New("needs a role")
+		}
+		return authMiddleware.RoleMiddleware(params...), nil
+	})
+	kernel.Alias("can", func(params []string) (func(http.Handler) http.Handler, error) {
+		if len(params) == 0 {
+			return nil, errors.New("needs a permission")
+		}
+		return authMiddleware.PermissionMiddleware(params...), nil
+	})
+	kernel.Alias("throttle", r.throttle)
+	kernel.Alias("formats", func(params []string) (func(http.Handler) http.Handler, error) {
+		if len(params) == 0 {
+			return nil, errors.New("needs a format")
+		}
+		formats := make([]resources.Format, len(params))
+		for i, param := range params {
+			formats[i] = resources.Format(param)
+			if !resources.Registered(formats[i]) {
+				return nil, fmt.Errorf("no renderer for format %q", param)
+			}
+		}
+		return resources.WithFormats(formats...), nil
+	})
+
+	kernel.Alias("body", func(params []string) (func(http.Handler) http.Handler, error) {
+		if len(params) != 1 {
+			return nil, errors.New("needs a size, such as 10MB")
+		}
+		size, err := dolphinMiddleware.ParseSize(params[0])
+		if err != nil {
+			return nil, err
+		}
+		return dolphinMiddleware.BodyLimit(size), nil
+	})
+	kernel.Alias("timeout", func(params []string) (func(http.Handler) http.Handler, error) {
+		if len(params) != 1 {
+			return nil, errors.New("needs a duration, such as 2m")
+		}
+		timeout, err := time.ParseDuration(params[0])
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid timeout %q", params[0])
+		}
+		return dolphinMiddleware.Timeout(timeout), nil
+	})
+	kernel.Alias("webhook", r.captureWebhooks)
+
+	for name, middleware := range r.app.Config().HTTP.MiddlewareGroups {
+		kernel.Group(name, middleware...)
+	}
+	for name := range kernel.Groups() {
+		if _, err := kernel.Resolve(name); err != nil {
+			r.app.Logger().Fatal("Invalid middleware group", zap.String("group", name), zap.Error(err))
+		}
+	}
+}
+
+// throttle makes the middleware of "throttle:<limit>,<minutes>" and of
+// "throttle:<name>", a limiter of http.rate_limits
+func (r *Router) throttle(params []string) (func(http.Handler) http.Handler, error) {
+	switch len(params) {
+	case 1:
+		limit, ok := r.rateLimits[params[0]]
+		if !ok {
+			return nil, fmt.Errorf("no rate limiter named %q in http.rate_limits", params[0])
+		}
+		return limit, nil
+	case 2:
+		limit, err := strconv.Atoi(params[0])
+		if err != nil || limit < 1 {
+			return nil, fmt.Errorf("invalid limit %q", params[0])
+		}
+		minutes, err := strconv.Atoi(params[1])
+		if err != nil || minutes < 1 {
+			return nil, fmt.Errorf("invalid minutes %q", params[1])
+		}
+		name := "throttle:" + strings.Join(params, ",")
+		return ratelimit.NamedRateLimitMiddleware(name, limit, time.Duration(minutes)*time.Minute, r.userOrIP, r.limiter, r.app.Logger()), nil
+	}
+	return nil, errors.New("wants a limiter name, or a limit and minutes")
+}
+
+// rateLimitPaths runs requests through the limiters counting per user, or
+// per IP when perUser is false, whose paths they fall under, in name order
+func (r *Router) rateLimitPaths(perUser bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return r.limitPaths(next, perUser)
+	}
+}
+
+func (r *Router) limitPaths(next http.Handler, perUser bool) http.Handler {
+	names := make([]string, 0, len(r.rateLimits))
+	for name := range r.rateLimits {
+		names = append(names, name)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+
+	handler := next
+	for _, name := range names {
+		cfg := r.app.Config().HTTP.RateLimits[name]
+		paths := cfg.Paths
+		if len(paths) == 0 || (cfg.By == "user") != perUser {
+			continue
+		}
+		limited, unlimited := r.rateLimits[name](handler), handler
+		handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if underAny(req.URL.Path, paths) {
+				limited.ServeHTTP(w, req)
+				return
+			}
+			unlimited.ServeHTTP(w, req)
+		})
+	}
+	return handler
+}
+
+// underAny reports whether path is one of prefixes or below one
+func underAny(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if prefix == "" || path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// newIntrusion creates the ban list in the application database and the
+// intrusion detector banning on it, alerting through the notifier when
+// notifications are enabled
+func (r *Router) newIntrusion() {
+	cfg := r.app.Config().Intrusion
+	bans, err := ratelimit.NewBanList(r.app.DB().GetDB(), cfg.BanRefresh)
+	if err != nil {
+		r.app.Logger().Fatal("Failed to set up the ban list", zap.Error(err))
+	}
+	var alerter intrusion.Alerter
+	if r.notifier != nil && len(cfg.AlertPhones)+len(cfg.AlertUsers) > 0 {
+		alerter = intrusion.NewNotifyAlerter(r.notifier, cfg.AlertPhones, cfg.AlertUsers)
+	}
+	detector, err := intrusion.New(cfg, bans, alerter, r.app.Logger())
+	if err != nil {
+		r.app.Logger().Fatal("Invalid intrusion config", zap.Error(err))
+	}
+	r.bans, r.intrusion = bans, detector
+}
+
+// newArtifacts creates the generated artifact cache on artifacts.disk
+func (r *Router) newArtifacts() *artifacts.Cache {
+	cache, err := artifacts.FromConfig(r.app.Config().Artifacts, &r.app.Config().Storage, r.app.Logger())
+	if err != nil {
+		r.app.Logger().Fatal("Invalid artifacts config", zap.Error(err))
+	}
+	return cache
+}
+
+// newWebhooks creates the capturer keeping inbound webhooks in the
+// application database
+func (r *Router) newWebhooks() *webhooks.Capturer {
+	store, err := webhooks.NewStore(r.app.DB().GetDB())
+	if err != nil {
+		r.app.Logger().Fatal("Failed to set up webhook capture", zap.Error(err))
+	}
+	return webhooks.New(store, r.app.Config().Webhooks, r.app.Logger())
+}
+
+// captureWebhooks makes the middleware of "webhook:<source>", which passes
+// requests through untouched unless webhooks.capture is on
+func (r *Router) captureWebhooks(params []string) (func(http.Handler) http.Handler, error) {
+	if len(params) != 1 || params[0] == "" {
+		return nil, errors.New("needs a source, such as github")
+	}
+	if r.webhooks == nil {
+		return func(next http.Handler) http.Handler { return next }, nil
+	}
+	return r.webhooks.Middleware(params[0]), nil
+}
+
+// newGateway creates the gateway proxying gateway.upstreams, counting
+// their requests by the named rate limiters
+func (r *Router) newGateway() *gateway.Gateway {
+	g, err := gateway.New(r.app.Config().Gateway, r.rateLimits, r.app.Logger())
+	if err != nil {
+		r.app.Logger().Fatal("Invalid gateway config", zap.Error(err))
+	}
+	return g
+}
+
+// newSearch installs the search manager on the application database, so
+// searchable models are indexed as they are written
+func (r *Router) newSearch() *search.Manager {
+	manager, err := search.New(r.app.Config().Search, r.app.Logger())
+	if err != nil {
+		r.app.Logger().Fatal("Invalid search config", zap.Error(err))
+	}
+	if err := r.app.DB().GetDB().Use(manager); err != nil {
+		r.app.Logger().Fatal("Failed to set up search", zap.Error(err))
+	}
+	return manager
+}
+
+// presenceMember identifies the signed-in user for presence, as the auth
+// middleware recorded them for the request
+func (r *Router) presenceMember(req *http.Request) (presence.Member, bool) {
+	user, ok := auth.UserFromContext(req.Context())
+	if !ok {
+		return presence.Member{}, false
+	}
+	return presence.Member{ID: strconv.FormatUint(uint64(user.GetID()), 10), Name: user.GetAuthIdentifier()}, true
+}
+
+// newMetrics creates the Prometheus collector from the metrics config and
+// instruments the database with it, counting the queries cut short too
+func (r *Router) newMetrics() *observability.MetricsCollector {
+	cfg := observability.DefaultMetricsConfig()
+	cfg.Namespace = r.app.Config().Metrics.Namespace
+	cfg.Path = r.app.Config().Metrics.Path
+	cfg.Port = r.app.Config().Metrics.Port
+	cfg.LabelAllowlist = r.app.Config().Metrics.LabelAllowlist
+	cfg.MaxSeries = r.app.Config().Metrics.MaxSeries
+	if r.app.Config().SLO.Enabled {
+		cfg.Buckets = observability.SLOBuckets(cfg.Buckets, r.app.Config().SLO)
+	}
+
+	metrics := observability.NewMetricsCollector(cfg, r.app.Logger())
+	if err := metrics.InstrumentDB(r.app.DB().GetDB()); err != nil {
+		r.app.Logger().Warn("Database metrics unavailable", zap.Error(err))
+	}
+	r.app.DB().QueryTimeouts().OnCancel = metrics.RecordQueryCanceled
+	return metrics
+}
+
+// newSLOs tracks the objectives in the SLO config from the request metrics
+// and starts checking their error budgets
+func (r *Router) newSLOs() *observability.SLOTracker {
+	tracker, err := observability.NewSLOTracker(r.metrics, r.app.Config().SLO, r.app.Logger())
+	if err != nil {
+		r.app.Logger().Fatal("Invalid SLO config", zap.Error(err))
+	}
+	tracker.Start()
+	return tracker
+}
+
+// newTracer creates the tracer from the tracing config and traces the
+// database's statements and the signed-in user with it. With only server
+// timing on, spans stay in the process.
+func (r *Router) newTracer() *observability.TracerManager {
+	cfg := observability.TraceConfigFromConfig(r.app.Config())
+	var tracer *observability.TracerManager
+	var err error
+	if r.app.Config().Tracing.Enabled {
+		tracer, err = observability.NewTracerManager(cfg, r.app.Logger())
+	} else {
+		tracer, err = observability.NewTracerManagerWithExporter(cfg, nil, r.app.Logger())
+	}
+	if err != nil {
+		r.app.Logger().Fatal("Invalid tracing config", zap.Error(err))
+	}
+	if err := tracer.InstrumentDB(r.app.DB().GetDB()); err != nil {
+		r.app.Logger().Warn("Database tracing unavailable", zap.Error(err))
+	}
+	tracer.IdentifyUsers(func(req *http.Request) (string, bool) {
+		return auth.UserID(req.Context())
+	})
+	if r.app.Config().ServerTimingEnabled() {
+		if r.serverTiming, err = tracer.EnableServerTiming(); err != nil {
+			r.app.Logger().Warn("Server timing unavailable", zap.Error(err))
+		}
+	}
+	return tracer
+}
+
+// Routes returns the routes, for listing them with chi.Walk
+func (r *Router) Routes() chi.Routes {
+	return r.router
+}
+
 // ServeHTTP implements http.Handler
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	r.router.ServeHTTP(w, req)
@@ -52,6 +1025,223 @@ func (r *Router) Mount(pattern string, sr chi.Router) {
 	r.router.Mount(pattern, sr)
 }
 
+// Health returns the health manager behind /health, for registering
+// application checks
+func (r *Router) Health() *health.HealthManager {
+	return r.health
+}
+
+// Meter returns the usage meter, or nil when metering is disabled
+func (r *Router) Meter() *metering.Meter {
+	return r.meter
+}
+
+// Metrics returns the Prometheus collector, or nil when metrics are
+// disabled
+func (r *Router) Metrics() *observability.MetricsCollector {
+	return r.metrics
+}
+
+// MetricsServer returns a server exposing the metrics on the configured
+// host and port, or nil when metrics are disabled. The caller starts it and
+// shuts it down with the application server.
+func (r *Router) MetricsServer() *http.Server {
+	if r.metrics == nil {
+		return nil
+	}
+	cfg := r.app.Config().Metrics
+	return r.metrics.NewServer(fmt.Sprintf("%s:%d", cfg.Host, cfg.Port), cfg.Path)
+}
+
+// SLOs returns the service level objective tracker, or nil unless
+// metrics.enabled and slo.enabled are on. Give it a notification provider
+// with UseNotifications to send alerts to slo.alerts.channels.
+func (r *Router) SLOs() *observability.SLOTracker {
+	return r.slos
+}
+
+// Tus returns the resumable upload server, or nil unless tus.enabled is
+// on. Check and process uploads with its OnCreate and OnComplete hooks.
+func (r *Router) Tus() *storage.TusServer {
+	return r.tus
+}
+
+// Broadcaster returns the broadcaster reaching the app's other instances,
+// e.g. for a GraphQL SubscriptionManager's UseBroadcaster
+func (r *Router) Broadcaster() broadcast.Broadcaster {
+	return r.broadcaster
+}
+
+// Search returns the search manager, or nil unless search.enabled is on.
+// Sync models through a queue with its UseQueue.
+func (r *Router) Search() *search.Manager {
+	return r.search
+}
+
+// Gateway returns the gateway proxying the upstream services, or nil
+// unless gateway.upstreams has any
+func (r *Router) Gateway() *gateway.Gateway {
+	return r.gateway
+}
+
+// Webhooks returns the capturer of inbound webhooks, or nil unless
+// webhooks.capture is on. Replay a failed delivery with its Replay.
+func (r *Router) Webhooks() *webhooks.Capturer {
+	return r.webhooks
+}
+
+// Queue returns the queue manager. Push jobs to its connections, or keep
+// events on one with queue.Events and events.NewEventBusWithQueue.
+func (r *Router) Queue() *queue.Manager {
+	return r.queue
+}
+
+// Scanner returns the guard scanning uploads, or nil unless scan.driver
+// is set. Scan other files with its Check and CheckStored.
+func (r *Router) Scanner() *scan.Guard {
+	return r.scanner
+}
+
+// Payments returns the payment manager, or nil unless payments.enabled is
+// on. Charge and refund through it, and handle webhook events with On.
+func (r *Router) Payments() *payments.Manager {
+	return r.payments
+}
+
+// Allocations returns the tracker of heap allocations per route, or nil
+// unless app.debug and debug.allocations are on
+func (r *Router) Allocations() *debug.AllocationTracker {
+	return r.allocations
+}
+
+// CDN returns the purger of cdn.driver, or nil unless one is configured.
+// Purge the keys responses were tagged with through cdn.Tag.
+func (r *Router) CDN() cdn.Purger {
+	return r.purger
+}
+
+// Notifier returns the SMS and push notifier, or nil unless
+// notifications.enabled is on. Register devices and save channel
+// preferences through its Store.
+func (r *Router) Notifier() *notify.Notifier {
+	return r.notifier
+}
+
+// Experiments returns the A/B experiments, or nil unless
+// experiments.enabled is on. Handlers read the request's variant with
+// experiments.Assigned.
+func (r *Router) Experiments() *experiments.Service {
+	return r.experiments
+}
+
+// RateLimit returns the middleware of a named limiter of http.rate_limits,
+// for routes such as r.With(router.RateLimit("uploads")).Post(...). It
+// panics when no limiter has the name.
+func (r *Router) RateLimit(name string) func(http.Handler) http.Handler {
+	limit, ok := r.rateLimits[name]
+	if !ok {
+		panic(fmt.Sprintf("router: no rate limiter named %q in http.rate_limits", name))
+	}
+	return limit
+}
+
+// Bans returns the list of banned IPs, or nil unless intrusion.enabled is
+// on
+func (r *Router) Bans() *ratelimit.BanList {
+	return r.bans
+}
+
+// Intrusion returns the intrusion detector, or nil unless
+// intrusion.enabled is on. Login handlers check submitted credentials
+// against its honeytokens with Credential.
+func (r *Router) Intrusion() *intrusion.Detector {
+	return r.intrusion
+}
+
+// Signing returns the verifier of requests signed by the services of
+// signing.keys, or nil when there are none. Put internal routes behind its
+// Middleware.
+func (r *Router) Signing() *signing.Verifier {
+	return r.signing
+}
+
+// Artifacts returns the cache of generated files such as PDF invoices, or
+// nil unless artifacts.enabled is on
+func (r *Router) Artifacts() *artifacts.Cache {
+	return r.artifacts
+}
+
+// Operations returns the manager of long-running operations, or nil unless
+// async.enabled is on. Handlers start operations with it and answer with
+// Accept.
+func (r *Router) Operations() *async.Manager {
+	return r.operations
+}
+
+// Recorder returns the request recorder, or nil unless app.debug and
+// debug.record are on
+func (r *Router) Recorder() *debug.Recorder {
+	return r.recorder
+}
+
+// Tracer returns the tracer, or nil when tracing and server timing are
+// disabled
+func (r *Router) Tracer() *observability.TracerManager {
+	return r.tracer
+}
+
+// Close saves usage still held by the meter, exports buffered spans,
+// stops metrics collection and upload cleanup, saves local search indexes,
+// closes queue and rate limiter connections and waits for image variants and artifacts being made. Call it after the
+// server has shut down.
+func (r *Router) Close(ctx context.Context) error {
+	var errs []error
+	if r.tus != nil {
+		r.tus.Close()
+	}
+	if r.slos != nil {
+		r.slos.Close()
+	}
+	if r.metrics != nil {
+		r.metrics.Close()
+	}
+	if r.meter != nil {
+		errs = append(errs, r.meter.Close(ctx))
+	}
+	if r.tracer != nil {
+		errs = append(errs, r.tracer.Shutdown(ctx))
+	}
+	if r.errorViews != nil {
+		errs = append(errs, r.errorViews.Stop())
+	}
+	if r.recorder != nil {
+		errs = append(errs, r.recorder.Close())
+	}
+	if r.workflows != nil {
+		r.workflows.Close()
+	}
+	if r.operations != nil {
+		r.operations.Close()
+	}
+	if r.outbox != nil {
+		r.outbox.Close()
+	}
+	errs = append(errs, r.queue.Close())
+	media.Default.Close()
+	if r.artifacts != nil {
+		r.artifacts.Close()
+	}
+	r.stopBroadcasting()
+	errs = append(errs, r.broadcaster.Close())
+	if r.search != nil {
+		errs = append(errs, r.search.Close())
+	}
+	if r.redis != nil {
+		errs = append(errs, r.redis.Close())
+	}
+	return errors.Join(errs...)
+}
+
 // Use adds a middleware to the router
 func (r *Router) Use(mwf func(http.Handler) http.Handler) {
 	r.router.Use(mwf)
@@ -59,70 +1249,400 @@ func (r *Router) Use(mwf func(http.Handler) http.Handler) {
 
 // setupMiddleware configures global middleware
 func (r *Router) setupMiddleware() {
-	// Maintenance mode middleware (should be first)
+	// A place for the user the auth middleware of a route authenticates,
+	// which the middleware here read once the handler has run
+	r.router.Use(auth.Identify)
+
+	// Early hints are written before any middleware wraps the response,
+	// since wrappers take a 103 for the final status
+	if r.earlyHints != nil {
+		r.router.Use(r.earlyHints.Middleware)
+	}
+
+	// Tracing and metrics wrap everything so maintenance and read-only
+	// refusals are seen too
+	if r.tracer != nil {
+		r.router.Use(observability.TracingMiddleware(r.tracer))
+	}
+	if r.serverTiming != nil {
+		r.router.Use(r.serverTiming.Middleware)
+	}
+	if r.metrics != nil {
+		r.router.Use(r.metrics.HTTPMetricsMiddleware)
+	}
+
+	// Errors written before a route group is reached, such as maintenance
+	// pages and recovered panics, get an error page or problem+json by the
+	// client's Accept header
+	r.router.Use(problem.Middleware(problem.Negotiate(r.errorPages), nil))
+
+	// Maintenance mode middleware (first after metrics)
 	maintenanceMiddleware := maintenance.NewMiddleware(r.maintenanceManager)
 	r.router.Use(maintenanceMiddleware.Handle)
 
+	// Read-only mode refuses writes but keeps reads and the admin toggle
+	r.router.Use(maintenance.NewReadOnlyMiddleware(r.readOnly, "/maintenance/").Handle)
+
 	// Request ID middleware
 	r.router.Use(middleware.RequestID)
 
-	// Real IP middleware
-	r.router.Use(middleware.RealIP)
+	// Client IP from the forwarded headers of trusted proxies only
+	trustedProxies, err := ratelimit.ParsePrefixes(r.app.Config().HTTP.TrustedProxies)
+	if err != nil {
+		r.app.Logger().Fatal("Invalid http.trusted_proxies", zap.Error(err))
+	}
+	r.router.Use(ratelimit.RealIP(trustedProxies))
+
+	// Banned IPs are refused; honeytokens and scanning get IPs banned
+	if r.intrusion != nil {
+		r.router.Use(ratelimit.BanMiddleware(r.bans, r.app.Logger()))
+		r.router.Use(r.intrusion.Middleware)
+	}
+
+	// Access log, with the request ID echoed and a request logger in the
+	// context for logger.FromContext
+	accessLog, err := logger.NewAccessLogger(r.app.Logger(), r.app.Config().Log.Access)
+	if err != nil {
+		r.app.Logger().Fatal("Invalid access log config", zap.Error(err))
+	}
+	r.router.Use(accessLog.Handler)
+
+	// Body size, timeout and slow threshold, by route from http.requests;
+	// inside the access log, whose slow threshold it sets, and outside
+	// everything reading bodies up front: the recorder, metering and
+	// idempotency
+	r.router.Use(r.requestLimits())
 
-	// Logger middleware
-	r.router.Use(loggingMiddleware.New(r.app.Logger()))
+	// Request recorder for the debug dashboard, outside recovery so that
+	// panics are recorded with the error response
+	if r.recorder != nil {
+		r.router.Use(r.recorder.Middleware())
+	}
+
+	// Allocations per route, measured around everything below
+	if r.allocations != nil {
+		r.router.Use(r.allocations.Middleware())
+	}
 
 	// Recovery middleware
 	r.router.Use(recoveryMiddleware.New(r.app.Logger()))
 
-	// Timeout middleware
-	r.router.Use(middleware.Timeout(30))
-
-	// CORS middleware
-	corsMiddleware := cors.New(cors.Options{
-		AllowedOrigins:   []string{"*"}, // Configure based on your needs
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"*"},
-		ExposedHeaders:   []string{"Link"},
-		AllowCredentials: true,
-		MaxAge:           300,
-	})
+	// CDN caching headers by route, outside cookies so responses setting
+	// them aren't cached
+	if routes := r.app.Config().CDN.Routes; len(routes) > 0 {
+		policies := make(map[string]cdn.Policy, len(routes))
+		for route, cfg := range routes {
+			policies[route] = cdn.PolicyFromConfig(cfg)
+		}
+		r.router.Use(cdn.Routes(policies))
+	}
+
+	// Cookies queued while handling a request are added to its response;
+	// inside recovery so a request that panics doesn't set them
+	r.router.Use(cookies.Middleware)
+
+	// Saved preferences, whose locale the translator uses; a guest's here,
+	// and a signed-in user's again behind authentication (see afterAuth)
+	if r.preferences != nil {
+		r.router.Use(r.preferences.Middleware)
+	}
+
+	// Experiment unit by visitor cookie; a signed-in user's behind
+	// authentication (see afterAuth)
+	if r.experiments != nil {
+		r.router.Use(r.experiments.Middleware)
+	}
+
+	// Locale from the query, preferences, cookie or Accept-Language header
+	r.router.Use(r.translator.Middleware)
+
+	// Read-your-writes scope for replica routing
+	if len(r.app.Config().Database.Replicas) > 0 {
+		r.router.Use(database.StickyMiddleware)
+	}
+
+	// Tenant resolution; central endpoints such as /health stay tenant-free
+	if r.app.Config().Tenancy.Enabled {
+		r.router.Use(r.tenantMiddleware())
+	}
+
+	// Usage metering bills API calls to the resolved tenant
+	if r.meter != nil {
+		r.router.Use(metering.Middleware(r.meter, centralPaths...))
+	}
+
+	// Idempotency-Key is honored behind auth, see afterAuth
+	if cfg := r.app.Config().Idempotency; cfg.Enabled {
+		r.idempotency = dolphinMiddleware.IdempotencyMiddleware(r.idempotencyStore(), dolphinMiddleware.IdempotencyOptions{
+			TTL:     cfg.TTL,
+			Methods: cfg.Methods,
+		})
+	}
+
+	// CORS middleware, from the http.cors presets
+	corsConfig := r.app.Config().HTTP.CORS
+	corsOptions := cors.Options{
+		AllowedOrigins:   corsConfig.AllowedOrigins,
+		AllowedMethods:   slices.Clone(corsConfig.AllowedMethods),
+		AllowedHeaders:   corsConfig.AllowedHeaders,
+		ExposedHeaders:   slices.Clone(corsConfig.ExposedHeaders),
+		AllowCredentials: corsConfig.AllowCredentials,
+		MaxAge:           corsConfig.MaxAge,
+	}
+	// tus clients on other origins send chunks and read the offsets
+	if r.tus != nil {
+		corsOptions.AllowedMethods = append(corsOptions.AllowedMethods, "PATCH", "HEAD")
+		corsOptions.ExposedHeaders = append(corsOptions.ExposedHeaders, "Location", "Tus-Resumable", "Tus-Version",
+			"Tus-Extension", "Tus-Max-Size", "Upload-Offset", "Upload-Length", "Upload-Metadata", "Upload-Expires")
+	}
+	corsMiddleware := cors.New(corsOptions)
 	r.router.Use(corsMiddleware.Handler)
 
-	// Compress middleware
-	r.router.Use(middleware.Compress(5))
+	// Named rate limiters counting per IP apply to their paths, inside CORS
+	// so that browsers can read the 429s. Those counting per user apply
+	// behind auth, see afterAuth.
+	r.router.Use(r.rateLimitPaths(false))
+
+	// Feature gated middleware, enabled per app in config (see `dolphin upgrade`)
+	features := r.app.Config().Features
+	if features.SecurityHeaders {
+		r.router.Use(security.SecurityHeadersMiddlewareWithPreset(features.SecurityPreset))
+	}
+	if features.Compression {
+		r.router.Use(dolphinMiddleware.CompressionMiddleware(compressionOptions(features)))
+	}
+	if features.ResponseCache {
+		r.router.Use(dolphinMiddleware.ResponseCacheMiddleware(r.responseCacheStore(), features.ResponseCacheTTL))
+	}
+
+	// Under `dolphin dev`, pages load the live reload script; inside
+	// compression so the HTML is still plain, and inside security headers
+	// so the CSP can be widened for it
+	if inject := livereload.InjectFromEnv(); inject != nil {
+		r.router.Use(inject)
+	}
+}
+
+// requestLimits bounds requests by the http.requests limits and their
+// route overrides
+func (r *Router) requestLimits() func(http.Handler) http.Handler {
+	cfg := r.app.Config().HTTP.Requests
+	limits := func(c config.RequestLimitsConfig) dolphinMiddleware.RequestLimits {
+		return dolphinMiddleware.RequestLimits{MaxBodySize: c.MaxBodySize, Timeout: c.Timeout, SlowThreshold: c.SlowThreshold}
+	}
+	routes := make(map[string]dolphinMiddleware.RequestLimits, len(cfg.Routes))
+	for route, c := range cfg.Routes {
+		routes[route] = limits(c)
+	}
+	return dolphinMiddleware.Limits(limits(cfg.RequestLimitsConfig), routes)
+}
+
+// compressionOptions splits the configured exclusions into paths and
+// content types
+func compressionOptions(features config.FeaturesConfig) dolphinMiddleware.CompressionOptions {
+	opts := dolphinMiddleware.CompressionOptions{Level: features.CompressionLevel}
+	for _, entry := range features.CompressionExclude {
+		if strings.HasPrefix(entry, "/") {
+			opts.ExcludedPaths = append(opts.ExcludedPaths, entry)
+		} else {
+			opts.ExcludedContentTypes = append(opts.ExcludedContentTypes, entry)
+		}
+	}
+	return opts
+}
+
+// centralPaths are served without resolving a tenant
+var centralPaths = []string{"/health", "/maintenance/", "/swagger/", "/static/", "/modules/", "/webhooks/", "/robots.txt", "/.well-known/"}
+
+// tenantMiddleware resolves the tenant from the configured resolvers
+func (r *Router) tenantMiddleware() func(http.Handler) http.Handler {
+	cfg := &r.app.Config().Tenancy
+	store, err := tenancy.StoreFromConfig(cfg)
+	if err != nil {
+		r.app.Logger().Fatal("Invalid tenancy config", zap.Error(err))
+	}
+	resolvers, err := tenancy.ResolversFromConfig(cfg)
+	if err != nil {
+		r.app.Logger().Fatal("Invalid tenancy config", zap.Error(err))
+	}
+	resolve := tenancy.Middleware(store, resolvers...)
+	correlation.Default.UseTenants(store)
+
+	return func(next http.Handler) http.Handler {
+		tenanted := resolve(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			for _, path := range centralPaths {
+				if req.URL.Path == strings.TrimSuffix(path, "/") || strings.HasPrefix(req.URL.Path, path) {
+					next.ServeHTTP(w, req)
+					return
+				}
+			}
+			tenanted.ServeHTTP(w, req)
+		})
+	}
+}
+
+// responseCacheStore picks the response cache backend from the cache config
+func (r *Router) responseCacheStore() cache.Cache {
+	cfg := r.app.Config().Cache
+	var store cache.Cache = cache.NewMemoryCache()
+	if cfg.Driver == "redis" {
+		store = cache.NewRedisCache(cfg.Host, cfg.Port, cfg.DB)
+	}
+	if r.metrics != nil {
+		store = r.metrics.InstrumentCache("response", store)
+	}
+	if r.tracer != nil {
+		store = r.tracer.InstrumentCache("response", store)
+	}
+	return store
+}
+
+// idempotencyStore keeps the responses replayed for idempotency keys in the
+// default cache, shared by every instance when it is Redis
+func (r *Router) idempotencyStore() cache.Cache {
+	var store cache.Cache = cache.Default
+	if r.metrics != nil {
+		store = r.metrics.InstrumentCache("idempotency", store)
+	}
+	if r.tracer != nil {
+		store = r.tracer.InstrumentCache("idempotency", store)
+	}
+	return store
 }
 
 // setupRoutes configures application routes
 func (r *Router) setupRoutes() {
-	// Health check endpoint
-	r.router.Get("/health", r.healthCheck)
+	// Health, liveness and readiness endpoints
+	health.SetupHealthRoutes(r.router, r.health)
 
 	// Maintenance status endpoint
 	r.router.Get("/maintenance/status", r.maintenanceStatus)
 
+	// Read-only mode status and admin toggle
+	r.router.Get("/maintenance/read-only", r.readOnlyStatus)
+	r.router.Put("/maintenance/read-only", r.enableReadOnly)
+	r.router.Delete("/maintenance/read-only", r.disableReadOnly)
+
+	// Runtime log level, behind log.admin_token
+	if level := r.app.LogLevel(); level != nil {
+		levelHandler := logger.LevelHandler(*level, r.app.Logger())
+		r.router.Method(http.MethodGet, "/maintenance/log-level", r.logLevelAdmin(levelHandler))
+		r.router.Method(http.MethodPut, "/maintenance/log-level", r.logLevelAdmin(levelHandler))
+	}
+
+	// Bounce and complaint webhooks feeding the mail suppression list
+	if r.app.Config().Mail.Webhooks.Enabled {
+		r.setupMailWebhooks()
+	}
+
+	// Verified payment webhooks, one per provider
+	if r.payments != nil {
+		r.router.Route(r.app.Config().Payments.WebhookPath, func(pr chi.Router) {
+			r.captureSource(pr, "payments")
+			r.payments.Routes(pr)
+		})
+	}
+
+	// Preferences as JSON, the switcher partial, and saving changes, for
+	// the signed-in user or in the guest's cookie
+	if r.preferences != nil {
+		r.router.Route(r.app.Config().Preferences.Path, func(pr chi.Router) {
+			pr.Use(r.identify)
+			r.preferences.Routes(pr)
+		})
+	}
+
+	// Status of long-running operations, polled or streamed by clients
+	if r.operations != nil {
+		r.router.Route(r.app.Config().Async.Path, func(or chi.Router) {
+			or.Use(r.identify)
+			r.operations.Routes(or)
+		})
+	}
+
+	// Who's online per channel, for HTMX widgets and JSON clients
+	if r.presence != nil {
+		r.router.Route(r.app.Config().Presence.Path, func(pr chi.Router) {
+			pr.Use(r.identify)
+			r.presence.Routes(pr)
+		})
+	}
+
+	// Resumable uploads over the tus protocol and their JavaScript client
+	if r.tus != nil {
+		r.router.Route(r.app.Config().Tus.Path, r.tus.Routes)
+	}
+
+	// Paths proxied to the services of gateway.upstreams
+	if r.gateway != nil {
+		r.gateway.Mount(r.router)
+	}
+
+	// robots.txt and /.well-known/security.txt
+	if r.seo != nil {
+		r.seo.Routes(r.router)
+	}
+
 	// Swagger documentation
 	r.router.Get("/swagger/*", httpSwagger.Handler(
 		httpSwagger.URL("http://localhost:8080/swagger/doc.json"),
 	))
 
-	// API routes
+	// Unmatched paths are reported by the group they fall under, so they
+	// get problem+json below /api and an error page elsewhere
+	r.router.NotFound(problem.Handler(problem.New(http.StatusNotFound, "")))
+
+	// API routes, in the api middleware group
 	r.router.Route("/api", func(api chi.Router) {
+		api.Use(problem.Middleware(problem.JSON, r.app.Logger()))
+
 		// API v1 routes
-		api.Route("/v1", func(v1 chi.Router) {
-			r.setupAPIRoutes(v1)
+		routing.Wrap(api).Group("api", func(api *routing.Router) {
+			api.Route("/v1", func(v1 *routing.Router) {
+				r.setupAPIRoutes(v1.Router)
+			})
 		})
 	})
 
-	// Web routes
+	// Web routes, in the web middleware group
 	r.router.Route("/", func(web chi.Router) {
-		r.setupWebRoutes(web)
+		web.Use(problem.Middleware(r.errorPages, r.app.Logger()))
+		routing.Wrap(web).Group("web", func(web *routing.Router) {
+			r.setupWebRoutes(web.Router)
+		})
 	})
 
+	// Routes and assets contributed by registered modules
+	modules.Mount(r.router)
+
 	// Static file serving
 	r.setupStaticRoutes()
 }
 
+// setupMailWebhooks mounts the SES and Mailgun webhooks over the database
+// suppression list, which mail.MailManager.SetSuppressions checks
+func (r *Router) setupMailWebhooks() {
+	cfg := r.app.Config().Mail.Webhooks
+	store, err := mail.NewDBSuppressionStore(r.app.DB().GetDB())
+	if err != nil {
+		r.app.Logger().Fatal("Failed to set up the mail suppression list", zap.Error(err))
+	}
+	handlers := mail.NewWebhooks(store, cfg, r.app.Logger())
+	r.router.Route(cfg.Path, func(mr chi.Router) {
+		r.captureSource(mr, "mail")
+		handlers.Routes(mr)
+	})
+}
+
+// captureSource keeps the deliveries of a router's webhooks from source,
+// with webhooks.capture on
+func (r *Router) captureSource(router chi.Router, source string) {
+	if r.webhooks != nil {
+		router.Use(r.webhooks.Middleware(source))
+	}
+}
+
 // placeholderHandler is a temporary handler for routes without controllers
 func (r *Router) placeholderHandler(w http.ResponseWriter, req *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -142,12 +1662,6 @@ func (r *Router) setupStaticRoutes() {
 
 // Handler methods
 
-func (r *Router) healthCheck(w http.ResponseWriter, req *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"status":"ok","service":"dolphin-framework"}`))
-}
-
 func (r *Router) maintenanceStatus(w http.ResponseWriter, req *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -168,3 +1682,74 @@ func (r *Router) maintenanceStatus(w http.ResponseWriter, req *http.Request) {
 
 	w.Write(jsonData)
 }
+
+func (r *Router) readOnlyStatus(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(r.readOnly.Info())
+}
+
+// enableReadOnly turns read-only mode on; the optional JSON body sets
+// "message" and "retry_after"
+func (r *Router) enableReadOnly(w http.ResponseWriter, req *http.Request) {
+	if !r.readOnlyAdmin(w, req) {
+		return
+	}
+
+	var body struct {
+		Message    string `json:"message"`
+		RetryAfter int    `json:"retry_after"`
+	}
+	if req.ContentLength != 0 {
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+	}
+	if err := r.readOnly.Enable(body.Message, body.RetryAfter); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	r.app.Logger().Warn("Read-only mode enabled", zap.String("remote", req.RemoteAddr))
+	r.readOnlyStatus(w, req)
+}
+
+func (r *Router) disableReadOnly(w http.ResponseWriter, req *http.Request) {
+	if !r.readOnlyAdmin(w, req) {
+		return
+	}
+	if err := r.readOnly.Disable(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	r.app.Logger().Info("Read-only mode disabled", zap.String("remote", req.RemoteAddr))
+	r.readOnlyStatus(w, req)
+}
+
+// readOnlyAdmin checks the X-Admin-Token header against read_only.admin_token
+func (r *Router) readOnlyAdmin(w http.ResponseWriter, req *http.Request) bool {
+	return checkAdminToken(w, req, r.app.Config().ReadOnly.AdminToken, "read-only admin API is disabled; set read_only.admin_token")
+}
+
+// logLevelAdmin lets through requests whose X-Admin-Token header matches
+// log.admin_token
+func (r *Router) logLevelAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if checkAdminToken(w, req, r.app.Config().Log.AdminToken, "log level admin API is disabled; set log.admin_token") {
+			next.ServeHTTP(w, req)
+		}
+	})
+}
+
+// checkAdminToken compares the X-Admin-Token header with token, refusing
+// the request with disabled as the reason while token is empty
+func checkAdminToken(w http.ResponseWriter, req *http.Request, token, disabled string) bool {
+	if token == "" {
+		http.Error(w, disabled, http.StatusForbidden)
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(req.Header.Get("X-Admin-Token")), []byte(token)) != 1 {
+		http.Error(w, "invalid admin token", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
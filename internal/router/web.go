@@ -1,6 +1,7 @@
 package router
 
 import (
+	"bytes"
 	"html/template"
 	"net/http"
 	"os"
@@ -8,13 +9,24 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/mrhoseah/dolphin/internal/auth"
+	"github.com/mrhoseah/dolphin/internal/experiments"
+	"github.com/mrhoseah/dolphin/internal/frontend"
+	"github.com/mrhoseah/dolphin/internal/i18n"
 	dolphinMiddleware "github.com/mrhoseah/dolphin/internal/middleware"
+	"github.com/mrhoseah/dolphin/internal/observability"
+	"github.com/mrhoseah/dolphin/internal/preferences"
+	"github.com/mrhoseah/dolphin/internal/presence"
 	"github.com/mrhoseah/dolphin/internal/time"
 	"github.com/mrhoseah/dolphin/internal/version"
+	"go.uber.org/zap"
 )
 
 // render joins base layout with header/footer partials and the page body.
-func render(w http.ResponseWriter, pagePath string) error {
+// Layouts can use the time and vite template helpers, with times in the
+// preferred timezone, and translate into the request's locale with t and
+// choice. tusScript loads the resumable upload client when tus is enabled,
+// and variant and inVariant read the request's experiment variants.
+func (r *Router) render(w http.ResponseWriter, req *http.Request, pagePath string) error {
 	header, _ := os.ReadFile("ui/views/partials/header.html")
 	footer, _ := os.ReadFile("ui/views/partials/footer.html")
 	bodyBytes, err := os.ReadFile(pagePath)
@@ -57,23 +69,82 @@ func render(w http.ResponseWriter, pagePath string) error {
 		}
 	}
 
-	// Create template data with version information
+	// Preload the layout's and page's critical assets, sent as early
+	// hints to the route's next requests
+	if r.earlyHints != nil {
+		r.hint(w, req, string(base), body)
+	}
+
+	// Create template data with version information and the request's
+	// preferences
+	prefs := preferences.FromContext(req.Context())
 	data := map[string]interface{}{
-		"Version": version.GetVersion(),
-		"Header":  string(header),
-		"Body":    body,
-		"Footer":  string(footer),
+		"Version":     version.GetVersion(),
+		"Header":      string(header),
+		"Body":        body,
+		"Footer":      string(footer),
+		"Preferences": prefs,
+	}
+	// Layouts load the preference switcher from here when it is enabled
+	if r.preferences != nil {
+		data["PreferencesPath"] = r.app.Config().Preferences.Path
 	}
 
-	// Parse and execute template with time helpers
-	tmpl, err := template.New("layout").Funcs(time.TemplateHelpers()).Parse(string(base))
+	// Parse and execute template with time helpers in the preferred
+	// timezone, vite and translation helpers. The page is rendered before
+	// it is written so its span ends within the Server-Timing header.
+	_, span := observability.StartTemplateSpan(req.Context(), pagePath)
+	tmpl, err := template.New("layout").Funcs(time.TemplateHelpersIn(prefs.Location())).Funcs(r.vite.TemplateHelpers()).
+		Funcs(r.translator.TemplateHelpers(i18n.Locale(req.Context()))).Funcs(r.tusHelpers()).Funcs(r.experimentHelpers(req)).Parse(string(base))
+	var page bytes.Buffer
+	if err == nil {
+		err = tmpl.Execute(&page, data)
+	}
+	span.End()
 	if err != nil {
 		return err
 	}
-	
+
 	w.Header().Set("Content-Type", "text/html")
 	w.WriteHeader(http.StatusOK)
-	return tmpl.Execute(w, data)
+	_, err = page.WriteTo(w)
+	return err
+}
+
+// hint adds the preload links of the critical assets of templates to the
+// response. Assets missing from the Vite manifest are skipped with a warning,
+// as the page's own tags will fail to load them too.
+func (r *Router) hint(w http.ResponseWriter, req *http.Request, templates ...string) {
+	links, err := r.vite.Preloads(frontend.CriticalAssets(templates...)...)
+	if err != nil {
+		r.app.Logger().Warn("Failed to resolve early hints", zap.Error(err))
+		return
+	}
+	frontend.Hint(w, req, links)
+}
+
+// experimentHelpers returns the experiment template helpers for a request,
+// reading every experiment as unassigned while experiments are disabled
+func (r *Router) experimentHelpers(req *http.Request) template.FuncMap {
+	if r.experiments != nil {
+		return experiments.TemplateHelpers(req.Context())
+	}
+	return template.FuncMap{
+		"variant":   func(string) string { return "" },
+		"inVariant": func(string, string) bool { return false },
+	}
+}
+
+// tusHelpers returns the tus template helpers, rendering nothing while tus
+// is disabled so layouts can use them either way
+func (r *Router) tusHelpers() template.FuncMap {
+	if r.tus != nil {
+		return r.tus.TemplateHelpers()
+	}
+	return template.FuncMap{
+		"tusScript":   func() template.HTML { return "" },
+		"tusEndpoint": func() string { return "" },
+	}
 }
 
 // setupWebRoutes configures web routes with HTMX support
@@ -90,18 +161,21 @@ func (r *Router) setupWebRoutes(router chi.Router) {
 		auth.Post("/login", r.handleLoginSubmit)
 		auth.Get("/register", r.handleRegisterPage)
 		auth.Post("/register", r.handleRegisterSubmit)
-		auth.Post("/logout", webAuthMiddleware.Authenticate(http.HandlerFunc(r.handleLogout)).ServeHTTP)
+		auth.Post("/logout", r.authenticate(webAuthMiddleware)(http.HandlerFunc(r.handleLogout)).ServeHTTP)
 	})
 
 	// Dashboard (protected)
 	router.Route("/dashboard", func(dashboard chi.Router) {
-		dashboard.Use(webAuthMiddleware.Authenticate)
+		dashboard.Use(r.authenticate(webAuthMiddleware))
+		if r.presenceTracker != nil {
+			dashboard.Use(presence.Track(r.presenceTracker, r.presenceMember, presence.PathChannel))
+		}
 		dashboard.Get("/", r.handleDashboard)
 	})
 
 	// Admin routes
 	router.Route("/admin", func(admin chi.Router) {
-		admin.Use(webAuthMiddleware.Authenticate)
+		admin.Use(r.authenticate(webAuthMiddleware))
 		admin.Use(webAuthMiddleware.RoleMiddleware("admin"))
 
 		admin.Get("/", r.handleAdminDashboard)
@@ -111,7 +185,7 @@ func (r *Router) setupWebRoutes(router chi.Router) {
 
 	// HTMX partial routes
 	router.Route("/partials", func(partials chi.Router) {
-		partials.Use(webAuthMiddleware.Authenticate)
+		partials.Use(r.authenticate(webAuthMiddleware))
 		partials.Get("/user-menu", r.handleUserMenu)
 		partials.Get("/notifications", r.handleNotifications)
 		partials.Get("/sidebar", r.handleSidebar)
@@ -120,14 +194,14 @@ func (r *Router) setupWebRoutes(router chi.Router) {
 
 // handleHome renders the home page with HTMX integration
 func (r *Router) handleHome(w http.ResponseWriter, req *http.Request) {
-	if err := render(w, "ui/views/pages/home.html"); err != nil {
+	if err := r.render(w, req, "ui/views/pages/home.html"); err != nil {
 		http.Error(w, "Home view not found", http.StatusInternalServerError)
 	}
 }
 
 // handleLoginPage renders the login page
 func (r *Router) handleLoginPage(w http.ResponseWriter, req *http.Request) {
-	if err := render(w, "ui/views/auth/login.html"); err != nil {
+	if err := r.render(w, req, "ui/views/auth/login.html"); err != nil {
 		http.Error(w, "Login view not found", http.StatusInternalServerError)
 	}
 }
@@ -146,7 +220,10 @@ func (r *Router) handleLoginSubmit(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if err := r.authManager.LoginWithCredentials(map[string]string{"email": email, "password": password}); err != nil {
+	// Decoy accounts alert and ban, and are refused like any other
+	// wrong credentials
+	honeytoken := r.intrusion != nil && r.intrusion.Credential(req, email)
+	if honeytoken || r.authManager.LoginWithCredentials(map[string]string{"email": email, "password": password}) != nil {
 		w.WriteHeader(http.StatusUnauthorized)
 		w.Write([]byte(`<div class="bg-red-100 border border-red-400 text-red-700 px-4 py-3 rounded">Invalid credentials.</div>`))
 		return
@@ -160,7 +237,7 @@ func (r *Router) handleLoginSubmit(w http.ResponseWriter, req *http.Request) {
 
 // handleRegisterPage renders the register page
 func (r *Router) handleRegisterPage(w http.ResponseWriter, req *http.Request) {
-	if err := render(w, "ui/views/auth/register.html"); err != nil {
+	if err := r.render(w, req, "ui/views/auth/register.html"); err != nil {
 		http.Error(w, "Register view not found", http.StatusInternalServerError)
 	}
 }
@@ -182,7 +259,7 @@ func (r *Router) handleRegisterSubmit(w http.ResponseWriter, req *http.Request)
 	}
 
 	// Minimal user create (plaintext password placeholder)
-	db := r.app.DB().GetDB()
+	db := r.app.DB().GetDB().WithContext(req.Context())
 	u := auth.User{Email: email, Password: password, FirstName: first, LastName: last}
 	if err := db.Create(&u).Error; err != nil {
 		w.WriteHeader(http.StatusConflict)
@@ -215,7 +292,7 @@ func (r *Router) handleLogout(w http.ResponseWriter, req *http.Request) {
 
 // handleDashboard renders the dashboard with HTMX
 func (r *Router) handleDashboard(w http.ResponseWriter, req *http.Request) {
-	if err := render(w, "ui/views/pages/dashboard.html"); err != nil {
+	if err := r.render(w, req, "ui/views/pages/dashboard.html"); err != nil {
 		http.Error(w, "Dashboard view not found", http.StatusInternalServerError)
 	}
 }
@@ -0,0 +1,43 @@
+package routing
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Match finds the chi route pattern r will be served by, before it is
+// routed, or "" when the router isn't chi or nothing matches. Middleware
+// added with Use runs before chi routes the request, when the route
+// context's own pattern is still empty, so keying on it there would make
+// a bucket, policy or metric per URL.
+func Match(r *http.Request) string {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil || rctx.Routes == nil {
+		return ""
+	}
+	match := chi.NewRouteContext()
+	if !rctx.Routes.Match(match, r.Method, r.URL.Path) {
+		return ""
+	}
+	return match.RoutePattern()
+}
+
+// Pattern returns the route pattern that served r, once it has been
+// routed: chi's, or the pattern http.ServeMux matched without its method
+// and host. It is "" for unmatched requests, whose paths would make a
+// label, span or log field per URL.
+func Pattern(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		return rctx.RoutePattern()
+	}
+	pattern := r.Pattern
+	if i := strings.IndexByte(pattern, ' '); i >= 0 {
+		pattern = strings.TrimLeft(pattern[i:], " ")
+	}
+	if i := strings.IndexByte(pattern, '/'); i > 0 {
+		pattern = pattern[i:]
+	}
+	return pattern
+}
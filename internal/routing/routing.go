@@ -0,0 +1,302 @@
+// Package routing names middleware, so routes ask for it by alias, such as
+// "auth" or "throttle:60,1", or by group, such as "api", a list of aliases
+// configured under http.middleware_groups:
+//
+//	routing.Wrap(r).Group("api", func(r *routing.Router) {
+//		r.Get("/orders", orders.Index)
+//		r.Middleware("verified", "throttle:10,1").Post("/orders", orders.Store)
+//	})
+//
+// The router registers the framework's aliases and the configured groups
+// on Default; applications add their own aliases with Default.Alias.
+// route:list shows the names each route runs.
+package routing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Factory makes the middleware of an alias from its parameters, the
+// comma-separated list after the colon: ["60", "1"] for "throttle:60,1"
+type Factory func(params []string) (func(http.Handler) http.Handler, error)
+
+// Plain is the factory of an alias taking no parameters
+func Plain(mw func(http.Handler) http.Handler) Factory {
+	return func(params []string) (func(http.Handler) http.Handler, error) {
+		if len(params) > 0 {
+			return nil, errors.New("takes no parameters")
+		}
+		return mw, nil
+	}
+}
+
+// ErrUnknown is returned for names that are neither an alias nor a group
+var ErrUnknown = errors.New("routing: unknown middleware")
+
+// Kernel holds the middleware aliases and groups
+type Kernel struct {
+	mu      sync.RWMutex
+	aliases map[string]Factory
+	groups  map[string][]string
+}
+
+// Default is the kernel of the application's routes
+var Default = NewKernel()
+
+// NewKernel creates a kernel with the empty web and api groups
+func NewKernel() *Kernel {
+	return &Kernel{
+		aliases: map[string]Factory{},
+		groups:  map[string][]string{"web": nil, "api": nil},
+	}
+}
+
+// Alias names middleware, replacing any alias of that name
+func (k *Kernel) Alias(name string, factory Factory) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.aliases[name] = factory
+}
+
+// Group defines a group as a list of aliases and other groups, replacing
+// any group of that name
+func (k *Kernel) Group(name string, middleware ...string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.groups[name] = middleware
+}
+
+// Aliases returns the names of the aliases, sorted
+func (k *Kernel) Aliases() []string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	names := make([]string, 0, len(k.aliases))
+	for name := range k.aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Groups returns the groups and their middleware
+func (k *Kernel) Groups() map[string][]string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	groups := make(map[string][]string, len(k.groups))
+	for name, middleware := range k.groups {
+		groups[name] = append([]string(nil), middleware...)
+	}
+	return groups
+}
+
+// Resolve returns the middleware of names, in order, each a group or an
+// alias with its parameters
+func (k *Kernel) Resolve(names ...string) ([]func(http.Handler) http.Handler, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	middleware := make([]func(http.Handler) http.Handler, 0, len(names))
+	for _, name := range names {
+		mw, err := k.resolve(name, nil)
+		if err != nil {
+			return nil, err
+		}
+		middleware = append(middleware, mw)
+	}
+	return middleware, nil
+}
+
+// resolve makes the middleware of one name; within names the groups being
+// expanded, so that a group including itself is reported
+func (k *Kernel) resolve(name string, within []string) (func(http.Handler) http.Handler, error) {
+	if members, ok := k.groups[name]; ok {
+		for _, outer := range within {
+			if outer == name {
+				return nil, fmt.Errorf("routing: group %s includes itself", name)
+			}
+		}
+		chain := make([]func(http.Handler) http.Handler, 0, len(members))
+		for _, member := range members {
+			mw, err := k.resolve(member, append(within, name))
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, mw)
+		}
+		return group(name, chain), nil
+	}
+
+	alias, params, _ := strings.Cut(name, ":")
+	factory, ok := k.aliases[alias]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknown, name)
+	}
+	var args []string
+	if params != "" {
+		args = strings.Split(params, ",")
+	}
+	mw, err := factory(args)
+	if err != nil {
+		return nil, fmt.Errorf("routing: %s: %w", name, err)
+	}
+	return tag(name, mw), nil
+}
+
+// named is a handler made by the middleware of an alias or group, which
+// Names finds by its name
+type named struct {
+	http.Handler
+	name string
+}
+
+// tag names mw. Every tagged middleware is made by this one function
+// literal, which is how Names tells them from others without calling those.
+func tag(name string, mw func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return named{Handler: mw(next), name: name}
+	}
+}
+
+// groupsKey is the context key of the groups a request has gone through
+type groupsKey struct{}
+
+// group runs chain once per request, so that routes registered in a group
+// and mounted inside the same group again aren't throttled twice
+func group(name string, chain []func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return tag(name, func(next http.Handler) http.Handler {
+		inner := next
+		for i := len(chain) - 1; i >= 0; i-- {
+			inner = chain[i](inner)
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			applied, _ := r.Context().Value(groupsKey{}).([]string)
+			for _, g := range applied {
+				if g == name {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			applied = append(applied[:len(applied):len(applied)], name)
+			inner.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), groupsKey{}, applied)))
+		})
+	})
+}
+
+var tagCode = reflect.ValueOf(tag("", nil)).Pointer()
+
+// Names returns the names of the aliases and groups among middleware, as
+// route:list shows them; other middleware is skipped
+func Names(middleware ...func(http.Handler) http.Handler) []string {
+	var names []string
+	for _, mw := range middleware {
+		if mw == nil || reflect.ValueOf(mw).Pointer() != tagCode {
+			continue
+		}
+		if h, ok := mw(http.NotFoundHandler()).(named); ok {
+			names = append(names, h.name)
+		}
+	}
+	return names
+}
+
+// Walk calls fn for every route of r with the middleware it runs, like
+// chi.Walk, but also counting the middleware of the groups sub-routers are
+// mounted in, which chi.Walk leaves out
+func Walk(r chi.Routes, fn chi.WalkFunc) error {
+	return walk(r, fn, "", nil)
+}
+
+func walk(r chi.Routes, fn chi.WalkFunc, parent string, parentMiddleware []func(http.Handler) http.Handler) error {
+	for _, route := range r.Routes() {
+		middleware := append(parentMiddleware[:len(parentMiddleware):len(parentMiddleware)], r.Middlewares()...)
+
+		if route.SubRoutes != nil {
+			if chain, ok := route.Handlers["*"].(*chi.ChainHandler); ok {
+				middleware = append(middleware, chain.Middlewares...)
+			}
+			if err := walk(route.SubRoutes, fn, parent+strings.TrimSuffix(route.Pattern, "/*"), middleware); err != nil {
+				return err
+			}
+			continue
+		}
+
+		methods := make([]string, 0, len(route.Handlers))
+		for method := range route.Handlers {
+			if method != "*" {
+				methods = append(methods, method)
+			}
+		}
+		sort.Strings(methods)
+		for _, method := range methods {
+			handler, routeMiddleware := route.Handlers[method], middleware
+			if chain, ok := handler.(*chi.ChainHandler); ok {
+				handler, routeMiddleware = chain.Endpoint, append(middleware[:len(middleware):len(middleware)], chain.Middlewares...)
+			}
+			if err := fn(method, parent+route.Pattern, handler, routeMiddleware...); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Router is a chi router whose routes ask for middleware by name
+type Router struct {
+	chi.Router
+	kernel *Kernel
+
+	// base is the router the routes are registered on, through the
+	// middleware asked for so far
+	base       chi.Router
+	middleware []func(http.Handler) http.Handler
+}
+
+// Wrap returns r asking Default for middleware
+func Wrap(r chi.Router) *Router {
+	return Default.Wrap(r)
+}
+
+// Wrap returns r asking k for middleware
+func (k *Kernel) Wrap(r chi.Router) *Router {
+	return &Router{Router: r, kernel: k, base: r}
+}
+
+// Group runs fn with a router whose routes run the named middleware, a
+// group or an alias. Like chi's bad patterns, unknown names panic.
+func (r *Router) Group(name string, fn func(r *Router)) *Router {
+	sub := r.Middleware(name)
+	if fn != nil {
+		fn(sub)
+	}
+	return sub
+}
+
+// Middleware returns a router whose routes run the named middleware, for
+// single routes: r.Middleware("auth").Post("/orders", store)
+func (r *Router) Middleware(names ...string) *Router {
+	middleware, err := r.kernel.Resolve(names...)
+	if err != nil {
+		panic(err)
+	}
+	middleware = append(r.middleware[:len(r.middleware):len(r.middleware)], middleware...)
+	return &Router{Router: r.base.With(middleware...), kernel: r.kernel, base: r.base, middleware: middleware}
+}
+
+// Route mounts a sub-router on pattern, built by fn. The sub-router runs
+// the middleware asked for so far itself, so that route:list sees it.
+func (r *Router) Route(pattern string, fn func(r *Router)) *Router {
+	sub := chi.NewRouter()
+	sub.Use(r.middleware...)
+	wrapped := r.kernel.Wrap(sub)
+	fn(wrapped)
+	r.base.Mount(pattern, sub)
+	return wrapped
+}
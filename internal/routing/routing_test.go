@@ -0,0 +1,173 @@
+package routing
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// trace appends name to the X-Trace header of the request it passes on
+func trace(name string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Header.Add("X-Trace", name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func newKernel() *Kernel {
+	k := NewKernel()
+	k.Alias("auth", Plain(trace("auth")))
+	k.Alias("throttle", func(params []string) (func(http.Handler) http.Handler, error) {
+		if len(params) != 2 {
+			return nil, errors.New("wants a limit and minutes")
+		}
+		return trace("throttle " + strings.Join(params, "/")), nil
+	})
+	k.Group("api", "throttle:60,1", "auth")
+	return k
+}
+
+func serve(h http.Handler, path string) string {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	return strings.Join(req.Header.Values("X-Trace"), ", ")
+}
+
+func TestGroupsAndAliases(t *testing.T) {
+	k := newKernel()
+	mux := chi.NewRouter()
+	r := k.Wrap(mux)
+	reached := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {})
+
+	r.Group("api", func(r *Router) {
+		r.Get("/orders", reached)
+		r.Middleware("throttle:5,1").Post("/orders", reached)
+	})
+	r.Group("web", func(r *Router) {
+		r.Route("/account", func(r *Router) {
+			r.Middleware("auth").Get("/", reached)
+		})
+	})
+	r.Get("/", reached)
+
+	assert.Equal(t, "throttle 60/1, auth", serve(mux, "/orders"))
+	assert.Equal(t, "auth", serve(mux, "/account"), "the web group is empty")
+	assert.Empty(t, serve(mux, "/"))
+
+	req := httptest.NewRequest(http.MethodPost, "/orders", nil)
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, []string{"throttle 60/1", "auth", "throttle 5/1"}, req.Header.Values("X-Trace"))
+
+	routes := map[string][]string{}
+	require.NoError(t, Walk(mux, func(method, route string, _ http.Handler, middleware ...func(http.Handler) http.Handler) error {
+		routes[method+" "+route] = Names(middleware...)
+		return nil
+	}))
+	assert.Equal(t, []string{"api"}, routes["GET /orders"])
+	assert.Equal(t, []string{"api", "throttle:5,1"}, routes["POST /orders"])
+	assert.Equal(t, []string{"web", "auth"}, routes["GET /account/"])
+	assert.Empty(t, routes["GET /"])
+
+	inline := chi.NewRouter()
+	k.Wrap(inline).Group("api", func(r *Router) {
+		r.Router.Route("/v1", func(r chi.Router) {
+			r.Get("/orders", reached)
+		})
+	})
+	require.NoError(t, Walk(inline, func(method, route string, _ http.Handler, middleware ...func(http.Handler) http.Handler) error {
+		assert.Equal(t, "GET /v1/orders", method+" "+route)
+		assert.Equal(t, []string{"api"}, Names(middleware...), "chi's own sub-routers in a group")
+		return nil
+	}))
+}
+
+func TestGroupsRunOncePerRequest(t *testing.T) {
+	k := newKernel()
+	inner := chi.NewRouter()
+	k.Wrap(inner).Group("api", func(r *Router) {
+		r.Get("/orders", func(w http.ResponseWriter, req *http.Request) {})
+	})
+	outer := chi.NewRouter()
+	k.Wrap(outer).Group("api", func(r *Router) {
+		r.Mount("/v1", inner)
+	})
+
+	assert.Equal(t, "throttle 60/1, auth", serve(outer, "/v1/orders"))
+}
+
+func TestResolveErrors(t *testing.T) {
+	k := newKernel()
+
+	_, err := k.Resolve("verified")
+	assert.ErrorIs(t, err, ErrUnknown)
+	_, err = k.Resolve("throttle:60")
+	assert.EqualError(t, err, "routing: throttle:60: wants a limit and minutes")
+	_, err = k.Resolve("auth:admin")
+	assert.Error(t, err, "auth takes no parameters")
+
+	k.Group("admin", "api", "everyone")
+	k.Group("everyone", "admin")
+	_, err = k.Resolve("admin")
+	assert.EqualError(t, err, "routing: group admin includes itself")
+
+	assert.Panics(t, func() { k.Wrap(chi.NewRouter()).Group("verified", nil) })
+	assert.Equal(t, []string{"auth", "throttle"}, k.Aliases())
+	assert.Equal(t, []string{"throttle:60,1", "auth"}, k.Groups()["api"])
+}
+
+func TestMatch(t *testing.T) {
+	var seen []string
+	r := chi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			seen = append(seen, Match(req))
+			next.ServeHTTP(w, req)
+		})
+	})
+	r.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	r.Route("/admin", func(r chi.Router) {
+		r.Post("/posts/{post}", func(w http.ResponseWriter, r *http.Request) {})
+	})
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/users/1", nil),
+		httptest.NewRequest(http.MethodPost, "/admin/posts/7", nil),
+		httptest.NewRequest(http.MethodGet, "/missing", nil),
+	} {
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	assert.Equal(t, []string{"/users/{id}", "/admin/posts/{post}", ""}, seen)
+	assert.Empty(t, Match(httptest.NewRequest(http.MethodGet, "/users/1", nil)), "not served by chi")
+}
+
+func TestPattern(t *testing.T) {
+	var seen []string
+	record := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			next.ServeHTTP(w, req)
+			seen = append(seen, Pattern(req))
+		})
+	}
+	r := chi.NewRouter()
+	r.Use(record)
+	r.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+
+	// http.ServeMux's patterns lose their method and host
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET example.com/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		seen = append(seen, Pattern(r))
+	})
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://example.com/items/3", nil))
+
+	assert.Equal(t, []string{"/users/{id}", "", "/items/{id}"}, seen)
+}
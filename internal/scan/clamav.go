@@ -0,0 +1,160 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+const (
+	// clamChunk is how much is sent to clamd at a time
+	clamChunk = 64 << 10
+
+	defaultClamAVAddress = "localhost:3310"
+	defaultClamAVTimeout = 2 * time.Minute
+)
+
+// ClamAV scans content with a clamd daemon, streaming it over the INSTREAM
+// command. Files larger than clamd's StreamMaxLength are reported as
+// errors, not as clean.
+type ClamAV struct {
+	network string
+	address string
+	timeout time.Duration
+	dialer  net.Dialer
+}
+
+// NewClamAV creates a scanner for the clamd at cfg.Address: a host:port,
+// or the path of a unix socket
+func NewClamAV(cfg config.ClamAVConfig) *ClamAV {
+	c := &ClamAV{network: "tcp", address: cfg.Address, timeout: cfg.Timeout}
+	if c.address == "" {
+		c.address = defaultClamAVAddress
+	}
+	if strings.HasPrefix(c.address, "/") || strings.HasPrefix(c.address, "unix:") {
+		c.network, c.address = "unix", strings.TrimPrefix(c.address, "unix:")
+	}
+	if c.timeout <= 0 {
+		c.timeout = defaultClamAVTimeout
+	}
+	return c
+}
+
+func (c *ClamAV) Name() string {
+	return "clamav"
+}
+
+// dial connects to clamd, with a deadline for the whole command
+func (c *ClamAV) dial(ctx context.Context) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	conn, err := c.dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return nil, fmt.Errorf("scan: connecting to clamd: %w", err)
+	}
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	return conn, nil
+}
+
+// Ping checks clamd is answering
+func (c *ClamAV) Ping(ctx context.Context) error {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("zPING\x00")); err != nil {
+		return fmt.Errorf("scan: clamd: %w", err)
+	}
+	reply, err := readClamReply(conn)
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("scan: clamd answered %q", reply)
+	}
+	return nil
+}
+
+func (c *ClamAV) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+	defer conn.Close()
+	// Stop at once when ctx is done mid-scan
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	w := bufio.NewWriterSize(conn, clamChunk+4)
+	w.WriteString("zINSTREAM\x00")
+	chunk := make([]byte, clamChunk)
+	var size [4]byte
+	for {
+		n, err := io.ReadFull(r, chunk)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size[:], uint32(n))
+			w.Write(size[:])
+			if _, err := w.Write(chunk[:n]); err != nil {
+				// clamd hangs up when the stream passes its limit;
+				// its reply says so
+				break
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return Result{}, fmt.Errorf("scan: reading the file: %w", err)
+		}
+	}
+	w.Write([]byte{0, 0, 0, 0})
+	writeErr := w.Flush()
+
+	reply, err := readClamReply(conn)
+	if err != nil {
+		if writeErr != nil {
+			err = writeErr
+		}
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return Result{}, fmt.Errorf("scan: clamd: %w", err)
+	}
+	return parseClamReply(reply)
+}
+
+// readClamReply reads a reply to a z-prefixed command, ended by a NUL
+func readClamReply(conn net.Conn) (string, error) {
+	reply, err := bufio.NewReader(conn).ReadBytes(0)
+	if err != nil && !(errors.Is(err, io.EOF) && len(reply) > 0) {
+		return "", err
+	}
+	return string(bytes.TrimRight(reply, "\x00\n")), nil
+}
+
+// parseClamReply reads a scan's verdict: "stream: OK", "stream: <name>
+// FOUND" or "<reason> ERROR"
+func parseClamReply(reply string) (Result, error) {
+	reply = strings.TrimSpace(strings.TrimPrefix(reply, "stream:"))
+	switch {
+	case reply == "OK":
+		return Result{}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return Result{Infected: true, Signature: strings.TrimSuffix(reply, " FOUND")}, nil
+	case strings.HasSuffix(reply, " ERROR"):
+		return Result{}, fmt.Errorf("scan: clamd: %s", strings.TrimSuffix(reply, " ERROR"))
+	default:
+		return Result{}, fmt.Errorf("scan: clamd answered %q", reply)
+	}
+}
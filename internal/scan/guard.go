@@ -0,0 +1,327 @@
+package scan
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/correlation"
+	"github.com/mrhoseah/dolphin/internal/providers"
+	"github.com/mrhoseah/dolphin/internal/storage"
+)
+
+// JobType is the type of the queue jobs that scan stored files
+const JobType = "scan.file"
+
+// TusDisk is the name the disk of completed tus uploads is added under
+const TusDisk = "tus"
+
+// Actions taken on infected files
+const (
+	// Reject deletes infected files
+	Reject = "reject"
+
+	// Quarantine moves infected files to the quarantine disk, with a
+	// .json file describing the detection next to each
+	Quarantine = "quarantine"
+)
+
+// Detection records an infected file and what was done with it
+type Detection struct {
+	Disk      string    `json:"disk"`
+	Path      string    `json:"path"`
+	Signature string    `json:"signature"`
+	Scanner   string    `json:"scanner"`
+	Action    string    `json:"action"`
+	RequestID string    `json:"request_id,omitempty"`
+	UserID    string    `json:"user_id,omitempty"`
+	Tenant    string    `json:"tenant,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// Guard scans uploads on the disks added to it and rejects or quarantines
+// the infected ones
+type Guard struct {
+	scanner    Scanner
+	action     string
+	quarantine storage.Driver
+	asyncAbove int64
+	logger     *zap.Logger
+	now        func() time.Time
+
+	mu        sync.RWMutex
+	disks     map[string]storage.Driver
+	queue     providers.QueueProvider
+	queueName string
+}
+
+// QuarantineDisk creates the driver infected files are quarantined on:
+// the storage disk named by scan.quarantine_disk, or the local directory
+// scan.quarantine_dir
+func QuarantineDisk(cfg *config.Config) (storage.Driver, error) {
+	if cfg.Scan.QuarantineDisk == "" {
+		return storage.NewLocalDriver(cfg.Scan.QuarantineDir, ""), nil
+	}
+	return storage.Disk(&cfg.Storage, cfg.Scan.QuarantineDisk)
+}
+
+// FromConfig creates the guard of the scan config, with the disk of
+// completed tus uploads added
+func FromConfig(cfg *config.Config, logger *zap.Logger) (*Guard, error) {
+	scanner, err := New(cfg.Scan)
+	if err != nil {
+		return nil, err
+	}
+	quarantine, err := QuarantineDisk(cfg)
+	if err != nil {
+		return nil, err
+	}
+	guard, err := NewGuard(scanner, cfg.Scan, quarantine, logger)
+	if err != nil {
+		return nil, err
+	}
+	tus, err := storage.TusDisk(cfg)
+	if err != nil {
+		return nil, err
+	}
+	guard.AddDisk(TusDisk, tus)
+	return guard, nil
+}
+
+// NewGuard creates a guard scanning with scanner and dealing with infected
+// files as cfg.Action says, quarantining them on quarantine
+func NewGuard(scanner Scanner, cfg config.ScanConfig, quarantine storage.Driver, logger *zap.Logger) (*Guard, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	action := cfg.Action
+	switch action {
+	case "":
+		action = Reject
+	case Reject, Quarantine:
+	default:
+		return nil, fmt.Errorf("scan: unknown action %q", cfg.Action)
+	}
+	if action == Quarantine && quarantine == nil {
+		return nil, fmt.Errorf("scan: quarantining needs a quarantine disk")
+	}
+	return &Guard{
+		scanner:    scanner,
+		action:     action,
+		quarantine: quarantine,
+		asyncAbove: cfg.AsyncAbove,
+		logger:     logger,
+		now:        time.Now,
+		disks:      make(map[string]storage.Driver),
+	}, nil
+}
+
+// AddDisk lets the guard scan files stored on disk under name, such as
+// those named in queued scans
+func (g *Guard) AddDisk(name string, disk storage.Driver) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.disks[name] = disk
+}
+
+// UseQueue has files larger than scan.async_above scanned by jobs pushed
+// to the named queue, whose workers must process them with JobHandler
+func (g *Guard) UseQueue(queue providers.QueueProvider, name string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.queue = queue
+	g.queueName = name
+}
+
+// Async reports whether a file of size is scanned by a queue job once
+// stored, rather than before
+func (g *Guard) Async(size int64) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.queue != nil && g.asyncAbove > 0 && size > g.asyncAbove
+}
+
+// Check scans content about to be stored at file on disk, leaving it read
+// back from the start when clean. An infected file is quarantined, when
+// the guard does, and an *InfectedError returned.
+func (g *Guard) Check(ctx context.Context, disk, file string, content io.ReadSeeker) error {
+	result, err := g.scanner.Scan(ctx, content)
+	if err != nil {
+		return err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if !result.Infected {
+		return nil
+	}
+	g.infected(ctx, disk, file, result, func() (io.ReadCloser, error) {
+		return io.NopCloser(content), nil
+	})
+	return &InfectedError{Path: file, Signature: result.Signature}
+}
+
+// CheckStored scans the file stored at file on the named disk. An infected
+// file is moved to quarantine or deleted, and an *InfectedError returned.
+func (g *Guard) CheckStored(ctx context.Context, disk, file string) error {
+	driver, err := g.disk(disk)
+	if err != nil {
+		return err
+	}
+	content, err := driver.Get(file)
+	if err != nil {
+		return err
+	}
+	result, err := g.scanner.Scan(ctx, content)
+	content.Close()
+	if err != nil {
+		return err
+	}
+	if !result.Infected {
+		return nil
+	}
+
+	g.infected(ctx, disk, file, result, func() (io.ReadCloser, error) {
+		return driver.Get(file)
+	})
+	if err := driver.Delete(file); err != nil {
+		g.logger.Error("Failed to remove an infected file", zap.String("disk", disk), zap.String("path", file), zap.Error(err))
+	}
+	return &InfectedError{Path: file, Signature: result.Signature}
+}
+
+// Scan checks the file stored at file on the named disk, queueing the
+// check when the file is large and the guard has a queue. It reports
+// whether the check was queued.
+func (g *Guard) Scan(ctx context.Context, disk, file string, size int64) (bool, error) {
+	if g.Async(size) {
+		err := g.Enqueue(ctx, disk, file)
+		if err == nil {
+			return true, nil
+		}
+		g.logger.Warn("Failed to queue a scan; scanning now", zap.String("disk", disk), zap.String("path", file), zap.Error(err))
+	}
+	return false, g.CheckStored(ctx, disk, file)
+}
+
+// CheckUpload checks a completed tus upload, for TusServer.OnStored
+func (g *Guard) CheckUpload(ctx context.Context, u *storage.Upload) error {
+	_, err := g.Scan(ctx, TusDisk, u.Path, u.Size)
+	return err
+}
+
+// Enqueue pushes a job checking the file stored at file on the named disk
+func (g *Guard) Enqueue(ctx context.Context, disk, file string) error {
+	g.mu.RLock()
+	queue, name := g.queue, g.queueName
+	g.mu.RUnlock()
+	if queue == nil {
+		return fmt.Errorf("scan: no queue")
+	}
+	return queue.Push(name, providers.Job{
+		ID:          disk + ":" + file,
+		Type:        JobType,
+		Payload:     map[string]interface{}{"disk": disk, "path": file},
+		Correlation: correlation.Capture(ctx),
+	})
+}
+
+// JobHandler checks the files of the jobs pushed by Enqueue. Infected
+// files are dealt with and the job is done; a scanner failure fails the
+// job so it is retried.
+func (g *Guard) JobHandler() providers.JobHandler {
+	return func(job providers.Job) error {
+		disk, _ := job.Payload["disk"].(string)
+		file, _ := job.Payload["path"].(string)
+		if job.Type != JobType || disk == "" || file == "" {
+			return fmt.Errorf("scan: not a scan job: %s", job.ID)
+		}
+		return correlation.Run(context.Background(), job.Correlation, "job "+job.Type, func(ctx context.Context) error {
+			driver, err := g.disk(disk)
+			if err != nil {
+				return err
+			}
+			if !driver.Exists(file) {
+				// Deleted before its turn came
+				return nil
+			}
+			if err := g.CheckStored(ctx, disk, file); err != nil && !IsInfected(err) {
+				return err
+			}
+			return nil
+		})
+	}
+}
+
+func (g *Guard) disk(name string) (storage.Driver, error) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	driver, ok := g.disks[name]
+	if !ok {
+		return nil, fmt.Errorf("scan: no disk named %q", name)
+	}
+	return driver, nil
+}
+
+// infected quarantines an infected file when the guard does, reading it
+// with open, and logs the detection as an audit event
+func (g *Guard) infected(ctx context.Context, disk, file string, result Result, open func() (io.ReadCloser, error)) {
+	fields := correlation.Capture(ctx)
+	detection := Detection{
+		Disk:      disk,
+		Path:      file,
+		Signature: result.Signature,
+		Scanner:   g.scanner.Name(),
+		Action:    g.action,
+		RequestID: fields[correlation.RequestIDKey],
+		UserID:    fields[correlation.UserKey],
+		Tenant:    fields[correlation.TenantKey],
+		At:        g.now().UTC(),
+	}
+	if g.action == Quarantine {
+		if err := g.quarantineFile(detection, open); err != nil {
+			g.logger.Error("Failed to quarantine an infected file", zap.String("disk", disk), zap.String("path", file), zap.Error(err))
+			detection.Action = Reject
+		}
+	}
+
+	g.logger.Warn("Audit event",
+		zap.String("action", "upload.infected"),
+		zap.String("resource", disk+":"+file),
+		zap.String("user_id", detection.UserID),
+		zap.Bool("success", false),
+		zap.String("category", "audit"),
+		zap.String("signature", detection.Signature),
+		zap.String("scanner", detection.Scanner),
+		zap.String("outcome", detection.Action),
+		zap.String("request_id", detection.RequestID),
+		zap.String("tenant", detection.Tenant))
+}
+
+// quarantineFile copies a file to <disk>/<path> on the quarantine disk,
+// with its detection next to it
+func (g *Guard) quarantineFile(detection Detection, open func() (io.ReadCloser, error)) error {
+	content, err := open()
+	if err != nil {
+		return err
+	}
+	target := path.Join(detection.Disk, detection.Path)
+	err = g.quarantine.Put(target, content)
+	content.Close()
+	if err != nil {
+		return err
+	}
+	record, err := json.MarshalIndent(detection, "", "  ")
+	if err != nil {
+		return err
+	}
+	return g.quarantine.Put(target+".json", bytes.NewReader(record))
+}
@@ -0,0 +1,102 @@
+// Package scan checks uploads for malware before the application keeps
+// them. A Scanner looks at a file's content; the Guard decides what
+// happens to infected files, rejecting or quarantining them, and logs each
+// detection as an audit event:
+//
+//	scanner, _ := scan.New(cfg.Scan)
+//	guard, _ := scan.NewGuard(scanner, cfg.Scan, quarantine, logger)
+//	media.Default.UseScanner(guard)
+//
+// Large files can be stored at once and scanned by a queue job instead,
+// with UseQueue and JobHandler.
+package scan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/problem"
+	"github.com/mrhoseah/dolphin/internal/storage"
+)
+
+// ErrInfected is wrapped by the errors of infected files. It wraps
+// storage.ErrUploadRejected, so resumable uploads refuse them with 422.
+var ErrInfected = fmt.Errorf("%w: infected", storage.ErrUploadRejected)
+
+// Result is what a scanner found in a file
+type Result struct {
+	Infected bool
+
+	// Signature names the malware found, e.g. Win.Test.EICAR_HDB-1
+	Signature string
+}
+
+// Scanner checks content for malware
+type Scanner interface {
+	// Scan reads r to its end and reports what it found. An error means
+	// the content couldn't be scanned, not that it is infected.
+	Scan(ctx context.Context, r io.Reader) (Result, error)
+
+	// Name identifies the scanner in audit logs
+	Name() string
+}
+
+// New creates the scanner named by cfg.Driver: clamav, or none
+func New(cfg config.ScanConfig) (Scanner, error) {
+	switch cfg.Driver {
+	case "none", "":
+		return Nop{}, nil
+	case "clamav":
+		return NewClamAV(cfg.ClamAV), nil
+	default:
+		return nil, fmt.Errorf("scan: unknown driver %q", cfg.Driver)
+	}
+}
+
+// Nop finds every file clean, for when scanning is off
+type Nop struct{}
+
+func (Nop) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	return Result{}, nil
+}
+
+func (Nop) Name() string {
+	return "none"
+}
+
+// InfectedError is returned for a file a scanner found malware in. It is
+// reported to clients as 422 with Field's error.
+type InfectedError struct {
+	// Field is the form field the file was sent in, file when empty
+	Field string
+
+	// Path is where the file was to be stored, or was stored, on its disk
+	Path      string
+	Signature string
+}
+
+func (e *InfectedError) Error() string {
+	return fmt.Sprintf("scan: %s is infected with %s", e.Path, e.Signature)
+}
+
+func (e *InfectedError) Unwrap() error {
+	return ErrInfected
+}
+
+// Problem reports the error as a validation failure of the file's field,
+// without naming the malware
+func (e *InfectedError) Problem() *problem.Problem {
+	field := e.Field
+	if field == "" {
+		field = "file"
+	}
+	return problem.Validation(map[string]string{field: "must not contain malware"}).Problem()
+}
+
+// IsInfected reports whether err is an InfectedError
+func IsInfected(err error) bool {
+	return errors.Is(err, ErrInfected)
+}
@@ -0,0 +1,275 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/problem"
+	"github.com/mrhoseah/dolphin/internal/providers"
+	"github.com/mrhoseah/dolphin/internal/storage"
+)
+
+// eicar is the antivirus test file every scanner detects
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// fakeClamd answers PING and INSTREAM like clamd, finding eicar and
+// refusing streams over limit bytes
+func fakeClamd(t *testing.T, limit int) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				command, err := r.ReadString(0)
+				if err != nil {
+					return
+				}
+				switch command {
+				case "zPING\x00":
+					conn.Write([]byte("PONG\x00"))
+				case "zINSTREAM\x00":
+					var content bytes.Buffer
+					for {
+						var size uint32
+						if binary.Read(r, binary.BigEndian, &size) != nil {
+							return
+						}
+						if size == 0 {
+							break
+						}
+						if content.Len()+int(size) > limit {
+							conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+							return
+						}
+						io.CopyN(&content, r, int64(size))
+					}
+					if strings.Contains(content.String(), eicar) {
+						conn.Write([]byte("stream: Win.Test.EICAR_HDB-1 FOUND\x00"))
+					} else {
+						conn.Write([]byte("stream: OK\x00"))
+					}
+				default:
+					conn.Write([]byte("UNKNOWN COMMAND\x00"))
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestClamAV(t *testing.T) {
+	address := fakeClamd(t, 1<<20)
+	scanner, err := New(config.ScanConfig{Driver: "clamav", ClamAV: config.ClamAVConfig{Address: address}})
+	require.NoError(t, err)
+	clamav := scanner.(*ClamAV)
+	ctx := context.Background()
+
+	require.NoError(t, clamav.Ping(ctx))
+
+	result, err := clamav.Scan(ctx, strings.NewReader("hello"))
+	require.NoError(t, err)
+	assert.False(t, result.Infected)
+
+	// Spread over several chunks
+	infected := strings.Repeat("x", clamChunk+10) + eicar
+	result, err = clamav.Scan(ctx, strings.NewReader(infected))
+	require.NoError(t, err)
+	assert.True(t, result.Infected)
+	assert.Equal(t, "Win.Test.EICAR_HDB-1", result.Signature)
+
+	_, err = NewClamAV(config.ClamAVConfig{Address: fakeClamd(t, 100)}).Scan(ctx, strings.NewReader(strings.Repeat("x", 200)))
+	assert.ErrorContains(t, err, "INSTREAM size limit exceeded")
+
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	ln.Close()
+	_, err = NewClamAV(config.ClamAVConfig{Address: ln.Addr().String(), Timeout: time.Second}).Scan(ctx, strings.NewReader("x"))
+	assert.ErrorContains(t, err, "connecting to clamd")
+}
+
+func TestNewClamAV(t *testing.T) {
+	c := NewClamAV(config.ClamAVConfig{})
+	assert.Equal(t, "tcp", c.network)
+	assert.Equal(t, defaultClamAVAddress, c.address)
+	assert.Equal(t, defaultClamAVTimeout, c.timeout)
+
+	c = NewClamAV(config.ClamAVConfig{Address: "unix:/run/clamav/clamd.ctl"})
+	assert.Equal(t, "unix", c.network)
+	assert.Equal(t, "/run/clamav/clamd.ctl", c.address)
+
+	scanner, err := New(config.ScanConfig{})
+	require.NoError(t, err)
+	assert.Equal(t, "none", scanner.Name())
+	_, err = New(config.ScanConfig{Driver: "virustotal"})
+	assert.ErrorContains(t, err, "unknown driver")
+}
+
+func TestParseClamReply(t *testing.T) {
+	result, err := parseClamReply("stream: OK")
+	require.NoError(t, err)
+	assert.False(t, result.Infected)
+	result, err = parseClamReply("stream: Eicar-Signature FOUND")
+	require.NoError(t, err)
+	assert.Equal(t, Result{Infected: true, Signature: "Eicar-Signature"}, result)
+	_, err = parseClamReply("Can't allocate memory ERROR")
+	assert.EqualError(t, err, "scan: clamd: Can't allocate memory")
+}
+
+// signatureScanner finds eicar, like the fake clamd, without a daemon
+type signatureScanner struct{ failing bool }
+
+func (s signatureScanner) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	if s.failing {
+		return Result{}, errors.New("clamd is down")
+	}
+	data, _ := io.ReadAll(r)
+	if strings.Contains(string(data), eicar) {
+		return Result{Infected: true, Signature: "Eicar-Signature"}, nil
+	}
+	return Result{}, nil
+}
+
+func (signatureScanner) Name() string { return "test" }
+
+func newTestGuard(t *testing.T, action string) (*Guard, *storage.LocalDriver, *storage.LocalDriver, *observer.ObservedLogs) {
+	core, logs := observer.New(zap.InfoLevel)
+	uploads := storage.NewLocalDriver(t.TempDir(), "/uploads")
+	quarantine := storage.NewLocalDriver(t.TempDir(), "")
+	guard, err := NewGuard(signatureScanner{}, config.ScanConfig{Action: action, AsyncAbove: 10}, quarantine, zap.New(core))
+	require.NoError(t, err)
+	guard.AddDisk("uploads", uploads)
+	return guard, uploads, quarantine, logs
+}
+
+func TestGuardCheck(t *testing.T) {
+	guard, _, quarantine, logs := newTestGuard(t, Quarantine)
+	ctx := context.Background()
+
+	clean := strings.NewReader("hello")
+	require.NoError(t, guard.Check(ctx, "uploads", "docs/a.txt", clean))
+	data, _ := io.ReadAll(clean)
+	assert.Equal(t, "hello", string(data), "read back from the start")
+
+	err := guard.Check(ctx, "uploads", "docs/b.txt", strings.NewReader(eicar))
+	var infected *InfectedError
+	require.ErrorAs(t, err, &infected)
+	assert.Equal(t, "Eicar-Signature", infected.Signature)
+	assert.True(t, IsInfected(err))
+	assert.ErrorIs(t, err, storage.ErrUploadRejected)
+
+	// Kept in quarantine with what was found
+	content, err := quarantine.Get("uploads/docs/b.txt")
+	require.NoError(t, err)
+	data, _ = io.ReadAll(content)
+	content.Close()
+	assert.Equal(t, eicar, string(data))
+	record, err := quarantine.Get("uploads/docs/b.txt.json")
+	require.NoError(t, err)
+	var detection Detection
+	require.NoError(t, json.NewDecoder(record).Decode(&detection))
+	record.Close()
+	assert.Equal(t, "Eicar-Signature", detection.Signature)
+	assert.Equal(t, Quarantine, detection.Action)
+	assert.Equal(t, "test", detection.Scanner)
+
+	audits := logs.FilterMessage("Audit event").All()
+	require.Len(t, audits, 1)
+	fields := audits[0].ContextMap()
+	assert.Equal(t, "upload.infected", fields["action"])
+	assert.Equal(t, "uploads:docs/b.txt", fields["resource"])
+	assert.Equal(t, "audit", fields["category"])
+	assert.Equal(t, "quarantine", fields["outcome"])
+
+	_, err = NewGuard(Nop{}, config.ScanConfig{Action: "ignore"}, nil, nil)
+	assert.ErrorContains(t, err, "unknown action")
+}
+
+func TestGuardCheckStored(t *testing.T) {
+	guard, uploads, quarantine, _ := newTestGuard(t, Reject)
+	ctx := context.Background()
+	require.NoError(t, uploads.Put("a.txt", strings.NewReader("hello")))
+	require.NoError(t, uploads.Put("b.txt", strings.NewReader(eicar)))
+
+	require.NoError(t, guard.CheckStored(ctx, "uploads", "a.txt"))
+	assert.True(t, uploads.Exists("a.txt"))
+
+	assert.True(t, IsInfected(guard.CheckStored(ctx, "uploads", "b.txt")))
+	assert.False(t, uploads.Exists("b.txt"), "rejected files are deleted")
+	assert.False(t, quarantine.Exists("uploads/b.txt"))
+
+	_, err := guard.Scan(ctx, "other", "a.txt", 1)
+	assert.ErrorContains(t, err, "no disk")
+
+	failing, err := NewGuard(signatureScanner{failing: true}, config.ScanConfig{}, nil, nil)
+	require.NoError(t, err)
+	failing.AddDisk("uploads", uploads)
+	err = failing.CheckStored(ctx, "uploads", "a.txt")
+	assert.EqualError(t, err, "clamd is down")
+	assert.True(t, uploads.Exists("a.txt"), "kept when it couldn't be scanned")
+}
+
+type recordingQueue struct {
+	providers.QueueProvider
+	jobs []providers.Job
+}
+
+func (q *recordingQueue) Push(queue string, job providers.Job) error {
+	q.jobs = append(q.jobs, job)
+	return nil
+}
+
+func TestGuardQueuesLargeFiles(t *testing.T) {
+	guard, uploads, _, _ := newTestGuard(t, Reject)
+	ctx := context.Background()
+	large := strings.Repeat("x", 20) + eicar
+	require.NoError(t, uploads.Put("large.bin", strings.NewReader(large)))
+
+	// Without a queue every file is scanned at once
+	assert.False(t, guard.Async(int64(len(large))))
+	queue := &recordingQueue{}
+	guard.UseQueue(queue, "scans")
+	assert.True(t, guard.Async(int64(len(large))))
+	assert.False(t, guard.Async(5))
+
+	queued, err := guard.Scan(ctx, "uploads", "large.bin", int64(len(large)))
+	require.NoError(t, err)
+	assert.True(t, queued)
+	require.Len(t, queue.jobs, 1)
+	assert.Equal(t, JobType, queue.jobs[0].Type)
+	assert.True(t, uploads.Exists("large.bin"), "until the job runs")
+
+	require.NoError(t, guard.JobHandler()(queue.jobs[0]))
+	assert.False(t, uploads.Exists("large.bin"))
+	// A file removed before its scan ran is skipped
+	require.NoError(t, guard.JobHandler()(queue.jobs[0]))
+	assert.Error(t, guard.JobHandler()(providers.Job{ID: "1", Type: "mail"}))
+}
+
+func TestInfectedProblem(t *testing.T) {
+	p := problem.From(&InfectedError{Field: "avatar", Path: "a.png", Signature: "Eicar-Signature"})
+	assert.Equal(t, http.StatusUnprocessableEntity, p.Status)
+	assert.Equal(t, map[string]string{"avatar": "must not contain malware"}, p.Errors)
+	assert.NotContains(t, p.Detail, "Eicar")
+}
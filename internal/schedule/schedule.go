@@ -0,0 +1,62 @@
+// Package schedule runs a task on an interval in a long-running command,
+// such as `dolphin model:prune --every 24h`. Instances running the same
+// schedule take turns with WithoutOverlapping:
+//
+//	lock := cache.Lock("schedule:reports", time.Hour)
+//	schedule.Every(ctx, 24*time.Hour, generateReports, schedule.WithoutOverlapping(lock))
+package schedule
+
+import (
+	"context"
+	"time"
+
+	"github.com/mrhoseah/dolphin/internal/cache"
+)
+
+// Option changes how Every runs a task
+type Option func(*options)
+
+type options struct {
+	lock *cache.Mutex
+}
+
+// WithoutOverlapping skips a run while lock is held, by a run still going
+// on this instance or by another instance sharing the lock's store. A run
+// is skipped too when the store can't be reached. The lock's ttl should
+// outlast the longest run, since it frees the lock of a crashed instance.
+func WithoutOverlapping(lock *cache.Mutex) Option {
+	return func(o *options) {
+		o.lock = lock
+	}
+}
+
+// Every runs fn at once, then every interval until ctx is cancelled
+func Every(ctx context.Context, interval time.Duration, fn func(context.Context), opts ...Option) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	run := fn
+	if o.lock != nil {
+		run = func(ctx context.Context) {
+			if ok, err := o.lock.TryAcquire(ctx); err != nil || !ok {
+				return
+			}
+			defer o.lock.Release(ctx)
+			fn(ctx)
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	run(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			run(ctx)
+		}
+	}
+}
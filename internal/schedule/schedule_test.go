@@ -0,0 +1,51 @@
+package schedule
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/cache"
+)
+
+func TestEvery(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var runs atomic.Int32
+	done := make(chan struct{})
+	go func() {
+		Every(ctx, 20*time.Millisecond, func(context.Context) { runs.Add(1) })
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool { return runs.Load() >= 3 }, 2*time.Second, 5*time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Every kept running after its context was cancelled")
+	}
+}
+
+func TestWithoutOverlapping(t *testing.T) {
+	locks := cache.NewMemoryCache()
+	other := cache.NewMutex(locks, "schedule:reports", time.Minute)
+	ok, err := other.TryAcquire(context.Background())
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var runs atomic.Int32
+	go Every(ctx, 20*time.Millisecond, func(context.Context) { runs.Add(1) },
+		WithoutOverlapping(cache.NewMutex(locks, "schedule:reports", time.Minute)))
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Zero(t, runs.Load(), "skipped while another instance holds the lock")
+
+	require.NoError(t, other.Release(context.Background()))
+	assert.Eventually(t, func() bool { return runs.Load() >= 2 }, 2*time.Second, 5*time.Millisecond, "each run releases the lock")
+}
@@ -0,0 +1,189 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Elasticsearch keeps indexes on an Elasticsearch cluster, creating them
+// with dynamic mappings on first write
+type Elasticsearch struct {
+	url      string
+	username string
+	password string
+	client   *http.Client
+}
+
+// NewElasticsearch creates an engine for the Elasticsearch cluster at url,
+// with basic auth unless username is empty
+func NewElasticsearch(url, username, password string) *Elasticsearch {
+	return &Elasticsearch{
+		url:      strings.TrimSuffix(url, "/"),
+		username: username,
+		password: password,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Index implements Engine through the bulk API
+func (e *Elasticsearch) Index(ctx context.Context, index string, docs ...Document) error {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, doc := range docs {
+		encoder.Encode(map[string]interface{}{"index": map[string]string{"_index": index, "_id": doc.ID}})
+		if err := encoder.Encode(doc.Fields); err != nil {
+			return err
+		}
+	}
+	return e.bulk(ctx, &body)
+}
+
+// Delete implements Engine through the bulk API
+func (e *Elasticsearch) Delete(ctx context.Context, index string, ids ...string) error {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, id := range ids {
+		encoder.Encode(map[string]interface{}{"delete": map[string]string{"_index": index, "_id": id}})
+	}
+	return e.bulk(ctx, &body)
+}
+
+// Search implements Engine, matching the text against every field and
+// filters against exact values
+func (e *Elasticsearch) Search(ctx context.Context, index string, q Query) (*Results, error) {
+	var must interface{} = map[string]interface{}{"match_all": map[string]interface{}{}}
+	if q.Text != "" {
+		must = map[string]interface{}{"multi_match": map[string]interface{}{
+			"query":    q.Text,
+			"fields":   []string{"*"},
+			"type":     "best_fields",
+			"operator": "and",
+			// Numbers and booleans are skipped rather than failing the query
+			"lenient": true,
+		}}
+	}
+	request := map[string]interface{}{
+		"from":             q.Offset,
+		"size":             q.limit(),
+		"track_total_hits": true,
+		"query": map[string]interface{}{"bool": map[string]interface{}{
+			"must":   must,
+			"filter": elasticsearchFilter(q.Filters),
+		}},
+	}
+
+	var response struct {
+		Hits struct {
+			Total struct {
+				Value int `json:"value"`
+			} `json:"total"`
+			Hits []struct {
+				ID     string                 `json:"_id"`
+				Score  float64                `json:"_score"`
+				Source map[string]interface{} `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	err := e.do(ctx, http.MethodPost, "/"+url.PathEscape(index)+"/_search", "application/json", jsonBody(request), &response)
+	if status, ok := err.(*statusError); ok && status.Code == http.StatusNotFound {
+		// Nothing has been indexed yet
+		return &Results{Hits: []Hit{}}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	results := &Results{Hits: make([]Hit, len(response.Hits.Hits)), Total: response.Hits.Total.Value}
+	for i, hit := range response.Hits.Hits {
+		results.Hits[i] = Hit{ID: hit.ID, Score: hit.Score, Document: hit.Source}
+	}
+	return results, nil
+}
+
+// Configure implements Engine by creating the index. Filters work on any
+// field, so there is nothing to declare.
+func (e *Elasticsearch) Configure(ctx context.Context, index string, settings Settings) error {
+	err := e.do(ctx, http.MethodPut, "/"+url.PathEscape(index), "application/json", nil, nil)
+	if status, ok := err.(*statusError); ok && status.Code == http.StatusBadRequest && strings.Contains(status.Message, "resource_already_exists_exception") {
+		return nil
+	}
+	return err
+}
+
+// Flush implements Engine
+func (e *Elasticsearch) Flush(ctx context.Context, index string) error {
+	err := e.do(ctx, http.MethodDelete, "/"+url.PathEscape(index), "", nil, nil)
+	if status, ok := err.(*statusError); ok && status.Code == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+// bulk sends NDJSON actions, failing with the first item the cluster
+// refused
+func (e *Elasticsearch) bulk(ctx context.Context, body *bytes.Buffer) error {
+	var response struct {
+		Errors bool                                `json:"errors"`
+		Items  []map[string]map[string]interface{} `json:"items"`
+	}
+	if err := e.do(ctx, http.MethodPost, "/_bulk", "application/x-ndjson", body, &response); err != nil {
+		return err
+	}
+	if !response.Errors {
+		return nil
+	}
+	for _, item := range response.Items {
+		for action, result := range item {
+			if reason, ok := result["error"]; ok {
+				return fmt.Errorf("search: elasticsearch %s of %v failed: %v", action, result["_id"], reason)
+			}
+		}
+	}
+	return fmt.Errorf("search: elasticsearch bulk request failed")
+}
+
+func (e *Elasticsearch) do(ctx context.Context, method, path, contentType string, body io.Reader, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, e.url+path, body)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if e.username != "" {
+		req.SetBasicAuth(e.username, e.password)
+	}
+	return send(e.client, req, "elasticsearch", out)
+}
+
+// elasticsearchFilter writes filters as term queries. Strings are matched
+// on the keyword field dynamic mappings add to text fields.
+func elasticsearchFilter(filters map[string]interface{}) []interface{} {
+	names := make([]string, 0, len(filters))
+	for name := range filters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	terms := make([]interface{}, len(names))
+	for i, name := range names {
+		field := name
+		if _, ok := filters[name].(string); ok {
+			field += ".keyword"
+		}
+		terms[i] = map[string]interface{}{"term": map[string]interface{}{field: filters[name]}}
+	}
+	return terms
+}
+
+// jsonBody encodes v as a request body
+func jsonBody(v interface{}) io.Reader {
+	data, _ := json.Marshal(v)
+	return bytes.NewReader(data)
+}
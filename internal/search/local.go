@@ -0,0 +1,389 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// localSaveDelay is how long the local engine gathers writes to an index
+// before saving it
+const localSaveDelay = time.Second
+
+// Local keeps indexes in memory, saved to a JSON file per index, for
+// development, tests and single instances. Every term of a query must
+// match a word of the document, the last one as a prefix so results
+// follow what is typed.
+//
+// Writes are saved together at most a second after the first of them, and
+// when the engine is closed, so importing a table doesn't rewrite the file
+// for every chunk. Queries look terms up in a word index rather than
+// reading every document.
+type Local struct {
+	dir string
+
+	mu      sync.Mutex
+	indexes map[string]*localIndex
+	dirty   map[string]bool
+	saving  *time.Timer
+	err     error
+}
+
+// localIndex is an index's documents, the words found in each and the
+// documents each word is found in
+type localIndex struct {
+	Documents map[string]map[string]interface{} `json:"documents"`
+	words     map[string]map[string]int
+	postings  map[string]map[string]bool
+}
+
+// put adds or replaces a document
+func (idx *localIndex) put(id string, doc map[string]interface{}) {
+	idx.remove(id)
+	idx.Documents[id] = doc
+	idx.words[id] = words(doc)
+	for word := range idx.words[id] {
+		if idx.postings[word] == nil {
+			idx.postings[word] = map[string]bool{}
+		}
+		idx.postings[word][id] = true
+	}
+}
+
+// remove deletes a document
+func (idx *localIndex) remove(id string) {
+	for word := range idx.words[id] {
+		delete(idx.postings[word], id)
+		if len(idx.postings[word]) == 0 {
+			delete(idx.postings, word)
+		}
+	}
+	delete(idx.Documents, id)
+	delete(idx.words, id)
+}
+
+// candidates returns the IDs of the documents with a word for every term,
+// the last one as a prefix
+func (idx *localIndex) candidates(terms []string) map[string]bool {
+	var found map[string]bool
+	for i, term := range terms {
+		matches := map[string]bool{}
+		for id := range idx.postings[term] {
+			matches[id] = true
+		}
+		if i == len(terms)-1 {
+			for word, ids := range idx.postings {
+				if word == term || !strings.HasPrefix(word, term) {
+					continue
+				}
+				for id := range ids {
+					matches[id] = true
+				}
+			}
+		}
+		if found != nil {
+			for id := range found {
+				if !matches[id] {
+					delete(found, id)
+				}
+			}
+		} else {
+			found = matches
+		}
+		if len(found) == 0 {
+			break
+		}
+	}
+	return found
+}
+
+// NewLocal creates an engine keeping indexes in dir, or only in memory
+// when dir is empty
+func NewLocal(dir string) (*Local, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("search: creating the index directory: %w", err)
+		}
+	}
+	return &Local{dir: dir, indexes: map[string]*localIndex{}, dirty: map[string]bool{}}, nil
+}
+
+// Index implements Engine
+func (l *Local) Index(ctx context.Context, index string, docs ...Document) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	idx, err := l.load(index)
+	if err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		// Round trip through JSON, so documents look the same before and
+		// after a restart
+		data, err := json.Marshal(doc.Fields)
+		if err != nil {
+			return err
+		}
+		var fields map[string]interface{}
+		json.Unmarshal(data, &fields)
+		idx.put(doc.ID, fields)
+	}
+	return l.changed(index)
+}
+
+// Delete implements Engine
+func (l *Local) Delete(ctx context.Context, index string, ids ...string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	idx, err := l.load(index)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		idx.remove(id)
+	}
+	return l.changed(index)
+}
+
+// Search implements Engine. Documents score a point per term matching a
+// whole word and half a point per prefix match, each time it occurs.
+func (l *Local) Search(ctx context.Context, index string, q Query) (*Results, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	idx, err := l.load(index)
+	if err != nil {
+		return nil, err
+	}
+
+	terms := tokenize(q.Text)
+	ids := idx.Documents
+	if len(terms) > 0 {
+		ids = make(map[string]map[string]interface{})
+		for id := range idx.candidates(terms) {
+			ids[id] = idx.Documents[id]
+		}
+	}
+	var hits []Hit
+	for id, doc := range ids {
+		if !matchesFilters(doc, q.Filters) {
+			continue
+		}
+		score, ok := scoreTerms(idx.words[id], terms)
+		if !ok {
+			continue
+		}
+		hits = append(hits, Hit{ID: id, Score: score, Document: doc})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+
+	results := &Results{Hits: []Hit{}, Total: len(hits)}
+	if q.Offset < len(hits) {
+		hits = hits[q.Offset:]
+		if len(hits) > q.limit() {
+			hits = hits[:q.limit()]
+		}
+		results.Hits = hits
+	}
+	return results, nil
+}
+
+// Configure implements Engine. Filters work on any field, so there is
+// nothing to declare.
+func (l *Local) Configure(ctx context.Context, index string, settings Settings) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err := l.load(index)
+	return err
+}
+
+// Flush implements Engine
+func (l *Local) Flush(ctx context.Context, index string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.indexes, index)
+	delete(l.dirty, index)
+	if l.dir == "" {
+		return nil
+	}
+	if err := os.Remove(l.path(index)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// load returns an index, reading it from its file the first time
+func (l *Local) load(index string) (*localIndex, error) {
+	if idx, ok := l.indexes[index]; ok {
+		return idx, nil
+	}
+	idx := &localIndex{Documents: map[string]map[string]interface{}{}}
+	if l.dir != "" {
+		data, err := os.ReadFile(l.path(index))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if err == nil {
+			if err := json.Unmarshal(data, idx); err != nil {
+				return nil, fmt.Errorf("search: reading index %s: %w", index, err)
+			}
+		}
+	}
+	documents := idx.Documents
+	idx.Documents = make(map[string]map[string]interface{}, len(documents))
+	idx.words = make(map[string]map[string]int, len(documents))
+	idx.postings = map[string]map[string]bool{}
+	for id, doc := range documents {
+		idx.put(id, doc)
+	}
+	l.indexes[index] = idx
+	return idx, nil
+}
+
+// changed has an index saved with the other writes of the next second. It
+// returns the error of the last save, if it failed, once; the index is
+// saved again with the next writes.
+func (l *Local) changed(index string) error {
+	if l.dir == "" {
+		return nil
+	}
+	l.dirty[index] = true
+	if l.saving == nil {
+		l.saving = time.AfterFunc(localSaveDelay, func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			l.saving = nil
+			l.err = l.saveDirty()
+		})
+	}
+	err := l.err
+	l.err = nil
+	return err
+}
+
+// saveDirty saves the indexes written since they were last saved
+func (l *Local) saveDirty() error {
+	var errs []error
+	for index := range l.dirty {
+		if err := l.save(index, l.indexes[index]); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		delete(l.dirty, index)
+	}
+	return errors.Join(errs...)
+}
+
+// Close saves the writes not saved yet. The engine can still be used.
+func (l *Local) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.saving != nil {
+		l.saving.Stop()
+		l.saving = nil
+	}
+	l.err = nil
+	return l.saveDirty()
+}
+
+// save writes an index to its file, replacing the previous in one step
+func (l *Local) save(index string, idx *localIndex) error {
+	if l.dir == "" {
+		return nil
+	}
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	tmp := l.path(index) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.path(index))
+}
+
+func (l *Local) path(index string) string {
+	return filepath.Join(l.dir, url.PathEscape(index)+".json")
+}
+
+// words counts the words in a document's values
+func words(doc map[string]interface{}) map[string]int {
+	counts := map[string]int{}
+	var add func(value interface{})
+	add = func(value interface{}) {
+		switch v := value.(type) {
+		case nil:
+		case []interface{}:
+			for _, item := range v {
+				add(item)
+			}
+		case map[string]interface{}:
+			for _, item := range v {
+				add(item)
+			}
+		default:
+			for _, word := range tokenize(fmt.Sprint(v)) {
+				counts[word]++
+			}
+		}
+	}
+	for _, value := range doc {
+		add(value)
+	}
+	return counts
+}
+
+// tokenize splits text into lower case words
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// scoreTerms scores a document's words against a query's terms, reporting
+// false unless every term matches. Only the last term matches prefixes.
+func scoreTerms(counts map[string]int, terms []string) (float64, bool) {
+	score := 0.0
+	for i, term := range terms {
+		matched := 0.0
+		if count, ok := counts[term]; ok {
+			matched += float64(count)
+		}
+		if i == len(terms)-1 {
+			for word, count := range counts {
+				if word != term && strings.HasPrefix(word, term) {
+					matched += float64(count) / 2
+				}
+			}
+		}
+		if matched == 0 {
+			return 0, false
+		}
+		score += matched
+	}
+	return score, true
+}
+
+// matchesFilters reports whether a document's fields equal the filters'
+// values
+func matchesFilters(doc map[string]interface{}, filters map[string]interface{}) bool {
+	for name, want := range filters {
+		got, ok := doc[name]
+		if !ok || fmt.Sprint(got) != fmt.Sprint(want) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,404 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/correlation"
+	"github.com/mrhoseah/dolphin/internal/providers"
+)
+
+const pluginName = "dolphin:search"
+
+// JobType is the type of the jobs syncing models to an index
+const JobType = "search.sync"
+
+// Manager keeps searchable models in sync with their indexes and searches
+// them. Installed on a database with db.Use, it indexes models after they
+// are created or updated and removes them after they are deleted.
+type Manager struct {
+	engine    Engine
+	prefix    string
+	chunkSize int
+	logger    *zap.Logger
+
+	queue     providers.QueueProvider
+	queueName string
+}
+
+// New creates a manager for the engine of the search config's driver
+func New(cfg config.SearchConfig, logger *zap.Logger) (*Manager, error) {
+	engine, err := NewEngine(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return NewManager(engine, cfg, logger), nil
+}
+
+// NewManager creates a manager keeping indexes on engine
+func NewManager(engine Engine, cfg config.SearchConfig, logger *zap.Logger) *Manager {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	chunkSize := cfg.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = 500
+	}
+	return &Manager{engine: engine, prefix: cfg.Prefix, chunkSize: chunkSize, logger: logger}
+}
+
+// From returns the manager installed on db, if any
+func From(db *gorm.DB) (*Manager, bool) {
+	m, ok := db.Config.Plugins[pluginName].(*Manager)
+	return m, ok
+}
+
+// Close saves the writes the engine holds back, as the local engine does
+// to write its files in batches. Call it once the app stops writing.
+func (m *Manager) Close() error {
+	if closer, ok := m.engine.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Engine returns the engine indexes are kept on
+func (m *Manager) Engine() Engine {
+	return m.engine
+}
+
+// UseQueue syncs models through jobs pushed to the named queue, so writes
+// don't wait for the search server. The queue's workers must process them
+// with JobHandler. Without a queue, models are synced as they are written.
+func (m *Manager) UseQueue(queue providers.QueueProvider, name string) {
+	m.queue = queue
+	m.queueName = name
+}
+
+// IndexName returns the name of a model's index, prefixed
+func (m *Manager) IndexName(model Searchable) string {
+	return m.prefix + model.SearchIndex()
+}
+
+// Name implements gorm.Plugin
+func (m *Manager) Name() string {
+	return pluginName
+}
+
+// Initialize implements gorm.Plugin by syncing searchable models after
+// each write commits
+func (m *Manager) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Create().After("gorm:commit_or_rollback_transaction").Register(pluginName+"_create", m.saved); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:commit_or_rollback_transaction").Register(pluginName+"_update", m.saved); err != nil {
+		return err
+	}
+	return cb.Delete().After("gorm:commit_or_rollback_transaction").Register(pluginName+"_delete", m.deleted)
+}
+
+// Search returns the documents of a model's index matching a query
+func (m *Manager) Search(ctx context.Context, model Searchable, q Query) (*Results, error) {
+	return m.engine.Search(ctx, m.IndexName(model), q)
+}
+
+// Find searches the index of the models dest holds, a pointer to a slice
+// of searchable models, and loads the models hit from db, best first. Hits
+// whose rows are gone are left out.
+func (m *Manager) Find(ctx context.Context, db *gorm.DB, dest interface{}, q Query) (*Results, error) {
+	slice := reflect.ValueOf(dest)
+	if slice.Kind() != reflect.Ptr || slice.Elem().Kind() != reflect.Slice {
+		return nil, fmt.Errorf("search: Find needs a pointer to a slice, not %T", dest)
+	}
+	elem := slice.Elem().Type().Elem()
+	for elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	model, ok := reflect.New(elem).Interface().(Searchable)
+	if !ok {
+		return nil, fmt.Errorf("search: %s is not searchable", elem)
+	}
+
+	results, err := m.Search(ctx, model, q)
+	if err != nil {
+		return nil, err
+	}
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return nil, err
+	}
+	primary := stmt.Schema.PrioritizedPrimaryField
+	if primary == nil {
+		return nil, fmt.Errorf("search: %s has no primary key", elem)
+	}
+
+	ids := results.IDs()
+	if len(ids) == 0 {
+		slice.Elem().Set(reflect.MakeSlice(slice.Elem().Type(), 0, 0))
+		return results, nil
+	}
+	if err := db.WithContext(ctx).Where(fmt.Sprintf("%s IN ?", stmt.Quote(primary.DBName)), ids).Find(dest).Error; err != nil {
+		return nil, err
+	}
+
+	rank := make(map[string]int, len(ids))
+	for i, id := range ids {
+		rank[id] = i
+	}
+	rows := slice.Elem()
+	keys := make([]int, rows.Len())
+	for i := range keys {
+		value, _ := primary.ValueOf(ctx, reflect.Indirect(rows.Index(i)))
+		keys[i] = rank[fmt.Sprint(value)]
+	}
+	sort.Sort(byRank{rows: rows, keys: keys, swap: reflect.Swapper(rows.Interface())})
+	return results, nil
+}
+
+// byRank sorts loaded rows into the order they were hit
+type byRank struct {
+	rows reflect.Value
+	keys []int
+	swap func(i, j int)
+}
+
+func (b byRank) Len() int           { return len(b.keys) }
+func (b byRank) Less(i, j int) bool { return b.keys[i] < b.keys[j] }
+func (b byRank) Swap(i, j int) {
+	b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
+	b.swap(i, j)
+}
+
+// Sync indexes models, or removes those that shouldn't be searchable
+func (m *Manager) Sync(ctx context.Context, db *gorm.DB, searchables ...Searchable) error {
+	for _, model := range searchables {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return err
+		}
+		if err := m.apply(ctx, m.batch(ctx, stmt.Schema, reflect.ValueOf(model), false)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Import indexes every row of a model's table, chunk by chunk, calling
+// progress with the rows indexed so far. Soft-deleted rows and models that
+// shouldn't be searchable are left out.
+func (m *Manager) Import(ctx context.Context, db *gorm.DB, model Searchable, progress func(indexed int)) (int, error) {
+	index := m.IndexName(model)
+	settings := Settings{}
+	if filterable, ok := model.(Filterable); ok {
+		settings.Filterable = filterable.SearchFilterable()
+	}
+	if err := m.engine.Configure(ctx, index, settings); err != nil {
+		return 0, err
+	}
+
+	typ := reflect.Indirect(reflect.ValueOf(model)).Type()
+	rows := reflect.New(reflect.SliceOf(typ))
+	indexed := 0
+	err := db.WithContext(ctx).Model(model).FindInBatches(rows.Interface(), m.chunkSize, func(tx *gorm.DB, _ int) error {
+		var docs []Document
+		eachSearchable(rows.Elem(), func(value reflect.Value, s Searchable) {
+			if doc, ok := m.document(ctx, tx.Statement.Schema, value, s); ok {
+				docs = append(docs, doc)
+			}
+		})
+		if len(docs) == 0 {
+			return nil
+		}
+		if err := m.engine.Index(ctx, index, docs...); err != nil {
+			return err
+		}
+		indexed += len(docs)
+		if progress != nil {
+			progress(indexed)
+		}
+		return nil
+	}).Error
+	return indexed, err
+}
+
+// Flush removes a model's index
+func (m *Manager) Flush(ctx context.Context, model Searchable) error {
+	return m.engine.Flush(ctx, m.IndexName(model))
+}
+
+// JobHandler syncs the models of the jobs pushed to the manager's queue
+func (m *Manager) JobHandler() providers.JobHandler {
+	return func(job providers.Job) error {
+		encoded, _ := job.Payload["changes"].(string)
+		var changes []change
+		if job.Type != JobType || json.Unmarshal([]byte(encoded), &changes) != nil {
+			return fmt.Errorf("search: not a sync job: %s", job.ID)
+		}
+		return correlation.Run(context.Background(), job.Correlation, "job "+job.Type, func(ctx context.Context) error {
+			return m.apply(ctx, changes)
+		})
+	}
+}
+
+// change indexes documents in an index or removes them from it
+type change struct {
+	Index     string     `json:"index"`
+	Documents []Document `json:"documents,omitempty"`
+	Deleted   []string   `json:"deleted,omitempty"`
+}
+
+// saved syncs the models written by a create or update
+func (m *Manager) saved(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return
+	}
+	m.dispatch(db, m.batch(db.Statement.Context, db.Statement.Schema, db.Statement.ReflectValue, false))
+}
+
+// deleted removes the models of a delete from their indexes
+func (m *Manager) deleted(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return
+	}
+	m.dispatch(db, m.batch(db.Statement.Context, db.Statement.Schema, db.Statement.ReflectValue, true))
+}
+
+// batch groups the changes to the searchable models in value by index.
+// Models without a primary key, as in updates by condition, are skipped.
+func (m *Manager) batch(ctx context.Context, s *schema.Schema, value reflect.Value, deleted bool) []change {
+	byIndex := map[string]*change{}
+	var order []string
+	eachSearchable(value, func(value reflect.Value, model Searchable) {
+		id, ok := primaryKey(ctx, s, value)
+		if !ok {
+			return
+		}
+		index := m.IndexName(model)
+		c, seen := byIndex[index]
+		if !seen {
+			c = &change{Index: index}
+			byIndex[index] = c
+			order = append(order, index)
+		}
+		if !deleted {
+			if doc, ok := m.document(ctx, s, value, model); ok {
+				c.Documents = append(c.Documents, doc)
+				return
+			}
+		}
+		c.Deleted = append(c.Deleted, id)
+	})
+
+	changes := make([]change, len(order))
+	for i, index := range order {
+		changes[i] = *byIndex[index]
+	}
+	return changes
+}
+
+// document returns a model as indexed, unless it shouldn't be searchable
+func (m *Manager) document(ctx context.Context, s *schema.Schema, value reflect.Value, model Searchable) (Document, bool) {
+	id, ok := primaryKey(ctx, s, value)
+	if !ok {
+		return Document{}, false
+	}
+	if conditional, ok := model.(Conditional); ok && !conditional.ShouldBeSearchable() {
+		return Document{}, false
+	}
+	if deletedAt, ok := s.FieldsByName["DeletedAt"]; ok {
+		if _, zero := deletedAt.ValueOf(ctx, value); !zero {
+			return Document{}, false
+		}
+	}
+	return Document{ID: id, Fields: model.SearchDocument()}, true
+}
+
+// dispatch applies changes now, or queues them when the manager has a
+// queue. The write has committed, so failures are logged rather than
+// returned; search:import brings an index back in line.
+func (m *Manager) dispatch(db *gorm.DB, changes []change) {
+	if len(changes) == 0 {
+		return
+	}
+	if m.queue != nil {
+		encoded, err := json.Marshal(changes)
+		if err == nil {
+			err = m.queue.Push(m.queueName, providers.Job{
+				ID:          changes[0].Index,
+				Type:        JobType,
+				Payload:     map[string]interface{}{"changes": string(encoded)},
+				Correlation: correlation.Capture(db.Statement.Context),
+			})
+		}
+		if err == nil {
+			return
+		}
+		m.logger.Warn("Failed to queue search sync; syncing now", zap.Error(err))
+	}
+	if err := m.apply(db.Statement.Context, changes); err != nil {
+		m.logger.Error("Failed to sync search index", zap.Error(err))
+	}
+}
+
+// apply sends changes to the engine
+func (m *Manager) apply(ctx context.Context, changes []change) error {
+	for _, c := range changes {
+		if len(c.Documents) > 0 {
+			if err := m.engine.Index(ctx, c.Index, c.Documents...); err != nil {
+				return fmt.Errorf("search: indexing %s: %w", c.Index, err)
+			}
+		}
+		if len(c.Deleted) > 0 {
+			if err := m.engine.Delete(ctx, c.Index, c.Deleted...); err != nil {
+				return fmt.Errorf("search: removing from %s: %w", c.Index, err)
+			}
+		}
+	}
+	return nil
+}
+
+// primaryKey returns a model's primary key as a document ID
+func primaryKey(ctx context.Context, s *schema.Schema, value reflect.Value) (string, bool) {
+	field := s.PrioritizedPrimaryField
+	if field == nil {
+		return "", false
+	}
+	key, zero := field.ValueOf(ctx, value)
+	if zero {
+		return "", false
+	}
+	return fmt.Sprint(key), true
+}
+
+// eachSearchable calls fn with each searchable model held by value, a
+// model or a slice of them
+func eachSearchable(value reflect.Value, fn func(reflect.Value, Searchable)) {
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !value.IsNil() {
+			eachSearchable(value.Elem(), fn)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			eachSearchable(value.Index(i), fn)
+		}
+	case reflect.Struct:
+		model := value.Interface()
+		if value.CanAddr() {
+			model = value.Addr().Interface()
+		}
+		if searchable, ok := model.(Searchable); ok {
+			fn(value, searchable)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Meilisearch keeps indexes on a Meilisearch server. Writes are queued by
+// the server and show up in searches shortly after.
+type Meilisearch struct {
+	host   string
+	key    string
+	client *http.Client
+}
+
+// NewMeilisearch creates an engine for the Meilisearch server at host,
+// authenticating with key unless empty
+func NewMeilisearch(host, key string) *Meilisearch {
+	return &Meilisearch{
+		host:   strings.TrimSuffix(host, "/"),
+		key:    key,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Index implements Engine
+func (m *Meilisearch) Index(ctx context.Context, index string, docs ...Document) error {
+	body := make([]map[string]interface{}, len(docs))
+	for i, doc := range docs {
+		fields := make(map[string]interface{}, len(doc.Fields)+1)
+		for name, value := range doc.Fields {
+			fields[name] = value
+		}
+		fields["id"] = doc.ID
+		body[i] = fields
+	}
+	return m.do(ctx, http.MethodPost, "/indexes/"+url.PathEscape(index)+"/documents?primaryKey=id", body, nil)
+}
+
+// Delete implements Engine
+func (m *Meilisearch) Delete(ctx context.Context, index string, ids ...string) error {
+	return m.do(ctx, http.MethodPost, "/indexes/"+url.PathEscape(index)+"/documents/delete-batch", ids, nil)
+}
+
+// Search implements Engine
+func (m *Meilisearch) Search(ctx context.Context, index string, q Query) (*Results, error) {
+	request := map[string]interface{}{
+		"q":                q.Text,
+		"limit":            q.limit(),
+		"offset":           q.Offset,
+		"showRankingScore": true,
+	}
+	if filter := meilisearchFilter(q.Filters); filter != "" {
+		request["filter"] = filter
+	}
+	var response struct {
+		Hits               []map[string]interface{} `json:"hits"`
+		EstimatedTotalHits int                      `json:"estimatedTotalHits"`
+	}
+	if err := m.do(ctx, http.MethodPost, "/indexes/"+url.PathEscape(index)+"/search", request, &response); err != nil {
+		return nil, err
+	}
+
+	results := &Results{Hits: make([]Hit, len(response.Hits)), Total: response.EstimatedTotalHits}
+	for i, doc := range response.Hits {
+		score, _ := doc["_rankingScore"].(float64)
+		delete(doc, "_rankingScore")
+		results.Hits[i] = Hit{ID: fmt.Sprint(doc["id"]), Score: score, Document: doc}
+	}
+	return results, nil
+}
+
+// Configure implements Engine by declaring the filterable fields
+func (m *Meilisearch) Configure(ctx context.Context, index string, settings Settings) error {
+	filterable := settings.Filterable
+	if filterable == nil {
+		filterable = []string{}
+	}
+	return m.do(ctx, http.MethodPatch, "/indexes/"+url.PathEscape(index)+"/settings", map[string]interface{}{
+		"filterableAttributes": filterable,
+	}, nil)
+}
+
+// Flush implements Engine
+func (m *Meilisearch) Flush(ctx context.Context, index string) error {
+	err := m.do(ctx, http.MethodDelete, "/indexes/"+url.PathEscape(index), nil, nil)
+	if status, ok := err.(*statusError); ok && status.Code == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+func (m *Meilisearch) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, m.host+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if m.key != "" {
+		req.Header.Set("Authorization", "Bearer "+m.key)
+	}
+	return send(m.client, req, "meilisearch", out)
+}
+
+// meilisearchFilter writes filters as a Meilisearch filter expression,
+// sorted so the same filters always give the same expression
+func meilisearchFilter(filters map[string]interface{}) string {
+	names := make([]string, 0, len(filters))
+	for name := range filters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	conditions := make([]string, len(names))
+	for i, name := range names {
+		var value string
+		switch v := filters[name].(type) {
+		case string:
+			value = strconv.Quote(v)
+		case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+			value = fmt.Sprint(v)
+		default:
+			value = strconv.Quote(fmt.Sprint(v))
+		}
+		conditions[i] = name + " = " + value
+	}
+	return strings.Join(conditions, " AND ")
+}
+
+// statusError is a search server answering with an error status
+type statusError struct {
+	Server  string
+	Code    int
+	Message string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("search: %s returned status %d: %s", e.Server, e.Code, e.Message)
+}
+
+// send sends a request to a search server and decodes its JSON answer
+// into out
+func send(client *http.Client, req *http.Request, server string, out interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("search: %s: %w", server, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &statusError{Server: server, Code: resp.StatusCode, Message: strings.TrimSpace(string(message))}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("search: reading the %s response: %w", server, err)
+	}
+	return nil
+}
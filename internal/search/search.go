@@ -0,0 +1,190 @@
+// Package search keeps models in a full-text search index. Installed on a
+// database, it indexes searchable models as they are created and updated
+// and removes them when deleted:
+//
+//	func (p Post) SearchIndex() string { return "posts" }
+//	func (p Post) SearchDocument() map[string]interface{} {
+//		return map[string]interface{}{"title": p.Title, "body": p.Body, "published": p.Published}
+//	}
+//
+//	var posts []Post
+//	results, err := manager.Find(ctx, db, &posts, search.Query{Text: "dolphins", Filters: map[string]interface{}{"published": true}})
+//
+// Indexes are kept on Meilisearch, Elasticsearch or, for development and
+// single instances, in local files. Rows written before a model was
+// searchable are indexed with `dolphin search:import <Model>`.
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/orm"
+)
+
+// Searchable is implemented by models kept in a search index. Documents
+// are identified by the model's primary key.
+type Searchable interface {
+	orm.Model
+
+	// SearchIndex names the index the model is kept in
+	SearchIndex() string
+
+	// SearchDocument returns the fields indexed for the model
+	SearchDocument() map[string]interface{}
+}
+
+// Conditional is implemented by searchable models that are only indexed
+// in some states, such as posts once published. Models that stop being
+// searchable are removed from the index when saved.
+type Conditional interface {
+	ShouldBeSearchable() bool
+}
+
+// Filterable is implemented by searchable models whose fields are used in
+// query filters. Meilisearch only filters on fields declared in advance;
+// search:import declares them.
+type Filterable interface {
+	SearchFilterable() []string
+}
+
+// Document is a model as indexed
+type Document struct {
+	ID     string                 `json:"id"`
+	Fields map[string]interface{} `json:"fields"`
+}
+
+// Query is a full-text search of an index
+type Query struct {
+	// Text is what to search for; empty matches every document
+	Text string
+
+	// Filters match documents whose field equals the value
+	Filters map[string]interface{}
+
+	// Limit caps the hits returned, 20 when 0, after skipping Offset
+	Limit  int
+	Offset int
+}
+
+// limit returns the query's limit, defaulted
+func (q Query) limit() int {
+	if q.Limit <= 0 {
+		return 20
+	}
+	return q.Limit
+}
+
+// Hit is a document matching a query
+type Hit struct {
+	ID       string                 `json:"id"`
+	Score    float64                `json:"score"`
+	Document map[string]interface{} `json:"document"`
+}
+
+// Results are the hits of a query, best first, and how many documents
+// matched in all
+type Results struct {
+	Hits  []Hit `json:"hits"`
+	Total int   `json:"total"`
+}
+
+// IDs returns the hits' IDs, best first
+func (r *Results) IDs() []string {
+	ids := make([]string, len(r.Hits))
+	for i, hit := range r.Hits {
+		ids[i] = hit.ID
+	}
+	return ids
+}
+
+// Settings configure an index
+type Settings struct {
+	// Filterable are the fields used in query filters
+	Filterable []string
+}
+
+// Engine keeps search indexes
+type Engine interface {
+	// Index adds documents to an index, replacing those with the same IDs
+	Index(ctx context.Context, index string, docs ...Document) error
+
+	// Delete removes documents from an index
+	Delete(ctx context.Context, index string, ids ...string) error
+
+	// Search returns the documents of an index matching a query
+	Search(ctx context.Context, index string, q Query) (*Results, error)
+
+	// Configure applies settings to an index, creating it if needed
+	Configure(ctx context.Context, index string, settings Settings) error
+
+	// Flush removes an index and its documents
+	Flush(ctx context.Context, index string) error
+}
+
+// NewEngine creates the engine of the search config's driver
+func NewEngine(cfg config.SearchConfig) (Engine, error) {
+	switch cfg.Driver {
+	case "meilisearch":
+		if cfg.Meilisearch.Host == "" {
+			return nil, errors.New("search: meilisearch.host is required")
+		}
+		return NewMeilisearch(cfg.Meilisearch.Host, cfg.Meilisearch.Key), nil
+	case "elasticsearch":
+		if cfg.Elasticsearch.URL == "" {
+			return nil, errors.New("search: elasticsearch.url is required")
+		}
+		return NewElasticsearch(cfg.Elasticsearch.URL, cfg.Elasticsearch.Username, cfg.Elasticsearch.Password), nil
+	case "local", "":
+		return NewLocal(cfg.Local.Dir)
+	default:
+		return nil, fmt.Errorf("search: unknown driver %q", cfg.Driver)
+	}
+}
+
+var (
+	modelsMu sync.RWMutex
+	models   = map[string]Searchable{}
+)
+
+// Register registers searchable models for search:import, keyed by index
+func Register(searchables ...Searchable) {
+	modelsMu.Lock()
+	defer modelsMu.Unlock()
+	for _, m := range searchables {
+		models[m.SearchIndex()] = m
+	}
+}
+
+// Registered returns the registered searchable models sorted by index
+func Registered() []Searchable {
+	modelsMu.RLock()
+	defer modelsMu.RUnlock()
+
+	result := make([]Searchable, 0, len(models))
+	for _, m := range models {
+		result = append(result, m)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].SearchIndex() < result[j].SearchIndex()
+	})
+	return result
+}
+
+// Lookup returns the registered model named by its type, index or table,
+// in any case
+func Lookup(name string) (Searchable, bool) {
+	for _, m := range Registered() {
+		typ := reflect.Indirect(reflect.ValueOf(m)).Type().Name()
+		if strings.EqualFold(name, typ) || strings.EqualFold(name, m.SearchIndex()) || strings.EqualFold(name, m.TableName()) {
+			return m, true
+		}
+	}
+	return nil, false
+}
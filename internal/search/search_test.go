@@ -0,0 +1,258 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/database"
+	"github.com/mrhoseah/dolphin/internal/orm"
+	"github.com/mrhoseah/dolphin/internal/providers"
+)
+
+type post struct {
+	orm.BaseModel
+	Title     string
+	Body      string
+	Published bool
+}
+
+func (post) TableName() string   { return "posts" }
+func (post) SearchIndex() string { return "posts" }
+
+func (p post) SearchDocument() map[string]interface{} {
+	return map[string]interface{}{"title": p.Title, "body": p.Body, "published": p.Published}
+}
+
+func (p post) ShouldBeSearchable() bool { return p.Title != "" }
+
+func (post) SearchFilterable() []string { return []string{"published"} }
+
+type recordingQueue struct {
+	providers.QueueProvider
+	jobs []providers.Job
+}
+
+func (q *recordingQueue) Push(queue string, job providers.Job) error {
+	q.jobs = append(q.jobs, job)
+	return nil
+}
+
+func newTestSearch(t *testing.T) (*Manager, *Local, *gorm.DB) {
+	db, err := database.New(&config.DatabaseConfig{Driver: "sqlite", Database: filepath.Join(t.TempDir(), "app.db")})
+	require.NoError(t, err)
+	gdb := db.GetDB()
+	require.NoError(t, gdb.AutoMigrate(&post{}))
+
+	engine, err := NewLocal(filepath.Join(t.TempDir(), "search"))
+	require.NoError(t, err)
+	t.Cleanup(func() { engine.Close() })
+	manager := NewManager(engine, config.SearchConfig{Prefix: "test_", ChunkSize: 2}, nil)
+	require.NoError(t, gdb.Use(manager))
+	return manager, engine, gdb
+}
+
+func TestManagerSyncsModels(t *testing.T) {
+	manager, engine, db := newTestSearch(t)
+	ctx := context.Background()
+
+	posts := []post{
+		{Title: "Dolphins sleep with one eye open", Body: "Half their brain rests", Published: true},
+		{Title: "Whales and dolphins", Body: "Dolphins are toothed whales, dolphins everywhere", Published: true},
+		{Title: "Draft about dolphins", Body: "Not ready"},
+		{Body: "Untitled dolphins aren't searchable"},
+	}
+	require.NoError(t, db.Create(&posts).Error)
+
+	results, err := manager.Search(ctx, post{}, Query{Text: "dolphins"})
+	require.NoError(t, err)
+	assert.Equal(t, 3, results.Total)
+	assert.Equal(t, "2", results.Hits[0].ID, "the post mentioning dolphins most")
+
+	var found []post
+	results, err = manager.Find(ctx, db, &found, Query{Text: "dolph", Filters: map[string]interface{}{"published": true}})
+	require.NoError(t, err)
+	require.Len(t, found, 2)
+	assert.Equal(t, []uint{2, 1}, []uint{found[0].ID, found[1].ID}, "in the order hit")
+
+	// Updates reindex, and untitling removes
+	posts[2].Published = true
+	require.NoError(t, db.Save(&posts[2]).Error)
+	posts[0].Title = ""
+	require.NoError(t, db.Save(&posts[0]).Error)
+	results, err = manager.Search(ctx, post{}, Query{Filters: map[string]interface{}{"published": true}})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"2", "3"}, results.IDs())
+
+	// Soft deletes remove too
+	require.NoError(t, db.Delete(&posts[1]).Error)
+	results, err = engine.Search(ctx, "test_posts", Query{Text: "whales"})
+	require.NoError(t, err)
+	assert.Empty(t, results.Hits)
+
+	// The index survives a restart, saved with the writes of the last
+	// second or on closing
+	require.NoError(t, manager.Close())
+	reopened, err := NewLocal(engine.dir)
+	require.NoError(t, err)
+	results, err = reopened.Search(ctx, "test_posts", Query{Text: "draft", Filters: map[string]interface{}{"published": true}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"3"}, results.IDs())
+}
+
+func TestManagerImportAndQueue(t *testing.T) {
+	manager, engine, db := newTestSearch(t)
+	ctx := context.Background()
+	queue := &recordingQueue{}
+	manager.UseQueue(queue, "search")
+
+	require.NoError(t, db.Create(&[]post{{Title: "one"}, {Title: "two"}, {Title: "three"}, {Body: "hidden"}}).Error)
+	require.Len(t, queue.jobs, 1, "the created posts are synced in one job")
+	results, err := manager.Search(ctx, post{}, Query{})
+	require.NoError(t, err)
+	assert.Empty(t, results.Hits, "not synced until the job runs")
+
+	require.NoError(t, manager.JobHandler()(queue.jobs[0]))
+	results, err = manager.Search(ctx, post{}, Query{})
+	require.NoError(t, err)
+	assert.Equal(t, 3, results.Total)
+	assert.Error(t, manager.JobHandler()(providers.Job{ID: "1", Type: "mail"}))
+
+	require.NoError(t, manager.Flush(ctx, post{}))
+	var chunks []int
+	indexed, err := manager.Import(ctx, db, post{}, func(n int) { chunks = append(chunks, n) })
+	require.NoError(t, err)
+	assert.Equal(t, 3, indexed)
+	assert.Equal(t, []int{2, 3}, chunks, "two rows at a time")
+	results, err = engine.Search(ctx, "test_posts", Query{Text: "thr"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"3"}, results.IDs())
+
+	Register(post{})
+	model, ok := Lookup("Post")
+	require.True(t, ok)
+	assert.Equal(t, "posts", model.SearchIndex())
+}
+
+func TestLocalBatchesWrites(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "search")
+	engine, err := NewLocal(dir)
+	require.NoError(t, err)
+	t.Cleanup(func() { engine.Close() })
+	ctx := context.Background()
+
+	for i, title := range []string{"Dolphins at dawn", "Dolphin pods", "Whale songs"} {
+		doc := Document{ID: fmt.Sprint(i + 1), Fields: map[string]interface{}{"title": title}}
+		require.NoError(t, engine.Index(ctx, "posts", doc))
+	}
+	assert.NoFileExists(t, engine.path("posts"), "not saved for every write")
+	results, err := engine.Search(ctx, "posts", Query{Text: "dolphin po"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2"}, results.IDs(), "every term, the last as a prefix")
+
+	require.NoError(t, engine.Delete(ctx, "posts", "1"))
+	require.NoError(t, engine.Close())
+	reopened, err := NewLocal(dir)
+	require.NoError(t, err)
+	results, err = reopened.Search(ctx, "posts", Query{Text: "dolph"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2"}, results.IDs())
+
+	// Writes left unsaved are saved after a moment
+	require.NoError(t, engine.Index(ctx, "pages", Document{ID: "1", Fields: map[string]interface{}{"title": "About"}}))
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(engine.path("pages"))
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestMeilisearch(t *testing.T) {
+	var requests []string
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r.Method+" "+r.URL.RequestURI())
+		bodies = append(bodies, string(body))
+		if strings.HasSuffix(r.URL.Path, "/search") {
+			w.Write([]byte(`{"hits":[{"id":"7","title":"Dolphins","_rankingScore":0.9}],"estimatedTotalHits":1}`))
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"taskUid":1}`))
+	}))
+	defer server.Close()
+
+	engine := NewMeilisearch(server.URL, "secret")
+	ctx := context.Background()
+	require.NoError(t, engine.Configure(ctx, "posts", Settings{Filterable: []string{"published"}}))
+	require.NoError(t, engine.Index(ctx, "posts", Document{ID: "7", Fields: map[string]interface{}{"title": "Dolphins"}}))
+	require.NoError(t, engine.Delete(ctx, "posts", "8"))
+	results, err := engine.Search(ctx, "posts", Query{Text: "dolph", Filters: map[string]interface{}{"published": true, "author": `Jo "Jo"`}})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"PATCH /indexes/posts/settings",
+		"POST /indexes/posts/documents?primaryKey=id",
+		"POST /indexes/posts/documents/delete-batch",
+		"POST /indexes/posts/search",
+	}, requests)
+	assert.JSONEq(t, `{"filterableAttributes":["published"]}`, bodies[0])
+	assert.JSONEq(t, `[{"id":"7","title":"Dolphins"}]`, bodies[1])
+	assert.JSONEq(t, `["8"]`, bodies[2])
+	var search map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(bodies[3]), &search))
+	assert.Equal(t, `author = "Jo \"Jo\"" AND published = true`, search["filter"])
+	assert.Equal(t, 1, results.Total)
+	assert.Equal(t, Hit{ID: "7", Score: 0.9, Document: map[string]interface{}{"id": "7", "title": "Dolphins"}}, results.Hits[0])
+}
+
+func TestElasticsearch(t *testing.T) {
+	var bulk string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		switch r.URL.Path {
+		case "/_bulk":
+			assert.Equal(t, "application/x-ndjson", r.Header.Get("Content-Type"))
+			bulk += string(body)
+			w.Write([]byte(`{"errors":false,"items":[]}`))
+		case "/posts/_search":
+			assert.Contains(t, string(body), `{"term":{"published":true}}`)
+			w.Write([]byte(`{"hits":{"total":{"value":1},"hits":[{"_id":"7","_score":1.5,"_source":{"title":"Dolphins"}}]}}`))
+		case "/missing/_search":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"type":"index_not_found_exception"}}`))
+		}
+	}))
+	defer server.Close()
+
+	engine := NewElasticsearch(server.URL, "", "")
+	ctx := context.Background()
+	require.NoError(t, engine.Index(ctx, "posts", Document{ID: "7", Fields: map[string]interface{}{"title": "Dolphins"}}))
+	require.NoError(t, engine.Delete(ctx, "posts", "8"))
+	assert.Equal(t, `{"index":{"_id":"7","_index":"posts"}}
+{"title":"Dolphins"}
+{"delete":{"_id":"8","_index":"posts"}}
+`, bulk)
+
+	results, err := engine.Search(ctx, "posts", Query{Text: "dolphins", Filters: map[string]interface{}{"published": true}})
+	require.NoError(t, err)
+	assert.Equal(t, &Results{Hits: []Hit{{ID: "7", Score: 1.5, Document: map[string]interface{}{"title": "Dolphins"}}}, Total: 1}, results)
+
+	results, err = engine.Search(ctx, "missing", Query{Text: "dolphins"})
+	require.NoError(t, err)
+	assert.Empty(t, results.Hits)
+}
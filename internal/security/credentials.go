@@ -165,7 +165,12 @@ func (cm *CredentialManager) DecryptToFile(filePath string) error {
 
 // loadOrGenerateMasterKey loads or generates the master key
 func (cm *CredentialManager) loadOrGenerateMasterKey() error {
-	// Try to load existing key
+	// Try to load existing key, preferring DOLPHIN_MASTER_KEY
+	if os.Getenv(MasterKeyEnv) != "" {
+		key, err := LoadMasterKey(cm.keyFile)
+		cm.masterKey = key
+		return err
+	}
 	if data, err := os.ReadFile(cm.keyFile); err == nil {
 		cm.masterKey = data
 		return nil
@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/gorilla/sessions"
+	"github.com/mrhoseah/dolphin/internal/problem"
 	"go.uber.org/zap"
 )
 
@@ -249,7 +250,7 @@ func CSRFMiddleware(manager *CSRFManager, config *CSRFConfig) func(http.Handler)
 					zap.String("method", r.Method),
 					zap.String("path", r.URL.Path),
 					zap.String("ip", r.RemoteAddr))
-				http.Error(w, "CSRF token missing", http.StatusForbidden)
+				problem.Write(w, r, problem.New(problem.StatusPageExpired, "CSRF token missing"))
 				return
 			}
 
@@ -257,7 +258,7 @@ func CSRFMiddleware(manager *CSRFManager, config *CSRFConfig) func(http.Handler)
 			valid, err := manager.ValidateToken(sessionID, token)
 			if err != nil {
 				manager.logger.Error("CSRF token validation error", zap.Error(err))
-				http.Error(w, "CSRF token validation failed", http.StatusForbidden)
+				problem.Write(w, r, problem.New(problem.StatusPageExpired, "CSRF token validation failed"))
 				return
 			}
 
@@ -266,7 +267,7 @@ func CSRFMiddleware(manager *CSRFManager, config *CSRFConfig) func(http.Handler)
 					zap.String("method", r.Method),
 					zap.String("path", r.URL.Path),
 					zap.String("ip", r.RemoteAddr))
-				http.Error(w, "CSRF token invalid", http.StatusForbidden)
+				problem.Write(w, r, problem.New(problem.StatusPageExpired, "CSRF token invalid"))
 				return
 			}
 
@@ -0,0 +1,128 @@
+package security
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// EncryptedEnvFile is the encrypted .env the application loads at boot
+	EncryptedEnvFile = ".env.encrypted"
+
+	// CredentialsKeyFile holds the master key; keep it out of version control
+	CredentialsKeyFile = ".dolphin/credentials.key"
+
+	// MasterKeyEnv supplies the master key, base64 encoded, where the key
+	// file isn't deployed
+	MasterKeyEnv = "DOLPHIN_MASTER_KEY"
+)
+
+// ErrNoMasterKey is returned when neither DOLPHIN_MASTER_KEY nor the key
+// file is available to decrypt credentials
+var ErrNoMasterKey = errors.New("no master key: set " + MasterKeyEnv + " or provide " + CredentialsKeyFile)
+
+// LoadMasterKey reads the master key from DOLPHIN_MASTER_KEY, falling back
+// to keyFile. Unlike NewCredentialManager it never generates a key.
+func LoadMasterKey(keyFile string) ([]byte, error) {
+	if encoded := strings.TrimSpace(os.Getenv(MasterKeyEnv)); encoded != "" {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", MasterKeyEnv, err)
+		}
+		return key, nil
+	}
+
+	key, err := os.ReadFile(keyFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoMasterKey
+	}
+	return key, err
+}
+
+// EncryptEnv encrypts a whole .env file, comments and all, to dst
+func (cm *CredentialManager) EncryptEnv(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	return cm.WriteEnv(dst, data)
+}
+
+// WriteEnv encrypts plaintext to an encrypted .env file
+func (cm *CredentialManager) WriteEnv(path string, plaintext []byte) error {
+	encrypted, err := cm.encrypt(string(plaintext))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt %s: %w", path, err)
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(path, []byte(encrypted+"\n"), 0600)
+}
+
+// ReadEnv decrypts an encrypted .env file
+func (cm *CredentialManager) ReadEnv(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := cm.decrypt(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s (wrong master key?): %w", path, err)
+	}
+	return []byte(plaintext), nil
+}
+
+// EditEnv decrypts path to a private temporary file, lets edit change it and
+// re-encrypts the result. A missing path starts from an empty file. The
+// plaintext is removed afterwards; it reports whether anything changed.
+func (cm *CredentialManager) EditEnv(path string, edit func(file string) error) (bool, error) {
+	var plaintext []byte
+	if _, err := os.Stat(path); err == nil {
+		if plaintext, err = cm.ReadEnv(path); err != nil {
+			return false, err
+		}
+	}
+
+	tmp, err := os.CreateTemp("", "dolphin-credentials-*.env")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(plaintext)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if err := edit(tmp.Name()); err != nil {
+		return false, err
+	}
+	edited, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		return false, err
+	}
+	if string(edited) == string(plaintext) {
+		return false, nil
+	}
+	return true, cm.WriteEnv(path, edited)
+}
+
+// DecryptEnvFile decrypts an encrypted .env file in memory with the master
+// key from LoadMasterKey
+func DecryptEnvFile(path, keyFile string) ([]byte, error) {
+	key, err := LoadMasterKey(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	cm := &CredentialManager{masterKey: key, keyFile: keyFile, encrypted: make(map[string]string)}
+	return cm.ReadEnv(path)
+}
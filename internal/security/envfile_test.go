@@ -0,0 +1,58 @@
+package security
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEditEnv(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(MasterKeyEnv, "")
+	keyFile := filepath.Join(dir, ".dolphin", "credentials.key")
+	path := filepath.Join(dir, EncryptedEnvFile)
+
+	cm, err := NewCredentialManager(keyFile)
+	require.NoError(t, err)
+	assert.FileExists(t, keyFile, "a master key is generated for the first edit")
+
+	var edited string
+	changed, err := cm.EditEnv(path, func(file string) error {
+		edited = file
+		data, err := os.ReadFile(file)
+		require.NoError(t, err)
+		assert.Empty(t, data)
+		return os.WriteFile(file, []byte("STRIPE_SECRET=sk_live_1\n"), 0600)
+	})
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.NoFileExists(t, edited, "the plaintext is removed")
+
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(raw), "sk_live_1")
+	plaintext, err := DecryptEnvFile(path, keyFile)
+	require.NoError(t, err)
+	assert.Equal(t, "STRIPE_SECRET=sk_live_1\n", string(plaintext))
+
+	// Closing the editor without saving changes nothing
+	changed, err = cm.EditEnv(path, func(file string) error { return nil })
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	_, err = cm.EditEnv(path, func(file string) error {
+		os.WriteFile(file, []byte("STRIPE_SECRET=lost\n"), 0600)
+		return errors.New("editor exited with status 1")
+	})
+	assert.Error(t, err)
+	plaintext, err = DecryptEnvFile(path, keyFile)
+	require.NoError(t, err)
+	assert.Equal(t, "STRIPE_SECRET=sk_live_1\n", string(plaintext), "a failed edit is discarded")
+
+	_, err = DecryptEnvFile(path, filepath.Join(dir, "missing.key"))
+	assert.ErrorIs(t, err, ErrNoMasterKey)
+}
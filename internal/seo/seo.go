@@ -0,0 +1,237 @@
+// Package seo serves the plain-text files crawlers and researchers look for:
+// /robots.txt and /.well-known/security.txt (RFC 9116), generated from the
+// seo config. Environments listed in seo.robots.disallow_environments, such
+// as staging, disallow every crawler whatever the rules.
+//
+// Either file can be overridden with a text/template at its template path,
+// rendered with TemplateData; {{.Generated}} includes the generated file.
+package seo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+// SecurityTxtPath is where security.txt is served
+const SecurityTxtPath = "/.well-known/security.txt"
+
+// TemplateData is what override templates are rendered with
+type TemplateData struct {
+	Environment string
+	URL         string
+
+	// DisallowAll is set in robots.txt for disallowed environments
+	DisallowAll bool
+
+	// Generated is the file generated from the config
+	Generated string
+}
+
+// Files generates robots.txt and security.txt for an app environment
+type Files struct {
+	cfg         config.SEOConfig
+	environment string
+	url         string
+	expires     time.Time
+	logger      *zap.Logger
+
+	now func() time.Time
+}
+
+// New creates the files of the seo config for app's environment and URL
+func New(cfg config.SEOConfig, app config.AppConfig, logger *zap.Logger) (*Files, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	f := &Files{
+		cfg:         cfg,
+		environment: app.Environment,
+		url:         strings.TrimRight(app.URL, "/"),
+		logger:      logger,
+		now:         time.Now,
+	}
+	if cfg.SecurityTxt.Enabled {
+		if err := f.validateSecurityTxt(); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (f *Files) validateSecurityTxt() error {
+	cfg := f.cfg.SecurityTxt
+	if len(cfg.Contact) == 0 {
+		return errors.New("seo: security.txt needs a contact")
+	}
+	for _, contact := range cfg.Contact {
+		if !strings.HasPrefix(contact, "mailto:") && !strings.HasPrefix(contact, "tel:") && !strings.HasPrefix(contact, "https://") {
+			return fmt.Errorf("seo: security.txt contact %q must be a mailto:, tel: or https:// URI", contact)
+		}
+	}
+	if cfg.Expires != "" {
+		expires, err := time.Parse(time.RFC3339, cfg.Expires)
+		if err != nil {
+			return fmt.Errorf("seo: security.txt expires must be RFC 3339: %w", err)
+		}
+		f.expires = expires
+	}
+	return nil
+}
+
+// DisallowAll reports whether the environment's robots.txt disallows every
+// crawler
+func (f *Files) DisallowAll() bool {
+	return slices.Contains(f.cfg.Robots.DisallowEnvironments, f.environment)
+}
+
+// Robots returns the environment's robots.txt
+func (f *Files) Robots() ([]byte, error) {
+	var b strings.Builder
+	if f.DisallowAll() {
+		b.WriteString("User-agent: *\nDisallow: /\n")
+		return f.override(f.cfg.Robots.Template, b.String())
+	}
+
+	rules := f.cfg.Robots.Rules
+	if len(rules) == 0 {
+		rules = []config.RobotsRule{{UserAgent: "*"}}
+	}
+	for i, rule := range rules {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		agent := rule.UserAgent
+		if agent == "" {
+			agent = "*"
+		}
+		fmt.Fprintf(&b, "User-agent: %s\n", agent)
+		for _, path := range rule.Allow {
+			fmt.Fprintf(&b, "Allow: %s\n", path)
+		}
+		for _, path := range rule.Disallow {
+			fmt.Fprintf(&b, "Disallow: %s\n", path)
+		}
+		if len(rule.Allow) == 0 && len(rule.Disallow) == 0 {
+			b.WriteString("Disallow:\n")
+		}
+		if rule.CrawlDelay > 0 {
+			fmt.Fprintf(&b, "Crawl-delay: %d\n", rule.CrawlDelay)
+		}
+	}
+	if len(f.cfg.Robots.Sitemaps) > 0 {
+		b.WriteString("\n")
+		for _, sitemap := range f.cfg.Robots.Sitemaps {
+			fmt.Fprintf(&b, "Sitemap: %s\n", f.absolute(sitemap))
+		}
+	}
+	return f.override(f.cfg.Robots.Template, b.String())
+}
+
+// SecurityTxt returns security.txt. Without seo.security_txt.expires it
+// expires a year from now.
+func (f *Files) SecurityTxt() ([]byte, error) {
+	cfg := f.cfg.SecurityTxt
+	expires := f.expires
+	if expires.IsZero() {
+		expires = f.now().UTC().Truncate(24*time.Hour).AddDate(1, 0, 0)
+	}
+	canonical := cfg.Canonical
+	if len(canonical) == 0 && f.url != "" {
+		canonical = []string{f.url + SecurityTxtPath}
+	}
+
+	var b strings.Builder
+	field := func(name string, values []string) {
+		for _, value := range values {
+			fmt.Fprintf(&b, "%s: %s\n", name, f.absolute(value))
+		}
+	}
+	field("Contact", cfg.Contact)
+	fmt.Fprintf(&b, "Expires: %s\n", expires.Format(time.RFC3339))
+	field("Encryption", cfg.Encryption)
+	field("Acknowledgments", cfg.Acknowledgments)
+	if len(cfg.PreferredLanguages) > 0 {
+		fmt.Fprintf(&b, "Preferred-Languages: %s\n", strings.Join(cfg.PreferredLanguages, ", "))
+	}
+	field("Canonical", canonical)
+	field("Policy", cfg.Policy)
+	field("Hiring", cfg.Hiring)
+	return f.override(cfg.Template, b.String())
+}
+
+// absolute resolves paths such as /sitemap.xml against the app URL, which
+// crawlers require
+func (f *Files) absolute(value string) string {
+	if f.url == "" || !strings.HasPrefix(value, "/") || strings.HasPrefix(value, "//") {
+		return value
+	}
+	return f.url + value
+}
+
+// override renders the template at path over a generated file, or returns
+// the file when there is none
+func (f *Files) override(path, generated string) ([]byte, error) {
+	if path == "" {
+		return []byte(generated), nil
+	}
+	source, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return []byte(generated), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New(path).Parse(string(source))
+	if err != nil {
+		return nil, fmt.Errorf("seo: %w", err)
+	}
+	var out bytes.Buffer
+	err = tmpl.Execute(&out, TemplateData{
+		Environment: f.environment,
+		URL:         f.url,
+		DisallowAll: f.DisallowAll(),
+		Generated:   generated,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("seo: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// Routes serves the enabled files
+func (f *Files) Routes(r chi.Router) {
+	if f.cfg.Robots.Enabled {
+		r.Get("/robots.txt", f.serve(f.Robots))
+	}
+	if f.cfg.SecurityTxt.Enabled {
+		r.Get(SecurityTxtPath, f.serve(f.SecurityTxt))
+	}
+}
+
+func (f *Files) serve(generate func() ([]byte, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := generate()
+		if err != nil {
+			f.logger.Error("Failed to generate "+r.URL.Path, zap.Error(err))
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		w.Write(body)
+	}
+}
@@ -0,0 +1,158 @@
+package seo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+var testConfig = config.SEOConfig{
+	Robots: config.RobotsConfig{
+		Enabled:              true,
+		DisallowEnvironments: []string{"staging"},
+		Rules: []config.RobotsRule{
+			{UserAgent: "*", Allow: []string{"/"}, Disallow: []string{"/admin", "/api"}},
+			{UserAgent: "GPTBot", Disallow: []string{"/"}, CrawlDelay: 10},
+		},
+		Sitemaps: []string{"/sitemap.xml", "https://cdn.example.com/news.xml"},
+	},
+	SecurityTxt: config.SecurityTxtConfig{
+		Enabled:            true,
+		Contact:            []string{"mailto:security@example.com", "https://example.com/security"},
+		Encryption:         []string{"/pgp-key.txt"},
+		PreferredLanguages: []string{"en", "sw"},
+		Policy:             []string{"https://example.com/disclosure"},
+	},
+}
+
+func newTestFiles(t *testing.T, cfg config.SEOConfig, environment string) *Files {
+	files, err := New(cfg, config.AppConfig{Environment: environment, URL: "https://example.com/"}, nil)
+	require.NoError(t, err)
+	files.now = func() time.Time { return time.Date(2026, 10, 18, 15, 4, 5, 0, time.UTC) }
+	return files
+}
+
+func TestRobots(t *testing.T) {
+	robots, err := newTestFiles(t, testConfig, "production").Robots()
+	require.NoError(t, err)
+	assert.Equal(t, `User-agent: *
+Allow: /
+Disallow: /admin
+Disallow: /api
+
+User-agent: GPTBot
+Disallow: /
+Crawl-delay: 10
+
+Sitemap: https://example.com/sitemap.xml
+Sitemap: https://cdn.example.com/news.xml
+`, string(robots))
+
+	robots, err = newTestFiles(t, testConfig, "staging").Robots()
+	require.NoError(t, err)
+	assert.Equal(t, "User-agent: *\nDisallow: /\n", string(robots))
+
+	robots, err = newTestFiles(t, config.SEOConfig{}, "production").Robots()
+	require.NoError(t, err)
+	assert.Equal(t, "User-agent: *\nDisallow:\n", string(robots), "allows everything")
+}
+
+func TestSecurityTxt(t *testing.T) {
+	securityTxt, err := newTestFiles(t, testConfig, "production").SecurityTxt()
+	require.NoError(t, err)
+	assert.Equal(t, `Contact: mailto:security@example.com
+Contact: https://example.com/security
+Expires: 2027-10-18T00:00:00Z
+Encryption: https://example.com/pgp-key.txt
+Preferred-Languages: en, sw
+Canonical: https://example.com/.well-known/security.txt
+Policy: https://example.com/disclosure
+`, string(securityTxt))
+
+	cfg := testConfig
+	cfg.SecurityTxt.Expires = "2027-01-01T00:00:00Z"
+	cfg.SecurityTxt.Canonical = []string{"https://www.example.com/.well-known/security.txt"}
+	securityTxt, err = newTestFiles(t, cfg, "production").SecurityTxt()
+	require.NoError(t, err)
+	assert.Contains(t, string(securityTxt), "Expires: 2027-01-01T00:00:00Z\n")
+	assert.Contains(t, string(securityTxt), "Canonical: https://www.example.com/.well-known/security.txt\n")
+}
+
+func TestSecurityTxtValidation(t *testing.T) {
+	for name, securityTxt := range map[string]config.SecurityTxtConfig{
+		"no contact":  {Enabled: true},
+		"bad contact": {Enabled: true, Contact: []string{"security@example.com"}},
+		"bad expires": {Enabled: true, Contact: []string{"mailto:security@example.com"}, Expires: "next year"},
+	} {
+		_, err := New(config.SEOConfig{SecurityTxt: securityTxt}, config.AppConfig{}, nil)
+		assert.Error(t, err, name)
+	}
+
+	_, err := New(config.SEOConfig{SecurityTxt: config.SecurityTxtConfig{Contact: []string{"oops"}}}, config.AppConfig{}, nil)
+	assert.NoError(t, err, "disabled")
+}
+
+func TestTemplateOverride(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "robots.txt")
+	require.NoError(t, os.WriteFile(path, []byte(`# {{.Environment}} at {{.URL}}
+{{.Generated}}{{if not .DisallowAll}}
+User-agent: Googlebot-Image
+Disallow: /private-images
+{{end}}`), 0644))
+
+	cfg := testConfig
+	cfg.Robots.Rules = nil
+	cfg.Robots.Sitemaps = nil
+	cfg.Robots.Template = path
+	robots, err := newTestFiles(t, cfg, "production").Robots()
+	require.NoError(t, err)
+	assert.Equal(t, `# production at https://example.com
+User-agent: *
+Disallow:
+
+User-agent: Googlebot-Image
+Disallow: /private-images
+`, string(robots))
+
+	robots, err = newTestFiles(t, cfg, "staging").Robots()
+	require.NoError(t, err)
+	assert.Equal(t, "# staging at https://example.com\nUser-agent: *\nDisallow: /\n", string(robots))
+
+	cfg.Robots.Template = filepath.Join(t.TempDir(), "missing.txt")
+	robots, err = newTestFiles(t, cfg, "production").Robots()
+	require.NoError(t, err)
+	assert.Equal(t, "User-agent: *\nDisallow:\n", string(robots), "generated without the template")
+}
+
+func TestRoutes(t *testing.T) {
+	r := chi.NewRouter()
+	newTestFiles(t, testConfig, "staging").Routes(r)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/robots.txt", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/plain; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "User-agent: *\nDisallow: /\n", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, SecurityTxtPath, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Contact: mailto:security@example.com\n")
+
+	cfg := testConfig
+	cfg.SecurityTxt.Enabled = false
+	r = chi.NewRouter()
+	newTestFiles(t, cfg, "production").Routes(r)
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, SecurityTxtPath, nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
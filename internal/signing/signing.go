@@ -0,0 +1,249 @@
+// Package signing signs requests between the app's services with a shared
+// HMAC secret, for internal traffic that doesn't run over mutual TLS. The
+// caller signs the timestamp, a nonce, the method, the URI and a SHA-256 of
+// the body:
+//
+//	client := &http.Client{Transport: signing.Default.Transport(nil)}
+//
+// and the service called verifies the signature, refusing requests signed
+// too long ago or whose nonce it has already seen:
+//
+//	r.With(router.Signing().Middleware()).Post("/internal/orders", orders.Sync)
+package signing
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/cache"
+	"github.com/mrhoseah/dolphin/internal/problem"
+)
+
+// Header carries the signature: key=<id>,t=<unix seconds>,nonce=<hex>,v1=<hex>
+const Header = "X-Signature"
+
+// maxBody caps the bodies hashed when verifying; larger requests are refused
+const maxBody = 10 << 20
+
+var (
+	// ErrInvalidSignature is returned for requests that aren't signed by a
+	// known key, or were signed too long ago
+	ErrInvalidSignature = errors.New("signing: invalid signature")
+
+	// ErrReplayed is returned for a signed request seen before
+	ErrReplayed = errors.New("signing: replayed request")
+)
+
+// Default signs the app's outgoing requests with signing.key_id and
+// signing.secret, set by the router. It is nil until they are configured.
+var Default *Signer
+
+// Signer signs outgoing requests
+type Signer struct {
+	keyID  string
+	secret []byte
+	now    func() time.Time
+}
+
+// NewSigner creates a signer presenting keyID, shared with the services
+// called along with secret
+func NewSigner(keyID, secret string) *Signer {
+	return &Signer{keyID: keyID, secret: []byte(secret), now: time.Now}
+}
+
+// Sign sets the signature header of req, reading its body and putting it
+// back for sending
+func (s *Signer) Sign(req *http.Request) error {
+	body, err := readBody(req)
+	if err != nil {
+		return fmt.Errorf("signing: reading the body: %w", err)
+	}
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("signing: %w", err)
+	}
+	timestamp := strconv.FormatInt(s.now().Unix(), 10)
+	n := hex.EncodeToString(nonce)
+	signature := sign(s.secret, timestamp, n, req.Method, req.URL.RequestURI(), body)
+	req.Header.Set(Header, fmt.Sprintf("key=%s,t=%s,nonce=%s,v1=%s", s.keyID, timestamp, n, signature))
+	return nil
+}
+
+// Transport returns a round tripper signing each request before base sends
+// it, http.DefaultTransport when nil. Retries are signed afresh, so they
+// aren't refused as replays.
+func (s *Signer) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return signingTransport{signer: s, base: base}
+}
+
+type signingTransport struct {
+	signer *Signer
+	base   http.RoundTripper
+}
+
+func (t signingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A round tripper mustn't change the request it is given
+	req = req.Clone(req.Context())
+	if err := t.signer.Sign(req); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
+
+// readBody returns the body of req, leaving it to be read again
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer body.Close()
+		return io.ReadAll(body)
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+	return body, nil
+}
+
+// sign returns the hex HMAC-SHA256 of a request's signed parts
+func sign(secret []byte, timestamp, nonce, method, uri string, body []byte) string {
+	digest := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n%s", timestamp, nonce, method, uri, hex.EncodeToString(digest[:]))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// callerKey holds the key ID of a verified request
+type callerKey struct{}
+
+// Caller returns the key ID the request of ctx was signed with, once the
+// verifier's middleware has checked it
+func Caller(ctx context.Context) (string, bool) {
+	keyID, ok := ctx.Value(callerKey{}).(string)
+	return keyID, ok
+}
+
+// Verifier checks the signatures of inbound requests
+type Verifier struct {
+	keys    map[string][]byte
+	maxSkew time.Duration
+	nonces  cache.Locker
+	logger  *zap.Logger
+	now     func() time.Time
+}
+
+// NewVerifier creates a verifier accepting the secrets of keys, by key ID,
+// on requests signed within maxSkew of now. Nonces are held in nonces for
+// as long as their requests would be accepted; with the Redis locker every
+// instance refuses a replay.
+func NewVerifier(keys map[string]string, maxSkew time.Duration, nonces cache.Locker, logger *zap.Logger) *Verifier {
+	if maxSkew <= 0 {
+		maxSkew = 5 * time.Minute
+	}
+	if nonces == nil {
+		nonces = cache.Locks
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	v := &Verifier{keys: make(map[string][]byte, len(keys)), maxSkew: maxSkew, nonces: nonces, logger: logger, now: time.Now}
+	for keyID, secret := range keys {
+		v.keys[keyID] = []byte(secret)
+	}
+	return v
+}
+
+// Verify checks the signature of r, returning the key ID it was signed
+// with. The body is read and put back for the handler.
+func (v *Verifier) Verify(r *http.Request) (string, error) {
+	fields := map[string]string{}
+	for _, part := range strings.Split(r.Header.Get(Header), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		fields[name] = value
+	}
+	keyID, timestamp, nonce, signature := fields["key"], fields["t"], fields["nonce"], fields["v1"]
+	secret, ok := v.keys[keyID]
+	if !ok {
+		return "", fmt.Errorf("%w: unknown key %q", ErrInvalidSignature, keyID)
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || nonce == "" || len(nonce) > 64 || signature == "" {
+		return "", fmt.Errorf("%w: malformed %s header", ErrInvalidSignature, Header)
+	}
+	if skew := v.now().Sub(time.Unix(seconds, 0)); skew > v.maxSkew || skew < -v.maxSkew {
+		return "", fmt.Errorf("%w: timestamp is %s off", ErrInvalidSignature, skew.Round(time.Second))
+	}
+
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		body, err = io.ReadAll(io.LimitReader(r.Body, maxBody+1))
+		r.Body.Close()
+		if err != nil {
+			return "", fmt.Errorf("signing: reading the body: %w", err)
+		}
+		if len(body) > maxBody {
+			return "", fmt.Errorf("%w: body too large to verify", ErrInvalidSignature)
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	expected := sign(secret, timestamp, nonce, r.Method, r.URL.RequestURI(), body)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return "", fmt.Errorf("%w: signature mismatch", ErrInvalidSignature)
+	}
+
+	// A nonce is held until its timestamp is too old to be accepted anyway
+	fresh, err := v.nonces.AcquireLock(r.Context(), "signing:nonce:"+keyID+":"+nonce, keyID, 2*v.maxSkew)
+	if err != nil {
+		return "", fmt.Errorf("signing: checking the nonce: %w", err)
+	}
+	if !fresh {
+		return "", ErrReplayed
+	}
+	return keyID, nil
+}
+
+// Middleware refuses requests without a valid signature with a 401
+// problem, and lets handlers find the caller with Caller
+func (v *Verifier) Middleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			keyID, err := v.Verify(r)
+			if err != nil {
+				if !errors.Is(err, ErrInvalidSignature) && !errors.Is(err, ErrReplayed) {
+					v.logger.Error("Failed to verify a request signature", zap.Error(err))
+					problem.Write(w, r, err)
+					return
+				}
+				v.logger.Warn("Refused a request with an invalid signature",
+					zap.String("path", r.URL.Path), zap.String("remote_addr", r.RemoteAddr), zap.Error(err))
+				problem.Write(w, r, problem.New(http.StatusUnauthorized, "The request signature is invalid"))
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), callerKey{}, keyID)))
+		})
+	}
+}
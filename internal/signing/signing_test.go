@@ -0,0 +1,123 @@
+package signing
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/cache"
+)
+
+func newServer(t *testing.T, v *Verifier) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(v.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		caller, _ := Caller(r.Context())
+		body, _ := io.ReadAll(r.Body)
+		w.Write([]byte(caller + ":" + string(body)))
+	})))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestTransport(t *testing.T) {
+	v := NewVerifier(map[string]string{"orders": "secret"}, time.Minute, cache.NewMemoryCache(), nil)
+	server := newServer(t, v)
+	client := &http.Client{Transport: NewSigner("orders", "secret").Transport(nil)}
+
+	for _, body := range []string{`{"id":7}`, `{"id":7}`} {
+		resp, err := client.Post(server.URL+"/internal/orders?sync=1", "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		got, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "each request is signed afresh")
+		assert.Equal(t, "orders:"+body, string(got))
+	}
+
+	resp, err := client.Get(server.URL + "/internal/orders")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	v := NewVerifier(map[string]string{"orders": "secret"}, time.Minute, cache.NewMemoryCache(), nil)
+	v.now = func() time.Time { return now }
+	signed := func(signer *Signer, method, target, body string) *http.Request {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		require.NoError(t, signer.Sign(req))
+		return req
+	}
+	signer := NewSigner("orders", "secret")
+	signer.now = func() time.Time { return now }
+
+	req := signed(signer, http.MethodPost, "/internal/orders", "paid")
+	keyID, err := v.Verify(req)
+	require.NoError(t, err)
+	assert.Equal(t, "orders", keyID)
+	body, _ := io.ReadAll(req.Body)
+	assert.Equal(t, "paid", string(body), "the handler reads the body")
+
+	// The same request sent again is a replay
+	replayed := httptest.NewRequest(http.MethodPost, "/internal/orders", strings.NewReader("paid"))
+	replayed.Header = req.Header
+	_, err = v.Verify(replayed)
+	assert.ErrorIs(t, err, ErrReplayed)
+
+	// Changing the body, method or URI breaks the signature
+	for _, tamper := range []func(*http.Request) *http.Request{
+		func(r *http.Request) *http.Request {
+			return withHeader(httptest.NewRequest(http.MethodPost, "/internal/orders", strings.NewReader("refunded")), r)
+		},
+		func(r *http.Request) *http.Request {
+			return withHeader(httptest.NewRequest(http.MethodPut, "/internal/orders", strings.NewReader("paid")), r)
+		},
+		func(r *http.Request) *http.Request {
+			return withHeader(httptest.NewRequest(http.MethodPost, "/internal/orders?all=1", strings.NewReader("paid")), r)
+		},
+	} {
+		_, err = v.Verify(tamper(signed(signer, http.MethodPost, "/internal/orders", "paid")))
+		assert.ErrorIs(t, err, ErrInvalidSignature)
+	}
+
+	_, err = v.Verify(signed(NewSigner("orders", "other"), http.MethodGet, "/internal/orders", ""))
+	assert.ErrorIs(t, err, ErrInvalidSignature, "wrong secret")
+	_, err = v.Verify(signed(NewSigner("billing", "secret"), http.MethodGet, "/internal/orders", ""))
+	assert.ErrorIs(t, err, ErrInvalidSignature, "unknown key")
+	_, err = v.Verify(httptest.NewRequest(http.MethodGet, "/internal/orders", nil))
+	assert.ErrorIs(t, err, ErrInvalidSignature, "unsigned")
+
+	// Clocks may be off by up to the skew, either way
+	for _, offset := range []time.Duration{-50 * time.Second, 50 * time.Second} {
+		skewed := NewSigner("orders", "secret")
+		skewed.now = func() time.Time { return now.Add(offset) }
+		_, err = v.Verify(signed(skewed, http.MethodGet, "/internal/orders", ""))
+		assert.NoError(t, err)
+	}
+	stale := NewSigner("orders", "secret")
+	stale.now = func() time.Time { return now.Add(-2 * time.Minute) }
+	_, err = v.Verify(signed(stale, http.MethodGet, "/internal/orders", ""))
+	assert.ErrorIs(t, err, ErrInvalidSignature, "signed too long ago")
+}
+
+func TestMiddleware(t *testing.T) {
+	v := NewVerifier(map[string]string{"orders": "secret"}, time.Minute, cache.NewMemoryCache(), nil)
+	server := newServer(t, v)
+
+	resp, err := http.Post(server.URL, "text/plain", strings.NewReader("unsigned"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+// withHeader gives req the signature of signed
+func withHeader(req, signed *http.Request) *http.Request {
+	req.Header.Set(Header, signed.Header.Get(Header))
+	return req
+}
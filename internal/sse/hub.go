@@ -0,0 +1,341 @@
+package sse
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/broadcast"
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/problem"
+)
+
+// BroadcastChannel is the broadcast channel events published on a hub are
+// shared on, named after their hub channel
+const BroadcastChannel = "sse"
+
+// subscriberBuffer is how many events a stream may fall behind by before
+// it is closed, to catch up from the history when the client reconnects
+const subscriberBuffer = 64
+
+// Default is the hub of the app's streams, configured from sse by the
+// router and drained when the server shuts down
+var Default = NewHub(config.SSEConfig{Heartbeat: 15 * time.Second, Retry: 3 * time.Second, History: 100}, nil)
+
+// Hub publishes events on named channels to the streams following them,
+// on every instance once UseBroadcaster shares them
+type Hub struct {
+	heartbeat time.Duration
+	retry     time.Duration
+	history   int
+	logger    *zap.Logger
+
+	// draining is canceled by Drain, ending the streams
+	draining context.Context
+	drain    context.CancelFunc
+	streams  atomic.Int64
+
+	mu          sync.Mutex
+	subscribers map[string]map[*subscriber]bool
+	histories   map[string][]Event
+	watchers    map[uint64]func(channel string, e Event)
+	nextWatcher uint64
+	lastID      int64
+	broadcaster broadcast.Broadcaster
+	unsubscribe func()
+}
+
+// subscriber is a stream following channels
+type subscriber struct {
+	channels []string
+	events   chan Event
+	closed   bool
+}
+
+// NewHub creates a hub streaming as cfg says
+func NewHub(cfg config.SSEConfig, logger *zap.Logger) *Hub {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if cfg.Heartbeat <= 0 {
+		cfg.Heartbeat = 15 * time.Second
+	}
+	draining, drain := context.WithCancel(context.Background())
+	return &Hub{
+		heartbeat:   cfg.Heartbeat,
+		retry:       cfg.Retry,
+		history:     cfg.History,
+		logger:      logger,
+		draining:    draining,
+		drain:       drain,
+		subscribers: make(map[string]map[*subscriber]bool),
+		histories:   make(map[string][]Event),
+		watchers:    make(map[uint64]func(string, Event)),
+	}
+}
+
+// Stream starts a stream of events on w. It fails without writing
+// anything while the hub is draining, with a 503 problem.
+func (h *Hub) Stream(w http.ResponseWriter, r *http.Request) (*Stream, error) {
+	if h.draining.Err() != nil {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(h.retry.Seconds()))))
+		return nil, problem.New(http.StatusServiceUnavailable, "The server is shutting down")
+	}
+
+	// Streams outlive the server's write timeout and the request timeout;
+	// other cancellations, the client going away among them, end them
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+	ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+	context.AfterFunc(r.Context(), func() {
+		if !errors.Is(context.Cause(r.Context()), problem.ErrRequestTimeout) {
+			cancel()
+		}
+	})
+	stopDraining := context.AfterFunc(h.draining, cancel)
+	h.streams.Add(1)
+	context.AfterFunc(ctx, func() {
+		stopDraining()
+		h.streams.Add(-1)
+	})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	s := &Stream{
+		w:           w,
+		rc:          rc,
+		ctx:         ctx,
+		cancel:      cancel,
+		lastEventID: r.Header.Get("Last-Event-ID"),
+		heartbeat:   h.heartbeat,
+		logger:      h.logger,
+	}
+	// Starting with the retry delay, or a comment, sends the headers
+	start := []byte(": stream\n\n")
+	if h.retry > 0 {
+		start, _ = Event{Retry: h.retry}.encode()
+	}
+	if err := s.write(start); err != nil {
+		h.logger.Warn("Event stream can't be flushed", zap.Error(err))
+	}
+	return s, nil
+}
+
+// Serve streams the events published on channels, after those of them the
+// client missed since its Last-Event-ID that are still in the history. It
+// returns an error only when the stream can't start, before writing
+// anything.
+func (h *Hub) Serve(w http.ResponseWriter, r *http.Request, channels ...string) error {
+	stream, err := h.Stream(w, r)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	events, missed, unsubscribe := h.subscribe(channels, stream.LastEventID())
+	defer unsubscribe()
+	for _, e := range missed {
+		if err := stream.Send(e); errors.Is(err, ErrClosed) {
+			return nil
+		} else if err != nil {
+			h.logger.Error("Failed to send event", zap.String("event", e.Name), zap.Error(err))
+		}
+	}
+	stream.Run(events)
+	return nil
+}
+
+// Handler returns a handler serving the events published on channels
+func (h *Hub) Handler(channels ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := h.Serve(w, r, channels...); err != nil {
+			problem.Write(w, r, err)
+		}
+	})
+}
+
+// subscribe follows channels, returning the events of their histories
+// after lastEventID too
+func (h *Hub) subscribe(channels []string, lastEventID string) (<-chan Event, []Event, func()) {
+	sub := &subscriber{channels: channels, events: make(chan Event, subscriberBuffer)}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, channel := range channels {
+		if h.subscribers[channel] == nil {
+			h.subscribers[channel] = make(map[*subscriber]bool)
+		}
+		h.subscribers[channel][sub] = true
+	}
+
+	var missed []Event
+	if last, err := strconv.ParseInt(lastEventID, 10, 64); err == nil {
+		for _, channel := range channels {
+			for _, e := range h.histories[channel] {
+				if sequence(e) > last {
+					missed = append(missed, e)
+				}
+			}
+		}
+		sort.SliceStable(missed, func(i, j int) bool { return sequence(missed[i]) < sequence(missed[j]) })
+	}
+
+	return sub.events, missed, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.remove(sub)
+	}
+}
+
+// remove stops sending to sub, with the hub locked
+func (h *Hub) remove(sub *subscriber) {
+	for _, channel := range sub.channels {
+		delete(h.subscribers[channel], sub)
+		if len(h.subscribers[channel]) == 0 {
+			delete(h.subscribers, channel)
+		}
+	}
+	if !sub.closed {
+		sub.closed = true
+		close(sub.events)
+	}
+}
+
+// sequence returns the number of an event published on a hub
+func sequence(e Event) int64 {
+	n, _ := strconv.ParseInt(e.ID, 10, 64)
+	return n
+}
+
+// Publish numbers e and sends it to the streams following channel, on
+// this instance and, with a broadcaster, every other. IDs are the time of
+// publishing, so the clients of a channel can resume on any instance.
+func (h *Hub) Publish(ctx context.Context, channel string, e Event) error {
+	if data, ok := e.Data.([]byte); ok {
+		e.Data = string(data)
+	}
+	data, err := json.Marshal(e.Data)
+	if err != nil {
+		return fmt.Errorf("sse: encoding event data: %w", err)
+	}
+
+	h.mu.Lock()
+	next := time.Now().UnixNano()
+	if next <= h.lastID {
+		next = h.lastID + 1
+	}
+	h.lastID = next
+	b := h.broadcaster
+	h.mu.Unlock()
+	e.ID = strconv.FormatInt(next, 10)
+
+	h.deliver(channel, e)
+	if b != nil {
+		return b.Publish(ctx, BroadcastChannel, channel, wireEvent{ID: e.ID, Name: e.Name, Data: data, Retry: e.Retry})
+	}
+	return nil
+}
+
+// deliver keeps e in the channel's history and sends it to the channel's
+// streams and the watchers. Streams too far behind to take it are closed.
+func (h *Hub) deliver(channel string, e Event) {
+	h.mu.Lock()
+	if h.history > 0 {
+		history := append(h.histories[channel], e)
+		if len(history) > h.history {
+			history = append([]Event(nil), history[len(history)-h.history:]...)
+		}
+		h.histories[channel] = history
+	}
+	for sub := range h.subscribers[channel] {
+		select {
+		case sub.events <- e:
+		default:
+			h.logger.Warn("Event stream fell behind", zap.String("channel", channel))
+			h.remove(sub)
+		}
+	}
+	watchers := make([]func(string, Event), 0, len(h.watchers))
+	for _, fn := range h.watchers {
+		watchers = append(watchers, fn)
+	}
+	h.mu.Unlock()
+
+	for _, fn := range watchers {
+		fn(channel, e)
+	}
+}
+
+// Watch calls fn with every event delivered on this instance, published
+// here or on another instance. The returned function stops watching.
+func (h *Hub) Watch(fn func(channel string, e Event)) (stop func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.nextWatcher++
+	watcher := h.nextWatcher
+	h.watchers[watcher] = fn
+	return func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.watchers, watcher)
+	}
+}
+
+// wireEvent is an event as it is broadcast
+type wireEvent struct {
+	ID    string          `json:"id"`
+	Name  string          `json:"name,omitempty"`
+	Data  json.RawMessage `json:"data"`
+	Retry time.Duration   `json:"retry,omitempty"`
+}
+
+// UseBroadcaster has events published on any instance reach the streams
+// connected to this one, so clients can be spread over instances
+func (h *Hub) UseBroadcaster(b broadcast.Broadcaster) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.unsubscribe != nil {
+		h.unsubscribe()
+	}
+	h.broadcaster = b
+	h.unsubscribe = b.Subscribe(BroadcastChannel, func(ctx context.Context, msg broadcast.Message) error {
+		var wire wireEvent
+		if err := json.Unmarshal(msg.Payload, &wire); err != nil {
+			return err
+		}
+		e := Event{ID: wire.ID, Name: wire.Name, Retry: wire.Retry}
+		// Text is sent as it was published, anything else as its JSON
+		if len(wire.Data) > 0 && wire.Data[0] == '"' {
+			var text string
+			if err := json.Unmarshal(wire.Data, &text); err != nil {
+				return err
+			}
+			e.Data = text
+		} else if string(wire.Data) != "null" {
+			e.Data = wire.Data
+		}
+		h.deliver(msg.Name, e)
+		return nil
+	})
+}
+
+// Drain ends the hub's streams and refuses new ones, so clients reconnect
+// to an instance that isn't shutting down. It is registered with the
+// server's RegisterOnShutdown, as the server waits for streams otherwise.
+func (h *Hub) Drain() {
+	if h.draining.Err() == nil {
+		h.logger.Info("Draining event streams", zap.Int64("streams", h.streams.Load()))
+	}
+	h.drain()
+}
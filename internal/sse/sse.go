@@ -0,0 +1,194 @@
+// Package sse streams server-sent events to EventSource clients and the
+// HTMX SSE extension. A handler streams events of its own with a Stream:
+//
+//	func (c *ExportController) Progress(ctx *dolphin.Context) error {
+//		stream, err := ctx.EventStream()
+//		if err != nil {
+//			return err
+//		}
+//		stream.Run(c.exports.Progress(stream.Context(), ctx.Param("id")))
+//		return nil
+//	}
+//
+// or serves the events published on channels of a Hub, from any instance:
+//
+//	r.Get("/orders/{id}/events", func(w http.ResponseWriter, r *http.Request) {
+//		sse.Default.Serve(w, r, "orders."+chi.URLParam(r, "id"))
+//	})
+//	sse.Default.Publish(ctx, "orders.7", sse.Event{Name: "shipped", Data: order})
+//
+// Idle streams send heartbeats so proxies keep them open, events carry IDs
+// so reconnecting clients pick up where they left off, and streams end
+// when the server shuts down so clients reconnect to another instance.
+package sse
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrClosed is returned by Send once the client has gone away or the
+// server is shutting down
+var ErrClosed = errors.New("sse: stream closed")
+
+// Event is a server-sent event
+type Event struct {
+	// ID is sent back as Last-Event-ID by clients reconnecting after it.
+	// A Hub numbers the events published on it.
+	ID string
+
+	// Name is the event type clients listen for, "message" when empty
+	Name string
+
+	// Data is sent as it is when it is a string, []byte or template.HTML,
+	// and as JSON otherwise
+	Data interface{}
+
+	// Retry changes how long the client waits before reconnecting
+	Retry time.Duration
+}
+
+// encode returns the event in the wire format, one data line per line of
+// data
+func (e Event) encode() ([]byte, error) {
+	var buf bytes.Buffer
+	if e.ID != "" {
+		fmt.Fprintf(&buf, "id: %s\n", field(e.ID))
+	}
+	if e.Name != "" {
+		fmt.Fprintf(&buf, "event: %s\n", field(e.Name))
+	}
+	if e.Retry > 0 {
+		fmt.Fprintf(&buf, "retry: %d\n", e.Retry.Milliseconds())
+	}
+	if e.Data != nil {
+		data, err := text(e.Data)
+		if err != nil {
+			return nil, err
+		}
+		data = strings.ReplaceAll(strings.ReplaceAll(data, "\r\n", "\n"), "\r", "\n")
+		for _, line := range strings.Split(data, "\n") {
+			fmt.Fprintf(&buf, "data: %s\n", line)
+		}
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// text returns the data of an event as it is sent
+func text(data interface{}) (string, error) {
+	switch data := data.(type) {
+	case string:
+		return data, nil
+	case []byte:
+		return string(data), nil
+	case template.HTML:
+		return string(data), nil
+	}
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return "", fmt.Errorf("sse: encoding event data: %w", err)
+	}
+	return string(encoded), nil
+}
+
+// field removes the line breaks that would end an id or event field early
+func field(value string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+}
+
+// Stream is a response of server-sent events
+type Stream struct {
+	w           http.ResponseWriter
+	rc          *http.ResponseController
+	ctx         context.Context
+	cancel      context.CancelFunc
+	lastEventID string
+	heartbeat   time.Duration
+	logger      *zap.Logger
+
+	mu sync.Mutex
+}
+
+// Context returns the stream's context, canceled once the client has gone
+// away or the server is shutting down. Unlike the request's, it outlives
+// the request timeout of http.requests.
+func (s *Stream) Context() context.Context {
+	return s.ctx
+}
+
+// LastEventID returns the ID of the last event the client received before
+// reconnecting, or "" for a first connection
+func (s *Stream) LastEventID() string {
+	return s.lastEventID
+}
+
+// Send writes an event and flushes it to the client
+func (s *Stream) Send(e Event) error {
+	data, err := e.encode()
+	if err != nil {
+		return err
+	}
+	return s.write(data)
+}
+
+// write sends raw event stream data, closing the stream when it can't
+func (s *Stream) write(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ctx.Err() != nil {
+		return ErrClosed
+	}
+	if _, err := s.w.Write(data); err != nil {
+		s.cancel()
+		return fmt.Errorf("%w: %s", ErrClosed, err)
+	}
+	if err := s.rc.Flush(); err != nil {
+		s.cancel()
+		return fmt.Errorf("%w: %s", ErrClosed, err)
+	}
+	return nil
+}
+
+// Run sends the events received on events, and a heartbeat comment while
+// there are none, until events is closed, the client goes away or the
+// server shuts down. Events that can't be encoded are logged and skipped.
+func (s *Stream) Run(events <-chan Event) {
+	defer s.Close()
+	heartbeat := time.NewTicker(s.heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-heartbeat.C:
+			if s.write([]byte(": heartbeat\n\n")) != nil {
+				return
+			}
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			if err := s.Send(e); errors.Is(err, ErrClosed) {
+				return
+			} else if err != nil {
+				s.logger.Error("Failed to send event", zap.String("event", e.Name), zap.Error(err))
+			}
+		}
+	}
+}
+
+// Close ends the stream. The response is complete once the handler returns.
+func (s *Stream) Close() {
+	s.cancel()
+}
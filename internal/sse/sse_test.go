@@ -0,0 +1,169 @@
+package sse
+
+import (
+	"bufio"
+	"context"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/broadcast"
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/problem"
+)
+
+// client reads a stream one event, or comment, at a time
+type client struct {
+	resp    *http.Response
+	scanner *bufio.Scanner
+}
+
+func connect(t *testing.T, url, lastEventID string) *client {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return &client{resp: resp, scanner: bufio.NewScanner(resp.Body)}
+}
+
+// next returns the lines of the next event, or nil once the stream ends
+func (c *client) next() []string {
+	var lines []string
+	for c.scanner.Scan() {
+		if c.scanner.Text() == "" {
+			return lines
+		}
+		lines = append(lines, c.scanner.Text())
+	}
+	return nil
+}
+
+// wait waits for the hub to have subscribers on channel
+func wait(t *testing.T, hub *Hub, channel string) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		hub.mu.Lock()
+		defer hub.mu.Unlock()
+		return len(hub.subscribers[channel]) > 0
+	}, time.Second, time.Millisecond)
+}
+
+func TestEventEncoding(t *testing.T) {
+	encoded, err := Event{ID: "7", Name: "update\n", Data: "first\r\nsecond", Retry: 2 * time.Second}.encode()
+	require.NoError(t, err)
+	assert.Equal(t, "id: 7\nevent: update\nretry: 2000\ndata: first\ndata: second\n\n", string(encoded))
+
+	encoded, err = Event{Data: map[string]int{"count": 2}}.encode()
+	require.NoError(t, err)
+	assert.Equal(t, "data: {\"count\":2}\n\n", string(encoded))
+
+	encoded, err = Event{Name: "row", Data: template.HTML("<tr><td>1</td></tr>")}.encode()
+	require.NoError(t, err)
+	assert.Equal(t, "event: row\ndata: <tr><td>1</td></tr>\n\n", string(encoded))
+
+	_, err = Event{Data: make(chan int)}.encode()
+	assert.Error(t, err)
+}
+
+func TestStream(t *testing.T) {
+	hub := NewHub(config.SSEConfig{Heartbeat: 20 * time.Millisecond, Retry: time.Second}, nil)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The stream outlives the request timeout
+		ctx, cancel := context.WithTimeoutCause(r.Context(), time.Millisecond, problem.ErrRequestTimeout)
+		defer cancel()
+		stream, err := hub.Stream(w, r.WithContext(ctx))
+		require.NoError(t, err)
+		events := make(chan Event, 1)
+		events <- Event{ID: "1", Name: "progress", Data: map[string]string{"last": stream.LastEventID()}}
+		stream.Run(events)
+	}))
+	t.Cleanup(server.Close)
+
+	c := connect(t, server.URL, "41")
+	assert.Equal(t, "text/event-stream", c.resp.Header.Get("Content-Type"))
+	assert.Equal(t, []string{"retry: 1000"}, c.next())
+	assert.Equal(t, []string{"id: 1", "event: progress", `data: {"last":"41"}`}, c.next())
+	assert.Equal(t, []string{": heartbeat"}, c.next())
+}
+
+func TestHub(t *testing.T) {
+	hub := NewHub(config.SSEConfig{History: 2}, nil)
+	server := httptest.NewServer(hub.Handler("orders"))
+	t.Cleanup(server.Close)
+
+	c := connect(t, server.URL, "")
+	assert.Equal(t, []string{": stream"}, c.next())
+	wait(t, hub, "orders")
+
+	ctx := context.Background()
+	require.NoError(t, hub.Publish(ctx, "orders", Event{Name: "created", Data: []byte("7")}))
+	require.NoError(t, hub.Publish(ctx, "invoices", Event{Data: "not followed"}))
+	require.NoError(t, hub.Publish(ctx, "orders", Event{Name: "shipped", Data: "7"}))
+	created, shipped := c.next(), c.next()
+	assert.Equal(t, []string{"event: created", "data: 7"}, created[1:])
+	assert.Equal(t, []string{"event: shipped", "data: 7"}, shipped[1:])
+	assert.Less(t, created[0], shipped[0])
+
+	// Reconnecting after the first event replays the second
+	require.NoError(t, hub.Publish(ctx, "orders", Event{Name: "delivered", Data: "7"}))
+	resumed := connect(t, server.URL, strings.TrimPrefix(created[0], "id: "))
+	resumed.next()
+	assert.Equal(t, shipped, resumed.next())
+	assert.Equal(t, "event: delivered", resumed.next()[1])
+}
+
+func TestHubAcrossInstances(t *testing.T) {
+	network := broadcast.NewMemory(nil)
+	here, there := NewHub(config.SSEConfig{History: 10}, nil), NewHub(config.SSEConfig{History: 10}, nil)
+	here.UseBroadcaster(network)
+	there.UseBroadcaster(network.Join())
+
+	var watched []Event
+	there.Watch(func(channel string, e Event) { watched = append(watched, e) })
+
+	server := httptest.NewServer(there.Handler("orders"))
+	t.Cleanup(server.Close)
+	c := connect(t, server.URL, "")
+	c.next()
+	wait(t, there, "orders")
+
+	ctx := context.Background()
+	require.NoError(t, here.Publish(ctx, "orders", Event{Name: "created", Data: map[string]int{"id": 7}}))
+	require.NoError(t, here.Publish(ctx, "orders", Event{Data: "text"}))
+	created := c.next()
+	assert.Equal(t, []string{"event: created", `data: {"id":7}`}, created[1:])
+	assert.Equal(t, []string{"data: text"}, c.next()[1:])
+	require.Len(t, watched, 2)
+	assert.Equal(t, "text", watched[1].Data)
+
+	// IDs are kept, so the client can resume on the other instance
+	assert.Equal(t, strings.TrimPrefix(created[0], "id: "), here.histories["orders"][0].ID)
+}
+
+func TestDrain(t *testing.T) {
+	hub := NewHub(config.SSEConfig{Retry: 2 * time.Second}, nil)
+	server := httptest.NewServer(hub.Handler("orders"))
+	t.Cleanup(server.Close)
+
+	c := connect(t, server.URL, "")
+	c.next()
+	wait(t, hub, "orders")
+
+	hub.Drain()
+	assert.Nil(t, c.next(), "the stream ends")
+
+	refused := connect(t, server.URL, "")
+	assert.Equal(t, http.StatusServiceUnavailable, refused.resp.StatusCode)
+	assert.Equal(t, "2", refused.resp.Header.Get("Retry-After"))
+}
@@ -0,0 +1,83 @@
+package startup
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/render"
+
+	"github.com/mrhoseah/dolphin/internal/health"
+)
+
+// Handler serves the application once it is ready. Until then liveness
+// passes, so an orchestrator doesn't restart the process, while readiness
+// and every other request get 503.
+type Handler struct {
+	waiter     *Waiter
+	app        atomic.Pointer[http.Handler]
+	retryAfter int
+}
+
+// Handler returns a handler that holds requests off until Ready is called
+func (w *Waiter) Handler() *Handler {
+	retryAfter := int(w.config.Backoff.Seconds())
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	return &Handler{waiter: w, retryAfter: retryAfter}
+}
+
+// Ready swaps in the application
+func (h *Handler) Ready(app http.Handler) {
+	h.app.Store(&app)
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if app := h.app.Load(); app != nil {
+		(*app).ServeHTTP(w, r)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	switch r.URL.Path {
+	case "/health/live":
+		render.JSON(w, r, health.HealthResponse{Status: health.StatusHealthy, Timestamp: time.Now()})
+	case "/health", "/health/ready":
+		render.Status(r, http.StatusServiceUnavailable)
+		render.JSON(w, r, h.response())
+	default:
+		w.Header().Set("Retry-After", strconv.Itoa(h.retryAfter))
+		http.Error(w, "Service starting, dependencies unavailable", http.StatusServiceUnavailable)
+	}
+}
+
+// response reports each dependency as a health check
+func (h *Handler) response() health.HealthResponse {
+	now := time.Now()
+	response := health.HealthResponse{
+		Status:    health.StatusUnhealthy,
+		Timestamp: now,
+		Checks:    map[string]health.HealthStatus{},
+	}
+	for _, status := range h.waiter.Statuses() {
+		check := health.HealthStatus{
+			Name:      status.Name,
+			Status:    health.StatusHealthy,
+			Details:   map[string]interface{}{"attempts": status.Attempts},
+			Timestamp: now,
+		}
+		if status.State != StateReady {
+			check.Status = health.StatusUnhealthy
+			check.Message = "waiting"
+			if status.LastError != "" {
+				check.Message = fmt.Sprintf("waiting: %s", status.LastError)
+			}
+		}
+		response.Checks[status.Name] = check
+	}
+	return response
+}
@@ -0,0 +1,223 @@
+package startup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/database"
+)
+
+// Startup policies
+const (
+	// PolicyFail exits on the first failed connection
+	PolicyFail = "fail"
+	// PolicyWait retries connections before the server starts listening
+	PolicyWait = "wait"
+	// PolicyDegraded listens straight away, reporting not-ready while it
+	// retries
+	PolicyDegraded = "degraded"
+)
+
+// Dependency states
+const (
+	StateWaiting = "waiting"
+	StateReady   = "ready"
+)
+
+// Dependency is something the application needs before it can serve
+type Dependency struct {
+	Name string
+
+	// Connect makes one connection attempt
+	Connect func(ctx context.Context) error
+}
+
+// DependencyStatus is how connecting to a dependency is going
+type DependencyStatus struct {
+	Name      string    `json:"name"`
+	State     string    `json:"state"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error,omitempty"`
+	ReadyAt   time.Time `json:"ready_at,omitempty"`
+}
+
+// Waiter connects to dependencies under the configured startup policy
+type Waiter struct {
+	config config.StartupConfig
+	logger *zap.Logger
+
+	mu       sync.RWMutex
+	statuses []*DependencyStatus
+}
+
+// New creates a waiter, rejecting an unknown policy
+func New(cfg config.StartupConfig, logger *zap.Logger) (*Waiter, error) {
+	switch cfg.Policy {
+	case "":
+		cfg.Policy = PolicyWait
+	case PolicyFail, PolicyWait, PolicyDegraded:
+	default:
+		return nil, fmt.Errorf("unknown startup policy %q (use fail, wait or degraded)", cfg.Policy)
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = 500 * time.Millisecond
+	}
+	if cfg.MaxBackoff < cfg.Backoff {
+		cfg.MaxBackoff = cfg.Backoff
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &Waiter{config: cfg, logger: logger}, nil
+}
+
+// Degraded reports whether the server should listen before dependencies
+// are connected
+func (w *Waiter) Degraded() bool {
+	return w.config.Policy == PolicyDegraded
+}
+
+// Statuses returns the state of every dependency waited on so far
+func (w *Waiter) Statuses() []DependencyStatus {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	statuses := make([]DependencyStatus, len(w.statuses))
+	for i, status := range w.statuses {
+		statuses[i] = *status
+	}
+	return statuses
+}
+
+// Ready reports whether every dependency waited on has connected
+func (w *Waiter) Ready() bool {
+	for _, status := range w.Statuses() {
+		if status.State != StateReady {
+			return false
+		}
+	}
+	return true
+}
+
+// Wait connects to each dependency in turn. Failed attempts are retried
+// with exponential backoff until the timeout passes or ctx is done, except
+// under the fail policy where the first failure is returned.
+func (w *Waiter) Wait(ctx context.Context, deps ...Dependency) error {
+	if w.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.config.Timeout)
+		defer cancel()
+	}
+
+	w.mu.Lock()
+	statuses := make([]*DependencyStatus, len(deps))
+	for i, dep := range deps {
+		statuses[i] = &DependencyStatus{Name: dep.Name, State: StateWaiting}
+	}
+	w.statuses = append(w.statuses, statuses...)
+	w.mu.Unlock()
+
+	for i, dep := range deps {
+		if err := w.connect(ctx, dep, statuses[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// connect retries one dependency until it connects
+func (w *Waiter) connect(ctx context.Context, dep Dependency, status *DependencyStatus) error {
+	backoff := w.config.Backoff
+	for {
+		err := dep.Connect(ctx)
+
+		w.mu.Lock()
+		status.Attempts++
+		attempts := status.Attempts
+		if err == nil {
+			status.State = StateReady
+			status.LastError = ""
+			status.ReadyAt = time.Now()
+		} else {
+			status.LastError = err.Error()
+		}
+		w.mu.Unlock()
+
+		if err == nil {
+			if attempts > 1 {
+				w.logger.Info("Connected to "+dep.Name, zap.Int("attempts", attempts))
+			}
+			return nil
+		}
+		if w.config.Policy == PolicyFail {
+			return fmt.Errorf("%s: %w", dep.Name, err)
+		}
+
+		// Jitter keeps replicas started together from retrying in step
+		delay := backoff/2 + rand.N(backoff)
+		w.logger.Warn("Waiting for "+dep.Name,
+			zap.Int("attempt", attempts), zap.Duration("retry_in", delay), zap.Error(err))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return fmt.Errorf("%s still unavailable after %s and %d attempts: %w", dep.Name, w.config.Timeout, attempts, err)
+			}
+			return ctx.Err()
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, w.config.MaxBackoff)
+	}
+}
+
+// Connect waits for the database, and Redis when startup.redis is set and
+// the cache uses it, returning the connected database
+func (w *Waiter) Connect(ctx context.Context, cfg *config.Config) (*database.Manager, error) {
+	var db *database.Manager
+	deps := []Dependency{{
+		Name: "database",
+		Connect: func(ctx context.Context) error {
+			manager, err := database.New(&cfg.Database)
+			if err != nil {
+				return err
+			}
+			db = manager
+			return nil
+		},
+	}}
+	if cfg.Startup.Redis && cfg.Cache.Driver == "redis" {
+		deps = append(deps, Redis(cfg.Cache))
+	}
+
+	if err := w.Wait(ctx, deps...); err != nil {
+		if db != nil {
+			db.Close()
+		}
+		return nil, err
+	}
+	return db, nil
+}
+
+// Redis is a dependency on the cache's Redis server
+func Redis(cfg config.CacheConfig) Dependency {
+	return Dependency{
+		Name: "redis",
+		Connect: func(ctx context.Context) error {
+			client := redis.NewClient(&redis.Options{
+				Addr: fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+				DB:   cfg.DB,
+			})
+			defer client.Close()
+			return client.Ping(ctx).Err()
+		},
+	}
+}
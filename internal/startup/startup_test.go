@@ -0,0 +1,140 @@
+package startup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/health"
+)
+
+func newWaiter(t *testing.T, policy string, timeout time.Duration) *Waiter {
+	w, err := New(config.StartupConfig{
+		Policy:     policy,
+		Timeout:    timeout,
+		Backoff:    time.Millisecond,
+		MaxBackoff: 4 * time.Millisecond,
+	}, nil)
+	require.NoError(t, err)
+	return w
+}
+
+// flaky fails until its attempt number reaches succeedOn
+func flaky(name string, succeedOn int) Dependency {
+	attempts := 0
+	return Dependency{Name: name, Connect: func(ctx context.Context) error {
+		attempts++
+		if attempts < succeedOn {
+			return errors.New("connection refused")
+		}
+		return nil
+	}}
+}
+
+func TestNewRejectsUnknownPolicy(t *testing.T) {
+	_, err := New(config.StartupConfig{Policy: "hope"}, nil)
+	assert.ErrorContains(t, err, "unknown startup policy")
+
+	w, err := New(config.StartupConfig{}, nil)
+	require.NoError(t, err)
+	assert.False(t, w.Degraded())
+}
+
+func TestWaitRetriesUntilConnected(t *testing.T) {
+	w := newWaiter(t, PolicyWait, time.Second)
+
+	require.NoError(t, w.Wait(context.Background(), flaky("database", 3), flaky("redis", 1)))
+	assert.True(t, w.Ready())
+
+	statuses := w.Statuses()
+	require.Len(t, statuses, 2)
+	assert.Equal(t, "database", statuses[0].Name)
+	assert.Equal(t, StateReady, statuses[0].State)
+	assert.Equal(t, 3, statuses[0].Attempts)
+	assert.Empty(t, statuses[0].LastError)
+	assert.Equal(t, 1, statuses[1].Attempts)
+}
+
+func TestWaitGivesUpAtTimeout(t *testing.T) {
+	w := newWaiter(t, PolicyWait, 20*time.Millisecond)
+
+	err := w.Wait(context.Background(), flaky("database", 1000))
+	assert.ErrorContains(t, err, "database still unavailable after 20ms")
+	assert.ErrorContains(t, err, "connection refused")
+	assert.False(t, w.Ready())
+	assert.Greater(t, w.Statuses()[0].Attempts, 1)
+}
+
+func TestFailPolicyStopsAtFirstFailure(t *testing.T) {
+	w := newWaiter(t, PolicyFail, time.Second)
+
+	err := w.Wait(context.Background(), flaky("database", 2))
+	assert.EqualError(t, err, "database: connection refused")
+	assert.Equal(t, 1, w.Statuses()[0].Attempts)
+}
+
+func TestWaitStopsWhenCanceled(t *testing.T) {
+	w := newWaiter(t, PolicyDegraded, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	assert.ErrorIs(t, w.Wait(ctx, flaky("database", 1000)), context.Canceled)
+}
+
+func TestConnectDatabase(t *testing.T) {
+	w := newWaiter(t, PolicyWait, time.Second)
+	cfg := &config.Config{
+		Database: config.DatabaseConfig{Driver: "sqlite", Database: filepath.Join(t.TempDir(), "app.db")},
+		// Redis is only waited for when asked to
+		Cache: config.CacheConfig{Driver: "redis", Host: "127.0.0.1", Port: 1},
+	}
+
+	db, err := w.Connect(context.Background(), cfg)
+	require.NoError(t, err)
+	defer db.Close()
+	assert.Len(t, w.Statuses(), 1)
+
+	cfg.Database.Driver = "oracle"
+	_, err = newWaiter(t, PolicyFail, time.Second).Connect(context.Background(), cfg)
+	assert.ErrorContains(t, err, "unsupported database driver")
+}
+
+func TestHandlerBeforeAndAfterReady(t *testing.T) {
+	w := newWaiter(t, PolicyDegraded, 0)
+	w.statuses = []*DependencyStatus{{Name: "database", State: StateWaiting, Attempts: 2, LastError: "connection refused"}}
+	h := w.Handler()
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	assert.Equal(t, http.StatusOK, serve("/health/live").Code)
+
+	rec := serve("/health/ready")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	var response health.HealthResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, health.StatusUnhealthy, response.Status)
+	assert.Equal(t, "waiting: connection refused", response.Checks["database"].Message)
+
+	rec = serve("/api/users")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+
+	h.Ready(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	assert.Equal(t, http.StatusTeapot, serve("/health/ready").Code)
+	assert.Equal(t, http.StatusTeapot, serve("/api/users").Code)
+}
@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+// NewDriver creates the driver a disk is configured with
+func NewDriver(disk config.DiskConfig) (Driver, error) {
+	switch disk.Driver {
+	case "local":
+		return NewLocalDriver(disk.Options["root"], disk.Options["base_url"]), nil
+	case "s3":
+		return NewS3Driver(disk.Options["bucket"], disk.Options["region"], disk.Options["base_url"], disk.Options["endpoint"]), nil
+	default:
+		return nil, fmt.Errorf("storage: unknown driver %q", disk.Driver)
+	}
+}
+
+// Disk creates the driver of the named disk, or of the default disk when
+// name is empty
+func Disk(cfg *config.StorageConfig, name string) (Driver, error) {
+	if name == "" {
+		name = cfg.Default
+	}
+	disk, ok := cfg.Disks[name]
+	if !ok {
+		return nil, fmt.Errorf("storage: no disk named %q", name)
+	}
+	driver, err := NewDriver(disk)
+	if err != nil {
+		return nil, fmt.Errorf("disk %s: %w", name, err)
+	}
+	return driver, nil
+}
+
+// DiskNames returns the names of the configured disks, sorted
+func DiskNames(cfg *config.StorageConfig) []string {
+	names := make([]string, 0, len(cfg.Disks))
+	for name := range cfg.Disks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
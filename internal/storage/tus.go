@@ -0,0 +1,650 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+// TusVersion is the version of the tus resumable upload protocol served
+const TusVersion = "1.0.0"
+
+// tusExtensions are the protocol extensions served
+const tusExtensions = "creation,creation-with-upload,expiration,termination"
+
+// offsetStream is the content type chunks are sent as
+const offsetStream = "application/offset+octet-stream"
+
+// ErrUploadNotFound is returned for uploads that don't exist or have
+// expired
+var ErrUploadNotFound = errors.New("storage: upload not found")
+
+// ErrUploadRejected is wrapped by the errors of OnStored checks refusing
+// an upload's content, such as malware scans
+var ErrUploadRejected = errors.New("storage: upload rejected")
+
+// errUploadTooLarge is returned for chunks going past the upload's length
+var errUploadTooLarge = errors.New("storage: chunk goes past the upload length")
+
+// uploadID matches the IDs given to uploads, so they are safe file names
+var uploadID = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// Upload is a resumable upload
+type Upload struct {
+	ID string `json:"id"`
+
+	// Size is the upload's length and Offset how much of it has arrived
+	Size   int64 `json:"size"`
+	Offset int64 `json:"offset"`
+
+	// Metadata is what the client sent about the file, such as filename
+	// and filetype. It is for display only and may say anything.
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// Path is where the completed upload is stored on the server's disk
+	Path string `json:"path,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Complete reports whether every chunk has arrived and the upload is
+// stored
+func (u *Upload) Complete() bool {
+	return u.Path != ""
+}
+
+// Progress is the fraction of the upload that has arrived, from 0 to 1
+func (u *Upload) Progress() float64 {
+	if u.Size == 0 {
+		return 1
+	}
+	return float64(u.Offset) / float64(u.Size)
+}
+
+// TusServer accepts resumable uploads over the tus protocol. Chunks are
+// appended to a file in a local directory, so an upload survives restarts
+// and dropped connections; once complete, it is stored on a disk.
+type TusServer struct {
+	disk    Driver
+	dir     string
+	prefix  string
+	path    string
+	maxSize int64
+	expiry  time.Duration
+	logger  *zap.Logger
+	now     func() time.Time
+
+	onCreate   func(r *http.Request, u *Upload) error
+	onStored   func(ctx context.Context, u *Upload) error
+	onComplete func(ctx context.Context, u *Upload) error
+
+	// locks holds a mutex per upload, so only one request writes to it
+	locks sync.Map
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// TusDisk creates the driver completed uploads are stored on: the storage
+// disk named by tus.disk, or the local disk at tus.root
+func TusDisk(cfg *config.Config) (Driver, error) {
+	if cfg.Tus.Disk == "" {
+		return NewLocalDriver(cfg.Tus.Root, ""), nil
+	}
+	return Disk(&cfg.Storage, cfg.Tus.Disk)
+}
+
+// NewTusServer creates a tus server from the tus config, storing completed
+// uploads on disk
+func NewTusServer(disk Driver, cfg config.TusConfig, logger *zap.Logger) (*TusServer, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("storage: creating the upload directory: %w", err)
+	}
+	return &TusServer{
+		disk:    disk,
+		dir:     cfg.Dir,
+		prefix:  cfg.Prefix,
+		path:    cfg.Path,
+		maxSize: cfg.MaxSize,
+		expiry:  cfg.Expiry,
+		logger:  logger,
+		now:     time.Now,
+		stop:    make(chan struct{}),
+	}, nil
+}
+
+// OnCreate has fn check each upload before it is created, e.g. that the
+// user is signed in or that the metadata names an accepted file type. An
+// error refuses the upload with 403 and the error's message.
+func (s *TusServer) OnCreate(fn func(r *http.Request, u *Upload) error) {
+	s.onCreate = fn
+}
+
+// OnStored has fn check each upload once stored, before OnComplete, such
+// as scanning it for malware. An error wrapping ErrUploadRejected refuses
+// the upload with 422 and forgets it, leaving fn to deal with the stored
+// file; other errors are answered with 500.
+func (s *TusServer) OnStored(fn func(ctx context.Context, u *Upload) error) {
+	s.onStored = fn
+}
+
+// OnComplete has fn process each upload once stored, e.g. moving it to
+// where the application keeps such files. Errors are logged and answered
+// with 500; the upload stays stored.
+func (s *TusServer) OnComplete(fn func(ctx context.Context, u *Upload) error) {
+	s.onComplete = fn
+}
+
+// Routes registers the tus endpoints: OPTIONS and POST / to discover the
+// server and create uploads, HEAD, PATCH and DELETE /{id} to resume, send
+// chunks and cancel, and GET /client.js serving the JavaScript client
+func (s *TusServer) Routes(r chi.Router) {
+	r.Get("/client.js", ServeTusClient)
+	r.HandleFunc("/", s.serveUploads)
+	r.HandleFunc("/{id}", s.serveUpload)
+}
+
+// Get returns an upload by its ID or URL, as the client was given
+func (s *TusServer) Get(id string) (*Upload, error) {
+	id = path.Base(id)
+	if !uploadID.MatchString(id) {
+		return nil, ErrUploadNotFound
+	}
+	data, err := os.ReadFile(s.infoPath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrUploadNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	var u Upload
+	if err := json.Unmarshal(data, &u); err != nil {
+		return nil, fmt.Errorf("storage: reading upload %s: %w", id, err)
+	}
+	if !u.Complete() {
+		// The chunks' file is what has arrived, even if the process died
+		// before saving the offset
+		info, err := os.Stat(s.dataPath(id))
+		if err != nil {
+			return nil, fmt.Errorf("storage: reading upload %s: %w", id, err)
+		}
+		u.Offset = info.Size()
+	}
+	return &u, nil
+}
+
+// Delete removes an upload, with its stored file once complete
+func (s *TusServer) Delete(id string) error {
+	u, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+	if u.Complete() && s.disk.Exists(u.Path) {
+		if err := s.disk.Delete(u.Path); err != nil {
+			return err
+		}
+	}
+	return s.remove(u.ID)
+}
+
+// Cleanup removes the uploads that have expired, returning how many. The
+// stored files of completed uploads are kept.
+func (s *TusServer) Cleanup() (int, error) {
+	infos, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	var errs []error
+	for _, info := range infos {
+		id := strings.TrimSuffix(filepath.Base(info), ".json")
+		lock := s.lock(id)
+		if !lock.TryLock() {
+			// A chunk is arriving, so it hasn't expired
+			continue
+		}
+		u, err := s.Get(id)
+		if err == nil && s.now().After(u.ExpiresAt) {
+			err = s.remove(id)
+			if err == nil {
+				removed++
+			}
+		}
+		lock.Unlock()
+		if err != nil && !errors.Is(err, ErrUploadNotFound) {
+			errs = append(errs, err)
+		}
+	}
+	return removed, errors.Join(errs...)
+}
+
+// Start removes expired uploads every interval until Close is called
+func (s *TusServer) Start(interval time.Duration) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if removed, err := s.Cleanup(); err != nil {
+					s.logger.Warn("Failed to remove expired uploads", zap.Error(err))
+				} else if removed > 0 {
+					s.logger.Info("Removed expired uploads", zap.Int("count", removed))
+				}
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops removing expired uploads
+func (s *TusServer) Close() {
+	s.stopOnce.Do(func() { close(s.stop) })
+	s.wg.Wait()
+}
+
+// serveUploads answers OPTIONS and creates uploads
+func (s *TusServer) serveUploads(w http.ResponseWriter, r *http.Request) {
+	method, ok := s.begin(w, r)
+	if !ok {
+		return
+	}
+	switch method {
+	case http.MethodOptions:
+		s.options(w)
+	case http.MethodPost:
+		s.create(w, r)
+	default:
+		w.Header().Set("Allow", "OPTIONS, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// serveUpload reports, continues and cancels an upload
+func (s *TusServer) serveUpload(w http.ResponseWriter, r *http.Request) {
+	method, ok := s.begin(w, r)
+	if !ok {
+		return
+	}
+	id := chi.URLParam(r, "id")
+	switch method {
+	case http.MethodOptions:
+		s.options(w)
+	case http.MethodHead:
+		s.head(w, id)
+	case http.MethodPatch:
+		s.patch(w, r, id)
+	case http.MethodDelete:
+		s.terminate(w, id)
+	default:
+		w.Header().Set("Allow", "OPTIONS, HEAD, PATCH, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// begin returns the request's method, as overridden for clients that can
+// only send GET and POST, after checking it speaks the protocol version
+// served
+func (s *TusServer) begin(w http.ResponseWriter, r *http.Request) (string, bool) {
+	w.Header().Set("Tus-Resumable", TusVersion)
+	method := r.Method
+	if override := r.Header.Get("X-HTTP-Method-Override"); override != "" && r.Method == http.MethodPost {
+		method = strings.ToUpper(override)
+	}
+	if method != http.MethodOptions && r.Header.Get("Tus-Resumable") != TusVersion {
+		w.Header().Set("Tus-Version", TusVersion)
+		http.Error(w, "unsupported tus version", http.StatusPreconditionFailed)
+		return "", false
+	}
+	return method, true
+}
+
+func (s *TusServer) options(w http.ResponseWriter) {
+	w.Header().Set("Tus-Version", TusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	if s.maxSize > 0 {
+		w.Header().Set("Tus-Max-Size", strconv.FormatInt(s.maxSize, 10))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *TusServer) create(w http.ResponseWriter, r *http.Request) {
+	size, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || size < 0 {
+		http.Error(w, "Upload-Length must be the upload's size in bytes", http.StatusBadRequest)
+		return
+	}
+	if s.maxSize > 0 && size > s.maxSize {
+		http.Error(w, fmt.Sprintf("uploads may be up to %d bytes", s.maxSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+	metadata, err := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	id, err := newUploadID()
+	if err != nil {
+		s.fail(w, "", err)
+		return
+	}
+
+	now := s.now()
+	u := &Upload{ID: id, Size: size, Metadata: metadata, CreatedAt: now, ExpiresAt: now.Add(s.expiry)}
+	if s.onCreate != nil {
+		if err := s.onCreate(r, u); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+
+	lock := s.lock(id)
+	lock.Lock()
+	defer lock.Unlock()
+	if err := os.WriteFile(s.dataPath(id), nil, 0644); err != nil {
+		s.fail(w, id, err)
+		return
+	}
+	if err := s.save(u); err != nil {
+		s.fail(w, id, err)
+		return
+	}
+
+	w.Header().Set("Location", strings.TrimSuffix(r.URL.Path, "/")+"/"+id)
+	// The first chunk may come with the request creating the upload
+	if r.Header.Get("Content-Type") == offsetStream || size == 0 {
+		if !s.write(w, r, u) {
+			return
+		}
+		w.Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	}
+	w.Header().Set("Upload-Expires", u.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *TusServer) head(w http.ResponseWriter, id string) {
+	u, ok := s.find(w, id)
+	if !ok {
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(u.Size, 10))
+	w.Header().Set("Upload-Expires", u.ExpiresAt.UTC().Format(http.TimeFormat))
+	if len(u.Metadata) > 0 {
+		w.Header().Set("Upload-Metadata", formatUploadMetadata(u.Metadata))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *TusServer) patch(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Header.Get("Content-Type") != offsetStream {
+		http.Error(w, "chunks must be sent as "+offsetStream, http.StatusUnsupportedMediaType)
+		return
+	}
+	lock := s.lock(id)
+	if !lock.TryLock() {
+		http.Error(w, "the upload is being written by another request", http.StatusLocked)
+		return
+	}
+	defer lock.Unlock()
+
+	u, ok := s.find(w, id)
+	if !ok {
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		http.Error(w, "Upload-Offset must be where the chunk starts", http.StatusBadRequest)
+		return
+	}
+	if offset != u.Offset {
+		http.Error(w, fmt.Sprintf("the upload is at offset %d", u.Offset), http.StatusConflict)
+		return
+	}
+	if !s.write(w, r, u) {
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	w.Header().Set("Upload-Expires", u.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *TusServer) terminate(w http.ResponseWriter, id string) {
+	lock := s.lock(id)
+	if !lock.TryLock() {
+		http.Error(w, "the upload is being written by another request", http.StatusLocked)
+		return
+	}
+	defer lock.Unlock()
+
+	if _, ok := s.find(w, id); !ok {
+		return
+	}
+	if err := s.Delete(id); err != nil {
+		s.fail(w, id, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// find loads an upload, answering 404 for unknown uploads and 410 for
+// those that expired but haven't been removed yet
+func (s *TusServer) find(w http.ResponseWriter, id string) (*Upload, bool) {
+	u, err := s.Get(id)
+	if errors.Is(err, ErrUploadNotFound) {
+		http.Error(w, "upload not found", http.StatusNotFound)
+		return nil, false
+	} else if err != nil {
+		s.fail(w, id, err)
+		return nil, false
+	}
+	if s.now().After(u.ExpiresAt) {
+		http.Error(w, "upload expired", http.StatusGone)
+		return nil, false
+	}
+	return u, true
+}
+
+// write appends the request body to an upload, storing it once complete.
+// Bytes that arrive before a connection drops are kept, so the client can
+// resume from them. It answers the request itself when it fails.
+func (s *TusServer) write(w http.ResponseWriter, r *http.Request, u *Upload) bool {
+	written, err := s.append(u, r.Body)
+	u.Offset += written
+	u.ExpiresAt = s.now().Add(s.expiry)
+	if saveErr := s.save(u); saveErr != nil && err == nil {
+		err = saveErr
+	}
+	switch {
+	case errors.Is(err, errUploadTooLarge):
+		http.Error(w, fmt.Sprintf("the upload is %d bytes long", u.Size), http.StatusRequestEntityTooLarge)
+		return false
+	case err != nil:
+		s.fail(w, u.ID, err)
+		return false
+	}
+
+	if u.Offset == u.Size && !u.Complete() {
+		err := s.complete(r.Context(), u)
+		if errors.Is(err, ErrUploadRejected) {
+			s.logger.Warn("Upload rejected", zap.String("upload", u.ID), zap.Error(err))
+			if err := s.remove(u.ID); err != nil {
+				s.logger.Warn("Failed to remove a rejected upload", zap.String("upload", u.ID), zap.Error(err))
+			}
+			http.Error(w, "the upload was rejected", http.StatusUnprocessableEntity)
+			return false
+		}
+		if err != nil {
+			s.fail(w, u.ID, err)
+			return false
+		}
+	}
+	return true
+}
+
+// append copies body to the end of an upload's chunks, up to its length
+func (s *TusServer) append(u *Upload, body io.Reader) (int64, error) {
+	if u.Complete() {
+		return 0, nil
+	}
+	f, err := os.OpenFile(s.dataPath(u.ID), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	remaining := u.Size - u.Offset
+	written, err := io.Copy(f, io.LimitReader(body, remaining+1))
+	if written > remaining {
+		// The whole chunk is refused rather than cut short
+		if err := f.Truncate(u.Offset); err != nil {
+			return 0, err
+		}
+		return 0, errUploadTooLarge
+	}
+	return written, err
+}
+
+// complete stores an upload on the disk and hands it to OnStored and
+// OnComplete
+func (s *TusServer) complete(ctx context.Context, u *Upload) error {
+	f, err := os.Open(s.dataPath(u.ID))
+	if err != nil {
+		return err
+	}
+	stored := path.Join(s.prefix, u.ID)
+	err = s.disk.Put(stored, f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("storage: storing upload %s: %w", u.ID, err)
+	}
+
+	u.Path = stored
+	if err := s.save(u); err != nil {
+		return err
+	}
+	if err := os.Remove(s.dataPath(u.ID)); err != nil {
+		s.logger.Warn("Failed to remove an upload's chunks", zap.String("upload", u.ID), zap.Error(err))
+	}
+	if s.onStored != nil {
+		if err := s.onStored(ctx, u); err != nil {
+			return err
+		}
+	}
+	if s.onComplete != nil {
+		return s.onComplete(ctx, u)
+	}
+	return nil
+}
+
+// save writes an upload's info, replacing the previous in one step
+func (s *TusServer) save(u *Upload) error {
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	tmp := s.infoPath(u.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.infoPath(u.ID))
+}
+
+// remove deletes an upload's chunks and info
+func (s *TusServer) remove(id string) error {
+	if err := os.Remove(s.dataPath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := os.Remove(s.infoPath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	s.locks.Delete(id)
+	return nil
+}
+
+func (s *TusServer) lock(id string) *sync.Mutex {
+	lock, _ := s.locks.LoadOrStore(id, &sync.Mutex{})
+	return lock.(*sync.Mutex)
+}
+
+func (s *TusServer) fail(w http.ResponseWriter, id string, err error) {
+	s.logger.Error("Upload request failed", zap.String("upload", id), zap.Error(err))
+	http.Error(w, "the upload failed", http.StatusInternalServerError)
+}
+
+func (s *TusServer) dataPath(id string) string {
+	return filepath.Join(s.dir, id+".bin")
+}
+
+func (s *TusServer) infoPath(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+func newUploadID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// parseUploadMetadata reads the Upload-Metadata header: comma separated
+// keys, each followed by a space and its base64 value unless empty
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if key == "" || err != nil {
+			return nil, fmt.Errorf("Upload-Metadata has an invalid pair %q", pair)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+// formatUploadMetadata writes metadata as an Upload-Metadata header
+func formatUploadMetadata(metadata map[string]string) string {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key + " " + base64.StdEncoding.EncodeToString([]byte(metadata[key]))
+	}
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+// ServeTusClient serves the JavaScript tus client
+func ServeTusClient(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Write([]byte(TusClientJS))
+}
+
+// TemplateHelpers returns template functions for pages uploading to the
+// server:
+//
+//	{{tusScript}}   the script tag loading the client
+//	{{tusEndpoint}} the URL uploads are created at
+func (s *TusServer) TemplateHelpers() template.FuncMap {
+	endpoint := strings.TrimSuffix(s.path, "/")
+	return template.FuncMap{
+		"tusScript": func() template.HTML {
+			return template.HTML(`<script src="` + template.HTMLEscapeString(endpoint+"/client.js") + `" defer></script>`)
+		},
+		"tusEndpoint": func() string {
+			return endpoint
+		},
+	}
+}
+
+// TusClientJS uploads files in chunks, resuming where an upload stopped
+// after a dropped connection or a reload of the page:
+//
+//	DolphinTus.upload(file, {endpoint, chunkSize, metadata, onProgress})
+//
+// returns a promise of the upload's URL. File inputs with a
+// data-tus-upload attribute upload as soon as a file is picked, putting the
+// URL in the field named by data-tus-target and firing tus:progress,
+// tus:success and tus:error events.
+const TusClientJS = `(function () {
+    'use strict';
+
+    var script = document.currentScript;
+    var DEFAULT_ENDPOINT = script ? script.src.replace(/\/client\.js(\?.*)?$/, '') : '/tus';
+    var CHUNK_SIZE = 5 * 1024 * 1024;
+    var RETRY_DELAYS = [0, 1000, 3000, 5000];
+    var STORAGE_PREFIX = 'dolphin-tus:';
+
+    function request(method, url, headers, body, onProgress) {
+        return new Promise(function (resolve, reject) {
+            var xhr = new XMLHttpRequest();
+            xhr.open(method, url);
+            xhr.setRequestHeader('Tus-Resumable', '1.0.0');
+            Object.keys(headers || {}).forEach(function (name) {
+                xhr.setRequestHeader(name, headers[name]);
+            });
+            if (onProgress) {
+                xhr.upload.onprogress = function (event) { onProgress(event.loaded); };
+            }
+            xhr.onload = function () { resolve(xhr); };
+            xhr.onerror = function () { reject(new Error('tus: network error')); };
+            xhr.send(body || null);
+        });
+    }
+
+    function httpError(xhr) {
+        var error = new Error('tus: ' + (xhr.responseText || 'status ' + xhr.status).trim());
+        error.status = xhr.status;
+        // Conflicts, locks and server errors may pass, the rest won't
+        error.permanent = xhr.status < 500 && xhr.status !== 409 && xhr.status !== 423;
+        return error;
+    }
+
+    function encodeMetadata(metadata) {
+        return Object.keys(metadata).map(function (key) {
+            return key + ' ' + btoa(unescape(encodeURIComponent(String(metadata[key]))));
+        }).join(',');
+    }
+
+    function storage(method, key, value) {
+        try {
+            return window.localStorage[method](key, value);
+        } catch (error) {
+            return null;
+        }
+    }
+
+    function upload(file, options) {
+        options = options || {};
+        var endpoint = options.endpoint || DEFAULT_ENDPOINT;
+        var chunkSize = options.chunkSize || CHUNK_SIZE;
+        var metadata = Object.assign({ filename: file.name, filetype: file.type }, options.metadata || {});
+        var fingerprint = STORAGE_PREFIX + endpoint + ':' + [file.name, file.type, file.size, file.lastModified].join(':');
+
+        function progress(sent) {
+            if (options.onProgress) options.onProgress(Math.min(sent, file.size), file.size);
+        }
+
+        function create() {
+            var headers = { 'Upload-Length': String(file.size), 'Upload-Metadata': encodeMetadata(metadata) };
+            return request('POST', endpoint, headers).then(function (xhr) {
+                if (xhr.status !== 201) throw httpError(xhr);
+                var url = new URL(xhr.getResponseHeader('Location'), window.location.href).href;
+                storage('setItem', fingerprint, url);
+                return { url: url, offset: 0 };
+            });
+        }
+
+        function offset(url) {
+            return request('HEAD', url).then(function (xhr) {
+                if (xhr.status !== 200) throw httpError(xhr);
+                return { url: url, offset: parseInt(xhr.getResponseHeader('Upload-Offset'), 10) };
+            });
+        }
+
+        function resume() {
+            var url = storage('getItem', fingerprint);
+            if (!url) return create();
+            return offset(url).catch(function () {
+                storage('removeItem', fingerprint);
+                return create();
+            });
+        }
+
+        function send(state, attempt) {
+            progress(state.offset);
+            if (state.offset >= file.size) {
+                storage('removeItem', fingerprint);
+                return state.url;
+            }
+            var end = Math.min(state.offset + chunkSize, file.size);
+            var headers = { 'Upload-Offset': String(state.offset), 'Content-Type': 'application/offset+octet-stream' };
+            return request('PATCH', state.url, headers, file.slice(state.offset, end), function (loaded) {
+                progress(state.offset + loaded);
+            }).then(function (xhr) {
+                if (xhr.status !== 204) throw httpError(xhr);
+                state.offset = parseInt(xhr.getResponseHeader('Upload-Offset'), 10);
+                return send(state, 0);
+            }).catch(function (error) {
+                if (error.permanent || attempt >= RETRY_DELAYS.length) throw error;
+                // Ask where the upload got to before sending again
+                return new Promise(function (resolve) {
+                    setTimeout(resolve, RETRY_DELAYS[attempt]);
+                }).then(function () {
+                    return offset(state.url);
+                }).then(function (resumed) {
+                    return send(resumed, attempt + 1);
+                }, function () {
+                    return send(state, attempt + 1);
+                });
+            });
+        }
+
+        return resume().then(function (state) { return send(state, 0); });
+    }
+
+    function emit(input, name, detail) {
+        input.dispatchEvent(new CustomEvent(name, { bubbles: true, detail: detail }));
+    }
+
+    function bind(input) {
+        if (input.dataset.tusBound) return;
+        input.dataset.tusBound = 'true';
+        input.addEventListener('change', function () {
+            var file = input.files && input.files[0];
+            if (!file) return;
+            var target = input.dataset.tusTarget && input.form ? input.form.elements[input.dataset.tusTarget] : null;
+            var bar = input.dataset.tusProgress ? document.getElementById(input.dataset.tusProgress) : null;
+            emit(input, 'tus:start', { file: file });
+            upload(file, {
+                endpoint: input.dataset.tusUpload || undefined,
+                chunkSize: parseInt(input.dataset.tusChunkSize, 10) || undefined,
+                onProgress: function (sent, total) {
+                    if (bar) {
+                        bar.max = total;
+                        bar.value = sent;
+                    }
+                    emit(input, 'tus:progress', { file: file, sent: sent, total: total });
+                }
+            }).then(function (url) {
+                if (target) target.value = url;
+                emit(input, 'tus:success', { file: file, url: url });
+            }).catch(function (error) {
+                emit(input, 'tus:error', { file: file, error: error });
+            });
+        });
+    }
+
+    function scan(root) {
+        root.querySelectorAll('input[type=file][data-tus-upload]').forEach(bind);
+    }
+
+    if (document.readyState === 'loading') {
+        document.addEventListener('DOMContentLoaded', function () { scan(document); });
+    } else {
+        scan(document);
+    }
+    // Inputs swapped in by htmx
+    document.addEventListener('htmx:load', function (event) { scan(event.target); });
+
+    window.DolphinTus = { upload: upload, bind: bind };
+})();
+`
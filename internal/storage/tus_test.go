@@ -0,0 +1,245 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+func newTestTusServer(t *testing.T) (*TusServer, *LocalDriver, http.Handler) {
+	dir := t.TempDir()
+	disk := NewLocalDriver(filepath.Join(dir, "app"), "")
+	s, err := NewTusServer(disk, config.TusConfig{
+		Path:    "/tus",
+		Dir:     filepath.Join(dir, "tus"),
+		Prefix:  "uploads",
+		MaxSize: 100,
+		Expiry:  time.Hour,
+	}, nil)
+	require.NoError(t, err)
+	r := chi.NewRouter()
+	r.Route("/tus", s.Routes)
+	return s, disk, r
+}
+
+func tusRequest(h http.Handler, method, path string, body io.Reader, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, body)
+	req.Header.Set("Tus-Resumable", TusVersion)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestTusUploadInChunks(t *testing.T) {
+	s, disk, h := newTestTusServer(t)
+	var completed *Upload
+	s.OnComplete(func(ctx context.Context, u *Upload) error {
+		completed = u
+		return nil
+	})
+
+	w := tusRequest(h, http.MethodOptions, "/tus", nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, tusExtensions, w.Header().Get("Tus-Extension"))
+	assert.Equal(t, "100", w.Header().Get("Tus-Max-Size"))
+
+	w = tusRequest(h, http.MethodPost, "/tus", nil, "Upload-Length", "101")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	// "hello.txt" and "text/plain"
+	w = tusRequest(h, http.MethodPost, "/tus", nil, "Upload-Length", "11", "Upload-Metadata", "filename aGVsbG8udHh0,filetype dGV4dC9wbGFpbg==")
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	location := w.Header().Get("Location")
+	require.True(t, strings.HasPrefix(location, "/tus/"), location)
+	assert.NotEmpty(t, w.Header().Get("Upload-Expires"))
+
+	w = tusRequest(h, http.MethodPatch, location, strings.NewReader("hello"), "Upload-Offset", "0", "Content-Type", offsetStream)
+	require.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+	assert.Equal(t, "5", w.Header().Get("Upload-Offset"))
+
+	halfway, err := s.Get(location)
+	require.NoError(t, err)
+	assert.InDelta(t, 5.0/11, halfway.Progress(), 1e-9)
+	assert.False(t, halfway.Complete())
+
+	// A client resuming asks where the upload got to
+	w = tusRequest(h, http.MethodHead, location, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "5", w.Header().Get("Upload-Offset"))
+	assert.Equal(t, "11", w.Header().Get("Upload-Length"))
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "filename aGVsbG8udHh0,filetype dGV4dC9wbGFpbg==", w.Header().Get("Upload-Metadata"))
+
+	w = tusRequest(h, http.MethodPatch, location, strings.NewReader("world"), "Upload-Offset", "3", "Content-Type", offsetStream)
+	assert.Equal(t, http.StatusConflict, w.Code, "the chunk must start at the offset")
+	w = tusRequest(h, http.MethodPatch, location, strings.NewReader(" world"), "Upload-Offset", "5")
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+	w = tusRequest(h, http.MethodPatch, location, strings.NewReader(" world!"), "Upload-Offset", "5", "Content-Type", offsetStream)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code, "past the upload length")
+	assert.Equal(t, "5", tusRequest(h, http.MethodHead, location, nil).Header().Get("Upload-Offset"))
+
+	w = tusRequest(h, http.MethodPatch, location, strings.NewReader(" world"), "Upload-Offset", "5", "Content-Type", offsetStream)
+	require.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+	assert.Equal(t, "11", w.Header().Get("Upload-Offset"))
+
+	require.NotNil(t, completed)
+	assert.True(t, completed.Complete())
+	assert.Equal(t, 1.0, completed.Progress())
+	assert.Equal(t, "hello.txt", completed.Metadata["filename"])
+	assert.Equal(t, "uploads/"+completed.ID, completed.Path)
+	u, err := s.Get(location)
+	require.NoError(t, err)
+	assert.Equal(t, completed.Path, u.Path)
+	content, err := disk.Get(u.Path)
+	require.NoError(t, err)
+	defer content.Close()
+	data, _ := io.ReadAll(content)
+	assert.Equal(t, "hello world", string(data))
+
+	w = tusRequest(h, http.MethodDelete, location, nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.False(t, disk.Exists(u.Path))
+	assert.Equal(t, http.StatusNotFound, tusRequest(h, http.MethodHead, location, nil).Code)
+}
+
+func TestTusProtocol(t *testing.T) {
+	s, _, h := newTestTusServer(t)
+	s.OnCreate(func(r *http.Request, u *Upload) error {
+		if u.Metadata["filetype"] == "application/x-msdownload" {
+			return errors.New("executables aren't accepted")
+		}
+		return nil
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/tus", nil)
+	req.Header.Set("Upload-Length", "5")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code, "no Tus-Resumable header")
+	assert.Equal(t, TusVersion, w.Header().Get("Tus-Version"))
+
+	w = tusRequest(h, http.MethodPost, "/tus", nil, "Upload-Length", "5", "Upload-Metadata", "filetype YXBwbGljYXRpb24veC1tc2Rvd25sb2Fk")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "executables aren't accepted")
+	w = tusRequest(h, http.MethodPost, "/tus", nil, "Upload-Metadata", "filename aGVsbG8udHh0")
+	assert.Equal(t, http.StatusBadRequest, w.Code, "no Upload-Length")
+	w = tusRequest(h, http.MethodPost, "/tus", nil, "Upload-Length", "5", "Upload-Metadata", "filename !!!")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// The whole upload in the request creating it, with PATCH overridden
+	w = tusRequest(h, http.MethodPost, "/tus", strings.NewReader("hello"), "Upload-Length", "5", "Content-Type", offsetStream)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "5", w.Header().Get("Upload-Offset"))
+	u, err := s.Get(w.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.True(t, u.Complete())
+
+	w = tusRequest(h, http.MethodPost, "/tus", nil, "Upload-Length", "5")
+	location := w.Header().Get("Location")
+	w = tusRequest(h, http.MethodPost, location, strings.NewReader("he"), "X-HTTP-Method-Override", "PATCH", "Upload-Offset", "0", "Content-Type", offsetStream)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Upload-Offset"))
+
+	assert.Equal(t, http.StatusNotFound, tusRequest(h, http.MethodHead, "/tus/../../etc/passwd", nil).Code)
+	assert.Equal(t, http.StatusNotFound, tusRequest(h, http.MethodHead, "/tus/0123456789abcdef0123456789abcdef", nil).Code)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/tus/client.js", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "window.DolphinTus")
+}
+
+func TestTusExpiry(t *testing.T) {
+	s, _, h := newTestTusServer(t)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	stale := tusRequest(h, http.MethodPost, "/tus", nil, "Upload-Length", "10").Header().Get("Location")
+	now = now.Add(30 * time.Minute)
+	active := tusRequest(h, http.MethodPost, "/tus", nil, "Upload-Length", "10").Header().Get("Location")
+	done := tusRequest(h, http.MethodPost, "/tus", strings.NewReader("hi"), "Upload-Length", "2", "Content-Type", offsetStream).Header().Get("Location")
+
+	// A chunk keeps an upload from expiring
+	now = now.Add(45 * time.Minute)
+	w := tusRequest(h, http.MethodPatch, active, strings.NewReader("0123"), "Upload-Offset", "0", "Content-Type", offsetStream)
+	require.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, http.StatusGone, tusRequest(h, http.MethodHead, stale, nil).Code)
+
+	removed, err := s.Cleanup()
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	assert.Equal(t, http.StatusNotFound, tusRequest(h, http.MethodHead, stale, nil).Code)
+	assert.Equal(t, http.StatusOK, tusRequest(h, http.MethodHead, active, nil).Code)
+
+	now = now.Add(2 * time.Hour)
+	removed, err = s.Cleanup()
+	require.NoError(t, err)
+	assert.Equal(t, 2, removed)
+	entries, err := os.ReadDir(s.dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+	_, err = s.Get(done)
+	assert.ErrorIs(t, err, ErrUploadNotFound)
+}
+
+func TestTusDisk(t *testing.T) {
+	cfg := &config.Config{
+		Tus: config.TusConfig{Root: "storage/app"},
+		Storage: config.StorageConfig{Disks: map[string]config.DiskConfig{
+			"s3": {Driver: "s3", Options: map[string]string{"bucket": "videos"}},
+		}},
+	}
+	disk, err := TusDisk(cfg)
+	require.NoError(t, err)
+	assert.IsType(t, &LocalDriver{}, disk)
+
+	cfg.Tus.Disk = "s3"
+	disk, err = TusDisk(cfg)
+	require.NoError(t, err)
+	assert.IsType(t, &S3Driver{}, disk)
+
+	cfg.Tus.Disk = "missing"
+	_, err = TusDisk(cfg)
+	assert.Error(t, err)
+}
+
+func TestTusOnStoredRejects(t *testing.T) {
+	s, disk, h := newTestTusServer(t)
+	completed := false
+	s.OnStored(func(ctx context.Context, u *Upload) error {
+		if err := disk.Delete(u.Path); err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: infected", ErrUploadRejected)
+	})
+	s.OnComplete(func(ctx context.Context, u *Upload) error {
+		completed = true
+		return nil
+	})
+
+	w := tusRequest(h, http.MethodPost, "/tus", nil, "Upload-Length", "5")
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	location := w.Header().Get("Location")
+
+	w = tusRequest(h, http.MethodPatch, location, strings.NewReader("hello"), "Upload-Offset", "0", "Content-Type", offsetStream)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code, w.Body.String())
+	assert.False(t, completed)
+	assert.Equal(t, http.StatusNotFound, tusRequest(h, http.MethodHead, location, nil).Code, "the rejected upload is forgotten")
+}
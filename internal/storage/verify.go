@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// VerifyDir is where Verify writes its test files on a disk
+const VerifyDir = ".dolphin-verify"
+
+// VerifyOptions configures Verify
+type VerifyOptions struct {
+	// Rounds is how many files are written, read and deleted, 10 by
+	// default
+	Rounds int
+
+	// Size is the size of each file in bytes, 64KB by default
+	Size int
+}
+
+// Latency summarizes how long an operation took over the rounds
+type Latency struct {
+	P50 time.Duration `json:"p50"`
+	P95 time.Duration `json:"p95"`
+	P99 time.Duration `json:"p99"`
+	Max time.Duration `json:"max"`
+}
+
+// VerifyReport is what Verify found on a disk
+type VerifyReport struct {
+	Rounds int `json:"rounds"`
+	Size   int `json:"size"`
+
+	// Put, Get and Delete are the latencies of the rounds that got that far
+	Put    Latency `json:"put"`
+	Get    Latency `json:"get"`
+	Delete Latency `json:"delete"`
+
+	// Step names what failed, such as "connect" when the first write did,
+	// or "checksum" when a file read back differs; empty when all passed
+	Step  string `json:"step,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// OK reports whether every round passed
+func (r *VerifyReport) OK() bool {
+	return r.Step == ""
+}
+
+// Verify checks a disk end to end: each round writes a file of random
+// bytes, checks it exists with the size written, reads it back comparing
+// SHA-256 checksums, deletes it and checks it is gone. It stops at the
+// first failure or when ctx is done.
+func Verify(ctx context.Context, driver Driver, opts VerifyOptions) *VerifyReport {
+	if opts.Rounds <= 0 {
+		opts.Rounds = 10
+	}
+	if opts.Size <= 0 {
+		opts.Size = 64 << 10
+	}
+	report := &VerifyReport{Size: opts.Size}
+	var puts, gets, deletes []time.Duration
+	defer func() {
+		report.Put, report.Get, report.Delete = latency(puts), latency(gets), latency(deletes)
+	}()
+	fail := func(step string, err error) *VerifyReport {
+		report.Step, report.Error = step, err.Error()
+		return report
+	}
+
+	content := make([]byte, opts.Size)
+	for round := 0; round < opts.Rounds; round++ {
+		if err := ctx.Err(); err != nil {
+			return fail("timeout", err)
+		}
+		if _, err := rand.Read(content); err != nil {
+			return fail("put", err)
+		}
+		want := sha256.Sum256(content)
+		path := VerifyDir + "/" + uuid.NewString()
+
+		start := time.Now()
+		if err := driver.Put(path, bytes.NewReader(content)); err != nil {
+			if round == 0 {
+				return fail("connect", err)
+			}
+			return fail("put", err)
+		}
+		puts = append(puts, time.Since(start))
+
+		if !driver.Exists(path) {
+			return fail("exists", fmt.Errorf("%s is missing after being written", path))
+		}
+		if size, err := driver.Size(path); err != nil {
+			return fail("size", err)
+		} else if size != int64(opts.Size) {
+			return fail("size", fmt.Errorf("%s is %d bytes, %d were written", path, size, opts.Size))
+		}
+
+		start = time.Now()
+		reader, err := driver.Get(path)
+		if err != nil {
+			return fail("get", err)
+		}
+		hash := sha256.New()
+		_, err = io.Copy(hash, reader)
+		reader.Close()
+		if err != nil {
+			return fail("get", err)
+		}
+		gets = append(gets, time.Since(start))
+		if got := hash.Sum(nil); !bytes.Equal(got, want[:]) {
+			return fail("checksum", fmt.Errorf("%s reads back as %x, %x was written", path, got, want))
+		}
+
+		start = time.Now()
+		if err := driver.Delete(path); err != nil {
+			return fail("delete", err)
+		}
+		deletes = append(deletes, time.Since(start))
+		if driver.Exists(path) {
+			return fail("delete", fmt.Errorf("%s still exists after being deleted", path))
+		}
+		report.Rounds++
+	}
+	return report
+}
+
+// latency summarizes durations by nearest-rank percentiles
+func latency(durations []time.Duration) Latency {
+	if len(durations) == 0 {
+		return Latency{}
+	}
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	at := func(p int) time.Duration {
+		rank := (p*len(sorted) + 99) / 100
+		return sorted[max(rank, 1)-1]
+	}
+	return Latency{P50: at(50), P95: at(95), P99: at(99), Max: sorted[len(sorted)-1]}
+}
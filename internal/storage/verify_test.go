@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+// corruptingDriver flips the first byte of every file read
+type corruptingDriver struct {
+	*LocalDriver
+}
+
+func (d corruptingDriver) Get(path string) (io.ReadCloser, error) {
+	reader, err := d.LocalDriver.Get(path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	content[0] ^= 0xff
+	return io.NopCloser(bytes.NewReader(content)), nil
+}
+
+func TestVerifyLocalDisk(t *testing.T) {
+	root := t.TempDir()
+	report := Verify(context.Background(), NewLocalDriver(root, ""), VerifyOptions{Rounds: 5, Size: 1024})
+
+	assert.True(t, report.OK(), report.Error)
+	assert.Equal(t, 5, report.Rounds)
+	assert.Positive(t, report.Put.Max)
+	assert.LessOrEqual(t, report.Get.P50, report.Get.P99)
+	files, err := os.ReadDir(filepath.Join(root, VerifyDir))
+	require.NoError(t, err)
+	assert.Empty(t, files, "test files are deleted")
+}
+
+func TestVerifyFailures(t *testing.T) {
+	ctx := context.Background()
+
+	report := Verify(ctx, corruptingDriver{NewLocalDriver(t.TempDir(), "")}, VerifyOptions{Rounds: 3})
+	assert.False(t, report.OK())
+	assert.Equal(t, "checksum", report.Step)
+	assert.Zero(t, report.Rounds)
+
+	report = Verify(ctx, NewS3Driver("bucket", "us-east-1", "", ""), VerifyOptions{})
+	assert.Equal(t, "connect", report.Step)
+	assert.Contains(t, report.Error, "not implemented")
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	report = Verify(cancelled, NewLocalDriver(t.TempDir(), ""), VerifyOptions{})
+	assert.Equal(t, "timeout", report.Step)
+}
+
+func TestLatencyPercentiles(t *testing.T) {
+	var durations []time.Duration
+	for i := 100; i >= 1; i-- {
+		durations = append(durations, time.Duration(i)*time.Millisecond)
+	}
+	assert.Equal(t, Latency{P50: 50 * time.Millisecond, P95: 95 * time.Millisecond, P99: 99 * time.Millisecond, Max: 100 * time.Millisecond}, latency(durations))
+	assert.Equal(t, Latency{P50: time.Second, P95: time.Second, P99: time.Second, Max: time.Second}, latency([]time.Duration{time.Second}))
+	assert.Equal(t, Latency{}, latency(nil))
+}
+
+func TestDisk(t *testing.T) {
+	cfg := &config.StorageConfig{
+		Default: "local",
+		Disks: map[string]config.DiskConfig{
+			"local":  {Driver: "local", Options: map[string]string{"root": "storage/app"}},
+			"backup": {Driver: "s3", Options: map[string]string{"bucket": "backups"}},
+			"ftp":    {Driver: "ftp"},
+		},
+	}
+	driver, err := Disk(cfg, "")
+	require.NoError(t, err)
+	assert.IsType(t, &LocalDriver{}, driver)
+	driver, err = Disk(cfg, "backup")
+	require.NoError(t, err)
+	assert.IsType(t, &S3Driver{}, driver)
+	_, err = Disk(cfg, "ftp")
+	assert.EqualError(t, err, `disk ftp: storage: unknown driver "ftp"`)
+	_, err = Disk(cfg, "missing")
+	assert.Error(t, err)
+	assert.Equal(t, []string{"backup", "ftp", "local"}, DiskNames(cfg))
+}
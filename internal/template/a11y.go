@@ -0,0 +1,141 @@
+package template
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// LintIssue is an accessibility problem in a template's markup
+type LintIssue struct {
+	Path string
+	Name string
+	Line int
+
+	Message string
+}
+
+func (i *LintIssue) String() string {
+	location := i.Path
+	if i.Line > 0 {
+		location += ":" + strconv.Itoa(i.Line)
+	}
+	return location + ": " + i.Message
+}
+
+// unlabelledInputs are the input types that don't need a label, being
+// hidden or labelled by their value
+var unlabelledInputs = map[string]bool{"hidden": true, "submit": true, "reset": true, "button": true, "image": true}
+
+// LintAccessibility checks template markup for images without alt text and
+// form controls without a label: a <label for> naming their id, a <label>
+// around them, aria-label or aria-labelledby. An empty alt marks an image
+// as decorative, so only a missing one is reported. Template actions are
+// left as they are, so a control whose id is an action needs a label whose
+// for is the same action.
+func LintAccessibility(content string) []LintIssue {
+	type control struct {
+		tag, id string
+		line    int
+	}
+	var (
+		issues    []LintIssue
+		pending   []control
+		labelled  = make(map[string]bool)
+		inLabel   int
+		line      = 1
+		tokenizer = html.NewTokenizer(strings.NewReader(content))
+	)
+	for {
+		tt := tokenizer.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		start := line
+		line += bytes.Count(tokenizer.Raw(), []byte("\n"))
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken && tt != html.EndTagToken {
+			continue
+		}
+
+		token := tokenizer.Token()
+		if tt == html.EndTagToken {
+			if token.Data == "label" && inLabel > 0 {
+				inLabel--
+			}
+			continue
+		}
+		attrs := make(map[string]string, len(token.Attr))
+		for _, attr := range token.Attr {
+			attrs[attr.Key] = attr.Val
+		}
+
+		switch token.Data {
+		case "label":
+			if target, ok := attrs["for"]; ok {
+				labelled[target] = true
+			}
+			if tt == html.StartTagToken {
+				inLabel++
+			}
+		case "img":
+			if _, ok := attrs["alt"]; !ok {
+				issues = append(issues, LintIssue{Line: start, Message: "<img> has no alt text; use alt=\"\" for decorative images"})
+			}
+		case "input", "select", "textarea":
+			if token.Data == "input" && unlabelledInputs[strings.ToLower(attrs["type"])] {
+				continue
+			}
+			if inLabel > 0 || attrs["aria-label"] != "" || attrs["aria-labelledby"] != "" {
+				continue
+			}
+			pending = append(pending, control{tag: token.Data, id: attrs["id"], line: start})
+		}
+	}
+
+	// Labels may come after the controls they name
+	for _, c := range pending {
+		if c.id != "" && labelled[c.id] {
+			continue
+		}
+		message := "<" + c.tag + "> has no label"
+		if c.id == "" {
+			message += "; give it an id and a <label for> naming it"
+		}
+		issues = append(issues, LintIssue{Line: c.line, Message: message})
+	}
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].Line < issues[j].Line })
+	return issues
+}
+
+// Lint checks the markup of the loaded templates with LintAccessibility,
+// ordering the issues by path and line. Markdown pages are left out, their
+// markup being generated.
+func (e *Engine) Lint() []*LintIssue {
+	e.mu.RLock()
+	templates := make([]*Template, 0, len(e.templates))
+	for _, tmpl := range e.templates {
+		if !isMarkdown(tmpl.Path) {
+			templates = append(templates, tmpl)
+		}
+	}
+	e.mu.RUnlock()
+
+	var issues []*LintIssue
+	for _, tmpl := range templates {
+		for _, issue := range LintAccessibility(tmpl.Content) {
+			issue := issue
+			issue.Path, issue.Name = tmpl.Path, tmpl.Name
+			issues = append(issues, &issue)
+		}
+	}
+	sort.Slice(issues, func(i, j int) bool {
+		if issues[i].Path != issues[j].Path {
+			return issues[i].Path < issues[j].Path
+		}
+		return issues[i].Line < issues[j].Line
+	})
+	return issues
+}
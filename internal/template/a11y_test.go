@@ -0,0 +1,52 @@
+package template
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLintAccessibility(t *testing.T) {
+	issues := LintAccessibility(`<form>
+    <img src="logo.png">
+    <img src="divider.png" alt="">
+    <label for="email">Email</label>
+    <input id="email" name="email">
+    <input name="phone" placeholder="Phone">
+    <label>Remember me <input type="checkbox" name="remember"></label>
+    <input type="hidden" name="csrf_token">
+    <select id="country-{{.ID}}" name="country"></select>
+    <label for="country-{{.ID}}">Country</label>
+    <textarea id="notes"
+              name="notes"></textarea>
+    <input name="q" aria-label="Search">
+    <button type="submit">Save</button>
+</form>`)
+	assert.Equal(t, []LintIssue{
+		{Line: 2, Message: `<img> has no alt text; use alt="" for decorative images`},
+		{Line: 6, Message: "<input> has no label; give it an id and a <label for> naming it"},
+		{Line: 11, Message: "<textarea> has no label"},
+	}, issues)
+}
+
+func TestEngineLint(t *testing.T) {
+	config := DefaultConfig()
+	config.LayoutsDir, config.PagesDir = t.TempDir(), t.TempDir()
+	config.PartialsDir, config.ComponentsDir, config.EmailsDir, config.ErrorsDir = "", "", "", ""
+	config.AutoReload = false
+	config.EnableLogging = false
+	require.NoError(t, os.WriteFile(filepath.Join(config.PagesDir, "search.html"),
+		[]byte("<h1>Search</h1>\n<input name=\"q\">"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(config.PagesDir, "about.md"),
+		[]byte("![Team](team.png)"), 0644))
+
+	engine, err := NewEngine(config, nil)
+	require.NoError(t, err)
+	issues := engine.Lint()
+	require.Len(t, issues, 1)
+	assert.Equal(t, filepath.Join(config.PagesDir, "search.html")+":2: <input> has no label; give it an id and a <label for> naming it",
+		issues[0].String())
+}
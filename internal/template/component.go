@@ -62,19 +62,20 @@ func (cm *ComponentManager) parseComponentContent(component *Component) error {
 	lines := strings.Split(component.Content, "\n")
 	var currentSlot string
 	var slotContent []string
+	left, _ := cm.engine.config.delims()
 	
 	for i, line := range lines {
 		line = strings.TrimSpace(line)
 		
 		// Parse props directive
-		if strings.HasPrefix(line, "{{props") {
+		if strings.HasPrefix(line, left+"props") {
 			props := cm.extractDirective(line, "props")
 			component.Props[props] = nil
 			continue
 		}
 		
 		// Parse slot start
-		if strings.HasPrefix(line, "{{slot") {
+		if strings.HasPrefix(line, left+"slot") {
 			// Save previous slot
 			if currentSlot != "" {
 				component.Slots[currentSlot] = strings.Join(slotContent, "\n")
@@ -88,7 +89,7 @@ func (cm *ComponentManager) parseComponentContent(component *Component) error {
 		}
 		
 		// Parse slot end
-		if strings.HasPrefix(line, "{{endslot") {
+		if strings.HasPrefix(line, left+"endslot") {
 			if currentSlot != "" {
 				component.Slots[currentSlot] = strings.Join(slotContent, "\n")
 				currentSlot = ""
@@ -98,21 +99,21 @@ func (cm *ComponentManager) parseComponentContent(component *Component) error {
 		}
 		
 		// Parse event directive
-		if strings.HasPrefix(line, "{{event") {
+		if strings.HasPrefix(line, left+"event") {
 			event := cm.extractDirective(line, "event")
 			component.Events[event] = ""
 			continue
 		}
 		
 		// Parse style directive
-		if strings.HasPrefix(line, "{{style") {
+		if strings.HasPrefix(line, left+"style") {
 			style := cm.extractDirective(line, "style")
 			component.Styles = style
 			continue
 		}
 		
 		// Parse script directive
-		if strings.HasPrefix(line, "{{script") {
+		if strings.HasPrefix(line, left+"script") {
 			script := cm.extractDirective(line, "script")
 			component.Scripts = script
 			continue
@@ -170,14 +171,29 @@ func (cm *ComponentManager) compileComponent(component *Component) error {
 	}
 	
 	// Add component-specific functions
-	funcMap["slot"] = cm.slotHelper(component)
+	funcMap["componentProps"] = componentProps
+	funcMap["componentScope"] = componentScope
 	funcMap["prop"] = cm.propHelper(component)
 	funcMap["event"] = cm.eventHelper(component)
 	funcMap["style"] = cm.styleHelper(component)
 	funcMap["script"] = cm.scriptHelper(component)
 	
+	// Inline the components it uses and fill its slots with the content
+	// set for them, or their defaults
+	left, right := cm.engine.config.delims()
+	content, err := expandRaw(component.Content, left, right)
+	if err != nil {
+		return fmt.Errorf("template %s: %w", component.Name, err)
+	}
+	if content, err = cm.engine.expandComponents(content, newComponentExpansion()); err != nil {
+		return fmt.Errorf("template %s: %w", component.Name, err)
+	}
+	if content, err = cm.engine.fillSlots(content, component.Slots, ""); err != nil {
+		return fmt.Errorf("template %s: %w", component.Name, err)
+	}
+
 	// Compile template
-	compiled, err := template.New(component.Name).Funcs(funcMap).Parse(component.Content)
+	compiled, err := cm.engine.newTemplate(component.Name, funcMap).Parse(content)
 	if err != nil {
 		return err
 	}
@@ -186,16 +202,6 @@ func (cm *ComponentManager) compileComponent(component *Component) error {
 	return nil
 }
 
-// slotHelper returns a helper function for rendering slots
-func (cm *ComponentManager) slotHelper(component *Component) func(string) string {
-	return func(slotName string) string {
-		if slot, exists := component.Slots[slotName]; exists {
-			return slot
-		}
-		return ""
-	}
-}
-
 // propHelper returns a helper function for accessing props
 func (cm *ComponentManager) propHelper(component *Component) func(string, ...interface{}) interface{} {
 	return func(propName string, defaultValue ...interface{}) interface{} {
@@ -302,7 +308,9 @@ func (cb *ComponentBuilder) Prop(name string, defaultValue interface{}) *Compone
 	return cb
 }
 
-// Slot adds a slot to the component
+// Slot sets the content of a slot, which takes the place of {{slot "name"}}
+// in the component, or of {{slot}} for the "default" slot. The content may
+// use template actions and is rendered with the component's data.
 func (cb *ComponentBuilder) Slot(name, content string) *ComponentBuilder {
 	cb.component.Slots[name] = content
 	return cb
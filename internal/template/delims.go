@@ -0,0 +1,101 @@
+package template
+
+import (
+	"fmt"
+	"html/template"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultLeftDelim  = "{{"
+	defaultRightDelim = "}}"
+)
+
+// delims returns the action delimiters templates are parsed with
+func (c *Config) delims() (string, string) {
+	left, right := c.LeftDelim, c.RightDelim
+	if left == "" {
+		left = defaultLeftDelim
+	}
+	if right == "" {
+		right = defaultRightDelim
+	}
+	return left, right
+}
+
+// newTemplate returns an empty template that parses with the configured
+// delimiters
+func (e *Engine) newTemplate(name string, funcMap template.FuncMap) *template.Template {
+	left, right := e.config.delims()
+	return template.New(name).Delims(left, right).Funcs(funcMap)
+}
+
+// parse compiles content with the configured delimiters after expanding its
+// raw blocks
+func (e *Engine) parse(name, content string, funcMap template.FuncMap) (*template.Template, error) {
+	left, right := e.config.delims()
+	content, err := expandRaw(content, left, right)
+	if err != nil {
+		return nil, fmt.Errorf("template %s: %w", name, err)
+	}
+	return e.newTemplate(name, funcMap).Parse(content)
+}
+
+// expandRaw rewrites the raw blocks in content, {{raw}} ... {{endraw}} with
+// the default delimiters, so that their text is output as written. Every
+// left delimiter inside a block becomes an action printing the delimiter,
+// which leaves the markup around it visible to html/template's contextual
+// escaping.
+func expandRaw(content, left, right string) (string, error) {
+	literal := left + strconv.Quote(left) + right
+
+	var out strings.Builder
+	for {
+		start, end, ok := findTag(content, "raw", left, right)
+		if !ok {
+			out.WriteString(content)
+			return out.String(), nil
+		}
+		out.WriteString(content[:start])
+		content = content[end:]
+
+		closeStart, closeEnd, ok := findTag(content, "endraw", left, right)
+		if !ok {
+			return "", fmt.Errorf("%sraw%s block is not closed with %sendraw%s", left, right, left, right)
+		}
+		out.WriteString(strings.ReplaceAll(content[:closeStart], left, literal))
+		content = content[closeEnd:]
+	}
+}
+
+// findTag returns the bounds of the first action in content that consists
+// of keyword alone, such as {{raw}} or {{ raw }}
+func findTag(content, keyword, left, right string) (int, int, bool) {
+	offset := 0
+	for {
+		start, end, inner, ok := nextAction(content[offset:], left, right)
+		if !ok {
+			return 0, 0, false
+		}
+		if strings.TrimSpace(inner) == keyword {
+			return offset + start, offset + end, true
+		}
+		offset += start + len(left)
+	}
+}
+
+// nextAction returns the bounds of the first action in content and the text
+// between its delimiters
+func nextAction(content, left, right string) (int, int, string, bool) {
+	start := strings.Index(content, left)
+	if start < 0 {
+		return 0, 0, "", false
+	}
+	inner := start + len(left)
+	i := strings.Index(content[inner:], right)
+	if i < 0 {
+		return 0, 0, "", false
+	}
+	return start, inner + i + len(right), content[inner : inner+i], true
+}
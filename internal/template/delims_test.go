@@ -0,0 +1,88 @@
+package template
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newPagesEngine(t *testing.T, config *Config, pages map[string]string) *Engine {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range pages {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name+".html"), []byte(content), 0644))
+	}
+	config.LayoutsDir, config.PartialsDir, config.ComponentsDir = "", "", ""
+	config.EmailsDir, config.ErrorsDir = "", ""
+	config.PagesDir = dir
+	config.AutoReload = false
+	config.EnableLogging = false
+	engine, err := NewEngine(config, nil)
+	require.NoError(t, err)
+	return engine
+}
+
+func TestCustomDelimiters(t *testing.T) {
+	config := DefaultConfig()
+	config.LeftDelim, config.RightDelim = "[[", "]]"
+	engine := newPagesEngine(t, config, map[string]string{
+		"counter": `<div x-data="{ count: [[.Start]] }"><span x-text="count">{{ count }}</span> [[upper .Label]]</div>`,
+	})
+
+	html, err := engine.Render("counter", TemplateData{"Start": 3, "Label": "clicks"})
+	require.NoError(t, err)
+	assert.Equal(t, `<div x-data="{ count: 3 }"><span x-text="count">{{ count }}</span> CLICKS</div>`, html)
+}
+
+func TestRawBlocks(t *testing.T) {
+	tests := []struct {
+		name        string
+		left, right string
+		content     string
+		want        string
+	}{
+		{
+			name:    "text and attributes",
+			content: `<p>{{.Name}}</p>{{raw}}<p x-text="{{ greeting }}">{{ message }}</p>{{endraw}}`,
+			want:    `<p>Ada</p><p x-text="{{ greeting }}">{{ message }}</p>`,
+		},
+		{
+			name:    "spaced tags and comments",
+			content: `{{ raw }}{{/* kept */}} {{ .Name }}{{ endraw }} {{.Name}}`,
+			want:    `{{/* kept */}} {{ .Name }} Ada`,
+		},
+		{
+			name:    "escaping still applies outside",
+			content: `{{raw}}<b>{{ x }}</b>{{endraw}}{{.HTML}}`,
+			want:    `<b>{{ x }}</b>&lt;i&gt;`,
+		},
+		{
+			name:    "custom delimiters",
+			left:    "[[",
+			right:   "]]",
+			content: `[[raw]]<template>[[ x ]] {{ y }}</template>[[endraw]][[.Name]]`,
+			want:    `<template>[[ x ]] {{ y }}</template>Ada`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			if tt.left != "" {
+				config.LeftDelim, config.RightDelim = tt.left, tt.right
+			}
+			engine := newPagesEngine(t, config, map[string]string{"page": tt.content})
+
+			html, err := engine.Render("page", TemplateData{"Name": "Ada", "HTML": "<i>"})
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, html)
+		})
+	}
+}
+
+func TestUnclosedRawBlock(t *testing.T) {
+	_, err := expandRaw(`{{raw}}{{ open }}`, "{{", "}}")
+	assert.EqualError(t, err, "{{raw}} block is not closed with {{endraw}}")
+}
@@ -0,0 +1,212 @@
+package template
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CompileError is a template file that failed to compile or refers to a
+// layout that can't be used
+type CompileError struct {
+	Path string
+	Name string
+
+	// Line and Column locate the error in the file; zero when unknown
+	Line   int
+	Column int
+
+	Message string
+}
+
+func (e *CompileError) Error() string {
+	location := e.Path
+	if e.Line > 0 {
+		location += ":" + strconv.Itoa(e.Line)
+		if e.Column > 0 {
+			location += ":" + strconv.Itoa(e.Column)
+		}
+	}
+	return location + ": " + e.Message
+}
+
+// parseErrorPattern matches text/template and html/template errors, such
+// as `template: pages.home:12: unexpected "}" in operand` or
+// `html/template:pages.home:3:14: ...`
+var parseErrorPattern = regexp.MustCompile(`^(?:html/)?template: ?(.*?):(\d+):(?:(\d+):)? (.*)$`)
+
+// newCompileError locates err, returned while compiling the template name
+// read from path
+func newCompileError(name, path string, err error) *CompileError {
+	var compileErr *CompileError
+	if errors.As(err, &compileErr) {
+		return compileErr
+	}
+	ce := &CompileError{Path: path, Name: name, Message: err.Error()}
+	if m := parseErrorPattern.FindStringSubmatch(err.Error()); m != nil {
+		ce.Line, _ = strconv.Atoi(m[2])
+		ce.Column, _ = strconv.Atoi(m[3])
+		ce.Message = m[4]
+	}
+	return ce
+}
+
+// Errors returns the templates that failed to compile, and those extending
+// a layout that is missing or extends them in turn, ordered by path
+func (e *Engine) Errors() []*CompileError {
+	e.mu.RLock()
+	var errs []*CompileError
+	for _, err := range e.failed {
+		errs = append(errs, err)
+	}
+	var extending []*Template
+	for _, tmpl := range e.templates {
+		if tmpl.Extends != "" {
+			extending = append(extending, tmpl)
+		}
+	}
+	e.mu.RUnlock()
+
+	for _, tmpl := range extending {
+		if _, err := e.layoutChain(tmpl, ""); err != nil {
+			errs = append(errs, &CompileError{
+				Path:    tmpl.Path,
+				Name:    tmpl.Name,
+				Line:    lineOf(tmpl.Content, strconv.Quote(tmpl.Extends)),
+				Message: err.Error(),
+			})
+		}
+	}
+
+	sort.Slice(errs, func(i, j int) bool {
+		if errs[i].Path != errs[j].Path {
+			return errs[i].Path < errs[j].Path
+		}
+		return errs[i].Line < errs[j].Line
+	})
+	return errs
+}
+
+// lineOf returns the line of the first occurrence of substr, or 0
+func lineOf(content, substr string) int {
+	i := strings.Index(content, substr)
+	if i < 0 {
+		return 0
+	}
+	return strings.Count(content[:i], "\n") + 1
+}
+
+// TypeStats counts the templates of one type
+type TypeStats struct {
+	Dir   string
+	Count int
+	Size  int64
+}
+
+// Stats describes the loaded templates
+type Stats struct {
+	Types    map[TemplateType]TypeStats
+	Total    int
+	Size     int64
+	Helpers  int
+	Errors   int
+	LoadTime time.Duration
+	LoadedAt time.Time
+}
+
+// Stats returns counts and sizes of the loaded templates by type, and how
+// long the last full load took
+func (e *Engine) Stats() Stats {
+	errs := len(e.Errors())
+	helpers := len(e.HelperNames())
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	stats := Stats{
+		Types:    make(map[TemplateType]TypeStats),
+		Helpers:  helpers,
+		Errors:   errs,
+		LoadTime: e.loadTime,
+		LoadedAt: e.loadedAt,
+	}
+	for templateType, dir := range e.config.dirs() {
+		stats.Types[templateType] = TypeStats{Dir: dir}
+	}
+	for _, tmpl := range e.templates {
+		ts := stats.Types[tmpl.Type]
+		ts.Count++
+		ts.Size += tmpl.Size
+		stats.Types[tmpl.Type] = ts
+		stats.Total++
+		stats.Size += tmpl.Size
+	}
+	return stats
+}
+
+// HelperNames returns the names of the registered helpers, sorted
+func (e *Engine) HelperNames() []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	names := make([]string, 0, len(e.helpers)+len(e.config.Funcs))
+	for name := range e.helpers {
+		names = append(names, name)
+	}
+	for name := range e.config.Funcs {
+		if _, ok := e.helpers[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Reload reports a template the watcher recompiled or dropped
+type Reload struct {
+	Path     string
+	Name     string
+	Type     TemplateType
+	Removed  bool
+	Err      *CompileError
+	Duration time.Duration
+}
+
+func (r Reload) String() string {
+	switch {
+	case r.Err != nil:
+		return r.Err.Error()
+	case r.Removed:
+		return fmt.Sprintf("%s removed", r.Name)
+	default:
+		return fmt.Sprintf("%s recompiled in %s", r.Name, r.Duration.Round(time.Microsecond))
+	}
+}
+
+// OnReload calls fn after the watcher recompiles or drops a template. Only
+// changes are reported: saving a file without changing it is not.
+func (e *Engine) OnReload(fn func(Reload)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.onReload = fn
+}
+
+// dirs maps each template type to its directory, leaving out unset ones
+func (c *Config) dirs() map[TemplateType]string {
+	dirs := make(map[TemplateType]string)
+	for templateType, dir := range map[TemplateType]string{
+		TypeLayout:    c.LayoutsDir,
+		TypePartial:   c.PartialsDir,
+		TypePage:      c.PagesDir,
+		TypeComponent: c.ComponentsDir,
+		TypeEmail:     c.EmailsDir,
+		TypeError:     c.ErrorsDir,
+	} {
+		if dir != "" {
+			dirs[templateType] = dir
+		}
+	}
+	return dirs
+}
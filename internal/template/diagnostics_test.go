@@ -0,0 +1,125 @@
+package template
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompileErrors(t *testing.T) {
+	engine := newLayoutsEngine(t, map[string]string{
+		"base":   "<main>{{.layout}}</main>",
+		"broken": "<title>\n{{.Title}\n</title>",
+	}, map[string]string{
+		"home":    `{{extends "base"}}{{define "content"}}hi{{end}}`,
+		"orphan":  "<p>\n" + `{{extends "missing"}}` + "\n</p>",
+		"unknown": "line one\nline two\n{{shout .Name}}",
+	})
+	config := engine.config
+
+	errs := engine.Errors()
+	require.Len(t, errs, 3)
+	broken := errs[0]
+	assert.Equal(t, filepath.Join(config.LayoutsDir, "broken.html"), broken.Path)
+	assert.Equal(t, "broken", broken.Name)
+	assert.Equal(t, 2, broken.Line)
+	assert.Equal(t, "bad character U+007D '}'", broken.Message)
+	assert.Equal(t, broken.Path+":2: "+broken.Message, broken.Error())
+
+	paths := []string{errs[1].Path, errs[2].Path}
+	assert.ElementsMatch(t, []string{filepath.Join(config.PagesDir, "orphan.html"), filepath.Join(config.PagesDir, "unknown.html")}, paths)
+	for _, err := range errs[1:] {
+		switch err.Name {
+		case "orphan":
+			assert.Equal(t, 2, err.Line)
+			assert.Equal(t, "layout template missing not found", err.Message)
+		case "unknown":
+			assert.Equal(t, 3, err.Line)
+			assert.Equal(t, `function "shout" not defined`, err.Message)
+		}
+	}
+
+	stats := engine.Stats()
+	assert.Equal(t, 3, stats.Total, "templates that fail to compile aren't loaded")
+	assert.Equal(t, 3, stats.Errors)
+	assert.Equal(t, 1, stats.Types[TypeLayout].Count)
+	assert.Equal(t, 2, stats.Types[TypePage].Count)
+	assert.Equal(t, config.PagesDir, stats.Types[TypePage].Dir)
+	assert.NotContains(t, stats.Types, TypePartial, "unset directories aren't reported")
+	assert.Equal(t, len(engine.HelperNames()), stats.Helpers)
+	assert.False(t, stats.LoadedAt.IsZero())
+
+	var located *CompileError
+	assert.True(t, errors.As(newCompileError("x", "x.html", errors.New("html/template:x:4:12: bad")), &located))
+	assert.Equal(t, "x.html:4:12: bad", located.Error())
+}
+
+func TestWatcherReports(t *testing.T) {
+	config := DefaultConfig()
+	config.PagesDir = t.TempDir()
+	config.LayoutsDir, config.PartialsDir, config.ComponentsDir, config.EmailsDir, config.ErrorsDir = "", "", "", "", ""
+	config.EnableLogging = false
+	page := filepath.Join(config.PagesDir, "home.html")
+	require.NoError(t, os.WriteFile(page, []byte("<h1>{{.Title}}</h1>"), 0644))
+
+	engine, err := NewEngine(config, nil)
+	require.NoError(t, err)
+	defer engine.Stop()
+	reloads := make(chan Reload, 10)
+	engine.OnReload(func(r Reload) { reloads <- r })
+
+	next := func() Reload {
+		select {
+		case r := <-reloads:
+			return r
+		case <-time.After(5 * time.Second):
+			t.Fatal("no reload reported")
+			return Reload{}
+		}
+	}
+	// Wait for the watcher to add its directories
+	write := func(content string) {
+		require.NoError(t, os.WriteFile(page, []byte(content), 0644))
+	}
+	require.Eventually(t, func() bool {
+		write("<h1>{{.Title}}</h1>\n<p>{{.Body}}</p>")
+		select {
+		case r := <-reloads:
+			assert.Equal(t, "home", r.Name)
+			assert.Nil(t, r.Err)
+			return true
+		case <-time.After(50 * time.Millisecond):
+			return false
+		}
+	}, 5*time.Second, 10*time.Millisecond)
+
+	write("<h1>{{.Title}}</h1>\n<p>{{.Body}</p>")
+	r := next()
+	require.NotNil(t, r.Err)
+	assert.Equal(t, 2, r.Err.Line)
+	require.Len(t, engine.Errors(), 1)
+
+	write("<h1>{{.Title}}</h1>")
+	r = next()
+	assert.Nil(t, r.Err)
+	assert.Empty(t, engine.Errors())
+
+	require.NoError(t, os.Remove(page))
+	r = next()
+	assert.True(t, r.Removed)
+	_, exists := engine.GetTemplate("home")
+	assert.False(t, exists)
+
+	nested := filepath.Join(config.PagesDir, "admin")
+	require.NoError(t, os.Mkdir(nested, 0755))
+	require.Eventually(t, func() bool {
+		require.NoError(t, os.WriteFile(filepath.Join(nested, "users.html"), []byte("users"), 0644))
+		_, exists := engine.GetTemplate("admin.users")
+		return exists
+	}, 5*time.Second, 50*time.Millisecond, "new directories are watched")
+}
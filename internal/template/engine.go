@@ -23,6 +23,7 @@ const (
 	TypeComponent
 	TypeEmail
 	TypeSMS
+	TypeError
 )
 
 func (tt TemplateType) String() string {
@@ -39,6 +40,8 @@ func (tt TemplateType) String() string {
 		return "email"
 	case TypeSMS:
 		return "sms"
+	case TypeError:
+		return "error"
 	default:
 		return "unknown"
 	}
@@ -52,12 +55,24 @@ type Config struct {
 	PagesDir      string `yaml:"pages_dir" json:"pages_dir"`
 	ComponentsDir string `yaml:"components_dir" json:"components_dir"`
 	EmailsDir     string `yaml:"emails_dir" json:"emails_dir"`
+	ErrorsDir     string `yaml:"errors_dir" json:"errors_dir"`
+
+	// Namespaces maps a namespace to a directory of more pages, such as a
+	// module's views, named with the namespace in front: the page
+	// index.html in the billing namespace is billing::index. A directory
+	// that doesn't exist holds no pages.
+	Namespaces map[string]string `yaml:"namespaces" json:"namespaces"`
 
 	// Template settings
 	Extension      string `yaml:"extension" json:"extension"`
 	AutoReload     bool   `yaml:"auto_reload" json:"auto_reload"`
 	CacheTemplates bool   `yaml:"cache_templates" json:"cache_templates"`
 
+	// Action delimiters, "{{" and "}}" by default. Setting them to "[[" and
+	// "]]" leaves {{ }} to front-end frameworks such as Alpine.js and Vue.
+	LeftDelim  string `yaml:"left_delim" json:"left_delim"`
+	RightDelim string `yaml:"right_delim" json:"right_delim"`
+
 	// Layout settings
 	DefaultLayout string `yaml:"default_layout" json:"default_layout"`
 	LayoutVar     string `yaml:"layout_var" json:"layout_var"`
@@ -65,6 +80,13 @@ type Config struct {
 	// Helper settings
 	EnableHelpers bool `yaml:"enable_helpers" json:"enable_helpers"`
 
+	// Funcs are added to the helpers, such as the time and vite helpers
+	// pages rendered by the router use
+	Funcs template.FuncMap `yaml:"-" json:"-"`
+
+	// Markdown settings for .md pages and the markdown helper
+	Markdown MarkdownConfig `yaml:"markdown" json:"markdown"`
+
 	// Security settings
 	EscapeHTML     bool     `yaml:"escape_html" json:"escape_html"`
 	TrustedOrigins []string `yaml:"trusted_origins" json:"trusted_origins"`
@@ -86,12 +108,16 @@ func DefaultConfig() *Config {
 		PagesDir:       "ui/views/pages",
 		ComponentsDir:  "ui/views/components",
 		EmailsDir:      "ui/views/emails",
+		ErrorsDir:      "resources/views/errors",
 		Extension:      ".html",
 		AutoReload:     true,
 		CacheTemplates: true,
+		LeftDelim:      defaultLeftDelim,
+		RightDelim:     defaultRightDelim,
 		DefaultLayout:  "base",
 		LayoutVar:      "layout",
 		EnableHelpers:  true,
+		Markdown:       MarkdownConfig{HighlightStyle: "github"},
 		EscapeHTML:     true,
 		TrustedOrigins: []string{},
 		MaxCacheSize:   1000,
@@ -114,6 +140,19 @@ type Template struct {
 	Blocks       map[string]string  `json:"blocks,omitempty"`
 	Extends      string             `json:"extends,omitempty"`
 	Includes     []string           `json:"includes,omitempty"`
+
+	// Meta is the front matter of a Markdown page
+	Meta map[string]interface{} `json:"meta,omitempty"`
+
+	// source is Content as parsed, with directives, raw blocks and
+	// components expanded
+	source     string
+	sourceHash string
+	extensions []blockExtension
+
+	// componentFiles are the files of the components inlined, with their
+	// modification times when they were read
+	componentFiles map[string]time.Time
 }
 
 // TemplateData represents data passed to templates
@@ -134,15 +173,30 @@ type Engine struct {
 	pages      map[string]*Template
 	components map[string]*Template
 	emails     map[string]*Template
+	errors     map[string]*Template
 
 	// Helper functions
 	helpers map[string]HelperFunc
 
+	// Renderer for .md pages and the markdown helper
+	markdown *Markdown
+
 	// Cache
 	cache map[string]*Template
 
-	// File watcher
-	watcher *TemplateWatcher
+	// Templates parsed with their layouts, by template name
+	compositions map[string]*composition
+
+	// Files that failed to compile, by path
+	failed map[string]*CompileError
+
+	// File watcher, and the function told about its reloads
+	watcher  *TemplateWatcher
+	onReload func(Reload)
+
+	// How long the last full load took, and when
+	loadTime time.Duration
+	loadedAt time.Time
 
 	// Mutex for thread safety
 	mu sync.RWMutex
@@ -154,16 +208,21 @@ func NewEngine(config *Config, logger *zap.Logger) (*Engine, error) {
 		config = DefaultConfig()
 	}
 
-	// Create directories if they don't exist
+	// Create directories if they don't exist; an empty directory setting
+	// turns that template type off
 	dirs := []string{
 		config.LayoutsDir,
 		config.PartialsDir,
 		config.PagesDir,
 		config.ComponentsDir,
 		config.EmailsDir,
+		config.ErrorsDir,
 	}
 
 	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
 		if err := os.MkdirAll(dir, 0755); err != nil {
 			return nil, fmt.Errorf("failed to create directory %s: %w", dir, err)
 		}
@@ -178,8 +237,13 @@ func NewEngine(config *Config, logger *zap.Logger) (*Engine, error) {
 		pages:      make(map[string]*Template),
 		components: make(map[string]*Template),
 		emails:     make(map[string]*Template),
+		errors:     make(map[string]*Template),
 		helpers:    make(map[string]HelperFunc),
+		markdown:   NewMarkdown(config.Markdown),
 		cache:      make(map[string]*Template),
+
+		compositions: make(map[string]*composition),
+		failed:       make(map[string]*CompileError),
 	}
 
 	// Register default helpers
@@ -215,6 +279,10 @@ func (e *Engine) LoadTemplates() error {
 	e.pages = make(map[string]*Template)
 	e.components = make(map[string]*Template)
 	e.emails = make(map[string]*Template)
+	e.errors = make(map[string]*Template)
+	e.compositions = make(map[string]*composition)
+	e.failed = make(map[string]*CompileError)
+	start := time.Now()
 
 	// Load templates from each directory
 	directories := map[string]TemplateType{
@@ -223,13 +291,27 @@ func (e *Engine) LoadTemplates() error {
 		e.config.PagesDir:      TypePage,
 		e.config.ComponentsDir: TypeComponent,
 		e.config.EmailsDir:     TypeEmail,
+		e.config.ErrorsDir:     TypeError,
 	}
 
 	for dir, templateType := range directories {
+		if dir == "" {
+			continue
+		}
 		if err := e.loadTemplatesFromDir(dir, templateType); err != nil {
 			return fmt.Errorf("failed to load templates from %s: %w", dir, err)
 		}
 	}
+	for _, dir := range e.config.namespaceDirs() {
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			continue
+		}
+		if err := e.loadTemplatesFromDir(dir, TypePage); err != nil {
+			return fmt.Errorf("failed to load templates from %s: %w", dir, err)
+		}
+	}
+	e.loadTime = time.Since(start)
+	e.loadedAt = time.Now()
 
 	if e.config.EnableLogging && e.logger != nil {
 		e.logger.Info("Templates loaded successfully",
@@ -238,7 +320,8 @@ func (e *Engine) LoadTemplates() error {
 			zap.Int("partials", len(e.partials)),
 			zap.Int("pages", len(e.pages)),
 			zap.Int("components", len(e.components)),
-			zap.Int("emails", len(e.emails)))
+			zap.Int("emails", len(e.emails)),
+			zap.Int("errors", len(e.errors)))
 	}
 
 	return nil
@@ -257,13 +340,14 @@ func (e *Engine) loadTemplatesFromDir(dir string, templateType TemplateType) err
 		}
 
 		// Check file extension
-		if !strings.HasSuffix(path, e.config.Extension) {
+		if !e.isTemplateFile(path, templateType) {
 			return nil
 		}
 
 		// Load template
 		template, err := e.loadTemplate(path, templateType)
 		if err != nil {
+			e.failed[path] = newCompileError(e.generateTemplateName(path, templateType), path, err)
 			if e.config.EnableLogging && e.logger != nil {
 				e.logger.Warn("Failed to load template",
 					zap.String("path", path),
@@ -287,6 +371,8 @@ func (e *Engine) loadTemplatesFromDir(dir string, templateType TemplateType) err
 			e.components[template.Name] = template
 		case TypeEmail:
 			e.emails[template.Name] = template
+		case TypeError:
+			e.errors[template.Name] = template
 		}
 
 		return nil
@@ -321,9 +407,9 @@ func (e *Engine) loadTemplate(path string, templateType TemplateType) (*Template
 		Hash:         e.generateHash(string(content)),
 	}
 
-	// Compile template
+	// Compile template; the error locates the problem in the file
 	if err := e.compileTemplate(tmpl); err != nil {
-		return nil, fmt.Errorf("failed to compile template %s: %w", name, err)
+		return nil, newCompileError(name, path, err)
 	}
 
 	return tmpl, nil
@@ -331,6 +417,10 @@ func (e *Engine) loadTemplate(path string, templateType TemplateType) (*Template
 
 // generateTemplateName generates a template name from path
 func (e *Engine) generateTemplateName(path string, templateType TemplateType) string {
+	if namespace, dir, ok := e.config.namespaceOf(path); ok && templateType == TypePage {
+		return e.namespacedName(namespace, dir, path)
+	}
+
 	// Get relative path from template directory
 	var baseDir string
 	switch templateType {
@@ -344,6 +434,8 @@ func (e *Engine) generateTemplateName(path string, templateType TemplateType) st
 		baseDir = e.config.ComponentsDir
 	case TypeEmail:
 		baseDir = e.config.EmailsDir
+	case TypeError:
+		baseDir = e.config.ErrorsDir
 	}
 
 	relPath, err := filepath.Rel(baseDir, path)
@@ -353,11 +445,25 @@ func (e *Engine) generateTemplateName(path string, templateType TemplateType) st
 
 	// Remove extension and convert to template name
 	name := strings.TrimSuffix(relPath, e.config.Extension)
+	if templateType == TypePage {
+		name = strings.TrimSuffix(name, markdownExtension)
+	}
 	name = strings.ReplaceAll(name, string(filepath.Separator), ".")
 
+	// Error pages are named by status, so they get their own namespace
+	if templateType == TypeError {
+		name = "errors." + name
+	}
+
 	return name
 }
 
+// isTemplateFile reports whether path has the extension of templateType's
+// templates; pages may also be written in Markdown
+func (e *Engine) isTemplateFile(path string, templateType TemplateType) bool {
+	return strings.HasSuffix(path, e.config.Extension) || (templateType == TypePage && isMarkdown(path))
+}
+
 // generateHash generates a hash for template content
 func (e *Engine) generateHash(content string) string {
 	// Simple hash implementation
@@ -370,7 +476,25 @@ func (e *Engine) generateHash(content string) string {
 
 // compileTemplate compiles a template with helpers
 func (e *Engine) compileTemplate(tmpl *Template) error {
-	// Create template with helpers
+	source, err := e.expandDirectives(tmpl)
+	if err != nil {
+		return err
+	}
+
+	// Compile template
+	compiled, err := e.newTemplate(tmpl.Name, e.funcMap()).Parse(source)
+	if err != nil {
+		return err
+	}
+
+	tmpl.source = source
+	tmpl.sourceHash = e.generateHash(source)
+	tmpl.Compiled = compiled
+	return nil
+}
+
+// funcMap returns the helpers templates are compiled with
+func (e *Engine) funcMap() template.FuncMap {
 	funcMap := template.FuncMap{}
 
 	// Add helper functions
@@ -379,19 +503,21 @@ func (e *Engine) compileTemplate(tmpl *Template) error {
 			funcMap[name] = helper
 		}
 	}
-
-	// Compile template
-	compiled, err := template.New(tmpl.Name).Funcs(funcMap).Parse(tmpl.Content)
-	if err != nil {
-		return err
+	for name, fn := range e.config.Funcs {
+		funcMap[name] = fn
 	}
 
-	tmpl.Compiled = compiled
-	return nil
+	// Inlined components need these whether or not helpers are enabled
+	funcMap["componentProps"] = componentProps
+	funcMap["componentScope"] = componentScope
+
+	return funcMap
 }
 
-// Render renders a template with data
+// Render renders a template with data. Names may use slashes for the
+// directories they are in, e.g. users/index for users.index.
 func (e *Engine) Render(name string, data TemplateData) (string, error) {
+	name = templateName(name)
 	e.mu.RLock()
 	tmpl, exists := e.templates[name]
 	e.mu.RUnlock()
@@ -401,14 +527,11 @@ func (e *Engine) Render(name string, data TemplateData) (string, error) {
 	}
 
 	// Check if template needs recompilation
-	if e.config.AutoReload && e.needsRecompilation(tmpl) {
-		if err := e.reloadTemplate(tmpl); err != nil {
-			if e.config.EnableLogging && e.logger != nil {
-				e.logger.Warn("Failed to reload template",
-					zap.String("template", name),
-					zap.Error(err))
-			}
-		}
+	e.refresh(tmpl)
+
+	// Templates that extend a layout render inside it
+	if tmpl.Extends != "" {
+		return e.renderLayout(tmpl, "", data)
 	}
 
 	// Render template
@@ -420,8 +543,13 @@ func (e *Engine) Render(name string, data TemplateData) (string, error) {
 	return buf.String(), nil
 }
 
-// RenderWithLayout renders a template with a layout
+// RenderWithLayout renders a page inside a layout, which defaults to the
+// layout the page extends and then to the default layout. The layout may
+// itself extend another, and the page's body is available to them as the
+// layout variable.
 func (e *Engine) RenderWithLayout(pageName, layoutName string, data TemplateData) (string, error) {
+	pageName = templateName(pageName)
+
 	// Get page template
 	e.mu.RLock()
 	page, exists := e.pages[pageName]
@@ -432,24 +560,12 @@ func (e *Engine) RenderWithLayout(pageName, layoutName string, data TemplateData
 	}
 
 	// Use default layout if not specified
-	if layoutName == "" {
+	if layoutName == "" && page.Extends == "" {
 		layoutName = e.config.DefaultLayout
 	}
 
-	// Get layout template
-	e.mu.RLock()
-	layout, exists := e.layouts[layoutName]
-	e.mu.RUnlock()
-
-	if !exists {
-		return "", fmt.Errorf("layout template %s not found", layoutName)
-	}
-
-	// Add page content to data
-	data[e.config.LayoutVar] = page.Content
-
-	// Render layout with page content
-	return e.Render(layout.Name, data)
+	// Render page inside its layouts
+	return e.renderLayout(page, layoutName, data)
 }
 
 // RenderPartial renders a partial template
@@ -499,7 +615,37 @@ func (e *Engine) needsRecompilation(tmpl *Template) bool {
 		return false
 	}
 
-	return info.ModTime().After(tmpl.LastModified)
+	if info.ModTime().After(tmpl.LastModified) {
+		return true
+	}
+
+	// or one of the components it uses has
+	for path, modified := range tmpl.componentFiles {
+		if info, err := os.Stat(path); err != nil || !info.ModTime().Equal(modified) {
+			return true
+		}
+	}
+	return false
+}
+
+// refresh recompiles tmpl if auto-reload is on and its file has changed
+// since it was loaded, reporting whether it did
+func (e *Engine) refresh(tmpl *Template) bool {
+	if !e.config.AutoReload || !e.needsRecompilation(tmpl) {
+		return false
+	}
+	if err := e.reloadTemplate(tmpl); err != nil && e.config.EnableLogging && e.logger != nil {
+		e.logger.Warn("Failed to reload template",
+			zap.String("template", tmpl.Name),
+			zap.Error(err))
+	}
+	return true
+}
+
+// templateName converts a name written with slashes, users/index, to the
+// dotted name templates are loaded under, users.index
+func templateName(name string) string {
+	return strings.ReplaceAll(name, "/", ".")
 }
 
 // reloadTemplate reloads a template
@@ -572,11 +718,32 @@ func (e *Engine) GetTemplatesByType(templateType TemplateType) map[string]*Templ
 			result[name] = tmpl
 		}
 		return result
+	case TypeError:
+		result := make(map[string]*Template)
+		for name, tmpl := range e.errors {
+			result[name] = tmpl
+		}
+		return result
 	default:
 		return make(map[string]*Template)
 	}
 }
 
+// ErrorPage returns the name of the error template for status: the page
+// for the exact status, such as errors.404, or else the one for its class,
+// such as errors.5xx
+func (e *Engine) ErrorPage(status int) (string, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	for _, name := range []string{fmt.Sprintf("errors.%d", status), fmt.Sprintf("errors.%dxx", status/100)} {
+		if _, ok := e.errors[name]; ok {
+			return name, true
+		}
+	}
+	return "", false
+}
+
 // GetAllTemplates returns all templates
 func (e *Engine) GetAllTemplates() map[string]*Template {
 	e.mu.RLock()
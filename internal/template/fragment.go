@@ -0,0 +1,86 @@
+package template
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RenderFragment renders one named part of a template, a {{define}} or
+// {{block}} in it, such as the rows of a table for htmx to swap in:
+//
+//	engine.RenderFragment("users/index", "row", data)
+//
+// A template that extends a layout can also render the blocks it inherits.
+func (e *Engine) RenderFragment(name, fragment string, data TemplateData) (string, error) {
+	name = templateName(name)
+	e.mu.RLock()
+	tmpl, exists := e.templates[name]
+	e.mu.RUnlock()
+
+	if !exists {
+		return "", fmt.Errorf("template %s not found", name)
+	}
+
+	e.refresh(tmpl)
+	set := tmpl.Compiled
+	if tmpl.Extends != "" {
+		var err error
+		if set, err = e.composedFor(tmpl, ""); err != nil {
+			return "", err
+		}
+	}
+
+	if set == nil || set.Lookup(fragment) == nil {
+		return "", fmt.Errorf("template %s has no fragment %s", name, fragment)
+	}
+	var buf bytes.Buffer
+	if err := set.ExecuteTemplate(&buf, fragment, data); err != nil {
+		return "", fmt.Errorf("failed to render fragment %s of %s: %w", fragment, name, err)
+	}
+	return buf.String(), nil
+}
+
+// IsHTMX reports whether htmx sent r, as the HX-Request header says. History
+// restores are left out: htmx asks for the whole page when restoring one
+// that has dropped out of its cache.
+func IsHTMX(r *http.Request) bool {
+	return r.Header.Get("HX-Request") == "true" && r.Header.Get("HX-History-Restore-Request") != "true"
+}
+
+// RenderHTMX writes the template name as a whole page, or only its fragment
+// when htmx made the request, so one template serves both:
+//
+//	if err := views.RenderHTMX(w, r, "users/index", "rows", data); err != nil {
+//		problem.Write(w, r, err)
+//	}
+//
+// The response varies on HX-Request so that caches keep the two apart.
+// Rendering is traced as template.render under the request's span.
+func (e *Engine) RenderHTMX(w http.ResponseWriter, r *http.Request, name, fragment string, data TemplateData) error {
+	_, span := otel.Tracer("github.com/mrhoseah/dolphin/internal/template").Start(r.Context(), "template.render "+name,
+		trace.WithAttributes(attribute.String("template.name", name)))
+	var (
+		out string
+		err error
+	)
+	if IsHTMX(r) {
+		out, err = e.RenderFragment(name, fragment, data)
+	} else {
+		out, err = e.Render(name, data)
+	}
+	span.End()
+	if err != nil {
+		return err
+	}
+
+	w.Header().Add("Vary", "HX-Request")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, err = io.WriteString(w, out)
+	return err
+}
@@ -0,0 +1,81 @@
+package template
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderFragment(t *testing.T) {
+	engine := newLayoutsEngine(t, map[string]string{
+		"base": `<title>{{block "title" .}}Dolphin{{end}}</title><main>{{.layout}}</main>`,
+	}, map[string]string{
+		"users/index": `{{extends "base"}}{{define "title"}}Users{{end}}` +
+			`<table><tbody id="rows">{{block "rows" .}}{{range .Users}}{{template "row" .}}{{end}}{{end}}</tbody></table>` +
+			`{{define "row"}}<tr><td>{{.Name}}</td></tr>{{end}}`,
+		"plain": `<p>{{block "greeting" .}}Hi {{.Name}}{{end}}</p>`,
+	})
+	data := TemplateData{"Users": []TemplateData{{"Name": "ada"}, {"Name": "<bob>"}}}
+
+	page, err := engine.Render("users/index", data)
+	require.NoError(t, err)
+	assert.Equal(t, `<title>Users</title><main><table><tbody id="rows"><tr><td>ada</td></tr><tr><td>&lt;bob&gt;</td></tr></tbody></table></main>`, page)
+
+	rows, err := engine.RenderFragment("users/index", "rows", data)
+	require.NoError(t, err)
+	assert.Equal(t, `<tr><td>ada</td></tr><tr><td>&lt;bob&gt;</td></tr>`, rows)
+
+	row, err := engine.RenderFragment("users.index", "row", TemplateData{"Name": "carol"})
+	require.NoError(t, err)
+	assert.Equal(t, `<tr><td>carol</td></tr>`, row)
+
+	title, err := engine.RenderFragment("users/index", "title", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "Users", title)
+
+	greeting, err := engine.RenderFragment("plain", "greeting", TemplateData{"Name": "Ada"})
+	require.NoError(t, err)
+	assert.Equal(t, "Hi Ada", greeting)
+
+	_, err = engine.RenderFragment("users/index", "missing", nil)
+	assert.EqualError(t, err, "template users.index has no fragment missing")
+	_, err = engine.RenderFragment("users/missing", "rows", nil)
+	assert.EqualError(t, err, "template users.missing not found")
+}
+
+func TestRenderHTMX(t *testing.T) {
+	engine := newLayoutsEngine(t, map[string]string{
+		"base": `<html>{{.layout}}</html>`,
+	}, map[string]string{
+		"users/index": `{{extends "base"}}<ul>{{block "rows" .}}{{range .Users}}<li>{{.}}</li>{{end}}{{end}}</ul>`,
+	})
+	data := TemplateData{"Users": []string{"ada"}}
+
+	render := func(headers map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/users", nil)
+		for name, value := range headers {
+			r.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		require.NoError(t, engine.RenderHTMX(w, r, "users/index", "rows", data))
+		return w
+	}
+
+	full := render(nil)
+	assert.Equal(t, "<html><ul><li>ada</li></ul></html>", full.Body.String())
+	assert.Equal(t, "text/html; charset=utf-8", full.Header().Get("Content-Type"))
+	assert.Equal(t, "HX-Request", full.Header().Get("Vary"))
+
+	partial := render(map[string]string{"HX-Request": "true"})
+	assert.Equal(t, "<li>ada</li>", partial.Body.String())
+	assert.Equal(t, "HX-Request", partial.Header().Get("Vary"))
+
+	restore := render(map[string]string{"HX-Request": "true", "HX-History-Restore-Request": "true"})
+	assert.Equal(t, full.Body.String(), restore.Body.String(), "history restores get the whole page")
+
+	err := engine.RenderHTMX(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), "nope", "rows", nil)
+	assert.Error(t, err)
+}
@@ -117,6 +117,10 @@ func (e *Engine) registerDefaultHelpers() {
 	e.RegisterHelper("present", e.presentHelper)
 	e.RegisterHelper("blank", e.blankHelper)
 	e.RegisterHelper("nil", e.nilHelper)
+
+	// Markdown helpers
+	e.RegisterHelper("markdown", e.markdownHelper)
+	e.RegisterHelper("markdownStyles", e.markdownStylesHelper)
 }
 
 // String helpers
@@ -0,0 +1,240 @@
+package template
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// directivePattern matches the inheritance directives handled before
+// parsing: {{extends "layout"}}, {{append "block"}} and {{prepend "block"}}
+var directivePattern = regexp.MustCompile(`^(extends|append|prepend)\s+"([^"]+)"$`)
+
+// blockExtension is an append or prepend block, which adds to the block its
+// parent layout defines instead of replacing it
+type blockExtension struct {
+	block string
+	mode  string
+}
+
+// composition is a template parsed together with the layouts it inherits
+// from, valid while none of them changes
+type composition struct {
+	key  string
+	tmpl *template.Template
+}
+
+// extensionName names the definition holding part of an extended block
+func extensionName(block, part, owner string) string {
+	return block + ":" + part + ":" + owner
+}
+
+// expandDirectives returns tmpl's content ready for parsing: Markdown pages
+// are converted to HTML, raw blocks are expanded, components are inlined and
+// recorded in tmpl.Includes, the extends directive is recorded in
+// tmpl.Extends and removed, and append and prepend blocks become definitions
+// that compose merges into the parent's block.
+func (e *Engine) expandDirectives(tmpl *Template) (string, error) {
+	left, right := e.config.delims()
+	content := tmpl.Content
+	if isMarkdown(tmpl.Path) {
+		source, err := e.markdownSource(tmpl)
+		if err != nil {
+			return "", err
+		}
+		content = source
+	}
+	content, err := expandRaw(content, left, right)
+	if err != nil {
+		return "", err
+	}
+	x := newComponentExpansion()
+	if content, err = e.expandComponents(content, x); err != nil {
+		return "", err
+	}
+	// Compiled on their own, components render their default slots
+	if tmpl.Type == TypeComponent {
+		if content, err = e.fillSlots(content, nil, ""); err != nil {
+			return "", err
+		}
+	}
+	tmpl.Includes = x.used()
+	tmpl.componentFiles = x.files
+
+	tmpl.Extends = ""
+	tmpl.extensions = nil
+
+	var out strings.Builder
+	for {
+		start, end, inner, ok := nextAction(content, left, right)
+		if !ok {
+			out.WriteString(content)
+			return out.String(), nil
+		}
+		out.WriteString(content[:start])
+
+		m := directivePattern.FindStringSubmatch(strings.TrimSpace(inner))
+		switch {
+		case m == nil:
+			out.WriteString(content[start:end])
+		case m[1] == "extends":
+			tmpl.Extends = m[2]
+		default:
+			tmpl.extensions = append(tmpl.extensions, blockExtension{block: m[2], mode: m[1]})
+			out.WriteString(left + "define " + strconv.Quote(extensionName(m[2], m[1], tmpl.Name)) + right)
+		}
+		content = content[end:]
+	}
+}
+
+// layoutChain returns tmpl preceded by the layouts it inherits from, the
+// outermost first. layoutName, when set, replaces tmpl's own extends.
+func (e *Engine) layoutChain(tmpl *Template, layoutName string) ([]*Template, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	chain := []*Template{tmpl}
+	names := []string{tmpl.Name}
+	parent := layoutName
+	if parent == "" {
+		parent = tmpl.Extends
+	}
+	for parent != "" {
+		layout, exists := e.layouts[parent]
+		if !exists {
+			return nil, fmt.Errorf("layout template %s not found", parent)
+		}
+		names = append(names, layout.Name)
+		for _, t := range chain {
+			if t == layout {
+				return nil, fmt.Errorf("layout inheritance cycle: %s", strings.Join(names, " -> "))
+			}
+		}
+		chain = append([]*Template{layout}, chain...)
+		parent = layout.Extends
+	}
+	return chain, nil
+}
+
+// compose parses chain into one template set executing its outermost
+// layout. Each template's definitions replace those of the layouts above
+// it, except append and prepend blocks, which wrap them.
+func (e *Engine) compose(chain []*Template) (*template.Template, error) {
+	left, right := e.config.delims()
+	funcMap := e.funcMap()
+
+	root := chain[0]
+	set, err := e.newTemplate(root.Name, funcMap).Parse(root.source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile template %s: %w", root.Name, err)
+	}
+
+	for _, child := range chain[1:] {
+		if _, err := set.New(child.Name).Parse(child.source); err != nil {
+			return nil, fmt.Errorf("failed to compile template %s: %w", child.Name, err)
+		}
+
+		for _, ext := range child.extensions {
+			inherited := extensionName(ext.block, "parent", child.Name)
+			if parent := set.Lookup(ext.block); parent != nil && parent.Tree != nil {
+				if _, err := set.AddParseTree(inherited, parent.Tree); err != nil {
+					return nil, err
+				}
+			} else if _, err := set.New(inherited).Parse(""); err != nil {
+				return nil, err
+			}
+
+			first, second := inherited, extensionName(ext.block, ext.mode, child.Name)
+			if ext.mode == "prepend" {
+				first, second = second, first
+			}
+			merged := fmt.Sprintf("%[1]sdefine %[3]q%[2]s%[1]stemplate %[4]q .%[2]s%[1]stemplate %[5]q .%[2]s%[1]send%[2]s",
+				left, right, ext.block, first, second)
+			if _, err := set.New(extensionName(ext.block, "merged", child.Name)).Parse(merged); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return set, nil
+}
+
+// composed returns chain parsed by compose, reusing the previous result
+// until one of the templates is reloaded
+func (e *Engine) composed(chain []*Template) (*template.Template, error) {
+	leaf := chain[len(chain)-1]
+	parts := make([]string, len(chain))
+	for i, t := range chain {
+		parts[i] = t.Name + "@" + t.sourceHash
+	}
+	key := strings.Join(parts, "<")
+
+	e.mu.RLock()
+	cached, exists := e.compositions[leaf.Name]
+	e.mu.RUnlock()
+	if exists && cached.key == key {
+		return cached.tmpl, nil
+	}
+
+	tmpl, err := e.compose(chain)
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	e.compositions[leaf.Name] = &composition{key: key, tmpl: tmpl}
+	e.mu.Unlock()
+	return tmpl, nil
+}
+
+// composedFor returns tmpl parsed together with the layouts it inherits
+// from, recompiling those that changed when auto-reload is on
+func (e *Engine) composedFor(tmpl *Template, layoutName string) (*template.Template, error) {
+	chain, err := e.layoutChain(tmpl, layoutName)
+	if err != nil {
+		return nil, err
+	}
+
+	reloaded := false
+	for _, t := range chain {
+		if e.refresh(t) {
+			reloaded = true
+		}
+	}
+	// A reloaded template may extend a different layout
+	if reloaded {
+		if chain, err = e.layoutChain(tmpl, layoutName); err != nil {
+			return nil, err
+		}
+	}
+
+	return e.composed(chain)
+}
+
+// renderLayout renders tmpl inside the layouts it inherits from. The body
+// tmpl renders outside its block definitions is passed to the layouts as
+// the layout variable.
+func (e *Engine) renderLayout(tmpl *Template, layoutName string, data TemplateData) (string, error) {
+	set, err := e.composedFor(tmpl, layoutName)
+	if err != nil {
+		return "", err
+	}
+
+	if data == nil {
+		data = TemplateData{}
+	}
+	var body bytes.Buffer
+	if err := set.ExecuteTemplate(&body, tmpl.Name, data); err != nil {
+		return "", fmt.Errorf("failed to render template %s: %w", tmpl.Name, err)
+	}
+	data[e.config.LayoutVar] = template.HTML(body.String())
+
+	var buf bytes.Buffer
+	if err := set.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render template %s: %w", tmpl.Name, err)
+	}
+	return buf.String(), nil
+}
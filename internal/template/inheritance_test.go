@@ -0,0 +1,94 @@
+package template
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newLayoutsEngine(t *testing.T, layouts, pages map[string]string) *Engine {
+	t.Helper()
+	config := DefaultConfig()
+	config.LayoutsDir, config.PagesDir = t.TempDir(), t.TempDir()
+	config.PartialsDir, config.ComponentsDir, config.EmailsDir, config.ErrorsDir = "", "", "", ""
+	config.AutoReload = false
+	config.EnableLogging = false
+	for dir, files := range map[string]map[string]string{config.LayoutsDir: layouts, config.PagesDir: pages} {
+		for name, content := range files {
+			path := filepath.Join(dir, name+".html")
+			require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+			require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		}
+	}
+	engine, err := NewEngine(config, nil)
+	require.NoError(t, err)
+	return engine
+}
+
+var nestedLayouts = map[string]string{
+	"base": `<title>{{block "title" .}}Dolphin{{end}}</title>` +
+		`<nav>{{block "nav" .}}public{{end}}</nav>` +
+		`<main>{{block "content" .}}{{.layout}}{{end}}</main>` +
+		`{{block "scripts" .}}<script src="/app.js"></script>{{end}}`,
+	"admin": `{{extends "base"}}` +
+		`{{define "nav"}}admin{{end}}` +
+		`{{define "content"}}<aside>menu</aside>{{block "panel" .}}{{end}}{{end}}` +
+		`{{append "scripts"}}<script src="/admin.js"></script>{{end}}`,
+}
+
+func TestNestedLayouts(t *testing.T) {
+	engine := newLayoutsEngine(t, nestedLayouts, map[string]string{
+		"users": `{{extends "admin"}}` +
+			`{{prepend "title"}}{{.Heading}} | {{end}}` +
+			`{{define "panel"}}<h1>{{.Heading}}</h1>{{end}}` +
+			`{{append "scripts"}}<script src="/users.js"></script>{{end}}`,
+	})
+
+	html, err := engine.Render("users", TemplateData{"Heading": "Users"})
+	require.NoError(t, err)
+	assert.Equal(t, `<title>Users | Dolphin</title>`+
+		`<nav>admin</nav>`+
+		`<main><aside>menu</aside><h1>Users</h1></main>`+
+		`<script src="/app.js"></script><script src="/admin.js"></script><script src="/users.js"></script>`, html)
+
+	// Other pages on the same shell see the admin blocks only
+	html, err = engine.Render("admin", nil)
+	require.NoError(t, err)
+	assert.Equal(t, `<title>Dolphin</title><nav>admin</nav><main><aside>menu</aside></main>`+
+		`<script src="/app.js"></script><script src="/admin.js"></script>`, html)
+}
+
+func TestRenderWithLayoutPassesPageBody(t *testing.T) {
+	engine := newLayoutsEngine(t, nestedLayouts, map[string]string{
+		"about": `<p>About {{.Name}}</p>`,
+	})
+
+	html, err := engine.RenderWithLayout("about", "", TemplateData{"Name": "<Dolphin>"})
+	require.NoError(t, err)
+	assert.Equal(t, `<title>Dolphin</title><nav>public</nav><main><p>About &lt;Dolphin&gt;</p></main>`+
+		`<script src="/app.js"></script>`, html)
+
+	// An explicit layout wins over the default, and may extend another
+	html, err = engine.RenderWithLayout("about", "admin", TemplateData{"Name": "Dolphin"})
+	require.NoError(t, err)
+	assert.Contains(t, html, `<nav>admin</nav>`)
+}
+
+func TestLayoutErrors(t *testing.T) {
+	engine := newLayoutsEngine(t, map[string]string{
+		"a": `{{extends "b"}}`,
+		"b": `{{extends "a"}}`,
+	}, map[string]string{
+		"loop":    `{{extends "a"}}`,
+		"missing": `{{extends "nowhere"}}`,
+	})
+
+	_, err := engine.Render("loop", nil)
+	assert.EqualError(t, err, "layout inheritance cycle: loop -> a -> b -> a")
+
+	_, err = engine.Render("missing", nil)
+	assert.EqualError(t, err, "layout template nowhere not found")
+}
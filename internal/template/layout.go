@@ -61,26 +61,27 @@ func (lm *LayoutManager) parseLayoutContent(layout *Layout) error {
 	lines := strings.Split(layout.Content, "\n")
 	var currentBlock string
 	var blockContent []string
+	left, _ := lm.engine.config.delims()
 
 	for i, line := range lines {
 		line = strings.TrimSpace(line)
 
 		// Parse extends directive
-		if strings.HasPrefix(line, "{{extends") {
+		if strings.HasPrefix(line, left+"extends") {
 			extends := lm.extractDirective(line, "extends")
 			layout.Extends = extends
 			continue
 		}
 
 		// Parse include directive
-		if strings.HasPrefix(line, "{{include") {
+		if strings.HasPrefix(line, left+"include") {
 			include := lm.extractDirective(line, "include")
 			layout.Includes = append(layout.Includes, include)
 			continue
 		}
 
 		// Parse block start
-		if strings.HasPrefix(line, "{{block") {
+		if strings.HasPrefix(line, left+"block") {
 			// Save previous block
 			if currentBlock != "" {
 				layout.Blocks[currentBlock] = strings.Join(blockContent, "\n")
@@ -94,7 +95,7 @@ func (lm *LayoutManager) parseLayoutContent(layout *Layout) error {
 		}
 
 		// Parse block end
-		if strings.HasPrefix(line, "{{endblock") {
+		if strings.HasPrefix(line, left+"endblock") {
 			if currentBlock != "" {
 				layout.Blocks[currentBlock] = strings.Join(blockContent, "\n")
 				currentBlock = ""
@@ -160,7 +161,7 @@ func (lm *LayoutManager) compileLayout(layout *Layout) error {
 	funcMap["extends"] = lm.extendsHelper(layout)
 
 	// Compile template
-	compiled, err := template.New(layout.Name).Funcs(funcMap).Parse(layout.Content)
+	compiled, err := lm.engine.parse(layout.Name, layout.Content, funcMap)
 	if err != nil {
 		return err
 	}
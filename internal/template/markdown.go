@@ -0,0 +1,199 @@
+package template
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/util"
+	"gopkg.in/yaml.v3"
+)
+
+// markdownExtension marks page templates written in Markdown
+const markdownExtension = ".md"
+
+// MarkdownConfig controls how Markdown pages and the markdown helper are
+// rendered
+type MarkdownConfig struct {
+	// HighlightStyle is the Chroma style the markdownStyles helper writes
+	// CSS for, e.g. "github" or "monokai"
+	HighlightStyle string `yaml:"highlight_style" json:"highlight_style"`
+
+	// Unsafe keeps raw HTML such as scripts and iframes, for trusted
+	// content only; otherwise HTML is sanitized
+	Unsafe bool `yaml:"unsafe" json:"unsafe"`
+}
+
+// Markdown renders CommonMark with GitHub's tables, task lists,
+// strikethrough and autolinks, highlights fenced code blocks and sanitizes
+// the result
+type Markdown struct {
+	md     goldmark.Markdown
+	policy *bluemonday.Policy
+	style  *chroma.Style
+}
+
+// NewMarkdown creates a Markdown renderer
+func NewMarkdown(config MarkdownConfig) *Markdown {
+	style := styles.Get(config.HighlightStyle)
+	m := &Markdown{
+		md: goldmark.New(
+			goldmark.WithExtensions(extension.GFM),
+			goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+			goldmark.WithRendererOptions(
+				// Raw HTML is kept here and sanitized afterwards
+				html.WithUnsafe(),
+				renderer.WithNodeRenderers(util.Prioritized(codeBlockRenderer{}, 100)),
+			),
+		),
+		style: style,
+	}
+	if !config.Unsafe {
+		m.policy = markdownPolicy()
+	}
+	return m
+}
+
+// markdownPolicy allows what Markdown produces, with the classes code
+// highlighting uses and the checkboxes of task lists
+func markdownPolicy() *bluemonday.Policy {
+	policy := bluemonday.UGCPolicy()
+	policy.AllowAttrs("class").Matching(regexp.MustCompile(`^[\w\- ]+$`)).OnElements("pre", "code", "span")
+	policy.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	policy.AllowAttrs("checked", "disabled").OnElements("input")
+	return policy
+}
+
+// Render converts Markdown to HTML
+func (m *Markdown) Render(source []byte) (template.HTML, error) {
+	var buf bytes.Buffer
+	if err := m.md.Convert(source, &buf); err != nil {
+		return "", err
+	}
+	if m.policy == nil {
+		return template.HTML(buf.String()), nil
+	}
+	return template.HTML(m.policy.SanitizeBytes(buf.Bytes())), nil
+}
+
+// CSS returns the stylesheet for highlighted code blocks
+func (m *Markdown) CSS() (template.CSS, error) {
+	var buf bytes.Buffer
+	if err := chromahtml.New(chromahtml.WithClasses(true)).WriteCSS(&buf, m.style); err != nil {
+		return "", err
+	}
+	return template.CSS(buf.String()), nil
+}
+
+// codeBlockRenderer highlights fenced code blocks in languages Chroma
+// knows, marking the others with their language for client-side
+// highlighters
+type codeBlockRenderer struct{}
+
+func (r codeBlockRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindFencedCodeBlock, r.render)
+}
+
+func (codeBlockRenderer) render(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkSkipChildren, nil
+	}
+	block := node.(*ast.FencedCodeBlock)
+	language := string(block.Language(source))
+	var code bytes.Buffer
+	lines := block.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		code.Write(line.Value(source))
+	}
+
+	if lexer := lexers.Get(language); lexer != nil && language != "" {
+		iterator, err := chroma.Coalesce(lexer).Tokenise(nil, code.String())
+		if err == nil {
+			err = chromahtml.New(chromahtml.WithClasses(true)).Format(w, styles.Fallback, iterator)
+		}
+		return ast.WalkSkipChildren, err
+	}
+
+	w.WriteString("<pre><code")
+	if language != "" {
+		w.WriteString(` class="language-` + template.HTMLEscapeString(language) + `"`)
+	}
+	w.WriteString(">")
+	w.WriteString(template.HTMLEscapeString(code.String()))
+	w.WriteString("</code></pre>\n")
+	return ast.WalkSkipChildren, nil
+}
+
+// isMarkdown reports whether path is a Markdown page
+func isMarkdown(path string) bool {
+	return filepath.Ext(path) == markdownExtension
+}
+
+// frontMatterPattern matches YAML front matter between --- lines at the
+// start of a Markdown page
+var frontMatterPattern = regexp.MustCompile(`(?s)\A---\r?\n(.*?)\r?\n---\r?\n?`)
+
+// markdownSource converts a Markdown page to template source. Its front
+// matter is kept in tmpl.Meta; a layout there is extended and a title
+// fills the layout's title block. The HTML is output as it is, so template
+// actions in the Markdown are not run.
+func (e *Engine) markdownSource(tmpl *Template) (string, error) {
+	content := tmpl.Content
+	tmpl.Meta = nil
+	if m := frontMatterPattern.FindStringSubmatchIndex(content); m != nil {
+		if err := yaml.Unmarshal([]byte(content[m[2]:m[3]]), &tmpl.Meta); err != nil {
+			return "", fmt.Errorf("front matter: %w", err)
+		}
+		content = content[m[1]:]
+	}
+
+	body, err := e.markdown.Render([]byte(content))
+	if err != nil {
+		return "", err
+	}
+
+	left, right := e.config.delims()
+	literal := func(s string) string {
+		return strings.ReplaceAll(s, left, left+strconv.Quote(left)+right)
+	}
+	var source strings.Builder
+	if layout, ok := tmpl.Meta["layout"].(string); ok && layout != "" {
+		source.WriteString(left + "extends " + strconv.Quote(layout) + right)
+	}
+	if title, ok := tmpl.Meta["title"].(string); ok && title != "" {
+		source.WriteString(left + `define "title"` + right + literal(template.HTMLEscapeString(title)) + left + "end" + right)
+	}
+	source.WriteString(literal(string(body)))
+	return source.String(), nil
+}
+
+// markdownHelper renders its argument as sanitized Markdown:
+// {{markdown .Post.Body}}
+func (e *Engine) markdownHelper(args ...interface{}) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("markdown expects 1 argument, got %d", len(args))
+	}
+	return e.markdown.Render([]byte(fmt.Sprint(args[0])))
+}
+
+// markdownStylesHelper returns the CSS for highlighted code:
+// <style>{{markdownStyles}}</style>
+func (e *Engine) markdownStylesHelper(args ...interface{}) (interface{}, error) {
+	return e.markdown.CSS()
+}
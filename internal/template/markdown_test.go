@@ -0,0 +1,78 @@
+package template
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarkdownRender(t *testing.T) {
+	md := NewMarkdown(MarkdownConfig{HighlightStyle: "github"})
+
+	html, err := md.Render([]byte("# Guide\n\n| Name | Size |\n|------|------|\n| a    | 1    |\n\n- [x] done\n\n```go\nfunc main() {}\n```\n\n```unknownlang\n<b>raw</b>\n```\n"))
+	require.NoError(t, err)
+	out := string(html)
+	assert.Contains(t, out, `<h1 id="guide">Guide</h1>`)
+	assert.Contains(t, out, "<table>")
+	assert.Contains(t, out, "<td>a</td>")
+	assert.Contains(t, out, `<input checked="" disabled="" type="checkbox"`)
+	assert.Contains(t, out, `<pre class="chroma">`)
+	assert.Contains(t, out, `<span class="kd">func</span>`)
+	assert.Contains(t, out, `<code class="language-unknownlang">&lt;b&gt;raw&lt;/b&gt;`)
+
+	html, err = md.Render([]byte(`Hi <script>alert(1)</script><a href="javascript:alert(1)" onclick="x()">link</a> <em>ok</em>`))
+	require.NoError(t, err)
+	out = string(html)
+	assert.NotContains(t, out, "<script")
+	assert.NotContains(t, out, "onclick")
+	assert.NotContains(t, out, "javascript:")
+	assert.Contains(t, out, "<em>ok</em>")
+
+	html, err = NewMarkdown(MarkdownConfig{Unsafe: true}).Render([]byte(`<iframe src="/embed"></iframe>`))
+	require.NoError(t, err)
+	assert.Contains(t, string(html), `<iframe src="/embed"></iframe>`)
+
+	css, err := md.CSS()
+	require.NoError(t, err)
+	assert.Contains(t, string(css), ".chroma")
+}
+
+func TestMarkdownHelper(t *testing.T) {
+	engine := newLayoutsEngine(t, nil, map[string]string{
+		"post": `<article>{{markdown .Body}}</article>`,
+	})
+
+	html, err := engine.Render("post", TemplateData{"Body": "**bold** <img src=x onerror=alert(1)>"})
+	require.NoError(t, err)
+	assert.Equal(t, "<article><p><strong>bold</strong> <img src=\"x\"></p>\n</article>", html)
+}
+
+func TestMarkdownPages(t *testing.T) {
+	engine := newLayoutsEngine(t, map[string]string{
+		"base": `<title>{{block "title" .}}Dolphin{{end}}</title><main>{{.layout}}</main>`,
+	}, nil)
+	pages := engine.config.PagesDir
+	require.NoError(t, os.MkdirAll(filepath.Join(pages, "docs"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(pages, "docs", "install.md"), []byte(
+		"---\nlayout: base\ntitle: Installing <Dolphin>\ndraft: true\n---\n# Install\n\nRun `{{ .Secret }}` as-is.\n"), 0644))
+	require.NoError(t, engine.LoadTemplates())
+
+	page, ok := engine.GetTemplate("docs.install")
+	require.True(t, ok)
+	assert.Equal(t, true, page.Meta["draft"])
+
+	html, err := engine.Render("docs/install", TemplateData{"Secret": "leaked"})
+	require.NoError(t, err)
+	assert.Equal(t, "<title>Installing &lt;Dolphin&gt;</title>"+
+		"<main><h1 id=\"install\">Install</h1>\n<p>Run <code>{{ .Secret }}</code> as-is.</p>\n</main>", html)
+
+	// Without a layout in the front matter, pages use the default one
+	require.NoError(t, os.WriteFile(filepath.Join(pages, "about.md"), []byte("About *us*\n"), 0644))
+	require.NoError(t, engine.LoadTemplates())
+	html, err = engine.RenderWithLayout("about", "", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "<title>Dolphin</title><main><p>About <em>us</em></p>\n</main>", html)
+}
@@ -0,0 +1,51 @@
+package template
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// NamespaceSeparator joins a namespace to the names of its pages, as in
+// billing::index or billing::invoices.show
+const NamespaceSeparator = "::"
+
+// namespaceOf returns the namespace whose directory holds path, preferring
+// the deepest directory when they nest
+func (c *Config) namespaceOf(path string) (string, string, bool) {
+	namespace, dir := "", ""
+	for ns, nsDir := range c.Namespaces {
+		if inDir(path, nsDir) && len(nsDir) > len(dir) {
+			namespace, dir = ns, nsDir
+		}
+	}
+	return namespace, dir, dir != ""
+}
+
+// namespaceDirs returns the namespaces' directories in namespace order
+func (c *Config) namespaceDirs() []string {
+	namespaces := make([]string, 0, len(c.Namespaces))
+	for ns, dir := range c.Namespaces {
+		if dir != "" {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	sort.Strings(namespaces)
+
+	dirs := make([]string, len(namespaces))
+	for i, ns := range namespaces {
+		dirs[i] = c.Namespaces[ns]
+	}
+	return dirs
+}
+
+// namespacedName names a page in a namespace's directory after its path
+// there, prefixed by the namespace
+func (e *Engine) namespacedName(namespace, dir, path string) string {
+	relPath, err := filepath.Rel(dir, path)
+	if err != nil {
+		relPath = path
+	}
+	name := strings.TrimSuffix(strings.TrimSuffix(relPath, e.config.Extension), markdownExtension)
+	return namespace + NamespaceSeparator + strings.ReplaceAll(name, string(filepath.Separator), ".")
+}
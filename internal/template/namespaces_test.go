@@ -0,0 +1,55 @@
+package template
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNamespacedPages(t *testing.T) {
+	billing := t.TempDir()
+	for name, content := range map[string]string{
+		"index.html":         `<h1>Invoices</h1>`,
+		"invoices/show.html": `{{extends "base"}}{{define "content"}}Invoice {{.Number}}{{end}}`,
+	} {
+		path := filepath.Join(billing, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	config := DefaultConfig()
+	config.LayoutsDir, config.PagesDir = t.TempDir(), t.TempDir()
+	config.PartialsDir, config.ComponentsDir, config.EmailsDir, config.ErrorsDir = "", "", "", ""
+	config.Namespaces = map[string]string{
+		"billing":  billing,
+		"shipping": filepath.Join(t.TempDir(), "missing"),
+	}
+	config.AutoReload = false
+	config.EnableLogging = false
+	require.NoError(t, os.WriteFile(filepath.Join(config.LayoutsDir, "base.html"),
+		[]byte(`<main>{{block "content" .}}{{end}}</main>`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(config.PagesDir, "index.html"), []byte(`<h1>Home</h1>`), 0644))
+
+	engine, err := NewEngine(config, nil)
+	require.NoError(t, err)
+
+	// The application's index and the module's don't collide
+	html, err := engine.Render("index", nil)
+	require.NoError(t, err)
+	assert.Equal(t, `<h1>Home</h1>`, html)
+	html, err = engine.Render("billing::index", nil)
+	require.NoError(t, err)
+	assert.Equal(t, `<h1>Invoices</h1>`, html)
+
+	// Module pages may extend the application's layouts
+	html, err = engine.Render("billing::invoices/show", TemplateData{"Number": 42})
+	require.NoError(t, err)
+	assert.Equal(t, `<main>Invoice 42</main>`, html)
+
+	pages := engine.GetTemplatesByType(TypePage)
+	assert.Contains(t, pages, "billing::invoices.show")
+	assert.Len(t, pages, 3)
+}
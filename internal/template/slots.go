@@ -0,0 +1,502 @@
+package template
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Components are expanded into the templates using them when those are
+// compiled. A page writes a component as a tag, passing props as attributes
+// and slot content in its body:
+//
+//	<x-card title="Team" :members=".Members" compact>
+//		<p>{{len .Members}} people</p>
+//		<x-slot name="footer"><a href="/team">All</a></x-slot>
+//	</x-card>
+//
+// Plain attributes are strings, those starting with a colon are template
+// expressions and bare ones are true. {{component "card" .Card}} inserts a
+// component with a value as its props and no slots.
+//
+// The component template, components/card.html, sees only its props as
+// dot, and places the content it is given with {{slot}} for the body and
+// {{slot "footer"}} for a named slot. {{slot "footer"}}...{{endslot}} gives
+// default content for when none is passed, and hasSlot "footer" reports
+// whether it was. Slot content is rendered with the page's data, so it can
+// use the page's fields and other components.
+
+// componentTagPattern matches the start of a component tag, <x-card
+var componentTagPattern = regexp.MustCompile(`<x-([A-Za-z0-9][\w.-]*)`)
+
+// componentActionPattern matches {{component "name" value}}
+var componentActionPattern = regexp.MustCompile(`^component\s+"([^"]+)"\s*(.*)$`)
+
+// slotActionPattern matches {{slot}} and {{slot "name"}}
+var slotActionPattern = regexp.MustCompile(`^slot(?:\s+"([^"]+)")?$`)
+
+// hasSlotPattern matches hasSlot "name" within an action
+var hasSlotPattern = regexp.MustCompile(`\bhasSlot\s+"([^"]+)"`)
+
+// componentAttrPattern matches one attribute of a component tag
+var componentAttrPattern = regexp.MustCompile(`^\s*([:@]?[A-Za-z_][\w:.-]*)(?:\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>/]+)))?`)
+
+// defaultSlot names the content of a component tag outside named slots
+const defaultSlot = "default"
+
+// componentAttr is an attribute of a component tag; bare ones, such as
+// compact in <x-card compact>, have no value
+type componentAttr struct {
+	name, value string
+	bare        bool
+}
+
+// componentExpansion tracks the components inlined into one template
+type componentExpansion struct {
+	// files are the component files used, with their modification times
+	files map[string]time.Time
+	names map[string]bool
+	// stack holds the components being expanded, to catch cycles
+	stack []string
+	// vars numbers the variables holding callers' data
+	vars int
+}
+
+func newComponentExpansion() *componentExpansion {
+	return &componentExpansion{files: map[string]time.Time{}, names: map[string]bool{}}
+}
+
+// used returns the names of the components inlined, sorted
+func (x *componentExpansion) used() []string {
+	names := make([]string, 0, len(x.names))
+	for name := range x.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// componentSource reads a component template by name, e.g. forms.input for
+// components/forms/input.html
+func (e *Engine) componentSource(name string, x *componentExpansion) (string, bool, error) {
+	if e.config.ComponentsDir == "" {
+		return "", false, nil
+	}
+	path := filepath.Join(e.config.ComponentsDir, filepath.FromSlash(strings.ReplaceAll(templateName(name), ".", "/"))+e.config.Extension)
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", false, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, err
+	}
+	left, right := e.config.delims()
+	source, err := expandRaw(string(content), left, right)
+	if err != nil {
+		return "", false, fmt.Errorf("component %s: %w", name, err)
+	}
+	x.files[path] = info.ModTime()
+	x.names[templateName(name)] = true
+	return source, true, nil
+}
+
+// expandComponents inlines the component tags and component actions in
+// content. Tags naming no component are left as they are, for custom
+// elements.
+func (e *Engine) expandComponents(content string, x *componentExpansion) (string, error) {
+	content, err := e.expandComponentTags(content, x)
+	if err != nil {
+		return "", err
+	}
+	return e.expandComponentActions(content, x)
+}
+
+// expandComponentTags inlines each <x-name> tag in content
+func (e *Engine) expandComponentTags(content string, x *componentExpansion) (string, error) {
+	var out strings.Builder
+	for {
+		m := componentTagPattern.FindStringSubmatchIndex(content)
+		if m == nil {
+			out.WriteString(content)
+			return out.String(), nil
+		}
+		name := content[m[2]:m[3]]
+		if name == "slot" {
+			return "", fmt.Errorf("<x-slot> is outside a component tag")
+		}
+		tagEnd, attrs, selfClosing, err := parseComponentTag(content[m[1]:])
+		if err != nil {
+			return "", fmt.Errorf("<x-%s>: %w", name, err)
+		}
+		tagEnd += m[1]
+
+		source, found, err := e.componentSource(name, x)
+		if err != nil {
+			return "", err
+		}
+		if !found {
+			out.WriteString(content[:m[1]])
+			content = content[m[1]:]
+			continue
+		}
+
+		body, after := "", tagEnd
+		if !selfClosing {
+			bodyEnd, closeEnd, ok := matchingClose(content[tagEnd:], "x-"+name)
+			if !ok {
+				return "", fmt.Errorf("<x-%s> is not closed with </x-%s>", name, name)
+			}
+			body, after = content[tagEnd:tagEnd+bodyEnd], tagEnd+closeEnd
+		}
+		slots, err := splitSlots(body)
+		if err != nil {
+			return "", fmt.Errorf("<x-%s>: %w", name, err)
+		}
+		props, err := e.componentProps(attrs)
+		if err != nil {
+			return "", fmt.Errorf("<x-%s>: %w", name, err)
+		}
+
+		inlined, err := e.inlineComponent(name, source, props, slots, x)
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(content[:m[0]])
+		out.WriteString(inlined)
+		content = content[after:]
+	}
+}
+
+// expandComponentActions inlines each {{component "name" value}} action in
+// content
+func (e *Engine) expandComponentActions(content string, x *componentExpansion) (string, error) {
+	left, right := e.config.delims()
+	var out strings.Builder
+	for {
+		start, end, inner, ok := nextAction(content, left, right)
+		if !ok {
+			out.WriteString(content)
+			return out.String(), nil
+		}
+		m := componentActionPattern.FindStringSubmatch(strings.TrimSpace(inner))
+		if m == nil {
+			out.WriteString(content[:end])
+			content = content[end:]
+			continue
+		}
+		source, found, err := e.componentSource(m[1], x)
+		if err != nil {
+			return "", err
+		}
+		if !found {
+			return "", fmt.Errorf("component %s not found", m[1])
+		}
+		value := "."
+		if strings.TrimSpace(m[2]) != "" {
+			value = "(" + m[2] + ")"
+		}
+		inlined, err := e.inlineComponent(m[1], source, "componentScope "+value, nil, x)
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(content[:start])
+		out.WriteString(inlined)
+		content = content[end:]
+	}
+}
+
+// inlineComponent returns a component's source ready to be placed in its
+// caller: ranging once over props makes them dot, and the slots are
+// rendered with the caller's data, held in a variable
+func (e *Engine) inlineComponent(name, source, props string, slots map[string]string, x *componentExpansion) (string, error) {
+	// Components used in the slots are the caller's
+	for slot, content := range slots {
+		expanded, err := e.expandComponents(content, x)
+		if err != nil {
+			return "", err
+		}
+		slots[slot] = expanded
+	}
+
+	// and those used by the component are its own
+	for _, caller := range x.stack {
+		if caller == name {
+			return "", fmt.Errorf("component %s nests itself: %s -> %s", name, strings.Join(x.stack, " -> "), name)
+		}
+	}
+	x.stack = append(x.stack, name)
+	defer func() { x.stack = x.stack[:len(x.stack)-1] }()
+	source, err := e.expandComponents(source, x)
+	if err != nil {
+		return "", fmt.Errorf("component %s: %w", name, err)
+	}
+
+	left, right := e.config.delims()
+	x.vars++
+	caller := fmt.Sprintf("$componentCaller%d", x.vars)
+	source, err = e.fillSlots(source, slots, caller)
+	if err != nil {
+		return "", fmt.Errorf("component %s: %w", name, err)
+	}
+	return left + caller + " := ." + right + left + "range " + props + right + source + left + "end" + right, nil
+}
+
+// fillSlots replaces the slot directives in a component's source with the
+// content given for them, rendered with the data in the variable caller, or
+// with their defaults. Without a caller, the content is rendered with the
+// component's own data.
+func (e *Engine) fillSlots(source string, slots map[string]string, caller string) (string, error) {
+	left, right := e.config.delims()
+	var out strings.Builder
+	for {
+		start, end, inner, ok := nextAction(source, left, right)
+		if !ok {
+			out.WriteString(source)
+			return out.String(), nil
+		}
+		out.WriteString(source[:start])
+		action := strings.TrimSpace(inner)
+
+		if action == "endslot" {
+			return "", fmt.Errorf("%sendslot%s without %sslot%s", left, right, left, right)
+		}
+		m := slotActionPattern.FindStringSubmatch(action)
+		if m == nil {
+			out.WriteString(left + hasSlotPattern.ReplaceAllStringFunc(inner, func(s string) string {
+				return strconv.FormatBool(slots[hasSlotPattern.FindStringSubmatch(s)[1]] != "")
+			}) + right)
+			source = source[end:]
+			continue
+		}
+
+		name := m[1]
+		if name == "" {
+			name = defaultSlot
+		}
+		source = source[end:]
+		fallback := ""
+		if closeStart, closeEnd, ok := endOfSlot(source, left, right); ok {
+			fallback, source = source[:closeStart], source[closeEnd:]
+		}
+
+		content, given := slots[name]
+		switch {
+		case !given || content == "":
+			filled, err := e.fillSlots(fallback, slots, caller)
+			if err != nil {
+				return "", err
+			}
+			out.WriteString(filled)
+		case caller == "":
+			out.WriteString(content)
+		default:
+			out.WriteString(left + "range componentScope " + caller + right + content + left + "end" + right)
+		}
+	}
+}
+
+// endOfSlot returns the bounds of the {{endslot}} closing the slot whose
+// directive content follows, or false when the next slot directive is
+// another slot, making this one empty by default
+func endOfSlot(content, left, right string) (int, int, bool) {
+	offset := 0
+	for {
+		start, end, inner, ok := nextAction(content[offset:], left, right)
+		if !ok {
+			return 0, 0, false
+		}
+		action := strings.TrimSpace(inner)
+		if action == "endslot" {
+			return offset + start, offset + end, true
+		}
+		if slotActionPattern.MatchString(action) {
+			return 0, 0, false
+		}
+		offset += end
+	}
+}
+
+// componentProps returns the pipeline making a component's props from the
+// attributes of its tag
+func (e *Engine) componentProps(attrs []componentAttr) (string, error) {
+	left, _ := e.config.delims()
+	args := []string{"componentProps"}
+	for _, attr := range attrs {
+		name, value := attr.name, attr.value
+		switch {
+		case strings.HasPrefix(name, ":"):
+			if strings.TrimSpace(value) == "" {
+				return "", fmt.Errorf("attribute %s has no expression", name)
+			}
+			args = append(args, strconv.Quote(name[1:]), "("+value+")")
+		case attr.bare:
+			args = append(args, strconv.Quote(name), "true")
+		case strings.Contains(value, left):
+			return "", fmt.Errorf("attribute %s holds an action; write :%s with an expression instead", name, name)
+		default:
+			args = append(args, strconv.Quote(name), strconv.Quote(value))
+		}
+	}
+	return strings.Join(args, " "), nil
+}
+
+// parseComponentTag reads the attributes of a tag whose name has been read,
+// returning where the tag ends and whether it closes itself
+func parseComponentTag(content string) (int, []componentAttr, bool, error) {
+	var attrs []componentAttr
+	i := 0
+	for {
+		rest := content[i:]
+		trimmed := strings.TrimLeft(rest, " \t\r\n")
+		i += len(rest) - len(trimmed)
+		switch {
+		case strings.HasPrefix(trimmed, "/>"):
+			return i + 2, attrs, true, nil
+		case strings.HasPrefix(trimmed, ">"):
+			return i + 1, attrs, false, nil
+		}
+		m := componentAttrPattern.FindStringSubmatchIndex(trimmed)
+		if m == nil {
+			return 0, nil, false, fmt.Errorf("tag is not closed with >")
+		}
+		attr := componentAttr{name: trimmed[m[2]:m[3]], bare: true}
+		for group := 2; group <= 4; group++ {
+			if m[2*group] >= 0 {
+				attr.value, attr.bare = trimmed[m[2*group]:m[2*group+1]], false
+			}
+		}
+		attrs = append(attrs, attr)
+		i += m[1]
+	}
+}
+
+// matchingClose returns the bounds of the </tag> closing the tag whose body
+// content starts, skipping tags of the same name nested in it
+func matchingClose(content, tag string) (int, int, bool) {
+	open, closing := "<"+tag, "</"+tag+">"
+	depth, offset := 0, 0
+	for {
+		nextClose := strings.Index(content[offset:], closing)
+		if nextClose < 0 {
+			return 0, 0, false
+		}
+		nextOpen := indexOpenTag(content[offset:], open)
+		if nextOpen >= 0 && nextOpen < nextClose {
+			end, _, selfClosing, err := parseComponentTag(content[offset+nextOpen+len(open):])
+			if err != nil {
+				return 0, 0, false
+			}
+			if !selfClosing {
+				depth++
+			}
+			offset += nextOpen + len(open) + end
+			continue
+		}
+		if depth == 0 {
+			return offset + nextClose, offset + nextClose + len(closing), true
+		}
+		depth--
+		offset += nextClose + len(closing)
+	}
+}
+
+// indexOpenTag returns where the tag open starts in content, not counting
+// longer names it is a prefix of
+func indexOpenTag(content, open string) int {
+	offset := 0
+	for {
+		i := strings.Index(content[offset:], open)
+		if i < 0 {
+			return -1
+		}
+		next := offset + i + len(open)
+		if next >= len(content) || strings.ContainsRune(" \t\r\n/>", rune(content[next])) {
+			return offset + i
+		}
+		offset = next
+	}
+}
+
+// splitSlots separates the named slots in a component tag's body from the
+// rest, which is the default slot. Slots of components nested in the body
+// are left to them.
+func splitSlots(body string) (map[string]string, error) {
+	slots := map[string]string{}
+	var rest strings.Builder
+	for {
+		m := componentTagPattern.FindStringSubmatchIndex(body)
+		if m == nil {
+			rest.WriteString(body)
+			break
+		}
+		name := body[m[2]:m[3]]
+		tagEnd, attrs, selfClosing, err := parseComponentTag(body[m[1]:])
+		if err != nil {
+			return nil, fmt.Errorf("<x-%s>: %w", name, err)
+		}
+		tagEnd += m[1]
+		after := tagEnd
+		bodyEnd := tagEnd
+		if !selfClosing {
+			end, closeEnd, ok := matchingClose(body[tagEnd:], "x-"+name)
+			if !ok {
+				return nil, fmt.Errorf("<x-%s> is not closed with </x-%s>", name, name)
+			}
+			bodyEnd, after = tagEnd+end, tagEnd+closeEnd
+		}
+		if name != "slot" {
+			rest.WriteString(body[:after])
+			body = body[after:]
+			continue
+		}
+
+		slot := ""
+		for _, attr := range attrs {
+			if attr.name == "name" {
+				slot = attr.value
+			}
+		}
+		if slot == "" {
+			return nil, fmt.Errorf("<x-slot> needs a name")
+		}
+		if _, exists := slots[slot]; exists {
+			return nil, fmt.Errorf("slot %s is given twice", slot)
+		}
+		rest.WriteString(body[:m[0]])
+		slots[slot] = body[tagEnd:bodyEnd]
+		body = body[after:]
+	}
+	if content := rest.String(); strings.TrimSpace(content) != "" {
+		slots[defaultSlot] = content
+	}
+	return slots, nil
+}
+
+// componentProps collects a component's props from name/value pairs,
+// ranged over once to make them dot
+func componentProps(pairs ...interface{}) ([]TemplateData, error) {
+	if len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("componentProps expects name/value pairs")
+	}
+	props := TemplateData{}
+	for i := 0; i < len(pairs); i += 2 {
+		name, ok := pairs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("componentProps: prop name %v is not a string", pairs[i])
+		}
+		props[name] = pairs[i+1]
+	}
+	return []TemplateData{props}, nil
+}
+
+// componentScope wraps value to be ranged over once, making it dot even
+// when it is empty
+func componentScope(value interface{}) []interface{} {
+	return []interface{}{value}
+}
@@ -0,0 +1,153 @@
+package template
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testComponents = map[string]string{
+	"card": `<div class="card{{if .compact}} compact{{end}}">` +
+		`<h2>{{.title}}</h2>{{.secret}}` +
+		`<div class="body">{{slot}}</div>` +
+		`{{if hasSlot "footer"}}<footer>{{slot "footer"}}</footer>{{end}}` +
+		`<aside>{{slot "aside"}}No aside{{endslot}}</aside></div>`,
+	"badge":       `<span class="badge">{{.Label}}</span>`,
+	"forms.field": `<label>{{.label}} <x-badge :Label=".label" /></label>{{slot}}`,
+	"panel":       `<section><x-card :title=".heading">{{slot}}<x-slot name="footer">{{.heading}}</x-slot></x-card></section>`,
+	"loop":        `<x-loop />`,
+}
+
+func newComponentsEngine(t *testing.T, components, pages map[string]string) *Engine {
+	t.Helper()
+	config := DefaultConfig()
+	config.ComponentsDir, config.PagesDir = t.TempDir(), t.TempDir()
+	config.LayoutsDir, config.PartialsDir, config.EmailsDir, config.ErrorsDir = "", "", "", ""
+	config.AutoReload = false
+	config.EnableLogging = false
+	for dir, files := range map[string]map[string]string{config.ComponentsDir: components, config.PagesDir: pages} {
+		for name, content := range files {
+			path := filepath.Join(dir, strings.ReplaceAll(name, ".", "/")+".html")
+			require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+			require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		}
+	}
+	engine, err := NewEngine(config, nil)
+	require.NoError(t, err)
+	return engine
+}
+
+func TestComponentSlots(t *testing.T) {
+	engine := newComponentsEngine(t, testComponents, map[string]string{
+		"team": `<x-card title="Team" :count="len .Members" compact>` +
+			`<p>{{.Name}} has {{len .Members}}</p>` +
+			`<x-slot name="footer"><a href="/team?n={{.Name}}">All</a></x-slot>` +
+			`</x-card>`,
+		"plain": `<x-card title="Plain"/>`,
+	})
+	data := TemplateData{"Name": "Ops & Co", "Members": []string{"a", "b"}, "secret": "leaked"}
+
+	html, err := engine.Render("team", data)
+	require.NoError(t, err)
+	assert.Equal(t, `<div class="card compact"><h2>Team</h2>`+
+		`<div class="body"><p>Ops &amp; Co has 2</p></div>`+
+		`<footer><a href="/team?n=Ops%20%26%20Co">All</a></footer>`+
+		`<aside>No aside</aside></div>`, html, "the page's data stays out of the component")
+
+	html, err = engine.Render("plain", data)
+	require.NoError(t, err)
+	assert.Equal(t, `<div class="card"><h2>Plain</h2><div class="body"></div><aside>No aside</aside></div>`, html)
+
+	page, _ := engine.GetTemplate("team")
+	assert.Equal(t, []string{"card"}, page.Includes)
+
+	// Compiled on its own, a component renders its defaults
+	html, err = engine.RenderComponent("card", TemplateData{"title": "Alone"})
+	require.NoError(t, err)
+	assert.Equal(t, `<div class="card"><h2>Alone</h2><div class="body"></div><aside>No aside</aside></div>`, html)
+}
+
+func TestNestedComponents(t *testing.T) {
+	engine := newComponentsEngine(t, testComponents, map[string]string{
+		"settings": `<x-panel heading="Settings">` +
+			`<x-forms.field label="Email"><input value="{{.Email}}"></x-forms.field>` +
+			`<x-card title="Inner"><x-slot name="aside">{{.Email}}</x-slot></x-card>` +
+			`</x-panel>` +
+			`{{component "badge" .Badge}}<x-unknown a="1">{{.Email}}</x-unknown>`,
+	})
+
+	html, err := engine.Render("settings", TemplateData{"Email": "a@b.c", "Badge": map[string]string{"Label": "new"}})
+	require.NoError(t, err)
+	assert.Equal(t, `<section><div class="card"><h2>Settings</h2>`+
+		`<div class="body">`+
+		`<label>Email <span class="badge">Email</span></label><input value="a@b.c">`+
+		`<div class="card"><h2>Inner</h2><div class="body"></div><aside>a@b.c</aside></div>`+
+		`</div>`+
+		`<footer>Settings</footer><aside>No aside</aside></div></section>`+
+		`<span class="badge">new</span><x-unknown a="1">a@b.c</x-unknown>`, html)
+
+	page, _ := engine.GetTemplate("settings")
+	assert.Equal(t, []string{"badge", "card", "forms.field", "panel"}, page.Includes)
+
+	broken := newComponentsEngine(t, testComponents, map[string]string{"broken": `<x-loop />`})
+	_, ok := broken.GetTemplate("broken")
+	assert.False(t, ok)
+	require.Len(t, broken.failed, 2)
+	for _, err := range broken.failed {
+		assert.ErrorContains(t, err, "component loop nests itself")
+	}
+}
+
+func TestComponentErrors(t *testing.T) {
+	engine := newComponentsEngine(t, testComponents, nil)
+	for source, message := range map[string]string{
+		`<x-card title="{{.Title}}"/>`:                          "write :title with an expression",
+		`<x-card>open`:                                          "is not closed with </x-card>",
+		`<x-slot name="footer">x</x-slot>`:                      "outside a component tag",
+		`<x-card><x-slot>x</x-slot></x-card>`:                   "needs a name",
+		`{{component "missing" .}}`:                             "component missing not found",
+		`<x-card><x-slot name="a"/><x-slot name="a"/></x-card>`: "slot a is given twice",
+	} {
+		_, err := engine.expandComponents(source, newComponentExpansion())
+		assert.ErrorContains(t, err, message, source)
+	}
+}
+
+func TestComponentChangesRecompilePages(t *testing.T) {
+	engine := newComponentsEngine(t, map[string]string{"badge": `<b>{{.Label}}</b>`}, map[string]string{
+		"home": `<x-badge Label="hi"/>`,
+	})
+	engine.config.AutoReload = true
+
+	html, err := engine.Render("home", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "<b>hi</b>", html)
+
+	path := filepath.Join(engine.config.ComponentsDir, "badge.html")
+	require.NoError(t, os.WriteFile(path, []byte(`<i>{{.Label}}</i>`), 0644))
+	later := time.Now().Add(time.Second)
+	require.NoError(t, os.Chtimes(path, later, later))
+
+	html, err = engine.Render("home", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "<i>hi</i>", html)
+}
+
+func TestComponentBuilderSlots(t *testing.T) {
+	engine := newComponentsEngine(t, testComponents, nil)
+	cm := NewComponentManager(engine)
+	_, err := NewComponentBuilder("alert", cm).
+		Content(`<div role="alert">{{slot "icon"}}!{{endslot}} {{slot}}<x-badge :Label=".level"/></div>`).
+		Slot("default", `<strong>{{.message}}</strong>`).
+		Build()
+	require.NoError(t, err)
+
+	html, err := cm.RenderComponent("alert", TemplateData{"message": "Saved", "level": "info"})
+	require.NoError(t, err)
+	assert.Equal(t, `<div role="alert">! <strong>Saved</strong><span class="badge">info</span></div>`, html)
+}
@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"go.uber.org/zap"
@@ -55,9 +56,14 @@ func (tw *TemplateWatcher) Watch() {
 		tw.engine.config.PagesDir,
 		tw.engine.config.ComponentsDir,
 		tw.engine.config.EmailsDir,
+		tw.engine.config.ErrorsDir,
 	}
+	directories = append(directories, tw.engine.config.namespaceDirs()...)
 
 	for _, dir := range directories {
+		if dir == "" {
+			continue
+		}
 		if err := tw.watcher.Add(dir); err != nil {
 			if tw.logger != nil {
 				tw.logger.Error("Failed to add watch directory",
@@ -69,7 +75,9 @@ func (tw *TemplateWatcher) Watch() {
 
 	// Add subdirectories
 	for _, dir := range directories {
-		tw.addSubdirectories(dir)
+		if dir != "" {
+			tw.addSubdirectories(dir)
+		}
 	}
 
 	for {
@@ -115,6 +123,19 @@ func (tw *TemplateWatcher) addSubdirectories(dir string) {
 
 // handleEvent handles a file system event
 func (tw *TemplateWatcher) handleEvent(event fsnotify.Event) {
+	if event.Op == fsnotify.Chmod {
+		return
+	}
+
+	// Watch directories created after the watcher started
+	if event.Op.Has(fsnotify.Create) {
+		if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+			tw.watcher.Add(event.Name)
+			tw.addSubdirectories(event.Name)
+			return
+		}
+	}
+
 	// Check if file should be processed
 	if !tw.shouldProcessFile(event.Name) {
 		return
@@ -126,6 +147,13 @@ func (tw *TemplateWatcher) handleEvent(event fsnotify.Event) {
 			zap.String("op", event.Op.String()))
 	}
 
+	// Deleted and renamed files drop out; the new name of a renamed file
+	// arrives as a create
+	if _, err := os.Stat(event.Name); os.IsNotExist(err) {
+		tw.removeTemplate(event.Name)
+		return
+	}
+
 	// Reload the specific template
 	if err := tw.reloadTemplate(event.Name); err != nil {
 		if tw.engine.config.EnableLogging && tw.logger != nil {
@@ -138,55 +166,62 @@ func (tw *TemplateWatcher) handleEvent(event fsnotify.Event) {
 
 // shouldProcessFile checks if a file should be processed
 func (tw *TemplateWatcher) shouldProcessFile(path string) bool {
-	// Check file extension
-	if !strings.HasSuffix(path, tw.engine.config.Extension) {
-		return false
-	}
+	templateType, ok := tw.templateType(path)
+	return ok && tw.engine.isTemplateFile(path, templateType)
+}
 
-	// Check if file is in a watched directory
-	directories := []string{
-		tw.engine.config.LayoutsDir,
-		tw.engine.config.PartialsDir,
-		tw.engine.config.PagesDir,
-		tw.engine.config.ComponentsDir,
-		tw.engine.config.EmailsDir,
+// templateType returns the type of the templates in path's directory
+func (tw *TemplateWatcher) templateType(path string) (TemplateType, bool) {
+	config := tw.engine.config
+	if _, _, ok := config.namespaceOf(path); ok {
+		return TypePage, true
 	}
-
-	for _, dir := range directories {
-		if strings.HasPrefix(path, dir) {
-			return true
-		}
+	switch {
+	case inDir(path, config.LayoutsDir):
+		return TypeLayout, true
+	case inDir(path, config.PartialsDir):
+		return TypePartial, true
+	case inDir(path, config.PagesDir):
+		return TypePage, true
+	case inDir(path, config.ComponentsDir):
+		return TypeComponent, true
+	case inDir(path, config.EmailsDir):
+		return TypeEmail, true
+	case inDir(path, config.ErrorsDir):
+		return TypeError, true
 	}
-
-	return false
+	return 0, false
 }
 
 // reloadTemplate reloads a specific template
 func (tw *TemplateWatcher) reloadTemplate(path string) error {
-	// Determine template type from path
-	var templateType TemplateType
-	if strings.HasPrefix(path, tw.engine.config.LayoutsDir) {
-		templateType = TypeLayout
-	} else if strings.HasPrefix(path, tw.engine.config.PartialsDir) {
-		templateType = TypePartial
-	} else if strings.HasPrefix(path, tw.engine.config.PagesDir) {
-		templateType = TypePage
-	} else if strings.HasPrefix(path, tw.engine.config.ComponentsDir) {
-		templateType = TypeComponent
-	} else if strings.HasPrefix(path, tw.engine.config.EmailsDir) {
-		templateType = TypeEmail
-	} else {
+	templateType, ok := tw.templateType(path)
+	if !ok {
 		return nil // Skip unknown files
 	}
+	name := tw.engine.generateTemplateName(path, templateType)
 
 	// Load the template
+	start := time.Now()
 	tmpl, err := tw.engine.loadTemplate(path, templateType)
 	if err != nil {
+		compileErr := newCompileError(name, path, err)
+		tw.engine.mu.Lock()
+		previous := tw.engine.failed[path]
+		tw.engine.failed[path] = compileErr
+		tw.engine.mu.Unlock()
+		if previous == nil || previous.Error() != compileErr.Error() {
+			tw.notify(Reload{Path: path, Name: name, Type: templateType, Err: compileErr})
+		}
 		return err
 	}
+	duration := time.Since(start)
 
 	// Update the template in the engine
 	tw.engine.mu.Lock()
+	existing := tw.engine.templates[tmpl.Name]
+	_, failed := tw.engine.failed[path]
+	delete(tw.engine.failed, path)
 	tw.engine.templates[tmpl.Name] = tmpl
 
 	// Update type-specific map
@@ -201,6 +236,8 @@ func (tw *TemplateWatcher) reloadTemplate(path string) error {
 		tw.engine.components[tmpl.Name] = tmpl
 	case TypeEmail:
 		tw.engine.emails[tmpl.Name] = tmpl
+	case TypeError:
+		tw.engine.errors[tmpl.Name] = tmpl
 	}
 	tw.engine.mu.Unlock()
 
@@ -211,9 +248,54 @@ func (tw *TemplateWatcher) reloadTemplate(path string) error {
 			zap.String("path", path))
 	}
 
+	// Editors often write a file more than once per save
+	if failed || existing == nil || existing.Hash != tmpl.Hash {
+		tw.notify(Reload{Path: path, Name: tmpl.Name, Type: templateType, Duration: duration})
+	}
 	return nil
 }
 
+// removeTemplate drops the template of a deleted file
+func (tw *TemplateWatcher) removeTemplate(path string) {
+	templateType, ok := tw.templateType(path)
+	if !ok {
+		return
+	}
+	name := tw.engine.generateTemplateName(path, templateType)
+
+	tw.engine.mu.Lock()
+	tmpl, exists := tw.engine.templates[name]
+	_, failed := tw.engine.failed[path]
+	delete(tw.engine.failed, path)
+	if exists && tmpl.Path == path {
+		delete(tw.engine.templates, name)
+		delete(tw.engine.layouts, name)
+		delete(tw.engine.partials, name)
+		delete(tw.engine.pages, name)
+		delete(tw.engine.components, name)
+		delete(tw.engine.emails, name)
+		delete(tw.engine.errors, name)
+		delete(tw.engine.compositions, name)
+	} else {
+		exists = false
+	}
+	tw.engine.mu.Unlock()
+
+	if exists || failed {
+		tw.notify(Reload{Path: path, Name: name, Type: templateType, Removed: true})
+	}
+}
+
+// notify tells the engine's OnReload function about a reload
+func (tw *TemplateWatcher) notify(reload Reload) {
+	tw.engine.mu.RLock()
+	fn := tw.engine.onReload
+	tw.engine.mu.RUnlock()
+	if fn != nil {
+		fn(reload)
+	}
+}
+
 // Stop stops the template watcher
 func (tw *TemplateWatcher) Stop() {
 	close(tw.stopChan)
@@ -223,3 +305,8 @@ func (tw *TemplateWatcher) Stop() {
 		tw.watcher.Close()
 	}
 }
+
+// inDir reports whether path is under dir; an unset dir holds nothing
+func inDir(path, dir string) bool {
+	return dir != "" && strings.HasPrefix(path, dir)
+}
@@ -0,0 +1,170 @@
+package tenancy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/database"
+	"gorm.io/gorm"
+)
+
+// Manager opens and caches one connection per tenant
+type Manager struct {
+	config *config.TenancyConfig
+	base   *config.DatabaseConfig
+	store  Store
+
+	mu    sync.Mutex
+	conns map[string]*database.Manager
+}
+
+// NewManager creates a tenant connection manager. Tenant connections copy
+// base and override the database or schema according to the strategy.
+func NewManager(cfg *config.TenancyConfig, base *config.DatabaseConfig, store Store) (*Manager, error) {
+	switch cfg.Strategy {
+	case StrategyDatabase:
+	case StrategySchema:
+		if base.Driver != "postgres" {
+			return nil, fmt.Errorf("tenancy: schema strategy requires postgres, got %s", base.Driver)
+		}
+	default:
+		return nil, fmt.Errorf("tenancy: unknown strategy %q", cfg.Strategy)
+	}
+
+	return &Manager{
+		config: cfg,
+		base:   base,
+		store:  store,
+		conns:  map[string]*database.Manager{},
+	}, nil
+}
+
+// Store returns the tenant store
+func (m *Manager) Store() Store {
+	return m.store
+}
+
+// Strategy returns the configured isolation strategy
+func (m *Manager) Strategy() string {
+	return m.config.Strategy
+}
+
+// DatabaseName returns the database a tenant uses under the database strategy
+func (m *Manager) DatabaseName(t *Tenant) string {
+	if t.Database != "" {
+		return t.Database
+	}
+	return m.name(t)
+}
+
+// SchemaName returns the schema a tenant uses under the schema strategy
+func (m *Manager) SchemaName(t *Tenant) string {
+	if t.Schema != "" {
+		return t.Schema
+	}
+	return m.name(t)
+}
+
+func (m *Manager) name(t *Tenant) string {
+	pattern := m.config.Pattern
+	if !strings.Contains(pattern, "%s") {
+		pattern = "tenant_%s"
+	}
+	// Hyphens are valid in IDs but not in unquoted identifiers
+	return fmt.Sprintf(pattern, strings.ReplaceAll(t.ID, "-", "_"))
+}
+
+// Connection returns the tenant's database manager, connecting on first use
+func (m *Manager) Connection(t *Tenant) (*database.Manager, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if conn, ok := m.conns[t.ID]; ok {
+		return conn, nil
+	}
+
+	cfg := *m.base
+	if m.config.Strategy == StrategySchema {
+		cfg.Schema = m.SchemaName(t)
+	} else {
+		cfg.Database = m.DatabaseName(t)
+	}
+	// Replicas are configured for the main database only
+	cfg.Replicas = nil
+
+	conn, err := database.New(&cfg)
+	if err != nil {
+		return nil, fmt.Errorf("tenant %s: %w", t.ID, err)
+	}
+	m.conns[t.ID] = conn
+	return conn, nil
+}
+
+// DB returns the GORM handle of the tenant in ctx, bound to ctx
+func (m *Manager) DB(ctx context.Context) (*gorm.DB, error) {
+	t, ok := FromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("tenancy: no tenant in context")
+	}
+	conn, err := m.Connection(t)
+	if err != nil {
+		return nil, err
+	}
+	return conn.GetDB().WithContext(ctx), nil
+}
+
+// Close closes every tenant connection
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var firstErr error
+	for id, conn := range m.conns {
+		if err := conn.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(m.conns, id)
+	}
+	return firstErr
+}
+
+// MigrateResult reports the migration outcome for one tenant
+type MigrateResult struct {
+	Tenant string
+	database.MigrationResult
+	Err error
+}
+
+// Migrate runs pending migrations for each tenant. Under the schema
+// strategy the schema is created first through central, the main database
+// connection. Tenants are migrated independently, so one failure doesn't
+// stop the rest.
+func (m *Manager) Migrate(ctx context.Context, central *database.Manager, migrationsDir string, tenants []*Tenant) []MigrateResult {
+	results := make([]MigrateResult, 0, len(tenants))
+	for _, t := range tenants {
+		result := MigrateResult{Tenant: t.ID}
+
+		if m.config.Strategy == StrategySchema {
+			stmt := fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s", m.SchemaName(t))
+			if _, err := central.GetSQLDB().ExecContext(ctx, stmt); err != nil {
+				result.Err = err
+				results = append(results, result)
+				continue
+			}
+		}
+
+		conn, err := m.Connection(t)
+		if err != nil {
+			result.Err = err
+			results = append(results, result)
+			continue
+		}
+
+		result.MigrationResult = conn.Migrator(migrationsDir).Migrate()
+		results = append(results, result)
+	}
+	return results
+}
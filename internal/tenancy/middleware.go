@@ -0,0 +1,53 @@
+package tenancy
+
+import (
+	"errors"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TenantIDKey is the attribute the request's span gets with the tenant's ID
+const TenantIDKey = attribute.Key("tenant.id")
+
+// Middleware resolves the tenant for each request with the first resolver
+// that matches and stores it in the request context, and records it on the
+// request's span. Requests without a tenant get 400 and unknown tenants
+// 404.
+func Middleware(store Store, resolvers ...Resolver) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, resolver := range resolvers {
+				id, ok := resolver.Resolve(r)
+				if !ok {
+					continue
+				}
+				if !ValidID(id) {
+					http.Error(w, "invalid tenant", http.StatusBadRequest)
+					return
+				}
+
+				tenant, err := store.Find(r.Context(), id)
+				if errors.Is(err, ErrTenantNotFound) {
+					http.Error(w, "tenant not found", http.StatusNotFound)
+					return
+				}
+				if err != nil {
+					http.Error(w, "tenant lookup failed", http.StatusInternalServerError)
+					return
+				}
+
+				trace.SpanFromContext(r.Context()).SetAttributes(TenantIDKey.String(tenant.ID))
+
+				if rw, ok := resolver.(pathRewriter); ok {
+					r = rw.strip(r)
+				}
+				next.ServeHTTP(w, r.WithContext(WithTenant(r.Context(), tenant)))
+				return
+			}
+
+			http.Error(w, "tenant required", http.StatusBadRequest)
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package tenancy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+// Resolver extracts a tenant ID from a request
+type Resolver interface {
+	Resolve(r *http.Request) (string, bool)
+}
+
+// pathRewriter is implemented by resolvers that consume part of the URL,
+// so routes behind the middleware stay tenant-agnostic
+type pathRewriter interface {
+	strip(r *http.Request) *http.Request
+}
+
+// SubdomainResolver takes the tenant from the leftmost label of hosts
+// under baseDomain, e.g. acme.example.com
+type SubdomainResolver struct {
+	BaseDomain string
+}
+
+func (s SubdomainResolver) Resolve(r *http.Request) (string, bool) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+
+	sub, ok := strings.CutSuffix(host, "."+strings.ToLower(s.BaseDomain))
+	if !ok || sub == "" || strings.Contains(sub, ".") {
+		return "", false
+	}
+	return sub, true
+}
+
+// HeaderResolver takes the tenant from a request header
+type HeaderResolver struct {
+	Header string
+}
+
+func (h HeaderResolver) Resolve(r *http.Request) (string, bool) {
+	id := strings.TrimSpace(r.Header.Get(h.Header))
+	return strings.ToLower(id), id != ""
+}
+
+// PathResolver takes the tenant from /{prefix}/{tenant}/... and removes
+// both segments before routing
+type PathResolver struct {
+	Prefix string
+}
+
+func (p PathResolver) Resolve(r *http.Request) (string, bool) {
+	id, _, ok := p.split(r.URL.Path)
+	return id, ok
+}
+
+func (p PathResolver) strip(r *http.Request) *http.Request {
+	_, rest, ok := p.split(r.URL.Path)
+	if !ok {
+		return r
+	}
+	r2 := r.Clone(r.Context())
+	r2.URL.Path = rest
+	r2.URL.RawPath = ""
+	return r2
+}
+
+func (p PathResolver) split(path string) (id, rest string, ok bool) {
+	prefix := "/" + strings.Trim(p.Prefix, "/") + "/"
+	if p.Prefix == "" {
+		prefix = "/"
+	}
+	after, found := strings.CutPrefix(path, prefix)
+	if !found {
+		return "", "", false
+	}
+	id, rest, _ = strings.Cut(after, "/")
+	if id == "" {
+		return "", "", false
+	}
+	return strings.ToLower(id), "/" + rest, true
+}
+
+// ResolversFromConfig builds the resolver chain named in config
+func ResolversFromConfig(cfg *config.TenancyConfig) ([]Resolver, error) {
+	var resolvers []Resolver
+	for _, name := range cfg.Resolvers {
+		switch name {
+		case "subdomain":
+			if cfg.BaseDomain == "" {
+				return nil, fmt.Errorf("tenancy: subdomain resolver needs tenancy.base_domain")
+			}
+			resolvers = append(resolvers, SubdomainResolver{BaseDomain: cfg.BaseDomain})
+		case "header":
+			resolvers = append(resolvers, HeaderResolver{Header: cfg.Header})
+		case "path":
+			resolvers = append(resolvers, PathResolver{Prefix: cfg.PathPrefix})
+		default:
+			return nil, fmt.Errorf("tenancy: unknown resolver %q", name)
+		}
+	}
+	return resolvers, nil
+}
@@ -0,0 +1,128 @@
+package tenancy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/mrhoseah/dolphin/internal/cache"
+	"github.com/mrhoseah/dolphin/internal/storage"
+)
+
+// ErrScopedFlush is returned by Cache.Flush, which would otherwise clear
+// every tenant's entries
+var ErrScopedFlush = errors.New("tenancy: cannot flush a tenant-scoped cache")
+
+// Cache prefixes keys with the tenant in the call's context so tenants
+// sharing a cache backend can't read each other's entries. Calls without a
+// tenant use the key as is.
+type Cache struct {
+	inner cache.Cache
+}
+
+var _ cache.Cache = (*Cache)(nil)
+
+// NewCache wraps a cache with tenant key prefixes
+func NewCache(inner cache.Cache) *Cache {
+	return &Cache{inner: inner}
+}
+
+// CacheKey returns the key stored in the backend for key under ctx's tenant
+func CacheKey(ctx context.Context, key string) string {
+	if t, ok := FromContext(ctx); ok {
+		return "tenant:" + t.ID + ":" + key
+	}
+	return key
+}
+
+func (c *Cache) Get(ctx context.Context, key string) (string, error) {
+	return c.inner.Get(ctx, CacheKey(ctx, key))
+}
+
+func (c *Cache) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	return c.inner.Set(ctx, CacheKey(ctx, key), value, expiration)
+}
+
+func (c *Cache) Delete(ctx context.Context, key string) error {
+	return c.inner.Delete(ctx, CacheKey(ctx, key))
+}
+
+func (c *Cache) Exists(ctx context.Context, key string) (bool, error) {
+	return c.inner.Exists(ctx, CacheKey(ctx, key))
+}
+
+func (c *Cache) Flush(ctx context.Context) error {
+	return ErrScopedFlush
+}
+
+// Storage confines a storage driver to tenants/{id}/ so paths given by one
+// tenant can't reach another's files
+type Storage struct {
+	inner  storage.Driver
+	prefix string
+}
+
+var _ storage.Driver = (*Storage)(nil)
+
+// NewStorage scopes a storage driver to a tenant
+func NewStorage(inner storage.Driver, t *Tenant) *Storage {
+	return &Storage{inner: inner, prefix: "tenants/" + t.ID + "/"}
+}
+
+func (s *Storage) path(p string) string {
+	// Clean away leading slashes and parent references
+	parts := strings.Split(strings.TrimLeft(p, "/"), "/")
+	kept := parts[:0]
+	for _, part := range parts {
+		if part != ".." && part != "." && part != "" {
+			kept = append(kept, part)
+		}
+	}
+	return s.prefix + strings.Join(kept, "/")
+}
+
+func (s *Storage) Put(path string, content io.Reader) error {
+	return s.inner.Put(s.path(path), content)
+}
+
+func (s *Storage) Get(path string) (io.ReadCloser, error) {
+	return s.inner.Get(s.path(path))
+}
+
+func (s *Storage) Delete(path string) error {
+	return s.inner.Delete(s.path(path))
+}
+
+func (s *Storage) Exists(path string) bool {
+	return s.inner.Exists(s.path(path))
+}
+
+func (s *Storage) URL(path string) string {
+	return s.inner.URL(s.path(path))
+}
+
+func (s *Storage) Size(path string) (int64, error) {
+	return s.inner.Size(s.path(path))
+}
+
+// List returns files under prefix with paths relative to the tenant root
+func (s *Storage) List(prefix string) ([]storage.FileInfo, error) {
+	files, err := s.inner.List(s.path(prefix))
+	if err != nil {
+		return nil, err
+	}
+	for i := range files {
+		files[i].Path = strings.TrimPrefix(files[i].Path, s.prefix)
+	}
+	return files, nil
+}
+
+func (s *Storage) Copy(src, dest string) error {
+	return s.inner.Copy(s.path(src), s.path(dest))
+}
+
+func (s *Storage) Move(src, dest string) error {
+	return s.inner.Move(s.path(src), s.path(dest))
+}
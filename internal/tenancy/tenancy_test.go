@@ -0,0 +1,109 @@
+package tenancy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/cache"
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+func TestResolvers(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "http://acme.example.com:8080/t/globex/api/users", nil)
+	req.Header.Set("X-Tenant", "Initech")
+
+	id, ok := SubdomainResolver{BaseDomain: "example.com"}.Resolve(req)
+	assert.True(t, ok)
+	assert.Equal(t, "acme", id)
+
+	id, ok = HeaderResolver{Header: "X-Tenant"}.Resolve(req)
+	assert.True(t, ok)
+	assert.Equal(t, "initech", id)
+
+	id, ok = PathResolver{Prefix: "t"}.Resolve(req)
+	assert.True(t, ok)
+	assert.Equal(t, "globex", id)
+
+	_, ok = SubdomainResolver{BaseDomain: "example.com"}.Resolve(httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+	assert.False(t, ok)
+}
+
+func TestMiddleware(t *testing.T) {
+	store := NewMemoryStore(&Tenant{ID: "acme"})
+	handler := Middleware(store, PathResolver{Prefix: "t"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant, ok := FromContext(r.Context())
+		require.True(t, ok)
+		w.Write([]byte(tenant.ID + " " + r.URL.Path))
+	}))
+
+	cases := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/t/acme/api/users", http.StatusOK, "acme /api/users"},
+		{"/t/globex/api/users", http.StatusNotFound, ""},
+		{"/t/Bad..ID/", http.StatusBadRequest, ""},
+		{"/api/users", http.StatusBadRequest, ""},
+	}
+	for _, tc := range cases {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		assert.Equal(t, tc.status, rec.Code, tc.path)
+		if tc.body != "" {
+			assert.Equal(t, tc.body, rec.Body.String())
+		}
+	}
+}
+
+func TestScopedCache(t *testing.T) {
+	inner := cache.NewMemoryCache()
+	scoped := NewCache(inner)
+	acme := WithTenant(context.Background(), &Tenant{ID: "acme"})
+	globex := WithTenant(context.Background(), &Tenant{ID: "globex"})
+
+	require.NoError(t, scoped.Set(acme, "plan", "pro", time.Minute))
+	exists, _ := scoped.Exists(globex, "plan")
+	assert.False(t, exists)
+	exists, _ = inner.Exists(context.Background(), "tenant:acme:plan")
+	assert.True(t, exists)
+	assert.ErrorIs(t, scoped.Flush(acme), ErrScopedFlush)
+}
+
+func TestScopedStoragePaths(t *testing.T) {
+	s := NewStorage(nil, &Tenant{ID: "acme"})
+	assert.Equal(t, "tenants/acme/avatars/1.png", s.path("/avatars/1.png"))
+	assert.Equal(t, "tenants/acme/etc/passwd", s.path("../../etc/passwd"))
+}
+
+func TestManagerDatabasePerTenant(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.TenancyConfig{Strategy: StrategyDatabase, Pattern: filepath.Join(dir, "tenant_%s.db")}
+	store := NewMemoryStore(&Tenant{ID: "acme"}, &Tenant{ID: "globex-inc"})
+	m, err := NewManager(cfg, &config.DatabaseConfig{Driver: "sqlite", MaxOpen: 1, MaxIdle: 1}, store)
+	require.NoError(t, err)
+	defer m.Close()
+
+	acmeDB, err := m.DB(WithTenant(context.Background(), &Tenant{ID: "acme"}))
+	require.NoError(t, err)
+	require.NoError(t, acmeDB.Exec("CREATE TABLE notes (id integer)").Error)
+
+	globex, _ := store.Find(context.Background(), "globex-inc")
+	assert.Equal(t, filepath.Join(dir, "tenant_globex_inc.db"), m.DatabaseName(globex))
+	globexConn, err := m.Connection(globex)
+	require.NoError(t, err)
+	assert.False(t, globexConn.GetDB().Migrator().HasTable("notes"))
+
+	_, err = m.DB(context.Background())
+	assert.Error(t, err)
+
+	_, err = NewManager(&config.TenancyConfig{Strategy: StrategySchema}, &config.DatabaseConfig{Driver: "sqlite"}, store)
+	assert.Error(t, err)
+}
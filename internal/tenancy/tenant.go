@@ -0,0 +1,133 @@
+package tenancy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+// Isolation strategies
+const (
+	StrategyDatabase = "database"
+	StrategySchema   = "schema"
+)
+
+// ErrTenantNotFound is returned when no tenant has the requested ID
+var ErrTenantNotFound = errors.New("tenant not found")
+
+// idPattern restricts tenant IDs to characters that are safe in
+// subdomains, paths, database names and cache keys
+var idPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// Tenant is one customer's isolated slice of the application
+type Tenant struct {
+	ID string
+
+	// Database is the tenant's database under the database strategy
+	Database string
+
+	// Schema is the tenant's Postgres schema under the schema strategy
+	Schema string
+}
+
+// ValidID reports whether id can be used as a tenant ID
+func ValidID(id string) bool {
+	return idPattern.MatchString(id)
+}
+
+// Store looks up tenants
+type Store interface {
+	Find(ctx context.Context, id string) (*Tenant, error)
+	All(ctx context.Context) ([]*Tenant, error)
+}
+
+// MemoryStore is a fixed set of tenants, e.g. from config or Register
+type MemoryStore struct {
+	mu      sync.RWMutex
+	tenants map[string]*Tenant
+}
+
+// NewMemoryStore creates a store holding the given tenants
+func NewMemoryStore(tenants ...*Tenant) *MemoryStore {
+	s := &MemoryStore{tenants: map[string]*Tenant{}}
+	for _, t := range tenants {
+		s.tenants[t.ID] = t
+	}
+	return s
+}
+
+// Add adds or replaces a tenant
+func (s *MemoryStore) Add(t *Tenant) error {
+	if !ValidID(t.ID) {
+		return fmt.Errorf("invalid tenant id %q", t.ID)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tenants[t.ID] = t
+	return nil
+}
+
+// Find returns the tenant with the given ID
+func (s *MemoryStore) Find(ctx context.Context, id string) (*Tenant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if t, ok := s.tenants[id]; ok {
+		return t, nil
+	}
+	return nil, ErrTenantNotFound
+}
+
+// All returns every tenant sorted by ID
+func (s *MemoryStore) All(ctx context.Context) ([]*Tenant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]*Tenant, 0, len(s.tenants))
+	for _, t := range s.tenants {
+		result = append(result, t)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+var registered = NewMemoryStore()
+
+// Register adds tenants to the default store; generated app/tenants files
+// call it from init
+func Register(tenants ...*Tenant) {
+	for _, t := range tenants {
+		if err := registered.Add(t); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// StoreFromConfig returns a store with the registered tenants plus those
+// listed in config, which win on conflicting IDs
+func StoreFromConfig(cfg *config.TenancyConfig) (*MemoryStore, error) {
+	all, _ := registered.All(context.Background())
+	store := NewMemoryStore(all...)
+	for _, tc := range cfg.Tenants {
+		if err := store.Add(&Tenant{ID: tc.ID, Database: tc.Database, Schema: tc.Schema}); err != nil {
+			return nil, err
+		}
+	}
+	return store, nil
+}
+
+type contextKey struct{}
+
+// WithTenant returns a context carrying the tenant
+func WithTenant(ctx context.Context, t *Tenant) context.Context {
+	return context.WithValue(ctx, contextKey{}, t)
+}
+
+// FromContext returns the tenant resolved for the request, if any
+func FromContext(ctx context.Context) (*Tenant, bool) {
+	t, ok := ctx.Value(contextKey{}).(*Tenant)
+	return t, ok && t != nil
+}
@@ -25,6 +25,32 @@ func TemplateHelpers() template.FuncMap {
 	}
 }
 
+// TemplateHelpersIn returns the template helpers with times shown in loc,
+// such as the timezone a user prefers
+func TemplateHelpersIn(loc *time.Location) template.FuncMap {
+	in := func(format func(time.Time) string) func(time.Time) string {
+		return func(t time.Time) string { return format(t.In(loc)) }
+	}
+	is := func(check func(time.Time) bool) func(time.Time) bool {
+		return func(t time.Time) bool { return check(t.In(loc)) }
+	}
+	helpers := TemplateHelpers()
+	helpers["moment"] = func(t time.Time) *Moment { return NewMoment(t.In(loc)) }
+	helpers["now"] = func() *Moment { return NewMoment(time.Now().In(loc)) }
+	helpers["fromNow"] = in(FromNow)
+	helpers["formatTime"] = func(t time.Time, layout string) string { return FormatTime(t.In(loc), layout) }
+	helpers["formatDate"] = in(FormatDate)
+	helpers["formatDateTime"] = in(FormatDateTime)
+	helpers["calendar"] = in(Calendar)
+	helpers["humanize"] = in(Humanize)
+	helpers["relativeTime"] = in(RelativeTime)
+	helpers["isToday"] = is(IsToday)
+	helpers["isYesterday"] = is(IsYesterday)
+	helpers["isThisWeek"] = is(IsThisWeek)
+	helpers["isThisYear"] = is(IsThisYear)
+	return helpers
+}
+
 // FromNow is a helper function that takes a time.Time and returns a human-readable string
 func FromNow(t time.Time) string {
 	return NewMoment(t).FromNow()
@@ -34,6 +34,12 @@ func FromString(timeStr string) (*Moment, error) {
 	return &Moment{time: t}, nil
 }
 
+// now is the current time in the moment's location, so calendar days are
+// compared in the same timezone
+func (m *Moment) now() time.Time {
+	return time.Now().In(m.time.Location())
+}
+
 // Time returns the underlying time.Time
 func (m *Moment) Time() time.Time {
 	return m.time
@@ -66,7 +72,7 @@ func (m *Moment) FormatISO() string {
 
 // FromNow returns a human-readable string describing the time relative to now
 func (m *Moment) FromNow() string {
-	now := time.Now()
+	now := m.now()
 	diff := now.Sub(m.time)
 
 	// Handle future times
@@ -178,7 +184,7 @@ func (m *Moment) formatFuture(diff time.Duration) string {
 
 // Calendar returns a calendar-style time string
 func (m *Moment) Calendar() string {
-	now := time.Now()
+	now := m.now()
 
 	// Same day
 	if m.time.Year() == now.Year() && m.time.YearDay() == now.YearDay() {
@@ -208,26 +214,26 @@ func (m *Moment) Calendar() string {
 
 // IsToday checks if the time is today
 func (m *Moment) IsToday() bool {
-	now := time.Now()
+	now := m.now()
 	return m.time.Year() == now.Year() && m.time.YearDay() == now.YearDay()
 }
 
 // IsYesterday checks if the time is yesterday
 func (m *Moment) IsYesterday() bool {
-	yesterday := time.Now().AddDate(0, 0, -1)
+	yesterday := m.now().AddDate(0, 0, -1)
 	return m.time.Year() == yesterday.Year() && m.time.YearDay() == yesterday.YearDay()
 }
 
 // IsThisWeek checks if the time is this week
 func (m *Moment) IsThisWeek() bool {
-	now := time.Now()
+	now := m.now()
 	weekStart := now.AddDate(0, 0, -int(now.Weekday()))
 	return m.time.After(weekStart)
 }
 
 // IsThisYear checks if the time is this year
 func (m *Moment) IsThisYear() bool {
-	now := time.Now()
+	now := m.now()
 	return m.time.Year() == now.Year()
 }
 
@@ -393,7 +399,7 @@ func (m *Moment) UnixNano() int64 {
 
 // Humanize returns a human-readable string with more context
 func (m *Moment) Humanize() string {
-	now := time.Now()
+	now := m.now()
 	diff := now.Sub(m.time)
 
 	// Handle future times
@@ -456,7 +462,7 @@ func (m *Moment) formatDuration(d time.Duration) string {
 
 // RelativeTime returns a relative time string with more precision
 func (m *Moment) RelativeTime() string {
-	now := time.Now()
+	now := m.now()
 	diff := now.Sub(m.time)
 
 	// Handle future times
@@ -0,0 +1,336 @@
+// Package webhooks keeps the inbound webhooks an app takes, so a delivery
+// that failed can be looked at on the debug dashboard and processed again
+// once the bug is fixed:
+//
+//	dolphin webhooks:list --failed
+//	dolphin webhooks:replay 9f86d081884c7d65
+//
+// With webhooks.capture on, the payments and mail webhook endpoints are
+// captured, and other routes with the webhook middleware alias:
+//
+//	routing.Wrap(r).Middleware("webhook:github").Post("/webhooks/github", github.Handle)
+//
+// A replay serves the stored request through the app's router again, in
+// process. Signatures are checked as of when the delivery arrived, see
+// ReceivedAt, so providers' replay windows don't refuse it.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mrhoseah/dolphin/internal/capture"
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+// ErrNotFound is returned for a delivery that isn't kept, or no longer
+var ErrNotFound = errors.New("webhooks: delivery not found")
+
+// maxResponse caps the bytes kept of the response to a delivery, enough
+// for the error a handler answered with
+const maxResponse = 4 << 10
+
+// pruneInterval is how often deliveries past the retention are removed
+const pruneInterval = time.Hour
+
+// Delivery is a webhook request as it arrived, with the answer it got
+type Delivery struct {
+	ID     string `gorm:"primaryKey;size:32" json:"id"`
+	Source string `gorm:"size:64;index" json:"source"`
+
+	// ReplayOf is the ID of the delivery a replay repeats
+	ReplayOf string `gorm:"size:32;index" json:"replay_of,omitempty"`
+
+	Method     string      `gorm:"size:10" json:"method"`
+	URL        string      `gorm:"size:2048" json:"url"`
+	Headers    http.Header `gorm:"serializer:json" json:"headers"`
+	RemoteAddr string      `gorm:"size:64" json:"remote_addr"`
+
+	// Body is the payload, base64 encoded when it isn't text. A payload
+	// over webhooks.max_body_size is truncated and can't be replayed.
+	Body          string `json:"body,omitempty"`
+	BodyBase64    bool   `json:"body_base64,omitempty"`
+	BodyTruncated bool   `json:"body_truncated,omitempty"`
+
+	Status     int           `json:"status"`
+	Response   string        `json:"response,omitempty"`
+	ReceivedAt time.Time     `gorm:"index" json:"received_at"`
+	Duration   time.Duration `json:"duration"`
+}
+
+// TableName stores deliveries in webhook_deliveries
+func (Delivery) TableName() string {
+	return "webhook_deliveries"
+}
+
+// Failed reports whether the handler didn't acknowledge the delivery
+func (d *Delivery) Failed() bool {
+	return d.Status < 200 || d.Status >= 300
+}
+
+// payload returns the body as it was sent
+func (d *Delivery) payload() ([]byte, error) {
+	if d.BodyBase64 {
+		return base64.StdEncoding.DecodeString(d.Body)
+	}
+	return []byte(d.Body), nil
+}
+
+// Filter narrows the deliveries listed
+type Filter struct {
+	Source string
+	Failed bool
+
+	// Limit caps the deliveries listed, 50 when zero
+	Limit int
+}
+
+// Store keeps deliveries in the app database
+type Store struct {
+	db *gorm.DB
+}
+
+// NewStore creates the webhook_deliveries table when it doesn't exist
+func NewStore(db *gorm.DB) (*Store, error) {
+	if err := db.AutoMigrate(&Delivery{}); err != nil {
+		return nil, fmt.Errorf("webhooks: creating the deliveries table: %w", err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Save stores a delivery
+func (s *Store) Save(ctx context.Context, d *Delivery) error {
+	return s.db.WithContext(ctx).Create(d).Error
+}
+
+// Get returns the delivery with the given ID
+func (s *Store) Get(ctx context.Context, id string) (*Delivery, error) {
+	var d Delivery
+	err := s.db.WithContext(ctx).Where("id = ?", id).First(&d).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// List returns the deliveries filter selects, newest first
+func (s *Store) List(ctx context.Context, filter Filter) ([]*Delivery, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = 50
+	}
+	query := s.db.WithContext(ctx).Order("received_at DESC").Limit(filter.Limit)
+	if filter.Source != "" {
+		query = query.Where("source = ?", filter.Source)
+	}
+	if filter.Failed {
+		query = query.Where("status < ? OR status >= ?", 200, 300)
+	}
+	var deliveries []*Delivery
+	return deliveries, query.Find(&deliveries).Error
+}
+
+// Prune removes the deliveries received before before, returning how many
+func (s *Store) Prune(ctx context.Context, before time.Time) (int64, error) {
+	result := s.db.WithContext(ctx).Where("received_at < ?", before).Delete(&Delivery{})
+	return result.RowsAffected, result.Error
+}
+
+// Capturer stores the deliveries its middleware sees and replays them
+type Capturer struct {
+	store       *Store
+	retention   time.Duration
+	maxBodySize int64
+	logger      *zap.Logger
+	lastPrune   atomic.Int64
+
+	mu      sync.RWMutex
+	handler http.Handler
+}
+
+// New creates a capturer keeping deliveries in store as cfg says
+func New(store *Store, cfg config.WebhooksConfig, logger *zap.Logger) *Capturer {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if cfg.MaxBodySize <= 0 {
+		cfg.MaxBodySize = 1 << 20
+	}
+	return &Capturer{store: store, retention: cfg.Retention, maxBodySize: cfg.MaxBodySize, logger: logger}
+}
+
+// Store returns the store deliveries are kept in
+func (c *Capturer) Store() *Store {
+	return c.store
+}
+
+// SetHandler sets the handler replays are served by, normally the app's
+// router with the capturing middleware on its webhook routes
+func (c *Capturer) SetHandler(handler http.Handler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.handler = handler
+}
+
+// replayKey holds the *replay of a request that is a replay
+type replayKey struct{}
+
+// replay is the state of a replay in progress
+type replay struct {
+	of *Delivery
+
+	// delivery is the replay's own, stored by the middleware
+	delivery *Delivery
+}
+
+// ReceivedAt returns when the delivery a request replays arrived, for
+// checking its signature's timestamp as of then. It returns false for
+// requests that aren't replays, which only this package can make.
+func ReceivedAt(ctx context.Context) (time.Time, bool) {
+	if r, ok := ctx.Value(replayKey{}).(*replay); ok {
+		return r.of.ReceivedAt, true
+	}
+	return time.Time{}, false
+}
+
+// Middleware stores the requests of the routes it wraps, and their
+// answers, as deliveries from source
+func (c *Capturer) Middleware(source string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			d := &Delivery{
+				ID:         newID(),
+				Source:     source,
+				Method:     r.Method,
+				URL:        r.URL.RequestURI(),
+				Headers:    r.Header.Clone(),
+				RemoteAddr: r.RemoteAddr,
+				ReceivedAt: time.Now(),
+			}
+			d.Headers.Del("Cookie")
+			replaying, _ := r.Context().Value(replayKey{}).(*replay)
+			if replaying != nil {
+				d.ReplayOf = replaying.of.ID
+			}
+
+			// Keep the start of the body and hand the handler all of it
+			if r.Body != nil && r.Body != http.NoBody {
+				head, _ := io.ReadAll(io.LimitReader(r.Body, c.maxBodySize+1))
+				d.BodyTruncated = int64(len(head)) > c.maxBodySize
+				kept := head[:min(int64(len(head)), c.maxBodySize)]
+				if utf8.Valid(kept) {
+					d.Body = string(kept)
+				} else {
+					d.Body, d.BodyBase64 = base64.StdEncoding.EncodeToString(kept), true
+				}
+				r.Body = struct {
+					io.Reader
+					io.Closer
+				}{io.MultiReader(bytes.NewReader(head), r.Body), r.Body}
+			}
+
+			ww := chimiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			response := capture.NewBuffer(maxResponse)
+			ww.Tee(response)
+			next.ServeHTTP(ww, r)
+
+			d.Duration = time.Since(d.ReceivedAt)
+			d.Status = ww.Status()
+			if d.Status == 0 {
+				d.Status = http.StatusOK
+			}
+			d.Response = response.String()
+			if !utf8.ValidString(d.Response) {
+				d.Response = ""
+			}
+
+			ctx := context.WithoutCancel(r.Context())
+			if err := c.store.Save(ctx, d); err != nil {
+				c.logger.Warn("Failed to store a webhook delivery", zap.String("source", source), zap.Error(err))
+			} else if replaying != nil {
+				replaying.delivery = d
+			}
+			c.prune(ctx)
+		})
+	}
+}
+
+// prune removes the deliveries past the retention, at most once an
+// interval
+func (c *Capturer) prune(ctx context.Context) {
+	if c.retention <= 0 {
+		return
+	}
+	now := time.Now()
+	last := c.lastPrune.Load()
+	if now.Sub(time.Unix(0, last)) < pruneInterval || !c.lastPrune.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+	if _, err := c.store.Prune(ctx, now.Add(-c.retention)); err != nil {
+		c.logger.Warn("Failed to prune webhook deliveries", zap.Error(err))
+	}
+}
+
+// Replay serves a delivery again and returns the delivery of the replay,
+// with the answer the handler gave this time
+func (c *Capturer) Replay(ctx context.Context, id string) (*Delivery, error) {
+	c.mu.RLock()
+	handler := c.handler
+	c.mu.RUnlock()
+	if handler == nil {
+		return nil, errors.New("webhooks: no handler set for replays")
+	}
+
+	original, err := c.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if original.BodyTruncated {
+		return nil, fmt.Errorf("webhooks: delivery %s can't be replayed: its body was truncated", id)
+	}
+	body, err := original.payload()
+	if err != nil {
+		return nil, err
+	}
+
+	// A fresh context, since the caller's may carry a route of its own
+	replaying := &replay{of: original}
+	req, err := http.NewRequestWithContext(context.WithValue(context.Background(), replayKey{}, replaying), original.Method, original.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("webhooks: delivery %s can't be replayed: %w", id, err)
+	}
+	for name, values := range original.Headers {
+		req.Header[name] = append([]string(nil), values...)
+	}
+	req.RequestURI = req.URL.RequestURI()
+	req.RemoteAddr = original.RemoteAddr
+
+	handler.ServeHTTP(&capture.Discard{}, req)
+	if replaying.delivery == nil {
+		return nil, fmt.Errorf("webhooks: the replay of %s wasn't captured; does its route still capture %s webhooks?", id, original.Source)
+	}
+	return replaying.delivery, nil
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,161 @@
+package webhooks
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+)
+
+func newCapturer(t *testing.T, cfg config.WebhooksConfig) *Capturer {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "webhooks.db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	require.NoError(t, err)
+	store, err := NewStore(db)
+	require.NoError(t, err)
+	return New(store, cfg, nil)
+}
+
+// post sends a webhook through handler
+func post(handler http.Handler, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Cookie", "session=secret")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestCapture(t *testing.T) {
+	c := newCapturer(t, config.WebhooksConfig{MaxBodySize: 16})
+	var received []string
+	r := chi.NewRouter()
+	r.With(c.Middleware("github")).Post("/hooks/github", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = append(received, string(body))
+		if strings.Contains(string(body), "bad") {
+			http.Error(w, "unknown event", http.StatusUnprocessableEntity)
+		}
+	})
+
+	post(r, "/hooks/github?delivery=1", `{"ok":true}`)
+	post(r, "/hooks/github", `{"bad":true}`)
+	post(r, "/hooks/github", `{"event":"a long payload"}`)
+	assert.Equal(t, []string{`{"ok":true}`, `{"bad":true}`, `{"event":"a long payload"}`}, received, "handlers read the whole body")
+
+	ctx := context.Background()
+	deliveries, err := c.Store().List(ctx, Filter{})
+	require.NoError(t, err)
+	require.Len(t, deliveries, 3)
+	long, bad, ok := deliveries[0], deliveries[1], deliveries[2]
+
+	assert.Equal(t, "github", ok.Source)
+	assert.Equal(t, "/hooks/github?delivery=1", ok.URL)
+	assert.Equal(t, http.StatusOK, ok.Status)
+	assert.Equal(t, "application/json", ok.Headers.Get("Content-Type"))
+	assert.Empty(t, ok.Headers.Get("Cookie"))
+
+	assert.True(t, bad.Failed())
+	assert.Equal(t, "unknown event\n", bad.Response)
+
+	assert.True(t, long.BodyTruncated)
+	assert.Equal(t, `{"event":"a long`, long.Body)
+
+	failed, err := c.Store().List(ctx, Filter{Source: "github", Failed: true})
+	require.NoError(t, err)
+	require.Len(t, failed, 1)
+	assert.Equal(t, bad.ID, failed[0].ID)
+
+	others, err := c.Store().List(ctx, Filter{Source: "stripe"})
+	require.NoError(t, err)
+	assert.Empty(t, others)
+
+	_, err = c.Store().Get(ctx, "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestReplay(t *testing.T) {
+	c := newCapturer(t, config.WebhooksConfig{})
+	fixed := false
+	var replayedAt []time.Time
+	r := chi.NewRouter()
+	r.With(c.Middleware("payments")).Post("/webhooks/{provider}", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if receivedAt, ok := ReceivedAt(r.Context()); ok {
+			replayedAt = append(replayedAt, receivedAt)
+		}
+		if !fixed || chi.URLParam(r, "provider") != "stripe" || string(body) != `{"id":"evt_1"}` {
+			http.Error(w, "handler bug", http.StatusInternalServerError)
+		}
+	})
+	c.SetHandler(r)
+
+	post(r, "/webhooks/stripe", `{"id":"evt_1"}`)
+	ctx := context.Background()
+	deliveries, err := c.Store().List(ctx, Filter{})
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	original := deliveries[0]
+	require.True(t, original.Failed())
+
+	// After the fix, the replay succeeds as of when the webhook arrived
+	fixed = true
+	replay, err := c.Replay(ctx, original.ID)
+	require.NoError(t, err)
+	assert.Equal(t, original.ID, replay.ReplayOf)
+	assert.False(t, replay.Failed())
+	require.Len(t, replayedAt, 1)
+	assert.True(t, original.ReceivedAt.Equal(replayedAt[0]))
+
+	_, ok := ReceivedAt(context.Background())
+	assert.False(t, ok, "requests that aren't replays have no receive time")
+
+	_, err = c.Replay(ctx, "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// A route that no longer captures webhooks can't be replayed through
+	c.SetHandler(http.NotFoundHandler())
+	_, err = c.Replay(ctx, original.ID)
+	assert.ErrorContains(t, err, "wasn't captured")
+}
+
+func TestReplayTruncated(t *testing.T) {
+	c := newCapturer(t, config.WebhooksConfig{MaxBodySize: 4})
+	handler := c.Middleware("mail")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	c.SetHandler(handler)
+	post(handler, "/webhooks/mail", "too long")
+
+	deliveries, err := c.Store().List(context.Background(), Filter{})
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	_, err = c.Replay(context.Background(), deliveries[0].ID)
+	assert.ErrorContains(t, err, "truncated")
+}
+
+func TestPrune(t *testing.T) {
+	c := newCapturer(t, config.WebhooksConfig{Retention: time.Hour})
+	ctx := context.Background()
+	old := &Delivery{ID: "old", Source: "github", Status: 200, ReceivedAt: time.Now().Add(-2 * time.Hour)}
+	require.NoError(t, c.Store().Save(ctx, old))
+
+	// The first delivery prunes those past the retention
+	post(c.Middleware("github")(http.NotFoundHandler()), "/hooks", "{}")
+	deliveries, err := c.Store().List(ctx, Filter{})
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.NotEqual(t, "old", deliveries[0].ID)
+	assert.Equal(t, http.StatusNotFound, deliveries[0].Status)
+}
@@ -0,0 +1,392 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/mrhoseah/dolphin/internal/correlation"
+	"github.com/mrhoseah/dolphin/internal/providers"
+)
+
+// JobType is the type of the queue jobs that run async steps
+const JobType = "workflow.step"
+
+// Engine starts, runs and resumes workflow instances
+type Engine struct {
+	store     Store
+	logger    *zap.Logger
+	lease     time.Duration
+	queue     providers.QueueProvider
+	queueName string
+
+	wg   sync.WaitGroup
+	stop chan struct{}
+	once sync.Once
+}
+
+// Default is the engine the application starts workflows with. It keeps
+// instances in memory until the router gives it the database store.
+var Default = NewEngine(nil, nil)
+
+// NewEngine creates an engine keeping instances in store, or in memory when
+// store is nil
+func NewEngine(store Store, logger *zap.Logger) *Engine {
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &Engine{
+		store:  store,
+		logger: logger,
+		lease:  5 * time.Minute,
+		stop:   make(chan struct{}),
+	}
+}
+
+// SetStore replaces the store; call it before starting workflows
+func (e *Engine) SetStore(store Store) {
+	e.store = store
+}
+
+// SetLogger replaces the logger
+func (e *Engine) SetLogger(logger *zap.Logger) {
+	e.logger = logger
+}
+
+// SetLease sets how long a worker may go without saving an instance before
+// it is presumed to have crashed and the instance is resumed elsewhere.
+// Steps that take longer than the lease may run twice.
+func (e *Engine) SetLease(lease time.Duration) {
+	if lease > 0 {
+		e.lease = lease
+	}
+}
+
+// UseQueue runs async steps through jobs pushed to the named queue. The
+// queue's workers must process them with JobHandler. Without a queue, async
+// steps run in a goroutine.
+func (e *Engine) UseQueue(queue providers.QueueProvider, name string) {
+	e.queue = queue
+	e.queueName = name
+}
+
+// Store returns the engine's store
+func (e *Engine) Store() Store {
+	return e.store
+}
+
+// Start creates an instance of a registered workflow with the given data
+// and runs its steps up to the first async one. A failing step isn't an
+// error: the instance is compensated and its Error says why.
+func (e *Engine) Start(ctx context.Context, name string, data map[string]interface{}) (*Instance, error) {
+	if _, ok := Lookup(name); !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknown, name)
+	}
+	instance := &Instance{ID: uuid.NewString(), Workflow: name, Status: StatusPending}
+	state := &State{instance: instance}
+	for key, value := range data {
+		if err := state.Set(key, value); err != nil {
+			return nil, err
+		}
+	}
+	if err := e.store.Create(ctx, instance); err != nil {
+		return nil, err
+	}
+	if err := e.run(ctx, instance.ID, false); err != nil {
+		return nil, err
+	}
+	return e.store.Get(ctx, instance.ID)
+}
+
+// Retry restarts a compensated instance from its first step, or resumes
+// compensating a failed one
+func (e *Engine) Retry(ctx context.Context, id string) (*Instance, error) {
+	instance, err := e.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	switch instance.Status {
+	case StatusCompensated:
+		instance.Status = StatusPending
+		instance.Step = 0
+		instance.Error = ""
+	case StatusFailed:
+		instance.Status = StatusCompensating
+	default:
+		return nil, fmt.Errorf("%w: %s is %s", ErrNotRetried, id, instance.Status)
+	}
+	instance.StepName = ""
+	instance.Attempts = 0
+	instance.LeaseUntil = time.Time{}
+	if err := e.store.Update(ctx, instance); err != nil {
+		return nil, err
+	}
+
+	// Processes that don't register the definition, like the CLI, leave the
+	// instance to the application's worker
+	if _, ok := Lookup(instance.Workflow); ok {
+		if err := e.run(ctx, id, false); err != nil {
+			return nil, err
+		}
+	}
+	return e.store.Get(ctx, id)
+}
+
+// Resume runs pending instances and those whose worker stopped saving them
+// before their lease ran out, typically because the process crashed.
+// Instances of workflows not registered in this process are left alone.
+func (e *Engine) Resume(ctx context.Context) error {
+	instances, err := e.store.List(ctx, Filter{Statuses: []Status{
+		StatusPending, StatusRunning, StatusWaiting, StatusCompensating,
+	}})
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	var errs []error
+	for _, instance := range instances {
+		if _, ok := Lookup(instance.Workflow); !ok {
+			continue
+		}
+		if instance.Status != StatusPending && now.Before(instance.LeaseUntil) {
+			continue
+		}
+		// A waiting instance whose job was lost runs its async step here
+		if err := e.run(ctx, instance.ID, instance.Status == StatusWaiting); err != nil && !errors.Is(err, ErrConflict) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Work resumes instances every interval until Close
+func (e *Engine) Work(interval time.Duration) {
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := e.Resume(context.Background()); err != nil {
+				e.logger.Error("Failed to resume workflows", zap.Error(err))
+			}
+			select {
+			case <-e.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Close stops Work and waits for async steps run in goroutines
+func (e *Engine) Close() {
+	e.once.Do(func() { close(e.stop) })
+	e.wg.Wait()
+}
+
+// JobHandler runs the async steps of the jobs pushed to the engine's queue
+func (e *Engine) JobHandler() providers.JobHandler {
+	return func(job providers.Job) error {
+		id, _ := job.Payload["workflow_id"].(string)
+		if job.Type != JobType || id == "" {
+			return fmt.Errorf("workflow: not a workflow job: %s", job.ID)
+		}
+		return correlation.Run(context.Background(), job.Correlation, "job "+job.Type, func(ctx context.Context) error {
+			return e.run(ctx, id, true)
+		})
+	}
+}
+
+// run claims an instance and runs it until it finishes or waits for an
+// async step. fromQueue is set when the async step it waits for should run
+// now. An instance claimed by another worker is left alone.
+func (e *Engine) run(ctx context.Context, id string, fromQueue bool) error {
+	instance, err := e.store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	def, ok := Lookup(instance.Workflow)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknown, instance.Workflow)
+	}
+
+	previous := instance.Status
+	expired := !time.Now().Before(instance.LeaseUntil)
+	switch previous {
+	case StatusPending:
+		instance.Status = StatusRunning
+	case StatusWaiting:
+		if !fromQueue && !expired {
+			return nil
+		}
+		instance.Status = StatusRunning
+	case StatusRunning, StatusCompensating:
+		if !expired {
+			return nil
+		}
+	default:
+		return nil
+	}
+	instance.LeaseUntil = time.Now().Add(e.lease)
+	if err := e.store.Update(ctx, instance); err != nil {
+		if errors.Is(err, ErrConflict) {
+			return nil
+		}
+		return err
+	}
+
+	logger := e.logger.With(zap.String("workflow", def.Name), zap.String("id", id))
+	state := &State{instance: instance}
+
+	// Only the step the instance was waiting for runs in this call, or the
+	// interrupted one after a crash; later async steps are queued again
+	allowAsync := previous == StatusWaiting || previous == StatusRunning
+	for instance.Status == StatusRunning && instance.Step < len(def.Steps) {
+		step := def.Steps[instance.Step]
+		instance.StepName = step.Name
+		if step.Async && !allowAsync {
+			return e.enqueue(ctx, instance)
+		}
+		allowAsync = false
+
+		if err := e.runStep(ctx, step, state, logger); err != nil {
+			logger.Warn("Workflow step failed", zap.String("step", step.Name), zap.Error(err))
+			instance.Status = StatusCompensating
+			instance.Error = fmt.Sprintf("%s: %v", step.Name, err)
+		} else {
+			instance.Step++
+		}
+		instance.Attempts = 0
+		if err := e.save(ctx, instance); err != nil {
+			return err
+		}
+	}
+
+	if instance.Status == StatusRunning {
+		instance.Status = StatusCompleted
+		instance.StepName = ""
+		instance.LeaseUntil = time.Time{}
+		return e.store.Update(ctx, instance)
+	}
+	return e.compensate(ctx, def, instance, state, logger)
+}
+
+// runStep runs a step, retrying it with backoff; attempts are saved so that
+// a resumed instance doesn't start them over
+func (e *Engine) runStep(ctx context.Context, step Step, state *State, logger *zap.Logger) error {
+	backoff := step.Backoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+	instance := state.instance
+	for {
+		err := call(ctx, step.Run, state)
+		if err == nil {
+			return nil
+		}
+		instance.Attempts++
+		if instance.Attempts > step.Retries {
+			return err
+		}
+		logger.Info("Retrying workflow step", zap.String("step", step.Name), zap.Int("attempt", instance.Attempts), zap.Error(err))
+		if err := e.save(ctx, instance); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff << (instance.Attempts - 1)):
+		}
+	}
+}
+
+// compensate undoes completed steps in reverse order
+func (e *Engine) compensate(ctx context.Context, def *Definition, instance *Instance, state *State, logger *zap.Logger) error {
+	for instance.Step > 0 {
+		if instance.Step > len(def.Steps) {
+			instance.Step = len(def.Steps)
+		}
+		step := def.Steps[instance.Step-1]
+		instance.StepName = step.Name
+		if step.Compensate != nil {
+			if err := call(ctx, step.Compensate, state); err != nil {
+				logger.Error("Workflow compensation failed", zap.String("step", step.Name), zap.Error(err))
+				instance.Status = StatusFailed
+				instance.Error = joinError(instance.Error, fmt.Sprintf("compensating %s: %v", step.Name, err))
+				instance.LeaseUntil = time.Time{}
+				return e.store.Update(ctx, instance)
+			}
+		}
+		instance.Step--
+		if err := e.save(ctx, instance); err != nil {
+			return err
+		}
+	}
+	instance.Status = StatusCompensated
+	instance.StepName = ""
+	instance.LeaseUntil = time.Time{}
+	return e.store.Update(ctx, instance)
+}
+
+// enqueue hands the current async step to the queue, or to a goroutine
+func (e *Engine) enqueue(ctx context.Context, instance *Instance) error {
+	instance.Status = StatusWaiting
+	instance.LeaseUntil = time.Now().Add(e.lease)
+	if err := e.store.Update(ctx, instance); err != nil {
+		return err
+	}
+	if e.queue == nil {
+		e.wg.Add(1)
+		go func() {
+			defer e.wg.Done()
+			if err := e.run(context.WithoutCancel(ctx), instance.ID, true); err != nil {
+				e.logger.Error("Workflow async step failed", zap.String("id", instance.ID), zap.Error(err))
+			}
+		}()
+		return nil
+	}
+	// If the push fails the instance stays waiting and is resumed once its
+	// lease runs out
+	err := e.queue.Push(e.queueName, providers.Job{
+		ID:          instance.ID + ":" + instance.StepName,
+		Type:        JobType,
+		Payload:     map[string]interface{}{"workflow_id": instance.ID, "step": instance.StepName},
+		Correlation: correlation.Capture(ctx),
+	})
+	if err != nil {
+		e.logger.Warn("Failed to queue workflow step", zap.String("id", instance.ID), zap.Error(err))
+	}
+	return nil
+}
+
+// save persists progress and renews the lease
+func (e *Engine) save(ctx context.Context, instance *Instance) error {
+	instance.LeaseUntil = time.Now().Add(e.lease)
+	return e.store.Update(ctx, instance)
+}
+
+// call runs fn, turning panics into errors
+func call(ctx context.Context, fn StepFunc, state *State) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn(ctx, state)
+}
+
+func joinError(first, second string) string {
+	if first == "" {
+		return second
+	}
+	return first + "; " + second
+}
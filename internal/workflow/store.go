@@ -0,0 +1,296 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Store persists workflow instances
+type Store interface {
+	// Create saves a new instance
+	Create(ctx context.Context, instance *Instance) error
+
+	// Get returns an instance, or ErrNotFound
+	Get(ctx context.Context, id string) (*Instance, error)
+
+	// Update saves an instance if its Version is still the stored one and
+	// increments it; otherwise it returns ErrConflict
+	Update(ctx context.Context, instance *Instance) error
+
+	// List returns instances matching the filter, most recently updated
+	// first
+	List(ctx context.Context, filter Filter) ([]Instance, error)
+}
+
+// Filter selects instances. Zero fields match everything.
+type Filter struct {
+	Workflow string
+	Statuses []Status
+	Limit    int
+}
+
+func (f Filter) matches(instance *Instance) bool {
+	if f.Workflow != "" && instance.Workflow != f.Workflow {
+		return false
+	}
+	if len(f.Statuses) == 0 {
+		return true
+	}
+	for _, status := range f.Statuses {
+		if instance.Status == status {
+			return true
+		}
+	}
+	return false
+}
+
+// MemoryStore keeps instances in memory, for tests and workflows that
+// needn't survive a restart
+type MemoryStore struct {
+	mu        sync.Mutex
+	instances map[string]Instance
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{instances: make(map[string]Instance)}
+}
+
+func (s *MemoryStore) Create(ctx context.Context, instance *Instance) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	instance.Version = 1
+	instance.CreatedAt, instance.UpdatedAt = now, now
+	s.instances[instance.ID] = copyInstance(*instance)
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (*Instance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	instance, ok := s.instances[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	instance = copyInstance(instance)
+	return &instance, nil
+}
+
+func (s *MemoryStore) Update(ctx context.Context, instance *Instance) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.instances[instance.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if stored.Version != instance.Version {
+		return ErrConflict
+	}
+	instance.Version++
+	instance.UpdatedAt = time.Now()
+	s.instances[instance.ID] = copyInstance(*instance)
+	return nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, filter Filter) ([]Instance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var instances []Instance
+	for _, instance := range s.instances {
+		if filter.matches(&instance) {
+			instances = append(instances, copyInstance(instance))
+		}
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].UpdatedAt.After(instances[j].UpdatedAt)
+	})
+	if filter.Limit > 0 && len(instances) > filter.Limit {
+		instances = instances[:filter.Limit]
+	}
+	return instances, nil
+}
+
+// copyInstance copies the data map too, so callers can't change stored
+// instances
+func copyInstance(instance Instance) Instance {
+	if instance.Data != nil {
+		data := make(map[string]json.RawMessage, len(instance.Data))
+		for key, value := range instance.Data {
+			data[key] = value
+		}
+		instance.Data = data
+	}
+	return instance
+}
+
+// InstanceRecord is the row DBStore keeps per instance
+type InstanceRecord struct {
+	ID         string    `gorm:"primarykey;size:36"`
+	Workflow   string    `gorm:"size:100;index;not null"`
+	Status     string    `gorm:"size:20;index;not null"`
+	Step       int       `gorm:"not null"`
+	StepName   string    `gorm:"size:100"`
+	Attempts   int       `gorm:"not null"`
+	Data       string    `gorm:"type:text"`
+	Error      string    `gorm:"type:text"`
+	LeaseUntil time.Time `gorm:"index"`
+	Version    int       `gorm:"not null"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time `gorm:"index"`
+}
+
+// TableName returns the table name for the InstanceRecord model
+func (InstanceRecord) TableName() string {
+	return "workflow_instances"
+}
+
+// DBStore keeps instances in the application database
+type DBStore struct {
+	db *gorm.DB
+}
+
+// NewDBStore creates a database instance store, creating its table if
+// needed
+func NewDBStore(db *gorm.DB) (*DBStore, error) {
+	if err := db.AutoMigrate(&InstanceRecord{}); err != nil {
+		return nil, err
+	}
+	return &DBStore{db: db}, nil
+}
+
+func (s *DBStore) Create(ctx context.Context, instance *Instance) error {
+	now := time.Now().UTC()
+	instance.Version = 1
+	instance.CreatedAt, instance.UpdatedAt = now, now
+	record, err := toRecord(instance)
+	if err != nil {
+		return err
+	}
+	return s.db.WithContext(ctx).Create(&record).Error
+}
+
+func (s *DBStore) Get(ctx context.Context, id string) (*Instance, error) {
+	var record InstanceRecord
+	err := s.db.WithContext(ctx).Where("id = ?", id).First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fromRecord(record)
+}
+
+func (s *DBStore) Update(ctx context.Context, instance *Instance) error {
+	data, err := json.Marshal(instance.Data)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	result := s.db.WithContext(ctx).Model(&InstanceRecord{}).
+		Where("id = ? AND version = ?", instance.ID, instance.Version).
+		Updates(map[string]interface{}{
+			"status":      string(instance.Status),
+			"step":        instance.Step,
+			"step_name":   instance.StepName,
+			"attempts":    instance.Attempts,
+			"data":        string(data),
+			"error":       instance.Error,
+			"lease_until": instance.LeaseUntil.UTC(),
+			"version":     instance.Version + 1,
+			"updated_at":  now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		if _, err := s.Get(ctx, instance.ID); err != nil {
+			return err
+		}
+		return ErrConflict
+	}
+	instance.Version++
+	instance.UpdatedAt = now
+	return nil
+}
+
+func (s *DBStore) List(ctx context.Context, filter Filter) ([]Instance, error) {
+	q := s.db.WithContext(ctx).Model(&InstanceRecord{})
+	if filter.Workflow != "" {
+		q = q.Where("workflow = ?", filter.Workflow)
+	}
+	if len(filter.Statuses) > 0 {
+		statuses := make([]string, len(filter.Statuses))
+		for i, status := range filter.Statuses {
+			statuses[i] = string(status)
+		}
+		q = q.Where("status IN ?", statuses)
+	}
+	if filter.Limit > 0 {
+		q = q.Limit(filter.Limit)
+	}
+
+	var records []InstanceRecord
+	if err := q.Order("updated_at DESC").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	instances := make([]Instance, 0, len(records))
+	for _, record := range records {
+		instance, err := fromRecord(record)
+		if err != nil {
+			return nil, err
+		}
+		instances = append(instances, *instance)
+	}
+	return instances, nil
+}
+
+func toRecord(instance *Instance) (InstanceRecord, error) {
+	data, err := json.Marshal(instance.Data)
+	if err != nil {
+		return InstanceRecord{}, err
+	}
+	return InstanceRecord{
+		ID:         instance.ID,
+		Workflow:   instance.Workflow,
+		Status:     string(instance.Status),
+		Step:       instance.Step,
+		StepName:   instance.StepName,
+		Attempts:   instance.Attempts,
+		Data:       string(data),
+		Error:      instance.Error,
+		LeaseUntil: instance.LeaseUntil.UTC(),
+		Version:    instance.Version,
+		CreatedAt:  instance.CreatedAt,
+		UpdatedAt:  instance.UpdatedAt,
+	}, nil
+}
+
+func fromRecord(record InstanceRecord) (*Instance, error) {
+	instance := &Instance{
+		ID:         record.ID,
+		Workflow:   record.Workflow,
+		Status:     Status(record.Status),
+		Step:       record.Step,
+		StepName:   record.StepName,
+		Attempts:   record.Attempts,
+		Error:      record.Error,
+		LeaseUntil: record.LeaseUntil,
+		Version:    record.Version,
+		CreatedAt:  record.CreatedAt,
+		UpdatedAt:  record.UpdatedAt,
+	}
+	if record.Data != "" && record.Data != "null" {
+		if err := json.Unmarshal([]byte(record.Data), &instance.Data); err != nil {
+			return nil, err
+		}
+	}
+	return instance, nil
+}
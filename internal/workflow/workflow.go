@@ -0,0 +1,195 @@
+// Package workflow runs multi-step business processes as sagas. Each step
+// may have a compensation that undoes it; when a step fails for good, the
+// steps before it are compensated in reverse order. Instances are persisted
+// after every step so that a crashed process is resumed by another worker:
+//
+//	workflow.Register(workflow.Define("order.process",
+//		workflow.Step{Name: "reserve", Run: reserveStock, Compensate: releaseStock},
+//		workflow.Step{Name: "charge", Run: chargeCard, Compensate: refundCard, Retries: 3},
+//		workflow.Step{Name: "ship", Run: createShipment, Async: true},
+//	))
+//	instance, err := workflow.Default.Start(ctx, "order.process", map[string]interface{}{"order_id": order.ID})
+//
+// A step may run more than once, after a crash or a retry, so steps and
+// compensations must be idempotent.
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Status is the state of a workflow instance
+type Status string
+
+const (
+	// StatusPending instances wait for a worker, after Start or Retry
+	StatusPending Status = "pending"
+	// StatusRunning instances are running their steps
+	StatusRunning Status = "running"
+	// StatusWaiting instances have an async step queued
+	StatusWaiting Status = "waiting"
+	// StatusCompleted instances ran every step
+	StatusCompleted Status = "completed"
+	// StatusCompensating instances are undoing their completed steps
+	StatusCompensating Status = "compensating"
+	// StatusCompensated instances had a step fail and every step before it
+	// undone
+	StatusCompensated Status = "compensated"
+	// StatusFailed instances had a compensation fail; Retry continues
+	// compensating
+	StatusFailed Status = "failed"
+)
+
+// Finished reports whether no more work is scheduled for the status
+func (s Status) Finished() bool {
+	return s == StatusCompleted || s == StatusCompensated || s == StatusFailed
+}
+
+// StepFunc runs or compensates a step
+type StepFunc func(ctx context.Context, state *State) error
+
+// Step is one step of a workflow
+type Step struct {
+	Name string
+	Run  StepFunc
+
+	// Compensate undoes Run when a later step fails; nil when there is
+	// nothing to undo. The failing step itself isn't compensated.
+	Compensate StepFunc
+
+	// Async runs the step through the engine's queue rather than in the
+	// caller of Start
+	Async bool
+
+	// Retries is how many more times Run is tried after failing, waiting
+	// Backoff (default 1s), doubled each time, in between
+	Retries int
+	Backoff time.Duration
+}
+
+// Definition is a named sequence of steps
+type Definition struct {
+	Name  string
+	Steps []Step
+}
+
+// Define creates a definition
+func Define(name string, steps ...Step) *Definition {
+	return &Definition{Name: name, Steps: steps}
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]*Definition{}
+)
+
+// Register makes a definition available to every engine. Registering a
+// name again replaces its definition.
+func Register(def *Definition) {
+	if def.Name == "" {
+		panic("workflow: definition without a name")
+	}
+	for i, step := range def.Steps {
+		if step.Name == "" || step.Run == nil {
+			panic(fmt.Sprintf("workflow: %s step %d needs a name and a Run function", def.Name, i))
+		}
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[def.Name] = def
+}
+
+// Lookup returns a registered definition
+func Lookup(name string) (*Definition, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	def, ok := registry[name]
+	return def, ok
+}
+
+// Registered lists the names of registered definitions
+func Registered() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Instance is one run of a workflow
+type Instance struct {
+	ID       string
+	Workflow string
+	Status   Status
+
+	// Step is the index of the next step to run; while compensating it is
+	// the number of steps still to undo
+	Step     int
+	StepName string
+
+	// Attempts counts failed tries of the current step
+	Attempts int
+	Data     map[string]json.RawMessage
+	Error    string
+
+	// LeaseUntil is when a worker that stopped touching the instance is
+	// presumed to have crashed
+	LeaseUntil time.Time
+
+	// Version increases with every update, so that concurrent workers
+	// can't both claim an instance
+	Version   int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// State is the data steps share, persisted with the instance
+type State struct {
+	instance *Instance
+}
+
+// ID returns the instance ID, e.g. as an idempotency key for payment APIs
+func (s *State) ID() string {
+	return s.instance.ID
+}
+
+// Get decodes the value stored under key into dest. It returns ErrNoValue
+// when nothing is stored under key.
+func (s *State) Get(key string, dest interface{}) error {
+	raw, ok := s.instance.Data[key]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNoValue, key)
+	}
+	return json.Unmarshal(raw, dest)
+}
+
+// Set stores value under key for later steps and compensations
+func (s *State) Set(key string, value interface{}) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("workflow: can't store %s: %w", key, err)
+	}
+	if s.instance.Data == nil {
+		s.instance.Data = map[string]json.RawMessage{}
+	}
+	s.instance.Data[key] = raw
+	return nil
+}
+
+// Errors returned by engines, stores and State
+var (
+	ErrNotFound   = errors.New("workflow: instance not found")
+	ErrConflict   = errors.New("workflow: instance was updated by another worker")
+	ErrNoValue    = errors.New("workflow: no value")
+	ErrUnknown    = errors.New("workflow: unknown workflow")
+	ErrNotRetried = errors.New("workflow: only compensated and failed instances can be retried")
+)
@@ -0,0 +1,268 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrhoseah/dolphin/internal/config"
+	"github.com/mrhoseah/dolphin/internal/database"
+	"github.com/mrhoseah/dolphin/internal/providers"
+)
+
+// recorder notes the steps and compensations a workflow runs
+type recorder struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (r *recorder) step(name string, err error) StepFunc {
+	return func(ctx context.Context, state *State) error {
+		r.mu.Lock()
+		r.calls = append(r.calls, name)
+		r.mu.Unlock()
+		return err
+	}
+}
+
+func (r *recorder) list() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.calls...)
+}
+
+func TestCompletes(t *testing.T) {
+	rec := &recorder{}
+	Register(Define(t.Name(),
+		Step{Name: "reserve", Run: func(ctx context.Context, state *State) error {
+			var orderID int
+			require.NoError(t, state.Get("order_id", &orderID))
+			return state.Set("reservation", orderID*10)
+		}},
+		Step{Name: "charge", Run: func(ctx context.Context, state *State) error {
+			var reservation int
+			require.NoError(t, state.Get("reservation", &reservation))
+			assert.Equal(t, 420, reservation)
+			assert.ErrorIs(t, state.Get("missing", &reservation), ErrNoValue)
+			return rec.step("charge", nil)(ctx, state)
+		}},
+	))
+
+	engine := NewEngine(nil, nil)
+	instance, err := engine.Start(context.Background(), t.Name(), map[string]interface{}{"order_id": 42})
+	require.NoError(t, err)
+	assert.Equal(t, StatusCompleted, instance.Status)
+	assert.Equal(t, 2, instance.Step)
+	assert.True(t, instance.LeaseUntil.IsZero())
+	assert.Equal(t, []string{"charge"}, rec.list())
+
+	_, err = engine.Start(context.Background(), "missing", nil)
+	assert.ErrorIs(t, err, ErrUnknown)
+}
+
+func TestCompensatesInReverse(t *testing.T) {
+	rec := &recorder{}
+	attempts := 0
+	Register(Define(t.Name(),
+		Step{Name: "reserve", Run: rec.step("reserve", nil), Compensate: rec.step("release", nil)},
+		Step{Name: "notify", Run: rec.step("notify", nil)},
+		Step{Name: "charge", Run: rec.step("charge", nil), Compensate: rec.step("refund", nil)},
+		Step{Name: "ship", Retries: 2, Backoff: time.Millisecond, Run: func(ctx context.Context, state *State) error {
+			attempts++
+			return errors.New("carrier down")
+		}, Compensate: rec.step("unship", nil)},
+	))
+
+	instance, err := NewEngine(nil, nil).Start(context.Background(), t.Name(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, StatusCompensated, instance.Status)
+	assert.Equal(t, "ship: carrier down", instance.Error)
+	assert.Equal(t, 0, instance.Step)
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, []string{"reserve", "notify", "charge", "refund", "release"}, rec.list(),
+		"the failing step isn't compensated")
+}
+
+func TestFailedCompensationRetries(t *testing.T) {
+	rec := &recorder{}
+	refundErr := errors.New("gateway down")
+	Register(Define(t.Name(),
+		Step{Name: "reserve", Run: rec.step("reserve", nil), Compensate: rec.step("release", nil)},
+		Step{Name: "charge", Run: rec.step("charge", nil), Compensate: func(ctx context.Context, state *State) error {
+			return rec.step("refund", refundErr)(ctx, state)
+		}},
+		Step{Name: "ship", Run: func(ctx context.Context, state *State) error { panic("boom") }},
+	))
+
+	engine := NewEngine(nil, nil)
+	instance, err := engine.Start(context.Background(), t.Name(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, StatusFailed, instance.Status)
+	assert.Equal(t, "ship: panic: boom; compensating charge: gateway down", instance.Error)
+
+	refundErr = nil
+	instance, err = engine.Retry(context.Background(), instance.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusCompensated, instance.Status)
+	assert.Equal(t, []string{"reserve", "charge", "refund", "refund", "release"}, rec.list())
+
+	// A compensated instance starts over
+	instance, err = engine.Retry(context.Background(), instance.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusCompensated, instance.Status)
+	assert.Equal(t, "ship: panic: boom", instance.Error)
+
+	Register(Define(t.Name()+"/done", Step{Name: "noop", Run: rec.step("noop", nil)}))
+	done, err := engine.Start(context.Background(), t.Name()+"/done", nil)
+	require.NoError(t, err)
+	_, err = engine.Retry(context.Background(), done.ID)
+	assert.ErrorIs(t, err, ErrNotRetried)
+	_, err = engine.Retry(context.Background(), "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+// fakeQueue records pushed jobs
+type fakeQueue struct {
+	providers.QueueProvider
+	jobs []providers.Job
+}
+
+func (q *fakeQueue) Push(queue string, job providers.Job) error {
+	q.jobs = append(q.jobs, job)
+	return nil
+}
+
+func TestAsyncSteps(t *testing.T) {
+	rec := &recorder{}
+	Register(Define(t.Name(),
+		Step{Name: "reserve", Run: rec.step("reserve", nil)},
+		Step{Name: "label", Run: rec.step("label", nil), Async: true},
+		Step{Name: "ship", Run: rec.step("ship", nil), Async: true},
+		Step{Name: "email", Run: rec.step("email", nil)},
+	))
+	ctx := context.Background()
+
+	t.Run("queue", func(t *testing.T) {
+		rec.calls = nil
+		queue := &fakeQueue{}
+		engine := NewEngine(nil, nil)
+		engine.UseQueue(queue, "workflows")
+
+		instance, err := engine.Start(ctx, "TestAsyncSteps", nil)
+		require.NoError(t, err)
+		assert.Equal(t, StatusWaiting, instance.Status)
+		assert.Equal(t, "label", instance.StepName)
+		require.Len(t, queue.jobs, 1)
+		assert.Equal(t, JobType, queue.jobs[0].Type)
+
+		handle := engine.JobHandler()
+		require.NoError(t, handle(queue.jobs[0]))
+		instance, err = engine.store.Get(ctx, instance.ID)
+		require.NoError(t, err)
+		assert.Equal(t, StatusWaiting, instance.Status, "each async step is queued")
+		require.Len(t, queue.jobs, 2)
+
+		// A job delivered twice finds nothing to do
+		require.NoError(t, handle(queue.jobs[0]))
+		require.NoError(t, handle(queue.jobs[1]))
+		instance, err = engine.store.Get(ctx, instance.ID)
+		require.NoError(t, err)
+		assert.Equal(t, StatusCompleted, instance.Status)
+		assert.Equal(t, []string{"reserve", "label", "ship", "email"}, rec.list())
+	})
+
+	t.Run("goroutine", func(t *testing.T) {
+		rec.calls = nil
+		engine := NewEngine(nil, nil)
+		instance, err := engine.Start(ctx, "TestAsyncSteps", nil)
+		require.NoError(t, err)
+		engine.Close()
+		instance, err = engine.store.Get(ctx, instance.ID)
+		require.NoError(t, err)
+		assert.Equal(t, StatusCompleted, instance.Status)
+		assert.Equal(t, []string{"reserve", "label", "ship", "email"}, rec.list())
+	})
+}
+
+func TestResumeAfterCrash(t *testing.T) {
+	rec := &recorder{}
+	Register(Define(t.Name(),
+		Step{Name: "reserve", Run: rec.step("reserve", nil)},
+		Step{Name: "charge", Run: rec.step("charge", nil)},
+	))
+	ctx := context.Background()
+	store := NewMemoryStore()
+	engine := NewEngine(store, nil)
+
+	// A worker died after reserving; another holds a live lease
+	crashed := &Instance{ID: "crashed", Workflow: t.Name(), Status: StatusRunning, Step: 1, LeaseUntil: time.Now().Add(-time.Second)}
+	busy := &Instance{ID: "busy", Workflow: t.Name(), Status: StatusRunning, Step: 1, LeaseUntil: time.Now().Add(time.Minute)}
+	unknown := &Instance{ID: "unknown", Workflow: "elsewhere", Status: StatusPending}
+	for _, instance := range []*Instance{crashed, busy, unknown} {
+		require.NoError(t, store.Create(ctx, instance))
+	}
+
+	require.NoError(t, engine.Resume(ctx))
+	assert.Equal(t, []string{"charge"}, rec.list())
+	for id, status := range map[string]Status{"crashed": StatusCompleted, "busy": StatusRunning, "unknown": StatusPending} {
+		instance, err := store.Get(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, status, instance.Status, id)
+	}
+
+	// Stale copies can't be saved over newer ones
+	stale := *busy
+	stale.Version = 1
+	require.NoError(t, store.Update(ctx, busy))
+	assert.ErrorIs(t, store.Update(ctx, &stale), ErrConflict)
+}
+
+func TestDBStore(t *testing.T) {
+	db, err := database.New(&config.DatabaseConfig{Driver: "sqlite", Database: filepath.Join(t.TempDir(), "app.db")})
+	require.NoError(t, err)
+	defer db.Close()
+	store, err := NewDBStore(db.GetDB())
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	instance := &Instance{ID: "order-1", Workflow: "order.process", Status: StatusPending}
+	require.NoError(t, (&State{instance: instance}).Set("order_id", 42))
+	require.NoError(t, store.Create(ctx, instance))
+	require.NoError(t, store.Create(ctx, &Instance{ID: "order-2", Workflow: "order.process", Status: StatusCompleted}))
+
+	instance.Status = StatusRunning
+	instance.Step = 1
+	instance.LeaseUntil = time.Now().Add(time.Minute)
+	require.NoError(t, store.Update(ctx, instance))
+	assert.Equal(t, 2, instance.Version)
+
+	saved, err := store.Get(ctx, "order-1")
+	require.NoError(t, err)
+	assert.Equal(t, StatusRunning, saved.Status)
+	assert.Equal(t, 1, saved.Step)
+	assert.WithinDuration(t, instance.LeaseUntil, saved.LeaseUntil, time.Millisecond)
+	var orderID int
+	require.NoError(t, (&State{instance: saved}).Get("order_id", &orderID))
+	assert.Equal(t, 42, orderID)
+
+	stale := *saved
+	stale.Version = 1
+	assert.ErrorIs(t, store.Update(ctx, &stale), ErrConflict)
+	assert.ErrorIs(t, store.Update(ctx, &Instance{ID: "missing"}), ErrNotFound)
+	_, err = store.Get(ctx, "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	instances, err := store.List(ctx, Filter{Statuses: []Status{StatusRunning, StatusPending}})
+	require.NoError(t, err)
+	require.Len(t, instances, 1)
+	assert.Equal(t, "order-1", instances[0].ID)
+	instances, err = store.List(ctx, Filter{Workflow: "order.process", Limit: 1})
+	require.NoError(t, err)
+	assert.Len(t, instances, 1)
+}
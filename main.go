@@ -35,6 +35,9 @@ import (
 	"github.com/mrhoseah/dolphin/internal/database"
 	"github.com/mrhoseah/dolphin/internal/logger"
 	"github.com/mrhoseah/dolphin/internal/router"
+	"github.com/mrhoseah/dolphin/internal/startup"
+	// Generated migrations register themselves from init
+	_ "github.com/mrhoseah/dolphin/migrations"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
 )
@@ -64,18 +67,22 @@ func main() {
 		Short: "Run database migrations",
 		Run:   migrate,
 	}
+	migrateCmd.Flags().String("database", "", "Only run migrations targeting this connection (default: every connection)")
 
 	var rollbackCmd = &cobra.Command{
 		Use:   "rollback",
 		Short: "Rollback the last batch of migrations",
 		Run:   rollback,
 	}
+	rollbackCmd.Flags().Bool("force-data-loss", false, "Roll back even if Down drops tables or columns that hold data")
+	rollbackCmd.Flags().String("database", database.DefaultConnection, "Connection whose migrations to roll back")
 
 	var statusCmd = &cobra.Command{
 		Use:   "status",
 		Short: "Show migration status",
 		Run:   status,
 	}
+	statusCmd.Flags().String("database", "", "Only show migrations targeting this connection (default: every connection)")
 
 	// Make commands
 	var makeControllerCmd = &cobra.Command{
@@ -137,25 +144,66 @@ func main() {
 }
 
 func serve(cmd *cobra.Command, args []string) {
-	// Initialize logger
-	logger := logger.New(cfg.Log.Level, cfg.Log.Format)
+	// Initialize logger; its level can change while serving
+	logLevel := zap.NewAtomicLevelAt(logger.ParseLevel(cfg.Log.Level))
+	logger := logger.NewWithLevel(logLevel, cfg.Log.Format)
 
-	// Initialize database
-	db, err := database.New(&cfg.Database)
+	// Dependencies are waited for as startup.policy says
+	waiter, err := startup.New(cfg.Startup, logger)
 	if err != nil {
-		logger.Fatal("Failed to connect to database", zap.Error(err))
+		logger.Fatal("Invalid startup config", zap.Error(err))
 	}
+	connectCtx, stopConnecting := context.WithCancel(context.Background())
+	defer stopConnecting()
+
+	// SIGHUP re-reads the config for a new log level
+	app.ReloadLogLevelOnSIGHUP(connectCtx, logLevel, logger)
+
+	handler := waiter.Handler()
+	booted := make(chan app.Booted, 1)
+	boot := func() {
+		// Initialize database
+		db, err := waiter.Connect(connectCtx, cfg)
+		if err != nil {
+			if connectCtx.Err() != nil {
+				return
+			}
+			logger.Fatal("Failed to connect to dependencies", zap.Error(err))
+		}
 
-	// Initialize application
-	app := app.New(cfg, logger, db)
+		// Initialize application
+		application := app.New(cfg, logger, db)
+		application.SetLogLevel(logLevel)
+
+		// Initialize router
+		r := router.New(application)
+
+		// Prometheus metrics on their own port
+		metricsSrv := r.MetricsServer()
+		if metricsSrv != nil {
+			go func() {
+				logger.Info("📊 Metrics", zap.String("url", cfg.Metrics.URL()))
+				if err := metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					logger.Error("Failed to start metrics server", zap.Error(err))
+				}
+			}()
+		}
 
-	// Initialize router
-	r := router.New(app)
+		handler.Ready(r)
+		booted <- app.Booted{Router: r, Metrics: metricsSrv}
+	}
+
+	// Degraded startup listens first, reporting not-ready until connected
+	if waiter.Degraded() {
+		go boot()
+	} else {
+		boot()
+	}
 
 	// Create HTTP server
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%d", cfg.Server.Port),
-		Handler:      r,
+		Handler:      handler,
 		ReadTimeout:  time.Duration(cfg.Server.ReadTimeout) * time.Second,
 		WriteTimeout: time.Duration(cfg.Server.WriteTimeout) * time.Second,
 		IdleTimeout:  time.Duration(cfg.Server.IdleTimeout) * time.Second,
@@ -174,6 +222,7 @@ func serve(cmd *cobra.Command, args []string) {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
+	stopConnecting()
 
 	logger.Info("Shutting down server...")
 
@@ -184,40 +233,59 @@ func serve(cmd *cobra.Command, args []string) {
 	if err := srv.Shutdown(ctx); err != nil {
 		logger.Fatal("Server forced to shutdown", zap.Error(err))
 	}
+	select {
+	case b := <-booted:
+		b.Shutdown(ctx, logger)
+	default:
+	}
 
 	logger.Info("Server exited")
 }
 
 func migrate(cmd *cobra.Command, args []string) {
 	logger := logger.New(cfg.Log.Level, cfg.Log.Format)
-	db, err := database.New(&cfg.Database)
-	if err != nil {
-		logger.Fatal("Failed to connect to database", zap.Error(err))
-	}
 
-	migrator := database.NewMigrator(db.GetSQLDB(), "migrations")
-	result := migrator.Migrate()
+	connection, _ := cmd.Flags().GetString("database")
+	for _, name := range app.MigrationConnections(&cfg.Database, connection) {
+		db, err := database.NewConnection(&cfg.Database, name)
+		if err != nil {
+			logger.Fatal("Failed to connect to database", zap.String("connection", name), zap.Error(err))
+		}
 
-	if result.Message != "" {
-		logger.Info(result.Message)
-	}
-	if len(result.Executed) > 0 {
-		logger.Info("Executed migrations", zap.Any("migrations", result.Executed))
-		logger.Info("Batch", zap.Int("batch", result.Batch))
+		result := db.Migrator("migrations").Migrate()
+		db.Close()
+
+		if result.Message != "" {
+			logger.Info(result.Message, zap.String("connection", name))
+		}
+		if len(result.Executed) > 0 {
+			logger.Info("Executed migrations", zap.String("connection", name), zap.Any("migrations", result.Executed))
+			logger.Info("Batch", zap.Int("batch", result.Batch))
+		}
 	}
 }
 
 func rollback(cmd *cobra.Command, args []string) {
 	logger := logger.New(cfg.Log.Level, cfg.Log.Format)
-	db, err := database.New(&cfg.Database)
+	connection, _ := cmd.Flags().GetString("database")
+	db, err := database.NewConnection(&cfg.Database, connection)
 	if err != nil {
 		logger.Fatal("Failed to connect to database", zap.Error(err))
 	}
+	defer db.Close()
 
-	migrator := database.NewMigrator(db.GetSQLDB(), "migrations")
+	force, _ := cmd.Flags().GetBool("force-data-loss")
+	migrator := db.Migrator("migrations")
+	migrator.ForceDataLoss = force
 	result := migrator.Rollback()
+	if result.Blocked {
+		logger.Fatal(result.Message)
+	}
 
 	logger.Info(result.Message)
+	for _, loss := range result.DataLoss {
+		logger.Warn("Dropped data", zap.String("detail", loss.String()))
+	}
 	if len(result.RolledBack) > 0 {
 		logger.Info("Rolled back migrations", zap.Any("migrations", result.RolledBack))
 		logger.Info("Batch", zap.Int("batch", result.Batch))
@@ -226,17 +294,20 @@ func rollback(cmd *cobra.Command, args []string) {
 
 func status(cmd *cobra.Command, args []string) {
 	logger := logger.New(cfg.Log.Level, cfg.Log.Format)
-	db, err := database.New(&cfg.Database)
-	if err != nil {
-		logger.Fatal("Failed to connect to database", zap.Error(err))
-	}
-
-	migrator := database.NewMigrator(db.GetSQLDB(), "migrations")
-	status := migrator.Status()
 
 	logger.Info("Migration Status:")
-	for _, s := range status {
-		logger.Info("Migration status", zap.String("migration", s.Migration), zap.String("status", s.Status), zap.Any("batch", s.Batch))
+	connection, _ := cmd.Flags().GetString("database")
+	for _, name := range app.MigrationConnections(&cfg.Database, connection) {
+		db, err := database.NewConnection(&cfg.Database, name)
+		if err != nil {
+			logger.Fatal("Failed to connect to database", zap.String("connection", name), zap.Error(err))
+		}
+		status := db.Migrator("migrations").Status()
+		db.Close()
+
+		for _, s := range status {
+			logger.Info("Migration status", zap.String("connection", name), zap.String("migration", s.Migration), zap.String("status", s.Status), zap.Any("batch", s.Batch))
+		}
 	}
 }
 